@@ -1,6 +1,7 @@
 package acme
 
 import (
+	"context"
 	"crypto"
 	"encoding/base64"
 	"encoding/json"
@@ -106,14 +107,59 @@ func (p *Policy) AreWildcardNamesAllowed() bool {
 
 // ExternalAccountKey is an ACME External Account Binding key.
 type ExternalAccountKey struct {
-	ID            string    `json:"id"`
-	ProvisionerID string    `json:"provisionerID"`
-	Reference     string    `json:"reference"`
-	AccountID     string    `json:"-"`
-	HmacKey       []byte    `json:"-"`
-	CreatedAt     time.Time `json:"createdAt"`
-	BoundAt       time.Time `json:"boundAt,omitempty"`
-	Policy        *Policy   `json:"policy,omitempty"`
+	ID            string                  `json:"id"`
+	ProvisionerID string                  `json:"provisionerID"`
+	Reference     string                  `json:"reference"`
+	AccountID     string                  `json:"-"`
+	HmacKey       []byte                  `json:"-"`
+	CreatedAt     time.Time               `json:"createdAt"`
+	BoundAt       time.Time               `json:"boundAt,omitempty"`
+	ExpiresAt     time.Time               `json:"expiresAt,omitempty"`
+	RevokedAt     time.Time               `json:"revokedAt,omitempty"`
+	Policy        *Policy                 `json:"policy,omitempty"`
+	Stats         ExternalAccountKeyStats `json:"stats"`
+}
+
+// ExternalAccountKeyStats contains the issuance statistics of the account
+// bound to an External Account Binding key.
+type ExternalAccountKeyStats struct {
+	Orders       int       `json:"orders"`
+	Certificates int       `json:"certificates"`
+	LastIssuedAt time.Time `json:"lastIssuedAt,omitempty"`
+}
+
+// ExternalAccountKeyStatsRecorder is the interface implemented by the
+// databases that keep the issuance statistics of the External Account Binding
+// keys.
+type ExternalAccountKeyStatsRecorder interface {
+	// AddExternalAccountKeyStats adds the orders and certificates in stats to
+	// the statistics of the given key. The last issuance time is updated if
+	// the one in stats is later.
+	AddExternalAccountKeyStats(ctx context.Context, provisionerID, keyID string, stats ExternalAccountKeyStats) error
+}
+
+// IsRevoked returns whether this EAK has been revoked.
+func (eak *ExternalAccountKey) IsRevoked() bool {
+	return !eak.RevokedAt.IsZero()
+}
+
+// IsExpired returns whether this EAK has expired at the given time.
+func (eak *ExternalAccountKey) IsExpired(now time.Time) bool {
+	return !eak.ExpiresAt.IsZero() && !now.Before(eak.ExpiresAt)
+}
+
+// CheckUsable returns an error if the EAK has been revoked or it has expired, in
+// which case it cannot be bound to new accounts and the accounts bound to it
+// cannot create new orders.
+func (eak *ExternalAccountKey) CheckUsable(now time.Time) error {
+	switch {
+	case eak.IsRevoked():
+		return NewError(ErrorUnauthorizedType, "external account binding key with id '%s' was revoked on %s", eak.ID, eak.RevokedAt)
+	case eak.IsExpired(now):
+		return NewError(ErrorUnauthorizedType, "external account binding key with id '%s' expired on %s", eak.ID, eak.ExpiresAt)
+	default:
+		return nil
+	}
 }
 
 // AlreadyBound returns whether this EAK is already bound to
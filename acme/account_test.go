@@ -162,3 +162,47 @@ func TestExternalAccountKey_BindTo(t *testing.T) {
 		})
 	}
 }
+
+func TestExternalAccountKey_CheckUsable(t *testing.T) {
+	now := time.Now()
+	revokedAt := now.Add(-time.Minute)
+	expiresAt := now.Add(-time.Second)
+	tests := []struct {
+		name string
+		eak  *ExternalAccountKey
+		err  *Error
+	}{
+		{
+			name: "ok",
+			eak:  &ExternalAccountKey{ID: "eakID"},
+		},
+		{
+			name: "ok/not-expired",
+			eak:  &ExternalAccountKey{ID: "eakID", ExpiresAt: now.Add(time.Hour)},
+		},
+		{
+			name: "fail/revoked",
+			eak:  &ExternalAccountKey{ID: "eakID", RevokedAt: revokedAt},
+			err:  NewError(ErrorUnauthorizedType, "external account binding key with id '%s' was revoked on %s", "eakID", revokedAt),
+		},
+		{
+			name: "fail/expired",
+			eak:  &ExternalAccountKey{ID: "eakID", ExpiresAt: expiresAt},
+			err:  NewError(ErrorUnauthorizedType, "external account binding key with id '%s' expired on %s", "eakID", expiresAt),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.eak.CheckUsable(now)
+			if tt.err == nil {
+				assert.Nil(t, err)
+				return
+			}
+			var ae *Error
+			if assert.True(t, errors.As(err, &ae)) {
+				assert.Equals(t, ae.Type, tt.err.Type)
+				assert.Equals(t, ae.Detail, tt.err.Detail)
+			}
+		})
+	}
+}
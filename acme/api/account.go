@@ -5,11 +5,15 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"net/url"
+	"strconv"
 
 	"github.com/go-chi/chi/v5"
+	"go.step.sm/crypto/jose"
 
 	"github.com/smallstep/certificates/acme"
 	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/logging"
 )
 
@@ -68,12 +72,58 @@ func (u *UpdateAccountRequest) Validate() error {
 	}
 }
 
+// KeyChangeRequest represents the payload of the inner JWS of a key-change
+// request.
+type KeyChangeRequest struct {
+	Account string           `json:"account"`
+	OldKey  *jose.JSONWebKey `json:"oldKey"`
+}
+
+// Validate validates a key-change request body.
+func (k *KeyChangeRequest) Validate() error {
+	switch {
+	case k.Account == "":
+		return acme.NewError(acme.ErrorMalformedType, "account cannot be empty")
+	case k.OldKey == nil:
+		return acme.NewError(acme.ErrorMalformedType, "oldKey cannot be empty")
+	default:
+		return nil
+	}
+}
+
+// OrdersList is the response of the orders resource of an account.
+type OrdersList struct {
+	Orders []string `json:"orders"`
+}
+
 // getAccountLocationPath returns the current account URL location.
 // Returned location will be of the form: https://<ca-url>/acme/<provisioner>/account/<accID>
 func getAccountLocationPath(ctx context.Context, linker acme.Linker, accID string) string {
 	return linker.GetLink(ctx, acme.AccountLinkType, accID)
 }
 
+// authorizeAccount validates a new account or a contact update using the
+// account webhooks of the provisioner.
+func authorizeAccount(ctx context.Context, prov *provisioner.ACME, acc *acme.Account) error {
+	var keyID string
+	if acc.Key != nil {
+		keyID = acc.Key.KeyID
+	}
+	err := prov.AuthorizeAccount(ctx, provisioner.ACMEAccount{
+		ID:      acc.ID,
+		KeyID:   keyID,
+		Contact: acc.Contact,
+	})
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, provisioner.ErrWebhookDenied):
+		return acme.WrapError(acme.ErrorInvalidContactType, err, "account contact is not allowed")
+	default:
+		return acme.WrapErrorISE(err, "error authorizing account")
+	}
+}
+
 // NewAccount is the handler resource for creating new ACME accounts.
 func NewAccount(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -139,6 +189,10 @@ func NewAccount(w http.ResponseWriter, r *http.Request) {
 			ProvisionerID:   prov.ID,
 			ProvisionerName: prov.Name,
 		}
+		if err := authorizeAccount(ctx, prov, acc); err != nil {
+			render.Error(w, err)
+			return
+		}
 		if err := db.CreateAccount(ctx, acc); err != nil {
 			render.Error(w, acme.WrapErrorISE(err, "error creating account"))
 			return
@@ -157,6 +211,12 @@ func NewAccount(w http.ResponseWriter, r *http.Request) {
 		}
 	} else {
 		// Account exists
+		if nar.OnlyReturnExisting && acc.ProvisionerName != "" && acc.ProvisionerName != prov.Name {
+			// Accounts are only returned by the provisioner that created them.
+			render.Error(w, acme.NewError(acme.ErrorAccountDoesNotExistType,
+				"account does not exist"))
+			return
+		}
 		httpStatus = http.StatusOK
 	}
 
@@ -200,6 +260,19 @@ func GetOrUpdateAccount(w http.ResponseWriter, r *http.Request) {
 			if len(uar.Status) > 0 {
 				acc.Status = uar.Status
 			} else if len(uar.Contact) > 0 {
+				prov, err := acmeProvisionerFromContext(ctx)
+				if err != nil {
+					render.Error(w, err)
+					return
+				}
+				if err := authorizeAccount(ctx, prov, &acme.Account{
+					ID:      acc.ID,
+					Key:     acc.Key,
+					Contact: uar.Contact,
+				}); err != nil {
+					render.Error(w, err)
+					return
+				}
 				acc.Contact = uar.Contact
 			}
 
@@ -226,6 +299,8 @@ func logOrdersByAccount(w http.ResponseWriter, oids []string) {
 }
 
 // GetOrdersByAccountID ACME api for retrieving the list of order urls belonging to an account.
+// If the database supports it, the list is paginated using the cursor and
+// limit query parameters, and the next page is linked in the response headers.
 func GetOrdersByAccountID(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	db := acme.MustDatabaseFromContext(ctx)
@@ -242,14 +317,160 @@ func GetOrdersByAccountID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	orders, err := db.GetOrdersByAccountID(ctx, acc.ID)
+	var (
+		orders     []string
+		nextCursor string
+	)
+	if lister, ok := db.(acme.OrderLister); ok {
+		q := r.URL.Query()
+		var limit int
+		if v := q.Get("limit"); v != "" {
+			if limit, err = strconv.Atoi(v); err != nil {
+				render.Error(w, acme.WrapError(acme.ErrorMalformedType, err, "limit '%s' is not an integer", v))
+				return
+			}
+		}
+		orders, nextCursor, err = lister.ListOrdersByAccountID(ctx, acc.ID, q.Get("cursor"), limit)
+	} else {
+		orders, err = db.GetOrdersByAccountID(ctx, acc.ID)
+	}
 	if err != nil {
 		render.Error(w, err)
 		return
 	}
 
+	// RFC 8555 section 7.1.2.1 links the next page using a "next" link
+	// relation.
+	if nextCursor != "" {
+		q := url.Values{"cursor": []string{nextCursor}}
+		if v := r.URL.Query().Get("limit"); v != "" {
+			q.Set("limit", v)
+		}
+		next := linker.GetLink(ctx, acme.OrdersByAccountLinkType, acc.ID) + "?" + q.Encode()
+		w.Header().Add("Link", link(next, "next"))
+	}
+
 	linker.LinkOrdersByAccountID(ctx, orders)
 
-	render.JSON(w, orders)
+	render.JSON(w, &OrdersList{Orders: orders})
 	logOrdersByAccount(w, orders)
 }
+
+// KeyChange ACME api for rolling over the key of an account, RFC 8555 section
+// 7.3.5. The outer JWS is signed with the current key of the account, and its
+// payload is a JWS signed with the new key.
+func KeyChange(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db := acme.MustDatabaseFromContext(ctx)
+	linker := acme.MustLinkerFromContext(ctx)
+
+	acc, err := accountFromContext(ctx)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+	outer, err := jwsFromContext(ctx)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+	payload, err := payloadFromContext(ctx)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	inner, err := jose.ParseJWS(string(payload.value))
+	if err != nil {
+		render.Error(w, acme.WrapError(acme.ErrorMalformedType, err, "failed to parse inner JWS"))
+		return
+	}
+	newKey, kcr, err := verifyKeyChangeJWS(outer, inner)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	// Check that the request is for the account and the old key that signed
+	// the outer JWS.
+	if kcr.Account != outer.Signatures[0].Protected.KeyID {
+		render.Error(w, acme.NewError(acme.ErrorMalformedType, "account in inner JWS does not match the outer JWS kid"))
+		return
+	}
+	oldKid, err := acme.KeyToID(acc.Key)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+	if kid, err := acme.KeyToID(kcr.OldKey); err != nil || kid != oldKid {
+		render.Error(w, acme.NewError(acme.ErrorMalformedType, "oldKey in inner JWS does not match the account key"))
+		return
+	}
+	newKid, err := acme.KeyToID(newKey)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+	if newKid == oldKid {
+		render.Error(w, acme.NewError(acme.ErrorMalformedType, "new key must be different from the account key"))
+		return
+	}
+
+	// The new key cannot be used by another account.
+	switch existing, err := db.GetAccountByKeyID(ctx, newKid); {
+	case err == nil:
+		w.Header().Set("Location", linker.GetLink(ctx, acme.AccountLinkType, existing.ID))
+		acmeErr := acme.NewError(acme.ErrorMalformedType, "new key is already in use by another account")
+		acmeErr.Status = http.StatusConflict
+		render.Error(w, acmeErr)
+		return
+	case !acme.IsErrNotFound(err):
+		render.Error(w, acme.WrapErrorISE(err, "error retrieving account by key"))
+		return
+	}
+
+	acc.Key = newKey
+	if err := db.UpdateAccount(ctx, acc); err != nil {
+		render.Error(w, acme.WrapErrorISE(err, "error updating account key"))
+		return
+	}
+
+	linker.LinkAccount(ctx, acc)
+
+	w.Header().Set("Location", linker.GetLink(ctx, acme.AccountLinkType, acc.ID))
+	render.JSON(w, acc)
+}
+
+// verifyKeyChangeJWS verifies the inner JWS of a key-change request using the
+// key in its header, and returns the new key and the decoded payload.
+func verifyKeyChangeJWS(outer, inner *jose.JSONWebSignature) (*jose.JSONWebKey, *KeyChangeRequest, error) {
+	if len(inner.Signatures) != 1 {
+		return nil, nil, acme.NewError(acme.ErrorMalformedType, "inner JWS must contain exactly one signature")
+	}
+	hdr := inner.Signatures[0].Protected
+	switch {
+	case hdr.JSONWebKey == nil:
+		return nil, nil, acme.NewError(acme.ErrorMalformedType, "inner JWS missing jwk protected header")
+	case hdr.Nonce != "":
+		return nil, nil, acme.NewError(acme.ErrorMalformedType, "inner JWS must not contain a nonce")
+	case !hdr.JSONWebKey.Valid() || !hdr.JSONWebKey.IsPublic():
+		return nil, nil, acme.NewError(acme.ErrorMalformedType, "invalid jwk in inner JWS")
+	}
+	outerURL, _ := outer.Signatures[0].Protected.ExtraHeaders["url"].(string)
+	if innerURL, _ := hdr.ExtraHeaders["url"].(string); innerURL != outerURL {
+		return nil, nil, acme.NewError(acme.ErrorMalformedType, "url header in inner JWS (%s) does not match outer JWS url (%s)", innerURL, outerURL)
+	}
+
+	b, err := inner.Verify(hdr.JSONWebKey)
+	if err != nil {
+		return nil, nil, acme.WrapError(acme.ErrorMalformedType, err, "error verifying inner JWS")
+	}
+	var kcr KeyChangeRequest
+	if err := json.Unmarshal(b, &kcr); err != nil {
+		return nil, nil, acme.WrapError(acme.ErrorMalformedType, err, "failed to unmarshal key-change request payload")
+	}
+	if err := kcr.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return hdr.JSONWebKey, &kcr, nil
+}
@@ -21,6 +21,7 @@ import (
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/acme"
 	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/webhook"
 )
 
 var (
@@ -44,6 +45,9 @@ func (*fakeProvisioner) AuthorizeSign(context.Context, string) ([]provisioner.Si
 func (*fakeProvisioner) IsChallengeEnabled(context.Context, provisioner.ACMEChallenge) bool {
 	return true
 }
+func (*fakeProvisioner) IsIdentifierChallengeEnabled(context.Context, provisioner.ACMEIdentifierType, provisioner.ACMEChallenge) bool {
+	return true
+}
 func (*fakeProvisioner) IsAttestationFormatEnabled(context.Context, provisioner.ACMEAttestationFormat) bool {
 	return true
 }
@@ -53,6 +57,8 @@ func (*fakeProvisioner) GetID() string                                 { return
 func (*fakeProvisioner) GetName() string                               { return "" }
 func (*fakeProvisioner) DefaultTLSCertDuration() time.Duration         { return 0 }
 func (*fakeProvisioner) GetOptions() *provisioner.Options              { return nil }
+func (*fakeProvisioner) GetProfileOptions(string) *provisioner.Options { return nil }
+func (*fakeProvisioner) GetACMEOptions() provisioner.ACMEOptions       { return provisioner.ACMEOptions{} }
 
 func newProv() acme.Provisioner {
 	// Initialize provisioners
@@ -66,6 +72,28 @@ func newProv() acme.Provisioner {
 	return p
 }
 
+// newProvWithAccountWebhook returns a provisioner with an account webhook that
+// allows or denies all the requests.
+func newProvWithAccountWebhook(t *testing.T, allow bool) acme.Provisioner {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.FatalError(t, json.NewEncoder(w).Encode(&webhook.ResponseBody{Allow: allow}))
+	}))
+	t.Cleanup(srv.Close)
+	p := &provisioner.ACME{
+		Type:            "ACME",
+		Name:            "test@acme-<test>provisioner.com",
+		AccountWebhooks: []string{"accounts"},
+		Options: &provisioner.Options{
+			Webhooks: []*provisioner.Webhook{
+				{Name: "accounts", Kind: "AUTHORIZING", URL: srv.URL},
+			},
+		},
+	}
+	assert.FatalError(t, p.Init(provisioner.Config{Claims: globalProvisionerClaims}))
+	return p
+}
+
 func newProvWithOptions(options *provisioner.Options) acme.Provisioner {
 	// Initialize provisioners
 	p := &provisioner.ACME{
@@ -98,9 +126,13 @@ func newACMEProvWithOptions(t *testing.T, options *provisioner.Options) *provisi
 }
 
 func createEABJWS(jwk *jose.JSONWebKey, hmacKey []byte, keyID, u string) (*jose.JSONWebSignature, error) {
+	return createEABJWSWithAlgorithm(jwk, jose.HS256, hmacKey, keyID, u)
+}
+
+func createEABJWSWithAlgorithm(jwk *jose.JSONWebKey, alg jose.SignatureAlgorithm, hmacKey []byte, keyID, u string) (*jose.JSONWebSignature, error) {
 	signer, err := jose.NewSigner(
 		jose.SigningKey{
-			Algorithm: jose.SignatureAlgorithm("HS256"),
+			Algorithm: alg,
 			Key:       hmacKey,
 		},
 		&jose.SignerOptions{
@@ -299,7 +331,10 @@ func TestHandler_GetOrdersByAccountID(t *testing.T) {
 	type test struct {
 		db         acme.DB
 		ctx        context.Context
+		query      string
 		statusCode int
+		want       []string
+		link       []string
 		err        *acme.Error
 	}
 	var tests = map[string]func(t *testing.T) test{
@@ -357,6 +392,41 @@ func TestHandler_GetOrdersByAccountID(t *testing.T) {
 				},
 				ctx:        ctx,
 				statusCode: 200,
+				want:       oidURLs,
+			}
+		},
+		"fail/bad-limit": func(t *testing.T) test {
+			acc := &acme.Account{ID: accID}
+			ctx := context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+			ctx = context.WithValue(ctx, accContextKey, acc)
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        ctx,
+				query:      "?limit=foo",
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "limit 'foo' is not an integer: strconv.Atoi: parsing \"foo\": invalid syntax"),
+			}
+		},
+		"ok/paginated": func(t *testing.T) test {
+			acc := &acme.Account{ID: accID}
+			ctx := context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+			ctx = acme.NewProvisionerContext(ctx, prov)
+			ctx = context.WithValue(ctx, accContextKey, acc)
+			return test{
+				db: &acme.MockDB{
+					MockListOrdersByAccountID: func(ctx context.Context, id, cursor string, limit int) ([]string, string, error) {
+						assert.Equals(t, id, acc.ID)
+						assert.Equals(t, cursor, "foo")
+						assert.Equals(t, limit, 1)
+						return []string{"foo"}, "bar", nil
+					},
+				},
+				ctx:        ctx,
+				query:      "?cursor=foo&limit=1",
+				statusCode: 200,
+				want:       oidURLs[:1],
+				link: []string{fmt.Sprintf("<%s/acme/%s/account/%s/orders?cursor=bar&limit=1>;rel=\"next\"",
+					baseURL.String(), provName, accID)},
 			}
 		},
 	}
@@ -364,7 +434,7 @@ func TestHandler_GetOrdersByAccountID(t *testing.T) {
 		tc := run(t)
 		t.Run(name, func(t *testing.T) {
 			ctx := acme.NewContext(tc.ctx, tc.db, nil, acme.NewLinker("test.ca.smallstep.com", "acme"), nil)
-			req := httptest.NewRequest("GET", u, http.NoBody)
+			req := httptest.NewRequest("GET", u+tc.query, http.NoBody)
 			req = req.WithContext(ctx)
 			w := httptest.NewRecorder()
 			GetOrdersByAccountID(w, req)
@@ -385,9 +455,10 @@ func TestHandler_GetOrdersByAccountID(t *testing.T) {
 				assert.Equals(t, ae.Subproblems, tc.err.Subproblems)
 				assert.Equals(t, res.Header["Content-Type"], []string{"application/problem+json"})
 			} else {
-				expB, err := json.Marshal(oidURLs)
+				expB, err := json.Marshal(&OrdersList{Orders: tc.want})
 				assert.FatalError(t, err)
 				assert.Equals(t, bytes.TrimSpace(body), expB)
+				assert.Equals(t, res.Header["Link"], tc.link)
 				assert.Equals(t, res.Header["Content-Type"], []string{"application/json"})
 			}
 		})
@@ -635,6 +706,50 @@ func TestHandler_NewAccount(t *testing.T) {
 				err:        acme.NewError(acme.ErrorServerInternalType, "error updating external account binding key"),
 			}
 		},
+		"fail/account-webhook-denied": func(t *testing.T) test {
+			nar := &NewAccountRequest{
+				Contact: []string{"mailto:jane@example.com"},
+			}
+			b, err := json.Marshal(nar)
+			assert.FatalError(t, err)
+			jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+			assert.FatalError(t, err)
+			ctx := context.WithValue(context.Background(), payloadContextKey, &payloadInfo{value: b})
+			ctx = context.WithValue(ctx, jwkContextKey, jwk)
+			ctx = acme.NewProvisionerContext(ctx, newProvWithAccountWebhook(t, false))
+			return test{
+				db: &acme.MockDB{
+					MockCreateAccount: func(ctx context.Context, acc *acme.Account) error {
+						assert.FatalError(t, errors.New("account must not be created"))
+						return nil
+					},
+				},
+				ctx:        ctx,
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorInvalidContactType, "account contact is not allowed"),
+			}
+		},
+		"fail/return-existing-other-provisioner": func(t *testing.T) test {
+			nar := &NewAccountRequest{
+				OnlyReturnExisting: true,
+			}
+			b, err := json.Marshal(nar)
+			assert.FatalError(t, err)
+			acc := &acme.Account{
+				ID:              "accountID",
+				Status:          acme.StatusValid,
+				ProvisionerName: "other",
+			}
+			ctx := acme.NewProvisionerContext(context.Background(), prov)
+			ctx = context.WithValue(ctx, payloadContextKey, &payloadInfo{value: b})
+			ctx = context.WithValue(ctx, accContextKey, acc)
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        ctx,
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorAccountDoesNotExistType, "account does not exist"),
+			}
+		},
 		"ok/new-account": func(t *testing.T) test {
 			nar := &NewAccountRequest{
 				Contact: []string{"foo", "bar"},
@@ -690,6 +805,36 @@ func TestHandler_NewAccount(t *testing.T) {
 				statusCode: 200,
 			}
 		},
+		"ok/new-account-webhook-allowed": func(t *testing.T) test {
+			nar := &NewAccountRequest{
+				Contact: []string{"mailto:jane@example.com"},
+			}
+			b, err := json.Marshal(nar)
+			assert.FatalError(t, err)
+			jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+			assert.FatalError(t, err)
+			ctx := context.WithValue(context.Background(), payloadContextKey, &payloadInfo{value: b})
+			ctx = context.WithValue(ctx, jwkContextKey, jwk)
+			ctx = acme.NewProvisionerContext(ctx, newProvWithAccountWebhook(t, true))
+			return test{
+				db: &acme.MockDB{
+					MockCreateAccount: func(ctx context.Context, acc *acme.Account) error {
+						acc.ID = "accountID"
+						assert.Equals(t, acc.Contact, nar.Contact)
+						return nil
+					},
+				},
+				acc: &acme.Account{
+					ID:        "accountID",
+					Key:       jwk,
+					Status:    acme.StatusValid,
+					Contact:   []string{"mailto:jane@example.com"},
+					OrdersURL: fmt.Sprintf("%s/acme/%s/account/accountID/orders", baseURL.String(), escProvName),
+				},
+				ctx:        ctx,
+				statusCode: 201,
+			}
+		},
 		"ok/new-account-no-eab-required": func(t *testing.T) test {
 			jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
 			assert.FatalError(t, err)
@@ -936,6 +1081,27 @@ func TestHandler_GetOrUpdateAccount(t *testing.T) {
 				err:        acme.NewErrorISE("force"),
 			}
 		},
+		"fail/update-contacts-webhook-denied": func(t *testing.T) test {
+			uar := &UpdateAccountRequest{
+				Contact: []string{"mailto:jane@example.com"},
+			}
+			b, err := json.Marshal(uar)
+			assert.FatalError(t, err)
+			ctx := acme.NewProvisionerContext(context.Background(), newProvWithAccountWebhook(t, false))
+			ctx = context.WithValue(ctx, accContextKey, &acc)
+			ctx = context.WithValue(ctx, payloadContextKey, &payloadInfo{value: b})
+			return test{
+				db: &acme.MockDB{
+					MockUpdateAccount: func(ctx context.Context, upd *acme.Account) error {
+						assert.FatalError(t, errors.New("account must not be updated"))
+						return nil
+					},
+				},
+				ctx:        ctx,
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorInvalidContactType, "account contact is not allowed"),
+			}
+		},
 		"ok/deactivate": func(t *testing.T) test {
 			uar := &UpdateAccountRequest{
 				Status: "deactivated",
@@ -1038,3 +1204,296 @@ func TestHandler_GetOrUpdateAccount(t *testing.T) {
 		})
 	}
 }
+
+func TestKeyChangeRequest_Validate(t *testing.T) {
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	assert.FatalError(t, err)
+	pub := jwk.Public()
+
+	type test struct {
+		kcr *KeyChangeRequest
+		err *acme.Error
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/no-account": func(t *testing.T) test {
+			return test{
+				kcr: &KeyChangeRequest{OldKey: &pub},
+				err: acme.NewError(acme.ErrorMalformedType, "account cannot be empty"),
+			}
+		},
+		"fail/no-old-key": func(t *testing.T) test {
+			return test{
+				kcr: &KeyChangeRequest{Account: "https://ca.smallstep.com/acme/acme/account/accID"},
+				err: acme.NewError(acme.ErrorMalformedType, "oldKey cannot be empty"),
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				kcr: &KeyChangeRequest{Account: "https://ca.smallstep.com/acme/acme/account/accID", OldKey: &pub},
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			if err := tc.kcr.Validate(); err != nil {
+				if assert.NotNil(t, tc.err) {
+					var ae *acme.Error
+					if assert.True(t, errors.As(err, &ae)) {
+						assert.HasPrefix(t, ae.Error(), tc.err.Error())
+						assert.Equals(t, ae.StatusCode(), tc.err.StatusCode())
+						assert.Equals(t, ae.Type, tc.err.Type)
+					}
+				}
+			} else {
+				assert.Nil(t, tc.err)
+			}
+		})
+	}
+}
+
+func TestHandler_KeyChange(t *testing.T) {
+	accID := "account-id"
+	prov := newProv()
+	escProvName := url.PathEscape(prov.GetName())
+	baseURL := &url.URL{Scheme: "https", Host: "test.ca.smallstep.com"}
+	accURL := fmt.Sprintf("%s/acme/%s/account/%s", baseURL.String(), escProvName, accID)
+	u := fmt.Sprintf("%s/acme/%s/key-change", baseURL.String(), escProvName)
+
+	oldJWK, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	assert.FatalError(t, err)
+	oldPub := oldJWK.Public()
+	newJWK, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	assert.FatalError(t, err)
+	newPub := newJWK.Public()
+	newKid, err := acme.KeyToID(&newPub)
+	assert.FatalError(t, err)
+
+	sign := func(t *testing.T, jwk *jose.JSONWebKey, headers map[string]interface{}, embed bool, payload []byte) string {
+		so := new(jose.SignerOptions)
+		so.EmbedJWK = embed
+		for k, v := range headers {
+			so.WithHeader(jose.HeaderKey(k), v)
+		}
+		signer, err := jose.NewSigner(jose.SigningKey{
+			Algorithm: jose.SignatureAlgorithm(jwk.Algorithm),
+			Key:       jwk.Key,
+		}, so)
+		assert.FatalError(t, err)
+		jws, err := signer.Sign(payload)
+		assert.FatalError(t, err)
+		raw, err := jws.CompactSerialize()
+		assert.FatalError(t, err)
+		return raw
+	}
+	newInner := func(t *testing.T, headers map[string]interface{}, kcr *KeyChangeRequest) []byte {
+		b, err := json.Marshal(kcr)
+		assert.FatalError(t, err)
+		if headers == nil {
+			headers = map[string]interface{}{"url": u}
+		}
+		return []byte(sign(t, newJWK, headers, true, b))
+	}
+	outer, err := jose.ParseJWS(sign(t, oldJWK, map[string]interface{}{"kid": accURL, "url": u}, false, []byte("{}")))
+	assert.FatalError(t, err)
+
+	newContext := func(inner []byte) context.Context {
+		ctx := acme.NewProvisionerContext(context.Background(), prov)
+		ctx = context.WithValue(ctx, accContextKey, &acme.Account{ID: accID, Key: &oldPub, Status: acme.StatusValid})
+		ctx = context.WithValue(ctx, jwsContextKey, outer)
+		return context.WithValue(ctx, payloadContextKey, &payloadInfo{value: inner})
+	}
+	kcr := &KeyChangeRequest{Account: accURL, OldKey: &oldPub}
+
+	type test struct {
+		db         acme.DB
+		ctx        context.Context
+		statusCode int
+		location   string
+		err        *acme.Error
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/no-account": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        context.Background(),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorAccountDoesNotExistType, "account does not exist"),
+			}
+		},
+		"fail/no-jws": func(t *testing.T) test {
+			ctx := context.WithValue(context.Background(), accContextKey, &acme.Account{ID: accID, Key: &oldPub})
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        ctx,
+				statusCode: 500,
+				err:        acme.NewErrorISE("jws expected in request context"),
+			}
+		},
+		"fail/parse-inner-error": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        newContext([]byte("foo")),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "failed to parse inner JWS"),
+			}
+		},
+		"fail/inner-missing-jwk": func(t *testing.T) test {
+			b, err := json.Marshal(kcr)
+			assert.FatalError(t, err)
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        newContext([]byte(sign(t, newJWK, map[string]interface{}{"url": u}, false, b))),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "inner JWS missing jwk protected header"),
+			}
+		},
+		"fail/inner-nonce": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        newContext(newInner(t, map[string]interface{}{"url": u, "nonce": "foo"}, kcr)),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "inner JWS must not contain a nonce"),
+			}
+		},
+		"fail/url-mismatch": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        newContext(newInner(t, map[string]interface{}{"url": "https://foo.com"}, kcr)),
+				statusCode: 400,
+				err: acme.NewError(acme.ErrorMalformedType, "url header in inner JWS (https://foo.com) "+
+					"does not match outer JWS url (%s)", u),
+			}
+		},
+		"fail/invalid-request": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        newContext(newInner(t, nil, &KeyChangeRequest{OldKey: &oldPub})),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "account cannot be empty"),
+			}
+		},
+		"fail/account-mismatch": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        newContext(newInner(t, nil, &KeyChangeRequest{Account: "foo", OldKey: &oldPub})),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "account in inner JWS does not match the outer JWS kid"),
+			}
+		},
+		"fail/old-key-mismatch": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        newContext(newInner(t, nil, &KeyChangeRequest{Account: accURL, OldKey: &newPub})),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "oldKey in inner JWS does not match the account key"),
+			}
+		},
+		"fail/same-key": func(t *testing.T) test {
+			b, err := json.Marshal(kcr)
+			assert.FatalError(t, err)
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        newContext([]byte(sign(t, oldJWK, map[string]interface{}{"url": u}, true, b))),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "new key must be different from the account key"),
+			}
+		},
+		"fail/key-in-use": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetAccountByKeyID: func(ctx context.Context, kid string) (*acme.Account, error) {
+						assert.Equals(t, kid, newKid)
+						return &acme.Account{ID: "other-id"}, nil
+					},
+				},
+				ctx:        newContext(newInner(t, nil, kcr)),
+				statusCode: 409,
+				location:   fmt.Sprintf("%s/acme/%s/account/other-id", baseURL.String(), escProvName),
+				err:        acme.NewError(acme.ErrorMalformedType, "new key is already in use by another account"),
+			}
+		},
+		"fail/db.GetAccountByKeyID-error": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetAccountByKeyID: func(ctx context.Context, kid string) (*acme.Account, error) {
+						return nil, errors.New("force")
+					},
+				},
+				ctx:        newContext(newInner(t, nil, kcr)),
+				statusCode: 500,
+				err:        acme.NewErrorISE("error retrieving account by key: force"),
+			}
+		},
+		"fail/db.UpdateAccount-error": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetAccountByKeyID: func(ctx context.Context, kid string) (*acme.Account, error) {
+						return nil, acme.ErrNotFound
+					},
+					MockUpdateAccount: func(ctx context.Context, acc *acme.Account) error {
+						return errors.New("force")
+					},
+				},
+				ctx:        newContext(newInner(t, nil, kcr)),
+				statusCode: 500,
+				err:        acme.NewErrorISE("error updating account key: force"),
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetAccountByKeyID: func(ctx context.Context, kid string) (*acme.Account, error) {
+						return nil, acme.ErrNotFound
+					},
+					MockUpdateAccount: func(ctx context.Context, acc *acme.Account) error {
+						assert.Equals(t, acc.ID, accID)
+						kid, err := acme.KeyToID(acc.Key)
+						assert.FatalError(t, err)
+						assert.Equals(t, kid, newKid)
+						return nil
+					},
+				},
+				ctx:        newContext(newInner(t, nil, kcr)),
+				statusCode: 200,
+				location:   accURL,
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			ctx := newBaseContext(tc.ctx, tc.db, acme.NewLinker("test.ca.smallstep.com", "acme"))
+			req := httptest.NewRequest("POST", u, http.NoBody)
+			req = req.WithContext(ctx)
+			w := httptest.NewRecorder()
+			KeyChange(w, req)
+			res := w.Result()
+
+			assert.Equals(t, res.StatusCode, tc.statusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+
+			if tc.location != "" {
+				assert.Equals(t, res.Header["Location"], []string{tc.location})
+			}
+			if res.StatusCode >= 400 && assert.NotNil(t, tc.err) {
+				var ae acme.Error
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &ae))
+
+				assert.Equals(t, ae.Type, tc.err.Type)
+				assert.HasPrefix(t, ae.Detail, tc.err.Detail)
+				assert.Equals(t, res.Header["Content-Type"], []string{"application/problem+json"})
+			} else {
+				var acc acme.Account
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &acc))
+
+				assert.Equals(t, acc.Status, acme.StatusValid)
+				assert.Equals(t, acc.OrdersURL, accURL+"/orders")
+				assert.Equals(t, res.Header["Content-Type"], []string{"application/json"})
+			}
+		})
+	}
+}
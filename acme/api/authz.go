@@ -0,0 +1,99 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/api/render"
+)
+
+// NewAuthzRequest represents the body for a NewAuthz request.
+type NewAuthzRequest struct {
+	Identifier acme.Identifier `json:"identifier"`
+}
+
+// Validate validates a new-authz request body.
+func (n *NewAuthzRequest) Validate() error {
+	// RFC 8555 section 7.4.1 does not allow wildcard domain names in
+	// pre-authorization requests.
+	if _, isWildcard := trimIfWildcard(n.Identifier.Value); isWildcard {
+		return acme.NewError(acme.ErrorMalformedType, "wildcard identifiers cannot be pre-authorized: %s", n.Identifier.Value)
+	}
+	return validateIdentifier(n.Identifier)
+}
+
+// NewAuthz ACME api for pre-authorizing an identifier, RFC 8555 section
+// 7.4.1. The valid authorizations are reused by the new orders of the account.
+func NewAuthz(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ca := mustAuthority(ctx)
+	linker := acme.MustLinkerFromContext(ctx)
+
+	acc, err := accountFromContext(ctx)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+	prov, err := provisionerFromContext(ctx)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+	if !prov.GetACMEOptions().AllowPreAuthorization {
+		render.Error(w, acme.NewError(acme.ErrorNotImplementedType, "pre-authorization is not enabled"))
+		return
+	}
+	payload, err := payloadFromContext(ctx)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	var nar NewAuthzRequest
+	if err := json.Unmarshal(payload.value, &nar); err != nil {
+		render.Error(w, acme.WrapError(acme.ErrorMalformedType, err,
+			"failed to unmarshal new-authz request payload"))
+		return
+	}
+	if err := nar.Validate(); err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	acmeProv, err := acmeProvisionerFromContext(ctx)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+	eak, err := accountExternalAccountKey(ctx, acmeProv.RequireEAB, prov, acc)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+	acmePolicy, err := newACMEPolicyEngine(eak)
+	if err != nil {
+		render.Error(w, acme.WrapErrorISE(err, "error creating ACME policy engine"))
+		return
+	}
+	if err := authorizeIdentifier(ctx, ca, prov, acmePolicy, nar.Identifier); err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	az := &acme.Authorization{
+		AccountID:  acc.ID,
+		Identifier: nar.Identifier,
+		ExpiresAt:  clock.Now().Add(defaultOrderExpiry),
+		Status:     acme.StatusPending,
+	}
+	if err := newAuthorization(ctx, az); err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	linker.LinkAuthorization(ctx, az)
+
+	w.Header().Set("Location", linker.GetLink(ctx, acme.AuthzLinkType, az.ID))
+	render.JSONStatus(w, az, http.StatusCreated)
+}
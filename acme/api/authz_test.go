@@ -0,0 +1,223 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+
+	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func TestNewAuthzRequest_Validate(t *testing.T) {
+	tests := []struct {
+		name string
+		nar  *NewAuthzRequest
+		err  *acme.Error
+	}{
+		{"ok/dns", &NewAuthzRequest{Identifier: acme.Identifier{Type: "dns", Value: "example.com"}}, nil},
+		{"ok/ip", &NewAuthzRequest{Identifier: acme.Identifier{Type: "ip", Value: "192.168.42.42"}}, nil},
+		{"fail/wildcard", &NewAuthzRequest{Identifier: acme.Identifier{Type: "dns", Value: "*.example.com"}},
+			acme.NewError(acme.ErrorMalformedType, "wildcard identifiers cannot be pre-authorized: *.example.com")},
+		{"fail/bad-dns", &NewAuthzRequest{Identifier: acme.Identifier{Type: "dns", Value: "xn--bücher.example.com"}},
+			acme.NewError(acme.ErrorMalformedType, "invalid DNS name: xn--bücher.example.com")},
+		{"fail/bad-type", &NewAuthzRequest{Identifier: acme.Identifier{Type: "foo", Value: "bar"}},
+			acme.NewError(acme.ErrorMalformedType, "identifier type unsupported: foo")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.nar.Validate()
+			if tt.err == nil {
+				assert.NoError(t, err)
+				return
+			}
+			var ae *acme.Error
+			if assert.True(t, errors.As(err, &ae)) {
+				assert.Equals(t, ae.Error(), tt.err.Error())
+				assert.Equals(t, ae.Type, tt.err.Type)
+			}
+		})
+	}
+}
+
+func TestHandler_NewAuthz(t *testing.T) {
+	prov := &provisioner.ACME{
+		Type:                  "ACME",
+		Name:                  "test@acme-<test>provisioner.com",
+		AllowPreAuthorization: true,
+	}
+	assert.FatalError(t, prov.Init(provisioner.Config{Claims: globalProvisionerClaims}))
+	escProvName := url.PathEscape(prov.GetName())
+	baseURL := &url.URL{Scheme: "https", Host: "test.ca.smallstep.com"}
+	u := fmt.Sprintf("%s/acme/%s/new-authz", baseURL.String(), escProvName)
+
+	identifier := acme.Identifier{Type: "dns", Value: "zap.internal"}
+	newPayload := func(t *testing.T, nar *NewAuthzRequest) *payloadInfo {
+		b, err := json.Marshal(nar)
+		assert.FatalError(t, err)
+		return &payloadInfo{value: b}
+	}
+
+	type test struct {
+		ca         acme.CertificateAuthority
+		db         acme.DB
+		ctx        context.Context
+		statusCode int
+		err        *acme.Error
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/no-account": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        acme.NewProvisionerContext(context.Background(), prov),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorAccountDoesNotExistType, "account does not exist"),
+			}
+		},
+		"fail/not-enabled": func(t *testing.T) test {
+			ctx := acme.NewProvisionerContext(context.Background(), newProv())
+			ctx = context.WithValue(ctx, accContextKey, &acme.Account{ID: "accID"})
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        ctx,
+				statusCode: 501,
+				err:        acme.NewError(acme.ErrorNotImplementedType, "pre-authorization is not enabled"),
+			}
+		},
+		"fail/unmarshal-payload-error": func(t *testing.T) test {
+			ctx := acme.NewProvisionerContext(context.Background(), prov)
+			ctx = context.WithValue(ctx, accContextKey, &acme.Account{ID: "accID"})
+			ctx = context.WithValue(ctx, payloadContextKey, &payloadInfo{})
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        ctx,
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "failed to unmarshal new-authz request payload: unexpected end of JSON input"),
+			}
+		},
+		"fail/wildcard": func(t *testing.T) test {
+			ctx := acme.NewProvisionerContext(context.Background(), prov)
+			ctx = context.WithValue(ctx, accContextKey, &acme.Account{ID: "accID"})
+			ctx = context.WithValue(ctx, payloadContextKey, newPayload(t, &NewAuthzRequest{
+				Identifier: acme.Identifier{Type: "dns", Value: "*.zap.internal"},
+			}))
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        ctx,
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "wildcard identifiers cannot be pre-authorized: *.zap.internal"),
+			}
+		},
+		"fail/not-authorized": func(t *testing.T) test {
+			ctx := acme.NewProvisionerContext(context.Background(), prov)
+			ctx = context.WithValue(ctx, accContextKey, &acme.Account{ID: "accID"})
+			ctx = context.WithValue(ctx, payloadContextKey, newPayload(t, &NewAuthzRequest{Identifier: identifier}))
+			return test{
+				ca: &mockCA{
+					MockAreSANsallowed: func(ctx context.Context, sans []string) error {
+						return errors.New("force")
+					},
+				},
+				db:         &acme.MockDB{},
+				ctx:        ctx,
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorRejectedIdentifierType, "not authorized"),
+			}
+		},
+		"fail/db.CreateAuthorization-error": func(t *testing.T) test {
+			ctx := acme.NewProvisionerContext(context.Background(), prov)
+			ctx = context.WithValue(ctx, accContextKey, &acme.Account{ID: "accID"})
+			ctx = context.WithValue(ctx, payloadContextKey, newPayload(t, &NewAuthzRequest{Identifier: identifier}))
+			return test{
+				ca: &mockCA{},
+				db: &acme.MockDB{
+					MockCreateChallenge: func(ctx context.Context, ch *acme.Challenge) error {
+						return nil
+					},
+					MockCreateAuthorization: func(ctx context.Context, az *acme.Authorization) error {
+						return errors.New("force")
+					},
+				},
+				ctx:        ctx,
+				statusCode: 500,
+				err:        acme.NewErrorISE("error creating authorization: force"),
+			}
+		},
+		"ok": func(t *testing.T) test {
+			ctx := acme.NewProvisionerContext(context.Background(), prov)
+			ctx = context.WithValue(ctx, accContextKey, &acme.Account{ID: "accID"})
+			ctx = context.WithValue(ctx, payloadContextKey, newPayload(t, &NewAuthzRequest{Identifier: identifier}))
+			count := 0
+			return test{
+				ca: &mockCA{},
+				db: &acme.MockDB{
+					MockCreateChallenge: func(ctx context.Context, ch *acme.Challenge) error {
+						ch.ID = fmt.Sprintf("ch%d", count)
+						count++
+						assert.Equals(t, ch.AccountID, "accID")
+						assert.Equals(t, ch.Value, "zap.internal")
+						return nil
+					},
+					MockCreateAuthorization: func(ctx context.Context, az *acme.Authorization) error {
+						az.ID = "azID"
+						assert.Equals(t, az.AccountID, "accID")
+						assert.Equals(t, az.Identifier, identifier)
+						assert.Equals(t, az.Status, acme.StatusPending)
+						assert.Equals(t, az.Wildcard, false)
+						assert.Equals(t, len(az.Challenges), 3)
+						return nil
+					},
+				},
+				ctx:        ctx,
+				statusCode: 201,
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, tc.ca)
+			ctx := newBaseContext(tc.ctx, tc.db, acme.NewLinker("test.ca.smallstep.com", "acme"))
+			req := httptest.NewRequest("POST", u, http.NoBody)
+			req = req.WithContext(ctx)
+			w := httptest.NewRecorder()
+			NewAuthz(w, req)
+			res := w.Result()
+
+			assert.Equals(t, res.StatusCode, tc.statusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+
+			if res.StatusCode >= 400 && assert.NotNil(t, tc.err) {
+				var ae acme.Error
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &ae))
+
+				assert.Equals(t, ae.Type, tc.err.Type)
+				assert.HasPrefix(t, ae.Detail, tc.err.Detail)
+				assert.Equals(t, res.Header["Content-Type"], []string{"application/problem+json"})
+			} else {
+				var az acme.Authorization
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &az))
+
+				assert.Equals(t, az.Identifier, identifier)
+				assert.Equals(t, az.Status, acme.StatusPending)
+				assert.Equals(t, len(az.Challenges), 3)
+				assert.True(t, az.ExpiresAt.After(clock.Now().Add(defaultOrderExpiry-time.Minute)))
+				assert.Equals(t, res.Header["Location"], []string{fmt.Sprintf("%s/acme/%s/authz/azID", baseURL.String(), escProvName)})
+				assert.Equals(t, res.Header["Content-Type"], []string{"application/json"})
+			}
+		})
+	}
+}
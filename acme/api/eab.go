@@ -4,10 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"net/http"
 
 	"go.step.sm/crypto/jose"
 
 	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/logging"
 )
 
 // ExternalAccountBinding represents the ACME externalAccountBinding JWS
@@ -50,6 +52,10 @@ func validateExternalAccountBinding(ctx context.Context, nar *NewAccountRequest)
 		return nil, acmeErr
 	}
 
+	if alg := eabJWS.Signatures[0].Protected.Algorithm; !acmeProv.IsEABAlgorithmAllowed(alg) {
+		return nil, acme.NewError(acme.ErrorBadSignatureAlgorithmType, "'alg' field set to disallowed algorithm '%s'", alg)
+	}
+
 	db := acme.MustDatabaseFromContext(ctx)
 	externalAccountKey, err := db.GetExternalAccountKey(ctx, acmeProv.ID, keyID)
 	if err != nil {
@@ -72,6 +78,10 @@ func validateExternalAccountBinding(ctx context.Context, nar *NewAccountRequest)
 		return nil, acme.NewError(acme.ErrorUnauthorizedType, "external account binding key with id '%s' was already bound to account '%s' on %s", keyID, externalAccountKey.AccountID, externalAccountKey.BoundAt)
 	}
 
+	if err := externalAccountKey.CheckUsable(clock.Now()); err != nil {
+		return nil, err
+	}
+
 	payload, err := eabJWS.Verify(externalAccountKey.HmacKey)
 	if err != nil {
 		return nil, acme.WrapErrorISE(err, "error verifying externalAccountBinding signature")
@@ -166,3 +176,23 @@ func validateEABJWS(ctx context.Context, jws *jose.JSONWebSignature) (string, *a
 
 	return keyID, nil
 }
+
+// addExternalAccountKeyStats adds the given stats to the External Account
+// Binding key if the database keeps track of them. Errors are only logged, at
+// this point the order or the certificate has already been created.
+func addExternalAccountKeyStats(ctx context.Context, w http.ResponseWriter, provisionerID string, eak *acme.ExternalAccountKey, stats acme.ExternalAccountKeyStats) {
+	if eak == nil {
+		return
+	}
+	recorder, ok := acme.MustDatabaseFromContext(ctx).(acme.ExternalAccountKeyStatsRecorder)
+	if !ok {
+		return
+	}
+	if err := recorder.AddExternalAccountKeyStats(ctx, provisionerID, eak.ID, stats); err != nil {
+		if rl, ok := w.(logging.ResponseLogger); ok {
+			rl.WithFields(map[string]interface{}{
+				"eab-stats-error": err.Error(),
+			})
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/api/render"
+)
+
+// maxEmailReplySize is the maximum size of the messages posted to the
+// email-reply endpoint.
+const maxEmailReplySize = 1 << 20
+
+// PostEmailReply validates an email-reply-00 challenge, RFC 8823, using the
+// reply posted by a mail gateway. The body of the request is the raw reply,
+// and the gateway authenticates using the reply secret of the provisioner as a
+// bearer token.
+func PostEmailReply(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db := acme.MustDatabaseFromContext(ctx)
+
+	prov, err := provisionerFromContext(ctx)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+	opts := prov.GetACMEOptions().EmailChallenge
+	if opts == nil {
+		render.Error(w, acme.NewError(acme.ErrorUnauthorizedType,
+			"provisioner '%s' does not support email-reply-00 challenges", prov.GetName()))
+		return
+	}
+
+	secret, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(secret), []byte(opts.ReplySecret)) == 0 {
+		render.Error(w, acme.NewError(acme.ErrorUnauthorizedType, "email reply secret is not valid"))
+		return
+	}
+
+	if err := acme.ValidateEmailReply(ctx, db, http.MaxBytesReader(w, r.Body, maxEmailReplySize)); err != nil {
+		render.Error(w, acme.WrapErrorISE(err, "error validating email reply"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
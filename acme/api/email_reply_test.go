@@ -0,0 +1,164 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/smallstep/assert"
+	"go.step.sm/crypto/jose"
+
+	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func TestHandler_PostEmailReply(t *testing.T) {
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	assert.FatalError(t, err)
+
+	b := make([]byte, 16, 20)
+	_, err = rand.Read(b)
+	assert.FatalError(t, err)
+	replyToken := base64.RawURLEncoding.EncodeToString(append(b, "chID"...))
+	keyAuth, err := acme.KeyAuthorization(replyToken+"token", jwk)
+	assert.FatalError(t, err)
+	sum := sha256.Sum256([]byte(keyAuth))
+	reply := "From: jane@example.com\r\n" +
+		"Subject: Re: ACME: " + replyToken + "\r\n" +
+		"\r\n" +
+		"-----BEGIN ACME RESPONSE-----\r\n" +
+		base64.RawURLEncoding.EncodeToString(sum[:]) + "\r\n" +
+		"-----END ACME RESPONSE-----\r\n"
+
+	emailProv := &acme.MockProvisioner{
+		MgetID:   func() string { return "provID" },
+		MgetName: func() string { return "acme" },
+		MgetACMEOptions: func() provisioner.ACMEOptions {
+			return provisioner.ACMEOptions{
+				EmailChallenge: &provisioner.ACMEEmailChallenge{
+					From:        "acme@ca.example.com",
+					SMTPServer:  "smtp.example.com:587",
+					ReplySecret: "secret",
+				},
+			}
+		},
+	}
+
+	type test struct {
+		db            acme.DB
+		ctx           context.Context
+		authorization string
+		body          string
+		statusCode    int
+		err           *acme.Error
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/no-provisioner": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        context.Background(),
+				statusCode: 500,
+				err:        acme.NewErrorISE("provisioner does not exist"),
+			}
+		},
+		"fail/not-configured": func(t *testing.T) test {
+			return test{
+				db:            &acme.MockDB{},
+				ctx:           acme.NewProvisionerContext(context.Background(), newProv()),
+				authorization: "Bearer secret",
+				statusCode:    401,
+				err:           acme.NewError(acme.ErrorUnauthorizedType, "provisioner 'test@acme-<test>provisioner.com' does not support email-reply-00 challenges"),
+			}
+		},
+		"fail/bad-secret": func(t *testing.T) test {
+			return test{
+				db:            &acme.MockDB{},
+				ctx:           acme.NewProvisionerContext(context.Background(), emailProv),
+				authorization: "Bearer foo",
+				body:          reply,
+				statusCode:    401,
+				err:           acme.NewError(acme.ErrorUnauthorizedType, "email reply secret is not valid"),
+			}
+		},
+		"fail/bad-reply": func(t *testing.T) test {
+			return test{
+				db:            &acme.MockDB{},
+				ctx:           acme.NewProvisionerContext(context.Background(), emailProv),
+				authorization: "Bearer secret",
+				body:          "From: jane@example.com\r\nSubject: hello\r\n\r\nhello\r\n",
+				statusCode:    400,
+				err:           acme.NewError(acme.ErrorMalformedType, "email reply subject does not contain an ACME token"),
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetChallenge: func(ctx context.Context, id, azID string) (*acme.Challenge, error) {
+						assert.Equals(t, id, "chID")
+						return &acme.Challenge{
+							ID:         "chID",
+							AccountID:  "accID",
+							Type:       acme.EMAILREPLY00,
+							Status:     acme.StatusProcessing,
+							Value:      "jane@example.com",
+							Token:      "token",
+							ReplyToken: replyToken,
+						}, nil
+					},
+					MockGetAccount: func(ctx context.Context, id string) (*acme.Account, error) {
+						return &acme.Account{ID: "accID", Key: jwk, Status: acme.StatusValid, ProvisionerID: "provID"}, nil
+					},
+					MockUpdateChallenge: func(ctx context.Context, ch *acme.Challenge) error {
+						assert.Equals(t, ch.Status, acme.StatusValid)
+						return nil
+					},
+				},
+				ctx:           acme.NewProvisionerContext(context.Background(), emailProv),
+				authorization: "Bearer secret",
+				body:          reply,
+				statusCode:    204,
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			ctx := acme.NewDatabaseContext(tc.ctx, tc.db)
+			u := fmt.Sprintf("https://test.ca.smallstep.com/acme/%s/email-reply", "acme")
+			req := httptest.NewRequest("POST", u, strings.NewReader(tc.body))
+			req = req.WithContext(ctx)
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+			w := httptest.NewRecorder()
+			PostEmailReply(w, req)
+			res := w.Result()
+
+			assert.Equals(t, res.StatusCode, tc.statusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+
+			if res.StatusCode >= 400 && assert.NotNil(t, tc.err) {
+				var ae acme.Error
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &ae))
+
+				assert.Equals(t, ae.Type, tc.err.Type)
+				assert.HasPrefix(t, ae.Detail, tc.err.Detail)
+				assert.Equals(t, res.Header["Content-Type"], []string{"application/problem+json"})
+			} else {
+				assert.Nil(t, tc.err)
+				assert.Equals(t, len(body), 0)
+			}
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"encoding/pem"
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -162,11 +163,13 @@ func route(r api.Router, middleware func(next nextHTTP) nextHTTP) {
 	r.MethodFunc("POST", getPath(acme.AccountLinkType, "{provisionerID}", "{accID}"),
 		extractPayloadByKid(GetOrUpdateAccount))
 	r.MethodFunc("POST", getPath(acme.KeyChangeLinkType, "{provisionerID}", "{accID}"),
-		extractPayloadByKid(NotImplemented))
+		extractPayloadByKid(KeyChange))
 	r.MethodFunc("POST", getPath(acme.NewOrderLinkType, "{provisionerID}"),
 		extractPayloadByKid(NewOrder))
+	r.MethodFunc("POST", getPath(acme.NewAuthzLinkType, "{provisionerID}"),
+		extractPayloadByKid(NewAuthz))
 	r.MethodFunc("POST", getPath(acme.OrderLinkType, "{provisionerID}", "{ordID}"),
-		extractPayloadByKid(isPostAsGet(GetOrder)))
+		extractPayloadByKid(GetOrUpdateOrder))
 	r.MethodFunc("POST", getPath(acme.OrdersByAccountLinkType, "{provisionerID}", "{accID}"),
 		extractPayloadByKid(isPostAsGet(GetOrdersByAccountID)))
 	r.MethodFunc("POST", getPath(acme.FinalizeLinkType, "{provisionerID}", "{ordID}"),
@@ -177,8 +180,18 @@ func route(r api.Router, middleware func(next nextHTTP) nextHTTP) {
 		extractPayloadByKid(GetChallenge))
 	r.MethodFunc("POST", getPath(acme.CertificateLinkType, "{provisionerID}", "{certID}"),
 		extractPayloadByKid(isPostAsGet(GetCertificate)))
+	r.MethodFunc("POST", getPath(acme.CertificateLinkType, "{provisionerID}", "{certID}", "{chainID}"),
+		extractPayloadByKid(isPostAsGet(GetCertificate)))
+	r.MethodFunc("GET", getPath(acme.StarCertificateLinkType, "{provisionerID}", "{ordID}"),
+		commonMiddleware(GetStarCertificate))
+	r.MethodFunc("POST", getPath(acme.StarCertificateLinkType, "{provisionerID}", "{ordID}"),
+		extractPayloadByKid(isPostAsGet(GetStarCertificate)))
 	r.MethodFunc("POST", getPath(acme.RevokeCertLinkType, "{provisionerID}"),
 		extractPayloadByKidOrJWK(RevokeCert))
+	r.MethodFunc("GET", getPath(acme.RenewalInfoLinkType, "{provisionerID}", "{certID}"),
+		commonMiddleware(GetRenewalInfo))
+	r.MethodFunc("POST", getPath(acme.EmailReplyLinkType, "{provisionerID}"),
+		commonMiddleware(PostEmailReply))
 }
 
 // GetNonce just sets the right header since a Nonce is added to each response
@@ -196,6 +209,20 @@ type Meta struct {
 	Website                 string   `json:"website,omitempty"`
 	CaaIdentities           []string `json:"caaIdentities,omitempty"`
 	ExternalAccountRequired bool     `json:"externalAccountRequired,omitempty"`
+	// Profiles maps the names of the certificate profiles supported by the
+	// server to their descriptions, see draft-aaron-acme-profiles.
+	Profiles map[string]string `json:"profiles,omitempty"`
+	// AutoRenewal contains the limits of the auto-renewal orders supported by
+	// the server, RFC 8739.
+	AutoRenewal *AutoRenewalMeta `json:"auto-renewal,omitempty"`
+}
+
+// AutoRenewalMeta represents the auto-renewal object in the directory
+// metadata, RFC 8739 section 3.1.1.
+type AutoRenewalMeta struct {
+	MinLifetime         int64 `json:"min-lifetime"`
+	MaxDuration         int64 `json:"max-duration"`
+	AllowCertificateGet bool  `json:"allow-certificate-get,omitempty"`
 }
 
 // Directory represents an ACME directory for configuring clients.
@@ -203,9 +230,12 @@ type Directory struct {
 	NewNonce   string `json:"newNonce"`
 	NewAccount string `json:"newAccount"`
 	NewOrder   string `json:"newOrder"`
+	NewAuthz   string `json:"newAuthz,omitempty"`
 	RevokeCert string `json:"revokeCert"`
 	KeyChange  string `json:"keyChange"`
-	Meta       *Meta  `json:"meta,omitempty"`
+	// RenewalInfo is the base URL of the ARI endpoint, RFC 9773.
+	RenewalInfo string `json:"renewalInfo,omitempty"`
+	Meta        *Meta  `json:"meta,omitempty"`
 }
 
 // ToLog enables response logging for the Directory type.
@@ -229,13 +259,22 @@ func GetDirectory(w http.ResponseWriter, r *http.Request) {
 
 	linker := acme.MustLinkerFromContext(ctx)
 
+	// The new-authz resource is only advertised if pre-authorization is
+	// enabled, RFC 8555 section 7.4.1.
+	var newAuthz string
+	if acmeProv.GetACMEOptions().AllowPreAuthorization {
+		newAuthz = linker.GetLink(ctx, acme.NewAuthzLinkType)
+	}
+
 	render.JSON(w, &Directory{
-		NewNonce:   linker.GetLink(ctx, acme.NewNonceLinkType),
-		NewAccount: linker.GetLink(ctx, acme.NewAccountLinkType),
-		NewOrder:   linker.GetLink(ctx, acme.NewOrderLinkType),
-		RevokeCert: linker.GetLink(ctx, acme.RevokeCertLinkType),
-		KeyChange:  linker.GetLink(ctx, acme.KeyChangeLinkType),
-		Meta:       createMetaObject(acmeProv),
+		NewNonce:    linker.GetLink(ctx, acme.NewNonceLinkType),
+		NewAccount:  linker.GetLink(ctx, acme.NewAccountLinkType),
+		NewOrder:    linker.GetLink(ctx, acme.NewOrderLinkType),
+		NewAuthz:    newAuthz,
+		RevokeCert:  linker.GetLink(ctx, acme.RevokeCertLinkType),
+		KeyChange:   linker.GetLink(ctx, acme.KeyChangeLinkType),
+		RenewalInfo: linker.GetLink(ctx, acme.RenewalInfoLinkType),
+		Meta:        createMetaObject(acmeProv),
 	})
 }
 
@@ -244,11 +283,28 @@ func GetDirectory(w http.ResponseWriter, r *http.Request) {
 // It returns nil if none of the properties are set.
 func createMetaObject(p *provisioner.ACME) *Meta {
 	if shouldAddMetaObject(p) {
+		var profiles map[string]string
+		if len(p.Profiles) > 0 {
+			profiles = make(map[string]string, len(p.Profiles))
+			for name, profile := range p.Profiles {
+				profiles[name] = profile.Description
+			}
+		}
+		var autoRenewal *AutoRenewalMeta
+		if ar := p.GetACMEOptions().AutoRenewal; ar != nil {
+			autoRenewal = &AutoRenewalMeta{
+				MinLifetime:         int64(ar.GetMinLifetime().Seconds()),
+				MaxDuration:         int64(ar.GetMaxDuration().Seconds()),
+				AllowCertificateGet: ar.AllowCertificateGet,
+			}
+		}
 		return &Meta{
 			TermsOfService:          p.TermsOfService,
 			Website:                 p.Website,
 			CaaIdentities:           p.CaaIdentities,
 			ExternalAccountRequired: p.RequireEAB,
+			Profiles:                profiles,
+			AutoRenewal:             autoRenewal,
 		}
 	}
 	return nil
@@ -266,6 +322,10 @@ func shouldAddMetaObject(p *provisioner.ACME) bool {
 		return true
 	case p.RequireEAB:
 		return true
+	case len(p.Profiles) > 0:
+		return true
+	case p.AutoRenewal != nil:
+		return true
 	default:
 		return false
 	}
@@ -359,10 +419,20 @@ func GetChallenge(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Add("Link", link(linker.GetLink(ctx, acme.AuthzLinkType, azID), "up"))
 	w.Header().Set("Location", linker.GetLink(ctx, acme.ChallengeLinkType, azID, ch.ID))
+	// RFC 8555 section 8.2 uses the Retry-After header to report the time of
+	// the next attempt of a challenge in processing state.
+	if ch.Status == acme.StatusProcessing && ch.Retry != nil {
+		retryAfter := ch.Retry.NextAttempt.Sub(clock.Now())
+		if retryAfter < time.Second {
+			retryAfter = time.Second
+		}
+		w.Header().Set("Retry-After", strconv.FormatInt(int64(retryAfter.Seconds()), 10))
+	}
 	render.JSON(w, ch)
 }
 
-// GetCertificate ACME api for retrieving a Certificate.
+// GetCertificate ACME api for retrieving a Certificate. The alternate chains of
+// the certificate are linked using the alternate relation.
 func GetCertificate(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	db := acme.MustDatabaseFromContext(ctx)
@@ -385,6 +455,94 @@ func GetCertificate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The chain 0 is the preferred chain, the other ones are the alternate
+	// chains configured in the authority, RFC 8555 section 7.4.2.
+	chains := mustAuthority(ctx).GetCertificateChains(append([]*x509.Certificate{cert.Leaf}, cert.Intermediates...), "")
+	var index int
+	if s := chi.URLParam(r, "chainID"); s != "" {
+		if index, err = strconv.Atoi(s); err != nil || index < 0 || index >= len(chains) {
+			render.Error(w, acme.NewError(acme.ErrorMalformedType,
+				"certificate '%s' does not have the chain '%s'", certID, s))
+			return
+		}
+	}
+	if len(chains) > 1 {
+		linker := acme.MustLinkerFromContext(ctx)
+		for i := range chains {
+			if i != index {
+				w.Header().Add("Link", link(linker.GetLink(ctx, acme.CertificateLinkType, certID, strconv.Itoa(i)), "alternate"))
+			}
+		}
+	}
+
+	chain := *cert
+	chain.Intermediates = chains[index][1:]
+	writeCertificateChain(w, &chain)
+}
+
+// GetStarCertificate ACME api for retrieving the current certificate of an
+// auto-renewal order, RFC 8739. The certificate is renewed if the current one
+// is about to expire. Unauthenticated GET requests are only allowed if the
+// order was created with allow-certificate-get.
+func GetStarCertificate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db := acme.MustDatabaseFromContext(ctx)
+
+	prov, err := provisionerFromContext(ctx)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	o, err := db.GetOrder(ctx, chi.URLParam(r, "ordID"))
+	if err != nil {
+		render.Error(w, acme.WrapErrorISE(err, "error retrieving order"))
+		return
+	}
+	if prov.GetID() != o.ProvisionerID {
+		render.Error(w, acme.NewError(acme.ErrorUnauthorizedType,
+			"provisioner '%s' does not own order '%s'", prov.GetID(), o.ID))
+		return
+	}
+	if o.AutoRenewal == nil {
+		render.Error(w, acme.NewError(acme.ErrorMalformedType,
+			"order '%s' is not an auto-renewal order", o.ID))
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		if !o.AutoRenewal.AllowCertificateGet {
+			render.Error(w, acme.NewError(acme.ErrorUnauthorizedType,
+				"order '%s' does not allow unauthenticated certificate requests", o.ID))
+			return
+		}
+	} else {
+		acc, err := accountFromContext(ctx)
+		if err != nil {
+			render.Error(w, err)
+			return
+		}
+		if acc.ID != o.AccountID {
+			render.Error(w, acme.NewError(acme.ErrorUnauthorizedType,
+				"account '%s' does not own order '%s'", acc.ID, o.ID))
+			return
+		}
+	}
+
+	cert, err := o.GetStarCertificate(ctx, db, mustAuthority(ctx), prov)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	w.Header().Set("Cert-Not-Before", cert.Leaf.NotBefore.UTC().Format(http.TimeFormat))
+	w.Header().Set("Cert-Not-After", cert.Leaf.NotAfter.UTC().Format(http.TimeFormat))
+	writeCertificateChain(w, cert)
+}
+
+// writeCertificateChain writes the PEM encoded leaf and intermediates of the
+// given certificate.
+func writeCertificateChain(w http.ResponseWriter, cert *acme.Certificate) {
 	var certBytes []byte
 	for _, c := range append([]*x509.Certificate{cert.Leaf}, cert.Intermediates...) {
 		certBytes = append(certBytes, pem.EncodeToMemory(&pem.Block{
@@ -108,11 +108,33 @@ func TestHandler_GetDirectory(t *testing.T) {
 			baseURL := &url.URL{Scheme: "https", Host: "test.ca.smallstep.com"}
 			ctx := acme.NewProvisionerContext(context.Background(), prov)
 			expDir := Directory{
-				NewNonce:   fmt.Sprintf("%s/acme/%s/new-nonce", baseURL.String(), provName),
-				NewAccount: fmt.Sprintf("%s/acme/%s/new-account", baseURL.String(), provName),
-				NewOrder:   fmt.Sprintf("%s/acme/%s/new-order", baseURL.String(), provName),
-				RevokeCert: fmt.Sprintf("%s/acme/%s/revoke-cert", baseURL.String(), provName),
-				KeyChange:  fmt.Sprintf("%s/acme/%s/key-change", baseURL.String(), provName),
+				NewNonce:    fmt.Sprintf("%s/acme/%s/new-nonce", baseURL.String(), provName),
+				NewAccount:  fmt.Sprintf("%s/acme/%s/new-account", baseURL.String(), provName),
+				NewOrder:    fmt.Sprintf("%s/acme/%s/new-order", baseURL.String(), provName),
+				RevokeCert:  fmt.Sprintf("%s/acme/%s/revoke-cert", baseURL.String(), provName),
+				KeyChange:   fmt.Sprintf("%s/acme/%s/key-change", baseURL.String(), provName),
+				RenewalInfo: fmt.Sprintf("%s/acme/%s/renewal-info", baseURL.String(), provName),
+			}
+			return test{
+				ctx:        ctx,
+				dir:        expDir,
+				statusCode: 200,
+			}
+		},
+		"ok/pre-authorization": func(t *testing.T) test {
+			prov := newACMEProv(t)
+			prov.AllowPreAuthorization = true
+			provName := url.PathEscape(prov.GetName())
+			baseURL := &url.URL{Scheme: "https", Host: "test.ca.smallstep.com"}
+			ctx := acme.NewProvisionerContext(context.Background(), prov)
+			expDir := Directory{
+				NewNonce:    fmt.Sprintf("%s/acme/%s/new-nonce", baseURL.String(), provName),
+				NewAccount:  fmt.Sprintf("%s/acme/%s/new-account", baseURL.String(), provName),
+				NewOrder:    fmt.Sprintf("%s/acme/%s/new-order", baseURL.String(), provName),
+				NewAuthz:    fmt.Sprintf("%s/acme/%s/new-authz", baseURL.String(), provName),
+				RevokeCert:  fmt.Sprintf("%s/acme/%s/revoke-cert", baseURL.String(), provName),
+				KeyChange:   fmt.Sprintf("%s/acme/%s/key-change", baseURL.String(), provName),
+				RenewalInfo: fmt.Sprintf("%s/acme/%s/renewal-info", baseURL.String(), provName),
 			}
 			return test{
 				ctx:        ctx,
@@ -127,11 +149,12 @@ func TestHandler_GetDirectory(t *testing.T) {
 			baseURL := &url.URL{Scheme: "https", Host: "test.ca.smallstep.com"}
 			ctx := acme.NewProvisionerContext(context.Background(), prov)
 			expDir := Directory{
-				NewNonce:   fmt.Sprintf("%s/acme/%s/new-nonce", baseURL.String(), provName),
-				NewAccount: fmt.Sprintf("%s/acme/%s/new-account", baseURL.String(), provName),
-				NewOrder:   fmt.Sprintf("%s/acme/%s/new-order", baseURL.String(), provName),
-				RevokeCert: fmt.Sprintf("%s/acme/%s/revoke-cert", baseURL.String(), provName),
-				KeyChange:  fmt.Sprintf("%s/acme/%s/key-change", baseURL.String(), provName),
+				NewNonce:    fmt.Sprintf("%s/acme/%s/new-nonce", baseURL.String(), provName),
+				NewAccount:  fmt.Sprintf("%s/acme/%s/new-account", baseURL.String(), provName),
+				NewOrder:    fmt.Sprintf("%s/acme/%s/new-order", baseURL.String(), provName),
+				RevokeCert:  fmt.Sprintf("%s/acme/%s/revoke-cert", baseURL.String(), provName),
+				KeyChange:   fmt.Sprintf("%s/acme/%s/key-change", baseURL.String(), provName),
+				RenewalInfo: fmt.Sprintf("%s/acme/%s/renewal-info", baseURL.String(), provName),
 				Meta: &Meta{
 					ExternalAccountRequired: true,
 				},
@@ -142,6 +165,35 @@ func TestHandler_GetDirectory(t *testing.T) {
 				statusCode: 200,
 			}
 		},
+		"ok/profiles": func(t *testing.T) test {
+			prov := newACMEProv(t)
+			prov.Profiles = map[string]*provisioner.ACMEProfile{
+				"classic":    {Description: "The classic profile"},
+				"shortlived": {Description: "Short-lived certificates"},
+			}
+			provName := url.PathEscape(prov.GetName())
+			baseURL := &url.URL{Scheme: "https", Host: "test.ca.smallstep.com"}
+			ctx := acme.NewProvisionerContext(context.Background(), prov)
+			expDir := Directory{
+				NewNonce:    fmt.Sprintf("%s/acme/%s/new-nonce", baseURL.String(), provName),
+				NewAccount:  fmt.Sprintf("%s/acme/%s/new-account", baseURL.String(), provName),
+				NewOrder:    fmt.Sprintf("%s/acme/%s/new-order", baseURL.String(), provName),
+				RevokeCert:  fmt.Sprintf("%s/acme/%s/revoke-cert", baseURL.String(), provName),
+				KeyChange:   fmt.Sprintf("%s/acme/%s/key-change", baseURL.String(), provName),
+				RenewalInfo: fmt.Sprintf("%s/acme/%s/renewal-info", baseURL.String(), provName),
+				Meta: &Meta{
+					Profiles: map[string]string{
+						"classic":    "The classic profile",
+						"shortlived": "Short-lived certificates",
+					},
+				},
+			}
+			return test{
+				ctx:        ctx,
+				dir:        expDir,
+				statusCode: 200,
+			}
+		},
 		"ok/full-meta": func(t *testing.T) test {
 			prov := newACMEProv(t)
 			prov.TermsOfService = "https://terms.ca.local/"
@@ -152,11 +204,12 @@ func TestHandler_GetDirectory(t *testing.T) {
 			baseURL := &url.URL{Scheme: "https", Host: "test.ca.smallstep.com"}
 			ctx := acme.NewProvisionerContext(context.Background(), prov)
 			expDir := Directory{
-				NewNonce:   fmt.Sprintf("%s/acme/%s/new-nonce", baseURL.String(), provName),
-				NewAccount: fmt.Sprintf("%s/acme/%s/new-account", baseURL.String(), provName),
-				NewOrder:   fmt.Sprintf("%s/acme/%s/new-order", baseURL.String(), provName),
-				RevokeCert: fmt.Sprintf("%s/acme/%s/revoke-cert", baseURL.String(), provName),
-				KeyChange:  fmt.Sprintf("%s/acme/%s/key-change", baseURL.String(), provName),
+				NewNonce:    fmt.Sprintf("%s/acme/%s/new-nonce", baseURL.String(), provName),
+				NewAccount:  fmt.Sprintf("%s/acme/%s/new-account", baseURL.String(), provName),
+				NewOrder:    fmt.Sprintf("%s/acme/%s/new-order", baseURL.String(), provName),
+				RevokeCert:  fmt.Sprintf("%s/acme/%s/revoke-cert", baseURL.String(), provName),
+				KeyChange:   fmt.Sprintf("%s/acme/%s/key-change", baseURL.String(), provName),
+				RenewalInfo: fmt.Sprintf("%s/acme/%s/renewal-info", baseURL.String(), provName),
 				Meta: &Meta{
 					TermsOfService:          "https://terms.ca.local/",
 					Website:                 "https://ca.local/",
@@ -400,6 +453,7 @@ func TestHandler_GetCertificate(t *testing.T) {
 		Bytes: root.Raw,
 	})...)
 	certID := "certID"
+	mockMustAuthority(t, &mockCA{})
 
 	prov := newProv()
 	provName := url.PathEscape(prov.GetName())
@@ -517,6 +571,327 @@ func TestHandler_GetCertificate(t *testing.T) {
 	}
 }
 
+func TestHandler_GetCertificate_alternateChains(t *testing.T) {
+	leaf, err := pemutil.ReadCertificate("../../authority/testdata/certs/foo.crt")
+	assert.FatalError(t, err)
+	inter, err := pemutil.ReadCertificate("../../authority/testdata/certs/intermediate_ca.crt")
+	assert.FatalError(t, err)
+	cross := &x509.Certificate{Raw: []byte("cross-signed intermediate")}
+
+	mockMustAuthority(t, &mockCA{
+		MockGetCertificateChains: func(certChain []*x509.Certificate, preferredChain string) [][]*x509.Certificate {
+			assert.Equals(t, []*x509.Certificate{leaf, inter}, certChain)
+			assert.Equals(t, "", preferredChain)
+			return [][]*x509.Certificate{certChain, {leaf, cross}}
+		},
+	})
+
+	prov := newProv()
+	provName := url.PathEscape(prov.GetName())
+	baseURL := &url.URL{Scheme: "https", Host: "test.ca.smallstep.com"}
+	db := &acme.MockDB{
+		MockGetCertificate: func(ctx context.Context, id string) (*acme.Certificate, error) {
+			return &acme.Certificate{
+				AccountID:     "accID",
+				OrderID:       "ordID",
+				Leaf:          leaf,
+				Intermediates: []*x509.Certificate{inter},
+				ID:            id,
+			}, nil
+		},
+	}
+	pemChain := func(certs ...*x509.Certificate) []byte {
+		var b []byte
+		for _, crt := range certs {
+			b = append(b, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: crt.Raw})...)
+		}
+		return b
+	}
+
+	tests := []struct {
+		name       string
+		chainID    string
+		statusCode int
+		links      []string
+		body       []byte
+	}{
+		{"ok default", "", 200, []string{fmt.Sprintf("<%s/acme/%s/certificate/certID/1>;rel=\"alternate\"", baseURL, provName)}, pemChain(leaf, inter)},
+		{"ok chain 0", "0", 200, []string{fmt.Sprintf("<%s/acme/%s/certificate/certID/1>;rel=\"alternate\"", baseURL, provName)}, pemChain(leaf, inter)},
+		{"ok chain 1", "1", 200, []string{fmt.Sprintf("<%s/acme/%s/certificate/certID/0>;rel=\"alternate\"", baseURL, provName)}, pemChain(leaf, cross)},
+		{"fail chain 2", "2", 400, nil, nil},
+		{"fail chain foo", "foo", 400, nil, nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("certID", "certID")
+			if tc.chainID != "" {
+				chiCtx.URLParams.Add("chainID", tc.chainID)
+			}
+			ctx := context.WithValue(context.Background(), accContextKey, &acme.Account{ID: "accID"})
+			ctx = context.WithValue(ctx, chi.RouteCtxKey, chiCtx)
+			ctx = acme.NewProvisionerContext(ctx, prov)
+			ctx = newBaseContext(ctx, db, acme.NewLinker("test.ca.smallstep.com", "acme"))
+			req := httptest.NewRequest("POST", fmt.Sprintf("%s/acme/%s/certificate/certID", baseURL, provName), http.NoBody)
+			req = req.WithContext(ctx)
+			w := httptest.NewRecorder()
+			GetCertificate(w, req)
+			res := w.Result()
+
+			assert.Equals(t, res.StatusCode, tc.statusCode)
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+
+			if res.StatusCode >= 400 {
+				var ae acme.Error
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &ae))
+				want := acme.NewError(acme.ErrorMalformedType, "certificate 'certID' does not have the chain '%s'", tc.chainID)
+				assert.Equals(t, ae.Type, want.Type)
+				assert.Equals(t, ae.Detail, want.Detail)
+			} else {
+				assert.Equals(t, res.Header["Link"], tc.links)
+				assert.Equals(t, body, tc.body)
+			}
+		})
+	}
+}
+
+func TestHandler_GetStarCertificate(t *testing.T) {
+	leaf, err := pemutil.ReadCertificate("../../authority/testdata/certs/foo.crt")
+	assert.FatalError(t, err)
+	inter, err := pemutil.ReadCertificate("../../authority/testdata/certs/intermediate_ca.crt")
+	assert.FatalError(t, err)
+
+	certBytes := append(pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: leaf.Raw,
+	}), pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: inter.Raw,
+	})...)
+
+	now := clock.Now().Truncate(time.Second)
+	current := *leaf
+	current.NotBefore = now.Add(-time.Hour)
+	current.NotAfter = now.Add(23 * time.Hour)
+
+	prov := newProv()
+	provName := url.PathEscape(prov.GetName())
+	baseURL := &url.URL{Scheme: "https", Host: "test.ca.smallstep.com"}
+	chiCtx := chi.NewRouteContext()
+	chiCtx.URLParams.Add("ordID", "ordID")
+	u := fmt.Sprintf("%s/acme/%s/star-certificate/ordID", baseURL.String(), provName)
+
+	newOrder := func(ar *acme.AutoRenewal) *acme.Order {
+		return &acme.Order{
+			ID:            "ordID",
+			AccountID:     "accID",
+			ProvisionerID: fmt.Sprintf("acme/%s", prov.GetName()),
+			Status:        acme.StatusValid,
+			CertificateID: "certID",
+			AutoRenewal:   ar,
+		}
+	}
+	ar := &acme.AutoRenewal{StartDate: now.Add(-time.Hour), EndDate: now.Add(72 * time.Hour), Lifetime: 86400}
+	getCertificate := func(ctx context.Context, id string) (*acme.Certificate, error) {
+		assert.Equals(t, id, "certID")
+		return &acme.Certificate{
+			ID:            id,
+			AccountID:     "accID",
+			OrderID:       "ordID",
+			Leaf:          &current,
+			Intermediates: []*x509.Certificate{inter},
+		}, nil
+	}
+
+	getAccount := func(ctx context.Context, id string) (*acme.Account, error) {
+		assert.Equals(t, id, "accID")
+		return &acme.Account{ID: id, Status: acme.StatusValid}, nil
+	}
+
+	type test struct {
+		db         acme.DB
+		ctx        context.Context
+		method     string
+		statusCode int
+		err        *acme.Error
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/deactivated-account": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetOrder: func(ctx context.Context, id string) (*acme.Order, error) {
+						return newOrder(&acme.AutoRenewal{
+							StartDate:           ar.StartDate,
+							EndDate:             ar.EndDate,
+							Lifetime:            ar.Lifetime,
+							AllowCertificateGet: true,
+						}), nil
+					},
+					MockGetAccount: func(ctx context.Context, id string) (*acme.Account, error) {
+						return &acme.Account{ID: id, Status: acme.StatusDeactivated}, nil
+					},
+				},
+				ctx:        acme.NewProvisionerContext(context.Background(), prov),
+				method:     "GET",
+				statusCode: 401,
+				err:        acme.NewError(acme.ErrorUnauthorizedType, "account accID is not valid"),
+			}
+		},
+		"fail/no-provisioner": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        context.Background(),
+				method:     "GET",
+				statusCode: 500,
+				err:        acme.NewErrorISE("provisioner does not exist"),
+			}
+		},
+		"fail/provisioner-id-mismatch": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetOrder: func(ctx context.Context, id string) (*acme.Order, error) {
+						o := newOrder(ar)
+						o.ProvisionerID = "bar"
+						return o, nil
+					},
+				},
+				ctx:        acme.NewProvisionerContext(context.Background(), prov),
+				method:     "GET",
+				statusCode: 401,
+				err:        acme.NewError(acme.ErrorUnauthorizedType, "provisioner '%s' does not own order 'ordID'", prov.GetID()),
+			}
+		},
+		"fail/not-auto-renewal": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetOrder: func(ctx context.Context, id string) (*acme.Order, error) {
+						return newOrder(nil), nil
+					},
+				},
+				ctx:        acme.NewProvisionerContext(context.Background(), prov),
+				method:     "GET",
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "order 'ordID' is not an auto-renewal order"),
+			}
+		},
+		"fail/get-not-allowed": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetOrder: func(ctx context.Context, id string) (*acme.Order, error) {
+						return newOrder(ar), nil
+					},
+				},
+				ctx:        acme.NewProvisionerContext(context.Background(), prov),
+				method:     "GET",
+				statusCode: 401,
+				err:        acme.NewError(acme.ErrorUnauthorizedType, "order 'ordID' does not allow unauthenticated certificate requests"),
+			}
+		},
+		"fail/account-id-mismatch": func(t *testing.T) test {
+			ctx := acme.NewProvisionerContext(context.Background(), prov)
+			ctx = context.WithValue(ctx, accContextKey, &acme.Account{ID: "foo"})
+			return test{
+				db: &acme.MockDB{
+					MockGetOrder: func(ctx context.Context, id string) (*acme.Order, error) {
+						return newOrder(ar), nil
+					},
+				},
+				ctx:        ctx,
+				method:     "POST",
+				statusCode: 401,
+				err:        acme.NewError(acme.ErrorUnauthorizedType, "account 'foo' does not own order 'ordID'"),
+			}
+		},
+		"fail/canceled": func(t *testing.T) test {
+			ctx := acme.NewProvisionerContext(context.Background(), prov)
+			ctx = context.WithValue(ctx, accContextKey, &acme.Account{ID: "accID"})
+			return test{
+				db: &acme.MockDB{
+					MockGetOrder: func(ctx context.Context, id string) (*acme.Order, error) {
+						o := newOrder(ar)
+						o.Status = acme.StatusCanceled
+						return o, nil
+					},
+				},
+				ctx:        ctx,
+				method:     "POST",
+				statusCode: 403,
+				err:        acme.NewError(acme.ErrorAutoRenewalCanceledType, "order ordID has been canceled"),
+			}
+		},
+		"ok/post": func(t *testing.T) test {
+			ctx := acme.NewProvisionerContext(context.Background(), prov)
+			ctx = context.WithValue(ctx, accContextKey, &acme.Account{ID: "accID"})
+			return test{
+				db: &acme.MockDB{
+					MockGetOrder: func(ctx context.Context, id string) (*acme.Order, error) {
+						return newOrder(ar), nil
+					},
+					MockGetAccount:     getAccount,
+					MockGetCertificate: getCertificate,
+				},
+				ctx:        ctx,
+				method:     "POST",
+				statusCode: 200,
+			}
+		},
+		"ok/get": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetOrder: func(ctx context.Context, id string) (*acme.Order, error) {
+						return newOrder(&acme.AutoRenewal{
+							StartDate:           ar.StartDate,
+							EndDate:             ar.EndDate,
+							Lifetime:            ar.Lifetime,
+							AllowCertificateGet: true,
+						}), nil
+					},
+					MockGetAccount:     getAccount,
+					MockGetCertificate: getCertificate,
+				},
+				ctx:        acme.NewProvisionerContext(context.Background(), prov),
+				method:     "GET",
+				statusCode: 200,
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, &mockCA{})
+			ctx := acme.NewDatabaseContext(tc.ctx, tc.db)
+			ctx = context.WithValue(ctx, chi.RouteCtxKey, chiCtx)
+			req := httptest.NewRequest(tc.method, u, http.NoBody)
+			req = req.WithContext(ctx)
+			w := httptest.NewRecorder()
+			GetStarCertificate(w, req)
+			res := w.Result()
+
+			assert.Equals(t, res.StatusCode, tc.statusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+
+			if res.StatusCode >= 400 && assert.NotNil(t, tc.err) {
+				var ae acme.Error
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &ae))
+
+				assert.Equals(t, ae.Type, tc.err.Type)
+				assert.HasPrefix(t, ae.Detail, tc.err.Detail)
+				assert.Equals(t, res.Header["Content-Type"], []string{"application/problem+json"})
+			} else {
+				assert.Equals(t, bytes.TrimSpace(body), bytes.TrimSpace(certBytes))
+				assert.Equals(t, res.Header["Content-Type"], []string{"application/pem-certificate-chain"})
+				assert.Equals(t, res.Header["Cert-Not-Before"], []string{current.NotBefore.UTC().Format(http.TimeFormat)})
+				assert.Equals(t, res.Header["Cert-Not-After"], []string{current.NotAfter.UTC().Format(http.TimeFormat)})
+			}
+		})
+	}
+}
+
 func TestHandler_GetChallenge(t *testing.T) {
 	chiCtx := chi.NewRouteContext()
 	chiCtx.URLParams.Add("chID", "chID")
@@ -535,6 +910,7 @@ func TestHandler_GetChallenge(t *testing.T) {
 		ctx        context.Context
 		statusCode int
 		ch         *acme.Challenge
+		retryAfter []string
 		err        *acme.Error
 	}
 	var tests = map[string]func(t *testing.T) test{
@@ -742,6 +1118,45 @@ func TestHandler_GetChallenge(t *testing.T) {
 				statusCode: 200,
 			}
 		},
+		"ok/processing": func(t *testing.T) test {
+			acc := &acme.Account{ID: "accID"}
+			ctx := acme.NewProvisionerContext(context.Background(), prov)
+			ctx = context.WithValue(ctx, accContextKey, acc)
+			ctx = context.WithValue(ctx, payloadContextKey, &payloadInfo{isEmptyJSON: true})
+			_jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+			assert.FatalError(t, err)
+			_pub := _jwk.Public()
+			ctx = context.WithValue(ctx, jwkContextKey, &_pub)
+			ctx = context.WithValue(ctx, chi.RouteCtxKey, chiCtx)
+			chErr := acme.NewError(acme.ErrorConnectionType, "force")
+			retry := &acme.ChallengeRetry{Attempts: 1, NextAttempt: clock.Now().Add(time.Minute)}
+			return test{
+				db: &acme.MockDB{
+					MockGetChallenge: func(ctx context.Context, chID, azID string) (*acme.Challenge, error) {
+						return &acme.Challenge{
+							ID:        "chID",
+							Status:    acme.StatusProcessing,
+							Type:      acme.HTTP01,
+							AccountID: "accID",
+							Error:     chErr,
+							Retry:     retry,
+						}, nil
+					},
+				},
+				ch: &acme.Challenge{
+					ID:              "chID",
+					Status:          acme.StatusProcessing,
+					AuthorizationID: "authzID",
+					Type:            acme.HTTP01,
+					AccountID:       "accID",
+					URL:             u,
+					Error:           chErr,
+				},
+				ctx:        ctx,
+				statusCode: 200,
+				retryAfter: []string{"60"},
+			}
+		},
 	}
 	for name, run := range tests {
 		tc := run(t)
@@ -773,6 +1188,7 @@ func TestHandler_GetChallenge(t *testing.T) {
 				assert.Equals(t, bytes.TrimSpace(body), expB)
 				assert.Equals(t, res.Header["Link"], []string{fmt.Sprintf("<%s/acme/%s/authz/%s>;rel=\"up\"", baseURL, provName, "authzID")})
 				assert.Equals(t, res.Header["Location"], []string{u})
+				assert.Equals(t, res.Header["Retry-After"], tc.retryAfter)
 				assert.Equals(t, res.Header["Content-Type"], []string{"application/json"})
 			}
 		})
@@ -780,6 +1196,17 @@ func TestHandler_GetChallenge(t *testing.T) {
 }
 
 func Test_createMetaObject(t *testing.T) {
+	autoRenewal := &provisioner.ACME{
+		Type: "ACME",
+		Name: "acme",
+		AutoRenewal: &provisioner.ACMEAutoRenewal{
+			MinLifetime:         &provisioner.Duration{Duration: time.Hour},
+			MaxDuration:         &provisioner.Duration{Duration: 30 * 24 * time.Hour},
+			AllowCertificateGet: true,
+		},
+	}
+	assert.FatalError(t, autoRenewal.Init(provisioner.Config{Claims: globalProvisionerClaims}))
+
 	tests := []struct {
 		name string
 		p    *provisioner.ACME
@@ -837,6 +1264,17 @@ func Test_createMetaObject(t *testing.T) {
 				ExternalAccountRequired: true,
 			},
 		},
+		{
+			name: "auto-renewal",
+			p:    autoRenewal,
+			want: &Meta{
+				AutoRenewal: &AutoRenewalMeta{
+					MinLifetime:         3600,
+					MaxDuration:         2592000,
+					AllowCertificateGet: true,
+				},
+			},
+		},
 		{
 			name: "full-meta",
 			p: &provisioner.ACME{
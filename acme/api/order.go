@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"net"
 	"net/http"
+	"net/mail"
 	"strings"
 	"time"
 
@@ -26,6 +27,8 @@ type NewOrderRequest struct {
 	Identifiers []acme.Identifier `json:"identifiers"`
 	NotBefore   time.Time         `json:"notBefore,omitempty"`
 	NotAfter    time.Time         `json:"notAfter,omitempty"`
+	Profile     string            `json:"profile,omitempty"`
+	AutoRenewal *acme.AutoRenewal `json:"auto-renewal,omitempty"`
 }
 
 // Validate validates a new-order request body.
@@ -33,23 +36,31 @@ func (n *NewOrderRequest) Validate() error {
 	if len(n.Identifiers) == 0 {
 		return acme.NewError(acme.ErrorMalformedType, "identifiers list cannot be empty")
 	}
+	if ar := n.AutoRenewal; ar != nil {
+		switch {
+		case !n.NotBefore.IsZero() || !n.NotAfter.IsZero():
+			return acme.NewError(acme.ErrorMalformedType, "notBefore and notAfter cannot be used in auto-renewal orders")
+		case ar.EndDate.IsZero():
+			return acme.NewError(acme.ErrorMalformedType, "auto-renewal end-date cannot be empty")
+		case !ar.StartDate.IsZero() && !ar.EndDate.After(ar.StartDate):
+			return acme.NewError(acme.ErrorMalformedType, "auto-renewal end-date must be after start-date")
+		case ar.Lifetime <= 0:
+			return acme.NewError(acme.ErrorMalformedType, "auto-renewal lifetime must be greater than 0")
+		case ar.LifetimeAdjust < 0:
+			return acme.NewError(acme.ErrorMalformedType, "auto-renewal lifetime-adjust cannot be negative")
+		}
+	}
+	var permanentIdentifiers int
 	for _, id := range n.Identifiers {
-		switch id.Type {
-		case acme.IP:
-			if net.ParseIP(id.Value) == nil {
-				return acme.NewError(acme.ErrorMalformedType, "invalid IP address: %s", id.Value)
-			}
-		case acme.DNS:
-			value, _ := trimIfWildcard(id.Value)
-			if _, err := x509util.SanitizeName(value); err != nil {
-				return acme.NewError(acme.ErrorMalformedType, "invalid DNS name: %s", id.Value)
-			}
-		case acme.PermanentIdentifier:
-			if id.Value == "" {
-				return acme.NewError(acme.ErrorMalformedType, "permanent identifier cannot be empty")
+		if err := validateIdentifier(id); err != nil {
+			return err
+		}
+		// Orders can combine a permanent identifier with other identifier
+		// types, but a certificate can only attest one device.
+		if id.Type == acme.PermanentIdentifier {
+			if permanentIdentifiers++; permanentIdentifiers > 1 {
+				return acme.NewError(acme.ErrorMalformedType, "orders cannot contain more than one permanent identifier")
 			}
-		default:
-			return acme.NewError(acme.ErrorMalformedType, "identifier type unsupported: %s", id.Type)
 		}
 
 		// TODO(hs): add some validations for DNS domains?
@@ -58,6 +69,40 @@ func (n *NewOrderRequest) Validate() error {
 	return nil
 }
 
+// validateIdentifier validates the type and value of an identifier in a
+// new-order or new-authz request.
+func validateIdentifier(id acme.Identifier) error {
+	switch id.Type {
+	case acme.IP:
+		ip := net.ParseIP(id.Value)
+		if ip == nil {
+			return acme.NewError(acme.ErrorMalformedType, "invalid IP address: %s", id.Value)
+		}
+		// RFC 8738 requires the textual form defined in RFC 1123 for IPv4
+		// addresses and RFC 5952 for IPv6 addresses.
+		if ip.String() != id.Value {
+			return acme.NewError(acme.ErrorMalformedType, "invalid IP address: %s is not in canonical form, use %s", id.Value, ip)
+		}
+	case acme.DNS:
+		value, _ := trimIfWildcard(id.Value)
+		if _, err := x509util.SanitizeName(value); err != nil {
+			return acme.NewError(acme.ErrorMalformedType, "invalid DNS name: %s", id.Value)
+		}
+	case acme.PermanentIdentifier:
+		if id.Value == "" {
+			return acme.NewError(acme.ErrorMalformedType, "permanent identifier cannot be empty")
+		}
+	case acme.Email:
+		// RFC 8823 requires a bare address, without display name.
+		if addr, err := mail.ParseAddress(id.Value); err != nil || addr.Address != id.Value {
+			return acme.NewError(acme.ErrorMalformedType, "invalid email address: %s", id.Value)
+		}
+	default:
+		return acme.NewError(acme.ErrorMalformedType, "identifier type unsupported: %s", id.Type)
+	}
+	return nil
+}
+
 // FinalizeRequest captures the body for a Finalize order request.
 type FinalizeRequest struct {
 	CSR string `json:"csr"`
@@ -125,8 +170,8 @@ func NewOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// TODO(hs): gather all errors, so that we can build one response with ACME subproblems
-	// include the nor.Validate() error here too, like in the example in the ACME RFC?
+	// TODO(hs): include the nor.Validate() error in the ACME subproblems too,
+	// like in the example in the ACME RFC?
 
 	acmeProv, err := acmeProvisionerFromContext(ctx)
 	if err != nil {
@@ -134,40 +179,73 @@ func NewOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var eak *acme.ExternalAccountKey
-	if acmeProv.RequireEAB {
-		if eak, err = db.GetExternalAccountKeyByAccountID(ctx, prov.GetID(), acc.ID); err != nil {
-			render.Error(w, acme.WrapErrorISE(err, "error retrieving external account binding key"))
+	// Use the durations of the requested profile, see draft-aaron-acme-profiles.
+	defaultDuration := prov.DefaultTLSCertDuration()
+	if nor.Profile != "" {
+		profile, ok := acmeProv.GetProfile(nor.Profile)
+		if !ok {
+			render.Error(w, acme.NewError(acme.ErrorInvalidProfileType, "profile %q is not supported", nor.Profile))
+			return
+		}
+		defaultDuration = profile.DefaultTLSCertDuration()
+	}
+
+	now := clock.Now()
+	if nor.AutoRenewal != nil {
+		if err := validateAutoRenewal(nor.AutoRenewal, prov.GetACMEOptions().AutoRenewal, now); err != nil {
+			render.Error(w, err)
 			return
 		}
 	}
 
+	eak, err := accountExternalAccountKey(ctx, acmeProv.RequireEAB, prov, acc)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+
 	acmePolicy, err := newACMEPolicyEngine(eak)
 	if err != nil {
 		render.Error(w, acme.WrapErrorISE(err, "error creating ACME policy engine"))
 		return
 	}
 
+	// Evaluate all the identifiers, so that orders for multiple identifiers
+	// report a subproblem for each identifier that is not authorized.
+	var subproblems []acme.Subproblem
 	for _, identifier := range nor.Identifiers {
-		// evaluate the ACME account level policy
-		if err = isIdentifierAllowed(acmePolicy, identifier); err != nil {
-			render.Error(w, acme.WrapError(acme.ErrorRejectedIdentifierType, err, "not authorized"))
-			return
-		}
-		// evaluate the provisioner level policy
-		orderIdentifier := provisioner.ACMEIdentifier{Type: provisioner.ACMEIdentifierType(identifier.Type), Value: identifier.Value}
-		if err = prov.AuthorizeOrderIdentifier(ctx, orderIdentifier); err != nil {
-			render.Error(w, acme.WrapError(acme.ErrorRejectedIdentifierType, err, "not authorized"))
-			return
+		if err := authorizeIdentifier(ctx, ca, prov, acmePolicy, identifier); err != nil {
+			if len(nor.Identifiers) == 1 {
+				render.Error(w, err)
+				return
+			}
+			subproblems = append(subproblems, acme.NewSubproblemFromError(identifier, err))
 		}
-		// evaluate the authority level policy
-		if err = ca.AreSANsAllowed(ctx, []string{identifier.Value}); err != nil {
-			render.Error(w, acme.WrapError(acme.ErrorRejectedIdentifierType, err, "not authorized"))
+	}
+	if len(subproblems) > 0 {
+		render.Error(w, acme.NewError(acme.ErrorCompoundType, "%d of %d identifiers are not authorized",
+			len(subproblems), len(nor.Identifiers)).AddSubproblems(subproblems...))
+		return
+	}
+
+	// Reuse the valid authorizations of the account if the provisioner allows
+	// pre-authorization or authorization reuse. With authorization reuse only
+	// the authorizations created during the reuse window are used.
+	var (
+		validAuthorizations []*acme.Authorization
+		maxAge              time.Duration
+	)
+	acmeOpts := prov.GetACMEOptions()
+	if reuse := acmeOpts.AuthorizationReuse; reuse.IsEnabled() {
+		maxAge = reuse.GetWindow()
+	}
+	if acmeOpts.AllowPreAuthorization || maxAge > 0 {
+		if validAuthorizations, err = db.GetAuthorizationsByAccountID(ctx, acc.ID); err != nil {
+			render.Error(w, acme.WrapErrorISE(err, "error retrieving authorizations"))
 			return
 		}
 	}
 
-	now := clock.Now()
 	// New order.
 	o := &acme.Order{
 		AccountID:        acc.ID,
@@ -178,9 +256,17 @@ func NewOrder(w http.ResponseWriter, r *http.Request) {
 		AuthorizationIDs: make([]string, len(nor.Identifiers)),
 		NotBefore:        nor.NotBefore,
 		NotAfter:         nor.NotAfter,
+		Profile:          nor.Profile,
+		AutoRenewal:      nor.AutoRenewal,
 	}
 
+	var reused int
 	for i, identifier := range o.Identifiers {
+		if az := findValidAuthorization(validAuthorizations, identifier, now, maxAge); az != nil {
+			o.AuthorizationIDs[i] = az.ID
+			reused++
+			continue
+		}
 		az := &acme.Authorization{
 			AccountID:  acc.ID,
 			Identifier: identifier,
@@ -194,29 +280,99 @@ func NewOrder(w http.ResponseWriter, r *http.Request) {
 		o.AuthorizationIDs[i] = az.ID
 	}
 
+	// The order is ready if all the authorizations are already valid.
+	if reused == len(o.Identifiers) {
+		o.Status = acme.StatusReady
+	}
+
 	if o.NotBefore.IsZero() {
 		o.NotBefore = now
 	}
 	if o.NotAfter.IsZero() {
-		o.NotAfter = o.NotBefore.Add(prov.DefaultTLSCertDuration())
+		o.NotAfter = o.NotBefore.Add(defaultDuration)
 	}
 	// If request NotBefore was empty then backdate the order.NotBefore (now)
 	// to avoid timing issues.
 	if nor.NotBefore.IsZero() {
 		o.NotBefore = o.NotBefore.Add(-defaultOrderBackdate)
 	}
+	// The validity of auto-renewal orders is defined by their start and end
+	// dates.
+	if o.AutoRenewal != nil {
+		o.NotBefore, o.NotAfter = o.AutoRenewal.StartDate, o.AutoRenewal.EndDate
+	}
 
 	if err := db.CreateOrder(ctx, o); err != nil {
 		render.Error(w, acme.WrapErrorISE(err, "error creating order"))
 		return
 	}
 
+	addExternalAccountKeyStats(ctx, w, prov.GetID(), eak, acme.ExternalAccountKeyStats{Orders: 1})
+
 	linker.LinkOrder(ctx, o)
 
 	w.Header().Set("Location", linker.GetLink(ctx, acme.OrderLinkType, o.ID))
 	render.JSONStatus(w, o, http.StatusCreated)
 }
 
+// accountExternalAccountKey returns the external account binding key of the
+// given account if the provisioner requires EAB. It returns an error if the
+// key cannot be used anymore.
+func accountExternalAccountKey(ctx context.Context, requireEAB bool, prov acme.Provisioner, acc *acme.Account) (*acme.ExternalAccountKey, error) {
+	if !requireEAB {
+		return nil, nil
+	}
+	db := acme.MustDatabaseFromContext(ctx)
+	eak, err := db.GetExternalAccountKeyByAccountID(ctx, prov.GetID(), acc.ID)
+	if err != nil {
+		return nil, acme.WrapErrorISE(err, "error retrieving external account binding key")
+	}
+	if eak != nil {
+		if err := eak.CheckUsable(clock.Now()); err != nil {
+			return nil, err
+		}
+	}
+	return eak, nil
+}
+
+// authorizeIdentifier evaluates the ACME account, provisioner and authority
+// policies for the given identifier.
+func authorizeIdentifier(ctx context.Context, ca acme.CertificateAuthority, prov acme.Provisioner, acmePolicy policy.X509Policy, identifier acme.Identifier) error {
+	// evaluate the ACME account level policy
+	if err := isIdentifierAllowed(acmePolicy, identifier); err != nil {
+		return acme.WrapError(acme.ErrorRejectedIdentifierType, err, "not authorized")
+	}
+	// evaluate the provisioner level policy
+	orderIdentifier := provisioner.ACMEIdentifier{Type: provisioner.ACMEIdentifierType(identifier.Type), Value: identifier.Value}
+	if err := prov.AuthorizeOrderIdentifier(ctx, orderIdentifier); err != nil {
+		return acme.WrapError(acme.ErrorRejectedIdentifierType, err, "not authorized")
+	}
+	// evaluate the authority level policy
+	if err := ca.AreSANsAllowed(ctx, []string{identifier.Value}); err != nil {
+		return acme.WrapError(acme.ErrorRejectedIdentifierType, err, "not authorized")
+	}
+	return nil
+}
+
+// findValidAuthorization returns the first valid authorization for the given
+// identifier that has not expired. If maxAge is greater than 0, the
+// authorization must have been created in the last maxAge. Wildcard
+// identifiers only match wildcard authorizations, which cannot be created with
+// new-authz.
+func findValidAuthorization(authzs []*acme.Authorization, identifier acme.Identifier, now time.Time, maxAge time.Duration) *acme.Authorization {
+	value, isWildcard := trimIfWildcard(identifier.Value)
+	for _, az := range authzs {
+		if maxAge > 0 && az.CreatedAt.Add(maxAge).Before(now) {
+			continue
+		}
+		if az.Status == acme.StatusValid && az.Wildcard == isWildcard && az.ExpiresAt.After(now) &&
+			az.Identifier.Type == identifier.Type && az.Identifier.Value == value {
+			return az
+		}
+	}
+	return nil
+}
+
 func isIdentifierAllowed(acmePolicy policy.X509Policy, identifier acme.Identifier) error {
 	if acmePolicy == nil {
 		return nil
@@ -224,6 +380,36 @@ func isIdentifierAllowed(acmePolicy policy.X509Policy, identifier acme.Identifie
 	return acmePolicy.AreSANsAllowed([]string{identifier.Value})
 }
 
+// validateAutoRenewal validates the auto-renewal fields of a new order against
+// the limits of the provisioner, RFC 8739. If the start date is not set, it is
+// set to the given time.
+func validateAutoRenewal(ar *acme.AutoRenewal, opts *provisioner.ACMEAutoRenewal, now time.Time) error {
+	if opts == nil {
+		return acme.NewError(acme.ErrorMalformedType, "auto-renewal orders are not supported")
+	}
+	if ar.StartDate.IsZero() {
+		ar.StartDate = now
+	}
+
+	lifetime := time.Duration(ar.Lifetime) * time.Second
+	lifetimeAdjust := time.Duration(ar.LifetimeAdjust) * time.Second
+	switch {
+	case !ar.EndDate.After(now):
+		return acme.NewError(acme.ErrorMalformedType, "auto-renewal end-date must be in the future")
+	case !ar.EndDate.After(ar.StartDate):
+		return acme.NewError(acme.ErrorMalformedType, "auto-renewal end-date must be after start-date")
+	case ar.EndDate.Sub(ar.StartDate) > opts.GetMaxDuration():
+		return acme.NewError(acme.ErrorMalformedType, "auto-renewal duration cannot be greater than %d seconds", int64(opts.GetMaxDuration().Seconds()))
+	case lifetime < opts.GetMinLifetime():
+		return acme.NewError(acme.ErrorMalformedType, "auto-renewal lifetime cannot be less than %d seconds", int64(opts.GetMinLifetime().Seconds()))
+	case lifetime+lifetimeAdjust > opts.GetMaxLifetime():
+		return acme.NewError(acme.ErrorMalformedType, "auto-renewal lifetime and lifetime-adjust cannot be greater than %d seconds", int64(opts.GetMaxLifetime().Seconds()))
+	case ar.AllowCertificateGet && !opts.AllowCertificateGet:
+		return acme.NewError(acme.ErrorMalformedType, "auto-renewal allow-certificate-get is not supported")
+	}
+	return nil
+}
+
 func newACMEPolicyEngine(eak *acme.ExternalAccountKey) (policy.X509Policy, error) {
 	if eak == nil {
 		return nil, nil
@@ -258,7 +444,7 @@ func newAuthorization(ctx context.Context, az *acme.Authorization) error {
 	prov := acme.MustProvisionerFromContext(ctx)
 	az.Challenges = make([]*acme.Challenge, 0, len(chTypes))
 	for _, typ := range chTypes {
-		if !prov.IsChallengeEnabled(ctx, provisioner.ACMEChallenge(typ)) {
+		if !prov.IsIdentifierChallengeEnabled(ctx, provisioner.ACMEIdentifierType(az.Identifier.Type), provisioner.ACMEChallenge(typ)) {
 			continue
 		}
 
@@ -272,6 +458,11 @@ func newAuthorization(ctx context.Context, az *acme.Authorization) error {
 		if err := db.CreateChallenge(ctx, ch); err != nil {
 			return acme.WrapErrorISE(err, "error creating challenge")
 		}
+		if typ == acme.EMAILREPLY00 {
+			if err := acme.SendEmailChallenge(ctx, db, ch); err != nil {
+				return err
+			}
+		}
 		az.Challenges = append(az.Challenges, ch)
 	}
 	if err = db.CreateAuthorization(ctx, az); err != nil {
@@ -280,40 +471,95 @@ func newAuthorization(ctx context.Context, az *acme.Authorization) error {
 	return nil
 }
 
+// UpdateOrderRequest represents the body of a request to update an order. RFC
+// 8739 allows clients to cancel auto-renewal orders.
+type UpdateOrderRequest struct {
+	Status acme.Status `json:"status"`
+}
+
+// Validate validates an update-order request body.
+func (u *UpdateOrderRequest) Validate() error {
+	if u.Status != acme.StatusCanceled {
+		return acme.NewError(acme.ErrorMalformedType, "cannot update order status to %s, only %s is supported",
+			u.Status, acme.StatusCanceled)
+	}
+	return nil
+}
+
+// GetOrUpdateOrder ACME api for retrieving an order, or for canceling an
+// auto-renewal order if the request is not a POST-as-GET.
+func GetOrUpdateOrder(w http.ResponseWriter, r *http.Request) {
+	payload, err := payloadFromContext(r.Context())
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+	if payload.isPostAsGet {
+		GetOrder(w, r)
+	} else {
+		CancelOrder(w, r)
+	}
+}
+
 // GetOrder ACME api for retrieving an order.
 func GetOrder(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	db := acme.MustDatabaseFromContext(ctx)
 	linker := acme.MustLinkerFromContext(ctx)
 
-	acc, err := accountFromContext(ctx)
+	o, err := orderFromRequest(r)
 	if err != nil {
 		render.Error(w, err)
 		return
 	}
-	prov, err := provisionerFromContext(ctx)
-	if err != nil {
-		render.Error(w, err)
+	if err = o.UpdateStatus(ctx, db); err != nil {
+		render.Error(w, acme.WrapErrorISE(err, "error updating order status"))
 		return
 	}
 
-	o, err := db.GetOrder(ctx, chi.URLParam(r, "ordID"))
+	linker.LinkOrder(ctx, o)
+
+	w.Header().Set("Location", linker.GetLink(ctx, acme.OrderLinkType, o.ID))
+	render.JSON(w, o)
+}
+
+// CancelOrder ACME api for canceling an auto-renewal order, RFC 8739. After
+// the cancellation the certificates of the order are not renewed.
+func CancelOrder(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db := acme.MustDatabaseFromContext(ctx)
+	linker := acme.MustLinkerFromContext(ctx)
+
+	payload, err := payloadFromContext(ctx)
 	if err != nil {
-		render.Error(w, acme.WrapErrorISE(err, "error retrieving order"))
+		render.Error(w, err)
 		return
 	}
-	if acc.ID != o.AccountID {
-		render.Error(w, acme.NewError(acme.ErrorUnauthorizedType,
-			"account '%s' does not own order '%s'", acc.ID, o.ID))
+	var uor UpdateOrderRequest
+	if err := json.Unmarshal(payload.value, &uor); err != nil {
+		render.Error(w, acme.WrapError(acme.ErrorMalformedType, err,
+			"failed to unmarshal update-order request payload"))
 		return
 	}
-	if prov.GetID() != o.ProvisionerID {
-		render.Error(w, acme.NewError(acme.ErrorUnauthorizedType,
-			"provisioner '%s' does not own order '%s'", prov.GetID(), o.ID))
+	if err := uor.Validate(); err != nil {
+		render.Error(w, err)
 		return
 	}
-	if err = o.UpdateStatus(ctx, db); err != nil {
-		render.Error(w, acme.WrapErrorISE(err, "error updating order status"))
+
+	o, err := orderFromRequest(r)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+	if o.AutoRenewal == nil || o.Status != acme.StatusValid {
+		render.Error(w, acme.NewError(acme.ErrorAutoRenewalCancellationInvalidType,
+			"order '%s' is not a valid auto-renewal order", o.ID))
+		return
+	}
+
+	o.Status = acme.StatusCanceled
+	if err := db.UpdateOrder(ctx, o); err != nil {
+		render.Error(w, acme.WrapErrorISE(err, "error updating order"))
 		return
 	}
 
@@ -323,6 +569,36 @@ func GetOrder(w http.ResponseWriter, r *http.Request) {
 	render.JSON(w, o)
 }
 
+// orderFromRequest returns the order in the request after checking that the
+// account and provisioner in the context own it.
+func orderFromRequest(r *http.Request) (*acme.Order, error) {
+	ctx := r.Context()
+	db := acme.MustDatabaseFromContext(ctx)
+
+	acc, err := accountFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	prov, err := provisionerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	o, err := db.GetOrder(ctx, chi.URLParam(r, "ordID"))
+	if err != nil {
+		return nil, acme.WrapErrorISE(err, "error retrieving order")
+	}
+	if acc.ID != o.AccountID {
+		return nil, acme.NewError(acme.ErrorUnauthorizedType,
+			"account '%s' does not own order '%s'", acc.ID, o.ID)
+	}
+	if prov.GetID() != o.ProvisionerID {
+		return nil, acme.NewError(acme.ErrorUnauthorizedType,
+			"provisioner '%s' does not own order '%s'", prov.GetID(), o.ID)
+	}
+	return o, nil
+}
+
 // FinalizeOrder attempts to finalize an order and create a certificate.
 func FinalizeOrder(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -371,12 +647,32 @@ func FinalizeOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Accounts bound to a revoked or expired EAB key cannot get certificates.
+	var eak *acme.ExternalAccountKey
+	if acmeProv, ok := prov.(*provisioner.ACME); ok && acmeProv.RequireEAB {
+		if eak, err = db.GetExternalAccountKeyByAccountID(ctx, prov.GetID(), acc.ID); err != nil {
+			render.Error(w, acme.WrapErrorISE(err, "error retrieving external account binding key"))
+			return
+		}
+		if eak != nil {
+			if err := eak.CheckUsable(clock.Now()); err != nil {
+				render.Error(w, err)
+				return
+			}
+		}
+	}
+
 	ca := mustAuthority(ctx)
 	if err = o.Finalize(ctx, db, fr.csr, ca, prov); err != nil {
 		render.Error(w, acme.WrapErrorISE(err, "error finalizing order"))
 		return
 	}
 
+	addExternalAccountKeyStats(ctx, w, prov.GetID(), eak, acme.ExternalAccountKeyStats{
+		Certificates: 1,
+		LastIssuedAt: clock.Now(),
+	})
+
 	linker.LinkOrder(ctx, o)
 
 	w.Header().Set("Location", linker.GetLink(ctx, acme.OrderLinkType, o.ID))
@@ -399,6 +695,8 @@ func challengeTypes(az *acme.Authorization) []acme.ChallengeType {
 		}
 	case acme.PermanentIdentifier:
 		chTypes = []acme.ChallengeType{acme.DEVICEATTEST01}
+	case acme.Email:
+		chTypes = []acme.ChallengeType{acme.EMAILREPLY00}
 	default:
 		chTypes = []acme.ChallengeType{}
 	}
@@ -50,6 +50,18 @@ func TestNewOrderRequest_Validate(t *testing.T) {
 				err: acme.NewError(acme.ErrorMalformedType, "identifier type unsupported: foo"),
 			}
 		},
+		"fail/multiple-permanent-identifiers": func(t *testing.T) test {
+			return test{
+				nor: &NewOrderRequest{
+					Identifiers: []acme.Identifier{
+						{Type: "permanent-identifier", Value: "7b53aa19-26f7-4fac-824f-7a781de0dab0"},
+						{Type: "dns", Value: "device.internal"},
+						{Type: "permanent-identifier", Value: "81a8bc3e-1a53-4f2f-9b7c-6a3c0a3ae1b5"},
+					},
+				},
+				err: acme.NewError(acme.ErrorMalformedType, "orders cannot contain more than one permanent identifier"),
+			}
+		},
 		"fail/bad-identifier/bad-dns": func(t *testing.T) test {
 			return test{
 				nor: &NewOrderRequest{
@@ -60,6 +72,16 @@ func TestNewOrderRequest_Validate(t *testing.T) {
 				err: acme.NewError(acme.ErrorMalformedType, "invalid DNS name: xn--bücher.example.com"),
 			}
 		},
+		"fail/bad-identifier/email": func(t *testing.T) test {
+			return test{
+				nor: &NewOrderRequest{
+					Identifiers: []acme.Identifier{
+						{Type: "email", Value: "Jane Doe <jane@example.com>"},
+					},
+				},
+				err: acme.NewError(acme.ErrorMalformedType, "invalid email address: Jane Doe <jane@example.com>"),
+			}
+		},
 		"fail/bad-identifier/dns-port": func(t *testing.T) test {
 			return test{
 				nor: &NewOrderRequest{
@@ -96,6 +118,53 @@ func TestNewOrderRequest_Validate(t *testing.T) {
 				err: acme.NewError(acme.ErrorMalformedType, "invalid IP address: %s", "192.168.42.1000"),
 			}
 		},
+		"fail/ip-not-canonical": func(t *testing.T) test {
+			return test{
+				nor: &NewOrderRequest{
+					Identifiers: []acme.Identifier{
+						{Type: "ip", Value: "2001:DB8:0::1"},
+					},
+				},
+				err: acme.NewError(acme.ErrorMalformedType, "invalid IP address: %s is not in canonical form, use %s", "2001:DB8:0::1", "2001:db8::1"),
+			}
+		},
+		"fail/auto-renewal-with-validity": func(t *testing.T) test {
+			return test{
+				nor: &NewOrderRequest{
+					Identifiers: []acme.Identifier{
+						{Type: "dns", Value: "example.com"},
+					},
+					NotAfter: time.Now().UTC().Add(time.Hour),
+					AutoRenewal: &acme.AutoRenewal{
+						EndDate:  time.Now().UTC().Add(24 * time.Hour),
+						Lifetime: 3600,
+					},
+				},
+				err: acme.NewError(acme.ErrorMalformedType, "notBefore and notAfter cannot be used in auto-renewal orders"),
+			}
+		},
+		"fail/auto-renewal-no-end-date": func(t *testing.T) test {
+			return test{
+				nor: &NewOrderRequest{
+					Identifiers: []acme.Identifier{
+						{Type: "dns", Value: "example.com"},
+					},
+					AutoRenewal: &acme.AutoRenewal{Lifetime: 3600},
+				},
+				err: acme.NewError(acme.ErrorMalformedType, "auto-renewal end-date cannot be empty"),
+			}
+		},
+		"fail/auto-renewal-no-lifetime": func(t *testing.T) test {
+			return test{
+				nor: &NewOrderRequest{
+					Identifiers: []acme.Identifier{
+						{Type: "dns", Value: "example.com"},
+					},
+					AutoRenewal: &acme.AutoRenewal{EndDate: time.Now().UTC().Add(24 * time.Hour)},
+				},
+				err: acme.NewError(acme.ErrorMalformedType, "auto-renewal lifetime must be greater than 0"),
+			}
+		},
 		"ok": func(t *testing.T) test {
 			nbf := time.Now().UTC().Add(time.Minute)
 			naf := time.Now().UTC().Add(5 * time.Minute)
@@ -158,6 +227,21 @@ func TestNewOrderRequest_Validate(t *testing.T) {
 				naf: naf,
 			}
 		},
+		"ok/email": func(t *testing.T) test {
+			nbf := time.Now().UTC().Add(time.Minute)
+			naf := time.Now().UTC().Add(5 * time.Minute)
+			return test{
+				nor: &NewOrderRequest{
+					Identifiers: []acme.Identifier{
+						{Type: "email", Value: "jane@example.com"},
+					},
+					NotAfter:  naf,
+					NotBefore: nbf,
+				},
+				nbf: nbf,
+				naf: naf,
+			}
+		},
 		"ok/mixed-ipv4-and-ipv6": func(t *testing.T) test {
 			nbf := time.Now().UTC().Add(time.Minute)
 			naf := time.Now().UTC().Add(5 * time.Minute)
@@ -501,6 +585,191 @@ func TestHandler_GetOrder(t *testing.T) {
 	}
 }
 
+func TestHandler_CancelOrder(t *testing.T) {
+	prov := newProv()
+	escProvName := url.PathEscape(prov.GetName())
+	baseURL := &url.URL{Scheme: "https", Host: "test.ca.smallstep.com"}
+
+	chiCtx := chi.NewRouteContext()
+	chiCtx.URLParams.Add("ordID", "orderID")
+	u := fmt.Sprintf("%s/acme/%s/order/orderID", baseURL.String(), escProvName)
+
+	now := clock.Now()
+	newOrder := func(status acme.Status, ar *acme.AutoRenewal) *acme.Order {
+		return &acme.Order{
+			ID:               "orderID",
+			AccountID:        "accountID",
+			ProvisionerID:    fmt.Sprintf("acme/%s", prov.GetName()),
+			Status:           status,
+			CertificateID:    "certID",
+			ExpiresAt:        now.Add(time.Hour),
+			NotBefore:        now,
+			NotAfter:         now.Add(72 * time.Hour),
+			AuthorizationIDs: []string{"foo"},
+			Identifiers:      []acme.Identifier{{Type: "dns", Value: "example.com"}},
+			AutoRenewal:      ar,
+		}
+	}
+	ar := &acme.AutoRenewal{StartDate: now, EndDate: now.Add(72 * time.Hour), Lifetime: 86400}
+	newContext := func(payload []byte) context.Context {
+		ctx := acme.NewProvisionerContext(context.Background(), prov)
+		ctx = context.WithValue(ctx, accContextKey, &acme.Account{ID: "accountID"})
+		ctx = context.WithValue(ctx, payloadContextKey, &payloadInfo{value: payload})
+		return context.WithValue(ctx, chi.RouteCtxKey, chiCtx)
+	}
+
+	type test struct {
+		db         acme.DB
+		ctx        context.Context
+		statusCode int
+		err        *acme.Error
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/unmarshal-error": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        newContext([]byte("foo")),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "failed to unmarshal update-order request payload: invalid character 'o' in literal false (expecting 'a')"),
+			}
+		},
+		"fail/invalid-status": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        newContext([]byte(`{"status":"deactivated"}`)),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "cannot update order status to deactivated, only canceled is supported"),
+			}
+		},
+		"fail/not-auto-renewal": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetOrder: func(ctx context.Context, id string) (*acme.Order, error) {
+						return newOrder(acme.StatusValid, nil), nil
+					},
+				},
+				ctx:        newContext([]byte(`{"status":"canceled"}`)),
+				statusCode: 403,
+				err:        acme.NewError(acme.ErrorAutoRenewalCancellationInvalidType, "order 'orderID' is not a valid auto-renewal order"),
+			}
+		},
+		"fail/already-canceled": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetOrder: func(ctx context.Context, id string) (*acme.Order, error) {
+						return newOrder(acme.StatusCanceled, ar), nil
+					},
+				},
+				ctx:        newContext([]byte(`{"status":"canceled"}`)),
+				statusCode: 403,
+				err:        acme.NewError(acme.ErrorAutoRenewalCancellationInvalidType, "order 'orderID' is not a valid auto-renewal order"),
+			}
+		},
+		"fail/db.UpdateOrder-error": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetOrder: func(ctx context.Context, id string) (*acme.Order, error) {
+						return newOrder(acme.StatusValid, ar), nil
+					},
+					MockUpdateOrder: func(ctx context.Context, o *acme.Order) error {
+						return acme.NewErrorISE("force")
+					},
+				},
+				ctx:        newContext([]byte(`{"status":"canceled"}`)),
+				statusCode: 500,
+				err:        acme.NewErrorISE("force"),
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetOrder: func(ctx context.Context, id string) (*acme.Order, error) {
+						return newOrder(acme.StatusValid, ar), nil
+					},
+					MockUpdateOrder: func(ctx context.Context, o *acme.Order) error {
+						assert.Equals(t, o.Status, acme.StatusCanceled)
+						return nil
+					},
+				},
+				ctx:        newContext([]byte(`{"status":"canceled"}`)),
+				statusCode: 200,
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			ctx := newBaseContext(tc.ctx, tc.db, acme.NewLinker("test.ca.smallstep.com", "acme"))
+			req := httptest.NewRequest("POST", u, http.NoBody)
+			req = req.WithContext(ctx)
+			w := httptest.NewRecorder()
+			GetOrUpdateOrder(w, req)
+			res := w.Result()
+
+			assert.Equals(t, res.StatusCode, tc.statusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+
+			if res.StatusCode >= 400 && assert.NotNil(t, tc.err) {
+				var ae acme.Error
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &ae))
+
+				assert.Equals(t, ae.Type, tc.err.Type)
+				assert.Equals(t, ae.Detail, tc.err.Detail)
+				assert.Equals(t, res.Header["Content-Type"], []string{"application/problem+json"})
+			} else {
+				var o acme.Order
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &o))
+
+				assert.Equals(t, o.Status, acme.StatusCanceled)
+				assert.Equals(t, o.StarCertificateURL, fmt.Sprintf("%s/acme/%s/star-certificate/orderID", baseURL.String(), escProvName))
+				assert.Equals(t, res.Header["Location"], []string{u})
+				assert.Equals(t, res.Header["Content-Type"], []string{"application/json"})
+			}
+		})
+	}
+}
+
+func Test_validateAutoRenewal(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	opts := &provisioner.ACMEAutoRenewal{
+		MinLifetime: &provisioner.Duration{Duration: time.Hour},
+		MaxDuration: &provisioner.Duration{Duration: 30 * 24 * time.Hour},
+	}
+	p := &provisioner.ACME{Type: "ACME", Name: "acme", AutoRenewal: opts}
+	assert.FatalError(t, p.Init(provisioner.Config{Claims: globalProvisionerClaims}))
+
+	tests := []struct {
+		name    string
+		ar      *acme.AutoRenewal
+		opts    *provisioner.ACMEAutoRenewal
+		wantErr string
+	}{
+		{"ok", &acme.AutoRenewal{EndDate: now.Add(48 * time.Hour), Lifetime: 43200, LifetimeAdjust: 3600}, opts, ""},
+		{"fail not supported", &acme.AutoRenewal{EndDate: now.Add(48 * time.Hour), Lifetime: 86400}, nil, "auto-renewal orders are not supported"},
+		{"fail end date", &acme.AutoRenewal{StartDate: now.Add(-48 * time.Hour), EndDate: now.Add(-time.Hour), Lifetime: 86400}, opts, "auto-renewal end-date must be in the future"},
+		{"fail duration", &acme.AutoRenewal{EndDate: now.Add(60 * 24 * time.Hour), Lifetime: 86400}, opts, "auto-renewal duration cannot be greater than 2592000 seconds"},
+		{"fail min lifetime", &acme.AutoRenewal{EndDate: now.Add(48 * time.Hour), Lifetime: 60}, opts, "auto-renewal lifetime cannot be less than 3600 seconds"},
+		{"fail max lifetime", &acme.AutoRenewal{EndDate: now.Add(48 * time.Hour), Lifetime: 86400, LifetimeAdjust: 86400}, opts, "auto-renewal lifetime and lifetime-adjust cannot be greater than 86400 seconds"},
+		{"fail allow certificate get", &acme.AutoRenewal{EndDate: now.Add(48 * time.Hour), Lifetime: 86400, AllowCertificateGet: true}, opts, "auto-renewal allow-certificate-get is not supported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateAutoRenewal(tt.ar, tt.opts, now)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				assert.Equals(t, tt.ar.StartDate, now)
+				return
+			}
+			if assert.Error(t, err) {
+				assert.HasPrefix(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestHandler_newAuthorization(t *testing.T) {
 	defaultProvisioner := newProv()
 	type test struct {
@@ -534,6 +803,34 @@ func TestHandler_newAuthorization(t *testing.T) {
 				err: acme.NewErrorISE("error creating challenge: force"),
 			}
 		},
+		"fail/email-challenge-not-configured": func(t *testing.T) test {
+			az := &acme.Authorization{
+				AccountID: "accID",
+				Identifier: acme.Identifier{
+					Type:  "email",
+					Value: "jane@example.com",
+				},
+			}
+			emailProv := newProv()
+			emailProv.(*provisioner.ACME).Challenges = []provisioner.ACMEChallenge{provisioner.EMAIL_REPLY_00}
+			return test{
+				prov: emailProv,
+				db: &acme.MockDB{
+					MockCreateChallenge: func(ctx context.Context, ch *acme.Challenge) error {
+						assert.Equals(t, ch.Type, acme.EMAILREPLY00)
+						assert.Equals(t, ch.Value, "jane@example.com")
+						ch.ID = "chID"
+						return nil
+					},
+					MockCreateAuthorization: func(ctx context.Context, _az *acme.Authorization) error {
+						t.Errorf("createAuthorization should not be called")
+						return nil
+					},
+				},
+				az:  az,
+				err: acme.NewErrorISE("email-reply-00 challenge is not configured"),
+			}
+		},
 		"fail/error-db.CreateAuthorization": func(t *testing.T) test {
 			az := &acme.Authorization{
 				AccountID: "accID",
@@ -755,6 +1052,40 @@ func TestHandler_newAuthorization(t *testing.T) {
 				az: az,
 			}
 		},
+		"ok/identifier-challenges": func(t *testing.T) test {
+			var ch1 *acme.Challenge
+			az := &acme.Authorization{
+				AccountID: "accID",
+				Identifier: acme.Identifier{
+					Type:  "dns",
+					Value: "device.internal",
+				},
+				Status:    acme.StatusPending,
+				ExpiresAt: clock.Now(),
+			}
+			prov := newProv()
+			prov.(*provisioner.ACME).Challenges = []provisioner.ACMEChallenge{provisioner.HTTP_01, provisioner.DNS_01, provisioner.DEVICE_ATTEST_01}
+			prov.(*provisioner.ACME).IdentifierChallenges = map[provisioner.ACMEIdentifierType][]provisioner.ACMEChallenge{
+				provisioner.DNS: {provisioner.DNS_01},
+			}
+			return test{
+				prov: prov,
+				db: &acme.MockDB{
+					MockCreateChallenge: func(ctx context.Context, ch *acme.Challenge) error {
+						ch.ID = "dns"
+						assert.Equals(t, ch.Type, acme.DNS01)
+						ch1 = ch
+						return nil
+					},
+					MockCreateAuthorization: func(ctx context.Context, _az *acme.Authorization) error {
+						assert.Equals(t, _az.Identifier, az.Identifier)
+						assert.Equals(t, _az.Challenges, []*acme.Challenge{ch1})
+						return nil
+					},
+				},
+				az: az,
+			}
+		},
 	}
 	for name, run := range tests {
 		t.Run(name, func(t *testing.T) {
@@ -946,6 +1277,27 @@ func TestHandler_NewOrder(t *testing.T) {
 				err: acme.NewErrorISE("error retrieving external account binding key: force"),
 			}
 		},
+		"fail/invalid-profile": func(t *testing.T) test {
+			acc := &acme.Account{ID: "accID"}
+			fr := &NewOrderRequest{
+				Identifiers: []acme.Identifier{
+					{Type: "dns", Value: "zap.internal"},
+				},
+				Profile: "unknown",
+			}
+			b, err := json.Marshal(fr)
+			assert.FatalError(t, err)
+			ctx := acme.NewProvisionerContext(context.Background(), prov)
+			ctx = context.WithValue(ctx, accContextKey, acc)
+			ctx = context.WithValue(ctx, payloadContextKey, &payloadInfo{value: b})
+			return test{
+				ctx:        ctx,
+				statusCode: 400,
+				ca:         &mockCA{},
+				db:         &acme.MockDB{},
+				err:        acme.NewError(acme.ErrorInvalidProfileType, `profile "unknown" is not supported`),
+			}
+		},
 		"fail/newACMEPolicyEngine-error": func(t *testing.T) test {
 			acmeProv := newACMEProv(t)
 			acmeProv.RequireEAB = true
@@ -1018,6 +1370,53 @@ func TestHandler_NewOrder(t *testing.T) {
 				err: acme.NewError(acme.ErrorRejectedIdentifierType, "not authorized"),
 			}
 		},
+		"fail/isIdentifierAllowed-multiple-identifiers": func(t *testing.T) test {
+			acmeProv := newACMEProv(t)
+			acmeProv.RequireEAB = true
+			acc := &acme.Account{ID: "accID"}
+			fr := &NewOrderRequest{
+				Identifiers: []acme.Identifier{
+					{Type: "dns", Value: "zap.internal"},
+					{Type: "dns", Value: "foo.local"},
+					{Type: "dns", Value: "bar.internal"},
+				},
+			}
+			b, err := json.Marshal(fr)
+			assert.FatalError(t, err)
+			ctx := acme.NewProvisionerContext(context.Background(), acmeProv)
+			ctx = context.WithValue(ctx, accContextKey, acc)
+			ctx = context.WithValue(ctx, payloadContextKey, &payloadInfo{value: b})
+			return test{
+				ctx:        ctx,
+				statusCode: 400,
+				ca:         &mockCA{},
+				db: &acme.MockDB{
+					MockGetExternalAccountKeyByAccountID: func(ctx context.Context, provisionerID, accountID string) (*acme.ExternalAccountKey, error) {
+						return &acme.ExternalAccountKey{
+							Policy: &acme.Policy{
+								X509: acme.X509Policy{
+									Allowed: acme.PolicyNames{
+										DNSNames: []string{"*.local"},
+									},
+								},
+							},
+						}, nil
+					},
+				},
+				err: acme.NewError(acme.ErrorCompoundType, "2 of 3 identifiers are not authorized").AddSubproblems(
+					acme.Subproblem{
+						Type:       "urn:ietf:params:acme:error:rejectedIdentifier",
+						Detail:     `not authorized: dns name "zap.internal" not allowed`,
+						Identifier: &acme.Identifier{Type: "dns", Value: "zap.internal"},
+					},
+					acme.Subproblem{
+						Type:       "urn:ietf:params:acme:error:rejectedIdentifier",
+						Detail:     `not authorized: dns name "bar.internal" not allowed`,
+						Identifier: &acme.Identifier{Type: "dns", Value: "bar.internal"},
+					},
+				),
+			}
+		},
 		"fail/prov.AuthorizeOrderIdentifier-error": func(t *testing.T) test {
 			options := &provisioner.Options{
 				X509: &provisioner.X509Options{
@@ -1432,6 +1831,211 @@ func TestHandler_NewOrder(t *testing.T) {
 				},
 			}
 		},
+		"ok/pre-authorized": func(t *testing.T) test {
+			preAuthProv := &provisioner.ACME{
+				Type:                  "ACME",
+				Name:                  "test@acme-<test>provisioner.com",
+				AllowPreAuthorization: true,
+			}
+			assert.FatalError(t, preAuthProv.Init(provisioner.Config{Claims: globalProvisionerClaims}))
+			acc := &acme.Account{ID: "accID"}
+			nor := &NewOrderRequest{
+				Identifiers: []acme.Identifier{
+					{Type: "dns", Value: "zap.internal"},
+				},
+			}
+			b, err := json.Marshal(nor)
+			assert.FatalError(t, err)
+			ctx := acme.NewProvisionerContext(context.Background(), preAuthProv)
+			ctx = context.WithValue(ctx, accContextKey, acc)
+			ctx = context.WithValue(ctx, payloadContextKey, &payloadInfo{value: b})
+			return test{
+				ctx:        ctx,
+				statusCode: 201,
+				nor:        nor,
+				ca:         &mockCA{},
+				db: &acme.MockDB{
+					MockGetAuthorizationsByAccountID: func(ctx context.Context, accountID string) ([]*acme.Authorization, error) {
+						assert.Equals(t, accountID, "accID")
+						return []*acme.Authorization{
+							{ID: "pendingID", Identifier: nor.Identifiers[0], Status: acme.StatusPending, ExpiresAt: clock.Now().Add(time.Hour)},
+							{ID: "expiredID", Identifier: nor.Identifiers[0], Status: acme.StatusValid, ExpiresAt: clock.Now().Add(-time.Hour)},
+							{ID: "otherID", Identifier: acme.Identifier{Type: "dns", Value: "zar.internal"}, Status: acme.StatusValid, ExpiresAt: clock.Now().Add(time.Hour)},
+							{ID: "validID", Identifier: nor.Identifiers[0], Status: acme.StatusValid, ExpiresAt: clock.Now().Add(time.Hour)},
+						}, nil
+					},
+					MockCreateChallenge: func(ctx context.Context, ch *acme.Challenge) error {
+						assert.FatalError(t, errors.New("unexpected challenge"))
+						return errors.New("force")
+					},
+					MockCreateAuthorization: func(ctx context.Context, az *acme.Authorization) error {
+						assert.FatalError(t, errors.New("unexpected authorization"))
+						return errors.New("force")
+					},
+					MockCreateOrder: func(ctx context.Context, o *acme.Order) error {
+						o.ID = "ordID"
+						assert.Equals(t, o.AuthorizationIDs, []string{"validID"})
+						return nil
+					},
+				},
+				vr: func(t *testing.T, o *acme.Order) {
+					assert.Equals(t, o.ID, "ordID")
+					assert.Equals(t, o.AuthorizationURLs, []string{fmt.Sprintf("%s/acme/%s/authz/validID", baseURL.String(), escProvName)})
+				},
+			}
+		},
+		"ok/reused-authorizations": func(t *testing.T) test {
+			reuseProv := &provisioner.ACME{
+				Type:               "ACME",
+				Name:               "test@acme-<test>provisioner.com",
+				AuthorizationReuse: &provisioner.ACMEAuthorizationReuse{Enabled: true},
+			}
+			assert.FatalError(t, reuseProv.Init(provisioner.Config{Claims: globalProvisionerClaims}))
+			acc := &acme.Account{ID: "accID"}
+			nor := &NewOrderRequest{
+				Identifiers: []acme.Identifier{
+					{Type: "dns", Value: "zap.internal"},
+					{Type: "dns", Value: "*.zap.internal"},
+				},
+			}
+			b, err := json.Marshal(nor)
+			assert.FatalError(t, err)
+			ctx := acme.NewProvisionerContext(context.Background(), reuseProv)
+			ctx = context.WithValue(ctx, accContextKey, acc)
+			ctx = context.WithValue(ctx, payloadContextKey, &payloadInfo{value: b})
+			return test{
+				ctx:        ctx,
+				statusCode: 201,
+				nor:        nor,
+				ca:         &mockCA{},
+				db: &acme.MockDB{
+					MockGetAuthorizationsByAccountID: func(ctx context.Context, accountID string) ([]*acme.Authorization, error) {
+						assert.Equals(t, accountID, "accID")
+						return []*acme.Authorization{
+							{ID: "oldID", Identifier: acme.Identifier{Type: "dns", Value: "zap.internal"}, Status: acme.StatusValid, CreatedAt: clock.Now().Add(-25 * time.Hour), ExpiresAt: clock.Now().Add(time.Hour)},
+							{ID: "wildcardID", Identifier: acme.Identifier{Type: "dns", Value: "zap.internal"}, Wildcard: true, Status: acme.StatusValid, CreatedAt: clock.Now(), ExpiresAt: clock.Now().Add(time.Hour)},
+							{ID: "validID", Identifier: acme.Identifier{Type: "dns", Value: "zap.internal"}, Status: acme.StatusValid, CreatedAt: clock.Now(), ExpiresAt: clock.Now().Add(time.Hour)},
+						}, nil
+					},
+					MockCreateAuthorization: func(ctx context.Context, az *acme.Authorization) error {
+						assert.FatalError(t, errors.New("unexpected authorization"))
+						return errors.New("force")
+					},
+					MockCreateOrder: func(ctx context.Context, o *acme.Order) error {
+						o.ID = "ordID"
+						assert.Equals(t, o.AuthorizationIDs, []string{"validID", "wildcardID"})
+						return nil
+					},
+				},
+				vr: func(t *testing.T, o *acme.Order) {
+					assert.Equals(t, o.ID, "ordID")
+					assert.Equals(t, o.Status, acme.StatusReady)
+				},
+			}
+		},
+		"ok/reuse-disabled": func(t *testing.T) test {
+			noReuseProv := &provisioner.ACME{
+				Type: "ACME",
+				Name: "test@acme-<test>provisioner.com",
+			}
+			assert.FatalError(t, noReuseProv.Init(provisioner.Config{Claims: globalProvisionerClaims}))
+			acc := &acme.Account{ID: "accID"}
+			nor := &NewOrderRequest{
+				Identifiers: []acme.Identifier{
+					{Type: "dns", Value: "zap.internal"},
+				},
+			}
+			b, err := json.Marshal(nor)
+			assert.FatalError(t, err)
+			ctx := acme.NewProvisionerContext(context.Background(), noReuseProv)
+			ctx = context.WithValue(ctx, accContextKey, acc)
+			ctx = context.WithValue(ctx, payloadContextKey, &payloadInfo{value: b})
+			return test{
+				ctx:        ctx,
+				statusCode: 201,
+				nor:        nor,
+				ca:         &mockCA{},
+				db: &acme.MockDB{
+					MockGetAuthorizationsByAccountID: func(ctx context.Context, accountID string) ([]*acme.Authorization, error) {
+						assert.FatalError(t, errors.New("unexpected authorizations lookup"))
+						return nil, errors.New("force")
+					},
+					MockCreateChallenge: func(ctx context.Context, ch *acme.Challenge) error {
+						ch.ID = string(ch.Type)
+						return nil
+					},
+					MockCreateAuthorization: func(ctx context.Context, az *acme.Authorization) error {
+						az.ID = "az1ID"
+						return nil
+					},
+					MockCreateOrder: func(ctx context.Context, o *acme.Order) error {
+						o.ID = "ordID"
+						assert.Equals(t, o.AuthorizationIDs, []string{"az1ID"})
+						return nil
+					},
+				},
+				vr: func(t *testing.T, o *acme.Order) {
+					assert.Equals(t, o.ID, "ordID")
+					assert.Equals(t, o.Status, acme.StatusPending)
+				},
+			}
+		},
+		"ok/profile": func(t *testing.T) test {
+			profileProv := &provisioner.ACME{
+				Type: "ACME",
+				Name: "test@acme-<test>provisioner.com",
+				Profiles: map[string]*provisioner.ACMEProfile{
+					"shortlived": {
+						Description: "Short-lived certificates",
+						Claims:      &provisioner.Claims{DefaultTLSDur: &provisioner.Duration{Duration: 6 * time.Hour}},
+					},
+				},
+			}
+			assert.FatalError(t, profileProv.Init(provisioner.Config{Claims: globalProvisionerClaims}))
+			acc := &acme.Account{ID: "accID"}
+			nor := &NewOrderRequest{
+				Identifiers: []acme.Identifier{
+					{Type: "dns", Value: "zap.internal"},
+				},
+				Profile: "shortlived",
+			}
+			b, err := json.Marshal(nor)
+			assert.FatalError(t, err)
+			ctx := acme.NewProvisionerContext(context.Background(), profileProv)
+			ctx = context.WithValue(ctx, accContextKey, acc)
+			ctx = context.WithValue(ctx, payloadContextKey, &payloadInfo{value: b})
+			return test{
+				ctx:        ctx,
+				statusCode: 201,
+				nor:        nor,
+				ca:         &mockCA{},
+				db: &acme.MockDB{
+					MockCreateChallenge: func(ctx context.Context, ch *acme.Challenge) error {
+						ch.ID = string(ch.Type)
+						return nil
+					},
+					MockCreateAuthorization: func(ctx context.Context, az *acme.Authorization) error {
+						az.ID = "az1ID"
+						return nil
+					},
+					MockCreateOrder: func(ctx context.Context, o *acme.Order) error {
+						o.ID = "ordID"
+						assert.Equals(t, o.Profile, "shortlived")
+						return nil
+					},
+				},
+				vr: func(t *testing.T, o *acme.Order) {
+					now := clock.Now()
+					testBufferDur := 5 * time.Second
+					expNaf := now.Add(6 * time.Hour)
+
+					assert.Equals(t, o.ID, "ordID")
+					assert.Equals(t, o.Profile, "shortlived")
+					assert.True(t, o.NotAfter.Add(-testBufferDur).Before(expNaf))
+					assert.True(t, o.NotAfter.Add(testBufferDur).After(expNaf))
+				},
+			}
+		},
 		"ok/nbf-no-naf": func(t *testing.T) test {
 			now := clock.Now()
 			expNbf := now.Add(10 * time.Minute)
@@ -2199,6 +2803,16 @@ func TestHandler_challengeTypes(t *testing.T) {
 			},
 			want: []acme.ChallengeType{acme.HTTP01, acme.TLSALPN01},
 		},
+		{
+			name: "ok/email",
+			args: args{
+				az: &acme.Authorization{
+					Identifier: acme.Identifier{Type: "email", Value: "jane@example.com"},
+					Wildcard:   false,
+				},
+			},
+			want: []acme.ChallengeType{acme.EMAILREPLY00},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
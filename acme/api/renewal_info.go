@@ -0,0 +1,80 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/api/render"
+)
+
+// GetRenewalInfo ACME api for retrieving the suggested renewal window of a
+// certificate, RFC 9773. The endpoint does not require authentication, and it
+// returns a 404 if the certificate was not issued by the provisioner.
+func GetRenewalInfo(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db := acme.MustDatabaseFromContext(ctx)
+
+	prov, err := provisionerFromContext(ctx)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	keyID, serial, err := acme.ParseCertificateID(chi.URLParam(r, "certID"))
+	if err != nil {
+		render.Error(w, acme.WrapError(acme.ErrorMalformedType, err, "error parsing certificate identifier"))
+		return
+	}
+
+	dbCert, err := db.GetCertificateBySerial(ctx, serial.String())
+	switch {
+	case acme.IsErrNotFound(err):
+		render.Error(w, newRenewalInfoNotFoundError("certificate with serial %s not found", serial))
+		return
+	case err != nil:
+		render.Error(w, acme.WrapErrorISE(err, "error retrieving certificate by serial"))
+		return
+	}
+	if !bytes.Equal(dbCert.Leaf.AuthorityKeyId, keyID) {
+		render.Error(w, newRenewalInfoNotFoundError(
+			"certificate with serial %s has a different authority key identifier", serial))
+		return
+	}
+
+	// The renewal information of a certificate is only available using the
+	// provisioner that issued it.
+	o, err := db.GetOrder(ctx, dbCert.OrderID)
+	if err != nil {
+		render.Error(w, acme.WrapErrorISE(err, "error retrieving order"))
+		return
+	}
+	if prov.GetID() != o.ProvisionerID {
+		render.Error(w, newRenewalInfoNotFoundError(
+			"certificate with serial %s was not issued by provisioner '%s'", serial, prov.GetName()))
+		return
+	}
+
+	revoked, err := mustAuthority(ctx).IsRevoked(serial.String())
+	if err != nil {
+		render.Error(w, acme.WrapErrorISE(err, "error checking revocation status"))
+		return
+	}
+
+	opts := prov.GetACMEOptions().RenewalInfo
+	info := acme.NewRenewalInfo(dbCert.Leaf, revoked, opts, clock.Now())
+
+	w.Header().Set("Retry-After", strconv.FormatInt(int64(opts.GetRetryAfter().Seconds()), 10))
+	render.JSON(w, info)
+}
+
+// newRenewalInfoNotFoundError returns the error used when the certificate in
+// the renewal information request is not known, RFC 9773 requires a 404.
+func newRenewalInfoNotFoundError(msg string, args ...any) *acme.Error {
+	err := acme.NewError(acme.ErrorMalformedType, msg, args...)
+	err.Status = http.StatusNotFound
+	return err
+}
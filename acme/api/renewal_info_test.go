@@ -0,0 +1,257 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/smallstep/assert"
+
+	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func TestHandler_GetRenewalInfo(t *testing.T) {
+	prov := newProv()
+	provName := url.PathEscape(prov.GetName())
+	baseURL := &url.URL{Scheme: "https", Host: "test.ca.smallstep.com"}
+
+	now := clock.Now()
+	leaf := &x509.Certificate{
+		AuthorityKeyId: []byte{1, 2, 3, 4},
+		SerialNumber:   big.NewInt(0x87654321),
+		NotBefore:      now.Add(-time.Hour),
+		NotAfter:       now.Add(23 * time.Hour),
+	}
+	certID := acme.CertificateID(leaf)
+	getOrder := func(ctx context.Context, id string) (*acme.Order, error) {
+		assert.Equals(t, id, "orderID")
+		return &acme.Order{ID: id, ProvisionerID: prov.GetID()}, nil
+	}
+
+	type test struct {
+		db         acme.DB
+		ca         acme.CertificateAuthority
+		ctx        context.Context
+		certID     string
+		statusCode int
+		retryAfter string
+		want       *acme.RenewalInfo
+		err        *acme.Error
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/no-provisioner": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				ca:         &mockCA{},
+				ctx:        context.Background(),
+				certID:     certID,
+				statusCode: 500,
+				err:        acme.NewErrorISE("provisioner does not exist"),
+			}
+		},
+		"fail/bad-certificate-id": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				ca:         &mockCA{},
+				ctx:        acme.NewProvisionerContext(context.Background(), prov),
+				certID:     "foo",
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "error parsing certificate identifier"),
+			}
+		},
+		"fail/db.GetCertificateBySerial-not-found": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetCertificateBySerial: func(ctx context.Context, serial string) (*acme.Certificate, error) {
+						return nil, acme.WrapError(acme.ErrorMalformedType, acme.ErrNotFound, "certificate with serial %s not found", serial)
+					},
+				},
+				ca:         &mockCA{},
+				ctx:        acme.NewProvisionerContext(context.Background(), prov),
+				certID:     certID,
+				statusCode: 404,
+				err:        acme.NewError(acme.ErrorMalformedType, "certificate with serial 2271560481 not found"),
+			}
+		},
+		"fail/db.GetCertificateBySerial-error": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetCertificateBySerial: func(ctx context.Context, serial string) (*acme.Certificate, error) {
+						return nil, errors.New("force")
+					},
+				},
+				ca:         &mockCA{},
+				ctx:        acme.NewProvisionerContext(context.Background(), prov),
+				certID:     certID,
+				statusCode: 500,
+				err:        acme.NewErrorISE("error retrieving certificate by serial"),
+			}
+		},
+		"fail/key-id-mismatch": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetCertificateBySerial: func(ctx context.Context, serial string) (*acme.Certificate, error) {
+						return &acme.Certificate{Leaf: &x509.Certificate{AuthorityKeyId: []byte{4, 3, 2, 1}}}, nil
+					},
+				},
+				ca:         &mockCA{},
+				ctx:        acme.NewProvisionerContext(context.Background(), prov),
+				certID:     certID,
+				statusCode: 404,
+				err:        acme.NewError(acme.ErrorMalformedType, "certificate with serial 2271560481 has a different authority key identifier"),
+			}
+		},
+		"fail/db.GetOrder-error": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetCertificateBySerial: func(ctx context.Context, serial string) (*acme.Certificate, error) {
+						return &acme.Certificate{OrderID: "orderID", Leaf: leaf}, nil
+					},
+					MockGetOrder: func(ctx context.Context, id string) (*acme.Order, error) {
+						return nil, errors.New("force")
+					},
+				},
+				ca:         &mockCA{},
+				ctx:        acme.NewProvisionerContext(context.Background(), prov),
+				certID:     certID,
+				statusCode: 500,
+				err:        acme.NewErrorISE("error retrieving order"),
+			}
+		},
+		"fail/provisioner-mismatch": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetCertificateBySerial: func(ctx context.Context, serial string) (*acme.Certificate, error) {
+						return &acme.Certificate{OrderID: "orderID", Leaf: leaf}, nil
+					},
+					MockGetOrder: func(ctx context.Context, id string) (*acme.Order, error) {
+						return &acme.Order{ID: id, ProvisionerID: "other"}, nil
+					},
+				},
+				ca:         &mockCA{},
+				ctx:        acme.NewProvisionerContext(context.Background(), prov),
+				certID:     certID,
+				statusCode: 404,
+				err:        acme.NewError(acme.ErrorMalformedType, "certificate with serial 2271560481 was not issued by provisioner"),
+			}
+		},
+		"fail/IsRevoked-error": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetCertificateBySerial: func(ctx context.Context, serial string) (*acme.Certificate, error) {
+						return &acme.Certificate{OrderID: "orderID", Leaf: leaf}, nil
+					},
+					MockGetOrder: getOrder,
+				},
+				ca: &mockCA{
+					MockIsRevoked: func(sn string) (bool, error) {
+						return false, errors.New("force")
+					},
+				},
+				ctx:        acme.NewProvisionerContext(context.Background(), prov),
+				certID:     certID,
+				statusCode: 500,
+				err:        acme.NewErrorISE("error checking revocation status"),
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetCertificateBySerial: func(ctx context.Context, serial string) (*acme.Certificate, error) {
+						assert.Equals(t, serial, "2271560481")
+						return &acme.Certificate{OrderID: "orderID", Leaf: leaf}, nil
+					},
+					MockGetOrder: getOrder,
+				},
+				ca:         &mockCA{},
+				ctx:        acme.NewProvisionerContext(context.Background(), prov),
+				certID:     certID,
+				statusCode: 200,
+				retryAfter: "21600",
+				want:       acme.NewRenewalInfo(leaf, false, nil, now),
+			}
+		},
+		"ok/revoked": func(t *testing.T) test {
+			renewalInfo := &provisioner.ACMERenewalInfo{
+				RetryAfter:     &provisioner.Duration{Duration: time.Hour},
+				ExplanationURL: "https://ca.example.com/incident",
+			}
+			return test{
+				db: &acme.MockDB{
+					MockGetCertificateBySerial: func(ctx context.Context, serial string) (*acme.Certificate, error) {
+						return &acme.Certificate{OrderID: "orderID", Leaf: leaf}, nil
+					},
+					MockGetOrder: getOrder,
+				},
+				ca: &mockCA{
+					MockIsRevoked: func(sn string) (bool, error) {
+						assert.Equals(t, sn, "2271560481")
+						return true, nil
+					},
+				},
+				ctx: acme.NewProvisionerContext(context.Background(), &acme.MockProvisioner{
+					MgetID:          func() string { return prov.GetID() },
+					MgetName:        func() string { return "acme" },
+					MgetACMEOptions: func() provisioner.ACMEOptions { return provisioner.ACMEOptions{RenewalInfo: renewalInfo} },
+				}),
+				certID:     certID,
+				statusCode: 200,
+				retryAfter: "3600",
+				want:       acme.NewRenewalInfo(leaf, true, renewalInfo, now),
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, tc.ca)
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("certID", tc.certID)
+			ctx := acme.NewDatabaseContext(tc.ctx, tc.db)
+			ctx = context.WithValue(ctx, chi.RouteCtxKey, chiCtx)
+			u := fmt.Sprintf("%s/acme/%s/renewal-info/%s", baseURL.String(), provName, tc.certID)
+			req := httptest.NewRequest("GET", u, http.NoBody)
+			req = req.WithContext(ctx)
+			w := httptest.NewRecorder()
+			GetRenewalInfo(w, req)
+			res := w.Result()
+
+			assert.Equals(t, res.StatusCode, tc.statusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+
+			if res.StatusCode >= 400 && assert.NotNil(t, tc.err) {
+				var ae acme.Error
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &ae))
+
+				assert.Equals(t, ae.Type, tc.err.Type)
+				assert.HasPrefix(t, ae.Detail, tc.err.Detail)
+				assert.Equals(t, res.Header["Content-Type"], []string{"application/problem+json"})
+			} else {
+				var info acme.RenewalInfo
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &info))
+
+				// The windows of revoked certificates are based on the current time.
+				assert.True(t, info.SuggestedWindow.Start.Sub(tc.want.SuggestedWindow.Start).Abs() <= time.Second)
+				assert.True(t, info.SuggestedWindow.End.Sub(tc.want.SuggestedWindow.End).Abs() <= time.Second)
+				assert.Equals(t, info.ExplanationURL, tc.want.ExplanationURL)
+				assert.Equals(t, res.Header["Retry-After"], []string{tc.retryAfter})
+				assert.Equals(t, res.Header["Content-Type"], []string{"application/json"})
+			}
+		})
+	}
+}
@@ -83,6 +83,21 @@ func RevokeCert(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Certificates of auto-renewal orders cannot be revoked, RFC 8739 section
+	// 2.3. The order has to be canceled instead.
+	if dbCert.OrderID != "" {
+		o, err := db.GetOrder(ctx, dbCert.OrderID)
+		if err != nil {
+			render.Error(w, acme.WrapErrorISE(err, "error retrieving order"))
+			return
+		}
+		if o.AutoRenewal != nil {
+			render.Error(w, acme.NewError(acme.ErrorAutoRenewalRevocationNotSupportedType,
+				"certificates of auto-renewal orders cannot be revoked"))
+			return
+		}
+	}
+
 	if shouldCheckAccountFrom(jws) {
 		account, err := accountFromContext(ctx)
 		if err != nil {
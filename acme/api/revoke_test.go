@@ -276,9 +276,10 @@ func jwsFinal(_ crypto.Hash, sig []byte, phead, payload string) ([]byte, error)
 }
 
 type mockCA struct {
-	MockIsRevoked      func(sn string) (bool, error)
-	MockRevoke         func(ctx context.Context, opts *authority.RevokeOptions) error
-	MockAreSANsallowed func(ctx context.Context, sans []string) error
+	MockIsRevoked            func(sn string) (bool, error)
+	MockRevoke               func(ctx context.Context, opts *authority.RevokeOptions) error
+	MockAreSANsallowed       func(ctx context.Context, sans []string) error
+	MockGetCertificateChains func(certChain []*x509.Certificate, preferredChain string) [][]*x509.Certificate
 }
 
 func (m *mockCA) SignWithContext(context.Context, *x509.CertificateRequest, provisioner.SignOptions, ...provisioner.SignOption) ([]*x509.Certificate, error) {
@@ -310,6 +311,13 @@ func (m *mockCA) LoadProvisionerByName(string) (provisioner.Interface, error) {
 	return nil, nil
 }
 
+func (m *mockCA) GetCertificateChains(certChain []*x509.Certificate, preferredChain string) [][]*x509.Certificate {
+	if m.MockGetCertificateChains != nil {
+		return m.MockGetCertificateChains(certChain, preferredChain)
+	}
+	return [][]*x509.Certificate{certChain}
+}
+
 func Test_validateReasonCode(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -17,6 +17,7 @@ type Authorization struct {
 	Challenges  []*Challenge `json:"challenges"`
 	Wildcard    bool         `json:"wildcard"`
 	ExpiresAt   time.Time    `json:"expires"`
+	CreatedAt   time.Time    `json:"-"`
 	Error       *Error       `json:"error,omitempty"`
 }
 
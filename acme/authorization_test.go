@@ -7,10 +7,13 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/assert"
+
+	"github.com/smallstep/certificates/authority/provisioner"
 )
 
 func TestAuthorization_UpdateStatus(t *testing.T) {
 	type test struct {
+		ctx context.Context
 		az  *Authorization
 		err *Error
 		db  DB
@@ -124,11 +127,45 @@ func TestAuthorization_UpdateStatus(t *testing.T) {
 				},
 			}
 		},
+		"ok/valid-reuse-enabled": func(t *testing.T) test {
+			now := clock.Now()
+			az := &Authorization{
+				ID:         "azID",
+				Status:     StatusPending,
+				ExpiresAt:  now.Add(5 * time.Minute),
+				Challenges: []*Challenge{{Status: StatusValid}},
+			}
+			prov := &MockProvisioner{
+				MgetACMEOptions: func() provisioner.ACMEOptions {
+					return provisioner.ACMEOptions{
+						AuthorizationReuse: &provisioner.ACMEAuthorizationReuse{
+							Enabled: true,
+							Window:  &provisioner.Duration{Duration: 30 * 24 * time.Hour},
+						},
+					}
+				},
+			}
+			return test{
+				ctx: NewProvisionerContext(context.Background(), prov),
+				az:  az,
+				db: &MockDB{
+					MockUpdateAuthorization: func(ctx context.Context, updaz *Authorization) error {
+						assert.Equals(t, updaz.Status, StatusValid)
+						assert.Equals(t, updaz.ExpiresAt, now.Add(5*time.Minute))
+						return nil
+					},
+				},
+			}
+		},
 	}
 	for name, run := range tests {
 		t.Run(name, func(t *testing.T) {
 			tc := run(t)
-			if err := tc.az.UpdateStatus(context.Background(), tc.db); err != nil {
+			ctx := tc.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			if err := tc.az.UpdateStatus(ctx, tc.db); err != nil {
 				if assert.NotNil(t, tc.err) {
 					var k *Error
 					if errors.As(err, &k) {
@@ -50,6 +50,8 @@ const (
 	TLSALPN01 ChallengeType = "tls-alpn-01"
 	// DEVICEATTEST01 is the device-attest-01 ACME challenge type
 	DEVICEATTEST01 ChallengeType = "device-attest-01"
+	// EMAILREPLY00 is the email-reply-00 ACME challenge type
+	EMAILREPLY00 ChallengeType = "email-reply-00"
 )
 
 var (
@@ -66,16 +68,19 @@ var (
 
 // Challenge represents an ACME response Challenge type.
 type Challenge struct {
-	ID              string        `json:"-"`
-	AccountID       string        `json:"-"`
-	AuthorizationID string        `json:"-"`
-	Value           string        `json:"-"`
-	Type            ChallengeType `json:"type"`
-	Status          Status        `json:"status"`
-	Token           string        `json:"token"`
-	ValidatedAt     string        `json:"validated,omitempty"`
-	URL             string        `json:"url"`
-	Error           *Error        `json:"error,omitempty"`
+	ID              string          `json:"-"`
+	AccountID       string          `json:"-"`
+	AuthorizationID string          `json:"-"`
+	Value           string          `json:"-"`
+	Type            ChallengeType   `json:"type"`
+	Status          Status          `json:"status"`
+	Token           string          `json:"token"`
+	From            string          `json:"from,omitempty"`
+	ReplyToken      string          `json:"-"`
+	ValidatedAt     string          `json:"validated,omitempty"`
+	URL             string          `json:"url"`
+	Error           *Error          `json:"error,omitempty"`
+	Retry           *ChallengeRetry `json:"-"`
 }
 
 // ToLog enables response logging.
@@ -89,12 +94,30 @@ func (ch *Challenge) ToLog() (interface{}, error) {
 
 // Validate attempts to validate the Challenge. Stores changes to the Challenge
 // type using the DB interface. If the Challenge is validated, the 'status' and
-// 'validated' attributes are updated.
+// 'validated' attributes are updated. If the provisioner retries challenges,
+// and the validation fails with a transient error, the next attempt is
+// scheduled.
 func (ch *Challenge) Validate(ctx context.Context, db DB, jwk *jose.JSONWebKey, payload []byte) error {
-	// If already valid or invalid then return without performing validation.
-	if ch.Status != StatusPending {
+	// If already valid or invalid, or if the next retry is not due yet, then
+	// return without performing validation.
+	if !ch.isValidationDue(clock.Now()) {
 		return nil
 	}
+	// Another replica of the CA might be validating the challenge.
+	unlock, ok, err := lockChallenge(ctx, db, ch)
+	if err != nil || !ok {
+		return err
+	}
+	defer unlock()
+
+	if err := ch.validate(ctx, db, jwk, payload); err != nil {
+		return err
+	}
+	challengeRetries.schedule(ctx, db, ch, jwk, payload)
+	return nil
+}
+
+func (ch *Challenge) validate(ctx context.Context, db DB, jwk *jose.JSONWebKey, payload []byte) error {
 	switch ch.Type {
 	case HTTP01:
 		return http01Validate(ctx, ch, db, jwk)
@@ -104,6 +127,8 @@ func (ch *Challenge) Validate(ctx context.Context, db DB, jwk *jose.JSONWebKey,
 		return tlsalpn01Validate(ctx, ch, db, jwk)
 	case DEVICEATTEST01:
 		return deviceAttest01Validate(ctx, ch, db, jwk, payload)
+	case EMAILREPLY00:
+		return emailReply00Validate(ctx, ch, db)
 	default:
 		return NewErrorISE("unexpected challenge type '%s'", ch.Type)
 	}
@@ -118,7 +143,10 @@ func http01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose.JSONWeb
 		u.Host += ":" + strconv.Itoa(InsecurePortHTTP01)
 	}
 
-	vc := MustClientFromContext(ctx)
+	vc, err := validationClient(ctx)
+	if err != nil {
+		return WrapErrorISE(err, "error creating validation client")
+	}
 	resp, err := vc.Get(u.String())
 	if err != nil {
 		return storeError(ctx, db, ch, false, WrapError(ErrorConnectionType, err,
@@ -199,7 +227,10 @@ func tlsalpn01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose.JSON
 		hostPort = net.JoinHostPort(ch.Value, strconv.Itoa(port))
 	}
 
-	vc := MustClientFromContext(ctx)
+	vc, err := validationClient(ctx)
+	if err != nil {
+		return WrapErrorISE(err, "error creating validation client")
+	}
 	conn, err := vc.TLSDial("tcp", hostPort, config)
 	if err != nil {
 		// With Go 1.17+ tls.Dial fails if there's no overlap between configured
@@ -230,9 +261,11 @@ func tlsalpn01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose.JSON
 
 	leafCert := certs[0]
 
-	// if no DNS names present, look for IP address and verify that exactly one exists
-	if len(leafCert.DNSNames) == 0 {
-		if len(leafCert.IPAddresses) != 1 || !leafCert.IPAddresses[0].Equal(net.ParseIP(ch.Value)) {
+	// RFC 8738 requires the certificate of an IP identifier to contain a single
+	// IP address and no DNS names; otherwise, if no DNS names are present,
+	// look for IP address and verify that exactly one exists.
+	if ip := net.ParseIP(ch.Value); ip != nil || len(leafCert.DNSNames) == 0 {
+		if len(leafCert.DNSNames) > 0 || len(leafCert.IPAddresses) != 1 || !leafCert.IPAddresses[0].Equal(ip) {
 			return storeError(ctx, db, ch, true, NewError(ErrorRejectedIdentifierType,
 				"incorrect certificate for tls-alpn-01 challenge: leaf certificate must contain a single IP address or DNS name, %v", ch.Value))
 		}
@@ -306,8 +339,7 @@ func dns01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose.JSONWebK
 	// Instead perform txt lookup for _acme-challenge.example.com
 	domain := strings.TrimPrefix(ch.Value, "*.")
 
-	vc := MustClientFromContext(ctx)
-	txtRecords, err := vc.LookupTxt("_acme-challenge." + domain)
+	txtRecords, err := lookupTxt(ctx, "_acme-challenge."+domain)
 	if err != nil {
 		return storeError(ctx, db, ch, false, WrapError(ErrorDNSType, err,
 			"error looking up TXT records for domain %s", domain))
@@ -484,6 +516,18 @@ func deviceAttest01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose
 			return storeError(ctx, db, ch, true, NewDetailedError(ErrorBadAttestationStatementType, "permanent identifier does not match").AddSubproblems(subproblem))
 		}
 
+		// Only devices enrolled in the CA can be attested if the provisioner
+		// requires it.
+		if prov.GetACMEOptions().RequireDeviceEnrollment {
+			if err := validateEnrolledDevice(ctx, db, prov, ch, data); err != nil {
+				var acmeError *Error
+				if errors.As(err, &acmeError) && acmeError.Status != 500 {
+					return storeError(ctx, db, ch, true, acmeError)
+				}
+				return err
+			}
+		}
+
 		// Update attestation key fingerprint to compare against the CSR
 		az.Fingerprint = data.Fingerprint
 	default:
@@ -1124,10 +1168,14 @@ func KeyAuthorization(token string, jwk *jose.JSONWebKey) (string, error) {
 }
 
 // storeError the given error to an ACME error and saves using the DB interface.
+// If the error is transient and the provisioner retries challenges, the retry
+// state of the challenge is updated.
 func storeError(ctx context.Context, db DB, ch *Challenge, markInvalid bool, err *Error) error {
 	ch.Error = err
 	if markInvalid {
 		ch.Status = StatusInvalid
+	} else if opts := challengeRetryOptions(ctx); opts != nil {
+		updateRetry(ch, opts, err)
 	}
 	if err := db.UpdateChallenge(ctx, ch); err != nil {
 		return WrapErrorISE(err, "failure saving error to acme challenge")
@@ -0,0 +1,380 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"go.step.sm/crypto/randutil"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+const (
+	// emailReplyTokenEntropy is the number of random bytes in the token sent in
+	// the subject of the challenge emails, RFC 8823 requires at least 128 bits.
+	emailReplyTokenEntropy = 16
+
+	// maxEmailReplyBodySize is the maximum size of the body of a reply that
+	// is read looking for the ACME response.
+	maxEmailReplyBodySize = 64 * 1024
+
+	// emailSendTimeout is the maximum time to deliver a challenge email to
+	// the SMTP server.
+	emailSendTimeout = 30 * time.Second
+
+	emailResponseBegin = "-----BEGIN ACME RESPONSE-----"
+	emailResponseEnd   = "-----END ACME RESPONSE-----"
+)
+
+var errNoEmailResponse = errors.New("email reply does not contain an ACME response")
+
+// SendEmailChallenge sends the email of an email-reply-00 challenge, RFC 8823.
+// The first part of the token is only sent by email, and it's stored in the
+// challenge to verify the reply; the second part is the token in the challenge
+// object returned to the client. The challenge must be already created in the
+// database.
+//
+// The email is delivered in the background, so the request does not wait for
+// the SMTP server. If it cannot be delivered, the challenge is marked as
+// invalid.
+func SendEmailChallenge(ctx context.Context, db DB, ch *Challenge) error {
+	opts := MustProvisionerFromContext(ctx).GetACMEOptions().EmailChallenge
+	if opts == nil {
+		return NewErrorISE("email-reply-00 challenge is not configured")
+	}
+
+	token, err := newEmailReplyToken(ch.ID)
+	if err != nil {
+		return WrapErrorISE(err, "error generating email reply token")
+	}
+	ch.ReplyToken = token
+	ch.From = opts.From
+	if err := db.UpdateChallenge(ctx, ch); err != nil {
+		return WrapErrorISE(err, "error updating challenge")
+	}
+
+	msg, err := newEmailChallengeMessage(opts.From, ch.Value, token)
+	if err != nil {
+		return WrapErrorISE(err, "error creating challenge email")
+	}
+	go deliverEmailChallenge(context.WithoutCancel(ctx), db, opts, ch.ID, ch.AuthorizationID, ch.Value, msg)
+	return nil
+}
+
+// deliverEmailChallenge sends the email of the challenge with the given id,
+// and marks the challenge as invalid if the email cannot be sent.
+func deliverEmailChallenge(ctx context.Context, db DB, opts *provisioner.ACMEEmailChallenge, chID, azID, to string, msg []byte) {
+	sendErr := sendEmail(opts, to, msg)
+	if sendErr == nil {
+		return
+	}
+	log.Printf("error sending ACME challenge email to %s: %v", to, sendErr)
+
+	ch, err := db.GetChallenge(ctx, chID, azID)
+	if err != nil {
+		log.Printf("error retrieving ACME challenge %s: %v", chID, err)
+		return
+	}
+	if err := storeError(ctx, db, ch, true, WrapErrorISE(sendErr,
+		"error sending challenge email to %s", to)); err != nil {
+		log.Printf("error updating ACME challenge %s: %v", chID, err)
+	}
+}
+
+// ValidateEmailReply validates the email-reply-00 challenge replied with the
+// given message. The message must be a raw RFC 5322 message whose origin has
+// already been verified using DKIM or SPF by the mail gateway.
+func ValidateEmailReply(ctx context.Context, db DB, r io.Reader) error {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return WrapError(ErrorMalformedType, err, "error parsing email reply")
+	}
+
+	token, err := emailReplyToken(msg.Header.Get("Subject"))
+	if err != nil {
+		return err
+	}
+	chID, err := parseEmailReplyToken(token)
+	if err != nil {
+		return err
+	}
+	ch, err := db.GetChallenge(ctx, chID, "")
+	if err != nil {
+		return WrapError(ErrorMalformedType, err, "error retrieving challenge")
+	}
+	if ch.Type != EMAILREPLY00 || ch.ReplyToken == "" ||
+		subtle.ConstantTimeCompare([]byte(token), []byte(ch.ReplyToken)) == 0 {
+		return NewError(ErrorMalformedType, "email reply token does not match any challenge")
+	}
+	if ch.Status != StatusPending && ch.Status != StatusProcessing {
+		return NewError(ErrorMalformedType, "challenge %s is not pending", ch.ID)
+	}
+
+	from, err := mail.ParseAddress(msg.Header.Get("From"))
+	if err != nil {
+		return WrapError(ErrorMalformedType, err, "error parsing email reply sender")
+	}
+	if !strings.EqualFold(from.Address, ch.Value) {
+		return NewError(ErrorUnauthorizedType, "email reply sender %s does not match identifier %s", from.Address, ch.Value)
+	}
+
+	acc, err := db.GetAccount(ctx, ch.AccountID)
+	if err != nil {
+		return WrapErrorISE(err, "error retrieving account %s", ch.AccountID)
+	}
+	// The reply secret only authorizes the replies for the challenges of the
+	// provisioner.
+	if prov := MustProvisionerFromContext(ctx); acc.ProvisionerID != prov.GetID() {
+		return NewError(ErrorUnauthorizedType, "provisioner '%s' does not own challenge %s", prov.GetName(), ch.ID)
+	}
+	if acc.Status != StatusValid {
+		return NewError(ErrorUnauthorizedType, "account %s is not valid", acc.ID)
+	}
+
+	// Automatic replies, like out of office messages, are ignored.
+	if v := msg.Header.Get("Auto-Submitted"); v != "" && !strings.EqualFold(v, "no") {
+		return NewError(ErrorMalformedType, "email reply is auto-submitted")
+	}
+	response, err := emailReplyResponse(msg)
+	if err != nil {
+		return WrapError(ErrorMalformedType, err, "error reading email reply")
+	}
+
+	// The key authorization uses the concatenation of both tokens.
+	keyAuth, err := KeyAuthorization(ch.ReplyToken+ch.Token, acc.Key)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256([]byte(keyAuth))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(response)) == 0 {
+		return storeError(ctx, db, ch, true, NewError(ErrorRejectedIdentifierType,
+			"email reply response does not match; expected %s, but got %s", expected, response))
+	}
+
+	// Update and store the challenge.
+	ch.Status = StatusValid
+	ch.Error = nil
+	ch.ValidatedAt = clock.Now().Format(time.RFC3339)
+
+	if err := db.UpdateChallenge(ctx, ch); err != nil {
+		return WrapErrorISE(err, "error updating challenge")
+	}
+	return nil
+}
+
+// emailReply00Validate is called when the client is ready to reply the
+// challenge email. The challenge is validated when the reply is received, so
+// the challenge just moves to the processing state.
+func emailReply00Validate(ctx context.Context, ch *Challenge, db DB) error {
+	ch.Status = StatusProcessing
+	if err := db.UpdateChallenge(ctx, ch); err != nil {
+		return WrapErrorISE(err, "error updating challenge")
+	}
+	return nil
+}
+
+// newEmailReplyToken returns a new token with the given challenge id. The
+// challenge id allows finding the challenge of a reply without an index in
+// the database.
+func newEmailReplyToken(chID string) (string, error) {
+	b := make([]byte, emailReplyTokenEntropy, emailReplyTokenEntropy+len(chID))
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(append(b, chID...)), nil
+}
+
+// parseEmailReplyToken returns the challenge id in the given token.
+func parseEmailReplyToken(token string) (string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(b) <= emailReplyTokenEntropy {
+		return "", NewError(ErrorMalformedType, "email reply token is not valid")
+	}
+	return string(b[emailReplyTokenEntropy:]), nil
+}
+
+// emailReplyToken returns the token in the subject of a reply, the subject has
+// the format "ACME: <token>" optionally preceded by a prefix like "Re:".
+func emailReplyToken(subject string) (string, error) {
+	if s, err := new(mime.WordDecoder).DecodeHeader(subject); err == nil {
+		subject = s
+	}
+	_, token, ok := strings.Cut(subject, "ACME:")
+	if token = strings.TrimSpace(token); !ok || token == "" {
+		return "", NewError(ErrorMalformedType, "email reply subject does not contain an ACME token")
+	}
+	return token, nil
+}
+
+// emailReplyResponse returns the response in the body of the reply, enclosed
+// in the "-----BEGIN ACME RESPONSE-----" and "-----END ACME RESPONSE-----"
+// lines. Multipart messages are supported using the first text/plain part.
+func emailReplyResponse(msg *mail.Message) (string, error) {
+	body, err := emailReplyText(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), msg.Body)
+	if err != nil {
+		return "", err
+	}
+	_, rest, ok := strings.Cut(body, emailResponseBegin)
+	if !ok {
+		return "", errNoEmailResponse
+	}
+	response, _, ok := strings.Cut(rest, emailResponseEnd)
+	if !ok {
+		return "", errNoEmailResponse
+	}
+	// The response might be wrapped in multiple lines.
+	return strings.Join(strings.Fields(response), ""), nil
+}
+
+// emailReplyText returns the decoded text of a message or message part.
+func emailReplyText(contentType, encoding string, r io.Reader) (string, error) {
+	mediaType := "text/plain"
+	var params map[string]string
+	if contentType != "" {
+		var err error
+		if mediaType, params, err = mime.ParseMediaType(contentType); err != nil {
+			return "", fmt.Errorf("error parsing content type: %w", err)
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(mediaType, "multipart/"):
+		mr := multipart.NewReader(r, params["boundary"])
+		for {
+			p, err := mr.NextPart()
+			if err != nil {
+				return "", fmt.Errorf("email reply does not contain a text/plain part: %w", err)
+			}
+			ct := p.Header.Get("Content-Type")
+			if ct == "" || strings.HasPrefix(ct, "text/plain") || strings.HasPrefix(ct, "multipart/") {
+				return emailReplyText(ct, p.Header.Get("Content-Transfer-Encoding"), p)
+			}
+		}
+	case mediaType != "text/plain":
+		return "", fmt.Errorf("email reply content type %s is not supported", mediaType)
+	}
+
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "quoted-printable":
+		r = quotedprintable.NewReader(r)
+	case "base64":
+		r = base64.NewDecoder(base64.StdEncoding, &newlineStripper{r: r})
+	}
+	b, err := io.ReadAll(io.LimitReader(r, maxEmailReplyBodySize))
+	if err != nil {
+		return "", fmt.Errorf("error reading email reply: %w", err)
+	}
+	return string(b), nil
+}
+
+// newlineStripper removes the line breaks of base64 encoded parts.
+type newlineStripper struct {
+	r io.Reader
+}
+
+func (s *newlineStripper) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	j := 0
+	for _, c := range p[:n] {
+		if c != '\r' && c != '\n' {
+			p[j] = c
+			j++
+		}
+	}
+	return j, err
+}
+
+// newEmailChallengeMessage returns the challenge email defined in RFC 8823
+// section 3.
+func newEmailChallengeMessage(from, to, token string) ([]byte, error) {
+	id, err := randutil.Alphanumeric(32)
+	if err != nil {
+		return nil, err
+	}
+	domain := from[strings.LastIndex(from, "@")+1:]
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", to)
+	fmt.Fprintf(&buf, "Subject: ACME: %s\r\n", token)
+	fmt.Fprintf(&buf, "Date: %s\r\n", clock.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", id, domain)
+	buf.WriteString("Auto-Submitted: auto-generated; type=acme\r\n")
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString("This is an automatically generated ACME challenge for the email address\r\n")
+	fmt.Fprintf(&buf, "%s. If you did not request an S/MIME certificate, please ignore\r\n", to)
+	buf.WriteString("this message.\r\n")
+	return buf.Bytes(), nil
+}
+
+// sendEmail sends the given message using the SMTP server in the options. It
+// upgrades the connection using STARTTLS if the server supports it, like
+// smtp.SendMail, but the delivery fails if it takes longer than
+// emailSendTimeout.
+func sendEmail(opts *provisioner.ACMEEmailChallenge, to string, msg []byte) error {
+	host, _, err := net.SplitHostPort(opts.SMTPServer)
+	if err != nil {
+		return err
+	}
+	conn, err := net.DialTimeout("tcp", opts.SMTPServer, emailSendTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(emailSendTimeout)); err != nil {
+		return err
+	}
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}); err != nil {
+			return err
+		}
+	}
+	if opts.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", opts.Username, opts.Password, host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(opts.From); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
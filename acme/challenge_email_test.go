@@ -0,0 +1,365 @@
+package acme
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// newSMTPServer starts a minimal SMTP server that accepts one message and
+// sends it to the returned channel. Line endings are converted to \n.
+func newSMTPServer(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	messages := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tp := textproto.NewConn(conn)
+		_ = tp.PrintfLine("220 localhost ESMTP")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			switch cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0]); cmd {
+			case "DATA":
+				_ = tp.PrintfLine("354 go ahead")
+				b, err := tp.ReadDotBytes()
+				if err != nil {
+					return
+				}
+				messages <- string(b)
+				_ = tp.PrintfLine("250 OK")
+			case "QUIT":
+				_ = tp.PrintfLine("221 bye")
+				return
+			default:
+				_ = tp.PrintfLine("250 OK")
+			}
+		}
+	}()
+	return l.Addr().String(), messages
+}
+
+func mustEmailReply(t *testing.T, ch *Challenge, jwk *jose.JSONWebKey) string {
+	t.Helper()
+	keyAuth, err := KeyAuthorization(ch.ReplyToken+ch.Token, jwk)
+	require.NoError(t, err)
+	sum := sha256.Sum256([]byte(keyAuth))
+	return "From: Jane Doe <jane@example.com>\r\n" +
+		"To: acme@ca.example.com\r\n" +
+		"Subject: Re: ACME: " + ch.ReplyToken + "\r\n" +
+		"\r\n" +
+		"-----BEGIN ACME RESPONSE-----\r\n" +
+		base64.RawURLEncoding.EncodeToString(sum[:]) + "\r\n" +
+		"-----END ACME RESPONSE-----\r\n"
+}
+
+func TestSendEmailChallenge(t *testing.T) {
+	addr, messages := newSMTPServer(t)
+	prov := &MockProvisioner{
+		MgetACMEOptions: func() provisioner.ACMEOptions {
+			return provisioner.ACMEOptions{
+				EmailChallenge: &provisioner.ACMEEmailChallenge{
+					From:        "acme@ca.example.com",
+					SMTPServer:  addr,
+					ReplySecret: "secret",
+				},
+			}
+		},
+	}
+	ctx := NewProvisionerContext(context.Background(), prov)
+
+	var updated *Challenge
+	db := &MockDB{
+		MockUpdateChallenge: func(ctx context.Context, ch *Challenge) error {
+			updated = ch
+			return nil
+		},
+	}
+	ch := &Challenge{
+		ID:     "chID",
+		Type:   EMAILREPLY00,
+		Status: StatusPending,
+		Value:  "jane@example.com",
+		Token:  "token",
+	}
+	require.NoError(t, SendEmailChallenge(ctx, db, ch))
+	assert.Equal(t, ch, updated)
+	assert.Equal(t, "acme@ca.example.com", ch.From)
+	chID, err := parseEmailReplyToken(ch.ReplyToken)
+	require.NoError(t, err)
+	assert.Equal(t, "chID", chID)
+
+	msg := <-messages
+	assert.Contains(t, msg, "From: acme@ca.example.com\n")
+	assert.Contains(t, msg, "To: jane@example.com\n")
+	assert.Contains(t, msg, "Subject: ACME: "+ch.ReplyToken+"\n")
+	assert.Contains(t, msg, "Auto-Submitted: auto-generated; type=acme\n")
+
+	t.Run("fail not configured", func(t *testing.T) {
+		ctx := NewProvisionerContext(context.Background(), &MockProvisioner{})
+		err := SendEmailChallenge(ctx, db, &Challenge{ID: "chID"})
+		assert.EqualError(t, err, "email-reply-00 challenge is not configured")
+	})
+
+	t.Run("fail delivery", func(t *testing.T) {
+		// Nothing listens on the address.
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		addr := l.Addr().String()
+		l.Close()
+
+		ctx := NewProvisionerContext(context.Background(), &MockProvisioner{
+			MgetACMEOptions: func() provisioner.ACMEOptions {
+				return provisioner.ACMEOptions{EmailChallenge: &provisioner.ACMEEmailChallenge{From: "acme@ca.example.com", SMTPServer: addr, ReplySecret: "secret"}}
+			},
+		})
+		invalid := make(chan *Challenge, 1)
+		db := &MockDB{
+			MockGetChallenge: func(ctx context.Context, id, azID string) (*Challenge, error) {
+				assert.Equal(t, "chID", id)
+				assert.Equal(t, "azID", azID)
+				return &Challenge{ID: "chID", AuthorizationID: "azID", Type: EMAILREPLY00, Status: StatusPending}, nil
+			},
+			MockUpdateChallenge: func(ctx context.Context, ch *Challenge) error {
+				if ch.Status == StatusInvalid {
+					invalid <- ch
+				}
+				return nil
+			},
+		}
+
+		// The request does not wait for the delivery.
+		ch := &Challenge{ID: "chID", AuthorizationID: "azID", Type: EMAILREPLY00, Status: StatusPending, Value: "jane@example.com", Token: "token"}
+		require.NoError(t, SendEmailChallenge(ctx, db, ch))
+		assert.Equal(t, StatusPending, ch.Status)
+
+		select {
+		case ch := <-invalid:
+			assert.Equal(t, "urn:ietf:params:acme:error:serverInternal", ch.Error.Type)
+			assert.ErrorContains(t, ch.Error, "error sending challenge email to jane@example.com")
+		case <-time.After(10 * time.Second):
+			t.Fatal("challenge was not marked as invalid")
+		}
+	})
+}
+
+func TestValidateEmailReply(t *testing.T) {
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	require.NoError(t, err)
+	token, err := newEmailReplyToken("chID")
+	require.NoError(t, err)
+
+	newChallenge := func() *Challenge {
+		return &Challenge{
+			ID:         "chID",
+			AccountID:  "accID",
+			Type:       EMAILREPLY00,
+			Status:     StatusProcessing,
+			Value:      "jane@example.com",
+			Token:      "token",
+			ReplyToken: token,
+		}
+	}
+	ctx := NewProvisionerContext(context.Background(), &MockProvisioner{
+		MgetID:   func() string { return "provID" },
+		MgetName: func() string { return "acme" },
+	})
+	newDB := func(ch *Challenge, updated **Challenge) *MockDB {
+		return &MockDB{
+			MockGetChallenge: func(ctx context.Context, id, azID string) (*Challenge, error) {
+				assert.Equal(t, "chID", id)
+				return ch, nil
+			},
+			MockGetAccount: func(ctx context.Context, id string) (*Account, error) {
+				assert.Equal(t, "accID", id)
+				return &Account{ID: "accID", Key: jwk, Status: StatusValid, ProvisionerID: "provID"}, nil
+			},
+			MockUpdateChallenge: func(ctx context.Context, ch *Challenge) error {
+				*updated = ch
+				return nil
+			},
+		}
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		var updated *Challenge
+		ch := newChallenge()
+		err := ValidateEmailReply(ctx, newDB(ch, &updated), strings.NewReader(mustEmailReply(t, ch, jwk)))
+		require.NoError(t, err)
+		if assert.NotNil(t, updated) {
+			assert.Equal(t, StatusValid, updated.Status)
+			assert.NotEmpty(t, updated.ValidatedAt)
+			assert.Nil(t, updated.Error)
+		}
+	})
+
+	t.Run("fail response mismatch", func(t *testing.T) {
+		var updated *Challenge
+		ch := newChallenge()
+		reply := mustEmailReply(t, &Challenge{ReplyToken: ch.ReplyToken, Token: "other"}, jwk)
+		err := ValidateEmailReply(ctx, newDB(ch, &updated), strings.NewReader(reply))
+		require.NoError(t, err)
+		if assert.NotNil(t, updated) {
+			assert.Equal(t, StatusInvalid, updated.Status)
+			assert.Equal(t, "urn:ietf:params:acme:error:rejectedIdentifier", updated.Error.Type)
+		}
+	})
+
+	t.Run("fail provisioner", func(t *testing.T) {
+		var updated *Challenge
+		ch := newChallenge()
+		ctx := NewProvisionerContext(context.Background(), &MockProvisioner{
+			MgetID:   func() string { return "otherID" },
+			MgetName: func() string { return "other" },
+		})
+		err := ValidateEmailReply(ctx, newDB(ch, &updated), strings.NewReader(mustEmailReply(t, ch, jwk)))
+		assert.EqualError(t, err, "provisioner 'other' does not own challenge chID")
+		assert.Nil(t, updated)
+	})
+
+	tests := []struct {
+		name    string
+		ch      *Challenge
+		reply   func(reply string) string
+		wantErr string
+	}{
+		{"fail subject", newChallenge(), func(reply string) string {
+			return strings.Replace(reply, "Subject: Re: ACME: ", "Subject: ", 1)
+		}, "email reply subject does not contain an ACME token"},
+		{"fail token", newChallenge(), func(reply string) string {
+			other, _ := newEmailReplyToken("chID")
+			return strings.Replace(reply, token, other, 1)
+		}, "email reply token does not match any challenge"},
+		{"fail status", &Challenge{ID: "chID", Type: EMAILREPLY00, Status: StatusValid, ReplyToken: token}, func(reply string) string {
+			return reply
+		}, "challenge chID is not pending"},
+		{"fail sender", newChallenge(), func(reply string) string {
+			return strings.Replace(reply, "jane@example.com", "john@example.com", 1)
+		}, "email reply sender john@example.com does not match identifier jane@example.com"},
+		{"fail auto-submitted", newChallenge(), func(reply string) string {
+			return "Auto-Submitted: auto-replied\r\n" + reply
+		}, "email reply is auto-submitted"},
+		{"fail no response", newChallenge(), func(reply string) string {
+			return strings.Replace(reply, "-----END ACME RESPONSE-----", "", 1)
+		}, "error reading email reply: email reply does not contain an ACME response"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var updated *Challenge
+			reply := tt.reply(mustEmailReply(t, newChallenge(), jwk))
+			err := ValidateEmailReply(ctx, newDB(tt.ch, &updated), strings.NewReader(reply))
+			assert.EqualError(t, err, tt.wantErr)
+			assert.Nil(t, updated)
+		})
+	}
+}
+
+func Test_emailReply00Validate(t *testing.T) {
+	var updated *Challenge
+	db := &MockDB{
+		MockUpdateChallenge: func(ctx context.Context, ch *Challenge) error {
+			updated = ch
+			return nil
+		},
+	}
+	ch := &Challenge{ID: "chID", Type: EMAILREPLY00, Status: StatusPending}
+	require.NoError(t, ch.Validate(context.Background(), db, nil, nil))
+	if assert.NotNil(t, updated) {
+		assert.Equal(t, StatusProcessing, updated.Status)
+	}
+
+	// The challenge is not validated again until the reply is received.
+	updated = nil
+	require.NoError(t, ch.Validate(context.Background(), db, nil, nil))
+	assert.Nil(t, updated)
+}
+
+func Test_emailReplyToken(t *testing.T) {
+	tests := []struct {
+		name    string
+		subject string
+		want    string
+		wantErr bool
+	}{
+		{"ok", "ACME: token", "token", false},
+		{"ok reply", "Re: ACME: token", "token", false},
+		{"ok encoded", "=?utf-8?q?Re=3A_ACME=3A_token?=", "token", false},
+		{"fail empty", "ACME: ", "", true},
+		{"fail missing", "Re: hello", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := emailReplyToken(tt.subject)
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_parseEmailReplyToken(t *testing.T) {
+	token, err := newEmailReplyToken("chID")
+	require.NoError(t, err)
+	other, err := newEmailReplyToken("chID")
+	require.NoError(t, err)
+	assert.NotEqual(t, token, other)
+
+	chID, err := parseEmailReplyToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, "chID", chID)
+
+	_, err = parseEmailReplyToken("not+base64")
+	assert.Error(t, err)
+	_, err = parseEmailReplyToken(base64.RawURLEncoding.EncodeToString(make([]byte, emailReplyTokenEntropy)))
+	assert.Error(t, err)
+}
+
+func Test_emailReplyResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		msg     string
+		want    string
+		wantErr bool
+	}{
+		{"ok", "Subject: Re: ACME: token\r\n\r\n> quoted\r\n-----BEGIN ACME RESPONSE-----\r\nabc\r\ndef\r\n-----END ACME RESPONSE-----\r\n", "abcdef", false},
+		{"ok quoted-printable", "Content-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n" +
+			"-----BEGIN ACME RESPONSE-----\r\nab=\r\nc=3D\r\n-----END ACME RESPONSE-----\r\n", "abc=", false},
+		{"ok multipart", "Content-Type: multipart/alternative; boundary=b\r\n\r\n" +
+			"--b\r\nContent-Type: text/html\r\n\r\n<p>html</p>\r\n" +
+			"--b\r\nContent-Type: text/plain\r\nContent-Transfer-Encoding: base64\r\n\r\n" +
+			base64.StdEncoding.EncodeToString([]byte("-----BEGIN ACME RESPONSE-----\nabc\n-----END ACME RESPONSE-----\n")) + "\r\n" +
+			"--b--\r\n", "abc", false},
+		{"fail html", "Content-Type: text/html\r\n\r\n-----BEGIN ACME RESPONSE-----\r\nabc\r\n-----END ACME RESPONSE-----\r\n", "", true},
+		{"fail multipart", "Content-Type: multipart/alternative; boundary=b\r\n\r\n--b\r\nContent-Type: text/html\r\n\r\n<p>html</p>\r\n--b--\r\n", "", true},
+		{"fail missing", "Subject: Re: ACME: token\r\n\r\nhello\r\n", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := mail.ReadMessage(strings.NewReader(tt.msg))
+			require.NoError(t, err)
+			got, err := emailReplyResponse(msg)
+			assert.Equal(t, tt.wantErr, err != nil, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package acme
+
+import (
+	"context"
+	"time"
+)
+
+// challengeLockTTL is the time a challenge is locked if the lock is not
+// released, it's larger than the timeouts of the validation clients.
+const challengeLockTTL = 2 * time.Minute
+
+// ChallengeLocker is the interface implemented by the databases that can lock
+// a challenge, so only one CA replica validates it at a time when multiple
+// replicas share the database.
+type ChallengeLocker interface {
+	// LockChallenge locks the challenge with the given id for the given time.
+	// It returns false if the challenge is already locked, and a token to
+	// release the lock otherwise.
+	LockChallenge(ctx context.Context, id string, ttl time.Duration) (string, bool, error)
+	// UnlockChallenge releases the lock of a challenge if it has not expired.
+	UnlockChallenge(ctx context.Context, id, token string) error
+}
+
+// isValidationDue returns true if the challenge is pending, or if it's
+// processing and its next retry is due at the given time.
+func (ch *Challenge) isValidationDue(now time.Time) bool {
+	switch {
+	case ch.Status == StatusPending:
+		return true
+	case ch.Status == StatusProcessing && ch.Retry.IsDue(now):
+		return true
+	default:
+		return false
+	}
+}
+
+// lockChallenge locks the challenge if the database supports it and reloads
+// it, as it might have been validated by another replica before the lock. It
+// returns false if the challenge is locked by another replica or if it does
+// not need to be validated anymore. The returned function releases the lock.
+func lockChallenge(ctx context.Context, db DB, ch *Challenge) (func(), bool, error) {
+	locker, ok := db.(ChallengeLocker)
+	if !ok {
+		return func() {}, true, nil
+	}
+
+	token, ok, err := locker.LockChallenge(ctx, ch.ID, challengeLockTTL)
+	if err != nil {
+		return nil, false, WrapErrorISE(err, "error locking challenge %s", ch.ID)
+	}
+	if !ok {
+		return nil, false, nil
+	}
+	unlock := func() {
+		// The lock expires if it cannot be released.
+		_ = locker.UnlockChallenge(context.WithoutCancel(ctx), ch.ID, token)
+	}
+
+	current, err := db.GetChallenge(ctx, ch.ID, ch.AuthorizationID)
+	if err != nil {
+		unlock()
+		return nil, false, WrapErrorISE(err, "error retrieving challenge %s", ch.ID)
+	}
+	current.AuthorizationID = ch.AuthorizationID
+	*ch = *current
+	if !ch.isValidationDue(clock.Now()) {
+		unlock()
+		return nil, false, nil
+	}
+	return unlock, true, nil
+}
@@ -0,0 +1,160 @@
+package acme
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+)
+
+// lockingDB is a MockDB that implements the ChallengeLocker interface.
+type lockingDB struct {
+	*MockDB
+	lock     func(id string, ttl time.Duration) (string, bool, error)
+	unlocked []string
+}
+
+func (db *lockingDB) LockChallenge(_ context.Context, id string, ttl time.Duration) (string, bool, error) {
+	return db.lock(id, ttl)
+}
+
+func (db *lockingDB) UnlockChallenge(_ context.Context, id, token string) error {
+	db.unlocked = append(db.unlocked, id+":"+token)
+	return nil
+}
+
+func TestChallenge_isValidationDue(t *testing.T) {
+	now := clock.Now()
+	assert.True(t, (&Challenge{Status: StatusPending}).isValidationDue(now))
+	assert.True(t, (&Challenge{Status: StatusProcessing, Retry: &ChallengeRetry{NextAttempt: now}}).isValidationDue(now))
+	assert.False(t, (&Challenge{Status: StatusProcessing, Retry: &ChallengeRetry{NextAttempt: now.Add(time.Second)}}).isValidationDue(now))
+	assert.False(t, (&Challenge{Status: StatusProcessing}).isValidationDue(now))
+	assert.False(t, (&Challenge{Status: StatusValid}).isValidationDue(now))
+	assert.False(t, (&Challenge{Status: StatusInvalid}).isValidationDue(now))
+}
+
+func TestChallenge_Validate_lock(t *testing.T) {
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	require.NoError(t, err)
+	keyAuth, err := KeyAuthorization("token", jwk)
+	require.NoError(t, err)
+	h := sha256.Sum256([]byte(keyAuth))
+	txt := base64.RawURLEncoding.EncodeToString(h[:])
+
+	var lookups int
+	ctx := NewClientContext(context.Background(), &mockClient{
+		lookupTxt: func(name string) ([]string, error) {
+			lookups++
+			return []string{txt}, nil
+		},
+	})
+	newChallenge := func() *Challenge {
+		return &Challenge{
+			ID:              "chID",
+			AuthorizationID: "azID",
+			Type:            DNS01,
+			Status:          StatusPending,
+			Token:           "token",
+			Value:           "zap.internal",
+		}
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		lookups = 0
+		var updated *Challenge
+		db := &lockingDB{
+			MockDB: &MockDB{
+				MockGetChallenge: func(ctx context.Context, id, azID string) (*Challenge, error) {
+					assert.Equal(t, "chID", id)
+					assert.Equal(t, "azID", azID)
+					return newChallenge(), nil
+				},
+				MockUpdateChallenge: func(ctx context.Context, ch *Challenge) error {
+					updated = ch
+					return nil
+				},
+			},
+			lock: func(id string, ttl time.Duration) (string, bool, error) {
+				assert.Equal(t, "chID", id)
+				assert.Equal(t, challengeLockTTL, ttl)
+				return "token", true, nil
+			},
+		}
+		ch := newChallenge()
+		require.NoError(t, ch.Validate(ctx, db, jwk, nil))
+		assert.Equal(t, StatusValid, ch.Status)
+		assert.Equal(t, "azID", ch.AuthorizationID)
+		assert.Equal(t, ch, updated)
+		assert.Equal(t, 1, lookups)
+		assert.Equal(t, []string{"chID:token"}, db.unlocked)
+	})
+
+	t.Run("ok locked by other replica", func(t *testing.T) {
+		lookups = 0
+		db := &lockingDB{
+			MockDB: &MockDB{},
+			lock: func(id string, ttl time.Duration) (string, bool, error) {
+				return "", false, nil
+			},
+		}
+		ch := newChallenge()
+		require.NoError(t, ch.Validate(ctx, db, jwk, nil))
+		assert.Equal(t, StatusPending, ch.Status)
+		assert.Equal(t, 0, lookups)
+		assert.Empty(t, db.unlocked)
+	})
+
+	t.Run("ok validated by other replica", func(t *testing.T) {
+		lookups = 0
+		db := &lockingDB{
+			MockDB: &MockDB{
+				MockGetChallenge: func(ctx context.Context, id, azID string) (*Challenge, error) {
+					ch := newChallenge()
+					ch.Status = StatusValid
+					return ch, nil
+				},
+			},
+			lock: func(id string, ttl time.Duration) (string, bool, error) {
+				return "token", true, nil
+			},
+		}
+		ch := newChallenge()
+		require.NoError(t, ch.Validate(ctx, db, jwk, nil))
+		assert.Equal(t, StatusValid, ch.Status)
+		assert.Equal(t, 0, lookups)
+		assert.Equal(t, []string{"chID:token"}, db.unlocked)
+	})
+
+	t.Run("fail lock", func(t *testing.T) {
+		db := &lockingDB{
+			MockDB: &MockDB{},
+			lock: func(id string, ttl time.Duration) (string, bool, error) {
+				return "", false, errors.New("force")
+			},
+		}
+		err := newChallenge().Validate(ctx, db, jwk, nil)
+		assert.EqualError(t, err, "error locking challenge chID: force")
+	})
+
+	t.Run("fail get challenge", func(t *testing.T) {
+		db := &lockingDB{
+			MockDB: &MockDB{
+				MockGetChallenge: func(ctx context.Context, id, azID string) (*Challenge, error) {
+					return nil, errors.New("force")
+				},
+			},
+			lock: func(id string, ttl time.Duration) (string, bool, error) {
+				return "token", true, nil
+			},
+		}
+		err := newChallenge().Validate(ctx, db, jwk, nil)
+		assert.EqualError(t, err, "error retrieving challenge chID: force")
+		assert.Equal(t, []string{"chID:token"}, db.unlocked)
+	})
+}
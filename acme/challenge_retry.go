@@ -0,0 +1,130 @@
+package acme
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.step.sm/crypto/jose"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// ChallengeRetry is the retry state of a challenge whose validation failed
+// with a transient error.
+type ChallengeRetry struct {
+	// Attempts is the number of failed validation attempts.
+	Attempts int `json:"attempts"`
+	// NextAttempt is the time of the next validation attempt, it is not set
+	// after the last attempt.
+	NextAttempt time.Time `json:"nextAttempt,omitempty"`
+}
+
+// IsDue returns true if the next validation attempt can be done at the given
+// time.
+func (r *ChallengeRetry) IsDue(now time.Time) bool {
+	return r != nil && !r.NextAttempt.IsZero() && !now.Before(r.NextAttempt)
+}
+
+// challengeRetryOptions returns the retry options of the provisioner in the
+// context, it returns nil if the challenges must not be retried.
+func challengeRetryOptions(ctx context.Context) *provisioner.ACMEChallengeRetry {
+	if prov, ok := ProvisionerFromContext(ctx); ok {
+		return prov.GetACMEOptions().ChallengeRetry
+	}
+	return nil
+}
+
+// updateRetry updates the retry state of a challenge after a failed attempt.
+// The challenge is marked as processing until the last attempt, when it's
+// marked as invalid. The retry state is added to the challenge error.
+func updateRetry(ch *Challenge, opts *provisioner.ACMEChallengeRetry, err *Error) {
+	attempts := 1
+	if ch.Retry != nil {
+		attempts = ch.Retry.Attempts + 1
+	}
+	maxAttempts := opts.GetMaxAttempts()
+	if attempts >= maxAttempts {
+		ch.Status = StatusInvalid
+		ch.Retry = &ChallengeRetry{Attempts: attempts}
+		err.Detail = fmt.Sprintf("%s; giving up after %d attempts", err.Detail, attempts)
+		return
+	}
+
+	ch.Status = StatusProcessing
+	ch.Retry = &ChallengeRetry{
+		Attempts:    attempts,
+		NextAttempt: clock.Now().Add(opts.GetBackoff(attempts)),
+	}
+	err.Detail = fmt.Sprintf("%s; attempt %d of %d failed, retrying at %s",
+		err.Detail, attempts, maxAttempts, ch.Retry.NextAttempt.Format(time.RFC3339))
+}
+
+// challengeRetries schedules the retries of the challenges in processing
+// state.
+var challengeRetries = &retryScheduler{
+	scheduled: make(map[string]struct{}),
+}
+
+// retryScheduler validates the challenges again at the time of their next
+// attempt. The retry state is stored in the database, so if a retry is lost,
+// e.g. after a restart, the challenge is validated again on the next client
+// request.
+type retryScheduler struct {
+	mu        sync.Mutex
+	scheduled map[string]struct{}
+}
+
+// schedule schedules the next validation attempt of a challenge. Only one
+// attempt per challenge is scheduled at a time.
+func (s *retryScheduler) schedule(ctx context.Context, db DB, ch *Challenge, jwk *jose.JSONWebKey, payload []byte) {
+	if ch.Status != StatusProcessing || ch.Retry == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.scheduled[ch.ID]; ok {
+		return
+	}
+	s.scheduled[ch.ID] = struct{}{}
+
+	// The retries are done after the request that created them has finished.
+	ctx = context.WithoutCancel(ctx)
+	id, azID, attempts := ch.ID, ch.AuthorizationID, ch.Retry.Attempts
+	time.AfterFunc(time.Until(ch.Retry.NextAttempt), func() {
+		s.mu.Lock()
+		delete(s.scheduled, id)
+		s.mu.Unlock()
+		s.retry(ctx, db, id, azID, attempts, jwk, payload)
+	})
+}
+
+// retry validates a challenge again if no other attempt has been done since
+// the retry was scheduled. Validation errors are stored in the challenge;
+// other errors, like database errors, are ignored, and the challenge will be
+// validated again on the next client request.
+func (s *retryScheduler) retry(ctx context.Context, db DB, id, azID string, attempts int, jwk *jose.JSONWebKey, payload []byte) {
+	ch, err := db.GetChallenge(ctx, id, azID)
+	if err != nil {
+		return
+	}
+	ch.AuthorizationID = azID
+	if ch.Status != StatusProcessing || ch.Retry == nil {
+		return
+	}
+	// A client request has validated the challenge in the meantime.
+	if ch.Retry.Attempts != attempts {
+		s.schedule(ctx, db, ch, jwk, payload)
+		return
+	}
+	unlock, ok, err := lockChallenge(ctx, db, ch)
+	if err != nil || !ok {
+		return
+	}
+	defer unlock()
+	if err := ch.validate(ctx, db, jwk, payload); err == nil {
+		s.schedule(ctx, db, ch, jwk, payload)
+	}
+}
@@ -0,0 +1,185 @@
+package acme
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func TestChallengeRetry_IsDue(t *testing.T) {
+	now := clock.Now()
+	var r *ChallengeRetry
+	assert.False(t, r.IsDue(now))
+	assert.False(t, (&ChallengeRetry{Attempts: 5}).IsDue(now))
+	assert.False(t, (&ChallengeRetry{Attempts: 1, NextAttempt: now.Add(time.Second)}).IsDue(now))
+	assert.True(t, (&ChallengeRetry{Attempts: 1, NextAttempt: now}).IsDue(now))
+	assert.True(t, (&ChallengeRetry{Attempts: 1, NextAttempt: now.Add(-time.Second)}).IsDue(now))
+}
+
+func Test_updateRetry(t *testing.T) {
+	opts := &provisioner.ACMEChallengeRetry{
+		MaxAttempts: 3,
+		Backoff:     &provisioner.Duration{Duration: time.Minute},
+	}
+
+	ch := &Challenge{Status: StatusPending}
+	err := NewError(ErrorDNSType, "error looking up TXT records")
+	detail := err.Detail
+	updateRetry(ch, opts, err)
+	assert.Equal(t, StatusProcessing, ch.Status)
+	require.NotNil(t, ch.Retry)
+	assert.Equal(t, 1, ch.Retry.Attempts)
+	assert.WithinDuration(t, clock.Now().Add(time.Minute), ch.Retry.NextAttempt, time.Second)
+	assert.Equal(t, detail+"; attempt 1 of 3 failed, retrying at "+
+		ch.Retry.NextAttempt.Format(time.RFC3339), err.Detail)
+
+	err = NewError(ErrorDNSType, "error looking up TXT records")
+	updateRetry(ch, opts, err)
+	assert.Equal(t, StatusProcessing, ch.Status)
+	assert.Equal(t, 2, ch.Retry.Attempts)
+	assert.WithinDuration(t, clock.Now().Add(2*time.Minute), ch.Retry.NextAttempt, time.Second)
+
+	err = NewError(ErrorDNSType, "error looking up TXT records")
+	updateRetry(ch, opts, err)
+	assert.Equal(t, StatusInvalid, ch.Status)
+	assert.Equal(t, &ChallengeRetry{Attempts: 3}, ch.Retry)
+	assert.Equal(t, detail+"; giving up after 3 attempts", err.Detail)
+}
+
+func Test_storeError_retry(t *testing.T) {
+	prov := &MockProvisioner{
+		MgetACMEOptions: func() provisioner.ACMEOptions {
+			return provisioner.ACMEOptions{ChallengeRetry: &provisioner.ACMEChallengeRetry{MaxAttempts: 2}}
+		},
+	}
+	db := &MockDB{
+		MockUpdateChallenge: func(ctx context.Context, ch *Challenge) error {
+			return nil
+		},
+	}
+	ctx := NewProvisionerContext(context.Background(), prov)
+
+	// Transient errors are retried.
+	ch := &Challenge{Status: StatusPending}
+	require.NoError(t, storeError(ctx, db, ch, false, NewError(ErrorConnectionType, "force")))
+	assert.Equal(t, StatusProcessing, ch.Status)
+	assert.Equal(t, 1, ch.Retry.Attempts)
+
+	// Other errors are not.
+	ch = &Challenge{Status: StatusPending}
+	require.NoError(t, storeError(ctx, db, ch, true, NewError(ErrorRejectedIdentifierType, "force")))
+	assert.Equal(t, StatusInvalid, ch.Status)
+	assert.Nil(t, ch.Retry)
+
+	// Without retries the challenge remains pending.
+	ch = &Challenge{Status: StatusPending}
+	require.NoError(t, storeError(context.Background(), db, ch, false, NewError(ErrorConnectionType, "force")))
+	assert.Equal(t, StatusPending, ch.Status)
+	assert.Nil(t, ch.Retry)
+}
+
+func TestChallenge_Validate_retry(t *testing.T) {
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	require.NoError(t, err)
+	keyAuth, err := KeyAuthorization("token", jwk)
+	require.NoError(t, err)
+	h := sha256.Sum256([]byte(keyAuth))
+	txt := base64.RawURLEncoding.EncodeToString(h[:])
+
+	prov := &MockProvisioner{
+		MgetACMEOptions: func() provisioner.ACMEOptions {
+			return provisioner.ACMEOptions{
+				ChallengeRetry: &provisioner.ACMEChallengeRetry{
+					MaxAttempts: 3,
+					Backoff:     &provisioner.Duration{Duration: time.Millisecond},
+				},
+			}
+		},
+	}
+
+	// The TXT record is published after the first attempt.
+	var lookups int
+	vc := &mockClient{
+		lookupTxt: func(name string) ([]string, error) {
+			assert.Equal(t, "_acme-challenge.zap.internal", name)
+			if lookups++; lookups == 1 {
+				return nil, errors.New("force")
+			}
+			return []string{txt}, nil
+		},
+	}
+
+	var (
+		mu     sync.Mutex
+		stored *Challenge
+	)
+	done := make(chan struct{})
+	db := &MockDB{
+		MockGetChallenge: func(ctx context.Context, id, azID string) (*Challenge, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			assert.Equal(t, "chID", id)
+			assert.Equal(t, "azID", azID)
+			ch := *stored
+			return &ch, nil
+		},
+		MockUpdateChallenge: func(ctx context.Context, ch *Challenge) error {
+			mu.Lock()
+			defer mu.Unlock()
+			c := *ch
+			stored = &c
+			if ch.Status == StatusValid {
+				close(done)
+			}
+			return nil
+		},
+	}
+
+	ctx := NewProvisionerContext(context.Background(), prov)
+	ctx = NewClientContext(ctx, vc)
+	ch := &Challenge{
+		ID:              "chID",
+		AuthorizationID: "azID",
+		Type:            DNS01,
+		Status:          StatusPending,
+		Token:           "token",
+		Value:           "zap.internal",
+	}
+	require.NoError(t, ch.Validate(ctx, db, jwk, nil))
+	assert.Equal(t, StatusProcessing, ch.Status)
+	assert.Equal(t, 1, ch.Retry.Attempts)
+	assert.Equal(t, NewError(ErrorDNSType, "").Type, ch.Error.Type)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("challenge was not retried")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, StatusValid, stored.Status)
+	assert.Nil(t, stored.Error)
+	assert.Equal(t, 2, lookups)
+}
+
+func TestChallenge_Validate_notDue(t *testing.T) {
+	ch := &Challenge{
+		Type:   DNS01,
+		Status: StatusProcessing,
+		Retry:  &ChallengeRetry{Attempts: 1, NextAttempt: clock.Now().Add(time.Minute)},
+	}
+	// The database is not used if the next attempt is not due.
+	require.NoError(t, ch.Validate(context.Background(), nil, nil, nil))
+	assert.Equal(t, StatusProcessing, ch.Status)
+}
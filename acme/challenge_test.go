@@ -1656,7 +1656,13 @@ func newTLSALPNValidationCert(keyAuthHash []byte, obsoleteOID, critical bool, na
 		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
 		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
 		BasicConstraintsValid: true,
-		DNSNames:              names,
+	}
+	for _, name := range names {
+		if ip := net.ParseIP(name); ip != nil {
+			certTemplate.IPAddresses = append(certTemplate.IPAddresses, ip)
+		} else {
+			certTemplate.DNSNames = append(certTemplate.DNSNames, name)
+		}
 	}
 
 	if keyAuthHash != nil {
@@ -2618,6 +2624,48 @@ func TestTLSALPN01Validate(t *testing.T) {
 				jwk: jwk,
 			}
 		},
+		"ok/ip-with-dns-name-error": func(t *testing.T) test {
+			ch := makeTLSCh()
+			ch.Value = "127.0.0.1"
+
+			jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+			require.NoError(t, err)
+
+			expKeyAuth, err := KeyAuthorization(ch.Token, jwk)
+			require.NoError(t, err)
+			expKeyAuthHash := sha256.Sum256([]byte(expKeyAuth))
+
+			cert, err := newTLSALPNValidationCert(expKeyAuthHash[:], false, true, ch.Value, "zap.internal")
+			require.NoError(t, err)
+
+			srv, tlsDial := newTestTLSALPNServer(cert)
+			srv.Start()
+
+			return test{
+				ch: ch,
+				vc: &mockClient{
+					tlsDial: tlsDial,
+				},
+				db: &MockDB{
+					MockUpdateChallenge: func(ctx context.Context, updch *Challenge) error {
+						assert.Equal(t, "chID", updch.ID)
+						assert.Equal(t, StatusInvalid, updch.Status)
+						assert.Equal(t, "127.0.0.1", updch.Value)
+
+						err := NewError(ErrorRejectedIdentifierType, "incorrect certificate for tls-alpn-01 challenge: leaf certificate must contain a single IP address or DNS name, %v", ch.Value)
+
+						assert.EqualError(t, updch.Error.Err, err.Err.Error())
+						assert.Equal(t, err.Type, updch.Error.Type)
+						assert.Equal(t, err.Detail, updch.Error.Detail)
+						assert.Equal(t, err.Status, updch.Error.Status)
+
+						return nil
+					},
+				},
+				srv: srv,
+				jwk: jwk,
+			}
+		},
 		"ok/ip": func(t *testing.T) test {
 			ch := makeTLSCh()
 			ch.Value = "127.0.0.1"
@@ -26,6 +26,7 @@ type CertificateAuthority interface {
 	IsRevoked(sn string) (bool, error)
 	Revoke(context.Context, *authority.RevokeOptions) error
 	LoadProvisionerByName(string) (provisioner.Interface, error)
+	GetCertificateChains(certChain []*x509.Certificate, preferredChain string) [][]*x509.Certificate
 }
 
 // NewContext adds the given acme components to the context.
@@ -72,12 +73,15 @@ type Provisioner interface {
 	AuthorizeSign(ctx context.Context, token string) ([]provisioner.SignOption, error)
 	AuthorizeRevoke(ctx context.Context, token string) error
 	IsChallengeEnabled(ctx context.Context, challenge provisioner.ACMEChallenge) bool
+	IsIdentifierChallengeEnabled(ctx context.Context, typ provisioner.ACMEIdentifierType, challenge provisioner.ACMEChallenge) bool
 	IsAttestationFormatEnabled(ctx context.Context, format provisioner.ACMEAttestationFormat) bool
 	GetAttestationRoots() (*x509.CertPool, bool)
 	GetID() string
 	GetName() string
 	DefaultTLSCertDuration() time.Duration
 	GetOptions() *provisioner.Options
+	GetProfileOptions(profile string) *provisioner.Options
+	GetACMEOptions() provisioner.ACMEOptions
 }
 
 type provisionerKey struct{}
@@ -108,18 +112,21 @@ func MustProvisionerFromContext(ctx context.Context) Provisioner {
 
 // MockProvisioner for testing
 type MockProvisioner struct {
-	Mret1                     interface{}
-	Merr                      error
-	MgetID                    func() string
-	MgetName                  func() string
-	MauthorizeOrderIdentifier func(ctx context.Context, identifier provisioner.ACMEIdentifier) error
-	MauthorizeSign            func(ctx context.Context, ott string) ([]provisioner.SignOption, error)
-	MauthorizeRevoke          func(ctx context.Context, token string) error
-	MisChallengeEnabled       func(ctx context.Context, challenge provisioner.ACMEChallenge) bool
-	MisAttFormatEnabled       func(ctx context.Context, format provisioner.ACMEAttestationFormat) bool
-	MgetAttestationRoots      func() (*x509.CertPool, bool)
-	MdefaultTLSCertDuration   func() time.Duration
-	MgetOptions               func() *provisioner.Options
+	Mret1                         interface{}
+	Merr                          error
+	MgetID                        func() string
+	MgetName                      func() string
+	MauthorizeOrderIdentifier     func(ctx context.Context, identifier provisioner.ACMEIdentifier) error
+	MauthorizeSign                func(ctx context.Context, ott string) ([]provisioner.SignOption, error)
+	MauthorizeRevoke              func(ctx context.Context, token string) error
+	MisChallengeEnabled           func(ctx context.Context, challenge provisioner.ACMEChallenge) bool
+	MisIdentifierChallengeEnabled func(ctx context.Context, typ provisioner.ACMEIdentifierType, challenge provisioner.ACMEChallenge) bool
+	MisAttFormatEnabled           func(ctx context.Context, format provisioner.ACMEAttestationFormat) bool
+	MgetAttestationRoots          func() (*x509.CertPool, bool)
+	MdefaultTLSCertDuration       func() time.Duration
+	MgetOptions                   func() *provisioner.Options
+	MgetProfileOptions            func(profile string) *provisioner.Options
+	MgetACMEOptions               func() provisioner.ACMEOptions
 }
 
 // GetName mock
@@ -162,6 +169,14 @@ func (m *MockProvisioner) IsChallengeEnabled(ctx context.Context, challenge prov
 	return m.Merr == nil
 }
 
+// IsIdentifierChallengeEnabled mock
+func (m *MockProvisioner) IsIdentifierChallengeEnabled(ctx context.Context, typ provisioner.ACMEIdentifierType, challenge provisioner.ACMEChallenge) bool {
+	if m.MisIdentifierChallengeEnabled != nil {
+		return m.MisIdentifierChallengeEnabled(ctx, typ, challenge)
+	}
+	return m.IsChallengeEnabled(ctx, challenge)
+}
+
 // IsAttestationFormatEnabled mock
 func (m *MockProvisioner) IsAttestationFormatEnabled(ctx context.Context, format provisioner.ACMEAttestationFormat) bool {
 	if m.MisAttFormatEnabled != nil {
@@ -193,6 +208,22 @@ func (m *MockProvisioner) GetOptions() *provisioner.Options {
 	return m.Mret1.(*provisioner.Options)
 }
 
+// GetProfileOptions mock
+func (m *MockProvisioner) GetProfileOptions(profile string) *provisioner.Options {
+	if m.MgetProfileOptions != nil {
+		return m.MgetProfileOptions(profile)
+	}
+	return m.GetOptions()
+}
+
+// GetACMEOptions mock
+func (m *MockProvisioner) GetACMEOptions() provisioner.ACMEOptions {
+	if m.MgetACMEOptions != nil {
+		return m.MgetACMEOptions()
+	}
+	return provisioner.ACMEOptions{}
+}
+
 // GetID mock
 func (m *MockProvisioner) GetID() string {
 	if m.MgetID != nil {
@@ -56,6 +56,23 @@ type DB interface {
 	UpdateOrder(ctx context.Context, o *Order) error
 }
 
+// OrderLister is the interface implemented by the databases that can paginate
+// the orders owned by an account.
+type OrderLister interface {
+	// ListOrdersByAccountID returns a page of the order IDs owned by an
+	// account, and the cursor of the next page, empty in the last page.
+	ListOrdersByAccountID(ctx context.Context, accountID, cursor string, limit int) ([]string, string, error)
+}
+
+// OrderCertificateSwapper is the interface implemented by the databases that
+// can atomically replace the certificate of an order.
+type OrderCertificateSwapper interface {
+	// SwapOrderCertificate sets the certificate of an order only if its
+	// current certificate is oldCertificateID. It returns false if the
+	// certificate of the order has been changed by another request.
+	SwapOrderCertificate(ctx context.Context, orderID, oldCertificateID, newCertificateID string) (bool, error)
+}
+
 type dbKey struct{}
 
 // NewDatabaseContext adds the given acme database to the context.
@@ -97,6 +114,12 @@ type MockDB struct {
 	MockGetExternalAccountKeyByAccountID func(ctx context.Context, provisionerID, accountID string) (*ExternalAccountKey, error)
 	MockDeleteExternalAccountKey         func(ctx context.Context, provisionerID, keyID string) error
 	MockUpdateExternalAccountKey         func(ctx context.Context, provisionerID string, eak *ExternalAccountKey) error
+	MockAddExternalAccountKeyStats       func(ctx context.Context, provisionerID, keyID string, stats ExternalAccountKeyStats) error
+
+	MockCreateEnrolledDevice func(ctx context.Context, dev *EnrolledDevice) error
+	MockGetEnrolledDevice    func(ctx context.Context, provisionerID, id string) (*EnrolledDevice, error)
+	MockGetEnrolledDevices   func(ctx context.Context, provisionerID string) ([]*EnrolledDevice, error)
+	MockDeleteEnrolledDevice func(ctx context.Context, provisionerID, id string) error
 
 	MockCreateNonce func(ctx context.Context) (Nonce, error)
 	MockDeleteNonce func(ctx context.Context, nonce Nonce) error
@@ -114,10 +137,13 @@ type MockDB struct {
 	MockGetChallenge    func(ctx context.Context, id, authzID string) (*Challenge, error)
 	MockUpdateChallenge func(ctx context.Context, ch *Challenge) error
 
-	MockCreateOrder          func(ctx context.Context, o *Order) error
-	MockGetOrder             func(ctx context.Context, id string) (*Order, error)
-	MockGetOrdersByAccountID func(ctx context.Context, accountID string) ([]string, error)
-	MockUpdateOrder          func(ctx context.Context, o *Order) error
+	MockCreateOrder           func(ctx context.Context, o *Order) error
+	MockGetOrder              func(ctx context.Context, id string) (*Order, error)
+	MockGetOrdersByAccountID  func(ctx context.Context, accountID string) ([]string, error)
+	MockListOrdersByAccountID func(ctx context.Context, accountID, cursor string, limit int) ([]string, string, error)
+	MockUpdateOrder           func(ctx context.Context, o *Order) error
+
+	MockDeleteStaleResources func(ctx context.Context, opts GarbageCollectionOptions) (*GarbageCollectionStats, error)
 
 	MockRet1  interface{}
 	MockError error
@@ -233,6 +259,50 @@ func (m *MockDB) UpdateExternalAccountKey(ctx context.Context, provisionerID str
 	return m.MockError
 }
 
+// AddExternalAccountKeyStats mock
+func (m *MockDB) AddExternalAccountKeyStats(ctx context.Context, provisionerID, keyID string, stats ExternalAccountKeyStats) error {
+	if m.MockAddExternalAccountKeyStats != nil {
+		return m.MockAddExternalAccountKeyStats(ctx, provisionerID, keyID, stats)
+	}
+	return m.MockError
+}
+
+// CreateEnrolledDevice mock
+func (m *MockDB) CreateEnrolledDevice(ctx context.Context, dev *EnrolledDevice) error {
+	if m.MockCreateEnrolledDevice != nil {
+		return m.MockCreateEnrolledDevice(ctx, dev)
+	}
+	return m.MockError
+}
+
+// GetEnrolledDevice mock
+func (m *MockDB) GetEnrolledDevice(ctx context.Context, provisionerID, id string) (*EnrolledDevice, error) {
+	if m.MockGetEnrolledDevice != nil {
+		return m.MockGetEnrolledDevice(ctx, provisionerID, id)
+	} else if m.MockError != nil {
+		return nil, m.MockError
+	}
+	return m.MockRet1.(*EnrolledDevice), m.MockError
+}
+
+// GetEnrolledDevices mock
+func (m *MockDB) GetEnrolledDevices(ctx context.Context, provisionerID string) ([]*EnrolledDevice, error) {
+	if m.MockGetEnrolledDevices != nil {
+		return m.MockGetEnrolledDevices(ctx, provisionerID)
+	} else if m.MockError != nil {
+		return nil, m.MockError
+	}
+	return m.MockRet1.([]*EnrolledDevice), m.MockError
+}
+
+// DeleteEnrolledDevice mock
+func (m *MockDB) DeleteEnrolledDevice(ctx context.Context, provisionerID, id string) error {
+	if m.MockDeleteEnrolledDevice != nil {
+		return m.MockDeleteEnrolledDevice(ctx, provisionerID, id)
+	}
+	return m.MockError
+}
+
 // CreateNonce mock
 func (m *MockDB) CreateNonce(ctx context.Context) (Nonce, error) {
 	if m.MockCreateNonce != nil {
@@ -392,3 +462,23 @@ func (m *MockDB) GetOrdersByAccountID(ctx context.Context, accID string) ([]stri
 	}
 	return m.MockRet1.([]string), m.MockError
 }
+
+// ListOrdersByAccountID mock. If it is not set, the orders are returned by
+// GetOrdersByAccountID in a single page.
+func (m *MockDB) ListOrdersByAccountID(ctx context.Context, accID, cursor string, limit int) ([]string, string, error) {
+	if m.MockListOrdersByAccountID != nil {
+		return m.MockListOrdersByAccountID(ctx, accID, cursor, limit)
+	}
+	orders, err := m.GetOrdersByAccountID(ctx, accID)
+	return orders, "", err
+}
+
+// DeleteStaleResources mock
+func (m *MockDB) DeleteStaleResources(ctx context.Context, opts GarbageCollectionOptions) (*GarbageCollectionStats, error) {
+	if m.MockDeleteStaleResources != nil {
+		return m.MockDeleteStaleResources(ctx, opts)
+	} else if m.MockError != nil {
+		return nil, m.MockError
+	}
+	return m.MockRet1.(*GarbageCollectionStats), m.MockError
+}
@@ -141,5 +141,43 @@ func (db *DB) UpdateAccount(ctx context.Context, acc *acme.Account) error {
 		nu.DeactivatedAt = clock.Now()
 	}
 
+	// If the key has been rolled over, the key-account index is updated too.
+	if acc.Key != nil && old.Key != nil {
+		oldKid, err := acme.KeyToID(old.Key)
+		if err != nil {
+			return err
+		}
+		kid, err := acme.KeyToID(acc.Key)
+		if err != nil {
+			return err
+		}
+		if kid != oldKid {
+			return db.updateAccountKey(ctx, old, nu, acc.Key, oldKid, kid)
+		}
+	}
+
 	return db.save(ctx, old.ID, nu, old, "account", accountTable)
 }
+
+// updateAccountKey saves an account with a new key, replacing the key-account
+// index of the old key with the one of the new key.
+func (db *DB) updateAccountKey(ctx context.Context, old, nu *dbAccount, key *jose.JSONWebKey, oldKid, kid string) error {
+	kidB := []byte(kid)
+	_, swapped, err := db.db.CmpAndSwap(accountByKeyIDTable, kidB, nil, []byte(old.ID))
+	switch {
+	case err != nil:
+		return errors.Wrap(err, "error storing keyID to accountID index")
+	case !swapped:
+		return errors.Errorf("key-id to account-id index already exists")
+	}
+
+	nu.Key = key
+	if err := db.save(ctx, old.ID, nu, old, "account", accountTable); err != nil {
+		db.db.Del(accountByKeyIDTable, kidB)
+		return err
+	}
+	if err := db.db.Del(accountByKeyIDTable, []byte(oldKid)); err != nil {
+		return errors.Wrapf(err, "error deleting key-account index for key %s", oldKid)
+	}
+	return nil
+}
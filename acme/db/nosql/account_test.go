@@ -700,6 +700,98 @@ func TestDB_UpdateAccount(t *testing.T) {
 				},
 			}
 		},
+		"fail/key-index-exists": func(t *testing.T) test {
+			newJWK, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+			assert.FatalError(t, err)
+			newKid, err := acme.KeyToID(newJWK)
+			assert.FatalError(t, err)
+			return test{
+				acc: &acme.Account{ID: accID, Status: acme.StatusValid, Key: newJWK},
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return b, nil
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						assert.Equals(t, bucket, accountByKeyIDTable)
+						assert.Equals(t, string(key), newKid)
+						assert.Nil(t, old)
+						return []byte("other"), false, nil
+					},
+				},
+				err: errors.New("key-id to account-id index already exists"),
+			}
+		},
+		"fail/key-change-save-error": func(t *testing.T) test {
+			newJWK, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+			assert.FatalError(t, err)
+			newKid, err := acme.KeyToID(newJWK)
+			assert.FatalError(t, err)
+			var deleted bool
+			return test{
+				acc: &acme.Account{ID: accID, Status: acme.StatusValid, Key: newJWK},
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return b, nil
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						switch string(bucket) {
+						case string(accountByKeyIDTable):
+							return nu, true, nil
+						case string(accountTable):
+							return nil, false, errors.New("force")
+						default:
+							assert.FatalError(t, errors.Errorf("unexpected bucket %s", string(bucket)))
+							return nil, false, errors.New("force")
+						}
+					},
+					MDel: func(bucket, key []byte) error {
+						assert.False(t, deleted)
+						assert.Equals(t, bucket, accountByKeyIDTable)
+						assert.Equals(t, string(key), newKid)
+						deleted = true
+						return nil
+					},
+				},
+				err: errors.New("error saving acme account: force"),
+			}
+		},
+		"ok/key-change": func(t *testing.T) test {
+			newJWK, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+			assert.FatalError(t, err)
+			newKid, err := acme.KeyToID(newJWK)
+			assert.FatalError(t, err)
+			oldKid, err := acme.KeyToID(jwk)
+			assert.FatalError(t, err)
+			return test{
+				acc: &acme.Account{ID: accID, Status: acme.StatusDeactivated, Key: newJWK},
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return b, nil
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						switch string(bucket) {
+						case string(accountByKeyIDTable):
+							assert.Equals(t, string(key), newKid)
+							assert.Nil(t, old)
+							assert.Equals(t, string(nu), accID)
+						case string(accountTable):
+							assert.Equals(t, old, b)
+							dbNew := new(dbAccount)
+							assert.FatalError(t, json.Unmarshal(nu, dbNew))
+							assert.Equals(t, dbNew.Key.KeyID, newJWK.KeyID)
+						default:
+							assert.FatalError(t, errors.Errorf("unexpected bucket %s", string(bucket)))
+						}
+						return nu, true, nil
+					},
+					MDel: func(bucket, key []byte) error {
+						assert.Equals(t, bucket, accountByKeyIDTable)
+						assert.Equals(t, string(key), oldKid)
+						return nil
+					},
+				},
+			}
+		},
 	}
 	for name, run := range tests {
 		tc := run(t)
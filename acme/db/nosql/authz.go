@@ -3,6 +3,8 @@ package nosql
 import (
 	"context"
 	"encoding/json"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
@@ -10,6 +12,9 @@ import (
 	"github.com/smallstep/nosql"
 )
 
+// Mutex for locking authzsByAccount index operations.
+var authzsByAccountMux sync.Mutex
+
 // dbAuthz is the base authz type that others build from.
 type dbAuthz struct {
 	ID           string          `json:"id"`
@@ -69,6 +74,7 @@ func (db *DB) GetAuthorization(ctx context.Context, id string) (*acme.Authorizat
 		Challenges:  chs,
 		Wildcard:    dbaz.Wildcard,
 		ExpiresAt:   dbaz.ExpiresAt,
+		CreatedAt:   dbaz.CreatedAt,
 		Token:       dbaz.Token,
 		Fingerprint: dbaz.Fingerprint,
 		Error:       dbaz.Error,
@@ -103,7 +109,15 @@ func (db *DB) CreateAuthorization(ctx context.Context, az *acme.Authorization) e
 		Wildcard:     az.Wildcard,
 	}
 
-	return db.save(ctx, az.ID, dbaz, nil, "authz", authzTable)
+	if err := db.save(ctx, az.ID, dbaz, nil, "authz", authzTable); err != nil {
+		return err
+	}
+	if _, err := db.updateAddAuthzIDs(ctx, az.AccountID, az.ID); err != nil {
+		// Ignore error from delete -- we tried our best.
+		db.db.Del(authzTable, []byte(az.ID))
+		return err
+	}
+	return nil
 }
 
 // UpdateAuthorization saves an updated ACME Authorization to the database.
@@ -120,25 +134,16 @@ func (db *DB) UpdateAuthorization(ctx context.Context, az *acme.Authorization) e
 	return db.save(ctx, old.ID, nu, old, "authz", authzTable)
 }
 
-// GetAuthorizationsByAccountID retrieves and unmarshals ACME authz types from the database.
-func (db *DB) GetAuthorizationsByAccountID(_ context.Context, accountID string) ([]*acme.Authorization, error) {
-	entries, err := db.db.List(authzTable)
+// GetAuthorizationsByAccountID retrieves and unmarshals the ACME authz types
+// of the account that have not expired.
+func (db *DB) GetAuthorizationsByAccountID(ctx context.Context, accountID string) ([]*acme.Authorization, error) {
+	dbazs, err := db.updateAddAuthzIDs(ctx, accountID)
 	if err != nil {
-		return nil, errors.Wrapf(err, "error listing authz")
+		return nil, err
 	}
-	authzs := []*acme.Authorization{}
-	for _, entry := range entries {
-		dbaz := new(dbAuthz)
-		if err = json.Unmarshal(entry.Value, dbaz); err != nil {
-			return nil, errors.Wrapf(err, "error unmarshaling dbAuthz key '%s' into dbAuthz struct", string(entry.Key))
-		}
-		// Filter out all dbAuthzs that don't belong to the accountID. This
-		// could be made more efficient with additional data structures mapping the
-		// Account ID to authorizations. Not trivial to do, though.
-		if dbaz.AccountID != accountID {
-			continue
-		}
-		authzs = append(authzs, &acme.Authorization{
+	authzs := make([]*acme.Authorization, len(dbazs))
+	for i, dbaz := range dbazs {
+		authzs[i] = &acme.Authorization{
 			ID:          dbaz.ID,
 			AccountID:   dbaz.AccountID,
 			Identifier:  dbaz.Identifier,
@@ -146,11 +151,99 @@ func (db *DB) GetAuthorizationsByAccountID(_ context.Context, accountID string)
 			Challenges:  nil, // challenges not required for current use case
 			Wildcard:    dbaz.Wildcard,
 			ExpiresAt:   dbaz.ExpiresAt,
+			CreatedAt:   dbaz.CreatedAt,
 			Token:       dbaz.Token,
 			Fingerprint: dbaz.Fingerprint,
 			Error:       dbaz.Error,
-		})
+		}
 	}
-
 	return authzs, nil
 }
+
+// updateAddAuthzIDs adds the given authz IDs to the index of the account,
+// removes the ones that have expired or no longer exist, and returns the
+// authorizations of the account that have not expired, without the added ones.
+//
+// Accounts created before the index existed do not have an entry, their
+// authorizations are looked up in the authz table once and stored in the
+// index.
+func (db *DB) updateAddAuthzIDs(ctx context.Context, accID string, addAzIDs ...string) ([]*dbAuthz, error) {
+	authzsByAccountMux.Lock()
+	defer authzsByAccountMux.Unlock()
+
+	var (
+		oldAzIDs []string
+		dbazs    []*dbAuthz
+		indexed  bool
+	)
+	b, err := db.db.Get(authzsByAccountIDTable, []byte(accID))
+	switch {
+	case nosql.IsErrNotFound(err):
+		if dbazs, err = db.listDBAuthzs(accID); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, errors.Wrapf(err, "error loading authzIDs for account %s", accID)
+	default:
+		indexed = true
+		if err := json.Unmarshal(b, &oldAzIDs); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshaling authzIDs for account %s", accID)
+		}
+		for _, id := range oldAzIDs {
+			data, err := db.db.Get(authzTable, []byte(id))
+			if nosql.IsErrNotFound(err) {
+				continue
+			} else if err != nil {
+				return nil, errors.Wrapf(err, "error loading authz %s", id)
+			}
+			dbaz := new(dbAuthz)
+			if err := json.Unmarshal(data, dbaz); err != nil {
+				return nil, errors.Wrapf(err, "error unmarshaling authz %s into dbAuthz", id)
+			}
+			dbazs = append(dbazs, dbaz)
+		}
+	}
+
+	now := clock.Now()
+	validAzs := make([]*dbAuthz, 0, len(dbazs))
+	newAzIDs := make([]string, 0, len(dbazs)+len(addAzIDs))
+	for _, dbaz := range dbazs {
+		if dbaz.ExpiresAt.After(now) {
+			validAzs = append(validAzs, dbaz)
+			newAzIDs = append(newAzIDs, dbaz.ID)
+		}
+	}
+	newAzIDs = append(newAzIDs, addAzIDs...)
+
+	// Write the index if it did not exist or if it has changed.
+	if !indexed || !slices.Equal(oldAzIDs, newAzIDs) {
+		var _old interface{}
+		if indexed {
+			_old = oldAzIDs
+		}
+		if err := db.save(ctx, accID, newAzIDs, _old, "authzIDsByAccountID", authzsByAccountIDTable); err != nil {
+			return nil, errors.Wrapf(err, "error saving authzIDs index for account %s", accID)
+		}
+	}
+	return validAzs, nil
+}
+
+// listDBAuthzs returns the authorizations of the account looking at all the
+// entries in the authz table.
+func (db *DB) listDBAuthzs(accountID string) ([]*dbAuthz, error) {
+	entries, err := db.db.List(authzTable)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error listing authz")
+	}
+	var dbazs []*dbAuthz
+	for _, entry := range entries {
+		dbaz := new(dbAuthz)
+		if err = json.Unmarshal(entry.Value, dbaz); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshaling dbAuthz key '%s' into dbAuthz struct", string(entry.Key))
+		}
+		if dbaz.AccountID == accountID {
+			dbazs = append(dbazs, dbaz)
+		}
+	}
+	return dbazs, nil
+}
@@ -410,7 +410,18 @@ func TestDB_CreateAuthorization(t *testing.T) {
 			)
 			return test{
 				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						assert.Equals(t, bucket, authzsByAccountIDTable)
+						assert.Equals(t, string(key), "accountID")
+						return []byte(`[]`), nil
+					},
 					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						if string(bucket) == string(authzsByAccountIDTable) {
+							assert.Equals(t, string(key), "accountID")
+							assert.Equals(t, old, []byte(`[]`))
+							assert.Equals(t, nu, []byte(`["`+id+`"]`))
+							return nu, true, nil
+						}
 						*idPtr = string(key)
 						assert.Equals(t, bucket, authzTable)
 						assert.Equals(t, string(key), az.ID)
@@ -439,6 +450,41 @@ func TestDB_CreateAuthorization(t *testing.T) {
 				_id: idPtr,
 			}
 		},
+		"fail/index-error": func(t *testing.T) test {
+			var deleted bool
+			az := &acme.Authorization{
+				AccountID: "accountID",
+				Identifier: acme.Identifier{
+					Type:  "dns",
+					Value: "test.ca.smallstep.com",
+				},
+				Status:    acme.StatusPending,
+				ExpiresAt: clock.Now().Add(5 * time.Minute),
+			}
+			t.Cleanup(func() {
+				assert.True(t, deleted)
+			})
+			return test{
+				db: &db.MockNoSQLDB{
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						assert.Equals(t, bucket, authzTable)
+						return nu, true, nil
+					},
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						assert.Equals(t, bucket, authzsByAccountIDTable)
+						return nil, errors.New("force")
+					},
+					MDel: func(bucket, key []byte) error {
+						assert.Equals(t, bucket, authzTable)
+						assert.Equals(t, string(key), az.ID)
+						deleted = true
+						return nil
+					},
+				},
+				az:  az,
+				err: errors.New("error loading authzIDs for account accountID: force"),
+			}
+		},
 	}
 	for name, run := range tests {
 		tc := run(t)
@@ -633,6 +679,11 @@ func TestDB_GetAuthorizationsByAccountID(t *testing.T) {
 		"fail/db.List-error": func(t *testing.T) test {
 			return test{
 				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						assert.Equals(t, bucket, authzsByAccountIDTable)
+						assert.Equals(t, string(key), accountID)
+						return nil, nosqldb.ErrNotFound
+					},
 					MList: func(bucket []byte) ([]*nosqldb.Entry, error) {
 						assert.Equals(t, bucket, authzTable)
 						return nil, errors.New("force")
@@ -645,6 +696,11 @@ func TestDB_GetAuthorizationsByAccountID(t *testing.T) {
 			b := []byte(`{malformed}`)
 			return test{
 				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						assert.Equals(t, bucket, authzsByAccountIDTable)
+						assert.Equals(t, string(key), accountID)
+						return nil, nosqldb.ErrNotFound
+					},
 					MList: func(bucket []byte) ([]*nosqldb.Entry, error) {
 						assert.Equals(t, bucket, authzTable)
 						return []*nosqldb.Entry{
@@ -681,6 +737,11 @@ func TestDB_GetAuthorizationsByAccountID(t *testing.T) {
 
 			return test{
 				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						assert.Equals(t, bucket, authzsByAccountIDTable)
+						assert.Equals(t, string(key), accountID)
+						return nil, nosqldb.ErrNotFound
+					},
 					MList: func(bucket []byte) ([]*nosqldb.Entry, error) {
 						assert.Equals(t, bucket, authzTable)
 						return []*nosqldb.Entry{
@@ -691,6 +752,13 @@ func TestDB_GetAuthorizationsByAccountID(t *testing.T) {
 							},
 						}, nil
 					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						assert.Equals(t, bucket, authzsByAccountIDTable)
+						assert.Equals(t, string(key), accountID)
+						assert.Equals(t, old, nil)
+						assert.Equals(t, nu, []byte(`["azID"]`))
+						return nu, true, nil
+					},
 				},
 				authzs: []*acme.Authorization{
 					{
@@ -702,6 +770,7 @@ func TestDB_GetAuthorizationsByAccountID(t *testing.T) {
 						Challenges: nil,
 						Wildcard:   dbaz.Wildcard,
 						ExpiresAt:  dbaz.ExpiresAt,
+						CreatedAt:  dbaz.CreatedAt,
 						Error:      dbaz.Error,
 					},
 				},
@@ -728,6 +797,11 @@ func TestDB_GetAuthorizationsByAccountID(t *testing.T) {
 
 			return test{
 				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						assert.Equals(t, bucket, authzsByAccountIDTable)
+						assert.Equals(t, string(key), accountID)
+						return nil, nosqldb.ErrNotFound
+					},
 					MList: func(bucket []byte) ([]*nosqldb.Entry, error) {
 						assert.Equals(t, bucket, authzTable)
 						return []*nosqldb.Entry{
@@ -738,10 +812,94 @@ func TestDB_GetAuthorizationsByAccountID(t *testing.T) {
 							},
 						}, nil
 					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						assert.Equals(t, bucket, authzsByAccountIDTable)
+						assert.Equals(t, old, nil)
+						assert.Equals(t, nu, []byte(`[]`))
+						return nu, true, nil
+					},
 				},
 				authzs: []*acme.Authorization{},
 			}
 		},
+		"fail/index-error": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						assert.Equals(t, bucket, authzsByAccountIDTable)
+						return nil, errors.New("force")
+					},
+				},
+				err: errors.New("error loading authzIDs for account accountID: force"),
+			}
+		},
+		"ok/index": func(t *testing.T) test {
+			now := clock.Now()
+			dbaz := &dbAuthz{
+				ID:        azID,
+				AccountID: accountID,
+				Identifier: acme.Identifier{
+					Type:  "dns",
+					Value: "test.ca.smallstep.com",
+				},
+				Status:    acme.StatusValid,
+				CreatedAt: now,
+				ExpiresAt: now.Add(5 * time.Minute),
+			}
+			expired := &dbAuthz{
+				ID:        "expiredID",
+				AccountID: accountID,
+				Status:    acme.StatusValid,
+				CreatedAt: now.Add(-48 * time.Hour),
+				ExpiresAt: now.Add(-24 * time.Hour),
+			}
+			b, err := json.Marshal(dbaz)
+			assert.FatalError(t, err)
+			eb, err := json.Marshal(expired)
+			assert.FatalError(t, err)
+
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						switch string(bucket) {
+						case string(authzsByAccountIDTable):
+							assert.Equals(t, string(key), accountID)
+							return []byte(`["azID","expiredID","deletedID"]`), nil
+						case string(authzTable):
+							switch string(key) {
+							case azID:
+								return b, nil
+							case "expiredID":
+								return eb, nil
+							default:
+								return nil, nosqldb.ErrNotFound
+							}
+						default:
+							return nil, errors.Errorf("unexpected bucket '%s'", string(bucket))
+						}
+					},
+					MList: func(bucket []byte) ([]*nosqldb.Entry, error) {
+						return nil, errors.New("unexpected list")
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						assert.Equals(t, bucket, authzsByAccountIDTable)
+						assert.Equals(t, old, []byte(`["azID","expiredID","deletedID"]`))
+						assert.Equals(t, nu, []byte(`["azID"]`))
+						return nu, true, nil
+					},
+				},
+				authzs: []*acme.Authorization{
+					{
+						ID:         dbaz.ID,
+						AccountID:  dbaz.AccountID,
+						Identifier: dbaz.Identifier,
+						Status:     dbaz.Status,
+						ExpiresAt:  dbaz.ExpiresAt,
+						CreatedAt:  dbaz.CreatedAt,
+					},
+				},
+			}
+		},
 	}
 	for name, run := range tests {
 		tc := run(t)
@@ -363,7 +363,7 @@ func TestDB_GetCertificateBySerial(t *testing.T) {
 						return nil, errors.New("wrong table")
 					},
 				},
-				acmeErr: acme.NewError(acme.ErrorMalformedType, "certificate with serial %s not found", serial),
+				acmeErr: acme.WrapError(acme.ErrorMalformedType, acme.ErrNotFound, "certificate with serial %s not found", serial),
 			}
 		},
 		"fail/db-error": func(t *testing.T) test {
@@ -13,15 +13,18 @@ import (
 )
 
 type dbChallenge struct {
-	ID          string             `json:"id"`
-	AccountID   string             `json:"accountID"`
-	Type        acme.ChallengeType `json:"type"`
-	Status      acme.Status        `json:"status"`
-	Token       string             `json:"token"`
-	Value       string             `json:"value"`
-	ValidatedAt string             `json:"validatedAt"`
-	CreatedAt   time.Time          `json:"createdAt"`
-	Error       *acme.Error        `json:"error"` // TODO(hs): a bit dangerous; should become db-specific type
+	ID          string               `json:"id"`
+	AccountID   string               `json:"accountID"`
+	Type        acme.ChallengeType   `json:"type"`
+	Status      acme.Status          `json:"status"`
+	Token       string               `json:"token"`
+	From        string               `json:"from,omitempty"`
+	ReplyToken  string               `json:"replyToken,omitempty"`
+	Value       string               `json:"value"`
+	ValidatedAt string               `json:"validatedAt"`
+	CreatedAt   time.Time            `json:"createdAt"`
+	Error       *acme.Error          `json:"error"` // TODO(hs): a bit dangerous; should become db-specific type
+	Retry       *acme.ChallengeRetry `json:"retry,omitempty"`
 }
 
 func (dbc *dbChallenge) clone() *dbChallenge {
@@ -82,8 +85,11 @@ func (db *DB) GetChallenge(ctx context.Context, id, authzID string) (*acme.Chall
 		Value:       dbch.Value,
 		Status:      dbch.Status,
 		Token:       dbch.Token,
+		From:        dbch.From,
+		ReplyToken:  dbch.ReplyToken,
 		Error:       dbch.Error,
 		ValidatedAt: dbch.ValidatedAt,
+		Retry:       dbch.Retry,
 	}
 	return ch, nil
 }
@@ -101,6 +107,9 @@ func (db *DB) UpdateChallenge(ctx context.Context, ch *acme.Challenge) error {
 	nu.Status = ch.Status
 	nu.Error = ch.Error
 	nu.ValidatedAt = ch.ValidatedAt
+	nu.Retry = ch.Retry
+	nu.From = ch.From
+	nu.ReplyToken = ch.ReplyToken
 
 	return db.save(ctx, old.ID, nu, old, "challenge", challengeTable)
 }
@@ -0,0 +1,89 @@
+package nosql
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/nosql"
+)
+
+// dbChallengeLock is the lock of a challenge being validated. A lock without
+// token has been released.
+type dbChallengeLock struct {
+	Token     string    `json:"token,omitempty"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// getChallengeLock returns the lock of a challenge and its raw value, the
+// returned lock is nil if the challenge has never been locked.
+func (db *DB) getChallengeLock(id string) (*dbChallengeLock, []byte, error) {
+	b, err := db.db.Get(challengeLockTable, []byte(id))
+	switch {
+	case nosql.IsErrNotFound(err):
+		return nil, nil, nil
+	case err != nil:
+		return nil, nil, errors.Wrapf(err, "error loading acme challenge lock %s", id)
+	}
+	l := new(dbChallengeLock)
+	if err := json.Unmarshal(b, l); err != nil {
+		return nil, nil, errors.Wrapf(err, "error unmarshaling challenge lock key '%s' into dbChallengeLock", id)
+	}
+	return l, b, nil
+}
+
+// LockChallenge locks the challenge with the given id for the given time using
+// a compare-and-swap, so only one CA replica can hold the lock.
+// Implements the acme.ChallengeLocker interface.
+func (db *DB) LockChallenge(_ context.Context, id string, ttl time.Duration) (string, bool, error) {
+	now := clock.Now()
+	l, old, err := db.getChallengeLock(id)
+	if err != nil {
+		return "", false, err
+	}
+	if l != nil && l.Token != "" && now.Before(l.ExpiresAt) {
+		return "", false, nil
+	}
+
+	token, err := randID()
+	if err != nil {
+		return "", false, err
+	}
+	nu, err := json.Marshal(&dbChallengeLock{
+		Token:     token,
+		ExpiresAt: now.Add(ttl),
+	})
+	if err != nil {
+		return "", false, errors.Wrapf(err, "error marshaling acme challenge lock %s", id)
+	}
+	_, swapped, err := db.db.CmpAndSwap(challengeLockTable, []byte(id), old, nu)
+	switch {
+	case err != nil:
+		return "", false, errors.Wrapf(err, "error saving acme challenge lock %s", id)
+	case !swapped:
+		return "", false, nil
+	default:
+		return token, true, nil
+	}
+}
+
+// UnlockChallenge releases the lock of a challenge if it's still held with the
+// given token. Implements the acme.ChallengeLocker interface.
+func (db *DB) UnlockChallenge(_ context.Context, id, token string) error {
+	l, old, err := db.getChallengeLock(id)
+	if err != nil {
+		return err
+	}
+	if l == nil || l.Token != token {
+		return nil
+	}
+	nu, err := json.Marshal(&dbChallengeLock{})
+	if err != nil {
+		return errors.Wrapf(err, "error marshaling acme challenge lock %s", id)
+	}
+	if _, _, err := db.db.CmpAndSwap(challengeLockTable, []byte(id), old, nu); err != nil {
+		return errors.Wrapf(err, "error saving acme challenge lock %s", id)
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+package nosql
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/nosql"
+	"github.com/smallstep/nosql/database"
+)
+
+func TestDB_LockChallenge(t *testing.T) {
+	chID := "chID"
+	now := clock.Now()
+	lock := func(t *testing.T, l *dbChallengeLock) []byte {
+		b, err := json.Marshal(l)
+		assert.FatalError(t, err)
+		return b
+	}
+
+	type test struct {
+		db   nosql.DB
+		want bool
+		err  error
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/db.Get-error": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return nil, errors.New("force")
+					},
+				},
+				err: errors.New("error loading acme challenge lock chID: force"),
+			}
+		},
+		"fail/db.CmpAndSwap-error": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return nil, database.ErrNotFound
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						return nil, false, errors.New("force")
+					},
+				},
+				err: errors.New("error saving acme challenge lock chID: force"),
+			}
+		},
+		"ok/locked": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return lock(t, &dbChallengeLock{Token: "other", ExpiresAt: now.Add(time.Minute)}), nil
+					},
+				},
+				want: false,
+			}
+		},
+		"ok/locked-concurrently": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return nil, database.ErrNotFound
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						return lock(t, &dbChallengeLock{Token: "other", ExpiresAt: now.Add(time.Minute)}), false, nil
+					},
+				},
+				want: false,
+			}
+		},
+		"ok/new": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						assert.Equals(t, bucket, challengeLockTable)
+						assert.Equals(t, string(key), chID)
+						return nil, database.ErrNotFound
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						assert.Equals(t, bucket, challengeLockTable)
+						assert.Equals(t, string(key), chID)
+						assert.Nil(t, old)
+						l := new(dbChallengeLock)
+						assert.FatalError(t, json.Unmarshal(nu, l))
+						assert.NotEquals(t, l.Token, "")
+						assert.True(t, l.ExpiresAt.After(now))
+						return nu, true, nil
+					},
+				},
+				want: true,
+			}
+		},
+		"ok/expired": func(t *testing.T) test {
+			old := lock(t, &dbChallengeLock{Token: "other", ExpiresAt: now.Add(-time.Second)})
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return old, nil
+					},
+					MCmpAndSwap: func(bucket, key, o, nu []byte) ([]byte, bool, error) {
+						assert.Equals(t, o, old)
+						return nu, true, nil
+					},
+				},
+				want: true,
+			}
+		},
+		"ok/released": func(t *testing.T) test {
+			old := lock(t, &dbChallengeLock{})
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return old, nil
+					},
+					MCmpAndSwap: func(bucket, key, o, nu []byte) ([]byte, bool, error) {
+						assert.Equals(t, o, old)
+						return nu, true, nil
+					},
+				},
+				want: true,
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			d := DB{db: tc.db}
+			token, ok, err := d.LockChallenge(context.Background(), chID, time.Minute)
+			if err != nil {
+				if assert.NotNil(t, tc.err) {
+					assert.HasPrefix(t, err.Error(), tc.err.Error())
+				}
+				return
+			}
+			if assert.Nil(t, tc.err) {
+				assert.Equals(t, ok, tc.want)
+				assert.Equals(t, token != "", tc.want)
+			}
+		})
+	}
+}
+
+func TestDB_UnlockChallenge(t *testing.T) {
+	chID := "chID"
+	lock, err := json.Marshal(&dbChallengeLock{Token: "token", ExpiresAt: clock.Now().Add(time.Minute)})
+	assert.FatalError(t, err)
+
+	type test struct {
+		db  nosql.DB
+		err error
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/db.Get-error": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return nil, errors.New("force")
+					},
+				},
+				err: errors.New("error loading acme challenge lock chID: force"),
+			}
+		},
+		"fail/db.CmpAndSwap-error": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return lock, nil
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						return nil, false, errors.New("force")
+					},
+				},
+				err: errors.New("error saving acme challenge lock chID: force"),
+			}
+		},
+		"ok/not-found": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return nil, database.ErrNotFound
+					},
+				},
+			}
+		},
+		"ok/other-token": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						b, err := json.Marshal(&dbChallengeLock{Token: "other", ExpiresAt: clock.Now().Add(time.Minute)})
+						assert.FatalError(t, err)
+						return b, nil
+					},
+				},
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						assert.Equals(t, bucket, challengeLockTable)
+						assert.Equals(t, string(key), chID)
+						return lock, nil
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						assert.Equals(t, bucket, challengeLockTable)
+						assert.Equals(t, old, lock)
+						l := new(dbChallengeLock)
+						assert.FatalError(t, json.Unmarshal(nu, l))
+						assert.Equals(t, l.Token, "")
+						return nu, true, nil
+					},
+				},
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			d := DB{db: tc.db}
+			if err := d.UnlockChallenge(context.Background(), chID, "token"); err != nil {
+				if assert.NotNil(t, tc.err) {
+					assert.HasPrefix(t, err.Error(), tc.err.Error())
+				}
+				return
+			}
+			assert.Nil(t, tc.err)
+		})
+	}
+}
@@ -62,6 +62,30 @@ func TestDB_getDBChallenge(t *testing.T) {
 				err: errors.New("error unmarshaling dbChallenge"),
 			}
 		},
+		"ok/email-reply": func(t *testing.T) test {
+			dbc := &dbChallenge{
+				ID:         chID,
+				AccountID:  "accountID",
+				Type:       "email-reply-00",
+				Status:     acme.StatusPending,
+				Token:      "token",
+				Value:      "jane@example.com",
+				CreatedAt:  clock.Now(),
+				From:       "acme@ca.example.com",
+				ReplyToken: "replyToken",
+				Error:      acme.NewErrorISE("The server experienced an internal error"),
+			}
+			b, err := json.Marshal(dbc)
+			assert.FatalError(t, err)
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return b, nil
+					},
+				},
+				dbc: dbc,
+			}
+		},
 		"ok": func(t *testing.T) test {
 			dbc := &dbChallenge{
 				ID:          chID,
@@ -265,6 +289,7 @@ func TestDB_GetChallenge(t *testing.T) {
 				CreatedAt:   clock.Now(),
 				ValidatedAt: "foobar",
 				Error:       acme.NewErrorISE("The server experienced an internal error"),
+				Retry:       &acme.ChallengeRetry{Attempts: 1, NextAttempt: clock.Now()},
 			}
 			b, err := json.Marshal(dbc)
 			assert.FatalError(t, err)
@@ -309,6 +334,9 @@ func TestDB_GetChallenge(t *testing.T) {
 				assert.Equals(t, ch.Value, tc.dbc.Value)
 				assert.Equals(t, ch.ValidatedAt, tc.dbc.ValidatedAt)
 				assert.Equals(t, ch.Error.Error(), tc.dbc.Error.Error())
+				assert.Equals(t, ch.Retry, tc.dbc.Retry)
+				assert.Equals(t, ch.From, tc.dbc.From)
+				assert.Equals(t, ch.ReplyToken, tc.dbc.ReplyToken)
 			}
 		})
 	}
@@ -400,6 +428,9 @@ func TestDB_UpdateChallenge(t *testing.T) {
 				Status:      acme.StatusValid,
 				ValidatedAt: "foobar",
 				Error:       acme.NewError(acme.ErrorMalformedType, "malformed"),
+				Retry:       &acme.ChallengeRetry{Attempts: 2},
+				From:        "acme@ca.example.com",
+				ReplyToken:  "replyToken",
 			}
 			return test{
 				ch: updCh,
@@ -429,6 +460,9 @@ func TestDB_UpdateChallenge(t *testing.T) {
 						assert.Equals(t, dbNew.Status, acme.StatusValid)
 						assert.Equals(t, dbNew.ValidatedAt, "foobar")
 						assert.Equals(t, dbNew.Error.Error(), acme.NewError(acme.ErrorMalformedType, "The request message was malformed").Error())
+						assert.Equals(t, dbNew.Retry, &acme.ChallengeRetry{Attempts: 2})
+						assert.Equals(t, dbNew.From, "acme@ca.example.com")
+						assert.Equals(t, dbNew.ReplyToken, "replyToken")
 						return nu, true, nil
 					},
 				},
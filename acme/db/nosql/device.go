@@ -0,0 +1,102 @@
+package nosql
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/smallstep/certificates/acme"
+	nosqlDB "github.com/smallstep/nosql"
+)
+
+type dbEnrolledDevice struct {
+	ID            string                  `json:"id"`
+	ProvisionerID string                  `json:"provisionerID"`
+	Type          acme.EnrolledDeviceType `json:"type"`
+	Value         string                  `json:"value"`
+	CreatedAt     time.Time               `json:"createdAt"`
+}
+
+func (dbdev *dbEnrolledDevice) toEnrolledDevice() *acme.EnrolledDevice {
+	return &acme.EnrolledDevice{
+		ID:            dbdev.ID,
+		ProvisionerID: dbdev.ProvisionerID,
+		Type:          dbdev.Type,
+		Value:         dbdev.Value,
+		CreatedAt:     dbdev.CreatedAt,
+	}
+}
+
+// enrolledDeviceKey returns the key of an enrolled device. The devices are
+// scoped to the provisioner they were enrolled in.
+func enrolledDeviceKey(provisionerID, id string) string {
+	return provisionerID + "." + id
+}
+
+// CreateEnrolledDevice stores a new enrolled device. The ID of the device is
+// derived from its type and value, so a device cannot be enrolled twice in the
+// same provisioner.
+func (db *DB) CreateEnrolledDevice(ctx context.Context, dev *acme.EnrolledDevice) error {
+	dev.ID = acme.EnrolledDeviceID(dev.Type, dev.Value)
+	dev.CreatedAt = clock.Now()
+
+	dbdev := &dbEnrolledDevice{
+		ID:            dev.ID,
+		ProvisionerID: dev.ProvisionerID,
+		Type:          dev.Type,
+		Value:         dev.Value,
+		CreatedAt:     dev.CreatedAt,
+	}
+	return db.save(ctx, enrolledDeviceKey(dev.ProvisionerID, dev.ID), dbdev, nil, "enrolled_device", enrolledDeviceTable)
+}
+
+// GetEnrolledDevice retrieves an enrolled device of a provisioner.
+func (db *DB) GetEnrolledDevice(_ context.Context, provisionerID, id string) (*acme.EnrolledDevice, error) {
+	data, err := db.db.Get(enrolledDeviceTable, []byte(enrolledDeviceKey(provisionerID, id)))
+	if err != nil {
+		if nosqlDB.IsErrNotFound(err) {
+			return nil, acme.ErrNotFound
+		}
+		return nil, errors.Wrapf(err, "error loading enrolled device %s", id)
+	}
+
+	dbdev := new(dbEnrolledDevice)
+	if err := json.Unmarshal(data, dbdev); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshaling enrolled device %s into dbEnrolledDevice", id)
+	}
+	return dbdev.toEnrolledDevice(), nil
+}
+
+// GetEnrolledDevices retrieves all the devices enrolled in a provisioner.
+func (db *DB) GetEnrolledDevices(_ context.Context, provisionerID string) ([]*acme.EnrolledDevice, error) {
+	entries, err := db.db.List(enrolledDeviceTable)
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing enrolled devices")
+	}
+
+	devices := []*acme.EnrolledDevice{}
+	for _, entry := range entries {
+		dbdev := new(dbEnrolledDevice)
+		if err := json.Unmarshal(entry.Value, dbdev); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshaling enrolled device key '%s' into dbEnrolledDevice", string(entry.Key))
+		}
+		if dbdev.ProvisionerID != provisionerID {
+			continue
+		}
+		devices = append(devices, dbdev.toEnrolledDevice())
+	}
+	return devices, nil
+}
+
+// DeleteEnrolledDevice removes an enrolled device of a provisioner.
+func (db *DB) DeleteEnrolledDevice(ctx context.Context, provisionerID, id string) error {
+	if _, err := db.GetEnrolledDevice(ctx, provisionerID, id); err != nil {
+		return err
+	}
+	if err := db.db.Del(enrolledDeviceTable, []byte(enrolledDeviceKey(provisionerID, id))); err != nil {
+		return errors.Wrapf(err, "error deleting enrolled device %s", id)
+	}
+	return nil
+}
@@ -0,0 +1,297 @@
+package nosql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/acme"
+	certdb "github.com/smallstep/certificates/db"
+	"github.com/smallstep/nosql"
+	nosqldb "github.com/smallstep/nosql/database"
+)
+
+func TestDB_CreateEnrolledDevice(t *testing.T) {
+	id := acme.EnrolledDeviceID(acme.EnrolledDeviceSerialNumber, "1234")
+	type test struct {
+		db  nosql.DB
+		err error
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/cmpAndSwap-error": func(t *testing.T) test {
+			return test{
+				db: &certdb.MockNoSQLDB{
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						return nil, false, errors.New("force")
+					},
+				},
+				err: errors.New("error saving acme enrolled_device: force"),
+			}
+		},
+		"fail/already-enrolled": func(t *testing.T) test {
+			return test{
+				db: &certdb.MockNoSQLDB{
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						return []byte("foo"), false, nil
+					},
+				},
+				err: errors.New("error saving acme enrolled_device; changed since last read"),
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				db: &certdb.MockNoSQLDB{
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						assert.Equals(t, bucket, enrolledDeviceTable)
+						assert.Equals(t, string(key), "provID."+id)
+						assert.Nil(t, old)
+
+						dbdev := new(dbEnrolledDevice)
+						assert.FatalError(t, json.Unmarshal(nu, dbdev))
+						assert.Equals(t, dbdev.ID, id)
+						assert.Equals(t, dbdev.ProvisionerID, "provID")
+						assert.Equals(t, dbdev.Type, acme.EnrolledDeviceSerialNumber)
+						assert.Equals(t, dbdev.Value, "1234")
+						assert.False(t, dbdev.CreatedAt.IsZero())
+						return nu, true, nil
+					},
+				},
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			d := DB{db: tc.db}
+			dev := &acme.EnrolledDevice{
+				ProvisionerID: "provID",
+				Type:          acme.EnrolledDeviceSerialNumber,
+				Value:         "1234",
+			}
+			err := d.CreateEnrolledDevice(context.Background(), dev)
+			if tc.err != nil {
+				if assert.NotNil(t, err) {
+					assert.HasPrefix(t, err.Error(), tc.err.Error())
+				}
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, dev.ID, id)
+			assert.False(t, dev.CreatedAt.IsZero())
+		})
+	}
+}
+
+func TestDB_GetEnrolledDevice(t *testing.T) {
+	dbdev := &dbEnrolledDevice{
+		ID:            "devID",
+		ProvisionerID: "provID",
+		Type:          acme.EnrolledDeviceEK,
+		Value:         "sha256:AAAA",
+		CreatedAt:     clock.Now(),
+	}
+	b, err := json.Marshal(dbdev)
+	assert.FatalError(t, err)
+
+	type test struct {
+		db  nosql.DB
+		err error
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/not-found": func(t *testing.T) test {
+			return test{
+				db: &certdb.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return nil, nosqldb.ErrNotFound
+					},
+				},
+				err: acme.ErrNotFound,
+			}
+		},
+		"fail/db.Get-error": func(t *testing.T) test {
+			return test{
+				db: &certdb.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return nil, errors.New("force")
+					},
+				},
+				err: errors.New("error loading enrolled device devID: force"),
+			}
+		},
+		"fail/unmarshal-error": func(t *testing.T) test {
+			return test{
+				db: &certdb.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return []byte("foo"), nil
+					},
+				},
+				err: errors.New("error unmarshaling enrolled device devID into dbEnrolledDevice"),
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				db: &certdb.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						assert.Equals(t, bucket, enrolledDeviceTable)
+						assert.Equals(t, string(key), "provID.devID")
+						return b, nil
+					},
+				},
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			d := DB{db: tc.db}
+			dev, err := d.GetEnrolledDevice(context.Background(), "provID", "devID")
+			if tc.err != nil {
+				if assert.NotNil(t, err) {
+					assert.HasPrefix(t, err.Error(), tc.err.Error())
+				}
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, dev.ID, dbdev.ID)
+			assert.Equals(t, dev.ProvisionerID, dbdev.ProvisionerID)
+			assert.Equals(t, dev.Type, dbdev.Type)
+			assert.Equals(t, dev.Value, dbdev.Value)
+			assert.Equals(t, dev.CreatedAt, dbdev.CreatedAt)
+		})
+	}
+}
+
+func TestDB_GetEnrolledDevices(t *testing.T) {
+	newEntry := func(t *testing.T, provisionerID, id string) *nosqldb.Entry {
+		b, err := json.Marshal(&dbEnrolledDevice{ID: id, ProvisionerID: provisionerID})
+		assert.FatalError(t, err)
+		return &nosqldb.Entry{Bucket: enrolledDeviceTable, Key: []byte(provisionerID + "." + id), Value: b}
+	}
+
+	type test struct {
+		db   nosql.DB
+		want []string
+		err  error
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/db.List-error": func(t *testing.T) test {
+			return test{
+				db: &certdb.MockNoSQLDB{
+					MList: func(bucket []byte) ([]*nosqldb.Entry, error) {
+						return nil, errors.New("force")
+					},
+				},
+				err: errors.New("error listing enrolled devices: force"),
+			}
+		},
+		"fail/unmarshal-error": func(t *testing.T) test {
+			return test{
+				db: &certdb.MockNoSQLDB{
+					MList: func(bucket []byte) ([]*nosqldb.Entry, error) {
+						return []*nosqldb.Entry{{Key: []byte("provID.foo"), Value: []byte("foo")}}, nil
+					},
+				},
+				err: errors.New("error unmarshaling enrolled device key 'provID.foo' into dbEnrolledDevice"),
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				db: &certdb.MockNoSQLDB{
+					MList: func(bucket []byte) ([]*nosqldb.Entry, error) {
+						assert.Equals(t, bucket, enrolledDeviceTable)
+						return []*nosqldb.Entry{
+							newEntry(t, "provID", "dev1"),
+							newEntry(t, "otherProvID", "dev2"),
+							newEntry(t, "provID", "dev3"),
+						}, nil
+					},
+				},
+				want: []string{"dev1", "dev3"},
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			d := DB{db: tc.db}
+			devices, err := d.GetEnrolledDevices(context.Background(), "provID")
+			if tc.err != nil {
+				if assert.NotNil(t, err) {
+					assert.HasPrefix(t, err.Error(), tc.err.Error())
+				}
+				return
+			}
+			assert.FatalError(t, err)
+			ids := make([]string, len(devices))
+			for i, dev := range devices {
+				ids[i] = dev.ID
+			}
+			assert.Equals(t, ids, tc.want)
+		})
+	}
+}
+
+func TestDB_DeleteEnrolledDevice(t *testing.T) {
+	b, err := json.Marshal(&dbEnrolledDevice{ID: "devID", ProvisionerID: "provID"})
+	assert.FatalError(t, err)
+
+	type test struct {
+		db  nosql.DB
+		err error
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/not-found": func(t *testing.T) test {
+			return test{
+				db: &certdb.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return nil, nosqldb.ErrNotFound
+					},
+				},
+				err: acme.ErrNotFound,
+			}
+		},
+		"fail/db.Del-error": func(t *testing.T) test {
+			return test{
+				db: &certdb.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return b, nil
+					},
+					MDel: func(bucket, key []byte) error {
+						return errors.New("force")
+					},
+				},
+				err: errors.New("error deleting enrolled device devID: force"),
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				db: &certdb.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return b, nil
+					},
+					MDel: func(bucket, key []byte) error {
+						assert.Equals(t, bucket, enrolledDeviceTable)
+						assert.Equals(t, string(key), "provID.devID")
+						return nil
+					},
+				},
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			d := DB{db: tc.db}
+			err := d.DeleteEnrolledDevice(context.Background(), "provID", "devID")
+			if tc.err != nil {
+				if assert.NotNil(t, err) {
+					assert.HasPrefix(t, err.Error(), tc.err.Error())
+				}
+				return
+			}
+			assert.FatalError(t, err)
+		})
+	}
+}
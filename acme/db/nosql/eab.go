@@ -20,13 +20,38 @@ var externalAccountKeyMutex sync.RWMutex
 var referencesByProvisionerIndexMutex sync.Mutex
 
 type dbExternalAccountKey struct {
-	ID            string    `json:"id"`
-	ProvisionerID string    `json:"provisionerID"`
-	Reference     string    `json:"reference"`
-	AccountID     string    `json:"accountID,omitempty"`
-	HmacKey       []byte    `json:"key"`
-	CreatedAt     time.Time `json:"createdAt"`
-	BoundAt       time.Time `json:"boundAt"`
+	ID            string                       `json:"id"`
+	ProvisionerID string                       `json:"provisionerID"`
+	Reference     string                       `json:"reference"`
+	AccountID     string                       `json:"accountID,omitempty"`
+	HmacKey       []byte                       `json:"key"`
+	CreatedAt     time.Time                    `json:"createdAt"`
+	BoundAt       time.Time                    `json:"boundAt"`
+	ExpiresAt     time.Time                    `json:"expiresAt,omitempty"`
+	RevokedAt     time.Time                    `json:"revokedAt,omitempty"`
+	Policy        *acme.Policy                 `json:"policy,omitempty"`
+	Stats         acme.ExternalAccountKeyStats `json:"stats"`
+}
+
+func (dbeak *dbExternalAccountKey) clone() *dbExternalAccountKey {
+	nu := *dbeak
+	return &nu
+}
+
+func (dbeak *dbExternalAccountKey) toExternalAccountKey() *acme.ExternalAccountKey {
+	return &acme.ExternalAccountKey{
+		ID:            dbeak.ID,
+		ProvisionerID: dbeak.ProvisionerID,
+		Reference:     dbeak.Reference,
+		AccountID:     dbeak.AccountID,
+		HmacKey:       dbeak.HmacKey,
+		CreatedAt:     dbeak.CreatedAt,
+		BoundAt:       dbeak.BoundAt,
+		ExpiresAt:     dbeak.ExpiresAt,
+		RevokedAt:     dbeak.RevokedAt,
+		Policy:        dbeak.Policy,
+		Stats:         dbeak.Stats,
+	}
 }
 
 type dbExternalAccountKeyReference struct {
@@ -34,6 +59,11 @@ type dbExternalAccountKeyReference struct {
 	ExternalAccountKeyID string `json:"externalAccountKeyID"`
 }
 
+type dbExternalAccountKeyAccount struct {
+	AccountID            string `json:"accountID"`
+	ExternalAccountKeyID string `json:"externalAccountKeyID"`
+}
+
 // getDBExternalAccountKey retrieves and unmarshals dbExternalAccountKey.
 func (db *DB) getDBExternalAccountKey(_ context.Context, id string) (*dbExternalAccountKey, error) {
 	data, err := db.db.Get(externalAccountKeyTable, []byte(id))
@@ -94,15 +124,7 @@ func (db *DB) CreateExternalAccountKey(ctx context.Context, provisionerID, refer
 		}
 	}
 
-	return &acme.ExternalAccountKey{
-		ID:            dbeak.ID,
-		ProvisionerID: dbeak.ProvisionerID,
-		Reference:     dbeak.Reference,
-		AccountID:     dbeak.AccountID,
-		HmacKey:       dbeak.HmacKey,
-		CreatedAt:     dbeak.CreatedAt,
-		BoundAt:       dbeak.BoundAt,
-	}, nil
+	return dbeak.toExternalAccountKey(), nil
 }
 
 // GetExternalAccountKey retrieves an External Account Binding key by KeyID
@@ -119,15 +141,7 @@ func (db *DB) GetExternalAccountKey(ctx context.Context, provisionerID, keyID st
 		return nil, acme.NewError(acme.ErrorUnauthorizedType, "provisioner does not match provisioner for which the EAB key was created")
 	}
 
-	return &acme.ExternalAccountKey{
-		ID:            dbeak.ID,
-		ProvisionerID: dbeak.ProvisionerID,
-		Reference:     dbeak.Reference,
-		AccountID:     dbeak.AccountID,
-		HmacKey:       dbeak.HmacKey,
-		CreatedAt:     dbeak.CreatedAt,
-		BoundAt:       dbeak.BoundAt,
-	}, nil
+	return dbeak.toExternalAccountKey(), nil
 }
 
 func (db *DB) DeleteExternalAccountKey(ctx context.Context, provisionerID, keyID string) error {
@@ -148,6 +162,11 @@ func (db *DB) DeleteExternalAccountKey(ctx context.Context, provisionerID, keyID
 			return errors.Wrapf(err, "error deleting ACME EAB Key reference with Key ID %s and reference %s", keyID, dbeak.Reference)
 		}
 	}
+	if dbeak.AccountID != "" {
+		if err := db.db.Del(externalAccountKeyIDsByAccountIDTable, []byte(referenceKey(provisionerID, dbeak.AccountID))); err != nil {
+			return errors.Wrapf(err, "error deleting ACME EAB Key account with Key ID %s and account %s", keyID, dbeak.AccountID)
+		}
+	}
 	if err := db.db.Del(externalAccountKeyTable, []byte(keyID)); err != nil {
 		return errors.Wrapf(err, "error deleting ACME EAB Key with Key ID %s", keyID)
 	}
@@ -167,17 +186,9 @@ func (db *DB) GetExternalAccountKeys(ctx context.Context, provisionerID, cursor
 
 	// cursor and limit are ignored in open source, at least for now.
 
-	var eakIDs []string
-	r, err := db.db.Get(externalAccountKeyIDsByProvisionerIDTable, []byte(provisionerID))
+	eakIDs, err := db.getEAKIDs(ctx, provisionerID)
 	if err != nil {
-		if !nosqlDB.IsErrNotFound(err) {
-			return nil, "", errors.Wrapf(err, "error loading ACME EAB Key IDs for provisioner %s", provisionerID)
-		}
-		// it may happen that no record is found; we'll continue with an empty slice
-	} else {
-		if err := json.Unmarshal(r, &eakIDs); err != nil {
-			return nil, "", errors.Wrapf(err, "error unmarshaling ACME EAB Key IDs for provisioner %s", provisionerID)
-		}
+		return nil, "", err
 	}
 
 	keys := []*acme.ExternalAccountKey{}
@@ -191,15 +202,7 @@ func (db *DB) GetExternalAccountKeys(ctx context.Context, provisionerID, cursor
 				return nil, "", errors.Wrapf(err, "error retrieving ACME EAB Key for provisioner %s and keyID %s", provisionerID, eakID)
 			}
 		}
-		keys = append(keys, &acme.ExternalAccountKey{
-			ID:            eak.ID,
-			HmacKey:       eak.HmacKey,
-			ProvisionerID: eak.ProvisionerID,
-			Reference:     eak.Reference,
-			AccountID:     eak.AccountID,
-			CreatedAt:     eak.CreatedAt,
-			BoundAt:       eak.BoundAt,
-		})
+		keys = append(keys, eak.toExternalAccountKey())
 	}
 
 	return keys, "", nil
@@ -229,11 +232,97 @@ func (db *DB) GetExternalAccountKeyByReference(ctx context.Context, provisionerI
 	return db.GetExternalAccountKey(ctx, provisionerID, dbExternalAccountKeyReference.ExternalAccountKeyID)
 }
 
-func (db *DB) GetExternalAccountKeyByAccountID(context.Context, string, string) (*acme.ExternalAccountKey, error) {
+// GetExternalAccountKeyByAccountID retrieves the External Account Binding key
+// bound to the given account. It returns nil if the account was not created
+// using an External Account Binding key.
+func (db *DB) GetExternalAccountKeyByAccountID(ctx context.Context, provisionerID, accountID string) (*acme.ExternalAccountKey, error) {
+	externalAccountKeyMutex.RLock()
+	defer externalAccountKeyMutex.RUnlock()
+
+	if accountID == "" {
+		//nolint:nilnil // legacy
+		return nil, nil
+	}
+
+	k, err := db.db.Get(externalAccountKeyIDsByAccountIDTable, []byte(referenceKey(provisionerID, accountID)))
+	switch {
+	case nosqlDB.IsErrNotFound(err):
+		// The keys bound before the index was added are looked up in the
+		// keys of the provisioner, and added to the index.
+		dbeak, err := db.findExternalAccountKeyByAccountID(ctx, provisionerID, accountID)
+		if err != nil || dbeak == nil {
+			return nil, err
+		}
+		if err := db.setEAKAccountID(provisionerID, accountID, dbeak.ID); err != nil {
+			return nil, err
+		}
+		return dbeak.toExternalAccountKey(), nil
+	case err != nil:
+		return nil, errors.Wrapf(err, "error loading ACME EAB key for account %s", accountID)
+	}
+
+	var ref dbExternalAccountKeyAccount
+	if err := json.Unmarshal(k, &ref); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshaling ACME EAB key for account %s", accountID)
+	}
+	dbeak, err := db.getDBExternalAccountKey(ctx, ref.ExternalAccountKeyID)
+	if err != nil {
+		if errors.Is(err, acme.ErrNotFound) {
+			//nolint:nilnil // legacy
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "error retrieving ACME EAB Key for provisioner %s and keyID %s", provisionerID, ref.ExternalAccountKeyID)
+	}
+	if dbeak.ProvisionerID != provisionerID || dbeak.AccountID != accountID {
+		//nolint:nilnil // legacy
+		return nil, nil
+	}
+	return dbeak.toExternalAccountKey(), nil
+}
+
+// findExternalAccountKeyByAccountID looks for the key bound to the given
+// account in all the keys of the provisioner.
+func (db *DB) findExternalAccountKeyByAccountID(ctx context.Context, provisionerID, accountID string) (*dbExternalAccountKey, error) {
+	eakIDs, err := db.getEAKIDs(ctx, provisionerID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, eakID := range eakIDs {
+		if eakID == "" {
+			continue // shouldn't happen; just in case
+		}
+		dbeak, err := db.getDBExternalAccountKey(ctx, eakID)
+		if err != nil {
+			if errors.Is(err, acme.ErrNotFound) {
+				continue
+			}
+			return nil, errors.Wrapf(err, "error retrieving ACME EAB Key for provisioner %s and keyID %s", provisionerID, eakID)
+		}
+		if dbeak.AccountID == accountID {
+			return dbeak, nil
+		}
+	}
+
 	//nolint:nilnil // legacy
 	return nil, nil
 }
 
+// setEAKAccountID adds the key bound to an account to the account index.
+func (db *DB) setEAKAccountID(provisionerID, accountID, eakID string) error {
+	b, err := json.Marshal(dbExternalAccountKeyAccount{
+		AccountID:            accountID,
+		ExternalAccountKeyID: eakID,
+	})
+	if err != nil {
+		return errors.Wrap(err, "error marshaling ACME EAB key account")
+	}
+	if err := db.db.Set(externalAccountKeyIDsByAccountIDTable, []byte(referenceKey(provisionerID, accountID)), b); err != nil {
+		return errors.Wrapf(err, "error saving ACME EAB key for account %s", accountID)
+	}
+	return nil
+}
+
 func (db *DB) UpdateExternalAccountKey(ctx context.Context, provisionerID string, eak *acme.ExternalAccountKey) error {
 	externalAccountKeyMutex.Lock()
 	defer externalAccountKeyMutex.Unlock()
@@ -255,6 +344,8 @@ func (db *DB) UpdateExternalAccountKey(ctx context.Context, provisionerID string
 		return errors.New("cannot change reference for an existing ACME EAB Key")
 	}
 
+	// The expiration and revocation times are kept if they are not set, and
+	// the statistics can only be modified using AddExternalAccountKeyStats.
 	nu := dbExternalAccountKey{
 		ID:            eak.ID,
 		ProvisionerID: eak.ProvisionerID,
@@ -263,11 +354,79 @@ func (db *DB) UpdateExternalAccountKey(ctx context.Context, provisionerID string
 		HmacKey:       eak.HmacKey,
 		CreatedAt:     eak.CreatedAt,
 		BoundAt:       eak.BoundAt,
+		ExpiresAt:     old.ExpiresAt,
+		RevokedAt:     old.RevokedAt,
+		Policy:        eak.Policy,
+		Stats:         old.Stats,
+	}
+	if !eak.ExpiresAt.IsZero() {
+		nu.ExpiresAt = eak.ExpiresAt
+	}
+	if !eak.RevokedAt.IsZero() {
+		nu.RevokedAt = eak.RevokedAt
+	}
+
+	if err := db.save(ctx, nu.ID, nu, old, "external_account_key", externalAccountKeyTable); err != nil {
+		return err
+	}
+
+	// Keep the index of the account bound to the key.
+	if old.AccountID != nu.AccountID {
+		if old.AccountID != "" {
+			if err := db.db.Del(externalAccountKeyIDsByAccountIDTable, []byte(referenceKey(provisionerID, old.AccountID))); err != nil {
+				return errors.Wrapf(err, "error deleting ACME EAB key for account %s", old.AccountID)
+			}
+		}
+		if nu.AccountID != "" {
+			return db.setEAKAccountID(provisionerID, nu.AccountID, nu.ID)
+		}
+	}
+	return nil
+}
+
+// AddExternalAccountKeyStats adds the orders and certificates in stats to the
+// statistics of an External Account Binding key.
+func (db *DB) AddExternalAccountKeyStats(ctx context.Context, provisionerID, keyID string, stats acme.ExternalAccountKeyStats) error {
+	externalAccountKeyMutex.Lock()
+	defer externalAccountKeyMutex.Unlock()
+
+	old, err := db.getDBExternalAccountKey(ctx, keyID)
+	if err != nil {
+		return err
+	}
+
+	if old.ProvisionerID != provisionerID {
+		return errors.New("provisioner does not match provisioner for which the EAB key was created")
+	}
+
+	nu := old.clone()
+	nu.Stats.Orders += stats.Orders
+	nu.Stats.Certificates += stats.Certificates
+	if stats.LastIssuedAt.After(nu.Stats.LastIssuedAt) {
+		nu.Stats.LastIssuedAt = stats.LastIssuedAt
 	}
 
 	return db.save(ctx, nu.ID, nu, old, "external_account_key", externalAccountKeyTable)
 }
 
+// getEAKIDs returns the IDs of the External Account Binding keys of a
+// provisioner.
+func (db *DB) getEAKIDs(_ context.Context, provisionerID string) ([]string, error) {
+	var eakIDs []string
+	r, err := db.db.Get(externalAccountKeyIDsByProvisionerIDTable, []byte(provisionerID))
+	if err != nil {
+		if !nosqlDB.IsErrNotFound(err) {
+			return nil, errors.Wrapf(err, "error loading ACME EAB Key IDs for provisioner %s", provisionerID)
+		}
+		// it may happen that no record is found; we'll continue with an empty slice
+	} else {
+		if err := json.Unmarshal(r, &eakIDs); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshaling ACME EAB Key IDs for provisioner %s", provisionerID)
+		}
+	}
+	return eakIDs, nil
+}
+
 func (db *DB) addEAKID(ctx context.Context, provisionerID, eakID string) error {
 	referencesByProvisionerIndexMutex.Lock()
 	defer referencesByProvisionerIndexMutex.Unlock()
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/pkg/errors"
@@ -1069,6 +1070,169 @@ func TestDB_CreateExternalAccountKey(t *testing.T) {
 	}
 }
 
+func TestDB_GetExternalAccountKeyByAccountID(t *testing.T) {
+	keyID := "keyID"
+	provID := "provID"
+	accID := "accID"
+	now := clock.Now()
+	dbeak := &dbExternalAccountKey{
+		ID:            keyID,
+		ProvisionerID: provID,
+		Reference:     "ref",
+		AccountID:     accID,
+		HmacKey:       []byte{1, 3, 3, 7},
+		CreatedAt:     now,
+		BoundAt:       now,
+	}
+	b, err := json.Marshal(dbeak)
+	assert.FatalError(t, err)
+	dbref := &dbExternalAccountKeyAccount{
+		AccountID:            accID,
+		ExternalAccountKeyID: keyID,
+	}
+	refB, err := json.Marshal(dbref)
+	assert.FatalError(t, err)
+	type test struct {
+		db  nosql.DB
+		eak *acme.ExternalAccountKey
+		err error
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"ok": func(t *testing.T) test {
+			return test{
+				db: &certdb.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						switch string(bucket) {
+						case string(externalAccountKeyIDsByAccountIDTable):
+							assert.Equals(t, string(key), provID+"."+accID)
+							return refB, nil
+						case string(externalAccountKeyTable):
+							assert.Equals(t, string(key), keyID)
+							return b, nil
+						default:
+							return nil, fmt.Errorf("unexpected bucket %s", bucket)
+						}
+					},
+				},
+				eak: dbeak.toExternalAccountKey(),
+			}
+		},
+		"ok/legacy": func(t *testing.T) test {
+			var saved bool
+			return test{
+				db: &certdb.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						switch string(bucket) {
+						case string(externalAccountKeyIDsByAccountIDTable):
+							if saved {
+								return refB, nil
+							}
+							return nil, nosqldb.ErrNotFound
+						case string(externalAccountKeyIDsByProvisionerIDTable):
+							assert.Equals(t, string(key), provID)
+							return json.Marshal([]string{"otherKeyID", keyID})
+						case string(externalAccountKeyTable):
+							if string(key) == keyID {
+								return b, nil
+							}
+							return json.Marshal(&dbExternalAccountKey{ID: string(key), ProvisionerID: provID})
+						default:
+							return nil, fmt.Errorf("unexpected bucket %s", bucket)
+						}
+					},
+					MSet: func(bucket, key, value []byte) error {
+						assert.Equals(t, bucket, externalAccountKeyIDsByAccountIDTable)
+						assert.Equals(t, string(key), provID+"."+accID)
+						assert.Equals(t, value, refB)
+						saved = true
+						return nil
+					},
+				},
+				eak: dbeak.toExternalAccountKey(),
+			}
+		},
+		"ok/not-found": func(t *testing.T) test {
+			return test{
+				db: &certdb.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						switch string(bucket) {
+						case string(externalAccountKeyIDsByAccountIDTable), string(externalAccountKeyIDsByProvisionerIDTable):
+							return nil, nosqldb.ErrNotFound
+						default:
+							return nil, fmt.Errorf("unexpected bucket %s", bucket)
+						}
+					},
+				},
+			}
+		},
+		"ok/account-mismatch": func(t *testing.T) test {
+			return test{
+				db: &certdb.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						switch string(bucket) {
+						case string(externalAccountKeyIDsByAccountIDTable):
+							return refB, nil
+						case string(externalAccountKeyTable):
+							return json.Marshal(&dbExternalAccountKey{ID: keyID, ProvisionerID: provID, AccountID: "otherAccID"})
+						default:
+							return nil, fmt.Errorf("unexpected bucket %s", bucket)
+						}
+					},
+				},
+			}
+		},
+		"fail/db.Get-error": func(t *testing.T) test {
+			return test{
+				db: &certdb.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						assert.Equals(t, bucket, externalAccountKeyIDsByAccountIDTable)
+						return nil, errors.New("force")
+					},
+				},
+				err: errors.New("error loading ACME EAB key for account accID: force"),
+			}
+		},
+		"fail/db.Set-error": func(t *testing.T) test {
+			return test{
+				db: &certdb.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						switch string(bucket) {
+						case string(externalAccountKeyIDsByAccountIDTable):
+							return nil, nosqldb.ErrNotFound
+						case string(externalAccountKeyIDsByProvisionerIDTable):
+							return json.Marshal([]string{keyID})
+						case string(externalAccountKeyTable):
+							return b, nil
+						default:
+							return nil, fmt.Errorf("unexpected bucket %s", bucket)
+						}
+					},
+					MSet: func(bucket, key, value []byte) error {
+						return errors.New("force")
+					},
+				},
+				err: errors.New("error saving ACME EAB key for account accID: force"),
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			d := DB{db: tc.db}
+			eak, err := d.GetExternalAccountKeyByAccountID(context.Background(), provID, accID)
+			if err != nil {
+				if assert.NotNil(t, tc.err) {
+					assert.HasPrefix(t, err.Error(), tc.err.Error())
+				}
+				return
+			}
+			if assert.Nil(t, tc.err) {
+				assert.Equals(t, tc.eak, eak)
+			}
+		})
+	}
+}
+
 func TestDB_UpdateExternalAccountKey(t *testing.T) {
 	keyID := "keyID"
 	provID := "provID"
@@ -1085,9 +1249,10 @@ func TestDB_UpdateExternalAccountKey(t *testing.T) {
 	b, err := json.Marshal(dbeak)
 	assert.FatalError(t, err)
 	type test struct {
-		db  nosql.DB
-		eak *acme.ExternalAccountKey
-		err error
+		db    nosql.DB
+		eak   *acme.ExternalAccountKey
+		err   error
+		check func(t *testing.T)
 	}
 	var tests = map[string]func(t *testing.T) test{
 
@@ -1127,6 +1292,38 @@ func TestDB_UpdateExternalAccountKey(t *testing.T) {
 				},
 			}
 		},
+		"ok/bind": func(t *testing.T) test {
+			var indexed bool
+			return test{
+				eak: &acme.ExternalAccountKey{
+					ID:            keyID,
+					ProvisionerID: provID,
+					Reference:     ref,
+					AccountID:     "accID",
+					HmacKey:       []byte{1, 3, 3, 7},
+					CreatedAt:     now,
+				},
+				db: &certdb.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						assert.Equals(t, bucket, externalAccountKeyTable)
+						return b, nil
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						assert.Equals(t, bucket, externalAccountKeyTable)
+						return nu, true, nil
+					},
+					MSet: func(bucket, key, value []byte) error {
+						assert.Equals(t, bucket, externalAccountKeyIDsByAccountIDTable)
+						assert.Equals(t, string(key), provID+".accID")
+						indexed = true
+						return nil
+					},
+				},
+				check: func(t *testing.T) {
+					assert.True(t, indexed)
+				},
+			}
+		},
 		"fail/db.Get-error": func(t *testing.T) test {
 			return test{
 				eak: &acme.ExternalAccountKey{
@@ -1231,6 +1428,8 @@ func TestDB_UpdateExternalAccountKey(t *testing.T) {
 				if assert.NotNil(t, tc.err) {
 					assert.HasPrefix(t, err.Error(), tc.err.Error())
 				}
+			} else if tc.check != nil {
+				tc.check(t)
 			} else if assert.Nil(t, tc.err) {
 				assert.Equals(t, dbeak.ID, tc.eak.ID)
 				assert.Equals(t, dbeak.ProvisionerID, tc.eak.ProvisionerID)
@@ -1244,6 +1443,94 @@ func TestDB_UpdateExternalAccountKey(t *testing.T) {
 	}
 }
 
+func TestDB_AddExternalAccountKeyStats(t *testing.T) {
+	keyID := "keyID"
+	provID := "provID"
+	now := clock.Now()
+	dbeak := &dbExternalAccountKey{
+		ID:            keyID,
+		ProvisionerID: provID,
+		Reference:     "ref",
+		HmacKey:       []byte{1, 3, 3, 7},
+		CreatedAt:     now,
+		Stats: acme.ExternalAccountKeyStats{
+			Orders:       2,
+			Certificates: 1,
+			LastIssuedAt: now,
+		},
+	}
+	b, err := json.Marshal(dbeak)
+	assert.FatalError(t, err)
+	type test struct {
+		db    nosql.DB
+		stats acme.ExternalAccountKeyStats
+		err   error
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/db.Get-error": func(t *testing.T) test {
+			return test{
+				db: &certdb.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return nil, errors.New("force")
+					},
+				},
+				err: errors.New("error loading external account key keyID: force"),
+			}
+		},
+		"fail/provisioner-mismatch": func(t *testing.T) test {
+			return test{
+				db: &certdb.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						b, err := json.Marshal(&dbExternalAccountKey{ID: keyID, ProvisionerID: "aDifferentProvID"})
+						assert.FatalError(t, err)
+						return b, nil
+					},
+				},
+				err: errors.New("provisioner does not match provisioner for which the EAB key was created"),
+			}
+		},
+		"ok": func(t *testing.T) test {
+			lastIssuedAt := now.Add(time.Minute)
+			return test{
+				stats: acme.ExternalAccountKeyStats{Certificates: 1, LastIssuedAt: lastIssuedAt},
+				db: &certdb.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						assert.Equals(t, bucket, externalAccountKeyTable)
+						assert.Equals(t, string(key), keyID)
+						return b, nil
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						assert.Equals(t, bucket, externalAccountKeyTable)
+						assert.Equals(t, old, b)
+
+						dbNew := new(dbExternalAccountKey)
+						assert.FatalError(t, json.Unmarshal(nu, dbNew))
+						assert.Equals(t, 2, dbNew.Stats.Orders)
+						assert.Equals(t, 2, dbNew.Stats.Certificates)
+						assert.True(t, lastIssuedAt.Equal(dbNew.Stats.LastIssuedAt))
+						assert.Equals(t, dbeak.HmacKey, dbNew.HmacKey)
+						return nu, true, nil
+					},
+				},
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			d := DB{db: tc.db}
+			err := d.AddExternalAccountKeyStats(context.Background(), provID, keyID, tc.stats)
+			if tc.err != nil {
+				if assert.NotNil(t, err) {
+					assert.HasPrefix(t, err.Error(), tc.err.Error())
+				}
+				return
+			}
+			assert.FatalError(t, err)
+		})
+	}
+}
+
 func TestDB_addEAKID(t *testing.T) {
 	provID := "provID"
 	eakID := "eakID"
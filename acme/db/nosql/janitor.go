@@ -0,0 +1,205 @@
+package nosql
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/nosql"
+
+	"github.com/smallstep/certificates/acme"
+)
+
+// DeleteStaleResources deletes the orders, authorizations, challenges and
+// nonces that have expired according to the given options. Orders are
+// deleted first, and the authorizations of the orders that are kept are not
+// deleted, even if they have expired.
+//
+// Implements the acme.GarbageCollector interface.
+func (db *DB) DeleteStaleResources(ctx context.Context, opts acme.GarbageCollectionOptions) (*acme.GarbageCollectionStats, error) {
+	stats := new(acme.GarbageCollectionStats)
+	keepAuthzs, err := db.deleteStaleOrders(ctx, opts, stats)
+	if err != nil {
+		return stats, err
+	}
+	if err := db.deleteStaleAuthorizations(ctx, opts, keepAuthzs, stats); err != nil {
+		return stats, err
+	}
+	if err := db.deleteStaleNonces(opts, stats); err != nil {
+		return stats, err
+	}
+	return stats, nil
+}
+
+// deleteStaleOrders deletes the expired orders. The orders are removed from
+// the orders index of their accounts before deleting them, so the index never
+// contains deleted orders. It returns the IDs of the authorizations of the
+// orders that are kept.
+func (db *DB) deleteStaleOrders(ctx context.Context, opts acme.GarbageCollectionOptions, stats *acme.GarbageCollectionStats) (map[string]struct{}, error) {
+	entries, err := db.db.List(orderTable)
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing acme orders")
+	}
+
+	keepAuthzs := make(map[string]struct{})
+	staleOids := make(map[string][]string)
+	for _, entry := range entries {
+		o := new(dbOrder)
+		if err := json.Unmarshal(entry.Value, o); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshaling order key '%s' into dbOrder", string(entry.Key))
+		}
+		if isOrderStale(o, opts) {
+			staleOids[o.AccountID] = append(staleOids[o.AccountID], o.ID)
+			continue
+		}
+		for _, azID := range o.AuthorizationIDs {
+			keepAuthzs[azID] = struct{}{}
+		}
+	}
+
+	for accID, oids := range staleOids {
+		if err := db.removeOrderIDs(ctx, accID, oids); err != nil {
+			return nil, err
+		}
+		for _, oid := range oids {
+			if err := db.db.Del(orderTable, []byte(oid)); err != nil {
+				return nil, errors.Wrapf(err, "error deleting acme order %s", oid)
+			}
+			stats.Orders++
+		}
+	}
+	return keepAuthzs, nil
+}
+
+// isOrderStale returns true if the order has expired more than the order TTL
+// of its provisioner ago. Auto-renewal orders expire at their end date.
+func isOrderStale(o *dbOrder, opts acme.GarbageCollectionOptions) bool {
+	ttl, ok := opts.OrderTTL(o.ProvisionerID)
+	if !ok {
+		return false
+	}
+	expiresAt := o.ExpiresAt
+	if o.AutoRenewal != nil && o.AutoRenewal.EndDate.After(expiresAt) {
+		expiresAt = o.AutoRenewal.EndDate
+	}
+	return opts.Now.After(expiresAt.Add(ttl))
+}
+
+// removeOrderIDs removes the given orders from the orders index of an
+// account.
+func (db *DB) removeOrderIDs(ctx context.Context, accID string, oids []string) error {
+	b, err := db.db.Get(ordersByAccountIDTable, []byte(accID))
+	switch {
+	case nosql.IsErrNotFound(err):
+		return nil
+	case err != nil:
+		return errors.Wrapf(err, "error loading orderIDs for account %s", accID)
+	}
+
+	var oldOids []string
+	if err := json.Unmarshal(b, &oldOids); err != nil {
+		return errors.Wrapf(err, "error unmarshaling orderIDs for account %s", accID)
+	}
+	remove := make(map[string]struct{}, len(oids))
+	for _, oid := range oids {
+		remove[oid] = struct{}{}
+	}
+	newOids := make([]string, 0, len(oldOids))
+	for _, oid := range oldOids {
+		if _, ok := remove[oid]; !ok {
+			newOids = append(newOids, oid)
+		}
+	}
+
+	var _new interface{} = newOids
+	switch {
+	case len(newOids) == len(oldOids):
+		return nil
+	case len(newOids) == 0:
+		_new = nil
+	}
+	if err := db.save(ctx, accID, _new, oldOids, "orderIDsByAccountID", ordersByAccountIDTable); err != nil {
+		return errors.Wrapf(err, "error saving orderIDs index for account %s", accID)
+	}
+	return nil
+}
+
+// deleteStaleAuthorizations deletes the expired authorizations and their
+// challenges, except the ones in keep. The authorization TTL is the one of
+// the provisioner of the account.
+func (db *DB) deleteStaleAuthorizations(ctx context.Context, opts acme.GarbageCollectionOptions, keep map[string]struct{}, stats *acme.GarbageCollectionStats) error {
+	entries, err := db.db.List(authzTable)
+	if err != nil {
+		return errors.Wrap(err, "error listing acme authzs")
+	}
+
+	provisionerIDs := make(map[string]string)
+	for _, entry := range entries {
+		az := new(dbAuthz)
+		if err := json.Unmarshal(entry.Value, az); err != nil {
+			return errors.Wrapf(err, "error unmarshaling authz key '%s' into dbAuthz", string(entry.Key))
+		}
+		if _, ok := keep[az.ID]; ok {
+			continue
+		}
+
+		provID, ok := provisionerIDs[az.AccountID]
+		if !ok {
+			// Accounts created before the provisioner ID was stored are
+			// skipped, as well as the missing ones.
+			if acc, err := db.getDBAccount(ctx, az.AccountID); err == nil {
+				provID = acc.ProvisionerID
+			} else if !acme.IsErrNotFound(err) {
+				return err
+			}
+			provisionerIDs[az.AccountID] = provID
+		}
+		ttl, ok := opts.AuthorizationTTL(provID)
+		if !ok || !opts.Now.After(az.ExpiresAt.Add(ttl)) {
+			continue
+		}
+
+		for _, chID := range az.ChallengeIDs {
+			if err := db.db.Del(challengeTable, []byte(chID)); err != nil {
+				return errors.Wrapf(err, "error deleting acme challenge %s", chID)
+			}
+			if err := db.db.Del(challengeLockTable, []byte(chID)); err != nil && !nosql.IsErrNotFound(err) {
+				return errors.Wrapf(err, "error deleting acme challenge lock %s", chID)
+			}
+			stats.Challenges++
+		}
+		if err := db.db.Del(authzTable, entry.Key); err != nil {
+			return errors.Wrapf(err, "error deleting acme authz %s", az.ID)
+		}
+		stats.Authorizations++
+	}
+	return nil
+}
+
+// deleteStaleNonces deletes the nonces created more than the nonce TTL of
+// their provisioner ago.
+func (db *DB) deleteStaleNonces(opts acme.GarbageCollectionOptions, stats *acme.GarbageCollectionStats) error {
+	if opts.NonceTTL == nil {
+		return nil
+	}
+
+	entries, err := db.db.List(nonceTable)
+	if err != nil {
+		return errors.Wrap(err, "error listing acme nonces")
+	}
+	for _, entry := range entries {
+		n := new(dbNonce)
+		if err := json.Unmarshal(entry.Value, n); err != nil {
+			return errors.Wrapf(err, "error unmarshaling nonce key '%s' into dbNonce", string(entry.Key))
+		}
+		ttl, ok := opts.NonceTTL(n.ProvisionerID)
+		if !ok || ttl <= 0 || !opts.Now.After(n.CreatedAt.Add(ttl)) {
+			continue
+		}
+		if err := db.db.Del(nonceTable, entry.Key); err != nil {
+			return errors.Wrapf(err, "error deleting acme nonce %s", n.ID)
+		}
+		stats.Nonces++
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package nosql
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/nosql"
+	"github.com/smallstep/nosql/database"
+)
+
+func TestDB_DeleteStaleResources(t *testing.T) {
+	now := clock.Now()
+	opts := acme.GarbageCollectionOptions{
+		Now: now,
+		OrderTTL: func(provisionerID string) (time.Duration, bool) {
+			return time.Hour, provisionerID == "p1"
+		},
+		AuthorizationTTL: func(provisionerID string) (time.Duration, bool) {
+			return time.Hour, provisionerID == "p1"
+		},
+		NonceTTL: func(provisionerID string) (time.Duration, bool) {
+			if provisionerID == "p2" {
+				return time.Hour, true
+			}
+			return 24 * time.Hour, true
+		},
+	}
+
+	entry := func(t *testing.T, key string, v interface{}) *database.Entry {
+		b, err := json.Marshal(v)
+		assert.FatalError(t, err)
+		return &database.Entry{Key: []byte(key), Value: b}
+	}
+	orders := func(t *testing.T) []*database.Entry {
+		return []*database.Entry{
+			entry(t, "o1", &dbOrder{ID: "o1", AccountID: "acc1", ProvisionerID: "p1",
+				ExpiresAt: now.Add(-2 * time.Hour), AuthorizationIDs: []string{"a1"}}),
+			entry(t, "o2", &dbOrder{ID: "o2", AccountID: "acc1", ProvisionerID: "p1",
+				ExpiresAt: now.Add(-30 * time.Minute), AuthorizationIDs: []string{"a2"}}),
+			entry(t, "o3", &dbOrder{ID: "o3", AccountID: "acc2", ProvisionerID: "p2",
+				ExpiresAt: now.Add(-48 * time.Hour), AuthorizationIDs: []string{"a3"}}),
+			entry(t, "o4", &dbOrder{ID: "o4", AccountID: "acc1", ProvisionerID: "p1",
+				ExpiresAt: now.Add(-2 * time.Hour), AutoRenewal: &acme.AutoRenewal{EndDate: now.Add(time.Hour)}}),
+		}
+	}
+	authzs := func(t *testing.T) []*database.Entry {
+		return []*database.Entry{
+			entry(t, "a1", &dbAuthz{ID: "a1", AccountID: "acc1", ExpiresAt: now.Add(-2 * time.Hour),
+				ChallengeIDs: []string{"c1", "c2"}}),
+			entry(t, "a2", &dbAuthz{ID: "a2", AccountID: "acc1", ExpiresAt: now.Add(-2 * time.Hour),
+				ChallengeIDs: []string{"c3"}}),
+			entry(t, "a3", &dbAuthz{ID: "a3", AccountID: "acc2", ExpiresAt: now.Add(-48 * time.Hour),
+				ChallengeIDs: []string{"c4"}}),
+			entry(t, "a4", &dbAuthz{ID: "a4", AccountID: "acc3", ExpiresAt: now.Add(-48 * time.Hour),
+				ChallengeIDs: []string{"c5"}}),
+		}
+	}
+	nonces := func(t *testing.T) []*database.Entry {
+		return []*database.Entry{
+			entry(t, "n1", &dbNonce{ID: "n1", CreatedAt: now.Add(-25 * time.Hour)}),
+			entry(t, "n2", &dbNonce{ID: "n2", CreatedAt: now}),
+			entry(t, "n3", &dbNonce{ID: "n3", ProvisionerID: "p1", CreatedAt: now.Add(-2 * time.Hour)}),
+			entry(t, "n4", &dbNonce{ID: "n4", ProvisionerID: "p2", CreatedAt: now.Add(-2 * time.Hour)}),
+		}
+	}
+	list := func(t *testing.T) func(bucket []byte) ([]*database.Entry, error) {
+		return func(bucket []byte) ([]*database.Entry, error) {
+			switch string(bucket) {
+			case string(orderTable):
+				return orders(t), nil
+			case string(authzTable):
+				return authzs(t), nil
+			case string(nonceTable):
+				return nonces(t), nil
+			default:
+				return nil, errors.Errorf("unexpected bucket %s", string(bucket))
+			}
+		}
+	}
+	get := func(t *testing.T) func(bucket, key []byte) ([]byte, error) {
+		return func(bucket, key []byte) ([]byte, error) {
+			switch string(bucket) {
+			case string(ordersByAccountIDTable):
+				assert.Equals(t, string(key), "acc1")
+				return json.Marshal([]string{"o1", "o2", "o4"})
+			case string(accountTable):
+				switch string(key) {
+				case "acc1":
+					return json.Marshal(&dbAccount{ID: "acc1", ProvisionerID: "p1"})
+				case "acc2":
+					return json.Marshal(&dbAccount{ID: "acc2", ProvisionerID: "p2"})
+				default:
+					return nil, database.ErrNotFound
+				}
+			default:
+				return nil, errors.Errorf("unexpected bucket %s", string(bucket))
+			}
+		}
+	}
+
+	type test struct {
+		db      nosql.DB
+		deleted map[string][]string
+		stats   *acme.GarbageCollectionStats
+		err     error
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/list-orders-error": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MList: func(bucket []byte) ([]*database.Entry, error) {
+						assert.Equals(t, bucket, orderTable)
+						return nil, errors.New("force")
+					},
+				},
+				err: errors.New("error listing acme orders: force"),
+			}
+		},
+		"fail/save-index-error": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MList: list(t),
+					MGet:  get(t),
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						return nil, false, errors.New("force")
+					},
+				},
+				err: errors.New("error saving orderIDs index for account acc1: error saving acme orderIDsByAccountID: force"),
+			}
+		},
+		"fail/delete-authz-error": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MList: list(t),
+					MGet:  get(t),
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						return nu, true, nil
+					},
+					MDel: func(bucket, key []byte) error {
+						if string(bucket) == string(authzTable) {
+							return errors.New("force")
+						}
+						return nil
+					},
+				},
+				err: errors.New("error deleting acme authz a1: force"),
+			}
+		},
+		"ok": func(t *testing.T) test {
+			deleted := make(map[string][]string)
+			return test{
+				db: &db.MockNoSQLDB{
+					MList: list(t),
+					MGet:  get(t),
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						assert.Equals(t, bucket, ordersByAccountIDTable)
+						assert.Equals(t, string(key), "acc1")
+						var oids []string
+						assert.FatalError(t, json.Unmarshal(nu, &oids))
+						assert.Equals(t, oids, []string{"o2", "o4"})
+						return nu, true, nil
+					},
+					MDel: func(bucket, key []byte) error {
+						deleted[string(bucket)] = append(deleted[string(bucket)], string(key))
+						return nil
+					},
+				},
+				deleted: deleted,
+				stats: &acme.GarbageCollectionStats{
+					Orders: 1, Authorizations: 1, Challenges: 2, Nonces: 2,
+				},
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			d := DB{db: tc.db}
+			stats, err := d.DeleteStaleResources(context.Background(), opts)
+			if err != nil {
+				if assert.NotNil(t, tc.err) {
+					assert.HasPrefix(t, err.Error(), tc.err.Error())
+				}
+				return
+			}
+			if assert.Nil(t, tc.err) {
+				assert.Equals(t, stats, tc.stats)
+				assert.Equals(t, tc.deleted, map[string][]string{
+					string(orderTable):         {"o1"},
+					string(authzTable):         {"a1"},
+					string(challengeTable):     {"c1", "c2"},
+					string(challengeLockTable): {"c1", "c2"},
+					string(nonceTable):         {"n1", "n4"},
+				})
+			}
+		})
+	}
+}
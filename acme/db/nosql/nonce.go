@@ -3,19 +3,20 @@ package nosql
 import (
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"time"
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/certificates/acme"
 	"github.com/smallstep/nosql"
-	"github.com/smallstep/nosql/database"
 )
 
 // dbNonce contains nonce metadata used in the ACME protocol.
 type dbNonce struct {
-	ID        string
-	CreatedAt time.Time
-	DeletedAt time.Time
+	ID            string
+	ProvisionerID string `json:",omitempty"`
+	CreatedAt     time.Time
+	DeletedAt     time.Time
 }
 
 // CreateNonce creates, stores, and returns an ACME replay-nonce.
@@ -31,6 +32,9 @@ func (db *DB) CreateNonce(ctx context.Context) (acme.Nonce, error) {
 		ID:        id,
 		CreatedAt: clock.Now(),
 	}
+	if p, ok := acme.ProvisionerFromContext(ctx); ok {
+		n.ProvisionerID = p.GetID()
+	}
 	if err := db.save(ctx, id, n, nil, "nonce", nonceTable); err != nil {
 		return "", err
 	}
@@ -38,29 +42,40 @@ func (db *DB) CreateNonce(ctx context.Context) (acme.Nonce, error) {
 }
 
 // DeleteNonce verifies that the nonce is valid (by checking if it exists),
-// and if so, consumes the nonce resource by deleting it from the database.
+// and if so, consumes the nonce resource. The nonce is first marked as deleted
+// using a compare-and-swap, so only one request can consume it even if
+// multiple CA replicas share the database, and then it's removed.
 func (db *DB) DeleteNonce(_ context.Context, nonce acme.Nonce) error {
-	err := db.db.Update(&database.Tx{
-		Operations: []*database.TxEntry{
-			{
-				Bucket: nonceTable,
-				Key:    []byte(nonce),
-				Cmd:    database.Get,
-			},
-			{
-				Bucket: nonceTable,
-				Key:    []byte(nonce),
-				Cmd:    database.Delete,
-			},
-		},
-	})
-
+	b, err := db.db.Get(nonceTable, []byte(nonce))
 	switch {
 	case nosql.IsErrNotFound(err):
 		return acme.NewError(acme.ErrorBadNonceType, "nonce %s not found", string(nonce))
+	case err != nil:
+		return errors.Wrapf(err, "error loading nonce %s", string(nonce))
+	}
+	n := new(dbNonce)
+	if err := json.Unmarshal(b, n); err != nil {
+		return errors.Wrapf(err, "error unmarshaling nonce key '%s' into dbNonce", string(nonce))
+	}
+	if !n.DeletedAt.IsZero() {
+		return acme.NewError(acme.ErrorBadNonceType, "nonce %s has already been used", string(nonce))
+	}
+
+	n.DeletedAt = clock.Now()
+	nu, err := json.Marshal(n)
+	if err != nil {
+		return errors.Wrapf(err, "error marshaling nonce %s", string(nonce))
+	}
+	_, swapped, err := db.db.CmpAndSwap(nonceTable, []byte(nonce), b, nu)
+	switch {
 	case err != nil:
 		return errors.Wrapf(err, "error deleting nonce %s", string(nonce))
-	default:
-		return nil
+	case !swapped:
+		return acme.NewError(acme.ErrorBadNonceType, "nonce %s has already been used", string(nonce))
 	}
+
+	// The nonce cannot be used anymore, if it's not removed now the garbage
+	// collector will remove it.
+	_ = db.db.Del(nonceTable, []byte(nonce))
+	return nil
 }
@@ -16,6 +16,7 @@ import (
 
 func TestDB_CreateNonce(t *testing.T) {
 	type test struct {
+		ctx context.Context
 		db  nosql.DB
 		err error
 		_id *string
@@ -63,12 +64,38 @@ func TestDB_CreateNonce(t *testing.T) {
 				_id: idPtr,
 			}
 		},
+		"ok/provisioner": func(t *testing.T) test {
+			var (
+				id    string
+				idPtr = &id
+			)
+
+			prov := &acme.MockProvisioner{MgetID: func() string { return "provID" }}
+			return test{
+				ctx: acme.NewProvisionerContext(context.Background(), prov),
+				db: &db.MockNoSQLDB{
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						*idPtr = string(key)
+						dbn := new(dbNonce)
+						assert.FatalError(t, json.Unmarshal(nu, dbn))
+						assert.Equals(t, dbn.ID, string(key))
+						assert.Equals(t, dbn.ProvisionerID, "provID")
+						return nil, true, nil
+					},
+				},
+				_id: idPtr,
+			}
+		},
 	}
 	for name, run := range tests {
 		tc := run(t)
 		t.Run(name, func(t *testing.T) {
 			d := DB{db: tc.db}
-			if n, err := d.CreateNonce(context.Background()); err != nil {
+			ctx := tc.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			if n, err := d.CreateNonce(ctx); err != nil {
 				if assert.NotNil(t, tc.err) {
 					assert.HasPrefix(t, err.Error(), tc.err.Error())
 				}
@@ -84,6 +111,12 @@ func TestDB_CreateNonce(t *testing.T) {
 func TestDB_DeleteNonce(t *testing.T) {
 
 	nonceID := "nonceID"
+	now := clock.Now()
+	nonce, err := json.Marshal(&dbNonce{ID: nonceID, CreatedAt: now})
+	assert.FatalError(t, err)
+	usedNonce, err := json.Marshal(&dbNonce{ID: nonceID, CreatedAt: now, DeletedAt: now})
+	assert.FatalError(t, err)
+
 	type test struct {
 		db      nosql.DB
 		err     error
@@ -93,53 +126,113 @@ func TestDB_DeleteNonce(t *testing.T) {
 		"fail/not-found": func(t *testing.T) test {
 			return test{
 				db: &db.MockNoSQLDB{
-					MUpdate: func(tx *database.Tx) error {
-						assert.Equals(t, tx.Operations[0].Bucket, nonceTable)
-						assert.Equals(t, tx.Operations[0].Key, []byte(nonceID))
-						assert.Equals(t, tx.Operations[0].Cmd, database.Get)
-
-						assert.Equals(t, tx.Operations[1].Bucket, nonceTable)
-						assert.Equals(t, tx.Operations[1].Key, []byte(nonceID))
-						assert.Equals(t, tx.Operations[1].Cmd, database.Delete)
-						return database.ErrNotFound
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						assert.Equals(t, bucket, nonceTable)
+						assert.Equals(t, key, []byte(nonceID))
+						return nil, database.ErrNotFound
 					},
 				},
 				acmeErr: acme.NewError(acme.ErrorBadNonceType, "nonce %s not found", nonceID),
 			}
 		},
-		"fail/db.Update-error": func(t *testing.T) test {
+		"fail/db.Get-error": func(t *testing.T) test {
 			return test{
 				db: &db.MockNoSQLDB{
-					MUpdate: func(tx *database.Tx) error {
-						assert.Equals(t, tx.Operations[0].Bucket, nonceTable)
-						assert.Equals(t, tx.Operations[0].Key, []byte(nonceID))
-						assert.Equals(t, tx.Operations[0].Cmd, database.Get)
-
-						assert.Equals(t, tx.Operations[1].Bucket, nonceTable)
-						assert.Equals(t, tx.Operations[1].Key, []byte(nonceID))
-						assert.Equals(t, tx.Operations[1].Cmd, database.Delete)
-						return errors.New("force")
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return nil, errors.New("force")
+					},
+				},
+				err: errors.New("error loading nonce nonceID: force"),
+			}
+		},
+		"fail/unmarshal-error": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return []byte("foo"), nil
+					},
+				},
+				err: errors.New("error unmarshaling nonce key 'nonceID' into dbNonce"),
+			}
+		},
+		"fail/already-used": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return usedNonce, nil
+					},
+				},
+				acmeErr: acme.NewError(acme.ErrorBadNonceType, "nonce %s has already been used", nonceID),
+			}
+		},
+		"fail/db.CmpAndSwap-error": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return nonce, nil
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						return nil, false, errors.New("force")
 					},
 				},
 				err: errors.New("error deleting nonce nonceID: force"),
 			}
 		},
+		"fail/used-concurrently": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return nonce, nil
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						return usedNonce, false, nil
+					},
+				},
+				acmeErr: acme.NewError(acme.ErrorBadNonceType, "nonce %s has already been used", nonceID),
+			}
+		},
 		"ok": func(t *testing.T) test {
 			return test{
 				db: &db.MockNoSQLDB{
-					MUpdate: func(tx *database.Tx) error {
-						assert.Equals(t, tx.Operations[0].Bucket, nonceTable)
-						assert.Equals(t, tx.Operations[0].Key, []byte(nonceID))
-						assert.Equals(t, tx.Operations[0].Cmd, database.Get)
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						assert.Equals(t, bucket, nonceTable)
+						assert.Equals(t, key, []byte(nonceID))
+						return nonce, nil
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						assert.Equals(t, bucket, nonceTable)
+						assert.Equals(t, key, []byte(nonceID))
+						assert.Equals(t, old, nonce)
 
-						assert.Equals(t, tx.Operations[1].Bucket, nonceTable)
-						assert.Equals(t, tx.Operations[1].Key, []byte(nonceID))
-						assert.Equals(t, tx.Operations[1].Cmd, database.Delete)
+						dbn := new(dbNonce)
+						assert.FatalError(t, json.Unmarshal(nu, dbn))
+						assert.Equals(t, dbn.ID, nonceID)
+						assert.False(t, dbn.DeletedAt.IsZero())
+						return nu, true, nil
+					},
+					MDel: func(bucket, key []byte) error {
+						assert.Equals(t, bucket, nonceTable)
+						assert.Equals(t, key, []byte(nonceID))
 						return nil
 					},
 				},
 			}
 		},
+		"ok/del-error": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return nonce, nil
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						return nu, true, nil
+					},
+					MDel: func(bucket, key []byte) error {
+						return errors.New("force")
+					},
+				},
+			}
+		},
 	}
 	for name, run := range tests {
 		tc := run(t)
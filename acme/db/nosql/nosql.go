@@ -18,11 +18,15 @@ var (
 	nonceTable                                = []byte("nonces")
 	orderTable                                = []byte("acme_orders")
 	ordersByAccountIDTable                    = []byte("acme_account_orders_index")
+	authzsByAccountIDTable                    = []byte("acme_account_authzs_index")
 	certTable                                 = []byte("acme_certs")
 	certBySerialTable                         = []byte("acme_serial_certs_index")
 	externalAccountKeyTable                   = []byte("acme_external_account_keys")
 	externalAccountKeyIDsByReferenceTable     = []byte("acme_external_account_keyID_reference_index")
 	externalAccountKeyIDsByProvisionerIDTable = []byte("acme_external_account_keyID_provisionerID_index")
+	externalAccountKeyIDsByAccountIDTable     = []byte("acme_external_account_keyID_accountID_index")
+	enrolledDeviceTable                       = []byte("acme_enrolled_devices")
+	challengeLockTable                        = []byte("acme_challenge_locks")
 )
 
 // DB is a struct that implements the AcmeDB interface.
@@ -33,9 +37,10 @@ type DB struct {
 // New configures and returns a new ACME DB backend implemented using a nosql DB.
 func New(db nosqlDB.DB) (*DB, error) {
 	tables := [][]byte{accountTable, accountByKeyIDTable, authzTable,
-		challengeTable, nonceTable, orderTable, ordersByAccountIDTable,
+		challengeTable, nonceTable, orderTable, ordersByAccountIDTable, authzsByAccountIDTable,
 		certTable, certBySerialTable, externalAccountKeyTable,
 		externalAccountKeyIDsByReferenceTable, externalAccountKeyIDsByProvisionerIDTable,
+		externalAccountKeyIDsByAccountIDTable, enrolledDeviceTable, challengeLockTable,
 	}
 	for _, b := range tables {
 		if err := db.CreateTable(b); err != nil {
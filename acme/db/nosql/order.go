@@ -3,6 +3,7 @@ package nosql
 import (
 	"context"
 	"encoding/json"
+	"slices"
 	"sync"
 	"time"
 
@@ -23,6 +24,9 @@ type dbOrder struct {
 	Status           acme.Status       `json:"status"`
 	NotBefore        time.Time         `json:"notBefore,omitempty"`
 	NotAfter         time.Time         `json:"notAfter,omitempty"`
+	Profile          string            `json:"profile,omitempty"`
+	AutoRenewal      *acme.AutoRenewal `json:"autoRenewal,omitempty"`
+	CSR              []byte            `json:"csr,omitempty"`
 	CreatedAt        time.Time         `json:"createdAt"`
 	ExpiresAt        time.Time         `json:"expiresAt,omitempty"`
 	CertificateID    string            `json:"certificate,omitempty"`
@@ -57,17 +61,20 @@ func (db *DB) GetOrder(ctx context.Context, id string) (*acme.Order, error) {
 	}
 
 	o := &acme.Order{
-		ID:               dbo.ID,
-		AccountID:        dbo.AccountID,
-		ProvisionerID:    dbo.ProvisionerID,
-		CertificateID:    dbo.CertificateID,
-		Status:           dbo.Status,
-		ExpiresAt:        dbo.ExpiresAt,
-		Identifiers:      dbo.Identifiers,
-		NotBefore:        dbo.NotBefore,
-		NotAfter:         dbo.NotAfter,
-		AuthorizationIDs: dbo.AuthorizationIDs,
-		Error:            dbo.Error,
+		ID:                 dbo.ID,
+		AccountID:          dbo.AccountID,
+		ProvisionerID:      dbo.ProvisionerID,
+		CertificateID:      dbo.CertificateID,
+		Status:             dbo.Status,
+		ExpiresAt:          dbo.ExpiresAt,
+		Identifiers:        dbo.Identifiers,
+		NotBefore:          dbo.NotBefore,
+		NotAfter:           dbo.NotAfter,
+		Profile:            dbo.Profile,
+		AutoRenewal:        dbo.AutoRenewal,
+		CertificateRequest: dbo.CSR,
+		AuthorizationIDs:   dbo.AuthorizationIDs,
+		Error:              dbo.Error,
 	}
 
 	return o, nil
@@ -92,6 +99,8 @@ func (db *DB) CreateOrder(ctx context.Context, o *acme.Order) error {
 		Identifiers:      o.Identifiers,
 		NotBefore:        o.NotBefore,
 		NotAfter:         o.NotAfter,
+		Profile:          o.Profile,
+		AutoRenewal:      o.AutoRenewal,
 		AuthorizationIDs: o.AuthorizationIDs,
 	}
 	if err := db.save(ctx, o.ID, dbo, nil, "order", orderTable); err != nil {
@@ -117,9 +126,39 @@ func (db *DB) UpdateOrder(ctx context.Context, o *acme.Order) error {
 	nu.Status = o.Status
 	nu.Error = o.Error
 	nu.CertificateID = o.CertificateID
+	nu.CSR = o.CertificateRequest
 	return db.save(ctx, old.ID, nu, old, "order", orderTable)
 }
 
+// SwapOrderCertificate sets the certificate of an order if its current
+// certificate is oldCertificateID. It returns false if the certificate or any
+// other field of the order has changed since it was read.
+func (db *DB) SwapOrderCertificate(ctx context.Context, orderID, oldCertificateID, newCertificateID string) (bool, error) {
+	old, err := db.getDBOrder(ctx, orderID)
+	if err != nil {
+		return false, err
+	}
+	if old.CertificateID != oldCertificateID {
+		return false, nil
+	}
+
+	nu := old.clone()
+	nu.CertificateID = newCertificateID
+	oldB, err := json.Marshal(old)
+	if err != nil {
+		return false, errors.Wrapf(err, "error marshaling order %s", orderID)
+	}
+	newB, err := json.Marshal(nu)
+	if err != nil {
+		return false, errors.Wrapf(err, "error marshaling order %s", orderID)
+	}
+	_, swapped, err := db.db.CmpAndSwap(orderTable, []byte(orderID), oldB, newB)
+	if err != nil {
+		return false, errors.Wrapf(err, "error saving acme order %s", orderID)
+	}
+	return swapped, nil
+}
+
 func (db *DB) updateAddOrderIDs(ctx context.Context, accID string, addOids ...string) ([]string, error) {
 	ordersByAccountMux.Lock()
 	defer ordersByAccountMux.Unlock()
@@ -185,3 +224,32 @@ func (db *DB) updateAddOrderIDs(ctx context.Context, accID string, addOids ...st
 func (db *DB) GetOrdersByAccountID(ctx context.Context, accID string) ([]string, error) {
 	return db.updateAddOrderIDs(ctx, accID)
 }
+
+// defaultOrdersLimit is the maximum number of orders returned in a page of the
+// orders of an account.
+const defaultOrdersLimit = 100
+
+// ListOrdersByAccountID returns a page of the order IDs owned by the account
+// and the cursor of the next page. The cursor is the ID of the first order in
+// the page, and the next cursor is empty in the last page.
+func (db *DB) ListOrdersByAccountID(ctx context.Context, accID, cursor string, limit int) ([]string, string, error) {
+	oids, err := db.updateAddOrderIDs(ctx, accID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if limit <= 0 || limit > defaultOrdersLimit {
+		limit = defaultOrdersLimit
+	}
+
+	start := 0
+	if cursor != "" {
+		if start = slices.Index(oids, cursor); start == -1 {
+			return nil, "", acme.NewError(acme.ErrorMalformedType, "cursor %s is not valid", cursor)
+		}
+	}
+	if end := start + limit; end < len(oids) {
+		return oids[start:end], oids[end], nil
+	}
+	return oids[start:], "", nil
+}
@@ -1023,3 +1023,230 @@ func TestDB_updateAddOrderIDs(t *testing.T) {
 		})
 	}
 }
+
+func TestDB_ListOrdersByAccountID(t *testing.T) {
+	accID := "accID"
+	oids := []string{"foo", "bar", "baz"}
+	boids, err := json.Marshal(oids)
+	assert.FatalError(t, err)
+	min5 := clock.Now().Add(5 * time.Minute)
+	baz, err := json.Marshal(&dbAuthz{
+		ID:           "a",
+		Status:       acme.StatusPending,
+		ExpiresAt:    min5,
+		ChallengeIDs: []string{"aa"},
+	})
+	assert.FatalError(t, err)
+	bch, err := json.Marshal(&dbChallenge{ID: "aa", Status: acme.StatusPending})
+	assert.FatalError(t, err)
+
+	newDB := func(t *testing.T) nosql.DB {
+		return &db.MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				switch string(bucket) {
+				case string(ordersByAccountIDTable):
+					assert.Equals(t, key, []byte(accID))
+					return boids, nil
+				case string(orderTable):
+					return json.Marshal(&dbOrder{
+						ID:               string(key),
+						Status:           acme.StatusPending,
+						ExpiresAt:        min5,
+						AuthorizationIDs: []string{"a"},
+					})
+				case string(authzTable):
+					return baz, nil
+				case string(challengeTable):
+					return bch, nil
+				default:
+					assert.FatalError(t, errors.Errorf("unexpected bucket %s", string(bucket)))
+					return nil, errors.New("force")
+				}
+			},
+			MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+				assert.Equals(t, bucket, ordersByAccountIDTable)
+				return nu, true, nil
+			},
+		}
+	}
+
+	type test struct {
+		db         nosql.DB
+		cursor     string
+		limit      int
+		res        []string
+		nextCursor string
+		err        error
+		acmeErr    *acme.Error
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/db.Get-error": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return nil, errors.New("force")
+					},
+				},
+				err: errors.Errorf("error loading orderIDs for account %s", accID),
+			}
+		},
+		"fail/invalid-cursor": func(t *testing.T) test {
+			return test{
+				db:      newDB(t),
+				cursor:  "zap",
+				acmeErr: acme.NewError(acme.ErrorMalformedType, "cursor zap is not valid"),
+			}
+		},
+		"ok/default-limit": func(t *testing.T) test {
+			return test{
+				db:  newDB(t),
+				res: oids,
+			}
+		},
+		"ok/first-page": func(t *testing.T) test {
+			return test{
+				db:         newDB(t),
+				limit:      2,
+				res:        []string{"foo", "bar"},
+				nextCursor: "baz",
+			}
+		},
+		"ok/last-page": func(t *testing.T) test {
+			return test{
+				db:     newDB(t),
+				cursor: "baz",
+				limit:  2,
+				res:    []string{"baz"},
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			d := DB{db: tc.db}
+			res, nextCursor, err := d.ListOrdersByAccountID(context.Background(), accID, tc.cursor, tc.limit)
+			if err != nil {
+				switch k := err.(type) {
+				case *acme.Error:
+					if assert.NotNil(t, tc.acmeErr) {
+						assert.Equals(t, k.Type, tc.acmeErr.Type)
+						assert.Equals(t, k.Detail, tc.acmeErr.Detail)
+						assert.Equals(t, k.Status, tc.acmeErr.Status)
+					}
+				default:
+					if assert.NotNil(t, tc.err) {
+						assert.HasPrefix(t, err.Error(), tc.err.Error())
+					}
+				}
+			} else if assert.Nil(t, tc.err) && assert.Nil(t, tc.acmeErr) {
+				assert.Equals(t, res, tc.res)
+				assert.Equals(t, nextCursor, tc.nextCursor)
+			}
+		})
+	}
+}
+
+func TestDB_SwapOrderCertificate(t *testing.T) {
+	orderID := "orderID"
+	dbo := &dbOrder{
+		ID:            orderID,
+		AccountID:     "accID",
+		Status:        acme.StatusValid,
+		CertificateID: "certID",
+	}
+	b, err := json.Marshal(dbo)
+	assert.FatalError(t, err)
+
+	type test struct {
+		db      nosql.DB
+		oldID   string
+		swapped bool
+		err     error
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"ok": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return b, nil
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						assert.Equals(t, bucket, orderTable)
+						assert.Equals(t, key, []byte(orderID))
+						assert.Equals(t, old, b)
+						var o dbOrder
+						assert.FatalError(t, json.Unmarshal(nu, &o))
+						assert.Equals(t, "newCertID", o.CertificateID)
+						assert.Equals(t, acme.StatusValid, o.Status)
+						return nu, true, nil
+					},
+				},
+				oldID:   "certID",
+				swapped: true,
+			}
+		},
+		"ok/changed-certificate": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return b, nil
+					},
+				},
+				oldID: "otherCertID",
+			}
+		},
+		"ok/changed-order": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return b, nil
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						return old, false, nil
+					},
+				},
+				oldID: "certID",
+			}
+		},
+		"fail/db.CmpAndSwap-error": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return b, nil
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						return nil, false, errors.New("force")
+					},
+				},
+				oldID: "certID",
+				err:   errors.New("error saving acme order orderID: force"),
+			}
+		},
+		"fail/db.Get-error": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return nil, errors.New("force")
+					},
+				},
+				oldID: "certID",
+				err:   errors.New("error loading order orderID: force"),
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			d := DB{db: tc.db}
+			swapped, err := d.SwapOrderCertificate(context.Background(), orderID, tc.oldID, "newCertID")
+			if tc.err != nil {
+				if assert.NotNil(t, err) {
+					assert.Equals(t, tc.err.Error(), err.Error())
+				}
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, tc.swapped, swapped)
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package acme
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// EnrolledDeviceType is the type of identifier used to enroll a TPM device.
+type EnrolledDeviceType string
+
+const (
+	// EnrolledDeviceEK is the type of the devices enrolled using the
+	// fingerprint of their endorsement key (EK).
+	EnrolledDeviceEK EnrolledDeviceType = "ek"
+	// EnrolledDeviceSerialNumber is the type of the devices enrolled using
+	// their serial number.
+	EnrolledDeviceSerialNumber EnrolledDeviceType = "serialNumber"
+)
+
+// ekURNPrefix is the prefix of the permanent identifiers containing the
+// fingerprint of an EK, e.g. urn:ek:sha256:<base64>.
+const ekURNPrefix = "urn:ek:"
+
+// EnrolledDevice is a TPM device registered in the CA. If a provisioner
+// requires device enrollment, only enrolled devices can complete the
+// device-attest-01 challenge using the tpm attestation format.
+type EnrolledDevice struct {
+	ID            string             `json:"id"`
+	ProvisionerID string             `json:"provisionerID"`
+	Type          EnrolledDeviceType `json:"type"`
+	Value         string             `json:"value"`
+	CreatedAt     time.Time          `json:"createdAt"`
+}
+
+// EnrolledDeviceDB is the interface implemented by the databases that can
+// store the devices enrolled in a provisioner.
+type EnrolledDeviceDB interface {
+	CreateEnrolledDevice(ctx context.Context, dev *EnrolledDevice) error
+	GetEnrolledDevice(ctx context.Context, provisionerID, id string) (*EnrolledDevice, error)
+	GetEnrolledDevices(ctx context.Context, provisionerID string) ([]*EnrolledDevice, error)
+	DeleteEnrolledDevice(ctx context.Context, provisionerID, id string) error
+}
+
+// EnrolledDeviceID returns the identifier of the enrolled device with the
+// given type and value. The identifier is derived from them, so the device
+// can be looked up while validating an attestation.
+func EnrolledDeviceID(typ EnrolledDeviceType, value string) string {
+	sum := sha256.Sum256([]byte(string(typ) + ":" + value))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// EKFingerprint returns the fingerprint of an EK public key, the base64
+// encoded SHA-256 of the PKIX, ASN.1 DER form of the key prefixed by
+// "sha256:". This is the fingerprint used in the urn:ek permanent identifiers.
+func EKFingerprint(pub crypto.PublicKey) (string, error) {
+	b, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling public key: %w", err)
+	}
+	sum := sha256.Sum256(b)
+	return "sha256:" + base64.StdEncoding.EncodeToString(sum[:]), nil
+}
+
+// validateEnrolledDevice checks that the TPM device in an attestation is
+// enrolled in the provisioner. Only the permanent identifiers in the verified
+// AK certificate are used to look up the device, the challenge value is
+// chosen by the client and it must be one of them. The validation fails if
+// the AK certificate does not have any permanent identifier.
+func validateEnrolledDevice(ctx context.Context, db DB, prov Provisioner, ch *Challenge, data *tpmAttestationData) error {
+	edb, ok := db.(EnrolledDeviceDB)
+	if !ok {
+		return NewErrorISE("database does not support enrolled devices")
+	}
+
+	notEnrolled := func(format string, args ...any) error {
+		subproblem := NewSubproblemWithIdentifier(
+			ErrorRejectedIdentifierType,
+			Identifier{Type: "permanent-identifier", Value: ch.Value},
+			format, args...,
+		)
+		return NewDetailedError(ErrorBadAttestationStatementType, "device is not enrolled").AddSubproblems(subproblem)
+	}
+
+	if len(data.PermanentIdentifiers) == 0 {
+		return notEnrolled("the AK certificate does not contain any hardware identifier")
+	}
+	if !slices.Contains(data.PermanentIdentifiers, ch.Value) {
+		return notEnrolled("challenge identifier %q doesn't match any of the attested hardware identifiers %q", ch.Value, data.PermanentIdentifiers)
+	}
+
+	for _, v := range data.PermanentIdentifiers {
+		typ, value, ok := enrolledDeviceValue(v)
+		if !ok {
+			continue
+		}
+		dev, err := edb.GetEnrolledDevice(ctx, prov.GetID(), EnrolledDeviceID(typ, value))
+		switch {
+		case err == nil:
+			// The id is derived from the type and value, but compare them
+			// too, the EK fingerprint must be the one of the enrolled key.
+			if dev.Type == typ && subtle.ConstantTimeCompare([]byte(dev.Value), []byte(value)) == 1 {
+				return nil
+			}
+		case !IsErrNotFound(err):
+			return WrapErrorISE(err, "error retrieving enrolled device")
+		}
+	}
+
+	return notEnrolled("none of the attested hardware identifiers %q is enrolled", data.PermanentIdentifiers)
+}
+
+// enrolledDeviceValue returns the type and value of the enrolled device that
+// would match the given attested identifier. Identifiers in the urn:ek form
+// match the devices enrolled using an EK, other identifiers match the devices
+// enrolled using a serial number.
+func enrolledDeviceValue(identifier string) (EnrolledDeviceType, string, bool) {
+	if identifier == "" {
+		return "", "", false
+	}
+	if fp, ok := strings.CutPrefix(identifier, ekURNPrefix); ok {
+		return EnrolledDeviceEK, fp, true
+	}
+	return EnrolledDeviceSerialNumber, identifier, true
+}
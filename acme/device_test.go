@@ -0,0 +1,111 @@
+package acme
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnrolledDeviceID(t *testing.T) {
+	id := EnrolledDeviceID(EnrolledDeviceSerialNumber, "1234")
+	assert.Equal(t, id, EnrolledDeviceID(EnrolledDeviceSerialNumber, "1234"))
+	assert.NotEqual(t, id, EnrolledDeviceID(EnrolledDeviceEK, "1234"))
+	assert.NotEqual(t, id, EnrolledDeviceID(EnrolledDeviceSerialNumber, "4321"))
+	assert.NotContains(t, id, "/")
+}
+
+func TestEKFingerprint(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	b, err := x509.MarshalPKIXPublicKey(key.Public())
+	require.NoError(t, err)
+	sum := sha256.Sum256(b)
+
+	fp, err := EKFingerprint(key.Public())
+	require.NoError(t, err)
+	assert.Equal(t, "sha256:"+base64.StdEncoding.EncodeToString(sum[:]), fp)
+
+	_, err = EKFingerprint("not a key")
+	assert.Error(t, err)
+}
+
+func Test_enrolledDeviceValue(t *testing.T) {
+	tests := []struct {
+		identifier string
+		wantType   EnrolledDeviceType
+		wantValue  string
+		wantOK     bool
+	}{
+		{"urn:ek:sha256:AAAA", EnrolledDeviceEK, "sha256:AAAA", true},
+		{"1234", EnrolledDeviceSerialNumber, "1234", true},
+		{"", "", "", false},
+	}
+	for _, tt := range tests {
+		typ, value, ok := enrolledDeviceValue(tt.identifier)
+		assert.Equal(t, tt.wantType, typ)
+		assert.Equal(t, tt.wantValue, value)
+		assert.Equal(t, tt.wantOK, ok)
+	}
+}
+
+type noEnrolledDeviceDB struct {
+	DB
+}
+
+func Test_validateEnrolledDevice(t *testing.T) {
+	ctx := context.Background()
+	prov := &MockProvisioner{MgetID: func() string { return "provID" }}
+
+	getEnrolledDevice := func(want EnrolledDeviceType, value string) func(context.Context, string, string) (*EnrolledDevice, error) {
+		return func(_ context.Context, provisionerID, id string) (*EnrolledDevice, error) {
+			assert.Equal(t, "provID", provisionerID)
+			if id == EnrolledDeviceID(want, value) {
+				return &EnrolledDevice{ID: id, Type: want, Value: value}, nil
+			}
+			return nil, ErrNotFound
+		}
+	}
+
+	tests := []struct {
+		name        string
+		db          DB
+		value       string
+		identifiers []string
+		wantStatus  int
+	}{
+		{"ok serial number", &MockDB{MockGetEnrolledDevice: getEnrolledDevice(EnrolledDeviceSerialNumber, "1234")}, "1234", []string{"1234"}, 0},
+		{"ok ek", &MockDB{MockGetEnrolledDevice: getEnrolledDevice(EnrolledDeviceEK, "sha256:AAAA")}, "urn:ek:sha256:AAAA", []string{"urn:ek:sha256:AAAA"}, 0},
+		{"ok ek and serial number", &MockDB{MockGetEnrolledDevice: getEnrolledDevice(EnrolledDeviceEK, "sha256:AAAA")}, "1234", []string{"1234", "urn:ek:sha256:AAAA"}, 0},
+		{"fail not enrolled", &MockDB{MockGetEnrolledDevice: getEnrolledDevice(EnrolledDeviceEK, "sha256:BBBB")}, "urn:ek:sha256:AAAA", []string{"urn:ek:sha256:AAAA"}, 400},
+		{"fail challenge value not attested", &MockDB{MockGetEnrolledDevice: getEnrolledDevice(EnrolledDeviceSerialNumber, "1234")}, "1234", []string{"urn:ek:sha256:AAAA"}, 400},
+		{"fail no attested identifiers", &MockDB{MockGetEnrolledDevice: getEnrolledDevice(EnrolledDeviceSerialNumber, "1234")}, "1234", nil, 400},
+		{"fail ek does not match", &MockDB{MockGetEnrolledDevice: func(_ context.Context, _, id string) (*EnrolledDevice, error) {
+			return &EnrolledDevice{ID: id, Type: EnrolledDeviceEK, Value: "sha256:BBBB"}, nil
+		}}, "urn:ek:sha256:AAAA", []string{"urn:ek:sha256:AAAA"}, 400},
+		{"fail db error", &MockDB{MockError: errors.New("force")}, "1234", []string{"1234"}, 500},
+		{"fail not supported", &noEnrolledDeviceDB{}, "1234", []string{"1234"}, 500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch := &Challenge{Value: tt.value}
+			data := &tpmAttestationData{PermanentIdentifiers: tt.identifiers}
+			err := validateEnrolledDevice(ctx, tt.db, prov, ch, data)
+			if tt.wantStatus == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			var acmeErr *Error
+			require.ErrorAs(t, err, &acmeErr)
+			assert.Equal(t, tt.wantStatus, acmeErr.Status)
+		})
+	}
+}
@@ -65,6 +65,21 @@ const (
 	ErrorUserActionRequiredType
 	// ErrorNotImplementedType operation is not implemented
 	ErrorNotImplementedType
+	// ErrorInvalidProfileType the profile requested in a new order is not
+	// supported by the server
+	ErrorInvalidProfileType
+	// ErrorAutoRenewalCanceledType the STAR certificate cannot be retrieved
+	// because the order has been canceled
+	ErrorAutoRenewalCanceledType
+	// ErrorAutoRenewalExpiredType the STAR certificate cannot be retrieved
+	// because the end date of the order has passed
+	ErrorAutoRenewalExpiredType
+	// ErrorAutoRenewalCancellationInvalidType the order to cancel is not a
+	// valid STAR order
+	ErrorAutoRenewalCancellationInvalidType
+	// ErrorAutoRenewalRevocationNotSupportedType STAR certificates cannot be
+	// revoked
+	ErrorAutoRenewalRevocationNotSupportedType
 )
 
 // String returns the string representation of the acme problem type,
@@ -121,6 +136,16 @@ func (ap ProblemType) String() string {
 		return "userActionRequired"
 	case ErrorNotImplementedType:
 		return "notImplemented"
+	case ErrorInvalidProfileType:
+		return "invalidProfile"
+	case ErrorAutoRenewalCanceledType:
+		return "autoRenewalCanceled"
+	case ErrorAutoRenewalExpiredType:
+		return "autoRenewalExpired"
+	case ErrorAutoRenewalCancellationInvalidType:
+		return "autoRenewalCancellationInvalid"
+	case ErrorAutoRenewalRevocationNotSupportedType:
+		return "autoRenewalRevocationNotSupported"
 	default:
 		return fmt.Sprintf("unsupported type ACME error type '%d'", int(ap))
 	}
@@ -266,6 +291,31 @@ var (
 			details: "Visit the “instance” URL and take actions specified there",
 			status:  400,
 		},
+		ErrorInvalidProfileType: {
+			typ:     officialACMEPrefix + ErrorInvalidProfileType.String(),
+			details: "The requested profile is not supported by the server",
+			status:  400,
+		},
+		ErrorAutoRenewalCanceledType: {
+			typ:     officialACMEPrefix + ErrorAutoRenewalCanceledType.String(),
+			details: "The auto-renewal order has been canceled",
+			status:  403,
+		},
+		ErrorAutoRenewalExpiredType: {
+			typ:     officialACMEPrefix + ErrorAutoRenewalExpiredType.String(),
+			details: "The auto-renewal order has expired",
+			status:  403,
+		},
+		ErrorAutoRenewalCancellationInvalidType: {
+			typ:     officialACMEPrefix + ErrorAutoRenewalCancellationInvalidType.String(),
+			details: "The order cannot be canceled",
+			status:  403,
+		},
+		ErrorAutoRenewalRevocationNotSupportedType: {
+			typ:     officialACMEPrefix + ErrorAutoRenewalRevocationNotSupportedType.String(),
+			details: "Revocation of auto-renewal certificates is not supported",
+			status:  403,
+		},
 		ErrorServerInternalType: errorServerInternalMetadata,
 	}
 )
@@ -341,6 +391,25 @@ func NewSubproblemWithIdentifier(pt ProblemType, identifier Identifier, msg stri
 	return s
 }
 
+// NewSubproblemFromError creates a new Subproblem for the given Identifier
+// using the type of the given error. The error message is only set as the
+// Detail if the error is not an internal server error.
+func NewSubproblemFromError(identifier Identifier, err error) Subproblem {
+	var e *Error
+	if !errors.As(err, &e) {
+		e = newError(ErrorServerInternalType, err)
+	}
+	s := Subproblem{
+		Type:       e.Type,
+		Detail:     e.Detail,
+		Identifier: &identifier,
+	}
+	if e.Status < 500 && e.Err != nil {
+		s.Detail = e.Err.Error()
+	}
+	return s
+}
+
 func newError(pt ProblemType, err error) *Error {
 	meta, ok := errorMap[pt]
 	if !ok {
@@ -414,6 +483,11 @@ func (e *Error) Cause() error {
 	return e.Err
 }
 
+// Unwrap returns the internal error, to be used with errors.Is and errors.As.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
 // ToLog implements the EnableLogger interface.
 func (e *Error) ToLog() (interface{}, error) {
 	b, err := json.Marshal(e)
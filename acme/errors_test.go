@@ -2,6 +2,7 @@ package acme
 
 import (
 	"encoding/json"
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -52,3 +53,38 @@ func TestError_WithAdditionalErrorDetail(t *testing.T) {
 		})
 	}
 }
+
+func TestNewSubproblemFromError(t *testing.T) {
+	identifier := Identifier{Type: "dns", Value: "zap.internal"}
+	tests := []struct {
+		name string
+		err  error
+		want Subproblem
+	}{
+		{"acme error", NewError(ErrorRejectedIdentifierType, "dns name not allowed"), Subproblem{
+			Type:       "urn:ietf:params:acme:error:rejectedIdentifier",
+			Detail:     "dns name not allowed",
+			Identifier: &identifier,
+		}},
+		{"wrapped acme error", WrapError(ErrorRejectedIdentifierType, errors.New("force"), "not authorized"), Subproblem{
+			Type:       "urn:ietf:params:acme:error:rejectedIdentifier",
+			Detail:     "not authorized: force",
+			Identifier: &identifier,
+		}},
+		{"internal error", NewErrorISE("force"), Subproblem{
+			Type:       "urn:ietf:params:acme:error:serverInternal",
+			Detail:     "The server experienced an internal error",
+			Identifier: &identifier,
+		}},
+		{"other error", errors.New("force"), Subproblem{
+			Type:       "urn:ietf:params:acme:error:serverInternal",
+			Detail:     "The server experienced an internal error",
+			Identifier: &identifier,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, NewSubproblemFromError(identifier, tt.err))
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package acme
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// GarbageCollectionOptions are the options used to delete the stale resources
+// of an ACME database.
+type GarbageCollectionOptions struct {
+	// Now is the time used to check the expiration of the resources.
+	Now time.Time
+	// OrderTTL returns the time that the orders of a provisioner are kept
+	// after they expire, and false if they must not be deleted.
+	OrderTTL func(provisionerID string) (time.Duration, bool)
+	// AuthorizationTTL returns the time that the authorizations of the
+	// accounts of a provisioner are kept after they expire, and false if they
+	// must not be deleted.
+	AuthorizationTTL func(provisionerID string) (time.Duration, bool)
+	// NonceTTL returns the time that the unused nonces of a provisioner are
+	// kept, and false if they must not be deleted.
+	NonceTTL func(provisionerID string) (time.Duration, bool)
+}
+
+// GarbageCollectionStats contains the number of resources deleted in a
+// garbage collection.
+type GarbageCollectionStats struct {
+	Orders         int
+	Authorizations int
+	Challenges     int
+	Nonces         int
+}
+
+// GarbageCollector is the interface implemented by the databases that can
+// delete stale resources. The challenges of an authorization must be deleted
+// with it, and the authorizations of orders that are not deleted must be
+// kept.
+type GarbageCollector interface {
+	DeleteStaleResources(ctx context.Context, opts GarbageCollectionOptions) (*GarbageCollectionStats, error)
+}
+
+// janitorDefaultInterval is the time between two garbage collections if no
+// provisioner enables them.
+const janitorDefaultInterval = time.Hour
+
+// Janitor periodically deletes the stale orders, authorizations, challenges
+// and nonces of an ACME database, using the garbage collection options of the
+// ACME provisioners.
+type Janitor struct {
+	db           GarbageCollector
+	provisioners func() []Provisioner
+	stop         chan struct{}
+	stopOnce     sync.Once
+}
+
+// NewJanitor returns a janitor for the given database. The provisioners
+// function must return the current ACME provisioners, and it's called on each
+// garbage collection. It returns nil if the database does not support garbage
+// collection.
+func NewJanitor(db DB, provisioners func() []Provisioner) *Janitor {
+	gc, ok := db.(GarbageCollector)
+	if !ok {
+		return nil
+	}
+	return &Janitor{
+		db:           gc,
+		provisioners: provisioners,
+		stop:         make(chan struct{}),
+	}
+}
+
+// Run runs the garbage collections until Stop is called.
+func (j *Janitor) Run() {
+	timer := time.NewTimer(j.interval())
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-j.stop:
+			return
+		case <-timer.C:
+			if _, err := j.Collect(context.Background()); err != nil {
+				log.Printf("error deleting stale ACME resources: %v", err)
+			}
+			timer.Reset(j.interval())
+		}
+	}
+}
+
+// Stop stops the garbage collections.
+func (j *Janitor) Stop() {
+	j.stopOnce.Do(func() {
+		close(j.stop)
+	})
+}
+
+// Collect deletes the stale resources of the provisioners enabling garbage
+// collection.
+func (j *Janitor) Collect(ctx context.Context) (*GarbageCollectionStats, error) {
+	opts, ok := garbageCollectionOptions(j.provisioners(), clock.Now())
+	if !ok {
+		return &GarbageCollectionStats{}, nil
+	}
+	return j.db.DeleteStaleResources(ctx, opts)
+}
+
+// interval returns the time until the next garbage collection, the shortest
+// interval of the provisioners enabling garbage collection.
+func (j *Janitor) interval() time.Duration {
+	var d time.Duration
+	for _, p := range j.provisioners() {
+		if gc := p.GetACMEOptions().GarbageCollection; gc != nil {
+			if i := gc.GetInterval(); d == 0 || i < d {
+				d = i
+			}
+		}
+	}
+	if d == 0 {
+		return janitorDefaultInterval
+	}
+	return d
+}
+
+// garbageCollectionOptions returns the garbage collection options for the
+// given provisioners, and false if none of them enables garbage collection.
+func garbageCollectionOptions(provisioners []Provisioner, now time.Time) (GarbageCollectionOptions, bool) {
+	var minNonceTTL time.Duration
+	orderTTLs := make(map[string]time.Duration)
+	authzTTLs := make(map[string]time.Duration)
+	nonceTTLs := make(map[string]time.Duration)
+	for _, p := range provisioners {
+		gc := p.GetACMEOptions().GarbageCollection
+		if gc == nil {
+			continue
+		}
+		orderTTLs[p.GetID()] = gc.GetOrderTTL()
+		authzTTLs[p.GetID()] = gc.GetAuthorizationTTL()
+		ttl := gc.GetNonceTTL()
+		nonceTTLs[p.GetID()] = ttl
+		if minNonceTTL == 0 || ttl < minNonceTTL {
+			minNonceTTL = ttl
+		}
+	}
+	if len(orderTTLs) == 0 {
+		return GarbageCollectionOptions{}, false
+	}
+
+	return GarbageCollectionOptions{
+		Now: now,
+		OrderTTL: func(provisionerID string) (time.Duration, bool) {
+			ttl, ok := orderTTLs[provisionerID]
+			return ttl, ok
+		},
+		AuthorizationTTL: func(provisionerID string) (time.Duration, bool) {
+			ttl, ok := authzTTLs[provisionerID]
+			return ttl, ok
+		},
+		// Nonces created before the provisioner was stored with them, or by
+		// provisioners without garbage collection, use the shortest TTL.
+		NonceTTL: func(provisionerID string) (time.Duration, bool) {
+			if ttl, ok := nonceTTLs[provisionerID]; ok {
+				return ttl, true
+			}
+			return minNonceTTL, true
+		},
+	}, true
+}
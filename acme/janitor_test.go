@@ -0,0 +1,173 @@
+package acme
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func gcProvisioner(id string, gc *provisioner.ACMEGarbageCollection) Provisioner {
+	return &MockProvisioner{
+		MgetID: func() string { return id },
+		MgetACMEOptions: func() provisioner.ACMEOptions {
+			return provisioner.ACMEOptions{GarbageCollection: gc}
+		},
+	}
+}
+
+func TestNewJanitor(t *testing.T) {
+	provs := func() []Provisioner { return nil }
+	assert.NotNil(t, NewJanitor(&MockDB{}, provs))
+
+	type db struct{ DB }
+	assert.Nil(t, NewJanitor(db{}, provs))
+}
+
+func Test_garbageCollectionOptions(t *testing.T) {
+	now := clock.Now()
+
+	_, ok := garbageCollectionOptions(nil, now)
+	assert.False(t, ok)
+	_, ok = garbageCollectionOptions([]Provisioner{gcProvisioner("p1", nil)}, now)
+	assert.False(t, ok)
+
+	opts, ok := garbageCollectionOptions([]Provisioner{
+		gcProvisioner("p1", nil),
+		gcProvisioner("p2", &provisioner.ACMEGarbageCollection{}),
+		gcProvisioner("p3", &provisioner.ACMEGarbageCollection{
+			OrderTTL:         &provisioner.Duration{Duration: time.Hour},
+			AuthorizationTTL: &provisioner.Duration{Duration: 2 * time.Hour},
+			NonceTTL:         &provisioner.Duration{Duration: time.Minute},
+		}),
+	}, now)
+	require.True(t, ok)
+	assert.Equal(t, now, opts.Now)
+
+	ttl, ok := opts.NonceTTL("p2")
+	assert.True(t, ok)
+	assert.Equal(t, 24*time.Hour, ttl)
+	ttl, ok = opts.NonceTTL("p3")
+	assert.True(t, ok)
+	assert.Equal(t, time.Minute, ttl)
+	ttl, ok = opts.NonceTTL("")
+	assert.True(t, ok)
+	assert.Equal(t, time.Minute, ttl)
+	ttl, ok = opts.NonceTTL("p1")
+	assert.True(t, ok)
+	assert.Equal(t, time.Minute, ttl)
+
+	ttl, ok = opts.OrderTTL("p1")
+	assert.False(t, ok)
+	assert.Zero(t, ttl)
+	ttl, ok = opts.OrderTTL("p2")
+	assert.True(t, ok)
+	assert.Equal(t, 7*24*time.Hour, ttl)
+	ttl, ok = opts.OrderTTL("p3")
+	assert.True(t, ok)
+	assert.Equal(t, time.Hour, ttl)
+
+	ttl, ok = opts.AuthorizationTTL("")
+	assert.False(t, ok)
+	assert.Zero(t, ttl)
+	ttl, ok = opts.AuthorizationTTL("p2")
+	assert.True(t, ok)
+	assert.Equal(t, 7*24*time.Hour, ttl)
+	ttl, ok = opts.AuthorizationTTL("p3")
+	assert.True(t, ok)
+	assert.Equal(t, 2*time.Hour, ttl)
+}
+
+func TestJanitor_Collect(t *testing.T) {
+	var provs []Provisioner
+	var called int
+	db := &MockDB{
+		MockDeleteStaleResources: func(ctx context.Context, opts GarbageCollectionOptions) (*GarbageCollectionStats, error) {
+			called++
+			ttl, ok := opts.OrderTTL("p1")
+			assert.True(t, ok)
+			assert.Equal(t, time.Hour, ttl)
+			return &GarbageCollectionStats{Orders: 1, Nonces: 2}, nil
+		},
+	}
+	j := NewJanitor(db, func() []Provisioner { return provs })
+
+	// Nothing is deleted without garbage collection options.
+	stats, err := j.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, &GarbageCollectionStats{}, stats)
+	assert.Equal(t, 0, called)
+
+	provs = []Provisioner{gcProvisioner("p1", &provisioner.ACMEGarbageCollection{
+		OrderTTL: &provisioner.Duration{Duration: time.Hour},
+	})}
+	stats, err = j.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, &GarbageCollectionStats{Orders: 1, Nonces: 2}, stats)
+	assert.Equal(t, 1, called)
+
+	db.MockDeleteStaleResources = nil
+	db.MockError = errors.New("force")
+	_, err = j.Collect(context.Background())
+	assert.EqualError(t, err, "force")
+}
+
+func TestJanitor_interval(t *testing.T) {
+	var provs []Provisioner
+	j := NewJanitor(&MockDB{}, func() []Provisioner { return provs })
+	assert.Equal(t, time.Hour, j.interval())
+
+	provs = []Provisioner{
+		gcProvisioner("p1", nil),
+		gcProvisioner("p2", &provisioner.ACMEGarbageCollection{
+			Interval: &provisioner.Duration{Duration: 10 * time.Minute},
+		}),
+		gcProvisioner("p3", &provisioner.ACMEGarbageCollection{
+			Interval: &provisioner.Duration{Duration: 5 * time.Minute},
+		}),
+	}
+	assert.Equal(t, 5*time.Minute, j.interval())
+}
+
+func TestJanitor_Run(t *testing.T) {
+	var once sync.Once
+	done := make(chan struct{})
+	db := &MockDB{
+		MockDeleteStaleResources: func(ctx context.Context, opts GarbageCollectionOptions) (*GarbageCollectionStats, error) {
+			once.Do(func() { close(done) })
+			return &GarbageCollectionStats{}, nil
+		},
+	}
+	j := NewJanitor(db, func() []Provisioner {
+		return []Provisioner{gcProvisioner("p1", &provisioner.ACMEGarbageCollection{
+			Interval: &provisioner.Duration{Duration: time.Millisecond},
+		})}
+	})
+
+	stopped := make(chan struct{})
+	go func() {
+		j.Run()
+		close(stopped)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("garbage collection was not run")
+	}
+
+	// Stop can be called more than once.
+	j.Stop()
+	j.Stop()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("janitor was not stopped")
+	}
+}
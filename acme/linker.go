@@ -46,6 +46,12 @@ const (
 	RevokeCertLinkType
 	// KeyChangeLinkType key rollover
 	KeyChangeLinkType
+	// StarCertificateLinkType certificate of an auto-renewal order
+	StarCertificateLinkType
+	// RenewalInfoLinkType renewal information of a certificate
+	RenewalInfoLinkType
+	// EmailReplyLinkType replies of email-reply-00 challenges
+	EmailReplyLinkType
 )
 
 func (l LinkType) String() string {
@@ -74,6 +80,12 @@ func (l LinkType) String() string {
 		return "revoke-cert"
 	case KeyChangeLinkType:
 		return "key-change"
+	case StarCertificateLinkType:
+		return "star-certificate"
+	case RenewalInfoLinkType:
+		return "renewal-info"
+	case EmailReplyLinkType:
+		return "email-reply"
 	default:
 		return fmt.Sprintf("unexpected LinkType '%d'", int(l))
 	}
@@ -81,9 +93,15 @@ func (l LinkType) String() string {
 
 func GetUnescapedPathSuffix(typ LinkType, provisionerName string, inputs ...string) string {
 	switch typ {
-	case NewNonceLinkType, NewAccountLinkType, NewOrderLinkType, NewAuthzLinkType, DirectoryLinkType, KeyChangeLinkType, RevokeCertLinkType:
+	case NewNonceLinkType, NewAccountLinkType, NewOrderLinkType, NewAuthzLinkType, DirectoryLinkType, KeyChangeLinkType, RevokeCertLinkType, EmailReplyLinkType:
 		return fmt.Sprintf("/%s/%s", provisionerName, typ)
-	case AccountLinkType, OrderLinkType, AuthzLinkType, CertificateLinkType:
+	case AccountLinkType, OrderLinkType, AuthzLinkType, StarCertificateLinkType:
+		return fmt.Sprintf("/%s/%s/%s", provisionerName, typ, inputs[0])
+	case CertificateLinkType:
+		// Alternate chains of a certificate are identified by their index.
+		if len(inputs) > 1 {
+			return fmt.Sprintf("/%s/%s/%s/%s", provisionerName, typ, inputs[0], inputs[1])
+		}
 		return fmt.Sprintf("/%s/%s/%s", provisionerName, typ, inputs[0])
 	case ChallengeLinkType:
 		return fmt.Sprintf("/%s/%s/%s/%s", provisionerName, typ, inputs[0], inputs[1])
@@ -91,6 +109,13 @@ func GetUnescapedPathSuffix(typ LinkType, provisionerName string, inputs ...stri
 		return fmt.Sprintf("/%s/%s/%s/orders", provisionerName, AccountLinkType, inputs[0])
 	case FinalizeLinkType:
 		return fmt.Sprintf("/%s/%s/%s/finalize", provisionerName, OrderLinkType, inputs[0])
+	case RenewalInfoLinkType:
+		// The directory links to the base path, the clients append the
+		// certificate identifier.
+		if len(inputs) == 0 {
+			return fmt.Sprintf("/%s/%s", provisionerName, typ)
+		}
+		return fmt.Sprintf("/%s/%s/%s", provisionerName, typ, inputs[0])
 	default:
 		return ""
 	}
@@ -237,7 +262,13 @@ func (l *linker) LinkOrder(ctx context.Context, o *Order) {
 	}
 	o.FinalizeURL = l.GetLink(ctx, FinalizeLinkType, o.ID)
 	if o.CertificateID != "" {
-		o.CertificateURL = l.GetLink(ctx, CertificateLinkType, o.CertificateID)
+		// Auto-renewal orders link to the certificate that is renewed
+		// periodically, RFC 8739.
+		if o.AutoRenewal != nil {
+			o.StarCertificateURL = l.GetLink(ctx, StarCertificateLinkType, o.ID)
+		} else {
+			o.CertificateURL = l.GetLink(ctx, CertificateLinkType, o.CertificateID)
+		}
 	}
 }
 
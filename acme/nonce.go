@@ -1,5 +1,7 @@
 package acme
 
+import "context"
+
 // Nonce represents an ACME nonce type.
 type Nonce string
 
@@ -7,3 +9,29 @@ type Nonce string
 func (n Nonce) String() string {
 	return string(n)
 }
+
+// NonceStore is the interface used to create and consume the ACME nonces. A
+// nonce must be consumed only once, even if multiple CA replicas share the
+// store. The ACME database implements it.
+type NonceStore interface {
+	CreateNonce(ctx context.Context) (Nonce, error)
+	DeleteNonce(ctx context.Context, nonce Nonce) error
+}
+
+type nonceStoreKey struct{}
+
+// NewNonceStoreContext adds the given nonce store to the context. It allows
+// to use a different backend than the ACME database for the nonces.
+func NewNonceStoreContext(ctx context.Context, s NonceStore) context.Context {
+	return context.WithValue(ctx, nonceStoreKey{}, s)
+}
+
+// MustNonceStoreFromContext returns the nonce store in the given context, or
+// the ACME database if the context does not have a nonce store. It will panic
+// if none of them are in the context.
+func MustNonceStoreFromContext(ctx context.Context) NonceStore {
+	if s, ok := ctx.Value(nonceStoreKey{}).(NonceStore); ok {
+		return s
+	}
+	return MustDatabaseFromContext(ctx)
+}
@@ -0,0 +1,23 @@
+package acme
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMustNonceStoreFromContext(t *testing.T) {
+	db := &MockDB{}
+	ctx := NewDatabaseContext(context.Background(), db)
+	assert.Equal(t, db, MustNonceStoreFromContext(ctx))
+
+	store := &MockDB{MockError: errors.New("force")}
+	ctx = NewNonceStoreContext(ctx, store)
+	assert.Equal(t, store, MustNonceStoreFromContext(ctx))
+
+	assert.Panics(t, func() {
+		MustNonceStoreFromContext(context.Background())
+	})
+}
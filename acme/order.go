@@ -7,10 +7,13 @@ import (
 	"crypto/x509"
 	"encoding/json"
 	"net"
+	"net/mail"
+	"slices"
 	"sort"
 	"strings"
 	"time"
 
+	"github.com/pkg/errors"
 	"github.com/smallstep/certificates/authority/provisioner"
 	"go.step.sm/crypto/keyutil"
 	"go.step.sm/crypto/x509util"
@@ -26,8 +29,24 @@ const (
 	// PermanentIdentifier is the ACME permanent-identifier identifier type
 	// defined in https://datatracker.ietf.org/doc/html/draft-bweeks-acme-device-attest-00
 	PermanentIdentifier IdentifierType = "permanent-identifier"
+	// Email is the ACME email identifier type defined in RFC 8823
+	Email IdentifierType = "email"
 )
 
+// defaultEmailLeafTemplate is the template used by default on orders with
+// only email identifiers. The only difference with the DefaultLeafTemplate is
+// that the extended key usage is limited to "emailProtection".
+const defaultEmailLeafTemplate = `{
+	"subject": {{ toJson .Subject }},
+	"sans": {{ toJson .SANs }},
+{{- if typeIs "*rsa.PublicKey" .Insecure.CR.PublicKey }}
+	"keyUsage": ["keyEncipherment", "digitalSignature"],
+{{- else }}
+	"keyUsage": ["digitalSignature"],
+{{- end }}
+	"extKeyUsage": ["emailProtection"]
+}`
+
 // Identifier encodes the type that an order pertains to.
 type Identifier struct {
 	Type  IdentifierType `json:"type"`
@@ -44,12 +63,18 @@ type Order struct {
 	Identifiers       []Identifier `json:"identifiers"`
 	NotBefore         time.Time    `json:"notBefore"`
 	NotAfter          time.Time    `json:"notAfter"`
+	Profile           string       `json:"profile,omitempty"`
+	AutoRenewal       *AutoRenewal `json:"auto-renewal,omitempty"`
 	Error             *Error       `json:"error,omitempty"`
 	AuthorizationIDs  []string     `json:"-"`
 	AuthorizationURLs []string     `json:"authorizations"`
 	FinalizeURL       string       `json:"finalize"`
 	CertificateID     string       `json:"-"`
 	CertificateURL    string       `json:"certificate,omitempty"`
+	// CertificateRequest is the CSR in DER format used to finalize an
+	// auto-renewal order, it is used to sign the renewed certificates.
+	CertificateRequest []byte `json:"-"`
+	StarCertificateURL string `json:"star-certificate,omitempty"`
 }
 
 // ToLog enables response logging.
@@ -69,7 +94,7 @@ func (o *Order) UpdateStatus(ctx context.Context, db DB) error {
 	switch o.Status {
 	case StatusInvalid:
 		return nil
-	case StatusValid:
+	case StatusValid, StatusCanceled:
 		return nil
 	case StatusReady:
 		// Check expiry
@@ -92,6 +117,7 @@ func (o *Order) UpdateStatus(ctx context.Context, db DB) error {
 			StatusInvalid: 0,
 			StatusPending: 0,
 		}
+		var subproblems []Subproblem
 		for _, azID := range o.AuthorizationIDs {
 			az, err := db.GetAuthorization(ctx, azID)
 			if err != nil {
@@ -102,10 +128,15 @@ func (o *Order) UpdateStatus(ctx context.Context, db DB) error {
 			}
 			st := az.Status
 			count[st]++
+			if st == StatusInvalid {
+				subproblems = append(subproblems, authorizationSubproblem(az))
+			}
 		}
 		switch {
 		case count[StatusInvalid] > 0:
 			o.Status = StatusInvalid
+			o.Error = NewError(ErrorCompoundType, "%d of %d authorizations are invalid",
+				count[StatusInvalid], len(o.AuthorizationIDs)).AddSubproblems(subproblems...)
 
 		// No change in the order status, so just return the order as is -
 		// without writing any changes.
@@ -127,6 +158,23 @@ func (o *Order) UpdateStatus(ctx context.Context, db DB) error {
 	return nil
 }
 
+// authorizationSubproblem returns the subproblem reported in an order for an
+// invalid authorization. The error of the authorization, or the first error of
+// its challenges, is used if present.
+func authorizationSubproblem(az *Authorization) Subproblem {
+	err := az.Error
+	for _, ch := range az.Challenges {
+		if err != nil {
+			break
+		}
+		err = ch.Error
+	}
+	if err == nil {
+		return NewSubproblemWithIdentifier(ErrorMalformedType, az.Identifier, "authorization has expired")
+	}
+	return NewSubproblemFromError(az.Identifier, err)
+}
+
 // getAuthorizationFingerprint returns a fingerprint from the list of authorizations. This
 // fingerprint is used on the device-attest-01 flow to verify the attestation
 // certificate public key with the CSR public key.
@@ -163,7 +211,7 @@ func (o *Order) Finalize(ctx context.Context, db DB, csr *x509.CertificateReques
 	switch o.Status {
 	case StatusInvalid:
 		return NewError(ErrorOrderNotReadyType, "order %s has been abandoned", o.ID)
-	case StatusValid:
+	case StatusValid, StatusCanceled:
 		return nil
 	case StatusPending:
 		return NewError(ErrorOrderNotReadyType, "order %s is not ready", o.ID)
@@ -173,26 +221,68 @@ func (o *Order) Finalize(ctx context.Context, db DB, csr *x509.CertificateReques
 		return NewErrorISE("unexpected status %s for order %s", o.Status, o.ID)
 	}
 
+	// The certificates of auto-renewal orders are valid for the current
+	// period, and the CSR is kept to sign the next ones.
+	notBefore, notAfter := o.NotBefore, o.NotAfter
+	if o.AutoRenewal != nil {
+		notBefore, notAfter = o.AutoRenewal.validity(clock.Now())
+		o.CertificateRequest = csr.Raw
+	}
+
+	cert, err := o.sign(ctx, db, csr, auth, p, notBefore, notAfter)
+	if err != nil {
+		return err
+	}
+
+	o.CertificateID = cert.ID
+	o.Status = StatusValid
+	if err = db.UpdateOrder(ctx, o); err != nil {
+		return WrapErrorISE(err, "error updating order %s", o.ID)
+	}
+	return nil
+}
+
+// sign validates the CSR against the order and signs and stores a new
+// certificate with the given validity.
+func (o *Order) sign(ctx context.Context, db DB, csr *x509.CertificateRequest, auth CertificateAuthority, p Provisioner, notBefore, notAfter time.Time) (*Certificate, error) {
 	// Get key fingerprint if any. And then compare it with the CSR fingerprint.
 	//
 	// In device-attest-01 challenges we should check that the keys in the CSR
 	// and the attestation certificate are the same.
 	fingerprint, err := o.getAuthorizationFingerprint(ctx, db)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if fingerprint != "" {
 		fp, err := keyutil.Fingerprint(csr.PublicKey)
 		if err != nil {
-			return WrapErrorISE(err, "error calculating key fingerprint")
+			return nil, WrapErrorISE(err, "error calculating key fingerprint")
 		}
 		if subtle.ConstantTimeCompare([]byte(fingerprint), []byte(fp)) == 0 {
-			return NewError(ErrorUnauthorizedType, "order %s csr does not match the attested key", o.ID)
+			return nil, NewError(ErrorUnauthorizedType, "order %s csr does not match the attested key", o.ID)
 		}
 	}
 
-	// canonicalize the CSR to allow for comparison
-	csr = canonicalize(csr)
+	var permanentIdentifier string
+	for i := range o.Identifiers {
+		if o.Identifiers[i].Type == PermanentIdentifier {
+			permanentIdentifier = o.Identifiers[i].Value
+			break
+		}
+	}
+	// Orders can combine the permanent identifier with other identifiers.
+	mixed := permanentIdentifier != "" && numberOfIdentifierType(PermanentIdentifier, o.Identifiers) < len(o.Identifiers)
+
+	// canonicalize the CSR to allow for comparison. In mixed orders, a Common
+	// Name equal to the permanent identifier is not compared with the other
+	// identifiers.
+	if mixed && csr.Subject.CommonName == permanentIdentifier {
+		csr.Subject.CommonName = ""
+		csr = canonicalize(csr)
+		csr.Subject.CommonName = permanentIdentifier
+	} else {
+		csr = canonicalize(csr)
+	}
 
 	// Template data
 	data := x509util.NewTemplateData()
@@ -201,26 +291,36 @@ func (o *Order) Finalize(ctx context.Context, db DB, csr *x509.CertificateReques
 	// Custom sign options passed to authority.Sign
 	var extraOptions []provisioner.SignOption
 
-	// TODO: support for multiple identifiers?
-	var permanentIdentifier string
-	for i := range o.Identifiers {
-		if o.Identifiers[i].Type == PermanentIdentifier {
-			permanentIdentifier = o.Identifiers[i].Value
-			// the first (and only) Permanent Identifier that gets added to the certificate
-			// should be equal to the Subject Common Name if it's set. If not equal, the CSR
-			// is rejected, because the Common Name hasn't been challenged in that case. This
-			// could result in unauthorized access if a relying system relies on the Common
-			// Name in its authorization logic.
-			if csr.Subject.CommonName != "" && csr.Subject.CommonName != permanentIdentifier {
-				return NewError(ErrorBadCSRType, "CSR Subject Common Name does not match identifiers exactly: "+
-					"CSR Subject Common Name = %s, Order Permanent Identifier = %s", csr.Subject.CommonName, permanentIdentifier)
-			}
-			break
-		}
+	// The Permanent Identifier that gets added to the certificate should be
+	// equal to the Subject Common Name if it's set. If not equal, the CSR is
+	// rejected, because the Common Name hasn't been challenged in that case.
+	// This could result in unauthorized access if a relying system relies on
+	// the Common Name in its authorization logic. In mixed orders the Common
+	// Name can also be one of the other identifiers, this is checked with the
+	// SANs.
+	if permanentIdentifier != "" && !mixed && csr.Subject.CommonName != "" && csr.Subject.CommonName != permanentIdentifier {
+		return nil, NewError(ErrorBadCSRType, "CSR Subject Common Name does not match identifiers exactly: "+
+			"CSR Subject Common Name = %s, Order Permanent Identifier = %s", csr.Subject.CommonName, permanentIdentifier)
 	}
 
 	var defaultTemplate string
-	if permanentIdentifier != "" {
+	switch {
+	case mixed:
+		// The certificate is used by the attested device with the other
+		// identifiers, e.g. as a TLS server.
+		defaultTemplate = x509util.DefaultLeafTemplate
+		sans, err := o.sans(csr, p.GetACMEOptions().AllowIdentifierSubset)
+		if err != nil {
+			return nil, err
+		}
+		data.SetSubjectAlternativeNames(append([]x509util.SubjectAlternativeName{{
+			Type:  x509util.PermanentIdentifierType,
+			Value: permanentIdentifier,
+		}}, sans...)...)
+		extraOptions = append(extraOptions, provisioner.AttestationData{
+			PermanentIdentifier: permanentIdentifier,
+		})
+	case permanentIdentifier != "":
 		defaultTemplate = x509util.DefaultAttestedLeafTemplate
 		data.SetSubjectAlternativeNames(x509util.SubjectAlternativeName{
 			Type:  x509util.PermanentIdentifierType,
@@ -229,33 +329,38 @@ func (o *Order) Finalize(ctx context.Context, db DB, csr *x509.CertificateReques
 		extraOptions = append(extraOptions, provisioner.AttestationData{
 			PermanentIdentifier: permanentIdentifier,
 		})
-	} else {
+	default:
 		defaultTemplate = x509util.DefaultLeafTemplate
-		sans, err := o.sans(csr)
+		if numberOfIdentifierType(Email, o.Identifiers) == len(o.Identifiers) {
+			defaultTemplate = defaultEmailLeafTemplate
+		}
+		sans, err := o.sans(csr, p.GetACMEOptions().AllowIdentifierSubset)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		data.SetSubjectAlternativeNames(sans...)
 	}
 
+	// The webhooks of the provisioner receive the order and its account, and
+	// the enriching webhooks add their data to the template data.
+	acc, err := db.GetAccount(ctx, o.AccountID)
+	if err != nil {
+		return nil, WrapErrorISE(err, "error retrieving account %s", o.AccountID)
+	}
+
 	// Get authorizations from the ACME provisioner.
 	ctx = provisioner.NewContextWithMethod(ctx, provisioner.SignMethod)
+	ctx = provisioner.NewContextWithACMEOrder(ctx, o.webhookOrder(acc, data))
+	if o.Profile != "" {
+		ctx = provisioner.NewContextWithACMEProfile(ctx, o.Profile)
+	}
 	signOps, err := p.AuthorizeSign(ctx, "")
 	if err != nil {
-		return WrapErrorISE(err, "error retrieving authorization options from ACME provisioner")
-	}
-	// Unlike most of the provisioners, ACME's AuthorizeSign method doesn't
-	// define the templates, and the template data used in WebHooks is not
-	// available.
-	for _, signOp := range signOps {
-		if wc, ok := signOp.(*provisioner.WebhookController); ok {
-			wc.TemplateData = data
-		}
+		return nil, WrapErrorISE(err, "error retrieving authorization options from ACME provisioner")
 	}
-
-	templateOptions, err := provisioner.CustomTemplateOptions(p.GetOptions(), data, defaultTemplate)
+	templateOptions, err := provisioner.CustomTemplateOptions(p.GetProfileOptions(o.Profile), data, defaultTemplate)
 	if err != nil {
-		return WrapErrorISE(err, "error creating template options from ACME provisioner")
+		return nil, WrapErrorISE(err, "error creating template options from ACME provisioner")
 	}
 
 	// Build extra signing options.
@@ -264,11 +369,15 @@ func (o *Order) Finalize(ctx context.Context, db DB, csr *x509.CertificateReques
 
 	// Sign a new certificate.
 	certChain, err := auth.SignWithContext(ctx, csr, provisioner.SignOptions{
-		NotBefore: provisioner.NewTimeDuration(o.NotBefore),
-		NotAfter:  provisioner.NewTimeDuration(o.NotAfter),
+		NotBefore: provisioner.NewTimeDuration(notBefore),
+		NotAfter:  provisioner.NewTimeDuration(notAfter),
 	}, signOps...)
 	if err != nil {
-		return WrapErrorISE(err, "error signing certificate for order %s", o.ID)
+		// The CAA records are checked by the authority just before signing.
+		if errors.Is(errors.Cause(err), provisioner.ErrCAAForbidden) {
+			return nil, WrapDetailedError(ErrorCaaType, err, "error signing certificate for order %s", o.ID)
+		}
+		return nil, WrapErrorISE(err, "error signing certificate for order %s", o.ID)
 	}
 
 	cert := &Certificate{
@@ -278,28 +387,54 @@ func (o *Order) Finalize(ctx context.Context, db DB, csr *x509.CertificateReques
 		Intermediates: certChain[1:],
 	}
 	if err := db.CreateCertificate(ctx, cert); err != nil {
-		return WrapErrorISE(err, "error creating certificate for order %s", o.ID)
+		return nil, WrapErrorISE(err, "error creating certificate for order %s", o.ID)
 	}
+	return cert, nil
+}
 
-	o.CertificateID = cert.ID
-	o.Status = StatusValid
-	if err = db.UpdateOrder(ctx, o); err != nil {
-		return WrapErrorISE(err, "error updating order %s", o.ID)
+// webhookOrder returns the order and account sent to the webhooks of the
+// provisioner, and the template data that the enriching webhooks modify.
+func (o *Order) webhookOrder(acc *Account, data x509util.TemplateData) *provisioner.ACMEOrder {
+	identifiers := make([]provisioner.ACMEIdentifier, len(o.Identifiers))
+	for i, id := range o.Identifiers {
+		identifiers[i] = provisioner.ACMEIdentifier{
+			Type:  provisioner.ACMEIdentifierType(id.Type),
+			Value: id.Value,
+		}
+	}
+	var keyID string
+	if acc.Key != nil {
+		keyID = acc.Key.KeyID
+	}
+	return &provisioner.ACMEOrder{
+		ID:          o.ID,
+		Identifiers: identifiers,
+		Profile:     o.Profile,
+		Account: provisioner.ACMEAccount{
+			ID:      acc.ID,
+			KeyID:   keyID,
+			Contact: acc.Contact,
+		},
+		TemplateData: data,
 	}
-	return nil
 }
 
-func (o *Order) sans(csr *x509.CertificateRequest) ([]x509util.SubjectAlternativeName, error) {
+// sans returns the subject alternative names of the CSR after validating them
+// against the order identifiers. The CSR must contain the exact same set of
+// identifiers as the order, unless subset is true, in which case the CSR can
+// omit some of them.
+func (o *Order) sans(csr *x509.CertificateRequest, subset bool) ([]x509util.SubjectAlternativeName, error) {
 	var sans []x509util.SubjectAlternativeName
-	if len(csr.EmailAddresses) > 0 || len(csr.URIs) > 0 {
-		return sans, NewError(ErrorBadCSRType, "Only DNS names and IP addresses are allowed")
+	if len(csr.URIs) > 0 {
+		return sans, NewError(ErrorBadCSRType, "Only DNS names, IP addresses and email addresses are allowed")
 	}
 
 	// order the DNS names and IP addresses, so that they can be compared against the canonicalized CSR
 	orderNames := make([]string, numberOfIdentifierType(DNS, o.Identifiers))
 	orderIPs := make([]net.IP, numberOfIdentifierType(IP, o.Identifiers))
 	orderPIDs := make([]string, numberOfIdentifierType(PermanentIdentifier, o.Identifiers))
-	indexDNS, indexIP, indexPID := 0, 0, 0
+	orderEmails := make([]string, numberOfIdentifierType(Email, o.Identifiers))
+	indexDNS, indexIP, indexPID, indexEmail := 0, 0, 0, 0
 	for _, n := range o.Identifiers {
 		switch n.Type {
 		case DNS:
@@ -311,14 +446,18 @@ func (o *Order) sans(csr *x509.CertificateRequest) ([]x509util.SubjectAlternativ
 		case PermanentIdentifier:
 			orderPIDs[indexPID] = n.Value
 			indexPID++
+		case Email:
+			orderEmails[indexEmail] = n.Value
+			indexEmail++
 		default:
 			return sans, NewErrorISE("unsupported identifier type in order: %s", n.Type)
 		}
 	}
 	orderNames = uniqueSortedLowerNames(orderNames)
 	orderIPs = uniqueSortedIPs(orderIPs)
+	orderEmails = uniqueSortedLowerNames(orderEmails)
 
-	totalNumberOfSANs := len(csr.DNSNames) + len(csr.IPAddresses)
+	totalNumberOfSANs := len(csr.DNSNames) + len(csr.IPAddresses) + len(csr.EmailAddresses)
 	sans = make([]x509util.SubjectAlternativeName, totalNumberOfSANs)
 	index := 0
 
@@ -327,6 +466,46 @@ func (o *Order) sans(csr *x509.CertificateRequest) ([]x509util.SubjectAlternativ
 	// Note that with certificate templates we are not going to check for the
 	// absence of other SANs as they will only be set if the template allows
 	// them.
+	if subset {
+		if totalNumberOfSANs == 0 {
+			return sans, NewError(ErrorBadCSRType, "CSR does not contain any identifier")
+		}
+		for i := range csr.DNSNames {
+			if !slices.Contains(orderNames, csr.DNSNames[i]) {
+				return sans, NewError(ErrorBadCSRType, "CSR names are not a subset of identifiers: "+
+					"CSR names = %v, Order names = %v", csr.DNSNames, orderNames)
+			}
+			sans[index] = x509util.SubjectAlternativeName{
+				Type:  x509util.DNSType,
+				Value: csr.DNSNames[i],
+			}
+			index++
+		}
+		for i := range csr.IPAddresses {
+			if !slices.ContainsFunc(orderIPs, func(ip net.IP) bool { return ipsAreEqual(csr.IPAddresses[i], ip) }) {
+				return sans, NewError(ErrorBadCSRType, "CSR IPs are not a subset of identifiers: "+
+					"CSR IPs = %v, Order IPs = %v", csr.IPAddresses, orderIPs)
+			}
+			sans[index] = x509util.SubjectAlternativeName{
+				Type:  x509util.IPType,
+				Value: csr.IPAddresses[i].String(),
+			}
+			index++
+		}
+		for i := range csr.EmailAddresses {
+			if !slices.Contains(orderEmails, csr.EmailAddresses[i]) {
+				return sans, NewError(ErrorBadCSRType, "CSR emails are not a subset of identifiers: "+
+					"CSR emails = %v, Order emails = %v", csr.EmailAddresses, orderEmails)
+			}
+			sans[index] = x509util.SubjectAlternativeName{
+				Type:  x509util.EmailType,
+				Value: csr.EmailAddresses[i],
+			}
+			index++
+		}
+		return sans, nil
+	}
+
 	if len(csr.DNSNames) != len(orderNames) {
 		return sans, NewError(ErrorBadCSRType, "CSR names do not match identifiers exactly: "+
 			"CSR names = %v, Order names = %v", csr.DNSNames, orderNames)
@@ -361,6 +540,23 @@ func (o *Order) sans(csr *x509.CertificateRequest) ([]x509util.SubjectAlternativ
 		index++
 	}
 
+	if len(csr.EmailAddresses) != len(orderEmails) {
+		return sans, NewError(ErrorBadCSRType, "CSR emails do not match identifiers exactly: "+
+			"CSR emails = %v, Order emails = %v", csr.EmailAddresses, orderEmails)
+	}
+
+	for i := range csr.EmailAddresses {
+		if csr.EmailAddresses[i] != orderEmails[i] {
+			return sans, NewError(ErrorBadCSRType, "CSR emails do not match identifiers exactly: "+
+				"CSR emails = %v, Order emails = %v", csr.EmailAddresses, orderEmails)
+		}
+		sans[index] = x509util.SubjectAlternativeName{
+			Type:  x509util.EmailType,
+			Value: csr.EmailAddresses[i],
+		}
+		index++
+	}
+
 	return sans, nil
 }
 
@@ -379,8 +575,9 @@ func numberOfIdentifierType(typ IdentifierType, ids []Identifier) int {
 // canonicalize canonicalizes a CSR so that it can be compared against an Order
 // NOTE: this effectively changes the order of SANs in the CSR, which may be OK,
 // but may not be expected. It also adds a Subject Common Name to either the IP
-// addresses or DNS names slice, depending on whether it can be parsed as an IP
-// or not. This might result in an additional SAN in the final certificate.
+// addresses, email addresses or DNS names slice, depending on whether it can be
+// parsed as an IP, an email or not. This might result in an additional SAN in
+// the final certificate.
 func canonicalize(csr *x509.CertificateRequest) (canonicalized *x509.CertificateRequest) {
 	// for clarity only; we're operating on the same object by pointer
 	canonicalized = csr
@@ -390,12 +587,15 @@ func canonicalize(csr *x509.CertificateRequest) (canonicalized *x509.Certificate
 	// MUST appear either in the commonName portion of the requested subject
 	// name or in an extensionRequest attribute [RFC2985] requesting a
 	// subjectAltName extension, or both. Subject Common Names that can be
-	// parsed as an IP are included as an IP address for the equality check.
+	// parsed as an IP are included as an IP address for the equality check,
+	// and the ones that are email addresses are included as emails.
 	// If these were excluded, a certificate could contain an IP as the
 	// common name without having been challenged.
 	if csr.Subject.CommonName != "" {
 		if ip := net.ParseIP(csr.Subject.CommonName); ip != nil {
 			canonicalized.IPAddresses = append(canonicalized.IPAddresses, ip)
+		} else if isEmailAddress(csr.Subject.CommonName) {
+			canonicalized.EmailAddresses = append(canonicalized.EmailAddresses, csr.Subject.CommonName)
 		} else {
 			canonicalized.DNSNames = append(canonicalized.DNSNames, csr.Subject.CommonName)
 		}
@@ -403,10 +603,19 @@ func canonicalize(csr *x509.CertificateRequest) (canonicalized *x509.Certificate
 
 	canonicalized.DNSNames = uniqueSortedLowerNames(canonicalized.DNSNames)
 	canonicalized.IPAddresses = uniqueSortedIPs(canonicalized.IPAddresses)
+	if len(canonicalized.EmailAddresses) > 0 {
+		canonicalized.EmailAddresses = uniqueSortedLowerNames(canonicalized.EmailAddresses)
+	}
 
 	return canonicalized
 }
 
+// isEmailAddress returns true if the given value is a bare email address.
+func isEmailAddress(value string) bool {
+	addr, err := mail.ParseAddress(value)
+	return err == nil && addr.Address == value
+}
+
 // ipsAreEqual compares IPs to be equal. Nil values (i.e. invalid IPs) are
 // not considered equal. IPv6 representations of IPv4 addresses are
 // considered equal to the IPv4 address in this implementation, which is
@@ -3,6 +3,7 @@ package acme
 import (
 	"context"
 	"crypto"
+	"crypto/rand"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/asn1"
@@ -19,6 +20,8 @@ import (
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/authority"
 	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/errs"
+	"go.step.sm/crypto/jose"
 	"go.step.sm/crypto/keyutil"
 	"go.step.sm/crypto/x509util"
 )
@@ -140,8 +143,9 @@ func TestOrder_UpdateStatus(t *testing.T) {
 				Status: StatusValid,
 			}
 			az2 := &Authorization{
-				ID:     "b",
-				Status: StatusInvalid,
+				ID:         "b",
+				Identifier: Identifier{Type: "dns", Value: "zap.internal"},
+				Status:     StatusInvalid,
 			}
 
 			return test{
@@ -152,6 +156,75 @@ func TestOrder_UpdateStatus(t *testing.T) {
 						assert.Equals(t, updo.AccountID, o.AccountID)
 						assert.Equals(t, updo.Status, StatusInvalid)
 						assert.Equals(t, updo.ExpiresAt, o.ExpiresAt)
+						assert.Equals(t, updo.Error.Type, "urn:ietf:params:acme:error:compound")
+						assert.Equals(t, updo.Error.Err.Error(), "1 of 2 authorizations are invalid")
+						assert.Equals(t, updo.Error.Subproblems, []Subproblem{
+							{
+								Type:       "urn:ietf:params:acme:error:malformed",
+								Detail:     "authorization has expired",
+								Identifier: &Identifier{Type: "dns", Value: "zap.internal"},
+							},
+						})
+						return nil
+					},
+					MockGetAuthorization: func(ctx context.Context, id string) (*Authorization, error) {
+						switch id {
+						case az1.ID:
+							return az1, nil
+						case az2.ID:
+							return az2, nil
+						default:
+							assert.FatalError(t, errors.Errorf("unexpected authz key %s", id))
+							return nil, errors.New("force")
+						}
+					},
+				},
+			}
+		},
+		"ok/invalid-challenge-errors": func(t *testing.T) test {
+			now := clock.Now()
+			o := &Order{
+				ID:               "oID",
+				AccountID:        "accID",
+				Status:           StatusPending,
+				ExpiresAt:        now.Add(5 * time.Minute),
+				AuthorizationIDs: []string{"a", "b"},
+			}
+			az1 := &Authorization{
+				ID:         "a",
+				Identifier: Identifier{Type: "dns", Value: "zap.internal"},
+				Status:     StatusInvalid,
+				Challenges: []*Challenge{
+					{Status: StatusPending},
+					{Status: StatusInvalid, Error: NewError(ErrorConnectionType, "error doing http GET")},
+				},
+			}
+			az2 := &Authorization{
+				ID:         "b",
+				Identifier: Identifier{Type: "dns", Value: "foo.internal"},
+				Status:     StatusInvalid,
+				Error:      NewErrorISE("force"),
+			}
+
+			return test{
+				o: o,
+				db: &MockDB{
+					MockUpdateOrder: func(ctx context.Context, updo *Order) error {
+						assert.Equals(t, updo.Status, StatusInvalid)
+						assert.Equals(t, updo.Error.Type, "urn:ietf:params:acme:error:compound")
+						assert.Equals(t, updo.Error.Err.Error(), "2 of 2 authorizations are invalid")
+						assert.Equals(t, updo.Error.Subproblems, []Subproblem{
+							{
+								Type:       "urn:ietf:params:acme:error:connection",
+								Detail:     "error doing http GET",
+								Identifier: &Identifier{Type: "dns", Value: "zap.internal"},
+							},
+							{
+								Type:       "urn:ietf:params:acme:error:serverInternal",
+								Detail:     "The server experienced an internal error",
+								Identifier: &Identifier{Type: "dns", Value: "foo.internal"},
+							},
+						})
 						return nil
 					},
 					MockGetAuthorization: func(ctx context.Context, id string) (*Authorization, error) {
@@ -301,6 +374,10 @@ func (m *mockSignAuth) LoadProvisionerByName(name string) (provisioner.Interface
 	return m.ret1.(provisioner.Interface), m.err
 }
 
+func (m *mockSignAuth) GetCertificateChains(certChain []*x509.Certificate, _ string) [][]*x509.Certificate {
+	return [][]*x509.Certificate{certChain}
+}
+
 func (m *mockSignAuth) IsRevoked(string) (bool, error) {
 	return false, nil
 }
@@ -494,6 +571,9 @@ func TestOrder_Finalize(t *testing.T) {
 					},
 				},
 				db: &MockDB{
+					MockGetAccount: func(ctx context.Context, id string) (*Account, error) {
+						return &Account{ID: id, Status: StatusValid}, nil
+					},
 					MockGetAuthorization: func(ctx context.Context, id string) (*Authorization, error) {
 						return &Authorization{ID: id, Status: StatusValid}, nil
 					},
@@ -501,6 +581,40 @@ func TestOrder_Finalize(t *testing.T) {
 				err: NewErrorISE("error retrieving authorization options from ACME provisioner: force"),
 			}
 		},
+		"fail/error-db.GetAccount": func(t *testing.T) test {
+			now := clock.Now()
+			o := &Order{
+				ID:               "oID",
+				AccountID:        "accID",
+				Status:           StatusReady,
+				ExpiresAt:        now.Add(5 * time.Minute),
+				AuthorizationIDs: []string{"a"},
+				Identifiers: []Identifier{
+					{Type: "dns", Value: "foo.internal"},
+				},
+			}
+			csr := &x509.CertificateRequest{
+				Subject: pkix.Name{
+					CommonName: "foo.internal",
+				},
+			}
+
+			return test{
+				o:    o,
+				csr:  csr,
+				prov: &MockProvisioner{},
+				db: &MockDB{
+					MockGetAccount: func(ctx context.Context, id string) (*Account, error) {
+						assert.Equals(t, "accID", id)
+						return nil, errors.New("force")
+					},
+					MockGetAuthorization: func(ctx context.Context, id string) (*Authorization, error) {
+						return &Authorization{ID: id, Status: StatusValid}, nil
+					},
+				},
+				err: NewErrorISE("error retrieving account accID: force"),
+			}
+		},
 		"fail/error-template-options": func(t *testing.T) test {
 			now := clock.Now()
 			o := &Order{
@@ -538,6 +652,9 @@ func TestOrder_Finalize(t *testing.T) {
 					},
 				},
 				db: &MockDB{
+					MockGetAccount: func(ctx context.Context, id string) (*Account, error) {
+						return &Account{ID: id, Status: StatusValid}, nil
+					},
 					MockGetAuthorization: func(ctx context.Context, id string) (*Authorization, error) {
 						return &Authorization{ID: id, Status: StatusValid}, nil
 					},
@@ -584,6 +701,9 @@ func TestOrder_Finalize(t *testing.T) {
 					},
 				},
 				db: &MockDB{
+					MockGetAccount: func(ctx context.Context, id string) (*Account, error) {
+						return &Account{ID: id, Status: StatusValid}, nil
+					},
 					MockGetAuthorization: func(ctx context.Context, id string) (*Authorization, error) {
 						return &Authorization{ID: id, Status: StatusValid}, nil
 					},
@@ -591,6 +711,55 @@ func TestOrder_Finalize(t *testing.T) {
 				err: NewErrorISE("error signing certificate for order oID: force"),
 			}
 		},
+		"fail/error-ca-sign-caa": func(t *testing.T) test {
+			now := clock.Now()
+			o := &Order{
+				ID:               "oID",
+				AccountID:        "accID",
+				Status:           StatusReady,
+				ExpiresAt:        now.Add(5 * time.Minute),
+				AuthorizationIDs: []string{"a", "b"},
+				Identifiers: []Identifier{
+					{Type: "dns", Value: "foo.internal"},
+					{Type: "dns", Value: "bar.internal"},
+				},
+			}
+			csr := &x509.CertificateRequest{
+				Subject: pkix.Name{
+					CommonName: "foo.internal",
+				},
+				DNSNames: []string{"bar.internal"},
+			}
+
+			return test{
+				o:   o,
+				csr: csr,
+				prov: &MockProvisioner{
+					MauthorizeSign: func(ctx context.Context, token string) ([]provisioner.SignOption, error) {
+						assert.Equals(t, token, "")
+						return nil, nil
+					},
+					MgetOptions: func() *provisioner.Options {
+						return nil
+					},
+				},
+				ca: &mockSignAuth{
+					signWithContext: func(_ context.Context, _csr *x509.CertificateRequest, signOpts provisioner.SignOptions, extraOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+						assert.Equals(t, _csr, csr)
+						return nil, errs.ForbiddenErr(fmt.Errorf("bar.internal: %w", provisioner.ErrCAAForbidden), "error creating certificate")
+					},
+				},
+				db: &MockDB{
+					MockGetAccount: func(ctx context.Context, id string) (*Account, error) {
+						return &Account{ID: id, Status: StatusValid}, nil
+					},
+					MockGetAuthorization: func(ctx context.Context, id string) (*Authorization, error) {
+						return &Authorization{ID: id, Status: StatusValid}, nil
+					},
+				},
+				err: NewDetailedError(ErrorCaaType, "error signing certificate for order oID: bar.internal: caa records forbid issuance"),
+			}
+		},
 		"fail/error-db.CreateCertificate": func(t *testing.T) test {
 			now := clock.Now()
 			o := &Order{
@@ -634,6 +803,9 @@ func TestOrder_Finalize(t *testing.T) {
 					},
 				},
 				db: &MockDB{
+					MockGetAccount: func(ctx context.Context, id string) (*Account, error) {
+						return &Account{ID: id, Status: StatusValid}, nil
+					},
 					MockGetAuthorization: func(ctx context.Context, id string) (*Authorization, error) {
 						return &Authorization{ID: id, Status: StatusValid}, nil
 					},
@@ -691,6 +863,9 @@ func TestOrder_Finalize(t *testing.T) {
 					},
 				},
 				db: &MockDB{
+					MockGetAccount: func(ctx context.Context, id string) (*Account, error) {
+						return &Account{ID: id, Status: StatusValid}, nil
+					},
 					MockGetAuthorization: func(ctx context.Context, id string) (*Authorization, error) {
 						return &Authorization{ID: id, Status: StatusValid}, nil
 					},
@@ -776,6 +951,9 @@ func TestOrder_Finalize(t *testing.T) {
 					},
 				},
 				db: &MockDB{
+					MockGetAccount: func(ctx context.Context, id string) (*Account, error) {
+						return &Account{ID: id, Status: StatusValid}, nil
+					},
 					MockGetAuthorization: func(ctx context.Context, id string) (*Authorization, error) {
 						return &Authorization{
 							ID:          id,
@@ -869,6 +1047,9 @@ func TestOrder_Finalize(t *testing.T) {
 					},
 				},
 				db: &MockDB{
+					MockGetAccount: func(ctx context.Context, id string) (*Account, error) {
+						return &Account{ID: id, Status: StatusValid}, nil
+					},
 					MockGetAuthorization: func(ctx context.Context, id string) (*Authorization, error) {
 						switch id {
 						case "a":
@@ -908,6 +1089,122 @@ func TestOrder_Finalize(t *testing.T) {
 				},
 			}
 		},
+		"ok/permanent-identifier-and-dns": func(t *testing.T) test {
+			now := clock.Now()
+			o := &Order{
+				ID:               "oID",
+				AccountID:        "accID",
+				Status:           StatusReady,
+				ExpiresAt:        now.Add(5 * time.Minute),
+				AuthorizationIDs: []string{"a", "b"},
+				Identifiers: []Identifier{
+					{Type: "permanent-identifier", Value: "a-permanent-identifier"},
+					{Type: "dns", Value: "device.internal"},
+				},
+			}
+
+			signer := mustSigner("EC", "P-256", 0)
+			der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+				Subject: pkix.Name{
+					CommonName: "a-permanent-identifier",
+				},
+				DNSNames: []string{"device.internal"},
+			}, signer)
+			assert.FatalError(t, err)
+			csr, err := x509.ParseCertificateRequest(der)
+			assert.FatalError(t, err)
+			leaf := &x509.Certificate{Subject: pkix.Name{CommonName: "a-permanent-identifier"}}
+
+			return test{
+				o:   o,
+				csr: csr,
+				prov: &MockProvisioner{
+					MauthorizeSign: func(ctx context.Context, token string) ([]provisioner.SignOption, error) {
+						return nil, nil
+					},
+					MgetOptions: func() *provisioner.Options {
+						return nil
+					},
+				},
+				ca: &mockSignAuth{
+					signWithContext: func(_ context.Context, _csr *x509.CertificateRequest, signOpts provisioner.SignOptions, extraOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+						// The permanent identifier is not added as a DNS name.
+						assert.Equals(t, []string{"device.internal"}, _csr.DNSNames)
+						var certOpts []x509util.Option
+						var attestationData *provisioner.AttestationData
+						for _, op := range extraOpts {
+							switch v := op.(type) {
+							case provisioner.CertificateOptions:
+								certOpts = append(certOpts, v.Options(signOpts)...)
+							case provisioner.AttestationData:
+								attestationData = &v
+							}
+						}
+						if assert.NotNil(t, attestationData) {
+							assert.Equals(t, "a-permanent-identifier", attestationData.PermanentIdentifier)
+						}
+						cert, err := x509util.NewCertificate(_csr, certOpts...)
+						assert.FatalError(t, err)
+						assert.Equals(t, []x509util.SubjectAlternativeName{
+							{Type: x509util.PermanentIdentifierType, Value: "a-permanent-identifier"},
+							{Type: x509util.DNSType, Value: "device.internal"},
+						}, cert.SANs)
+						assert.Equals(t, x509util.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}, cert.ExtKeyUsage)
+						return []*x509.Certificate{leaf}, nil
+					},
+				},
+				db: &MockDB{
+					MockGetAccount: func(ctx context.Context, id string) (*Account, error) {
+						return &Account{ID: id, Status: StatusValid}, nil
+					},
+					MockGetAuthorization: func(ctx context.Context, id string) (*Authorization, error) {
+						return &Authorization{ID: id, Status: StatusValid}, nil
+					},
+					MockCreateCertificate: func(ctx context.Context, cert *Certificate) error {
+						cert.ID = "certID"
+						return nil
+					},
+					MockUpdateOrder: func(ctx context.Context, updo *Order) error {
+						assert.Equals(t, updo.CertificateID, "certID")
+						assert.Equals(t, updo.Status, StatusValid)
+						return nil
+					},
+				},
+			}
+		},
+		"fail/permanent-identifier-and-dns-common-name": func(t *testing.T) test {
+			now := clock.Now()
+			o := &Order{
+				ID:               "oID",
+				AccountID:        "accID",
+				Status:           StatusReady,
+				ExpiresAt:        now.Add(5 * time.Minute),
+				AuthorizationIDs: []string{"a", "b"},
+				Identifiers: []Identifier{
+					{Type: "permanent-identifier", Value: "a-permanent-identifier"},
+					{Type: "dns", Value: "device.internal"},
+				},
+			}
+			csr := &x509.CertificateRequest{
+				Subject: pkix.Name{
+					CommonName: "other.internal",
+				},
+				DNSNames: []string{"device.internal"},
+			}
+
+			return test{
+				o:    o,
+				csr:  csr,
+				prov: &MockProvisioner{},
+				db: &MockDB{
+					MockGetAuthorization: func(ctx context.Context, id string) (*Authorization, error) {
+						return &Authorization{ID: id, Status: StatusValid}, nil
+					},
+				},
+				err: NewError(ErrorBadCSRType, "CSR names do not match identifiers exactly: "+
+					"CSR names = [device.internal other.internal], Order names = [device.internal]"),
+			}
+		},
 		"ok/permanent-identifier-only": func(t *testing.T) test {
 			now := clock.Now()
 			o := &Order{
@@ -979,6 +1276,9 @@ func TestOrder_Finalize(t *testing.T) {
 					},
 				},
 				db: &MockDB{
+					MockGetAccount: func(ctx context.Context, id string) (*Account, error) {
+						return &Account{ID: id, Status: StatusValid}, nil
+					},
 					MockGetAuthorization: func(ctx context.Context, id string) (*Authorization, error) {
 						return &Authorization{
 							ID:          id,
@@ -1050,6 +1350,9 @@ func TestOrder_Finalize(t *testing.T) {
 					},
 				},
 				db: &MockDB{
+					MockGetAccount: func(ctx context.Context, id string) (*Account, error) {
+						return &Account{ID: id, Status: StatusValid}, nil
+					},
 					MockGetAuthorization: func(ctx context.Context, id string) (*Authorization, error) {
 						return &Authorization{ID: id, Status: StatusValid}, nil
 					},
@@ -1074,6 +1377,93 @@ func TestOrder_Finalize(t *testing.T) {
 				},
 			}
 		},
+		"ok/new-cert-profile": func(t *testing.T) test {
+			now := clock.Now()
+			o := &Order{
+				ID:               "oID",
+				AccountID:        "accID",
+				Status:           StatusReady,
+				ExpiresAt:        now.Add(5 * time.Minute),
+				AuthorizationIDs: []string{"a"},
+				Identifiers: []Identifier{
+					{Type: "dns", Value: "foo.internal"},
+				},
+				Profile: "shortlived",
+			}
+			csr := &x509.CertificateRequest{
+				Subject: pkix.Name{
+					CommonName: "foo.internal",
+				},
+			}
+
+			foo := &x509.Certificate{Subject: pkix.Name{CommonName: "foo"}}
+			bar := &x509.Certificate{Subject: pkix.Name{CommonName: "bar"}}
+
+			return test{
+				o:   o,
+				csr: csr,
+				prov: &MockProvisioner{
+					MauthorizeSign: func(ctx context.Context, token string) ([]provisioner.SignOption, error) {
+						profile, ok := provisioner.ACMEProfileFromContext(ctx)
+						assert.True(t, ok)
+						assert.Equals(t, "shortlived", profile)
+						order, ok := provisioner.ACMEOrderFromContext(ctx)
+						assert.True(t, ok)
+						// The enriching webhooks modify the template data
+						// of the certificate.
+						assert.Equals(t, "foo.internal", order.TemplateData[x509util.SubjectKey].(x509util.Subject).CommonName)
+						order.TemplateData = nil
+						assert.Equals(t, &provisioner.ACMEOrder{
+							ID: "oID",
+							Identifiers: []provisioner.ACMEIdentifier{
+								{Type: provisioner.DNS, Value: "foo.internal"},
+							},
+							Profile: "shortlived",
+							Account: provisioner.ACMEAccount{
+								ID:      "accID",
+								KeyID:   "kid",
+								Contact: []string{"mailto:jane@example.com"},
+							},
+						}, order)
+						return nil, nil
+					},
+					MgetProfileOptions: func(profile string) *provisioner.Options {
+						assert.Equals(t, "shortlived", profile)
+						return nil
+					},
+				},
+				ca: &mockSignAuth{
+					signWithContext: func(_ context.Context, _csr *x509.CertificateRequest, signOpts provisioner.SignOptions, extraOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+						assert.Equals(t, _csr, csr)
+						return []*x509.Certificate{foo, bar}, nil
+					},
+				},
+				db: &MockDB{
+					MockGetAccount: func(ctx context.Context, id string) (*Account, error) {
+						assert.Equals(t, "accID", id)
+						return &Account{
+							ID:      id,
+							Key:     &jose.JSONWebKey{KeyID: "kid"},
+							Contact: []string{"mailto:jane@example.com"},
+							Status:  StatusValid,
+						}, nil
+					},
+					MockGetAuthorization: func(ctx context.Context, id string) (*Authorization, error) {
+						return &Authorization{ID: id, Status: StatusValid}, nil
+					},
+					MockCreateCertificate: func(ctx context.Context, cert *Certificate) error {
+						cert.ID = "certID"
+						return nil
+					},
+					MockUpdateOrder: func(ctx context.Context, updo *Order) error {
+						assert.Equals(t, updo.CertificateID, "certID")
+						assert.Equals(t, updo.Status, StatusValid)
+						assert.Equals(t, updo.Profile, "shortlived")
+						return nil
+					},
+				},
+			}
+		},
 		"ok/new-cert-ip": func(t *testing.T) test {
 			now := clock.Now()
 			o := &Order{
@@ -1114,6 +1504,9 @@ func TestOrder_Finalize(t *testing.T) {
 					},
 				},
 				db: &MockDB{
+					MockGetAccount: func(ctx context.Context, id string) (*Account, error) {
+						return &Account{ID: id, Status: StatusValid}, nil
+					},
 					MockGetAuthorization: func(ctx context.Context, id string) (*Authorization, error) {
 						return &Authorization{ID: id, Status: StatusValid}, nil
 					},
@@ -1181,6 +1574,9 @@ func TestOrder_Finalize(t *testing.T) {
 					},
 				},
 				db: &MockDB{
+					MockGetAccount: func(ctx context.Context, id string) (*Account, error) {
+						return &Account{ID: id, Status: StatusValid}, nil
+					},
 					MockGetAuthorization: func(ctx context.Context, id string) (*Authorization, error) {
 						return &Authorization{ID: id, Status: StatusValid}, nil
 					},
@@ -1649,6 +2045,25 @@ func Test_canonicalize(t *testing.T) {
 				IPAddresses: []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("192.168.42.42"), net.ParseIP("192.168.43.42")},
 			},
 		},
+		{
+			name: "ok/email-common-name",
+			args: args{
+				csr: &x509.CertificateRequest{
+					Subject: pkix.Name{
+						CommonName: "Jane@example.com",
+					},
+					EmailAddresses: []string{"jane@example.com", "doe@example.com"},
+				},
+			},
+			want: &x509.CertificateRequest{
+				Subject: pkix.Name{
+					CommonName: "Jane@example.com",
+				},
+				DNSNames:       []string{},
+				IPAddresses:    []net.IP{},
+				EmailAddresses: []string{"doe@example.com", "jane@example.com"},
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -1667,6 +2082,7 @@ func TestOrder_sans(t *testing.T) {
 	tests := []struct {
 		name   string
 		fields fields
+		subset bool
 		csr    *x509.CertificateRequest
 		want   []x509util.SubjectAlternativeName
 		err    *Error
@@ -1689,18 +2105,66 @@ func TestOrder_sans(t *testing.T) {
 			err: nil,
 		},
 		{
-			name: "fail/invalid-alternative-name-email",
+			name: "ok/email",
 			fields: fields{
-				Identifiers: []Identifier{},
+				Identifiers: []Identifier{
+					{Type: "email", Value: "jane@example.com"},
+				},
 			},
 			csr: &x509.CertificateRequest{
 				Subject: pkix.Name{
-					CommonName: "foo.internal",
+					CommonName: "jane@example.com",
 				},
+				EmailAddresses: []string{"jane@example.com"},
+			},
+			want: []x509util.SubjectAlternativeName{
+				{Type: "email", Value: "jane@example.com"},
+			},
+			err: nil,
+		},
+		{
+			name: "ok/email-subset",
+			fields: fields{
+				Identifiers: []Identifier{
+					{Type: "email", Value: "jane@example.com"},
+					{Type: "email", Value: "doe@example.com"},
+				},
+			},
+			csr: &x509.CertificateRequest{
+				EmailAddresses: []string{"doe@example.com"},
+			},
+			subset: true,
+			want: []x509util.SubjectAlternativeName{
+				{Type: "email", Value: "doe@example.com"},
+			},
+			err: nil,
+		},
+		{
+			name: "fail/invalid-alternative-name-email",
+			fields: fields{
+				Identifiers: []Identifier{},
+			},
+			csr: &x509.CertificateRequest{
 				EmailAddresses: []string{"test@example.com"},
 			},
 			want: []x509util.SubjectAlternativeName{},
-			err:  NewError(ErrorBadCSRType, "Only DNS names and IP addresses are allowed"),
+			err: NewError(ErrorBadCSRType, "CSR emails do not match identifiers exactly: "+
+				"CSR emails = [test@example.com], Order emails = []"),
+		},
+		{
+			name: "fail/email-subset",
+			fields: fields{
+				Identifiers: []Identifier{
+					{Type: "email", Value: "jane@example.com"},
+				},
+			},
+			csr: &x509.CertificateRequest{
+				EmailAddresses: []string{"doe@example.com"},
+			},
+			subset: true,
+			want:   []x509util.SubjectAlternativeName{},
+			err: NewError(ErrorBadCSRType, "CSR emails are not a subset of identifiers: "+
+				"CSR emails = [doe@example.com], Order emails = [jane@example.com]"),
 		},
 		{
 			name: "fail/invalid-alternative-name-uri",
@@ -1719,7 +2183,7 @@ func TestOrder_sans(t *testing.T) {
 				},
 			},
 			want: []x509util.SubjectAlternativeName{},
-			err:  NewError(ErrorBadCSRType, "Only DNS names and IP addresses are allowed"),
+			err:  NewError(ErrorBadCSRType, "Only DNS names, IP addresses and email addresses are allowed"),
 		},
 		{
 			name: "fail/error-names-length-mismatch",
@@ -1847,6 +2311,103 @@ func TestOrder_sans(t *testing.T) {
 			},
 			err: nil,
 		},
+		{
+			name: "fail/error-names-extra",
+			fields: fields{
+				Identifiers: []Identifier{
+					{Type: "dns", Value: "foo.internal"},
+				},
+			},
+			csr: &x509.CertificateRequest{
+				Subject: pkix.Name{
+					CommonName: "foo.internal",
+				},
+				DNSNames: []string{"bar.internal"},
+			},
+			want: []x509util.SubjectAlternativeName{},
+			err: NewError(ErrorBadCSRType, "CSR names do not match identifiers exactly: "+
+				"CSR names = %v, Order names = %v", []string{"bar.internal", "foo.internal"}, []string{"foo.internal"}),
+		},
+		{
+			name: "ok/subset-exact",
+			fields: fields{
+				Identifiers: []Identifier{
+					{Type: "dns", Value: "foo.internal"},
+					{Type: "ip", Value: "192.168.42.42"},
+				},
+			},
+			subset: true,
+			csr: &x509.CertificateRequest{
+				DNSNames:    []string{"foo.internal"},
+				IPAddresses: []net.IP{net.ParseIP("192.168.42.42")},
+			},
+			want: []x509util.SubjectAlternativeName{
+				{Type: "dns", Value: "foo.internal"},
+				{Type: "ip", Value: "192.168.42.42"},
+			},
+		},
+		{
+			name: "ok/subset-missing",
+			fields: fields{
+				Identifiers: []Identifier{
+					{Type: "dns", Value: "foo.internal"},
+					{Type: "dns", Value: "bar.internal"},
+					{Type: "ip", Value: "192.168.42.42"},
+				},
+			},
+			subset: true,
+			csr: &x509.CertificateRequest{
+				Subject: pkix.Name{
+					CommonName: "foo.internal",
+				},
+			},
+			want: []x509util.SubjectAlternativeName{
+				{Type: "dns", Value: "foo.internal"},
+			},
+		},
+		{
+			name: "fail/subset-names-extra",
+			fields: fields{
+				Identifiers: []Identifier{
+					{Type: "dns", Value: "foo.internal"},
+					{Type: "dns", Value: "bar.internal"},
+				},
+			},
+			subset: true,
+			csr: &x509.CertificateRequest{
+				DNSNames: []string{"foo.internal", "zap.internal"},
+			},
+			want: []x509util.SubjectAlternativeName{},
+			err: NewError(ErrorBadCSRType, "CSR names are not a subset of identifiers: "+
+				"CSR names = %v, Order names = %v", []string{"foo.internal", "zap.internal"}, []string{"bar.internal", "foo.internal"}),
+		},
+		{
+			name: "fail/subset-ips-extra",
+			fields: fields{
+				Identifiers: []Identifier{
+					{Type: "ip", Value: "192.168.42.42"},
+				},
+			},
+			subset: true,
+			csr: &x509.CertificateRequest{
+				IPAddresses: []net.IP{net.ParseIP("192.168.42.42"), net.ParseIP("192.168.43.42")},
+			},
+			want: []x509util.SubjectAlternativeName{},
+			err: NewError(ErrorBadCSRType, "CSR IPs are not a subset of identifiers: "+
+				"CSR IPs = %v, Order IPs = %v", []net.IP{net.ParseIP("192.168.42.42"), net.ParseIP("192.168.43.42")}, []net.IP{net.ParseIP("192.168.42.42")}),
+		},
+		{
+			name: "fail/subset-empty",
+			fields: fields{
+				Identifiers: []Identifier{
+					{Type: "dns", Value: "foo.internal"},
+				},
+			},
+			subset: true,
+			csr:    &x509.CertificateRequest{},
+			want:   []x509util.SubjectAlternativeName{},
+			err:    NewError(ErrorBadCSRType, "CSR does not contain any identifier"),
+		},
 		{
 			name: "fail/unsupported-identifier-type",
 			fields: fields{
@@ -1867,7 +2428,7 @@ func TestOrder_sans(t *testing.T) {
 				Identifiers: tt.fields.Identifiers,
 			}
 			canonicalizedCSR := canonicalize(tt.csr)
-			got, err := o.sans(canonicalizedCSR)
+			got, err := o.sans(canonicalizedCSR, tt.subset)
 			if tt.err != nil {
 				if err == nil {
 					t.Errorf("Order.sans() = %v, want error; got none", got)
@@ -0,0 +1,197 @@
+package acme
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/proxy"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// proxyClientTimeout is the timeout of the connections of a proxy client, it
+// matches the timeouts of the default client.
+const proxyClientTimeout = 30 * time.Second
+
+// validationClient returns the client used to validate http-01 and
+// tls-alpn-01 challenges. If the provisioner in the context configures a
+// validation proxy, the returned client connects to the ACME clients through
+// the proxy, otherwise the client in the context is returned.
+func validationClient(ctx context.Context) (Client, error) {
+	if p, ok := ProvisionerFromContext(ctx); ok {
+		if opts := p.GetACMEOptions().ValidationProxy; opts != nil {
+			return newProxyClient(opts)
+		}
+	}
+	return MustClientFromContext(ctx), nil
+}
+
+// proxyClient is a Client that connects through an HTTP, HTTPS or SOCKS5
+// proxy. TXT records are looked up using the system resolver.
+type proxyClient struct {
+	proxyURL *url.URL
+	http     *http.Client
+	dialer   *net.Dialer
+	socks    proxy.ContextDialer
+}
+
+// newProxyClient creates a client using the given proxy. The options must be
+// validated before calling this function.
+func newProxyClient(opts *provisioner.ACMEValidationProxy) (*proxyClient, error) {
+	u, err := url.Parse(opts.URL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing proxy %q", opts.URL)
+	}
+
+	c := &proxyClient{
+		proxyURL: u,
+		dialer: &net.Dialer{
+			Timeout: proxyClientTimeout,
+		},
+	}
+	transport := &http.Transport{
+		DisableKeepAlives: true,
+		TLSClientConfig: &tls.Config{
+			//nolint:gosec // used on tls-alpn-01 challenge
+			InsecureSkipVerify: true, // lgtm[go/disabled-certificate-check]
+		},
+	}
+	switch u.Scheme {
+	case "socks5", "socks5h":
+		d, err := proxy.FromURL(u, c.dialer)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error creating proxy %q", u.Redacted())
+		}
+		cd, ok := d.(proxy.ContextDialer)
+		if !ok {
+			return nil, errors.Errorf("proxy %q does not support contexts", u.Redacted())
+		}
+		c.socks = cd
+		transport.DialContext = cd.DialContext
+	default:
+		transport.Proxy = http.ProxyURL(u)
+	}
+	c.http = &http.Client{
+		Timeout:   proxyClientTimeout,
+		Transport: transport,
+	}
+	return c, nil
+}
+
+func (c *proxyClient) Get(url string) (*http.Response, error) {
+	return c.http.Get(url)
+}
+
+func (c *proxyClient) LookupTxt(name string) ([]string, error) {
+	return net.LookupTXT(name)
+}
+
+func (c *proxyClient) TLSDial(network, addr string, config *tls.Config) (*tls.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), proxyClientTimeout)
+	defer cancel()
+
+	conn, err := c.dial(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// dial connects to the given address through the proxy.
+func (c *proxyClient) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	if c.socks != nil {
+		return c.socks.DialContext(ctx, network, addr)
+	}
+	return c.dialConnect(ctx, network, addr)
+}
+
+// dialConnect opens a tunnel to the given address using the CONNECT method of
+// an HTTP or HTTPS proxy.
+func (c *proxyClient) dialConnect(ctx context.Context, network, addr string) (net.Conn, error) {
+	proxyAddr := c.proxyURL.Host
+	if c.proxyURL.Port() == "" {
+		port := "80"
+		if c.proxyURL.Scheme == "https" {
+			port = "443"
+		}
+		proxyAddr = net.JoinHostPort(c.proxyURL.Hostname(), port)
+	}
+
+	conn, err := c.dialer.DialContext(ctx, network, proxyAddr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error connecting to proxy %s", c.proxyURL.Redacted())
+	}
+	if c.proxyURL.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			ServerName: c.proxyURL.Hostname(),
+		})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, errors.Wrapf(err, "error connecting to proxy %s", c.proxyURL.Redacted())
+		}
+		conn = tlsConn
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if u := c.proxyURL.User; u != nil {
+		password, _ := u.Password()
+		auth := base64.StdEncoding.EncodeToString([]byte(u.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+auth)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, errors.Wrapf(err, "error writing CONNECT request to proxy %s", c.proxyURL.Redacted())
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, errors.Wrapf(err, "error reading CONNECT response from proxy %s", c.proxyURL.Redacted())
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s returned %s to CONNECT %s", c.proxyURL.Redacted(), resp.Status, addr)
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	// The proxy must not send data before the TLS handshake starts, but if it
+	// does the buffered data is read before the connection.
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn is a net.Conn that reads first the data in a buffer.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
@@ -0,0 +1,104 @@
+package acme
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// RenewalInfo contains the renewal information of a certificate as defined in
+// the ACME Renewal Information (ARI) extension, RFC 9773.
+type RenewalInfo struct {
+	SuggestedWindow RenewalWindow `json:"suggestedWindow"`
+	ExplanationURL  string        `json:"explanationURL,omitempty"`
+}
+
+// RenewalWindow is the window of time where a client should renew a
+// certificate.
+type RenewalWindow struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// ToLog enables response logging.
+func (r *RenewalInfo) ToLog() (interface{}, error) {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return nil, WrapErrorISE(err, "error marshaling renewal info for logging")
+	}
+	return string(b), nil
+}
+
+// NewRenewalInfo returns the renewal information of the given certificate.
+// The suggested window covers the second half of the last third of the
+// certificate validity. If the certificate is revoked, or the provisioner
+// requests the renewal of the certificates issued before a given time, the
+// window is moved to the past, so clients renew immediately.
+func NewRenewalInfo(cert *x509.Certificate, revoked bool, opts *provisioner.ACMERenewalInfo, now time.Time) *RenewalInfo {
+	var explanationURL string
+	renewNow := revoked
+	if opts != nil {
+		explanationURL = opts.ExplanationURL
+		if t := opts.RenewIssuedBefore; t != nil && cert.NotBefore.Before(*t) {
+			renewNow = true
+		}
+	}
+
+	var window RenewalWindow
+	if renewNow {
+		window.Start = now.Add(-time.Hour).Truncate(time.Second)
+		window.End = now.Truncate(time.Second)
+	} else {
+		lifetime := cert.NotAfter.Sub(cert.NotBefore)
+		window.Start = cert.NotAfter.Add(-lifetime / 3).Truncate(time.Second)
+		window.End = cert.NotAfter.Add(-lifetime / 6).Truncate(time.Second)
+	}
+
+	return &RenewalInfo{
+		SuggestedWindow: window,
+		ExplanationURL:  explanationURL,
+	}
+}
+
+// CertificateID returns the unique identifier used by ARI for the given
+// certificate. It contains the base64url encoding of the key identifier of
+// the authority key identifier extension and the DER encoding of the serial
+// number separated by a dot.
+func CertificateID(cert *x509.Certificate) string {
+	serial := cert.SerialNumber.Bytes()
+	if len(serial) == 0 || serial[0]&0x80 != 0 {
+		serial = append([]byte{0}, serial...)
+	}
+	return base64.RawURLEncoding.EncodeToString(cert.AuthorityKeyId) + "." +
+		base64.RawURLEncoding.EncodeToString(serial)
+}
+
+// ParseCertificateID parses an ARI certificate identifier and returns the
+// authority key identifier and the serial number in it.
+func ParseCertificateID(id string) ([]byte, *big.Int, error) {
+	keyID, serial, ok := strings.Cut(id, ".")
+	if !ok {
+		return nil, nil, errors.Errorf("certificate identifier %q is not valid", id)
+	}
+	kb, err := base64.RawURLEncoding.DecodeString(keyID)
+	if err != nil || len(kb) == 0 {
+		return nil, nil, errors.Errorf("certificate identifier %q is not valid: bad key identifier", id)
+	}
+	sb, err := base64.RawURLEncoding.DecodeString(serial)
+	if err != nil || len(sb) == 0 {
+		return nil, nil, errors.Errorf("certificate identifier %q is not valid: bad serial number", id)
+	}
+	// Serial numbers are positive integers, the DER encoding requires a
+	// leading zero if the most significant bit is set.
+	if sb[0]&0x80 != 0 {
+		return nil, nil, errors.Errorf("certificate identifier %q is not valid: bad serial number", id)
+	}
+	return kb, new(big.Int).SetBytes(sb), nil
+}
@@ -0,0 +1,97 @@
+package acme
+
+import (
+	"crypto/x509"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func TestCertificateID(t *testing.T) {
+	// Example from RFC 9773, section 4.1.
+	cert := &x509.Certificate{
+		AuthorityKeyId: []byte{
+			0x69, 0x88, 0x5B, 0x6B, 0x87, 0x46, 0x40, 0x41, 0xE1, 0xB3,
+			0x7B, 0x84, 0x7B, 0xA0, 0xAE, 0x2C, 0xDE, 0x01, 0xC8, 0xD4,
+		},
+		SerialNumber: big.NewInt(0x87654321),
+	}
+	id := CertificateID(cert)
+	assert.Equal(t, "aYhba4dGQEHhs3uEe6CuLN4ByNQ.AIdlQyE", id)
+
+	keyID, serial, err := ParseCertificateID(id)
+	require.NoError(t, err)
+	assert.Equal(t, cert.AuthorityKeyId, keyID)
+	assert.Equal(t, cert.SerialNumber, serial)
+}
+
+func TestParseCertificateID(t *testing.T) {
+	tests := []struct {
+		name       string
+		id         string
+		wantSerial *big.Int
+		wantErr    bool
+	}{
+		{"ok", "aYhba4dGQEHhs3uEe6CuLN4ByNQ.AIdlQyE", big.NewInt(0x87654321), false},
+		{"ok small serial", "aYhba4dGQEHhs3uEe6CuLN4ByNQ.AQ", big.NewInt(1), false},
+		{"fail no dot", "aYhba4dGQEHhs3uEe6CuLN4ByNQ", nil, true},
+		{"fail key id", ".AIdlQyE", nil, true},
+		{"fail serial", "aYhba4dGQEHhs3uEe6CuLN4ByNQ.", nil, true},
+		{"fail padding", "aYhba4dGQEHhs3uEe6CuLN4ByNQ=.AIdlQyE", nil, true},
+		{"fail negative serial", "aYhba4dGQEHhs3uEe6CuLN4ByNQ.h2VDIQ", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, serial, err := ParseCertificateID(tt.id)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantSerial, serial)
+		})
+	}
+}
+
+func TestNewRenewalInfo(t *testing.T) {
+	now := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+	cert := &x509.Certificate{
+		NotBefore: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:  time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC),
+	}
+	renewIssuedBefore := time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)
+	renewNow := RenewalWindow{Start: now.Add(-time.Hour), End: now}
+
+	tests := []struct {
+		name    string
+		revoked bool
+		opts    *provisioner.ACMERenewalInfo
+		want    *RenewalInfo
+	}{
+		{"ok", false, nil, &RenewalInfo{SuggestedWindow: RenewalWindow{
+			Start: time.Date(2024, 1, 21, 0, 0, 0, 0, time.UTC),
+			End:   time.Date(2024, 1, 26, 0, 0, 0, 0, time.UTC),
+		}}},
+		{"ok revoked", true, nil, &RenewalInfo{SuggestedWindow: renewNow}},
+		{"ok renew issued before", false, &provisioner.ACMERenewalInfo{
+			ExplanationURL:    "https://ca.example.com/incident",
+			RenewIssuedBefore: &renewIssuedBefore,
+		}, &RenewalInfo{SuggestedWindow: renewNow, ExplanationURL: "https://ca.example.com/incident"}},
+		{"ok issued after", false, &provisioner.ACMERenewalInfo{
+			RenewIssuedBefore: &cert.NotBefore,
+		}, &RenewalInfo{SuggestedWindow: RenewalWindow{
+			Start: time.Date(2024, 1, 21, 0, 0, 0, 0, time.UTC),
+			End:   time.Date(2024, 1, 26, 0, 0, 0, 0, time.UTC),
+		}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, NewRenewalInfo(cert, tt.revoked, tt.opts, now))
+		})
+	}
+}
@@ -0,0 +1,386 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+const (
+	// dnsResolverDefaultTimeout is the default timeout of a query to a
+	// resolver.
+	dnsResolverDefaultTimeout = 10 * time.Second
+	// dnsResolverDefaultMaxCNAMEs is the default maximum number of aliases
+	// followed to find a TXT record.
+	dnsResolverDefaultMaxCNAMEs = 8
+	// dnsMaxMessageSize is the maximum size of a DNS message over TCP or HTTPS.
+	dnsMaxMessageSize = 65535
+)
+
+// errDNSNegativeResponse is the error returned when a resolver responds that
+// the requested TXT record does not exist.
+var errDNSNegativeResponse = errors.New("no TXT records found")
+
+// lookupTxt returns the TXT records for the given name using the resolvers
+// configured in the provisioner, or the client in the context if the
+// provisioner does not configure them.
+func lookupTxt(ctx context.Context, name string) ([]string, error) {
+	if p, ok := ProvisionerFromContext(ctx); ok {
+		if opts := p.GetACMEOptions().DNSValidation; opts != nil {
+			r, err := getDNSResolver(p.GetID(), opts)
+			if err != nil {
+				return nil, err
+			}
+			return r.LookupTxt(ctx, name)
+		}
+	}
+	return MustClientFromContext(ctx).LookupTxt(name)
+}
+
+// dnsResolvers stores the resolvers of the provisioners indexed by the
+// provisioner id, so the connections to the resolvers are reused.
+var dnsResolvers = struct {
+	sync.Mutex
+	m map[string]*dnsResolver
+}{m: make(map[string]*dnsResolver)}
+
+// getDNSResolver returns the resolver of the provisioner with the given id,
+// creating it if the provisioner does not have one or if its options have
+// changed since it was created.
+func getDNSResolver(provisionerID string, opts *provisioner.ACMEDNSValidation) (*dnsResolver, error) {
+	dnsResolvers.Lock()
+	defer dnsResolvers.Unlock()
+	old, ok := dnsResolvers.m[provisionerID]
+	if ok && old.opts == opts {
+		return old, nil
+	}
+	r, err := newDNSResolver(opts)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		old.httpClient.CloseIdleConnections()
+	}
+	dnsResolvers.m[provisionerID] = r
+	return r, nil
+}
+
+// dnsResolver looks up TXT records querying a list of resolvers using DNS over
+// TLS or DNS over HTTPS.
+type dnsResolver struct {
+	opts                *provisioner.ACMEDNSValidation
+	resolvers           []*url.URL
+	requireDNSSEC       bool
+	disableCNAMEs       bool
+	maxCNAMEs           int
+	bypassNegativeCache bool
+	timeout             time.Duration
+	tlsConfig           *tls.Config
+	httpClient          *http.Client
+}
+
+// newDNSResolver creates a resolver with the given options. The options must
+// be validated before calling this function.
+func newDNSResolver(opts *provisioner.ACMEDNSValidation) (*dnsResolver, error) {
+	r := &dnsResolver{
+		opts:                opts,
+		requireDNSSEC:       opts.RequireDNSSEC,
+		disableCNAMEs:       opts.DisableCNAMEs,
+		maxCNAMEs:           opts.MaxCNAMEs,
+		bypassNegativeCache: opts.BypassNegativeCache,
+		timeout:             dnsResolverDefaultTimeout,
+		tlsConfig: &tls.Config{
+			MinVersion: tls.VersionTLS12,
+		},
+	}
+	if r.maxCNAMEs == 0 {
+		r.maxCNAMEs = dnsResolverDefaultMaxCNAMEs
+	}
+	if opts.Timeout != nil && opts.Timeout.Duration > 0 {
+		r.timeout = opts.Timeout.Duration
+	}
+	for _, s := range opts.Resolvers {
+		u, err := url.Parse(s)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing resolver %q", s)
+		}
+		r.resolvers = append(r.resolvers, u)
+	}
+	r.httpClient = &http.Client{
+		Timeout: r.timeout,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: r.tlsConfig,
+		},
+	}
+	return r, nil
+}
+
+// LookupTxt returns the TXT records for the given name. The resolvers are
+// queried in order until one of them returns a response. Negative responses
+// are only accepted from the first resolver that returns a response unless the
+// negative cache bypass is enabled, in which case the rest of resolvers are
+// also queried.
+func (r *dnsResolver) LookupTxt(ctx context.Context, name string) ([]string, error) {
+	var lastErr error
+	for _, u := range r.resolvers {
+		records, err := r.lookupTxt(ctx, u, name)
+		if err == nil {
+			return records, nil
+		}
+		lastErr = fmt.Errorf("resolver %s: %w", u.Redacted(), err)
+		if errors.Is(err, errDNSNegativeResponse) && !r.bypassNegativeCache {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+// lookupTxt looks up the TXT records for the given name in the given resolver
+// following the aliases of the name.
+func (r *dnsResolver) lookupTxt(ctx context.Context, u *url.URL, name string) ([]string, error) {
+	name = dnsCanonicalName(name)
+	var aliases int
+	for {
+		msg, err := r.query(ctx, u, name)
+		if err != nil {
+			return nil, err
+		}
+		records, chain, err := r.parseTxtResponse(msg, name)
+		if err != nil {
+			return nil, err
+		}
+		if aliases += len(chain); aliases > r.maxCNAMEs {
+			return nil, errors.Errorf("too many CNAME records for %s", name)
+		}
+		switch {
+		case len(records) > 0:
+			return records, nil
+		case len(chain) == 0:
+			return nil, errDNSNegativeResponse
+		}
+		// The response does not contain the records of the last alias, the
+		// resolver did not follow it.
+		name = chain[len(chain)-1]
+	}
+}
+
+// parseTxtResponse parses a DNS response and returns the TXT records of the
+// given name. If the name is an alias, it follows the CNAME records in the
+// response and returns the chain of aliases followed.
+func (r *dnsResolver) parseTxtResponse(msg *dnsmessage.Message, name string) ([]string, []string, error) {
+	switch msg.Header.RCode {
+	case dnsmessage.RCodeSuccess:
+	case dnsmessage.RCodeNameError:
+		return nil, nil, errDNSNegativeResponse
+	default:
+		return nil, nil, errors.Errorf("unexpected response code %s", msg.Header.RCode)
+	}
+	if r.requireDNSSEC && !msg.Header.AuthenticData {
+		return nil, nil, errors.Errorf("response for %s is not authenticated with DNSSEC", name)
+	}
+
+	cnames := make(map[string]string)
+	txts := make(map[string][]string)
+	for _, rr := range msg.Answers {
+		owner := dnsCanonicalName(rr.Header.Name.String())
+		switch b := rr.Body.(type) {
+		case *dnsmessage.CNAMEResource:
+			cnames[owner] = dnsCanonicalName(b.CNAME.String())
+		case *dnsmessage.TXTResource:
+			// Multiple strings in the same record are concatenated like
+			// net.LookupTXT does.
+			txts[owner] = append(txts[owner], strings.Join(b.TXT, ""))
+		}
+	}
+
+	var chain []string
+	for {
+		if records, ok := txts[name]; ok {
+			return records, chain, nil
+		}
+		target, ok := cnames[name]
+		switch {
+		case !ok:
+			return nil, chain, nil
+		case r.disableCNAMEs:
+			return nil, nil, errors.Errorf("%s is an alias to %s and CNAME records are not allowed", name, target)
+		case len(chain) >= len(cnames):
+			return nil, nil, errors.Errorf("CNAME loop found for %s", name)
+		}
+		chain = append(chain, target)
+		name = target
+	}
+}
+
+// query sends a TXT query for the given name to the given resolver.
+func (r *dnsResolver) query(ctx context.Context, u *url.URL, name string) (*dnsmessage.Message, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	// RFC 8484 recommends to use a zero ID in DNS over HTTPS to make the
+	// responses cache friendly.
+	var id uint16
+	if u.Scheme != "https" {
+		b := make([]byte, 2)
+		if _, err := rand.Read(b); err != nil {
+			return nil, errors.Wrap(err, "error generating query id")
+		}
+		id = binary.BigEndian.Uint16(b)
+	}
+	req, err := newDNSTxtQuery(id, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp []byte
+	switch u.Scheme {
+	case "tls":
+		resp, err = r.exchangeTLS(ctx, u, req)
+	case "https":
+		resp, err = r.exchangeHTTPS(ctx, u, req)
+	default:
+		err = errors.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	msg := new(dnsmessage.Message)
+	if err := msg.Unpack(resp); err != nil {
+		return nil, errors.Wrap(err, "error parsing DNS response")
+	}
+	switch {
+	case !msg.Header.Response:
+		return nil, errors.New("error parsing DNS response: message is not a response")
+	case msg.Header.ID != id:
+		return nil, errors.New("error parsing DNS response: id does not match the query")
+	case msg.Header.Truncated:
+		return nil, errors.New("error parsing DNS response: message is truncated")
+	}
+	return msg, nil
+}
+
+// exchangeTLS sends a DNS message to a DNS over TLS resolver, RFC 7858.
+func (r *dnsResolver) exchangeTLS(ctx context.Context, u *url.URL, req []byte) ([]byte, error) {
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "853")
+	}
+	tlsConfig := r.tlsConfig.Clone()
+	tlsConfig.ServerName = u.Hostname()
+	dialer := &tls.Dialer{Config: tlsConfig}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, errors.Wrap(err, "error connecting to resolver")
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return nil, errors.Wrap(err, "error setting deadline")
+		}
+	}
+
+	// Messages over TCP are prefixed with their length.
+	b := make([]byte, 2, 2+len(req))
+	binary.BigEndian.PutUint16(b, uint16(len(req)))
+	if _, err := conn.Write(append(b, req...)); err != nil {
+		return nil, errors.Wrap(err, "error writing DNS query")
+	}
+	if _, err := io.ReadFull(conn, b); err != nil {
+		return nil, errors.Wrap(err, "error reading DNS response")
+	}
+	resp := make([]byte, binary.BigEndian.Uint16(b))
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return nil, errors.Wrap(err, "error reading DNS response")
+	}
+	return resp, nil
+}
+
+// exchangeHTTPS sends a DNS message to a DNS over HTTPS resolver, RFC 8484.
+func (r *dnsResolver) exchangeHTTPS(ctx context.Context, u *url.URL, req []byte) ([]byte, error) {
+	hreq, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(req))
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating DNS over HTTPS request")
+	}
+	hreq.Header.Set("Accept", "application/dns-message")
+	hreq.Header.Set("Content-Type", "application/dns-message")
+	resp, err := r.httpClient.Do(hreq)
+	if err != nil {
+		return nil, errors.Wrap(err, "error sending DNS over HTTPS request")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("error sending DNS over HTTPS request: unexpected status code %d", resp.StatusCode)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, dnsMaxMessageSize))
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading DNS over HTTPS response")
+	}
+	return b, nil
+}
+
+// newDNSTxtQuery returns a TXT query for the given name. The query requests
+// the DNSSEC records and sets the AD bit to get the authenticated data flag
+// from validating resolvers as described in RFC 6840.
+func newDNSTxtQuery(id uint16, name string) ([]byte, error) {
+	qname, err := dnsmessage.NewName(name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error creating DNS query for %s", name)
+	}
+	b := dnsmessage.NewBuilder(make([]byte, 0, 512), dnsmessage.Header{
+		ID:               id,
+		RecursionDesired: true,
+		AuthenticData:    true,
+	})
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		return nil, errors.Wrap(err, "error creating DNS query")
+	}
+	if err := b.Question(dnsmessage.Question{
+		Name:  qname,
+		Type:  dnsmessage.TypeTXT,
+		Class: dnsmessage.ClassINET,
+	}); err != nil {
+		return nil, errors.Wrapf(err, "error creating DNS query for %s", name)
+	}
+	if err := b.StartAdditionals(); err != nil {
+		return nil, errors.Wrap(err, "error creating DNS query")
+	}
+	var rh dnsmessage.ResourceHeader
+	if err := rh.SetEDNS0(4096, dnsmessage.RCodeSuccess, true); err != nil {
+		return nil, errors.Wrap(err, "error creating DNS query")
+	}
+	if err := b.OPTResource(rh, dnsmessage.OPTResource{}); err != nil {
+		return nil, errors.Wrap(err, "error creating DNS query")
+	}
+	msg, err := b.Finish()
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating DNS query")
+	}
+	return msg, nil
+}
+
+// dnsCanonicalName returns the given name in lower case and fully qualified.
+func dnsCanonicalName(name string) string {
+	name = strings.ToLower(name)
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	return name
+}
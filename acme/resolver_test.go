@@ -0,0 +1,250 @@
+package acme
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+type testDNSRecord struct {
+	name  string
+	cname string
+	txt   []string
+}
+
+type testDNSZone struct {
+	records       []testDNSRecord
+	authenticated bool
+	rcode         dnsmessage.RCode
+}
+
+// respond builds the response for the given query adding all the records of
+// the zone to the answers.
+func (z *testDNSZone) respond(t *testing.T, query []byte) []byte {
+	t.Helper()
+	var q dnsmessage.Message
+	require.NoError(t, q.Unpack(query))
+	require.Len(t, q.Questions, 1)
+	assert.Equal(t, dnsmessage.TypeTXT, q.Questions[0].Type)
+	require.NotNil(t, q.Additionals)
+	assert.True(t, q.Additionals[0].Header.DNSSECAllowed())
+
+	resp := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:                 q.Header.ID,
+			Response:           true,
+			RecursionAvailable: true,
+			AuthenticData:      z.authenticated,
+			RCode:              z.rcode,
+		},
+		Questions: q.Questions,
+	}
+	for _, r := range z.records {
+		hdr := dnsmessage.ResourceHeader{
+			Name:  dnsmessage.MustNewName(r.name),
+			Class: dnsmessage.ClassINET,
+			TTL:   60,
+		}
+		if r.cname != "" {
+			resp.Answers = append(resp.Answers, dnsmessage.Resource{
+				Header: hdr,
+				Body:   &dnsmessage.CNAMEResource{CNAME: dnsmessage.MustNewName(r.cname)},
+			})
+		} else {
+			resp.Answers = append(resp.Answers, dnsmessage.Resource{
+				Header: hdr,
+				Body:   &dnsmessage.TXTResource{TXT: r.txt},
+			})
+		}
+	}
+	b, err := resp.Pack()
+	require.NoError(t, err)
+	return b
+}
+
+func newTestDoHServer(t *testing.T, zone *testDNSZone) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/dns-message", r.Header.Get("Content-Type"))
+		b, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(zone.respond(t, b))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newTestDoTServer(t *testing.T, tlsConfig *tls.Config, zone *testDNSZone) string {
+	t.Helper()
+	lis, err := tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	require.NoError(t, err)
+	t.Cleanup(func() { lis.Close() })
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				b := make([]byte, 2)
+				if _, err := io.ReadFull(conn, b); err != nil {
+					return
+				}
+				query := make([]byte, binary.BigEndian.Uint16(b))
+				if _, err := io.ReadFull(conn, query); err != nil {
+					return
+				}
+				resp := zone.respond(t, query)
+				binary.BigEndian.PutUint16(b, uint16(len(resp)))
+				conn.Write(append(b, resp...))
+			}(conn)
+		}
+	}()
+	return "tls://" + lis.Addr().String()
+}
+
+func newTestDNSResolver(t *testing.T, srv *httptest.Server, opts *provisioner.ACMEDNSValidation) *dnsResolver {
+	t.Helper()
+	require.NoError(t, opts.Validate())
+	r, err := newDNSResolver(opts)
+	require.NoError(t, err)
+	r.tlsConfig.RootCAs = srv.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+	return r
+}
+
+func TestDNSResolver_LookupTxt(t *testing.T) {
+	ctx := context.Background()
+	name := "_acme-challenge.example.com"
+	records := []testDNSRecord{
+		{name: "_acme-challenge.example.com.", txt: []string{"token"}},
+	}
+	aliases := []testDNSRecord{
+		{name: "_acme-challenge.example.com.", cname: "example.acme.example.net."},
+		{name: "example.acme.example.net.", txt: []string{"to", "ken"}},
+	}
+
+	t.Run("ok https", func(t *testing.T) {
+		srv := newTestDoHServer(t, &testDNSZone{records: records})
+		r := newTestDNSResolver(t, srv, &provisioner.ACMEDNSValidation{Resolvers: []string{srv.URL + "/dns-query"}})
+		txts, err := r.LookupTxt(ctx, name)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"token"}, txts)
+	})
+
+	t.Run("ok tls", func(t *testing.T) {
+		srv := newTestDoHServer(t, &testDNSZone{})
+		addr := newTestDoTServer(t, srv.TLS.Clone(), &testDNSZone{records: records, authenticated: true})
+		r := newTestDNSResolver(t, srv, &provisioner.ACMEDNSValidation{
+			Resolvers: []string{addr}, RequireDNSSEC: true, Timeout: &provisioner.Duration{Duration: 5 * time.Second},
+		})
+		txts, err := r.LookupTxt(ctx, name)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"token"}, txts)
+	})
+
+	t.Run("ok cname", func(t *testing.T) {
+		srv := newTestDoHServer(t, &testDNSZone{records: aliases})
+		r := newTestDNSResolver(t, srv, &provisioner.ACMEDNSValidation{Resolvers: []string{srv.URL}})
+		txts, err := r.LookupTxt(ctx, name)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"token"}, txts)
+	})
+
+	t.Run("ok bypass negative cache", func(t *testing.T) {
+		negative := newTestDoHServer(t, &testDNSZone{rcode: dnsmessage.RCodeNameError})
+		srv := newTestDoHServer(t, &testDNSZone{records: records})
+		r := newTestDNSResolver(t, srv, &provisioner.ACMEDNSValidation{
+			Resolvers: []string{negative.URL, srv.URL}, BypassNegativeCache: true,
+		})
+		r.tlsConfig.RootCAs.AddCert(negative.Certificate())
+		txts, err := r.LookupTxt(ctx, name)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"token"}, txts)
+	})
+
+	t.Run("fail negative cache", func(t *testing.T) {
+		negative := newTestDoHServer(t, &testDNSZone{})
+		srv := newTestDoHServer(t, &testDNSZone{records: records})
+		r := newTestDNSResolver(t, srv, &provisioner.ACMEDNSValidation{
+			Resolvers: []string{negative.URL, srv.URL},
+		})
+		r.tlsConfig.RootCAs.AddCert(negative.Certificate())
+		_, err := r.LookupTxt(ctx, name)
+		assert.ErrorIs(t, err, errDNSNegativeResponse)
+	})
+
+	t.Run("fail dnssec", func(t *testing.T) {
+		srv := newTestDoHServer(t, &testDNSZone{records: records})
+		r := newTestDNSResolver(t, srv, &provisioner.ACMEDNSValidation{Resolvers: []string{srv.URL}, RequireDNSSEC: true})
+		_, err := r.LookupTxt(ctx, name)
+		assert.ErrorContains(t, err, "is not authenticated with DNSSEC")
+	})
+
+	t.Run("fail cnames disabled", func(t *testing.T) {
+		srv := newTestDoHServer(t, &testDNSZone{records: aliases})
+		r := newTestDNSResolver(t, srv, &provisioner.ACMEDNSValidation{Resolvers: []string{srv.URL}, DisableCNAMEs: true})
+		_, err := r.LookupTxt(ctx, name)
+		assert.ErrorContains(t, err, "CNAME records are not allowed")
+	})
+
+	t.Run("fail too many cnames", func(t *testing.T) {
+		srv := newTestDoHServer(t, &testDNSZone{records: []testDNSRecord{
+			{name: "_acme-challenge.example.com.", cname: "a.example.net."},
+			{name: "a.example.net.", cname: "b.example.net."},
+			{name: "b.example.net.", txt: []string{"token"}},
+		}})
+		r := newTestDNSResolver(t, srv, &provisioner.ACMEDNSValidation{Resolvers: []string{srv.URL}, MaxCNAMEs: 1})
+		_, err := r.LookupTxt(ctx, name)
+		assert.ErrorContains(t, err, "too many CNAME records")
+	})
+
+	t.Run("fail cname loop", func(t *testing.T) {
+		srv := newTestDoHServer(t, &testDNSZone{records: []testDNSRecord{
+			{name: "_acme-challenge.example.com.", cname: "a.example.net."},
+			{name: "a.example.net.", cname: "_acme-challenge.example.com."},
+		}})
+		r := newTestDNSResolver(t, srv, &provisioner.ACMEDNSValidation{Resolvers: []string{srv.URL}})
+		_, err := r.LookupTxt(ctx, name)
+		assert.ErrorContains(t, err, "CNAME loop found")
+	})
+
+	t.Run("fail server error", func(t *testing.T) {
+		srv := newTestDoHServer(t, &testDNSZone{rcode: dnsmessage.RCodeServerFailure})
+		r := newTestDNSResolver(t, srv, &provisioner.ACMEDNSValidation{Resolvers: []string{srv.URL}})
+		_, err := r.LookupTxt(ctx, name)
+		assert.ErrorContains(t, err, "unexpected response code")
+	})
+}
+
+func TestGetDNSResolver(t *testing.T) {
+	opts := &provisioner.ACMEDNSValidation{Resolvers: []string{"https://dns.example.com/dns-query"}}
+	require.NoError(t, opts.Validate())
+	r1, err := getDNSResolver("acme-resolver", opts)
+	require.NoError(t, err)
+	r2, err := getDNSResolver("acme-resolver", opts)
+	require.NoError(t, err)
+	assert.Same(t, r1, r2)
+
+	// The resolver is created again if the options change.
+	opts = &provisioner.ACMEDNSValidation{Resolvers: []string{"tls://dns.example.com"}}
+	require.NoError(t, opts.Validate())
+	r3, err := getDNSResolver("acme-resolver", opts)
+	require.NoError(t, err)
+	assert.NotSame(t, r1, r3)
+	assert.Equal(t, "tls", r3.resolvers[0].Scheme)
+}
@@ -0,0 +1,153 @@
+package acme
+
+import (
+	"context"
+	"crypto/x509"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// AutoRenewal contains the auto-renewal fields of a short-term automatically
+// renewed (STAR) order as defined in RFC 8739.
+type AutoRenewal struct {
+	// StartDate is the earliest date of validity of the first certificate.
+	StartDate time.Time `json:"start-date,omitempty"`
+	// EndDate is the latest date of validity of the last certificate.
+	EndDate time.Time `json:"end-date"`
+	// Lifetime is the validity period of each certificate in seconds.
+	Lifetime int64 `json:"lifetime"`
+	// LifetimeAdjust is the amount of left pad in seconds added to each
+	// certificate, so consecutive certificates overlap.
+	LifetimeAdjust int64 `json:"lifetime-adjust,omitempty"`
+	// AllowCertificateGet allows to fetch the certificates using
+	// unauthenticated GET requests.
+	AllowCertificateGet bool `json:"allow-certificate-get,omitempty"`
+}
+
+// validity returns the validity of the certificate of the period that
+// contains the given time. The periods start on the start date and they last
+// for a lifetime, the certificates are backdated the lifetime adjustment.
+func (a *AutoRenewal) validity(now time.Time) (time.Time, time.Time) {
+	lifetime := time.Duration(a.Lifetime) * time.Second
+	start := a.StartDate
+	if now.After(start) {
+		start = start.Add(now.Sub(start) / lifetime * lifetime)
+	}
+
+	notBefore := start.Add(-time.Duration(a.LifetimeAdjust) * time.Second)
+	if notBefore.Before(a.StartDate) {
+		notBefore = a.StartDate
+	}
+	notAfter := start.Add(lifetime)
+	if notAfter.After(a.EndDate) {
+		notAfter = a.EndDate
+	}
+	return notBefore, notAfter
+}
+
+// starOrderLocks serialize the renewals of the auto-renewal orders in this
+// instance, so concurrent requests only sign one certificate per period.
+var starOrderLocks [64]sync.Mutex
+
+func starOrderLock(id string) *sync.Mutex {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return &starOrderLocks[h.Sum32()%uint32(len(starOrderLocks))]
+}
+
+// GetStarCertificate returns the current certificate of an auto-renewal
+// order. If the last certificate of the order does not belong to the current
+// period, a new one is signed using the CSR of the order. The account of the
+// order must be valid.
+//
+// Renewals are serialized in this instance, and if the database supports it
+// the certificate of the order is swapped atomically, so only one of the
+// concurrent requests updates the order.
+func (o *Order) GetStarCertificate(ctx context.Context, db DB, auth CertificateAuthority, p Provisioner) (*Certificate, error) {
+	switch {
+	case o.AutoRenewal == nil:
+		return nil, NewError(ErrorMalformedType, "order %s is not an auto-renewal order", o.ID)
+	case o.Status == StatusCanceled:
+		return nil, NewError(ErrorAutoRenewalCanceledType, "order %s has been canceled", o.ID)
+	case o.Status != StatusValid:
+		return nil, NewError(ErrorOrderNotReadyType, "order %s is not valid", o.ID)
+	}
+
+	now := clock.Now()
+	if !now.Before(o.AutoRenewal.EndDate) {
+		return nil, NewError(ErrorAutoRenewalExpiredType, "order %s expired on %s", o.ID, o.AutoRenewal.EndDate)
+	}
+
+	acc, err := db.GetAccount(ctx, o.AccountID)
+	if err != nil {
+		return nil, WrapErrorISE(err, "error retrieving account %s", o.AccountID)
+	}
+	if acc.Status != StatusValid {
+		return nil, NewError(ErrorUnauthorizedType, "account %s is not valid", acc.ID)
+	}
+
+	notBefore, notAfter := o.AutoRenewal.validity(now)
+	cert, err := db.GetCertificate(ctx, o.CertificateID)
+	if err != nil {
+		return nil, WrapErrorISE(err, "error retrieving certificate for order %s", o.ID)
+	}
+	if !cert.Leaf.NotAfter.Before(notAfter) {
+		return cert, nil
+	}
+
+	mu := starOrderLock(o.ID)
+	mu.Lock()
+	defer mu.Unlock()
+
+	// The certificate might have been renewed while waiting for the lock.
+	current, err := db.GetOrder(ctx, o.ID)
+	if err != nil {
+		return nil, WrapErrorISE(err, "error retrieving order %s", o.ID)
+	}
+	if current.CertificateID != o.CertificateID {
+		o.CertificateID = current.CertificateID
+		if cert, err = db.GetCertificate(ctx, o.CertificateID); err != nil {
+			return nil, WrapErrorISE(err, "error retrieving certificate for order %s", o.ID)
+		}
+		if !cert.Leaf.NotAfter.Before(notAfter) {
+			return cert, nil
+		}
+	}
+
+	csr, err := x509.ParseCertificateRequest(o.CertificateRequest)
+	if err != nil {
+		return nil, WrapErrorISE(err, "error parsing certificate request for order %s", o.ID)
+	}
+	if cert, err = o.sign(ctx, db, csr, auth, p, notBefore, notAfter); err != nil {
+		return nil, err
+	}
+
+	swapper, ok := db.(OrderCertificateSwapper)
+	if !ok {
+		o.CertificateID = cert.ID
+		if err := db.UpdateOrder(ctx, o); err != nil {
+			return nil, WrapErrorISE(err, "error updating order %s", o.ID)
+		}
+		return cert, nil
+	}
+
+	swapped, err := swapper.SwapOrderCertificate(ctx, o.ID, o.CertificateID, cert.ID)
+	if err != nil {
+		return nil, WrapErrorISE(err, "error updating order %s", o.ID)
+	}
+	if swapped {
+		o.CertificateID = cert.ID
+		return cert, nil
+	}
+
+	// Another instance has renewed the order, return its certificate.
+	if current, err = db.GetOrder(ctx, o.ID); err != nil {
+		return nil, WrapErrorISE(err, "error retrieving order %s", o.ID)
+	}
+	o.CertificateID = current.CertificateID
+	if cert, err = db.GetCertificate(ctx, o.CertificateID); err != nil {
+		return nil, WrapErrorISE(err, "error retrieving certificate for order %s", o.ID)
+	}
+	return cert, nil
+}
@@ -0,0 +1,278 @@
+package acme
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/keyutil"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func TestAutoRenewal_validity(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ar := &AutoRenewal{
+		StartDate:      start,
+		EndDate:        start.Add(100 * time.Hour),
+		Lifetime:       int64((24 * time.Hour).Seconds()),
+		LifetimeAdjust: int64(time.Hour.Seconds()),
+	}
+	tests := []struct {
+		name          string
+		now           time.Time
+		wantNotBefore time.Time
+		wantNotAfter  time.Time
+	}{
+		{"before start", start.Add(-time.Hour), start, start.Add(24 * time.Hour)},
+		{"first period", start.Add(time.Hour), start, start.Add(24 * time.Hour)},
+		{"second period", start.Add(30 * time.Hour), start.Add(23 * time.Hour), start.Add(48 * time.Hour)},
+		{"period boundary", start.Add(48 * time.Hour), start.Add(47 * time.Hour), start.Add(72 * time.Hour)},
+		{"last period", start.Add(99 * time.Hour), start.Add(95 * time.Hour), start.Add(100 * time.Hour)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notBefore, notAfter := ar.validity(tt.now)
+			assert.Equal(t, tt.wantNotBefore, notBefore)
+			assert.Equal(t, tt.wantNotAfter, notAfter)
+		})
+	}
+}
+
+func TestOrder_GetStarCertificate(t *testing.T) {
+	ctx := context.Background()
+	now := clock.Now()
+
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	csrBytes, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "foo.internal"},
+		DNSNames: []string{"foo.internal"},
+	}, signer)
+	require.NoError(t, err)
+
+	newOrder := func(status Status, endDate time.Time) *Order {
+		return &Order{
+			ID:            "oID",
+			AccountID:     "accID",
+			Status:        status,
+			CertificateID: "certID",
+			Identifiers:   []Identifier{{Type: "dns", Value: "foo.internal"}},
+			AutoRenewal: &AutoRenewal{
+				StartDate: now.Add(-time.Hour),
+				EndDate:   endDate,
+				Lifetime:  int64((24 * time.Hour).Seconds()),
+			},
+			CertificateRequest: csrBytes,
+		}
+	}
+	prov := &MockProvisioner{
+		MauthorizeSign: func(ctx context.Context, token string) ([]provisioner.SignOption, error) {
+			return nil, nil
+		},
+		MgetOptions: func() *provisioner.Options {
+			return nil
+		},
+	}
+	current := &Certificate{ID: "certID", Leaf: &x509.Certificate{NotAfter: now.Add(23 * time.Hour)}}
+	expired := &Certificate{ID: "certID", Leaf: &x509.Certificate{NotAfter: now.Add(-2 * time.Hour)}}
+
+	validAccount := func(ctx context.Context, id string) (*Account, error) {
+		assert.Equal(t, "accID", id)
+		return &Account{ID: id, Status: StatusValid}, nil
+	}
+
+	t.Run("ok current", func(t *testing.T) {
+		o := newOrder(StatusValid, now.Add(72*time.Hour))
+		db := &MockDB{
+			MockGetAccount: validAccount,
+			MockGetCertificate: func(ctx context.Context, id string) (*Certificate, error) {
+				assert.Equal(t, "certID", id)
+				return current, nil
+			},
+		}
+		cert, err := o.GetStarCertificate(ctx, db, &mockSignAuth{}, prov)
+		require.NoError(t, err)
+		assert.Equal(t, current, cert)
+	})
+
+	t.Run("ok renewed", func(t *testing.T) {
+		o := newOrder(StatusValid, now.Add(72*time.Hour))
+		o.AutoRenewal.StartDate = now.Add(-26 * time.Hour)
+		leaf := &x509.Certificate{Subject: pkix.Name{CommonName: "foo.internal"}}
+		issuer := &x509.Certificate{Subject: pkix.Name{CommonName: "issuer"}}
+		ca := &mockSignAuth{
+			signWithContext: func(_ context.Context, csr *x509.CertificateRequest, signOpts provisioner.SignOptions, extraOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+				assert.Equal(t, csrBytes, csr.Raw)
+				assert.Equal(t, o.AutoRenewal.StartDate.Add(24*time.Hour), signOpts.NotBefore.Time())
+				assert.Equal(t, o.AutoRenewal.StartDate.Add(48*time.Hour), signOpts.NotAfter.Time())
+				return []*x509.Certificate{leaf, issuer}, nil
+			},
+		}
+		db := &MockDB{
+			MockGetCertificate: func(ctx context.Context, id string) (*Certificate, error) {
+				return expired, nil
+			},
+			MockGetAccount: validAccount,
+			MockGetOrder: func(ctx context.Context, id string) (*Order, error) {
+				return newOrder(StatusValid, now.Add(72*time.Hour)), nil
+			},
+			MockCreateCertificate: func(ctx context.Context, cert *Certificate) error {
+				assert.Equal(t, "oID", cert.OrderID)
+				assert.Equal(t, leaf, cert.Leaf)
+				cert.ID = "newCertID"
+				return nil
+			},
+			MockUpdateOrder: func(ctx context.Context, updo *Order) error {
+				assert.Equal(t, "newCertID", updo.CertificateID)
+				return nil
+			},
+		}
+		cert, err := o.GetStarCertificate(ctx, db, ca, prov)
+		require.NoError(t, err)
+		assert.Equal(t, "newCertID", cert.ID)
+		assert.Equal(t, []*x509.Certificate{issuer}, cert.Intermediates)
+	})
+
+	newRenewal := func(swapped bool) (*mockSignAuth, *mockOrderCertificateSwapper) {
+		ca := &mockSignAuth{
+			signWithContext: func(_ context.Context, csr *x509.CertificateRequest, signOpts provisioner.SignOptions, extraOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+				return []*x509.Certificate{{Subject: pkix.Name{CommonName: "foo.internal"}}}, nil
+			},
+		}
+		db := &mockOrderCertificateSwapper{
+			MockDB: MockDB{
+				MockGetAccount: validAccount,
+				MockGetOrder: func(ctx context.Context, id string) (*Order, error) {
+					o := newOrder(StatusValid, now.Add(72*time.Hour))
+					if !swapped {
+						o.CertificateID = "otherCertID"
+					}
+					return o, nil
+				},
+				MockGetCertificate: func(ctx context.Context, id string) (*Certificate, error) {
+					if id == "otherCertID" {
+						return &Certificate{ID: id, Leaf: current.Leaf}, nil
+					}
+					return expired, nil
+				},
+				MockCreateCertificate: func(ctx context.Context, cert *Certificate) error {
+					cert.ID = "newCertID"
+					return nil
+				},
+				MockUpdateOrder: func(ctx context.Context, updo *Order) error {
+					t.Error("UpdateOrder should not be called")
+					return nil
+				},
+			},
+		}
+		db.swap = func(orderID, oldCertificateID, newCertificateID string) (bool, error) {
+			assert.Equal(t, "oID", orderID)
+			assert.Equal(t, "certID", oldCertificateID)
+			assert.Equal(t, "newCertID", newCertificateID)
+			return swapped, nil
+		}
+		return ca, db
+	}
+
+	t.Run("ok swapped", func(t *testing.T) {
+		o := newOrder(StatusValid, now.Add(72*time.Hour))
+		ca, db := newRenewal(true)
+		cert, err := o.GetStarCertificate(ctx, db, ca, prov)
+		require.NoError(t, err)
+		assert.Equal(t, "newCertID", cert.ID)
+		assert.Equal(t, "newCertID", o.CertificateID)
+	})
+
+	t.Run("ok renewed by another request", func(t *testing.T) {
+		// The order is renewed after the first read, before the lock.
+		o := newOrder(StatusValid, now.Add(72*time.Hour))
+		ca, db := newRenewal(false)
+		ca.signWithContext = func(_ context.Context, csr *x509.CertificateRequest, signOpts provisioner.SignOptions, extraOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+			t.Error("SignWithContext should not be called")
+			return nil, nil
+		}
+		cert, err := o.GetStarCertificate(ctx, db, ca, prov)
+		require.NoError(t, err)
+		assert.Equal(t, "otherCertID", cert.ID)
+		assert.Equal(t, "otherCertID", o.CertificateID)
+	})
+
+	t.Run("ok swap lost", func(t *testing.T) {
+		// The order is renewed by another instance while signing.
+		o := newOrder(StatusValid, now.Add(72*time.Hour))
+		ca, db := newRenewal(false)
+		getOrder := db.MockGetOrder
+		var calls int
+		db.MockGetOrder = func(ctx context.Context, id string) (*Order, error) {
+			if calls++; calls == 1 {
+				return newOrder(StatusValid, now.Add(72*time.Hour)), nil
+			}
+			return getOrder(ctx, id)
+		}
+		cert, err := o.GetStarCertificate(ctx, db, ca, prov)
+		require.NoError(t, err)
+		assert.Equal(t, "otherCertID", cert.ID)
+		assert.Equal(t, "otherCertID", o.CertificateID)
+	})
+
+	t.Run("fail account", func(t *testing.T) {
+		o := newOrder(StatusValid, now.Add(72*time.Hour))
+		db := &MockDB{
+			MockGetAccount: func(ctx context.Context, id string) (*Account, error) {
+				return &Account{ID: id, Status: StatusDeactivated}, nil
+			},
+		}
+		_, err := o.GetStarCertificate(ctx, db, &mockSignAuth{}, prov)
+		var acmeErr *Error
+		require.ErrorAs(t, err, &acmeErr)
+		assert.Equal(t, officialACMEPrefix+ErrorUnauthorizedType.String(), acmeErr.Type)
+	})
+
+	t.Run("fail not auto-renewal", func(t *testing.T) {
+		o := newOrder(StatusValid, now.Add(72*time.Hour))
+		o.AutoRenewal = nil
+		_, err := o.GetStarCertificate(ctx, &MockDB{}, &mockSignAuth{}, prov)
+		var acmeErr *Error
+		require.ErrorAs(t, err, &acmeErr)
+		assert.Equal(t, officialACMEPrefix+ErrorMalformedType.String(), acmeErr.Type)
+	})
+
+	t.Run("fail canceled", func(t *testing.T) {
+		o := newOrder(StatusCanceled, now.Add(72*time.Hour))
+		_, err := o.GetStarCertificate(ctx, &MockDB{}, &mockSignAuth{}, prov)
+		var acmeErr *Error
+		require.ErrorAs(t, err, &acmeErr)
+		assert.Equal(t, officialACMEPrefix+ErrorAutoRenewalCanceledType.String(), acmeErr.Type)
+	})
+
+	t.Run("fail not valid", func(t *testing.T) {
+		o := newOrder(StatusReady, now.Add(72*time.Hour))
+		_, err := o.GetStarCertificate(ctx, &MockDB{}, &mockSignAuth{}, prov)
+		var acmeErr *Error
+		require.ErrorAs(t, err, &acmeErr)
+		assert.Equal(t, officialACMEPrefix+ErrorOrderNotReadyType.String(), acmeErr.Type)
+	})
+
+	t.Run("fail expired", func(t *testing.T) {
+		o := newOrder(StatusValid, now.Add(-time.Minute))
+		_, err := o.GetStarCertificate(ctx, &MockDB{}, &mockSignAuth{}, prov)
+		var acmeErr *Error
+		require.ErrorAs(t, err, &acmeErr)
+		assert.Equal(t, officialACMEPrefix+ErrorAutoRenewalExpiredType.String(), acmeErr.Type)
+	})
+}
+
+type mockOrderCertificateSwapper struct {
+	MockDB
+	swap func(orderID, oldCertificateID, newCertificateID string) (bool, error)
+}
+
+func (m *mockOrderCertificateSwapper) SwapOrderCertificate(_ context.Context, orderID, oldCertificateID, newCertificateID string) (bool, error) {
+	return m.swap(orderID, oldCertificateID, newCertificateID)
+}
@@ -30,6 +30,7 @@ import (
 	"github.com/smallstep/certificates/authority"
 	"github.com/smallstep/certificates/authority/config"
 	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
 	"github.com/smallstep/certificates/errs"
 	"github.com/smallstep/certificates/logging"
 )
@@ -40,9 +41,11 @@ type Authority interface {
 	// context specifies the Authorize[Sign|Revoke|etc.] method.
 	Authorize(ctx context.Context, ott string) ([]provisioner.SignOption, error)
 	AuthorizeRenewToken(ctx context.Context, ott string) (*x509.Certificate, error)
+	ValidateToken(ctx context.Context, ott string) (*authority.TokenValidation, error)
 	GetTLSOptions() *config.TLSOptions
 	Root(shasum string) (*x509.Certificate, error)
 	SignWithContext(ctx context.Context, cr *x509.CertificateRequest, opts provisioner.SignOptions, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error)
+	FinalizePrecertificate(ctx context.Context, precert *x509.Certificate, scts [][]byte, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error)
 	Renew(peer *x509.Certificate) ([]*x509.Certificate, error)
 	RenewContext(ctx context.Context, peer *x509.Certificate, pk crypto.PublicKey) ([]*x509.Certificate, error)
 	Rekey(peer *x509.Certificate, pk crypto.PublicKey) ([]*x509.Certificate, error)
@@ -53,8 +56,12 @@ type Authority interface {
 	GetEncryptedKey(kid string) (string, error)
 	GetRoots() ([]*x509.Certificate, error)
 	GetFederation() ([]*x509.Certificate, error)
+	GetIntermediateCertificates() (current, previous []*x509.Certificate)
+	GetCertificateChains(certChain []*x509.Certificate, preferredChain string) [][]*x509.Certificate
 	Version() authority.Version
 	GetCertificateRevocationList() (*authority.CertificateRevocationListInfo, error)
+	GetIssuerCertificateRevocationList(keyID string) (*authority.CertificateRevocationListInfo, error)
+	GetPendingIssuance(ctx context.Context, id string) (*db.PendingIssuance, error)
 }
 
 // mustAuthority will be replaced on unit tests.
@@ -244,7 +251,12 @@ func scepFromProvisioner(p *provisioner.SCEP) *models.SCEP {
 		Capabilities:                  p.Capabilities,
 		IncludeRoot:                   p.IncludeRoot,
 		ExcludeIntermediate:           p.ExcludeIntermediate,
+		ExcludeRA:                     p.ExcludeRA,
+		ChainOrder:                    string(p.ChainOrder),
+		AllowRenewal:                  p.AllowRenewal,
+		RenewalMinRemainingLifetime:   p.RenewalMinRemainingLifetime,
 		MinimumPublicKeyLength:        p.MinimumPublicKeyLength,
+		MaxMessageSize:                p.MaxMessageSize,
 		DecrypterCertificate:          []byte(redacted),
 		DecrypterKeyPEM:               []byte(redacted),
 		DecrypterKeyURI:               redacted,
@@ -300,6 +312,12 @@ type FederationResponse struct {
 	Certificates []Certificate `json:"crts"`
 }
 
+// IntermediatesResponse is the response object of the intermediates request.
+type IntermediatesResponse struct {
+	Certificates []Certificate `json:"crts"`
+	Previous     []Certificate `json:"previous,omitempty"`
+}
+
 // caHandler is the type used to implement the different CA HTTP endpoints.
 type caHandler struct {
 	Authority Authority
@@ -322,6 +340,9 @@ func Route(r Router) {
 	r.MethodFunc("GET", "/health", Health)
 	r.MethodFunc("GET", "/root/{sha}", Root)
 	r.MethodFunc("POST", "/sign", Sign)
+	r.MethodFunc("POST", "/precertificates/finalize", FinalizePrecertificate)
+	r.MethodFunc("GET", "/pending-issuances/{id}", PendingIssuance)
+	r.MethodFunc("POST", "/validate-token", ValidateToken)
 	r.MethodFunc("POST", "/renew", Renew)
 	r.MethodFunc("POST", "/rekey", Rekey)
 	r.MethodFunc("POST", "/revoke", Revoke)
@@ -331,6 +352,7 @@ func Route(r Router) {
 	r.MethodFunc("GET", "/roots", Roots)
 	r.MethodFunc("GET", "/roots.pem", RootsPEM)
 	r.MethodFunc("GET", "/federation", Federation)
+	r.MethodFunc("GET", "/intermediates", Intermediates)
 	// SSH CA
 	r.MethodFunc("POST", "/ssh/sign", SSHSign)
 	r.MethodFunc("POST", "/ssh/renew", SSHRenew)
@@ -338,6 +360,7 @@ func Route(r Router) {
 	r.MethodFunc("POST", "/ssh/rekey", SSHRekey)
 	r.MethodFunc("GET", "/ssh/roots", SSHRoots)
 	r.MethodFunc("GET", "/ssh/federation", SSHFederation)
+	r.MethodFunc("GET", "/ssh/krl", SSHKRL)
 	r.MethodFunc("POST", "/ssh/config", SSHConfig)
 	r.MethodFunc("POST", "/ssh/config/{type}", SSHConfig)
 	r.MethodFunc("POST", "/ssh/check-host", SSHCheckHost)
@@ -387,6 +410,16 @@ func certChainToPEM(certChain []*x509.Certificate) []Certificate {
 	return certChainPEM
 }
 
+// certChainsToPEM converts the chains returned by GetCertificateChains, it
+// returns the first chain and the alternate ones.
+func certChainsToPEM(chains [][]*x509.Certificate) ([]Certificate, [][]Certificate) {
+	var alternateChainsPEM [][]Certificate
+	for _, chain := range chains[1:] {
+		alternateChainsPEM = append(alternateChainsPEM, certChainToPEM(chain))
+	}
+	return certChainToPEM(chains[0]), alternateChainsPEM
+}
+
 // Provisioners returns the list of provisioners configured in the authority.
 func Provisioners(w http.ResponseWriter, r *http.Request) {
 	cursor, limit, err := ParseCursor(r)
@@ -478,6 +511,25 @@ func Federation(w http.ResponseWriter, r *http.Request) {
 	}, http.StatusCreated)
 }
 
+// Intermediates returns the intermediate certificates used to sign new
+// certificates, and the previous intermediates that are still valid after an
+// intermediate rotation.
+func Intermediates(w http.ResponseWriter, r *http.Request) {
+	current, previous := mustAuthority(r.Context()).GetIntermediateCertificates()
+
+	resp := &IntermediatesResponse{
+		Certificates: make([]Certificate, len(current)),
+	}
+	for i := range current {
+		resp.Certificates[i] = Certificate{current[i]}
+	}
+	for _, crt := range previous {
+		resp.Previous = append(resp.Previous, Certificate{crt})
+	}
+
+	render.JSON(w, resp)
+}
+
 var oidStepProvisioner = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 37476, 9000, 64, 1}
 
 type stepProvisioner struct {
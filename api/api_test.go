@@ -36,6 +36,7 @@ import (
 
 	"github.com/smallstep/certificates/authority"
 	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
 	"github.com/smallstep/certificates/errs"
 	"github.com/smallstep/certificates/logging"
 	"github.com/smallstep/certificates/templates"
@@ -187,9 +188,11 @@ type mockAuthority struct {
 	err                          error
 	authorize                    func(ctx context.Context, ott string) ([]provisioner.SignOption, error)
 	authorizeRenewToken          func(ctx context.Context, ott string) (*x509.Certificate, error)
+	validateToken                func(ctx context.Context, ott string) (*authority.TokenValidation, error)
 	getTLSOptions                func() *authority.TLSOptions
 	root                         func(shasum string) (*x509.Certificate, error)
 	signWithContext              func(ctx context.Context, cr *x509.CertificateRequest, opts provisioner.SignOptions, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error)
+	finalizePrecertificate       func(ctx context.Context, precert *x509.Certificate, scts [][]byte, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error)
 	renew                        func(cert *x509.Certificate) ([]*x509.Certificate, error)
 	rekey                        func(oldCert *x509.Certificate, pk crypto.PublicKey) ([]*x509.Certificate, error)
 	renewContext                 func(ctx context.Context, oldCert *x509.Certificate, pk crypto.PublicKey) ([]*x509.Certificate, error)
@@ -200,7 +203,11 @@ type mockAuthority struct {
 	getEncryptedKey              func(kid string) (string, error)
 	getRoots                     func() ([]*x509.Certificate, error)
 	getFederation                func() ([]*x509.Certificate, error)
+	getIntermediateCertificates  func() ([]*x509.Certificate, []*x509.Certificate)
+	getCertificateChains         func(certChain []*x509.Certificate, preferredChain string) [][]*x509.Certificate
 	getCRL                       func() (*authority.CertificateRevocationListInfo, error)
+	getIssuerCRL                 func(keyID string) (*authority.CertificateRevocationListInfo, error)
+	getPendingIssuance           func(ctx context.Context, id string) (*db.PendingIssuance, error)
 	signSSH                      func(ctx context.Context, key ssh.PublicKey, opts provisioner.SignSSHOptions, signOpts ...provisioner.SignOption) (*ssh.Certificate, error)
 	signSSHAddUser               func(ctx context.Context, key ssh.PublicKey, cert *ssh.Certificate) (*ssh.Certificate, error)
 	renewSSH                     func(ctx context.Context, cert *ssh.Certificate) (*ssh.Certificate, error)
@@ -211,9 +218,17 @@ type mockAuthority struct {
 	getSSHConfig                 func(ctx context.Context, typ string, data map[string]string) ([]templates.Output, error)
 	checkSSHHost                 func(ctx context.Context, principal, token string) (bool, error)
 	getSSHBastion                func(ctx context.Context, user string, hostname string) (*authority.Bastion, error)
+	getSSHKRL                    func(ctx context.Context) ([]byte, error)
 	version                      func() authority.Version
 }
 
+func (m *mockAuthority) GetPendingIssuance(ctx context.Context, id string) (*db.PendingIssuance, error) {
+	if m.getPendingIssuance != nil {
+		return m.getPendingIssuance(ctx, id)
+	}
+	return m.ret1.(*db.PendingIssuance), m.err
+}
+
 func (m *mockAuthority) GetCertificateRevocationList() (*authority.CertificateRevocationListInfo, error) {
 	if m.getCRL != nil {
 		return m.getCRL()
@@ -222,6 +237,14 @@ func (m *mockAuthority) GetCertificateRevocationList() (*authority.CertificateRe
 	return m.ret1.(*authority.CertificateRevocationListInfo), m.err
 }
 
+func (m *mockAuthority) GetIssuerCertificateRevocationList(keyID string) (*authority.CertificateRevocationListInfo, error) {
+	if m.getIssuerCRL != nil {
+		return m.getIssuerCRL(keyID)
+	}
+
+	return m.ret1.(*authority.CertificateRevocationListInfo), m.err
+}
+
 // TODO: remove once Authorize is deprecated.
 func (m *mockAuthority) Authorize(ctx context.Context, ott string) ([]provisioner.SignOption, error) {
 	if m.authorize != nil {
@@ -230,6 +253,13 @@ func (m *mockAuthority) Authorize(ctx context.Context, ott string) ([]provisione
 	return m.ret1.([]provisioner.SignOption), m.err
 }
 
+func (m *mockAuthority) ValidateToken(ctx context.Context, ott string) (*authority.TokenValidation, error) {
+	if m.validateToken != nil {
+		return m.validateToken(ctx, ott)
+	}
+	return m.ret1.(*authority.TokenValidation), m.err
+}
+
 func (m *mockAuthority) AuthorizeRenewToken(ctx context.Context, ott string) (*x509.Certificate, error) {
 	if m.authorizeRenewToken != nil {
 		return m.authorizeRenewToken(ctx, ott)
@@ -258,6 +288,13 @@ func (m *mockAuthority) SignWithContext(ctx context.Context, cr *x509.Certificat
 	return []*x509.Certificate{m.ret1.(*x509.Certificate), m.ret2.(*x509.Certificate)}, m.err
 }
 
+func (m *mockAuthority) FinalizePrecertificate(ctx context.Context, precert *x509.Certificate, scts [][]byte, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+	if m.finalizePrecertificate != nil {
+		return m.finalizePrecertificate(ctx, precert, scts, signOpts...)
+	}
+	return []*x509.Certificate{m.ret1.(*x509.Certificate), m.ret2.(*x509.Certificate)}, m.err
+}
+
 func (m *mockAuthority) Renew(cert *x509.Certificate) ([]*x509.Certificate, error) {
 	if m.renew != nil {
 		return m.renew(cert)
@@ -328,6 +365,20 @@ func (m *mockAuthority) GetFederation() ([]*x509.Certificate, error) {
 	return m.ret1.([]*x509.Certificate), m.err
 }
 
+func (m *mockAuthority) GetIntermediateCertificates() ([]*x509.Certificate, []*x509.Certificate) {
+	if m.getIntermediateCertificates != nil {
+		return m.getIntermediateCertificates()
+	}
+	return m.ret1.([]*x509.Certificate), m.ret2.([]*x509.Certificate)
+}
+
+func (m *mockAuthority) GetCertificateChains(certChain []*x509.Certificate, preferredChain string) [][]*x509.Certificate {
+	if m.getCertificateChains != nil {
+		return m.getCertificateChains(certChain, preferredChain)
+	}
+	return [][]*x509.Certificate{certChain}
+}
+
 func (m *mockAuthority) SignSSH(ctx context.Context, key ssh.PublicKey, opts provisioner.SignSSHOptions, signOpts ...provisioner.SignOption) (*ssh.Certificate, error) {
 	if m.signSSH != nil {
 		return m.signSSH(ctx, key, opts, signOpts...)
@@ -398,6 +449,13 @@ func (m *mockAuthority) GetSSHBastion(ctx context.Context, user, hostname string
 	return m.ret1.(*authority.Bastion), m.err
 }
 
+func (m *mockAuthority) GetSSHKeyRevocationList(ctx context.Context) ([]byte, error) {
+	if m.getSSHKRL != nil {
+		return m.getSSHKRL(ctx)
+	}
+	return m.ret1.([]byte), m.err
+}
+
 func (m *mockAuthority) Version() authority.Version {
 	if m.version != nil {
 		return m.version()
@@ -911,6 +969,9 @@ func Test_Sign(t *testing.T) {
 		{"validate error", string(invalid), nil, nil, nil, nil, nil, http.StatusBadRequest, nil},
 		{"authorize error", string(valid), nil, fmt.Errorf("an error"), nil, nil, nil, http.StatusUnauthorized, nil},
 		{"sign error", string(valid), nil, nil, nil, nil, fmt.Errorf("an error"), http.StatusForbidden, nil},
+		{"pending approval", string(valid), nil, nil, nil, nil, &authority.PendingIssuanceError{
+			ID: "the-id", ExpiresAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		}, http.StatusAccepted, []byte(`{"id":"the-id","status":"pending","expiresAt":"2026-01-02T03:04:05Z"}`)},
 	}
 
 	for _, tt := range tests {
@@ -947,6 +1008,45 @@ func Test_Sign(t *testing.T) {
 	}
 }
 
+func Test_Sign_alternateChains(t *testing.T) {
+	csr := parseCertificateRequest(csrPEM)
+	body, err := json.Marshal(SignRequest{
+		CsrPEM:         CertificateRequest{csr},
+		OTT:            "foobarzar",
+		PreferredChain: "Smallstep Root CA",
+	})
+	require.NoError(t, err)
+
+	cert, root := parseCertificate(certPEM), parseCertificate(rootPEM)
+	mockMustAuthority(t, &mockAuthority{
+		ret1: cert, ret2: root,
+		authorize: func(ctx context.Context, ott string) ([]provisioner.SignOption, error) {
+			return nil, nil
+		},
+		getTLSOptions: func() *authority.TLSOptions {
+			return nil
+		},
+		getCertificateChains: func(certChain []*x509.Certificate, preferredChain string) [][]*x509.Certificate {
+			assert.Equal(t, []*x509.Certificate{cert, root}, certChain)
+			assert.Equal(t, "Smallstep Root CA", preferredChain)
+			return [][]*x509.Certificate{{cert}, {cert, root}}
+		},
+	})
+	req := httptest.NewRequest("POST", "http://example.com/sign", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	Sign(logging.NewResponseLogger(w), req)
+	res := w.Result()
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+
+	var resp SignResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&resp))
+	res.Body.Close()
+	assert.Equal(t, Certificate{cert}, resp.ServerPEM)
+	assert.Equal(t, Certificate{}, resp.CaPEM)
+	assert.Equal(t, []Certificate{{cert}}, resp.CertChainPEM)
+	assert.Equal(t, [][]Certificate{{{cert}, {root}}}, resp.AlternateChains)
+}
+
 func Test_Renew(t *testing.T) {
 	cs := &tls.ConnectionState{
 		PeerCertificates: []*x509.Certificate{parseCertificate(certPEM)},
@@ -1092,6 +1192,32 @@ func Test_Renew(t *testing.T) {
 	}
 }
 
+func Test_Renew_preferredChain(t *testing.T) {
+	cert, root := parseCertificate(certPEM), parseCertificate(rootPEM)
+	mockMustAuthority(t, &mockAuthority{
+		ret1: cert, ret2: root,
+		getTLSOptions: func() *authority.TLSOptions {
+			return nil
+		},
+		getCertificateChains: func(certChain []*x509.Certificate, preferredChain string) [][]*x509.Certificate {
+			assert.Equal(t, "Smallstep Root CA", preferredChain)
+			return [][]*x509.Certificate{{cert}, certChain}
+		},
+	})
+	req := httptest.NewRequest("POST", "http://example.com/renew?preferredChain=Smallstep+Root+CA", http.NoBody)
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	w := httptest.NewRecorder()
+	Renew(logging.NewResponseLogger(w), req)
+	res := w.Result()
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+
+	var resp SignResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&resp))
+	res.Body.Close()
+	assert.Equal(t, []Certificate{{cert}}, resp.CertChainPEM)
+	assert.Equal(t, [][]Certificate{{{cert}, {root}}}, resp.AlternateChains)
+}
+
 func Test_Rekey(t *testing.T) {
 	cs := &tls.ConnectionState{
 		PeerCertificates: []*x509.Certificate{parseCertificate(certPEM)},
@@ -1445,6 +1571,44 @@ func Test_Federation(t *testing.T) {
 	}
 }
 
+func Test_Intermediates(t *testing.T) {
+	crt := parseCertificate(rootPEM)
+	pemCrt := strings.ReplaceAll(rootPEM, "\n", `\n`) + `\n`
+	tests := []struct {
+		name     string
+		current  []*x509.Certificate
+		previous []*x509.Certificate
+		expected string
+	}{
+		{"ok", []*x509.Certificate{crt}, nil, `{"crts":["` + pemCrt + `"]}`},
+		{"ok previous", []*x509.Certificate{crt}, []*x509.Certificate{crt}, `{"crts":["` + pemCrt + `"],"previous":["` + pemCrt + `"]}`},
+		{"ok empty", nil, nil, `{"crts":[]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAuthority{ret1: tt.current, ret2: tt.previous})
+			req := httptest.NewRequest("GET", "http://example.com/intermediates", http.NoBody)
+			w := httptest.NewRecorder()
+			Intermediates(w, req)
+			res := w.Result()
+
+			if res.StatusCode != http.StatusOK {
+				t.Errorf("caHandler.Intermediates StatusCode = %d, wants %d", res.StatusCode, http.StatusOK)
+			}
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			if err != nil {
+				t.Errorf("caHandler.Intermediates unexpected error = %v", err)
+			}
+			if !bytes.Equal(bytes.TrimSpace(body), []byte(tt.expected)) {
+				t.Errorf("caHandler.Intermediates Body = %s, wants %s", body, tt.expected)
+			}
+		})
+	}
+}
+
 func Test_fmtPublicKey(t *testing.T) {
 	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	if err != nil {
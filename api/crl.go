@@ -6,12 +6,23 @@ import (
 	"time"
 
 	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority"
 	"github.com/smallstep/certificates/errs"
 )
 
-// CRL is an HTTP handler that returns the current CRL in DER or PEM format
+// CRL is an HTTP handler that returns the current CRL in DER or PEM format.
+// The CRL of the certificates issued by a previous intermediate is returned
+// if the issuer parameter is set to its hexadecimal subject key id.
 func CRL(w http.ResponseWriter, r *http.Request) {
-	crlInfo, err := mustAuthority(r.Context()).GetCertificateRevocationList()
+	var (
+		crlInfo *authority.CertificateRevocationListInfo
+		err     error
+	)
+	if keyID := r.URL.Query().Get("issuer"); keyID != "" {
+		crlInfo, err = mustAuthority(r.Context()).GetIssuerCertificateRevocationList(keyID)
+	} else {
+		crlInfo, err = mustAuthority(r.Context()).GetCertificateRevocationList()
+	}
 	if err != nil {
 		render.Error(w, err)
 		return
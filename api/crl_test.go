@@ -46,11 +46,23 @@ func Test_CRL(t *testing.T) {
 		{"ok/empty-pem", "http://example.com/crl?pem=true", nil, http.StatusOK, &authority.CertificateRevocationListInfo{Data: nil}, emptyPEMData, http.Header{"Content-Type": []string{"application/x-pem-file"}, "Content-Disposition": []string{`attachment; filename="crl.pem"`}}, ""},
 		{"fail/internal", "http://example.com/crl", errs.Wrap(http.StatusInternalServerError, errors.New("failure"), "authority.GetCertificateRevocationList"), http.StatusInternalServerError, nil, nil, http.Header{}, `{"status":500,"message":"The certificate authority encountered an Internal Server Error. Please see the certificate authority logs for more info."}`},
 		{"fail/nil", "http://example.com/crl", nil, http.StatusNotFound, nil, nil, http.Header{}, `{"status":404,"message":"no CRL available"}`},
+		{"ok/issuer", "http://example.com/crl?issuer=0a0b", nil, http.StatusOK, &authority.CertificateRevocationListInfo{Data: data}, data, http.Header{"Content-Type": []string{"application/pkix-crl"}, "Content-Disposition": []string{`attachment; filename="crl.der"`}}, ""},
+		{"fail/issuer", "http://example.com/crl?issuer=0c0d", errs.New(http.StatusNotFound, "no CRL available for issuer 0c0d"), http.StatusNotFound, nil, nil, http.Header{}, `{"status":404,"message":"no CRL available for issuer 0c0d"}`},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			mockMustAuthority(t, &mockAuthority{ret1: tt.crlInfo, err: tt.err})
+			mockMustAuthority(t, &mockAuthority{
+				getCRL: func() (*authority.CertificateRevocationListInfo, error) {
+					return tt.crlInfo, tt.err
+				},
+				getIssuerCRL: func(keyID string) (*authority.CertificateRevocationListInfo, error) {
+					if keyID != "0a0b" {
+						return nil, errs.New(http.StatusNotFound, "no CRL available for issuer %s", keyID)
+					}
+					return tt.crlInfo, tt.err
+				},
+			})
 
 			chiCtx := chi.NewRouteContext()
 			req := httptest.NewRequest("GET", tt.url, http.NoBody)
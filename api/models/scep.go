@@ -16,22 +16,27 @@ var errDummyImplementation = errors.New("dummy implementation")
 // are implemented, but return a dummy error.
 // TODO(hs): remove reliance on the interface for the API responses
 type SCEP struct {
-	ID                            string               `json:"-"`
-	Type                          string               `json:"type"`
-	Name                          string               `json:"name"`
-	ForceCN                       bool                 `json:"forceCN"`
-	ChallengePassword             string               `json:"challenge"`
-	Capabilities                  []string             `json:"capabilities,omitempty"`
-	IncludeRoot                   bool                 `json:"includeRoot"`
-	ExcludeIntermediate           bool                 `json:"excludeIntermediate"`
-	MinimumPublicKeyLength        int                  `json:"minimumPublicKeyLength"`
-	DecrypterCertificate          []byte               `json:"decrypterCertificate"`
-	DecrypterKeyPEM               []byte               `json:"decrypterKeyPEM"`
-	DecrypterKeyURI               string               `json:"decrypterKey"`
-	DecrypterKeyPassword          string               `json:"decrypterKeyPassword"`
-	EncryptionAlgorithmIdentifier int                  `json:"encryptionAlgorithmIdentifier"`
-	Options                       *provisioner.Options `json:"options,omitempty"`
-	Claims                        *provisioner.Claims  `json:"claims,omitempty"`
+	ID                            string                `json:"-"`
+	Type                          string                `json:"type"`
+	Name                          string                `json:"name"`
+	ForceCN                       bool                  `json:"forceCN"`
+	ChallengePassword             string                `json:"challenge"`
+	Capabilities                  []string              `json:"capabilities,omitempty"`
+	IncludeRoot                   bool                  `json:"includeRoot"`
+	ExcludeIntermediate           bool                  `json:"excludeIntermediate"`
+	ExcludeRA                     bool                  `json:"excludeRA,omitempty"`
+	ChainOrder                    string                `json:"chainOrder,omitempty"`
+	AllowRenewal                  bool                  `json:"allowRenewal,omitempty"`
+	RenewalMinRemainingLifetime   *provisioner.Duration `json:"renewalMinRemainingLifetime,omitempty"`
+	MinimumPublicKeyLength        int                   `json:"minimumPublicKeyLength"`
+	MaxMessageSize                int64                 `json:"maxMessageSize,omitempty"`
+	DecrypterCertificate          []byte                `json:"decrypterCertificate"`
+	DecrypterKeyPEM               []byte                `json:"decrypterKeyPEM"`
+	DecrypterKeyURI               string                `json:"decrypterKey"`
+	DecrypterKeyPassword          string                `json:"decrypterKeyPassword"`
+	EncryptionAlgorithmIdentifier int                   `json:"encryptionAlgorithmIdentifier"`
+	Options                       *provisioner.Options  `json:"options,omitempty"`
+	Claims                        *provisioner.Claims   `json:"claims,omitempty"`
 }
 
 // GetID returns the provisioner unique identifier.
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/errs"
+)
+
+// PendingIssuanceResponse is the response object of a certificate request that
+// requires the approval of an administrator. The certificate is only set once
+// the request is approved.
+type PendingIssuanceResponse struct {
+	ID           string        `json:"id"`
+	Status       string        `json:"status"`
+	Reason       string        `json:"reason,omitempty"`
+	ExpiresAt    time.Time     `json:"expiresAt"`
+	ServerPEM    *Certificate  `json:"crt,omitempty"`
+	CaPEM        *Certificate  `json:"ca,omitempty"`
+	CertChainPEM []Certificate `json:"certChain,omitempty"`
+}
+
+// PendingIssuance is an HTTP handler that returns the status of a certificate
+// request waiting for approval, and the certificate once it's issued. The id
+// of the request is only known by the requester and the administrators.
+func PendingIssuance(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	pi, err := mustAuthority(ctx).GetPendingIssuance(ctx, chi.URLParam(r, "id"))
+	if err != nil {
+		var sc render.StatusCodedError
+		if errors.As(err, &sc) && sc.StatusCode() == http.StatusNotFound {
+			render.Error(w, errs.NotFoundErr(err))
+			return
+		}
+		render.Error(w, errs.InternalServerErr(err))
+		return
+	}
+
+	resp := &PendingIssuanceResponse{
+		ID:        pi.ID,
+		Status:    string(pi.Status),
+		Reason:    pi.Reason,
+		ExpiresAt: pi.ExpiresAt,
+	}
+	if pi.Status == db.PendingIssuanceStatusIssued {
+		certChain := make([]*x509.Certificate, len(pi.Certificates))
+		for i, b := range pi.Certificates {
+			if certChain[i], err = x509.ParseCertificate(b); err != nil {
+				render.Error(w, errs.InternalServerErr(err))
+				return
+			}
+		}
+		resp.CertChainPEM = certChainToPEM(certChain)
+		if len(resp.CertChainPEM) > 0 {
+			resp.ServerPEM = &resp.CertChainPEM[0]
+		}
+		if len(resp.CertChainPEM) > 1 {
+			resp.CaPEM = &resp.CertChainPEM[1]
+		}
+	}
+
+	render.JSON(w, resp)
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/logging"
+)
+
+func Test_PendingIssuance(t *testing.T) {
+	crt, root := parseCertificate(certPEM), parseCertificate(rootPEM)
+	expiresAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	crtJSON := `"` + strings.ReplaceAll(certPEM, "\n", `\n`) + `\n"`
+	rootJSON := `"` + strings.ReplaceAll(rootPEM, "\n", `\n`) + `\n"`
+
+	tests := []struct {
+		name       string
+		pi         *db.PendingIssuance
+		err        error
+		statusCode int
+		expected   []byte
+	}{
+		{"ok pending", &db.PendingIssuance{ID: "the-id", Status: db.PendingIssuanceStatusPending, ExpiresAt: expiresAt}, nil, http.StatusOK,
+			[]byte(`{"id":"the-id","status":"pending","expiresAt":"2026-01-02T03:04:05Z"}`)},
+		{"ok denied", &db.PendingIssuance{ID: "the-id", Status: db.PendingIssuanceStatusDenied, Reason: "not allowed", ExpiresAt: expiresAt}, nil, http.StatusOK,
+			[]byte(`{"id":"the-id","status":"denied","reason":"not allowed","expiresAt":"2026-01-02T03:04:05Z"}`)},
+		{"ok issued", &db.PendingIssuance{ID: "the-id", Status: db.PendingIssuanceStatusIssued, ExpiresAt: expiresAt, Certificates: [][]byte{crt.Raw, root.Raw}}, nil, http.StatusOK,
+			[]byte(`{"id":"the-id","status":"issued","expiresAt":"2026-01-02T03:04:05Z","crt":` + crtJSON + `,"ca":` + rootJSON + `,"certChain":[` + crtJSON + `,` + rootJSON + `]}`)},
+		{"fail not found", nil, admin.NewError(admin.ErrorNotFoundType, "pending issuance the-id not found"), http.StatusNotFound, nil},
+		{"fail certificate", &db.PendingIssuance{ID: "the-id", Status: db.PendingIssuanceStatusIssued, Certificates: [][]byte{[]byte("foo")}}, nil, http.StatusInternalServerError, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAuthority{
+				getPendingIssuance: func(ctx context.Context, id string) (*db.PendingIssuance, error) {
+					assert.Equal(t, "the-id", id)
+					return tt.pi, tt.err
+				},
+			})
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("id", "the-id")
+			req := httptest.NewRequest("GET", "http://example.com/pending-issuances/the-id", http.NoBody)
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, chiCtx))
+			w := httptest.NewRecorder()
+			PendingIssuance(logging.NewResponseLogger(w), req)
+			res := w.Result()
+
+			assert.Equal(t, tt.statusCode, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			require.NoError(t, err)
+			if tt.statusCode < http.StatusBadRequest {
+				assert.Equal(t, string(tt.expected), string(bytes.TrimSpace(body)))
+			}
+		})
+	}
+}
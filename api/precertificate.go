@@ -0,0 +1,81 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/smallstep/certificates/api/read"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/errs"
+)
+
+// FinalizePrecertificateRequest is the request body used to get the final
+// certificate of an RFC 6962 pre-certificate. The SCTs are the serialized
+// signed certificate timestamps returned by the CT logs.
+type FinalizePrecertificateRequest struct {
+	PrecertificatePEM Certificate `json:"precertificate"`
+	SCTs              [][]byte    `json:"scts"`
+	OTT               string      `json:"ott"`
+}
+
+// Validate checks the fields of the FinalizePrecertificateRequest and returns
+// nil if they are ok or an error if something is wrong.
+func (s *FinalizePrecertificateRequest) Validate() error {
+	if s.PrecertificatePEM.Certificate == nil {
+		return errs.BadRequest("missing precertificate")
+	}
+	if len(s.SCTs) == 0 {
+		return errs.BadRequest("missing scts")
+	}
+	if s.OTT == "" {
+		return errs.BadRequest("missing ott")
+	}
+	return nil
+}
+
+// FinalizePrecertificate is an HTTP handler that reads a pre-certificate, the
+// signed certificate timestamps of the CT logs and a sign one-time-token (ott)
+// from the body, and returns the final certificate with the embedded SCTs. The
+// token must be issued by the provisioner that signed the pre-certificate.
+func FinalizePrecertificate(w http.ResponseWriter, r *http.Request) {
+	var body FinalizePrecertificateRequest
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, errs.BadRequestErr(err, "error reading request body"))
+		return
+	}
+
+	logOtt(w, body.OTT)
+	if err := body.Validate(); err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	ctx := r.Context()
+	a := mustAuthority(ctx)
+
+	ctx = provisioner.NewContextWithMethod(ctx, provisioner.SignMethod)
+	signOpts, err := a.Authorize(ctx, body.OTT)
+	if err != nil {
+		render.Error(w, errs.UnauthorizedErr(err))
+		return
+	}
+
+	certChain, err := a.FinalizePrecertificate(ctx, body.PrecertificatePEM.Certificate, body.SCTs, signOpts...)
+	if err != nil {
+		render.Error(w, errs.ForbiddenErr(err, "error finalizing pre-certificate"))
+		return
+	}
+	certChainPEM := certChainToPEM(certChain)
+	var caPEM Certificate
+	if len(certChainPEM) > 1 {
+		caPEM = certChainPEM[1]
+	}
+
+	LogCertificate(w, certChain[0])
+	render.JSONStatus(w, &SignResponse{
+		ServerPEM:    certChainPEM[0],
+		CaPEM:        caPEM,
+		CertChainPEM: certChainPEM,
+		TLSOptions:   a.GetTLSOptions(),
+	}, http.StatusCreated)
+}
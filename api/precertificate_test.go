@@ -0,0 +1,115 @@
+package api
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/certificates/logging"
+)
+
+func TestFinalizePrecertificateRequest_Validate(t *testing.T) {
+	precert := Certificate{parseCertificate(certPEM)}
+	scts := [][]byte{[]byte("sct")}
+	tests := []struct {
+		name    string
+		req     FinalizePrecertificateRequest
+		wantErr string
+	}{
+		{"ok", FinalizePrecertificateRequest{precert, scts, "ott"}, ""},
+		{"fail precertificate", FinalizePrecertificateRequest{Certificate{}, scts, "ott"}, "missing precertificate"},
+		{"fail scts", FinalizePrecertificateRequest{precert, nil, "ott"}, "missing scts"},
+		{"fail ott", FinalizePrecertificateRequest{precert, scts, ""}, "missing ott"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.req.Validate()
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestFinalizePrecertificate(t *testing.T) {
+	precert := parseCertificate(certPEM)
+	scts := [][]byte{[]byte("sct-one"), []byte("sct-two")}
+	valid, err := json.Marshal(FinalizePrecertificateRequest{
+		PrecertificatePEM: Certificate{precert},
+		SCTs:              scts,
+		OTT:               "the-ott",
+	})
+	require.NoError(t, err)
+	invalid, err := json.Marshal(FinalizePrecertificateRequest{
+		PrecertificatePEM: Certificate{precert},
+		OTT:               "the-ott",
+	})
+	require.NoError(t, err)
+
+	prov := &provisioner.JWK{Name: "jwk"}
+	expected := []byte(`{"crt":"` + strings.ReplaceAll(certPEM, "\n", `\n`) + `\n","ca":"` + strings.ReplaceAll(rootPEM, "\n", `\n`) + `\n","certChain":["` + strings.ReplaceAll(certPEM, "\n", `\n`) + `\n","` + strings.ReplaceAll(rootPEM, "\n", `\n`) + `\n"]}`)
+
+	tests := []struct {
+		name        string
+		input       string
+		authErr     error
+		finalizeErr error
+		statusCode  int
+	}{
+		{"ok", string(valid), nil, nil, http.StatusCreated},
+		{"fail read", "{", nil, nil, http.StatusBadRequest},
+		{"fail validate", string(invalid), nil, nil, http.StatusBadRequest},
+		{"fail authorize", string(valid), errors.New("force"), nil, http.StatusUnauthorized},
+		{"fail finalize", string(valid), nil, errors.New("force"), http.StatusForbidden},
+		{"fail finalize bad request", string(valid), nil, errs.BadRequest("certificate is not a pre-certificate"), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAuthority{
+				authorize: func(ctx context.Context, ott string) ([]provisioner.SignOption, error) {
+					assert.Equal(t, "the-ott", ott)
+					assert.Equal(t, provisioner.SignMethod, provisioner.MethodFromContext(ctx))
+					return []provisioner.SignOption{prov}, tt.authErr
+				},
+				finalizePrecertificate: func(ctx context.Context, crt *x509.Certificate, s [][]byte, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+					assert.Equal(t, precert, crt)
+					assert.Equal(t, scts, s)
+					assert.Equal(t, []provisioner.SignOption{prov}, signOpts)
+					if tt.finalizeErr != nil {
+						return nil, tt.finalizeErr
+					}
+					return []*x509.Certificate{precert, parseCertificate(rootPEM)}, nil
+				},
+				getTLSOptions: func() *authority.TLSOptions {
+					return nil
+				},
+			})
+			req := httptest.NewRequest("POST", "http://example.com/precertificates/finalize", strings.NewReader(tt.input))
+			w := httptest.NewRecorder()
+			FinalizePrecertificate(logging.NewResponseLogger(w), req)
+			res := w.Result()
+			assert.Equal(t, tt.statusCode, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			require.NoError(t, err)
+			if tt.statusCode < http.StatusBadRequest {
+				assert.Equal(t, string(expected), strings.TrimSpace(string(body)))
+			}
+		})
+	}
+}
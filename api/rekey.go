@@ -50,7 +50,7 @@ func Rekey(w http.ResponseWriter, r *http.Request) {
 		render.Error(w, errs.Wrap(http.StatusInternalServerError, err, "cahandler.Rekey"))
 		return
 	}
-	certChainPEM := certChainToPEM(certChain)
+	certChainPEM, alternateChainsPEM := certChainsToPEM(a.GetCertificateChains(certChain, ""))
 	var caPEM Certificate
 	if len(certChainPEM) > 1 {
 		caPEM = certChainPEM[1]
@@ -58,9 +58,10 @@ func Rekey(w http.ResponseWriter, r *http.Request) {
 
 	LogCertificate(w, certChain[0])
 	render.JSONStatus(w, &SignResponse{
-		ServerPEM:    certChainPEM[0],
-		CaPEM:        caPEM,
-		CertChainPEM: certChainPEM,
-		TLSOptions:   a.GetTLSOptions(),
+		ServerPEM:       certChainPEM[0],
+		CaPEM:           caPEM,
+		CertChainPEM:    certChainPEM,
+		AlternateChains: alternateChainsPEM,
+		TLSOptions:      a.GetTLSOptions(),
 	}, http.StatusCreated)
 }
@@ -16,7 +16,8 @@ const (
 )
 
 // Renew uses the information of certificate in the TLS connection to create a
-// new one.
+// new one. The preferredChain query parameter selects the chain returned
+// first if the authority is configured with alternate chains.
 func Renew(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
@@ -38,7 +39,7 @@ func Renew(w http.ResponseWriter, r *http.Request) {
 		render.Error(w, errs.Wrap(http.StatusInternalServerError, err, "cahandler.Renew"))
 		return
 	}
-	certChainPEM := certChainToPEM(certChain)
+	certChainPEM, alternateChainsPEM := certChainsToPEM(a.GetCertificateChains(certChain, r.URL.Query().Get("preferredChain")))
 	var caPEM Certificate
 	if len(certChainPEM) > 1 {
 		caPEM = certChainPEM[1]
@@ -46,10 +47,11 @@ func Renew(w http.ResponseWriter, r *http.Request) {
 
 	LogCertificate(w, certChain[0])
 	render.JSONStatus(w, &SignResponse{
-		ServerPEM:    certChainPEM[0],
-		CaPEM:        caPEM,
-		CertChainPEM: certChainPEM,
-		TLSOptions:   a.GetTLSOptions(),
+		ServerPEM:       certChainPEM[0],
+		CaPEM:           caPEM,
+		CertChainPEM:    certChainPEM,
+		AlternateChains: alternateChainsPEM,
+		TLSOptions:      a.GetTLSOptions(),
 	}, http.StatusCreated)
 }
 
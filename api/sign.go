@@ -3,12 +3,15 @@ package api
 import (
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/smallstep/certificates/api/read"
 	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority"
 	"github.com/smallstep/certificates/authority/config"
 	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
 	"github.com/smallstep/certificates/errs"
 )
 
@@ -19,6 +22,15 @@ type SignRequest struct {
 	NotAfter     TimeDuration       `json:"notAfter,omitempty"`
 	NotBefore    TimeDuration       `json:"notBefore,omitempty"`
 	TemplateData json.RawMessage    `json:"templateData,omitempty"`
+
+	// Precertificate requests an RFC 6962 pre-certificate with the critical
+	// poison extension instead of a final certificate.
+	Precertificate bool `json:"precertificate,omitempty"`
+
+	// PreferredChain is the common name of the issuer of the topmost
+	// certificate of the chain returned first, if the authority is configured
+	// with alternate chains.
+	PreferredChain string `json:"preferredChain,omitempty"`
 }
 
 // Validate checks the fields of the SignRequest and returns nil if they are ok
@@ -38,12 +50,15 @@ func (s *SignRequest) Validate() error {
 }
 
 // SignResponse is the response object of the certificate signature request.
+// The alternate chains contain the same leaf certificate with a different
+// chain of intermediates, e.g. intermediates cross-signed by other roots.
 type SignResponse struct {
-	ServerPEM    Certificate          `json:"crt"`
-	CaPEM        Certificate          `json:"ca"`
-	CertChainPEM []Certificate        `json:"certChain"`
-	TLSOptions   *config.TLSOptions   `json:"tlsOptions,omitempty"`
-	TLS          *tls.ConnectionState `json:"-"`
+	ServerPEM       Certificate          `json:"crt"`
+	CaPEM           Certificate          `json:"ca"`
+	CertChainPEM    []Certificate        `json:"certChain"`
+	AlternateChains [][]Certificate      `json:"alternateChains,omitempty"`
+	TLSOptions      *config.TLSOptions   `json:"tlsOptions,omitempty"`
+	TLS             *tls.ConnectionState `json:"-"`
 }
 
 // Sign is an HTTP handler that reads a certificate request and an
@@ -63,9 +78,10 @@ func Sign(w http.ResponseWriter, r *http.Request) {
 	}
 
 	opts := provisioner.SignOptions{
-		NotBefore:    body.NotBefore,
-		NotAfter:     body.NotAfter,
-		TemplateData: body.TemplateData,
+		NotBefore:      body.NotBefore,
+		NotAfter:       body.NotAfter,
+		TemplateData:   body.TemplateData,
+		Precertificate: body.Precertificate,
 	}
 
 	ctx := r.Context()
@@ -80,10 +96,20 @@ func Sign(w http.ResponseWriter, r *http.Request) {
 
 	certChain, err := a.SignWithContext(ctx, body.CsrPEM.CertificateRequest, opts, signOpts...)
 	if err != nil {
+		// The certificate can be retrieved once the request is approved.
+		var pe *authority.PendingIssuanceError
+		if errors.As(err, &pe) {
+			render.JSONStatus(w, &PendingIssuanceResponse{
+				ID:        pe.ID,
+				Status:    string(db.PendingIssuanceStatusPending),
+				ExpiresAt: pe.ExpiresAt,
+			}, http.StatusAccepted)
+			return
+		}
 		render.Error(w, errs.ForbiddenErr(err, "error signing certificate"))
 		return
 	}
-	certChainPEM := certChainToPEM(certChain)
+	certChainPEM, alternateChainsPEM := certChainsToPEM(a.GetCertificateChains(certChain, body.PreferredChain))
 	var caPEM Certificate
 	if len(certChainPEM) > 1 {
 		caPEM = certChainPEM[1]
@@ -91,9 +117,10 @@ func Sign(w http.ResponseWriter, r *http.Request) {
 
 	LogCertificate(w, certChain[0])
 	render.JSONStatus(w, &SignResponse{
-		ServerPEM:    certChainPEM[0],
-		CaPEM:        caPEM,
-		CertChainPEM: certChainPEM,
-		TLSOptions:   a.GetTLSOptions(),
+		ServerPEM:       certChainPEM[0],
+		CaPEM:           caPEM,
+		CertChainPEM:    certChainPEM,
+		AlternateChains: alternateChainsPEM,
+		TLSOptions:      a.GetTLSOptions(),
 	}, http.StatusCreated)
 }
@@ -16,7 +16,9 @@ import (
 	"github.com/smallstep/certificates/authority"
 	"github.com/smallstep/certificates/authority/config"
 	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
 	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/certificates/logging"
 	"github.com/smallstep/certificates/templates"
 )
 
@@ -32,6 +34,7 @@ type SSHAuthority interface {
 	CheckSSHHost(ctx context.Context, principal string, token string) (bool, error)
 	GetSSHHosts(ctx context.Context, cert *x509.Certificate) ([]config.Host, error)
 	GetSSHBastion(ctx context.Context, user string, hostname string) (*config.Bastion, error)
+	GetSSHKeyRevocationList(ctx context.Context) ([]byte, error)
 }
 
 // SSHSignRequest is the request body of an SSH certificate request.
@@ -70,9 +73,10 @@ func (s *SSHSignRequest) Validate() error {
 
 // SSHSignResponse is the response object that returns the SSH certificate.
 type SSHSignResponse struct {
-	Certificate         SSHCertificate  `json:"crt"`
-	AddUserCertificate  *SSHCertificate `json:"addUserCrt,omitempty"`
-	IdentityCertificate []Certificate   `json:"identityCrt,omitempty"`
+	Certificate             SSHCertificate           `json:"crt"`
+	AddUserCertificate      *SSHCertificate          `json:"addUserCrt,omitempty"`
+	IdentityCertificate     []Certificate            `json:"identityCrt,omitempty"`
+	IdentityPendingIssuance *PendingIssuanceResponse `json:"identityPendingIssuance,omitempty"`
 }
 
 // SSHRootsResponse represents the response object that returns the SSH user and
@@ -315,6 +319,7 @@ func SSHSign(w http.ResponseWriter, r *http.Request) {
 
 	// Sign identity certificate if available.
 	var identityCertificate []Certificate
+	var identityPendingIssuance *PendingIssuanceResponse
 	if cr := body.IdentityCSR.CertificateRequest; cr != nil {
 		ctx := authority.NewContextWithSkipTokenReuse(r.Context())
 		ctx = provisioner.NewContextWithMethod(ctx, provisioner.SignIdentityMethod)
@@ -331,21 +336,52 @@ func SSHSign(w http.ResponseWriter, r *http.Request) {
 		})
 
 		certChain, err := a.SignWithContext(ctx, cr, provisioner.SignOptions{}, signOpts...)
-		if err != nil {
+		var pe *authority.PendingIssuanceError
+		switch {
+		case errors.As(err, &pe):
+			// The identity certificate can be retrieved once the request is
+			// approved.
+			identityPendingIssuance = &PendingIssuanceResponse{
+				ID:        pe.ID,
+				Status:    string(db.PendingIssuanceStatusPending),
+				ExpiresAt: pe.ExpiresAt,
+			}
+		case err != nil:
 			render.Error(w, errs.ForbiddenErr(err, "error signing identity certificate"))
 			return
+		default:
+			identityCertificate = certChainToPEM(certChain)
 		}
-		identityCertificate = certChainToPEM(certChain)
 	}
 
 	LogSSHCertificate(w, cert)
+	logSSHAuditMetadata(w, signOpts)
 	render.JSONStatus(w, &SSHSignResponse{
-		Certificate:         SSHCertificate{cert},
-		AddUserCertificate:  addUserCertificate,
-		IdentityCertificate: identityCertificate,
+		Certificate:             SSHCertificate{cert},
+		AddUserCertificate:      addUserCertificate,
+		IdentityCertificate:     identityCertificate,
+		IdentityPendingIssuance: identityPendingIssuance,
 	}, http.StatusCreated)
 }
 
+// logSSHAuditMetadata adds the audit metadata of the request, also available
+// in the SSH certificate templates, to the log message.
+func logSSHAuditMetadata(w http.ResponseWriter, signOpts []provisioner.SignOption) {
+	rl, ok := w.(logging.ResponseLogger)
+	if !ok {
+		return
+	}
+	for _, op := range signOpts {
+		if m, ok := op.(*provisioner.SSHAuditMetadata); ok {
+			rl.WithFields(map[string]interface{}{
+				"provisioner": m.Provisioner,
+				"identity":    m.Identity,
+			})
+			return
+		}
+	}
+}
+
 // SSHRoots is an HTTP handler that returns the SSH public keys for user and host
 // certificates.
 func SSHRoots(w http.ResponseWriter, r *http.Request) {
@@ -398,6 +434,22 @@ func SSHFederation(w http.ResponseWriter, r *http.Request) {
 	render.JSON(w, resp)
 }
 
+// SSHKRL is an HTTP handler that returns the OpenSSH key revocation list (KRL)
+// with the revoked SSH certificates. The KRL can be used in the RevokedKeys
+// option of sshd.
+func SSHKRL(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	krl, err := mustAuthority(ctx).GetSSHKeyRevocationList(ctx)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/octet-stream")
+	w.Header().Add("Content-Disposition", "attachment; filename=\"krl\"")
+	w.Write(krl)
+}
+
 // SSHConfig is an HTTP handler that returns rendered templates for ssh clients
 // and servers.
 func SSHConfig(w http.ResponseWriter, r *http.Request) {
@@ -23,6 +23,7 @@ import (
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/authority"
 	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/errs"
 	"github.com/smallstep/certificates/logging"
 	"github.com/smallstep/certificates/templates"
 )
@@ -304,6 +305,8 @@ func Test_SSHSign(t *testing.T) {
 		{"ok-host", hostReq, nil, host, nil, nil, nil, nil, nil, []byte(fmt.Sprintf(`{"crt":%q}`, hostB64)), http.StatusCreated},
 		{"ok-user-add", userAddReq, nil, user, nil, user, nil, nil, nil, []byte(fmt.Sprintf(`{"crt":%q,"addUserCrt":%q}`, userB64, userB64)), http.StatusCreated},
 		{"ok-user-identity", userIdentityReq, nil, user, nil, user, nil, identityCerts, nil, []byte(fmt.Sprintf(`{"crt":%q,"identityCrt":[%s]}`, userB64, identityCertsPEM)), http.StatusCreated},
+		{"ok-user-identity-pending", userIdentityReq, nil, user, nil, user, nil, nil, &authority.PendingIssuanceError{ID: "the-id", ExpiresAt: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)},
+			[]byte(fmt.Sprintf(`{"crt":%q,"identityPendingIssuance":{"id":"the-id","status":"pending","expiresAt":"2030-01-01T00:00:00Z"}}`, userB64)), http.StatusCreated},
 		{"fail-body", []byte("bad-json"), nil, nil, nil, nil, nil, nil, nil, nil, http.StatusBadRequest},
 		{"fail-validate", []byte("{}"), nil, nil, nil, nil, nil, nil, nil, nil, http.StatusBadRequest},
 		{"fail-publicKey", []byte(`{"publicKey":"Zm9v","ott":"ott"}`), nil, nil, nil, nil, nil, nil, nil, nil, http.StatusBadRequest},
@@ -461,6 +464,51 @@ func Test_SSHFederation(t *testing.T) {
 	}
 }
 
+func Test_SSHKRL(t *testing.T) {
+	tests := []struct {
+		name       string
+		krl        []byte
+		krlErr     error
+		statusCode int
+	}{
+		{"ok", []byte("SSHKRL\n\x00"), nil, http.StatusOK},
+		{"not found", nil, errs.NotFound("ssh key revocation lists are not enabled"), http.StatusNotFound},
+		{"error", nil, errs.InternalServer("an error"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAuthority{
+				getSSHKRL: func(ctx context.Context) ([]byte, error) {
+					return tt.krl, tt.krlErr
+				},
+			})
+
+			req := httptest.NewRequest("GET", "http://example.com/ssh/krl", http.NoBody)
+			w := httptest.NewRecorder()
+			SSHKRL(logging.NewResponseLogger(w), req)
+			res := w.Result()
+
+			if res.StatusCode != tt.statusCode {
+				t.Errorf("caHandler.SSHKRL StatusCode = %d, wants %d", res.StatusCode, tt.statusCode)
+			}
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			if err != nil {
+				t.Errorf("caHandler.SSHKRL unexpected error = %v", err)
+			}
+			if tt.statusCode < http.StatusBadRequest {
+				if ct := res.Header.Get("Content-Type"); ct != "application/octet-stream" {
+					t.Errorf("caHandler.SSHKRL Content-Type = %s, wants application/octet-stream", ct)
+				}
+				if !bytes.Equal(body, tt.krl) {
+					t.Errorf("caHandler.SSHKRL Body = %x, wants %x", body, tt.krl)
+				}
+			}
+		})
+	}
+}
+
 func Test_SSHConfig(t *testing.T) {
 	userOutput := []templates.Output{
 		{Name: "config.tpl", Type: templates.File, Comment: "#", Path: "ssh/config", Content: []byte("UserKnownHostsFile /home/user/.step/ssh/known_hosts")},
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/smallstep/certificates/api/read"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/policy"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/errs"
+)
+
+// ValidateTokenRequest is the request body of a token validation request.
+type ValidateTokenRequest struct {
+	OTT string `json:"ott"`
+}
+
+// Validate validates the ValidateTokenRequest.
+func (s *ValidateTokenRequest) Validate() error {
+	if s.OTT == "" {
+		return errs.BadRequest("missing or empty ott")
+	}
+	return nil
+}
+
+// ValidateTokenProvisioner is the provisioner that authorizes a token.
+type ValidateTokenProvisioner struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// ValidateTokenDurations are the certificate durations allowed by a token.
+type ValidateTokenDurations struct {
+	Min     *provisioner.Duration `json:"min,omitempty"`
+	Max     *provisioner.Duration `json:"max,omitempty"`
+	Default *provisioner.Duration `json:"default,omitempty"`
+}
+
+// ValidateTokenPolicy are the X.509 policies applied to a token.
+type ValidateTokenPolicy struct {
+	Provisioner *policy.X509PolicyOptions `json:"provisioner,omitempty"`
+	Authority   *policy.X509PolicyOptions `json:"authority,omitempty"`
+}
+
+// ValidateTokenResponse is the response object of a token validation request.
+type ValidateTokenResponse struct {
+	Provisioner   ValidateTokenProvisioner `json:"provisioner"`
+	Subject       string                   `json:"subject"`
+	SANs          []string                 `json:"sans"`
+	Durations     ValidateTokenDurations   `json:"durations"`
+	NotBefore     *time.Time               `json:"notBefore,omitempty"`
+	NotAfter      *time.Time               `json:"notAfter,omitempty"`
+	Policy        ValidateTokenPolicy      `json:"policy"`
+	TokenConsumed bool                     `json:"tokenConsumed"`
+}
+
+// ValidateToken is an HTTP handler that reads a one-time-token (ott) from the
+// body and returns the information that the token authorizes, without signing
+// any certificate. The token is not consumed, and it can be used later to sign
+// a certificate. If the token has already been used, the response will have
+// tokenConsumed set to true.
+func ValidateToken(w http.ResponseWriter, r *http.Request) {
+	var body ValidateTokenRequest
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, errs.BadRequestErr(err, "error reading request body"))
+		return
+	}
+
+	logOtt(w, body.OTT)
+	if err := body.Validate(); err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	ctx := r.Context()
+	a := mustAuthority(ctx)
+
+	tv, err := a.ValidateToken(ctx, body.OTT)
+	if err != nil {
+		render.Error(w, errs.UnauthorizedErr(err))
+		return
+	}
+
+	resp := &ValidateTokenResponse{
+		SANs: []string{},
+		Policy: ValidateTokenPolicy{
+			Provisioner: tv.ProvisionerPolicy,
+			Authority:   tv.AuthorityPolicy,
+		},
+		TokenConsumed: tv.TokenConsumed,
+	}
+	if p := tv.Provisioner; p != nil {
+		resp.Provisioner = ValidateTokenProvisioner{
+			ID:   p.GetID(),
+			Name: p.GetName(),
+			Type: p.GetType().String(),
+		}
+	}
+	if s := tv.Summary; s != nil {
+		resp.Subject = s.Subject
+		if len(s.SANs) > 0 {
+			resp.SANs = s.SANs
+		}
+		resp.Durations = ValidateTokenDurations{
+			Min:     newDuration(s.MinDuration),
+			Max:     newDuration(s.MaxDuration),
+			Default: newDuration(s.DefaultDuration),
+		}
+		if !s.NotBefore.IsZero() {
+			resp.NotBefore = &s.NotBefore
+		}
+		if !s.NotAfter.IsZero() {
+			resp.NotAfter = &s.NotAfter
+		}
+	}
+
+	render.JSON(w, resp)
+}
+
+func newDuration(d time.Duration) *provisioner.Duration {
+	if d == 0 {
+		return nil
+	}
+	return &provisioner.Duration{Duration: d}
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/authority/policy"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/logging"
+)
+
+func Test_ValidateToken(t *testing.T) {
+	valid, err := json.Marshal(ValidateTokenRequest{OTT: "foobarzar"})
+	require.NoError(t, err)
+	invalid, err := json.Marshal(ValidateTokenRequest{OTT: ""})
+	require.NoError(t, err)
+
+	tv := &authority.TokenValidation{
+		Provisioner: &mockProvisioner{
+			getID:   func() string { return "prov-id" },
+			getName: func() string { return "prov-name" },
+			getType: func() provisioner.Type { return provisioner.TypeJWK },
+		},
+		Summary: &provisioner.SignOptionsSummary{
+			Subject:         "test.smallstep.com",
+			SANs:            []string{"test.smallstep.com", "127.0.0.1"},
+			MinDuration:     5 * time.Minute,
+			MaxDuration:     24 * time.Hour,
+			DefaultDuration: 24 * time.Hour,
+		},
+		AuthorityPolicy: &policy.X509PolicyOptions{
+			AllowedNames: &policy.X509NameOptions{DNSDomains: []string{"*.smallstep.com"}},
+		},
+	}
+	expected := []byte(`{"provisioner":{"id":"prov-id","name":"prov-name","type":"JWK"},"subject":"test.smallstep.com","sans":["test.smallstep.com","127.0.0.1"],"durations":{"min":"5m0s","max":"24h0m0s","default":"24h0m0s"},"policy":{"authority":{"allow":{"dns":["*.smallstep.com"]}}},"tokenConsumed":false}`)
+
+	consumedTV := *tv
+	consumedTV.TokenConsumed = true
+	consumed := bytes.Replace(expected, []byte(`"tokenConsumed":false`), []byte(`"tokenConsumed":true`), 1)
+
+	tests := []struct {
+		name       string
+		input      string
+		tv         *authority.TokenValidation
+		err        error
+		statusCode int
+		expected   []byte
+	}{
+		{"ok", string(valid), tv, nil, http.StatusOK, expected},
+		{"ok consumed", string(valid), &consumedTV, nil, http.StatusOK, consumed},
+		{"json read error", "{", nil, nil, http.StatusBadRequest, nil},
+		{"validate error", string(invalid), nil, nil, http.StatusBadRequest, nil},
+		{"expired token", string(valid), nil, errors.New("jwk.authorizeToken; invalid jwk claims: token is expired (exp)"), http.StatusUnauthorized, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAuthority{
+				validateToken: func(ctx context.Context, ott string) (*authority.TokenValidation, error) {
+					assert.Equal(t, "foobarzar", ott)
+					return tt.tv, tt.err
+				},
+			})
+			req := httptest.NewRequest("POST", "http://example.com/validate-token", strings.NewReader(tt.input))
+			w := httptest.NewRecorder()
+			ValidateToken(logging.NewResponseLogger(w), req)
+			res := w.Result()
+
+			assert.Equal(t, tt.statusCode, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			require.NoError(t, err)
+			if tt.statusCode < http.StatusBadRequest {
+				assert.Equal(t, tt.expected, bytes.TrimSpace(body))
+			}
+		})
+	}
+}
@@ -3,18 +3,29 @@ package api
 import (
 	"fmt"
 	"net/http"
+	"time"
 
+	"github.com/go-chi/chi/v5"
 	"go.step.sm/linkedca"
 	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/api/read"
 	"github.com/smallstep/certificates/api/render"
 	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/policy"
 )
 
 // CreateExternalAccountKeyRequest is the type for POST /admin/acme/eab requests
 type CreateExternalAccountKeyRequest struct {
 	Reference string `json:"reference"`
+	// ExpiresAt is the time after which the key cannot be bound to new
+	// accounts, and the account bound to it cannot get new certificates.
+	ExpiresAt time.Time `json:"expiresAt,omitempty"`
+	// Policy contains the names the account bound to the key can get
+	// certificates for.
+	Policy *acme.Policy `json:"policy,omitempty"`
 }
 
 // Validate validates a new ACME EAB Key request body.
@@ -22,6 +33,34 @@ func (r *CreateExternalAccountKeyRequest) Validate() error {
 	if len(r.Reference) > 256 { // an arbitrary, but sensible (IMO), limit
 		return fmt.Errorf("reference length %d exceeds the maximum (256)", len(r.Reference))
 	}
+	return validateExternalAccountKeyOptions(r.ExpiresAt, r.Policy)
+}
+
+// UpdateExternalAccountKeyRequest is the type for PUT
+// /admin/acme/eab/{provisionerName}/{id} requests. The policy replaces the
+// policy of the key, an empty policy removes it. The expiration is only
+// changed if it is set.
+type UpdateExternalAccountKeyRequest struct {
+	ExpiresAt time.Time    `json:"expiresAt,omitempty"`
+	Policy    *acme.Policy `json:"policy,omitempty"`
+}
+
+// Validate validates an update ACME EAB Key request body.
+func (r *UpdateExternalAccountKeyRequest) Validate() error {
+	return validateExternalAccountKeyOptions(r.ExpiresAt, r.Policy)
+}
+
+// validateExternalAccountKeyOptions checks that the expiration is in the
+// future and that the names in the policy are valid.
+func validateExternalAccountKeyOptions(expiresAt time.Time, p *acme.Policy) error {
+	if !expiresAt.IsZero() && !expiresAt.After(time.Now()) {
+		return fmt.Errorf("expiresAt %s is not in the future", expiresAt.Format(time.RFC3339))
+	}
+	if p != nil {
+		if _, err := policy.NewX509PolicyEngine(p); err != nil {
+			return fmt.Errorf("policy is not valid: %w", err)
+		}
+	}
 	return nil
 }
 
@@ -31,6 +70,34 @@ type GetExternalAccountKeysResponse struct {
 	NextCursor string             `json:"nextCursor"`
 }
 
+// ExternalAccountKeyStatsResponse is the type for GET
+// /admin/acme/eab/{provisionerName}/{id}/stats and POST
+// /admin/acme/eab/{provisionerName}/{id}/revoke responses. It contains the
+// state of the key and the issuance statistics of the account bound to it.
+type ExternalAccountKeyStatsResponse struct {
+	ID        string                       `json:"id"`
+	Reference string                       `json:"reference,omitempty"`
+	Account   string                       `json:"account,omitempty"`
+	CreatedAt time.Time                    `json:"createdAt"`
+	BoundAt   time.Time                    `json:"boundAt,omitempty"`
+	ExpiresAt time.Time                    `json:"expiresAt,omitempty"`
+	RevokedAt time.Time                    `json:"revokedAt,omitempty"`
+	Stats     acme.ExternalAccountKeyStats `json:"stats"`
+}
+
+func newExternalAccountKeyStatsResponse(k *acme.ExternalAccountKey) *ExternalAccountKeyStatsResponse {
+	return &ExternalAccountKeyStatsResponse{
+		ID:        k.ID,
+		Reference: k.Reference,
+		Account:   k.AccountID,
+		CreatedAt: k.CreatedAt,
+		BoundAt:   k.BoundAt,
+		ExpiresAt: k.ExpiresAt,
+		RevokedAt: k.RevokedAt,
+		Stats:     k.Stats,
+	}
+}
+
 // requireEABEnabled is a middleware that ensures ACME EAB is enabled
 // before serving requests that act on ACME EAB credentials.
 func requireEABEnabled(next http.HandlerFunc) http.HandlerFunc {
@@ -58,6 +125,12 @@ type ACMEAdminResponder interface {
 	GetExternalAccountKeys(w http.ResponseWriter, r *http.Request)
 	CreateExternalAccountKey(w http.ResponseWriter, r *http.Request)
 	DeleteExternalAccountKey(w http.ResponseWriter, r *http.Request)
+	UpdateExternalAccountKey(w http.ResponseWriter, r *http.Request)
+	RevokeExternalAccountKey(w http.ResponseWriter, r *http.Request)
+	GetExternalAccountKeyStats(w http.ResponseWriter, r *http.Request)
+	GetEnrolledDevices(w http.ResponseWriter, r *http.Request)
+	CreateEnrolledDevice(w http.ResponseWriter, r *http.Request)
+	DeleteEnrolledDevice(w http.ResponseWriter, r *http.Request)
 }
 
 // acmeAdminResponder implements ACMEAdminResponder.
@@ -69,18 +142,221 @@ func NewACMEAdminResponder() ACMEAdminResponder {
 }
 
 // GetExternalAccountKeys writes the response for the EAB keys GET endpoint
-func (h *acmeAdminResponder) GetExternalAccountKeys(w http.ResponseWriter, _ *http.Request) {
-	render.Error(w, admin.NewError(admin.ErrorNotImplementedType, "this functionality is currently only available in Certificate Manager: https://u.step.sm/cm"))
+func (h *acmeAdminResponder) GetExternalAccountKeys(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	prov := linkedca.MustProvisionerFromContext(ctx)
+	acmeDB := acme.MustDatabaseFromContext(ctx)
+
+	var (
+		keys       []*acme.ExternalAccountKey
+		nextCursor string
+	)
+	if reference := chi.URLParam(r, "reference"); reference != "" {
+		key, err := acmeDB.GetExternalAccountKeyByReference(ctx, prov.GetId(), reference)
+		if err != nil {
+			if acme.IsErrNotFound(err) {
+				render.Error(w, admin.NewError(admin.ErrorNotFoundType, "ACME EAB key for reference %s not found", reference))
+				return
+			}
+			render.Error(w, admin.WrapErrorISE(err, "error retrieving ACME EAB key for reference %s", reference))
+			return
+		}
+		if key != nil {
+			keys = []*acme.ExternalAccountKey{key}
+		}
+	} else {
+		cursor, limit, err := api.ParseCursor(r)
+		if err != nil {
+			render.Error(w, admin.WrapError(admin.ErrorBadRequestType, err,
+				"error parsing cursor and limit from query params"))
+			return
+		}
+		if keys, nextCursor, err = acmeDB.GetExternalAccountKeys(ctx, prov.GetId(), cursor, limit); err != nil {
+			render.Error(w, admin.WrapErrorISE(err, "error retrieving ACME EAB keys"))
+			return
+		}
+	}
+
+	eaks := make([]*linkedca.EABKey, len(keys))
+	for i, k := range keys {
+		eaks[i] = eakToLinked(k)
+	}
+
+	render.JSON(w, &GetExternalAccountKeysResponse{
+		EAKs:       eaks,
+		NextCursor: nextCursor,
+	})
 }
 
 // CreateExternalAccountKey writes the response for the EAB key POST endpoint
-func (h *acmeAdminResponder) CreateExternalAccountKey(w http.ResponseWriter, _ *http.Request) {
-	render.Error(w, admin.NewError(admin.ErrorNotImplementedType, "this functionality is currently only available in Certificate Manager: https://u.step.sm/cm"))
+func (h *acmeAdminResponder) CreateExternalAccountKey(w http.ResponseWriter, r *http.Request) {
+	var body CreateExternalAccountKeyRequest
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		render.Error(w, admin.WrapError(admin.ErrorBadRequestType, err, "error validating request body"))
+		return
+	}
+
+	ctx := r.Context()
+	prov := linkedca.MustProvisionerFromContext(ctx)
+	acmeDB := acme.MustDatabaseFromContext(ctx)
+
+	// References must be unique in a provisioner.
+	if body.Reference != "" {
+		k, err := acmeDB.GetExternalAccountKeyByReference(ctx, prov.GetId(), body.Reference)
+		switch {
+		case err != nil && !acme.IsErrNotFound(err):
+			render.Error(w, admin.WrapErrorISE(err, "error retrieving ACME EAB key for reference %s", body.Reference))
+			return
+		case err == nil && k != nil:
+			render.Error(w, admin.NewError(admin.ErrorConflictType, "an ACME EAB key for provisioner '%s' with reference '%s' already exists", prov.GetName(), body.Reference))
+			return
+		}
+	}
+
+	eak, err := acmeDB.CreateExternalAccountKey(ctx, prov.GetId(), body.Reference)
+	if err != nil {
+		render.Error(w, admin.WrapErrorISE(err, "error creating ACME EAB key for provisioner '%s' and reference '%s'", prov.GetName(), body.Reference))
+		return
+	}
+
+	if !body.ExpiresAt.IsZero() || body.Policy != nil {
+		eak.ExpiresAt = body.ExpiresAt
+		eak.Policy = body.Policy
+		if err := acmeDB.UpdateExternalAccountKey(ctx, prov.GetId(), eak); err != nil {
+			render.Error(w, admin.WrapErrorISE(err, "error setting the expiration and policy of ACME EAB key %s", eak.ID))
+			return
+		}
+	}
+
+	render.ProtoJSONStatus(w, eakToLinked(eak), http.StatusCreated)
 }
 
 // DeleteExternalAccountKey writes the response for the EAB key DELETE endpoint
-func (h *acmeAdminResponder) DeleteExternalAccountKey(w http.ResponseWriter, _ *http.Request) {
-	render.Error(w, admin.NewError(admin.ErrorNotImplementedType, "this functionality is currently only available in Certificate Manager: https://u.step.sm/cm"))
+func (h *acmeAdminResponder) DeleteExternalAccountKey(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	prov := linkedca.MustProvisionerFromContext(ctx)
+	acmeDB := acme.MustDatabaseFromContext(ctx)
+
+	keyID := chi.URLParam(r, "id")
+	if err := acmeDB.DeleteExternalAccountKey(ctx, prov.GetId(), keyID); err != nil {
+		if acme.IsErrNotFound(err) {
+			render.Error(w, admin.NewError(admin.ErrorNotFoundType, "ACME EAB key %s not found", keyID))
+			return
+		}
+		render.Error(w, admin.WrapErrorISE(err, "error deleting ACME EAB key %s", keyID))
+		return
+	}
+
+	render.JSON(w, &DeleteResponse{Status: "ok"})
+}
+
+// UpdateExternalAccountKey writes the response for the EAB key PUT endpoint.
+// It updates the expiration and policy of the key, revoked keys cannot be
+// updated.
+func (h *acmeAdminResponder) UpdateExternalAccountKey(w http.ResponseWriter, r *http.Request) {
+	var body UpdateExternalAccountKeyRequest
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		render.Error(w, admin.WrapError(admin.ErrorBadRequestType, err, "error validating request body"))
+		return
+	}
+
+	ctx := r.Context()
+	prov := linkedca.MustProvisionerFromContext(ctx)
+	acmeDB := acme.MustDatabaseFromContext(ctx)
+
+	eak, ok := getExternalAccountKey(w, r)
+	if !ok {
+		return
+	}
+
+	if eak.IsRevoked() {
+		render.Error(w, admin.NewError(admin.ErrorBadRequestType, "ACME EAB key %s is revoked", eak.ID))
+		return
+	}
+
+	if !body.ExpiresAt.IsZero() {
+		eak.ExpiresAt = body.ExpiresAt
+	}
+	eak.Policy = body.Policy
+	if err := acmeDB.UpdateExternalAccountKey(ctx, prov.GetId(), eak); err != nil {
+		render.Error(w, admin.WrapErrorISE(err, "error updating ACME EAB key %s", eak.ID))
+		return
+	}
+
+	render.ProtoJSON(w, eakToLinked(eak))
+}
+
+// RevokeExternalAccountKey writes the response for the EAB key revoke
+// endpoint. A revoked key cannot be bound to new accounts, and the account
+// bound to it cannot get new certificates.
+func (h *acmeAdminResponder) RevokeExternalAccountKey(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	prov := linkedca.MustProvisionerFromContext(ctx)
+	acmeDB := acme.MustDatabaseFromContext(ctx)
+
+	eak, ok := getExternalAccountKey(w, r)
+	if !ok {
+		return
+	}
+
+	if eak.IsRevoked() {
+		render.Error(w, admin.NewError(admin.ErrorBadRequestType, "ACME EAB key %s is already revoked", eak.ID))
+		return
+	}
+
+	eak.RevokedAt = time.Now()
+	if err := acmeDB.UpdateExternalAccountKey(ctx, prov.GetId(), eak); err != nil {
+		render.Error(w, admin.WrapErrorISE(err, "error revoking ACME EAB key %s", eak.ID))
+		return
+	}
+
+	render.JSON(w, newExternalAccountKeyStatsResponse(eak))
+}
+
+// GetExternalAccountKeyStats writes the response for the EAB key stats GET
+// endpoint.
+func (h *acmeAdminResponder) GetExternalAccountKeyStats(w http.ResponseWriter, r *http.Request) {
+	eak, ok := getExternalAccountKey(w, r)
+	if !ok {
+		return
+	}
+
+	render.JSON(w, newExternalAccountKeyStatsResponse(eak))
+}
+
+// getExternalAccountKey returns the EAB key with the id in the URL, or writes
+// an error response and returns false if it cannot be retrieved.
+func getExternalAccountKey(w http.ResponseWriter, r *http.Request) (*acme.ExternalAccountKey, bool) {
+	ctx := r.Context()
+	prov := linkedca.MustProvisionerFromContext(ctx)
+	acmeDB := acme.MustDatabaseFromContext(ctx)
+
+	keyID := chi.URLParam(r, "id")
+	eak, err := acmeDB.GetExternalAccountKey(ctx, prov.GetId(), keyID)
+	if err != nil {
+		if acme.IsErrNotFound(err) {
+			render.Error(w, admin.NewError(admin.ErrorNotFoundType, "ACME EAB key %s not found", keyID))
+			return nil, false
+		}
+		render.Error(w, admin.WrapErrorISE(err, "error retrieving ACME EAB key %s", keyID))
+		return nil, false
+	}
+	if eak == nil {
+		render.Error(w, admin.NewError(admin.ErrorNotFoundType, "ACME EAB key %s not found", keyID))
+		return nil, false
+	}
+
+	return eak, true
 }
 
 func eakToLinked(k *acme.ExternalAccountKey) *linkedca.EABKey {
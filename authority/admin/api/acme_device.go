@@ -0,0 +1,195 @@
+package api
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"go.step.sm/crypto/pemutil"
+	"go.step.sm/linkedca"
+
+	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/api/read"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/admin"
+)
+
+// CreateEnrolledDeviceRequest is the type for POST /admin/acme/devices
+// requests. Devices are enrolled using the EK public key, or the EK
+// certificate, in PEM format or using their serial number.
+type CreateEnrolledDeviceRequest struct {
+	EKPublicKey  string `json:"ekPublicKey,omitempty"`
+	SerialNumber string `json:"serialNumber,omitempty"`
+}
+
+// Validate validates a new enrolled device request body.
+func (r *CreateEnrolledDeviceRequest) Validate() error {
+	switch {
+	case r.EKPublicKey == "" && r.SerialNumber == "":
+		return errors.New("ekPublicKey or serialNumber is required")
+	case r.EKPublicKey != "" && r.SerialNumber != "":
+		return errors.New("ekPublicKey and serialNumber cannot be used together")
+	case len(r.SerialNumber) > 256: // same limit as the EAB references
+		return fmt.Errorf("serialNumber length %d exceeds the maximum (256)", len(r.SerialNumber))
+	case strings.HasPrefix(r.SerialNumber, "urn:ek:"):
+		return errors.New("serialNumber cannot be an EK URN, use ekPublicKey instead")
+	}
+	return nil
+}
+
+// device returns the enrolled device for the request body.
+func (r *CreateEnrolledDeviceRequest) device(provisionerID string) (*acme.EnrolledDevice, error) {
+	if r.SerialNumber != "" {
+		return &acme.EnrolledDevice{
+			ProvisionerID: provisionerID,
+			Type:          acme.EnrolledDeviceSerialNumber,
+			Value:         r.SerialNumber,
+		}, nil
+	}
+
+	v, err := pemutil.Parse([]byte(r.EKPublicKey))
+	if err != nil {
+		return nil, err
+	}
+	var pub crypto.PublicKey
+	switch k := v.(type) {
+	case *x509.Certificate:
+		pub = k.PublicKey
+	case crypto.Signer:
+		return nil, errors.New("ekPublicKey cannot be a private key")
+	default:
+		pub = k
+	}
+	fp, err := acme.EKFingerprint(pub)
+	if err != nil {
+		return nil, err
+	}
+	return &acme.EnrolledDevice{
+		ProvisionerID: provisionerID,
+		Type:          acme.EnrolledDeviceEK,
+		Value:         fp,
+	}, nil
+}
+
+// GetEnrolledDevicesResponse is the type for GET /admin/acme/devices responses.
+type GetEnrolledDevicesResponse struct {
+	Devices []*acme.EnrolledDevice `json:"devices"`
+}
+
+// requireACMEProvisioner is a middleware that ensures the provisioner in the
+// context is an ACME provisioner.
+func requireACMEProvisioner(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		prov := linkedca.MustProvisionerFromContext(r.Context())
+		if prov.GetDetails().GetACME() == nil {
+			render.Error(w, admin.NewError(admin.ErrorBadRequestType, "provisioner '%s' is not an ACME provisioner", prov.GetName()))
+			return
+		}
+		next(w, r)
+	}
+}
+
+// enrolledDeviceDB returns the ACME database in the context if it supports
+// enrolled devices, or writes an error response and returns false.
+func enrolledDeviceDB(ctx context.Context, w http.ResponseWriter) (acme.EnrolledDeviceDB, bool) {
+	db, ok := acme.MustDatabaseFromContext(ctx).(acme.EnrolledDeviceDB)
+	if !ok {
+		render.Error(w, admin.NewError(admin.ErrorNotImplementedType, "enrolled devices are not supported by the ACME database"))
+		return nil, false
+	}
+	return db, true
+}
+
+// GetEnrolledDevices writes the response for the enrolled devices GET endpoint.
+func (h *acmeAdminResponder) GetEnrolledDevices(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	prov := linkedca.MustProvisionerFromContext(ctx)
+	db, ok := enrolledDeviceDB(ctx, w)
+	if !ok {
+		return
+	}
+
+	devices, err := db.GetEnrolledDevices(ctx, prov.GetId())
+	if err != nil {
+		render.Error(w, admin.WrapErrorISE(err, "error retrieving enrolled devices"))
+		return
+	}
+
+	render.JSON(w, &GetEnrolledDevicesResponse{
+		Devices: devices,
+	})
+}
+
+// CreateEnrolledDevice writes the response for the enrolled device POST
+// endpoint.
+func (h *acmeAdminResponder) CreateEnrolledDevice(w http.ResponseWriter, r *http.Request) {
+	var body CreateEnrolledDeviceRequest
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		render.Error(w, admin.WrapError(admin.ErrorBadRequestType, err, "error validating request body"))
+		return
+	}
+
+	ctx := r.Context()
+	prov := linkedca.MustProvisionerFromContext(ctx)
+	db, ok := enrolledDeviceDB(ctx, w)
+	if !ok {
+		return
+	}
+
+	dev, err := body.device(prov.GetId())
+	if err != nil {
+		render.Error(w, admin.WrapError(admin.ErrorBadRequestType, err, "error parsing ekPublicKey"))
+		return
+	}
+
+	// Devices can be enrolled only once in a provisioner.
+	id := acme.EnrolledDeviceID(dev.Type, dev.Value)
+	switch _, err := db.GetEnrolledDevice(ctx, prov.GetId(), id); {
+	case err == nil:
+		render.Error(w, admin.NewError(admin.ErrorConflictType, "device %s is already enrolled in provisioner '%s'", id, prov.GetName()))
+		return
+	case !acme.IsErrNotFound(err):
+		render.Error(w, admin.WrapErrorISE(err, "error retrieving enrolled device %s", id))
+		return
+	}
+
+	if err := db.CreateEnrolledDevice(ctx, dev); err != nil {
+		render.Error(w, admin.WrapErrorISE(err, "error enrolling device in provisioner '%s'", prov.GetName()))
+		return
+	}
+
+	render.JSONStatus(w, dev, http.StatusCreated)
+}
+
+// DeleteEnrolledDevice writes the response for the enrolled device DELETE
+// endpoint.
+func (h *acmeAdminResponder) DeleteEnrolledDevice(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	prov := linkedca.MustProvisionerFromContext(ctx)
+	db, ok := enrolledDeviceDB(ctx, w)
+	if !ok {
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	if err := db.DeleteEnrolledDevice(ctx, prov.GetId(), id); err != nil {
+		if acme.IsErrNotFound(err) {
+			render.Error(w, admin.NewError(admin.ErrorNotFoundType, "enrolled device %s not found", id))
+			return
+		}
+		render.Error(w, admin.WrapErrorISE(err, "error deleting enrolled device %s", id))
+		return
+	}
+
+	render.JSON(w, &DeleteResponse{Status: "ok"})
+}
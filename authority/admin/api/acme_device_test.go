@@ -0,0 +1,378 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"go.step.sm/crypto/pemutil"
+	"go.step.sm/linkedca"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/authority/admin"
+)
+
+func mustEKPublicKey(t *testing.T) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	block, err := pemutil.Serialize(key.Public())
+	assert.FatalError(t, err)
+	fp, err := acme.EKFingerprint(key.Public())
+	assert.FatalError(t, err)
+	return string(pem.EncodeToMemory(block)), fp
+}
+
+func TestCreateEnrolledDeviceRequest_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     *CreateEnrolledDeviceRequest
+		wantErr bool
+	}{
+		{"ok/ek", &CreateEnrolledDeviceRequest{EKPublicKey: "-----BEGIN PUBLIC KEY-----"}, false},
+		{"ok/serial", &CreateEnrolledDeviceRequest{SerialNumber: "1234"}, false},
+		{"fail/empty", &CreateEnrolledDeviceRequest{}, true},
+		{"fail/both", &CreateEnrolledDeviceRequest{EKPublicKey: "-----BEGIN PUBLIC KEY-----", SerialNumber: "1234"}, true},
+		{"fail/serial-length", &CreateEnrolledDeviceRequest{SerialNumber: strings.Repeat("A", 257)}, true},
+		{"fail/serial-urn", &CreateEnrolledDeviceRequest{SerialNumber: "urn:ek:sha256:AAAA"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.req.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestHandler_requireACMEProvisioner(t *testing.T) {
+	acmeProv := &linkedca.Provisioner{
+		Name: "acme",
+		Details: &linkedca.ProvisionerDetails{
+			Data: &linkedca.ProvisionerDetails_ACME{ACME: &linkedca.ACMEProvisioner{}},
+		},
+	}
+	jwkProv := &linkedca.Provisioner{
+		Name: "jwk",
+		Details: &linkedca.ProvisionerDetails{
+			Data: &linkedca.ProvisionerDetails_JWK{JWK: &linkedca.JWKProvisioner{}},
+		},
+	}
+	next := func(w http.ResponseWriter, r *http.Request) {
+		w.Write(nil) // mock response with status 200
+	}
+
+	for name, tc := range map[string]struct {
+		prov       *linkedca.Provisioner
+		statusCode int
+	}{
+		"ok":       {acmeProv, 200},
+		"fail/jwk": {jwkProv, 400},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := linkedca.NewContextWithProvisioner(context.Background(), tc.prov)
+			req := httptest.NewRequest("GET", "/foo", http.NoBody).WithContext(ctx)
+			w := httptest.NewRecorder()
+			requireACMEProvisioner(next)(w, req)
+			assert.Equals(t, tc.statusCode, w.Result().StatusCode)
+		})
+	}
+}
+
+func TestHandler_CreateEnrolledDevice(t *testing.T) {
+	prov := &linkedca.Provisioner{
+		Id:   "provID",
+		Name: "provName",
+	}
+	ekPEM, ekFingerprint := mustEKPublicKey(t)
+	type test struct {
+		db         acme.DB
+		body       []byte
+		statusCode int
+		err        *admin.Error
+		want       *acme.EnrolledDevice
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/read-body": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				body:       []byte("{!?}"),
+				statusCode: 400,
+				err: &admin.Error{
+					Type:    admin.ErrorBadRequestType.String(),
+					Status:  http.StatusBadRequest,
+					Message: "error reading request body: error decoding json: invalid character '!' looking for beginning of object key string",
+					Detail:  "bad request",
+				},
+			}
+		},
+		"fail/validate": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				body:       []byte("{}"),
+				statusCode: 400,
+				err: &admin.Error{
+					Type:    admin.ErrorBadRequestType.String(),
+					Status:  http.StatusBadRequest,
+					Message: "error validating request body: ekPublicKey or serialNumber is required",
+					Detail:  "bad request",
+				},
+			}
+		},
+		"fail/bad-ek": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				body:       []byte(`{"ekPublicKey": "foo"}`),
+				statusCode: 400,
+				err: &admin.Error{
+					Type:    admin.ErrorBadRequestType.String(),
+					Status:  http.StatusBadRequest,
+					Message: "error parsing ekPublicKey: error decoding PEM: not a valid PEM encoded block",
+					Detail:  "bad request",
+				},
+			}
+		},
+		"fail/already-enrolled": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetEnrolledDevice: func(ctx context.Context, provisionerID, id string) (*acme.EnrolledDevice, error) {
+						return &acme.EnrolledDevice{ID: id}, nil
+					},
+				},
+				body:       []byte(`{"serialNumber": "1234"}`),
+				statusCode: 409,
+				err: &admin.Error{
+					Type:    admin.ErrorConflictType.String(),
+					Status:  http.StatusConflict,
+					Message: "device " + acme.EnrolledDeviceID(acme.EnrolledDeviceSerialNumber, "1234") + " is already enrolled in provisioner 'provName'",
+					Detail:  "conflict",
+				},
+			}
+		},
+		"fail/db.CreateEnrolledDevice": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetEnrolledDevice: func(ctx context.Context, provisionerID, id string) (*acme.EnrolledDevice, error) {
+						return nil, acme.ErrNotFound
+					},
+					MockCreateEnrolledDevice: func(ctx context.Context, dev *acme.EnrolledDevice) error {
+						return errors.New("force")
+					},
+				},
+				body:       []byte(`{"serialNumber": "1234"}`),
+				statusCode: 500,
+				err: &admin.Error{
+					Type:    admin.ErrorServerInternalType.String(),
+					Status:  http.StatusInternalServerError,
+					Message: "error enrolling device in provisioner 'provName': force",
+					Detail:  "the server experienced an internal error",
+				},
+			}
+		},
+		"ok/serial": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetEnrolledDevice: func(ctx context.Context, provisionerID, id string) (*acme.EnrolledDevice, error) {
+						return nil, acme.ErrNotFound
+					},
+					MockCreateEnrolledDevice: func(ctx context.Context, dev *acme.EnrolledDevice) error {
+						dev.ID = "devID"
+						return nil
+					},
+				},
+				body:       []byte(`{"serialNumber": "1234"}`),
+				statusCode: 201,
+				want:       &acme.EnrolledDevice{ID: "devID", ProvisionerID: "provID", Type: acme.EnrolledDeviceSerialNumber, Value: "1234"},
+			}
+		},
+		"ok/ek": func(t *testing.T) test {
+			body, err := json.Marshal(&CreateEnrolledDeviceRequest{EKPublicKey: ekPEM})
+			assert.FatalError(t, err)
+			return test{
+				db: &acme.MockDB{
+					MockGetEnrolledDevice: func(ctx context.Context, provisionerID, id string) (*acme.EnrolledDevice, error) {
+						assert.Equals(t, "provID", provisionerID)
+						assert.Equals(t, acme.EnrolledDeviceID(acme.EnrolledDeviceEK, ekFingerprint), id)
+						return nil, acme.ErrNotFound
+					},
+					MockCreateEnrolledDevice: func(ctx context.Context, dev *acme.EnrolledDevice) error {
+						dev.ID = "devID"
+						return nil
+					},
+				},
+				body:       body,
+				statusCode: 201,
+				want:       &acme.EnrolledDevice{ID: "devID", ProvisionerID: "provID", Type: acme.EnrolledDeviceEK, Value: ekFingerprint},
+			}
+		},
+	}
+	for name, prep := range tests {
+		tc := prep(t)
+		t.Run(name, func(t *testing.T) {
+			ctx := linkedca.NewContextWithProvisioner(context.Background(), prov)
+			ctx = acme.NewDatabaseContext(ctx, tc.db)
+			req := httptest.NewRequest("POST", "/foo", io.NopCloser(bytes.NewBuffer(tc.body))).WithContext(ctx)
+			w := httptest.NewRecorder()
+			acmeResponder := NewACMEAdminResponder()
+			acmeResponder.CreateEnrolledDevice(w, req)
+			res := w.Result()
+			assert.Equals(t, tc.statusCode, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+
+			if res.StatusCode >= 400 {
+				adminErr := admin.Error{}
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &adminErr))
+
+				assert.Equals(t, tc.err.Type, adminErr.Type)
+				assert.Equals(t, tc.err.Message, adminErr.Message)
+				assert.Equals(t, tc.err.StatusCode(), res.StatusCode)
+				assert.Equals(t, tc.err.Detail, adminErr.Detail)
+				return
+			}
+
+			dev := &acme.EnrolledDevice{}
+			assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), dev))
+			assert.Equals(t, tc.want, dev)
+		})
+	}
+}
+
+func TestHandler_GetEnrolledDevices(t *testing.T) {
+	prov := &linkedca.Provisioner{
+		Id:   "provID",
+		Name: "provName",
+	}
+	type test struct {
+		db         acme.DB
+		statusCode int
+		want       []string
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/db.GetEnrolledDevices": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetEnrolledDevices: func(ctx context.Context, provisionerID string) ([]*acme.EnrolledDevice, error) {
+						return nil, errors.New("force")
+					},
+				},
+				statusCode: 500,
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetEnrolledDevices: func(ctx context.Context, provisionerID string) ([]*acme.EnrolledDevice, error) {
+						assert.Equals(t, "provID", provisionerID)
+						return []*acme.EnrolledDevice{{ID: "dev1"}, {ID: "dev2"}}, nil
+					},
+				},
+				statusCode: 200,
+				want:       []string{"dev1", "dev2"},
+			}
+		},
+	}
+	for name, prep := range tests {
+		tc := prep(t)
+		t.Run(name, func(t *testing.T) {
+			ctx := linkedca.NewContextWithProvisioner(context.Background(), prov)
+			ctx = acme.NewDatabaseContext(ctx, tc.db)
+			req := httptest.NewRequest("GET", "/foo", http.NoBody).WithContext(ctx)
+			w := httptest.NewRecorder()
+			acmeResponder := NewACMEAdminResponder()
+			acmeResponder.GetEnrolledDevices(w, req)
+			res := w.Result()
+			assert.Equals(t, tc.statusCode, res.StatusCode)
+			if res.StatusCode >= 400 {
+				return
+			}
+
+			var response GetEnrolledDevicesResponse
+			assert.FatalError(t, json.NewDecoder(res.Body).Decode(&response))
+			res.Body.Close()
+			ids := make([]string, len(response.Devices))
+			for i, dev := range response.Devices {
+				ids[i] = dev.ID
+			}
+			assert.Equals(t, tc.want, ids)
+		})
+	}
+}
+
+func TestHandler_DeleteEnrolledDevice(t *testing.T) {
+	prov := &linkedca.Provisioner{
+		Id:   "provID",
+		Name: "provName",
+	}
+	type test struct {
+		db         acme.DB
+		statusCode int
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/not-found": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockDeleteEnrolledDevice: func(ctx context.Context, provisionerID, id string) error {
+						return acme.ErrNotFound
+					},
+				},
+				statusCode: 404,
+			}
+		},
+		"fail/db.DeleteEnrolledDevice": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockDeleteEnrolledDevice: func(ctx context.Context, provisionerID, id string) error {
+						return errors.New("force")
+					},
+				},
+				statusCode: 500,
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockDeleteEnrolledDevice: func(ctx context.Context, provisionerID, id string) error {
+						assert.Equals(t, "provID", provisionerID)
+						assert.Equals(t, "devID", id)
+						return nil
+					},
+				},
+				statusCode: 200,
+			}
+		},
+	}
+	for name, prep := range tests {
+		tc := prep(t)
+		t.Run(name, func(t *testing.T) {
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("provisionerName", "provName")
+			chiCtx.URLParams.Add("id", "devID")
+			ctx := context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+			ctx = linkedca.NewContextWithProvisioner(ctx, prov)
+			ctx = acme.NewDatabaseContext(ctx, tc.db)
+			req := httptest.NewRequest("DELETE", "/foo", http.NoBody).WithContext(ctx)
+			w := httptest.NewRecorder()
+			acmeResponder := NewACMEAdminResponder()
+			acmeResponder.DeleteEnrolledDevice(w, req)
+			assert.Equals(t, tc.statusCode, w.Result().StatusCode)
+		})
+	}
+}
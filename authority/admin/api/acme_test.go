@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -157,6 +158,7 @@ func TestHandler_requireEABEnabled(t *testing.T) {
 func TestCreateExternalAccountKeyRequest_Validate(t *testing.T) {
 	type fields struct {
 		Reference string
+		Policy    *acme.Policy
 	}
 	tests := []struct {
 		name    string
@@ -170,6 +172,15 @@ func TestCreateExternalAccountKeyRequest_Validate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "fail/policy",
+			fields: fields{
+				Policy: &acme.Policy{X509: acme.X509Policy{
+					Denied: acme.PolicyNames{DNSNames: []string{"**.example.com"}},
+				}},
+			},
+			wantErr: true,
+		},
 		{
 			name: "ok/empty-reference",
 			fields: fields{
@@ -189,6 +200,7 @@ func TestCreateExternalAccountKeyRequest_Validate(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			r := &CreateExternalAccountKeyRequest{
 				Reference: tt.fields.Reference,
+				Policy:    tt.fields.Policy,
 			}
 			if err := r.Validate(); (err != nil) != tt.wantErr {
 				t.Errorf("CreateExternalAccountKeyRequest.Validate() error = %v, wantErr %v", err, tt.wantErr)
@@ -198,23 +210,117 @@ func TestCreateExternalAccountKeyRequest_Validate(t *testing.T) {
 }
 
 func TestHandler_CreateExternalAccountKey(t *testing.T) {
+	prov := &linkedca.Provisioner{
+		Id:   "provID",
+		Name: "provName",
+	}
 	type test struct {
-		ctx        context.Context
+		db         acme.DB
+		body       string
 		statusCode int
 		err        *admin.Error
+		eak        *linkedca.EABKey
 	}
+	createdAt := time.Now().Truncate(time.Second)
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
 	var tests = map[string]func(t *testing.T) test{
-		"ok": func(t *testing.T) test {
-			chiCtx := chi.NewRouteContext()
-			ctx := context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+		"fail/read-body": func(t *testing.T) test {
 			return test{
-				ctx:        ctx,
-				statusCode: 501,
+				db:         &acme.MockDB{},
+				body:       "{",
+				statusCode: 400,
+				err: &admin.Error{
+					Type:    admin.ErrorBadRequestType.String(),
+					Status:  http.StatusBadRequest,
+					Message: "error reading request body: error decoding json: unexpected EOF",
+					Detail:  "bad request",
+				},
+			}
+		},
+		"fail/validate": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				body:       `{"reference":"` + strings.Repeat("A", 257) + `"}`,
+				statusCode: 400,
 				err: &admin.Error{
-					Type:    admin.ErrorNotImplementedType.String(),
-					Status:  http.StatusNotImplemented,
-					Message: "this functionality is currently only available in Certificate Manager: https://u.step.sm/cm",
-					Detail:  "not implemented",
+					Type:    admin.ErrorBadRequestType.String(),
+					Status:  http.StatusBadRequest,
+					Message: "error validating request body: reference length 257 exceeds the maximum (256)",
+					Detail:  "bad request",
+				},
+			}
+		},
+		"fail/reference-conflict": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetExternalAccountKeyByReference: func(ctx context.Context, provisionerID, reference string) (*acme.ExternalAccountKey, error) {
+						assert.Equals(t, "provID", provisionerID)
+						assert.Equals(t, "my-ref", reference)
+						return &acme.ExternalAccountKey{ID: "keyID"}, nil
+					},
+				},
+				body:       `{"reference":"my-ref"}`,
+				statusCode: 409,
+				err: &admin.Error{
+					Type:    admin.ErrorConflictType.String(),
+					Status:  http.StatusConflict,
+					Message: "an ACME EAB key for provisioner 'provName' with reference 'my-ref' already exists",
+					Detail:  "conflict",
+				},
+			}
+		},
+		"fail/db.CreateExternalAccountKey": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetExternalAccountKeyByReference: func(ctx context.Context, provisionerID, reference string) (*acme.ExternalAccountKey, error) {
+						return nil, acme.ErrNotFound
+					},
+					MockCreateExternalAccountKey: func(ctx context.Context, provisionerID, reference string) (*acme.ExternalAccountKey, error) {
+						return nil, errors.New("force")
+					},
+				},
+				body:       `{"reference":"my-ref"}`,
+				statusCode: 500,
+				err: &admin.Error{
+					Type:    admin.ErrorServerInternalType.String(),
+					Status:  http.StatusInternalServerError,
+					Message: "error creating ACME EAB key for provisioner 'provName' and reference 'my-ref': force",
+					Detail:  "the server experienced an internal error",
+				},
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetExternalAccountKeyByReference: func(ctx context.Context, provisionerID, reference string) (*acme.ExternalAccountKey, error) {
+						return nil, acme.ErrNotFound
+					},
+					MockCreateExternalAccountKey: func(ctx context.Context, provisionerID, reference string) (*acme.ExternalAccountKey, error) {
+						assert.Equals(t, "provID", provisionerID)
+						assert.Equals(t, "my-ref", reference)
+						return &acme.ExternalAccountKey{
+							ID:            "keyID",
+							ProvisionerID: provisionerID,
+							Reference:     reference,
+							HmacKey:       []byte{1, 2, 3},
+							CreatedAt:     createdAt,
+						}, nil
+					},
+					MockUpdateExternalAccountKey: func(ctx context.Context, provisionerID string, eak *acme.ExternalAccountKey) error {
+						assert.Equals(t, "provID", provisionerID)
+						assert.True(t, expiresAt.Equal(eak.ExpiresAt))
+						return nil
+					},
+				},
+				body:       `{"reference":"my-ref","expiresAt":"` + expiresAt.Format(time.RFC3339) + `"}`,
+				statusCode: 201,
+				eak: &linkedca.EABKey{
+					Id:          "keyID",
+					HmacKey:     []byte{1, 2, 3},
+					Provisioner: "provID",
+					Reference:   "my-ref",
+					CreatedAt:   timestamppb.New(createdAt),
+					BoundAt:     timestamppb.New(time.Time{}),
 				},
 			}
 		},
@@ -222,65 +328,232 @@ func TestHandler_CreateExternalAccountKey(t *testing.T) {
 	for name, prep := range tests {
 		tc := prep(t)
 		t.Run(name, func(t *testing.T) {
-
-			req := httptest.NewRequest("POST", "/foo", http.NoBody) // chi routing is prepared in test setup
-			req = req.WithContext(tc.ctx)
+			ctx := linkedca.NewContextWithProvisioner(context.Background(), prov)
+			ctx = acme.NewDatabaseContext(ctx, tc.db)
+			req := httptest.NewRequest("POST", "/foo", strings.NewReader(tc.body))
+			req = req.WithContext(ctx)
 			w := httptest.NewRecorder()
 			acmeResponder := NewACMEAdminResponder()
 			acmeResponder.CreateExternalAccountKey(w, req)
 			res := w.Result()
 			assert.Equals(t, tc.statusCode, res.StatusCode)
 
-			body, err := io.ReadAll(res.Body)
-			res.Body.Close()
-			assert.FatalError(t, err)
+			if res.StatusCode >= 400 {
+				body, err := io.ReadAll(res.Body)
+				res.Body.Close()
+				assert.FatalError(t, err)
 
-			adminErr := admin.Error{}
-			assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &adminErr))
+				adminErr := admin.Error{}
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &adminErr))
 
-			assert.Equals(t, tc.err.Type, adminErr.Type)
-			assert.Equals(t, tc.err.Message, adminErr.Message)
-			assert.Equals(t, tc.err.StatusCode(), res.StatusCode)
-			assert.Equals(t, tc.err.Detail, adminErr.Detail)
-			assert.Equals(t, []string{"application/json"}, res.Header["Content-Type"])
+				assert.Equals(t, tc.err.Type, adminErr.Type)
+				assert.Equals(t, tc.err.Message, adminErr.Message)
+				assert.Equals(t, tc.err.StatusCode(), res.StatusCode)
+				assert.Equals(t, tc.err.Detail, adminErr.Detail)
+				assert.Equals(t, []string{"application/json"}, res.Header["Content-Type"])
+				return
+			}
 
+			eak := &linkedca.EABKey{}
+			assert.FatalError(t, readProtoJSON(res.Body, eak))
+			assert.True(t, proto.Equal(tc.eak, eak))
 		})
 	}
 }
 
 func TestHandler_DeleteExternalAccountKey(t *testing.T) {
+	prov := &linkedca.Provisioner{
+		Id:   "provID",
+		Name: "provName",
+	}
 	type test struct {
-		ctx        context.Context
+		db         acme.DB
 		statusCode int
 		err        *admin.Error
 	}
 	var tests = map[string]func(t *testing.T) test{
+		"fail/not-found": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockDeleteExternalAccountKey: func(ctx context.Context, provisionerID, keyID string) error {
+						return acme.ErrNotFound
+					},
+				},
+				statusCode: 404,
+				err: &admin.Error{
+					Type:    admin.ErrorNotFoundType.String(),
+					Status:  http.StatusNotFound,
+					Message: "ACME EAB key keyID not found",
+					Detail:  "resource not found",
+				},
+			}
+		},
+		"fail/db.DeleteExternalAccountKey": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockDeleteExternalAccountKey: func(ctx context.Context, provisionerID, keyID string) error {
+						return errors.New("force")
+					},
+				},
+				statusCode: 500,
+				err: &admin.Error{
+					Type:    admin.ErrorServerInternalType.String(),
+					Status:  http.StatusInternalServerError,
+					Message: "error deleting ACME EAB key keyID: force",
+					Detail:  "the server experienced an internal error",
+				},
+			}
+		},
 		"ok": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockDeleteExternalAccountKey: func(ctx context.Context, provisionerID, keyID string) error {
+						assert.Equals(t, "provID", provisionerID)
+						assert.Equals(t, "keyID", keyID)
+						return nil
+					},
+				},
+				statusCode: 200,
+			}
+		},
+	}
+	for name, prep := range tests {
+		tc := prep(t)
+		t.Run(name, func(t *testing.T) {
 			chiCtx := chi.NewRouteContext()
 			chiCtx.URLParams.Add("provisionerName", "provName")
 			chiCtx.URLParams.Add("id", "keyID")
 			ctx := context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+			ctx = linkedca.NewContextWithProvisioner(ctx, prov)
+			ctx = acme.NewDatabaseContext(ctx, tc.db)
+			req := httptest.NewRequest("DELETE", "/foo", http.NoBody) // chi routing is prepared in test setup
+			req = req.WithContext(ctx)
+			w := httptest.NewRecorder()
+			acmeResponder := NewACMEAdminResponder()
+			acmeResponder.DeleteExternalAccountKey(w, req)
+			res := w.Result()
+			assert.Equals(t, tc.statusCode, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+
+			if res.StatusCode >= 400 {
+				adminErr := admin.Error{}
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &adminErr))
+
+				assert.Equals(t, tc.err.Type, adminErr.Type)
+				assert.Equals(t, tc.err.Message, adminErr.Message)
+				assert.Equals(t, tc.err.StatusCode(), res.StatusCode)
+				assert.Equals(t, tc.err.Detail, adminErr.Detail)
+				assert.Equals(t, []string{"application/json"}, res.Header["Content-Type"])
+				return
+			}
+
+			response := DeleteResponse{}
+			assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &response))
+			assert.Equals(t, "ok", response.Status)
+		})
+	}
+}
+
+func TestHandler_GetExternalAccountKeys(t *testing.T) {
+	prov := &linkedca.Provisioner{
+		Id:   "provID",
+		Name: "provName",
+	}
+	createdAt := time.Now().Truncate(time.Second)
+	key := &acme.ExternalAccountKey{
+		ID:            "keyID",
+		ProvisionerID: "provID",
+		Reference:     "my-ref",
+		HmacKey:       []byte{1, 2, 3},
+		CreatedAt:     createdAt,
+	}
+	type test struct {
+		db         acme.DB
+		reference  string
+		statusCode int
+		err        *admin.Error
+		ids        []string
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/reference-not-found": func(t *testing.T) test {
 			return test{
-				ctx:        ctx,
-				statusCode: 501,
+				db: &acme.MockDB{
+					MockGetExternalAccountKeyByReference: func(ctx context.Context, provisionerID, reference string) (*acme.ExternalAccountKey, error) {
+						return nil, acme.ErrNotFound
+					},
+				},
+				reference:  "my-ref",
+				statusCode: 404,
+				err: &admin.Error{
+					Type:    admin.ErrorNotFoundType.String(),
+					Status:  http.StatusNotFound,
+					Message: "ACME EAB key for reference my-ref not found",
+					Detail:  "resource not found",
+				},
+			}
+		},
+		"fail/db.GetExternalAccountKeys": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetExternalAccountKeys: func(ctx context.Context, provisionerID, cursor string, limit int) ([]*acme.ExternalAccountKey, string, error) {
+						return nil, "", errors.New("force")
+					},
+				},
+				statusCode: 500,
 				err: &admin.Error{
-					Type:    admin.ErrorNotImplementedType.String(),
-					Status:  http.StatusNotImplemented,
-					Message: "this functionality is currently only available in Certificate Manager: https://u.step.sm/cm",
-					Detail:  "not implemented",
+					Type:    admin.ErrorServerInternalType.String(),
+					Status:  http.StatusInternalServerError,
+					Message: "error retrieving ACME EAB keys: force",
+					Detail:  "the server experienced an internal error",
 				},
 			}
 		},
+		"ok/reference": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetExternalAccountKeyByReference: func(ctx context.Context, provisionerID, reference string) (*acme.ExternalAccountKey, error) {
+						assert.Equals(t, "provID", provisionerID)
+						assert.Equals(t, "my-ref", reference)
+						return key, nil
+					},
+				},
+				reference:  "my-ref",
+				statusCode: 200,
+				ids:        []string{"keyID"},
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetExternalAccountKeys: func(ctx context.Context, provisionerID, cursor string, limit int) ([]*acme.ExternalAccountKey, string, error) {
+						assert.Equals(t, "provID", provisionerID)
+						return []*acme.ExternalAccountKey{key, {ID: "otherID", ProvisionerID: "provID"}}, "", nil
+					},
+				},
+				statusCode: 200,
+				ids:        []string{"keyID", "otherID"},
+			}
+		},
 	}
 	for name, prep := range tests {
 		tc := prep(t)
 		t.Run(name, func(t *testing.T) {
-
-			req := httptest.NewRequest("DELETE", "/foo", http.NoBody) // chi routing is prepared in test setup
-			req = req.WithContext(tc.ctx)
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("provisionerName", "provName")
+			if tc.reference != "" {
+				chiCtx.URLParams.Add("reference", tc.reference)
+			}
+			ctx := context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+			ctx = linkedca.NewContextWithProvisioner(ctx, prov)
+			ctx = acme.NewDatabaseContext(ctx, tc.db)
+			req := httptest.NewRequest("GET", "/foo", http.NoBody).WithContext(ctx)
 			w := httptest.NewRecorder()
 			acmeResponder := NewACMEAdminResponder()
-			acmeResponder.DeleteExternalAccountKey(w, req)
+			acmeResponder.GetExternalAccountKeys(w, req)
+
 			res := w.Result()
 			assert.Equals(t, tc.statusCode, res.StatusCode)
 
@@ -288,52 +561,290 @@ func TestHandler_DeleteExternalAccountKey(t *testing.T) {
 			res.Body.Close()
 			assert.FatalError(t, err)
 
-			adminErr := admin.Error{}
-			assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &adminErr))
+			if res.StatusCode >= 400 {
+				adminErr := admin.Error{}
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &adminErr))
 
-			assert.Equals(t, tc.err.Type, adminErr.Type)
-			assert.Equals(t, tc.err.Message, adminErr.Message)
-			assert.Equals(t, tc.err.StatusCode(), res.StatusCode)
-			assert.Equals(t, tc.err.Detail, adminErr.Detail)
-			assert.Equals(t, []string{"application/json"}, res.Header["Content-Type"])
+				assert.Equals(t, tc.err.Type, adminErr.Type)
+				assert.Equals(t, tc.err.Message, adminErr.Message)
+				assert.Equals(t, tc.err.StatusCode(), res.StatusCode)
+				assert.Equals(t, tc.err.Detail, adminErr.Detail)
+				assert.Equals(t, []string{"application/json"}, res.Header["Content-Type"])
+				return
+			}
+
+			response := GetExternalAccountKeysResponse{}
+			assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &response))
+			var ids []string
+			for _, eak := range response.EAKs {
+				ids = append(ids, eak.Id)
+			}
+			assert.Equals(t, tc.ids, ids)
 		})
 	}
 }
 
-func TestHandler_GetExternalAccountKeys(t *testing.T) {
+func TestHandler_UpdateExternalAccountKey(t *testing.T) {
+	prov := &linkedca.Provisioner{
+		Id:   "provID",
+		Name: "provName",
+	}
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	p := &acme.Policy{
+		X509: acme.X509Policy{
+			Allowed: acme.PolicyNames{DNSNames: []string{"*.example.com"}},
+		},
+	}
 	type test struct {
-		ctx        context.Context
+		db         acme.DB
+		body       []byte
 		statusCode int
-		req        *http.Request
 		err        *admin.Error
 	}
 	var tests = map[string]func(t *testing.T) test{
+		"fail/read.JSON": func(t *testing.T) test {
+			return test{
+				body:       []byte("{!?}"),
+				statusCode: 400,
+				err: &admin.Error{
+					Type:    admin.ErrorBadRequestType.String(),
+					Status:  http.StatusBadRequest,
+					Message: "error reading request body: error decoding json: invalid character '!' looking for beginning of object key string",
+					Detail:  "bad request",
+				},
+			}
+		},
+		"fail/validate-policy": func(t *testing.T) test {
+			body, err := json.Marshal(&UpdateExternalAccountKeyRequest{
+				Policy: &acme.Policy{X509: acme.X509Policy{
+					Allowed: acme.PolicyNames{IPRanges: []string{"not-an-ip"}},
+				}},
+			})
+			assert.FatalError(t, err)
+			return test{
+				body:       body,
+				statusCode: 400,
+				err: &admin.Error{
+					Type:    admin.ErrorBadRequestType.String(),
+					Status:  http.StatusBadRequest,
+					Message: "error validating request body: policy is not valid: cannot parse permitted constraint \"not-an-ip\" as IP nor CIDR",
+					Detail:  "bad request",
+				},
+			}
+		},
+		"fail/not-found": func(t *testing.T) test {
+			body, err := json.Marshal(&UpdateExternalAccountKeyRequest{Policy: p})
+			assert.FatalError(t, err)
+			return test{
+				body: body,
+				db: &acme.MockDB{
+					MockGetExternalAccountKey: func(ctx context.Context, provisionerID, keyID string) (*acme.ExternalAccountKey, error) {
+						return nil, acme.ErrNotFound
+					},
+				},
+				statusCode: 404,
+				err: &admin.Error{
+					Type:    admin.ErrorNotFoundType.String(),
+					Status:  http.StatusNotFound,
+					Message: "ACME EAB key keyID not found",
+					Detail:  "resource not found",
+				},
+			}
+		},
+		"fail/revoked": func(t *testing.T) test {
+			body, err := json.Marshal(&UpdateExternalAccountKeyRequest{Policy: p})
+			assert.FatalError(t, err)
+			return test{
+				body: body,
+				db: &acme.MockDB{
+					MockGetExternalAccountKey: func(ctx context.Context, provisionerID, keyID string) (*acme.ExternalAccountKey, error) {
+						return &acme.ExternalAccountKey{ID: keyID, RevokedAt: time.Now()}, nil
+					},
+				},
+				statusCode: 400,
+				err: &admin.Error{
+					Type:    admin.ErrorBadRequestType.String(),
+					Status:  http.StatusBadRequest,
+					Message: "ACME EAB key keyID is revoked",
+					Detail:  "bad request",
+				},
+			}
+		},
+		"fail/db.UpdateExternalAccountKey": func(t *testing.T) test {
+			body, err := json.Marshal(&UpdateExternalAccountKeyRequest{Policy: p})
+			assert.FatalError(t, err)
+			return test{
+				body: body,
+				db: &acme.MockDB{
+					MockGetExternalAccountKey: func(ctx context.Context, provisionerID, keyID string) (*acme.ExternalAccountKey, error) {
+						return &acme.ExternalAccountKey{ID: keyID}, nil
+					},
+					MockUpdateExternalAccountKey: func(ctx context.Context, provisionerID string, eak *acme.ExternalAccountKey) error {
+						return errors.New("force")
+					},
+				},
+				statusCode: 500,
+				err: &admin.Error{
+					Type:    admin.ErrorServerInternalType.String(),
+					Status:  http.StatusInternalServerError,
+					Message: "error updating ACME EAB key keyID: force",
+					Detail:  "the server experienced an internal error",
+				},
+			}
+		},
 		"ok": func(t *testing.T) test {
+			body, err := json.Marshal(&UpdateExternalAccountKeyRequest{ExpiresAt: expiresAt, Policy: p})
+			assert.FatalError(t, err)
+			return test{
+				body: body,
+				db: &acme.MockDB{
+					MockGetExternalAccountKey: func(ctx context.Context, provisionerID, keyID string) (*acme.ExternalAccountKey, error) {
+						assert.Equals(t, "provID", provisionerID)
+						return &acme.ExternalAccountKey{ID: keyID, ProvisionerID: provisionerID}, nil
+					},
+					MockUpdateExternalAccountKey: func(ctx context.Context, provisionerID string, eak *acme.ExternalAccountKey) error {
+						assert.Equals(t, "provID", provisionerID)
+						assert.True(t, expiresAt.Equal(eak.ExpiresAt))
+						assert.Equals(t, p, eak.Policy)
+						return nil
+					},
+				},
+				statusCode: 200,
+			}
+		},
+	}
+	for name, prep := range tests {
+		tc := prep(t)
+		t.Run(name, func(t *testing.T) {
 			chiCtx := chi.NewRouteContext()
 			chiCtx.URLParams.Add("provisionerName", "provName")
-			req := httptest.NewRequest("GET", "/foo", http.NoBody)
+			chiCtx.URLParams.Add("id", "keyID")
 			ctx := context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+			ctx = linkedca.NewContextWithProvisioner(ctx, prov)
+			ctx = acme.NewDatabaseContext(ctx, tc.db)
+			req := httptest.NewRequest("PUT", "/foo", io.NopCloser(bytes.NewBuffer(tc.body))).WithContext(ctx)
+			w := httptest.NewRecorder()
+			acmeResponder := NewACMEAdminResponder()
+			acmeResponder.UpdateExternalAccountKey(w, req)
+
+			res := w.Result()
+			assert.Equals(t, tc.statusCode, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+
+			if res.StatusCode >= 400 {
+				adminErr := admin.Error{}
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &adminErr))
+
+				assert.Equals(t, tc.err.Type, adminErr.Type)
+				assert.Equals(t, tc.err.Message, adminErr.Message)
+				assert.Equals(t, tc.err.StatusCode(), res.StatusCode)
+				assert.Equals(t, tc.err.Detail, adminErr.Detail)
+				return
+			}
+
+			eabKey := &linkedca.EABKey{}
+			assert.FatalError(t, protojson.Unmarshal(body, eabKey))
+			assert.Equals(t, "keyID", eabKey.Id)
+			assert.Equals(t, []string{"*.example.com"}, eabKey.Policy.X509.Allow.Dns)
+		})
+	}
+}
+
+func TestHandler_RevokeExternalAccountKey(t *testing.T) {
+	prov := &linkedca.Provisioner{
+		Id:   "provID",
+		Name: "provName",
+	}
+	type test struct {
+		db         acme.DB
+		statusCode int
+		err        *admin.Error
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/not-found": func(t *testing.T) test {
 			return test{
-				ctx:        ctx,
-				statusCode: 501,
-				req:        req,
+				db: &acme.MockDB{
+					MockGetExternalAccountKey: func(ctx context.Context, provisionerID, keyID string) (*acme.ExternalAccountKey, error) {
+						return nil, acme.ErrNotFound
+					},
+				},
+				statusCode: 404,
+				err: &admin.Error{
+					Type:    admin.ErrorNotFoundType.String(),
+					Status:  http.StatusNotFound,
+					Message: "ACME EAB key keyID not found",
+					Detail:  "resource not found",
+				},
+			}
+		},
+		"fail/already-revoked": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetExternalAccountKey: func(ctx context.Context, provisionerID, keyID string) (*acme.ExternalAccountKey, error) {
+						return &acme.ExternalAccountKey{ID: keyID, RevokedAt: time.Now()}, nil
+					},
+				},
+				statusCode: 400,
+				err: &admin.Error{
+					Type:    admin.ErrorBadRequestType.String(),
+					Status:  http.StatusBadRequest,
+					Message: "ACME EAB key keyID is already revoked",
+					Detail:  "bad request",
+				},
+			}
+		},
+		"fail/db.UpdateExternalAccountKey": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetExternalAccountKey: func(ctx context.Context, provisionerID, keyID string) (*acme.ExternalAccountKey, error) {
+						return &acme.ExternalAccountKey{ID: keyID}, nil
+					},
+					MockUpdateExternalAccountKey: func(ctx context.Context, provisionerID string, eak *acme.ExternalAccountKey) error {
+						return errors.New("force")
+					},
+				},
+				statusCode: 500,
 				err: &admin.Error{
-					Type:    admin.ErrorNotImplementedType.String(),
-					Status:  http.StatusNotImplemented,
-					Message: "this functionality is currently only available in Certificate Manager: https://u.step.sm/cm",
-					Detail:  "not implemented",
+					Type:    admin.ErrorServerInternalType.String(),
+					Status:  http.StatusInternalServerError,
+					Message: "error revoking ACME EAB key keyID: force",
+					Detail:  "the server experienced an internal error",
+				},
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetExternalAccountKey: func(ctx context.Context, provisionerID, keyID string) (*acme.ExternalAccountKey, error) {
+						assert.Equals(t, "provID", provisionerID)
+						return &acme.ExternalAccountKey{ID: keyID, ProvisionerID: provisionerID}, nil
+					},
+					MockUpdateExternalAccountKey: func(ctx context.Context, provisionerID string, eak *acme.ExternalAccountKey) error {
+						assert.Equals(t, "provID", provisionerID)
+						assert.True(t, eak.IsRevoked())
+						return nil
+					},
 				},
+				statusCode: 200,
 			}
 		},
 	}
 	for name, prep := range tests {
 		tc := prep(t)
 		t.Run(name, func(t *testing.T) {
-
-			req := tc.req.WithContext(tc.ctx)
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("provisionerName", "provName")
+			chiCtx.URLParams.Add("id", "keyID")
+			ctx := context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+			ctx = linkedca.NewContextWithProvisioner(ctx, prov)
+			ctx = acme.NewDatabaseContext(ctx, tc.db)
+			req := httptest.NewRequest("POST", "/foo", http.NoBody).WithContext(ctx)
 			w := httptest.NewRecorder()
 			acmeResponder := NewACMEAdminResponder()
-			acmeResponder.GetExternalAccountKeys(w, req)
+			acmeResponder.RevokeExternalAccountKey(w, req)
 
 			res := w.Result()
 			assert.Equals(t, tc.statusCode, res.StatusCode)
@@ -342,18 +853,72 @@ func TestHandler_GetExternalAccountKeys(t *testing.T) {
 			res.Body.Close()
 			assert.FatalError(t, err)
 
-			adminErr := admin.Error{}
-			assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &adminErr))
+			if res.StatusCode >= 400 {
+				adminErr := admin.Error{}
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &adminErr))
 
-			assert.Equals(t, tc.err.Type, adminErr.Type)
-			assert.Equals(t, tc.err.Message, adminErr.Message)
-			assert.Equals(t, tc.err.StatusCode(), res.StatusCode)
-			assert.Equals(t, tc.err.Detail, adminErr.Detail)
-			assert.Equals(t, []string{"application/json"}, res.Header["Content-Type"])
+				assert.Equals(t, tc.err.Type, adminErr.Type)
+				assert.Equals(t, tc.err.Message, adminErr.Message)
+				assert.Equals(t, tc.err.StatusCode(), res.StatusCode)
+				assert.Equals(t, tc.err.Detail, adminErr.Detail)
+				return
+			}
+
+			response := ExternalAccountKeyStatsResponse{}
+			assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &response))
+			assert.Equals(t, "keyID", response.ID)
+			assert.False(t, response.RevokedAt.IsZero())
 		})
 	}
 }
 
+func TestHandler_GetExternalAccountKeyStats(t *testing.T) {
+	prov := &linkedca.Provisioner{
+		Id:   "provID",
+		Name: "provName",
+	}
+	lastIssuedAt := time.Now().Truncate(time.Second).UTC()
+	chiCtx := chi.NewRouteContext()
+	chiCtx.URLParams.Add("provisionerName", "provName")
+	chiCtx.URLParams.Add("id", "keyID")
+	ctx := context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+	ctx = linkedca.NewContextWithProvisioner(ctx, prov)
+	ctx = acme.NewDatabaseContext(ctx, &acme.MockDB{
+		MockGetExternalAccountKey: func(ctx context.Context, provisionerID, keyID string) (*acme.ExternalAccountKey, error) {
+			assert.Equals(t, "provID", provisionerID)
+			assert.Equals(t, "keyID", keyID)
+			return &acme.ExternalAccountKey{
+				ID:            keyID,
+				ProvisionerID: provisionerID,
+				Reference:     "my-ref",
+				AccountID:     "accID",
+				Stats: acme.ExternalAccountKeyStats{
+					Orders:       3,
+					Certificates: 2,
+					LastIssuedAt: lastIssuedAt,
+				},
+			}, nil
+		},
+	})
+
+	req := httptest.NewRequest("GET", "/foo", http.NoBody).WithContext(ctx)
+	w := httptest.NewRecorder()
+	NewACMEAdminResponder().GetExternalAccountKeyStats(w, req)
+
+	res := w.Result()
+	assert.Equals(t, http.StatusOK, res.StatusCode)
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	assert.FatalError(t, err)
+
+	response := ExternalAccountKeyStatsResponse{}
+	assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &response))
+	assert.Equals(t, "keyID", response.ID)
+	assert.Equals(t, "my-ref", response.Reference)
+	assert.Equals(t, "accID", response.Account)
+	assert.Equals(t, acme.ExternalAccountKeyStats{Orders: 3, Certificates: 2, LastIssuedAt: lastIssuedAt}, response.Stats)
+}
+
 func Test_eakToLinked(t *testing.T) {
 	tests := []struct {
 		name string
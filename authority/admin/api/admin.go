@@ -2,7 +2,9 @@ package api
 
 import (
 	"context"
+	"crypto/x509"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 
@@ -11,8 +13,11 @@ import (
 	"github.com/smallstep/certificates/api"
 	"github.com/smallstep/certificates/api/read"
 	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority"
 	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/config"
 	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
 )
 
 type adminAuthority interface {
@@ -33,6 +38,25 @@ type adminAuthority interface {
 	CreateAuthorityPolicy(ctx context.Context, admin *linkedca.Admin, policy *linkedca.Policy) (*linkedca.Policy, error)
 	UpdateAuthorityPolicy(ctx context.Context, admin *linkedca.Admin, policy *linkedca.Policy) (*linkedca.Policy, error)
 	RemoveAuthorityPolicy(ctx context.Context) error
+	ImportRevokedCertificates(ctx context.Context, rcis []*db.RevokedCertificateInfo) ([]error, error)
+	GenerateCertificateRevocationList() error
+	CreateSCEPChallenge(ctx context.Context, provisionerName string, ttl time.Duration) (string, time.Time, error)
+	GetSCEPNextCACertificates() ([]*x509.Certificate, error)
+	SetSCEPNextCACertificates(certs []*x509.Certificate) error
+	GetSSHInventoryHosts(ctx context.Context) ([]*db.SSHInventoryHost, error)
+	StoreSSHInventoryHost(ctx context.Context, host *db.SSHInventoryHost) (*db.SSHInventoryHost, error)
+	RemoveSSHInventoryHost(ctx context.Context, hostname string) error
+	GetTOFUInstances(ctx context.Context, provisionerName string) ([]*db.TOFUInstance, error)
+	ResetTOFUInstance(ctx context.Context, provisionerName, instanceID string) error
+	GetPendingIssuances(ctx context.Context) ([]*db.PendingIssuance, error)
+	GetPendingIssuance(ctx context.Context, id string) (*db.PendingIssuance, error)
+	ApprovePendingIssuance(ctx context.Context, id, decidedBy string) (*db.PendingIssuance, error)
+	DenyPendingIssuance(ctx context.Context, id, decidedBy, reason string) (*db.PendingIssuance, error)
+	CreateIntermediateRotation(ctx context.Context, keyName string) (*authority.IntermediateRotation, error)
+	GetIntermediateRotation(ctx context.Context) (*authority.IntermediateRotation, error)
+	CancelIntermediateRotation(ctx context.Context) error
+	ActivateIntermediateRotation(ctx context.Context, chain []*x509.Certificate) ([]*x509.Certificate, error)
+	ReloadConfig(ctx context.Context, dryRun bool) ([]config.Change, error)
 }
 
 // CreateAdminRequest represents the body for a CreateAdmin request.
@@ -3,6 +3,7 @@ package api
 import (
 	"bytes"
 	"context"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"io"
@@ -19,8 +20,11 @@ import (
 	"go.step.sm/linkedca"
 
 	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority"
 	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/config"
 	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
 )
 
 type mockAdminAuthority struct {
@@ -44,6 +48,26 @@ type mockAdminAuthority struct {
 	MockCreateAuthorityPolicy func(ctx context.Context, adm *linkedca.Admin, policy *linkedca.Policy) (*linkedca.Policy, error)
 	MockUpdateAuthorityPolicy func(ctx context.Context, adm *linkedca.Admin, policy *linkedca.Policy) (*linkedca.Policy, error)
 	MockRemoveAuthorityPolicy func(ctx context.Context) error
+
+	MockImportRevokedCertificates         func(ctx context.Context, rcis []*db.RevokedCertificateInfo) ([]error, error)
+	MockGenerateCertificateRevocationList func() error
+	MockCreateSCEPChallenge               func(ctx context.Context, provisionerName string, ttl time.Duration) (string, time.Time, error)
+	MockGetSCEPNextCACertificates         func() ([]*x509.Certificate, error)
+	MockSetSCEPNextCACertificates         func(certs []*x509.Certificate) error
+	MockGetSSHInventoryHosts              func(ctx context.Context) ([]*db.SSHInventoryHost, error)
+	MockStoreSSHInventoryHost             func(ctx context.Context, host *db.SSHInventoryHost) (*db.SSHInventoryHost, error)
+	MockRemoveSSHInventoryHost            func(ctx context.Context, hostname string) error
+	MockGetTOFUInstances                  func(ctx context.Context, provisionerName string) ([]*db.TOFUInstance, error)
+	MockResetTOFUInstance                 func(ctx context.Context, provisionerName, instanceID string) error
+	MockGetPendingIssuances               func(ctx context.Context) ([]*db.PendingIssuance, error)
+	MockGetPendingIssuance                func(ctx context.Context, id string) (*db.PendingIssuance, error)
+	MockApprovePendingIssuance            func(ctx context.Context, id, decidedBy string) (*db.PendingIssuance, error)
+	MockDenyPendingIssuance               func(ctx context.Context, id, decidedBy, reason string) (*db.PendingIssuance, error)
+	MockCreateIntermediateRotation        func(ctx context.Context, keyName string) (*authority.IntermediateRotation, error)
+	MockGetIntermediateRotation           func(ctx context.Context) (*authority.IntermediateRotation, error)
+	MockCancelIntermediateRotation        func(ctx context.Context) error
+	MockActivateIntermediateRotation      func(ctx context.Context, chain []*x509.Certificate) ([]*x509.Certificate, error)
+	MockReloadConfig                      func(ctx context.Context, dryRun bool) ([]config.Change, error)
 }
 
 func (m *mockAdminAuthority) IsAdminAPIEnabled() bool {
@@ -165,6 +189,139 @@ func (m *mockAdminAuthority) RemoveAuthorityPolicy(ctx context.Context) error {
 	return m.MockErr
 }
 
+func (m *mockAdminAuthority) ImportRevokedCertificates(ctx context.Context, rcis []*db.RevokedCertificateInfo) ([]error, error) {
+	if m.MockImportRevokedCertificates != nil {
+		return m.MockImportRevokedCertificates(ctx, rcis)
+	}
+	return nil, m.MockErr
+}
+
+func (m *mockAdminAuthority) GenerateCertificateRevocationList() error {
+	if m.MockGenerateCertificateRevocationList != nil {
+		return m.MockGenerateCertificateRevocationList()
+	}
+	return m.MockErr
+}
+
+func (m *mockAdminAuthority) CreateSCEPChallenge(ctx context.Context, provisionerName string, ttl time.Duration) (string, time.Time, error) {
+	if m.MockCreateSCEPChallenge != nil {
+		return m.MockCreateSCEPChallenge(ctx, provisionerName, ttl)
+	}
+	return "", time.Time{}, m.MockErr
+}
+
+func (m *mockAdminAuthority) GetSCEPNextCACertificates() ([]*x509.Certificate, error) {
+	if m.MockGetSCEPNextCACertificates != nil {
+		return m.MockGetSCEPNextCACertificates()
+	}
+	return nil, m.MockErr
+}
+
+func (m *mockAdminAuthority) SetSCEPNextCACertificates(certs []*x509.Certificate) error {
+	if m.MockSetSCEPNextCACertificates != nil {
+		return m.MockSetSCEPNextCACertificates(certs)
+	}
+	return m.MockErr
+}
+
+func (m *mockAdminAuthority) GetSSHInventoryHosts(ctx context.Context) ([]*db.SSHInventoryHost, error) {
+	if m.MockGetSSHInventoryHosts != nil {
+		return m.MockGetSSHInventoryHosts(ctx)
+	}
+	return m.MockRet1.([]*db.SSHInventoryHost), m.MockErr
+}
+
+func (m *mockAdminAuthority) StoreSSHInventoryHost(ctx context.Context, host *db.SSHInventoryHost) (*db.SSHInventoryHost, error) {
+	if m.MockStoreSSHInventoryHost != nil {
+		return m.MockStoreSSHInventoryHost(ctx, host)
+	}
+	return m.MockRet1.(*db.SSHInventoryHost), m.MockErr
+}
+
+func (m *mockAdminAuthority) RemoveSSHInventoryHost(ctx context.Context, hostname string) error {
+	if m.MockRemoveSSHInventoryHost != nil {
+		return m.MockRemoveSSHInventoryHost(ctx, hostname)
+	}
+	return m.MockErr
+}
+
+func (m *mockAdminAuthority) GetTOFUInstances(ctx context.Context, provisionerName string) ([]*db.TOFUInstance, error) {
+	if m.MockGetTOFUInstances != nil {
+		return m.MockGetTOFUInstances(ctx, provisionerName)
+	}
+	return m.MockRet1.([]*db.TOFUInstance), m.MockErr
+}
+
+func (m *mockAdminAuthority) ResetTOFUInstance(ctx context.Context, provisionerName, instanceID string) error {
+	if m.MockResetTOFUInstance != nil {
+		return m.MockResetTOFUInstance(ctx, provisionerName, instanceID)
+	}
+	return m.MockErr
+}
+
+func (m *mockAdminAuthority) GetPendingIssuances(ctx context.Context) ([]*db.PendingIssuance, error) {
+	if m.MockGetPendingIssuances != nil {
+		return m.MockGetPendingIssuances(ctx)
+	}
+	return m.MockRet1.([]*db.PendingIssuance), m.MockErr
+}
+
+func (m *mockAdminAuthority) GetPendingIssuance(ctx context.Context, id string) (*db.PendingIssuance, error) {
+	if m.MockGetPendingIssuance != nil {
+		return m.MockGetPendingIssuance(ctx, id)
+	}
+	return m.MockRet1.(*db.PendingIssuance), m.MockErr
+}
+
+func (m *mockAdminAuthority) ApprovePendingIssuance(ctx context.Context, id, decidedBy string) (*db.PendingIssuance, error) {
+	if m.MockApprovePendingIssuance != nil {
+		return m.MockApprovePendingIssuance(ctx, id, decidedBy)
+	}
+	return m.MockRet1.(*db.PendingIssuance), m.MockErr
+}
+
+func (m *mockAdminAuthority) DenyPendingIssuance(ctx context.Context, id, decidedBy, reason string) (*db.PendingIssuance, error) {
+	if m.MockDenyPendingIssuance != nil {
+		return m.MockDenyPendingIssuance(ctx, id, decidedBy, reason)
+	}
+	return m.MockRet1.(*db.PendingIssuance), m.MockErr
+}
+
+func (m *mockAdminAuthority) CreateIntermediateRotation(ctx context.Context, keyName string) (*authority.IntermediateRotation, error) {
+	if m.MockCreateIntermediateRotation != nil {
+		return m.MockCreateIntermediateRotation(ctx, keyName)
+	}
+	return m.MockRet1.(*authority.IntermediateRotation), m.MockErr
+}
+
+func (m *mockAdminAuthority) GetIntermediateRotation(ctx context.Context) (*authority.IntermediateRotation, error) {
+	if m.MockGetIntermediateRotation != nil {
+		return m.MockGetIntermediateRotation(ctx)
+	}
+	return m.MockRet1.(*authority.IntermediateRotation), m.MockErr
+}
+
+func (m *mockAdminAuthority) CancelIntermediateRotation(ctx context.Context) error {
+	if m.MockCancelIntermediateRotation != nil {
+		return m.MockCancelIntermediateRotation(ctx)
+	}
+	return m.MockErr
+}
+
+func (m *mockAdminAuthority) ActivateIntermediateRotation(ctx context.Context, chain []*x509.Certificate) ([]*x509.Certificate, error) {
+	if m.MockActivateIntermediateRotation != nil {
+		return m.MockActivateIntermediateRotation(ctx, chain)
+	}
+	return m.MockRet1.([]*x509.Certificate), m.MockErr
+}
+
+func (m *mockAdminAuthority) ReloadConfig(ctx context.Context, dryRun bool) ([]config.Change, error) {
+	if m.MockReloadConfig != nil {
+		return m.MockReloadConfig(ctx, dryRun)
+	}
+	return m.MockRet1.([]config.Change), m.MockErr
+}
+
 func TestCreateAdminRequest_Validate(t *testing.T) {
 	type fields struct {
 		Subject     string
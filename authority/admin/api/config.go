@@ -0,0 +1,55 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/config"
+)
+
+// ReloadConfigResponse is the response of the GetConfigDiff and ReloadConfig
+// requests.
+type ReloadConfigResponse struct {
+	Changes []config.Change `json:"changes"`
+}
+
+// GetConfigDiff validates the configuration file of the CA and returns the
+// changes from the running configuration, without reloading it. The new
+// configuration is initialized and discarded, so it fails on the same errors
+// as a reload.
+//
+// GetConfigDiff and ReloadConfig are part of the admin API, they are only
+// available if the admin API is enabled and the CA has an admin database. A
+// CA without them can be reloaded by sending a SIGHUP signal.
+func GetConfigDiff(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	changes, err := mustAuthority(ctx).ReloadConfig(ctx, true)
+	if err != nil {
+		render.Error(w, admin.WrapErrorISE(err, "error validating configuration"))
+		return
+	}
+
+	render.JSON(w, newReloadConfigResponse(changes))
+}
+
+// ReloadConfig validates the configuration file of the CA and reloads it
+// without restarting the process. The reload happens after the response is
+// sent, so the status is 202 Accepted.
+func ReloadConfig(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	changes, err := mustAuthority(ctx).ReloadConfig(ctx, false)
+	if err != nil {
+		render.Error(w, admin.WrapErrorISE(err, "error reloading configuration"))
+		return
+	}
+
+	render.JSONStatus(w, newReloadConfigResponse(changes), http.StatusAccepted)
+}
+
+func newReloadConfigResponse(changes []config.Change) *ReloadConfigResponse {
+	if changes == nil {
+		changes = []config.Change{}
+	}
+	return &ReloadConfigResponse{Changes: changes}
+}
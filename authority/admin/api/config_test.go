@@ -0,0 +1,98 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/config"
+)
+
+func TestGetConfigDiff(t *testing.T) {
+	changes := []config.Change{
+		{Path: "authority.provisioners.jwk", Type: config.ChangeAdded},
+		{Path: "tls", Type: config.ChangeModified},
+	}
+	tests := map[string]struct {
+		auth       *mockAdminAuthority
+		statusCode int
+		want       []config.Change
+	}{
+		"ok": {&mockAdminAuthority{MockReloadConfig: func(ctx context.Context, dryRun bool) ([]config.Change, error) {
+			assert.True(t, dryRun)
+			return changes, nil
+		}}, 200, changes},
+		"ok no changes": {&mockAdminAuthority{MockRet1: []config.Change(nil)}, 200, []config.Change{}},
+		"fail 400":      {&mockAdminAuthority{MockRet1: []config.Change(nil), MockErr: admin.NewError(admin.ErrorBadRequestType, "invalid configuration")}, 400, nil},
+		"fail 501":      {&mockAdminAuthority{MockRet1: []config.Change(nil), MockErr: admin.NewError(admin.ErrorNotImplementedType, "not implemented")}, 501, nil},
+		"fail 500":      {&mockAdminAuthority{MockRet1: []config.Change(nil), MockErr: errors.New("force")}, 500, nil},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			req := httptest.NewRequest("GET", "/config/diff", http.NoBody)
+			w := httptest.NewRecorder()
+			GetConfigDiff(w, req)
+			res := w.Result()
+			assert.Equal(t, tc.statusCode, res.StatusCode)
+
+			b, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			require.NoError(t, err)
+			if res.StatusCode != http.StatusOK {
+				return
+			}
+
+			var resp ReloadConfigResponse
+			require.NoError(t, json.Unmarshal(b, &resp))
+			assert.Equal(t, tc.want, resp.Changes)
+		})
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	changes := []config.Change{
+		{Path: "authority.provisioners.jwk", Type: config.ChangeRemoved},
+	}
+	tests := map[string]struct {
+		auth       *mockAdminAuthority
+		statusCode int
+		want       []config.Change
+	}{
+		"ok": {&mockAdminAuthority{MockReloadConfig: func(ctx context.Context, dryRun bool) ([]config.Change, error) {
+			assert.False(t, dryRun)
+			return changes, nil
+		}}, 202, changes},
+		"fail 400": {&mockAdminAuthority{MockRet1: []config.Change(nil), MockErr: admin.NewError(admin.ErrorBadRequestType, "invalid configuration")}, 400, nil},
+		"fail 500": {&mockAdminAuthority{MockRet1: []config.Change(nil), MockErr: errors.New("force")}, 500, nil},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			req := httptest.NewRequest("POST", "/config/reload", http.NoBody)
+			w := httptest.NewRecorder()
+			ReloadConfig(w, req)
+			res := w.Result()
+			assert.Equal(t, tc.statusCode, res.StatusCode)
+
+			b, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			require.NoError(t, err)
+			if res.StatusCode != http.StatusAccepted {
+				return
+			}
+
+			var resp ReloadConfigResponse
+			require.NoError(t, json.Unmarshal(b, &resp))
+			assert.Equal(t, tc.want, resp.Changes)
+		})
+	}
+}
@@ -61,6 +61,10 @@ func Route(r api.Router, options ...RouterOption) {
 		return authnz(loadProvisionerByName(requireEABEnabled(next)))
 	}
 
+	acmeDeviceMiddleware := func(next http.HandlerFunc) http.HandlerFunc {
+		return authnz(loadProvisionerByName(requireACMEProvisioner(next)))
+	}
+
 	authorityPolicyMiddleware := func(next http.HandlerFunc) http.HandlerFunc {
 		return authnz(enabledInStandalone(next))
 	}
@@ -91,6 +95,46 @@ func Route(r api.Router, options ...RouterOption) {
 	r.MethodFunc("PATCH", "/admins/{id}", authnz(UpdateAdmin))
 	r.MethodFunc("DELETE", "/admins/{id}", authnz(DeleteAdmin))
 
+	// Revocations
+	r.MethodFunc("POST", "/revocations/import", authnz(ImportRevocations))
+
+	// SCEP dynamic challenges
+	r.MethodFunc("POST", "/provisioners/{provisionerName}/scep/challenges", authnz(CreateSCEPChallenge))
+
+	// SCEP CA rollover
+	r.MethodFunc("GET", "/scep/nextca", authnz(GetSCEPNextCACertificates))
+	r.MethodFunc("PUT", "/scep/nextca", authnz(SetSCEPNextCACertificates))
+	r.MethodFunc("DELETE", "/scep/nextca", authnz(DeleteSCEPNextCACertificates))
+
+	// Trust on first use instances
+	r.MethodFunc("GET", "/provisioners/{provisionerName}/tofu", authnz(GetTOFUInstances))
+	r.MethodFunc("DELETE", "/provisioners/{provisionerName}/tofu/{instanceID}", authnz(ResetTOFUInstance))
+
+	// Templates
+	r.MethodFunc("POST", "/templates/render", authnz(RenderTemplate))
+
+	// SSH host inventory
+	r.MethodFunc("GET", "/ssh/hosts", authnz(GetSSHInventoryHosts))
+	r.MethodFunc("PUT", "/ssh/hosts/{hostname}", authnz(PutSSHInventoryHost))
+	r.MethodFunc("DELETE", "/ssh/hosts/{hostname}", authnz(DeleteSSHInventoryHost))
+
+	// Certificate approvals
+	r.MethodFunc("GET", "/pending-issuances", authnz(GetPendingIssuances))
+	r.MethodFunc("GET", "/pending-issuances/{id}", authnz(GetPendingIssuance))
+	r.MethodFunc("POST", "/pending-issuances/{id}/approve", authnz(ApprovePendingIssuance))
+	r.MethodFunc("POST", "/pending-issuances/{id}/deny", authnz(DenyPendingIssuance))
+
+	// Intermediate rotation
+	r.MethodFunc("POST", "/intermediates/rotation", authnz(CreateIntermediateRotation))
+	r.MethodFunc("GET", "/intermediates/rotation", authnz(GetIntermediateRotation))
+	r.MethodFunc("DELETE", "/intermediates/rotation", authnz(CancelIntermediateRotation))
+	r.MethodFunc("POST", "/intermediates/rotation/activate", authnz(ActivateIntermediateRotation))
+
+	// Configuration reload, only mounted with the rest of the admin API if the
+	// CA has an admin database.
+	r.MethodFunc("GET", "/config/diff", authnz(GetConfigDiff))
+	r.MethodFunc("POST", "/config/reload", authnz(ReloadConfig))
+
 	// ACME responder
 	if router.acmeResponder != nil {
 		// ACME External Account Binding Keys
@@ -98,6 +142,14 @@ func Route(r api.Router, options ...RouterOption) {
 		r.MethodFunc("GET", "/acme/eab/{provisionerName}", acmeEABMiddleware(router.acmeResponder.GetExternalAccountKeys))
 		r.MethodFunc("POST", "/acme/eab/{provisionerName}", acmeEABMiddleware(router.acmeResponder.CreateExternalAccountKey))
 		r.MethodFunc("DELETE", "/acme/eab/{provisionerName}/{id}", acmeEABMiddleware(router.acmeResponder.DeleteExternalAccountKey))
+		r.MethodFunc("PUT", "/acme/eab/{provisionerName}/{id}", acmeEABMiddleware(router.acmeResponder.UpdateExternalAccountKey))
+		r.MethodFunc("POST", "/acme/eab/{provisionerName}/{id}/revoke", acmeEABMiddleware(router.acmeResponder.RevokeExternalAccountKey))
+		r.MethodFunc("GET", "/acme/eab/{provisionerName}/{id}/stats", acmeEABMiddleware(router.acmeResponder.GetExternalAccountKeyStats))
+
+		// ACME enrolled TPM devices
+		r.MethodFunc("GET", "/acme/devices/{provisionerName}", acmeDeviceMiddleware(router.acmeResponder.GetEnrolledDevices))
+		r.MethodFunc("POST", "/acme/devices/{provisionerName}", acmeDeviceMiddleware(router.acmeResponder.CreateEnrolledDevice))
+		r.MethodFunc("DELETE", "/acme/devices/{provisionerName}/{id}", acmeDeviceMiddleware(router.acmeResponder.DeleteEnrolledDevice))
 	}
 
 	// Policy responder
@@ -129,5 +181,6 @@ func Route(r api.Router, options ...RouterOption) {
 		r.MethodFunc("POST", "/provisioners/{provisionerName}/webhooks", webhookMiddleware(router.webhookResponder.CreateProvisionerWebhook))
 		r.MethodFunc("PUT", "/provisioners/{provisionerName}/webhooks/{webhookName}", webhookMiddleware(router.webhookResponder.UpdateProvisionerWebhook))
 		r.MethodFunc("DELETE", "/provisioners/{provisionerName}/webhooks/{webhookName}", webhookMiddleware(router.webhookResponder.DeleteProvisionerWebhook))
+		r.MethodFunc("POST", "/provisioners/{provisionerName}/webhooks/{webhookName}/rotate", webhookMiddleware(router.webhookResponder.RotateProvisionerWebhookAuth))
 	}
 }
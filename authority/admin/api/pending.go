@@ -0,0 +1,102 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"go.step.sm/linkedca"
+
+	"github.com/smallstep/certificates/api/read"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/db"
+)
+
+// GetPendingIssuancesResponse is the response of a GetPendingIssuances
+// request.
+type GetPendingIssuancesResponse struct {
+	PendingIssuances []*db.PendingIssuance `json:"pendingIssuances"`
+}
+
+// DenyPendingIssuanceRequest is the body of a DenyPendingIssuance request.
+type DenyPendingIssuanceRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// GetPendingIssuances returns the certificate requests that require approval.
+// The status query parameter can be used to return only the requests with the
+// given status.
+func GetPendingIssuances(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	pis, err := mustAuthority(ctx).GetPendingIssuances(ctx)
+	if err != nil {
+		render.Error(w, admin.WrapErrorISE(err, "error retrieving pending issuances"))
+		return
+	}
+
+	resp := &GetPendingIssuancesResponse{
+		PendingIssuances: []*db.PendingIssuance{},
+	}
+	status := db.PendingIssuanceStatus(r.URL.Query().Get("status"))
+	for _, pi := range pis {
+		if status == "" || pi.Status == status {
+			resp.PendingIssuances = append(resp.PendingIssuances, pi)
+		}
+	}
+
+	render.JSON(w, resp)
+}
+
+// GetPendingIssuance returns the certificate request with the given id.
+func GetPendingIssuance(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := chi.URLParam(r, "id")
+	pi, err := mustAuthority(ctx).GetPendingIssuance(ctx, id)
+	if err != nil {
+		render.Error(w, admin.WrapErrorISE(err, "error retrieving pending issuance %s", id))
+		return
+	}
+
+	render.JSON(w, pi)
+}
+
+// ApprovePendingIssuance approves the certificate request with the given id
+// and signs the certificate.
+func ApprovePendingIssuance(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := chi.URLParam(r, "id")
+	pi, err := mustAuthority(ctx).ApprovePendingIssuance(ctx, id, decidedBy(r))
+	if err != nil {
+		render.Error(w, admin.WrapErrorISE(err, "error approving pending issuance %s", id))
+		return
+	}
+
+	render.JSON(w, pi)
+}
+
+// DenyPendingIssuance denies the certificate request with the given id.
+func DenyPendingIssuance(w http.ResponseWriter, r *http.Request) {
+	var body DenyPendingIssuanceRequest
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+
+	ctx := r.Context()
+	id := chi.URLParam(r, "id")
+	pi, err := mustAuthority(ctx).DenyPendingIssuance(ctx, id, decidedBy(r), body.Reason)
+	if err != nil {
+		render.Error(w, admin.WrapErrorISE(err, "error denying pending issuance %s", id))
+		return
+	}
+
+	render.JSON(w, pi)
+}
+
+// decidedBy returns the subject of the admin making the request.
+func decidedBy(r *http.Request) string {
+	if adm, ok := linkedca.AdminFromContext(r.Context()); ok {
+		return adm.Subject
+	}
+	return ""
+}
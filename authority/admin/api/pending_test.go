@@ -0,0 +1,162 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/linkedca"
+
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/db"
+)
+
+func TestGetPendingIssuances(t *testing.T) {
+	createdAt := time.Unix(1700000000, 0).UTC()
+	pending := &db.PendingIssuance{ID: "pi-1", Status: db.PendingIssuanceStatusPending, ProvisionerID: "jwk/1", CreatedAt: createdAt}
+	denied := &db.PendingIssuance{ID: "pi-2", Status: db.PendingIssuanceStatusDenied, ProvisionerID: "jwk/1", CreatedAt: createdAt}
+	tests := map[string]struct {
+		auth       *mockAdminAuthority
+		query      string
+		statusCode int
+		want       []*db.PendingIssuance
+	}{
+		"ok":          {&mockAdminAuthority{MockRet1: []*db.PendingIssuance{pending, denied}}, "", 200, []*db.PendingIssuance{pending, denied}},
+		"ok status":   {&mockAdminAuthority{MockRet1: []*db.PendingIssuance{pending, denied}}, "?status=denied", 200, []*db.PendingIssuance{denied}},
+		"ok no match": {&mockAdminAuthority{MockRet1: []*db.PendingIssuance{pending}}, "?status=issued", 200, []*db.PendingIssuance{}},
+		"ok empty":    {&mockAdminAuthority{MockRet1: []*db.PendingIssuance(nil)}, "", 200, []*db.PendingIssuance{}},
+		"fail 501":    {&mockAdminAuthority{MockRet1: []*db.PendingIssuance(nil), MockErr: admin.NewError(admin.ErrorNotImplementedType, "not implemented")}, "", 501, nil},
+		"fail 500":    {&mockAdminAuthority{MockRet1: []*db.PendingIssuance(nil), MockErr: errors.New("force")}, "", 500, nil},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			req := httptest.NewRequest("GET", "/pending-issuances"+tc.query, http.NoBody)
+			w := httptest.NewRecorder()
+			GetPendingIssuances(w, req)
+			res := w.Result()
+			assert.Equal(t, tc.statusCode, res.StatusCode)
+
+			b, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			require.NoError(t, err)
+			if res.StatusCode != http.StatusOK {
+				return
+			}
+
+			var resp GetPendingIssuancesResponse
+			require.NoError(t, json.Unmarshal(b, &resp))
+			assert.Equal(t, tc.want, resp.PendingIssuances)
+		})
+	}
+}
+
+func TestGetPendingIssuance(t *testing.T) {
+	pi := &db.PendingIssuance{ID: "pi-1", Status: db.PendingIssuanceStatusPending, CreatedAt: time.Unix(1700000000, 0).UTC()}
+	tests := map[string]struct {
+		err        error
+		statusCode int
+	}{
+		"ok":       {nil, 200},
+		"fail 404": {admin.NewError(admin.ErrorNotFoundType, "pending issuance pi-1 not found"), 404},
+		"fail 500": {errors.New("force"), 500},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAdminAuthority{
+				MockGetPendingIssuance: func(ctx context.Context, id string) (*db.PendingIssuance, error) {
+					assert.Equal(t, "pi-1", id)
+					return pi, tc.err
+				},
+			})
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("id", "pi-1")
+			req := httptest.NewRequest("GET", "/pending-issuances/pi-1", http.NoBody)
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, chiCtx))
+			w := httptest.NewRecorder()
+			GetPendingIssuance(w, req)
+			res := w.Result()
+			assert.Equal(t, tc.statusCode, res.StatusCode)
+			if res.StatusCode != http.StatusOK {
+				return
+			}
+
+			var got db.PendingIssuance
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+			assert.Equal(t, pi, &got)
+		})
+	}
+}
+
+func TestApprovePendingIssuance(t *testing.T) {
+	tests := map[string]struct {
+		err        error
+		statusCode int
+	}{
+		"ok":       {nil, 200},
+		"fail 400": {admin.NewError(admin.ErrorBadRequestType, "pending issuance pi-1 is denied"), 400},
+		"fail 409": {admin.NewError(admin.ErrorConflictType, "pending issuance pi-1 has been modified"), 409},
+		"fail 500": {errors.New("force"), 500},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAdminAuthority{
+				MockApprovePendingIssuance: func(ctx context.Context, id, decidedBy string) (*db.PendingIssuance, error) {
+					assert.Equal(t, "pi-1", id)
+					assert.Equal(t, "admin@example.com", decidedBy)
+					return &db.PendingIssuance{ID: id, Status: db.PendingIssuanceStatusIssued, DecidedBy: decidedBy}, tc.err
+				},
+			})
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("id", "pi-1")
+			ctx := context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+			ctx = linkedca.NewContextWithAdmin(ctx, &linkedca.Admin{Subject: "admin@example.com"})
+			req := httptest.NewRequest("POST", "/pending-issuances/pi-1/approve", http.NoBody).WithContext(ctx)
+			w := httptest.NewRecorder()
+			ApprovePendingIssuance(w, req)
+			assert.Equal(t, tc.statusCode, w.Result().StatusCode)
+		})
+	}
+}
+
+func TestDenyPendingIssuance(t *testing.T) {
+	tests := map[string]struct {
+		body       string
+		err        error
+		statusCode int
+	}{
+		"ok":           {`{"reason":"not allowed"}`, nil, 200},
+		"fail body":    {`{`, nil, 400},
+		"fail decided": {`{"reason":"not allowed"}`, admin.NewError(admin.ErrorBadRequestType, "pending issuance pi-1 is issued"), 400},
+		"fail 500":     {`{"reason":"not allowed"}`, errors.New("force"), 500},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAdminAuthority{
+				MockDenyPendingIssuance: func(ctx context.Context, id, decidedBy, reason string) (*db.PendingIssuance, error) {
+					assert.Equal(t, "pi-1", id)
+					assert.Equal(t, "admin@example.com", decidedBy)
+					assert.Equal(t, "not allowed", reason)
+					return &db.PendingIssuance{ID: id, Status: db.PendingIssuanceStatusDenied, Reason: reason}, tc.err
+				},
+			})
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("id", "pi-1")
+			ctx := context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+			ctx = linkedca.NewContextWithAdmin(ctx, &linkedca.Admin{Subject: "admin@example.com"})
+			req := httptest.NewRequest("POST", "/pending-issuances/pi-1/deny", strings.NewReader(tc.body)).WithContext(ctx)
+			w := httptest.NewRecorder()
+			DenyPendingIssuance(w, req)
+			assert.Equal(t, tc.statusCode, w.Result().StatusCode)
+		})
+	}
+}
@@ -205,7 +205,7 @@ func UpdateProvisioner(w http.ResponseWriter, r *http.Request) {
 func validateTemplates(x509, ssh *linkedca.Template) error {
 	if x509 != nil {
 		if len(x509.Template) > 0 {
-			if err := x509util.ValidateTemplate(x509.Template); err != nil {
+			if err := provisioner.ValidateX509Template(x509.Template); err != nil {
 				return fmt.Errorf("invalid X.509 template: %w", err)
 			}
 		}
@@ -218,7 +218,7 @@ func validateTemplates(x509, ssh *linkedca.Template) error {
 
 	if ssh != nil {
 		if len(ssh.Template) > 0 {
-			if err := sshutil.ValidateTemplate(ssh.Template); err != nil {
+			if err := provisioner.ValidateSSHTemplate(ssh.Template); err != nil {
 				return fmt.Errorf("invalid SSH template: %w", err)
 			}
 		}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/db"
+)
+
+// importRevocationsBatchSize is the maximum number of entries written in one
+// database transaction.
+const importRevocationsBatchSize = 500
+
+// importRevocationsLimiter allows only one import of revoked certificates at a
+// time.
+var importRevocationsLimiter = make(chan struct{}, 1)
+
+// Results of an imported revoked certificate.
+const (
+	ImportRevocationImported = "imported"
+	ImportRevocationExists   = "exists"
+	ImportRevocationInvalid  = "invalid"
+)
+
+// ImportRevocationEntry is an entry of an ImportRevocations request.
+type ImportRevocationEntry struct {
+	Serial     string     `json:"serial"`
+	ReasonCode int        `json:"reasonCode"`
+	Reason     string     `json:"reason,omitempty"`
+	RevokedAt  time.Time  `json:"revokedAt"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+}
+
+// ImportRevocationResult is the result of an imported revoked certificate.
+type ImportRevocationResult struct {
+	Serial string `json:"serial"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ImportRevocationsResponse is the response of an ImportRevocations request.
+type ImportRevocationsResponse struct {
+	Imported int                      `json:"imported"`
+	Failed   int                      `json:"failed"`
+	Results  []ImportRevocationResult `json:"results"`
+}
+
+// ImportRevocations marks as revoked a list of certificates issued by another
+// certificate authority. The body is a JSON array of ImportRevocationEntry, it
+// is read as a stream and written to the database in batches. If the body is
+// malformed, the batches already written are not rolled back.
+func ImportRevocations(w http.ResponseWriter, r *http.Request) {
+	select {
+	case importRevocationsLimiter <- struct{}{}:
+		defer func() { <-importRevocationsLimiter }()
+	default:
+		render.Error(w, admin.NewError(admin.ErrorTooManyRequestsType, "another import of revoked certificates is in progress"))
+		return
+	}
+
+	ctx := r.Context()
+	auth := mustAuthority(ctx)
+
+	dec := json.NewDecoder(r.Body)
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		render.Error(w, admin.NewError(admin.ErrorBadRequestType, "error reading request body: body must be a JSON array"))
+		return
+	}
+
+	resp := &ImportRevocationsResponse{
+		Results: []ImportRevocationResult{},
+	}
+	batch := make([]*db.RevokedCertificateInfo, 0, importRevocationsBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		results, err := auth.ImportRevokedCertificates(ctx, batch)
+		if err != nil {
+			return err
+		}
+		for i, err := range results {
+			res := ImportRevocationResult{
+				Serial: batch[i].Serial,
+				Status: ImportRevocationImported,
+			}
+			switch {
+			case err == nil:
+				resp.Imported++
+			case errors.Is(err, db.ErrAlreadyExists):
+				res.Status = ImportRevocationExists
+				resp.Failed++
+			default:
+				res.Status = ImportRevocationInvalid
+				res.Error = err.Error()
+				resp.Failed++
+			}
+			resp.Results = append(resp.Results, res)
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	for n := 0; dec.More(); n++ {
+		var e ImportRevocationEntry
+		if err := dec.Decode(&e); err != nil {
+			render.Error(w, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body: entry %d is not valid", n))
+			return
+		}
+		rci := &db.RevokedCertificateInfo{
+			Serial:     e.Serial,
+			ReasonCode: e.ReasonCode,
+			Reason:     e.Reason,
+			RevokedAt:  e.RevokedAt.UTC(),
+		}
+		if e.ExpiresAt != nil {
+			rci.ExpiresAt = e.ExpiresAt.UTC()
+		}
+		batch = append(batch, rci)
+		if len(batch) == importRevocationsBatchSize {
+			if err := flush(); err != nil {
+				render.Error(w, admin.WrapErrorISE(err, "error importing revoked certificates"))
+				return
+			}
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		render.Error(w, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+	if err := flush(); err != nil {
+		render.Error(w, admin.WrapErrorISE(err, "error importing revoked certificates"))
+		return
+	}
+
+	// Generate a new CRL with the imported certificates.
+	if resp.Imported > 0 {
+		if err := auth.GenerateCertificateRevocationList(); err != nil {
+			render.Error(w, admin.WrapErrorISE(err, "error generating certificate revocation list"))
+			return
+		}
+	}
+
+	render.JSON(w, resp)
+}
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/certificates/db"
+)
+
+func TestImportRevocations(t *testing.T) {
+	revokedAt := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+	newBody := func(n int) string {
+		entries := make([]string, n)
+		for i := range entries {
+			entries[i] = fmt.Sprintf(`{"serial":"%d","reasonCode":1,"revokedAt":"2023-05-01T12:00:00+02:00"}`, i+1)
+		}
+		return "[" + strings.Join(entries, ",") + "]"
+	}
+
+	type test struct {
+		body       string
+		auth       *mockAdminAuthority
+		statusCode int
+		imported   int
+		failed     int
+		batches    int
+		crl        bool
+		results    []ImportRevocationResult
+	}
+	tests := map[string]func(t *testing.T) *test{
+		"ok": func(t *testing.T) *test {
+			tc := &test{body: newBody(1234), statusCode: 200, imported: 1234, batches: 3, crl: true}
+			tc.auth = &mockAdminAuthority{
+				MockImportRevokedCertificates: func(ctx context.Context, rcis []*db.RevokedCertificateInfo) ([]error, error) {
+					tc.batches--
+					assert.LessOrEqual(t, len(rcis), importRevocationsBatchSize)
+					for _, rci := range rcis {
+						assert.Equal(t, 1, rci.ReasonCode)
+						assert.Equal(t, revokedAt, rci.RevokedAt)
+						assert.True(t, rci.ExpiresAt.IsZero())
+					}
+					return make([]error, len(rcis)), nil
+				},
+				MockGenerateCertificateRevocationList: func() error {
+					tc.crl = false
+					return nil
+				},
+			}
+			return tc
+		},
+		"ok with failures": func(t *testing.T) *test {
+			tc := &test{
+				body:       `[{"serial":"1","reasonCode":1,"revokedAt":"2023-05-01T10:00:00Z","expiresAt":"2024-05-01T10:00:00Z"},{"serial":"2","revokedAt":"2023-05-01T10:00:00Z"},{"serial":"foo","revokedAt":"2023-05-01T10:00:00Z"}]`,
+				statusCode: 200, imported: 1, failed: 2, batches: 1, crl: true,
+				results: []ImportRevocationResult{
+					{Serial: "1", Status: ImportRevocationImported},
+					{Serial: "2", Status: ImportRevocationExists},
+					{Serial: "foo", Status: ImportRevocationInvalid, Error: `serial number "foo" is not valid`},
+				},
+			}
+			tc.auth = &mockAdminAuthority{
+				MockImportRevokedCertificates: func(ctx context.Context, rcis []*db.RevokedCertificateInfo) ([]error, error) {
+					tc.batches--
+					require.Len(t, rcis, 3)
+					assert.Equal(t, time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC), rcis[0].ExpiresAt)
+					return []error{nil, db.ErrAlreadyExists, errors.New(`serial number "foo" is not valid`)}, nil
+				},
+				MockGenerateCertificateRevocationList: func() error {
+					tc.crl = false
+					return nil
+				},
+			}
+			return tc
+		},
+		"ok empty": func(t *testing.T) *test {
+			return &test{body: "[]", statusCode: 200, auth: &mockAdminAuthority{}}
+		},
+		"fail not an array": func(t *testing.T) *test {
+			return &test{body: `{"serial":"1"}`, statusCode: 400, auth: &mockAdminAuthority{}}
+		},
+		"fail bad entry": func(t *testing.T) *test {
+			return &test{body: `[{"serial":1}]`, statusCode: 400, auth: &mockAdminAuthority{}}
+		},
+		"fail truncated": func(t *testing.T) *test {
+			return &test{body: `[{"serial":"1","revokedAt":"2023-05-01T10:00:00Z"}`, statusCode: 400, auth: &mockAdminAuthority{}}
+		},
+		"fail import": func(t *testing.T) *test {
+			return &test{body: newBody(10), statusCode: 500, auth: &mockAdminAuthority{
+				MockImportRevokedCertificates: func(ctx context.Context, rcis []*db.RevokedCertificateInfo) ([]error, error) {
+					return nil, errors.New("force")
+				},
+			}}
+		},
+		"fail crl": func(t *testing.T) *test {
+			return &test{body: newBody(10), statusCode: 500, auth: &mockAdminAuthority{
+				MockImportRevokedCertificates: func(ctx context.Context, rcis []*db.RevokedCertificateInfo) ([]error, error) {
+					return make([]error, len(rcis)), nil
+				},
+				MockGenerateCertificateRevocationList: func() error {
+					return errors.New("force")
+				},
+			}}
+		},
+	}
+	for name, prep := range tests {
+		tc := prep(t)
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			req := httptest.NewRequest("POST", "/revocations/import", strings.NewReader(tc.body))
+			w := httptest.NewRecorder()
+			ImportRevocations(w, req)
+			res := w.Result()
+			assert.Equal(t, tc.statusCode, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			require.NoError(t, err)
+			if res.StatusCode != http.StatusOK {
+				return
+			}
+
+			var resp ImportRevocationsResponse
+			require.NoError(t, json.Unmarshal(body, &resp))
+			assert.Equal(t, tc.imported, resp.Imported)
+			assert.Equal(t, tc.failed, resp.Failed)
+			assert.Len(t, resp.Results, tc.imported+tc.failed)
+			assert.Equal(t, 0, tc.batches, "unexpected number of batches")
+			assert.False(t, tc.crl, "CRL was not generated")
+			if tc.results != nil {
+				assert.Equal(t, tc.results, resp.Results)
+			}
+		})
+	}
+}
+
+func TestImportRevocations_tooManyRequests(t *testing.T) {
+	mockMustAuthority(t, &mockAdminAuthority{})
+	importRevocationsLimiter <- struct{}{}
+	defer func() { <-importRevocationsLimiter }()
+
+	req := httptest.NewRequest("POST", "/revocations/import", strings.NewReader("[]"))
+	w := httptest.NewRecorder()
+	ImportRevocations(w, req)
+	assert.Equal(t, http.StatusTooManyRequests, w.Result().StatusCode)
+}
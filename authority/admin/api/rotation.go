@@ -0,0 +1,128 @@
+package api
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"time"
+
+	"go.step.sm/crypto/pemutil"
+
+	"github.com/smallstep/certificates/api/read"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/authority/admin"
+)
+
+// CreateIntermediateRotationRequest is the body of a
+// CreateIntermediateRotation request.
+type CreateIntermediateRotationRequest struct {
+	KeyName string `json:"keyName"`
+}
+
+// IntermediateRotationResponse is the response of the intermediate rotation
+// requests. The certificate request must be signed by the root.
+type IntermediateRotationResponse struct {
+	KeyName   string    `json:"keyName"`
+	CSR       string    `json:"csr"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ActivateIntermediateRotationRequest is the body of an
+// ActivateIntermediateRotation request. The certificate is a PEM bundle with
+// the new intermediate first. It can be empty if the authority is configured
+// with a root key.
+type ActivateIntermediateRotationRequest struct {
+	Certificate string `json:"certificate,omitempty"`
+}
+
+// ActivateIntermediateRotationResponse is the response of an
+// ActivateIntermediateRotation request.
+type ActivateIntermediateRotationResponse struct {
+	Certificate string `json:"certificate"`
+}
+
+// CreateIntermediateRotation creates a new intermediate key and returns the
+// certificate request that must be signed by the root.
+func CreateIntermediateRotation(w http.ResponseWriter, r *http.Request) {
+	var body CreateIntermediateRotationRequest
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+
+	ctx := r.Context()
+	rotation, err := mustAuthority(ctx).CreateIntermediateRotation(ctx, body.KeyName)
+	if err != nil {
+		render.Error(w, admin.WrapErrorISE(err, "error creating intermediate rotation"))
+		return
+	}
+
+	render.JSONStatus(w, newIntermediateRotationResponse(rotation), http.StatusCreated)
+}
+
+// GetIntermediateRotation returns the intermediate rotation in progress.
+func GetIntermediateRotation(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	rotation, err := mustAuthority(ctx).GetIntermediateRotation(ctx)
+	if err != nil {
+		render.Error(w, admin.WrapErrorISE(err, "error retrieving intermediate rotation"))
+		return
+	}
+
+	render.JSON(w, newIntermediateRotationResponse(rotation))
+}
+
+// CancelIntermediateRotation cancels the intermediate rotation in progress.
+func CancelIntermediateRotation(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if err := mustAuthority(ctx).CancelIntermediateRotation(ctx); err != nil {
+		render.Error(w, admin.WrapErrorISE(err, "error canceling intermediate rotation"))
+		return
+	}
+
+	render.JSON(w, &DeleteResponse{Status: "ok"})
+}
+
+// ActivateIntermediateRotation replaces the intermediate used to sign new
+// certificates without restarting the authority. The body is optional if the
+// authority can sign the new intermediate with the root key.
+func ActivateIntermediateRotation(w http.ResponseWriter, r *http.Request) {
+	var body ActivateIntermediateRotationRequest
+	if r.ContentLength != 0 {
+		if err := read.JSON(r.Body, &body); err != nil {
+			render.Error(w, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+			return
+		}
+	}
+
+	var err error
+	var chain []*x509.Certificate
+	if body.Certificate != "" {
+		if chain, err = pemutil.ParseCertificateBundle([]byte(body.Certificate)); err != nil {
+			render.Error(w, admin.WrapError(admin.ErrorBadRequestType, err, "error parsing certificate"))
+			return
+		}
+	}
+
+	ctx := r.Context()
+	if chain, err = mustAuthority(ctx).ActivateIntermediateRotation(ctx, chain); err != nil {
+		render.Error(w, admin.WrapErrorISE(err, "error activating intermediate rotation"))
+		return
+	}
+
+	render.JSON(w, &ActivateIntermediateRotationResponse{
+		Certificate: encodeCertificates(chain),
+	})
+}
+
+func newIntermediateRotationResponse(rotation *authority.IntermediateRotation) *IntermediateRotationResponse {
+	return &IntermediateRotationResponse{
+		KeyName: rotation.KeyName,
+		CSR: string(pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE REQUEST",
+			Bytes: rotation.CertificateRequest.Raw,
+		})),
+		CreatedAt: rotation.CreatedAt,
+	}
+}
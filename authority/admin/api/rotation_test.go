@@ -0,0 +1,181 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/minica"
+
+	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/authority/admin"
+)
+
+func mustIntermediateRotation(t *testing.T) (*authority.IntermediateRotation, *minica.CA) {
+	t.Helper()
+	ca, err := minica.New()
+	require.NoError(t, err)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "Intermediate CA"},
+	}, ca.Signer)
+	require.NoError(t, err)
+	csr, err := x509.ParseCertificateRequest(der)
+	require.NoError(t, err)
+	return &authority.IntermediateRotation{
+		KeyName:            "intermediate_ca_key",
+		CertificateRequest: csr,
+		CreatedAt:          time.Unix(1700000000, 0).UTC(),
+	}, ca
+}
+
+func TestCreateIntermediateRotation(t *testing.T) {
+	rotation, _ := mustIntermediateRotation(t)
+	tests := map[string]struct {
+		auth       *mockAdminAuthority
+		body       string
+		statusCode int
+	}{
+		"ok": {&mockAdminAuthority{MockCreateIntermediateRotation: func(ctx context.Context, keyName string) (*authority.IntermediateRotation, error) {
+			assert.Equal(t, "intermediate_ca_key", keyName)
+			return rotation, nil
+		}}, `{"keyName":"intermediate_ca_key"}`, 201},
+		"fail body": {&mockAdminAuthority{}, `{`, 400},
+		"fail 400":  {&mockAdminAuthority{MockRet1: (*authority.IntermediateRotation)(nil), MockErr: admin.NewError(admin.ErrorBadRequestType, "key name cannot be empty")}, `{}`, 400},
+		"fail 409":  {&mockAdminAuthority{MockRet1: (*authority.IntermediateRotation)(nil), MockErr: admin.NewError(admin.ErrorConflictType, "in progress")}, `{"keyName":"foo"}`, 409},
+		"fail 501":  {&mockAdminAuthority{MockRet1: (*authority.IntermediateRotation)(nil), MockErr: admin.NewError(admin.ErrorNotImplementedType, "not implemented")}, `{"keyName":"foo"}`, 501},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			req := httptest.NewRequest("POST", "/intermediates/rotation", strings.NewReader(tc.body))
+			w := httptest.NewRecorder()
+			CreateIntermediateRotation(w, req)
+			res := w.Result()
+			assert.Equal(t, tc.statusCode, res.StatusCode)
+
+			b, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			require.NoError(t, err)
+			if res.StatusCode != http.StatusCreated {
+				return
+			}
+
+			var resp IntermediateRotationResponse
+			require.NoError(t, json.Unmarshal(b, &resp))
+			assert.Equal(t, "intermediate_ca_key", resp.KeyName)
+			assert.Equal(t, rotation.CreatedAt, resp.CreatedAt)
+			assert.True(t, strings.HasPrefix(resp.CSR, "-----BEGIN CERTIFICATE REQUEST-----\n"))
+		})
+	}
+}
+
+func TestGetIntermediateRotation(t *testing.T) {
+	rotation, _ := mustIntermediateRotation(t)
+	tests := map[string]struct {
+		auth       *mockAdminAuthority
+		statusCode int
+	}{
+		"ok":       {&mockAdminAuthority{MockRet1: rotation}, 200},
+		"fail 404": {&mockAdminAuthority{MockRet1: (*authority.IntermediateRotation)(nil), MockErr: admin.NewError(admin.ErrorNotFoundType, "not found")}, 404},
+		"fail 500": {&mockAdminAuthority{MockRet1: (*authority.IntermediateRotation)(nil), MockErr: errors.New("force")}, 500},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			req := httptest.NewRequest("GET", "/intermediates/rotation", http.NoBody)
+			w := httptest.NewRecorder()
+			GetIntermediateRotation(w, req)
+			res := w.Result()
+			assert.Equal(t, tc.statusCode, res.StatusCode)
+
+			b, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			require.NoError(t, err)
+			if res.StatusCode != http.StatusOK {
+				return
+			}
+
+			var resp IntermediateRotationResponse
+			require.NoError(t, json.Unmarshal(b, &resp))
+			assert.Equal(t, rotation.KeyName, resp.KeyName)
+		})
+	}
+}
+
+func TestCancelIntermediateRotation(t *testing.T) {
+	tests := map[string]struct {
+		auth       *mockAdminAuthority
+		statusCode int
+	}{
+		"ok":       {&mockAdminAuthority{}, 200},
+		"fail 404": {&mockAdminAuthority{MockErr: admin.NewError(admin.ErrorNotFoundType, "not found")}, 404},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			req := httptest.NewRequest("DELETE", "/intermediates/rotation", http.NoBody)
+			w := httptest.NewRecorder()
+			CancelIntermediateRotation(w, req)
+			res := w.Result()
+			assert.Equal(t, tc.statusCode, res.StatusCode)
+		})
+	}
+}
+
+func TestActivateIntermediateRotation(t *testing.T) {
+	_, ca := mustIntermediateRotation(t)
+	chain := []*x509.Certificate{ca.Intermediate}
+	bundle := encodeCertificates(chain)
+	body, err := json.Marshal(ActivateIntermediateRotationRequest{Certificate: bundle})
+	require.NoError(t, err)
+	tests := map[string]struct {
+		auth       *mockAdminAuthority
+		body       string
+		statusCode int
+	}{
+		"ok": {&mockAdminAuthority{MockActivateIntermediateRotation: func(ctx context.Context, certs []*x509.Certificate) ([]*x509.Certificate, error) {
+			assert.Equal(t, chain, certs)
+			return certs, nil
+		}}, string(body), 200},
+		"ok signed by root": {&mockAdminAuthority{MockActivateIntermediateRotation: func(ctx context.Context, certs []*x509.Certificate) ([]*x509.Certificate, error) {
+			assert.Empty(t, certs)
+			return chain, nil
+		}}, "", 200},
+		"fail body":        {&mockAdminAuthority{}, `{`, 400},
+		"fail certificate": {&mockAdminAuthority{}, `{"certificate":"not a pem"}`, 400},
+		"fail 400":         {&mockAdminAuthority{MockRet1: []*x509.Certificate(nil), MockErr: admin.NewError(admin.ErrorBadRequestType, "bad request")}, "", 400},
+		"fail 404":         {&mockAdminAuthority{MockRet1: []*x509.Certificate(nil), MockErr: admin.NewError(admin.ErrorNotFoundType, "not found")}, "", 404},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			req := httptest.NewRequest("POST", "/intermediates/rotation/activate", strings.NewReader(tc.body))
+			w := httptest.NewRecorder()
+			ActivateIntermediateRotation(w, req)
+			res := w.Result()
+			assert.Equal(t, tc.statusCode, res.StatusCode)
+
+			b, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			require.NoError(t, err)
+			if res.StatusCode != http.StatusOK {
+				return
+			}
+
+			var resp ActivateIntermediateRotationResponse
+			require.NoError(t, json.Unmarshal(b, &resp))
+			assert.Equal(t, bundle, resp.Certificate)
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.step.sm/crypto/pemutil"
+
+	"github.com/smallstep/certificates/api/read"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/admin"
+)
+
+// CreateSCEPChallengeRequest is the body of a CreateSCEPChallenge request.
+type CreateSCEPChallengeRequest struct {
+	TTL string `json:"ttl,omitempty"`
+}
+
+// CreateSCEPChallengeResponse is the response of a CreateSCEPChallenge
+// request.
+type CreateSCEPChallengeResponse struct {
+	Challenge string    `json:"challenge"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// CreateSCEPChallenge creates a new one-time challenge for a SCEP provisioner
+// with dynamic challenges enabled. The request body is optional.
+func CreateSCEPChallenge(w http.ResponseWriter, r *http.Request) {
+	var body CreateSCEPChallengeRequest
+	if r.ContentLength != 0 {
+		if err := read.JSON(r.Body, &body); err != nil {
+			render.Error(w, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+			return
+		}
+	}
+
+	var ttl time.Duration
+	if body.TTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(body.TTL); err != nil {
+			render.Error(w, admin.WrapError(admin.ErrorBadRequestType, err, "error parsing ttl"))
+			return
+		}
+	}
+
+	ctx := r.Context()
+	name := chi.URLParam(r, "provisionerName")
+	challenge, expiresAt, err := mustAuthority(ctx).CreateSCEPChallenge(ctx, name, ttl)
+	if err != nil {
+		render.Error(w, admin.WrapErrorISE(err, "error creating scep challenge for provisioner %s", name))
+		return
+	}
+
+	render.JSONStatus(w, &CreateSCEPChallengeResponse{
+		Challenge: challenge,
+		ExpiresAt: expiresAt,
+	}, http.StatusCreated)
+}
+
+// SCEPNextCACertificatesRequest is the body of a SetSCEPNextCACertificates
+// request.
+type SCEPNextCACertificatesRequest struct {
+	Certificates string `json:"certificates"`
+}
+
+// SCEPNextCACertificatesResponse is the response of the SCEP next CA
+// certificates requests.
+type SCEPNextCACertificatesResponse struct {
+	Certificates string `json:"certificates"`
+}
+
+// GetSCEPNextCACertificates returns the PEM encoded certificates staged for the
+// SCEP GetNextCACert operation.
+func GetSCEPNextCACertificates(w http.ResponseWriter, r *http.Request) {
+	certs, err := mustAuthority(r.Context()).GetSCEPNextCACertificates()
+	if err != nil {
+		render.Error(w, admin.WrapErrorISE(err, "error retrieving next scep ca certificates"))
+		return
+	}
+
+	render.JSON(w, &SCEPNextCACertificatesResponse{
+		Certificates: encodeCertificates(certs),
+	})
+}
+
+// SetSCEPNextCACertificates stages the certificates returned by the SCEP
+// GetNextCACert operation before a CA rollover. The body contains a PEM
+// bundle with the next issuing CA certificate first. The certificates are
+// kept across restarts only if the database of the authority supports it.
+func SetSCEPNextCACertificates(w http.ResponseWriter, r *http.Request) {
+	var body SCEPNextCACertificatesRequest
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+
+	certs, err := pemutil.ParseCertificateBundle([]byte(body.Certificates))
+	if err != nil {
+		render.Error(w, admin.WrapError(admin.ErrorBadRequestType, err, "error parsing certificates"))
+		return
+	}
+
+	if err := mustAuthority(r.Context()).SetSCEPNextCACertificates(certs); err != nil {
+		render.Error(w, admin.WrapErrorISE(err, "error staging next scep ca certificates"))
+		return
+	}
+
+	render.JSON(w, &SCEPNextCACertificatesResponse{
+		Certificates: encodeCertificates(certs),
+	})
+}
+
+// DeleteSCEPNextCACertificates removes the certificates staged for the SCEP
+// GetNextCACert operation.
+func DeleteSCEPNextCACertificates(w http.ResponseWriter, r *http.Request) {
+	if err := mustAuthority(r.Context()).SetSCEPNextCACertificates(nil); err != nil {
+		render.Error(w, admin.WrapErrorISE(err, "error deleting next scep ca certificates"))
+		return
+	}
+
+	render.JSON(w, &DeleteResponse{Status: "ok"})
+}
+
+func encodeCertificates(certs []*x509.Certificate) string {
+	var b []byte
+	for _, crt := range certs {
+		b = append(b, pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: crt.Raw,
+		})...)
+	}
+	return string(b)
+}
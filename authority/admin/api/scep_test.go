@@ -0,0 +1,195 @@
+package api
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/minica"
+
+	"github.com/smallstep/certificates/authority/admin"
+)
+
+func TestCreateSCEPChallenge(t *testing.T) {
+	expiresAt := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+	type test struct {
+		body       string
+		auth       *mockAdminAuthority
+		statusCode int
+		want       *CreateSCEPChallengeResponse
+	}
+	tests := map[string]func(t *testing.T) *test{
+		"ok": func(t *testing.T) *test {
+			return &test{
+				statusCode: 201,
+				auth: &mockAdminAuthority{
+					MockCreateSCEPChallenge: func(ctx context.Context, provisionerName string, ttl time.Duration) (string, time.Time, error) {
+						assert.Equal(t, "scep", provisionerName)
+						assert.Equal(t, time.Duration(0), ttl)
+						return "the-challenge", expiresAt, nil
+					},
+				},
+				want: &CreateSCEPChallengeResponse{Challenge: "the-challenge", ExpiresAt: expiresAt},
+			}
+		},
+		"ok with ttl": func(t *testing.T) *test {
+			return &test{
+				body:       `{"ttl":"15m"}`,
+				statusCode: 201,
+				auth: &mockAdminAuthority{
+					MockCreateSCEPChallenge: func(ctx context.Context, provisionerName string, ttl time.Duration) (string, time.Time, error) {
+						assert.Equal(t, 15*time.Minute, ttl)
+						return "the-challenge", expiresAt, nil
+					},
+				},
+				want: &CreateSCEPChallengeResponse{Challenge: "the-challenge", ExpiresAt: expiresAt},
+			}
+		},
+		"fail body": func(t *testing.T) *test {
+			return &test{body: `{`, statusCode: 400, auth: &mockAdminAuthority{}}
+		},
+		"fail ttl": func(t *testing.T) *test {
+			return &test{body: `{"ttl":"foo"}`, statusCode: 400, auth: &mockAdminAuthority{}}
+		},
+		"fail bad request": func(t *testing.T) *test {
+			return &test{statusCode: 400, auth: &mockAdminAuthority{
+				MockCreateSCEPChallenge: func(ctx context.Context, provisionerName string, ttl time.Duration) (string, time.Time, error) {
+					return "", time.Time{}, admin.NewError(admin.ErrorBadRequestType, "provisioner scep does not have dynamic challenges enabled")
+				},
+			}}
+		},
+		"fail not found": func(t *testing.T) *test {
+			return &test{statusCode: 404, auth: &mockAdminAuthority{
+				MockCreateSCEPChallenge: func(ctx context.Context, provisionerName string, ttl time.Duration) (string, time.Time, error) {
+					return "", time.Time{}, admin.NewError(admin.ErrorNotFoundType, "provisioner scep not found")
+				},
+			}}
+		},
+		"fail create": func(t *testing.T) *test {
+			return &test{statusCode: 500, auth: &mockAdminAuthority{
+				MockCreateSCEPChallenge: func(ctx context.Context, provisionerName string, ttl time.Duration) (string, time.Time, error) {
+					return "", time.Time{}, errors.New("force")
+				},
+			}}
+		},
+	}
+	for name, prep := range tests {
+		tc := prep(t)
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("provisionerName", "scep")
+			req := httptest.NewRequest("POST", "/provisioners/scep/scep/challenges", strings.NewReader(tc.body))
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, chiCtx))
+			w := httptest.NewRecorder()
+			CreateSCEPChallenge(w, req)
+			res := w.Result()
+			assert.Equal(t, tc.statusCode, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			require.NoError(t, err)
+			if res.StatusCode != http.StatusCreated {
+				return
+			}
+
+			var resp CreateSCEPChallengeResponse
+			require.NoError(t, json.Unmarshal(body, &resp))
+			assert.Equal(t, tc.want, &resp)
+		})
+	}
+}
+
+func TestSetSCEPNextCACertificates(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	bundle := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Intermediate.Raw})) +
+		string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Root.Raw}))
+	body, err := json.Marshal(SCEPNextCACertificatesRequest{Certificates: bundle})
+	require.NoError(t, err)
+
+	type test struct {
+		body       string
+		auth       *mockAdminAuthority
+		statusCode int
+	}
+	tests := map[string]func(t *testing.T) *test{
+		"ok": func(t *testing.T) *test {
+			return &test{body: string(body), statusCode: 200, auth: &mockAdminAuthority{
+				MockSetSCEPNextCACertificates: func(certs []*x509.Certificate) error {
+					assert.Equal(t, []*x509.Certificate{ca.Intermediate, ca.Root}, certs)
+					return nil
+				},
+			}}
+		},
+		"fail body": func(t *testing.T) *test {
+			return &test{body: `{`, statusCode: 400, auth: &mockAdminAuthority{}}
+		},
+		"fail certificates": func(t *testing.T) *test {
+			return &test{body: `{"certificates":"foo"}`, statusCode: 400, auth: &mockAdminAuthority{}}
+		},
+		"fail bad request": func(t *testing.T) *test {
+			return &test{body: string(body), statusCode: 400, auth: &mockAdminAuthority{
+				MockSetSCEPNextCACertificates: func(certs []*x509.Certificate) error {
+					return admin.NewError(admin.ErrorBadRequestType, "next CA certificate is not a CA certificate")
+				},
+			}}
+		},
+		"fail not enabled": func(t *testing.T) *test {
+			return &test{body: string(body), statusCode: 501, auth: &mockAdminAuthority{
+				MockSetSCEPNextCACertificates: func(certs []*x509.Certificate) error {
+					return admin.NewError(admin.ErrorNotImplementedType, "scep is not enabled")
+				},
+			}}
+		},
+	}
+	for name, prep := range tests {
+		tc := prep(t)
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			req := httptest.NewRequest("PUT", "/scep/nextca", strings.NewReader(tc.body))
+			w := httptest.NewRecorder()
+			SetSCEPNextCACertificates(w, req)
+			res := w.Result()
+			assert.Equal(t, tc.statusCode, res.StatusCode)
+
+			b, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			require.NoError(t, err)
+			if res.StatusCode != http.StatusOK {
+				return
+			}
+
+			var resp SCEPNextCACertificatesResponse
+			require.NoError(t, json.Unmarshal(b, &resp))
+			assert.Equal(t, bundle, resp.Certificates)
+		})
+	}
+}
+
+func TestDeleteSCEPNextCACertificates(t *testing.T) {
+	var called bool
+	mockMustAuthority(t, &mockAdminAuthority{
+		MockSetSCEPNextCACertificates: func(certs []*x509.Certificate) error {
+			called = true
+			assert.Empty(t, certs)
+			return nil
+		},
+	})
+	req := httptest.NewRequest("DELETE", "/scep/nextca", http.NoBody)
+	w := httptest.NewRecorder()
+	DeleteSCEPNextCACertificates(w, req)
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.True(t, called)
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/smallstep/certificates/api/read"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/db"
+)
+
+// SSHInventoryHostRequest is the body of a PutSSHInventoryHost request.
+type SSHInventoryHostRequest struct {
+	Tags   map[string]string `json:"tags,omitempty"`
+	Groups []string          `json:"groups,omitempty"`
+}
+
+// GetSSHInventoryHostsResponse is the response of a GetSSHInventoryHosts
+// request.
+type GetSSHInventoryHostsResponse struct {
+	Hosts []*db.SSHInventoryHost `json:"hosts"`
+}
+
+// GetSSHInventoryHosts returns the hosts in the SSH host inventory.
+func GetSSHInventoryHosts(w http.ResponseWriter, r *http.Request) {
+	hosts, err := mustAuthority(r.Context()).GetSSHInventoryHosts(r.Context())
+	if err != nil {
+		render.Error(w, admin.WrapErrorISE(err, "error retrieving ssh inventory hosts"))
+		return
+	}
+	if hosts == nil {
+		hosts = []*db.SSHInventoryHost{}
+	}
+
+	render.JSON(w, &GetSSHInventoryHostsResponse{
+		Hosts: hosts,
+	})
+}
+
+// PutSSHInventoryHost adds a host to the SSH host inventory, or replaces the
+// tags and groups of an existing one.
+func PutSSHInventoryHost(w http.ResponseWriter, r *http.Request) {
+	var body SSHInventoryHostRequest
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+
+	hostname := chi.URLParam(r, "hostname")
+	host, err := mustAuthority(r.Context()).StoreSSHInventoryHost(r.Context(), &db.SSHInventoryHost{
+		Hostname: hostname,
+		Tags:     body.Tags,
+		Groups:   body.Groups,
+	})
+	if err != nil {
+		render.Error(w, admin.WrapErrorISE(err, "error storing ssh inventory host %s", hostname))
+		return
+	}
+
+	render.JSON(w, host)
+}
+
+// DeleteSSHInventoryHost removes a host from the SSH host inventory.
+func DeleteSSHInventoryHost(w http.ResponseWriter, r *http.Request) {
+	hostname := chi.URLParam(r, "hostname")
+	if err := mustAuthority(r.Context()).RemoveSSHInventoryHost(r.Context(), hostname); err != nil {
+		render.Error(w, admin.WrapErrorISE(err, "error deleting ssh inventory host %s", hostname))
+		return
+	}
+
+	render.JSON(w, &DeleteResponse{Status: "ok"})
+}
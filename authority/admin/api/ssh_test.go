@@ -0,0 +1,135 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/db"
+)
+
+func TestGetSSHInventoryHosts(t *testing.T) {
+	hosts := []*db.SSHInventoryHost{
+		{Hostname: "db01.internal", Groups: []string{"db"}},
+		{Hostname: "web01.internal", Tags: map[string]string{"env": "prod"}, Groups: []string{"web"}},
+	}
+	tests := map[string]struct {
+		auth       *mockAdminAuthority
+		statusCode int
+		want       []*db.SSHInventoryHost
+	}{
+		"ok":       {&mockAdminAuthority{MockRet1: hosts}, 200, hosts},
+		"ok empty": {&mockAdminAuthority{MockRet1: []*db.SSHInventoryHost(nil)}, 200, []*db.SSHInventoryHost{}},
+		"fail not implemented": {&mockAdminAuthority{
+			MockGetSSHInventoryHosts: func(ctx context.Context) ([]*db.SSHInventoryHost, error) {
+				return nil, admin.NewError(admin.ErrorNotImplementedType, "database does not support the ssh host inventory")
+			},
+		}, 501, nil},
+		"fail get": {&mockAdminAuthority{
+			MockGetSSHInventoryHosts: func(ctx context.Context) ([]*db.SSHInventoryHost, error) {
+				return nil, errors.New("force")
+			},
+		}, 500, nil},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			req := httptest.NewRequest("GET", "/ssh/hosts", http.NoBody)
+			w := httptest.NewRecorder()
+			GetSSHInventoryHosts(w, req)
+			res := w.Result()
+			assert.Equal(t, tc.statusCode, res.StatusCode)
+
+			b, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			require.NoError(t, err)
+			if res.StatusCode != http.StatusOK {
+				return
+			}
+
+			var resp GetSSHInventoryHostsResponse
+			require.NoError(t, json.Unmarshal(b, &resp))
+			assert.Equal(t, tc.want, resp.Hosts)
+		})
+	}
+}
+
+func TestPutSSHInventoryHost(t *testing.T) {
+	tests := map[string]struct {
+		body       string
+		auth       *mockAdminAuthority
+		statusCode int
+	}{
+		"ok": {`{"tags":{"env":"prod"},"groups":["web"]}`, &mockAdminAuthority{
+			MockStoreSSHInventoryHost: func(ctx context.Context, host *db.SSHInventoryHost) (*db.SSHInventoryHost, error) {
+				assert.Equal(t, &db.SSHInventoryHost{
+					Hostname: "web01.internal",
+					Tags:     map[string]string{"env": "prod"},
+					Groups:   []string{"web"},
+				}, host)
+				return host, nil
+			},
+		}, 200},
+		"fail body": {`{`, &mockAdminAuthority{}, 400},
+		"fail bad request": {`{"groups":[""]}`, &mockAdminAuthority{
+			MockStoreSSHInventoryHost: func(ctx context.Context, host *db.SSHInventoryHost) (*db.SSHInventoryHost, error) {
+				return nil, admin.NewError(admin.ErrorBadRequestType, "ssh inventory host groups cannot contain an empty value")
+			},
+		}, 400},
+		"fail store": {`{}`, &mockAdminAuthority{
+			MockStoreSSHInventoryHost: func(ctx context.Context, host *db.SSHInventoryHost) (*db.SSHInventoryHost, error) {
+				return nil, errors.New("force")
+			},
+		}, 500},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("hostname", "web01.internal")
+			req := httptest.NewRequest("PUT", "/ssh/hosts/web01.internal", strings.NewReader(tc.body))
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, chiCtx))
+			w := httptest.NewRecorder()
+			PutSSHInventoryHost(w, req)
+			assert.Equal(t, tc.statusCode, w.Result().StatusCode)
+		})
+	}
+}
+
+func TestDeleteSSHInventoryHost(t *testing.T) {
+	tests := map[string]struct {
+		err        error
+		statusCode int
+	}{
+		"ok":       {nil, 200},
+		"fail 404": {admin.NewError(admin.ErrorNotFoundType, "ssh inventory host web01.internal not found"), 404},
+		"fail 500": {errors.New("force"), 500},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAdminAuthority{
+				MockRemoveSSHInventoryHost: func(ctx context.Context, hostname string) error {
+					assert.Equal(t, "web01.internal", hostname)
+					return tc.err
+				},
+			})
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("hostname", "web01.internal")
+			req := httptest.NewRequest("DELETE", "/ssh/hosts/web01.internal", http.NoBody)
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, chiCtx))
+			w := httptest.NewRecorder()
+			DeleteSSHInventoryHost(w, req)
+			assert.Equal(t, tc.statusCode, w.Result().StatusCode)
+		})
+	}
+}
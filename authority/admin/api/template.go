@@ -0,0 +1,221 @@
+package api
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/pemutil"
+	"go.step.sm/crypto/sshutil"
+	"go.step.sm/crypto/x509util"
+
+	"github.com/smallstep/certificates/api/read"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// RenderTemplateRequest is the body of a RenderTemplate request. It contains a
+// certificate template and the sample data used to render it.
+type RenderTemplateRequest struct {
+	// Type is the type of template, "x509" or "ssh".
+	Type string `json:"type"`
+	// Template is the certificate template, as a JSON template or encoded in
+	// base64.
+	Template string `json:"template"`
+	// TemplateData is the template data configured in the provisioner.
+	TemplateData json.RawMessage `json:"templateData,omitempty"`
+	// Token contains the claims of a sample token.
+	Token map[string]interface{} `json:"token,omitempty"`
+	// UserData contains the sample data sent by the user.
+	UserData map[string]interface{} `json:"userData,omitempty"`
+	// Webhooks contains the sample responses of the enriching webhooks,
+	// indexed by the webhook name.
+	Webhooks map[string]interface{} `json:"webhooks,omitempty"`
+
+	// CSR is a PEM encoded certificate request used in X.509 templates. If
+	// it's not set, a CSR with the CommonName and SANs will be used.
+	CSR        string   `json:"csr,omitempty"`
+	CommonName string   `json:"commonName,omitempty"`
+	SANs       []string `json:"sans,omitempty"`
+
+	// CertType, KeyID and Principals are the values used in SSH templates.
+	CertType   string   `json:"certType,omitempty"`
+	KeyID      string   `json:"keyID,omitempty"`
+	Principals []string `json:"principals,omitempty"`
+}
+
+// RenderTemplateResponse is the response of a RenderTemplate request. It
+// contains the rendered certificate, it is not signed.
+type RenderTemplateResponse struct {
+	X509Certificate *x509util.Certificate `json:"x509Certificate,omitempty"`
+	SSHCertificate  *sshutil.Certificate  `json:"sshCertificate,omitempty"`
+}
+
+// Validate validates a RenderTemplate request body.
+func (r *RenderTemplateRequest) Validate() error {
+	switch {
+	case r.Type != "x509" && r.Type != "ssh":
+		return admin.NewError(admin.ErrorBadRequestType, "type must be x509 or ssh")
+	case strings.TrimSpace(r.Template) == "":
+		return admin.NewError(admin.ErrorBadRequestType, "template cannot be empty")
+	case r.Type == "ssh" && r.CertType != "" && r.CertType != sshutil.UserCert.String() && r.CertType != sshutil.HostCert.String():
+		return admin.NewError(admin.ErrorBadRequestType, "certType must be user or host")
+	}
+	return nil
+}
+
+// template returns the template text, decoding it if it's base64 encoded.
+func (r *RenderTemplateRequest) template() (string, error) {
+	template := strings.TrimSpace(r.Template)
+	if strings.HasPrefix(template, "{") {
+		return template, nil
+	}
+	b, err := base64.StdEncoding.DecodeString(template)
+	if err != nil {
+		return "", admin.WrapError(admin.ErrorBadRequestType, err, "error decoding template")
+	}
+	return string(b), nil
+}
+
+// RenderTemplate renders a certificate template with the given sample data and
+// returns the unsigned certificate, so templates can be tested before using
+// them in a provisioner.
+func RenderTemplate(w http.ResponseWriter, r *http.Request) {
+	var body RenderTemplateRequest
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+	if err := body.Validate(); err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	template, err := body.template()
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	var resp *RenderTemplateResponse
+	if body.Type == "x509" {
+		resp, err = renderX509Template(&body, template)
+	} else {
+		resp, err = renderSSHTemplate(&body, template)
+	}
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	render.JSON(w, resp)
+}
+
+func renderX509Template(body *RenderTemplateRequest, template string) (*RenderTemplateResponse, error) {
+	var csr *x509.CertificateRequest
+	if body.CSR != "" {
+		var err error
+		if csr, err = pemutil.ParseCertificateRequest([]byte(body.CSR)); err != nil {
+			return nil, admin.WrapError(admin.ErrorBadRequestType, err, "error parsing csr")
+		}
+	}
+
+	commonName, sans := body.CommonName, body.SANs
+	if csr != nil && commonName == "" && len(sans) == 0 {
+		commonName, sans = csr.Subject.CommonName, csrSANs(csr)
+	}
+	if csr == nil {
+		signer, err := keyutil.GenerateDefaultSigner()
+		if err != nil {
+			return nil, admin.WrapErrorISE(err, "error generating key")
+		}
+		if csr, err = x509util.CreateCertificateRequest(commonName, sans, signer); err != nil {
+			return nil, admin.WrapError(admin.ErrorBadRequestType, err, "error creating csr")
+		}
+	}
+
+	data := x509util.CreateTemplateData(commonName, sans)
+	if len(body.TemplateData) > 0 && string(body.TemplateData) != "null" {
+		if err := json.Unmarshal(body.TemplateData, &data); err != nil {
+			return nil, admin.WrapError(admin.ErrorBadRequestType, err, "error unmarshaling template data")
+		}
+	}
+	if body.Token != nil {
+		data.SetToken(body.Token)
+	}
+	if body.UserData != nil {
+		data.SetUserData(body.UserData)
+	}
+	for name, v := range body.Webhooks {
+		data.SetWebhook(name, v)
+	}
+
+	cert, err := x509util.NewCertificate(csr, provisioner.X509TemplateOption(template, data))
+	if err != nil {
+		return nil, admin.WrapError(admin.ErrorBadRequestType, err, "error rendering template")
+	}
+	return &RenderTemplateResponse{X509Certificate: cert}, nil
+}
+
+func renderSSHTemplate(body *RenderTemplateRequest, template string) (*RenderTemplateResponse, error) {
+	certType := sshutil.UserCert
+	if body.CertType == sshutil.HostCert.String() {
+		certType = sshutil.HostCert
+	}
+
+	signer, err := keyutil.GenerateDefaultSigner()
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error generating key")
+	}
+	key, err := ssh.NewPublicKey(signer.Public())
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error generating key")
+	}
+
+	data := sshutil.CreateTemplateData(certType, body.KeyID, body.Principals)
+	if len(body.TemplateData) > 0 && string(body.TemplateData) != "null" {
+		if err := json.Unmarshal(body.TemplateData, &data); err != nil {
+			return nil, admin.WrapError(admin.ErrorBadRequestType, err, "error unmarshaling template data")
+		}
+	}
+	if body.Token != nil {
+		data.SetToken(body.Token)
+	}
+	if body.UserData != nil {
+		data.SetUserData(body.UserData)
+	}
+	for name, v := range body.Webhooks {
+		data.SetWebhook(name, v)
+	}
+
+	cert, err := sshutil.NewCertificate(sshutil.CertificateRequest{
+		Key:        key,
+		Type:       certType.String(),
+		KeyID:      body.KeyID,
+		Principals: body.Principals,
+	}, provisioner.SSHTemplateOption(template, data))
+	if err != nil {
+		return nil, admin.WrapError(admin.ErrorBadRequestType, err, "error rendering template")
+	}
+	return &RenderTemplateResponse{SSHCertificate: cert}, nil
+}
+
+// csrSANs returns the SANs in a certificate request.
+func csrSANs(csr *x509.CertificateRequest) []string {
+	sans := make([]string, 0, len(csr.DNSNames)+len(csr.EmailAddresses)+len(csr.IPAddresses)+len(csr.URIs))
+	sans = append(sans, csr.DNSNames...)
+	sans = append(sans, csr.EmailAddresses...)
+	for _, ip := range csr.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	for _, u := range csr.URIs {
+		sans = append(sans, u.String())
+	}
+	return sans
+}
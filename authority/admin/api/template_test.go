@@ -0,0 +1,141 @@
+package api
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/x509util"
+
+	"github.com/smallstep/certificates/authority/admin"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	csr, err := x509util.CreateCertificateRequest("csr.example.com", []string{"csr.example.com", "10.1.2.3"}, signer)
+	require.NoError(t, err)
+	csrPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr.Raw}))
+
+	x509Template := `{
+	"subject": {"commonName": {{ toJson .Token.sub }}, "organization": {{ toJson .Organization }}},
+	"sans": {{ toJson .SANs }},
+	"extKeyUsage": {{ toJson (jsonPath "Webhooks.people.usages" .) }}
+	{{- if not .Insecure.User.allow }}{{ fail "user data does not allow it" }}{{ end }}
+}`
+	x509Body, err := json.Marshal(RenderTemplateRequest{
+		Type:         "x509",
+		Template:     x509Template,
+		TemplateData: json.RawMessage(`{"Organization": "Smallstep"}`),
+		Token:        map[string]interface{}{"sub": "jane@example.com"},
+		UserData:     map[string]interface{}{"allow": true},
+		Webhooks:     map[string]interface{}{"people": map[string]interface{}{"usages": []string{"clientAuth"}}},
+		SANs:         []string{"jane@example.com"},
+	})
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		body       string
+		statusCode int
+		err        *admin.Error
+		assertion  func(t *testing.T, resp *RenderTemplateResponse)
+	}{
+		"ok x509": {string(x509Body), 200, nil, func(t *testing.T, resp *RenderTemplateResponse) {
+			require.NotNil(t, resp.X509Certificate)
+			assert.Nil(t, resp.SSHCertificate)
+			assert.Equal(t, "jane@example.com", resp.X509Certificate.Subject.CommonName)
+			assert.Equal(t, x509util.MultiString{"Smallstep"}, resp.X509Certificate.Subject.Organization)
+			assert.Equal(t, []x509util.SubjectAlternativeName{{Type: "email", Value: "jane@example.com"}}, resp.X509Certificate.SANs)
+		}},
+		"ok x509 csr": {`{"type":"x509","template":"{\"subject\": {{ toJson .Subject }}, \"sans\": {{ toJson .SANs }}}","csr":` + jsonString(t, csrPEM) + `}`, 200, nil, func(t *testing.T, resp *RenderTemplateResponse) {
+			require.NotNil(t, resp.X509Certificate)
+			assert.Equal(t, "csr.example.com", resp.X509Certificate.Subject.CommonName)
+			assert.Equal(t, []x509util.SubjectAlternativeName{
+				{Type: "dns", Value: "csr.example.com"},
+				{Type: "ip", Value: "10.1.2.3"},
+			}, resp.X509Certificate.SANs)
+		}},
+		"ok x509 base64": {`{"type":"x509","template":"eyJzdWJqZWN0Ijoge3sgdG9Kc29uIC5TdWJqZWN0IH19fQ==","commonName":"foo"}`, 200, nil, func(t *testing.T, resp *RenderTemplateResponse) {
+			require.NotNil(t, resp.X509Certificate)
+			assert.Equal(t, "foo", resp.X509Certificate.Subject.CommonName)
+		}},
+		"ok ssh": {`{"type":"ssh","template":"{\"type\": {{ toJson .Type }}, \"keyId\": {{ toJson .Token.email }}, \"principals\": {{ toJson .Principals }}}","certType":"host","principals":["host.internal"],"token":{"email":"jane@example.com"}}`, 200, nil, func(t *testing.T, resp *RenderTemplateResponse) {
+			require.NotNil(t, resp.SSHCertificate)
+			assert.Nil(t, resp.X509Certificate)
+			assert.Equal(t, "jane@example.com", resp.SSHCertificate.KeyID)
+			assert.Equal(t, []string{"host.internal"}, resp.SSHCertificate.Principals)
+		}},
+		"fail body": {`{`, 400, &admin.Error{
+			Type:    admin.ErrorBadRequestType.String(),
+			Detail:  "bad request",
+			Message: "error reading request body: error decoding json: unexpected EOF",
+		}, nil},
+		"fail type": {`{"type":"foo","template":"{}"}`, 400, &admin.Error{
+			Type:    admin.ErrorBadRequestType.String(),
+			Detail:  "bad request",
+			Message: "type must be x509 or ssh",
+		}, nil},
+		"fail template": {`{"type":"x509"}`, 400, &admin.Error{
+			Type:    admin.ErrorBadRequestType.String(),
+			Detail:  "bad request",
+			Message: "template cannot be empty",
+		}, nil},
+		"fail cert type": {`{"type":"ssh","template":"{}","certType":"foo"}`, 400, &admin.Error{
+			Type:    admin.ErrorBadRequestType.String(),
+			Detail:  "bad request",
+			Message: "certType must be user or host",
+		}, nil},
+		"fail base64": {`{"type":"x509","template":"not base64"}`, 400, nil, nil},
+		"fail csr":    {`{"type":"x509","template":"{}","csr":"foo"}`, 400, nil, nil},
+		"fail parse":  {`{"type":"x509","template":"{\"subject\": {{ toJson .Subject }}"}`, 400, nil, nil},
+		"fail execute": {`{"type":"x509","template":"{{ fail \"not allowed\" }}"}`, 400, &admin.Error{
+			Type:    admin.ErrorBadRequestType.String(),
+			Detail:  "bad request",
+			Message: "error rendering template: not allowed",
+		}, nil},
+		"fail ssh execute": {`{"type":"ssh","template":"{\"keyId\": {{ toJson (jsonPath \"Webhooks.foo\" .) }}}"}`, 400, nil, nil},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/templates/render", strings.NewReader(tc.body))
+			w := httptest.NewRecorder()
+			RenderTemplate(w, req)
+			res := w.Result()
+			assert.Equal(t, tc.statusCode, res.StatusCode)
+
+			b, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			require.NoError(t, err)
+
+			if res.StatusCode != http.StatusOK {
+				var ae admin.Error
+				require.NoError(t, json.Unmarshal(b, &ae))
+				assert.Equal(t, admin.ErrorBadRequestType.String(), ae.Type)
+				assert.NotEmpty(t, ae.Message)
+				if tc.err != nil {
+					assert.Equal(t, tc.err.Detail, ae.Detail)
+					assert.Equal(t, tc.err.Message, ae.Message)
+				}
+				return
+			}
+
+			var resp RenderTemplateResponse
+			require.NoError(t, json.Unmarshal(b, &resp))
+			tc.assertion(t, &resp)
+		})
+	}
+}
+
+func jsonString(t *testing.T, s string) string {
+	t.Helper()
+	b, err := json.Marshal(s)
+	require.NoError(t, err)
+	return string(b)
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/db"
+)
+
+// GetTOFUInstancesResponse is the response of a GetTOFUInstances request.
+type GetTOFUInstancesResponse struct {
+	Instances []*db.TOFUInstance `json:"instances"`
+}
+
+// GetTOFUInstances returns the instances that have been issued a certificate
+// by a cloud provisioner using trust on first use.
+func GetTOFUInstances(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	name := chi.URLParam(r, "provisionerName")
+	instances, err := mustAuthority(ctx).GetTOFUInstances(ctx, name)
+	if err != nil {
+		render.Error(w, admin.WrapErrorISE(err, "error retrieving tofu instances for provisioner %s", name))
+		return
+	}
+	if instances == nil {
+		instances = []*db.TOFUInstance{}
+	}
+
+	render.JSON(w, &GetTOFUInstancesResponse{
+		Instances: instances,
+	})
+}
+
+// ResetTOFUInstance resets the first use of an instance in a cloud
+// provisioner, so the instance can get a new certificate. Instance IDs
+// containing slashes, like the Azure ones, must be sent path-escaped.
+func ResetTOFUInstance(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	name := chi.URLParam(r, "provisionerName")
+	instanceID := chi.URLParam(r, "instanceID")
+	// The router matches the escaped path if there is one, so the parameter
+	// is still escaped.
+	if r.URL.RawPath != "" {
+		id, err := url.PathUnescape(instanceID)
+		if err != nil {
+			render.Error(w, admin.WrapError(admin.ErrorBadRequestType, err, "error unescaping instance id"))
+			return
+		}
+		instanceID = id
+	}
+	if err := mustAuthority(ctx).ResetTOFUInstance(ctx, name, instanceID); err != nil {
+		render.Error(w, admin.WrapErrorISE(err, "error resetting tofu instance %s for provisioner %s", instanceID, name))
+		return
+	}
+
+	render.JSON(w, &DeleteResponse{Status: "ok"})
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/db"
+)
+
+func TestGetTOFUInstances(t *testing.T) {
+	instances := []*db.TOFUInstance{
+		{ProvisionerID: "aws/aws", InstanceID: "i-1234", TokenID: "token-id", CreatedAt: time.Unix(1700000000, 0).UTC()},
+	}
+	tests := map[string]struct {
+		auth       *mockAdminAuthority
+		statusCode int
+		want       []*db.TOFUInstance
+	}{
+		"ok":       {&mockAdminAuthority{MockRet1: instances}, 200, instances},
+		"ok empty": {&mockAdminAuthority{MockRet1: []*db.TOFUInstance(nil)}, 200, []*db.TOFUInstance{}},
+		"fail not found": {&mockAdminAuthority{
+			MockGetTOFUInstances: func(ctx context.Context, provisionerName string) ([]*db.TOFUInstance, error) {
+				return nil, admin.NewError(admin.ErrorNotFoundType, "provisioner %s not found", provisionerName)
+			},
+		}, 404, nil},
+		"fail get": {&mockAdminAuthority{
+			MockGetTOFUInstances: func(ctx context.Context, provisionerName string) ([]*db.TOFUInstance, error) {
+				return nil, errors.New("force")
+			},
+		}, 500, nil},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("provisionerName", "aws")
+			req := httptest.NewRequest("GET", "/provisioners/aws/tofu", http.NoBody)
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, chiCtx))
+			w := httptest.NewRecorder()
+			GetTOFUInstances(w, req)
+			res := w.Result()
+			assert.Equal(t, tc.statusCode, res.StatusCode)
+
+			b, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			require.NoError(t, err)
+			if res.StatusCode != http.StatusOK {
+				return
+			}
+
+			var resp GetTOFUInstancesResponse
+			require.NoError(t, json.Unmarshal(b, &resp))
+			assert.Equal(t, tc.want, resp.Instances)
+		})
+	}
+}
+
+func TestResetTOFUInstance(t *testing.T) {
+	tests := map[string]struct {
+		err        error
+		statusCode int
+	}{
+		"ok":       {nil, 200},
+		"fail 400": {admin.NewError(admin.ErrorBadRequestType, "provisioner aws does not support trust on first use"), 400},
+		"fail 404": {admin.NewError(admin.ErrorNotFoundType, "instance i-1234 has not been used in provisioner aws"), 404},
+		"fail 500": {errors.New("force"), 500},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAdminAuthority{
+				MockResetTOFUInstance: func(ctx context.Context, provisionerName, instanceID string) error {
+					assert.Equal(t, "aws", provisionerName)
+					assert.Equal(t, "i-1234", instanceID)
+					return tc.err
+				},
+			})
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("provisionerName", "aws")
+			chiCtx.URLParams.Add("instanceID", "i-1234")
+			req := httptest.NewRequest("DELETE", "/provisioners/aws/tofu/i-1234", http.NoBody)
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, chiCtx))
+			w := httptest.NewRecorder()
+			ResetTOFUInstance(w, req)
+			assert.Equal(t, tc.statusCode, w.Result().StatusCode)
+		})
+	}
+}
+
+func TestResetTOFUInstance_escaped(t *testing.T) {
+	mirID := "/subscriptions/subscriptionID/resourceGroups/resourceGroup/providers/Microsoft.Compute/virtualMachines/myVM"
+	var got string
+	mockMustAuthority(t, &mockAdminAuthority{
+		MockResetTOFUInstance: func(ctx context.Context, provisionerName, instanceID string) error {
+			assert.Equal(t, "azure", provisionerName)
+			got = instanceID
+			return nil
+		},
+	})
+
+	r := chi.NewRouter()
+	r.Delete("/provisioners/{provisionerName}/tofu/{instanceID}", ResetTOFUInstance)
+
+	req := httptest.NewRequest("DELETE", "/provisioners/azure/tofu/"+url.PathEscape(mirID), http.NoBody)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Result().StatusCode)
+	assert.Equal(t, mirID, got)
+
+	req = httptest.NewRequest("DELETE", "/provisioners/azure/tofu/i-1234", http.NoBody)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Result().StatusCode)
+	assert.Equal(t, "i-1234", got)
+}
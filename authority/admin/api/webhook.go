@@ -1,8 +1,10 @@
 package api
 
 import (
+	"bytes"
 	"encoding/base64"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 
@@ -20,6 +22,7 @@ type WebhookAdminResponder interface {
 	CreateProvisionerWebhook(w http.ResponseWriter, r *http.Request)
 	UpdateProvisionerWebhook(w http.ResponseWriter, r *http.Request)
 	DeleteProvisionerWebhook(w http.ResponseWriter, r *http.Request)
+	RotateProvisionerWebhookAuth(w http.ResponseWriter, r *http.Request)
 }
 
 // webhoookAdminResponder implements WebhookAdminResponder
@@ -231,3 +234,115 @@ func (war *webhookAdminResponder) UpdateProvisionerWebhook(w http.ResponseWriter
 	}
 	render.ProtoJSONStatus(w, whResponse, http.StatusCreated)
 }
+
+// RotateProvisionerWebhookAuth replaces the bearer token or basic auth
+// password used to authenticate to the webhook server. If the request body is
+// empty or does not contain the new credentials, a random token or password is
+// generated. It is meant to be called periodically, so the credentials are not
+// static.
+//
+// The rotation can be staged with the query parameter stage=true. A staged
+// rotation returns the new credentials without using them, so they can be
+// added to the webhook server before the CA starts to send them. The rotation
+// is completed sending the returned credentials in a request without the stage
+// parameter.
+func (war *webhookAdminResponder) RotateProvisionerWebhookAuth(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	auth := mustAuthority(ctx)
+	prov := linkedca.MustProvisionerFromContext(ctx)
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		render.Error(w, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+	var body = new(linkedca.Webhook)
+	if len(bytes.TrimSpace(data)) > 0 {
+		if err := read.ProtoJSON(bytes.NewReader(data), body); err != nil {
+			render.Error(w, err)
+			return
+		}
+	}
+	stage := r.URL.Query().Get("stage") == "true"
+
+	webhookName := chi.URLParam(r, "webhookName")
+
+	var wh *linkedca.Webhook
+	for _, v := range prov.Webhooks {
+		if v.Name == webhookName {
+			wh = v
+			break
+		}
+	}
+	if wh == nil {
+		msg := fmt.Sprintf("provisioner %q has no webhook with the name %q", prov.Name, webhookName)
+		render.Error(w, admin.NewError(admin.ErrorNotFoundType, msg))
+		return
+	}
+
+	// rotated holds the new credentials until they are used.
+	rotated := new(linkedca.Webhook)
+	switch a := body.GetAuth().(type) {
+	case *linkedca.Webhook_BearerToken:
+		if a.BearerToken.GetBearerToken() == "" {
+			render.Error(w, admin.NewError(admin.ErrorBadRequestType, "webhook bearer token cannot be empty"))
+			return
+		}
+		rotated.Auth = a
+	case *linkedca.Webhook_BasicAuth:
+		if a.BasicAuth.GetUsername() == "" || a.BasicAuth.GetPassword() == "" {
+			render.Error(w, admin.NewError(admin.ErrorBadRequestType, "webhook basic auth username and password cannot be empty"))
+			return
+		}
+		rotated.Auth = a
+	default:
+		secret, err := randutil.Bytes(32)
+		if err != nil {
+			render.Error(w, admin.WrapErrorISE(err, "error generating webhook auth secret"))
+			return
+		}
+		value := base64.RawURLEncoding.EncodeToString(secret)
+		switch current := wh.GetAuth().(type) {
+		case *linkedca.Webhook_BearerToken:
+			rotated.Auth = &linkedca.Webhook_BearerToken{
+				BearerToken: &linkedca.BearerToken{BearerToken: value},
+			}
+		case *linkedca.Webhook_BasicAuth:
+			rotated.Auth = &linkedca.Webhook_BasicAuth{
+				BasicAuth: &linkedca.BasicAuth{Username: current.BasicAuth.GetUsername(), Password: value},
+			}
+		default:
+			render.Error(w, admin.NewError(admin.ErrorBadRequestType, "webhook %q does not use bearer token or basic auth", wh.Name))
+			return
+		}
+	}
+
+	// Return a copy without the signing secret, but with the new auth
+	// secrets, so generated ones can be configured in the webhook server.
+	whResponse := &linkedca.Webhook{
+		Id:                   wh.Id,
+		Name:                 wh.Name,
+		Url:                  wh.Url,
+		Kind:                 wh.Kind,
+		CertType:             wh.CertType,
+		Auth:                 rotated.Auth,
+		DisableTlsClientAuth: wh.DisableTlsClientAuth,
+	}
+	if stage {
+		render.ProtoJSON(w, whResponse)
+		return
+	}
+
+	wh.Auth = rotated.Auth
+	if err := auth.UpdateProvisioner(ctx, prov); err != nil {
+		if isBadRequest(err) {
+			render.Error(w, admin.WrapError(admin.ErrorBadRequestType, err, "error rotating provisioner webhook auth"))
+			return
+		}
+
+		render.Error(w, admin.WrapErrorISE(err, "error rotating provisioner webhook auth"))
+		return
+	}
+	render.ProtoJSON(w, whResponse)
+}
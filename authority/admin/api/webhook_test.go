@@ -687,3 +687,219 @@ func TestWebhookAdminResponder_UpdateProvisionerWebhook(t *testing.T) {
 		})
 	}
 }
+
+func TestWebhookAdminResponder_RotateProvisionerWebhookAuth(t *testing.T) {
+	bearerWebhook := func() *linkedca.Webhook {
+		return &linkedca.Webhook{
+			Name: "my-webhook", Url: "https://example.com", Kind: linkedca.Webhook_ENRICHING, Secret: "c2VjcmV0",
+			Auth: &linkedca.Webhook_BearerToken{BearerToken: &linkedca.BearerToken{BearerToken: "old-token"}},
+		}
+	}
+	basicWebhook := func() *linkedca.Webhook {
+		return &linkedca.Webhook{
+			Name: "my-webhook", Url: "https://example.com", Kind: linkedca.Webhook_ENRICHING, Secret: "c2VjcmV0",
+			Auth: &linkedca.Webhook_BasicAuth{BasicAuth: &linkedca.BasicAuth{Username: "user", Password: "old-password"}},
+		}
+	}
+	type test struct {
+		auth        adminAuthority
+		body        string
+		webhook     *linkedca.Webhook
+		webhookName string
+		stage       bool
+		err         *admin.Error
+		statusCode  int
+		assertion   func(t *testing.T, wh *linkedca.Webhook)
+	}
+	updateOK := &mockAdminAuthority{
+		MockUpdateProvisioner: func(ctx context.Context, nu *linkedca.Provisioner) error {
+			return nil
+		},
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/read.ProtoJSON": func(t *testing.T) test {
+			adminErr := admin.NewError(admin.ErrorBadRequestType, "proto: syntax error (line 1:2): invalid value ?")
+			adminErr.Message = "proto: syntax error (line 1:2): invalid value ?"
+			return test{body: "{?}", webhook: bearerWebhook(), webhookName: "my-webhook", err: adminErr, statusCode: 400}
+		},
+		"fail/not-found": func(t *testing.T) test {
+			adminErr := admin.NewError(admin.ErrorNotFoundType, `provisioner "provName" has no webhook with the name "no-exists"`)
+			adminErr.Message = `provisioner "provName" has no webhook with the name "no-exists"`
+			return test{body: "{}", webhook: bearerWebhook(), webhookName: "no-exists", err: adminErr, statusCode: 404}
+		},
+		"fail/empty-bearer-token": func(t *testing.T) test {
+			adminErr := admin.NewError(admin.ErrorBadRequestType, "webhook bearer token cannot be empty")
+			adminErr.Message = "webhook bearer token cannot be empty"
+			return test{body: `{"bearerToken": {}}`, webhook: bearerWebhook(), webhookName: "my-webhook", err: adminErr, statusCode: 400}
+		},
+		"fail/empty-basic-auth": func(t *testing.T) test {
+			adminErr := admin.NewError(admin.ErrorBadRequestType, "webhook basic auth username and password cannot be empty")
+			adminErr.Message = "webhook basic auth username and password cannot be empty"
+			return test{body: `{"basicAuth": {"username": "user"}}`, webhook: basicWebhook(), webhookName: "my-webhook", err: adminErr, statusCode: 400}
+		},
+		"fail/no-auth": func(t *testing.T) test {
+			adminErr := admin.NewError(admin.ErrorBadRequestType, `webhook "my-webhook" does not use bearer token or basic auth`)
+			adminErr.Message = `webhook "my-webhook" does not use bearer token or basic auth`
+			return test{
+				body:        "{}",
+				webhook:     &linkedca.Webhook{Name: "my-webhook", Url: "https://example.com", Kind: linkedca.Webhook_ENRICHING},
+				webhookName: "my-webhook",
+				err:         adminErr,
+				statusCode:  400,
+			}
+		},
+		"fail/auth.UpdateProvisioner-error": func(t *testing.T) test {
+			adminErr := admin.NewError(admin.ErrorServerInternalType, "error rotating provisioner webhook auth: force")
+			adminErr.Message = "error rotating provisioner webhook auth: force"
+			return test{
+				auth: &mockAdminAuthority{
+					MockUpdateProvisioner: func(ctx context.Context, nu *linkedca.Provisioner) error {
+						return &authority.PolicyError{
+							Typ: authority.StoreFailure,
+							Err: errors.New("force"),
+						}
+					},
+				},
+				body:        "{}",
+				webhook:     bearerWebhook(),
+				webhookName: "my-webhook",
+				err:         adminErr,
+				statusCode:  500,
+			}
+		},
+		"ok/bearer-token": func(t *testing.T) test {
+			return test{
+				auth:        updateOK,
+				body:        `{"bearerToken": {"bearerToken": "new-token"}}`,
+				webhook:     bearerWebhook(),
+				webhookName: "my-webhook",
+				statusCode:  200,
+				assertion: func(t *testing.T, wh *linkedca.Webhook) {
+					assert.Equal(t, "new-token", wh.GetBearerToken().GetBearerToken())
+				},
+			}
+		},
+		"ok/generated-bearer-token": func(t *testing.T) test {
+			return test{
+				auth:        updateOK,
+				body:        "{}",
+				webhook:     bearerWebhook(),
+				webhookName: "my-webhook",
+				statusCode:  200,
+				assertion: func(t *testing.T, wh *linkedca.Webhook) {
+					assert.Len(t, wh.GetBearerToken().GetBearerToken(), 43)
+					assert.NotEqual(t, "old-token", wh.GetBearerToken().GetBearerToken())
+				},
+			}
+		},
+		"ok/empty-body": func(t *testing.T) test {
+			return test{
+				auth:        updateOK,
+				body:        "",
+				webhook:     bearerWebhook(),
+				webhookName: "my-webhook",
+				statusCode:  200,
+				assertion: func(t *testing.T, wh *linkedca.Webhook) {
+					assert.Len(t, wh.GetBearerToken().GetBearerToken(), 43)
+				},
+			}
+		},
+		"ok/stage": func(t *testing.T) test {
+			return test{
+				auth: &mockAdminAuthority{
+					MockUpdateProvisioner: func(ctx context.Context, nu *linkedca.Provisioner) error {
+						t.Error("staged rotation updated the provisioner")
+						return nil
+					},
+				},
+				body:        "",
+				webhook:     bearerWebhook(),
+				webhookName: "my-webhook",
+				stage:       true,
+				statusCode:  200,
+				assertion: func(t *testing.T, wh *linkedca.Webhook) {
+					assert.Len(t, wh.GetBearerToken().GetBearerToken(), 43)
+					assert.NotEqual(t, "old-token", wh.GetBearerToken().GetBearerToken())
+				},
+			}
+		},
+		"ok/generated-basic-auth": func(t *testing.T) test {
+			return test{
+				auth:        updateOK,
+				body:        "{}",
+				webhook:     basicWebhook(),
+				webhookName: "my-webhook",
+				statusCode:  200,
+				assertion: func(t *testing.T, wh *linkedca.Webhook) {
+					assert.Equal(t, "user", wh.GetBasicAuth().GetUsername())
+					assert.Len(t, wh.GetBasicAuth().GetPassword(), 43)
+					assert.NotEqual(t, "old-password", wh.GetBasicAuth().GetPassword())
+				},
+			}
+		},
+	}
+	for name, prep := range tests {
+		tc := prep(t)
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("webhookName", tc.webhookName)
+			ctx := context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+			prov := &linkedca.Provisioner{
+				Name:     "provName",
+				Webhooks: []*linkedca.Webhook{tc.webhook},
+			}
+			ctx = linkedca.NewContextWithProvisioner(ctx, prov)
+			ctx = admin.NewContext(ctx, &admin.MockDB{})
+			target := "/foo"
+			if tc.stage {
+				target += "?stage=true"
+			}
+			req := httptest.NewRequest("POST", target, strings.NewReader(tc.body)).WithContext(ctx)
+
+			war := NewWebhookAdminResponder()
+
+			w := httptest.NewRecorder()
+
+			war.RotateProvisionerWebhookAuth(w, req)
+			res := w.Result()
+
+			assert.Equal(t, tc.statusCode, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.NoError(t, err)
+
+			if res.StatusCode >= 400 {
+				ae := testAdminError{}
+				assert.NoError(t, json.Unmarshal(bytes.TrimSpace(body), &ae))
+
+				assert.Equal(t, tc.err.Type, ae.Type)
+				assert.Equal(t, tc.err.StatusCode(), res.StatusCode)
+				assert.Equal(t, tc.err.Detail, ae.Detail)
+				assert.Equal(t, []string{"application/json"}, res.Header["Content-Type"])
+
+				if strings.HasPrefix(tc.err.Message, "proto:") {
+					assert.True(t, strings.Contains(ae.Message, "syntax error"))
+				} else {
+					assert.Equal(t, tc.err.Message, ae.Message)
+				}
+
+				return
+			}
+
+			resp := &linkedca.Webhook{}
+			assert.NoError(t, protojson.Unmarshal(body, resp))
+			assert.Equal(t, "my-webhook", resp.Name)
+			assert.Empty(t, resp.Secret)
+			assert.Equal(t, "c2VjcmV0", prov.Webhooks[0].Secret)
+			if tc.stage {
+				assert.Equal(t, tc.webhook.GetAuth(), bearerWebhook().GetAuth())
+			} else {
+				assert.Equal(t, prov.Webhooks[0].GetAuth(), resp.GetAuth())
+			}
+			tc.assertion(t, resp)
+		})
+	}
+}
@@ -30,6 +30,8 @@ const (
 	ErrorServerInternalType
 	// ErrorConflictType conflict.
 	ErrorConflictType
+	// ErrorTooManyRequestsType too many requests.
+	ErrorTooManyRequestsType
 )
 
 // String returns the string representation of the admin problem type,
@@ -52,6 +54,8 @@ func (ap ProblemType) String() string {
 		return "internalServerError"
 	case ErrorConflictType:
 		return "conflict"
+	case ErrorTooManyRequestsType:
+		return "tooManyRequests"
 	default:
 		return fmt.Sprintf("unsupported error type '%d'", int(ap))
 	}
@@ -107,6 +111,11 @@ var (
 			details: "conflict",
 			status:  http.StatusConflict,
 		},
+		ErrorTooManyRequestsType: {
+			typ:     ErrorTooManyRequestsType.String(),
+			details: "too many requests",
+			status:  http.StatusTooManyRequests,
+		},
 	}
 )
 
@@ -0,0 +1,422 @@
+package authority
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/smallstep/nosql"
+	"go.step.sm/crypto/randutil"
+
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/provisioner"
+	casapi "github.com/smallstep/certificates/cas/apiv1"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/certificates/middleware/requestid"
+	"github.com/smallstep/certificates/webhook"
+)
+
+// PendingIssuanceError is the error returned by SignWithContext when the
+// provisioner requires the approval of the signing request. ID is the id of the
+// queued request, it can be used to retrieve the certificate once it's
+// approved.
+type PendingIssuanceError struct {
+	ID        string
+	ExpiresAt time.Time
+}
+
+// Error implements the error interface.
+func (e *PendingIssuanceError) Error() string {
+	return fmt.Sprintf("certificate request %s is pending approval", e.ID)
+}
+
+// StatusCode implements the render.StatusCodedError interface.
+func (e *PendingIssuanceError) StatusCode() int {
+	return http.StatusAccepted
+}
+
+// getApprovalOptions returns the approval options of the provisioner if its
+// signing requests must be approved. ACME and SCEP provisioners are skipped,
+// their clients cannot wait for a decision.
+func getApprovalOptions(p provisioner.Interface) (*provisioner.ApprovalOptions, bool) {
+	if p == nil {
+		return nil, false
+	}
+	switch p.GetType() {
+	case provisioner.TypeACME, provisioner.TypeSCEP:
+		return nil, false
+	}
+	po, ok := p.(interface{ GetOptions() *provisioner.Options })
+	if !ok {
+		return nil, false
+	}
+	o := po.GetOptions().GetApproval()
+	return o, o.IsRequired()
+}
+
+// queuePendingIssuance stores the signing request and the unsigned certificate
+// in the database until an administrator approves or denies it. On success it
+// returns a PendingIssuanceError with the id of the request.
+func (a *Authority) queuePendingIssuance(ctx context.Context, prov provisioner.Interface, o *provisioner.ApprovalOptions, csr *x509.CertificateRequest, leaf *x509.Certificate, lifetime, backdate time.Duration) error {
+	pdb, ok := a.db.(db.PendingIssuanceDB)
+	if !ok {
+		return errs.InternalServer("database does not support certificate approvals")
+	}
+	template, err := marshalPendingTemplate(leaf)
+	if err != nil {
+		return errs.Wrap(http.StatusInternalServerError, err, "authority.Sign; error queuing certificate request")
+	}
+	// The names are read from the encoded template, SANs might only be in an
+	// extension.
+	tpl, err := x509.ParseCertificate(template)
+	if err != nil {
+		return errs.Wrap(http.StatusInternalServerError, err, "authority.Sign; error queuing certificate request")
+	}
+	id, err := randutil.UUIDv4()
+	if err != nil {
+		return errs.Wrap(http.StatusInternalServerError, err, "authority.Sign; error queuing certificate request")
+	}
+
+	now := time.Now().UTC()
+	expiresAt := now.Add(o.GetExpiration())
+
+	// Identity certificates expire with their SSH certificate, so they keep
+	// their validity and they cannot be approved once it's expired.
+	var notAfter time.Time
+	if provisioner.MethodFromContext(ctx) == provisioner.SignIdentityMethod {
+		notAfter = leaf.NotAfter
+		if notAfter.Before(expiresAt) {
+			expiresAt = notAfter
+		}
+	}
+
+	pi := &db.PendingIssuance{
+		ID:                 id,
+		Status:             db.PendingIssuanceStatusPending,
+		ProvisionerID:      prov.GetID(),
+		ProvisionerName:    prov.GetName(),
+		CommonName:         tpl.Subject.CommonName,
+		SANs:               certificateSANs(tpl),
+		CSR:                csr.Raw,
+		Template:           template,
+		SignatureAlgorithm: leaf.SignatureAlgorithm,
+		Lifetime:           lifetime,
+		Backdate:           backdate,
+		NotAfter:           notAfter,
+		CreatedAt:          now,
+		ExpiresAt:          expiresAt,
+	}
+	if err := pdb.StorePendingIssuance(pi); err != nil {
+		return errs.Wrap(http.StatusInternalServerError, err, "authority.Sign; error queuing certificate request")
+	}
+
+	a.notifyIssuancePending(ctx, prov, csr, pi)
+
+	return &PendingIssuanceError{
+		ID:        pi.ID,
+		ExpiresAt: pi.ExpiresAt,
+	}
+}
+
+// notifyIssuancePending sends the issuance pending event to the notifying
+// webhooks of the provisioner.
+func (a *Authority) notifyIssuancePending(ctx context.Context, prov provisioner.Interface, csr *x509.CertificateRequest, pi *db.PendingIssuance) {
+	p, ok := prov.(interface{ GetOptions() *provisioner.Options })
+	if !ok {
+		return
+	}
+	webhooks := p.GetOptions().GetWebhooks()
+	if len(webhooks) == 0 {
+		return
+	}
+
+	requestID, _ := requestid.FromContext(ctx)
+	req, err := webhook.NewRequestBody(
+		webhook.WithX509CertificateRequest(csr),
+		webhook.WithIssuancePending(pi.ID, prov.GetType().String(), requestID, pi.ExpiresAt),
+	)
+	if err != nil {
+		log.Printf("error creating issuance pending notification: %v", err)
+		return
+	}
+	req.ProvisionerName = prov.GetName()
+
+	a.getWebhookNotifier().Notify(ctx, webhooks, req)
+}
+
+// pendingIssuanceDB returns the database used to store the signing requests
+// waiting for approval.
+func (a *Authority) pendingIssuanceDB() (db.PendingIssuanceDB, error) {
+	pdb, ok := a.db.(db.PendingIssuanceDB)
+	if !ok {
+		return nil, admin.NewError(admin.ErrorNotImplementedType, "database does not support certificate approvals")
+	}
+	return pdb, nil
+}
+
+// loadPendingIssuance returns the signing request with the given id. Pending
+// requests past their expiration are returned with the expired status.
+func (a *Authority) loadPendingIssuance(id string) (db.PendingIssuanceDB, *db.PendingIssuance, error) {
+	pdb, err := a.pendingIssuanceDB()
+	if err != nil {
+		return nil, nil, err
+	}
+	pi, err := pdb.GetPendingIssuance(id)
+	if err != nil {
+		if nosql.IsErrNotFound(err) {
+			return nil, nil, admin.NewError(admin.ErrorNotFoundType, "pending issuance %s not found", id)
+		}
+		return nil, nil, admin.WrapErrorISE(err, "error retrieving pending issuance %s", id)
+	}
+	setPendingIssuanceExpiration(pi, time.Now())
+	return pdb, pi, nil
+}
+
+func setPendingIssuanceExpiration(pi *db.PendingIssuance, now time.Time) {
+	if pi.Status == db.PendingIssuanceStatusPending && now.After(pi.ExpiresAt) {
+		pi.Status = db.PendingIssuanceStatusExpired
+	}
+}
+
+// GetPendingIssuance returns the signing request with the given id.
+func (a *Authority) GetPendingIssuance(_ context.Context, id string) (*db.PendingIssuance, error) {
+	_, pi, err := a.loadPendingIssuance(id)
+	return pi, err
+}
+
+// GetPendingIssuances returns all the signing requests that require approval,
+// sorted by creation time.
+func (a *Authority) GetPendingIssuances(_ context.Context) ([]*db.PendingIssuance, error) {
+	pdb, err := a.pendingIssuanceDB()
+	if err != nil {
+		return nil, err
+	}
+	pis, err := pdb.GetPendingIssuances()
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error retrieving pending issuances")
+	}
+	now := time.Now()
+	for _, pi := range pis {
+		setPendingIssuanceExpiration(pi, now)
+	}
+	sort.Slice(pis, func(i, j int) bool {
+		return pis[i].CreatedAt.Before(pis[j].CreatedAt)
+	})
+	return pis, nil
+}
+
+// ApprovePendingIssuance approves the signing request with the given id and
+// signs the certificate. The certificate is valid from the approval with the
+// requested lifetime. If the signature fails, the request is kept pending.
+func (a *Authority) ApprovePendingIssuance(ctx context.Context, id, decidedBy string) (*db.PendingIssuance, error) {
+	pdb, pi, err := a.loadPendingIssuance(id)
+	if err != nil {
+		return nil, err
+	}
+	if pi.Status != db.PendingIssuanceStatusPending {
+		return nil, admin.NewError(admin.ErrorBadRequestType, "pending issuance %s cannot be approved, it is %s", id, pi.Status)
+	}
+	prov, err := a.LoadProvisionerByID(pi.ProvisionerID)
+	if err != nil {
+		return nil, admin.NewError(admin.ErrorBadRequestType, "provisioner of pending issuance %s not found", id)
+	}
+
+	// Mark the request as approved, so it's only signed once.
+	now := time.Now().UTC()
+	approved := *pi
+	approved.Status = db.PendingIssuanceStatusApproved
+	approved.DecidedBy = decidedBy
+	approved.DecidedAt = now
+	if err := a.updatePendingIssuance(pdb, &approved, db.PendingIssuanceStatusPending); err != nil {
+		return nil, err
+	}
+
+	chain, err := a.signPendingIssuance(ctx, prov, &approved, now)
+	a.meter.X509Signed(prov, err)
+	if err != nil {
+		if err := pdb.UpdatePendingIssuance(pi, db.PendingIssuanceStatusApproved); err != nil {
+			log.Printf("error restoring pending issuance %s: %v", id, err)
+		}
+		return nil, admin.WrapErrorISE(err, "error signing pending issuance %s", id)
+	}
+
+	issued := approved
+	issued.Status = db.PendingIssuanceStatusIssued
+	for _, crt := range chain {
+		issued.Certificates = append(issued.Certificates, crt.Raw)
+	}
+	// The certificate is already signed, retry the update so it can be
+	// retrieved by the client.
+	for i := 1; ; i++ {
+		err = a.updatePendingIssuance(pdb, &issued, db.PendingIssuanceStatusApproved)
+		if err == nil || i == pendingIssuanceUpdateRetries {
+			break
+		}
+		time.Sleep(time.Duration(i) * 100 * time.Millisecond)
+	}
+	if err != nil {
+		log.Printf("error updating pending issuance %s, certificate with serial number %s has been issued: %v", id, chain[0].SerialNumber, err)
+		return nil, err
+	}
+	return &issued, nil
+}
+
+// pendingIssuanceUpdateRetries is the number of attempts to store the issued
+// certificate of an approved request.
+const pendingIssuanceUpdateRetries = 3
+
+// DenyPendingIssuance denies the signing request with the given id.
+func (a *Authority) DenyPendingIssuance(_ context.Context, id, decidedBy, reason string) (*db.PendingIssuance, error) {
+	pdb, pi, err := a.loadPendingIssuance(id)
+	if err != nil {
+		return nil, err
+	}
+	if pi.Status != db.PendingIssuanceStatusPending {
+		return nil, admin.NewError(admin.ErrorBadRequestType, "pending issuance %s cannot be denied, it is %s", id, pi.Status)
+	}
+
+	denied := *pi
+	denied.Status = db.PendingIssuanceStatusDenied
+	denied.DecidedBy = decidedBy
+	denied.DecidedAt = time.Now().UTC()
+	denied.Reason = reason
+	if err := a.updatePendingIssuance(pdb, &denied, db.PendingIssuanceStatusPending); err != nil {
+		return nil, err
+	}
+	return &denied, nil
+}
+
+func (a *Authority) updatePendingIssuance(pdb db.PendingIssuanceDB, pi *db.PendingIssuance, status db.PendingIssuanceStatus) error {
+	if err := pdb.UpdatePendingIssuance(pi, status); err != nil {
+		if errors.Is(err, db.ErrPendingIssuanceConflict) {
+			return admin.NewError(admin.ErrorConflictType, "pending issuance %s has been modified", pi.ID)
+		}
+		return admin.WrapErrorISE(err, "error updating pending issuance %s", pi.ID)
+	}
+	return nil
+}
+
+// signPendingIssuance signs the certificate of an approved request.
+func (a *Authority) signPendingIssuance(ctx context.Context, prov provisioner.Interface, pi *db.PendingIssuance, now time.Time) ([]*x509.Certificate, error) {
+	csr, err := x509.ParseCertificateRequest(pi.CSR)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing certificate request: %w", err)
+	}
+	leaf, err := unmarshalPendingTemplate(pi.Template, pi.SignatureAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	leaf.NotBefore = now.Add(-pi.Backdate)
+	leaf.NotAfter = now.Add(pi.Lifetime)
+	if !pi.NotAfter.IsZero() {
+		leaf.NotAfter = pi.NotAfter
+	}
+
+	if err := a.lintX509Certificate(leaf); err != nil {
+		return nil, err
+	}
+	if err := a.checkX509ChainLimits(); err != nil {
+		return nil, err
+	}
+
+	quotaDone, err := a.reserveCertificateQuota(prov, leaf)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := a.getX509CAService().CreateCertificate(&casapi.CreateCertificateRequest{
+		Template: leaf,
+		CSR:      csr,
+		Lifetime: pi.Lifetime,
+		Backdate: pi.Backdate,
+		Provisioner: &casapi.ProvisionerInfo{
+			ID:   prov.GetID(),
+			Type: prov.GetType().String(),
+			Name: prov.GetName(),
+		},
+	})
+	if err != nil {
+		quotaDone(nil)
+		return nil, fmt.Errorf("error creating certificate: %w", err)
+	}
+
+	quotaDone(resp.Certificate)
+	chain := append([]*x509.Certificate{resp.Certificate}, resp.CertificateChain...)
+
+	wp := wrapProvisioner(prov, nil)
+	if err := a.storeCertificate(wp, chain); err != nil && !errors.Is(err, db.ErrNotImplemented) {
+		return nil, fmt.Errorf("error storing certificate in db: %w", err)
+	}
+	a.notifyCertificateIssued(ctx, wp, csr, chain)
+
+	return chain, nil
+}
+
+// marshalPendingTemplate encodes the unsigned certificate of a pending
+// issuance. The DER is signed with an ephemeral key only to use the standard
+// encoding, the signature is never used. A missing serial number is encoded as
+// 0.
+func marshalPendingTemplate(leaf *x509.Certificate) ([]byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	tpl := *leaf
+	tpl.SignatureAlgorithm = x509.UnknownSignatureAlgorithm
+	if tpl.SerialNumber == nil {
+		tpl.SerialNumber = big.NewInt(0)
+	}
+	parent := &x509.Certificate{
+		Subject:   tpl.Subject,
+		PublicKey: key.Public(),
+	}
+	return x509.CreateCertificate(rand.Reader, &tpl, parent, leaf.PublicKey, key)
+}
+
+// unmarshalPendingTemplate decodes the unsigned certificate of a pending
+// issuance. All the extensions are kept as extra extensions, so the signed
+// certificate contains the same ones, but the authority key identifier that
+// belongs to the issuer.
+func unmarshalPendingTemplate(der []byte, sigAlg x509.SignatureAlgorithm) (*x509.Certificate, error) {
+	crt, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing certificate template: %w", err)
+	}
+	crt.ExtraExtensions = nil
+	for _, ext := range crt.Extensions {
+		if !ext.Id.Equal(oidAuthorityKeyIdentifier) {
+			crt.ExtraExtensions = append(crt.ExtraExtensions, ext)
+		}
+	}
+	crt.AuthorityKeyId = nil
+	crt.SignatureAlgorithm = sigAlg
+	if crt.SerialNumber.Sign() == 0 {
+		crt.SerialNumber = nil
+	}
+	crt.Raw, crt.RawTBSCertificate, crt.Signature = nil, nil, nil
+	return crt, nil
+}
+
+// certificateSANs returns the subject alternative names of a certificate.
+func certificateSANs(crt *x509.Certificate) []string {
+	sans := make([]string, 0, len(crt.DNSNames)+len(crt.EmailAddresses)+len(crt.IPAddresses)+len(crt.URIs))
+	sans = append(sans, crt.DNSNames...)
+	sans = append(sans, crt.EmailAddresses...)
+	for _, ip := range crt.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	for _, u := range crt.URIs {
+		sans = append(sans, u.String())
+	}
+	return sans
+}
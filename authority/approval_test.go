@@ -0,0 +1,281 @@
+package authority
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/x509util"
+
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+)
+
+func Test_marshalPendingTemplate(t *testing.T) {
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	leaf := &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "foo.example.com", Organization: []string{"Smallstep"}},
+		DNSNames:       []string{"foo.example.com"},
+		IPAddresses:    []net.IP{net.ParseIP("10.1.2.3").To4()},
+		KeyUsage:       x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		AuthorityKeyId: []byte("authority"),
+		PublicKey:      signer.Public(),
+		ExtraExtensions: []pkix.Extension{
+			{Id: asn1.ObjectIdentifier{1, 2, 3, 4}, Value: []byte{0x05, 0x00}},
+		},
+	}
+
+	der, err := marshalPendingTemplate(leaf)
+	require.NoError(t, err)
+	tpl, err := unmarshalPendingTemplate(der, x509.SHA256WithRSA)
+	require.NoError(t, err)
+	assert.Nil(t, tpl.SerialNumber)
+	assert.Nil(t, tpl.AuthorityKeyId)
+	assert.Equal(t, x509.SHA256WithRSA, tpl.SignatureAlgorithm)
+	assert.Equal(t, leaf.Subject.String(), tpl.Subject.String())
+	assert.Equal(t, leaf.DNSNames, tpl.DNSNames)
+	assert.Equal(t, leaf.IPAddresses, tpl.IPAddresses)
+	assert.Equal(t, leaf.KeyUsage, tpl.KeyUsage)
+	assert.Equal(t, leaf.ExtKeyUsage, tpl.ExtKeyUsage)
+	assert.Equal(t, leaf.PublicKey, tpl.PublicKey)
+	assert.Contains(t, tpl.ExtraExtensions, leaf.ExtraExtensions[0])
+	for _, ext := range tpl.ExtraExtensions {
+		assert.False(t, ext.Id.Equal(oidAuthorityKeyIdentifier))
+	}
+
+	_, err = unmarshalPendingTemplate([]byte("foo"), 0)
+	assert.Error(t, err)
+}
+
+func TestAuthority_PendingIssuances(t *testing.T) {
+	authDB, err := db.New(&db.Config{Type: "badgerv2", DataSource: t.TempDir()})
+	require.NoError(t, err)
+	t.Cleanup(func() { authDB.Shutdown() })
+
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	require.NoError(t, err)
+	pub := jwk.Public()
+
+	a := testAuthority(t, WithDatabase(authDB))
+	p := &provisioner.JWK{ID: "jwk-approval", Name: "approval", Type: "JWK", Key: &pub, Options: &provisioner.Options{
+		Approval: &provisioner.ApprovalOptions{Required: true},
+	}}
+	require.NoError(t, a.provisioners.Store(p))
+
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	sign := func(t *testing.T, name string) *PendingIssuanceError {
+		t.Helper()
+		csr, err := x509util.CreateCertificateRequest(name, []string{name}, signer)
+		require.NoError(t, err)
+		_, err = a.SignWithContext(context.Background(), csr, provisioner.SignOptions{}, p,
+			provisioner.CertificateModifierFunc(func(crt *x509.Certificate, opts provisioner.SignOptions) error {
+				crt.NotBefore = time.Now().Add(-opts.Backdate)
+				crt.NotAfter = time.Now().Add(time.Hour)
+				return nil
+			}),
+		)
+		var pe *PendingIssuanceError
+		require.ErrorAs(t, err, &pe)
+		assert.Equal(t, http.StatusAccepted, pe.StatusCode())
+		return pe
+	}
+	assertStatusCode := func(t *testing.T, err error, statusCode int) {
+		t.Helper()
+		var sc render.StatusCodedError
+		require.ErrorAs(t, err, &sc)
+		assert.Equal(t, statusCode, sc.StatusCode())
+	}
+
+	ctx := context.Background()
+	pe1 := sign(t, "foo.example.com")
+	pe2 := sign(t, "bar.example.com")
+	assert.WithinDuration(t, time.Now().Add(24*time.Hour), pe1.ExpiresAt, time.Minute)
+
+	pis, err := a.GetPendingIssuances(ctx)
+	require.NoError(t, err)
+	require.Len(t, pis, 2)
+	assert.Equal(t, pe1.ID, pis[0].ID)
+	assert.Equal(t, db.PendingIssuanceStatusPending, pis[0].Status)
+	assert.Equal(t, "approval", pis[0].ProvisionerName)
+	assert.Equal(t, "foo.example.com", pis[0].CommonName)
+	assert.Equal(t, []string{"foo.example.com"}, pis[0].SANs)
+	assert.Equal(t, time.Hour, pis[0].Lifetime.Round(time.Minute))
+
+	// Approved requests are signed with the requested lifetime.
+	pi, err := a.ApprovePendingIssuance(ctx, pe1.ID, "admin@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, db.PendingIssuanceStatusIssued, pi.Status)
+	assert.Equal(t, "admin@example.com", pi.DecidedBy)
+	require.Len(t, pi.Certificates, 2)
+	crt, err := x509.ParseCertificate(pi.Certificates[0])
+	require.NoError(t, err)
+	assert.Equal(t, "foo.example.com", crt.Subject.CommonName)
+	assert.Equal(t, []string{"foo.example.com"}, crt.DNSNames)
+	assert.Equal(t, signer.Public(), crt.PublicKey)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), crt.NotAfter, time.Minute)
+	intermediate, err := x509.ParseCertificate(pi.Certificates[1])
+	require.NoError(t, err)
+	require.NoError(t, crt.CheckSignatureFrom(intermediate))
+	assert.Equal(t, intermediate.SubjectKeyId, crt.AuthorityKeyId)
+
+	got, err := a.GetPendingIssuance(ctx, pe1.ID)
+	require.NoError(t, err)
+	assert.Equal(t, pi, got)
+	_, err = a.ApprovePendingIssuance(ctx, pe1.ID, "admin@example.com")
+	assertStatusCode(t, err, http.StatusBadRequest)
+
+	// Denied requests cannot be approved.
+	pi, err = a.DenyPendingIssuance(ctx, pe2.ID, "admin@example.com", "not allowed")
+	require.NoError(t, err)
+	assert.Equal(t, db.PendingIssuanceStatusDenied, pi.Status)
+	assert.Equal(t, "not allowed", pi.Reason)
+	assert.Empty(t, pi.Certificates)
+	_, err = a.ApprovePendingIssuance(ctx, pe2.ID, "admin@example.com")
+	assertStatusCode(t, err, http.StatusBadRequest)
+	_, err = a.DenyPendingIssuance(ctx, pe2.ID, "admin@example.com", "")
+	assertStatusCode(t, err, http.StatusBadRequest)
+
+	// Expired requests cannot be approved.
+	pdb := authDB.(db.PendingIssuanceDB)
+	require.NoError(t, pdb.StorePendingIssuance(&db.PendingIssuance{
+		ID:            "expired",
+		Status:        db.PendingIssuanceStatusPending,
+		ProvisionerID: p.GetID(),
+		CreatedAt:     time.Now().Add(-2 * time.Hour),
+		ExpiresAt:     time.Now().Add(-time.Hour),
+	}))
+	got, err = a.GetPendingIssuance(ctx, "expired")
+	require.NoError(t, err)
+	assert.Equal(t, db.PendingIssuanceStatusExpired, got.Status)
+	_, err = a.ApprovePendingIssuance(ctx, "expired", "admin@example.com")
+	assertStatusCode(t, err, http.StatusBadRequest)
+
+	_, err = a.GetPendingIssuance(ctx, "missing")
+	assertStatusCode(t, err, http.StatusNotFound)
+	_, err = a.ApprovePendingIssuance(ctx, "missing", "admin@example.com")
+	assertStatusCode(t, err, http.StatusNotFound)
+}
+
+// flakyPendingIssuanceDB fails the given number of updates to the issued
+// status.
+type flakyPendingIssuanceDB struct {
+	*db.DB
+	failures int
+}
+
+func (f *flakyPendingIssuanceDB) UpdatePendingIssuance(pi *db.PendingIssuance, status db.PendingIssuanceStatus) error {
+	if pi.Status == db.PendingIssuanceStatusIssued && f.failures > 0 {
+		f.failures--
+		return errors.New("force")
+	}
+	return f.DB.UpdatePendingIssuance(pi, status)
+}
+
+func TestAuthority_ApprovePendingIssuance(t *testing.T) {
+	authDB, err := db.New(&db.Config{Type: "badgerv2", DataSource: t.TempDir()})
+	require.NoError(t, err)
+	t.Cleanup(func() { authDB.Shutdown() })
+	flakyDB := &flakyPendingIssuanceDB{DB: authDB.(*db.DB)}
+
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	require.NoError(t, err)
+	pub := jwk.Public()
+
+	a := testAuthority(t, WithDatabase(flakyDB))
+	p := &provisioner.JWK{ID: "jwk-approval", Name: "approval", Type: "JWK", Key: &pub, Options: &provisioner.Options{
+		Approval: &provisioner.ApprovalOptions{Required: true},
+	}}
+	require.NoError(t, a.provisioners.Store(p))
+
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	sign := func(t *testing.T, ctx context.Context, notAfter time.Time) *PendingIssuanceError {
+		t.Helper()
+		csr, err := x509util.CreateCertificateRequest("foo.example.com", []string{"foo.example.com"}, signer)
+		require.NoError(t, err)
+		_, err = a.SignWithContext(ctx, csr, provisioner.SignOptions{}, p,
+			provisioner.CertificateModifierFunc(func(crt *x509.Certificate, opts provisioner.SignOptions) error {
+				crt.NotBefore = time.Now()
+				crt.NotAfter = notAfter
+				return nil
+			}),
+		)
+		var pe *PendingIssuanceError
+		require.ErrorAs(t, err, &pe)
+		return pe
+	}
+
+	t.Run("ok identity", func(t *testing.T) {
+		// Identity certificates keep the expiration of their SSH certificate.
+		notAfter := time.Now().Add(30 * time.Minute).Truncate(time.Second)
+		ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignIdentityMethod)
+		pe := sign(t, ctx, notAfter)
+		assert.Equal(t, notAfter, pe.ExpiresAt.Local())
+
+		time.Sleep(time.Second)
+		pi, err := a.ApprovePendingIssuance(context.Background(), pe.ID, "admin@example.com")
+		require.NoError(t, err)
+		crt, err := x509.ParseCertificate(pi.Certificates[0])
+		require.NoError(t, err)
+		assert.Equal(t, notAfter.UTC(), crt.NotAfter)
+	})
+
+	t.Run("ok retry", func(t *testing.T) {
+		pe := sign(t, context.Background(), time.Now().Add(time.Hour))
+		flakyDB.failures = pendingIssuanceUpdateRetries - 1
+		pi, err := a.ApprovePendingIssuance(context.Background(), pe.ID, "admin@example.com")
+		require.NoError(t, err)
+		assert.Equal(t, db.PendingIssuanceStatusIssued, pi.Status)
+		got, err := a.GetPendingIssuance(context.Background(), pe.ID)
+		require.NoError(t, err)
+		assert.Equal(t, db.PendingIssuanceStatusIssued, got.Status)
+		assert.Len(t, got.Certificates, 2)
+	})
+
+	t.Run("fail retry", func(t *testing.T) {
+		pe := sign(t, context.Background(), time.Now().Add(time.Hour))
+		flakyDB.failures = pendingIssuanceUpdateRetries
+		_, err := a.ApprovePendingIssuance(context.Background(), pe.ID, "admin@example.com")
+		assert.Error(t, err)
+	})
+}
+
+func TestAuthority_PendingIssuances_notSupported(t *testing.T) {
+	a := testAuthority(t, WithDatabase(&db.SimpleDB{}))
+	p := &provisioner.JWK{ID: "jwk-approval", Name: "approval", Type: "JWK", Options: &provisioner.Options{
+		Approval: &provisioner.ApprovalOptions{Required: true},
+	}}
+
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	csr, err := x509util.CreateCertificateRequest("foo.example.com", []string{"foo.example.com"}, signer)
+	require.NoError(t, err)
+	_, err = a.SignWithContext(context.Background(), csr, provisioner.SignOptions{}, p)
+	var sc render.StatusCodedError
+	require.ErrorAs(t, err, &sc)
+	assert.Equal(t, http.StatusInternalServerError, sc.StatusCode())
+
+	_, err = a.GetPendingIssuances(context.Background())
+	require.ErrorAs(t, err, &sc)
+	assert.Equal(t, http.StatusNotImplemented, sc.StatusCode())
+
+	// ACME provisioners do not support approvals.
+	_, ok := getApprovalOptions(&provisioner.ACME{Type: "ACME", Name: "acme", Options: p.Options})
+	assert.False(t, ok)
+	_, ok = getApprovalOptions(p)
+	assert.True(t, ok)
+}
@@ -28,6 +28,7 @@ import (
 	"github.com/smallstep/certificates/authority/administrator"
 	"github.com/smallstep/certificates/authority/config"
 	"github.com/smallstep/certificates/authority/internal/constraints"
+	"github.com/smallstep/certificates/authority/lint"
 	"github.com/smallstep/certificates/authority/policy"
 	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/cas"
@@ -49,6 +50,12 @@ type Authority struct {
 	templates     *templates.Templates
 	linkedCAToken string
 	webhookClient *http.Client
+	reloadFunc    ReloadFunc
+
+	// Notifications of the notifying webhooks, the notifier is created on
+	// first use.
+	webhookNotifier     *provisioner.WebhookNotifier
+	webhookNotifierOnce sync.Once
 
 	// X509 CA
 	password              []byte
@@ -58,14 +65,31 @@ type Authority struct {
 	rootX509CertPool      *x509.CertPool
 	federatedX509Certs    []*x509.Certificate
 	intermediateX509Certs []*x509.Certificate
+	alternateX509Chains   [][]*x509.Certificate
 	certificates          *sync.Map
 	x509Enforcers         []provisioner.CertificateEnforcer
-
-	// SCEP CA
+	x509Linters           []lint.Linter
+	keyDenylist           *keyDenylist
+
+	// Intermediate rotation. The x509CAMutex protects the X.509 CA service,
+	// the intermediates and the constraints engine.
+	x509CAMutex           sync.RWMutex
+	rotationMutex         sync.Mutex
+	intermediateRotation  *intermediateRotation
+	previousIntermediates []*previousIntermediate
+	previousCRLs          map[string]*CertificateRevocationListInfo
+
+	// Provisioner rate limiters
+	rateLimiters      map[string]*provisionerRateLimiter
+	rateLimitersMutex sync.Mutex
+
+	// SCEP CA. The scepMutex protects the SCEP authority and its options,
+	// they are replaced when a new intermediate is activated.
 	scepOptions    *scep.Options
 	validateSCEP   bool
 	scepAuthority  *scep.Authority
 	scepKeyManager provisioner.SCEPKeyManager
+	scepMutex      sync.RWMutex
 
 	// SSH CA
 	sshHostPassword         []byte
@@ -82,6 +106,13 @@ type Authority struct {
 	crlStopper chan struct{}
 	crlMutex   sync.Mutex
 
+	// KRL vars
+	krl        []byte
+	krlVersion uint64
+	krlTicker  *time.Ticker
+	krlStopper chan struct{}
+	krlMutex   sync.Mutex
+
 	// If true, do not re-initialize
 	initOnce  bool
 	startTime time.Time
@@ -288,8 +319,9 @@ func (a *Authority) ReloadAdminResources(ctx context.Context) error {
 	case a.requiresSCEP() && a.GetSCEP() != nil:
 		// update the SCEP Authority with the currently active SCEP
 		// provisioner names and revalidate the configuration.
-		a.scepAuthority.UpdateProvisioners(a.getSCEPProvisionerNames())
-		if err := a.scepAuthority.Validate(); err != nil {
+		scepAuthority := a.GetSCEP()
+		scepAuthority.UpdateProvisioners(a.getSCEPProvisionerNames())
+		if err := scepAuthority.Validate(); err != nil {
 			log.Printf("failed validating SCEP authority: %v\n", err)
 		}
 	case !a.requiresSCEP() && a.GetSCEP() != nil:
@@ -426,6 +458,10 @@ func (a *Authority) init() error {
 			if err != nil {
 				return err
 			}
+			// Load the intermediates replaced by an online rotation.
+			if err := a.loadPreviousIntermediates(); err != nil {
+				return err
+			}
 			// If not defined with an option, add intermediates to the list of
 			// certificates used for name constraints validation at issuance
 			// time.
@@ -451,6 +487,18 @@ func (a *Authority) init() error {
 		}
 	}
 
+	// Fail if the configured signature algorithm cannot be used with the
+	// intermediate key.
+	if err := a.validateX509Signer(); err != nil {
+		return err
+	}
+
+	// Fail if the chain issued with the intermediates exceeds the configured
+	// maximum length.
+	if err := a.validateLimits(); err != nil {
+		return err
+	}
+
 	// Read root certificates and store them in the certificates map.
 	if len(a.rootX509Certs) == 0 {
 		a.rootX509Certs = make([]*x509.Certificate, 0, len(a.config.Root))
@@ -488,62 +536,82 @@ func (a *Authority) init() error {
 		a.certificates.Store(hex.EncodeToString(sum[:]), crt)
 	}
 
+	// Read the alternate chains of intermediates, e.g. chains with
+	// intermediates cross-signed by other roots.
+	if len(a.alternateX509Chains) == 0 {
+		a.alternateX509Chains = make([][]*x509.Certificate, 0, len(a.config.AlternateChains))
+		for _, path := range a.config.AlternateChains {
+			crts, err := pemutil.ReadCertificateBundle(path)
+			if err != nil {
+				return err
+			}
+			a.alternateX509Chains = append(a.alternateX509Chains, crts)
+		}
+	}
+	for i, chain := range a.alternateX509Chains {
+		if err := validateAlternateChain(chain); err != nil {
+			return errors.Wrapf(err, "error validating alternate chain %d", i)
+		}
+	}
+
 	// Decrypt and load SSH keys
 	var tmplVars templates.Step
 	if a.config.SSH != nil {
 		if a.config.SSH.HostKey != "" {
-			signer, err := a.keyManager.CreateSigner(&kmsapi.CreateSignerRequest{
-				SigningKey: a.config.SSH.HostKey,
-				Password:   a.sshHostPassword,
-			})
+			a.sshCAHostCertSignKey, err = a.newSSHSigner(a.config.SSH.HostKey, a.sshHostPassword)
 			if err != nil {
 				return err
 			}
-			// If our signer is from sshagentkms, just unwrap it instead of
-			// wrapping it in another layer, and this prevents crypto from
-			// erroring out with: ssh: unsupported key type *agent.Key
-			switch s := signer.(type) {
-			case *sshagentkms.WrappedSSHSigner:
-				a.sshCAHostCertSignKey = s.Signer
-			case crypto.Signer:
-				a.sshCAHostCertSignKey, err = ssh.NewSignerFromSigner(s)
-			default:
-				return errors.Errorf("unsupported signer type %T", signer)
-			}
-			if err != nil {
-				return errors.Wrap(err, "error creating ssh signer")
-			}
 			// Append public key to list of host certs
 			a.sshCAHostCerts = append(a.sshCAHostCerts, a.sshCAHostCertSignKey.PublicKey())
 			a.sshCAHostFederatedCerts = append(a.sshCAHostFederatedCerts, a.sshCAHostCertSignKey.PublicKey())
 		}
 		if a.config.SSH.UserKey != "" {
-			signer, err := a.keyManager.CreateSigner(&kmsapi.CreateSignerRequest{
-				SigningKey: a.config.SSH.UserKey,
-				Password:   a.sshUserPassword,
-			})
+			a.sshCAUserCertSignKey, err = a.newSSHSigner(a.config.SSH.UserKey, a.sshUserPassword)
 			if err != nil {
 				return err
 			}
-			// If our signer is from sshagentkms, just unwrap it instead of
-			// wrapping it in another layer, and this prevents crypto from
-			// erroring out with: ssh: unsupported key type *agent.Key
-			switch s := signer.(type) {
-			case *sshagentkms.WrappedSSHSigner:
-				a.sshCAUserCertSignKey = s.Signer
-			case crypto.Signer:
-				a.sshCAUserCertSignKey, err = ssh.NewSignerFromSigner(s)
-			default:
-				return errors.Errorf("unsupported signer type %T", signer)
-			}
-			if err != nil {
-				return errors.Wrap(err, "error creating ssh signer")
-			}
 			// Append public key to list of user certs
 			a.sshCAUserCerts = append(a.sshCAUserCerts, a.sshCAUserCertSignKey.PublicKey())
 			a.sshCAUserFederatedCerts = append(a.sshCAUserFederatedCerts, a.sshCAUserCertSignKey.PublicKey())
 		}
 
+		// Load the additional signing keys. All of them are trusted, but only
+		// the active one will sign certificates. The public key of the active
+		// signer must be the first one in the lists of certs.
+		for _, key := range a.config.SSH.SigningKeys {
+			switch key.Type {
+			case provisioner.SSHHostCert:
+				signer, err := a.newSSHSigner(key.Key, a.sshHostPassword)
+				if err != nil {
+					return err
+				}
+				if key.Active {
+					a.sshCAHostCertSignKey = signer
+					a.sshCAHostCerts = append([]ssh.PublicKey{signer.PublicKey()}, a.sshCAHostCerts...)
+					a.sshCAHostFederatedCerts = append([]ssh.PublicKey{signer.PublicKey()}, a.sshCAHostFederatedCerts...)
+				} else {
+					a.sshCAHostCerts = append(a.sshCAHostCerts, signer.PublicKey())
+					a.sshCAHostFederatedCerts = append(a.sshCAHostFederatedCerts, signer.PublicKey())
+				}
+			case provisioner.SSHUserCert:
+				signer, err := a.newSSHSigner(key.Key, a.sshUserPassword)
+				if err != nil {
+					return err
+				}
+				if key.Active {
+					a.sshCAUserCertSignKey = signer
+					a.sshCAUserCerts = append([]ssh.PublicKey{signer.PublicKey()}, a.sshCAUserCerts...)
+					a.sshCAUserFederatedCerts = append([]ssh.PublicKey{signer.PublicKey()}, a.sshCAUserFederatedCerts...)
+				} else {
+					a.sshCAUserCerts = append(a.sshCAUserCerts, signer.PublicKey())
+					a.sshCAUserFederatedCerts = append(a.sshCAUserFederatedCerts, signer.PublicKey())
+				}
+			default:
+				return errors.Errorf("unsupported type %s", key.Type)
+			}
+		}
+
 		// Append other public keys and add them to the template variables.
 		for _, key := range a.config.SSH.Keys {
 			publicKey := key.PublicKey()
@@ -706,33 +774,9 @@ func (a *Authority) init() error {
 			// attempt to create the (default) SCEP signer if the intermediate
 			// key is configured.
 			if a.config.IntermediateKey != "" {
-				if options.Signer, err = a.keyManager.CreateSigner(&kmsapi.CreateSignerRequest{
-					SigningKey: a.config.IntermediateKey,
-					Password:   a.password,
-				}); err != nil {
+				if err := a.setSCEPSigner(options, a.config.IntermediateKey); err != nil {
 					return err
 				}
-
-				// TODO(hs): instead of creating the decrypter here, pass the
-				// intermediate key + chain down to the SCEP authority,
-				// and only instantiate it when required there. Is that possible?
-				// Also with entering passwords?
-				// TODO(hs): if moving the logic, try improving the logic for the
-				// decrypter password too? Right now it needs to be entered multiple
-				// times; I've observed it to be three times maximum, every time
-				// the intermediate key is read.
-				_, isRSAKey := options.Signer.Public().(*rsa.PublicKey)
-				if km, ok := a.keyManager.(kmsapi.Decrypter); ok && isRSAKey {
-					if decrypter, err := km.CreateDecrypter(&kmsapi.CreateDecrypterRequest{
-						DecryptionKey: a.config.IntermediateKey,
-						Password:      a.password,
-					}); err == nil {
-						// only pass the decrypter down when it was successfully created,
-						// meaning it's an RSA key, and `CreateDecrypter` did not fail.
-						options.Decrypter = decrypter
-						options.DecrypterCert = options.Intermediates[0]
-					}
-				}
 			}
 
 			a.scepOptions = options
@@ -742,6 +786,13 @@ func (a *Authority) init() error {
 		// can be validated when the CA is started.
 		a.scepOptions.SCEPProvisionerNames = a.getSCEPProvisionerNames()
 
+		// load the certificates staged for a CA rollover
+		if len(a.scepOptions.NextCACertificates) == 0 {
+			if a.scepOptions.NextCACertificates, err = a.loadSCEPNextCACertificates(); err != nil {
+				return err
+			}
+		}
+
 		// create a new SCEP authority
 		scepAuthority, err := scep.New(a, *a.scepOptions)
 		if err != nil {
@@ -772,16 +823,8 @@ func (a *Authority) init() error {
 	// Load X509 constraints engine.
 	//
 	// This is currently only available in CA mode.
-	if size := len(a.intermediateX509Certs); size > 0 {
-		last := a.intermediateX509Certs[size-1]
-		constraintCerts := make([]*x509.Certificate, 0, size+1)
-		constraintCerts = append(constraintCerts, a.intermediateX509Certs...)
-		for _, root := range a.rootX509Certs {
-			if bytes.Equal(last.RawIssuer, root.RawSubject) && bytes.Equal(last.AuthorityKeyId, root.SubjectKeyId) {
-				constraintCerts = append(constraintCerts, root)
-			}
-		}
-		a.constraintsEngine = constraints.New(constraintCerts...)
+	if len(a.intermediateX509Certs) > 0 {
+		a.constraintsEngine = newConstraintsEngine(a.intermediateX509Certs, a.rootX509Certs)
 	}
 
 	// Load x509 and SSH Policy Engines
@@ -789,6 +832,13 @@ func (a *Authority) init() error {
 		return err
 	}
 
+	// Load the fingerprints of the public keys that cannot be certified.
+	if filename := a.config.AuthorityConfig.KeyDenylist; filename != "" {
+		if a.keyDenylist, err = newKeyDenylist(filename); err != nil {
+			return err
+		}
+	}
+
 	// Configure templates, currently only ssh templates are supported.
 	if a.sshCAHostCertSignKey != nil || a.sshCAUserCertSignKey != nil {
 		a.templates = a.config.Templates
@@ -813,6 +863,13 @@ func (a *Authority) init() error {
 		}
 	}
 
+	// Start the KRL generator.
+	if a.config.SSH.GetKRL().IsEnabled() {
+		if err := a.startKRLGenerator(); err != nil {
+			return err
+		}
+	}
+
 	// JWT numeric dates are seconds.
 	a.startTime = time.Now().Truncate(time.Second)
 	// Set flag indicating that initialization has been completed, and should
@@ -822,6 +879,70 @@ func (a *Authority) init() error {
 	return nil
 }
 
+// newSSHSigner creates an ssh.Signer using the given SSH CA key.
+func (a *Authority) newSSHSigner(key string, password []byte) (ssh.Signer, error) {
+	signer, err := a.keyManager.CreateSigner(&kmsapi.CreateSignerRequest{
+		SigningKey: key,
+		Password:   password,
+	})
+	if err != nil {
+		return nil, err
+	}
+	// If our signer is from sshagentkms, just unwrap it instead of
+	// wrapping it in another layer, and this prevents crypto from
+	// erroring out with: ssh: unsupported key type *agent.Key
+	switch s := signer.(type) {
+	case *sshagentkms.WrappedSSHSigner:
+		return s.Signer, nil
+	case crypto.Signer:
+		sshSigner, err := ssh.NewSignerFromSigner(s)
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating ssh signer")
+		}
+		return sshSigner, nil
+	default:
+		return nil, errors.Errorf("unsupported signer type %T", signer)
+	}
+}
+
+// newConstraintsEngine returns the engine used to validate the name
+// constraints of the given intermediates, and the root that signed the last
+// one.
+func newConstraintsEngine(intermediates, roots []*x509.Certificate) *constraints.Engine {
+	last := intermediates[len(intermediates)-1]
+	constraintCerts := make([]*x509.Certificate, 0, len(intermediates)+1)
+	constraintCerts = append(constraintCerts, intermediates...)
+	for _, root := range roots {
+		if bytes.Equal(last.RawIssuer, root.RawSubject) && bytes.Equal(last.AuthorityKeyId, root.SubjectKeyId) {
+			constraintCerts = append(constraintCerts, root)
+		}
+	}
+	return constraints.New(constraintCerts...)
+}
+
+// getX509CAService returns the X.509 CA service. The service is replaced when
+// a new intermediate is activated.
+func (a *Authority) getX509CAService() cas.CertificateAuthorityService {
+	a.x509CAMutex.RLock()
+	defer a.x509CAMutex.RUnlock()
+	return a.x509CAService
+}
+
+// getConstraintsEngine returns the constraints engine of the current
+// intermediate.
+func (a *Authority) getConstraintsEngine() *constraints.Engine {
+	a.x509CAMutex.RLock()
+	defer a.x509CAMutex.RUnlock()
+	return a.constraintsEngine
+}
+
+// getIntermediates returns the current intermediate certificates.
+func (a *Authority) getIntermediates() []*x509.Certificate {
+	a.x509CAMutex.RLock()
+	defer a.x509CAMutex.RUnlock()
+	return a.intermediateX509Certs
+}
+
 // initLogf is used to log initialization information. The output
 // can be disabled by starting the CA with the `--quiet` flag.
 func (a *Authority) initLogf(format string, v ...any) {
@@ -855,6 +976,19 @@ func (a *Authority) GetConfig() *config.Config {
 	return a.config
 }
 
+// ReloadFunc is the function used to reload the configuration of the CA. It
+// returns the changes between the running configuration and the one in the
+// configuration file. If dryRun is true, the configuration is only validated.
+type ReloadFunc func(ctx context.Context, dryRun bool) ([]config.Change, error)
+
+// ReloadConfig reloads the configuration of the CA, see ReloadFunc.
+func (a *Authority) ReloadConfig(ctx context.Context, dryRun bool) ([]config.Change, error) {
+	if a.reloadFunc == nil {
+		return nil, admin.NewError(admin.ErrorNotImplementedType, "configuration reload is not supported by this authority")
+	}
+	return a.reloadFunc(ctx, dryRun)
+}
+
 // GetInfo returns information about the authority.
 func (a *Authority) GetInfo() Info {
 	ai := Info{
@@ -878,11 +1012,21 @@ func (a *Authority) IsAdminAPIEnabled() bool {
 }
 
 // Shutdown safely shuts down any clients, databases, etc. held by the Authority.
+// The connections to the plugins and the key managers of the webhook client
+// certificates are shared by all the authorities in the process, and they are
+// closed with provisioner.ClosePluginConnections and
+// provisioner.CloseWebhookKeyManagers.
 func (a *Authority) Shutdown() error {
 	if a.crlTicker != nil {
 		a.crlTicker.Stop()
 		close(a.crlStopper)
 	}
+	if a.krlTicker != nil {
+		a.krlTicker.Stop()
+		close(a.krlStopper)
+	}
+
+	a.stopWebhookNotifier()
 
 	if err := a.keyManager.Close(); err != nil {
 		log.Printf("error closing the key manager: %v", err)
@@ -896,6 +1040,12 @@ func (a *Authority) CloseForReload() {
 		a.crlTicker.Stop()
 		close(a.crlStopper)
 	}
+	if a.krlTicker != nil {
+		a.krlTicker.Stop()
+		close(a.krlStopper)
+	}
+
+	a.stopWebhookNotifier()
 
 	if err := a.keyManager.Close(); err != nil {
 		log.Printf("error closing the key manager: %v", err)
@@ -943,9 +1093,45 @@ func (a *Authority) getSCEPProvisionerNames() (names []string) {
 
 // GetSCEP returns the configured SCEP Authority
 func (a *Authority) GetSCEP() *scep.Authority {
+	a.scepMutex.RLock()
+	defer a.scepMutex.RUnlock()
 	return a.scepAuthority
 }
 
+// setSCEPSigner sets the default signer and decrypter of the SCEP options
+// using the given intermediate key. The decrypter is only set for RSA keys.
+func (a *Authority) setSCEPSigner(options *scep.Options, keyName string) error {
+	var err error
+	if options.Signer, err = a.keyManager.CreateSigner(&kmsapi.CreateSignerRequest{
+		SigningKey: keyName,
+		Password:   a.password,
+	}); err != nil {
+		return err
+	}
+
+	// TODO(hs): instead of creating the decrypter here, pass the
+	// intermediate key + chain down to the SCEP authority,
+	// and only instantiate it when required there. Is that possible?
+	// Also with entering passwords?
+	// TODO(hs): if moving the logic, try improving the logic for the
+	// decrypter password too? Right now it needs to be entered multiple
+	// times; I've observed it to be three times maximum, every time
+	// the intermediate key is read.
+	_, isRSAKey := options.Signer.Public().(*rsa.PublicKey)
+	if km, ok := a.keyManager.(kmsapi.Decrypter); ok && isRSAKey {
+		if decrypter, err := km.CreateDecrypter(&kmsapi.CreateDecrypterRequest{
+			DecryptionKey: keyName,
+			Password:      a.password,
+		}); err == nil {
+			// only pass the decrypter down when it was successfully created,
+			// meaning it's an RSA key, and `CreateDecrypter` did not fail.
+			options.Decrypter = decrypter
+			options.DecrypterCert = options.Intermediates[0]
+		}
+	}
+	return nil
+}
+
 func (a *Authority) startCRLGenerator() error {
 	if !a.config.CRL.IsEnabled() {
 		return nil
@@ -230,6 +230,9 @@ func TestAuthorityNew_bundles(t *testing.T) {
 	if err := writeCert("bundle1.crt", ca1.Root, ca2.Root); err != nil {
 		t.Fatal(err)
 	}
+	if err := writeCert("cross0.crt", mustCrossSign(t, ca0.Intermediate, ca1), ca1.Root); err != nil {
+		t.Fatal(err)
+	}
 
 	tests := []struct {
 		name    string
@@ -270,6 +273,16 @@ func TestAuthorityNew_bundles(t *testing.T) {
 			DNSNames:         []string{"127.0.0.1"},
 			AuthorityConfig:  &AuthConfig{},
 		}, false},
+		{"ok alternate chains", &config.Config{
+			Address:          "127.0.0.1:443",
+			Root:             []string{filepath.Join(rootPath, "root0.crt")},
+			FederatedRoots:   []string{filepath.Join(rootPath, "root1.crt")},
+			AlternateChains:  []string{filepath.Join(rootPath, "cross0.crt")},
+			IntermediateCert: filepath.Join(rootPath, "int0.crt"),
+			IntermediateKey:  filepath.Join(rootPath, "int0.key"),
+			DNSNames:         []string{"127.0.0.1"},
+			AuthorityConfig:  &AuthConfig{},
+		}, false},
 		{"fail root", &config.Config{
 			Address:          "127.0.0.1:443",
 			Root:             []string{filepath.Join(rootPath, "missing.crt")},
@@ -287,6 +300,24 @@ func TestAuthorityNew_bundles(t *testing.T) {
 			DNSNames:         []string{"127.0.0.1"},
 			AuthorityConfig:  &AuthConfig{},
 		}, true},
+		{"fail alternate chains", &config.Config{
+			Address:          "127.0.0.1:443",
+			Root:             []string{filepath.Join(rootPath, "root0.crt")},
+			AlternateChains:  []string{filepath.Join(rootPath, "missing.crt")},
+			IntermediateCert: filepath.Join(rootPath, "int0.crt"),
+			IntermediateKey:  filepath.Join(rootPath, "int0.key"),
+			DNSNames:         []string{"127.0.0.1"},
+			AuthorityConfig:  &AuthConfig{},
+		}, true},
+		{"fail alternate chains not signed", &config.Config{
+			Address:          "127.0.0.1:443",
+			Root:             []string{filepath.Join(rootPath, "root0.crt")},
+			AlternateChains:  []string{filepath.Join(rootPath, "bundle0.crt")},
+			IntermediateCert: filepath.Join(rootPath, "int0.crt"),
+			IntermediateKey:  filepath.Join(rootPath, "int0.key"),
+			DNSNames:         []string{"127.0.0.1"},
+			AuthorityConfig:  &AuthConfig{},
+		}, true},
 	}
 
 	for _, tt := range tests {
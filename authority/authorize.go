@@ -14,8 +14,11 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/certificates/authority/admin"
+	authPolicy "github.com/smallstep/certificates/authority/policy"
 	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
 	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/certificates/middleware/clientinfo"
 	"go.step.sm/crypto/jose"
 	"go.step.sm/linkedca"
 	"golang.org/x/crypto/ssh"
@@ -43,11 +46,34 @@ func SkipTokenReuseFromContext(ctx context.Context) bool {
 	return m
 }
 
+type skipRateLimitKey struct{}
+
+// newContextWithSkipRateLimit creates a new context from ctx and attaches a
+// value to skip the rate limit of the provisioner. It's used to validate
+// tokens without using the budget of the sign requests.
+func newContextWithSkipRateLimit(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipRateLimitKey{}, true)
+}
+
+// skipRateLimitFromContext returns if the rate limit needs to be ignored.
+func skipRateLimitFromContext(ctx context.Context) bool {
+	m, _ := ctx.Value(skipRateLimitKey{}).(bool)
+	return m
+}
+
 // getProvisionerFromToken extracts a provisioner from the given token without
 // doing any token validation.
-func (a *Authority) getProvisionerFromToken(token string) (provisioner.Interface, *Claims, error) {
+//
+// Opaque tokens do not identify their provisioner, the client must select it
+// using the X-Step-Provisioner header.
+func (a *Authority) getProvisionerFromToken(ctx context.Context, token string) (provisioner.Interface, *Claims, error) {
 	tok, err := jose.ParseSigned(token)
 	if err != nil {
+		if info, ok := clientinfo.FromContext(ctx); ok && info.Provisioner != "" {
+			if p, ok := a.provisioners.LoadByOpaqueToken(info.Provisioner); ok {
+				return p, &Claims{}, nil
+			}
+		}
 		return nil, nil, fmt.Errorf("error parsing token: %w", err)
 	}
 
@@ -72,7 +98,7 @@ func (a *Authority) getProvisionerFromToken(token string) (provisioner.Interface
 // the token. This method enforces the One-Time use policy (tokens can only be
 // used once).
 func (a *Authority) authorizeToken(ctx context.Context, token string) (provisioner.Interface, error) {
-	p, claims, err := a.getProvisionerFromToken(token)
+	p, claims, err := a.getProvisionerFromToken(ctx, token)
 	if err != nil {
 		return nil, errs.UnauthorizedErr(err)
 	}
@@ -97,6 +123,68 @@ func (a *Authority) authorizeToken(ctx context.Context, token string) (provision
 	return p, nil
 }
 
+// TokenValidation contains the information that a sign token authorizes. It's
+// the result of validating a token without signing a certificate.
+// TokenConsumed is true if the token has already been used, and it cannot be
+// used to sign a certificate.
+type TokenValidation struct {
+	Provisioner       provisioner.Interface
+	Summary           *provisioner.SignOptionsSummary
+	ProvisionerPolicy *authPolicy.X509PolicyOptions
+	AuthorityPolicy   *authPolicy.X509PolicyOptions
+	TokenConsumed     bool
+}
+
+// ValidateToken runs the provisioner validations of a sign token and returns
+// the information it authorizes. The token is not stored, so single-use tokens
+// are not consumed and can still be used to sign a certificate. The validation
+// does not count against the rate limit of the provisioner.
+func (a *Authority) ValidateToken(ctx context.Context, token string) (*TokenValidation, error) {
+	ctx = provisioner.NewContextWithMethod(ctx, provisioner.SignMethod)
+	ctx = NewContextWithSkipTokenReuse(ctx)
+	ctx = newContextWithSkipRateLimit(ctx)
+
+	signOpts, err := a.Authorize(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	tv := &TokenValidation{
+		Summary: provisioner.SummarizeSignOptions(signOpts),
+	}
+	for _, op := range signOpts {
+		if p, ok := op.(provisioner.Interface); ok {
+			tv.Provisioner = p
+			break
+		}
+	}
+	if p, ok := tv.Provisioner.(interface {
+		GetOptions() *provisioner.Options
+	}); ok {
+		// The policy in the provisioner options takes precedence over the
+		// names inherited from the provisioner defaults.
+		if x := p.GetOptions().GetPolicy().GetX509Options(); x != nil {
+			tv.ProvisionerPolicy = x
+		} else if o := p.GetOptions().GetX509Options(); o != nil && (o.AllowedNames != nil || o.DeniedNames != nil) {
+			tv.ProvisionerPolicy = &authPolicy.X509PolicyOptions{
+				AllowedNames:       o.AllowedNames,
+				DeniedNames:        o.DeniedNames,
+				AllowWildcardNames: o.AllowWildcardNames,
+			}
+		}
+	}
+	if tv.AuthorityPolicy, err = a.getX509PolicyOptions(ctx); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.ValidateToken")
+	}
+	if tv.Provisioner != nil {
+		if tv.TokenConsumed, err = a.isTokenUsed(token, tv.Provisioner); err != nil {
+			return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.ValidateToken")
+		}
+	}
+
+	return tv, nil
+}
+
 // AuthorizeAdminToken authorize an Admin token.
 func (a *Authority) AuthorizeAdminToken(r *http.Request, token string) (*linkedca.Admin, error) {
 	jwt, err := jose.ParseSigned(token)
@@ -192,11 +280,7 @@ func (a *Authority) AuthorizeAdminToken(r *http.Request, token string) (*linkedc
 // This method currently ignores any error coming from the GetTokenID, but it
 // should specifically ignore the error provisioner.ErrAllowTokenReuse.
 func (a *Authority) UseToken(token string, prov provisioner.Interface) error {
-	if reuseKey, err := prov.GetTokenID(token); err == nil {
-		if reuseKey == "" {
-			sum := sha256.Sum256([]byte(token))
-			reuseKey = strings.ToLower(hex.EncodeToString(sum[:]))
-		}
+	if reuseKey, ok := tokenReuseKey(token, prov); ok {
 		ok, err := a.db.UseToken(reuseKey, token)
 		if err != nil {
 			return errs.Wrap(http.StatusInternalServerError, err, "failed when attempting to store token")
@@ -204,10 +288,42 @@ func (a *Authority) UseToken(token string, prov provisioner.Interface) error {
 		if !ok {
 			return errs.Unauthorized("token already used")
 		}
+		if err := a.storeTOFUInstance(token, reuseKey, prov); err != nil {
+			return errs.Wrap(http.StatusInternalServerError, err, "failed when attempting to store instance")
+		}
 	}
 	return nil
 }
 
+// isTokenUsed returns true if the token has already been stored by UseToken,
+// without storing it. It returns false if the provisioner allows the reuse of
+// the token, or if the database cannot check the used tokens.
+func (a *Authority) isTokenUsed(token string, prov provisioner.Interface) (bool, error) {
+	reuseKey, ok := tokenReuseKey(token, prov)
+	if !ok {
+		return false, nil
+	}
+	if udb, ok := a.db.(db.UsedTokenDB); ok {
+		return udb.IsTokenUsed(reuseKey)
+	}
+	return false, nil
+}
+
+// tokenReuseKey returns the key used to store the token, and false if the
+// provisioner allows the reuse of the token. If we cannot get a token id from
+// the provisioner, the token is hashed.
+func tokenReuseKey(token string, prov provisioner.Interface) (string, bool) {
+	reuseKey, err := prov.GetTokenID(token)
+	if err != nil {
+		return "", false
+	}
+	if reuseKey == "" {
+		sum := sha256.Sum256([]byte(token))
+		reuseKey = strings.ToLower(hex.EncodeToString(sum[:]))
+	}
+	return reuseKey, true
+}
+
 // Authorize grabs the method from the context and authorizes the request by
 // validating the one-time-token.
 func (a *Authority) Authorize(ctx context.Context, token string) ([]provisioner.SignOption, error) {
@@ -251,6 +367,17 @@ func (a *Authority) authorizeSign(ctx context.Context, token string) ([]provisio
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.authorizeSign")
 	}
+	if !skipRateLimitFromContext(ctx) {
+		if err := a.checkRateLimit(p); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkProvisionerState(p); err != nil {
+		return nil, err
+	}
+	if err := checkProvisionerConditions(ctx, p); err != nil {
+		return nil, err
+	}
 	signOpts, err := p.AuthorizeSign(ctx, token)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.authorizeSign")
@@ -258,6 +385,16 @@ func (a *Authority) authorizeSign(ctx context.Context, token string) ([]provisio
 	return signOpts, nil
 }
 
+// checkProvisionerState returns a 403 error if the provisioner is deprecated.
+// Deprecated provisioners can renew, rekey and revoke certificates, but they
+// cannot sign new ones.
+func checkProvisionerState(p provisioner.Interface) error {
+	if po, ok := p.(interface{ GetOptions() *provisioner.Options }); ok && po.GetOptions().IsDeprecated() {
+		return errs.Forbidden("provisioner %q is deprecated and cannot sign new certificates", p.GetName())
+	}
+	return nil
+}
+
 // AuthorizeSign authorizes a signature request by validating and authenticating
 // a token that must be sent w/ the request.
 //
@@ -308,6 +445,9 @@ func (a *Authority) authorizeRenew(ctx context.Context, cert *x509.Certificate)
 			return nil, errs.Unauthorized("authority.authorizeRenew: provisioner not found", opts...)
 		}
 	}
+	if err := a.checkRateLimit(p); err != nil {
+		return nil, errs.ApplyOptions(err, opts...)
+	}
 	if err := p.AuthorizeRenew(ctx, cert); err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.authorizeRenew", opts...)
 	}
@@ -344,6 +484,26 @@ func (a *Authority) authorizeSSHSign(ctx context.Context, token string) ([]provi
 	if err != nil {
 		return nil, errs.Wrap(http.StatusUnauthorized, err, "authority.authorizeSSHSign")
 	}
+	if err := a.checkRateLimit(p); err != nil {
+		return nil, err
+	}
+	if err := checkProvisionerState(p); err != nil {
+		return nil, err
+	}
+	if err := checkProvisionerConditions(ctx, p); err != nil {
+		return nil, err
+	}
+	// SSHPOP delegation tokens are signed by a host certificate that must not
+	// be revoked.
+	if _, ok := p.(*provisioner.SSHPOP); ok {
+		cert, _, err := provisioner.ExtractSSHPOPCert(token)
+		if err != nil {
+			return nil, errs.Wrap(http.StatusUnauthorized, err, "authority.authorizeSSHSign")
+		}
+		if err := a.authorizeSSHCertificate(ctx, cert); err != nil {
+			return nil, err
+		}
+	}
 	signOpts, err := p.AuthorizeSSHSign(ctx, token)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusUnauthorized, err, "authority.authorizeSSHSign")
@@ -358,6 +518,9 @@ func (a *Authority) authorizeSSHRenew(ctx context.Context, token string) (*ssh.C
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.authorizeSSHRenew")
 	}
+	if err := a.checkRateLimit(p); err != nil {
+		return nil, err
+	}
 	cert, err := p.AuthorizeSSHRenew(ctx, token)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.authorizeSSHRenew")
@@ -372,6 +535,9 @@ func (a *Authority) authorizeSSHRekey(ctx context.Context, token string) (*ssh.C
 	if err != nil {
 		return nil, nil, errs.Wrap(http.StatusInternalServerError, err, "authority.authorizeSSHRekey")
 	}
+	if err := a.checkRateLimit(p); err != nil {
+		return nil, nil, err
+	}
 	cert, signOpts, err := p.AuthorizeSSHRekey(ctx, token)
 	if err != nil {
 		return nil, nil, errs.Wrap(http.StatusInternalServerError, err, "authority.authorizeSSHRekey")
@@ -11,6 +11,7 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"reflect"
 	"strconv"
@@ -26,9 +27,11 @@ import (
 
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/policy"
 	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/db"
 	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/certificates/middleware/clientinfo"
 )
 
 var testAudiences = provisioner.Audiences{
@@ -498,6 +501,135 @@ func TestAuthority_authorizeSign(t *testing.T) {
 	}
 }
 
+func Test_checkProvisionerState(t *testing.T) {
+	tests := []struct {
+		name string
+		p    provisioner.Interface
+		code int
+	}{
+		{"ok", &provisioner.JWK{Name: "jwk"}, 0},
+		{"ok active", &provisioner.JWK{Name: "jwk", Options: &provisioner.Options{State: provisioner.StateActive}}, 0},
+		{"ok nil", nil, 0},
+		{"ok sshpop", &provisioner.SSHPOP{Name: "sshpop"}, 0},
+		{"fail deprecated", &provisioner.JWK{Name: "jwk", Options: &provisioner.Options{State: provisioner.StateDeprecated}}, http.StatusForbidden},
+		{"fail deprecated acme", &provisioner.ACME{Name: "acme", Options: &provisioner.Options{State: provisioner.StateDeprecated}}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkProvisionerState(tt.p)
+			if tt.code == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			var sc render.StatusCodedError
+			assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+			assert.Equals(t, tt.code, sc.StatusCode())
+		})
+	}
+}
+
+func Test_checkProvisionerConditions(t *testing.T) {
+	conditions := &provisioner.Options{Conditions: &provisioner.Conditions{
+		SourceCIDRs: []string{"10.0.0.0/8"},
+		UserAgents:  []string{"^step-cli/"},
+	}}
+	allowed := clientinfo.NewContext(context.Background(), &clientinfo.ClientInfo{IP: net.ParseIP("10.1.2.3"), UserAgent: "step-cli/0.26.0"})
+	denied := clientinfo.NewContext(context.Background(), &clientinfo.ClientInfo{IP: net.ParseIP("192.168.1.1"), UserAgent: "step-cli/0.26.0"})
+	tests := []struct {
+		name string
+		ctx  context.Context
+		p    provisioner.Interface
+		code int
+	}{
+		{"ok", allowed, &provisioner.JWK{Name: "jwk", Options: conditions}, 0},
+		{"ok no conditions", context.Background(), &provisioner.JWK{Name: "jwk"}, 0},
+		{"ok sshpop", context.Background(), &provisioner.SSHPOP{Name: "sshpop"}, 0},
+		{"fail ip", denied, &provisioner.JWK{Name: "jwk", Options: conditions}, http.StatusForbidden},
+		{"fail no client info", context.Background(), &provisioner.ACME{Name: "acme", Options: conditions}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkProvisionerConditions(tt.ctx, tt.p)
+			if tt.code == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			var sc render.StatusCodedError
+			assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+			assert.Equals(t, tt.code, sc.StatusCode())
+		})
+	}
+}
+
+func TestAuthority_ValidateToken(t *testing.T) {
+	a := testAuthority(t)
+	a.startTime = time.Now().Add(-time.Hour)
+	a.config.AuthorityConfig.Policy = &policy.Options{
+		X509: &policy.X509PolicyOptions{
+			AllowedNames: &policy.X509NameOptions{DNSDomains: []string{"*.smallstep.com"}},
+		},
+	}
+
+	jwk, err := jose.ReadKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	assert.FatalError(t, err)
+
+	validToken, err := generateToken("test.smallstep.com", "step-cli", testAudiences.Sign[0],
+		[]string{"test.smallstep.com", "127.0.0.1"}, time.Now(), jwk)
+	assert.FatalError(t, err)
+	expiredToken, err := generateToken("test.smallstep.com", "step-cli", testAudiences.Sign[0],
+		[]string{"test.smallstep.com"}, time.Now().Add(-10*time.Minute), jwk)
+	assert.FatalError(t, err)
+
+	type test struct {
+		token string
+		err   error
+		code  int
+	}
+	tests := map[string]test{
+		"fail/invalid-token": {"foo", errors.New("authority.Authorize: authority.authorizeSign: error parsing token"), http.StatusUnauthorized},
+		"fail/expired-token": {expiredToken, errors.New("authority.Authorize: authority.authorizeSign: jwk.AuthorizeSign: jwk.authorizeToken; invalid jwk claims: go-jose/go-jose/jwt: validation failed, token is expired (exp)"), http.StatusUnauthorized},
+		"ok":                 {validToken, nil, 0},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := a.ValidateToken(context.Background(), tc.token)
+			if err != nil {
+				if assert.NotNil(t, tc.err) {
+					var sc render.StatusCodedError
+					assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+					assert.Equals(t, sc.StatusCode(), tc.code)
+					assert.HasPrefix(t, err.Error(), tc.err.Error())
+				}
+				return
+			}
+			if assert.Nil(t, tc.err) {
+				assert.Equals(t, "step-cli", got.Provisioner.GetName())
+				assert.Equals(t, &provisioner.SignOptionsSummary{
+					Subject:         "test.smallstep.com",
+					SANs:            []string{"test.smallstep.com", "127.0.0.1"},
+					MinDuration:     5 * time.Minute,
+					MaxDuration:     24 * time.Hour,
+					DefaultDuration: 24 * time.Hour,
+				}, got.Summary)
+				assert.Nil(t, got.ProvisionerPolicy)
+				assert.Equals(t, a.config.AuthorityConfig.Policy.X509, got.AuthorityPolicy)
+				assert.False(t, got.TokenConsumed)
+
+				// The token has not been consumed
+				ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod)
+				_, err := a.Authorize(ctx, tc.token)
+				assert.FatalError(t, err)
+
+				// The token is reported as consumed once it has been used
+				got, err = a.ValidateToken(context.Background(), tc.token)
+				assert.FatalError(t, err)
+				assert.True(t, got.TokenConsumed)
+			}
+		})
+	}
+}
+
 func TestAuthority_Authorize(t *testing.T) {
 	a := testAuthority(t)
 
@@ -1034,7 +1166,7 @@ func TestAuthority_authorizeSSHSign(t *testing.T) {
 				}
 			} else {
 				if assert.Nil(t, tc.err) {
-					assert.Len(t, 10, got) // number of provisioner.SignOptions returned
+					assert.Len(t, 11, got) // number of provisioner.SignOptions returned
 				}
 			}
 		})
@@ -0,0 +1,35 @@
+package authority
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/certificates/middleware/clientinfo"
+)
+
+// checkProvisionerConditions returns a 403 error if the request in the context
+// does not satisfy the conditions of the provisioner, the allowed client
+// addresses, time windows and user agents.
+func checkProvisionerConditions(ctx context.Context, p provisioner.Interface) error {
+	po, ok := p.(interface{ GetOptions() *provisioner.Options })
+	if !ok {
+		return nil
+	}
+	c := po.GetOptions().GetConditions()
+	if c == nil {
+		return nil
+	}
+
+	var ip net.IP
+	var userAgent string
+	if info, ok := clientinfo.FromContext(ctx); ok {
+		ip, userAgent = info.IP, info.UserAgent
+	}
+	if err := c.Allow(ip, userAgent, time.Now()); err != nil {
+		return errs.ForbiddenErr(err, "provisioner %q does not allow this request: %s", p.GetName(), err)
+	}
+	return nil
+}
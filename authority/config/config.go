@@ -2,17 +2,21 @@ package config
 
 import (
 	"bytes"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"net"
 	"os"
+	"slices"
 	"time"
 
 	"github.com/pkg/errors"
 
 	kms "go.step.sm/crypto/kms/apiv1"
+	"go.step.sm/crypto/x509util"
 	"go.step.sm/linkedca"
 
+	"github.com/smallstep/certificates/authority/lint"
 	"github.com/smallstep/certificates/authority/policy"
 	"github.com/smallstep/certificates/authority/provisioner"
 	cas "github.com/smallstep/certificates/cas/apiv1"
@@ -67,6 +71,8 @@ var (
 type Config struct {
 	Root             multiString          `json:"root"`
 	FederatedRoots   []string             `json:"federatedRoots"`
+	AlternateChains  []string             `json:"alternateChains,omitempty"`
+	PreferredChain   string               `json:"preferredChain,omitempty"`
 	IntermediateCert string               `json:"crt"`
 	IntermediateKey  string               `json:"key"`
 	Address          string               `json:"address"`
@@ -84,10 +90,18 @@ type Config struct {
 	CommonName       string               `json:"commonName,omitempty"`
 	CRL              *CRLConfig           `json:"crl,omitempty"`
 	MetricsAddress   string               `json:"metricsAddress,omitempty"`
+	Tenants          []*TenantConfig      `json:"tenants,omitempty"`
 	SkipValidation   bool                 `json:"-"`
 
+	// PreviousIntermediates are the intermediates replaced by an online
+	// rotation, they are kept until they expire.
+	PreviousIntermediates []*PreviousIntermediate `json:"previousIntermediates,omitempty"`
+
 	// Keeps record of the filename the Config is read from
 	loadedFromFilepath string
+
+	// Path prefix used to serve a tenant, it's added to the audiences.
+	pathPrefix string
 }
 
 // CRLConfig represents config options for CRL generation
@@ -169,6 +183,223 @@ type AuthConfig struct {
 	Backdate             *provisioner.Duration `json:"backdate,omitempty"`
 	EnableAdmin          bool                  `json:"enableAdmin,omitempty"`
 	DisableGetSSHHosts   bool                  `json:"disableGetSSHHosts,omitempty"`
+	Lint                 *LintConfig           `json:"lint,omitempty"`
+	Limits               *LimitsConfig         `json:"limits,omitempty"`
+	IntermediateRotation *RotationConfig       `json:"intermediateRotation,omitempty"`
+	X509Signer           *X509SignerConfig     `json:"x509Signer,omitempty"`
+	KeyDenylist          string                `json:"keyDenylist,omitempty"`
+	ProvisionerDefaults  *ProvisionerDefaults  `json:"provisionerDefaults,omitempty"`
+}
+
+// ProvisionerDefaults contains the claims, options and policies applied to
+// every provisioner that does not define its own.
+type ProvisionerDefaults struct {
+	Claims  *provisioner.Claims  `json:"claims,omitempty"`
+	Options *provisioner.Options `json:"options,omitempty"`
+	Policy  *policy.Options      `json:"policy,omitempty"`
+}
+
+// GetClaims returns the default claims of the provisioners.
+func (d *ProvisionerDefaults) GetClaims() *provisioner.Claims {
+	if d == nil {
+		return nil
+	}
+	return d.Claims
+}
+
+// GetOptions returns the default options of the provisioners, including the
+// default policy.
+func (d *ProvisionerDefaults) GetOptions() *provisioner.Options {
+	if d == nil || (d.Options == nil && d.Policy == nil) {
+		return nil
+	}
+	var o provisioner.Options
+	if d.Options != nil {
+		o = *d.Options
+	}
+	if x509Policy := d.Policy.GetX509Options(); x509Policy != nil {
+		var x509Options provisioner.X509Options
+		if o.X509 != nil {
+			x509Options = *o.X509
+		}
+		x509Options.AllowedNames = x509Policy.AllowedNames
+		x509Options.DeniedNames = x509Policy.DeniedNames
+		x509Options.AllowWildcardNames = x509Policy.AllowWildcardNames
+		o.X509 = &x509Options
+	}
+	if sshPolicy := d.Policy.GetSSHOptions(); sshPolicy != nil {
+		var sshOptions provisioner.SSHOptions
+		if o.SSH != nil {
+			sshOptions = *o.SSH
+		}
+		sshOptions.User = sshPolicy.User
+		sshOptions.Host = sshPolicy.Host
+		o.SSH = &sshOptions
+	}
+	return &o
+}
+
+// LintConfig contains the configuration of the lints run on the issued X.509
+// certificates. By default, a certificate that fails any of the lints is not
+// returned.
+type LintConfig struct {
+	WarnOnly    bool                  `json:"warnOnly,omitempty"`
+	MaxValidity *provisioner.Duration `json:"maxValidity,omitempty"`
+	Skip        []string              `json:"skip,omitempty"`
+}
+
+// Options returns the options used to create the built-in lints.
+func (c *LintConfig) Options() *lint.Options {
+	o := &lint.Options{
+		Skip: c.Skip,
+	}
+	if c.MaxValidity != nil {
+		o.MaxValidity = c.MaxValidity.Duration
+	}
+	return o
+}
+
+// Validate validates the lint configuration.
+func (c *LintConfig) Validate() error {
+	if c.MaxValidity != nil && c.MaxValidity.Duration < 0 {
+		return errors.New("authority.lint.maxValidity cannot be less than 0")
+	}
+	for _, name := range c.Skip {
+		switch name {
+		case lint.SANTypes, lint.CommonNameOnly, lint.Validity, lint.ExtKeyUsage:
+		default:
+			return errors.Errorf("authority.lint.skip contains an unknown lint %q", name)
+		}
+	}
+	return nil
+}
+
+// LimitsConfig contains the limits enforced on every certificate issued by
+// the authority, regardless of the provisioner used. A zero value disables a
+// limit.
+type LimitsConfig struct {
+	// MaxSANs is the maximum number of SANs in X.509 certificates, including
+	// the ones only available in the SAN extension, and of principals in SSH
+	// certificates.
+	MaxSANs int `json:"maxSANs,omitempty"`
+	// MaxSubjectLength is the maximum length of the subject of X.509
+	// certificates, in its RFC 2253 string form.
+	MaxSubjectLength int `json:"maxSubjectLength,omitempty"`
+	// MaxValidity is the maximum validity of X.509 and SSH certificates, even
+	// if the provisioner claims allow a longer one.
+	MaxValidity *provisioner.Duration `json:"maxValidity,omitempty"`
+	// MaxChainLength is the maximum number of certificates in the issued
+	// X.509 chain, including the leaf. It is checked with the intermediates
+	// of the authority on initialization and before signing.
+	MaxChainLength int `json:"maxChainLength,omitempty"`
+}
+
+// Validate validates the limits configuration.
+func (c *LimitsConfig) Validate() error {
+	switch {
+	case c.MaxSANs < 0:
+		return errors.New("authority.limits.maxSANs cannot be less than 0")
+	case c.MaxSubjectLength < 0:
+		return errors.New("authority.limits.maxSubjectLength cannot be less than 0")
+	case c.MaxValidity != nil && c.MaxValidity.Duration < 0:
+		return errors.New("authority.limits.maxValidity cannot be less than 0")
+	case c.MaxChainLength < 0:
+		return errors.New("authority.limits.maxChainLength cannot be less than 0")
+	default:
+		return nil
+	}
+}
+
+// X509SignerConfig contains the options used by the authority to sign X.509
+// certificates. The signature algorithms must be compatible with the key of
+// the intermediate, e.g. "SHA256-RSAPSS" requires an RSA key and "Ed25519"
+// an Ed25519 key.
+type X509SignerConfig struct {
+	// SignatureAlgorithm is the algorithm used to sign the certificates if
+	// the template does not set one. It defaults to the algorithm used to
+	// sign the intermediate, or the default one of the intermediate key.
+	SignatureAlgorithm x509util.SignatureAlgorithm `json:"signatureAlgorithm,omitempty"`
+	// AllowedSignatureAlgorithms is the list of algorithms that can be set in
+	// the certificate templates. All the supported ones are allowed if empty.
+	AllowedSignatureAlgorithms []x509util.SignatureAlgorithm `json:"allowedSignatureAlgorithms,omitempty"`
+	// AllowedKeyTypes is the list of allowed key types of the issued
+	// certificates, "EC", "RSA" or "OKP". All key types are allowed if empty.
+	AllowedKeyTypes []string `json:"allowedKeyTypes,omitempty"`
+}
+
+// Validate validates the X.509 signer configuration.
+func (c *X509SignerConfig) Validate() error {
+	if c.SignatureAlgorithm != 0 && !isSupportedSignatureAlgorithm(x509.SignatureAlgorithm(c.SignatureAlgorithm)) {
+		return errors.Errorf("authority.x509Signer.signatureAlgorithm %s is not supported", x509.SignatureAlgorithm(c.SignatureAlgorithm))
+	}
+	for _, alg := range c.AllowedSignatureAlgorithms {
+		if !isSupportedSignatureAlgorithm(x509.SignatureAlgorithm(alg)) {
+			return errors.Errorf("authority.x509Signer.allowedSignatureAlgorithms %s is not supported", x509.SignatureAlgorithm(alg))
+		}
+	}
+	if c.SignatureAlgorithm != 0 && len(c.AllowedSignatureAlgorithms) > 0 && !slices.Contains(c.AllowedSignatureAlgorithms, c.SignatureAlgorithm) {
+		return errors.Errorf("authority.x509Signer.signatureAlgorithm %s is not in the allowed signature algorithms", x509.SignatureAlgorithm(c.SignatureAlgorithm))
+	}
+	for _, kty := range c.AllowedKeyTypes {
+		switch kty {
+		case "EC", "RSA", "OKP":
+		default:
+			return errors.Errorf("authority.x509Signer.allowedKeyTypes %q is not supported", kty)
+		}
+	}
+	return nil
+}
+
+// isSupportedSignatureAlgorithm returns true if the authority can sign
+// certificates with the given algorithm. The algorithms based on MD5, SHA1 or
+// DSA are not supported.
+func isSupportedSignatureAlgorithm(alg x509.SignatureAlgorithm) bool {
+	switch alg {
+	case x509.SHA256WithRSA, x509.SHA384WithRSA, x509.SHA512WithRSA,
+		x509.SHA256WithRSAPSS, x509.SHA384WithRSAPSS, x509.SHA512WithRSAPSS,
+		x509.ECDSAWithSHA256, x509.ECDSAWithSHA384, x509.ECDSAWithSHA512,
+		x509.PureEd25519:
+		return true
+	default:
+		return false
+	}
+}
+
+// PreviousIntermediate is an intermediate replaced by an online rotation. The
+// key is used to sign the CRL of the certificates issued by it.
+type PreviousIntermediate struct {
+	Cert string `json:"crt"`
+	Key  string `json:"key"`
+}
+
+// DefaultIntermediateValidity is the validity of the intermediates signed by
+// the root key configured in the RotationConfig.
+var DefaultIntermediateValidity = 10 * 365 * 24 * time.Hour
+
+// RotationConfig contains the configuration used to rotate the intermediate
+// certificate online. If a root key is configured the authority can sign the
+// new intermediate, otherwise the certificate request must be signed by the
+// root out-of-band.
+type RotationConfig struct {
+	RootKey         string                `json:"rootKey,omitempty"`
+	RootKeyPassword string                `json:"rootKeyPassword,omitempty"`
+	Validity        *provisioner.Duration `json:"validity,omitempty"`
+}
+
+// GetValidity returns the validity of the intermediates signed by the root key.
+func (c *RotationConfig) GetValidity() time.Duration {
+	if c == nil || c.Validity == nil || c.Validity.Duration == 0 {
+		return DefaultIntermediateValidity
+	}
+	return c.Validity.Duration
+}
+
+// Validate validates the intermediate rotation configuration.
+func (c *RotationConfig) Validate() error {
+	if c.Validity != nil && c.Validity.Duration < 0 {
+		return errors.New("authority.intermediateRotation.validity cannot be less than 0")
+	}
+	return nil
 }
 
 // init initializes the required fields in the AuthConfig if they are not
@@ -211,6 +442,36 @@ func (c *AuthConfig) Validate(provisioner.Audiences) error {
 		return errors.New("authority.backdate cannot be less than 0")
 	}
 
+	if c.Lint != nil {
+		if err := c.Lint.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.Limits != nil {
+		if err := c.Limits.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.IntermediateRotation != nil {
+		if err := c.IntermediateRotation.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.X509Signer != nil {
+		if err := c.X509Signer.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.ProvisionerDefaults.GetClaims() != nil {
+		if _, err := provisioner.NewClaimer(c.ProvisionerDefaults.Claims, GlobalProvisionerClaims); err != nil {
+			return errors.Wrap(err, "authority.provisionerDefaults.claims are not valid")
+		}
+	}
+
 	return nil
 }
 
@@ -377,6 +638,11 @@ func (c *Config) Validate() error {
 		return err
 	}
 
+	// Validate tenants: nil is ok
+	if err := validateTenants(c.Tenants); err != nil {
+		return err
+	}
+
 	return c.AuthorityConfig.Validate(c.GetAudiences())
 }
 
@@ -392,8 +658,7 @@ func (c *Config) GetAudiences() provisioner.Audiences {
 		SSHRenew:  []string{},
 	}
 
-	for _, name := range c.DNSNames {
-		hostname := toHostname(name)
+	for _, hostname := range c.audienceHostnames() {
 		audiences.Sign = append(audiences.Sign,
 			fmt.Sprintf("https://%s/1.0/sign", hostname),
 			fmt.Sprintf("https://%s/sign", hostname),
@@ -426,16 +691,31 @@ func (c *Config) GetAudiences() provisioner.Audiences {
 
 // Audience returns the list of audiences for a given path.
 func (c *Config) Audience(path string) []string {
-	audiences := make([]string, len(c.DNSNames)+1)
-	for i, name := range c.DNSNames {
-		hostname := toHostname(name)
+	hostnames := c.audienceHostnames()
+	audiences := make([]string, len(hostnames)+1)
+	for i, hostname := range hostnames {
 		audiences[i] = "https://" + hostname + path
 	}
 	// For backward compatibility
-	audiences[len(c.DNSNames)] = path
+	audiences[len(hostnames)] = path
 	return audiences
 }
 
+// audienceHostnames returns the hostnames used in the audiences. Tenants served
+// with a path prefix also accept the hostnames followed by the prefix.
+func (c *Config) audienceHostnames() []string {
+	hostnames := make([]string, 0, len(c.DNSNames))
+	for _, name := range c.DNSNames {
+		hostnames = append(hostnames, toHostname(name))
+	}
+	if c.pathPrefix != "" {
+		for _, name := range c.DNSNames {
+			hostnames = append(hostnames, toHostname(name)+c.pathPrefix)
+		}
+	}
+	return hostnames
+}
+
 func toHostname(name string) string {
 	// ensure an IPv6 address is represented with square brackets when used as hostname
 	if ip := net.ParseIP(name); ip != nil && ip.To4() == nil {
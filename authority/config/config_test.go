@@ -1,15 +1,18 @@
 package config
 
 import (
+	"crypto/x509"
 	"fmt"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/authority/provisioner"
 	_ "github.com/smallstep/certificates/cas"
 	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/x509util"
 )
 
 func TestConfigValidate(t *testing.T) {
@@ -287,6 +290,163 @@ func TestAuthConfigValidate(t *testing.T) {
 				asn1dn: asn1dn,
 			}
 		},
+		"ok-lint": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Provisioners: p,
+					Lint: &LintConfig{
+						MaxValidity: &provisioner.Duration{Duration: 24 * time.Hour},
+						Skip:        []string{"cn_only", "ext_key_usage"},
+					},
+				},
+				asn1dn: ASN1DN{},
+			}
+		},
+		"fail-lint-max-validity": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Provisioners: p,
+					Lint: &LintConfig{
+						MaxValidity: &provisioner.Duration{Duration: -time.Hour},
+					},
+				},
+				err: errors.New("authority.lint.maxValidity cannot be less than 0"),
+			}
+		},
+		"ok-limits": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Provisioners: p,
+					Limits: &LimitsConfig{
+						MaxSANs:          100,
+						MaxSubjectLength: 1024,
+						MaxValidity:      &provisioner.Duration{Duration: 90 * 24 * time.Hour},
+						MaxChainLength:   3,
+					},
+				},
+				asn1dn: ASN1DN{},
+			}
+		},
+		"fail-limits-max-sans": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Provisioners: p,
+					Limits:       &LimitsConfig{MaxSANs: -1},
+				},
+				err: errors.New("authority.limits.maxSANs cannot be less than 0"),
+			}
+		},
+		"fail-limits-max-subject-length": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Provisioners: p,
+					Limits:       &LimitsConfig{MaxSubjectLength: -1},
+				},
+				err: errors.New("authority.limits.maxSubjectLength cannot be less than 0"),
+			}
+		},
+		"fail-limits-max-validity": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Provisioners: p,
+					Limits:       &LimitsConfig{MaxValidity: &provisioner.Duration{Duration: -time.Hour}},
+				},
+				err: errors.New("authority.limits.maxValidity cannot be less than 0"),
+			}
+		},
+		"fail-limits-max-chain-length": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Provisioners: p,
+					Limits:       &LimitsConfig{MaxChainLength: -1},
+				},
+				err: errors.New("authority.limits.maxChainLength cannot be less than 0"),
+			}
+		},
+		"ok-intermediate-rotation": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Provisioners: p,
+					IntermediateRotation: &RotationConfig{
+						RootKey:  "root_ca_key",
+						Validity: &provisioner.Duration{Duration: 5 * 365 * 24 * time.Hour},
+					},
+				},
+				asn1dn: ASN1DN{},
+			}
+		},
+		"fail-intermediate-rotation-validity": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Provisioners:         p,
+					IntermediateRotation: &RotationConfig{Validity: &provisioner.Duration{Duration: -time.Hour}},
+				},
+				err: errors.New("authority.intermediateRotation.validity cannot be less than 0"),
+			}
+		},
+		"ok-x509-signer": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Provisioners: p,
+					X509Signer: &X509SignerConfig{
+						SignatureAlgorithm:         x509util.SignatureAlgorithm(x509.SHA256WithRSAPSS),
+						AllowedSignatureAlgorithms: []x509util.SignatureAlgorithm{x509util.SignatureAlgorithm(x509.SHA256WithRSAPSS), x509util.SignatureAlgorithm(x509.SHA384WithRSAPSS)},
+						AllowedKeyTypes:            []string{"EC", "OKP"},
+					},
+				},
+				asn1dn: ASN1DN{},
+			}
+		},
+		"fail-x509-signer-signature-algorithm": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Provisioners: p,
+					X509Signer:   &X509SignerConfig{SignatureAlgorithm: x509util.SignatureAlgorithm(x509.SHA1WithRSA)},
+				},
+				err: errors.New("authority.x509Signer.signatureAlgorithm SHA1-RSA is not supported"),
+			}
+		},
+		"fail-x509-signer-allowed-signature-algorithms": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Provisioners: p,
+					X509Signer:   &X509SignerConfig{AllowedSignatureAlgorithms: []x509util.SignatureAlgorithm{x509util.SignatureAlgorithm(x509.DSAWithSHA256)}},
+				},
+				err: errors.New("authority.x509Signer.allowedSignatureAlgorithms DSA-SHA256 is not supported"),
+			}
+		},
+		"fail-x509-signer-signature-algorithm-not-allowed": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Provisioners: p,
+					X509Signer: &X509SignerConfig{
+						SignatureAlgorithm:         x509util.SignatureAlgorithm(x509.SHA256WithRSAPSS),
+						AllowedSignatureAlgorithms: []x509util.SignatureAlgorithm{x509util.SignatureAlgorithm(x509.PureEd25519)},
+					},
+				},
+				err: errors.New("authority.x509Signer.signatureAlgorithm SHA256-RSAPSS is not in the allowed signature algorithms"),
+			}
+		},
+		"fail-x509-signer-allowed-key-types": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Provisioners: p,
+					X509Signer:   &X509SignerConfig{AllowedKeyTypes: []string{"DSA"}},
+				},
+				err: errors.New(`authority.x509Signer.allowedKeyTypes "DSA" is not supported`),
+			}
+		},
+		"fail-lint-skip": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Provisioners: p,
+					Lint: &LintConfig{
+						Skip: []string{"foo"},
+					},
+				},
+				err: errors.New(`authority.lint.skip contains an unknown lint "foo"`),
+			}
+		},
 	}
 
 	for name, get := range tests {
@@ -334,10 +494,11 @@ func TestConfig_Audience(t *testing.T) {
 		path string
 	}
 	tests := []struct {
-		name   string
-		fields fields
-		args   args
-		want   []string
+		name       string
+		fields     fields
+		args       args
+		want       []string
+		pathPrefix string
 	}{
 		{"ok", fields{[]string{
 			"ca", "ca.example.com", "127.0.0.1", "::1",
@@ -347,12 +508,22 @@ func TestConfig_Audience(t *testing.T) {
 			"https://127.0.0.1/path",
 			"https://[::1]/path",
 			"/path",
-		}},
+		}, ""},
+		{"ok prefix", fields{[]string{
+			"ca.example.com", "::1",
+		}}, args{"/path"}, []string{
+			"https://ca.example.com/path",
+			"https://[::1]/path",
+			"https://ca.example.com/tenant/path",
+			"https://[::1]/tenant/path",
+			"/path",
+		}, "/tenant"},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			c := &Config{
-				DNSNames: tt.fields.DNSNames,
+				DNSNames:   tt.fields.DNSNames,
+				pathPrefix: tt.pathPrefix,
 			}
 			if got := c.Audience(tt.args.path); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("Config.Audience() = %v, want %v", got, tt.want)
@@ -0,0 +1,144 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// ChangeType is the type of a change between two configurations.
+type ChangeType string
+
+const (
+	// ChangeAdded is the type of the fields only present in the new
+	// configuration.
+	ChangeAdded ChangeType = "added"
+	// ChangeRemoved is the type of the fields only present in the old
+	// configuration.
+	ChangeRemoved ChangeType = "removed"
+	// ChangeModified is the type of the fields with different values.
+	ChangeModified ChangeType = "modified"
+)
+
+// Change is a difference between two configurations. The path uses the JSON
+// names of the fields, e.g. "tls" or "authority.policy", and the provisioners
+// are identified by name, e.g. "authority.provisioners.my-jwk". The values are
+// not included as they might contain secrets.
+type Change struct {
+	Path string     `json:"path"`
+	Type ChangeType `json:"type"`
+}
+
+// String implements the fmt.Stringer interface.
+func (c Change) String() string {
+	return fmt.Sprintf("%s %s", c.Path, c.Type)
+}
+
+// Diff returns the changes between the old and the new configuration. The
+// changes are sorted by path, except the provisioners, which keep the order
+// of the new configuration followed by the removed ones.
+func Diff(old, new *Config) ([]Change, error) {
+	o, err := toJSONMap(old)
+	if err != nil {
+		return nil, err
+	}
+	n, err := toJSONMap(new)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []Change
+	for _, key := range mergeKeys(o, n) {
+		if key != "authority" {
+			changes = appendChange(changes, key, o[key], n[key])
+			continue
+		}
+		oa, _ := o[key].(map[string]any)
+		na, _ := n[key].(map[string]any)
+		if oa == nil || na == nil {
+			changes = appendChange(changes, key, o[key], n[key])
+			continue
+		}
+		for _, k := range mergeKeys(oa, na) {
+			if k == "provisioners" {
+				changes = appendProvisionerChanges(changes, oa[k], na[k])
+			} else {
+				changes = appendChange(changes, key+"."+k, oa[k], na[k])
+			}
+		}
+	}
+	return changes, nil
+}
+
+// appendProvisionerChanges appends the changes in the provisioners, by name.
+func appendProvisionerChanges(changes []Change, old, new any) []Change {
+	names := func(v any) ([]string, map[string]any) {
+		list, _ := v.([]any)
+		order := make([]string, 0, len(list))
+		m := make(map[string]any, len(list))
+		for _, p := range list {
+			name, _ := p.(map[string]any)["name"].(string)
+			order = append(order, name)
+			m[name] = p
+		}
+		return order, m
+	}
+
+	oldNames, o := names(old)
+	newNames, n := names(new)
+	for _, name := range newNames {
+		changes = appendChange(changes, "authority.provisioners."+name, o[name], n[name])
+	}
+	for _, name := range oldNames {
+		if _, ok := n[name]; !ok {
+			changes = appendChange(changes, "authority.provisioners."+name, o[name], nil)
+		}
+	}
+	return changes
+}
+
+func appendChange(changes []Change, path string, old, new any) []Change {
+	switch {
+	case old == nil && new == nil:
+		return changes
+	case old == nil:
+		return append(changes, Change{Path: path, Type: ChangeAdded})
+	case new == nil:
+		return append(changes, Change{Path: path, Type: ChangeRemoved})
+	case !reflect.DeepEqual(old, new):
+		return append(changes, Change{Path: path, Type: ChangeModified})
+	default:
+		return changes
+	}
+}
+
+// mergeKeys returns the sorted keys present in any of the given maps.
+func mergeKeys(a, b map[string]any) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func toJSONMap(c *Config) (map[string]any, error) {
+	m := make(map[string]any)
+	if c == nil {
+		return m, nil
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling configuration: %w", err)
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("error unmarshaling configuration: %w", err)
+	}
+	return m, nil
+}
@@ -0,0 +1,90 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/smallstep/certificates/authority/policy"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func TestDiff(t *testing.T) {
+	newConfig := func(provisioners ...provisioner.Interface) *Config {
+		return &Config{
+			Root:             []string{"root_ca.crt"},
+			IntermediateCert: "intermediate_ca.crt",
+			IntermediateKey:  "intermediate_ca_key",
+			Address:          ":443",
+			DNSNames:         []string{"ca.smallstep.com"},
+			AuthorityConfig: &AuthConfig{
+				Provisioners: provisioners,
+			},
+		}
+	}
+	jwk := &provisioner.JWK{Type: "JWK", Name: "jwk"}
+	acme := &provisioner.ACME{Type: "ACME", Name: "acme"}
+	oidc := &provisioner.OIDC{Type: "OIDC", Name: "oidc", ClientID: "client-id"}
+	modifiedOIDC := &provisioner.OIDC{Type: "OIDC", Name: "oidc", ClientID: "other-client-id"}
+
+	withTLS := newConfig(jwk)
+	withTLS.TLS = &TLSOptions{MinVersion: 1.3}
+	withPolicy := newConfig(jwk)
+	withPolicy.AuthorityConfig.Policy = &policy.Options{
+		X509: &policy.X509PolicyOptions{
+			AllowedNames: &policy.X509NameOptions{DNSDomains: []string{"*.smallstep.com"}},
+		},
+	}
+	withAddress := newConfig(jwk)
+	withAddress.Address = ":8443"
+	withoutAuthority := newConfig()
+	withoutAuthority.AuthorityConfig = nil
+
+	tests := []struct {
+		name string
+		old  *Config
+		new  *Config
+		want []Change
+	}{
+		{"ok no changes", newConfig(jwk, acme), newConfig(jwk, acme), nil},
+		{"ok provisioners", newConfig(jwk, oidc, acme), newConfig(modifiedOIDC, jwk, &provisioner.ACME{Type: "ACME", Name: "acme2"}), []Change{
+			{Path: "authority.provisioners.oidc", Type: ChangeModified},
+			{Path: "authority.provisioners.acme2", Type: ChangeAdded},
+			{Path: "authority.provisioners.acme", Type: ChangeRemoved},
+		}},
+		{"ok all provisioners", newConfig(), newConfig(jwk), []Change{
+			{Path: "authority.provisioners.jwk", Type: ChangeAdded},
+		}},
+		{"ok tls", newConfig(jwk), withTLS, []Change{
+			{Path: "tls", Type: ChangeAdded},
+		}},
+		{"ok policy", withPolicy, newConfig(jwk), []Change{
+			{Path: "authority.policy", Type: ChangeRemoved},
+		}},
+		{"ok address", newConfig(jwk), withAddress, []Change{
+			{Path: "address", Type: ChangeModified},
+		}},
+		{"ok authority", withoutAuthority, newConfig(), []Change{
+			{Path: "authority", Type: ChangeAdded},
+		}},
+		{"ok nil", nil, newConfig(), []Change{
+			{Path: "address", Type: ChangeAdded},
+			{Path: "authority", Type: ChangeAdded},
+			{Path: "crt", Type: ChangeAdded},
+			{Path: "dnsNames", Type: ChangeAdded},
+			{Path: "insecureAddress", Type: ChangeAdded},
+			{Path: "key", Type: ChangeAdded},
+			{Path: "root", Type: ChangeAdded},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Diff(tt.old, tt.new)
+			if err != nil {
+				t.Fatalf("Diff() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Diff() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,9 @@
 package config
 
 import (
+	"strings"
+	"time"
+
 	"github.com/pkg/errors"
 	"github.com/smallstep/certificates/authority/provisioner"
 	"go.step.sm/crypto/jose"
@@ -9,12 +12,137 @@ import (
 
 // SSHConfig contains the user and host keys.
 type SSHConfig struct {
-	HostKey          string          `json:"hostKey"`
-	UserKey          string          `json:"userKey"`
-	Keys             []*SSHPublicKey `json:"keys,omitempty"`
-	AddUserPrincipal string          `json:"addUserPrincipal,omitempty"`
-	AddUserCommand   string          `json:"addUserCommand,omitempty"`
-	Bastion          *Bastion        `json:"bastion,omitempty"`
+	HostKey          string           `json:"hostKey"`
+	UserKey          string           `json:"userKey"`
+	Keys             []*SSHPublicKey  `json:"keys,omitempty"`
+	AddUserPrincipal string           `json:"addUserPrincipal,omitempty"`
+	AddUserCommand   string           `json:"addUserCommand,omitempty"`
+	Bastion          *Bastion         `json:"bastion,omitempty"`
+	KRL              *KRLConfig       `json:"krl,omitempty"`
+	SigningKeys      []*SSHSigningKey `json:"signingKeys,omitempty"`
+	HostAccess       []*SSHHostAccess `json:"hostAccess,omitempty"`
+	// AllowSameKeyRekey allows rekeying a certificate with the public key of
+	// the old certificate. This is disabled by default, rekeying is used to
+	// rotate the key and the renew endpoint must be used to keep it.
+	AllowSameKeyRekey bool `json:"allowSameKeyRekey,omitempty"`
+}
+
+// SSHHostAccess grants users access to the hosts in a group of the SSH host
+// inventory. If the access is configured, the /ssh/hosts endpoint requires a
+// client certificate and only returns the hosts in the groups granted to it.
+//
+// Users are matched with the email addresses of the client certificate, and
+// with the common name if it is also one of the SANs of the certificate. A user can be an email or name, a domain starting with "@", or
+// "*" to allow all users.
+type SSHHostAccess struct {
+	Group string   `json:"group"`
+	Users []string `json:"users"`
+}
+
+// Validate checks the fields in SSHHostAccess.
+func (a *SSHHostAccess) Validate() error {
+	switch {
+	case a == nil:
+		return errors.New("ssh.hostAccess cannot contain an empty rule")
+	case a.Group == "":
+		return errors.New("ssh.hostAccess group cannot be empty")
+	case len(a.Users) == 0:
+		return errors.Errorf("ssh.hostAccess users for group %q cannot be empty", a.Group)
+	}
+	for _, u := range a.Users {
+		if u == "" || u == "@" {
+			return errors.Errorf("ssh.hostAccess users for group %q cannot contain an empty value", a.Group)
+		}
+	}
+	return nil
+}
+
+// Allows returns true if the rule grants the access to any of the given
+// identities.
+func (a *SSHHostAccess) Allows(identities ...string) bool {
+	for _, u := range a.Users {
+		for _, id := range identities {
+			switch {
+			case u == "*":
+				return true
+			case strings.HasPrefix(u, "@"):
+				if strings.HasSuffix(strings.ToLower(id), strings.ToLower(u)) {
+					return true
+				}
+			case strings.EqualFold(u, id):
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SSHSigningKey is an additional key used to sign SSH user or host
+// certificates. All the signing keys are trusted, and their public keys are
+// returned with the SSH roots, but only the active one, or the HostKey and
+// UserKey if there is none, is used to sign new certificates. This allows the
+// rotation of the SSH CA keys, a new key can be distributed to the fleet before
+// making it the active one.
+type SSHSigningKey struct {
+	Type   string `json:"type"`
+	Key    string `json:"key"`
+	Active bool   `json:"active,omitempty"`
+}
+
+// Validate checks the fields in SSHSigningKey.
+func (k *SSHSigningKey) Validate() error {
+	switch {
+	case k == nil:
+		return errors.New("ssh.signingKeys cannot contain an empty key")
+	case k.Type != provisioner.SSHUserCert && k.Type != provisioner.SSHHostCert:
+		return errors.Errorf("ssh.signingKeys type %q is not valid", k.Type)
+	case k.Key == "":
+		return errors.New("ssh.signingKeys key cannot be empty")
+	default:
+		return nil
+	}
+}
+
+// DefaultKRLRenewPeriod is the default period used to generate the OpenSSH key
+// revocation list.
+var DefaultKRLRenewPeriod = &provisioner.Duration{Duration: time.Hour}
+
+// KRLConfig contains the options used to generate an OpenSSH key revocation
+// list (KRL) with the revoked SSH certificates. If File is set, the KRL will
+// be also written to that path, so it can be used in the RevokedKeys option of
+// sshd.
+type KRLConfig struct {
+	Enabled     bool                  `json:"enabled"`
+	RenewPeriod *provisioner.Duration `json:"renewPeriod,omitempty"`
+	File        string                `json:"file,omitempty"`
+}
+
+// IsEnabled returns if the KRL is enabled.
+func (c *KRLConfig) IsEnabled() bool {
+	return c != nil && c.Enabled
+}
+
+// Validate validates the KRL configuration.
+func (c *KRLConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.RenewPeriod != nil && c.RenewPeriod.Duration < 0 {
+		return errors.New("ssh.krl.renewPeriod must be greater than or equal to 0")
+	}
+	return nil
+}
+
+// TickerDuration returns the period used to generate the KRL. This is set by
+// renewPeriod, or DefaultKRLRenewPeriod if it is not set.
+func (c *KRLConfig) TickerDuration() time.Duration {
+	if !c.IsEnabled() {
+		return 0
+	}
+	if c.RenewPeriod != nil && c.RenewPeriod.Duration > 0 {
+		return c.RenewPeriod.Duration
+	}
+	return DefaultKRLRenewPeriod.Duration
 }
 
 // Bastion contains the custom properties used on bastion.
@@ -39,6 +167,7 @@ type Host struct {
 	HostID   string    `json:"hid"`
 	HostTags []HostTag `json:"host_tags"`
 	Hostname string    `json:"hostname"`
+	Groups   []string  `json:"groups,omitempty"`
 }
 
 // Validate checks the fields in SSHConfig.
@@ -51,7 +180,38 @@ func (c *SSHConfig) Validate() error {
 			return err
 		}
 	}
-	return nil
+	active := make(map[string]bool)
+	for _, k := range c.SigningKeys {
+		if err := k.Validate(); err != nil {
+			return err
+		}
+		if k.Active {
+			if active[k.Type] {
+				return errors.Errorf("ssh.signingKeys cannot contain more than one active %s key", k.Type)
+			}
+			active[k.Type] = true
+		}
+	}
+	for _, a := range c.HostAccess {
+		if err := a.Validate(); err != nil {
+			return err
+		}
+	}
+	return c.KRL.Validate()
+}
+
+// IsSameKeyRekeyAllowed returns whether an SSH certificate can be rekeyed with
+// the same public key.
+func (c *SSHConfig) IsSameKeyRekeyAllowed() bool {
+	return c != nil && c.AllowSameKeyRekey
+}
+
+// GetKRL returns the KRL configuration if it is defined.
+func (c *SSHConfig) GetKRL() *KRLConfig {
+	if c == nil {
+		return nil
+	}
+	return c.KRL
 }
 
 // SSHPublicKey contains a public key used by federated CAs to keep old signing
@@ -3,10 +3,13 @@ package config
 import (
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/smallstep/assert"
 	"go.step.sm/crypto/jose"
 	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/certificates/authority/provisioner"
 )
 
 func TestSSHPublicKey_Validate(t *testing.T) {
@@ -71,3 +74,103 @@ func TestSSHPublicKey_PublicKey(t *testing.T) {
 		})
 	}
 }
+
+func TestKRLConfig(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       *KRLConfig
+		wantEnabled  bool
+		wantDuration time.Duration
+		wantErr      bool
+	}{
+		{"nil", nil, false, 0, false},
+		{"disabled", &KRLConfig{RenewPeriod: &provisioner.Duration{Duration: time.Minute}}, false, 0, false},
+		{"default", &KRLConfig{Enabled: true}, true, time.Hour, false},
+		{"renewPeriod", &KRLConfig{Enabled: true, RenewPeriod: &provisioner.Duration{Duration: time.Minute}}, true, time.Minute, false},
+		{"fail renewPeriod", &KRLConfig{Enabled: true, RenewPeriod: &provisioner.Duration{Duration: -time.Minute}}, true, time.Hour, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("KRLConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := tt.config.IsEnabled(); got != tt.wantEnabled {
+				t.Errorf("KRLConfig.IsEnabled() = %v, want %v", got, tt.wantEnabled)
+			}
+			if got := tt.config.TickerDuration(); got != tt.wantDuration {
+				t.Errorf("KRLConfig.TickerDuration() = %v, want %v", got, tt.wantDuration)
+			}
+		})
+	}
+}
+
+func TestSSHConfig_Validate_signingKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    []*SSHSigningKey
+		wantErr bool
+	}{
+		{"ok", []*SSHSigningKey{{Type: "host", Key: "host.key", Active: true}, {Type: "host", Key: "old.key"}, {Type: "user", Key: "user.key", Active: true}}, false},
+		{"fail nil", []*SSHSigningKey{nil}, true},
+		{"fail type", []*SSHSigningKey{{Type: "bad", Key: "host.key"}}, true},
+		{"fail key", []*SSHSigningKey{{Type: "user"}}, true},
+		{"fail active", []*SSHSigningKey{{Type: "user", Key: "user.key", Active: true}, {Type: "user", Key: "new.key", Active: true}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &SSHConfig{SigningKeys: tt.keys}
+			if err := c.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("SSHConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSSHHostAccess_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		access  *SSHHostAccess
+		wantErr bool
+	}{
+		{"ok", &SSHHostAccess{Group: "web", Users: []string{"jane@example.com", "@example.org", "*"}}, false},
+		{"fail nil", nil, true},
+		{"fail group", &SSHHostAccess{Users: []string{"*"}}, true},
+		{"fail users", &SSHHostAccess{Group: "web"}, true},
+		{"fail empty user", &SSHHostAccess{Group: "web", Users: []string{""}}, true},
+		{"fail empty domain", &SSHHostAccess{Group: "web", Users: []string{"@"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.access.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("SSHHostAccess.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSSHHostAccess_Allows(t *testing.T) {
+	tests := []struct {
+		name       string
+		users      []string
+		identities []string
+		want       bool
+	}{
+		{"ok email", []string{"jane@example.com"}, []string{"Jane@Example.com"}, true},
+		{"ok domain", []string{"@example.com"}, []string{"jane", "jane@example.com"}, true},
+		{"ok all", []string{"*"}, []string{"jane"}, true},
+		{"fail email", []string{"jane@example.com"}, []string{"john@example.com"}, false},
+		{"fail domain", []string{"@example.com"}, []string{"jane@example.org"}, false},
+		{"fail no identities", []string{"*"}, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &SSHHostAccess{Group: "web", Users: tt.users}
+			if got := a.Allows(tt.identities...); got != tt.want {
+				t.Errorf("SSHHostAccess.Allows() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
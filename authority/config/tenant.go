@@ -0,0 +1,107 @@
+package config
+
+import (
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	tenantNameRegexp   = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+	tenantPrefixRegexp = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
+)
+
+// reservedTenantPrefixes are the first segments of the paths served by the
+// main authority. A tenant using one of them as a prefix would shadow the
+// routes of the main authority.
+var reservedTenantPrefixes = map[string]bool{
+	"1.0": true, "2.0": true, "acme": true, "admin": true, "scep": true,
+	"version": true, "health": true, "root": true, "roots": true,
+	"roots.pem": true, "sign": true, "sign-ssh": true, "pending-issuances": true,
+	"validate-token": true, "renew": true, "re-sign": true, "rekey": true,
+	"revoke": true, "crl": true, "provisioners": true, "federation": true,
+	"intermediates": true, "ssh": true,
+}
+
+// TenantConfig defines an additional authority served by the same step-ca
+// process. Each tenant has its own configuration file with its own roots,
+// intermediates, provisioners and DNS names.
+//
+// Requests are routed to a tenant using the SNI or the host of the request if
+// it matches one of the DNS names of the tenant, or using the URL prefix
+// "/<prefix>" if a prefix is configured. Tenants selected only by the prefix
+// share the TLS certificate of the main authority.
+//
+// If the configuration of the tenant does not define a database, the tenant
+// uses the database of the main authority with its tables namespaced by the
+// tenant name, "<name>-<table>".
+type TenantConfig struct {
+	Name   string `json:"name"`
+	Prefix string `json:"prefix,omitempty"`
+	Config string `json:"config"`
+}
+
+// Validate checks the fields in TenantConfig.
+func (t *TenantConfig) Validate() error {
+	switch {
+	case t == nil:
+		return errors.New("tenant cannot be nil")
+	case !tenantNameRegexp.MatchString(t.Name):
+		return errors.Errorf("invalid tenant name %q: only letters, digits and underscores are allowed", t.Name)
+	case t.Prefix != "" && !tenantPrefixRegexp.MatchString(t.Prefix):
+		return errors.Errorf("invalid prefix %q for tenant %s", t.Prefix, t.Name)
+	case reservedTenantPrefixes[t.Prefix]:
+		return errors.Errorf("invalid prefix %q for tenant %s: the prefix is reserved by the authority", t.Prefix, t.Name)
+	case t.Config == "":
+		return errors.Errorf("config cannot be empty for tenant %s", t.Name)
+	default:
+		return nil
+	}
+}
+
+// Load loads and validates the configuration of the tenant. Tenants are served
+// by the same server as the parent configuration, so the addresses are
+// always the ones in the parent.
+func (t *TenantConfig) Load(parent *Config) (*Config, error) {
+	c, err := LoadConfiguration(t.Config)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error loading tenant %s", t.Name)
+	}
+	if len(c.Tenants) > 0 {
+		return nil, errors.Errorf("error loading tenant %s: tenants cannot be nested", t.Name)
+	}
+
+	c.Address = parent.Address
+	c.InsecureAddress = ""
+	c.MetricsAddress = ""
+	if t.Prefix != "" {
+		c.pathPrefix = "/" + t.Prefix
+	}
+	if err := c.Validate(); err != nil {
+		return nil, errors.Wrapf(err, "error validating tenant %s", t.Name)
+	}
+	return c, nil
+}
+
+// validateTenants checks that the tenants are valid and that the names and the
+// prefixes are not repeated.
+func validateTenants(tenants []*TenantConfig) error {
+	names := make(map[string]bool, len(tenants))
+	prefixes := make(map[string]bool, len(tenants))
+	for _, t := range tenants {
+		if err := t.Validate(); err != nil {
+			return err
+		}
+		if names[t.Name] {
+			return errors.Errorf("tenant %s is defined more than once", t.Name)
+		}
+		names[t.Name] = true
+		if t.Prefix != "" {
+			if prefixes[t.Prefix] {
+				return errors.Errorf("prefix %q is used by more than one tenant", t.Prefix)
+			}
+			prefixes[t.Prefix] = true
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+func TestTenantConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		tenant  *TenantConfig
+		wantErr bool
+	}{
+		{"ok", &TenantConfig{Name: "tenant_1", Config: "ca.json"}, false},
+		{"ok prefix", &TenantConfig{Name: "tenant_1", Prefix: "tenant-1.v1", Config: "ca.json"}, false},
+		{"fail nil", nil, true},
+		{"fail name", &TenantConfig{Name: "tenant-1", Config: "ca.json"}, true},
+		{"fail empty name", &TenantConfig{Config: "ca.json"}, true},
+		{"fail prefix", &TenantConfig{Name: "tenant_1", Prefix: "tenant/1", Config: "ca.json"}, true},
+		{"fail reserved prefix", &TenantConfig{Name: "tenant_1", Prefix: "sign", Config: "ca.json"}, true},
+		{"fail reserved prefix acme", &TenantConfig{Name: "tenant_1", Prefix: "acme", Config: "ca.json"}, true},
+		{"fail reserved prefix version", &TenantConfig{Name: "tenant_1", Prefix: "1.0", Config: "ca.json"}, true},
+		{"fail config", &TenantConfig{Name: "tenant_1"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.tenant.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("TenantConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_validateTenants(t *testing.T) {
+	tests := []struct {
+		name    string
+		tenants []*TenantConfig
+		wantErr bool
+	}{
+		{"ok nil", nil, false},
+		{"ok", []*TenantConfig{
+			{Name: "foo", Config: "foo.json"},
+			{Name: "bar", Prefix: "bar", Config: "bar.json"},
+			{Name: "zar", Prefix: "zar", Config: "zar.json"},
+		}, false},
+		{"fail invalid", []*TenantConfig{{Name: "foo"}}, true},
+		{"fail name", []*TenantConfig{
+			{Name: "foo", Config: "foo.json"},
+			{Name: "foo", Prefix: "foo", Config: "bar.json"},
+		}, true},
+		{"fail prefix", []*TenantConfig{
+			{Name: "foo", Prefix: "foo", Config: "foo.json"},
+			{Name: "bar", Prefix: "foo", Config: "bar.json"},
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateTenants(tt.tenants); (err != nil) != tt.wantErr {
+				t.Errorf("validateTenants() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTenantConfig_Load(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		fn := filepath.Join(dir, name)
+		assert.FatalError(t, os.WriteFile(fn, []byte(data), 0600))
+		return fn
+	}
+	tenantConfig := write("tenant.json", `{
+		"root": "root_ca.crt", "crt": "intermediate_ca.crt", "key": "intermediate_ca_key",
+		"address": ":9000", "insecureAddress": ":8080", "metricsAddress": ":9090",
+		"dnsNames": ["tenant.example.com"], "authority": {}
+	}`)
+	nestedConfig := write("nested.json", `{
+		"root": "root_ca.crt", "crt": "intermediate_ca.crt", "key": "intermediate_ca_key",
+		"address": ":9000", "dnsNames": ["tenant.example.com"], "authority": {},
+		"tenants": [{"name": "nested", "config": "tenant.json"}]
+	}`)
+	invalidConfig := write("invalid.json", `{"address": ":9000", "authority": {}}`)
+
+	parent := &Config{Address: ":443", InsecureAddress: ":80", MetricsAddress: ":9100"}
+	c, err := (&TenantConfig{Name: "tenant", Prefix: "tenant", Config: tenantConfig}).Load(parent)
+	assert.FatalError(t, err)
+	assert.Equals(t, ":443", c.Address)
+	assert.Equals(t, "", c.InsecureAddress)
+	assert.Equals(t, "", c.MetricsAddress)
+	assert.Equals(t, []string{"tenant.example.com"}, c.DNSNames)
+	assert.Equals(t, []string{"https://tenant.example.com/sign", "https://tenant.example.com/tenant/sign", "/sign"}, c.Audience("/sign"))
+
+	c, err = (&TenantConfig{Name: "tenant", Config: tenantConfig}).Load(parent)
+	assert.FatalError(t, err)
+	assert.Equals(t, []string{"https://tenant.example.com/sign", "/sign"}, c.Audience("/sign"))
+
+	_, err = (&TenantConfig{Name: "tenant", Config: filepath.Join(dir, "missing.json")}).Load(parent)
+	assert.Error(t, err)
+	_, err = (&TenantConfig{Name: "tenant", Config: nestedConfig}).Load(parent)
+	assert.Error(t, err)
+	_, err = (&TenantConfig{Name: "tenant", Config: invalidConfig}).Load(parent)
+	assert.Error(t, err)
+}
@@ -0,0 +1,203 @@
+package authority
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+	casapi "github.com/smallstep/certificates/cas/apiv1"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/errs"
+)
+
+var (
+	// oidExtensionCTPoison is the RFC 6962 precertificate poison extension.
+	oidExtensionCTPoison = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 3}
+	// oidExtensionCTSCTList is the RFC 6962 embedded SCT list extension.
+	oidExtensionCTSCTList = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+)
+
+// asn1Null is the DER encoding of an ASN.1 NULL, the value of the poison
+// extension.
+var asn1Null = []byte{0x05, 0x00}
+
+// withPrecertificatePoison returns an enforcer that adds the critical poison
+// extension and removes any embedded SCT list if the certificate is a
+// pre-certificate.
+func withPrecertificatePoison(precertificate bool) provisioner.CertificateEnforcerFunc {
+	return func(crt *x509.Certificate) error {
+		if !precertificate {
+			return nil
+		}
+		crt.ExtraExtensions = removeExtensions(crt.ExtraExtensions, oidExtensionCTPoison, oidExtensionCTSCTList)
+		crt.ExtraExtensions = append(crt.ExtraExtensions, pkix.Extension{
+			Id:       oidExtensionCTPoison,
+			Critical: true,
+			Value:    asn1Null,
+		})
+		return nil
+	}
+}
+
+// precertificatesAllowed returns true if the given provisioner allows RFC 6962
+// pre-certificates.
+func precertificatesAllowed(prov provisioner.Interface) bool {
+	p, ok := prov.(interface{ GetOptions() *provisioner.Options })
+	return ok && p.GetOptions().GetX509Options().ArePrecertificatesAllowed()
+}
+
+// FinalizePrecertificate issues the final certificate that matches the given
+// pre-certificate. The new certificate keeps the serial number, validity,
+// subject, public key and extensions of the pre-certificate, but it removes the
+// poison extension and embeds the given signed certificate timestamps.
+//
+// The extra options are the ones returned by the authorization of a sign
+// token. The provisioner of the token must be the one that issued the
+// pre-certificate, and it must allow pre-certificates.
+func (a *Authority) FinalizePrecertificate(_ context.Context, precert *x509.Certificate, scts [][]byte, extraOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+	opts := []any{errs.WithKeyVal("serialNumber", precert.SerialNumber.String())}
+
+	var prov provisioner.Interface
+	for _, op := range extraOpts {
+		if p, ok := op.(provisioner.Interface); ok {
+			prov = p
+			break
+		}
+	}
+	if prov == nil {
+		return nil, errs.ApplyOptions(errs.Unauthorized("authority.FinalizePrecertificate; missing provisioner"), opts...)
+	}
+	if !precertificatesAllowed(prov) {
+		return nil, errs.ApplyOptions(errs.Forbidden("provisioner %q does not allow pre-certificates", prov.GetName()), opts...)
+	}
+
+	if !hasExtension(precert.Extensions, oidExtensionCTPoison) {
+		return nil, errs.ApplyOptions(errs.BadRequest("certificate is not a pre-certificate"), opts...)
+	}
+	if time.Now().After(precert.NotAfter) {
+		return nil, errs.ApplyOptions(errs.BadRequest("pre-certificate has expired"), opts...)
+	}
+	sctList, err := marshalSCTList(scts)
+	if err != nil {
+		return nil, errs.ApplyOptions(errs.BadRequestErr(err, "error encoding signed certificate timestamps"), opts...)
+	}
+
+	// The pre-certificate must have been issued by this authority.
+	var issued bool
+	for _, crt := range a.getIntermediates() {
+		if err := precert.CheckSignatureFrom(crt); err == nil {
+			issued = true
+			break
+		}
+	}
+	if !issued {
+		return nil, errs.ApplyOptions(errs.Forbidden("pre-certificate was not issued by this authority"), opts...)
+	}
+	if p, err := a.LoadProvisionerByCertificate(precert); err != nil || p.GetID() != prov.GetID() {
+		return nil, errs.ApplyOptions(errs.Forbidden("pre-certificate was not issued by provisioner %q", prov.GetName()), opts...)
+	}
+
+	isRevoked, err := a.IsRevoked(precert.SerialNumber.String())
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.FinalizePrecertificate", opts...)
+	}
+	if isRevoked {
+		return nil, errs.ApplyOptions(errs.Forbidden("pre-certificate has been revoked"), opts...)
+	}
+
+	// Copy all the pre-certificate extensions in the same order, so the final
+	// TBSCertificate only differs in the poison and SCT list extensions.
+	template := &x509.Certificate{
+		SerialNumber:       precert.SerialNumber,
+		RawSubject:         precert.RawSubject,
+		NotBefore:          precert.NotBefore,
+		NotAfter:           precert.NotAfter,
+		PublicKey:          precert.PublicKey,
+		SignatureAlgorithm: precert.SignatureAlgorithm,
+		SubjectKeyId:       precert.SubjectKeyId,
+	}
+	for _, ext := range precert.Extensions {
+		if ext.Id.Equal(oidExtensionCTPoison) || ext.Id.Equal(oidExtensionCTSCTList) {
+			continue
+		}
+		template.ExtraExtensions = append(template.ExtraExtensions, ext)
+	}
+	template.ExtraExtensions = append(template.ExtraExtensions, pkix.Extension{
+		Id:    oidExtensionCTSCTList,
+		Value: sctList,
+	})
+
+	resp, err := a.getX509CAService().CreateCertificate(&casapi.CreateCertificateRequest{
+		Template: template,
+		Lifetime: precert.NotAfter.Sub(precert.NotBefore),
+	})
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.FinalizePrecertificate; error creating certificate", opts...)
+	}
+
+	chain := append([]*x509.Certificate{resp.Certificate}, resp.CertificateChain...)
+
+	// Store the final certificate, it will replace the pre-certificate as both
+	// share the same serial number.
+	if err := a.storeCertificate(nil, chain); err != nil && !errors.Is(err, db.ErrNotImplemented) {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.FinalizePrecertificate; error storing certificate in db", opts...)
+	}
+
+	return chain, nil
+}
+
+// marshalSCTList encodes the given serialized SCTs as the value of the RFC 6962
+// SignedCertificateTimestampList extension.
+func marshalSCTList(scts [][]byte) ([]byte, error) {
+	if len(scts) == 0 {
+		return nil, errors.New("signed certificate timestamps cannot be empty")
+	}
+
+	var list []byte
+	for _, sct := range scts {
+		if len(sct) == 0 || len(sct) > 0xffff {
+			return nil, errors.New("signed certificate timestamp has an invalid length")
+		}
+		list = binary.BigEndian.AppendUint16(list, uint16(len(sct)))
+		list = append(list, sct...)
+	}
+	if len(list) > 0xffff {
+		return nil, errors.New("signed certificate timestamp list is too large")
+	}
+
+	b := binary.BigEndian.AppendUint16(nil, uint16(len(list)))
+	return asn1.Marshal(append(b, list...))
+}
+
+func hasExtension(exts []pkix.Extension, oid asn1.ObjectIdentifier) bool {
+	for _, ext := range exts {
+		if ext.Id.Equal(oid) {
+			return true
+		}
+	}
+	return false
+}
+
+func removeExtensions(exts []pkix.Extension, oids ...asn1.ObjectIdentifier) []pkix.Extension {
+	var ret []pkix.Extension
+	for _, ext := range exts {
+		var skip bool
+		for _, oid := range oids {
+			if ext.Id.Equal(oid) {
+				skip = true
+				break
+			}
+		}
+		if !skip {
+			ret = append(ret, ext)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,171 @@
+package authority
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/keyutil"
+
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+)
+
+func findExtension(exts []pkix.Extension, oid asn1.ObjectIdentifier) (pkix.Extension, bool) {
+	for _, ext := range exts {
+		if ext.Id.Equal(oid) {
+			return ext, true
+		}
+	}
+	return pkix.Extension{}, false
+}
+
+// allowPrecertificates enables the pre-certificates in the step-cli
+// provisioner of the given authority, and returns it.
+func allowPrecertificates(t *testing.T, a *Authority) provisioner.Interface {
+	t.Helper()
+
+	p, err := a.LoadProvisionerByName("step-cli")
+	require.NoError(t, err)
+	p.(*provisioner.JWK).Options = &provisioner.Options{
+		X509: &provisioner.X509Options{AllowPrecertificates: true},
+	}
+	return p
+}
+
+func signPrecertificate(t *testing.T, a *Authority) *x509.Certificate {
+	t.Helper()
+	chain, err := signPrecertificateErr(t, a)
+	require.NoError(t, err)
+	return chain[0]
+}
+
+func signPrecertificateErr(t *testing.T, a *Authority) ([]*x509.Certificate, error) {
+	t.Helper()
+
+	_, priv, err := keyutil.GenerateDefaultKeyPair()
+	require.NoError(t, err)
+
+	key, err := jose.ReadKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	require.NoError(t, err)
+	token, err := generateToken("smallstep test", "step-cli", testAudiences.Sign[0], []string{"test.smallstep.com"}, time.Now(), key)
+	require.NoError(t, err)
+	ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod)
+	extraOpts, err := a.Authorize(ctx, token)
+	require.NoError(t, err)
+
+	return a.SignWithContext(ctx, getCSR(t, priv), provisioner.SignOptions{
+		Precertificate: true,
+	}, extraOpts...)
+}
+
+func TestAuthority_SignWithContext_precertificate(t *testing.T) {
+	a := testAuthority(t)
+
+	// The provisioner must allow pre-certificates.
+	_, err := signPrecertificateErr(t, a)
+	var sc render.StatusCodedError
+	require.ErrorAs(t, err, &sc)
+	assert.Equal(t, http.StatusForbidden, sc.StatusCode())
+
+	allowPrecertificates(t, a)
+	precert := signPrecertificate(t, a)
+
+	ext, ok := findExtension(precert.Extensions, oidExtensionCTPoison)
+	require.True(t, ok, "pre-certificate does not contain the poison extension")
+	assert.True(t, ext.Critical)
+	assert.Equal(t, asn1Null, ext.Value)
+	assert.Len(t, precert.UnhandledCriticalExtensions, 1)
+
+	_, ok = findExtension(precert.Extensions, oidExtensionCTSCTList)
+	assert.False(t, ok)
+}
+
+func TestAuthority_FinalizePrecertificate(t *testing.T) {
+	scts := [][]byte{[]byte("sct-one"), []byte("sct-two")}
+	expectedSCTList, err := marshalSCTList(scts)
+	require.NoError(t, err)
+
+	a := testAuthority(t)
+	prov := allowPrecertificates(t, a)
+	precert := signPrecertificate(t, a)
+
+	root, signer := generateRootCertificate(t)
+	otherCA := testAuthority(t, WithX509Signer(generateIntermidiateCertificate(t, root, signer)))
+	otherProv := allowPrecertificates(t, otherCA)
+
+	allowOpts := &provisioner.Options{X509: &provisioner.X509Options{AllowPrecertificates: true}}
+	type args struct {
+		precert *x509.Certificate
+		scts    [][]byte
+		prov    provisioner.Interface
+	}
+	tests := []struct {
+		name     string
+		auth     *Authority
+		args     args
+		wantCode int
+	}{
+		{"ok", a, args{precert, scts, prov}, 0},
+		{"fail not a pre-certificate", a, args{getDefaultIssuer(a), scts, prov}, http.StatusBadRequest},
+		{"fail no scts", a, args{precert, nil, prov}, http.StatusBadRequest},
+		{"fail empty sct", a, args{precert, [][]byte{{}}, prov}, http.StatusBadRequest},
+		{"fail no provisioner", a, args{precert, scts, nil}, http.StatusUnauthorized},
+		{"fail provisioner not allowed", a, args{precert, scts, &provisioner.JWK{ID: "jwk", Name: "jwk"}}, http.StatusForbidden},
+		{"fail other provisioner", a, args{precert, scts, &provisioner.JWK{ID: "jwk", Name: "jwk", Options: allowOpts}}, http.StatusForbidden},
+		{"fail other issuer", otherCA, args{precert, scts, otherProv}, http.StatusForbidden},
+		{"fail revoked", func() *Authority {
+			_a := testAuthority(t)
+			_a.db = &db.MockAuthDB{
+				MIsRevoked: func(sn string) (bool, error) {
+					return sn == precert.SerialNumber.String(), nil
+				},
+			}
+			return _a
+		}(), args{precert, scts, prov}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var extraOpts []provisioner.SignOption
+			if tt.args.prov != nil {
+				extraOpts = append(extraOpts, tt.args.prov)
+			}
+			chain, err := tt.auth.FinalizePrecertificate(context.Background(), tt.args.precert, tt.args.scts, extraOpts...)
+			if tt.wantCode != 0 {
+				var sc render.StatusCodedError
+				require.ErrorAs(t, err, &sc)
+				assert.Equal(t, tt.wantCode, sc.StatusCode())
+				assert.Nil(t, chain)
+				return
+			}
+			require.NoError(t, err)
+			crt := chain[0]
+
+			_, ok := findExtension(crt.Extensions, oidExtensionCTPoison)
+			assert.False(t, ok, "final certificate contains the poison extension")
+			assert.Empty(t, crt.UnhandledCriticalExtensions)
+
+			ext, ok := findExtension(crt.Extensions, oidExtensionCTSCTList)
+			require.True(t, ok, "final certificate does not contain the SCT list extension")
+			assert.False(t, ext.Critical)
+			assert.Equal(t, expectedSCTList, ext.Value)
+
+			assert.Equal(t, precert.SerialNumber, crt.SerialNumber)
+			assert.Equal(t, precert.RawSubject, crt.RawSubject)
+			assert.Equal(t, precert.NotBefore, crt.NotBefore)
+			assert.Equal(t, precert.NotAfter, crt.NotAfter)
+			assert.Equal(t, precert.DNSNames, crt.DNSNames)
+			assert.Equal(t, precert.SubjectKeyId, crt.SubjectKeyId)
+			assert.Equal(t, precert.AuthorityKeyId, crt.AuthorityKeyId)
+			assert.Len(t, crt.Extensions, len(precert.Extensions))
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package authority
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"encoding/hex"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.step.sm/crypto/keyutil"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+// keyDenylist is a set of public key fingerprints that the authority refuses
+// to certify. The fingerprints are the hex encoded SHA-256 of the subject
+// public key, the same value returned by `step crypto key fingerprint`, with or
+// without the "SHA256:" prefix.
+//
+// The list is loaded when the authority is initialized, so the file is read
+// again when the configuration of the CA is reloaded.
+type keyDenylist struct {
+	fingerprints map[string]struct{}
+}
+
+// newKeyDenylist creates a new key denylist and loads it from the given file.
+func newKeyDenylist(filename string) (*keyDenylist, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", filename)
+	}
+	fingerprints, err := parseKeyDenylist(b)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing %s", filename)
+	}
+	return &keyDenylist{fingerprints: fingerprints}, nil
+}
+
+// Validate returns an error if the given public key is in the denylist.
+func (l *keyDenylist) Validate(pub crypto.PublicKey) error {
+	if l == nil {
+		return nil
+	}
+	fp, err := keyutil.EncodedFingerprint(pub, keyutil.HexFingerprint)
+	if err != nil {
+		return errs.BadRequestErr(err, "error calculating public key fingerprint")
+	}
+	fp = strings.TrimPrefix(fp, "SHA256:")
+
+	if _, ok := l.fingerprints[fp]; ok {
+		return errs.Forbidden("public key with fingerprint %s has been denylisted", fp)
+	}
+	return nil
+}
+
+// parseKeyDenylist parses a file with one hex encoded fingerprint per line.
+// The "SHA256:" prefix and colons in the fingerprints, empty lines and lines
+// starting with '#' are ignored.
+func parseKeyDenylist(b []byte) (map[string]struct{}, error) {
+	fingerprints := make(map[string]struct{})
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fp := strings.ToLower(line)
+		fp = strings.ReplaceAll(strings.TrimPrefix(fp, "sha256:"), ":", "")
+		if b, err := hex.DecodeString(fp); err != nil || len(b) != 32 {
+			return nil, errors.Errorf("line %d: %q is not a valid SHA-256 fingerprint", n, line)
+		}
+		fingerprints[fp] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return fingerprints, nil
+}
@@ -0,0 +1,110 @@
+package authority
+
+import (
+	"context"
+	"crypto"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/keyutil"
+
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func mustFingerprint(t *testing.T, pub crypto.PublicKey) string {
+	t.Helper()
+	fp, err := keyutil.EncodedFingerprint(pub, keyutil.HexFingerprint)
+	require.NoError(t, err)
+	return strings.TrimPrefix(fp, "SHA256:")
+}
+
+func Test_parseKeyDenylist(t *testing.T) {
+	fp := strings.Repeat("ab", 32)
+	tests := []struct {
+		name    string
+		data    string
+		want    map[string]struct{}
+		wantErr bool
+	}{
+		{"ok", fp + "\n", map[string]struct{}{fp: {}}, false},
+		{"ok empty", "", map[string]struct{}{}, false},
+		{"ok comments", "# leaked keys\n\n  " + fp + "  \n# end\n", map[string]struct{}{fp: {}}, false},
+		{"ok prefix", "SHA256:" + fp, map[string]struct{}{fp: {}}, false},
+		{"ok colons and uppercase", strings.ToUpper(strings.Repeat("ab:", 31) + "ab"), map[string]struct{}{fp: {}}, false},
+		{"fail hex", "zz" + fp[2:], nil, true},
+		{"fail length", fp[2:], nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseKeyDenylist([]byte(tt.data))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestAuthority_keyDenylist(t *testing.T) {
+	pub1, priv1, err := keyutil.GenerateDefaultKeyPair()
+	require.NoError(t, err)
+	pub2, priv2, err := keyutil.GenerateDefaultKeyPair()
+	require.NoError(t, err)
+
+	filename := filepath.Join(t.TempDir(), "denylist")
+	require.NoError(t, os.WriteFile(filename, []byte("# compromised keys\nSHA256:"+mustFingerprint(t, pub1)+"\n"), 0600))
+
+	a := testAuthority(t)
+	a.keyDenylist, err = newKeyDenylist(filename)
+	require.NoError(t, err)
+
+	key, err := jose.ReadKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	require.NoError(t, err)
+	sign := func(t *testing.T, priv crypto.PrivateKey) error {
+		t.Helper()
+		token, err := generateToken("smallstep test", "step-cli", testAudiences.Sign[0], []string{"test.smallstep.com"}, time.Now(), key)
+		require.NoError(t, err)
+		ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod)
+		extraOpts, err := a.Authorize(ctx, token)
+		require.NoError(t, err)
+		_, err = a.SignWithContext(ctx, getCSR(t, priv), provisioner.SignOptions{}, extraOpts...)
+		return err
+	}
+	assertDenied := func(t *testing.T, err error, pub crypto.PublicKey) {
+		t.Helper()
+		var sc render.StatusCodedError
+		require.ErrorAs(t, err, &sc)
+		assert.Equal(t, http.StatusForbidden, sc.StatusCode())
+		assert.ErrorContains(t, err, "public key with fingerprint "+mustFingerprint(t, pub)+" has been denylisted")
+	}
+
+	assertDenied(t, sign(t, priv1), pub1)
+	assert.NoError(t, sign(t, priv2))
+
+	// Update the list, it is loaded again on a configuration reload
+	require.NoError(t, os.WriteFile(filename, []byte(mustFingerprint(t, pub2)+"\n"), 0600))
+	a.keyDenylist, err = newKeyDenylist(filename)
+	require.NoError(t, err)
+	assert.NoError(t, sign(t, priv1))
+	assertDenied(t, sign(t, priv2), pub2)
+
+	// An invalid list fails
+	require.NoError(t, os.WriteFile(filename, []byte("foo\n"), 0600))
+	_, err = newKeyDenylist(filename)
+	assert.Error(t, err)
+
+	// Rekey to a denylisted key
+	crt := getDefaultIssuer(a)
+	_, err = a.Rekey(crt, pub2)
+	assertDenied(t, err, pub2)
+}
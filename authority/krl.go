@@ -0,0 +1,213 @@
+package authority
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.step.sm/cli-utils/step"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/errs"
+)
+
+// Constants used in the OpenSSH KRL format, see
+// https://github.com/openssh/openssh-portable/blob/master/PROTOCOL.krl
+const (
+	krlMagic                 uint64 = 0x5353484b524c0a00
+	krlFormatVersion         uint32 = 1
+	krlSectionCertificates   byte   = 1
+	krlSectionCertSerialList byte   = 0x20
+)
+
+// GetSSHKeyRevocationList returns the last OpenSSH key revocation list (KRL)
+// generated with the revoked SSH certificates.
+func (a *Authority) GetSSHKeyRevocationList(context.Context) ([]byte, error) {
+	if !a.config.SSH.GetKRL().IsEnabled() {
+		return nil, errs.NotFound("authority.GetSSHKeyRevocationList; ssh key revocation lists are not enabled")
+	}
+
+	a.krlMutex.Lock()
+	defer a.krlMutex.Unlock()
+	if a.krl == nil {
+		return nil, errs.NotFound("authority.GetSSHKeyRevocationList; ssh key revocation list is not available")
+	}
+	return a.krl, nil
+}
+
+// GenerateSSHKeyRevocationList generates an OpenSSH key revocation list (KRL)
+// with the revoked SSH certificates. The KRL revokes the serial numbers of the
+// certificates signed by any of the SSH user and host keys of the authority.
+// If a file is configured, the KRL is also written to disk. Returns nil if KRL
+// generation has been disabled in the config.
+func (a *Authority) GenerateSSHKeyRevocationList() error {
+	krlConfig := a.config.SSH.GetKRL()
+	if !krlConfig.IsEnabled() {
+		return nil
+	}
+
+	krlDB, ok := a.db.(db.SSHRevocationListDB)
+	if !ok {
+		return errors.Errorf("Database does not support KRL generation")
+	}
+
+	a.krlMutex.Lock()
+	defer a.krlMutex.Unlock()
+
+	revokedList, err := krlDB.GetRevokedSSHCertificates()
+	if err != nil {
+		return errors.Wrap(err, "could not retrieve revoked ssh certificates list from database")
+	}
+
+	now := time.Now().Truncate(time.Second).UTC()
+	serials := make([]uint64, 0, len(*revokedList))
+	seen := make(map[uint64]struct{}, len(*revokedList))
+	for _, rci := range *revokedList {
+		// skip expired certificates
+		if !rci.ExpiresAt.IsZero() && rci.ExpiresAt.Before(now) {
+			continue
+		}
+		sn, err := strconv.ParseUint(rci.Serial, 10, 64)
+		if err != nil {
+			continue
+		}
+		if _, ok := seen[sn]; !ok {
+			seen[sn] = struct{}{}
+			serials = append(serials, sn)
+		}
+	}
+	sort.Slice(serials, func(i, j int) bool {
+		return serials[i] < serials[j]
+	})
+
+	// The version must increase every time a new KRL is generated.
+	version := uint64(now.Unix())
+	if version <= a.krlVersion {
+		version = a.krlVersion + 1
+	}
+
+	krl := marshalKRL(version, now, a.sshCAKeys(), serials)
+	if krlConfig.File != "" {
+		if err := writeKRL(step.Abs(krlConfig.File), krl); err != nil {
+			return err
+		}
+	}
+
+	a.krl = krl
+	a.krlVersion = version
+	return nil
+}
+
+// sshCAKeys returns the unique list of SSH user and host keys of the
+// authority.
+func (a *Authority) sshCAKeys() []ssh.PublicKey {
+	var keys []ssh.PublicKey
+	for _, k := range append(append([]ssh.PublicKey{}, a.sshCAUserCerts...), a.sshCAHostCerts...) {
+		var found bool
+		for _, kk := range keys {
+			if bytes.Equal(k.Marshal(), kk.Marshal()) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+func (a *Authority) startKRLGenerator() error {
+	if _, ok := a.db.(db.SSHRevocationListDB); !ok {
+		return errors.Errorf("KRL Generation requested, but database does not support KRL generation")
+	}
+
+	// Always create a new KRL on startup.
+	if err := a.GenerateSSHKeyRevocationList(); err != nil {
+		return errors.Wrap(err, "could not generate a KRL")
+	}
+
+	a.krlStopper = make(chan struct{}, 1)
+	a.krlTicker = time.NewTicker(a.config.SSH.GetKRL().TickerDuration())
+
+	go func() {
+		for {
+			select {
+			case <-a.krlTicker.C:
+				if err := a.GenerateSSHKeyRevocationList(); err != nil {
+					log.Printf("error regenerating the KRL: %v", err)
+				}
+			case <-a.krlStopper:
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// marshalKRL encodes an unsigned KRL with a certificates section for each CA
+// key revoking the given serial numbers.
+func marshalKRL(version uint64, generatedAt time.Time, caKeys []ssh.PublicKey, serials []uint64) []byte {
+	b := binary.BigEndian.AppendUint64(nil, krlMagic)
+	b = binary.BigEndian.AppendUint32(b, krlFormatVersion)
+	b = binary.BigEndian.AppendUint64(b, version)
+	b = binary.BigEndian.AppendUint64(b, uint64(generatedAt.Unix()))
+	b = binary.BigEndian.AppendUint64(b, 0) // flags
+	b = appendKRLString(b, nil)             // reserved
+	b = appendKRLString(b, nil)             // comment
+	if len(serials) == 0 {
+		return b
+	}
+
+	list := make([]byte, 0, 8*len(serials))
+	for _, sn := range serials {
+		list = binary.BigEndian.AppendUint64(list, sn)
+	}
+	for _, key := range caKeys {
+		section := appendKRLString(nil, key.Marshal())
+		section = appendKRLString(section, nil) // reserved
+		section = append(section, krlSectionCertSerialList)
+		section = appendKRLString(section, list)
+		b = append(b, krlSectionCertificates)
+		b = appendKRLString(b, section)
+	}
+	return b
+}
+
+func appendKRLString(b, s []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(s)))
+	return append(b, s...)
+}
+
+// writeKRL atomically writes the KRL in the given file.
+func writeKRL(filename string, krl []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*")
+	if err != nil {
+		return errors.Wrap(err, "error creating krl file")
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(krl); err != nil {
+		f.Close()
+		return errors.Wrap(err, "error writing krl file")
+	}
+	if err := f.Chmod(0o644); err != nil {
+		f.Close()
+		return errors.Wrap(err, "error writing krl file")
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "error writing krl file")
+	}
+	if err := os.Rename(f.Name(), filename); err != nil {
+		return errors.Wrapf(err, "error writing %s", filename)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package authority
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/db"
+)
+
+func TestAuthority_GenerateSSHKeyRevocationList(t *testing.T) {
+	now := time.Now()
+	a := testAuthority(t)
+	a.db = &db.MockAuthDB{
+		MGetRevokedSSHCertificates: func() (*[]db.RevokedCertificateInfo, error) {
+			return &[]db.RevokedCertificateInfo{
+				{Serial: "3"},
+				{Serial: "1", ExpiresAt: now.Add(time.Hour)},
+				{Serial: "2", ExpiresAt: now.Add(-time.Hour)},
+				{Serial: "3"},
+				{Serial: "not-a-number"},
+			}, nil
+		},
+	}
+
+	// KRL is not enabled
+	_, err := a.GetSSHKeyRevocationList(context.Background())
+	var sc render.StatusCodedError
+	if assert.True(t, errors.As(err, &sc)) {
+		assert.Equal(t, http.StatusNotFound, sc.StatusCode())
+	}
+	require.NoError(t, a.GenerateSSHKeyRevocationList())
+
+	filename := filepath.Join(t.TempDir(), "krl")
+	a.config.SSH.KRL = &config.KRLConfig{Enabled: true, File: filename}
+	_, err = a.GetSSHKeyRevocationList(context.Background())
+	assert.Error(t, err)
+
+	require.NoError(t, a.GenerateSSHKeyRevocationList())
+	krl, err := a.GetSSHKeyRevocationList(context.Background())
+	require.NoError(t, err)
+	b, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	assert.Equal(t, krl, b)
+
+	// Header
+	assert.Equal(t, "SSHKRL\n\x00", string(krl[:8]))
+	assert.Equal(t, uint32(1), binary.BigEndian.Uint32(krl[8:]))
+	version := binary.BigEndian.Uint64(krl[12:])
+	krl = krl[44:] // skip generated date, flags, reserved and comment
+
+	// A certificates section for each CA key
+	for _, key := range []ssh.PublicKey{a.sshCAUserCertSignKey.PublicKey(), a.sshCAHostCertSignKey.PublicKey()} {
+		assert.Equal(t, byte(1), krl[0])
+		section, rest := readKRLString(t, krl[1:])
+		caKey, section := readKRLString(t, section)
+		assert.Equal(t, key.Marshal(), caKey)
+		reserved, section := readKRLString(t, section)
+		assert.Empty(t, reserved)
+		assert.Equal(t, byte(0x20), section[0])
+		serials, section := readKRLString(t, section[1:])
+		assert.Equal(t, []byte{0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 3}, serials)
+		assert.Empty(t, section)
+		krl = rest
+	}
+	assert.Empty(t, krl)
+
+	// The version increases every time
+	require.NoError(t, a.GenerateSSHKeyRevocationList())
+	krl, err = a.GetSSHKeyRevocationList(context.Background())
+	require.NoError(t, err)
+	assert.Greater(t, binary.BigEndian.Uint64(krl[12:]), version)
+
+	t.Run("fail db", func(t *testing.T) {
+		a.db = &db.MockAuthDB{
+			MGetRevokedSSHCertificates: func() (*[]db.RevokedCertificateInfo, error) {
+				return nil, errors.New("force")
+			},
+		}
+		assert.EqualError(t, a.GenerateSSHKeyRevocationList(), "could not retrieve revoked ssh certificates list from database: force")
+	})
+}
+
+type testSSHRevoker struct {
+	admin.DB
+	revoked []string
+}
+
+func (r *testSSHRevoker) RevokeSSH(_ *ssh.Certificate, rci *db.RevokedCertificateInfo) error {
+	r.revoked = append(r.revoked, rci.Serial)
+	return nil
+}
+
+func TestAuthority_revokeSSH_linkedCA(t *testing.T) {
+	var stored []string
+	a := testAuthority(t)
+	a.db = &db.MockAuthDB{
+		MRevokeSSH: func(rci *db.RevokedCertificateInfo) error {
+			stored = append(stored, rci.Serial)
+			return nil
+		},
+	}
+	lca := &testSSHRevoker{}
+	a.adminDB = lca
+
+	// Without KRL the revocation is only sent to the linked CA.
+	require.NoError(t, a.revokeSSH(nil, &db.RevokedCertificateInfo{Serial: "1"}))
+	assert.Equal(t, []string{"1"}, lca.revoked)
+	assert.Empty(t, stored)
+
+	// With KRL the revocation is also stored in the database.
+	a.config.SSH.KRL = &config.KRLConfig{Enabled: true}
+	require.NoError(t, a.revokeSSH(nil, &db.RevokedCertificateInfo{Serial: "2"}))
+	assert.Equal(t, []string{"1", "2"}, lca.revoked)
+	assert.Equal(t, []string{"2"}, stored)
+}
+
+func Test_marshalKRL(t *testing.T) {
+	generatedAt := time.Unix(1700000000, 0)
+	assert.Equal(t, []byte{
+		'S', 'S', 'H', 'K', 'R', 'L', '\n', 0, // magic
+		0, 0, 0, 1, // format version
+		0, 0, 0, 0, 0, 0, 0, 7, // krl version
+		0, 0, 0, 0, 0x65, 0x53, 0xf1, 0x00, // generated date
+		0, 0, 0, 0, 0, 0, 0, 0, // flags
+		0, 0, 0, 0, // reserved
+		0, 0, 0, 0, // comment
+	}, marshalKRL(7, generatedAt, nil, nil))
+}
+
+func readKRLString(t *testing.T, b []byte) ([]byte, []byte) {
+	t.Helper()
+	require.GreaterOrEqual(t, len(b), 4)
+	n := binary.BigEndian.Uint32(b)
+	require.GreaterOrEqual(t, len(b), int(4+n))
+	return b[4 : 4+n], b[4+n:]
+}
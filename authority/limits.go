@@ -0,0 +1,135 @@
+package authority
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/errs"
+)
+
+// getLimits returns the authority limits, or nil if they are not configured.
+func (a *Authority) getLimits() *config.LimitsConfig {
+	if a.config == nil || a.config.AuthorityConfig == nil {
+		return nil
+	}
+	return a.config.AuthorityConfig.Limits
+}
+
+// getBackdate returns the configured backdate, it is not counted in the
+// validity of the certificates.
+func (a *Authority) getBackdate() time.Duration {
+	if a.config == nil || a.config.AuthorityConfig == nil || a.config.AuthorityConfig.Backdate == nil {
+		return 0
+	}
+	return a.config.AuthorityConfig.Backdate.Duration
+}
+
+// checkX509Limits returns a forbidden error if the X.509 certificate with the
+// given lifetime, not including the backdate, exceeds the limits configured in
+// the authority. The limits are enforced for every provisioner, in addition to
+// the provisioner claims and options.
+func (a *Authority) checkX509Limits(leaf *x509.Certificate, lifetime time.Duration) error {
+	limits := a.getLimits()
+	if limits == nil {
+		return nil
+	}
+
+	if limits.MaxSANs > 0 {
+		n, err := countX509SANs(leaf)
+		if err != nil {
+			return errs.ForbiddenErr(err, "%s", err)
+		}
+		if n > limits.MaxSANs {
+			return errs.Forbidden("certificate has %d subject alternative names, the maximum allowed is %d", n, limits.MaxSANs)
+		}
+	}
+	if limits.MaxSubjectLength > 0 {
+		if n := len(leaf.Subject.String()); n > limits.MaxSubjectLength {
+			return errs.Forbidden("certificate subject has %d characters, the maximum allowed is %d", n, limits.MaxSubjectLength)
+		}
+	}
+	if limits.MaxValidity != nil && limits.MaxValidity.Duration > 0 {
+		if lifetime > limits.MaxValidity.Duration {
+			return errs.Forbidden("certificate validity of %s exceeds the maximum allowed of %s", lifetime, limits.MaxValidity.Duration)
+		}
+	}
+	return nil
+}
+
+var oidExtensionSubjectAltName = asn1.ObjectIdentifier{2, 5, 29, 17}
+
+// countX509SANs returns the number of SANs in the certificate. If the
+// certificate has a subject alternative name extension, all the names in it
+// are counted, including the otherName and other types not available in the
+// certificate fields.
+func countX509SANs(leaf *x509.Certificate) (int, error) {
+	for _, exts := range [][]pkix.Extension{leaf.ExtraExtensions, leaf.Extensions} {
+		for _, ext := range exts {
+			if !ext.Id.Equal(oidExtensionSubjectAltName) {
+				continue
+			}
+			var names []asn1.RawValue
+			if rest, err := asn1.Unmarshal(ext.Value, &names); err != nil || len(rest) > 0 {
+				return 0, fmt.Errorf("certificate has an invalid subject alternative name extension")
+			}
+			return len(names), nil
+		}
+	}
+	return len(leaf.DNSNames) + len(leaf.EmailAddresses) + len(leaf.IPAddresses) + len(leaf.URIs), nil
+}
+
+// validateLimits returns an error if the chain issued by the authority, the
+// leaf and the intermediates, is longer than the configured maximum.
+func (a *Authority) validateLimits() error {
+	limits := a.getLimits()
+	if limits == nil || limits.MaxChainLength <= 0 {
+		return nil
+	}
+	if n := 1 + len(a.getIntermediates()); n > limits.MaxChainLength {
+		return fmt.Errorf("authority.limits.maxChainLength %d is less than the length of the issued chain, %d", limits.MaxChainLength, n)
+	}
+	return nil
+}
+
+// checkX509ChainLimits returns a forbidden error if the chain that would be
+// issued with the current intermediates has more certificates than the
+// configured maximum. It is checked before signing, because the intermediates
+// can change after the initialization.
+func (a *Authority) checkX509ChainLimits() error {
+	limits := a.getLimits()
+	if limits == nil || limits.MaxChainLength <= 0 {
+		return nil
+	}
+	if n := 1 + len(a.getIntermediates()); n > limits.MaxChainLength {
+		return errs.Forbidden("certificate chain has %d certificates, the maximum allowed is %d", n, limits.MaxChainLength)
+	}
+	return nil
+}
+
+// checkSSHLimits returns a forbidden error if the SSH certificate exceeds the
+// limits configured in the authority.
+func (a *Authority) checkSSHLimits(cert *ssh.Certificate) error {
+	limits := a.getLimits()
+	if limits == nil {
+		return nil
+	}
+
+	if limits.MaxSANs > 0 {
+		if n := len(cert.ValidPrincipals); n > limits.MaxSANs {
+			return errs.Forbidden("ssh certificate has %d principals, the maximum allowed is %d", n, limits.MaxSANs)
+		}
+	}
+	if limits.MaxValidity != nil && limits.MaxValidity.Duration > 0 {
+		maxSeconds := uint64((limits.MaxValidity.Duration + a.getBackdate()) / time.Second)
+		if cert.ValidBefore < cert.ValidAfter || cert.ValidBefore-cert.ValidAfter > maxSeconds {
+			return errs.Forbidden("ssh certificate validity exceeds the maximum allowed of %s", limits.MaxValidity.Duration)
+		}
+	}
+	return nil
+}
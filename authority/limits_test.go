@@ -0,0 +1,145 @@
+package authority
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func assertForbidden(t *testing.T, err error) {
+	t.Helper()
+	var sc render.StatusCodedError
+	require.ErrorAs(t, err, &sc)
+	assert.Equal(t, http.StatusForbidden, sc.StatusCode())
+}
+
+func newLimitsAuthority(limits *config.LimitsConfig) *Authority {
+	return &Authority{config: &config.Config{
+		AuthorityConfig: &config.AuthConfig{
+			Backdate: &provisioner.Duration{Duration: time.Minute},
+			Limits:   limits,
+		},
+	}}
+}
+
+func TestAuthority_checkX509Limits(t *testing.T) {
+	leaf := &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "foo.example.com", Organization: []string{"Smallstep"}},
+		DNSNames:       []string{"foo.example.com", "bar.example.com"},
+		EmailAddresses: []string{"jane@example.com"},
+		IPAddresses:    []net.IP{net.ParseIP("10.1.2.3")},
+		URIs:           []*url.URL{{Scheme: "spiffe", Host: "example.com", Path: "/foo"}},
+	}
+	tests := []struct {
+		name     string
+		limits   *config.LimitsConfig
+		lifetime time.Duration
+		wantErr  bool
+	}{
+		{"ok no limits", nil, 1000 * time.Hour, false},
+		{"ok empty", &config.LimitsConfig{}, 1000 * time.Hour, false},
+		{"ok", &config.LimitsConfig{
+			MaxSANs:          5,
+			MaxSubjectLength: len("O=Smallstep,CN=foo.example.com"),
+			MaxValidity:      &provisioner.Duration{Duration: 24 * time.Hour},
+		}, 24 * time.Hour, false},
+		{"fail sans", &config.LimitsConfig{MaxSANs: 4}, time.Hour, true},
+		{"fail subject", &config.LimitsConfig{MaxSubjectLength: 10}, time.Hour, true},
+		{"fail validity", &config.LimitsConfig{MaxValidity: &provisioner.Duration{Duration: 24 * time.Hour}}, 25 * time.Hour, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newLimitsAuthority(tt.limits)
+			err := a.checkX509Limits(leaf, tt.lifetime)
+			if tt.wantErr {
+				assertForbidden(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestAuthority_checkX509Limits_extension(t *testing.T) {
+	// The otherName SANs are only available in the extension.
+	value, err := asn1.Marshal([]asn1.RawValue{
+		{Class: asn1.ClassContextSpecific, Tag: 2, Bytes: []byte("foo.example.com")},
+		{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: []byte{0x06, 0x01, 0x2a, 0xa0, 0x02, 0x05, 0x00}},
+	})
+	require.NoError(t, err)
+	leaf := &x509.Certificate{
+		DNSNames:        []string{"foo.example.com"},
+		ExtraExtensions: []pkix.Extension{{Id: oidExtensionSubjectAltName, Value: value}},
+	}
+	assert.NoError(t, newLimitsAuthority(&config.LimitsConfig{MaxSANs: 2}).checkX509Limits(leaf, time.Hour))
+	assertForbidden(t, newLimitsAuthority(&config.LimitsConfig{MaxSANs: 1}).checkX509Limits(leaf, time.Hour))
+
+	leaf.ExtraExtensions[0].Value = []byte("invalid")
+	assertForbidden(t, newLimitsAuthority(&config.LimitsConfig{MaxSANs: 2}).checkX509Limits(leaf, time.Hour))
+}
+
+func TestAuthority_checkX509ChainLimits(t *testing.T) {
+	newAuthority := func(limits *config.LimitsConfig) *Authority {
+		a := newLimitsAuthority(limits)
+		a.intermediateX509Certs = []*x509.Certificate{{}, {}}
+		return a
+	}
+	assert.NoError(t, newAuthority(nil).checkX509ChainLimits())
+	assert.NoError(t, newAuthority(&config.LimitsConfig{MaxChainLength: 3}).checkX509ChainLimits())
+	assertForbidden(t, newAuthority(&config.LimitsConfig{MaxChainLength: 2}).checkX509ChainLimits())
+
+	assert.NoError(t, newAuthority(nil).validateLimits())
+	assert.NoError(t, newAuthority(&config.LimitsConfig{MaxChainLength: 3}).validateLimits())
+	assert.EqualError(t, newAuthority(&config.LimitsConfig{MaxChainLength: 2}).validateLimits(),
+		"authority.limits.maxChainLength 2 is less than the length of the issued chain, 3")
+}
+
+func TestAuthority_checkSSHLimits(t *testing.T) {
+	now := time.Now()
+	newCert := func(d time.Duration, principals ...string) *ssh.Certificate {
+		return &ssh.Certificate{
+			ValidPrincipals: principals,
+			ValidAfter:      uint64(now.Add(-time.Minute).Unix()),
+			ValidBefore:     uint64(now.Add(d).Unix()),
+		}
+	}
+	tests := []struct {
+		name    string
+		limits  *config.LimitsConfig
+		cert    *ssh.Certificate
+		wantErr bool
+	}{
+		{"ok no limits", nil, newCert(1000*time.Hour, "foo", "bar"), false},
+		{"ok", &config.LimitsConfig{
+			MaxSANs:     2,
+			MaxValidity: &provisioner.Duration{Duration: 16 * time.Hour},
+		}, newCert(16*time.Hour, "foo", "bar"), false},
+		{"fail principals", &config.LimitsConfig{MaxSANs: 1}, newCert(time.Hour, "foo", "bar"), true},
+		{"fail validity", &config.LimitsConfig{MaxValidity: &provisioner.Duration{Duration: 16 * time.Hour}}, newCert(17*time.Hour, "foo"), true},
+		{"fail invalid validity", &config.LimitsConfig{MaxValidity: &provisioner.Duration{Duration: 16 * time.Hour}}, newCert(-time.Hour, "foo"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newLimitsAuthority(tt.limits)
+			err := a.checkSSHLimits(tt.cert)
+			if tt.wantErr {
+				assertForbidden(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
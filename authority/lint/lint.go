@@ -0,0 +1,221 @@
+// Package lint implements checks on issued X.509 certificates based on a
+// subset of the CA/Browser Forum baseline requirements.
+package lint
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Names of the built-in lints.
+const (
+	// SANTypes checks that the subject alternative names are well formed.
+	SANTypes = "san_types"
+	// CommonNameOnly checks that the certificate does not identify the subject
+	// only with the deprecated common name.
+	CommonNameOnly = "cn_only"
+	// Validity checks that the validity period of the certificate is bounded.
+	Validity = "validity"
+	// ExtKeyUsage checks that the certificate contains the required extended
+	// key usages.
+	ExtKeyUsage = "ext_key_usage"
+)
+
+var oidExtensionSubjectAltName = asn1.ObjectIdentifier{2, 5, 29, 17}
+
+// DefaultMaxValidity is the maximum validity of a leaf certificate allowed by
+// the CA/Browser Forum baseline requirements.
+const DefaultMaxValidity = 398 * 24 * time.Hour
+
+// Linter is the interface implemented by the certificate lints.
+type Linter interface {
+	// Name returns the name of the lint.
+	Name() string
+	// Lint returns an error if the certificate does not satisfy the lint.
+	Lint(crt *x509.Certificate) error
+}
+
+type linterFunc struct {
+	name string
+	fn   func(crt *x509.Certificate) error
+}
+
+func (l *linterFunc) Name() string                     { return l.name }
+func (l *linterFunc) Lint(crt *x509.Certificate) error { return l.fn(crt) }
+
+// New returns a Linter with the given name that runs the given function.
+func New(name string, fn func(crt *x509.Certificate) error) Linter {
+	return &linterFunc{name: name, fn: fn}
+}
+
+// Options are the options used to create the built-in lints.
+type Options struct {
+	// MaxValidity is the maximum validity period of a certificate. If it's not
+	// set DefaultMaxValidity will be used.
+	MaxValidity time.Duration
+	// Skip is the list of the built-in lints that will not be run.
+	Skip []string
+}
+
+// Builtin returns the built-in lints, except the ones skipped in the options.
+func Builtin(o *Options) []Linter {
+	if o == nil {
+		o = &Options{}
+	}
+	maxValidity := o.MaxValidity
+	if maxValidity <= 0 {
+		maxValidity = DefaultMaxValidity
+	}
+
+	linters := []Linter{
+		New(SANTypes, lintSANTypes),
+		New(CommonNameOnly, lintCommonNameOnly),
+		New(Validity, func(crt *x509.Certificate) error {
+			return lintValidity(crt, maxValidity)
+		}),
+		New(ExtKeyUsage, lintExtKeyUsage),
+	}
+
+	var ret []Linter
+	for _, l := range linters {
+		if !slices.Contains(o.Skip, l.Name()) {
+			ret = append(ret, l)
+		}
+	}
+	return ret
+}
+
+// Finding is the result of a failed lint.
+type Finding struct {
+	Lint string
+	Err  error
+}
+
+// Error is the error returned by Lint when one or more lints fail.
+type Error struct {
+	Findings []Finding
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	s := make([]string, len(e.Findings))
+	for i, f := range e.Findings {
+		s[i] = f.Lint + ": " + f.Err.Error()
+	}
+	return "certificate failed lint checks: " + strings.Join(s, "; ")
+}
+
+// Lint runs the given linters on the certificate and returns an *Error with
+// all the findings if any of them fails.
+func Lint(crt *x509.Certificate, linters ...Linter) error {
+	var findings []Finding
+	for _, l := range linters {
+		if err := l.Lint(crt); err != nil {
+			findings = append(findings, Finding{Lint: l.Name(), Err: err})
+		}
+	}
+	if len(findings) > 0 {
+		return &Error{Findings: findings}
+	}
+	return nil
+}
+
+func lintSANTypes(crt *x509.Certificate) error {
+	for _, name := range crt.DNSNames {
+		if err := validateDNSName(name); err != nil {
+			return err
+		}
+	}
+	for _, email := range crt.EmailAddresses {
+		if i := strings.LastIndex(email, "@"); i <= 0 || i == len(email)-1 {
+			return fmt.Errorf("email address %q is not valid", email)
+		}
+	}
+	for _, ip := range crt.IPAddresses {
+		if len(ip) != net.IPv4len && len(ip) != net.IPv6len {
+			return fmt.Errorf("ip address %v is not valid", ip)
+		}
+	}
+	for _, u := range crt.URIs {
+		if u.Scheme == "" {
+			return fmt.Errorf("uri %q does not have a scheme", u)
+		}
+	}
+	return nil
+}
+
+func validateDNSName(name string) error {
+	if name == "" || len(name) > 253 {
+		return fmt.Errorf("dns name %q is not valid", name)
+	}
+	labels := strings.Split(name, ".")
+	for i, label := range labels {
+		if label == "*" && i == 0 && len(labels) > 2 {
+			continue
+		}
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return fmt.Errorf("dns name %q is not valid", name)
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return fmt.Errorf("dns name %q is not valid", name)
+			}
+		}
+	}
+	return nil
+}
+
+func lintCommonNameOnly(crt *x509.Certificate) error {
+	if crt.IsCA {
+		return nil
+	}
+	if len(crt.DNSNames) == 0 && len(crt.IPAddresses) == 0 && len(crt.EmailAddresses) == 0 && len(crt.URIs) == 0 && !hasSANExtension(crt) {
+		if crt.Subject.CommonName != "" {
+			return fmt.Errorf("common name %q is not included in the subject alternative names", crt.Subject.CommonName)
+		}
+		return errors.New("certificate does not contain subject alternative names")
+	}
+	return nil
+}
+
+func lintValidity(crt *x509.Certificate, maxValidity time.Duration) error {
+	if !crt.NotAfter.After(crt.NotBefore) {
+		return fmt.Errorf("notAfter %s is not after notBefore %s", crt.NotAfter, crt.NotBefore)
+	}
+	if d := crt.NotAfter.Sub(crt.NotBefore); d > maxValidity {
+		return fmt.Errorf("validity period %s is greater than %s", d, maxValidity)
+	}
+	return nil
+}
+
+func lintExtKeyUsage(crt *x509.Certificate) error {
+	if crt.IsCA {
+		return nil
+	}
+	if len(crt.ExtKeyUsage) == 0 && len(crt.UnknownExtKeyUsage) == 0 {
+		return errors.New("certificate does not contain extended key usages")
+	}
+	for _, eku := range crt.ExtKeyUsage {
+		if eku == x509.ExtKeyUsageAny {
+			return errors.New("certificate contains the any extended key usage")
+		}
+	}
+	return nil
+}
+
+// hasSANExtension returns true if the certificate contains a subject
+// alternative name extension, for example, with only otherName values.
+func hasSANExtension(crt *x509.Certificate) bool {
+	for _, ext := range crt.Extensions {
+		if ext.Id.Equal(oidExtensionSubjectAltName) {
+			return true
+		}
+	}
+	return false
+}
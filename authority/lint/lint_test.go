@@ -0,0 +1,109 @@
+package lint
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuiltin(t *testing.T) {
+	now := time.Now()
+	compliant := func() *x509.Certificate {
+		return &x509.Certificate{
+			Subject:        pkix.Name{CommonName: "test.smallstep.com"},
+			DNSNames:       []string{"test.smallstep.com", "*.smallstep.com"},
+			IPAddresses:    []net.IP{net.ParseIP("127.0.0.1")},
+			EmailAddresses: []string{"jane@smallstep.com"},
+			URIs:           []*url.URL{{Scheme: "spiffe", Host: "smallstep.com", Path: "/jane"}},
+			ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+			NotBefore:      now,
+			NotAfter:       now.Add(24 * time.Hour),
+		}
+	}
+	with := func(fn func(crt *x509.Certificate)) *x509.Certificate {
+		crt := compliant()
+		fn(crt)
+		return crt
+	}
+
+	tests := []struct {
+		name    string
+		opts    *Options
+		crt     *x509.Certificate
+		want    []string
+		wantErr bool
+	}{
+		{"ok", nil, compliant(), nil, false},
+		{"ok ca", nil, with(func(crt *x509.Certificate) {
+			crt.IsCA = true
+			crt.DNSNames, crt.IPAddresses, crt.EmailAddresses, crt.URIs, crt.ExtKeyUsage = nil, nil, nil, nil, nil
+		}), nil, false},
+		{"ok skip", &Options{Skip: []string{ExtKeyUsage}}, with(func(crt *x509.Certificate) {
+			crt.ExtKeyUsage = nil
+		}), nil, false},
+		{"fail dns name", nil, with(func(crt *x509.Certificate) {
+			crt.DNSNames = []string{"foo..smallstep.com"}
+		}), []string{SANTypes}, true},
+		{"fail wildcard", nil, with(func(crt *x509.Certificate) {
+			crt.DNSNames = []string{"foo.*.smallstep.com"}
+		}), []string{SANTypes}, true},
+		{"fail email", nil, with(func(crt *x509.Certificate) {
+			crt.EmailAddresses = []string{"jane@"}
+		}), []string{SANTypes}, true},
+		{"fail uri", nil, with(func(crt *x509.Certificate) {
+			crt.URIs = []*url.URL{{Path: "jane"}}
+		}), []string{SANTypes}, true},
+		{"fail cn only", nil, with(func(crt *x509.Certificate) {
+			crt.DNSNames, crt.IPAddresses, crt.EmailAddresses, crt.URIs = nil, nil, nil, nil
+		}), []string{CommonNameOnly}, true},
+		{"fail validity", nil, with(func(crt *x509.Certificate) {
+			crt.NotAfter = now.Add(DefaultMaxValidity + time.Second)
+		}), []string{Validity}, true},
+		{"fail validity max", &Options{MaxValidity: time.Hour}, compliant(), []string{Validity}, true},
+		{"fail validity bounds", nil, with(func(crt *x509.Certificate) {
+			crt.NotAfter = now.Add(-time.Hour)
+		}), []string{Validity}, true},
+		{"fail ext key usage", nil, with(func(crt *x509.Certificate) {
+			crt.ExtKeyUsage = nil
+		}), []string{ExtKeyUsage}, true},
+		{"fail any ext key usage", nil, with(func(crt *x509.Certificate) {
+			crt.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageAny}
+		}), []string{ExtKeyUsage}, true},
+		{"fail multiple", nil, with(func(crt *x509.Certificate) {
+			crt.DNSNames, crt.IPAddresses, crt.EmailAddresses, crt.URIs, crt.ExtKeyUsage = nil, nil, nil, nil, nil
+		}), []string{CommonNameOnly, ExtKeyUsage}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Lint(tt.crt, Builtin(tt.opts)...)
+			if !tt.wantErr {
+				assert.NoError(t, err)
+				return
+			}
+			var le *Error
+			if assert.ErrorAs(t, err, &le) {
+				var got []string
+				for _, f := range le.Findings {
+					got = append(got, f.Lint)
+				}
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestLint_custom(t *testing.T) {
+	crt := &x509.Certificate{Subject: pkix.Name{CommonName: "test"}}
+	ok := New("ok", func(*x509.Certificate) error { return nil })
+	fail := New("fail", func(*x509.Certificate) error { return errors.New("bad certificate") })
+
+	assert.NoError(t, Lint(crt))
+	assert.NoError(t, Lint(crt, ok))
+	assert.EqualError(t, Lint(crt, ok, fail), "certificate failed lint checks: fail: bad certificate")
+}
@@ -14,6 +14,7 @@ import (
 
 	"github.com/smallstep/certificates/authority/admin"
 	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/lint"
 	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/cas"
 	casapi "github.com/smallstep/certificates/cas/apiv1"
@@ -103,6 +104,15 @@ func WithWebhookClient(c *http.Client) Option {
 	}
 }
 
+// WithReloadFunc sets the function used to reload the configuration of the
+// CA using the admin API.
+func WithReloadFunc(fn ReloadFunc) Option {
+	return func(a *Authority) error {
+		a.reloadFunc = fn
+		return nil
+	}
+}
+
 // WithGetIdentityFunc sets a custom function to retrieve the identity from
 // an external resource.
 func WithGetIdentityFunc(fn func(ctx context.Context, p provisioner.Interface, email string) (*provisioner.Identity, error)) Option {
@@ -288,6 +298,16 @@ func WithX509FederatedCerts(certs ...*x509.Certificate) Option {
 	}
 }
 
+// WithX509AlternateChains is an option that allows to define the alternate
+// chains of intermediates offered to the ACME clients. This option will replace
+// any alternate chain defined before.
+func WithX509AlternateChains(chains ...[]*x509.Certificate) Option {
+	return func(a *Authority) error {
+		a.alternateX509Chains = chains
+		return nil
+	}
+}
+
 // WithX509IntermediateCerts is an option that allows to define the list of
 // intermediate certificates that the CA will be using. This option will replace
 // any intermediate certificate defined before.
@@ -370,6 +390,16 @@ func WithX509Enforcers(ces ...provisioner.CertificateEnforcer) Option {
 	}
 }
 
+// WithX509Linters is an option that allows to define custom lints that will be
+// run on the issued certificates, in addition to the built-in ones enabled in
+// the configuration.
+func WithX509Linters(linters ...lint.Linter) Option {
+	return func(a *Authority) error {
+		a.x509Linters = linters
+		return nil
+	}
+}
+
 // WithSkipInit is an option that allows the constructor to skip initializtion
 // of the authority.
 func WithSkipInit() Option {
@@ -204,6 +204,27 @@ func (a *Authority) checkPolicy(_ context.Context, currentAdmin *linkedca.Admin,
 	return nil
 }
 
+// getX509PolicyOptions returns the X.509 authority policy options currently in
+// use, either from the admin database or the configuration.
+func (a *Authority) getX509PolicyOptions(ctx context.Context) (*authPolicy.X509PolicyOptions, error) {
+	if !a.config.AuthorityConfig.EnableAdmin {
+		return a.config.AuthorityConfig.Policy.GetX509Options(), nil
+	}
+	if _, ok := a.adminDB.(*linkedCaClient); ok {
+		return nil, nil
+	}
+
+	linkedPolicy, err := a.adminDB.GetAuthorityPolicy(ctx)
+	if err != nil {
+		var ae *admin.Error
+		if errors.As(err, &ae) && ae.Type == admin.ErrorNotFoundType.String() {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error getting authority policy: %w", err)
+	}
+	return authPolicy.LinkedToCertificates(linkedPolicy).GetX509Options(), nil
+}
+
 // reloadPolicyEngines reloads x509 and SSH policy engines using
 // configuration stored in the DB or from the configuration file.
 func (a *Authority) reloadPolicyEngines(ctx context.Context) error {
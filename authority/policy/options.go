@@ -1,5 +1,9 @@
 package policy
 
+import (
+	"github.com/smallstep/certificates/policy"
+)
+
 // Options is a container for authority level x509 and SSH
 // policy configuration.
 type Options struct {
@@ -54,6 +58,9 @@ type X509NameOptions struct {
 	IPRanges       []string `json:"ip,omitempty"`
 	EmailAddresses []string `json:"email,omitempty"`
 	URIDomains     []string `json:"uri,omitempty"`
+
+	// Subject contains the values of the subject attributes
+	Subject *X509SubjectOptions `json:"subject,omitempty"`
 }
 
 // HasNames checks if the AllowedNameOptions has one or more
@@ -63,7 +70,50 @@ func (o *X509NameOptions) HasNames() bool {
 		len(o.DNSDomains) > 0 ||
 		len(o.IPRanges) > 0 ||
 		len(o.EmailAddresses) > 0 ||
-		len(o.URIDomains) > 0
+		len(o.URIDomains) > 0 ||
+		o.Subject.HasValues()
+}
+
+// X509SubjectOptions models the X509 policy configuration of the
+// attributes of the subject distinguished name, other than the
+// common name.
+type X509SubjectOptions struct {
+	Organization       []string `json:"organization,omitempty"`
+	OrganizationalUnit []string `json:"organizationalUnit,omitempty"`
+	Country            []string `json:"country,omitempty"`
+	Locality           []string `json:"locality,omitempty"`
+	Province           []string `json:"province,omitempty"`
+	SerialNumber       []string `json:"serialNumber,omitempty"`
+}
+
+// HasValues checks if the X509SubjectOptions has one or more
+// values configured.
+func (o *X509SubjectOptions) HasValues() bool {
+	if o == nil {
+		return false
+	}
+	return len(o.Organization) > 0 ||
+		len(o.OrganizationalUnit) > 0 ||
+		len(o.Country) > 0 ||
+		len(o.Locality) > 0 ||
+		len(o.Province) > 0 ||
+		len(o.SerialNumber) > 0
+}
+
+// subjectAttributes returns the values of the subject attributes indexed by
+// the name type used in the policy engine.
+func (o *X509SubjectOptions) subjectAttributes() map[policy.NameType][]string {
+	if o == nil {
+		return nil
+	}
+	return map[policy.NameType][]string{
+		policy.OrganizationNameType:       o.Organization,
+		policy.OrganizationalUnitNameType: o.OrganizationalUnit,
+		policy.CountryNameType:            o.Country,
+		policy.LocalityNameType:           o.Locality,
+		policy.ProvinceNameType:           o.Province,
+		policy.SerialNumberNameType:       o.SerialNumber,
+	}
 }
 
 // GetAllowedNameOptions returns x509 allowed name policy configuration
@@ -43,3 +43,24 @@ func TestX509PolicyOptions_IsWildcardLiteralAllowed(t *testing.T) {
 		})
 	}
 }
+
+func TestX509NameOptions_HasNames(t *testing.T) {
+	tests := []struct {
+		name    string
+		options *X509NameOptions
+		want    bool
+	}{
+		{"empty", &X509NameOptions{}, false},
+		{"empty subject", &X509NameOptions{Subject: &X509SubjectOptions{}}, false},
+		{"dns", &X509NameOptions{DNSDomains: []string{"*.local"}}, true},
+		{"subject", &X509NameOptions{Subject: &X509SubjectOptions{Organization: []string{"Smallstep"}}}, true},
+		{"subject serial number", &X509NameOptions{Subject: &X509SubjectOptions{SerialNumber: []string{"*"}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.options.HasNames(); got != tt.want {
+				t.Errorf("X509NameOptions.HasNames() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -35,6 +35,11 @@ func NewX509PolicyEngine(policyOptions X509PolicyOptionsInterface) (X509Policy,
 			policy.WithPermittedEmailAddresses(allowed.EmailAddresses...),
 			policy.WithPermittedURIDomains(allowed.URIDomains...),
 		)
+		for nameType, values := range allowed.Subject.subjectAttributes() {
+			if len(values) > 0 {
+				options = append(options, policy.WithPermittedSubjectAttributes(nameType, values...))
+			}
+		}
 	}
 
 	denied := policyOptions.GetDeniedNameOptions()
@@ -46,6 +51,11 @@ func NewX509PolicyEngine(policyOptions X509PolicyOptionsInterface) (X509Policy,
 			policy.WithExcludedEmailAddresses(denied.EmailAddresses...),
 			policy.WithExcludedURIDomains(denied.URIDomains...),
 		)
+		for nameType, values := range denied.Subject.subjectAttributes() {
+			if len(values) > 0 {
+				options = append(options, policy.WithExcludedSubjectAttributes(nameType, values...))
+			}
+		}
 	}
 
 	// ensure no policy engine is returned when no name options were provided
@@ -251,3 +261,83 @@ func LinkedToCertificates(p *linkedca.Policy) *Options {
 
 	return opts
 }
+
+// CertificatesToLinked converts the policy options to a linkedca.Policy, it is
+// the counterpart of LinkedToCertificates.
+func CertificatesToLinked(o *Options) *linkedca.Policy {
+	// return early
+	if o == nil {
+		return nil
+	}
+
+	// return early if x509 nor SSH is set
+	if o.GetX509Options() == nil && o.GetSSHOptions() == nil {
+		return nil
+	}
+
+	p := &linkedca.Policy{}
+
+	// fill x509 policy configuration
+	if x509 := o.GetX509Options(); x509 != nil {
+		p.X509 = &linkedca.X509Policy{
+			AllowWildcardNames: x509.AllowWildcardNames,
+		}
+		if allow := x509.GetAllowedNameOptions(); allow != nil {
+			p.X509.Allow = &linkedca.X509Names{
+				Dns:         allow.DNSDomains,
+				Ips:         allow.IPRanges,
+				Emails:      allow.EmailAddresses,
+				Uris:        allow.URIDomains,
+				CommonNames: allow.CommonNames,
+			}
+		}
+		if deny := x509.GetDeniedNameOptions(); deny != nil {
+			p.X509.Deny = &linkedca.X509Names{
+				Dns:         deny.DNSDomains,
+				Ips:         deny.IPRanges,
+				Emails:      deny.EmailAddresses,
+				Uris:        deny.URIDomains,
+				CommonNames: deny.CommonNames,
+			}
+		}
+	}
+
+	// fill ssh policy configuration
+	if ssh := o.GetSSHOptions(); ssh != nil {
+		p.Ssh = &linkedca.SSHPolicy{}
+		if host := ssh.Host; host != nil {
+			p.Ssh.Host = &linkedca.SSHHostPolicy{}
+			if allow := host.AllowedNames; allow != nil {
+				p.Ssh.Host.Allow = &linkedca.SSHHostNames{
+					Dns:        allow.DNSDomains,
+					Ips:        allow.IPRanges,
+					Principals: allow.Principals,
+				}
+			}
+			if deny := host.DeniedNames; deny != nil {
+				p.Ssh.Host.Deny = &linkedca.SSHHostNames{
+					Dns:        deny.DNSDomains,
+					Ips:        deny.IPRanges,
+					Principals: deny.Principals,
+				}
+			}
+		}
+		if user := ssh.User; user != nil {
+			p.Ssh.User = &linkedca.SSHUserPolicy{}
+			if allow := user.AllowedNames; allow != nil {
+				p.Ssh.User.Allow = &linkedca.SSHUserNames{
+					Emails:     allow.EmailAddresses,
+					Principals: allow.Principals,
+				}
+			}
+			if deny := user.DeniedNames; deny != nil {
+				p.Ssh.User.Deny = &linkedca.SSHUserNames{
+					Emails:     deny.EmailAddresses,
+					Principals: deny.Principals,
+				}
+			}
+		}
+	}
+
+	return p
+}
@@ -1,11 +1,17 @@
 package policy
 
 import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/proto"
 
 	"go.step.sm/linkedca"
+
+	"github.com/smallstep/certificates/policy"
 )
 
 func TestPolicyToCertificates(t *testing.T) {
@@ -153,3 +159,124 @@ func TestPolicyToCertificates(t *testing.T) {
 		})
 	}
 }
+
+func TestCertificatesToLinked(t *testing.T) {
+	full := &linkedca.Policy{
+		X509: &linkedca.X509Policy{
+			Allow: &linkedca.X509Names{
+				Dns:         []string{"*.local"},
+				Ips:         []string{"192.168.0.1/24"},
+				Emails:      []string{"@example.com"},
+				Uris:        []string{"*.example.com"},
+				CommonNames: []string{"some name"},
+			},
+			Deny: &linkedca.X509Names{
+				Dns:         []string{"badhost.local"},
+				Ips:         []string{"192.168.0.30"},
+				Emails:      []string{"root@example.com"},
+				Uris:        []string{"bad.example.com"},
+				CommonNames: []string{"another name"},
+			},
+			AllowWildcardNames: true,
+		},
+		Ssh: &linkedca.SSHPolicy{
+			User: &linkedca.SSHUserPolicy{
+				Allow: &linkedca.SSHUserNames{
+					Emails:     []string{"@example.com"},
+					Principals: []string{"*"},
+				},
+				Deny: &linkedca.SSHUserNames{
+					Emails:     []string{"root@example.com"},
+					Principals: []string{"root"},
+				},
+			},
+			Host: &linkedca.SSHHostPolicy{
+				Allow: &linkedca.SSHHostNames{
+					Dns:        []string{"*.localhost"},
+					Ips:        []string{"192.168.0.1/24"},
+					Principals: []string{"*"},
+				},
+				Deny: &linkedca.SSHHostNames{
+					Dns:        []string{"badhost.localhost"},
+					Ips:        []string{"192.168.0.40"},
+					Principals: []string{"root"},
+				},
+			},
+		},
+	}
+	tests := []struct {
+		name    string
+		options *Options
+		want    *linkedca.Policy
+	}{
+		{"nil", nil, nil},
+		{"empty", &Options{}, nil},
+		{"x509", &Options{X509: &X509PolicyOptions{
+			AllowedNames: &X509NameOptions{DNSDomains: []string{"*.local"}},
+		}}, &linkedca.Policy{X509: &linkedca.X509Policy{
+			Allow: &linkedca.X509Names{Dns: []string{"*.local"}},
+		}}},
+		{"full", LinkedToCertificates(full), full},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CertificatesToLinked(tt.options)
+			if !proto.Equal(tt.want, got) {
+				t.Errorf("CertificatesToLinked() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewX509PolicyEngine_subject(t *testing.T) {
+	engine, err := NewX509PolicyEngine(&X509PolicyOptions{
+		AllowedNames: &X509NameOptions{
+			DNSDomains: []string{"*.example.com"},
+			Subject: &X509SubjectOptions{
+				Organization: []string{"Smallstep Labs"},
+				Country:      []string{"US", "CA"},
+			},
+		},
+		DeniedNames: &X509NameOptions{
+			Subject: &X509SubjectOptions{
+				OrganizationalUnit: []string{"*"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewX509PolicyEngine() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		subject  pkix.Name
+		wantType policy.NameType
+	}{
+		{"ok", pkix.Name{CommonName: "www.example.com", Organization: []string{"Smallstep Labs"}, Country: []string{"us"}}, ""},
+		{"ok no attributes", pkix.Name{CommonName: "www.example.com"}, ""},
+		{"fail organization", pkix.Name{CommonName: "www.example.com", Organization: []string{"Smallstep Labs", "Evil Corp"}}, policy.OrganizationNameType},
+		{"fail country", pkix.Name{CommonName: "www.example.com", Country: []string{"FR"}}, policy.CountryNameType},
+		{"fail organizational unit", pkix.Name{CommonName: "www.example.com", OrganizationalUnit: []string{"Engineering"}}, policy.OrganizationalUnitNameType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := engine.IsX509CertificateAllowed(&x509.Certificate{
+				Subject:  tt.subject,
+				DNSNames: []string{"www.example.com"},
+			})
+			if tt.wantType == "" {
+				if err != nil {
+					t.Errorf("IsX509CertificateAllowed() error = %v", err)
+				}
+				return
+			}
+			var npe *policy.NamePolicyError
+			if !errors.As(err, &npe) {
+				t.Fatalf("IsX509CertificateAllowed() error = %v, want NamePolicyError", err)
+			}
+			if npe.Reason != policy.NotAllowed || npe.NameType != tt.wantType {
+				t.Errorf("IsX509CertificateAllowed() error = %v, want %s not allowed", err, tt.wantType)
+			}
+		})
+	}
+}
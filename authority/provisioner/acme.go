@@ -5,12 +5,20 @@ import (
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
+	"log"
 	"net"
+	"net/mail"
+	"net/url"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/pkg/errors"
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/x509util"
 	"go.step.sm/linkedca"
+
+	"github.com/smallstep/certificates/webhook"
 )
 
 // ACMEChallenge represents the supported acme challenges.
@@ -26,6 +34,8 @@ const (
 	TLS_ALPN_01 ACMEChallenge = "tls-alpn-01"
 	// DEVICE_ATTEST_01 is the device-attest-01 ACME challenge.
 	DEVICE_ATTEST_01 ACMEChallenge = "device-attest-01"
+	// EMAIL_REPLY_00 is the email-reply-00 ACME challenge.
+	EMAIL_REPLY_00 ACMEChallenge = "email-reply-00"
 )
 
 // String returns a normalized version of the challenge.
@@ -36,7 +46,7 @@ func (c ACMEChallenge) String() string {
 // Validate returns an error if the acme challenge is not a valid one.
 func (c ACMEChallenge) Validate() error {
 	switch ACMEChallenge(c.String()) {
-	case HTTP_01, DNS_01, TLS_ALPN_01, DEVICE_ATTEST_01:
+	case HTTP_01, DNS_01, TLS_ALPN_01, DEVICE_ATTEST_01, EMAIL_REPLY_00:
 		return nil
 	default:
 		return fmt.Errorf("acme challenge %q is not supported", c)
@@ -76,6 +86,515 @@ func (f ACMEAttestationFormat) Validate() error {
 	}
 }
 
+// ACMEProfile is a certificate profile that ACME clients can request when
+// creating a new order, as defined in draft-aaron-acme-profiles. A profile
+// defines the X.509 template and the certificate durations used to sign the
+// certificates of the orders using it.
+type ACMEProfile struct {
+	// Description is the human readable description of the profile advertised
+	// in the ACME directory.
+	Description string `json:"description"`
+	// Claims overrides the claims of the provisioner for the profile.
+	Claims *Claims `json:"claims,omitempty"`
+	// X509 overrides the X.509 options of the provisioner for the profile.
+	X509    *X509Options `json:"x509,omitempty"`
+	claimer *Claimer
+	options *Options
+}
+
+// DefaultTLSCertDuration returns the default TLS cert duration of the
+// profile.
+func (p *ACMEProfile) DefaultTLSCertDuration() time.Duration {
+	return p.claimer.DefaultTLSCertDuration()
+}
+
+type acmeProfileKey struct{}
+
+// NewContextWithACMEProfile creates a new context with the given ACME profile
+// name.
+func NewContextWithACMEProfile(ctx context.Context, profile string) context.Context {
+	return context.WithValue(ctx, acmeProfileKey{}, profile)
+}
+
+// ACMEProfileFromContext returns the ACME profile name stored in the given
+// context.
+func ACMEProfileFromContext(ctx context.Context) (string, bool) {
+	profile, ok := ctx.Value(acmeProfileKey{}).(string)
+	return profile, ok && profile != ""
+}
+
+type acmeOrderKey struct{}
+
+// ACMEOrder encodes the ACME order sent to the webhooks that enrich and
+// authorize the certificate of a finalized order.
+type ACMEOrder struct {
+	ID string
+	// Identifiers are the identifiers of the order, they have been validated
+	// by the ACME challenges.
+	Identifiers []ACMEIdentifier
+	Profile     string
+	Account     ACMEAccount
+	// TemplateData is the data used to render the certificate template, the
+	// data returned by the enriching webhooks is added to it.
+	TemplateData x509util.TemplateData
+}
+
+// NewContextWithACMEOrder creates a new context with the given ACME order.
+func NewContextWithACMEOrder(ctx context.Context, order *ACMEOrder) context.Context {
+	return context.WithValue(ctx, acmeOrderKey{}, order)
+}
+
+// ACMEOrderFromContext returns the ACME order stored in the given context.
+func ACMEOrderFromContext(ctx context.Context) (*ACMEOrder, bool) {
+	order, ok := ctx.Value(acmeOrderKey{}).(*ACMEOrder)
+	return order, ok && order != nil
+}
+
+// webhookOptions returns the options used to add the order and its account
+// to the webhook requests.
+func (o *ACMEOrder) webhookOptions() []webhook.RequestBodyOption {
+	identifiers := make([]webhook.ACMEIdentifier, len(o.Identifiers))
+	for i, id := range o.Identifiers {
+		identifiers[i] = webhook.ACMEIdentifier{
+			Type:  string(id.Type),
+			Value: id.Value,
+		}
+	}
+	return []webhook.RequestBodyOption{
+		webhook.WithACMEOrder(&webhook.ACMEOrder{
+			ID:          o.ID,
+			Identifiers: identifiers,
+			Profile:     o.Profile,
+		}),
+		webhook.WithACMEAccount(&webhook.ACMEAccount{
+			ID:      o.Account.ID,
+			KeyID:   o.Account.KeyID,
+			Contact: o.Account.Contact,
+		}),
+	}
+}
+
+// ACMEDNSValidation configures the CA to verify dns-01 challenges querying its
+// own set of resolvers over DNS over TLS or DNS over HTTPS instead of the
+// system resolver. This is useful in split-horizon environments where the
+// system resolver of the CA does not see the public records.
+type ACMEDNSValidation struct {
+	// Resolvers is the list of resolvers to query in order. DNS over TLS
+	// resolvers use the tls scheme, e.g. tls://1.1.1.1 or tls://dns.example.com:853,
+	// and DNS over HTTPS resolvers use the https scheme, e.g.
+	// https://dns.example.com/dns-query.
+	Resolvers []string `json:"resolvers"`
+	// RequireDNSSEC requires the resolvers to authenticate the TXT records
+	// using DNSSEC. The resolvers must be validating resolvers.
+	RequireDNSSEC bool `json:"requireDNSSEC,omitempty"`
+	// DisableCNAMEs makes the validation fail if the challenge record is an
+	// alias to a different name.
+	DisableCNAMEs bool `json:"disableCNAMEs,omitempty"`
+	// MaxCNAMEs is the maximum number of aliases followed to find the
+	// challenge record, 8 by default.
+	MaxCNAMEs int `json:"maxCNAMEs,omitempty"`
+	// BypassNegativeCache makes the validation query the next resolver if a
+	// resolver responds that the challenge record does not exist, instead of
+	// failing with the possibly cached negative response.
+	BypassNegativeCache bool `json:"bypassNegativeCache,omitempty"`
+	// Timeout is the maximum time to wait for the response of a resolver, 10s
+	// by default.
+	Timeout *Duration `json:"timeout,omitempty"`
+}
+
+// Validate returns an error if the DNS validation options are not valid.
+func (v *ACMEDNSValidation) Validate() error {
+	if v == nil {
+		return nil
+	}
+	if len(v.Resolvers) == 0 {
+		return errors.New("acme dnsValidation resolvers cannot be empty")
+	}
+	for _, s := range v.Resolvers {
+		u, err := url.Parse(s)
+		if err != nil || u.Host == "" {
+			return fmt.Errorf("acme dnsValidation resolver %q is not valid", s)
+		}
+		if u.Scheme != "tls" && u.Scheme != "https" {
+			return fmt.Errorf("acme dnsValidation resolver %q is not valid: scheme must be tls or https", s)
+		}
+	}
+	switch {
+	case v.MaxCNAMEs < 0:
+		return errors.New("acme dnsValidation maxCNAMEs cannot be negative")
+	case v.Timeout != nil && v.Timeout.Duration < 0:
+		return errors.New("acme dnsValidation timeout cannot be negative")
+	}
+	return nil
+}
+
+// ACMEValidationProxy configures the CA to connect to the ACME clients through
+// a proxy when validating http-01 and tls-alpn-01 challenges. This is useful
+// in networks where the CA cannot connect directly to the ACME clients.
+type ACMEValidationProxy struct {
+	// URL is the URL of the proxy. HTTP and HTTPS proxies use the http and
+	// https schemes, e.g. http://proxy.example.com:3128, and SOCKS5 proxies
+	// use the socks5 scheme, e.g. socks5://proxy.example.com:1080. The
+	// credentials of the proxy can be set in the URL.
+	URL string `json:"url"`
+}
+
+// Validate returns an error if the validation proxy options are not valid.
+func (v *ACMEValidationProxy) Validate() error {
+	if v == nil {
+		return nil
+	}
+	u, err := url.Parse(v.URL)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("acme validationProxy url %q is not valid", v.URL)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+		return nil
+	default:
+		return fmt.Errorf("acme validationProxy url %q is not valid: scheme must be http, https or socks5", v.URL)
+	}
+}
+
+// ACMEEmailChallenge configures the email-reply-00 challenge defined in RFC
+// 8823. The CA sends the challenge emails using an SMTP server, and a mail
+// gateway posts the replies to the email-reply endpoint of the provisioner.
+//
+// The CA only checks the From header of the replies, the gateway must verify
+// the DKIM signatures or SPF records of the messages before posting them.
+type ACMEEmailChallenge struct {
+	// From is the address used to send the challenge emails.
+	From string `json:"from"`
+	// SMTPServer is the host and port of the SMTP server used to send the
+	// challenge emails, e.g. smtp.example.com:587.
+	SMTPServer string `json:"smtpServer"`
+	// Username and Password are the credentials used to authenticate with
+	// the SMTP server. The server must support STARTTLS to use them.
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// ReplySecret is the secret used by the mail gateway to authenticate with
+	// the email-reply endpoint, it is sent as a bearer token.
+	ReplySecret string `json:"replySecret"`
+}
+
+// Validate returns an error if the email challenge options are not valid.
+func (e *ACMEEmailChallenge) Validate() error {
+	if e == nil {
+		return nil
+	}
+	if addr, err := mail.ParseAddress(e.From); err != nil || addr.Address != e.From {
+		return fmt.Errorf("acme emailChallenge from %q is not valid", e.From)
+	}
+	if host, port, err := net.SplitHostPort(e.SMTPServer); err != nil || host == "" || port == "" {
+		return fmt.Errorf("acme emailChallenge smtpServer %q is not valid", e.SMTPServer)
+	}
+	if e.Username == "" && e.Password != "" {
+		return errors.New("acme emailChallenge username cannot be empty")
+	}
+	if e.ReplySecret == "" {
+		return errors.New("acme emailChallenge replySecret cannot be empty")
+	}
+	return nil
+}
+
+// ACMEAutoRenewal enables the short-term automatically renewed (STAR)
+// certificates defined in RFC 8739. Clients can create recurrent orders and
+// fetch the certificates that the CA renews periodically without running the
+// challenges again.
+type ACMEAutoRenewal struct {
+	// MinLifetime is the minimum lifetime of the certificates of an order, it
+	// defaults to the minimum TLS certificate duration of the provisioner.
+	MinLifetime *Duration `json:"minLifetime,omitempty"`
+	// MaxDuration is the maximum time between the start and end dates of an
+	// order, 365 days by default.
+	MaxDuration *Duration `json:"maxDuration,omitempty"`
+	// AllowCertificateGet allows clients to request that the certificates of
+	// an order can be fetched using unauthenticated GET requests.
+	AllowCertificateGet bool `json:"allowCertificateGet,omitempty"`
+	minLifetime         time.Duration
+	maxLifetime         time.Duration
+	maxDuration         time.Duration
+}
+
+// acmeAutoRenewalDefaultMaxDuration is the default maximum duration of an
+// auto-renewal order.
+const acmeAutoRenewalDefaultMaxDuration = 365 * 24 * time.Hour
+
+// init validates the auto-renewal options and initializes the limits using
+// the durations of the given claimer.
+func (a *ACMEAutoRenewal) init(claimer *Claimer) error {
+	a.minLifetime = claimer.MinTLSCertDuration()
+	a.maxLifetime = claimer.MaxTLSCertDuration()
+	a.maxDuration = acmeAutoRenewalDefaultMaxDuration
+	if a.MinLifetime != nil {
+		a.minLifetime = a.MinLifetime.Duration
+	}
+	if a.MaxDuration != nil {
+		a.maxDuration = a.MaxDuration.Duration
+	}
+	switch {
+	case a.minLifetime <= 0:
+		return errors.New("acme autoRenewal minLifetime must be greater than 0")
+	case a.minLifetime > a.maxLifetime:
+		return fmt.Errorf("acme autoRenewal minLifetime cannot be greater than the maximum TLS certificate duration %s", a.maxLifetime)
+	case a.maxDuration < a.minLifetime:
+		return errors.New("acme autoRenewal maxDuration cannot be less than minLifetime")
+	}
+	return nil
+}
+
+// GetMinLifetime returns the minimum lifetime of the certificates of an order.
+func (a *ACMEAutoRenewal) GetMinLifetime() time.Duration {
+	return a.minLifetime
+}
+
+// GetMaxLifetime returns the maximum lifetime of the certificates of an order,
+// including the lifetime adjustment.
+func (a *ACMEAutoRenewal) GetMaxLifetime() time.Duration {
+	return a.maxLifetime
+}
+
+// GetMaxDuration returns the maximum time between the start and end dates of
+// an order.
+func (a *ACMEAutoRenewal) GetMaxDuration() time.Duration {
+	return a.maxDuration
+}
+
+// ACMERenewalInfo configures the renewal windows suggested to the clients
+// using the ACME Renewal Information (ARI) extension. The CA can use it to ask
+// for the early renewal of certificates, e.g. before a mass revocation or
+// after a CA migration.
+type ACMERenewalInfo struct {
+	// RetryAfter is the time clients should wait before checking the renewal
+	// information again, 6 hours by default.
+	RetryAfter *Duration `json:"retryAfter,omitempty"`
+	// ExplanationURL is a URL with information about the suggested windows,
+	// e.g. an incident report.
+	ExplanationURL string `json:"explanationURL,omitempty"`
+	// RenewIssuedBefore makes the CA suggest the immediate renewal of all the
+	// certificates issued before this time.
+	RenewIssuedBefore *time.Time `json:"renewIssuedBefore,omitempty"`
+}
+
+// acmeRenewalInfoDefaultRetryAfter is the default time that clients should
+// wait before checking the renewal information again.
+const acmeRenewalInfoDefaultRetryAfter = 6 * time.Hour
+
+// Validate returns an error if the renewal information options are not valid.
+func (r *ACMERenewalInfo) Validate() error {
+	if r == nil {
+		return nil
+	}
+	if r.RetryAfter != nil && r.RetryAfter.Duration <= 0 {
+		return errors.New("acme renewalInfo retryAfter must be greater than 0")
+	}
+	if r.ExplanationURL != "" {
+		if u, err := url.Parse(r.ExplanationURL); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("acme renewalInfo explanationURL %q is not valid", r.ExplanationURL)
+		}
+	}
+	return nil
+}
+
+// GetRetryAfter returns the time that clients should wait before checking the
+// renewal information again.
+func (r *ACMERenewalInfo) GetRetryAfter() time.Duration {
+	if r == nil || r.RetryAfter == nil {
+		return acmeRenewalInfoDefaultRetryAfter
+	}
+	return r.RetryAfter.Duration
+}
+
+// ACMEChallengeRetry configures the retries of the challenges that fail with
+// a transient error, e.g. a DNS record that has not been propagated yet. While
+// the CA retries a challenge its status is processing, and the error of the
+// last attempt is reported to the clients.
+type ACMEChallengeRetry struct {
+	// MaxAttempts is the maximum number of validation attempts of a
+	// challenge, 5 by default.
+	MaxAttempts int `json:"maxAttempts,omitempty"`
+	// Backoff is the time to wait before the first retry, it doubles after
+	// every attempt. It defaults to 5 seconds.
+	Backoff *Duration `json:"backoff,omitempty"`
+	// MaxBackoff is the maximum time between two attempts, 5 minutes by
+	// default.
+	MaxBackoff *Duration `json:"maxBackoff,omitempty"`
+}
+
+const (
+	acmeChallengeRetryDefaultMaxAttempts = 5
+	acmeChallengeRetryDefaultBackoff     = 5 * time.Second
+	acmeChallengeRetryDefaultMaxBackoff  = 5 * time.Minute
+)
+
+// Validate returns an error if the challenge retry options are not valid.
+func (r *ACMEChallengeRetry) Validate() error {
+	if r == nil {
+		return nil
+	}
+	switch {
+	case r.MaxAttempts < 0:
+		return errors.New("acme challengeRetry maxAttempts cannot be negative")
+	case r.Backoff != nil && r.Backoff.Duration <= 0:
+		return errors.New("acme challengeRetry backoff must be greater than 0")
+	case r.MaxBackoff != nil && r.MaxBackoff.Duration <= 0:
+		return errors.New("acme challengeRetry maxBackoff must be greater than 0")
+	case r.getMaxBackoff() < r.getBackoff():
+		return errors.New("acme challengeRetry maxBackoff cannot be less than backoff")
+	}
+	return nil
+}
+
+// GetMaxAttempts returns the maximum number of validation attempts of a
+// challenge.
+func (r *ACMEChallengeRetry) GetMaxAttempts() int {
+	if r == nil || r.MaxAttempts == 0 {
+		return acmeChallengeRetryDefaultMaxAttempts
+	}
+	return r.MaxAttempts
+}
+
+// GetBackoff returns the time to wait after the given number of failed
+// attempts.
+func (r *ACMEChallengeRetry) GetBackoff(attempts int) time.Duration {
+	backoff, maxBackoff := r.getBackoff(), r.getMaxBackoff()
+	for i := 1; i < attempts && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		return maxBackoff
+	}
+	return backoff
+}
+
+func (r *ACMEChallengeRetry) getBackoff() time.Duration {
+	if r == nil || r.Backoff == nil {
+		return acmeChallengeRetryDefaultBackoff
+	}
+	return r.Backoff.Duration
+}
+
+func (r *ACMEChallengeRetry) getMaxBackoff() time.Duration {
+	if r == nil || r.MaxBackoff == nil {
+		return acmeChallengeRetryDefaultMaxBackoff
+	}
+	return r.MaxBackoff.Duration
+}
+
+// ACMEGarbageCollection configures the deletion of the stale resources of the
+// ACME database. Orders and authorizations are deleted some time after they
+// expire, and the challenges are deleted with their authorizations.
+type ACMEGarbageCollection struct {
+	// Interval is the time between two garbage collections, 1 hour by
+	// default. If multiple provisioners enable garbage collection the
+	// shortest interval is used.
+	Interval *Duration `json:"interval,omitempty"`
+	// OrderTTL is the time that orders are kept after they expire, 7 days by
+	// default. The orders of an auto-renewal order expire at its end date.
+	OrderTTL *Duration `json:"orderTTL,omitempty"`
+	// AuthorizationTTL is the time that authorizations are kept after they
+	// expire, 7 days by default.
+	AuthorizationTTL *Duration `json:"authorizationTTL,omitempty"`
+	// NonceTTL is the time that unused nonces are kept, 24 hours by default.
+	// Nonces are not bound to a provisioner, so if multiple provisioners
+	// enable garbage collection the shortest TTL is used.
+	NonceTTL *Duration `json:"nonceTTL,omitempty"`
+}
+
+const (
+	acmeGarbageCollectionDefaultInterval         = time.Hour
+	acmeGarbageCollectionDefaultOrderTTL         = 7 * 24 * time.Hour
+	acmeGarbageCollectionDefaultAuthorizationTTL = 7 * 24 * time.Hour
+	acmeGarbageCollectionDefaultNonceTTL         = 24 * time.Hour
+)
+
+// Validate returns an error if the garbage collection options are not valid.
+func (g *ACMEGarbageCollection) Validate() error {
+	if g == nil {
+		return nil
+	}
+	switch {
+	case g.Interval != nil && g.Interval.Duration <= 0:
+		return errors.New("acme garbageCollection interval must be greater than 0")
+	case g.OrderTTL != nil && g.OrderTTL.Duration <= 0:
+		return errors.New("acme garbageCollection orderTTL must be greater than 0")
+	case g.AuthorizationTTL != nil && g.AuthorizationTTL.Duration <= 0:
+		return errors.New("acme garbageCollection authorizationTTL must be greater than 0")
+	case g.NonceTTL != nil && g.NonceTTL.Duration <= 0:
+		return errors.New("acme garbageCollection nonceTTL must be greater than 0")
+	}
+	return nil
+}
+
+// GetInterval returns the time between two garbage collections.
+func (g *ACMEGarbageCollection) GetInterval() time.Duration {
+	if g == nil || g.Interval == nil {
+		return acmeGarbageCollectionDefaultInterval
+	}
+	return g.Interval.Duration
+}
+
+// GetOrderTTL returns the time that orders are kept after they expire.
+func (g *ACMEGarbageCollection) GetOrderTTL() time.Duration {
+	if g == nil || g.OrderTTL == nil {
+		return acmeGarbageCollectionDefaultOrderTTL
+	}
+	return g.OrderTTL.Duration
+}
+
+// GetAuthorizationTTL returns the time that authorizations are kept after
+// they expire.
+func (g *ACMEGarbageCollection) GetAuthorizationTTL() time.Duration {
+	if g == nil || g.AuthorizationTTL == nil {
+		return acmeGarbageCollectionDefaultAuthorizationTTL
+	}
+	return g.AuthorizationTTL.Duration
+}
+
+// GetNonceTTL returns the time that unused nonces are kept.
+func (g *ACMEGarbageCollection) GetNonceTTL() time.Duration {
+	if g == nil || g.NonceTTL == nil {
+		return acmeGarbageCollectionDefaultNonceTTL
+	}
+	return g.NonceTTL.Duration
+}
+
+// ACMEAuthorizationReuse configures the reuse of the valid authorizations of
+// an account. When enabled, the new orders of an account use the valid
+// authorizations of the same account for the same identifier created during
+// the reuse window. Authorizations are never reused after they expire, and
+// reusing an authorization does not extend its expiration.
+type ACMEAuthorizationReuse struct {
+	// Enabled makes new orders reuse the valid authorizations of the account.
+	Enabled bool `json:"enabled,omitempty"`
+	// Window is the maximum age of an authorization that can be reused, 24
+	// hours by default.
+	Window *Duration `json:"window,omitempty"`
+}
+
+const acmeAuthorizationReuseDefaultWindow = 24 * time.Hour
+
+// Validate returns an error if the authorization reuse options are not valid.
+func (r *ACMEAuthorizationReuse) Validate() error {
+	if r != nil && r.Window != nil && r.Window.Duration <= 0 {
+		return errors.New("acme authorizationReuse window must be greater than 0")
+	}
+	return nil
+}
+
+// IsEnabled returns true if the valid authorizations can be reused.
+func (r *ACMEAuthorizationReuse) IsEnabled() bool {
+	return r != nil && r.Enabled
+}
+
+// GetWindow returns the time that a valid authorization can be reused.
+func (r *ACMEAuthorizationReuse) GetWindow() time.Duration {
+	if r == nil || r.Window == nil {
+		return acmeAuthorizationReuseDefaultWindow
+	}
+	return r.Window.Duration
+}
+
 // ACME is the acme provisioner type, an entity that can authorize the ACME
 // provisioning flow.
 type ACME struct {
@@ -100,10 +619,34 @@ type ACME struct {
 	// EAB will be verified. If set to false and an EAB is provided, it is
 	// not verified. Defaults to false.
 	RequireEAB bool `json:"requireEAB,omitempty"`
+	// EABAlgorithms contains the MAC algorithms allowed in the ACME EAB JWS.
+	// If this value is not set HS256, HS384 and HS512 will be allowed.
+	EABAlgorithms []string `json:"eabAlgorithms,omitempty"`
+	// AllowIdentifierSubset makes the provisioner accept finalize requests
+	// with a CSR that only contains a subset of the identifiers authorized in
+	// the order. By default, the CSR must contain exactly the same set of
+	// identifiers as the order. Identifiers not present in the order are always
+	// rejected.
+	AllowIdentifierSubset bool `json:"allowIdentifierSubset,omitempty"`
+	// AllowPreAuthorization enables the new-authz resource, so clients can
+	// authorize identifiers before creating orders. The valid authorizations
+	// of an account are reused by its new orders. Defaults to false.
+	AllowPreAuthorization bool `json:"allowPreAuthorization,omitempty"`
+	// AllowWildcards controls if orders can contain wildcard DNS identifiers.
+	// Wildcard identifiers can only be validated using dns-01 and, if a policy
+	// is configured, both the wildcard and its base domain must be allowed.
+	// Defaults to true.
+	AllowWildcards *bool `json:"allowWildcards,omitempty"`
 	// Challenges contains the enabled challenges for this provisioner. If this
 	// value is not set the default http-01, dns-01 and tls-alpn-01 challenges
 	// will be enabled, device-attest-01 will be disabled.
 	Challenges []ACMEChallenge `json:"challenges,omitempty"`
+	// IdentifierChallenges restricts the challenges that can be used to
+	// validate each identifier type, e.g. an order with dns and
+	// permanent-identifier identifiers can require dns-01 for the first ones
+	// and device-attest-01 for the second one. The challenges must be enabled.
+	// Identifier types not in this map can use all the enabled challenges.
+	IdentifierChallenges map[ACMEIdentifierType][]ACMEChallenge `json:"identifierChallenges,omitempty"`
 	// AttestationFormats contains the enabled attestation formats for this
 	// provisioner. If this value is not set the default apple, step and tpm
 	// will be used.
@@ -111,7 +654,50 @@ type ACME struct {
 	// AttestationRoots contains a bundle of root certificates in PEM format
 	// that will be used to verify the attestation certificates. If provided,
 	// this bundle will be used even for well-known CAs like Apple and Yubico.
-	AttestationRoots    []byte   `json:"attestationRoots,omitempty"`
+	AttestationRoots []byte `json:"attestationRoots,omitempty"`
+	// RequireDeviceEnrollment makes the device-attest-01 challenge only accept
+	// TPM attestations of devices enrolled in the CA database, using the
+	// fingerprint of their EK or their serial number. Defaults to false.
+	RequireDeviceEnrollment bool `json:"requireDeviceEnrollment,omitempty"`
+	// Profiles contains the certificate profiles that clients can request in
+	// new orders. The key is the name of the profile. If a client does not
+	// request a profile, the claims and options of the provisioner are used.
+	Profiles map[string]*ACMEProfile `json:"profiles,omitempty"`
+	// DNSValidation makes the CA verify dns-01 challenges using the configured
+	// resolvers. If this value is not set the system resolver is used.
+	DNSValidation *ACMEDNSValidation `json:"dnsValidation,omitempty"`
+	// AutoRenewal enables the support of STAR certificates, RFC 8739. If this
+	// value is not set auto-renewal orders are not allowed.
+	AutoRenewal *ACMEAutoRenewal `json:"autoRenewal,omitempty"`
+	// RenewalInfo configures the renewal windows suggested to the clients
+	// using ARI. If this value is not set the windows are based only on the
+	// validity of the certificates.
+	RenewalInfo *ACMERenewalInfo `json:"renewalInfo,omitempty"`
+	// ChallengeRetry makes the CA retry the validation of the challenges that
+	// fail with transient errors. If this value is not set the challenges are
+	// validated once per client request, and they remain pending on transient
+	// errors.
+	ChallengeRetry *ACMEChallengeRetry `json:"challengeRetry,omitempty"`
+	// GarbageCollection makes the CA delete the stale orders, authorizations,
+	// challenges and nonces of the database. If this value is not set the
+	// resources of this provisioner are never deleted.
+	GarbageCollection *ACMEGarbageCollection `json:"garbageCollection,omitempty"`
+	// ValidationProxy configures a proxy used to connect to the ACME clients
+	// when validating http-01 and tls-alpn-01 challenges. If this value is not
+	// set the CA connects directly, or using the proxy in the environment for
+	// http-01.
+	ValidationProxy *ACMEValidationProxy `json:"validationProxy,omitempty"`
+	// EmailChallenge configures the email-reply-00 challenge used to validate
+	// email identifiers. It is required if the challenge is enabled.
+	EmailChallenge *ACMEEmailChallenge `json:"emailChallenge,omitempty"`
+	// AuthorizationReuse configures the reuse of valid authorizations by new
+	// orders of the same account. Authorizations are not reused by default,
+	// except the ones created with new-authz if pre-authorization is allowed.
+	AuthorizationReuse *ACMEAuthorizationReuse `json:"authorizationReuse,omitempty"`
+	// AccountWebhooks are the names of the authorizing webhooks used to
+	// validate new accounts and contact updates. These webhooks are not used
+	// to authorize certificate requests.
+	AccountWebhooks     []string `json:"accountWebhooks,omitempty"`
 	Claims              *Claims  `json:"claims,omitempty"`
 	Options             *Options `json:"options,omitempty"`
 	attestationRootPool *x509.CertPool
@@ -163,6 +749,74 @@ func (p *ACME) DefaultTLSCertDuration() time.Duration {
 	return p.ctl.Claimer.DefaultTLSCertDuration()
 }
 
+// validateIdentifierChallenges validates the challenges configured per
+// identifier type.
+func (p *ACME) validateIdentifierChallenges() error {
+	for typ, challenges := range p.IdentifierChallenges {
+		switch typ {
+		case IP, DNS, Email, PermanentIdentifier:
+		default:
+			return fmt.Errorf("acme identifierChallenges identifier type %q is not supported", typ)
+		}
+		if len(challenges) == 0 {
+			return fmt.Errorf("acme identifierChallenges for %q cannot be empty", typ)
+		}
+		for _, c := range challenges {
+			if err := c.Validate(); err != nil {
+				return err
+			}
+			if !p.IsChallengeEnabled(context.Background(), c) {
+				return fmt.Errorf("acme identifierChallenges challenge %q for %q is not enabled", c, typ)
+			}
+		}
+	}
+	return nil
+}
+
+// validateDirectoryMeta validates the properties of the provisioner added to
+// the meta object of the ACME directory. The properties are informational, so
+// Init only logs a warning if they are not valid.
+func (p *ACME) validateDirectoryMeta() error {
+	for _, v := range []struct{ name, value string }{
+		{"termsOfService", p.TermsOfService},
+		{"website", p.Website},
+	} {
+		if v.value == "" {
+			continue
+		}
+		if u, err := url.Parse(v.value); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("acme %s %q is not valid", v.name, v.value)
+		}
+	}
+	for _, name := range p.CaaIdentities {
+		if !isCAAIdentity(name) {
+			return fmt.Errorf("acme caaIdentities %q is not valid", name)
+		}
+	}
+	return nil
+}
+
+// isCAAIdentity returns if the given name is a valid issuer domain name, RFC
+// 8659 section 4.2.
+func isCAAIdentity(name string) bool {
+	if name == "" || strings.HasSuffix(name, ".") || net.ParseIP(name) != nil {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			switch {
+			case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-':
+			default:
+				return false
+			}
+		}
+	}
+	return true
+}
+
 // Init initializes and validates the fields of an ACME type.
 func (p *ACME) Init(config Config) (err error) {
 	switch {
@@ -182,6 +836,44 @@ func (p *ACME) Init(config Config) (err error) {
 			return err
 		}
 	}
+	for _, alg := range p.EABAlgorithms {
+		switch jose.SignatureAlgorithm(alg) {
+		case jose.HS256, jose.HS384, jose.HS512:
+		default:
+			return fmt.Errorf("acme eab algorithm %q is not supported", alg)
+		}
+	}
+
+	if err := p.validateIdentifierChallenges(); err != nil {
+		return err
+	}
+	if err := p.validateDirectoryMeta(); err != nil {
+		log.Printf("WARNING: provisioner %q: %v", p.Name, err)
+	}
+	if err := p.DNSValidation.Validate(); err != nil {
+		return err
+	}
+	if err := p.RenewalInfo.Validate(); err != nil {
+		return err
+	}
+	if err := p.ChallengeRetry.Validate(); err != nil {
+		return err
+	}
+	if err := p.GarbageCollection.Validate(); err != nil {
+		return err
+	}
+	if err := p.AuthorizationReuse.Validate(); err != nil {
+		return err
+	}
+	if err := p.ValidationProxy.Validate(); err != nil {
+		return err
+	}
+	if err := p.EmailChallenge.Validate(); err != nil {
+		return err
+	}
+	if p.EmailChallenge == nil && p.IsChallengeEnabled(context.Background(), EMAIL_REPLY_00) {
+		return errors.New("acme email-reply-00 challenge requires the emailChallenge options")
+	}
 
 	// Parse attestation roots.
 	// The pool will be nil if there are no roots.
@@ -206,8 +898,63 @@ func (p *ACME) Init(config Config) (err error) {
 		}
 	}
 
-	p.ctl, err = NewController(p, p.Claims, config, p.Options)
-	return
+	p.Options = mergeOptions(p.Options, config.DefaultOptions, p.GetType())
+	if p.ctl, err = NewController(p, p.Claims, config, p.Options); err != nil {
+		return err
+	}
+	for _, name := range p.AccountWebhooks {
+		if err := validateAccountWebhook(name, p.Options.GetWebhooks()); err != nil {
+			return err
+		}
+	}
+	if p.AutoRenewal != nil {
+		if err := p.AutoRenewal.init(p.ctl.Claimer); err != nil {
+			return err
+		}
+	}
+
+	// Initialize the profiles, the TLS durations of a profile default to the
+	// ones in the provisioner.
+	profileClaims := config.Claims
+	if p.Claims != nil {
+		if p.Claims.MinTLSDur != nil {
+			profileClaims.MinTLSDur = p.Claims.MinTLSDur
+		}
+		if p.Claims.MaxTLSDur != nil {
+			profileClaims.MaxTLSDur = p.Claims.MaxTLSDur
+		}
+		if p.Claims.DefaultTLSDur != nil {
+			profileClaims.DefaultTLSDur = p.Claims.DefaultTLSDur
+		}
+	}
+	for name, profile := range p.Profiles {
+		if name == "" {
+			return errors.New("acme profile name cannot be empty")
+		}
+		if profile == nil {
+			return fmt.Errorf("acme profile %q cannot be empty", name)
+		}
+		if profile.claimer, err = NewClaimer(profile.Claims, profileClaims); err != nil {
+			return fmt.Errorf("acme profile %q claims are not valid: %w", name, err)
+		}
+		profile.options = p.Options
+		if profile.X509 != nil {
+			var opts Options
+			if p.Options != nil {
+				opts = *p.Options
+			}
+			opts.X509 = profile.X509
+			if err := opts.GetX509Options().validateOtherNames(); err != nil {
+				return fmt.Errorf("acme profile %q x509 options are not valid: %w", name, err)
+			}
+			if err := opts.GetX509Options().validateIssuerAltNames(); err != nil {
+				return fmt.Errorf("acme profile %q x509 options are not valid: %w", name, err)
+			}
+			profile.options = &opts
+		}
+	}
+
+	return nil
 }
 
 // ACMEIdentifierType encodes ACME Identifier types
@@ -218,6 +965,10 @@ const (
 	IP ACMEIdentifierType = "ip"
 	// DNS is the ACME dns identifier type
 	DNS ACMEIdentifierType = "dns"
+	// Email is the ACME email identifier type
+	Email ACMEIdentifierType = "email"
+	// PermanentIdentifier is the ACME permanent-identifier identifier type
+	PermanentIdentifier ACMEIdentifierType = "permanent-identifier"
 )
 
 // ACMEIdentifier encodes ACME Order Identifiers
@@ -228,7 +979,18 @@ type ACMEIdentifier struct {
 
 // AuthorizeOrderIdentifier verifies the provisioner is allowed to issue a
 // certificate for an ACME Order Identifier.
-func (p *ACME) AuthorizeOrderIdentifier(_ context.Context, identifier ACMEIdentifier) error {
+func (p *ACME) AuthorizeOrderIdentifier(ctx context.Context, identifier ACMEIdentifier) error {
+	isWildcard := identifier.Type == DNS && strings.HasPrefix(identifier.Value, "*.")
+	if isWildcard {
+		if !p.AreWildcardsAllowed() {
+			return fmt.Errorf("wildcard identifier %q is not allowed", identifier.Value)
+		}
+		// RFC 8555 section 7.1.3 only allows dns-01 for wildcard identifiers.
+		if !p.IsIdentifierChallengeEnabled(ctx, DNS, DNS_01) {
+			return fmt.Errorf("wildcard identifier %q requires the dns-01 challenge", identifier.Value)
+		}
+	}
+
 	x509Policy := p.ctl.getPolicy().getX509()
 
 	// identifier is allowed if no policy is configured
@@ -236,13 +998,19 @@ func (p *ACME) AuthorizeOrderIdentifier(_ context.Context, identifier ACMEIdenti
 		return nil
 	}
 
-	// assuming only valid identifiers (IP or DNS) are provided
+	// assuming only valid identifiers (IP, DNS or email) are provided
 	var err error
 	switch identifier.Type {
 	case IP:
 		err = x509Policy.IsIPAllowed(net.ParseIP(identifier.Value))
 	case DNS:
 		err = x509Policy.IsDNSAllowed(identifier.Value)
+		// a wildcard is only allowed if the base domain is also allowed
+		if err == nil && isWildcard {
+			err = x509Policy.IsDNSAllowed(strings.TrimPrefix(identifier.Value, "*."))
+		}
+	case Email:
+		err = x509Policy.AreSANsAllowed([]string{identifier.Value})
 	default:
 		err = fmt.Errorf("invalid ACME identifier type '%s' provided", identifier.Type)
 	}
@@ -252,24 +1020,110 @@ func (p *ACME) AuthorizeOrderIdentifier(_ context.Context, identifier ACMEIdenti
 
 // AuthorizeSign does not do any validation, because all validation is handled
 // in the ACME protocol. This method returns a list of modifiers / constraints
-// on the resulting certificate.
-func (p *ACME) AuthorizeSign(context.Context, string) ([]SignOption, error) {
+// on the resulting certificate. If the context contains an ACME profile, the
+// durations of the profile are used. If the context contains an ACME order,
+// the order and its account are sent to the webhooks.
+func (p *ACME) AuthorizeSign(ctx context.Context, _ string) ([]SignOption, error) {
+	claimer := p.ctl.Claimer
+	if name, ok := ACMEProfileFromContext(ctx); ok {
+		profile, ok := p.Profiles[name]
+		if !ok {
+			return nil, fmt.Errorf("acme profile %q is not supported", name)
+		}
+		claimer = profile.claimer
+	}
+
+	// The enriching webhooks add their data to the template data of the
+	// order, a new one is used if the order does not have it.
+	var data x509util.TemplateData
+	order, hasOrder := ACMEOrderFromContext(ctx)
+	if hasOrder {
+		data = order.TemplateData
+	}
+	if data == nil {
+		data = x509util.NewTemplateData()
+	}
+	wc := p.newWebhookController(data, linkedca.Webhook_X509, false)
+	if hasOrder {
+		wc.options = append(wc.options, order.webhookOptions()...)
+	}
+
 	opts := []SignOption{
 		p,
 		// modifiers / withOptions
 		newProvisionerExtensionOption(TypeACME, p.Name, "").WithControllerOptions(p.ctl),
 		newForceCNOption(p.ForceCN),
-		profileDefaultDuration(p.ctl.Claimer.DefaultTLSCertDuration()),
+		profileDefaultDuration(claimer.DefaultTLSCertDuration()),
 		// validators
 		defaultPublicKeyValidator{},
-		newValidityValidator(p.ctl.Claimer.MinTLSCertDuration(), p.ctl.Claimer.MaxTLSCertDuration()),
+		newValidityValidator(claimer.MinTLSCertDuration(), claimer.MaxTLSCertDuration()),
 		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
-		p.ctl.newWebhookController(nil, linkedca.Webhook_X509),
+		wc,
 	}
 
 	return opts, nil
 }
 
+// ACMEAccount encodes the ACME account sent to the account webhooks.
+type ACMEAccount struct {
+	// ID is the account ID, it's empty for new accounts.
+	ID string
+	// KeyID is the thumbprint of the account key.
+	KeyID   string
+	Contact []string
+}
+
+// AuthorizeAccount validates a new account or a contact update using the
+// account webhooks. It returns ErrWebhookDenied if any of them does not allow
+// the account.
+func (p *ACME) AuthorizeAccount(ctx context.Context, acc ACMEAccount) error {
+	if len(p.AccountWebhooks) == 0 {
+		return nil
+	}
+	return p.newWebhookController(nil, linkedca.Webhook_ALL, true).Authorize(ctx, &webhook.RequestBody{
+		ProvisionerName: p.Name,
+		ACMEAccount: &webhook.ACMEAccount{
+			ID:      acc.ID,
+			KeyID:   acc.KeyID,
+			Contact: acc.Contact,
+		},
+	})
+}
+
+// newWebhookController returns a webhook controller with the account webhooks
+// if account is true, or with the rest of webhooks otherwise. The account
+// webhooks are always authorizing webhooks, so they do not need template data.
+func (p *ACME) newWebhookController(templateData WebhookSetter, certType linkedca.Webhook_CertType, account bool) *WebhookController {
+	wc := p.ctl.newWebhookController(templateData, certType)
+	if len(p.AccountWebhooks) == 0 {
+		return wc
+	}
+
+	webhooks := make([]*Webhook, 0, len(wc.webhooks))
+	for _, wh := range wc.webhooks {
+		if slices.Contains(p.AccountWebhooks, wh.Name) == account {
+			webhooks = append(webhooks, wh)
+		}
+	}
+	wc.webhooks = webhooks
+	return wc
+}
+
+// validateAccountWebhook returns an error if the given name is not the name of
+// an authorizing webhook.
+func validateAccountWebhook(name string, webhooks []*Webhook) error {
+	for _, wh := range webhooks {
+		if wh.Name != name {
+			continue
+		}
+		if wh.Kind != linkedca.Webhook_AUTHORIZING.String() {
+			return fmt.Errorf("acme account webhook %q must be an authorizing webhook", name)
+		}
+		return nil
+	}
+	return fmt.Errorf("acme account webhook %q is not defined", name)
+}
+
 // AuthorizeRevoke is called just before the certificate is to be revoked by
 // the CA. It can be used to authorize revocation of a certificate. With the
 // ACME protocol, revocation authorization is specified and performed as part
@@ -304,6 +1158,42 @@ func (p *ACME) IsChallengeEnabled(_ context.Context, challenge ACMEChallenge) bo
 	return false
 }
 
+// IsIdentifierChallengeEnabled checks if the given challenge can be used to
+// validate identifiers of the given type. The challenge must be enabled and,
+// if the IdentifierChallenges provisioner property contains the identifier
+// type, included in its challenges.
+func (p *ACME) IsIdentifierChallengeEnabled(ctx context.Context, typ ACMEIdentifierType, challenge ACMEChallenge) bool {
+	if !p.IsChallengeEnabled(ctx, challenge) {
+		return false
+	}
+	challenges, ok := p.IdentifierChallenges[typ]
+	if !ok {
+		return true
+	}
+	for _, ch := range challenges {
+		if strings.EqualFold(string(ch), string(challenge)) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsEABAlgorithmAllowed checks if the given MAC algorithm can be used in the
+// ACME EAB JWS. By default HS256, HS384 and HS512 are allowed, to disable any
+// of them the EABAlgorithms provisioner property should have at least one
+// element.
+func (p *ACME) IsEABAlgorithmAllowed(alg string) bool {
+	if len(p.EABAlgorithms) == 0 {
+		switch jose.SignatureAlgorithm(alg) {
+		case jose.HS256, jose.HS384, jose.HS512:
+			return true
+		default:
+			return false
+		}
+	}
+	return slices.Contains(p.EABAlgorithms, alg)
+}
+
 // IsAttestationFormatEnabled checks if the given attestation format is enabled.
 // By default apple, step and tpm are enabled, to disable any of them the
 // AttestationFormat provisioner property should have at least one element.
@@ -330,3 +1220,81 @@ func (p *ACME) IsAttestationFormatEnabled(_ context.Context, format ACMEAttestat
 func (p *ACME) GetAttestationRoots() (*x509.CertPool, bool) {
 	return p.attestationRootPool, p.attestationRootPool != nil
 }
+
+// GetProfile returns the profile with the given name and reports if the
+// profile can be requested in new orders.
+func (p *ACME) GetProfile(name string) (*ACMEProfile, bool) {
+	profile, ok := p.Profiles[name]
+	return profile, ok
+}
+
+// GetProfileOptions returns the options used to sign the certificates of the
+// given profile. It returns the provisioner options if the profile is empty
+// or not supported.
+func (p *ACME) GetProfileOptions(name string) *Options {
+	if profile, ok := p.Profiles[name]; ok {
+		return profile.options
+	}
+	return p.Options
+}
+
+// ACMEOptions are the options of an ACME provisioner used by the ACME API to
+// manage accounts, orders, authorizations and challenges. The nil options
+// mean that the feature is not configured.
+type ACMEOptions struct {
+	// AllowIdentifierSubset is true if the CSR used to finalize an order can
+	// contain a subset of the identifiers in the order.
+	AllowIdentifierSubset bool
+	// AllowPreAuthorization is true if clients can authorize identifiers
+	// before creating orders.
+	AllowPreAuthorization bool
+	// RequireDeviceEnrollment is true if TPM attestations are only accepted
+	// for devices enrolled in the CA database.
+	RequireDeviceEnrollment bool
+	// DNSValidation are the options used to verify dns-01 challenges, if nil
+	// the system resolver is used.
+	DNSValidation *ACMEDNSValidation
+	// AutoRenewal are the options of the auto-renewal orders, if nil
+	// auto-renewal orders are not allowed.
+	AutoRenewal *ACMEAutoRenewal
+	// RenewalInfo are the options used to suggest renewal windows.
+	RenewalInfo *ACMERenewalInfo
+	// ChallengeRetry are the options used to retry the validation of the
+	// challenges, if nil challenges are not retried.
+	ChallengeRetry *ACMEChallengeRetry
+	// GarbageCollection are the options used to delete the stale resources
+	// of the provisioner, if nil they are kept.
+	GarbageCollection *ACMEGarbageCollection
+	// AuthorizationReuse are the options used to reuse the valid
+	// authorizations of an account.
+	AuthorizationReuse *ACMEAuthorizationReuse
+	// ValidationProxy is the proxy used to validate http-01 and tls-alpn-01
+	// challenges, if nil a proxy is not used.
+	ValidationProxy *ACMEValidationProxy
+	// EmailChallenge are the options used to send and validate the
+	// email-reply-00 challenges.
+	EmailChallenge *ACMEEmailChallenge
+}
+
+// GetACMEOptions returns the options used by the ACME API.
+func (p *ACME) GetACMEOptions() ACMEOptions {
+	return ACMEOptions{
+		AllowIdentifierSubset:   p.AllowIdentifierSubset,
+		AllowPreAuthorization:   p.AllowPreAuthorization,
+		RequireDeviceEnrollment: p.RequireDeviceEnrollment,
+		DNSValidation:           p.DNSValidation,
+		AutoRenewal:             p.AutoRenewal,
+		RenewalInfo:             p.RenewalInfo,
+		ChallengeRetry:          p.ChallengeRetry,
+		GarbageCollection:       p.GarbageCollection,
+		AuthorizationReuse:      p.AuthorizationReuse,
+		ValidationProxy:         p.ValidationProxy,
+		EmailChallenge:          p.EmailChallenge,
+	}
+}
+
+// AreWildcardsAllowed returns true if orders can contain wildcard DNS
+// identifiers.
+func (p *ACME) AreWildcardsAllowed() bool {
+	return p.AllowWildcards == nil || *p.AllowWildcards
+}
@@ -0,0 +1,209 @@
+package provisioner
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/x509util"
+	"go.step.sm/linkedca"
+
+	"github.com/smallstep/certificates/webhook"
+)
+
+func newACMEAccountWebhooksProvisioner(t *testing.T, webhooks []*Webhook, accountWebhooks ...string) *ACME {
+	t.Helper()
+	p := &ACME{
+		Type:            "ACME",
+		Name:            "acme",
+		AccountWebhooks: accountWebhooks,
+		Options:         &Options{Webhooks: webhooks},
+	}
+	require.NoError(t, p.Init(Config{
+		Claims:    globalProvisionerClaims,
+		Audiences: testAudiences,
+	}))
+	return p
+}
+
+func TestACME_Init_accountWebhooks(t *testing.T) {
+	config := Config{
+		Claims:    globalProvisionerClaims,
+		Audiences: testAudiences,
+	}
+	webhooks := []*Webhook{
+		{Name: "accounts", Kind: linkedca.Webhook_AUTHORIZING.String()},
+		{Name: "people", Kind: linkedca.Webhook_ENRICHING.String()},
+	}
+	tests := []struct {
+		name            string
+		accountWebhooks []string
+		wantErr         string
+	}{
+		{"ok", []string{"accounts"}, ""},
+		{"ok empty", nil, ""},
+		{"fail enriching", []string{"people"}, `acme account webhook "people" must be an authorizing webhook`},
+		{"fail missing", []string{"missing"}, `acme account webhook "missing" is not defined`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &ACME{
+				Type:            "ACME",
+				Name:            "acme",
+				AccountWebhooks: tt.accountWebhooks,
+				Options:         &Options{Webhooks: webhooks},
+			}
+			err := p.Init(config)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestACME_AuthorizeAccount(t *testing.T) {
+	newServer := func(t *testing.T, allow bool, called *int) *httptest.Server {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			*called++
+			var req webhook.RequestBody
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			assert.Equal(t, "acme", req.ProvisionerName)
+			assert.Equal(t, &webhook.ACMEAccount{
+				ID:      "accID",
+				KeyID:   "keyID",
+				Contact: []string{"mailto:jane@example.com"},
+			}, req.ACMEAccount)
+			assert.NoError(t, json.NewEncoder(w).Encode(&webhook.ResponseBody{Allow: allow}))
+		}))
+		t.Cleanup(srv.Close)
+		return srv
+	}
+	acc := ACMEAccount{
+		ID:      "accID",
+		KeyID:   "keyID",
+		Contact: []string{"mailto:jane@example.com"},
+	}
+
+	t.Run("ok no account webhooks", func(t *testing.T) {
+		var called int
+		srv := newServer(t, false, &called)
+		p := newACMEAccountWebhooksProvisioner(t, []*Webhook{
+			{Name: "certs", Kind: linkedca.Webhook_AUTHORIZING.String(), URL: srv.URL},
+		})
+		assert.NoError(t, p.AuthorizeAccount(context.Background(), acc))
+		assert.Equal(t, 0, called)
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		var accountCalls, certCalls int
+		accounts := newServer(t, true, &accountCalls)
+		certs := newServer(t, false, &certCalls)
+		p := newACMEAccountWebhooksProvisioner(t, []*Webhook{
+			{Name: "accounts", Kind: linkedca.Webhook_AUTHORIZING.String(), URL: accounts.URL},
+			{Name: "certs", Kind: linkedca.Webhook_AUTHORIZING.String(), URL: certs.URL},
+		}, "accounts")
+		assert.NoError(t, p.AuthorizeAccount(context.Background(), acc))
+		assert.Equal(t, 1, accountCalls)
+		assert.Equal(t, 0, certCalls)
+	})
+
+	t.Run("fail denied", func(t *testing.T) {
+		var called int
+		srv := newServer(t, false, &called)
+		p := newACMEAccountWebhooksProvisioner(t, []*Webhook{
+			{Name: "accounts", Kind: linkedca.Webhook_AUTHORIZING.String(), URL: srv.URL},
+		}, "accounts")
+		assert.ErrorIs(t, p.AuthorizeAccount(context.Background(), acc), ErrWebhookDenied)
+		assert.Equal(t, 1, called)
+	})
+}
+
+func TestACME_AuthorizeSign_accountWebhooks(t *testing.T) {
+	p := newACMEAccountWebhooksProvisioner(t, []*Webhook{
+		{Name: "accounts", Kind: linkedca.Webhook_AUTHORIZING.String()},
+		{Name: "certs", Kind: linkedca.Webhook_AUTHORIZING.String()},
+	}, "accounts")
+	opts, err := p.AuthorizeSign(context.Background(), "")
+	require.NoError(t, err)
+
+	var wc *WebhookController
+	for _, o := range opts {
+		if v, ok := o.(*WebhookController); ok {
+			wc = v
+		}
+	}
+	require.NotNil(t, wc)
+	require.Len(t, wc.webhooks, 1)
+	assert.Equal(t, "certs", wc.webhooks[0].Name)
+}
+
+func TestACME_AuthorizeSign_enrichingWebhooks(t *testing.T) {
+	var order *webhook.ACMEOrder
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req webhook.RequestBody
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		order = req.ACMEOrder
+		assert.NoError(t, json.NewEncoder(w).Encode(&webhook.ResponseBody{
+			Allow: true,
+			Data:  map[string]any{"role": "web"},
+		}))
+	}))
+	t.Cleanup(srv.Close)
+
+	p := newACMEAccountWebhooksProvisioner(t, []*Webhook{
+		{Name: "people", Kind: linkedca.Webhook_ENRICHING.String(), URL: srv.URL, CertType: linkedca.Webhook_X509.String()},
+	})
+	getController := func(t *testing.T, ctx context.Context) *WebhookController {
+		t.Helper()
+		opts, err := p.AuthorizeSign(ctx, "")
+		require.NoError(t, err)
+		for _, o := range opts {
+			if v, ok := o.(*WebhookController); ok {
+				return v
+			}
+		}
+		t.Fatal("webhook controller not found")
+		return nil
+	}
+
+	t.Run("ok order", func(t *testing.T) {
+		data := x509util.NewTemplateData()
+		data.SetCommonName("foo.internal")
+		ctx := NewContextWithACMEOrder(context.Background(), &ACMEOrder{
+			ID:           "orderID",
+			TemplateData: data,
+		})
+		wc := getController(t, ctx)
+		require.NoError(t, wc.Enrich(ctx, &webhook.RequestBody{}))
+		require.NotNil(t, order)
+		assert.Equal(t, "orderID", order.ID)
+		assert.Equal(t, map[string]any{"people": map[string]any{"role": "web"}}, data[x509util.WebhooksKey])
+
+		// The data returned by the webhook is available in the templates.
+		templateOptions, err := CustomTemplateOptions(&Options{
+			X509: &X509Options{Template: `{"subject": {"commonName": {{ toJson .Subject.CommonName }}, "organizationalUnit": {{ toJson .Webhooks.people.role }}}}`},
+		}, data, x509util.DefaultLeafTemplate)
+		require.NoError(t, err)
+		signer, err := keyutil.GenerateDefaultSigner()
+		require.NoError(t, err)
+		csr, err := x509util.CreateCertificateRequest("foo.internal", []string{"foo.internal"}, signer)
+		require.NoError(t, err)
+		crt, err := x509util.NewCertificate(csr, templateOptions.Options(SignOptions{})...)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"web"}, crt.GetCertificate().Subject.OrganizationalUnit)
+	})
+
+	t.Run("ok without order", func(t *testing.T) {
+		ctx := context.Background()
+		wc := getController(t, ctx)
+		require.NotNil(t, wc.TemplateData)
+		assert.NoError(t, wc.Enrich(ctx, &webhook.RequestBody{}))
+	})
+}
@@ -0,0 +1,46 @@
+package provisioner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestACMEAuthorizationReuse_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		reuse   *ACMEAuthorizationReuse
+		wantErr bool
+	}{
+		{"ok nil", nil, false},
+		{"ok empty", &ACMEAuthorizationReuse{}, false},
+		{"ok enabled", &ACMEAuthorizationReuse{Enabled: true}, false},
+		{"ok window", &ACMEAuthorizationReuse{Window: &Duration{Duration: time.Hour}}, false},
+		{"fail window", &ACMEAuthorizationReuse{Window: &Duration{}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.reuse.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestACMEAuthorizationReuse_IsEnabled(t *testing.T) {
+	var r *ACMEAuthorizationReuse
+	assert.False(t, r.IsEnabled())
+	assert.False(t, (&ACMEAuthorizationReuse{}).IsEnabled())
+	assert.True(t, (&ACMEAuthorizationReuse{Enabled: true}).IsEnabled())
+}
+
+func TestACMEAuthorizationReuse_GetWindow(t *testing.T) {
+	var r *ACMEAuthorizationReuse
+	assert.Equal(t, 24*time.Hour, r.GetWindow())
+	assert.Equal(t, 24*time.Hour, (&ACMEAuthorizationReuse{}).GetWindow())
+	assert.Equal(t, time.Hour, (&ACMEAuthorizationReuse{Window: &Duration{Duration: time.Hour}}).GetWindow())
+}
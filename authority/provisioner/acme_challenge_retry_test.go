@@ -0,0 +1,65 @@
+package provisioner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestACMEChallengeRetry_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		retry   *ACMEChallengeRetry
+		wantErr bool
+	}{
+		{"ok nil", nil, false},
+		{"ok empty", &ACMEChallengeRetry{}, false},
+		{"ok", &ACMEChallengeRetry{
+			MaxAttempts: 3,
+			Backoff:     &Duration{Duration: time.Second},
+			MaxBackoff:  &Duration{Duration: time.Minute},
+		}, false},
+		{"fail max attempts", &ACMEChallengeRetry{MaxAttempts: -1}, true},
+		{"fail backoff", &ACMEChallengeRetry{Backoff: &Duration{}}, true},
+		{"fail max backoff", &ACMEChallengeRetry{MaxBackoff: &Duration{}}, true},
+		{"fail max backoff less than backoff", &ACMEChallengeRetry{
+			Backoff:    &Duration{Duration: time.Minute},
+			MaxBackoff: &Duration{Duration: time.Second},
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.retry.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestACMEChallengeRetry_GetMaxAttempts(t *testing.T) {
+	var r *ACMEChallengeRetry
+	assert.Equal(t, 5, r.GetMaxAttempts())
+	assert.Equal(t, 5, (&ACMEChallengeRetry{}).GetMaxAttempts())
+	assert.Equal(t, 2, (&ACMEChallengeRetry{MaxAttempts: 2}).GetMaxAttempts())
+}
+
+func TestACMEChallengeRetry_GetBackoff(t *testing.T) {
+	var r *ACMEChallengeRetry
+	assert.Equal(t, 5*time.Second, r.GetBackoff(1))
+	assert.Equal(t, 10*time.Second, r.GetBackoff(2))
+	assert.Equal(t, 20*time.Second, r.GetBackoff(3))
+	assert.Equal(t, 5*time.Minute, r.GetBackoff(100))
+
+	r = &ACMEChallengeRetry{
+		Backoff:    &Duration{Duration: time.Second},
+		MaxBackoff: &Duration{Duration: 3 * time.Second},
+	}
+	assert.Equal(t, time.Second, r.GetBackoff(0))
+	assert.Equal(t, time.Second, r.GetBackoff(1))
+	assert.Equal(t, 2*time.Second, r.GetBackoff(2))
+	assert.Equal(t, 3*time.Second, r.GetBackoff(3))
+}
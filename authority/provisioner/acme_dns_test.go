@@ -0,0 +1,48 @@
+package provisioner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestACMEDNSValidation_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		v       *ACMEDNSValidation
+		wantErr bool
+	}{
+		{"ok nil", nil, false},
+		{"ok", &ACMEDNSValidation{Resolvers: []string{"tls://1.1.1.1", "tls://dns.example.com:853", "https://dns.example.com/dns-query"}}, false},
+		{"ok options", &ACMEDNSValidation{
+			Resolvers: []string{"tls://1.1.1.1"}, RequireDNSSEC: true, MaxCNAMEs: 2,
+			BypassNegativeCache: true, Timeout: &Duration{Duration: time.Second},
+		}, false},
+		{"fail empty", &ACMEDNSValidation{}, true},
+		{"fail host", &ACMEDNSValidation{Resolvers: []string{"tls://"}}, true},
+		{"fail scheme", &ACMEDNSValidation{Resolvers: []string{"udp://1.1.1.1:53"}}, true},
+		{"fail url", &ACMEDNSValidation{Resolvers: []string{"1.1.1.1"}}, true},
+		{"fail maxCNAMEs", &ACMEDNSValidation{Resolvers: []string{"tls://1.1.1.1"}, MaxCNAMEs: -1}, true},
+		{"fail timeout", &ACMEDNSValidation{Resolvers: []string{"tls://1.1.1.1"}, Timeout: &Duration{Duration: -time.Second}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.v.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestACME_Init_dnsValidation(t *testing.T) {
+	p := &ACME{Type: "ACME", Name: "acme", DNSValidation: &ACMEDNSValidation{Resolvers: []string{"https://dns.example.com/dns-query"}}}
+	assert.NoError(t, p.Init(Config{Claims: globalProvisionerClaims}))
+	assert.Equal(t, p.DNSValidation, p.GetACMEOptions().DNSValidation)
+
+	p = &ACME{Type: "ACME", Name: "acme", DNSValidation: &ACMEDNSValidation{}}
+	assert.Error(t, p.Init(Config{Claims: globalProvisionerClaims}))
+}
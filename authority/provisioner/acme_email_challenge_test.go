@@ -0,0 +1,104 @@
+package provisioner
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/certificates/authority/policy"
+)
+
+func TestACMEEmailChallenge_Validate(t *testing.T) {
+	ok := func() *ACMEEmailChallenge {
+		return &ACMEEmailChallenge{
+			From:        "acme@ca.example.com",
+			SMTPServer:  "smtp.example.com:587",
+			ReplySecret: "secret",
+		}
+	}
+	tests := []struct {
+		name    string
+		modify  func(e *ACMEEmailChallenge) *ACMEEmailChallenge
+		wantErr string
+	}{
+		{"ok nil", func(e *ACMEEmailChallenge) *ACMEEmailChallenge { return nil }, ""},
+		{"ok", func(e *ACMEEmailChallenge) *ACMEEmailChallenge { return e }, ""},
+		{"ok credentials", func(e *ACMEEmailChallenge) *ACMEEmailChallenge {
+			e.Username, e.Password = "user", "pass"
+			return e
+		}, ""},
+		{"fail from", func(e *ACMEEmailChallenge) *ACMEEmailChallenge {
+			e.From = "ACME <acme@ca.example.com>"
+			return e
+		}, `acme emailChallenge from "ACME <acme@ca.example.com>" is not valid`},
+		{"fail smtpServer", func(e *ACMEEmailChallenge) *ACMEEmailChallenge {
+			e.SMTPServer = "smtp.example.com"
+			return e
+		}, `acme emailChallenge smtpServer "smtp.example.com" is not valid`},
+		{"fail username", func(e *ACMEEmailChallenge) *ACMEEmailChallenge {
+			e.Password = "pass"
+			return e
+		}, "acme emailChallenge username cannot be empty"},
+		{"fail replySecret", func(e *ACMEEmailChallenge) *ACMEEmailChallenge {
+			e.ReplySecret = ""
+			return e
+		}, "acme emailChallenge replySecret cannot be empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.modify(ok()).Validate()
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestACME_Init_emailChallenge(t *testing.T) {
+	config := Config{
+		Claims:    globalProvisionerClaims,
+		Audiences: testAudiences,
+	}
+
+	p := &ACME{
+		Type:       "ACME",
+		Name:       "acme",
+		Challenges: []ACMEChallenge{EMAIL_REPLY_00},
+	}
+	assert.EqualError(t, p.Init(config), "acme email-reply-00 challenge requires the emailChallenge options")
+
+	p.EmailChallenge = &ACMEEmailChallenge{
+		From:        "acme@ca.example.com",
+		SMTPServer:  "smtp.example.com:587",
+		ReplySecret: "secret",
+	}
+	require.NoError(t, p.Init(config))
+	assert.Equal(t, p.EmailChallenge, p.GetACMEOptions().EmailChallenge)
+	assert.True(t, p.IsChallengeEnabled(context.Background(), EMAIL_REPLY_00))
+}
+
+func TestACME_AuthorizeOrderIdentifier_email(t *testing.T) {
+	p := &ACME{
+		Type: "ACME",
+		Name: "acme",
+		Options: &Options{
+			X509: &X509Options{
+				AllowedNames: &policy.X509NameOptions{
+					EmailAddresses: []string{"@example.com"},
+				},
+			},
+		},
+	}
+	require.NoError(t, p.Init(Config{
+		Claims:    globalProvisionerClaims,
+		Audiences: testAudiences,
+	}))
+
+	ctx := context.Background()
+	assert.NoError(t, p.AuthorizeOrderIdentifier(ctx, ACMEIdentifier{Type: Email, Value: "jane@example.com"}))
+	assert.Error(t, p.AuthorizeOrderIdentifier(ctx, ACMEIdentifier{Type: Email, Value: "jane@example.org"}))
+}
@@ -0,0 +1,59 @@
+package provisioner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestACMEGarbageCollection_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		gc      *ACMEGarbageCollection
+		wantErr bool
+	}{
+		{"ok nil", nil, false},
+		{"ok empty", &ACMEGarbageCollection{}, false},
+		{"ok", &ACMEGarbageCollection{
+			Interval:         &Duration{Duration: time.Minute},
+			OrderTTL:         &Duration{Duration: time.Hour},
+			AuthorizationTTL: &Duration{Duration: time.Hour},
+			NonceTTL:         &Duration{Duration: time.Hour},
+		}, false},
+		{"fail interval", &ACMEGarbageCollection{Interval: &Duration{}}, true},
+		{"fail order ttl", &ACMEGarbageCollection{OrderTTL: &Duration{Duration: -time.Hour}}, true},
+		{"fail authorization ttl", &ACMEGarbageCollection{AuthorizationTTL: &Duration{}}, true},
+		{"fail nonce ttl", &ACMEGarbageCollection{NonceTTL: &Duration{}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.gc.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestACMEGarbageCollection_defaults(t *testing.T) {
+	for _, gc := range []*ACMEGarbageCollection{nil, {}} {
+		assert.Equal(t, time.Hour, gc.GetInterval())
+		assert.Equal(t, 7*24*time.Hour, gc.GetOrderTTL())
+		assert.Equal(t, 7*24*time.Hour, gc.GetAuthorizationTTL())
+		assert.Equal(t, 24*time.Hour, gc.GetNonceTTL())
+	}
+
+	gc := &ACMEGarbageCollection{
+		Interval:         &Duration{Duration: time.Minute},
+		OrderTTL:         &Duration{Duration: 2 * time.Hour},
+		AuthorizationTTL: &Duration{Duration: 3 * time.Hour},
+		NonceTTL:         &Duration{Duration: 4 * time.Hour},
+	}
+	assert.Equal(t, time.Minute, gc.GetInterval())
+	assert.Equal(t, 2*time.Hour, gc.GetOrderTTL())
+	assert.Equal(t, 3*time.Hour, gc.GetAuthorizationTTL())
+	assert.Equal(t, 4*time.Hour, gc.GetNonceTTL())
+}
@@ -0,0 +1,86 @@
+package provisioner
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestACME_Init_identifierChallenges(t *testing.T) {
+	config := Config{
+		Claims:    globalProvisionerClaims,
+		Audiences: testAudiences,
+	}
+	tests := []struct {
+		name                 string
+		challenges           []ACMEChallenge
+		identifierChallenges map[ACMEIdentifierType][]ACMEChallenge
+		wantErr              string
+	}{
+		{"ok", []ACMEChallenge{DNS_01, DEVICE_ATTEST_01}, map[ACMEIdentifierType][]ACMEChallenge{
+			DNS:                 {DNS_01},
+			PermanentIdentifier: {DEVICE_ATTEST_01},
+		}, ""},
+		{"fail identifier type", nil, map[ACMEIdentifierType][]ACMEChallenge{
+			"foo": {DNS_01},
+		}, `acme identifierChallenges identifier type "foo" is not supported`},
+		{"fail empty", nil, map[ACMEIdentifierType][]ACMEChallenge{
+			DNS: {},
+		}, `acme identifierChallenges for "dns" cannot be empty`},
+		{"fail challenge", nil, map[ACMEIdentifierType][]ACMEChallenge{
+			DNS: {"foo-01"},
+		}, `acme challenge "foo-01" is not supported`},
+		{"fail not enabled", nil, map[ACMEIdentifierType][]ACMEChallenge{
+			PermanentIdentifier: {DEVICE_ATTEST_01},
+		}, `acme identifierChallenges challenge "device-attest-01" for "permanent-identifier" is not enabled`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &ACME{
+				Type:                 "ACME",
+				Name:                 "acme",
+				Challenges:           tt.challenges,
+				IdentifierChallenges: tt.identifierChallenges,
+			}
+			err := p.Init(config)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestACME_IsIdentifierChallengeEnabled(t *testing.T) {
+	ctx := context.Background()
+	p := &ACME{
+		Type:       "ACME",
+		Name:       "acme",
+		Challenges: []ACMEChallenge{HTTP_01, DNS_01, DEVICE_ATTEST_01},
+		IdentifierChallenges: map[ACMEIdentifierType][]ACMEChallenge{
+			DNS:                 {DNS_01},
+			PermanentIdentifier: {DEVICE_ATTEST_01},
+		},
+	}
+	require.NoError(t, p.Init(Config{
+		Claims:    globalProvisionerClaims,
+		Audiences: testAudiences,
+	}))
+
+	assert.True(t, p.IsIdentifierChallengeEnabled(ctx, DNS, DNS_01))
+	assert.False(t, p.IsIdentifierChallengeEnabled(ctx, DNS, HTTP_01))
+	assert.True(t, p.IsIdentifierChallengeEnabled(ctx, PermanentIdentifier, DEVICE_ATTEST_01))
+	assert.False(t, p.IsIdentifierChallengeEnabled(ctx, PermanentIdentifier, DNS_01))
+	// Identifier types without a configuration use the enabled challenges.
+	assert.True(t, p.IsIdentifierChallengeEnabled(ctx, IP, HTTP_01))
+	assert.True(t, p.IsIdentifierChallengeEnabled(ctx, IP, DEVICE_ATTEST_01))
+	assert.False(t, p.IsIdentifierChallengeEnabled(ctx, IP, TLS_ALPN_01))
+
+	// Wildcards require dns-01 for dns identifiers.
+	p.IdentifierChallenges[DNS] = []ACMEChallenge{HTTP_01}
+	assert.EqualError(t, p.AuthorizeOrderIdentifier(ctx, ACMEIdentifier{Type: DNS, Value: "*.example.com"}),
+		`wildcard identifier "*.example.com" requires the dns-01 challenge`)
+}
@@ -0,0 +1,62 @@
+package provisioner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestACME_validateDirectoryMeta(t *testing.T) {
+	config := Config{
+		Claims:    globalProvisionerClaims,
+		Audiences: testAudiences,
+	}
+	tests := []struct {
+		name    string
+		modify  func(p *ACME)
+		wantErr string
+	}{
+		{"ok empty", func(p *ACME) {}, ""},
+		{"ok", func(p *ACME) {
+			p.TermsOfService = "https://ca.example.com/terms"
+			p.Website = "https://ca.example.com"
+			p.CaaIdentities = []string{"ca.example.com", "Example-CA.com"}
+		}, ""},
+		{"fail termsOfService", func(p *ACME) {
+			p.TermsOfService = "/terms"
+		}, `acme termsOfService "/terms" is not valid`},
+		{"fail website", func(p *ACME) {
+			p.Website = "ca.example.com"
+		}, `acme website "ca.example.com" is not valid`},
+		{"fail caaIdentities scheme", func(p *ACME) {
+			p.CaaIdentities = []string{"https://ca.example.com"}
+		}, `acme caaIdentities "https://ca.example.com" is not valid`},
+		{"fail caaIdentities empty label", func(p *ACME) {
+			p.CaaIdentities = []string{"ca..example.com"}
+		}, `acme caaIdentities "ca..example.com" is not valid`},
+		{"fail caaIdentities hyphen", func(p *ACME) {
+			p.CaaIdentities = []string{"-ca.example.com"}
+		}, `acme caaIdentities "-ca.example.com" is not valid`},
+		{"fail caaIdentities ip", func(p *ACME) {
+			p.CaaIdentities = []string{"10.0.0.1"}
+		}, `acme caaIdentities "10.0.0.1" is not valid`},
+		{"fail caaIdentities empty", func(p *ACME) {
+			p.CaaIdentities = []string{""}
+		}, `acme caaIdentities "" is not valid`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &ACME{Type: "ACME", Name: "acme"}
+			tt.modify(p)
+			err := p.validateDirectoryMeta()
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			// Invalid properties only log a warning.
+			assert.NoError(t, p.Init(config))
+		})
+	}
+}
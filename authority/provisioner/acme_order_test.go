@@ -0,0 +1,75 @@
+package provisioner
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/certificates/webhook"
+)
+
+func TestACMEOrderFromContext(t *testing.T) {
+	_, ok := ACMEOrderFromContext(context.Background())
+	assert.False(t, ok)
+
+	_, ok = ACMEOrderFromContext(NewContextWithACMEOrder(context.Background(), nil))
+	assert.False(t, ok)
+
+	order := &ACMEOrder{ID: "oID"}
+	got, ok := ACMEOrderFromContext(NewContextWithACMEOrder(context.Background(), order))
+	assert.True(t, ok)
+	assert.Equal(t, order, got)
+}
+
+func TestACME_AuthorizeSign_order(t *testing.T) {
+	p, err := generateACME()
+	require.NoError(t, err)
+
+	webhookController := func(opts []SignOption) *WebhookController {
+		for _, o := range opts {
+			if wc, ok := o.(*WebhookController); ok {
+				return wc
+			}
+		}
+		t.Fatal("sign options do not contain a webhook controller")
+		return nil
+	}
+
+	opts, err := p.AuthorizeSign(context.Background(), "")
+	require.NoError(t, err)
+	assert.Empty(t, webhookController(opts).options)
+
+	ctx := NewContextWithACMEOrder(context.Background(), &ACMEOrder{
+		ID: "oID",
+		Identifiers: []ACMEIdentifier{
+			{Type: DNS, Value: "foo.internal"},
+			{Type: IP, Value: "10.0.0.1"},
+		},
+		Profile: "shortlived",
+		Account: ACMEAccount{
+			ID:      "accID",
+			KeyID:   "kid",
+			Contact: []string{"mailto:jane@example.com"},
+		},
+	})
+	opts, err = p.AuthorizeSign(ctx, "")
+	require.NoError(t, err)
+
+	body, err := webhook.NewRequestBody(webhookController(opts).options...)
+	require.NoError(t, err)
+	assert.Equal(t, &webhook.ACMEOrder{
+		ID: "oID",
+		Identifiers: []webhook.ACMEIdentifier{
+			{Type: "dns", Value: "foo.internal"},
+			{Type: "ip", Value: "10.0.0.1"},
+		},
+		Profile: "shortlived",
+	}, body.ACMEOrder)
+	assert.Equal(t, &webhook.ACMEAccount{
+		ID:      "accID",
+		KeyID:   "kid",
+		Contact: []string{"mailto:jane@example.com"},
+	}, body.ACMEAccount)
+}
@@ -0,0 +1,120 @@
+package provisioner
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestACME_Init_profiles(t *testing.T) {
+	tests := []struct {
+		name     string
+		profiles map[string]*ACMEProfile
+		wantErr  bool
+	}{
+		{"ok", map[string]*ACMEProfile{
+			"classic":    {Description: "The classic profile"},
+			"shortlived": {Description: "Short-lived certificates", Claims: &Claims{DefaultTLSDur: &Duration{Duration: 6 * time.Hour}}},
+		}, false},
+		{"ok x509", map[string]*ACMEProfile{
+			"tlsserver": {Description: "TLS server", X509: &X509Options{Template: `{"subject": {{ toJson .Subject }}}`}},
+		}, false},
+		{"fail empty name", map[string]*ACMEProfile{"": {Description: "empty"}}, true},
+		{"fail nil profile", map[string]*ACMEProfile{"classic": nil}, true},
+		{"fail claims", map[string]*ACMEProfile{
+			"shortlived": {Claims: &Claims{MinTLSDur: &Duration{Duration: 2 * time.Hour}, MaxTLSDur: &Duration{Duration: time.Hour}}},
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &ACME{Type: "ACME", Name: "acme", Profiles: tt.profiles}
+			err := p.Init(Config{Claims: globalProvisionerClaims})
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestACME_AuthorizeSign_profile(t *testing.T) {
+	x509Options := &X509Options{Template: `{"subject": {{ toJson .Subject }}}`}
+	p := &ACME{
+		Type: "ACME",
+		Name: "acme",
+		Profiles: map[string]*ACMEProfile{
+			"classic": {Description: "The classic profile"},
+			"shortlived": {
+				Description: "Short-lived certificates",
+				Claims: &Claims{
+					MinTLSDur:     &Duration{Duration: time.Minute},
+					MaxTLSDur:     &Duration{Duration: 12 * time.Hour},
+					DefaultTLSDur: &Duration{Duration: 6 * time.Hour},
+				},
+				X509: x509Options,
+			},
+		},
+	}
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims}))
+
+	durations := func(t *testing.T, opts []SignOption) (def, minDur, maxDur time.Duration) {
+		t.Helper()
+		for _, o := range opts {
+			switch v := o.(type) {
+			case profileDefaultDuration:
+				def = time.Duration(v)
+			case *validityValidator:
+				minDur, maxDur = v.min, v.max
+			}
+		}
+		return
+	}
+
+	t.Run("ok no profile", func(t *testing.T) {
+		opts, err := p.AuthorizeSign(context.Background(), "")
+		require.NoError(t, err)
+		def, minDur, maxDur := durations(t, opts)
+		assert.Equal(t, p.ctl.Claimer.DefaultTLSCertDuration(), def)
+		assert.Equal(t, p.ctl.Claimer.MinTLSCertDuration(), minDur)
+		assert.Equal(t, p.ctl.Claimer.MaxTLSCertDuration(), maxDur)
+		assert.Equal(t, p.Options, p.GetProfileOptions(""))
+	})
+
+	t.Run("ok classic", func(t *testing.T) {
+		ctx := NewContextWithACMEProfile(context.Background(), "classic")
+		opts, err := p.AuthorizeSign(ctx, "")
+		require.NoError(t, err)
+		def, minDur, maxDur := durations(t, opts)
+		assert.Equal(t, p.ctl.Claimer.DefaultTLSCertDuration(), def)
+		assert.Equal(t, p.ctl.Claimer.MinTLSCertDuration(), minDur)
+		assert.Equal(t, p.ctl.Claimer.MaxTLSCertDuration(), maxDur)
+		assert.Equal(t, p.Options, p.GetProfileOptions("classic"))
+	})
+
+	t.Run("ok shortlived", func(t *testing.T) {
+		ctx := NewContextWithACMEProfile(context.Background(), "shortlived")
+		opts, err := p.AuthorizeSign(ctx, "")
+		require.NoError(t, err)
+		def, minDur, maxDur := durations(t, opts)
+		assert.Equal(t, 6*time.Hour, def)
+		assert.Equal(t, time.Minute, minDur)
+		assert.Equal(t, 12*time.Hour, maxDur)
+		assert.Equal(t, x509Options, p.GetProfileOptions("shortlived").GetX509Options())
+
+		profile, ok := p.GetProfile("shortlived")
+		require.True(t, ok)
+		assert.Equal(t, 6*time.Hour, profile.DefaultTLSCertDuration())
+	})
+
+	t.Run("fail unknown", func(t *testing.T) {
+		ctx := NewContextWithACMEProfile(context.Background(), "unknown")
+		_, err := p.AuthorizeSign(ctx, "")
+		assert.Error(t, err)
+		_, ok := p.GetProfile("unknown")
+		assert.False(t, ok)
+	})
+}
@@ -0,0 +1,41 @@
+package provisioner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestACMERenewalInfo_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		renewalInfo *ACMERenewalInfo
+		wantErr     bool
+	}{
+		{"ok nil", nil, false},
+		{"ok", &ACMERenewalInfo{
+			RetryAfter:     &Duration{Duration: time.Hour},
+			ExplanationURL: "https://ca.example.com/incident",
+		}, false},
+		{"fail retry after", &ACMERenewalInfo{RetryAfter: &Duration{}}, true},
+		{"fail explanation url", &ACMERenewalInfo{ExplanationURL: "incident"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.renewalInfo.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestACMERenewalInfo_GetRetryAfter(t *testing.T) {
+	var r *ACMERenewalInfo
+	assert.Equal(t, 6*time.Hour, r.GetRetryAfter())
+	assert.Equal(t, 6*time.Hour, (&ACMERenewalInfo{}).GetRetryAfter())
+	assert.Equal(t, time.Hour, (&ACMERenewalInfo{RetryAfter: &Duration{Duration: time.Hour}}).GetRetryAfter())
+}
@@ -0,0 +1,46 @@
+package provisioner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestACME_Init_autoRenewal(t *testing.T) {
+	tests := []struct {
+		name            string
+		autoRenewal     *ACMEAutoRenewal
+		wantMinLifetime time.Duration
+		wantMaxDuration time.Duration
+		wantErr         bool
+	}{
+		{"ok defaults", &ACMEAutoRenewal{}, 5 * time.Minute, 365 * 24 * time.Hour, false},
+		{"ok", &ACMEAutoRenewal{
+			MinLifetime: &Duration{Duration: time.Hour},
+			MaxDuration: &Duration{Duration: 30 * 24 * time.Hour},
+		}, time.Hour, 30 * 24 * time.Hour, false},
+		{"fail min lifetime", &ACMEAutoRenewal{MinLifetime: &Duration{Duration: -time.Hour}}, 0, 0, true},
+		{"fail min lifetime greater than max", &ACMEAutoRenewal{MinLifetime: &Duration{Duration: 48 * time.Hour}}, 0, 0, true},
+		{"fail max duration", &ACMEAutoRenewal{
+			MinLifetime: &Duration{Duration: time.Hour},
+			MaxDuration: &Duration{Duration: time.Minute},
+		}, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &ACME{Type: "ACME", Name: "acme", AutoRenewal: tt.autoRenewal}
+			err := p.Init(Config{Claims: globalProvisionerClaims})
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			ar := p.GetACMEOptions().AutoRenewal
+			assert.Equal(t, tt.wantMinLifetime, ar.GetMinLifetime())
+			assert.Equal(t, p.ctl.Claimer.MaxTLSCertDuration(), ar.GetMaxLifetime())
+			assert.Equal(t, tt.wantMaxDuration, ar.GetMaxDuration())
+		})
+	}
+}
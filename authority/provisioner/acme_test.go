@@ -134,6 +134,12 @@ func TestACME_Init(t *testing.T) {
 				err: errors.New("acme attestation format \"zar\" is not supported"),
 			}
 		},
+		"fail-bad-eab-algorithm": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p:   &ACME{Name: "foo", Type: "bar", EABAlgorithms: []string{"HS384", "ES256"}},
+				err: errors.New("acme eab algorithm \"ES256\" is not supported"),
+			}
+		},
 		"fail-parse-attestation-roots": func(t *testing.T) ProvisionerValidateTest {
 			return ProvisionerValidateTest{
 				p:   &ACME{Name: "foo", Type: "bar", AttestationRoots: []byte("-----BEGIN CERTIFICATE-----\nZm9v\n-----END CERTIFICATE-----")},
@@ -376,3 +382,30 @@ func TestACME_IsAttestationFormatEnabled(t *testing.T) {
 		})
 	}
 }
+
+func TestACME_IsEABAlgorithmAllowed(t *testing.T) {
+	tests := []struct {
+		name          string
+		eabAlgorithms []string
+		alg           string
+		want          bool
+	}{
+		{"ok", []string{"HS384"}, "HS384", true},
+		{"ok empty HS256", nil, "HS256", true},
+		{"ok empty HS384", nil, "HS384", true},
+		{"ok empty HS512", []string{}, "HS512", true},
+		{"fail HS256", []string{"HS384", "HS512"}, "HS256", false},
+		{"fail empty ES256", nil, "ES256", false},
+		{"fail empty none", nil, "none", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &ACME{
+				EABAlgorithms: tt.eabAlgorithms,
+			}
+			if got := p.IsEABAlgorithmAllowed(tt.alg); got != tt.want {
+				t.Errorf("ACME.IsEABAlgorithmAllowed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package provisioner
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/certificates/authority/policy"
+)
+
+func TestACME_AreWildcardsAllowed(t *testing.T) {
+	yes, no := true, false
+	assert.True(t, (&ACME{}).AreWildcardsAllowed())
+	assert.True(t, (&ACME{AllowWildcards: &yes}).AreWildcardsAllowed())
+	assert.False(t, (&ACME{AllowWildcards: &no}).AreWildcardsAllowed())
+}
+
+func TestACME_AuthorizeOrderIdentifier_wildcard(t *testing.T) {
+	no := false
+	withPolicy := &Options{
+		X509: &X509Options{
+			AllowedNames:       &policy.X509NameOptions{DNSDomains: []string{"example.com", "*.example.com", "*.internal.example.com"}},
+			DeniedNames:        &policy.X509NameOptions{DNSDomains: []string{"internal.example.com"}},
+			AllowWildcardNames: true,
+		},
+	}
+
+	tests := []struct {
+		name       string
+		prov       *ACME
+		identifier ACMEIdentifier
+		wantErr    bool
+	}{
+		{"ok", &ACME{}, ACMEIdentifier{Type: DNS, Value: "*.example.com"}, false},
+		{"ok not wildcard", &ACME{AllowWildcards: &no}, ACMEIdentifier{Type: DNS, Value: "www.example.com"}, false},
+		{"ok policy", &ACME{Options: withPolicy}, ACMEIdentifier{Type: DNS, Value: "*.example.com"}, false},
+		{"ok policy subdomain", &ACME{Options: withPolicy}, ACMEIdentifier{Type: DNS, Value: "www.example.com"}, false},
+		{"fail not allowed", &ACME{AllowWildcards: &no}, ACMEIdentifier{Type: DNS, Value: "*.example.com"}, true},
+		{"fail no dns-01", &ACME{Challenges: []ACMEChallenge{HTTP_01, TLS_ALPN_01}}, ACMEIdentifier{Type: DNS, Value: "*.example.com"}, true},
+		{"fail policy", &ACME{Options: withPolicy}, ACMEIdentifier{Type: DNS, Value: "*.example.org"}, true},
+		{"fail policy base domain", &ACME{Options: withPolicy}, ACMEIdentifier{Type: DNS, Value: "*.internal.example.com"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.prov.Type = "ACME"
+			tt.prov.Name = "acme"
+			require.NoError(t, tt.prov.Init(Config{Claims: globalProvisionerClaims}))
+			err := tt.prov.AuthorizeOrderIdentifier(context.Background(), tt.identifier)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
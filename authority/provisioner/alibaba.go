@@ -0,0 +1,543 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/sshutil"
+	"go.step.sm/crypto/x509util"
+	"go.step.sm/linkedca"
+
+	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/certificates/webhook"
+)
+
+// alibabaIssuer is the string used as issuer in the generated tokens.
+const alibabaIssuer = "ecs.aliyuncs.com"
+
+// alibabaIdentityURL is the url used to retrieve the instance identity
+// document.
+const alibabaIdentityURL = "http://100.100.100.200/latest/dynamic/instance-identity/document"
+
+// alibabaSignatureURL is the url used to retrieve the PKCS #7 signature of the
+// instance identity document.
+const alibabaSignatureURL = "http://100.100.100.200/latest/dynamic/instance-identity/pkcs7"
+
+// alibabaAPITokenURL is the url used to get a token in the metadata service
+// hardened mode.
+const alibabaAPITokenURL = "http://100.100.100.200/latest/api/token" //nolint:gosec // no credentials here
+
+// alibabaMetadataTokenHeader is the header used to send the metadata token.
+const alibabaMetadataTokenHeader = "X-aliyun-ecs-metadata-token" //nolint:gosec // no credentials here
+
+// alibabaMetadataTokenTTLHeader is the header used to indicate the token TTL
+// requested.
+const alibabaMetadataTokenTTLHeader = "X-aliyun-ecs-metadata-token-ttl-seconds" //nolint:gosec // no credentials here
+
+type alibabaConfig struct {
+	identityURL  string
+	signatureURL string
+	tokenURL     string
+	certificates []*x509.Certificate
+}
+
+func newAlibabaConfig() *alibabaConfig {
+	return &alibabaConfig{
+		identityURL:  alibabaIdentityURL,
+		signatureURL: alibabaSignatureURL,
+		tokenURL:     alibabaAPITokenURL,
+	}
+}
+
+type alibabaPayload struct {
+	jose.Claims
+	Alibaba  alibabaIdentityPayload `json:"alibaba"`
+	document alibabaInstanceIdentityDocument
+}
+
+type alibabaIdentityPayload struct {
+	Document []byte `json:"document"`
+	PKCS7    []byte `json:"pkcs7"`
+}
+
+type alibabaInstanceIdentityDocument struct {
+	OwnerAccountID string `json:"owner-account-id"`
+	InstanceID     string `json:"instance-id"`
+	InstanceType   string `json:"instance-type"`
+	ImageID        string `json:"image-id"`
+	RegionID       string `json:"region-id"`
+	ZoneID         string `json:"zone-id"`
+	PrivateIPv4    string `json:"private-ipv4"`
+	SerialNumber   string `json:"serial-number"`
+	Mac            string `json:"mac"`
+	Audience       string `json:"audience"`
+}
+
+// Alibaba is the provisioner that supports identity tokens created from the
+// Alibaba Cloud ECS instance identity documents. The documents are signed by
+// Alibaba Cloud with PKCS #7 and bound to the audience of the CA, and the
+// signature is verified with the certificates in IIDRoots.
+//
+// If DisableCustomSANs is true, only the private IP will be added as a SAN. By
+// default it will accept any SAN in the CSR.
+//
+// If DisableTrustOnFirstUse is true, multiple sign request for this provisioner
+// with the same instance will be accepted. By default only the first request
+// will be accepted.
+//
+// Accounts restricts the owner accounts of the instances allowed.
+//
+// Alibaba Cloud instance identity docs are available at
+// https://www.alibabacloud.com/help/en/ecs/user-guide/use-instance-identities
+type Alibaba struct {
+	*base
+	ID                     string   `json:"-"`
+	Type                   string   `json:"type"`
+	Name                   string   `json:"name"`
+	Accounts               []string `json:"accounts"`
+	DisableCustomSANs      bool     `json:"disableCustomSANs"`
+	DisableTrustOnFirstUse bool     `json:"disableTrustOnFirstUse"`
+	IIDRoots               string   `json:"iidRoots"`
+	Claims                 *Claims  `json:"claims,omitempty"`
+	Options                *Options `json:"options,omitempty"`
+	config                 *alibabaConfig
+	ctl                    *Controller
+}
+
+// GetID returns the provisioner unique identifier.
+func (p *Alibaba) GetID() string {
+	if p.ID != "" {
+		return p.ID
+	}
+	return p.GetIDForToken()
+}
+
+// GetIDForToken returns an identifier that will be used to load the provisioner
+// from a token.
+func (p *Alibaba) GetIDForToken() string {
+	return "alibaba/" + p.Name
+}
+
+// GetTokenID returns the identifier of the token.
+func (p *Alibaba) GetTokenID(token string) (string, error) {
+	payload, err := p.authorizeToken(token)
+	if err != nil {
+		return "", err
+	}
+
+	// If TOFU is disabled create an ID for the token, so it cannot be reused.
+	if p.DisableTrustOnFirstUse {
+		sum := sha256.Sum256([]byte(token))
+		return strings.ToLower(hex.EncodeToString(sum[:])), nil
+	}
+
+	// Use provisioner + instance-id as the identifier.
+	return p.GetTOFUTokenID(payload.document.InstanceID), nil
+}
+
+// GetTOFUInstanceID returns the instance id in the identity document of the
+// token.
+func (p *Alibaba) GetTOFUInstanceID(token string) (string, error) {
+	if p.DisableTrustOnFirstUse {
+		return "", nil
+	}
+	payload, err := p.authorizeToken(token)
+	if err != nil {
+		return "", err
+	}
+	return payload.document.InstanceID, nil
+}
+
+// GetTOFUTokenID returns the SHA256 of "provisioner_id.instance_id".
+func (p *Alibaba) GetTOFUTokenID(instanceID string) string {
+	return tofuTokenID(fmt.Sprintf("%s.%s", p.GetIDForToken(), instanceID))
+}
+
+// GetName returns the name of the provisioner.
+func (p *Alibaba) GetName() string {
+	return p.Name
+}
+
+// GetType returns the type of provisioner.
+func (p *Alibaba) GetType() Type {
+	return TypeAlibaba
+}
+
+// GetEncryptedKey is not available in an Alibaba provisioner.
+func (p *Alibaba) GetEncryptedKey() (kid, key string, ok bool) {
+	return "", "", false
+}
+
+// GetOptions returns the configured provisioner options.
+func (p *Alibaba) GetOptions() *Options {
+	return p.Options
+}
+
+// GetIdentityToken retrieves the identity document and its signature for the
+// audience of the CA, and generates a token with them.
+func (p *Alibaba) GetIdentityToken(subject, caURL string) (string, error) {
+	// Initialize the config if this method is used from the cli.
+	p.assertConfig()
+
+	audience, err := generateSignAudience(caURL, p.GetIDForToken())
+	if err != nil {
+		return "", err
+	}
+
+	doc, err := p.readURL(p.config.identityURL)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving identity document:\n  Are you in an Alibaba Cloud ECS instance?\n  Is the metadata service enabled?")
+	}
+	sig, err := p.readURL(p.config.signatureURL + "?audience=" + url.QueryEscape(audience))
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving identity document signature:\n  Are you in an Alibaba Cloud ECS instance?\n  Is the metadata service enabled?")
+	}
+	signature, err := decodeIIDPKCS7(sig)
+	if err != nil {
+		return "", errors.Wrap(err, "error decoding identity document signature")
+	}
+
+	// The signed document is the identity document with the audience.
+	doc = []byte(strings.TrimSuffix(strings.TrimSpace(string(doc)), "}"))
+	audienceJSON, err := json.Marshal(audience)
+	if err != nil {
+		return "", errors.Wrap(err, "error marshaling audience")
+	}
+	doc = append(doc, []byte(`,"audience":`+string(audienceJSON)+`}`)...)
+
+	var idoc alibabaInstanceIdentityDocument
+	if err := json.Unmarshal(doc, &idoc); err != nil {
+		return "", errors.Wrap(err, "error unmarshaling identity document")
+	}
+	if subject == "" {
+		subject = idoc.InstanceID
+	}
+
+	// Create a JWT from the identity document
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.HS256, Key: signature},
+		new(jose.SignerOptions).WithType("JWT"),
+	)
+	if err != nil {
+		return "", errors.Wrap(err, "error creating signer")
+	}
+
+	now := time.Now()
+	payload := alibabaPayload{
+		Claims: jose.Claims{
+			Issuer:    alibabaIssuer,
+			Subject:   subject,
+			Audience:  []string{audience},
+			Expiry:    jose.NewNumericDate(now.Add(5 * time.Minute)),
+			NotBefore: jose.NewNumericDate(now),
+			IssuedAt:  jose.NewNumericDate(now),
+		},
+		Alibaba: alibabaIdentityPayload{
+			Document: doc,
+			PKCS7:    signature,
+		},
+	}
+
+	tok, err := jose.Signed(signer).Claims(payload).CompactSerialize()
+	if err != nil {
+		return "", errors.Wrap(err, "error serializing token")
+	}
+	return tok, nil
+}
+
+// Init validates and initializes the Alibaba provisioner.
+func (p *Alibaba) Init(config Config) (err error) {
+	switch {
+	case p.Type == "":
+		return errors.New("provisioner type cannot be empty")
+	case p.Name == "":
+		return errors.New("provisioner name cannot be empty")
+	case p.IIDRoots == "":
+		return errors.New("provisioner iidRoots cannot be empty")
+	}
+
+	// Add default config
+	p.assertConfig()
+	if p.config.certificates, err = loadIIDCertificates(p.IIDRoots); err != nil {
+		return err
+	}
+
+	config.Audiences = config.Audiences.WithFragment(p.GetIDForToken())
+	p.Options = mergeOptions(p.Options, config.DefaultOptions, p.GetType())
+	p.ctl, err = NewController(p, p.Claims, config, p.Options)
+	return
+}
+
+// assertConfig initializes the config if it has not been initialized.
+func (p *Alibaba) assertConfig() {
+	if p.config == nil {
+		p.config = newAlibabaConfig()
+	}
+}
+
+// readURL does a GET request to the given url and returns the body. It uses a
+// metadata token if the metadata service supports it, as required by the
+// hardened mode.
+func (p *Alibaba) readURL(u string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, u, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	if token, err := p.readMetadataToken(); err == nil {
+		req.Header.Set(alibabaMetadataTokenHeader, token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("request for metadata returned non-successful status code %d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// readMetadataToken returns a short lived token of the metadata service.
+func (p *Alibaba) readMetadataToken() (string, error) {
+	req, err := http.NewRequest(http.MethodPut, p.config.tokenURL, http.NoBody)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set(alibabaMetadataTokenTTLHeader, "30")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return "", fmt.Errorf("request for metadata token returned non-successful status code %d", resp.StatusCode)
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// authorizeToken performs common jwt authorization actions and returns the
+// claims for case specific downstream parsing.
+func (p *Alibaba) authorizeToken(token string) (*alibabaPayload, error) {
+	jwt, err := jose.ParseSigned(token)
+	if err != nil {
+		return nil, errs.Wrapf(http.StatusUnauthorized, err, "alibaba.authorizeToken; error parsing alibaba token")
+	}
+	if len(jwt.Headers) == 0 {
+		return nil, errs.InternalServer("alibaba.authorizeToken; error parsing token, header is missing")
+	}
+
+	var unsafeClaims alibabaPayload
+	if err := jwt.UnsafeClaimsWithoutVerification(&unsafeClaims); err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "alibaba.authorizeToken; error unmarshaling claims")
+	}
+
+	var payload alibabaPayload
+	if err := jwt.Claims(unsafeClaims.Alibaba.PKCS7, &payload); err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "alibaba.authorizeToken; error verifying claims")
+	}
+
+	// Validate identity document signature
+	document, err := verifyIIDPKCS7(payload.Alibaba.PKCS7, payload.Alibaba.Document, p.config.certificates)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "alibaba.authorizeToken; invalid alibaba token signature")
+	}
+
+	var doc alibabaInstanceIdentityDocument
+	if err := json.Unmarshal(document, &doc); err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "alibaba.authorizeToken; error unmarshaling alibaba identity document")
+	}
+
+	switch {
+	case doc.OwnerAccountID == "":
+		return nil, errs.Unauthorized("alibaba.authorizeToken; alibaba identity document owner-account-id cannot be empty")
+	case doc.InstanceID == "":
+		return nil, errs.Unauthorized("alibaba.authorizeToken; alibaba identity document instance-id cannot be empty")
+	case doc.PrivateIPv4 == "":
+		return nil, errs.Unauthorized("alibaba.authorizeToken; alibaba identity document private-ipv4 cannot be empty")
+	case doc.RegionID == "":
+		return nil, errs.Unauthorized("alibaba.authorizeToken; alibaba identity document region-id cannot be empty")
+	}
+
+	// According to "rfc7519 JSON Web Token" acceptable skew should be no
+	// more than a few minutes.
+	if err = payload.ValidateWithLeeway(jose.Expected{
+		Issuer: alibabaIssuer,
+		Time:   time.Now().UTC(),
+	}, time.Minute); err != nil {
+		return nil, errs.Wrapf(http.StatusUnauthorized, err, "alibaba.authorizeToken; invalid alibaba token")
+	}
+
+	// validate audiences with the defaults, the signed document must be bound
+	// to this CA too
+	if !matchesAudience(payload.Audience, p.ctl.Audiences.Sign) {
+		return nil, errs.Unauthorized("alibaba.authorizeToken; invalid token - invalid audience claim (aud)")
+	}
+	if !matchesAudience([]string{doc.Audience}, p.ctl.Audiences.Sign) {
+		return nil, errs.Unauthorized("alibaba.authorizeToken; invalid alibaba identity document - invalid audience")
+	}
+
+	// Validate subject, it has to be known if disableCustomSANs is enabled
+	if p.DisableCustomSANs {
+		if payload.Subject != doc.InstanceID && payload.Subject != doc.PrivateIPv4 {
+			return nil, errs.Unauthorized("alibaba.authorizeToken; invalid token - invalid subject claim (sub)")
+		}
+	}
+
+	// validate accounts
+	if len(p.Accounts) > 0 && !slices.Contains(p.Accounts, doc.OwnerAccountID) {
+		return nil, errs.Unauthorized("alibaba.authorizeToken; invalid alibaba identity document - owner-account-id is not valid")
+	}
+
+	payload.document = doc
+	return &payload, nil
+}
+
+// AuthorizeSign validates the given token and returns the sign options that
+// will be used on certificate creation.
+func (p *Alibaba) AuthorizeSign(ctx context.Context, token string) ([]SignOption, error) {
+	payload, err := p.authorizeToken(token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "alibaba.AuthorizeSign")
+	}
+
+	doc := payload.document
+
+	// Template options
+	data := x509util.NewTemplateData()
+	data.SetCommonName(payload.Claims.Subject)
+	if v, err := unsafeParseSigned(token); err == nil {
+		data.SetToken(v)
+	}
+
+	// Enforce known CN and default IP if configured.
+	// By default we'll accept the CN and SANs in the CSR.
+	// There's no way to trust them other than TOFU.
+	var so []SignOption
+	if p.DisableCustomSANs {
+		so = append(so,
+			dnsNamesValidator(nil),
+			ipAddressesValidator([]net.IP{
+				net.ParseIP(doc.PrivateIPv4),
+			}),
+			emailAddressesValidator(nil),
+			newURIsValidator(ctx, nil),
+		)
+
+		// Template options
+		data.SetSANs([]string{doc.PrivateIPv4})
+	}
+
+	templateOptions, err := CustomTemplateOptions(p.Options, data, x509util.DefaultIIDLeafTemplate)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "alibaba.AuthorizeSign")
+	}
+
+	return append(so,
+		p,
+		templateOptions,
+		// modifiers / withOptions
+		newProvisionerExtensionOption(TypeAlibaba, p.Name, doc.OwnerAccountID, "InstanceID", doc.InstanceID).WithControllerOptions(p.ctl),
+		profileDefaultDuration(p.ctl.Claimer.DefaultTLSCertDuration()),
+		// validators
+		defaultPublicKeyValidator{},
+		commonNameValidator(payload.Claims.Subject),
+		newValidityValidator(p.ctl.Claimer.MinTLSCertDuration(), p.ctl.Claimer.MaxTLSCertDuration()),
+		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
+		p.ctl.newWebhookController(
+			data,
+			linkedca.Webhook_X509,
+			webhook.WithAuthorizationPrincipal(doc.InstanceID),
+		),
+	), nil
+}
+
+// AuthorizeRenew returns an error if the renewal is disabled.
+func (p *Alibaba) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) error {
+	return p.ctl.AuthorizeRenew(ctx, cert)
+}
+
+// AuthorizeSSHSign returns the list of SignOption for a SignSSH request.
+func (p *Alibaba) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption, error) {
+	if !p.ctl.Claimer.IsSSHCAEnabled() {
+		return nil, errs.Unauthorized("alibaba.AuthorizeSSHSign; ssh ca is disabled for alibaba provisioner '%s'", p.GetName())
+	}
+	claims, err := p.authorizeToken(token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "alibaba.AuthorizeSSHSign")
+	}
+
+	doc := claims.document
+	signOptions := []SignOption{}
+
+	// Enforce host certificate.
+	defaults := SignSSHOptions{
+		CertType: SSHHostCert,
+	}
+
+	// Validated principals.
+	principals := []string{doc.PrivateIPv4}
+
+	// Only enforce known principals if disable custom sans is true.
+	if p.DisableCustomSANs {
+		defaults.Principals = principals
+	} else {
+		// Check that at least one principal is sent in the request.
+		signOptions = append(signOptions, &sshCertOptionsRequireValidator{
+			Principals: true,
+		})
+	}
+
+	// Certificate templates.
+	data := sshutil.CreateTemplateData(sshutil.HostCert, doc.InstanceID, principals)
+	if v, err := unsafeParseSigned(token); err == nil {
+		data.SetToken(v)
+	}
+	audit := newSSHAuditMetadata(ctx, p, doc.InstanceID, data)
+
+	templateOptions, err := CustomSSHTemplateOptions(p.Options, data, sshutil.DefaultIIDTemplate)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "alibaba.AuthorizeSSHSign")
+	}
+	signOptions = append(signOptions, templateOptions)
+
+	return append(signOptions,
+		p,
+		audit,
+		// Validate user SignSSHOptions.
+		sshCertOptionsValidator(defaults),
+		// Set the validity bounds if not set.
+		&sshDefaultDuration{p.ctl.Claimer},
+		// Validate public key
+		&sshDefaultPublicKeyValidator{},
+		// Validate the validity period.
+		&sshCertValidityValidator{p.ctl.Claimer},
+		// Require all the fields in the SSH certificate
+		&sshCertDefaultValidator{},
+		// Ensure that all principal names are allowed
+		newSSHNamePolicyValidator(p.ctl.getPolicy().getSSHHost(), nil),
+		// Call webhooks
+		p.ctl.newWebhookController(
+			data,
+			linkedca.Webhook_SSH,
+			webhook.WithAuthorizationPrincipal(doc.InstanceID),
+		),
+	), nil
+}
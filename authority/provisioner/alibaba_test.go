@@ -0,0 +1,187 @@
+package provisioner
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+)
+
+const testAlibabaDocument = `{"owner-account-id":"1234567890","instance-id":"i-bp1abc","instance-type":"ecs.g6.large","image-id":"ubuntu_22_04","region-id":"cn-hangzhou","zone-id":"cn-hangzhou-i","private-ipv4":"172.16.0.10","serial-number":"abc-123","mac":"00:16:3e:00:00:01"`
+
+func generateAlibaba(t *testing.T) (*Alibaba, *x509.Certificate, crypto.Signer) {
+	t.Helper()
+	crt, key, path := generateIIDSigner(t)
+	p := &Alibaba{
+		Type:     "Alibaba",
+		Name:     "alibaba",
+		IIDRoots: path,
+	}
+	require.NoError(t, p.Init(Config{
+		Claims:    globalProvisionerClaims,
+		Audiences: testAudiences,
+	}))
+	return p, crt, key
+}
+
+func generateAlibabaToken(t *testing.T, sub, aud, docAudience string, crt *x509.Certificate, key crypto.Signer) string {
+	t.Helper()
+	doc := []byte(testAlibabaDocument + `,"audience":"` + docAudience + `"}`)
+	signature := signIIDDocument(t, crt, key, doc, true)
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.HS256, Key: signature},
+		new(jose.SignerOptions).WithType("JWT"),
+	)
+	require.NoError(t, err)
+	now := time.Now()
+	tok, err := jose.Signed(signer).Claims(alibabaPayload{
+		Claims: jose.Claims{
+			Issuer:    alibabaIssuer,
+			Subject:   sub,
+			Audience:  []string{aud},
+			Expiry:    jose.NewNumericDate(now.Add(5 * time.Minute)),
+			NotBefore: jose.NewNumericDate(now),
+			IssuedAt:  jose.NewNumericDate(now),
+		},
+		Alibaba: alibabaIdentityPayload{
+			Document: doc,
+			PKCS7:    signature,
+		},
+	}).CompactSerialize()
+	require.NoError(t, err)
+	return tok
+}
+
+func TestAlibaba_Init(t *testing.T) {
+	config := Config{
+		Claims:    globalProvisionerClaims,
+		Audiences: testAudiences,
+	}
+	p, _, _ := generateAlibaba(t)
+	assert.Equal(t, "alibaba/alibaba", p.GetID())
+	assert.Equal(t, TypeAlibaba, p.GetType())
+
+	assert.EqualError(t, (&Alibaba{Name: "alibaba"}).Init(config), "provisioner type cannot be empty")
+	assert.EqualError(t, (&Alibaba{Type: "Alibaba"}).Init(config), "provisioner name cannot be empty")
+	assert.EqualError(t, (&Alibaba{Type: "Alibaba", Name: "alibaba"}).Init(config), "provisioner iidRoots cannot be empty")
+	assert.Error(t, (&Alibaba{Type: "Alibaba", Name: "alibaba", IIDRoots: "testdata/missing.pem"}).Init(config))
+}
+
+func TestAlibaba_authorizeToken(t *testing.T) {
+	p, crt, key := generateAlibaba(t)
+	otherCrt, otherKey, _ := generateIIDSigner(t)
+	aud := p.ctl.Audiences.Sign[0]
+
+	tests := []struct {
+		name              string
+		token             string
+		accounts          []string
+		disableCustomSANs bool
+		wantErr           bool
+	}{
+		{"ok", generateAlibabaToken(t, "foo.example.com", aud, aud, crt, key), nil, false, false},
+		{"ok accounts", generateAlibabaToken(t, "i-bp1abc", aud, aud, crt, key), []string{"1234567890"}, true, false},
+		{"ok ip", generateAlibabaToken(t, "172.16.0.10", aud, aud, crt, key), nil, true, false},
+		{"fail signer", generateAlibabaToken(t, "i-bp1abc", aud, aud, otherCrt, otherKey), nil, false, true},
+		{"fail audience", generateAlibabaToken(t, "i-bp1abc", "https://ca.example.com/1.0/sign", aud, crt, key), nil, false, true},
+		{"fail document audience", generateAlibabaToken(t, "i-bp1abc", aud, "https://ca.example.com/1.0/sign", crt, key), nil, false, true},
+		{"fail subject", generateAlibabaToken(t, "foo.example.com", aud, aud, crt, key), nil, true, true},
+		{"fail accounts", generateAlibabaToken(t, "i-bp1abc", aud, aud, crt, key), []string{"0987654321"}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p.Accounts = tt.accounts
+			p.DisableCustomSANs = tt.disableCustomSANs
+
+			payload, err := p.authorizeToken(tt.token)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "i-bp1abc", payload.document.InstanceID)
+			assert.Equal(t, "1234567890", payload.document.OwnerAccountID)
+
+			id, err := p.GetTokenID(tt.token)
+			require.NoError(t, err)
+			assert.Equal(t, p.GetTOFUTokenID("i-bp1abc"), id)
+		})
+	}
+}
+
+func TestAlibaba_AuthorizeSign(t *testing.T) {
+	p, crt, key := generateAlibaba(t)
+	aud := p.ctl.Audiences.Sign[0]
+	token := generateAlibabaToken(t, "i-bp1abc", aud, aud, crt, key)
+
+	opts, err := p.AuthorizeSign(context.Background(), token)
+	require.NoError(t, err)
+	assert.Contains(t, opts, commonNameValidator("i-bp1abc"))
+	assert.NotContains(t, opts, ipAddressesValidator([]net.IP{net.ParseIP("172.16.0.10")}))
+
+	p.DisableCustomSANs = true
+	opts, err = p.AuthorizeSign(context.Background(), token)
+	require.NoError(t, err)
+	assert.Contains(t, opts, ipAddressesValidator([]net.IP{net.ParseIP("172.16.0.10")}))
+
+	opts, err = p.AuthorizeSSHSign(context.Background(), token)
+	require.NoError(t, err)
+	assert.Contains(t, opts, sshCertOptionsValidator(SignSSHOptions{
+		CertType:   SSHHostCert,
+		Principals: []string{"172.16.0.10"},
+	}))
+}
+
+func TestAlibaba_GetIdentityToken(t *testing.T) {
+	p, crt, key := generateAlibaba(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			if r.Method != http.MethodPut || r.Header.Get(alibabaMetadataTokenTTLHeader) == "" {
+				http.Error(w, "bad request", http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, "the-token")
+			return
+		case "/document", "/pkcs7":
+			if r.Header.Get(alibabaMetadataTokenHeader) != "the-token" {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+		}
+		switch r.URL.Path {
+		case "/document":
+			fmt.Fprint(w, testAlibabaDocument+"}")
+		case "/pkcs7":
+			doc := []byte(testAlibabaDocument + `,"audience":"` + r.URL.Query().Get("audience") + `"}`)
+			fmt.Fprint(w, base64.StdEncoding.EncodeToString(signIIDDocument(t, crt, key, doc, true)))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	p.config.identityURL = srv.URL + "/document"
+	p.config.signatureURL = srv.URL + "/pkcs7"
+	p.config.tokenURL = srv.URL + "/token"
+
+	token, err := p.GetIdentityToken("", "https://ca.smallstep.com")
+	require.NoError(t, err)
+	payload, err := p.authorizeToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, "i-bp1abc", payload.Subject)
+
+	p.config.identityURL = srv.URL + "/missing"
+	_, err = p.GetIdentityToken("", "https://ca.smallstep.com")
+	assert.Error(t, err)
+}
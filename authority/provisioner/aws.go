@@ -13,7 +13,10 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"regexp"
+	"slices"
 	"strings"
+	"text/template"
 	"time"
 
 	"github.com/pkg/errors"
@@ -68,6 +71,8 @@ type awsConfig struct {
 	tokenTTL           string
 	certificates       []*x509.Certificate
 	signatureAlgorithm x509.SignatureAlgorithm
+	stsHostPattern     *regexp.Regexp
+	stsClient          *http.Client
 }
 
 func newAWSConfig(certPath string) (*awsConfig, error) {
@@ -110,6 +115,8 @@ func newAWSConfig(certPath string) (*awsConfig, error) {
 		tokenTTL:           awsAPITokenTTL,
 		certificates:       certs,
 		signatureAlgorithm: awsSignatureAlgorithm,
+		stsHostPattern:     awsSTSHostPattern,
+		stsClient:          &http.Client{Timeout: 10 * time.Second},
 	}, nil
 }
 
@@ -118,11 +125,13 @@ type awsPayload struct {
 	Amazon   awsAmazonPayload `json:"amazon"`
 	SANs     []string         `json:"sans"`
 	document awsInstanceIdentityDocument
+	identity *awsCallerIdentity
 }
 
 type awsAmazonPayload struct {
-	Document  []byte `json:"document"`
-	Signature []byte `json:"signature"`
+	Document   []byte         `json:"document"`
+	Signature  []byte         `json:"signature"`
+	IAMRequest *awsIAMRequest `json:"iamRequest,omitempty"`
 }
 
 type awsInstanceIdentityDocument struct {
@@ -148,6 +157,14 @@ type awsInstanceIdentityDocument struct {
 // If DisableCustomSANs is true, only the internal DNS and IP will be added as a
 // SAN. By default it will accept any SAN in the CSR.
 //
+// SANTemplates can be used with DisableCustomSANs to replace the internal DNS
+// and IP with the SANs rendered from the instance identity document, e.g.
+// "{{ .AWS.InstanceID }}.{{ .AWS.Region }}.example.com", or with the default
+// private DNS name in {{ .PrivateDNS }}. They are also used as the principals
+// of SSH host certificates. The templates are parsed on Init. Only the signed
+// fields of the document are available, the VPC, subnet and tags of the
+// instance are not part of it, and cannot be used.
+//
 // If DisableTrustOnFirstUse is true, multiple sign request for this provisioner
 // with the same instance will be accepted. By default only the first request
 // will be accepted.
@@ -155,26 +172,42 @@ type awsInstanceIdentityDocument struct {
 // If InstanceAge is set, only the instances with a pendingTime within the given
 // period will be accepted.
 //
+// AccountRegions can be used to restrict the regions allowed for an account.
+// The accounts not in AccountRegions are allowed in any region.
+//
 // IIDRoots can be used to specify a path to the certificates used to verify the
 // identity certificate signature.
 //
+// If IAMRoles is set, tokens with a signed STS GetCallerIdentity request are
+// also accepted. This allows workloads without an instance identity document,
+// like ECS tasks using a task role or EKS pods using IAM roles for service
+// accounts (IRSA), to get a certificate. The role of the caller must be one of
+// the given role ARNs, and the certificates are bound to it. If
+// AllowCrossAccountRoles is true, the given roles are also accepted if their
+// account is not one of the Accounts.
+//
 // Amazon Identity docs are available at
 // https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/instance-identity-documents.html
 type AWS struct {
 	*base
-	ID                     string   `json:"-"`
-	Type                   string   `json:"type"`
-	Name                   string   `json:"name"`
-	Accounts               []string `json:"accounts"`
-	DisableCustomSANs      bool     `json:"disableCustomSANs"`
-	DisableTrustOnFirstUse bool     `json:"disableTrustOnFirstUse"`
-	IMDSVersions           []string `json:"imdsVersions"`
-	InstanceAge            Duration `json:"instanceAge,omitempty"`
-	IIDRoots               string   `json:"iidRoots,omitempty"`
-	Claims                 *Claims  `json:"claims,omitempty"`
-	Options                *Options `json:"options,omitempty"`
+	ID                     string              `json:"-"`
+	Type                   string              `json:"type"`
+	Name                   string              `json:"name"`
+	Accounts               []string            `json:"accounts"`
+	DisableCustomSANs      bool                `json:"disableCustomSANs"`
+	SANTemplates           []string            `json:"sanTemplates,omitempty"`
+	DisableTrustOnFirstUse bool                `json:"disableTrustOnFirstUse"`
+	IMDSVersions           []string            `json:"imdsVersions"`
+	InstanceAge            Duration            `json:"instanceAge,omitempty"`
+	AccountRegions         map[string][]string `json:"accountRegions,omitempty"`
+	IIDRoots               string              `json:"iidRoots,omitempty"`
+	IAMRoles               []string            `json:"iamRoles,omitempty"`
+	AllowCrossAccountRoles bool                `json:"allowCrossAccountRoles,omitempty"`
+	Claims                 *Claims             `json:"claims,omitempty"`
+	Options                *Options            `json:"options,omitempty"`
 	config                 *awsConfig
 	ctl                    *Controller
+	sanTemplates           []*template.Template
 }
 
 // GetID returns the provisioner unique identifier.
@@ -197,6 +230,12 @@ func (p *AWS) GetTokenID(token string) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	// Tokens with an IAM identity are identified by the signature of the STS
+	// request, so they cannot be reused.
+	if payload.identity != nil {
+		return payload.ID, nil
+	}
+
 	// If TOFU is disabled create an ID for the token, so it cannot be reused.
 	// The timestamps, document and signatures should be mostly unique.
 	if p.DisableTrustOnFirstUse {
@@ -205,9 +244,7 @@ func (p *AWS) GetTokenID(token string) (string, error) {
 	}
 
 	// Use provisioner + instance-id as the identifier.
-	unique := fmt.Sprintf("%s.%s", p.GetIDForToken(), payload.document.InstanceID)
-	sum := sha256.Sum256([]byte(unique))
-	return strings.ToLower(hex.EncodeToString(sum[:])), nil
+	return p.GetTOFUTokenID(payload.document.InstanceID), nil
 }
 
 // GetName returns the name of the provisioner.
@@ -225,6 +262,11 @@ func (p *AWS) GetEncryptedKey() (kid, key string, ok bool) {
 	return "", "", false
 }
 
+// GetOptions returns the configured provisioner options.
+func (p *AWS) GetOptions() *Options {
+	return p.Options
+}
+
 // GetIdentityToken retrieves the identity document and it's signature and
 // generates a token with them.
 func (p *AWS) GetIdentityToken(subject, caURL string) (string, error) {
@@ -329,7 +371,28 @@ func (p *AWS) Init(config Config) (err error) {
 		}
 	}
 
+	// validate account regions
+	for account, regions := range p.AccountRegions {
+		if len(p.Accounts) > 0 && !slices.Contains(p.Accounts, account) {
+			return errors.Errorf("provisioner accountRegions contains account %s, but it is not in accounts", account)
+		}
+		if len(regions) == 0 {
+			return errors.Errorf("provisioner accountRegions for account %s cannot be empty", account)
+		}
+	}
+
+	// validate SAN templates
+	if p.sanTemplates, err = parseSANTemplates(p.SANTemplates, p.DisableCustomSANs); err != nil {
+		return err
+	}
+
+	// validate IAM roles
+	if err := p.validateIAMRoles(); err != nil {
+		return err
+	}
+
 	config.Audiences = config.Audiences.WithFragment(p.GetIDForToken())
+	p.Options = mergeOptions(p.Options, config.DefaultOptions, p.GetType())
 	p.ctl, err = NewController(p, p.Claims, config, p.Options)
 	return
 }
@@ -341,6 +404,9 @@ func (p *AWS) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "aws.AuthorizeSign")
 	}
+	if payload.identity != nil {
+		return p.authorizeIAMSign(ctx, token, payload)
+	}
 
 	doc := payload.document
 
@@ -355,8 +421,18 @@ func (p *AWS) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 	// By default we'll accept the CN and SANs in the CSR.
 	// There's no way to trust them other than TOFU.
 	var so []SignOption
-	if p.DisableCustomSANs {
-		dnsName := fmt.Sprintf("ip-%s.%s.compute.internal", strings.ReplaceAll(doc.PrivateIP, ".", "-"), doc.Region)
+	switch {
+	case p.DisableCustomSANs && len(p.SANTemplates) > 0:
+		sans, err := renderSANTemplates(p.sanTemplates, p.sanTemplateData(doc))
+		if err != nil {
+			return nil, errs.Wrap(http.StatusUnauthorized, err, "aws.AuthorizeSign; invalid aws identity document")
+		}
+		so = append(so, newDefaultSANsValidator(ctx, sans))
+
+		// Template options
+		data.SetSANs(sans)
+	case p.DisableCustomSANs:
+		dnsName := awsPrivateDNSName(doc)
 		so = append(so,
 			dnsNamesValidator([]string{dnsName}),
 			ipAddressesValidator([]net.IP{
@@ -394,6 +470,20 @@ func (p *AWS) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 	), nil
 }
 
+// sanTemplateData returns the data available in the SANTemplates, the
+// instance identity document and the default private DNS name of the instance.
+func (p *AWS) sanTemplateData(doc awsInstanceIdentityDocument) map[string]interface{} {
+	return map[string]interface{}{
+		"AWS":        doc,
+		"PrivateDNS": awsPrivateDNSName(doc),
+	}
+}
+
+// awsPrivateDNSName returns the default private DNS name of an instance.
+func awsPrivateDNSName(doc awsInstanceIdentityDocument) string {
+	return fmt.Sprintf("ip-%s.%s.compute.internal", strings.ReplaceAll(doc.PrivateIP, ".", "-"), doc.Region)
+}
+
 // AuthorizeRenew returns an error if the renewal is disabled.
 // NOTE: This method does not actually validate the certificate or check it's
 // revocation status. Just confirms that the provisioner that created the
@@ -536,6 +626,9 @@ func (p *AWS) authorizeToken(token string) (*awsPayload, error) {
 	if err := jwt.UnsafeClaimsWithoutVerification(&unsafeClaims); err != nil {
 		return nil, errs.Wrap(http.StatusUnauthorized, err, "aws.authorizeToken; error unmarshaling claims")
 	}
+	if unsafeClaims.Amazon.IAMRequest != nil {
+		return p.authorizeIAMToken(jwt, unsafeClaims.Amazon.IAMRequest)
+	}
 
 	var payload awsPayload
 	if err := jwt.Claims(unsafeClaims.Amazon.Signature, &payload); err != nil {
@@ -580,9 +673,16 @@ func (p *AWS) authorizeToken(token string) (*awsPayload, error) {
 
 	// Validate subject, it has to be known if disableCustomSANs is enabled
 	if p.DisableCustomSANs {
+		var sans []string
+		if len(p.SANTemplates) > 0 {
+			if sans, err = renderSANTemplates(p.sanTemplates, p.sanTemplateData(doc)); err != nil {
+				return nil, errs.Wrap(http.StatusUnauthorized, err, "aws.authorizeToken; invalid aws identity document")
+			}
+		}
 		if payload.Subject != doc.InstanceID &&
 			payload.Subject != doc.PrivateIP &&
-			payload.Subject != fmt.Sprintf("ip-%s.%s.compute.internal", strings.ReplaceAll(doc.PrivateIP, ".", "-"), doc.Region) {
+			payload.Subject != awsPrivateDNSName(doc) &&
+			!slices.Contains(sans, payload.Subject) {
 			return nil, errs.Unauthorized("aws.authorizeToken; invalid token - invalid subject claim (sub)")
 		}
 	}
@@ -601,6 +701,11 @@ func (p *AWS) authorizeToken(token string) (*awsPayload, error) {
 		}
 	}
 
+	// validate regions
+	if regions, ok := p.AccountRegions[doc.AccountID]; ok && !slices.Contains(regions, doc.Region) {
+		return nil, errs.Unauthorized("aws.authorizeToken; invalid aws identity document - region is not valid")
+	}
+
 	// validate instance age
 	if d := p.InstanceAge.Value(); d > 0 {
 		if now.Sub(doc.PendingTime) > d {
@@ -613,7 +718,7 @@ func (p *AWS) authorizeToken(token string) (*awsPayload, error) {
 }
 
 // AuthorizeSSHSign returns the list of SignOption for a SignSSH request.
-func (p *AWS) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, error) {
+func (p *AWS) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption, error) {
 	if !p.ctl.Claimer.IsSSHCAEnabled() {
 		return nil, errs.Unauthorized("aws.AuthorizeSSHSign; ssh ca is disabled for aws provisioner '%s'", p.GetName())
 	}
@@ -621,6 +726,9 @@ func (p *AWS) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, e
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "aws.AuthorizeSSHSign")
 	}
+	if claims.identity != nil {
+		return nil, errs.Unauthorized("aws.AuthorizeSSHSign; aws iam identities cannot sign ssh certificates")
+	}
 
 	doc := claims.document
 	signOptions := []SignOption{}
@@ -633,7 +741,12 @@ func (p *AWS) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, e
 	// Validated principals.
 	principals := []string{
 		doc.PrivateIP,
-		fmt.Sprintf("ip-%s.%s.compute.internal", strings.ReplaceAll(doc.PrivateIP, ".", "-"), doc.Region),
+		awsPrivateDNSName(doc),
+	}
+	if len(p.SANTemplates) > 0 {
+		if principals, err = renderSANTemplates(p.sanTemplates, p.sanTemplateData(doc)); err != nil {
+			return nil, errs.Wrap(http.StatusUnauthorized, err, "aws.AuthorizeSSHSign; invalid aws identity document")
+		}
 	}
 
 	// Only enforce known principals if disable custom sans is true.
@@ -651,6 +764,7 @@ func (p *AWS) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, e
 	if v, err := unsafeParseSigned(token); err == nil {
 		data.SetToken(v)
 	}
+	audit := newSSHAuditMetadata(ctx, p, doc.InstanceID, data)
 
 	templateOptions, err := CustomSSHTemplateOptions(p.Options, data, sshutil.DefaultIIDTemplate)
 	if err != nil {
@@ -660,6 +774,7 @@ func (p *AWS) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, e
 
 	return append(signOptions,
 		p,
+		audit,
 		// Validate user SignSSHOptions.
 		sshCertOptionsValidator(defaults),
 		// Set the validity bounds if not set.
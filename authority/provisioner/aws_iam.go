@@ -0,0 +1,297 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/x509util"
+	"go.step.sm/linkedca"
+
+	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/certificates/webhook"
+)
+
+// awsSTSHostPattern matches the hosts of the AWS Security Token Service
+// endpoints. The signed GetCallerIdentity requests are only sent to these
+// hosts.
+var awsSTSHostPattern = regexp.MustCompile(`^sts(\.[a-z0-9-]+)?\.amazonaws\.com(\.cn)?$`)
+
+// awsSTSAudienceHeader is the header that binds a signed GetCallerIdentity
+// request to the CA. It must be one of the signed headers, and its value must
+// be the audience of the provisioner.
+const awsSTSAudienceHeader = "X-Step-Audience"
+
+// awsSTSRequestBody is the only body accepted in a GetCallerIdentity request.
+const awsSTSRequestBody = "Action=GetCallerIdentity&Version=2011-06-15"
+
+// awsIAMRequest is a GetCallerIdentity request signed with AWS Signature
+// Version 4 using the credentials of an IAM role, e.g. the credentials of an
+// ECS task role or the web identity credentials of an EKS service account
+// (IRSA). The CA sends the request to STS to verify the identity of the client.
+type awsIAMRequest struct {
+	Method  string      `json:"method"`
+	URL     string      `json:"url"`
+	Headers http.Header `json:"headers"`
+	Body    []byte      `json:"body"`
+}
+
+// awsCallerIdentity is the identity returned by STS for a GetCallerIdentity
+// request. RoleARN is the ARN of the role derived from the assumed-role ARN.
+type awsCallerIdentity struct {
+	Arn      string `xml:"GetCallerIdentityResult>Arn"`
+	UserID   string `xml:"GetCallerIdentityResult>UserId"`
+	Account  string `xml:"GetCallerIdentityResult>Account"`
+	RoleARN  string `xml:"-"`
+	RoleName string `xml:"-"`
+}
+
+// awsRoleFromARN returns the role ARN and name of an assumed-role ARN, e.g.
+// arn:aws:sts::123456789012:assumed-role/my-role/my-session returns
+// arn:aws:iam::123456789012:role/my-role. IAM role ARNs are also accepted,
+// but the path of the role is not part of the returned ARN.
+func awsRoleFromARN(arn string) (roleARN, roleName string, err error) {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" || parts[1] == "" || parts[4] == "" {
+		return "", "", errors.Errorf("%q is not a valid ARN", arn)
+	}
+	resource := strings.Split(parts[5], "/")
+	switch {
+	case parts[2] == "sts" && len(resource) == 3 && resource[0] == "assumed-role":
+		roleName = resource[1]
+	case parts[2] == "iam" && len(resource) >= 2 && resource[0] == "role":
+		roleName = resource[len(resource)-1]
+	default:
+		return "", "", errors.Errorf("%q is not a role ARN", arn)
+	}
+	if roleName == "" {
+		return "", "", errors.Errorf("%q is not a role ARN", arn)
+	}
+	return "arn:" + parts[1] + ":iam::" + parts[4] + ":role/" + roleName, roleName, nil
+}
+
+// validateIAMRoles returns an error if the configured IAM roles are not valid
+// role ARNs.
+func (p *AWS) validateIAMRoles() error {
+	for _, role := range p.IAMRoles {
+		if _, _, err := awsRoleFromARN(role); err != nil {
+			return errors.Wrap(err, "provisioner iamRoles contains an invalid role")
+		}
+	}
+	return nil
+}
+
+// isIAMRoleAllowed returns true if the given role ARN is one of the configured
+// IAM roles. The path of the configured roles is ignored.
+func (p *AWS) isIAMRoleAllowed(roleARN string) bool {
+	for _, role := range p.IAMRoles {
+		if arn, _, err := awsRoleFromARN(role); err == nil && arn == roleARN {
+			return true
+		}
+	}
+	return false
+}
+
+// authorizeIAMToken validates a token containing a signed GetCallerIdentity
+// request. The request is sent to STS and the returned role must be one of the
+// configured IAM roles.
+func (p *AWS) authorizeIAMToken(jwt *jose.JSONWebToken, iamRequest *awsIAMRequest) (*awsPayload, error) {
+	if len(p.IAMRoles) == 0 {
+		return nil, errs.Unauthorized("aws.authorizeToken; aws iam identities are not enabled for provisioner '%s'", p.GetName())
+	}
+
+	// The token is signed with the signature of the request, like the identity
+	// document tokens, the request itself is verified by STS.
+	authorization := iamRequest.Headers.Get("Authorization")
+	if authorization == "" {
+		return nil, errs.Unauthorized("aws.authorizeToken; aws iam request authorization header cannot be empty")
+	}
+	var payload awsPayload
+	if err := jwt.Claims([]byte(authorization), &payload); err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "aws.authorizeToken; error verifying claims")
+	}
+	if err := p.validateIAMRequest(iamRequest); err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "aws.authorizeToken; invalid aws iam request")
+	}
+
+	now := time.Now().UTC()
+	if err := payload.ValidateWithLeeway(jose.Expected{
+		Issuer: awsIssuer,
+		Time:   now,
+	}, time.Minute); err != nil {
+		return nil, errs.Wrapf(http.StatusUnauthorized, err, "aws.authorizeToken; invalid aws token")
+	}
+	if !matchesAudience(payload.Audience, p.ctl.Audiences.Sign) {
+		return nil, errs.Unauthorized("aws.authorizeToken; invalid token - invalid audience claim (aud)")
+	}
+
+	identity, err := p.getCallerIdentity(iamRequest)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "aws.authorizeToken; error verifying aws iam identity")
+	}
+
+	// validate accounts, the roles are explicitly allowed, so they can be in
+	// other accounts if cross-account roles are allowed
+	if len(p.Accounts) > 0 && !p.AllowCrossAccountRoles {
+		var found bool
+		for _, sa := range p.Accounts {
+			if sa == identity.Account {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, errs.Unauthorized("aws.authorizeToken; invalid aws iam identity - account is not valid")
+		}
+	}
+
+	// validate roles
+	if !p.isIAMRoleAllowed(identity.RoleARN) {
+		return nil, errs.Unauthorized("aws.authorizeToken; invalid aws iam identity - role %s is not allowed", identity.RoleARN)
+	}
+
+	sum := sha256.Sum256([]byte(authorization))
+	payload.ID = strings.ToLower(hex.EncodeToString(sum[:]))
+	payload.identity = identity
+	return &payload, nil
+}
+
+// validateIAMRequest checks that the request is a GetCallerIdentity request
+// to an STS endpoint, signed with AWS Signature Version 4 and bound to the
+// audience of the provisioner.
+func (p *AWS) validateIAMRequest(r *awsIAMRequest) error {
+	if r.Method != http.MethodPost {
+		return errors.Errorf("method %q is not valid", r.Method)
+	}
+	u, err := url.Parse(r.URL)
+	if err != nil {
+		return errors.Wrap(err, "error parsing url")
+	}
+	if u.Scheme != "https" || !p.config.stsHostPattern.MatchString(u.Host) || (u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+		return errors.Errorf("url %q is not a valid sts endpoint", r.URL)
+	}
+	if string(r.Body) != awsSTSRequestBody {
+		return errors.New("body is not a GetCallerIdentity request")
+	}
+
+	authorization := r.Headers.Get("Authorization")
+	if !strings.HasPrefix(authorization, "AWS4-HMAC-SHA256 ") {
+		return errors.New("authorization header is not an AWS Signature Version 4")
+	}
+	var signedHeaders []string
+	for _, part := range strings.Split(strings.TrimPrefix(authorization, "AWS4-HMAC-SHA256 "), ",") {
+		if v, ok := strings.CutPrefix(strings.TrimSpace(part), "SignedHeaders="); ok {
+			signedHeaders = strings.Split(v, ";")
+		}
+	}
+	var signed bool
+	for _, h := range signedHeaders {
+		if strings.EqualFold(h, awsSTSAudienceHeader) {
+			signed = true
+			break
+		}
+	}
+	if !signed {
+		return errors.Errorf("%s header is not signed", awsSTSAudienceHeader)
+	}
+	if !matchesAudience([]string{r.Headers.Get(awsSTSAudienceHeader)}, p.ctl.Audiences.Sign) {
+		return errors.Errorf("%s header is not valid", awsSTSAudienceHeader)
+	}
+	return nil
+}
+
+// getCallerIdentity sends the signed GetCallerIdentity request to STS and
+// returns the identity of the caller.
+func (p *AWS) getCallerIdentity(r *awsIAMRequest) (*awsCallerIdentity, error) {
+	req, err := http.NewRequest(r.Method, r.URL, strings.NewReader(string(r.Body)))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range r.Headers {
+		req.Header[http.CanonicalHeaderKey(k)] = v
+	}
+	req.Header.Set("Accept", "application/xml")
+
+	resp, err := p.config.stsClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error sending request to sts")
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading sts response")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("sts returned status code %d", resp.StatusCode)
+	}
+
+	var identity awsCallerIdentity
+	if err := xml.Unmarshal(b, &identity); err != nil {
+		return nil, errors.Wrap(err, "error unmarshaling sts response")
+	}
+	if identity.Account == "" || identity.Arn == "" {
+		return nil, errors.New("sts response does not contain the caller identity")
+	}
+	if identity.RoleARN, identity.RoleName, err = awsRoleFromARN(identity.Arn); err != nil {
+		return nil, err
+	}
+	if !strings.Contains(identity.RoleARN, ":"+identity.Account+":") {
+		return nil, errors.Errorf("sts returned the arn %q for the account %q", identity.Arn, identity.Account)
+	}
+	return &identity, nil
+}
+
+// authorizeIAMSign returns the sign options for a token with an IAM identity.
+// The certificates are bound to the role ARN, it is set as the common name and
+// the only URI SAN.
+func (p *AWS) authorizeIAMSign(ctx context.Context, token string, payload *awsPayload) ([]SignOption, error) {
+	identity := payload.identity
+	roleURL, err := url.Parse(identity.RoleARN)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "aws.AuthorizeSign")
+	}
+
+	// Template options
+	data := x509util.NewTemplateData()
+	data.SetCommonName(identity.RoleARN)
+	data.SetSANs([]string{identity.RoleARN})
+	if v, err := unsafeParseSigned(token); err == nil {
+		data.SetToken(v)
+	}
+
+	templateOptions, err := CustomTemplateOptions(p.Options, data, x509util.DefaultLeafTemplate)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "aws.AuthorizeSign")
+	}
+
+	return []SignOption{
+		p,
+		templateOptions,
+		// modifiers / withOptions
+		newProvisionerExtensionOption(TypeAWS, p.Name, identity.Account, "RoleARN", identity.RoleARN).WithControllerOptions(p.ctl),
+		profileDefaultDuration(p.ctl.Claimer.DefaultTLSCertDuration()),
+		// validators
+		defaultPublicKeyValidator{},
+		commonNameValidator(identity.RoleARN),
+		dnsNamesValidator(nil),
+		ipAddressesValidator(nil),
+		emailAddressesValidator(nil),
+		newURIsValidator(ctx, []*url.URL{roleURL}),
+		newValidityValidator(p.ctl.Claimer.MinTLSCertDuration(), p.ctl.Claimer.MaxTLSCertDuration()),
+		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
+		p.ctl.newWebhookController(
+			data,
+			linkedca.Webhook_X509,
+			webhook.WithAuthorizationPrincipal(identity.RoleARN),
+		),
+	}, nil
+}
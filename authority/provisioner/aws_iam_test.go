@@ -0,0 +1,212 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+)
+
+func TestAWSRoleFromARN(t *testing.T) {
+	tests := []struct {
+		arn          string
+		wantRoleARN  string
+		wantRoleName string
+		wantErr      bool
+	}{
+		{"arn:aws:sts::123456789012:assumed-role/my-role/my-session", "arn:aws:iam::123456789012:role/my-role", "my-role", false},
+		{"arn:aws-cn:sts::123456789012:assumed-role/my-role/i-123", "arn:aws-cn:iam::123456789012:role/my-role", "my-role", false},
+		{"arn:aws:iam::123456789012:role/my-role", "arn:aws:iam::123456789012:role/my-role", "my-role", false},
+		{"arn:aws:iam::123456789012:role/path/to/my-role", "arn:aws:iam::123456789012:role/my-role", "my-role", false},
+		{"arn:aws:iam::123456789012:user/jane", "", "", true},
+		{"arn:aws:sts::123456789012:federated-user/jane", "", "", true},
+		{"arn:aws:sts:::assumed-role/my-role/my-session", "", "", true},
+		{"my-role", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arn, func(t *testing.T) {
+			roleARN, roleName, err := awsRoleFromARN(tt.arn)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantRoleARN, roleARN)
+			assert.Equal(t, tt.wantRoleName, roleName)
+		})
+	}
+}
+
+func TestAWS_Init_iamRoles(t *testing.T) {
+	config := Config{
+		Claims:    globalProvisionerClaims,
+		Audiences: testAudiences,
+	}
+	p := &AWS{Type: "AWS", Name: "aws", IAMRoles: []string{"arn:aws:iam::123456789012:role/my-role"}}
+	assert.NoError(t, p.Init(config))
+
+	p = &AWS{Type: "AWS", Name: "aws", IAMRoles: []string{"my-role"}}
+	assert.Error(t, p.Init(config))
+}
+
+func TestAWS_authorizeIAMToken(t *testing.T) {
+	p, err := generateAWS()
+	require.NoError(t, err)
+	account := p.Accounts[0]
+	p.IAMRoles = []string{"arn:aws:iam::" + account + ":role/path/my-role"}
+
+	arn := "arn:aws:sts::" + account + ":assumed-role/my-role/my-session"
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		if err != nil || string(b) != awsSTSRequestBody || r.Header.Get("Authorization") == "" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if r.Header.Get("X-Amz-Security-Token") == "expired" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		fmt.Fprintf(w, `<GetCallerIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <GetCallerIdentityResult>
+    <Arn>%s</Arn>
+    <UserId>AROAEXAMPLE:my-session</UserId>
+    <Account>%s</Account>
+  </GetCallerIdentityResult>
+</GetCallerIdentityResponse>`, r.Header.Get("X-Test-Arn"), account)
+	}))
+	defer srv.Close()
+	p.config.stsHostPattern = regexp.MustCompile(`^127\.0\.0\.1:\d+$`)
+	p.config.stsClient = srv.Client()
+
+	authorization := "AWS4-HMAC-SHA256 Credential=ASIAEXAMPLE/20240101/us-east-1/sts/aws4_request, SignedHeaders=content-type;host;x-amz-date;x-step-audience, Signature=0123456789abcdef"
+	request := func(modify func(r *awsIAMRequest)) *awsIAMRequest {
+		r := &awsIAMRequest{
+			Method: http.MethodPost,
+			URL:    srv.URL + "/",
+			Headers: http.Header{
+				"Authorization":   {authorization},
+				"Content-Type":    {"application/x-www-form-urlencoded; charset=utf-8"},
+				"X-Amz-Date":      {"20240101T000000Z"},
+				"X-Step-Audience": {p.ctl.Audiences.Sign[0]},
+				"X-Test-Arn":      {arn},
+			},
+			Body: []byte(awsSTSRequestBody),
+		}
+		if modify != nil {
+			modify(r)
+		}
+		return r
+	}
+	newToken := func(r *awsIAMRequest, aud string) string {
+		signer, err := jose.NewSigner(
+			jose.SigningKey{Algorithm: jose.HS256, Key: []byte(r.Headers.Get("Authorization"))},
+			new(jose.SignerOptions).WithType("JWT"),
+		)
+		require.NoError(t, err)
+		now := time.Now()
+		tok, err := jose.Signed(signer).Claims(awsPayload{
+			Claims: jose.Claims{
+				Issuer:    awsIssuer,
+				Subject:   "my-task",
+				Audience:  []string{aud},
+				Expiry:    jose.NewNumericDate(now.Add(5 * time.Minute)),
+				NotBefore: jose.NewNumericDate(now),
+				IssuedAt:  jose.NewNumericDate(now),
+			},
+			Amazon: awsAmazonPayload{IAMRequest: r},
+		}).CompactSerialize()
+		require.NoError(t, err)
+		return tok
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		roles   []string
+		wantErr bool
+	}{
+		{"ok", newToken(request(nil), p.ctl.Audiences.Sign[0]), nil, false},
+		{"fail not enabled", newToken(request(nil), p.ctl.Audiences.Sign[0]), []string{}, true},
+		{"fail role", newToken(request(func(r *awsIAMRequest) {
+			r.Headers.Set("X-Test-Arn", "arn:aws:sts::"+account+":assumed-role/other-role/my-session")
+		}), p.ctl.Audiences.Sign[0]), nil, true},
+		{"fail account", newToken(request(func(r *awsIAMRequest) {
+			r.Headers.Set("X-Test-Arn", "arn:aws:sts::000000000000:assumed-role/my-role/my-session")
+		}), p.ctl.Audiences.Sign[0]), nil, true},
+		{"fail user", newToken(request(func(r *awsIAMRequest) {
+			r.Headers.Set("X-Test-Arn", "arn:aws:iam::"+account+":user/my-role")
+		}), p.ctl.Audiences.Sign[0]), nil, true},
+		{"fail sts", newToken(request(func(r *awsIAMRequest) {
+			r.Headers.Set("X-Amz-Security-Token", "expired")
+		}), p.ctl.Audiences.Sign[0]), nil, true},
+		{"fail method", newToken(request(func(r *awsIAMRequest) {
+			r.Method = http.MethodGet
+		}), p.ctl.Audiences.Sign[0]), nil, true},
+		{"fail host", newToken(request(func(r *awsIAMRequest) {
+			r.URL = "https://sts.example.com/"
+		}), p.ctl.Audiences.Sign[0]), nil, true},
+		{"fail body", newToken(request(func(r *awsIAMRequest) {
+			r.Body = []byte("Action=GetSessionToken&Version=2011-06-15")
+		}), p.ctl.Audiences.Sign[0]), nil, true},
+		{"fail unsigned audience", newToken(request(func(r *awsIAMRequest) {
+			r.Headers.Set("Authorization", "AWS4-HMAC-SHA256 Credential=ASIAEXAMPLE/20240101/us-east-1/sts/aws4_request, SignedHeaders=host;x-amz-date, Signature=0123456789abcdef")
+		}), p.ctl.Audiences.Sign[0]), nil, true},
+		{"fail audience header", newToken(request(func(r *awsIAMRequest) {
+			r.Headers.Set("X-Step-Audience", "https://ca.example.com/1.0/sign")
+		}), p.ctl.Audiences.Sign[0]), nil, true},
+		{"fail audience claim", newToken(request(nil), "https://ca.example.com/1.0/sign"), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			roles := p.IAMRoles
+			if tt.roles != nil {
+				p.IAMRoles = tt.roles
+				defer func() { p.IAMRoles = roles }()
+			}
+
+			payload, err := p.authorizeToken(tt.token)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, &awsCallerIdentity{
+				Arn:      arn,
+				UserID:   "AROAEXAMPLE:my-session",
+				Account:  account,
+				RoleARN:  "arn:aws:iam::" + account + ":role/my-role",
+				RoleName: "my-role",
+			}, payload.identity)
+
+			sum := sha256.Sum256([]byte(authorization))
+			id, err := p.GetTokenID(tt.token)
+			require.NoError(t, err)
+			assert.Equal(t, hex.EncodeToString(sum[:]), id)
+
+			opts, err := p.AuthorizeSign(context.Background(), tt.token)
+			require.NoError(t, err)
+			assert.Contains(t, opts, commonNameValidator("arn:aws:iam::"+account+":role/my-role"))
+
+			_, err = p.AuthorizeSSHSign(context.Background(), tt.token)
+			assert.Error(t, err)
+		})
+	}
+	// roles in other accounts
+	token := newToken(request(nil), p.ctl.Audiences.Sign[0])
+	p.Accounts = []string{"111111111111"}
+	_, err = p.authorizeToken(token)
+	assert.Error(t, err)
+	p.AllowCrossAccountRoles = true
+	_, err = p.authorizeToken(token)
+	assert.NoError(t, err)
+}
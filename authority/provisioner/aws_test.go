@@ -542,6 +542,61 @@ func TestAWS_authorizeToken(t *testing.T) {
 	}
 }
 
+func TestAWS_authorizeToken_limits(t *testing.T) {
+	block, _ := pem.Decode([]byte(awsTestKey))
+	if block == nil || block.Type != "RSA PRIVATE KEY" {
+		t.Fatal("error decoding AWS key")
+	}
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	assert.FatalError(t, err)
+
+	p, srv, err := generateAWSWithServer()
+	assert.FatalError(t, err)
+	defer srv.Close()
+	account := p.Accounts[0]
+
+	otherRegionToken, err := p.GetIdentityToken("127.0.0.1", "https://ca.smallstep.com")
+	assert.FatalError(t, err)
+	token, err := generateAWSToken(
+		p, "127.0.0.1", awsIssuer, p.GetID(), account, "instance-id",
+		"127.0.0.1", "us-west-1", time.Now().Add(-2*time.Minute), key)
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name           string
+		token          string
+		accountRegions map[string][]string
+		wantErr        string
+	}{
+		{"ok", token, nil, ""},
+		{"ok regions", token, map[string][]string{account: {"us-east-1", "us-west-1"}}, ""},
+		{"ok other account regions", token, map[string][]string{"other": {"us-east-1"}}, ""},
+		{"fail regions", otherRegionToken, map[string][]string{account: {"us-east-1"}}, "aws.authorizeToken; invalid aws identity document - region is not valid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p.AccountRegions = tt.accountRegions
+
+			_, err := p.authorizeToken(tt.token)
+			if tt.wantErr != "" {
+				if assert.NotNil(t, err) {
+					assert.HasPrefix(t, err.Error(), tt.wantErr)
+				}
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+
+	config := Config{Claims: globalProvisionerClaims}
+	p = &AWS{Type: "AWS", Name: "aws", Accounts: []string{"account"}, AccountRegions: map[string][]string{"other": {"us-east-1"}}}
+	assert.Equals(t, "provisioner accountRegions contains account other, but it is not in accounts", p.Init(config).Error())
+	p = &AWS{Type: "AWS", Name: "aws", AccountRegions: map[string][]string{"account": {}}}
+	assert.Equals(t, "provisioner accountRegions for account account cannot be empty", p.Init(config).Error())
+	p = &AWS{Type: "AWS", Name: "aws", AccountRegions: map[string][]string{"account": {"us-east-1"}}}
+	assert.FatalError(t, p.Init(config))
+}
+
 func TestAWS_AuthorizeSign(t *testing.T) {
 	p1, srv, err := generateAWSWithServer()
 	assert.FatalError(t, err)
@@ -898,3 +953,60 @@ func TestAWS_HardcodedCertificates(t *testing.T) {
 	}
 	assert.Len(t, 15, certs, "expected 15 certificates in aws_certificates.pem")
 }
+
+func TestAWS_AuthorizeSign_sanTemplates(t *testing.T) {
+	block, _ := pem.Decode([]byte(awsTestKey))
+	if block == nil || block.Type != "RSA PRIVATE KEY" {
+		t.Fatal("error decoding AWS key")
+	}
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	assert.FatalError(t, err)
+
+	p, srv, err := generateAWSWithServer()
+	assert.FatalError(t, err)
+	defer srv.Close()
+	p.DisableCustomSANs = true
+	p.SANTemplates = []string{"{{ .AWS.InstanceID }}.{{ .AWS.Region }}.example.com", "{{ .AWS.PrivateIP }}"}
+	p.sanTemplates, err = parseSANTemplates(p.SANTemplates, p.DisableCustomSANs)
+	assert.FatalError(t, err)
+
+	token, err := generateAWSToken(
+		p, "instance-id.us-west-1.example.com", awsIssuer, p.GetID(), p.Accounts[0], "instance-id",
+		"127.0.0.1", "us-west-1", time.Now(), key)
+	assert.FatalError(t, err)
+
+	opts, err := p.AuthorizeSign(context.Background(), token)
+	assert.FatalError(t, err)
+	v := findGKEDefaultSANsValidator(t, opts)
+	assert.NoError(t, v.Valid(&x509.CertificateRequest{
+		DNSNames:    []string{"instance-id.us-west-1.example.com"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+	}))
+	assert.Error(t, v.Valid(&x509.CertificateRequest{
+		DNSNames:    []string{"ip-127-0-0-1.us-west-1.compute.internal"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+	}))
+
+	opts, err = p.AuthorizeSSHSign(context.Background(), token)
+	assert.FatalError(t, err)
+	var found bool
+	for _, o := range opts {
+		if v, ok := o.(sshCertOptionsValidator); ok {
+			assert.Equals(t, []string{"instance-id.us-west-1.example.com", "127.0.0.1"}, v.Principals)
+			found = true
+		}
+	}
+	assert.True(t, found)
+
+	// The subject must be one of the known names.
+	token, err = generateAWSToken(
+		p, "other.example.com", awsIssuer, p.GetID(), p.Accounts[0], "instance-id",
+		"127.0.0.1", "us-west-1", time.Now(), key)
+	assert.FatalError(t, err)
+	_, err = p.AuthorizeSign(context.Background(), token)
+	assert.Error(t, err)
+
+	config := Config{Claims: globalProvisionerClaims}
+	p = &AWS{Type: "AWS", Name: "aws", SANTemplates: []string{"{{ .AWS.InstanceID }}.example.com"}}
+	assert.Equals(t, "provisioner sanTemplates require disableCustomSANs", p.Init(config).Error())
+}
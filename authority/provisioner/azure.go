@@ -2,14 +2,16 @@ package provisioner
 
 import (
 	"context"
-	"crypto/sha256"
 	"crypto/x509"
-	"encoding/hex"
 	"encoding/json"
 	"io"
 	"net/http"
+	"os"
+	"path/filepath"
 	"regexp"
+	"runtime"
 	"strings"
+	"text/template"
 	"time"
 
 	"github.com/pkg/errors"
@@ -31,6 +33,14 @@ const azureIdentityTokenURL = "http://169.254.169.254/metadata/identity/oauth2/t
 
 const azureIdentityTokenAPIVersion = "2018-02-01"
 
+// azureArcIdentityTokenAPIVersion is the API version supported by the Azure Arc
+// Hybrid Instance Metadata Service.
+const azureArcIdentityTokenAPIVersion = "2020-06-01"
+
+// azureArcMaxKeySize is the maximum size of the key file used in the Azure Arc
+// authentication challenge.
+const azureArcMaxKeySize = 4096
+
 // azureInstanceComputeURL is the URL to get the instance compute metadata.
 const azureInstanceComputeURL = "http://169.254.169.254/metadata/instance/compute/azEnvironment"
 
@@ -38,8 +48,37 @@ const azureInstanceComputeURL = "http://169.254.169.254/metadata/instance/comput
 const azureDefaultAudience = "https://management.azure.com/"
 
 // azureXMSMirIDRegExp is the regular expression used to parse the xms_mirid claim.
-// Using case insensitive as resourceGroups appears as resourcegroups.
-var azureXMSMirIDRegExp = regexp.MustCompile(`(?i)^/subscriptions/([^/]+)/resourceGroups/([^/]+)/providers/Microsoft.(Compute/virtualMachines|ManagedIdentity/userAssignedIdentities)/([^/]+)$`)
+// Using case insensitive as resourceGroups appears as resourcegroups. The
+// identities of VM scale sets might include the instance id. Azure Arc-enabled
+// servers use the HybridCompute/machines resource.
+var azureXMSMirIDRegExp = regexp.MustCompile(`(?i)^/subscriptions/([^/]+)/resourceGroups/([^/]+)/providers/Microsoft.(Compute/virtualMachines|Compute/virtualMachineScaleSets|ManagedIdentity/userAssignedIdentities|HybridCompute/machines)/([^/]+)(?:/virtualMachines/([^/]+))?$`)
+
+// AzureTemplateDataKey is the key used in the certificate templates to access
+// the Azure resource of the managed identity, e.g. {{ .Azure.ResourceGroup }}.
+const AzureTemplateDataKey = "Azure"
+
+// AzureTemplateData is the information of the Azure resource of the managed
+// identity available in the X.509 and SSH certificate templates.
+type AzureTemplateData struct {
+	// SubscriptionID is the subscription of the resource.
+	SubscriptionID string `json:"subscriptionID"`
+	// ResourceGroup is the resource group of the resource.
+	ResourceGroup string `json:"resourceGroup"`
+	// ResourceType is the type of the resource, virtualMachines,
+	// virtualMachineScaleSets, userAssignedIdentities or machines for Azure
+	// Arc-enabled servers.
+	ResourceType string `json:"resourceType"`
+	// ResourceName is the name of the resource.
+	ResourceName string `json:"resourceName"`
+	// ObjectID is the object id of the managed identity.
+	ObjectID string `json:"objectID"`
+	// VMScaleSet is the name of the VM scale set if the resource is a scale
+	// set.
+	VMScaleSet string `json:"vmScaleSet,omitempty"`
+	// VMScaleSetInstanceID is the instance id in the VM scale set if the
+	// identity includes it.
+	VMScaleSetInstanceID string `json:"vmScaleSetInstanceID,omitempty"`
+}
 
 // azureEnvironments is the list of all Azure environments.
 var azureEnvironments = map[string]string{
@@ -52,19 +91,39 @@ var azureEnvironments = map[string]string{
 }
 
 type azureConfig struct {
-	oidcDiscoveryURL   string
-	identityTokenURL   string
-	instanceComputeURL string
+	oidcDiscoveryURL    string
+	identityTokenURL    string
+	instanceComputeURL  string
+	arcIdentityTokenURL string
+	arcKeyDirectory     string
 }
 
 func newAzureConfig(tenantID string) *azureConfig {
+	// The Azure Arc agent defines IDENTITY_ENDPOINT and IMDS_ENDPOINT on
+	// Arc-enabled servers.
+	var arcIdentityTokenURL string
+	if os.Getenv("IMDS_ENDPOINT") != "" {
+		arcIdentityTokenURL = os.Getenv("IDENTITY_ENDPOINT")
+	}
 	return &azureConfig{
-		oidcDiscoveryURL:   azureOIDCBaseURL + "/" + tenantID + "/.well-known/openid-configuration",
-		identityTokenURL:   azureIdentityTokenURL,
-		instanceComputeURL: azureInstanceComputeURL,
+		oidcDiscoveryURL:    azureOIDCBaseURL + "/" + tenantID + "/.well-known/openid-configuration",
+		identityTokenURL:    azureIdentityTokenURL,
+		instanceComputeURL:  azureInstanceComputeURL,
+		arcIdentityTokenURL: arcIdentityTokenURL,
+		arcKeyDirectory:     azureArcKeyDirectory(),
 	}
 }
 
+// azureArcKeyDirectory returns the directory where the Azure Arc agent writes
+// the keys used in the authentication challenge of the Hybrid Instance
+// Metadata Service.
+func azureArcKeyDirectory() string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.Getenv("ProgramData"), "AzureConnectedMachineAgent", "Tokens")
+	}
+	return "/var/opt/azcmagent/tokens"
+}
+
 type azureIdentityToken struct {
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
@@ -86,6 +145,7 @@ type azurePayload struct {
 	TenantID         string `json:"tid"`
 	Version          string `json:"ver"`
 	XMSMirID         string `json:"xms_mirid"`
+	resource         AzureTemplateData
 }
 
 // Azure is the provisioner that supports identity tokens created from the
@@ -96,13 +156,33 @@ type azurePayload struct {
 // If DisableCustomSANs is true, only the internal DNS and IP will be added as a
 // SAN. By default it will accept any SAN in the CSR.
 //
+// SANTemplates can be used with DisableCustomSANs to replace the name of the
+// resource with the SANs rendered from the managed identity, e.g.
+// "{{ .Azure.ResourceName }}.{{ .Azure.ResourceGroup }}.example.com", or with
+// the default private DNS name, the name of the resource, in
+// {{ .PrivateDNS }}. They are also used as the principals of SSH host
+// certificates. The templates are parsed on Init. Only the signed claims of the
+// token are available, the virtual network and tags of the resource are not
+// part of it, and cannot be used.
+//
 // If DisableTrustOnFirstUse is true, multiple sign request for this provisioner
 // with the same instance will be accepted. By default only the first request
-// will be accepted.
+// will be accepted. The instances of a VM scale set share the system-assigned
+// identity of the scale set, so DisableTrustOnFirstUse is required for them.
+//
+// ResourceGroups, SubscriptionIDs and ObjectIDs restrict the managed
+// identities accepted by the provisioner, the object ID is the principal ID of
+// the system or user-assigned managed identity.
+//
+// If EnableAzureArc is true, the provisioner will also accept the identity
+// tokens of Azure Arc-enabled servers, the on-premises machines managed by
+// Azure Arc. The client gets them from the Hybrid Instance Metadata Service.
 //
 // Microsoft Azure identity docs are available at
 // https://docs.microsoft.com/en-us/azure/active-directory/managed-identities-azure-resources/how-to-use-vm-token
-// and https://docs.microsoft.com/en-us/azure/virtual-machines/windows/instance-metadata-service
+// and https://docs.microsoft.com/en-us/azure/virtual-machines/windows/instance-metadata-service,
+// and the Azure Arc ones at
+// https://learn.microsoft.com/en-us/azure/azure-arc/servers/managed-identity-authentication
 type Azure struct {
 	*base
 	ID                     string   `json:"-"`
@@ -114,7 +194,9 @@ type Azure struct {
 	ObjectIDs              []string `json:"objectIDs"`
 	Audience               string   `json:"audience,omitempty"`
 	DisableCustomSANs      bool     `json:"disableCustomSANs"`
+	SANTemplates           []string `json:"sanTemplates,omitempty"`
 	DisableTrustOnFirstUse bool     `json:"disableTrustOnFirstUse"`
+	EnableAzureArc         bool     `json:"enableAzureArc,omitempty"`
 	Claims                 *Claims  `json:"claims,omitempty"`
 	Options                *Options `json:"options,omitempty"`
 	config                 *azureConfig
@@ -122,6 +204,7 @@ type Azure struct {
 	keyStore               *keyStore
 	ctl                    *Controller
 	environment            string
+	sanTemplates           []*template.Template
 }
 
 // GetID returns the provisioner unique identifier.
@@ -161,8 +244,7 @@ func (p *Azure) GetTokenID(token string) (string, error) {
 		return "", ErrAllowTokenReuse
 	}
 
-	sum := sha256.Sum256([]byte(claims.XMSMirID))
-	return strings.ToLower(hex.EncodeToString(sum[:])), nil
+	return p.GetTOFUTokenID(claims.XMSMirID), nil
 }
 
 // GetName returns the name of the provisioner.
@@ -180,6 +262,11 @@ func (p *Azure) GetEncryptedKey() (kid, key string, ok bool) {
 	return "", "", false
 }
 
+// GetOptions returns the configured provisioner options.
+func (p *Azure) GetOptions() *Options {
+	return p.Options
+}
+
 // GetIdentityToken retrieves from the metadata service the identity token and
 // returns it.
 func (p *Azure) GetIdentityToken(subject, caURL string) (string, error) {
@@ -191,6 +278,13 @@ func (p *Azure) GetIdentityToken(subject, caURL string) (string, error) {
 	// default to AzurePublicCloud to keep existing behavior
 	identityTokenResource := azureEnvironments["AzurePublicCloud"]
 
+	// Azure Arc-enabled servers do not have access to the instance metadata
+	// service, the token is retrieved from the Hybrid Instance Metadata
+	// Service.
+	if p.config.arcIdentityTokenURL != "" {
+		return p.getArcIdentityToken(identityTokenResource)
+	}
+
 	var err error
 	p.environment, err = p.getAzureEnvironment()
 	if err != nil {
@@ -218,6 +312,89 @@ func (p *Azure) GetIdentityToken(subject, caURL string) (string, error) {
 	}
 	defer resp.Body.Close()
 
+	return readAzureIdentityToken(resp)
+}
+
+// getArcIdentityToken retrieves the identity token from the Hybrid Instance
+// Metadata Service of an Azure Arc-enabled server. The service responds to the
+// first request with a challenge containing the path of a file only readable
+// by privileged users, the content of that file needs to be sent in a second
+// request to get the token.
+func (p *Azure) getArcIdentityToken(resource string) (string, error) {
+	newRequest := func() (*http.Request, error) {
+		req, err := http.NewRequest("GET", p.config.arcIdentityTokenURL, http.NoBody)
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating request")
+		}
+		req.Header.Set("Metadata", "true")
+
+		query := req.URL.Query()
+		query.Add("resource", resource)
+		query.Add("api-version", azureArcIdentityTokenAPIVersion)
+		req.URL.RawQuery = query.Encode()
+		return req, nil
+	}
+
+	req, err := newRequest()
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "error getting identity token, are you in an Azure Arc-enabled server?")
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		return "", errors.Errorf("error getting identity token: unexpected status=%d, expected an authentication challenge", resp.StatusCode)
+	}
+
+	key, err := p.readArcChallengeKey(resp.Header.Get("WWW-Authenticate"))
+	if err != nil {
+		return "", err
+	}
+
+	if req, err = newRequest(); err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Basic "+key)
+	if resp, err = http.DefaultClient.Do(req); err != nil {
+		return "", errors.Wrap(err, "error getting identity token, are you in an Azure Arc-enabled server?")
+	}
+	defer resp.Body.Close()
+
+	return readAzureIdentityToken(resp)
+}
+
+// readArcChallengeKey reads the key in the path of an Azure Arc authentication
+// challenge, e.g. "Basic realm=/var/opt/azcmagent/tokens/<id>.key". The path is
+// validated to be a key file in the Azure Arc agent directory.
+func (p *Azure) readArcChallengeKey(challenge string) (string, error) {
+	path, ok := strings.CutPrefix(challenge, "Basic realm=")
+	if !ok || path == "" {
+		return "", errors.Errorf("error getting identity token: invalid authentication challenge %q", challenge)
+	}
+	path = filepath.Clean(path)
+	if filepath.Dir(path) != filepath.Clean(p.config.arcKeyDirectory) || filepath.Ext(path) != ".key" {
+		return "", errors.Errorf("error getting identity token: invalid authentication challenge path %q", path)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", errors.Wrap(err, "error reading authentication challenge key")
+	}
+	if fi.Size() > azureArcMaxKeySize {
+		return "", errors.Errorf("error reading authentication challenge key: %s is too large", path)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", errors.Wrap(err, "error reading authentication challenge key")
+	}
+	return string(b), nil
+}
+
+// readAzureIdentityToken returns the access token in an identity token
+// response.
+func readAzureIdentityToken(resp *http.Response) (string, error) {
 	b, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return "", errors.Wrap(err, "error reading identity token response")
@@ -247,6 +424,10 @@ func (p *Azure) Init(config Config) (err error) {
 		p.Audience = azureDefaultAudience
 	}
 
+	if p.sanTemplates, err = parseSANTemplates(p.SANTemplates, p.DisableCustomSANs); err != nil {
+		return
+	}
+
 	// Initialize config
 	p.assertConfig()
 
@@ -262,6 +443,7 @@ func (p *Azure) Init(config Config) (err error) {
 		return
 	}
 
+	p.Options = mergeOptions(p.Options, config.DefaultOptions, p.GetType())
 	p.ctl, err = NewController(p, p.Claims, config, p.Options)
 	return
 }
@@ -303,7 +485,7 @@ func (p *Azure) authorizeToken(token string) (*azurePayload, string, string, str
 	}
 
 	re := azureXMSMirIDRegExp.FindStringSubmatch(claims.XMSMirID)
-	if len(re) != 5 {
+	if len(re) != 6 || (re[5] != "" && !strings.EqualFold(re[3], "Compute/virtualMachineScaleSets")) {
 		return nil, "", "", "", "", errs.Unauthorized("azure.authorizeToken; error parsing xms_mirid claim - %s", claims.XMSMirID)
 	}
 
@@ -311,17 +493,30 @@ func (p *Azure) authorizeToken(token string) (*azurePayload, string, string, str
 	identityObjectID := claims.ObjectID
 	subscription, group, name = re[1], re[2], re[4]
 
-	return &claims, name, group, subscription, identityObjectID, nil
-}
+	// Azure Arc-enabled servers are only accepted if enabled.
+	if strings.EqualFold(re[3], "HybridCompute/machines") && !p.EnableAzureArc {
+		return nil, "", "", "", "", errs.Unauthorized("azure.authorizeToken; azure arc-enabled servers are not allowed - %s", claims.XMSMirID)
+	}
 
-// AuthorizeSign validates the given token and returns the sign options that
-// will be used on certificate creation.
-func (p *Azure) AuthorizeSign(ctx context.Context, token string) ([]SignOption, error) {
-	_, name, group, subscription, identityObjectID, err := p.authorizeToken(token)
-	if err != nil {
-		return nil, errs.Wrap(http.StatusInternalServerError, err, "azure.AuthorizeSign")
+	_, resourceType, _ := strings.Cut(re[3], "/")
+	claims.resource = AzureTemplateData{
+		SubscriptionID: subscription,
+		ResourceGroup:  group,
+		ResourceType:   resourceType,
+		ResourceName:   name,
+		ObjectID:       identityObjectID,
+	}
+	if strings.EqualFold(resourceType, "virtualMachineScaleSets") {
+		claims.resource.VMScaleSet = name
+		claims.resource.VMScaleSetInstanceID = re[5]
 	}
 
+	return &claims, name, group, subscription, identityObjectID, nil
+}
+
+// authorizeResource returns an error if the resource group, subscription or
+// identity object id of a token are not allowed by the provisioner.
+func (p *Azure) authorizeResource(group, subscription, identityObjectID string) error {
 	// Filter by resource group
 	if len(p.ResourceGroups) > 0 {
 		var found bool
@@ -332,7 +527,7 @@ func (p *Azure) AuthorizeSign(ctx context.Context, token string) ([]SignOption,
 			}
 		}
 		if !found {
-			return nil, errs.Unauthorized("azure.AuthorizeSign; azure token validation failed - invalid resource group")
+			return errors.New("invalid resource group")
 		}
 	}
 
@@ -346,7 +541,7 @@ func (p *Azure) AuthorizeSign(ctx context.Context, token string) ([]SignOption,
 			}
 		}
 		if !found {
-			return nil, errs.Unauthorized("azure.AuthorizeSign; azure token validation failed - invalid subscription id")
+			return errors.New("invalid subscription id")
 		}
 	}
 
@@ -360,22 +555,51 @@ func (p *Azure) AuthorizeSign(ctx context.Context, token string) ([]SignOption,
 			}
 		}
 		if !found {
-			return nil, errs.Unauthorized("azure.AuthorizeSign; azure token validation failed - invalid identity object id")
+			return errors.New("invalid identity object id")
 		}
 	}
 
+	return nil
+}
+
+// AuthorizeSign validates the given token and returns the sign options that
+// will be used on certificate creation.
+func (p *Azure) AuthorizeSign(ctx context.Context, token string) ([]SignOption, error) {
+	claims, name, group, subscription, identityObjectID, err := p.authorizeToken(token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "azure.AuthorizeSign")
+	}
+
+	if err := p.authorizeResource(group, subscription, identityObjectID); err != nil {
+		return nil, errs.Unauthorized("azure.AuthorizeSign; azure token validation failed - %s", err)
+	}
+
 	// Template options
 	data := x509util.NewTemplateData()
 	data.SetCommonName(name)
 	if v, err := unsafeParseSigned(token); err == nil {
 		data.SetToken(v)
 	}
+	data.Set(AzureTemplateDataKey, claims.resource)
 
 	// Enforce known common name and default DNS if configured.
 	// By default we'll accept the CN and SANs in the CSR.
 	// There's no way to trust them other than TOFU.
 	var so []SignOption
-	if p.DisableCustomSANs {
+	switch {
+	case p.DisableCustomSANs && len(p.SANTemplates) > 0:
+		sans, err := renderSANTemplates(p.sanTemplates, p.sanTemplateData(claims))
+		if err != nil {
+			return nil, errs.Wrap(http.StatusUnauthorized, err, "azure.AuthorizeSign; invalid azure token")
+		}
+		so = append(so,
+			commonNameValidator(name),
+			newDefaultSANsValidator(ctx, sans),
+		)
+
+		// Enforce SANs in the template.
+		data.SetSANs(sans)
+	case p.DisableCustomSANs:
 		// name will work only inside the virtual network
 		so = append(so,
 			commonNameValidator(name),
@@ -412,6 +636,15 @@ func (p *Azure) AuthorizeSign(ctx context.Context, token string) ([]SignOption,
 	), nil
 }
 
+// sanTemplateData returns the data available in the SANTemplates, the
+// resource of the managed identity and its default private DNS name.
+func (p *Azure) sanTemplateData(claims *azurePayload) map[string]interface{} {
+	return map[string]interface{}{
+		AzureTemplateDataKey: claims.resource,
+		"PrivateDNS":         claims.resource.ResourceName,
+	}
+}
+
 // AuthorizeRenew returns an error if the renewal is disabled.
 // NOTE: This method does not actually validate the certificate or check it's
 // revocation status. Just confirms that the provisioner that created the
@@ -421,15 +654,18 @@ func (p *Azure) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) erro
 }
 
 // AuthorizeSSHSign returns the list of SignOption for a SignSSH request.
-func (p *Azure) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, error) {
+func (p *Azure) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption, error) {
 	if !p.ctl.Claimer.IsSSHCAEnabled() {
 		return nil, errs.Unauthorized("azure.AuthorizeSSHSign; sshCA is disabled for provisioner '%s'", p.GetName())
 	}
 
-	_, name, _, _, identityObjectID, err := p.authorizeToken(token)
+	claims, name, group, subscription, identityObjectID, err := p.authorizeToken(token)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "azure.AuthorizeSSHSign")
 	}
+	if err := p.authorizeResource(group, subscription, identityObjectID); err != nil {
+		return nil, errs.Unauthorized("azure.AuthorizeSSHSign; azure token validation failed - %s", err)
+	}
 
 	signOptions := []SignOption{}
 
@@ -440,6 +676,11 @@ func (p *Azure) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption,
 
 	// Validated principals.
 	principals := []string{name}
+	if len(p.SANTemplates) > 0 {
+		if principals, err = renderSANTemplates(p.sanTemplates, p.sanTemplateData(claims)); err != nil {
+			return nil, errs.Wrap(http.StatusUnauthorized, err, "azure.AuthorizeSSHSign; invalid azure token")
+		}
+	}
 
 	// Only enforce known principals if disable custom sans is true.
 	if p.DisableCustomSANs {
@@ -456,6 +697,8 @@ func (p *Azure) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption,
 	if v, err := unsafeParseSigned(token); err == nil {
 		data.SetToken(v)
 	}
+	data.Set(AzureTemplateDataKey, claims.resource)
+	audit := newSSHAuditMetadata(ctx, p, name, data)
 
 	templateOptions, err := CustomSSHTemplateOptions(p.Options, data, sshutil.DefaultIIDTemplate)
 	if err != nil {
@@ -465,6 +708,7 @@ func (p *Azure) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption,
 
 	return append(signOptions,
 		p,
+		audit,
 		// Validate user SignSSHOptions.
 		sshCertOptionsValidator(defaults),
 		// Set the validity bounds if not set.
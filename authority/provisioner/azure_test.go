@@ -12,6 +12,8 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -752,3 +754,214 @@ func TestAzure_assertConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestAzure_authorizeToken_resource(t *testing.T) {
+	p, srv, err := generateAzureWithServer()
+	assert.FatalError(t, err)
+	defer srv.Close()
+
+	tests := []struct {
+		name         string
+		resourceType string
+		want         AzureTemplateData
+	}{
+		{"vm", "vm", AzureTemplateData{
+			SubscriptionID: "subscriptionID", ResourceGroup: "resourceGroup",
+			ResourceType: "virtualMachines", ResourceName: "myResource", ObjectID: "the-oid",
+		}},
+		{"uai", "uai", AzureTemplateData{
+			SubscriptionID: "subscriptionID", ResourceGroup: "resourceGroup",
+			ResourceType: "userAssignedIdentities", ResourceName: "myResource", ObjectID: "the-oid",
+		}},
+		{"vmss", "vmss", AzureTemplateData{
+			SubscriptionID: "subscriptionID", ResourceGroup: "resourceGroup",
+			ResourceType: "virtualMachineScaleSets", ResourceName: "myResource", ObjectID: "the-oid",
+			VMScaleSet: "myResource",
+		}},
+		{"vmss-instance", "vmss-instance", AzureTemplateData{
+			SubscriptionID: "subscriptionID", ResourceGroup: "resourceGroup",
+			ResourceType: "virtualMachineScaleSets", ResourceName: "myResource", ObjectID: "the-oid",
+			VMScaleSet: "myResource", VMScaleSetInstanceID: "0",
+		}},
+		{"arc", "arc", AzureTemplateData{
+			SubscriptionID: "subscriptionID", ResourceGroup: "resourceGroup",
+			ResourceType: "machines", ResourceName: "myResource", ObjectID: "the-oid",
+		}},
+	}
+	p.EnableAzureArc = true
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tok, err := generateAzureToken("subject", p.oidcConfig.Issuer, azureDefaultAudience,
+				p.TenantID, "subscriptionID", "resourceGroup", "myResource", tt.resourceType,
+				time.Now(), &p.keyStore.keySet.Keys[0])
+			assert.FatalError(t, err)
+			claims, name, group, subscription, objectID, err := p.authorizeToken(tok)
+			assert.FatalError(t, err)
+			assert.Equals(t, "myResource", name)
+			assert.Equals(t, "resourceGroup", group)
+			assert.Equals(t, "subscriptionID", subscription)
+			assert.Equals(t, "the-oid", objectID)
+			assert.Equals(t, tt.want, claims.resource)
+		})
+	}
+}
+
+func TestAzure_authorizeToken_arcDisabled(t *testing.T) {
+	p, srv, err := generateAzureWithServer()
+	assert.FatalError(t, err)
+	defer srv.Close()
+
+	tok, err := generateAzureToken("subject", p.oidcConfig.Issuer, azureDefaultAudience,
+		p.TenantID, "subscriptionID", "resourceGroup", "myMachine", "arc",
+		time.Now(), &p.keyStore.keySet.Keys[0])
+	assert.FatalError(t, err)
+	_, _, _, _, _, err = p.authorizeToken(tok)
+	if assert.NotNil(t, err) {
+		var sc render.StatusCodedError
+		assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+		assert.Equals(t, http.StatusUnauthorized, sc.StatusCode())
+	}
+}
+
+func TestAzure_GetIdentityToken_arc(t *testing.T) {
+	p1, err := generateAzure()
+	assert.FatalError(t, err)
+
+	t1, err := generateAzureToken("subject", p1.oidcConfig.Issuer, azureDefaultAudience,
+		p1.TenantID, "subscriptionID", "resourceGroup", "myMachine", "arc",
+		time.Now(), &p1.keyStore.keySet.Keys[0])
+	assert.FatalError(t, err)
+
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "challenge.key")
+	assert.FatalError(t, os.WriteFile(keyPath, []byte("the-secret"), 0600))
+	bigKeyPath := filepath.Join(dir, "big.key")
+	assert.FatalError(t, os.WriteFile(bigKeyPath, make([]byte, azureArcMaxKeySize+1), 0600))
+	otherPath := filepath.Join(dir, "secret.txt")
+	assert.FatalError(t, os.WriteFile(otherPath, []byte("the-secret"), 0600))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata") != "true" || r.URL.Query().Get("api-version") != azureArcIdentityTokenAPIVersion ||
+			r.URL.Query().Get("resource") != azureDefaultAudience {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		var realm string
+		switch r.URL.Path {
+		case "/bad-request":
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		case "/missing-challenge":
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		case "/big-key":
+			realm = bigKeyPath
+		case "/other-file":
+			realm = otherPath
+		case "/outside-directory":
+			realm = filepath.Join(dir, "..", "challenge.key")
+		default:
+			realm = keyPath
+		}
+		if r.Header.Get("Authorization") != "Basic the-secret" {
+			w.Header().Set("WWW-Authenticate", "Basic realm="+realm)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"%s"}`, t1)
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name    string
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{"ok", "/metadata/identity/oauth2/token", t1, false},
+		{"fail request", "/bad-request", "", true},
+		{"fail missing challenge", "/missing-challenge", "", true},
+		{"fail big key", "/big-key", "", true},
+		{"fail other file", "/other-file", "", true},
+		{"fail outside directory", "/outside-directory", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p1.config.arcIdentityTokenURL = srv.URL + tt.path
+			p1.config.arcKeyDirectory = dir
+			got, err := p1.GetIdentityToken("subject", "caURL")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Azure.GetIdentityToken() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Azure.GetIdentityToken() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAzure_AuthorizeSSHSign_allowLists(t *testing.T) {
+	p, srv, err := generateAzureWithServer()
+	assert.FatalError(t, err)
+	defer srv.Close()
+
+	tok, err := generateAzureToken("subject", p.oidcConfig.Issuer, azureDefaultAudience,
+		p.TenantID, "subscriptionID", "resourceGroup", "myScaleSet", "vmss-instance",
+		time.Now(), &p.keyStore.keySet.Keys[0])
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name            string
+		resourceGroups  []string
+		subscriptionIDs []string
+		objectIDs       []string
+		wantErr         bool
+	}{
+		{"ok", nil, nil, nil, false},
+		{"ok allowed", []string{"resourceGroup"}, []string{"subscriptionID"}, []string{"the-oid"}, false},
+		{"fail resource group", []string{"otherGroup"}, nil, nil, true},
+		{"fail subscription", nil, []string{"otherSubscription"}, nil, true},
+		{"fail object id", nil, nil, []string{"other-oid"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p.ResourceGroups = tt.resourceGroups
+			p.SubscriptionIDs = tt.subscriptionIDs
+			p.ObjectIDs = tt.objectIDs
+			_, err := p.AuthorizeSSHSign(context.Background(), tok)
+			if tt.wantErr {
+				var sc render.StatusCodedError
+				assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+				assert.Equals(t, http.StatusUnauthorized, sc.StatusCode())
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestAzure_AuthorizeSign_sanTemplates(t *testing.T) {
+	p, err := generateAzure()
+	assert.FatalError(t, err)
+	p.DisableCustomSANs = true
+	p.SANTemplates = []string{"{{ .Azure.ResourceName }}.{{ .Azure.ResourceGroup }}.example.com", "{{ .PrivateDNS }}.example.net"}
+	p.sanTemplates, err = parseSANTemplates(p.SANTemplates, p.DisableCustomSANs)
+	assert.FatalError(t, err)
+
+	token, err := generateAzureToken("subject", p.oidcConfig.Issuer, azureDefaultAudience,
+		p.TenantID, "subscriptionID", "resourceGroup", "virtualMachine", "vm",
+		time.Now(), &p.keyStore.keySet.Keys[0])
+	assert.FatalError(t, err)
+
+	opts, err := p.AuthorizeSign(context.Background(), token)
+	assert.FatalError(t, err)
+	v := findGKEDefaultSANsValidator(t, opts)
+	assert.NoError(t, v.Valid(&x509.CertificateRequest{
+		DNSNames: []string{"virtualMachine.resourceGroup.example.com", "virtualMachine.example.net"},
+	}))
+	assert.Error(t, v.Valid(&x509.CertificateRequest{
+		DNSNames: []string{"virtualMachine"},
+	}))
+}
@@ -0,0 +1,452 @@
+package provisioner
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// caaDefaultTimeout is the default timeout of a CAA query to a resolver.
+	caaDefaultTimeout = 10 * time.Second
+	// caaCriticalFlag is the issuer critical flag of a CAA record.
+	caaCriticalFlag = 128
+	// caaResolvConf is the file with the system resolvers.
+	caaResolvConf = "/etc/resolv.conf"
+)
+
+// typeCAA is the DNS type of the CAA records.
+const typeCAA = dnsmessage.Type(257)
+
+// ErrCAAForbidden is the error returned when the CAA records of a DNS name do
+// not authorize the CA to issue a certificate for it.
+var ErrCAAForbidden = errors.New("caa records forbid issuance")
+
+// CAAFailureMode defines how the CAA checks handle the errors looking up the
+// CAA records.
+type CAAFailureMode string
+
+const (
+	// CAAHardFail rejects the certificate if the CAA records cannot be looked
+	// up.
+	CAAHardFail CAAFailureMode = "hard"
+	// CAASoftFail allows the certificate if the CAA records cannot be looked
+	// up.
+	CAASoftFail CAAFailureMode = "soft"
+)
+
+// CAAOptions configures the checking of the CAA records, RFC 8659, of the DNS
+// names in a certificate just before the certificate is signed.
+type CAAOptions struct {
+	// IssuerDomainNames are the domain names that identify the CA in the issue
+	// and issuewild properties of the CAA records, e.g. ca.example.com.
+	IssuerDomainNames []string `json:"issuerDomainNames"`
+	// FailureMode defines the behavior when the CAA records cannot be looked
+	// up, "hard" rejects the certificate and "soft" allows it. Defaults to
+	// "hard".
+	FailureMode CAAFailureMode `json:"failureMode,omitempty"`
+	// RequireDNSSEC requires the resolvers to authenticate the CAA records
+	// using DNSSEC, unauthenticated responses are handled like lookup errors.
+	// The resolvers must be validating resolvers.
+	RequireDNSSEC bool `json:"requireDNSSEC,omitempty"`
+	// Resolvers is the list of resolvers to query in order, e.g. 1.1.1.1 or
+	// 10.0.0.2:5353. Defaults to the nameservers in /etc/resolv.conf.
+	Resolvers []string `json:"resolvers,omitempty"`
+	// Timeout is the maximum time to wait for the response of a resolver, 10s
+	// by default.
+	Timeout *Duration `json:"timeout,omitempty"`
+}
+
+// Validate returns an error if the CAA options are not valid.
+func (o *CAAOptions) Validate() error {
+	if o == nil {
+		return nil
+	}
+	if len(o.IssuerDomainNames) == 0 {
+		return errors.New("caa issuerDomainNames cannot be empty")
+	}
+	for _, name := range o.IssuerDomainNames {
+		if _, err := dnsmessage.NewName(dnsCanonicalName(name)); err != nil || name == "" || strings.ContainsAny(name, "; \t") {
+			return errors.Errorf("caa issuerDomainName %q is not valid", name)
+		}
+	}
+	switch o.FailureMode {
+	case "", CAAHardFail, CAASoftFail:
+	default:
+		return errors.Errorf("unsupported caa failureMode %q", o.FailureMode)
+	}
+	for _, s := range o.Resolvers {
+		if _, err := caaResolverAddr(s); err != nil {
+			return errors.Errorf("caa resolver %q is not valid", s)
+		}
+	}
+	if o.Timeout != nil && o.Timeout.Duration < 0 {
+		return errors.New("caa timeout cannot be negative")
+	}
+	return nil
+}
+
+// GetCAA returns the options used to check the CAA records, it returns nil if
+// the CAA records must not be checked.
+func (o *X509Options) GetCAA() *CAAOptions {
+	if o == nil {
+		return nil
+	}
+	return o.CAA
+}
+
+// Check validates that the CAA records of all the DNS names in the given
+// certificate authorize the CA to issue it. Wildcard names are validated using
+// the issuewild properties if present. It returns an error wrapping
+// ErrCAAForbidden if a name is not authorized.
+func (o *CAAOptions) Check(ctx context.Context, cert *x509.Certificate) error {
+	if o == nil {
+		return nil
+	}
+	resolvers := o.Resolvers
+	if len(resolvers) == 0 {
+		var err error
+		if resolvers, err = caaSystemResolvers(); err != nil {
+			return o.lookupFailed(err)
+		}
+	}
+	timeout := caaDefaultTimeout
+	if o.Timeout != nil && o.Timeout.Duration > 0 {
+		timeout = o.Timeout.Duration
+	}
+
+	for _, name := range cert.DNSNames {
+		domain, wildcard := strings.CutPrefix(name, "*.")
+		records, err := o.relevantRecords(ctx, resolvers, timeout, domain)
+		if err != nil {
+			if err := o.lookupFailed(err); err != nil {
+				return err
+			}
+			continue
+		}
+		if !o.isAuthorized(records, wildcard) {
+			return fmt.Errorf("%s: %w", name, ErrCAAForbidden)
+		}
+	}
+	return nil
+}
+
+// lookupFailed returns the error to use when the CAA records cannot be looked
+// up, nil in soft-fail mode.
+func (o *CAAOptions) lookupFailed(err error) error {
+	if o.FailureMode == CAASoftFail {
+		return nil
+	}
+	return errors.Wrap(err, "error looking up caa records")
+}
+
+// relevantRecords returns the relevant CAA record set for the given domain,
+// the records of the closest name to the domain, climbing the tree up to the
+// top-level domain, with CAA records.
+func (o *CAAOptions) relevantRecords(ctx context.Context, resolvers []string, timeout time.Duration, domain string) ([]caaRecord, error) {
+	labels := strings.Split(strings.TrimSuffix(strings.ToLower(domain), "."), ".")
+	for i := range labels {
+		records, err := o.lookup(ctx, resolvers, timeout, strings.Join(labels[i:], "."))
+		if err != nil {
+			return nil, err
+		}
+		if len(records) > 0 {
+			return records, nil
+		}
+	}
+	return nil, nil
+}
+
+// lookup returns the CAA records of the given name querying the resolvers in
+// order until one of them returns a response. Aliases are followed by the
+// resolvers.
+func (o *CAAOptions) lookup(ctx context.Context, resolvers []string, timeout time.Duration, name string) ([]caaRecord, error) {
+	var lastErr error
+	for _, s := range resolvers {
+		msg, err := caaQuery(ctx, s, timeout, name)
+		if err == nil {
+			return o.parseResponse(msg, name)
+		}
+		lastErr = fmt.Errorf("resolver %s: %w", s, err)
+	}
+	return nil, lastErr
+}
+
+// parseResponse returns the CAA records in the given response.
+func (o *CAAOptions) parseResponse(msg *dnsmessage.Message, name string) ([]caaRecord, error) {
+	switch msg.Header.RCode {
+	case dnsmessage.RCodeSuccess:
+	case dnsmessage.RCodeNameError:
+		// RFC 8659 treats non-existent names like names without records.
+		if o.RequireDNSSEC && !msg.Header.AuthenticData {
+			return nil, errors.Errorf("response for %s is not authenticated with DNSSEC", name)
+		}
+		return nil, nil
+	default:
+		return nil, errors.Errorf("unexpected response code %s for %s", msg.Header.RCode, name)
+	}
+	if o.RequireDNSSEC && !msg.Header.AuthenticData {
+		return nil, errors.Errorf("response for %s is not authenticated with DNSSEC", name)
+	}
+
+	var records []caaRecord
+	for _, rr := range msg.Answers {
+		if rr.Header.Type != typeCAA {
+			continue
+		}
+		b, ok := rr.Body.(*dnsmessage.UnknownResource)
+		if !ok {
+			continue
+		}
+		record, err := parseCAARecord(b.Data)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing caa record for %s", name)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// isAuthorized returns true if the given relevant record set authorizes the CA
+// to issue a certificate. Records with unknown tags and the issuer critical
+// flag forbid the issuance, and record sets without issue or issuewild
+// properties do not restrict it.
+func (o *CAAOptions) isAuthorized(records []caaRecord, wildcard bool) bool {
+	tag := "issue"
+	for _, rr := range records {
+		switch rr.tag {
+		case "issue", "iodef":
+		case "issuewild":
+			if wildcard {
+				tag = "issuewild"
+			}
+		default:
+			if rr.flags&caaCriticalFlag != 0 {
+				return false
+			}
+		}
+	}
+
+	var restricted bool
+	for _, rr := range records {
+		if rr.tag != tag {
+			continue
+		}
+		restricted = true
+		issuer, _, _ := strings.Cut(rr.value, ";")
+		issuer = strings.TrimSpace(issuer)
+		for _, name := range o.IssuerDomainNames {
+			if issuer != "" && strings.EqualFold(issuer, name) {
+				return true
+			}
+		}
+	}
+	return !restricted
+}
+
+// caaRecord is a parsed CAA record.
+type caaRecord struct {
+	flags uint8
+	tag   string
+	value string
+}
+
+// parseCAARecord parses the data of a CAA record.
+func parseCAARecord(b []byte) (caaRecord, error) {
+	if len(b) < 2 {
+		return caaRecord{}, errors.New("record is too short")
+	}
+	n := int(b[1])
+	if n == 0 || len(b) < 2+n {
+		return caaRecord{}, errors.New("record has an invalid tag length")
+	}
+	return caaRecord{
+		flags: b[0],
+		tag:   strings.ToLower(string(b[2 : 2+n])),
+		value: string(b[2+n:]),
+	}, nil
+}
+
+// caaQuery sends a CAA query for the given name to the given resolver over
+// UDP, and retries it over TCP if the response is truncated.
+func caaQuery(ctx context.Context, resolver string, timeout time.Duration, name string) (*dnsmessage.Message, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	addr, err := caaResolverAddr(resolver)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, 2)
+	if _, err := rand.Read(b); err != nil {
+		return nil, errors.Wrap(err, "error generating query id")
+	}
+	id := binary.BigEndian.Uint16(b)
+	req, err := newDNSCAAQuery(id, name)
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := caaExchange(ctx, "udp", addr, id, req)
+	if err == nil && msg.Header.Truncated {
+		msg, err = caaExchange(ctx, "tcp", addr, id, req)
+	}
+	return msg, err
+}
+
+// caaExchange sends a DNS message to the given address and returns the parsed
+// response.
+func caaExchange(ctx context.Context, network, addr string, id uint16, req []byte) (*dnsmessage.Message, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, errors.Wrap(err, "error connecting to resolver")
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return nil, errors.Wrap(err, "error setting deadline")
+		}
+	}
+
+	var resp []byte
+	if network == "tcp" {
+		// Messages over TCP are prefixed with their length.
+		b := make([]byte, 2, 2+len(req))
+		binary.BigEndian.PutUint16(b, uint16(len(req)))
+		if _, err := conn.Write(append(b, req...)); err != nil {
+			return nil, errors.Wrap(err, "error writing DNS query")
+		}
+		if _, err := io.ReadFull(conn, b); err != nil {
+			return nil, errors.Wrap(err, "error reading DNS response")
+		}
+		resp = make([]byte, binary.BigEndian.Uint16(b))
+		if _, err := io.ReadFull(conn, resp); err != nil {
+			return nil, errors.Wrap(err, "error reading DNS response")
+		}
+	} else {
+		if _, err := conn.Write(req); err != nil {
+			return nil, errors.Wrap(err, "error writing DNS query")
+		}
+		resp = make([]byte, 4096)
+		n, err := conn.Read(resp)
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading DNS response")
+		}
+		resp = resp[:n]
+	}
+
+	msg := new(dnsmessage.Message)
+	if err := msg.Unpack(resp); err != nil {
+		return nil, errors.Wrap(err, "error parsing DNS response")
+	}
+	switch {
+	case !msg.Header.Response:
+		return nil, errors.New("error parsing DNS response: message is not a response")
+	case msg.Header.ID != id:
+		return nil, errors.New("error parsing DNS response: id does not match the query")
+	}
+	return msg, nil
+}
+
+// newDNSCAAQuery returns a CAA query for the given name. The query requests
+// the DNSSEC records and sets the AD bit to get the authenticated data flag
+// from validating resolvers as described in RFC 6840.
+func newDNSCAAQuery(id uint16, name string) ([]byte, error) {
+	qname, err := dnsmessage.NewName(dnsCanonicalName(name))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error creating DNS query for %s", name)
+	}
+	b := dnsmessage.NewBuilder(make([]byte, 0, 512), dnsmessage.Header{
+		ID:               id,
+		RecursionDesired: true,
+		AuthenticData:    true,
+	})
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		return nil, errors.Wrap(err, "error creating DNS query")
+	}
+	if err := b.Question(dnsmessage.Question{
+		Name:  qname,
+		Type:  typeCAA,
+		Class: dnsmessage.ClassINET,
+	}); err != nil {
+		return nil, errors.Wrapf(err, "error creating DNS query for %s", name)
+	}
+	if err := b.StartAdditionals(); err != nil {
+		return nil, errors.Wrap(err, "error creating DNS query")
+	}
+	var rh dnsmessage.ResourceHeader
+	if err := rh.SetEDNS0(4096, dnsmessage.RCodeSuccess, true); err != nil {
+		return nil, errors.Wrap(err, "error creating DNS query")
+	}
+	if err := b.OPTResource(rh, dnsmessage.OPTResource{}); err != nil {
+		return nil, errors.Wrap(err, "error creating DNS query")
+	}
+	msg, err := b.Finish()
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating DNS query")
+	}
+	return msg, nil
+}
+
+// caaResolverAddr returns the address of a resolver, adding the default port
+// if it's not present.
+func caaResolverAddr(s string) (string, error) {
+	if ip := net.ParseIP(s); ip != nil {
+		return net.JoinHostPort(s, "53"), nil
+	}
+	host, port, err := net.SplitHostPort(s)
+	if err != nil {
+		return "", err
+	}
+	if host == "" || port == "" {
+		return "", errors.Errorf("invalid resolver address %q", s)
+	}
+	return s, nil
+}
+
+// caaSystemResolvers returns the nameservers in /etc/resolv.conf.
+func caaSystemResolvers() ([]string, error) {
+	f, err := os.Open(caaResolvConf)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading system resolvers")
+	}
+	defer f.Close()
+
+	var resolvers []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 1 && fields[0] == "nameserver" {
+			resolvers = append(resolvers, fields[1])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "error reading system resolvers")
+	}
+	if len(resolvers) == 0 {
+		return nil, errors.Errorf("error reading system resolvers: %s does not define any nameserver", caaResolvConf)
+	}
+	return resolvers, nil
+}
+
+// dnsCanonicalName returns the given name in lower case and fully qualified.
+func dnsCanonicalName(name string) string {
+	name = strings.ToLower(name)
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	return name
+}
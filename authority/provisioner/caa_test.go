@@ -0,0 +1,275 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+type testCAARecord struct {
+	flags uint8
+	tag   string
+	value string
+}
+
+func (r testCAARecord) data() []byte {
+	b := []byte{r.flags, byte(len(r.tag))}
+	b = append(b, r.tag...)
+	return append(b, r.value...)
+}
+
+type testCAAZone struct {
+	records       map[string][]testCAARecord
+	nxdomain      bool
+	authenticated bool
+	truncated     bool
+	rcode         dnsmessage.RCode
+}
+
+// respond builds the response for the given query with the records of the
+// queried name.
+func (z *testCAAZone) respond(t *testing.T, query []byte, tcp bool) []byte {
+	t.Helper()
+	var q dnsmessage.Message
+	require.NoError(t, q.Unpack(query))
+	require.Len(t, q.Questions, 1)
+	assert.Equal(t, typeCAA, q.Questions[0].Type)
+	require.NotNil(t, q.Additionals)
+	assert.True(t, q.Additionals[0].Header.DNSSECAllowed())
+
+	name := strings.TrimSuffix(q.Questions[0].Name.String(), ".")
+	resp := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:                 q.Header.ID,
+			Response:           true,
+			RecursionAvailable: true,
+			AuthenticData:      z.authenticated,
+			Truncated:          z.truncated && !tcp,
+			RCode:              z.rcode,
+		},
+		Questions: q.Questions,
+	}
+	if z.nxdomain && len(z.records[name]) == 0 {
+		resp.Header.RCode = dnsmessage.RCodeNameError
+	}
+	if !resp.Header.Truncated {
+		for _, r := range z.records[name] {
+			resp.Answers = append(resp.Answers, dnsmessage.Resource{
+				Header: dnsmessage.ResourceHeader{
+					Name:  q.Questions[0].Name,
+					Type:  typeCAA,
+					Class: dnsmessage.ClassINET,
+					TTL:   60,
+				},
+				Body: &dnsmessage.UnknownResource{Type: typeCAA, Data: r.data()},
+			})
+		}
+	}
+	b, err := resp.Pack()
+	require.NoError(t, err)
+	return b
+}
+
+// newTestCAAServer starts a DNS server listening on UDP and TCP on the same
+// port and returns its address.
+func newTestCAAServer(t *testing.T, zone *testCAAZone) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	pc, err := net.ListenPacket("udp", ln.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		ln.Close()
+		pc.Close()
+	})
+
+	go func() {
+		b := make([]byte, 512)
+		for {
+			n, addr, err := pc.ReadFrom(b)
+			if err != nil {
+				return
+			}
+			_, _ = pc.WriteTo(zone.respond(t, b[:n], false), addr)
+		}
+	}()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			b := make([]byte, 2)
+			if _, err := io.ReadFull(conn, b); err == nil {
+				query := make([]byte, binary.BigEndian.Uint16(b))
+				if _, err := io.ReadFull(conn, query); err == nil {
+					resp := zone.respond(t, query, true)
+					binary.BigEndian.PutUint16(b, uint16(len(resp)))
+					_, _ = conn.Write(append(b, resp...))
+				}
+			}
+			conn.Close()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestCAAOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    *CAAOptions
+		wantErr string
+	}{
+		{"ok nil", nil, ""},
+		{"ok", &CAAOptions{IssuerDomainNames: []string{"ca.example.com"}}, ""},
+		{"ok full", &CAAOptions{
+			IssuerDomainNames: []string{"ca.example.com", "ca.example.org"},
+			FailureMode:       CAASoftFail,
+			RequireDNSSEC:     true,
+			Resolvers:         []string{"1.1.1.1", "10.0.0.2:5353", "[::1]:53"},
+			Timeout:           &Duration{Duration: time.Second},
+		}, ""},
+		{"fail issuerDomainNames", &CAAOptions{}, "caa issuerDomainNames cannot be empty"},
+		{"fail issuerDomainName", &CAAOptions{IssuerDomainNames: []string{"ca.example.com; account=1"}}, `caa issuerDomainName "ca.example.com; account=1" is not valid`},
+		{"fail empty issuerDomainName", &CAAOptions{IssuerDomainNames: []string{""}}, `caa issuerDomainName "" is not valid`},
+		{"fail failureMode", &CAAOptions{IssuerDomainNames: []string{"ca.example.com"}, FailureMode: "ignore"}, `unsupported caa failureMode "ignore"`},
+		{"fail resolver", &CAAOptions{IssuerDomainNames: []string{"ca.example.com"}, Resolvers: []string{"dns.example.com"}}, `caa resolver "dns.example.com" is not valid`},
+		{"fail timeout", &CAAOptions{IssuerDomainNames: []string{"ca.example.com"}, Timeout: &Duration{Duration: -time.Second}}, "caa timeout cannot be negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.Validate()
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestX509Options_GetCAA(t *testing.T) {
+	var o *X509Options
+	assert.Nil(t, o.GetCAA())
+	caa := &CAAOptions{IssuerDomainNames: []string{"ca.example.com"}}
+	o = &X509Options{CAA: caa}
+	assert.Equal(t, caa, o.GetCAA())
+}
+
+func TestCAAOptions_isAuthorized(t *testing.T) {
+	o := &CAAOptions{IssuerDomainNames: []string{"ca.example.com"}}
+	tests := []struct {
+		name     string
+		records  []caaRecord
+		wildcard bool
+		want     bool
+	}{
+		{"empty", nil, false, true},
+		{"issue", []caaRecord{{tag: "issue", value: "ca.example.com"}}, false, true},
+		{"issue case", []caaRecord{{tag: "issue", value: " CA.Example.com ; account=123"}}, false, true},
+		{"issue other", []caaRecord{{tag: "issue", value: "ca.example.org"}}, false, false},
+		{"issue any of", []caaRecord{{tag: "issue", value: "ca.example.org"}, {tag: "issue", value: "ca.example.com"}}, false, true},
+		{"issue none", []caaRecord{{tag: "issue", value: ";"}}, false, false},
+		{"iodef only", []caaRecord{{tag: "iodef", value: "mailto:security@example.com"}}, false, true},
+		{"unknown", []caaRecord{{tag: "unknown", value: "foo"}}, false, true},
+		{"unknown critical", []caaRecord{{flags: 128, tag: "unknown", value: "foo"}, {tag: "issue", value: "ca.example.com"}}, false, false},
+		{"issuewild ignored", []caaRecord{{tag: "issuewild", value: "ca.example.org"}}, false, true},
+		{"wildcard issue", []caaRecord{{tag: "issue", value: "ca.example.com"}}, true, true},
+		{"wildcard issuewild", []caaRecord{{tag: "issue", value: "ca.example.org"}, {tag: "issuewild", value: "ca.example.com"}}, true, true},
+		{"wildcard issuewild other", []caaRecord{{tag: "issue", value: "ca.example.com"}, {tag: "issuewild", value: "ca.example.org"}}, true, false},
+		{"wildcard issuewild none", []caaRecord{{tag: "issue", value: "ca.example.com"}, {tag: "issuewild", value: ";"}}, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, o.isAuthorized(tt.records, tt.wildcard))
+		})
+	}
+}
+
+func Test_parseCAARecord(t *testing.T) {
+	r, err := parseCAARecord(testCAARecord{flags: 128, tag: "Issue", value: "ca.example.com"}.data())
+	require.NoError(t, err)
+	assert.Equal(t, caaRecord{flags: 128, tag: "issue", value: "ca.example.com"}, r)
+
+	_, err = parseCAARecord([]byte{0})
+	assert.Error(t, err)
+	_, err = parseCAARecord([]byte{0, 0, 'a'})
+	assert.Error(t, err)
+	_, err = parseCAARecord([]byte{0, 5, 'i', 's'})
+	assert.Error(t, err)
+}
+
+func TestCAAOptions_Check(t *testing.T) {
+	records := map[string][]testCAARecord{
+		"example.com":         {{tag: "issue", value: "ca.example.com"}, {tag: "issuewild", value: ";"}},
+		"other.example.com":   {{tag: "issue", value: "ca.example.org"}},
+		"unknown.example.org": {{flags: 128, tag: "tbs", value: "foo"}},
+	}
+	cert := func(names ...string) *x509.Certificate {
+		return &x509.Certificate{DNSNames: names}
+	}
+	unreachable := func(t *testing.T) string {
+		t.Helper()
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		addr := ln.Addr().String()
+		ln.Close()
+		return addr
+	}
+
+	tests := []struct {
+		name    string
+		zone    *testCAAZone
+		opts    *CAAOptions
+		cert    *x509.Certificate
+		wantErr string
+	}{
+		{"ok nil", nil, nil, cert("other.example.com"), ""},
+		{"ok", &testCAAZone{records: records}, &CAAOptions{}, cert("example.com", "www.example.com", "foo.example.net"), ""},
+		{"ok nxdomain", &testCAAZone{records: records, nxdomain: true}, &CAAOptions{}, cert("foo.bar.example.com"), ""},
+		{"ok truncated", &testCAAZone{records: records, truncated: true}, &CAAOptions{}, cert("example.com"), ""},
+		{"ok dnssec", &testCAAZone{records: records, authenticated: true}, &CAAOptions{RequireDNSSEC: true}, cert("example.com"), ""},
+		{"ok soft-fail", &testCAAZone{records: records, rcode: dnsmessage.RCodeServerFailure}, &CAAOptions{FailureMode: CAASoftFail}, cert("example.com"), ""},
+		{"ok soft-fail dnssec", &testCAAZone{records: records}, &CAAOptions{FailureMode: CAASoftFail, RequireDNSSEC: true}, cert("example.com"), ""},
+		{"fail forbidden", &testCAAZone{records: records}, &CAAOptions{}, cert("example.com", "other.example.com"), "other.example.com: caa records forbid issuance"},
+		{"fail forbidden wildcard", &testCAAZone{records: records}, &CAAOptions{}, cert("*.example.com"), "*.example.com: caa records forbid issuance"},
+		{"fail forbidden critical", &testCAAZone{records: records}, &CAAOptions{}, cert("www.unknown.example.org"), "www.unknown.example.org: caa records forbid issuance"},
+		{"fail server failure", &testCAAZone{records: records, rcode: dnsmessage.RCodeServerFailure}, &CAAOptions{}, cert("example.com"), "error looking up caa records: unexpected response code RCodeServerFailure for example.com"},
+		{"fail dnssec", &testCAAZone{records: records}, &CAAOptions{RequireDNSSEC: true}, cert("example.com"), "error looking up caa records: response for example.com is not authenticated with DNSSEC"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.opts != nil {
+				tt.opts.IssuerDomainNames = []string{"ca.example.com"}
+				tt.opts.Resolvers = []string{newTestCAAServer(t, tt.zone)}
+			}
+			err := tt.opts.Check(context.Background(), tt.cert)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				if strings.Contains(tt.wantErr, "forbid") {
+					assert.ErrorIs(t, err, ErrCAAForbidden)
+				}
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+
+	t.Run("ok next resolver", func(t *testing.T) {
+		opts := &CAAOptions{
+			IssuerDomainNames: []string{"ca.example.com"},
+			Resolvers:         []string{unreachable(t), newTestCAAServer(t, &testCAAZone{records: records})},
+			Timeout:           &Duration{Duration: time.Second},
+		}
+		assert.ErrorIs(t, opts.Check(context.Background(), cert("other.example.com")), ErrCAAForbidden)
+	})
+}
@@ -24,13 +24,60 @@ type Claims struct {
 	EnableSSHCA       *bool     `json:"enableSSHCA,omitempty"`
 
 	// Renewal properties
-	DisableRenewal          *bool `json:"disableRenewal,omitempty"`
-	AllowRenewalAfterExpiry *bool `json:"allowRenewalAfterExpiry,omitempty"`
+	DisableRenewal          *bool          `json:"disableRenewal,omitempty"`
+	AllowRenewalAfterExpiry *bool          `json:"allowRenewalAfterExpiry,omitempty"`
+	RenewalWindow           *RenewalWindow `json:"renewalWindow,omitempty"`
 
 	// Other properties
 	DisableSmallstepExtensions *bool `json:"disableSmallstepExtensions,omitempty"`
 }
 
+// RenewalWindow is the period of the lifetime of an X.509 certificate in which
+// it can be renewed.
+type RenewalWindow struct {
+	// Start is the fraction of the certificate lifetime that must have elapsed
+	// before the certificate can be renewed, e.g. 0.66 allows renewals after
+	// 2/3 of the lifetime.
+	Start float64 `json:"start,omitempty"`
+	// AfterExpiry is the time after the expiration of the certificate in which
+	// it can still be renewed. If set, it allows renewals after expiry even if
+	// allowRenewalAfterExpiry is not set.
+	AfterExpiry *Duration `json:"afterExpiry,omitempty"`
+}
+
+// StartTime returns the time from which a certificate with the given validity
+// can be renewed.
+func (w *RenewalWindow) StartTime(notBefore, notAfter time.Time) time.Time {
+	if w == nil || w.Start <= 0 {
+		return notBefore
+	}
+	lifetime := notAfter.Sub(notBefore)
+	return notBefore.Add(time.Duration(float64(lifetime) * w.Start))
+}
+
+// GetAfterExpiry returns the time after expiry in which a certificate can be
+// renewed, 0 if it is not set.
+func (w *RenewalWindow) GetAfterExpiry() time.Duration {
+	if w == nil || w.AfterExpiry == nil {
+		return 0
+	}
+	return w.AfterExpiry.Duration
+}
+
+// Validate validates the renewal window.
+func (w *RenewalWindow) Validate() error {
+	switch {
+	case w == nil:
+		return nil
+	case w.Start < 0 || w.Start >= 1:
+		return errors.Errorf("claims: RenewalWindow start must be greater or equal than 0 and less than 1")
+	case w.GetAfterExpiry() < 0:
+		return errors.Errorf("claims: RenewalWindow afterExpiry cannot be less than 0")
+	default:
+		return nil
+	}
+}
+
 // Claimer is the type that controls claims. It provides an interface around the
 // current claim and the global one.
 type Claimer struct {
@@ -65,6 +112,7 @@ func (c *Claimer) Claims() Claims {
 		EnableSSHCA:                &enableSSHCA,
 		DisableRenewal:             &disableRenewal,
 		AllowRenewalAfterExpiry:    &allowRenewalAfterExpiry,
+		RenewalWindow:              c.RenewalWindow(),
 		DisableSmallstepExtensions: &disableSmallstepExtensions,
 	}
 }
@@ -134,6 +182,16 @@ func (c *Claimer) AllowRenewalAfterExpiry() bool {
 	return *c.claims.AllowRenewalAfterExpiry
 }
 
+// RenewalWindow returns the period of the lifetime of an X.509 certificate in
+// which it can be renewed. If the property is not set within the provisioner
+// then the global value from the authority configuration will be used.
+func (c *Claimer) RenewalWindow() *RenewalWindow {
+	if c.claims == nil || c.claims.RenewalWindow == nil {
+		return c.global.RenewalWindow
+	}
+	return c.claims.RenewalWindow
+}
+
 // DefaultSSHCertDuration returns the default SSH certificate duration for the
 // given certificate type.
 func (c *Claimer) DefaultSSHCertDuration(certType uint32) (time.Duration, error) {
@@ -253,6 +311,6 @@ func (c *Claimer) Validate() error {
 	case max < def:
 		return errors.Errorf("claims: MaxCertDuration cannot be less than DefaultCertDuration: MaxCertDuration - %v, DefaultCertDuration - %v", max, def)
 	default:
-		return nil
+		return c.RenewalWindow().Validate()
 	}
 }
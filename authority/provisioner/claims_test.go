@@ -49,3 +49,24 @@ func TestClaimer_DefaultSSHCertDuration(t *testing.T) {
 		})
 	}
 }
+
+func TestRenewalWindow_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		window  *RenewalWindow
+		wantErr bool
+	}{
+		{"nil", nil, false},
+		{"ok", &RenewalWindow{Start: 0.66, AfterExpiry: &Duration{Duration: 24 * time.Hour}}, false},
+		{"fail start negative", &RenewalWindow{Start: -0.5}, true},
+		{"fail start", &RenewalWindow{Start: 1}, true},
+		{"fail afterExpiry", &RenewalWindow{AfterExpiry: &Duration{Duration: -time.Hour}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.window.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("RenewalWindow.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -42,6 +42,35 @@ type loadByTokenPayload struct {
 	TenantID        string `json:"tid"`   // Microsoft Azure tenant id
 }
 
+// additionalKeysProvisioner is implemented by the provisioners that accept
+// tokens signed by more than one key, like a JWK provisioner with a key
+// rotation in progress.
+type additionalKeysProvisioner interface {
+	additionalKeys() []*JWKKey
+}
+
+// additionalClientsProvisioner is implemented by the provisioners that accept
+// tokens issued to more than one client, like an OIDC provisioner with a
+// device authorization client.
+type additionalClientsProvisioner interface {
+	additionalClientIDs() []string
+}
+
+// additionalTokenIDs returns the token identifiers of the additional keys of a
+// provisioner, <name>:<kid>, and the ones of the additional clients.
+func additionalTokenIDs(p Interface) []string {
+	var ids []string
+	if akp, ok := p.(additionalKeysProvisioner); ok {
+		for _, k := range akp.additionalKeys() {
+			ids = append(ids, p.GetName()+":"+k.Key.KeyID)
+		}
+	}
+	if acp, ok := p.(additionalClientsProvisioner); ok {
+		ids = append(ids, acp.additionalClientIDs()...)
+	}
+	return ids
+}
+
 // Collection is a memory map of provisioners.
 type Collection struct {
 	byID      *sync.Map
@@ -104,6 +133,15 @@ func (c *Collection) LoadByToken(token *jose.JSONWebToken, claims *jose.Claims)
 		return c.LoadByTokenID(claims.Issuer + ":" + token.Headers[0].KeyID)
 	}
 
+	// JWK provisioners with custom audiences.
+	if len(token.Headers) > 0 {
+		if p, ok := c.LoadByTokenID(claims.Issuer + ":" + token.Headers[0].KeyID); ok {
+			if jwk, ok := p.(*JWK); ok && jwk.Audiences.matches(claims.Audience) {
+				return p, true
+			}
+		}
+	}
+
 	// The ID will be just the clientID stored in azp, aud or tid.
 	var payload loadByTokenPayload
 	if err := token.UnsafeClaimsWithoutVerification(&payload); err != nil {
@@ -148,6 +186,22 @@ func (c *Collection) LoadByToken(token *jose.JSONWebToken, claims *jose.Claims)
 	return c.LoadByTokenID(payload.Audience[0])
 }
 
+// LoadByOpaqueToken loads the provisioner with the given name if it accepts
+// opaque tokens, tokens that are not a JWT. Opaque tokens do not contain any
+// information about the provisioner, so the provisioner must be selected
+// explicitly by the client. The token is not validated, it is only sent to the
+// introspection endpoint of the selected provisioner when it is authorized.
+func (c *Collection) LoadByOpaqueToken(name string) (Interface, bool) {
+	p, ok := c.LoadByName(name)
+	if !ok {
+		return nil, false
+	}
+	if o, ok := p.(*OIDC); ok && o.IntrospectionEndpoint != "" {
+		return p, true
+	}
+	return nil, false
+}
+
 // LoadByCertificate looks for the provisioner extension and extracts the
 // proper id to load the provisioner.
 func (c *Collection) LoadByCertificate(cert *x509.Certificate) (Interface, bool) {
@@ -173,6 +227,13 @@ func (c *Collection) LoadEncryptedKey(keyID string) (string, bool) {
 	if !ok {
 		return "", false
 	}
+	if akp, ok := p.(additionalKeysProvisioner); ok {
+		for _, k := range akp.additionalKeys() {
+			if k.Key.KeyID == keyID && k.EncryptedKey != "" {
+				return k.EncryptedKey, true
+			}
+		}
+	}
 	_, key, ok := p.GetEncryptedKey()
 	return key, ok
 }
@@ -199,10 +260,32 @@ func (c *Collection) Store(p Interface) error {
 			"cannot add multiple provisioners with the same token identifier")
 	}
 
+	// Store provisioner by the ID of the additional keys.
+	additionalIDs := additionalTokenIDs(p)
+	for i, id := range additionalIDs {
+		if _, loaded := c.byTokenID.LoadOrStore(id, p); loaded {
+			c.byID.Delete(p.GetID())
+			c.byName.Delete(p.GetName())
+			c.byTokenID.Delete(p.GetIDForToken())
+			for _, id := range additionalIDs[:i] {
+				c.byTokenID.Delete(id)
+			}
+			return admin.NewError(admin.ErrorBadRequestType,
+				"cannot add multiple provisioners with the same token identifier")
+		}
+	}
+
 	// Store provisioner in byKey if EncryptedKey is defined.
 	if kid, _, ok := p.GetEncryptedKey(); ok {
 		c.byKey.Store(kid, p)
 	}
+	if akp, ok := p.(additionalKeysProvisioner); ok {
+		for _, k := range akp.additionalKeys() {
+			if k.EncryptedKey != "" {
+				c.byKey.Store(k.Key.KeyID, p)
+			}
+		}
+	}
 
 	// Store sorted provisioners.
 	// Use the first 4 bytes (32bit) of the sum to insert the order
@@ -246,9 +329,17 @@ func (c *Collection) Remove(id string) error {
 	c.byID.Delete(id)
 	c.byName.Delete(prov.GetName())
 	c.byTokenID.Delete(prov.GetIDForToken())
+	for _, id := range additionalTokenIDs(prov) {
+		c.byTokenID.Delete(id)
+	}
 	if kid, _, ok := prov.GetEncryptedKey(); ok {
 		c.byKey.Delete(kid)
 	}
+	if akp, ok := prov.(additionalKeysProvisioner); ok {
+		for _, k := range akp.additionalKeys() {
+			c.byKey.Delete(k.Key.KeyID)
+		}
+	}
 
 	return nil
 }
@@ -273,6 +364,13 @@ func (c *Collection) Update(nu Interface) error {
 		}
 	}
 
+	for _, id := range additionalTokenIDs(nu) {
+		if p, ok := c.LoadByTokenID(id); ok && p.GetID() != old.GetID() {
+			return admin.NewError(admin.ErrorBadRequestType,
+				"provisioner with Token ID %s already exists", id)
+		}
+	}
+
 	if err := c.Remove(old.GetID()); err != nil {
 		return err
 	}
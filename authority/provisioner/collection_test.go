@@ -295,6 +295,72 @@ func TestCollection_Store(t *testing.T) {
 	}
 }
 
+func TestCollection_Store_additionalKeys(t *testing.T) {
+	c := NewCollection(testAudiences)
+	p1, err := generateJWK()
+	assert.FatalError(t, err)
+	p2, err := generateJWK()
+	assert.FatalError(t, err)
+	p3, err := generateJWK()
+	assert.FatalError(t, err)
+
+	// p1 accepts tokens signed with the key of p2
+	p1.Keys = []*JWKKey{{Key: p2.Key, EncryptedKey: p2.EncryptedKey}}
+	assert.FatalError(t, c.Store(p1))
+
+	p, ok := c.LoadByTokenID(p1.Name + ":" + p2.Key.KeyID)
+	assert.True(t, ok)
+	assert.Equals(t, p1, p)
+	key, ok := c.LoadEncryptedKey(p2.Key.KeyID)
+	assert.True(t, ok)
+	assert.Equals(t, p2.EncryptedKey, key)
+	key, ok = c.LoadEncryptedKey(p1.Key.KeyID)
+	assert.True(t, ok)
+	assert.Equals(t, p1.EncryptedKey, key)
+
+	// additional token ids cannot be duplicated
+	p3.Name = p1.Name + "-other"
+	p3.Keys = []*JWKKey{{Key: p2.Key}}
+	assert.FatalError(t, c.Store(p3))
+	dup := &JWK{Name: p3.Name, Type: "JWK", Key: p2.Key}
+	assert.Error(t, c.Store(dup))
+	_, ok = c.Load(dup.GetID())
+	assert.False(t, ok)
+
+	assert.FatalError(t, c.Remove(p1.GetID()))
+	_, ok = c.LoadByTokenID(p1.Name + ":" + p2.Key.KeyID)
+	assert.False(t, ok)
+	_, ok = c.LoadEncryptedKey(p2.Key.KeyID)
+	assert.False(t, ok)
+}
+
+func TestCollection_LoadByToken_jwkAudiences(t *testing.T) {
+	c := NewCollection(testAudiences)
+	p1, err := generateJWK()
+	assert.FatalError(t, err)
+	p1.Audiences = &JWKAudiences{Sign: []string{"step-ca-sign"}}
+	assert.FatalError(t, p1.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+	assert.FatalError(t, c.Store(p1))
+	key, err := decryptJSONWebKey(p1.EncryptedKey)
+	assert.FatalError(t, err)
+
+	parse := func(aud string) (*jose.JSONWebToken, *jose.Claims) {
+		tok, err := generateSimpleToken(p1.Name, aud, key)
+		assert.FatalError(t, err)
+		jwt, err := jose.ParseSigned(tok)
+		assert.FatalError(t, err)
+		var claims jose.Claims
+		assert.FatalError(t, jwt.UnsafeClaimsWithoutVerification(&claims))
+		return jwt, &claims
+	}
+
+	p, ok := c.LoadByToken(parse("step-ca-sign"))
+	assert.True(t, ok)
+	assert.Equals(t, p1, p)
+	_, ok = c.LoadByToken(parse("other-audience"))
+	assert.False(t, ok)
+}
+
 func TestCollection_Find(t *testing.T) {
 	c, err := generateCollection(10, 10)
 	assert.FatalError(t, err)
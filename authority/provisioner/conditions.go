@@ -0,0 +1,217 @@
+package provisioner
+
+import (
+	"net"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Conditions restrict where and when a provisioner can be used to sign
+// certificates. All the configured conditions must be satisfied.
+type Conditions struct {
+	// SourceCIDRs is the list of IP ranges allowed to send requests.
+	SourceCIDRs []string `json:"sourceCIDRs,omitempty"`
+	// TimeWindows is the list of windows of time where requests are allowed.
+	TimeWindows []TimeWindow `json:"timeWindows,omitempty"`
+	// UserAgents is the list of regular expressions that the User-Agent header
+	// of the requests must match.
+	UserAgents []string `json:"userAgents,omitempty"`
+
+	once    sync.Once
+	matcher *conditionsMatcher
+	err     error
+}
+
+// TimeWindow is a daily window of time, e.g. from 08:00 to 18:00. If the end
+// time is before the start time, the window ends on the next day.
+type TimeWindow struct {
+	// Days is the list of week days where the window applies, e.g. "Mon" or
+	// "Monday". Defaults to every day.
+	Days []string `json:"days,omitempty"`
+	// Start is the start time in the HH:MM format.
+	Start string `json:"start"`
+	// End is the end time in the HH:MM format.
+	End string `json:"end"`
+	// Location is the IANA time zone of the window, UTC by default.
+	Location string `json:"location,omitempty"`
+}
+
+// conditionsMatcher contains the compiled source ranges, time windows and
+// user agent patterns of the conditions.
+type conditionsMatcher struct {
+	sourceNets  []*net.IPNet
+	timeWindows []*timeWindowMatcher
+	userAgents  []*regexp.Regexp
+}
+
+// timeWindowMatcher contains the parsed fields of a time window.
+type timeWindowMatcher struct {
+	days       []time.Weekday
+	start, end time.Duration
+	loc        *time.Location
+}
+
+// Init validates and compiles the conditions. It is called when the
+// provisioner is initialized, and the compiled conditions are used by Allow.
+func (c *Conditions) Init() error {
+	if c == nil {
+		return nil
+	}
+	c.once.Do(func() {
+		c.matcher, c.err = c.compile()
+	})
+	return c.err
+}
+
+// Validate returns an error if the conditions are not valid.
+func (c *Conditions) Validate() error {
+	if c == nil {
+		return nil
+	}
+	_, err := c.compile()
+	return err
+}
+
+func (c *Conditions) compile() (*conditionsMatcher, error) {
+	m := new(conditionsMatcher)
+	for _, s := range c.SourceCIDRs {
+		_, ipNet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, errors.Errorf("conditions sourceCIDRs %q is not a valid CIDR", s)
+		}
+		m.sourceNets = append(m.sourceNets, ipNet)
+	}
+	for i := range c.TimeWindows {
+		w, err := c.TimeWindows[i].compile()
+		if err != nil {
+			return nil, err
+		}
+		m.timeWindows = append(m.timeWindows, w)
+	}
+	for _, s := range c.UserAgents {
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return nil, errors.Wrapf(err, "conditions userAgents %q is not a valid regular expression", s)
+		}
+		m.userAgents = append(m.userAgents, re)
+	}
+	return m, nil
+}
+
+// Allow returns an error if the request with the given client ip and
+// User-Agent at the given time does not satisfy the conditions. The ip can be
+// nil if it is not known, in which case the request is not allowed if source
+// ranges are configured.
+func (c *Conditions) Allow(ip net.IP, userAgent string, t time.Time) error {
+	if c == nil {
+		return nil
+	}
+	if err := c.Init(); err != nil {
+		return err
+	}
+	m := c.matcher
+	if len(m.sourceNets) > 0 {
+		if ip == nil {
+			return errors.New("request source address is not available")
+		}
+		if !slices.ContainsFunc(m.sourceNets, func(ipNet *net.IPNet) bool {
+			return ipNet.Contains(ip)
+		}) {
+			return errors.Errorf("request source address %s is not allowed", ip)
+		}
+	}
+	if len(m.timeWindows) > 0 {
+		if !slices.ContainsFunc(m.timeWindows, func(w *timeWindowMatcher) bool {
+			return w.contains(t)
+		}) {
+			return errors.New("request is not allowed at this time")
+		}
+	}
+	if len(m.userAgents) > 0 {
+		if !slices.ContainsFunc(m.userAgents, func(re *regexp.Regexp) bool {
+			return re.MatchString(userAgent)
+		}) {
+			return errors.Errorf("request user agent %q is not allowed", userAgent)
+		}
+	}
+	return nil
+}
+
+// Validate returns an error if the time window is not valid.
+func (w *TimeWindow) Validate() error {
+	_, err := w.compile()
+	return err
+}
+
+func (w *TimeWindow) compile() (*timeWindowMatcher, error) {
+	start, err := parseTimeOfDay(w.Start)
+	if err != nil {
+		return nil, errors.Errorf("conditions timeWindows start %q is not valid", w.Start)
+	}
+	end, err := parseTimeOfDay(w.End)
+	if err != nil {
+		return nil, errors.Errorf("conditions timeWindows end %q is not valid", w.End)
+	}
+	var days []time.Weekday
+	for _, s := range w.Days {
+		d, ok := parseWeekday(s)
+		if !ok {
+			return nil, errors.Errorf("conditions timeWindows day %q is not valid", s)
+		}
+		days = append(days, d)
+	}
+	loc, err := time.LoadLocation(w.Location)
+	if err != nil {
+		return nil, errors.Wrapf(err, "conditions timeWindows location %q is not valid", w.Location)
+	}
+	return &timeWindowMatcher{days: days, start: start, end: end, loc: loc}, nil
+}
+
+// contains returns true if the given time is in the window. If the window
+// ends on the next day, the day of the start is used.
+func (w *timeWindowMatcher) contains(t time.Time) bool {
+	t = t.In(w.loc)
+	day := t.Weekday()
+	now := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	switch {
+	case w.start <= w.end:
+		if now < w.start || now >= w.end {
+			return false
+		}
+	case now >= w.start:
+	case now < w.end:
+		day = (day + 6) % 7
+	default:
+		return false
+	}
+
+	if len(w.days) == 0 {
+		return true
+	}
+	return slices.Contains(w.days, day)
+}
+
+// parseTimeOfDay parses a time in the HH:MM format and returns the duration
+// since midnight.
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// parseWeekday parses the short or long English name of a week day.
+func parseWeekday(s string) (time.Weekday, bool) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(s, d.String()) || strings.EqualFold(s, d.String()[:3]) {
+			return d, true
+		}
+	}
+	return 0, false
+}
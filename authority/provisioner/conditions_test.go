@@ -0,0 +1,104 @@
+package provisioner
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConditions_Validate(t *testing.T) {
+	tests := []struct {
+		name       string
+		conditions *Conditions
+		wantErr    bool
+	}{
+		{"nil", nil, false},
+		{"ok", &Conditions{
+			SourceCIDRs: []string{"10.0.0.0/8", "2001:db8::/32"},
+			TimeWindows: []TimeWindow{{Days: []string{"Mon", "tuesday"}, Start: "08:00", End: "18:00", Location: "Europe/Madrid"}},
+			UserAgents:  []string{"^step-cli/"},
+		}, false},
+		{"fail sourceCIDRs", &Conditions{SourceCIDRs: []string{"10.0.0.1"}}, true},
+		{"fail start", &Conditions{TimeWindows: []TimeWindow{{Start: "8am", End: "18:00"}}}, true},
+		{"fail end", &Conditions{TimeWindows: []TimeWindow{{Start: "08:00", End: "24:00"}}}, true},
+		{"fail days", &Conditions{TimeWindows: []TimeWindow{{Days: []string{"Funday"}, Start: "08:00", End: "18:00"}}}, true},
+		{"fail location", &Conditions{TimeWindows: []TimeWindow{{Start: "08:00", End: "18:00", Location: "Mars/Olympus"}}}, true},
+		{"fail userAgents", &Conditions{UserAgents: []string{"step-cli/("}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.conditions.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestConditions_Init(t *testing.T) {
+	var c *Conditions
+	assert.NoError(t, c.Init())
+
+	c = &Conditions{SourceCIDRs: []string{"10.0.0.0/8"}, UserAgents: []string{"^step-cli/"}}
+	assert.NoError(t, c.Init())
+	if assert.NotNil(t, c.matcher) {
+		assert.Len(t, c.matcher.sourceNets, 1)
+		assert.Len(t, c.matcher.userAgents, 1)
+	}
+	// The compiled conditions are reused.
+	m := c.matcher
+	assert.NoError(t, c.Allow(net.ParseIP("10.1.2.3"), "step-cli/0.26.0", time.Now()))
+	assert.Same(t, m, c.matcher)
+
+	c = &Conditions{UserAgents: []string{"step-cli/("}}
+	assert.Error(t, c.Init())
+	assert.Error(t, c.Allow(nil, "step-cli/0.26.0", time.Now()))
+}
+
+func TestConditions_Allow(t *testing.T) {
+	// Wednesday.
+	noon := time.Date(2024, time.May, 15, 12, 0, 0, 0, time.UTC)
+	c := &Conditions{
+		SourceCIDRs: []string{"10.0.0.0/8"},
+		TimeWindows: []TimeWindow{{Days: []string{"Mon", "Tue", "Wed", "Thu", "Fri"}, Start: "08:00", End: "18:00"}},
+		UserAgents:  []string{"^step-cli/", "^Go-http-client/"},
+	}
+	night := &Conditions{
+		TimeWindows: []TimeWindow{{Days: []string{"Wed"}, Start: "22:00", End: "02:00", Location: "America/Los_Angeles"}},
+	}
+	tests := []struct {
+		name       string
+		conditions *Conditions
+		ip         net.IP
+		userAgent  string
+		t          time.Time
+		wantErr    bool
+	}{
+		{"ok nil", nil, nil, "", noon, false},
+		{"ok", c, net.ParseIP("10.1.2.3"), "step-cli/0.26.0", noon, false},
+		{"ok other user agent", c, net.ParseIP("10.1.2.3"), "Go-http-client/1.1", noon, false},
+		{"ok night start", night, nil, "", time.Date(2024, time.May, 16, 5, 30, 0, 0, time.UTC), false},
+		{"ok night end", night, nil, "", time.Date(2024, time.May, 16, 8, 30, 0, 0, time.UTC), false},
+		{"fail night day", night, nil, "", time.Date(2024, time.May, 17, 8, 30, 0, 0, time.UTC), true},
+		{"fail night time", night, nil, "", time.Date(2024, time.May, 16, 10, 0, 0, 0, time.UTC), true},
+		{"fail ip", c, net.ParseIP("192.168.1.1"), "step-cli/0.26.0", noon, true},
+		{"fail missing ip", c, nil, "step-cli/0.26.0", noon, true},
+		{"fail time", c, net.ParseIP("10.1.2.3"), "step-cli/0.26.0", noon.Add(7 * time.Hour), true},
+		{"fail day", c, net.ParseIP("10.1.2.3"), "step-cli/0.26.0", noon.Add(72 * time.Hour), true},
+		{"fail user agent", c, net.ParseIP("10.1.2.3"), "curl/8.0", noon, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.conditions.Allow(tt.ip, tt.userAgent, tt.t)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -34,10 +34,75 @@ func NewController(p Interface, claims *Claims, config Config, options *Options)
 	if err != nil {
 		return nil, err
 	}
+	if options, err = applyPolicyOptions(options, config.DefaultOptions); err != nil {
+		return nil, err
+	}
 	policy, err := newPolicyEngine(options)
 	if err != nil {
 		return nil, err
 	}
+	if err := options.GetX509Options().validateOtherNames(); err != nil {
+		return nil, err
+	}
+	if err := options.GetX509Options().validateIssuerAltNames(); err != nil {
+		return nil, err
+	}
+	if err := options.GetSSHOptions().validateKeyID(); err != nil {
+		return nil, err
+	}
+	if err := options.GetSSHOptions().validateCertificateOptions(); err != nil {
+		return nil, err
+	}
+	if err := options.GetSSHOptions().validateUserPrincipals(p.GetType()); err != nil {
+		return nil, err
+	}
+	if err := options.GetSSHOptions().validateSourceAddress(p.GetType()); err != nil {
+		return nil, err
+	}
+	if err := options.GetX509Options().GetNotAfterAlignment().Validate(); err != nil {
+		return nil, err
+	}
+	if err := options.GetX509Options().GetCAA().Validate(); err != nil {
+		return nil, err
+	}
+	if err := options.GetRateLimit().Validate(); err != nil {
+		return nil, err
+	}
+	if err := options.GetCertificateQuota().Validate(); err != nil {
+		return nil, err
+	}
+	if err := options.GetApproval().Validate(); err != nil {
+		return nil, err
+	}
+	if err := options.GetConditions().Init(); err != nil {
+		return nil, err
+	}
+	if options != nil {
+		if err := options.State.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	for _, wh := range options.GetWebhooks() {
+		if err := wh.TOFU.Validate(); err != nil {
+			return nil, err
+		}
+		if err := wh.Cache.Validate(); err != nil {
+			return nil, err
+		}
+		if err := wh.CircuitBreaker.Validate(); err != nil {
+			return nil, err
+		}
+		if err := wh.ClientCertificate.Validate(); err != nil {
+			return nil, err
+		}
+		if wh.DisableTLSClientAuth && wh.ClientCertificate != nil {
+			return nil, errors.New("webhook clientCertificate cannot be used with disableTLSClientAuth")
+		}
+		if wh.clientCertificate, err = wh.ClientCertificate.load(); err != nil {
+			return nil, err
+		}
+		wh.pinStore = config.WebhookPinStore
+	}
 	return &Controller{
 		Interface:             p,
 		Audiences:             &config.Audiences,
@@ -137,8 +202,8 @@ func DefaultIdentityFunc(_ context.Context, p Interface, email string) (*Identit
 
 // DefaultAuthorizeRenew is the default implementation of AuthorizeRenew. It
 // will return an error if the provisioner has the renewal disabled, if the
-// certificate is not yet valid or if the certificate is expired and renew after
-// expiry is disabled.
+// certificate is not yet valid, if the certificate is outside the renewal
+// window, or if the certificate is expired and renew after expiry is disabled.
 func DefaultAuthorizeRenew(_ context.Context, p *Controller, cert *x509.Certificate) error {
 	if p.Claimer.IsDisableRenewal() {
 		return errs.Unauthorized("renew is disabled for provisioner '%s'", p.GetName())
@@ -148,10 +213,21 @@ func DefaultAuthorizeRenew(_ context.Context, p *Controller, cert *x509.Certific
 	if now.Before(cert.NotBefore) {
 		return errs.Unauthorized("certificate is not yet valid" + " " + now.UTC().Format(time.RFC3339Nano) + " vs " + cert.NotBefore.Format(time.RFC3339Nano))
 	}
-	if now.After(cert.NotAfter) && !p.Claimer.AllowRenewalAfterExpiry() {
-		// return a custom 401 Unauthorized error with a clearer message for the client
-		// TODO(hs): these errors likely need to be refactored as a whole; HTTP status codes shouldn't be in this layer.
-		return errs.New(http.StatusUnauthorized, "The request lacked necessary authorization to be completed: certificate expired on %s", cert.NotAfter)
+
+	window := p.Claimer.RenewalWindow()
+	if start := window.StartTime(cert.NotBefore, cert.NotAfter); now.Before(start) {
+		return errs.Unauthorized("certificate cannot be renewed before %s", start.UTC().Format(time.RFC3339))
+	}
+	if now.After(cert.NotAfter) {
+		if afterExpiry := window.GetAfterExpiry(); afterExpiry > 0 {
+			if end := cert.NotAfter.Add(afterExpiry); now.After(end) {
+				return errs.New(http.StatusUnauthorized, "The request lacked necessary authorization to be completed: certificate expired on %s and the renewal window ended on %s", cert.NotAfter, end)
+			}
+		} else if !p.Claimer.AllowRenewalAfterExpiry() {
+			// return a custom 401 Unauthorized error with a clearer message for the client
+			// TODO(hs): these errors likely need to be refactored as a whole; HTTP status codes shouldn't be in this layer.
+			return errs.New(http.StatusUnauthorized, "The request lacked necessary authorization to be completed: certificate expired on %s", cert.NotAfter)
+		}
 	}
 
 	return nil
@@ -3,6 +3,7 @@ package provisioner
 import (
 	"context"
 	"crypto/x509"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"reflect"
@@ -130,6 +131,34 @@ func TestNewController(t *testing.T) {
 				},
 			},
 		}}, nil, true},
+		{"fail other names", args{&JWK{}, nil, Config{
+			Claims:    globalProvisionerClaims,
+			Audiences: testAudiences,
+		}, &Options{
+			X509: &X509Options{
+				OtherNames: []OtherName{{OID: "1.3.foo", Value: "{{ .Token.upn }}"}},
+			},
+		}}, nil, true},
+		{"fail issuer alt names", args{&JWK{}, nil, Config{
+			Claims:    globalProvisionerClaims,
+			Audiences: testAudiences,
+		}, &Options{
+			X509: &X509Options{
+				IssuerAltNames: []IssuerAltName{{Type: "uri", Value: "ca.example.com"}},
+			},
+		}}, nil, true},
+		{"fail notAfter alignment", args{&JWK{}, nil, Config{
+			Claims:    globalProvisionerClaims,
+			Audiences: testAudiences,
+		}, &Options{
+			X509: &X509Options{NotAfterAlignment: "monthly"},
+		}}, nil, true},
+		{"fail webhook tofu", args{&JWK{}, nil, Config{
+			Claims:    globalProvisionerClaims,
+			Audiences: testAudiences,
+		}, &Options{
+			Webhooks: []*Webhook{{Name: "foo", TOFU: "always"}},
+		}}, nil, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -145,6 +174,93 @@ func TestNewController(t *testing.T) {
 	}
 }
 
+func TestNewController_policy(t *testing.T) {
+	var options Options
+	if err := json.Unmarshal([]byte(`{
+		"policy": {
+			"x509": {"allow": {"dns": ["*.example.com"]}},
+			"ssh": {"host": {"deny": {"dns": ["bad.example.com"]}}}
+		}
+	}`), &options); err != nil {
+		t.Fatal(err)
+	}
+
+	p := &JWK{Name: "my-jwk"}
+	config := Config{Claims: globalProvisionerClaims}
+	ctl, err := NewController(p, nil, config, &options)
+	if err != nil {
+		t.Fatalf("NewController() error = %v", err)
+	}
+	if err := ctl.getPolicy().getX509().AreSANsAllowed([]string{"foo.example.com"}); err != nil {
+		t.Errorf("AreSANsAllowed() error = %v", err)
+	}
+	if err := ctl.getPolicy().getX509().AreSANsAllowed([]string{"foo.example.org"}); err == nil {
+		t.Error("AreSANsAllowed() error = nil, want an error")
+	}
+	if err := ctl.getPolicy().getSSHHost().IsSSHCertificateAllowed(&ssh.Certificate{
+		CertType: ssh.HostCert, ValidPrincipals: []string{"bad.example.com"},
+	}); err == nil {
+		t.Error("IsSSHCertificateAllowed() error = nil, want an error")
+	}
+
+	// The options can be used again, e.g. on a reload.
+	if _, err := NewController(p, nil, config, &options); err != nil {
+		t.Errorf("NewController() error = %v", err)
+	}
+
+	// The options are not modified.
+	if options.X509 != nil || options.SSH != nil {
+		t.Errorf("NewController() modified the options: %+v", options)
+	}
+
+	// The options policy takes precedence over the names of the defaults.
+	defaults := &Options{X509: &X509Options{
+		AllowedNames: &policy.X509NameOptions{DNSDomains: []string{"*.example.org"}},
+	}}
+	merged := mergeOptions(&options, defaults, p.GetType())
+	ctl, err = NewController(p, nil, Config{Claims: globalProvisionerClaims, DefaultOptions: defaults}, merged)
+	if err != nil {
+		t.Fatalf("NewController() error = %v", err)
+	}
+	if err := ctl.getPolicy().getX509().AreSANsAllowed([]string{"foo.example.org"}); err == nil {
+		t.Error("AreSANsAllowed() error = nil, want an error")
+	}
+	if merged.X509.AllowedNames != defaults.X509.AllowedNames {
+		t.Error("NewController() modified the merged options")
+	}
+
+	// The policy of the defaults cannot be used with the names of the defaults.
+	defaults.Policy = options.Policy
+	_, err = NewController(p, nil, Config{Claims: globalProvisionerClaims, DefaultOptions: defaults}, mergeOptions(nil, defaults, p.GetType()))
+	if err == nil || err.Error() != "provisionerDefaults.options.policy cannot be used with the x509 policy in provisionerDefaults.policy" {
+		t.Errorf("NewController() error = %v, want a provisioner defaults error", err)
+	}
+
+	// The policy of the defaults is not used with admin managed policies.
+	admin := &Options{X509: &X509Options{
+		AllowedNames: &policy.X509NameOptions{DNSDomains: []string{"*.local"}},
+	}}
+	if merged := mergeOptions(admin, defaults, p.GetType()); merged.Policy != nil {
+		t.Errorf("mergeOptions() Policy = %v, want nil", merged.Policy)
+	}
+
+	// Admin managed policies cannot be combined with the options policy.
+	admin.Policy = options.Policy
+	_, err = NewController(p, nil, config, admin)
+	if err == nil || err.Error() != "options.policy cannot be used with the x509 policy managed by the admin api" {
+		t.Errorf("NewController() error = %v, want an admin api error", err)
+	}
+
+	// Invalid policies fail.
+	if _, err := NewController(p, nil, config, &Options{
+		Policy: &policy.Options{X509: &policy.X509PolicyOptions{
+			AllowedNames: &policy.X509NameOptions{DNSDomains: []string{"**.example.com"}},
+		}},
+	}); err == nil {
+		t.Error("NewController() error = nil, want an error")
+	}
+}
+
 func TestController_GetIdentity(t *testing.T) {
 	ctx := context.Background()
 	type fields struct {
@@ -368,6 +484,22 @@ func TestDefaultAuthorizeRenew(t *testing.T) {
 			NotBefore: now.Add(-time.Hour),
 			NotAfter:  now.Add(-time.Minute),
 		}}, false},
+		{"ok renewal window", args{ctx, &Controller{
+			Interface: &JWK{},
+			Claimer:   mustClaimer(t, &Claims{RenewalWindow: &RenewalWindow{Start: 0.66}}, globalProvisionerClaims),
+		}, &x509.Certificate{
+			NotBefore: now.Add(-45 * time.Minute),
+			NotAfter:  now.Add(15 * time.Minute),
+		}}, false},
+		{"ok renewal window after expiry", args{ctx, &Controller{
+			Interface: &JWK{},
+			Claimer: mustClaimer(t, &Claims{RenewalWindow: &RenewalWindow{
+				Start: 0.66, AfterExpiry: &Duration{Duration: 24 * time.Hour},
+			}}, globalProvisionerClaims),
+		}, &x509.Certificate{
+			NotBefore: now.Add(-2 * time.Hour),
+			NotAfter:  now.Add(-time.Hour),
+		}}, false},
 		{"fail disabled", args{ctx, &Controller{
 			Interface: &JWK{},
 			Claimer:   mustClaimer(t, &Claims{DisableRenewal: &trueValue}, globalProvisionerClaims),
@@ -389,6 +521,23 @@ func TestDefaultAuthorizeRenew(t *testing.T) {
 			NotBefore: now.Add(-time.Hour),
 			NotAfter:  now.Add(-time.Minute),
 		}}, true},
+		{"fail renewal window not started", args{ctx, &Controller{
+			Interface: &JWK{},
+			Claimer:   mustClaimer(t, &Claims{RenewalWindow: &RenewalWindow{Start: 0.66}}, globalProvisionerClaims),
+		}, &x509.Certificate{
+			NotBefore: now.Add(-15 * time.Minute),
+			NotAfter:  now.Add(45 * time.Minute),
+		}}, true},
+		{"fail renewal window ended", args{ctx, &Controller{
+			Interface: &JWK{},
+			Claimer: mustClaimer(t, &Claims{
+				AllowRenewalAfterExpiry: &trueValue,
+				RenewalWindow:           &RenewalWindow{AfterExpiry: &Duration{Duration: time.Hour}},
+			}, globalProvisionerClaims),
+		}, &x509.Certificate{
+			NotBefore: now.Add(-3 * time.Hour),
+			NotAfter:  now.Add(-2 * time.Hour),
+		}}, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
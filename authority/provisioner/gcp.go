@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"text/template"
 	"time"
 
 	"github.com/pkg/errors"
@@ -37,6 +38,7 @@ type gcpPayload struct {
 	Email           string           `json:"email"`
 	EmailVerified   bool             `json:"email_verified"`
 	Google          gcpGooglePayload `json:"google"`
+	gke             *gkePayload
 }
 
 type gcpGooglePayload struct {
@@ -71,6 +73,14 @@ func newGCPConfig() *gcpConfig {
 // If DisableCustomSANs is true, only the internal DNS and IP will be added as a
 // SAN. By default it will accept any SAN in the CSR.
 //
+// SANTemplates can be used with DisableCustomSANs to replace the internal DNS
+// names with the SANs rendered from the Compute Engine claims of the token,
+// e.g. "{{ .GCP.InstanceName }}.{{ .GCP.Zone }}.example.com", or with the
+// default private DNS names in {{ .PrivateDNS }} and {{ .ZonalPrivateDNS }}.
+// They are also used as the principals of SSH host certificates. The templates
+// are parsed on Init. Only the signed claims of the token are available, the
+// network and labels of the instance are not part of it, and cannot be used.
+//
 // If DisableTrustOnFirstUse is true, multiple sign request for this provisioner
 // with the same instance will be accepted. By default only the first request
 // will be accepted.
@@ -78,6 +88,17 @@ func newGCPConfig() *gcpConfig {
 // If InstanceAge is set, only the instances with an instance_creation_timestamp
 // within the given period will be accepted.
 //
+// If EnableSSHUserCerts is true, the instances running with one of the
+// SSHUserServiceAccounts will be able to request SSH user certificates. The
+// principals of these certificates are derived from the service account email,
+// the sanitized local part and the email itself.
+//
+// If GKEClusters is set, the Kubernetes service account tokens issued by these
+// clusters, e.g. projects/my-project/locations/us-central1/clusters/my-cluster,
+// will be accepted for X.509 certificates. The certificates are bound to the
+// service account, and GKENamespaces restricts the namespaces allowed. Each
+// GKE token can only be used once.
+//
 // Google Identity docs are available at
 // https://cloud.google.com/compute/docs/instances/verifying-instance-identity
 type GCP struct {
@@ -88,13 +109,20 @@ type GCP struct {
 	ServiceAccounts        []string `json:"serviceAccounts"`
 	ProjectIDs             []string `json:"projectIDs"`
 	DisableCustomSANs      bool     `json:"disableCustomSANs"`
+	SANTemplates           []string `json:"sanTemplates,omitempty"`
 	DisableTrustOnFirstUse bool     `json:"disableTrustOnFirstUse"`
 	InstanceAge            Duration `json:"instanceAge,omitempty"`
+	EnableSSHUserCerts     bool     `json:"enableSSHUserCerts,omitempty"`
+	SSHUserServiceAccounts []string `json:"sshUserServiceAccounts,omitempty"`
+	GKEClusters            []string `json:"gkeClusters,omitempty"`
+	GKENamespaces          []string `json:"gkeNamespaces,omitempty"`
 	Claims                 *Claims  `json:"claims,omitempty"`
 	Options                *Options `json:"options,omitempty"`
 	config                 *gcpConfig
 	keyStore               *keyStore
+	gkeKeyStores           map[string]*keyStore
 	ctl                    *Controller
+	sanTemplates           []*template.Template
 }
 
 // GetID returns the provisioner unique identifier. The name should uniquely
@@ -114,7 +142,8 @@ func (p *GCP) GetIDForToken() string {
 
 // GetTokenID returns the identifier of the token. The default value for GCP the
 // SHA256 of "provisioner_id.instance_id", but if DisableTrustOnFirstUse is set
-// to true, then it will be the SHA256 of the token.
+// to true, or the token is a GKE token, then it will be the SHA256 of the
+// token.
 func (p *GCP) GetTokenID(token string) (string, error) {
 	jwt, err := jose.ParseSigned(token)
 	if err != nil {
@@ -132,13 +161,14 @@ func (p *GCP) GetTokenID(token string) (string, error) {
 	if err = jwt.UnsafeClaimsWithoutVerification(&claims); err != nil {
 		return "", errors.Wrap(err, "error verifying claims")
 	}
+	if isGKEIssuer(claims.Issuer) {
+		return getGKETokenID(token), nil
+	}
 
 	// Create unique ID for Trust On First Use (TOFU). Only the first instance
 	// per provisioner is allowed as we don't have a way to trust the given
 	// sans.
-	unique := fmt.Sprintf("%s.%s", p.GetIDForToken(), claims.Google.ComputeEngine.InstanceID)
-	sum := sha256.Sum256([]byte(unique))
-	return strings.ToLower(hex.EncodeToString(sum[:])), nil
+	return p.GetTOFUTokenID(claims.Google.ComputeEngine.InstanceID), nil
 }
 
 // GetName returns the name of the provisioner.
@@ -156,6 +186,11 @@ func (p *GCP) GetEncryptedKey() (kid, key string, ok bool) {
 	return "", "", false
 }
 
+// GetOptions returns the configured provisioner options.
+func (p *GCP) GetOptions() *Options {
+	return p.Options
+}
+
 // GetIdentityURL returns the url that generates the GCP token.
 func (p *GCP) GetIdentityURL(audience string) string {
 	// Initialize config if required
@@ -206,6 +241,16 @@ func (p *GCP) Init(config Config) (err error) {
 		return errors.New("provisioner name cannot be empty")
 	case p.InstanceAge.Value() < 0:
 		return errors.New("provisioner instanceAge cannot be negative")
+	case p.EnableSSHUserCerts && len(p.SSHUserServiceAccounts) == 0:
+		return errors.New("provisioner sshUserServiceAccounts cannot be empty if enableSSHUserCerts is true")
+	case len(p.GKENamespaces) > 0 && len(p.GKEClusters) == 0:
+		return errors.New("provisioner gkeClusters cannot be empty if gkeNamespaces is set")
+	}
+	if err = p.validateGKEClusters(); err != nil {
+		return
+	}
+	if p.sanTemplates, err = parseSANTemplates(p.SANTemplates, p.DisableCustomSANs); err != nil {
+		return
 	}
 
 	// Initialize config
@@ -215,8 +260,12 @@ func (p *GCP) Init(config Config) (err error) {
 	if p.keyStore, err = newKeyStore(p.config.CertsURL); err != nil {
 		return
 	}
+	if err = p.initGKEKeyStores(); err != nil {
+		return
+	}
 
 	config.Audiences = config.Audiences.WithFragment(p.GetIDForToken())
+	p.Options = mergeOptions(p.Options, config.DefaultOptions, p.GetType())
 	p.ctl, err = NewController(p, p.Claims, config, p.Options)
 	return
 }
@@ -228,6 +277,9 @@ func (p *GCP) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "gcp.AuthorizeSign")
 	}
+	if claims.gke != nil {
+		return p.authorizeGKESign(ctx, token, claims.gke)
+	}
 
 	ce := claims.Google.ComputeEngine
 
@@ -242,9 +294,21 @@ func (p *GCP) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 	// By default we we'll accept the CN and SANs in the CSR.
 	// There's no way to trust them other than TOFU.
 	var so []SignOption
-	if p.DisableCustomSANs {
-		dnsName1 := fmt.Sprintf("%s.c.%s.internal", ce.InstanceName, ce.ProjectID)
-		dnsName2 := fmt.Sprintf("%s.%s.c.%s.internal", ce.InstanceName, ce.Zone, ce.ProjectID)
+	switch {
+	case p.DisableCustomSANs && len(p.SANTemplates) > 0:
+		sans, err := renderSANTemplates(p.sanTemplates, p.sanTemplateData(ce))
+		if err != nil {
+			return nil, errs.Wrap(http.StatusUnauthorized, err, "gcp.AuthorizeSign; invalid gcp token")
+		}
+		so = append(so,
+			commonNameSliceValidator(append([]string{ce.InstanceName, ce.InstanceID}, sans...)),
+			newDefaultSANsValidator(ctx, sans),
+		)
+
+		// Template SANs
+		data.SetSANs(sans)
+	case p.DisableCustomSANs:
+		dnsName1, dnsName2 := gcpPrivateDNSNames(ce)
 		so = append(so,
 			commonNameSliceValidator([]string{
 				ce.InstanceName, ce.InstanceID, dnsName1, dnsName2,
@@ -284,6 +348,25 @@ func (p *GCP) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 	), nil
 }
 
+// sanTemplateData returns the data available in the SANTemplates, the
+// Compute Engine claims and the default global and zonal private DNS names of
+// the instance.
+func (p *GCP) sanTemplateData(ce gcpComputeEnginePayload) map[string]interface{} {
+	dnsName, zonalDNSName := gcpPrivateDNSNames(ce)
+	return map[string]interface{}{
+		"GCP":             ce,
+		"PrivateDNS":      dnsName,
+		"ZonalPrivateDNS": zonalDNSName,
+	}
+}
+
+// gcpPrivateDNSNames returns the default global and zonal private DNS names of
+// an instance.
+func gcpPrivateDNSNames(ce gcpComputeEnginePayload) (string, string) {
+	return fmt.Sprintf("%s.c.%s.internal", ce.InstanceName, ce.ProjectID),
+		fmt.Sprintf("%s.%s.c.%s.internal", ce.InstanceName, ce.Zone, ce.ProjectID)
+}
+
 // AuthorizeRenew returns an error if the renewal is disabled.
 func (p *GCP) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) error {
 	return p.ctl.AuthorizeRenew(ctx, cert)
@@ -308,6 +391,16 @@ func (p *GCP) authorizeToken(token string) (*gcpPayload, error) {
 		return nil, errs.Unauthorized("gcp.authorizeToken; error parsing gcp token - header is missing")
 	}
 
+	// GKE tokens are signed by the cluster.
+	var unsafeClaims jose.Claims
+	if err := jwt.UnsafeClaimsWithoutVerification(&unsafeClaims); err == nil && isGKEIssuer(unsafeClaims.Issuer) {
+		gke, err := p.authorizeGKEToken(jwt, unsafeClaims.Issuer)
+		if err != nil {
+			return nil, err
+		}
+		return &gcpPayload{Claims: gke.Claims, gke: gke}, nil
+	}
+
 	var found bool
 	var claims gcpPayload
 	kid := jwt.Headers[0].KeyID
@@ -387,7 +480,7 @@ func (p *GCP) authorizeToken(token string) (*gcpPayload, error) {
 }
 
 // AuthorizeSSHSign returns the list of SignOption for a SignSSH request.
-func (p *GCP) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, error) {
+func (p *GCP) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption, error) {
 	if !p.ctl.Claimer.IsSSHCAEnabled() {
 		return nil, errs.Unauthorized("gcp.AuthorizeSSHSign; sshCA is disabled for gcp provisioner '%s'", p.GetName())
 	}
@@ -395,6 +488,9 @@ func (p *GCP) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, e
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "gcp.AuthorizeSSHSign")
 	}
+	if claims.gke != nil {
+		return nil, errs.Unauthorized("gcp.AuthorizeSSHSign; gke tokens cannot be used to sign SSH certificates")
+	}
 
 	ce := claims.Google.ComputeEngine
 	signOptions := []SignOption{}
@@ -405,9 +501,12 @@ func (p *GCP) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, e
 	}
 
 	// Validated principals.
-	principals := []string{
-		fmt.Sprintf("%s.c.%s.internal", ce.InstanceName, ce.ProjectID),
-		fmt.Sprintf("%s.%s.c.%s.internal", ce.InstanceName, ce.Zone, ce.ProjectID),
+	dnsName1, dnsName2 := gcpPrivateDNSNames(ce)
+	principals := []string{dnsName1, dnsName2}
+	if len(p.SANTemplates) > 0 {
+		if principals, err = renderSANTemplates(p.sanTemplates, p.sanTemplateData(ce)); err != nil {
+			return nil, errs.Wrap(http.StatusUnauthorized, err, "gcp.AuthorizeSSHSign; invalid gcp token")
+		}
 	}
 
 	// Only enforce known principals if disable custom sans is true.
@@ -425,17 +524,51 @@ func (p *GCP) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, e
 	if v, err := unsafeParseSigned(token); err == nil {
 		data.SetToken(v)
 	}
+	audit := newSSHAuditMetadata(ctx, p, ce.InstanceName, data)
 
 	templateOptions, err := CustomSSHTemplateOptions(p.Options, data, sshutil.DefaultIIDTemplate)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "gcp.AuthorizeSSHSign")
 	}
+
+	// Validate user SignSSHOptions.
+	var optionsValidator SSHCertOptionsValidator = sshCertOptionsValidator(defaults)
+
+	// Allow user certificates for the configured service accounts. The
+	// certificate type in the request selects the principals and template
+	// data used.
+	if p.isSSHUserServiceAccount(claims) {
+		userPrincipals := []string{SanitizeSSHUserPrincipal(claims.Email), claims.Email}
+		hostOptions, hostValidator := templateOptions, optionsValidator
+		templateOptions = sshCertificateOptionsFunc(func(so SignSSHOptions) []sshutil.Option {
+			if so.CertType == SSHUserCert {
+				data.SetType(sshutil.UserCert)
+				data.SetKeyID(claims.Email)
+				data.SetPrincipals(userPrincipals)
+				data.SetExtensions(sshutil.DefaultExtensions(sshutil.UserCert))
+				audit.Identity = claims.Email
+			}
+			return hostOptions.Options(so)
+		})
+		optionsValidator = &sshCertTypeOptionsValidator{
+			host: hostValidator,
+			user: sshCertOptionsValidator(SignSSHOptions{
+				CertType:   SSHUserCert,
+				Principals: userPrincipals,
+			}),
+		}
+	}
 	signOptions = append(signOptions, templateOptions)
 
+	// Restrict the addresses from which the user certificates can be used.
+	if m := newSSHSourceAddressModifier(ctx, p.Options.GetSSHOptions()); m != nil {
+		signOptions = append(signOptions, m)
+	}
+
 	return append(signOptions,
 		p,
-		// Validate user SignSSHOptions.
-		sshCertOptionsValidator(defaults),
+		audit,
+		optionsValidator,
 		// Set the validity bounds if not set.
 		&sshDefaultDuration{p.ctl.Claimer},
 		// Validate public key
@@ -445,7 +578,7 @@ func (p *GCP) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, e
 		// Require all the fields in the SSH certificate
 		&sshCertDefaultValidator{},
 		// Ensure that all principal names are allowed
-		newSSHNamePolicyValidator(p.ctl.getPolicy().getSSHHost(), nil),
+		newSSHNamePolicyValidator(p.ctl.getPolicy().getSSHHost(), p.ctl.getPolicy().getSSHUser()),
 		// Call webhooks
 		p.ctl.newWebhookController(
 			data,
@@ -454,3 +587,33 @@ func (p *GCP) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, e
 		),
 	), nil
 }
+
+// isSSHUserServiceAccount returns true if SSH user certificates are enabled and
+// the token was issued for one of the configured service accounts.
+func (p *GCP) isSSHUserServiceAccount(claims *gcpPayload) bool {
+	if !p.EnableSSHUserCerts || claims.Email == "" || !claims.EmailVerified {
+		return false
+	}
+	for _, sa := range p.SSHUserServiceAccounts {
+		if sa == claims.Email {
+			return true
+		}
+	}
+	return false
+}
+
+// sshCertTypeOptionsValidator validates the SignSSHOptions with the validator
+// of the requested certificate type. Requests without a certificate type are
+// validated as host certificates.
+type sshCertTypeOptionsValidator struct {
+	host SSHCertOptionsValidator
+	user SSHCertOptionsValidator
+}
+
+// Valid implements SSHCertOptionsValidator.
+func (v *sshCertTypeOptionsValidator) Valid(got SignSSHOptions) error {
+	if got.CertType == SSHUserCert {
+		return v.user.Valid(got)
+	}
+	return v.host.Valid(got)
+}
@@ -0,0 +1,219 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/x509util"
+	"go.step.sm/linkedca"
+
+	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/certificates/webhook"
+)
+
+// gkeIssuerPrefix is the prefix of the issuer of the service account tokens
+// of a GKE cluster, the issuer is the prefix followed by the cluster, e.g.
+// https://container.googleapis.com/v1/projects/my-project/locations/us-central1/clusters/my-cluster.
+const gkeIssuerPrefix = "https://container.googleapis.com/v1/"
+
+// gkeClusterRegExp is the regular expression used to parse a GKE cluster in
+// the format projects/<project>/locations/<location>/clusters/<name>.
+var gkeClusterRegExp = regexp.MustCompile(`^projects/([^/]+)/locations/([^/]+)/clusters/([^/]+)$`)
+
+// GKETemplateDataKey is the key used in the certificate templates to access
+// the Kubernetes workload of a GKE token, e.g. {{ .GKE.Namespace }}.
+const GKETemplateDataKey = "GKE"
+
+// GKETemplateData is the information of the Kubernetes workload of a GKE
+// workload identity token available in the X.509 certificate templates.
+type GKETemplateData struct {
+	// ProjectID is the project of the cluster.
+	ProjectID string `json:"projectID"`
+	// Location is the region or zone of the cluster.
+	Location string `json:"location"`
+	// Cluster is the name of the cluster.
+	Cluster string `json:"cluster"`
+	// Namespace is the namespace of the service account.
+	Namespace string `json:"namespace"`
+	// ServiceAccount is the name of the service account.
+	ServiceAccount string `json:"serviceAccount"`
+	// ServiceAccountUID is the uid of the service account.
+	ServiceAccountUID string `json:"serviceAccountUID"`
+	// PodName is the name of the pod the token is bound to, if any.
+	PodName string `json:"podName,omitempty"`
+	// PodUID is the uid of the pod the token is bound to, if any.
+	PodUID string `json:"podUID,omitempty"`
+}
+
+// gkePayload represents the claims of a service account token issued by a GKE
+// cluster.
+type gkePayload struct {
+	k8sBoundSAPayload
+	// data is the parsed cluster and workload of the token.
+	data GKETemplateData
+}
+
+// isGKEIssuer returns true if the issuer is the issuer of a GKE cluster.
+func isGKEIssuer(issuer string) bool {
+	return strings.HasPrefix(issuer, gkeIssuerPrefix)
+}
+
+// validateGKEClusters returns an error if the configured GKE clusters are not
+// in the format projects/<project>/locations/<location>/clusters/<name>.
+func (p *GCP) validateGKEClusters() error {
+	for _, c := range p.GKEClusters {
+		if !gkeClusterRegExp.MatchString(c) {
+			return errors.Errorf("provisioner gkeClusters contains an invalid cluster %q", c)
+		}
+	}
+	return nil
+}
+
+// initGKEKeyStores initializes the key stores with the keys used by the
+// configured GKE clusters to sign the service account tokens.
+func (p *GCP) initGKEKeyStores() error {
+	p.gkeKeyStores = make(map[string]*keyStore, len(p.GKEClusters))
+	for _, c := range p.GKEClusters {
+		ks, err := newKeyStore(gkeIssuerPrefix + c + "/jwks")
+		if err != nil {
+			return errors.Wrapf(err, "error getting the keys of the GKE cluster %s", c)
+		}
+		p.gkeKeyStores[c] = ks
+	}
+	return nil
+}
+
+// authorizeGKEToken validates a service account token issued by one of the
+// configured GKE clusters and returns its claims. The token is bound to the
+// Kubernetes service account, the GCP service accounts and instance
+// restrictions do not apply to it.
+func (p *GCP) authorizeGKEToken(jwt *jose.JSONWebToken, issuer string) (*gkePayload, error) {
+	cluster := strings.TrimPrefix(issuer, gkeIssuerPrefix)
+	ks, ok := p.gkeKeyStores[cluster]
+	if !ok {
+		return nil, errs.Unauthorized("gcp.authorizeToken; gke cluster %s is not allowed", cluster)
+	}
+
+	var found bool
+	var claims gkePayload
+	kid := jwt.Headers[0].KeyID
+	for _, key := range ks.Get(kid) {
+		if err := jwt.Claims(key.Public(), &claims.k8sBoundSAPayload); err == nil {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, errs.Unauthorized("gcp.authorizeToken; failed to validate gke token payload - cannot find key for kid %s", kid)
+	}
+
+	// According to "rfc7519 JSON Web Token" acceptable skew should be no
+	// more than a few minutes.
+	if err := claims.ValidateWithLeeway(jose.Expected{
+		Issuer: issuer,
+		Time:   time.Now().UTC(),
+	}, time.Minute); err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "gcp.authorizeToken; invalid gke token payload")
+	}
+	if claims.Expiry == nil {
+		return nil, errs.Unauthorized("gcp.authorizeToken; gke token must contain an exp claim")
+	}
+
+	// validate audiences with the defaults
+	if !matchesAudience(claims.Audience, p.ctl.Audiences.Sign) {
+		return nil, errs.Unauthorized("gcp.authorizeToken; invalid gke token - invalid audience claim (aud)")
+	}
+
+	// Service account tokens always contain the namespace and service account.
+	k := claims.Kubernetes
+	if k.Namespace == "" || k.ServiceAccount.Name == "" || claims.Subject != claims.serviceAccountUsername() {
+		return nil, errs.Unauthorized("gcp.authorizeToken; gke token is not a service account token")
+	}
+
+	// validate namespaces
+	if len(p.GKENamespaces) > 0 && !slices.Contains(p.GKENamespaces, k.Namespace) {
+		return nil, errs.Unauthorized("gcp.authorizeToken; invalid gke token - namespace %q is not allowed", k.Namespace)
+	}
+
+	// validate projects
+	re := gkeClusterRegExp.FindStringSubmatch(cluster)
+	if len(re) != 4 {
+		return nil, errs.Unauthorized("gcp.authorizeToken; invalid gke token - invalid cluster %s", cluster)
+	}
+	if len(p.ProjectIDs) > 0 && !slices.Contains(p.ProjectIDs, re[1]) {
+		return nil, errs.Unauthorized("gcp.authorizeToken; invalid gke token - invalid project id")
+	}
+
+	claims.data = GKETemplateData{
+		ProjectID:         re[1],
+		Location:          re[2],
+		Cluster:           re[3],
+		Namespace:         k.Namespace,
+		ServiceAccount:    k.ServiceAccount.Name,
+		ServiceAccountUID: k.ServiceAccount.UID,
+	}
+	if k.Pod != nil {
+		claims.data.PodName = k.Pod.Name
+		claims.data.PodUID = k.Pod.UID
+	}
+
+	return &claims, nil
+}
+
+// getGKETokenID returns the SHA256 of a GKE token. Service account tokens
+// are not bound to an instance, so each token can only be used once.
+func getGKETokenID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return strings.ToLower(hex.EncodeToString(sum[:]))
+}
+
+// authorizeGKESign returns the sign options for a GKE token. The certificates
+// are bound to the Kubernetes service account, like the certificates of the
+// K8sBoundSA provisioner they contain the DNS names <name>.<namespace>.svc and
+// <name>.<namespace>.svc.cluster.local.
+func (p *GCP) authorizeGKESign(ctx context.Context, token string, claims *gkePayload) ([]SignOption, error) {
+	name, namespace := claims.data.ServiceAccount, claims.data.Namespace
+	sans := []string{
+		fmt.Sprintf("%s.%s.svc", name, namespace),
+		fmt.Sprintf("%s.%s.svc.%s", name, namespace, K8sBoundSADefaultClusterDomain),
+	}
+
+	// Template options
+	data := x509util.CreateTemplateData(name, sans)
+	if v, err := unsafeParseSigned(token); err == nil {
+		data.SetToken(v)
+	}
+	data.Set(GKETemplateDataKey, claims.data)
+
+	templateOptions, err := TemplateOptions(p.Options, data)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "gcp.AuthorizeSign")
+	}
+
+	return []SignOption{
+		p,
+		templateOptions,
+		// modifiers / withOptions
+		newProvisionerExtensionOption(TypeGCP, p.Name, claims.Subject, "Cluster", strings.TrimPrefix(claims.Issuer, gkeIssuerPrefix)).WithControllerOptions(p.ctl),
+		profileDefaultDuration(p.ctl.Claimer.DefaultTLSCertDuration()),
+		// validators
+		newDefaultSANsValidator(ctx, sans),
+		defaultPublicKeyValidator{},
+		newValidityValidator(p.ctl.Claimer.MinTLSCertDuration(), p.ctl.Claimer.MaxTLSCertDuration()),
+		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
+		p.ctl.newWebhookController(
+			data,
+			linkedca.Webhook_X509,
+			webhook.WithAuthorizationPrincipal(claims.Subject),
+		),
+	}, nil
+}
@@ -0,0 +1,147 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+)
+
+func generateGKEToken(t *testing.T, jwk *jose.JSONWebKey, iss, aud, namespace, name string) string {
+	t.Helper()
+	sig, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.ES256, Key: jwk.Key},
+		new(jose.SignerOptions).WithType("JWT").WithHeader("kid", jwk.KeyID),
+	)
+	require.NoError(t, err)
+
+	now := time.Now()
+	var claims k8sBoundSAPayload
+	claims.Claims = jose.Claims{
+		Subject:   "system:serviceaccount:" + namespace + ":" + name,
+		Issuer:    iss,
+		Audience:  []string{aud},
+		IssuedAt:  jose.NewNumericDate(now),
+		NotBefore: jose.NewNumericDate(now),
+		Expiry:    jose.NewNumericDate(now.Add(5 * time.Minute)),
+	}
+	claims.Kubernetes.Namespace = namespace
+	claims.Kubernetes.ServiceAccount.Name = name
+	claims.Kubernetes.ServiceAccount.UID = "the-sa-uid"
+	claims.Kubernetes.Pod = &struct {
+		Name string `json:"name"`
+		UID  string `json:"uid"`
+	}{"my-pod", "the-pod-uid"}
+	tok, err := jose.Signed(sig).Claims(claims).CompactSerialize()
+	require.NoError(t, err)
+	return tok
+}
+
+func TestGCP_Init_gkeClusters(t *testing.T) {
+	config := Config{
+		Claims:    globalProvisionerClaims,
+		Audiences: testAudiences,
+	}
+	p := &GCP{Type: "GCP", Name: "gcp", GKEClusters: []string{"my-cluster"}}
+	assert.EqualError(t, p.Init(config), `provisioner gkeClusters contains an invalid cluster "my-cluster"`)
+
+	p = &GCP{Type: "GCP", Name: "gcp", GKENamespaces: []string{"default"}}
+	assert.EqualError(t, p.Init(config), "provisioner gkeClusters cannot be empty if gkeNamespaces is set")
+}
+
+func TestGCP_authorizeToken_gke(t *testing.T) {
+	p, err := generateGCP()
+	require.NoError(t, err)
+	jwk, err := generateJSONWebKey()
+	require.NoError(t, err)
+
+	cluster := "projects/my-project/locations/us-central1/clusters/my-cluster"
+	p.GKEClusters = []string{cluster}
+	p.gkeKeyStores = map[string]*keyStore{
+		cluster: {
+			keySet: jose.JSONWebKeySet{Keys: []jose.JSONWebKey{*jwk}},
+			expiry: time.Now().Add(24 * time.Hour),
+		},
+	}
+
+	iss := gkeIssuerPrefix + cluster
+	aud := p.ctl.Audiences.Sign[0]
+	otherKey, err := generateJSONWebKey()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		token      string
+		namespaces []string
+		projectIDs []string
+		wantErr    bool
+	}{
+		{"ok", generateGKEToken(t, jwk, iss, aud, "default", "my-sa"), nil, nil, false},
+		{"ok allowed", generateGKEToken(t, jwk, iss, aud, "default", "my-sa"), []string{"default"}, []string{"my-project"}, false},
+		{"fail cluster", generateGKEToken(t, jwk, gkeIssuerPrefix+"projects/my-project/locations/us-central1/clusters/other", aud, "default", "my-sa"), nil, nil, true},
+		{"fail key", generateGKEToken(t, otherKey, iss, aud, "default", "my-sa"), nil, nil, true},
+		{"fail audience", generateGKEToken(t, jwk, iss, "https://ca.example.com/1.0/sign", "default", "my-sa"), nil, nil, true},
+		{"fail service account", generateGKEToken(t, jwk, iss, aud, "", "my-sa"), nil, nil, true},
+		{"fail namespace", generateGKEToken(t, jwk, iss, aud, "default", "my-sa"), []string{"kube-system"}, nil, true},
+		{"fail project", generateGKEToken(t, jwk, iss, aud, "default", "my-sa"), nil, []string{"other-project"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p.GKENamespaces = tt.namespaces
+			p.ProjectIDs = tt.projectIDs
+
+			claims, err := p.authorizeToken(tt.token)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.NotNil(t, claims.gke)
+			assert.Equal(t, GKETemplateData{
+				ProjectID:         "my-project",
+				Location:          "us-central1",
+				Cluster:           "my-cluster",
+				Namespace:         "default",
+				ServiceAccount:    "my-sa",
+				ServiceAccountUID: "the-sa-uid",
+				PodName:           "my-pod",
+				PodUID:            "the-pod-uid",
+			}, claims.gke.data)
+
+			id, err := p.GetTokenID(tt.token)
+			require.NoError(t, err)
+			assert.Equal(t, getGKETokenID(tt.token), id)
+
+			opts, err := p.AuthorizeSign(context.Background(), tt.token)
+			require.NoError(t, err)
+			sansValidator := findGKEDefaultSANsValidator(t, opts)
+			assert.NoError(t, sansValidator.Valid(&x509.CertificateRequest{
+				Subject:  pkix.Name{CommonName: "my-sa"},
+				DNSNames: []string{"my-sa.default.svc", "my-sa.default.svc.cluster.local"},
+			}))
+			assert.Error(t, sansValidator.Valid(&x509.CertificateRequest{
+				Subject:  pkix.Name{CommonName: "my-sa"},
+				DNSNames: []string{"other.default.svc"},
+			}))
+
+			_, err = p.AuthorizeSSHSign(context.Background(), tt.token)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func findGKEDefaultSANsValidator(t *testing.T, opts []SignOption) CertificateRequestValidator {
+	t.Helper()
+	for _, o := range opts {
+		if v, ok := o.(*defaultSANsValidator); ok {
+			return v
+		}
+	}
+	t.Fatal("defaultSANsValidator not found")
+	return nil
+}
@@ -215,6 +215,28 @@ func TestGCP_Init(t *testing.T) {
 	}
 }
 
+func TestGCP_Init_sshUserCerts(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+
+	p := &GCP{
+		Type:               "GCP",
+		Name:               "name",
+		EnableSSHUserCerts: true,
+		config: &gcpConfig{
+			CertsURL:    srv.URL,
+			IdentityURL: gcpIdentityURL,
+		},
+	}
+	err := p.Init(Config{Claims: globalProvisionerClaims})
+	if assert.NotNil(t, err) {
+		assert.Equals(t, "provisioner sshUserServiceAccounts cannot be empty if enableSSHUserCerts is true", err.Error())
+	}
+
+	p.SSHUserServiceAccounts = []string{"foo@developer.gserviceaccount.com"}
+	assert.FatalError(t, p.Init(Config{Claims: globalProvisionerClaims}))
+}
+
 func TestGCP_authorizeToken(t *testing.T) {
 	type test struct {
 		p     *GCP
@@ -605,12 +627,36 @@ func TestGCP_AuthorizeSSHSign(t *testing.T) {
 	p3.ctl.Claimer, err = NewClaimer(p3.Claims, globalProvisionerClaims)
 	assert.FatalError(t, err)
 
+	p4, err := generateGCP()
+	assert.FatalError(t, err)
+	p4.DisableCustomSANs = true
+	p4.EnableSSHUserCerts = true
+	p4.SSHUserServiceAccounts = []string{"foo@developer.gserviceaccount.com"}
+
+	p5, err := generateGCP()
+	assert.FatalError(t, err)
+	p5.DisableCustomSANs = true
+	p5.EnableSSHUserCerts = true
+	p5.SSHUserServiceAccounts = []string{"bar@developer.gserviceaccount.com"}
+
 	t1, err := generateGCPToken(p1.ServiceAccounts[0],
 		"https://accounts.google.com", p1.GetID(),
 		"instance-id", "instance-name", "project-id", "zone",
 		time.Now(), &p1.keyStore.keySet.Keys[0])
 	assert.FatalError(t, err)
 
+	t4, err := generateGCPToken(p4.ServiceAccounts[0],
+		"https://accounts.google.com", p4.GetID(),
+		"instance-id", "instance-name", "project-id", "zone",
+		time.Now(), &p4.keyStore.keySet.Keys[0])
+	assert.FatalError(t, err)
+
+	t5, err := generateGCPToken(p5.ServiceAccounts[0],
+		"https://accounts.google.com", p5.GetID(),
+		"instance-id", "instance-name", "project-id", "zone",
+		time.Now(), &p5.keyStore.keySet.Keys[0])
+	assert.FatalError(t, err)
+
 	t2, err := generateGCPToken(p2.ServiceAccounts[0],
 		"https://accounts.google.com", p2.GetID(),
 		"instance-id", "instance-name", "project-id", "zone",
@@ -647,6 +693,15 @@ func TestGCP_AuthorizeSSHSign(t *testing.T) {
 		CertType: "host", Principals: []string{"foo.bar", "bar.foo"},
 		ValidAfter: NewTimeDuration(tm), ValidBefore: NewTimeDuration(tm.Add(hostDuration)),
 	}
+	userDuration := p4.ctl.Claimer.DefaultUserSSHCertDuration()
+	expectedUserOptions := &SignSSHOptions{
+		CertType: "user", Principals: []string{"foo", "foo@developer.gserviceaccount.com"},
+		ValidAfter: NewTimeDuration(tm), ValidBefore: NewTimeDuration(tm.Add(userDuration)),
+	}
+	expectedUserOptionsPrincipal := &SignSSHOptions{
+		CertType: "user", Principals: []string{"foo"},
+		ValidAfter: NewTimeDuration(tm), ValidBefore: NewTimeDuration(tm.Add(userDuration)),
+	}
 
 	type args struct {
 		token   string
@@ -670,7 +725,13 @@ func TestGCP_AuthorizeSSHSign(t *testing.T) {
 		{"ok-principal2", p1, args{t1, SignSSHOptions{Principals: []string{"instance-name.zone.c.project-id.internal"}}, pub}, expectedHostOptionsPrincipal2, http.StatusOK, false, false},
 		{"ok-options", p1, args{t1, SignSSHOptions{CertType: "host", Principals: []string{"instance-name.c.project-id.internal", "instance-name.zone.c.project-id.internal"}}, pub}, expectedHostOptions, http.StatusOK, false, false},
 		{"ok-custom", p2, args{t2, SignSSHOptions{Principals: []string{"foo.bar", "bar.foo"}}, pub}, expectedCustomOptions, http.StatusOK, false, false},
+		{"ok-user", p4, args{t4, SignSSHOptions{CertType: "user"}, pub}, expectedUserOptions, http.StatusOK, false, false},
+		{"ok-user-principal", p4, args{t4, SignSSHOptions{CertType: "user", Principals: []string{"foo"}}, pub}, expectedUserOptionsPrincipal, http.StatusOK, false, false},
+		{"ok-user-host", p4, args{t4, SignSSHOptions{}, pub}, expectedHostOptions, http.StatusOK, false, false},
 		{"fail-rsa1024", p1, args{t1, SignSSHOptions{}, rsa1024.Public()}, expectedHostOptions, http.StatusOK, false, true},
+		{"fail-user-principal", p4, args{t4, SignSSHOptions{CertType: "user", Principals: []string{"root"}}, pub}, nil, http.StatusOK, false, true},
+		{"fail-user-host-principal", p4, args{t4, SignSSHOptions{CertType: "host", Principals: []string{"foo"}}, pub}, nil, http.StatusOK, false, true},
+		{"fail-user-service-account", p5, args{t5, SignSSHOptions{CertType: "user"}, pub}, nil, http.StatusOK, false, true},
 		{"fail-type", p1, args{t1, SignSSHOptions{CertType: "user"}, pub}, nil, http.StatusOK, false, true},
 		{"fail-principal", p1, args{t1, SignSSHOptions{Principals: []string{"smallstep.com"}}, pub}, nil, http.StatusOK, false, true},
 		{"fail-extra-principal", p1, args{t1, SignSSHOptions{Principals: []string{"instance-name.c.project-id.internal", "instance-name.zone.c.project-id.internal", "smallstep.com"}}, pub}, nil, http.StatusOK, false, true},
@@ -749,3 +810,34 @@ func TestGCP_AuthorizeRenew(t *testing.T) {
 		})
 	}
 }
+
+func TestGCP_AuthorizeSign_sanTemplates(t *testing.T) {
+	p, err := generateGCP()
+	assert.FatalError(t, err)
+	p.DisableCustomSANs = true
+	p.SANTemplates = []string{"{{ .GCP.InstanceName }}.{{ .GCP.Zone }}.example.com", "{{ .ZonalPrivateDNS }}"}
+	p.sanTemplates, err = parseSANTemplates(p.SANTemplates, p.DisableCustomSANs)
+	assert.FatalError(t, err)
+
+	token, err := generateGCPToken(p.ServiceAccounts[0],
+		"https://accounts.google.com", p.GetID(),
+		"instance-id", "instance-name", "project-id", "zone",
+		time.Now(), &p.keyStore.keySet.Keys[0])
+	assert.FatalError(t, err)
+
+	opts, err := p.AuthorizeSign(context.Background(), token)
+	assert.FatalError(t, err)
+	v := findGKEDefaultSANsValidator(t, opts)
+	assert.NoError(t, v.Valid(&x509.CertificateRequest{
+		DNSNames: []string{"instance-name.zone.example.com", "instance-name.zone.c.project-id.internal"},
+	}))
+	assert.Error(t, v.Valid(&x509.CertificateRequest{
+		DNSNames: []string{"instance-name.c.project-id.internal"},
+	}))
+
+	p.SANTemplates = []string{"{{ .GCP.Foo }}.example.com"}
+	p.sanTemplates, err = parseSANTemplates(p.SANTemplates, p.DisableCustomSANs)
+	assert.FatalError(t, err)
+	_, err = p.AuthorizeSign(context.Background(), token)
+	assert.Error(t, err)
+}
@@ -0,0 +1,354 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/x509util"
+	"go.step.sm/linkedca"
+
+	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/certificates/webhook"
+)
+
+const (
+	// GitHubActionsDefaultIssuer is the issuer of the GitHub Actions OIDC
+	// tokens.
+	GitHubActionsDefaultIssuer = "https://token.actions.githubusercontent.com"
+	// GitHubActionsDefaultServerURL is the default URL of the GitHub server
+	// used in the URI SAN of the certificates.
+	GitHubActionsDefaultServerURL = "https://github.com"
+)
+
+// GitHubActionsTemplateDataKey is the key used in the certificate templates to
+// access the claims of a GitHub Actions token, e.g. {{ .GitHub.Repository }}.
+const GitHubActionsTemplateDataKey = "GitHub"
+
+// GitHubActionsTemplateData is the information of the workflow run of a GitHub
+// Actions token available in the X.509 certificate templates.
+type GitHubActionsTemplateData struct {
+	Repository      string `json:"repository"`
+	RepositoryOwner string `json:"repositoryOwner"`
+	RepositoryID    string `json:"repositoryID"`
+	Ref             string `json:"ref"`
+	RefType         string `json:"refType"`
+	SHA             string `json:"sha"`
+	Environment     string `json:"environment,omitempty"`
+	Workflow        string `json:"workflow"`
+	WorkflowRef     string `json:"workflowRef"`
+	JobWorkflowRef  string `json:"jobWorkflowRef"`
+	RunID           string `json:"runID"`
+	RunAttempt      string `json:"runAttempt"`
+	Actor           string `json:"actor"`
+	EventName       string `json:"eventName"`
+}
+
+// gitHubActionsPayload represents the claims of a GitHub Actions OIDC token.
+type gitHubActionsPayload struct {
+	jose.Claims
+	Repository      string `json:"repository"`
+	RepositoryOwner string `json:"repository_owner"`
+	RepositoryID    string `json:"repository_id"`
+	Ref             string `json:"ref"`
+	RefType         string `json:"ref_type"`
+	SHA             string `json:"sha"`
+	Environment     string `json:"environment"`
+	Workflow        string `json:"workflow"`
+	WorkflowRef     string `json:"workflow_ref"`
+	JobWorkflowRef  string `json:"job_workflow_ref"`
+	RunID           string `json:"run_id"`
+	RunAttempt      string `json:"run_attempt"`
+	Actor           string `json:"actor"`
+	EventName       string `json:"event_name"`
+}
+
+func (c *gitHubActionsPayload) templateData() GitHubActionsTemplateData {
+	return GitHubActionsTemplateData{
+		Repository:      c.Repository,
+		RepositoryOwner: c.RepositoryOwner,
+		RepositoryID:    c.RepositoryID,
+		Ref:             c.Ref,
+		RefType:         c.RefType,
+		SHA:             c.SHA,
+		Environment:     c.Environment,
+		Workflow:        c.Workflow,
+		WorkflowRef:     c.WorkflowRef,
+		JobWorkflowRef:  c.JobWorkflowRef,
+		RunID:           c.RunID,
+		RunAttempt:      c.RunAttempt,
+		Actor:           c.Actor,
+		EventName:       c.EventName,
+	}
+}
+
+// GitHubActions represents a provisioner that validates the OIDC tokens of
+// GitHub Actions workflows, so CI jobs can get short-lived certificates without
+// long-lived secrets.
+//
+// The tokens must have as audience the sign audience of the CA with the
+// provisioner id as a fragment, e.g.
+// https://ca.example.com/1.0/sign#github/my-provisioner.
+//
+// Repositories, Refs, Environments and Workflows are allow lists of the
+// repository, ref, environment and job_workflow_ref claims of the tokens. They
+// support "*" as a wildcard for any sequence of characters, e.g. "my-org/*" or
+// "refs/tags/v*". Repositories is required.
+//
+// The certificates have the repository as the common name and the URI
+// <serverURL>/<job_workflow_ref> as a SAN.
+type GitHubActions struct {
+	*base
+	ID   string `json:"-"`
+	Type string `json:"type"`
+	Name string `json:"name"`
+	// Issuer is the issuer of the tokens, by default
+	// https://token.actions.githubusercontent.com.
+	Issuer string `json:"issuer,omitempty"`
+	// ServerURL is the URL of the GitHub server, by default https://github.com.
+	ServerURL    string   `json:"serverURL,omitempty"`
+	Repositories []string `json:"repositories"`
+	Refs         []string `json:"refs,omitempty"`
+	Environments []string `json:"environments,omitempty"`
+	Workflows    []string `json:"workflows,omitempty"`
+	Claims       *Claims  `json:"claims,omitempty"`
+	Options      *Options `json:"options,omitempty"`
+	keyStore     *keyStore
+	ctl          *Controller
+}
+
+// GetID returns the provisioner unique identifier.
+func (p *GitHubActions) GetID() string {
+	if p.ID != "" {
+		return p.ID
+	}
+	return p.GetIDForToken()
+}
+
+// GetIDForToken returns an identifier that will be used to load the provisioner
+// from a token.
+func (p *GitHubActions) GetIDForToken() string {
+	return "github/" + p.Name
+}
+
+// GetTokenID returns the identifier of the token.
+func (p *GitHubActions) GetTokenID(ott string) (string, error) {
+	token, err := jose.ParseSigned(ott)
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing token")
+	}
+	var claims jose.Claims
+	if err = token.UnsafeClaimsWithoutVerification(&claims); err != nil {
+		return "", errors.Wrap(err, "error verifying claims")
+	}
+	return claims.ID, nil
+}
+
+// GetName returns the name of the provisioner.
+func (p *GitHubActions) GetName() string {
+	return p.Name
+}
+
+// GetType returns the type of provisioner.
+func (p *GitHubActions) GetType() Type {
+	return TypeGitHubActions
+}
+
+// GetEncryptedKey is not available in a GitHubActions provisioner.
+func (p *GitHubActions) GetEncryptedKey() (kid, key string, ok bool) {
+	return "", "", false
+}
+
+// GetOptions returns the configured provisioner options.
+func (p *GitHubActions) GetOptions() *Options {
+	return p.Options
+}
+
+func (p *GitHubActions) getIssuer() string {
+	if p.Issuer != "" {
+		return p.Issuer
+	}
+	return GitHubActionsDefaultIssuer
+}
+
+func (p *GitHubActions) getServerURL() string {
+	if p.ServerURL != "" {
+		return strings.TrimSuffix(p.ServerURL, "/")
+	}
+	return GitHubActionsDefaultServerURL
+}
+
+// Init initializes and validates the fields of a GitHubActions type.
+func (p *GitHubActions) Init(config Config) (err error) {
+	switch {
+	case p.Type == "":
+		return errors.New("provisioner type cannot be empty")
+	case p.Name == "":
+		return errors.New("provisioner name cannot be empty")
+	case len(p.Repositories) == 0:
+		return errors.New("provisioner repositories cannot be empty")
+	}
+
+	// Get the keys from the OIDC discovery of the issuer.
+	var conf openIDConfiguration
+	u := strings.TrimSuffix(p.getIssuer(), "/") + "/.well-known/openid-configuration"
+	if err := getAndDecode(u, &conf); err != nil {
+		return err
+	}
+	if err := conf.Validate(); err != nil {
+		return errors.Wrapf(err, "error parsing %s", u)
+	}
+	if conf.Issuer != p.getIssuer() {
+		return errors.Errorf("error parsing %s: issuer %q does not match the provisioner issuer", u, conf.Issuer)
+	}
+	if p.keyStore, err = newKeyStore(conf.JWKSetURI); err != nil {
+		return err
+	}
+
+	config.Audiences = config.Audiences.WithFragment(p.GetIDForToken())
+	p.Options = mergeOptions(p.Options, config.DefaultOptions, p.GetType())
+	p.ctl, err = NewController(p, p.Claims, config, p.Options)
+	return
+}
+
+// matchesAnyPattern returns true if the value matches one of the patterns,
+// or if there are no patterns. A "*" in a pattern matches any sequence of
+// characters.
+func matchesAnyPattern(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if globMatch(pattern, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// globMatch returns true if the value matches the pattern, where "*" matches
+// any sequence of characters.
+func globMatch(pattern, value string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == value
+	}
+	if !strings.HasPrefix(value, parts[0]) {
+		return false
+	}
+	value = value[len(parts[0]):]
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(value, part)
+		if i < 0 {
+			return false
+		}
+		value = value[i+len(part):]
+	}
+	return strings.HasSuffix(value, last)
+}
+
+// authorizeToken validates a GitHub Actions token and returns its claims.
+func (p *GitHubActions) authorizeToken(token string) (*gitHubActionsPayload, error) {
+	jwt, err := jose.ParseSigned(token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err,
+			"github.authorizeToken; error parsing github token")
+	}
+	if len(jwt.Headers) == 0 {
+		return nil, errs.Unauthorized("github.authorizeToken; error parsing github token - header is missing")
+	}
+
+	var found bool
+	var claims gitHubActionsPayload
+	for _, key := range p.keyStore.Get(jwt.Headers[0].KeyID) {
+		if err := jwt.Claims(key, &claims); err == nil {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, errs.Unauthorized("github.authorizeToken; error validating github token and extracting claims")
+	}
+
+	// According to "rfc7519 JSON Web Token" acceptable skew should be no
+	// more than a few minutes.
+	if err = claims.ValidateWithLeeway(jose.Expected{
+		Issuer: p.getIssuer(),
+		Time:   time.Now().UTC(),
+	}, time.Minute); err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "github.authorizeToken; invalid github token claims")
+	}
+	if claims.Expiry == nil {
+		return nil, errs.Unauthorized("github.authorizeToken; github token must contain an exp claim")
+	}
+	if !matchesAudience(claims.Audience, p.ctl.Audiences.Sign) {
+		return nil, errs.Unauthorized("github.authorizeToken; github token has invalid audience "+
+			"claim (aud); expected %s, but got %s", p.ctl.Audiences.Sign, claims.Audience)
+	}
+
+	switch {
+	case claims.Repository == "" || claims.JobWorkflowRef == "":
+		return nil, errs.Unauthorized("github.authorizeToken; github token is not a workflow token")
+	case !matchesAnyPattern(p.Repositories, claims.Repository):
+		return nil, errs.Forbidden("github.authorizeToken; repository %q is not allowed", claims.Repository)
+	case !matchesAnyPattern(p.Refs, claims.Ref):
+		return nil, errs.Forbidden("github.authorizeToken; ref %q is not allowed", claims.Ref)
+	case len(p.Environments) > 0 && !matchesAnyPattern(p.Environments, claims.Environment):
+		return nil, errs.Forbidden("github.authorizeToken; environment %q is not allowed", claims.Environment)
+	case !matchesAnyPattern(p.Workflows, claims.JobWorkflowRef):
+		return nil, errs.Forbidden("github.authorizeToken; workflow %q is not allowed", claims.JobWorkflowRef)
+	}
+
+	return &claims, nil
+}
+
+// AuthorizeSign validates the given token.
+func (p *GitHubActions) AuthorizeSign(ctx context.Context, token string) ([]SignOption, error) {
+	claims, err := p.authorizeToken(token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "github.AuthorizeSign")
+	}
+
+	// The certificates are bound to the workflow.
+	sans := []string{p.getServerURL() + "/" + claims.JobWorkflowRef}
+
+	data := x509util.CreateTemplateData(claims.Repository, sans)
+	if v, err := unsafeParseSigned(token); err == nil {
+		data.SetToken(v)
+	}
+	data.Set(GitHubActionsTemplateDataKey, claims.templateData())
+
+	templateOptions, err := TemplateOptions(p.Options, data)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "github.AuthorizeSign")
+	}
+
+	return []SignOption{
+		p,
+		templateOptions,
+		// modifiers / withOptions
+		newProvisionerExtensionOption(TypeGitHubActions, p.Name, claims.Repository, "Ref", claims.Ref, "Workflow", claims.JobWorkflowRef).WithControllerOptions(p.ctl),
+		profileDefaultDuration(p.ctl.Claimer.DefaultTLSCertDuration()),
+		// validators
+		newDefaultSANsValidator(ctx, sans),
+		defaultPublicKeyValidator{},
+		newValidityValidator(p.ctl.Claimer.MinTLSCertDuration(), p.ctl.Claimer.MaxTLSCertDuration()),
+		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
+		p.ctl.newWebhookController(
+			data,
+			linkedca.Webhook_X509,
+			webhook.WithAuthorizationPrincipal(claims.Subject),
+		),
+	}, nil
+}
+
+// AuthorizeRenew returns an error if the renewal is disabled.
+func (p *GitHubActions) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) error {
+	return p.ctl.AuthorizeRenew(ctx, cert)
+}
@@ -0,0 +1,215 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+)
+
+func newGitHubActionsToken(t *testing.T, jwk *jose.JSONWebKey, iss, aud string, modify func(c *gitHubActionsPayload)) string {
+	t.Helper()
+	sig, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.ES256, Key: jwk.Key},
+		new(jose.SignerOptions).WithType("JWT").WithHeader("kid", jwk.KeyID),
+	)
+	require.NoError(t, err)
+
+	now := time.Now()
+	claims := gitHubActionsPayload{
+		Claims: jose.Claims{
+			ID:        "the-jti",
+			Subject:   "repo:my-org/my-repo:ref:refs/heads/main",
+			Issuer:    iss,
+			Audience:  []string{aud},
+			IssuedAt:  jose.NewNumericDate(now),
+			NotBefore: jose.NewNumericDate(now),
+			Expiry:    jose.NewNumericDate(now.Add(5 * time.Minute)),
+		},
+		Repository:      "my-org/my-repo",
+		RepositoryOwner: "my-org",
+		RepositoryID:    "123",
+		Ref:             "refs/heads/main",
+		RefType:         "branch",
+		SHA:             "0123456789abcdef",
+		Workflow:        "release",
+		WorkflowRef:     "my-org/my-repo/.github/workflows/release.yml@refs/heads/main",
+		JobWorkflowRef:  "my-org/my-repo/.github/workflows/release.yml@refs/heads/main",
+		RunID:           "42",
+		RunAttempt:      "1",
+		Actor:           "octocat",
+		EventName:       "push",
+	}
+	if modify != nil {
+		modify(&claims)
+	}
+	tok, err := jose.Signed(sig).Claims(claims).CompactSerialize()
+	require.NoError(t, err)
+	return tok
+}
+
+func TestGitHubActions_Init(t *testing.T) {
+	config := Config{Claims: globalProvisionerClaims, Audiences: testAudiences}
+	assert.EqualError(t, (&GitHubActions{Name: "ci"}).Init(config), "provisioner type cannot be empty")
+	assert.EqualError(t, (&GitHubActions{Type: "GitHubActions"}).Init(config), "provisioner name cannot be empty")
+	assert.EqualError(t, (&GitHubActions{Type: "GitHubActions", Name: "ci"}).Init(config), "provisioner repositories cannot be empty")
+}
+
+func Test_globMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		value   string
+		want    bool
+	}{
+		{"my-org/my-repo", "my-org/my-repo", true},
+		{"my-org/my-repo", "my-org/other", false},
+		{"my-org/*", "my-org/my-repo", true},
+		{"my-org/*", "other-org/my-repo", false},
+		{"*", "anything/at/all", true},
+		{"refs/tags/v*", "refs/tags/v1.0.0", true},
+		{"refs/tags/v*", "refs/heads/v1", false},
+		{"my-org/my-repo/.github/workflows/release.yml@*", "my-org/my-repo/.github/workflows/release.yml@refs/heads/main", true},
+		{"*/.github/workflows/*.yml@refs/heads/main", "my-org/my-repo/.github/workflows/release.yml@refs/heads/main", true},
+		{"*/.github/workflows/*.yml@refs/heads/main", "my-org/my-repo/.github/workflows/release.yml@refs/heads/dev", false},
+		{"a*b*c", "abc", true},
+		{"a*b*c", "acb", false},
+		{"a*a", "a", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.value, func(t *testing.T) {
+			assert.Equal(t, tt.want, globMatch(tt.pattern, tt.value))
+		})
+	}
+}
+
+func TestGitHubActions_AuthorizeSign(t *testing.T) {
+	jwk, err := generateJSONWebKey()
+	require.NoError(t, err)
+	other, err := generateJSONWebKey()
+	require.NoError(t, err)
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(openIDConfiguration{Issuer: srv.URL, JWKSetURI: srv.URL + "/.well-known/jwks"})
+		case "/.well-known/jwks":
+			json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{jwk.Public()}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	p := &GitHubActions{
+		Type:         "GitHubActions",
+		Name:         "ci",
+		Issuer:       srv.URL,
+		Repositories: []string{"my-org/*"},
+		Refs:         []string{"refs/heads/main", "refs/tags/v*"},
+	}
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+	assert.Equal(t, "github/ci", p.GetID())
+	assert.Equal(t, TypeGitHubActions, p.GetType())
+	aud := testAudiences.Sign[0] + "#" + p.GetIDForToken()
+
+	t.Run("ok", func(t *testing.T) {
+		token := newGitHubActionsToken(t, jwk, srv.URL, aud, nil)
+		opts, err := p.AuthorizeSign(context.Background(), token)
+		require.NoError(t, err)
+		v := findGKEDefaultSANsValidator(t, opts)
+		u, err := url.Parse("https://github.com/my-org/my-repo/.github/workflows/release.yml@refs/heads/main")
+		require.NoError(t, err)
+		assert.NoError(t, v.Valid(&x509.CertificateRequest{
+			Subject: pkix.Name{CommonName: "my-org/my-repo"},
+			URIs:    []*url.URL{u},
+		}))
+		assert.Error(t, v.Valid(&x509.CertificateRequest{
+			Subject:  pkix.Name{CommonName: "my-org/my-repo"},
+			DNSNames: []string{"example.com"},
+		}))
+
+		id, err := p.GetTokenID(token)
+		require.NoError(t, err)
+		assert.Equal(t, "the-jti", id)
+	})
+
+	t.Run("ok tag", func(t *testing.T) {
+		_, err := p.AuthorizeSign(context.Background(), newGitHubActionsToken(t, jwk, srv.URL, aud, func(c *gitHubActionsPayload) {
+			c.Ref = "refs/tags/v1.0.0"
+		}))
+		assert.NoError(t, err)
+	})
+
+	t.Run("fail key", func(t *testing.T) {
+		_, err := p.AuthorizeSign(context.Background(), newGitHubActionsToken(t, other, srv.URL, aud, nil))
+		assertStatusCode(t, err, http.StatusUnauthorized)
+	})
+
+	t.Run("fail issuer", func(t *testing.T) {
+		_, err := p.AuthorizeSign(context.Background(), newGitHubActionsToken(t, jwk, GitHubActionsDefaultIssuer, aud, nil))
+		assertStatusCode(t, err, http.StatusUnauthorized)
+	})
+
+	t.Run("fail audience", func(t *testing.T) {
+		_, err := p.AuthorizeSign(context.Background(), newGitHubActionsToken(t, jwk, srv.URL, "https://github.com/my-org", nil))
+		assertStatusCode(t, err, http.StatusUnauthorized)
+	})
+
+	t.Run("fail not a workflow", func(t *testing.T) {
+		_, err := p.AuthorizeSign(context.Background(), newGitHubActionsToken(t, jwk, srv.URL, aud, func(c *gitHubActionsPayload) {
+			c.JobWorkflowRef = ""
+		}))
+		assertStatusCode(t, err, http.StatusUnauthorized)
+	})
+
+	t.Run("fail repository", func(t *testing.T) {
+		_, err := p.AuthorizeSign(context.Background(), newGitHubActionsToken(t, jwk, srv.URL, aud, func(c *gitHubActionsPayload) {
+			c.Repository = "other-org/my-repo"
+		}))
+		assertStatusCode(t, err, http.StatusForbidden)
+	})
+
+	t.Run("fail ref", func(t *testing.T) {
+		_, err := p.AuthorizeSign(context.Background(), newGitHubActionsToken(t, jwk, srv.URL, aud, func(c *gitHubActionsPayload) {
+			c.Ref = "refs/heads/feature"
+		}))
+		assertStatusCode(t, err, http.StatusForbidden)
+	})
+
+	t.Run("fail environment", func(t *testing.T) {
+		p.Environments = []string{"production"}
+		defer func() { p.Environments = nil }()
+		_, err := p.AuthorizeSign(context.Background(), newGitHubActionsToken(t, jwk, srv.URL, aud, nil))
+		assertStatusCode(t, err, http.StatusForbidden)
+		_, err = p.AuthorizeSign(context.Background(), newGitHubActionsToken(t, jwk, srv.URL, aud, func(c *gitHubActionsPayload) {
+			c.Environment = "production"
+		}))
+		assert.NoError(t, err)
+	})
+
+	t.Run("fail workflow", func(t *testing.T) {
+		p.Workflows = []string{"my-org/my-repo/.github/workflows/release.yml@*"}
+		defer func() { p.Workflows = nil }()
+		_, err := p.AuthorizeSign(context.Background(), newGitHubActionsToken(t, jwk, srv.URL, aud, nil))
+		assert.NoError(t, err)
+		_, err = p.AuthorizeSign(context.Background(), newGitHubActionsToken(t, jwk, srv.URL, aud, func(c *gitHubActionsPayload) {
+			c.JobWorkflowRef = "my-org/my-repo/.github/workflows/test.yml@refs/heads/main"
+		}))
+		assertStatusCode(t, err, http.StatusForbidden)
+	})
+
+	t.Run("fail ssh", func(t *testing.T) {
+		_, err := p.AuthorizeSSHSign(context.Background(), newGitHubActionsToken(t, jwk, srv.URL, aud, nil))
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,71 @@
+package provisioner
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/pkcs7"
+	"go.step.sm/crypto/pemutil"
+)
+
+// loadIIDCertificates reads the certificates used to verify the PKCS #7
+// signature of an instance identity document.
+func loadIIDCertificates(path string) ([]*x509.Certificate, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", path)
+	}
+	certs, err := pemutil.ParseCertificateBundle(b)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing %s", path)
+	}
+	return certs, nil
+}
+
+// decodeIIDPKCS7 decodes a PKCS #7 signature returned by a metadata service,
+// the signature can be PEM encoded or just base64 encoded.
+func decodeIIDPKCS7(b []byte) ([]byte, error) {
+	b = bytes.TrimSpace(b)
+	if bytes.HasPrefix(b, []byte("-----BEGIN")) {
+		block, _ := pem.Decode(b)
+		if block == nil {
+			return nil, errors.New("error decoding PEM signature")
+		}
+		return block.Bytes, nil
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(b)), ""))
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding signature")
+	}
+	return sig, nil
+}
+
+// verifyIIDPKCS7 verifies the PKCS #7 signature of an instance identity
+// document with the given certificates and returns the signed document. The
+// document is required if the signature is detached. The certificates embedded
+// in the signature are ignored, only the given ones are trusted.
+func verifyIIDPKCS7(signature, document []byte, certs []*x509.Certificate) ([]byte, error) {
+	p7, err := pkcs7.Parse(signature)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing signature")
+	}
+	switch {
+	case len(p7.Content) == 0:
+		if len(document) == 0 {
+			return nil, errors.New("error validating signature: document is missing")
+		}
+		p7.Content = document
+	case len(document) > 0 && !bytes.Equal(p7.Content, document):
+		return nil, errors.New("error validating signature: document does not match the signed content")
+	}
+	p7.Certificates = certs
+	if err := p7.Verify(); err != nil {
+		return nil, errors.Wrap(err, "error validating signature")
+	}
+	return p7.Content, nil
+}
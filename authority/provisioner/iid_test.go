@@ -0,0 +1,95 @@
+package provisioner
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/smallstep/pkcs7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/minica"
+)
+
+// generateIIDSigner returns a certificate and key used to sign instance
+// identity documents, and the path of a file with the certificate.
+func generateIIDSigner(t *testing.T) (*x509.Certificate, crypto.Signer, string) {
+	t.Helper()
+	ca, err := minica.New()
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "iid.pem")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{
+		Type: "CERTIFICATE", Bytes: ca.Intermediate.Raw,
+	}), 0o600))
+	return ca.Intermediate, ca.Signer, path
+}
+
+func signIIDDocument(t *testing.T, crt *x509.Certificate, key crypto.Signer, doc []byte, detached bool) []byte {
+	t.Helper()
+	sd, err := pkcs7.NewSignedData(doc)
+	require.NoError(t, err)
+	sd.SetDigestAlgorithm(pkcs7.OIDDigestAlgorithmSHA256)
+	require.NoError(t, sd.AddSigner(crt, key, pkcs7.SignerInfoConfig{}))
+	if detached {
+		sd.Detach()
+	}
+	b, err := sd.Finish()
+	require.NoError(t, err)
+	return b
+}
+
+func Test_verifyIIDPKCS7(t *testing.T) {
+	crt, key, path := generateIIDSigner(t)
+	certs, err := loadIIDCertificates(path)
+	require.NoError(t, err)
+	otherCrt, otherKey, _ := generateIIDSigner(t)
+
+	doc := []byte(`{"instanceId":"ins-123"}`)
+	tests := []struct {
+		name      string
+		signature []byte
+		document  []byte
+		want      []byte
+		wantErr   bool
+	}{
+		{"ok", signIIDDocument(t, crt, key, doc, false), nil, doc, false},
+		{"ok with document", signIIDDocument(t, crt, key, doc, false), doc, doc, false},
+		{"ok detached", signIIDDocument(t, crt, key, doc, true), doc, doc, false},
+		{"fail detached without document", signIIDDocument(t, crt, key, doc, true), nil, nil, true},
+		{"fail document", signIIDDocument(t, crt, key, doc, false), []byte(`{"instanceId":"ins-456"}`), nil, true},
+		{"fail detached document", signIIDDocument(t, crt, key, doc, true), []byte(`{"instanceId":"ins-456"}`), nil, true},
+		{"fail signer", signIIDDocument(t, otherCrt, otherKey, doc, false), nil, nil, true},
+		{"fail parse", []byte("foo"), nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := verifyIIDPKCS7(tt.signature, tt.document, certs)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_decodeIIDPKCS7(t *testing.T) {
+	want := []byte{1, 2, 3, 4, 5, 6}
+	for _, s := range []string{
+		"AQIDBAUG",
+		"AQID\nBAUG\n",
+		"-----BEGIN PKCS7-----\nAQIDBAUG\n-----END PKCS7-----\n",
+	} {
+		got, err := decodeIIDPKCS7([]byte(s))
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+	_, err := decodeIIDPKCS7([]byte("-----BEGIN PKCS7-----"))
+	assert.Error(t, err)
+	_, err = decodeIIDPKCS7([]byte("%%%"))
+	assert.Error(t, err)
+}
@@ -37,11 +37,77 @@ type JWK struct {
 	Name         string           `json:"name"`
 	Key          *jose.JSONWebKey `json:"key"`
 	EncryptedKey string           `json:"encryptedKey,omitempty"`
+	Keys         []*JWKKey        `json:"keys,omitempty"`
+	Audiences    *JWKAudiences    `json:"audiences,omitempty"`
 	Claims       *Claims          `json:"claims,omitempty"`
 	Options      *Options         `json:"options,omitempty"`
 	ctl          *Controller
 }
 
+// JWKKey is an additional key of a JWK provisioner. Tokens signed by an
+// additional key are accepted between its NotBefore and NotAfter times, so the
+// provisioner key can be rotated without creating a new provisioner.
+type JWKKey struct {
+	Key          *jose.JSONWebKey `json:"key"`
+	EncryptedKey string           `json:"encryptedKey,omitempty"`
+	NotBefore    *time.Time       `json:"notBefore,omitempty"`
+	NotAfter     *time.Time       `json:"notAfter,omitempty"`
+}
+
+// JWKAudiences are the audiences expected in the tokens of a JWK provisioner
+// for each endpoint. If the audiences of an endpoint are set, they replace the
+// default ones, so a token minted for one endpoint or hostname cannot be used
+// with another one. The audiences can be any string, not only URLs.
+type JWKAudiences struct {
+	Sign      []string `json:"sign,omitempty"`
+	Revoke    []string `json:"revoke,omitempty"`
+	SSHSign   []string `json:"sshSign,omitempty"`
+	SSHRevoke []string `json:"sshRevoke,omitempty"`
+}
+
+// apply returns a copy of the given audiences with the configured ones.
+func (a *JWKAudiences) apply(audiences Audiences) Audiences {
+	if a == nil {
+		return audiences
+	}
+	if len(a.Sign) > 0 {
+		audiences.Sign = a.Sign
+	}
+	if len(a.Revoke) > 0 {
+		audiences.Revoke = a.Revoke
+	}
+	if len(a.SSHSign) > 0 {
+		audiences.SSHSign = a.SSHSign
+	}
+	if len(a.SSHRevoke) > 0 {
+		audiences.SSHRevoke = a.SSHRevoke
+	}
+	return audiences
+}
+
+// matches returns true if any of the given audiences is one of the configured
+// audiences.
+func (a *JWKAudiences) matches(audiences []string) bool {
+	if a == nil {
+		return false
+	}
+	return matchesAudience(audiences, a.Sign) || matchesAudience(audiences, a.Revoke) ||
+		matchesAudience(audiences, a.SSHSign) || matchesAudience(audiences, a.SSHRevoke)
+}
+
+// isActive returns true if the key can be used to verify tokens at the given
+// time.
+func (k *JWKKey) isActive(t time.Time) bool {
+	switch {
+	case k.NotBefore != nil && t.Before(*k.NotBefore):
+		return false
+	case k.NotAfter != nil && t.After(*k.NotAfter):
+		return false
+	default:
+		return true
+	}
+}
+
 // GetID returns the provisioner unique identifier. The name and credential id
 // should uniquely identify any JWK provisioner.
 func (p *JWK) GetID() string {
@@ -90,6 +156,11 @@ func (p *JWK) GetEncryptedKey() (string, string, bool) {
 	return p.Key.KeyID, p.EncryptedKey, p.EncryptedKey != ""
 }
 
+// GetOptions returns the configured provisioner options.
+func (p *JWK) GetOptions() *Options {
+	return p.Options
+}
+
 // Init initializes and validates the fields of a JWK type.
 func (p *JWK) Init(config Config) (err error) {
 	switch {
@@ -101,10 +172,50 @@ func (p *JWK) Init(config Config) (err error) {
 		return errors.New("provisioner key cannot be empty")
 	}
 
+	kids := map[string]bool{p.Key.KeyID: true}
+	for _, k := range p.Keys {
+		switch {
+		case k == nil || k.Key == nil:
+			return errors.New("provisioner keys cannot contain an empty key")
+		case k.Key.KeyID == "":
+			return errors.New("provisioner keys cannot contain a key without a kid")
+		case kids[k.Key.KeyID]:
+			return errors.Errorf("provisioner keys cannot contain duplicated kid %s", k.Key.KeyID)
+		case k.NotBefore != nil && k.NotAfter != nil && !k.NotAfter.After(*k.NotBefore):
+			return errors.Errorf("provisioner key %s notAfter must be after notBefore", k.Key.KeyID)
+		}
+		kids[k.Key.KeyID] = true
+	}
+
+	config.Audiences = p.Audiences.apply(config.Audiences)
+	p.Options = mergeOptions(p.Options, config.DefaultOptions, p.GetType())
 	p.ctl, err = NewController(p, p.Claims, config, p.Options)
 	return
 }
 
+// selectKey returns the key used to verify a token with the given kid. The
+// provisioner key is used if the kid does not match any additional key.
+func (p *JWK) selectKey(kid string, t time.Time) (*jose.JSONWebKey, error) {
+	if kid == "" || kid == p.Key.KeyID {
+		return p.Key, nil
+	}
+	for _, k := range p.Keys {
+		if k.Key.KeyID == kid {
+			if !k.isActive(t) {
+				return nil, errors.Errorf("provisioner key %s is not active", kid)
+			}
+			return k.Key, nil
+		}
+	}
+	return p.Key, nil
+}
+
+// additionalKeys returns the additional keys of the provisioner, used by the
+// collection to load the provisioner by the kid of any of its keys.
+func (p *JWK) additionalKeys() []*JWKKey {
+	return p.Keys
+}
+
 // authorizeToken performs common jwt authorization actions and returns the
 // claims for case specific downstream parsing.
 // e.g. a Sign request will auth/validate different fields than a Revoke request.
@@ -114,8 +225,13 @@ func (p *JWK) authorizeToken(token string, audiences []string) (*jwtPayload, err
 		return nil, errs.Wrap(http.StatusUnauthorized, err, "jwk.authorizeToken; error parsing jwk token")
 	}
 
+	key, err := p.selectKey(jwt.Headers[0].KeyID, time.Now())
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "jwk.authorizeToken")
+	}
+
 	var claims jwtPayload
-	if err = jwt.Claims(p.Key, &claims); err != nil {
+	if err = jwt.Claims(key, &claims); err != nil {
 		return nil, errs.Wrap(http.StatusUnauthorized, err, "jwk.authorizeToken; error parsing jwk claims")
 	}
 
@@ -183,20 +299,25 @@ func (p *JWK) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 		}
 	}
 
-	return []SignOption{
+	signOptions := []SignOption{
 		self,
 		templateOptions,
 		// modifiers / withOptions
 		newProvisionerExtensionOption(TypeJWK, p.Name, p.Key.KeyID).WithControllerOptions(p.ctl),
 		profileDefaultDuration(p.ctl.Claimer.DefaultTLSCertDuration()),
 		// validators
-		commonNameSliceValidator(append([]string{claims.Subject}, claims.SANs...)),
 		defaultPublicKeyValidator{},
 		newDefaultSANsValidator(ctx, claims.SANs),
 		newValidityValidator(p.ctl.Claimer.MinTLSCertDuration(), p.ctl.Claimer.MaxTLSCertDuration()),
 		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
 		p.ctl.newWebhookController(data, linkedca.Webhook_X509),
-	}, nil
+	}
+
+	// Common name validators or modifiers
+	return append(signOptions, newCommonNameOptions(
+		p.Options.GetX509Options().GetCommonNameMode(),
+		append([]string{claims.Subject}, claims.SANs...),
+	)...), nil
 }
 
 // AuthorizeRenew returns an error if the renewal is disabled.
@@ -209,7 +330,7 @@ func (p *JWK) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) error
 }
 
 // AuthorizeSSHSign returns the list of SignOption for a SignSSH request.
-func (p *JWK) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, error) {
+func (p *JWK) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption, error) {
 	if !p.ctl.Claimer.IsSSHCAEnabled() {
 		return nil, errs.Unauthorized("jwk.AuthorizeSSHSign; sshCA is disabled for jwk provisioner '%s'", p.GetName())
 	}
@@ -252,6 +373,7 @@ func (p *JWK) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, e
 	if v, err := unsafeParseSigned(token); err == nil {
 		data.SetToken(v)
 	}
+	audit := newSSHAuditMetadata(ctx, p, claims.Subject, data)
 
 	templateOptions, err := TemplateSSHOptions(p.Options, data)
 	if err != nil {
@@ -259,6 +381,16 @@ func (p *JWK) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, e
 	}
 	signOptions = append(signOptions, templateOptions)
 
+	// Restrict the addresses from which the user certificates can be used.
+	if m := newSSHSourceAddressModifier(ctx, p.Options.GetSSHOptions()); m != nil {
+		signOptions = append(signOptions, m)
+	}
+
+	// Restrict the user principals to the ones allowed for the subject.
+	if v := newSSHUserPrincipalsValidator(p.Options.GetSSHOptions(), claims.Subject); v != nil {
+		signOptions = append(signOptions, v)
+	}
+
 	// Add modifiers from custom claims
 	t := now()
 	if !opts.ValidAfter.IsZero() {
@@ -270,6 +402,7 @@ func (p *JWK) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, e
 
 	return append(signOptions,
 		p,
+		audit,
 		// Set the validity bounds if not set.
 		&sshDefaultDuration{p.ctl.Claimer},
 		// Validate public key
@@ -8,6 +8,7 @@ import (
 	"crypto/x509"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"strings"
 	"testing"
@@ -17,6 +18,7 @@ import (
 
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/middleware/clientinfo"
 )
 
 func TestJWK_Getters(t *testing.T) {
@@ -82,11 +84,48 @@ func TestJWK_Init(t *testing.T) {
 				err: errors.New("claims: MinTLSCertDuration must be greater than 0"),
 			}
 		},
+		"fail-empty-keys-key": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p:   &JWK{Name: "foo", Type: "bar", Key: &jose.JSONWebKey{KeyID: "1"}, Keys: []*JWKKey{{}}},
+				err: errors.New("provisioner keys cannot contain an empty key"),
+			}
+		},
+		"fail-keys-kid": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p:   &JWK{Name: "foo", Type: "bar", Key: &jose.JSONWebKey{KeyID: "1"}, Keys: []*JWKKey{{Key: &jose.JSONWebKey{}}}},
+				err: errors.New("provisioner keys cannot contain a key without a kid"),
+			}
+		},
+		"fail-keys-duplicated-kid": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p:   &JWK{Name: "foo", Type: "bar", Key: &jose.JSONWebKey{KeyID: "1"}, Keys: []*JWKKey{{Key: &jose.JSONWebKey{KeyID: "1"}}}},
+				err: errors.New("provisioner keys cannot contain duplicated kid 1"),
+			}
+		},
+		"fail-keys-window": func(t *testing.T) ProvisionerValidateTest {
+			now := time.Now()
+			return ProvisionerValidateTest{
+				p: &JWK{Name: "foo", Type: "bar", Key: &jose.JSONWebKey{KeyID: "1"}, Keys: []*JWKKey{
+					{Key: &jose.JSONWebKey{KeyID: "2"}, NotBefore: &now, NotAfter: &now},
+				}},
+				err: errors.New("provisioner key 2 notAfter must be after notBefore"),
+			}
+		},
 		"ok": func(t *testing.T) ProvisionerValidateTest {
 			return ProvisionerValidateTest{
 				p: &JWK{Name: "foo", Type: "bar", Key: &jose.JSONWebKey{}},
 			}
 		},
+		"ok-keys": func(t *testing.T) ProvisionerValidateTest {
+			now := time.Now()
+			later := now.Add(time.Hour)
+			return ProvisionerValidateTest{
+				p: &JWK{Name: "foo", Type: "bar", Key: &jose.JSONWebKey{KeyID: "1"}, Keys: []*JWKKey{
+					{Key: &jose.JSONWebKey{KeyID: "2"}, NotBefore: &now, NotAfter: &later},
+					{Key: &jose.JSONWebKey{KeyID: "3"}},
+				}},
+			}
+		},
 	}
 
 	config := Config{
@@ -198,6 +237,110 @@ func TestJWK_authorizeToken(t *testing.T) {
 	}
 }
 
+func TestJWK_authorizeToken_keys(t *testing.T) {
+	p, err := generateJWK()
+	assert.FatalError(t, err)
+	active, err := generateJSONWebKey()
+	assert.FatalError(t, err)
+	expired, err := generateJSONWebKey()
+	assert.FatalError(t, err)
+	future, err := generateJSONWebKey()
+	assert.FatalError(t, err)
+	unknown, err := generateJSONWebKey()
+	assert.FatalError(t, err)
+
+	now := time.Now()
+	past, later := now.Add(-time.Hour), now.Add(time.Hour)
+	publicKey := func(k *jose.JSONWebKey) *jose.JSONWebKey {
+		pub := k.Public()
+		return &pub
+	}
+	p.Keys = []*JWKKey{
+		{Key: publicKey(active), NotBefore: &past, NotAfter: &later},
+		{Key: publicKey(expired), NotAfter: &past},
+		{Key: publicKey(future), NotBefore: &later},
+	}
+	assert.FatalError(t, p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+
+	tests := map[string]struct {
+		key     *jose.JSONWebKey
+		wantErr bool
+	}{
+		"ok-primary":   {key: nil},
+		"ok-active":    {key: active},
+		"fail-expired": {key: expired, wantErr: true},
+		"fail-future":  {key: future, wantErr: true},
+		"fail-unknown": {key: unknown, wantErr: true},
+	}
+	primary, err := decryptJSONWebKey(p.EncryptedKey)
+	assert.FatalError(t, err)
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			key := tt.key
+			if key == nil {
+				key = primary
+			}
+			tok, err := generateSimpleToken(p.Name, testAudiences.Sign[0], key)
+			assert.FatalError(t, err)
+			claims, err := p.authorizeToken(tok, testAudiences.Sign)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, claims)
+			} else {
+				assert.NoError(t, err)
+				assert.Equals(t, "subject", claims.Subject)
+			}
+		})
+	}
+}
+
+func TestJWK_audiences(t *testing.T) {
+	p, err := generateJWK()
+	assert.FatalError(t, err)
+	p.Audiences = &JWKAudiences{
+		Sign:   []string{"https://ca.internal/1.0/sign", "step-ca-sign"},
+		Revoke: []string{"https://ca.internal/1.0/revoke"},
+	}
+	assert.FatalError(t, p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+	key, err := decryptJSONWebKey(p.EncryptedKey)
+	assert.FatalError(t, err)
+
+	tests := map[string]struct {
+		aud     string
+		revoke  bool
+		wantErr bool
+	}{
+		"ok-sign":           {aud: "https://ca.internal/1.0/sign"},
+		"ok-sign-custom":    {aud: "step-ca-sign"},
+		"ok-revoke":         {aud: "https://ca.internal/1.0/revoke", revoke: true},
+		"fail-sign-revoke":  {aud: "https://ca.internal/1.0/revoke", wantErr: true},
+		"fail-revoke-sign":  {aud: "https://ca.internal/1.0/sign", revoke: true, wantErr: true},
+		"fail-sign-default": {aud: testAudiences.Sign[0], wantErr: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			tok, err := generateSimpleToken(p.Name, tt.aud, key)
+			assert.FatalError(t, err)
+			if tt.revoke {
+				err = p.AuthorizeRevoke(context.Background(), tok)
+			} else {
+				_, err = p.AuthorizeSign(context.Background(), tok)
+			}
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	// Audiences that are not configured use the defaults.
+	tok, err := generateSimpleToken(p.Name, testAudiences.SSHRevoke[0], key)
+	assert.FatalError(t, err)
+	_, err = p.authorizeToken(tok, p.ctl.Audiences.SSHRevoke)
+	assert.NoError(t, err)
+}
+
 func TestJWK_AuthorizeRevoke(t *testing.T) {
 	p1, err := generateJWK()
 	assert.FatalError(t, err)
@@ -483,6 +626,288 @@ func TestJWK_AuthorizeSSHSign(t *testing.T) {
 	}
 }
 
+func TestJWK_AuthorizeSSHSign_keyID(t *testing.T) {
+	key, err := generateJSONWebKey()
+	assert.FatalError(t, err)
+	signer, err := generateJSONWebKey()
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name        string
+		keyID       string
+		want        string
+		wantSignErr bool
+	}{
+		{"ok", `{{ .Token.sub }}-{{ .Token.step.ssh.certType }}`, "subject@localhost-user", false},
+		{"ok principals", `{{ .Token.sub }}/{{ join "," .Principals }}`, "subject@localhost/name", false},
+		{"fail undefined variable", `{{ .Token.email }}-{{ now | unixEpoch }}`, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := generateJWK()
+			assert.FatalError(t, err)
+			p.Options = &Options{SSH: &SSHOptions{KeyID: tt.keyID}}
+			assert.FatalError(t, p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+
+			jwk, err := decryptJSONWebKey(p.EncryptedKey)
+			assert.FatalError(t, err)
+			token, err := generateSimpleSSHUserToken(p.Name, testAudiences.SSHSign[0], jwk)
+			assert.FatalError(t, err)
+
+			opts, err := p.AuthorizeSSHSign(context.Background(), token)
+			assert.FatalError(t, err)
+			cert, err := signSSHCertificate(key.Public().Key, SignSSHOptions{}, opts, signer.Key.(crypto.Signer))
+			if tt.wantSignErr {
+				var sc render.StatusCodedError
+				assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+				assert.Equals(t, http.StatusBadRequest, sc.StatusCode())
+				assert.Nil(t, cert)
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, tt.want, cert.KeyId)
+		})
+	}
+
+	t.Run("fail invalid template", func(t *testing.T) {
+		p, err := generateJWK()
+		assert.FatalError(t, err)
+		p.Options = &Options{SSH: &SSHOptions{KeyID: `{{ .Token.sub `}}
+		assert.Error(t, p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+	})
+}
+
+func TestJWK_AuthorizeSSHSign_certificateOptions(t *testing.T) {
+	key, err := generateJSONWebKey()
+	assert.FatalError(t, err)
+	signer, err := generateJSONWebKey()
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name                string
+		opts                *SSHOptions
+		wantCriticalOptions map[string]string
+		wantExtensions      map[string]string
+		wantSignErr         bool
+	}{
+		{"ok", &SSHOptions{
+			CriticalOptions: map[string]string{"force-command": "/usr/bin/backup {{ .Token.sub }}"},
+			Extensions:      map[string]string{"permit-pty": "", "login@example.com": "{{ .KeyID }}"},
+		}, map[string]string{"force-command": "/usr/bin/backup subject@localhost"}, map[string]string{
+			"permit-X11-forwarding":   "",
+			"permit-agent-forwarding": "",
+			"permit-port-forwarding":  "",
+			"permit-pty":              "",
+			"permit-user-rc":          "",
+			"login@example.com":       "subject@localhost",
+		}, false},
+		{"ok principal", &SSHOptions{
+			CriticalOptions: map[string]string{"force-command": "/usr/bin/backup"},
+			PrincipalOptions: map[string]*SSHPrincipalOptions{
+				"name": {
+					CriticalOptions: map[string]string{"force-command": "/usr/bin/restore", "source-address": "10.0.0.0/8"},
+				},
+				"other": {
+					CriticalOptions: map[string]string{"source-address": "192.168.0.0/16"},
+				},
+			},
+		}, map[string]string{"force-command": "/usr/bin/restore", "source-address": "10.0.0.0/8"}, map[string]string{
+			"permit-X11-forwarding":   "",
+			"permit-agent-forwarding": "",
+			"permit-port-forwarding":  "",
+			"permit-pty":              "",
+			"permit-user-rc":          "",
+		}, false},
+		{"fail undefined variable", &SSHOptions{
+			CriticalOptions: map[string]string{"force-command": "{{ .Token.email }}"},
+		}, nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := generateJWK()
+			assert.FatalError(t, err)
+			p.Options = &Options{SSH: tt.opts}
+			assert.FatalError(t, p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+
+			jwk, err := decryptJSONWebKey(p.EncryptedKey)
+			assert.FatalError(t, err)
+			token, err := generateSimpleSSHUserToken(p.Name, testAudiences.SSHSign[0], jwk)
+			assert.FatalError(t, err)
+
+			opts, err := p.AuthorizeSSHSign(context.Background(), token)
+			assert.FatalError(t, err)
+			cert, err := signSSHCertificate(key.Public().Key, SignSSHOptions{}, opts, signer.Key.(crypto.Signer))
+			if tt.wantSignErr {
+				var sc render.StatusCodedError
+				assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+				assert.Equals(t, http.StatusBadRequest, sc.StatusCode())
+				assert.Nil(t, cert)
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, tt.wantCriticalOptions, cert.CriticalOptions)
+			assert.Equals(t, tt.wantExtensions, cert.Extensions)
+		})
+	}
+
+	t.Run("fail invalid template", func(t *testing.T) {
+		p, err := generateJWK()
+		assert.FatalError(t, err)
+		p.Options = &Options{SSH: &SSHOptions{Extensions: map[string]string{"permit-pty": `{{ .Token.sub `}}}
+		assert.Error(t, p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+	})
+
+	t.Run("fail empty principal", func(t *testing.T) {
+		p, err := generateJWK()
+		assert.FatalError(t, err)
+		p.Options = &Options{SSH: &SSHOptions{PrincipalOptions: map[string]*SSHPrincipalOptions{"": {}}}}
+		assert.Error(t, p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+	})
+}
+
+func TestJWK_AuthorizeSSHSign_audit(t *testing.T) {
+	key, err := generateJSONWebKey()
+	assert.FatalError(t, err)
+	signer, err := generateJSONWebKey()
+	assert.FatalError(t, err)
+
+	p, err := generateJWK()
+	assert.FatalError(t, err)
+	p.Options = &Options{SSH: &SSHOptions{
+		Extensions: map[string]string{"audit@example.com": "{{ toJson .Audit }}"},
+	}}
+	assert.FatalError(t, p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+
+	jwk, err := decryptJSONWebKey(p.EncryptedKey)
+	assert.FatalError(t, err)
+	token, err := generateSimpleSSHUserToken(p.Name, testAudiences.SSHSign[0], jwk)
+	assert.FatalError(t, err)
+
+	ctx := withRequestID(t, context.Background(), "reqID")
+	opts, err := p.AuthorizeSSHSign(ctx, token)
+	assert.FatalError(t, err)
+
+	want := &SSHAuditMetadata{RequestID: "reqID", Provisioner: p.GetName(), Identity: "subject@localhost"}
+	var found bool
+	for _, o := range opts {
+		if v, ok := o.(*SSHAuditMetadata); ok {
+			assert.Equals(t, want, v)
+			found = true
+		}
+	}
+	assert.True(t, found, "sign options do not contain the audit metadata")
+
+	cert, err := signSSHCertificate(key.Public().Key, SignSSHOptions{}, opts, signer.Key.(crypto.Signer))
+	assert.FatalError(t, err)
+	assert.Equals(t, `{"requestID":"reqID","provisioner":"`+p.GetName()+`","identity":"subject@localhost"}`, cert.Extensions["audit@example.com"])
+}
+
+func TestJWK_AuthorizeSSHSign_userPrincipals(t *testing.T) {
+	key, err := generateJSONWebKey()
+	assert.FatalError(t, err)
+	signer, err := generateJSONWebKey()
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name        string
+		rules       []*SSHUserPrincipalRule
+		wantSignErr bool
+	}{
+		{"ok", []*SSHUserPrincipalRule{{Identity: `subject@.+`, Principals: []string{"name"}}}, false},
+		{"fail principal", []*SSHUserPrincipalRule{{Identity: `(.+)@localhost`, Principals: []string{"$1"}}}, true},
+		{"fail no match", []*SSHUserPrincipalRule{{Identity: `other@localhost`, Principals: []string{"name"}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := generateJWK()
+			assert.FatalError(t, err)
+			p.Options = &Options{SSH: &SSHOptions{UserPrincipals: tt.rules}}
+			assert.FatalError(t, p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+
+			jwk, err := decryptJSONWebKey(p.EncryptedKey)
+			assert.FatalError(t, err)
+			token, err := generateSimpleSSHUserToken(p.Name, testAudiences.SSHSign[0], jwk)
+			assert.FatalError(t, err)
+
+			opts, err := p.AuthorizeSSHSign(context.Background(), token)
+			assert.FatalError(t, err)
+			cert, err := signSSHCertificate(key.Public().Key, SignSSHOptions{}, opts, signer.Key.(crypto.Signer))
+			if tt.wantSignErr {
+				assert.Error(t, err)
+				assert.Nil(t, cert)
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, []string{"name"}, cert.ValidPrincipals)
+		})
+	}
+
+	t.Run("fail invalid rule", func(t *testing.T) {
+		p, err := generateJWK()
+		assert.FatalError(t, err)
+		p.Options = &Options{SSH: &SSHOptions{UserPrincipals: []*SSHUserPrincipalRule{{Identity: `(.+`, Principals: []string{"$1"}}}}}
+		assert.Error(t, p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+	})
+}
+
+func TestJWK_AuthorizeSSHSign_sourceAddress(t *testing.T) {
+	key, err := generateJSONWebKey()
+	assert.FatalError(t, err)
+	signer, err := generateJSONWebKey()
+	assert.FatalError(t, err)
+
+	withClientIP := func(ip string) context.Context {
+		return clientinfo.NewContext(context.Background(), &clientinfo.ClientInfo{IP: net.ParseIP(ip)})
+	}
+
+	tests := []struct {
+		name        string
+		ctx         context.Context
+		sa          *SSHSourceAddress
+		want        string
+		wantSignErr bool
+	}{
+		{"ok clientIP", withClientIP("10.1.2.3"), &SSHSourceAddress{ClientIP: true}, "10.1.2.3", false},
+		{"ok cidrs", context.Background(), &SSHSourceAddress{CIDRs: []string{"10.0.0.0/8", "192.168.0.0/16"}}, "10.0.0.0/8,192.168.0.0/16", false},
+		{"ok both", withClientIP("2001:db8::1"), &SSHSourceAddress{ClientIP: true, CIDRs: []string{"10.0.0.0/8"}}, "10.0.0.0/8,2001:db8::1", false},
+		{"fail no client", context.Background(), &SSHSourceAddress{ClientIP: true}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := generateJWK()
+			assert.FatalError(t, err)
+			p.Options = &Options{SSH: &SSHOptions{
+				CriticalOptions: map[string]string{"source-address": "0.0.0.0/0"},
+				SourceAddress:   tt.sa,
+			}}
+			assert.FatalError(t, p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+
+			jwk, err := decryptJSONWebKey(p.EncryptedKey)
+			assert.FatalError(t, err)
+			token, err := generateSimpleSSHUserToken(p.Name, testAudiences.SSHSign[0], jwk)
+			assert.FatalError(t, err)
+
+			opts, err := p.AuthorizeSSHSign(tt.ctx, token)
+			assert.FatalError(t, err)
+			cert, err := signSSHCertificate(key.Public().Key, SignSSHOptions{}, opts, signer.Key.(crypto.Signer))
+			if tt.wantSignErr {
+				assert.Error(t, err)
+				assert.Nil(t, cert)
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, tt.want, cert.CriticalOptions["source-address"])
+		})
+	}
+
+	t.Run("fail invalid options", func(t *testing.T) {
+		p, err := generateJWK()
+		assert.FatalError(t, err)
+		p.Options = &Options{SSH: &SSHOptions{SourceAddress: &SSHSourceAddress{CIDRs: []string{"10.0.0.0/33"}}}}
+		assert.Error(t, p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+	})
+}
+
 func TestJWK_AuthorizeSign_SSHOptions(t *testing.T) {
 	tm, fn := mockNow()
 	defer fn()
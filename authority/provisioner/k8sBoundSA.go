@@ -0,0 +1,411 @@
+package provisioner
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/pemutil"
+	"go.step.sm/crypto/x509util"
+	"go.step.sm/linkedca"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+const (
+	// K8sBoundSADefaultTokenFile is the default file with the token used to
+	// authenticate the TokenReview requests, the token of the pod service
+	// account.
+	K8sBoundSADefaultTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	// K8sBoundSADefaultClusterDomain is the default domain of the cluster.
+	K8sBoundSADefaultClusterDomain = "cluster.local"
+	// maxTokenReviewResponseSize is the maximum size of a TokenReview response.
+	maxTokenReviewResponseSize = 1 << 20
+)
+
+// k8sBoundSAPayload represents the claims of a bound service account token.
+type k8sBoundSAPayload struct {
+	jose.Claims
+	Kubernetes struct {
+		Namespace      string `json:"namespace"`
+		ServiceAccount struct {
+			Name string `json:"name"`
+			UID  string `json:"uid"`
+		} `json:"serviceaccount"`
+		Pod *struct {
+			Name string `json:"name"`
+			UID  string `json:"uid"`
+		} `json:"pod,omitempty"`
+	} `json:"kubernetes.io"`
+}
+
+// serviceAccountUsername returns the username of the service account in the
+// token, system:serviceaccount:<namespace>:<name>.
+func (c *k8sBoundSAPayload) serviceAccountUsername() string {
+	return "system:serviceaccount:" + c.Kubernetes.Namespace + ":" + c.Kubernetes.ServiceAccount.Name
+}
+
+// tokenReview is the TokenReview object of the authentication.k8s.io/v1 API.
+type tokenReview struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Spec       struct {
+		Token     string   `json:"token"`
+		Audiences []string `json:"audiences,omitempty"`
+	} `json:"spec"`
+	Status struct {
+		Authenticated bool `json:"authenticated"`
+		User          struct {
+			Username string `json:"username"`
+			UID      string `json:"uid"`
+		} `json:"user"`
+		Audiences []string `json:"audiences"`
+		Error     string   `json:"error"`
+	} `json:"status"`
+}
+
+// K8sBoundSA represents a Kubernetes provisioner that validates bound service
+// account tokens, the tokens projected in the pods of a cluster. Contrary to
+// the K8sSA provisioner, it does not require the keys used to sign the tokens.
+//
+// If APIServer is configured, the tokens are validated with the TokenReview
+// API of the cluster. If not, the tokens are validated with the keys published
+// in the OIDC discovery endpoint of the issuer.
+//
+// The tokens must have as audience the sign (or revoke) audience of the CA
+// with the provisioner id as a fragment, e.g.
+// https://ca.example.com/1.0/sign#k8sbsa/my-cluster. The certificates are bound
+// to the service account in the token; by default they contain the DNS names
+// <name>.<namespace>.svc and <name>.<namespace>.svc.<clusterDomain>.
+type K8sBoundSA struct {
+	*base
+	ID   string `json:"-"`
+	Type string `json:"type"`
+	Name string `json:"name"`
+	// Issuer is the issuer of the service account tokens, the value of the
+	// --service-account-issuer flag of the Kubernetes API server.
+	Issuer string `json:"issuer"`
+	// APIServer is the URL of the Kubernetes API server used for TokenReview.
+	APIServer string `json:"apiServer,omitempty"`
+	// APIServerRoots is a PEM bundle used to verify the API server
+	// certificate. The system roots are used by default.
+	APIServerRoots []byte `json:"apiServerRoots,omitempty"`
+	// TokenFile is the file with the token used to authenticate to the API
+	// server. The file is read on each request, so rotated tokens are used.
+	TokenFile string `json:"tokenFile,omitempty"`
+	// Namespaces, if set, are the only namespaces allowed to get certificates.
+	Namespaces []string `json:"namespaces,omitempty"`
+	// ClusterDomain is the domain used in the default SANs.
+	ClusterDomain string   `json:"clusterDomain,omitempty"`
+	Claims        *Claims  `json:"claims,omitempty"`
+	Options       *Options `json:"options,omitempty"`
+	httpClient    *http.Client
+	keyStore      *keyStore
+	ctl           *Controller
+}
+
+// GetID returns the provisioner unique identifier.
+func (p *K8sBoundSA) GetID() string {
+	if p.ID != "" {
+		return p.ID
+	}
+	return p.GetIDForToken()
+}
+
+// GetIDForToken returns an identifier that will be used to load the provisioner
+// from a token.
+func (p *K8sBoundSA) GetIDForToken() string {
+	return "k8sbsa/" + p.Name
+}
+
+// GetTokenID returns the identifier of the token.
+func (p *K8sBoundSA) GetTokenID(ott string) (string, error) {
+	// Validate payload
+	token, err := jose.ParseSigned(ott)
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing token")
+	}
+
+	// Get claims w/out verification. We need to look up the provisioner
+	// key in order to verify the claims and we need the issuer from the claims
+	// before we can look up the provisioner.
+	var claims jose.Claims
+	if err = token.UnsafeClaimsWithoutVerification(&claims); err != nil {
+		return "", errors.Wrap(err, "error verifying claims")
+	}
+	return claims.ID, nil
+}
+
+// GetName returns the name of the provisioner.
+func (p *K8sBoundSA) GetName() string {
+	return p.Name
+}
+
+// GetType returns the type of provisioner.
+func (p *K8sBoundSA) GetType() Type {
+	return TypeK8sBoundSA
+}
+
+// GetEncryptedKey returns false, because the kubernetes provisioner does not
+// have access to the private key.
+func (p *K8sBoundSA) GetEncryptedKey() (string, string, bool) {
+	return "", "", false
+}
+
+// GetOptions returns the configured provisioner options.
+func (p *K8sBoundSA) GetOptions() *Options {
+	return p.Options
+}
+
+// GetClusterDomain returns the domain of the cluster used in the default SANs.
+func (p *K8sBoundSA) GetClusterDomain() string {
+	if p.ClusterDomain != "" {
+		return p.ClusterDomain
+	}
+	return K8sBoundSADefaultClusterDomain
+}
+
+// Init initializes and validates the fields of a K8sBoundSA type.
+func (p *K8sBoundSA) Init(config Config) (err error) {
+	switch {
+	case p.Type == "":
+		return errors.New("provisioner type cannot be empty")
+	case p.Name == "":
+		return errors.New("provisioner name cannot be empty")
+	case p.Issuer == "":
+		return errors.New("provisioner issuer cannot be empty")
+	}
+
+	if p.APIServer != "" {
+		if !strings.HasPrefix(p.APIServer, "https://") && !strings.HasPrefix(p.APIServer, "http://") {
+			return errors.Errorf("provisioner apiServer %q is not a valid url", p.APIServer)
+		}
+		tr := http.DefaultTransport.(*http.Transport).Clone()
+		if len(p.APIServerRoots) > 0 {
+			certs, err := pemutil.ParseCertificateBundle(p.APIServerRoots)
+			if err != nil {
+				return errors.Wrap(err, "error parsing apiServerRoots")
+			}
+			pool := x509.NewCertPool()
+			for _, crt := range certs {
+				pool.AddCert(crt)
+			}
+			tr.TLSClientConfig = &tls.Config{
+				RootCAs:    pool,
+				MinVersion: tls.VersionTLS12,
+			}
+		}
+		p.httpClient = &http.Client{
+			Transport: tr,
+			Timeout:   30 * time.Second,
+		}
+	} else {
+		// Get the keys from the OIDC discovery of the issuer.
+		var conf openIDConfiguration
+		u := strings.TrimSuffix(p.Issuer, "/") + "/.well-known/openid-configuration"
+		if err := getAndDecode(u, &conf); err != nil {
+			return err
+		}
+		if err := conf.Validate(); err != nil {
+			return errors.Wrapf(err, "error parsing %s", u)
+		}
+		if conf.Issuer != p.Issuer {
+			return errors.Errorf("error parsing %s: issuer %q does not match the provisioner issuer", u, conf.Issuer)
+		}
+		if p.keyStore, err = newKeyStore(conf.JWKSetURI); err != nil {
+			return err
+		}
+	}
+
+	config.Audiences = config.Audiences.WithFragment(p.GetIDForToken())
+	p.Options = mergeOptions(p.Options, config.DefaultOptions, p.GetType())
+	p.ctl, err = NewController(p, p.Claims, config, p.Options)
+	return
+}
+
+// authorizeToken validates a bound service account token and returns its
+// claims.
+func (p *K8sBoundSA) authorizeToken(token string, audiences []string) (*k8sBoundSAPayload, error) {
+	jwt, err := jose.ParseSigned(token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err,
+			"k8sbsa.authorizeToken; error parsing k8sBoundSA token")
+	}
+
+	var claims k8sBoundSAPayload
+	if p.APIServer != "" {
+		username, err := p.reviewToken(token, audiences)
+		if err != nil {
+			return nil, errs.Wrap(http.StatusUnauthorized, err,
+				"k8sbsa.authorizeToken; error validating k8sBoundSA token")
+		}
+		// The API server has validated the signature of the token.
+		if err := jwt.UnsafeClaimsWithoutVerification(&claims); err != nil {
+			return nil, errs.Wrap(http.StatusUnauthorized, err,
+				"k8sbsa.authorizeToken; error parsing k8sBoundSA token claims")
+		}
+		if username != claims.serviceAccountUsername() {
+			return nil, errs.Unauthorized("k8sbsa.authorizeToken; k8sBoundSA token does not match the reviewed user")
+		}
+	} else {
+		found := false
+		for _, key := range p.keyStore.Get(jwt.Headers[0].KeyID) {
+			if err := jwt.Claims(key, &claims); err == nil {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, errs.Unauthorized("k8sbsa.authorizeToken; error validating k8sBoundSA token and extracting claims")
+		}
+	}
+
+	// According to "rfc7519 JSON Web Token" acceptable skew should be no
+	// more than a few minutes.
+	if err = claims.ValidateWithLeeway(jose.Expected{
+		Issuer: p.Issuer,
+		Time:   time.Now().UTC(),
+	}, time.Minute); err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "k8sbsa.authorizeToken; invalid k8sBoundSA token claims")
+	}
+	if claims.Expiry == nil {
+		return nil, errs.Unauthorized("k8sbsa.authorizeToken; k8sBoundSA token must contain an exp claim")
+	}
+	if !matchesAudience(claims.Audience, audiences) {
+		return nil, errs.Unauthorized("k8sbsa.authorizeToken; k8sBoundSA token has invalid audience "+
+			"claim (aud); expected %s, but got %s", audiences, claims.Audience)
+	}
+
+	// Bound tokens always contain the namespace and service account.
+	k := claims.Kubernetes
+	if k.Namespace == "" || k.ServiceAccount.Name == "" || claims.Subject != claims.serviceAccountUsername() {
+		return nil, errs.Unauthorized("k8sbsa.authorizeToken; k8sBoundSA token is not a service account token")
+	}
+	if len(p.Namespaces) > 0 && !slices.Contains(p.Namespaces, k.Namespace) {
+		return nil, errs.Forbidden("k8sbsa.authorizeToken; namespace %q is not allowed", k.Namespace)
+	}
+
+	return &claims, nil
+}
+
+// reviewToken validates the token using the TokenReview API, and returns the
+// username of the authenticated service account.
+func (p *K8sBoundSA) reviewToken(token string, audiences []string) (string, error) {
+	bearer, err := os.ReadFile(p.getTokenFile())
+	if err != nil {
+		return "", errors.Wrap(err, "error reading tokenFile")
+	}
+
+	review := tokenReview{
+		APIVersion: "authentication.k8s.io/v1",
+		Kind:       "TokenReview",
+	}
+	review.Spec.Token = token
+	review.Spec.Audiences = audiences
+	body, err := json.Marshal(review)
+	if err != nil {
+		return "", errors.Wrap(err, "error marshaling token review")
+	}
+
+	u := strings.TrimSuffix(p.APIServer, "/") + "/apis/authentication.k8s.io/v1/tokenreviews"
+	req, err := http.NewRequest(http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return "", errors.Wrapf(err, "error creating request to %s", u)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(bearer)))
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to connect to %s", u)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("error reviewing token: %s returned status code %d", u, resp.StatusCode)
+	}
+
+	var result tokenReview
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxTokenReviewResponseSize)).Decode(&result); err != nil {
+		return "", errors.Wrapf(err, "error reading %s", u)
+	}
+	switch {
+	case result.Status.Error != "":
+		return "", errors.Errorf("error reviewing token: %s", result.Status.Error)
+	case !result.Status.Authenticated:
+		return "", errors.New("error reviewing token: token is not authenticated")
+	case !strings.HasPrefix(result.Status.User.Username, "system:serviceaccount:"):
+		return "", errors.Errorf("error reviewing token: user %q is not a service account", result.Status.User.Username)
+	}
+	return result.Status.User.Username, nil
+}
+
+func (p *K8sBoundSA) getTokenFile() string {
+	if p.TokenFile != "" {
+		return p.TokenFile
+	}
+	return K8sBoundSADefaultTokenFile
+}
+
+// AuthorizeRevoke returns an error if the provisioner does not have rights to
+// revoke the certificate with serial number in the `sub` property.
+func (p *K8sBoundSA) AuthorizeRevoke(_ context.Context, token string) error {
+	_, err := p.authorizeToken(token, p.ctl.Audiences.Revoke)
+	return errs.Wrap(http.StatusInternalServerError, err, "k8sbsa.AuthorizeRevoke")
+}
+
+// AuthorizeSign validates the given token.
+func (p *K8sBoundSA) AuthorizeSign(ctx context.Context, token string) ([]SignOption, error) {
+	claims, err := p.authorizeToken(token, p.ctl.Audiences.Sign)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "k8sbsa.AuthorizeSign")
+	}
+
+	// The certificates are bound to the service account.
+	name, namespace := claims.Kubernetes.ServiceAccount.Name, claims.Kubernetes.Namespace
+	sans := []string{
+		fmt.Sprintf("%s.%s.svc", name, namespace),
+		fmt.Sprintf("%s.%s.svc.%s", name, namespace, p.GetClusterDomain()),
+	}
+
+	data := x509util.CreateTemplateData(name, sans)
+	if v, err := unsafeParseSigned(token); err == nil {
+		data.SetToken(v)
+	}
+
+	templateOptions, err := TemplateOptions(p.Options, data)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "k8sbsa.AuthorizeSign")
+	}
+
+	return []SignOption{
+		p,
+		templateOptions,
+		// modifiers / withOptions
+		newProvisionerExtensionOption(TypeK8sBoundSA, p.Name, "").WithControllerOptions(p.ctl),
+		profileDefaultDuration(p.ctl.Claimer.DefaultTLSCertDuration()),
+		// validators
+		newDefaultSANsValidator(ctx, sans),
+		defaultPublicKeyValidator{},
+		newValidityValidator(p.ctl.Claimer.MinTLSCertDuration(), p.ctl.Claimer.MaxTLSCertDuration()),
+		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
+		p.ctl.newWebhookController(data, linkedca.Webhook_X509),
+	}, nil
+}
+
+// AuthorizeRenew returns an error if the renewal is disabled.
+func (p *K8sBoundSA) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) error {
+	return p.ctl.AuthorizeRenew(ctx, cert)
+}
@@ -0,0 +1,240 @@
+package provisioner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/x509util"
+
+	"github.com/smallstep/certificates/api/render"
+)
+
+func newK8sBoundSAToken(t *testing.T, jwk *jose.JSONWebKey, iss, aud, namespace, name string, exp time.Time) string {
+	t.Helper()
+	so := new(jose.SignerOptions)
+	so.WithType("JWT")
+	so.WithHeader("kid", jwk.KeyID)
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: jwk.Key}, so)
+	require.NoError(t, err)
+	now := time.Now()
+	tok, err := jose.Signed(sig).Claims(map[string]interface{}{
+		"iss": iss,
+		"sub": "system:serviceaccount:" + namespace + ":" + name,
+		"aud": []string{aud},
+		"iat": now.Unix(),
+		"nbf": now.Unix(),
+		"exp": exp.Unix(),
+		"kubernetes.io": map[string]interface{}{
+			"namespace":      namespace,
+			"serviceaccount": map[string]interface{}{"name": name, "uid": "5f3a1c4e"},
+			"pod":            map[string]interface{}{"name": name + "-7d4b9c", "uid": "9e2d7a61"},
+		},
+	}).CompactSerialize()
+	require.NoError(t, err)
+	return tok
+}
+
+func assertK8sBoundSASANs(t *testing.T, signOpts []SignOption, want []string) {
+	t.Helper()
+	var found bool
+	for _, op := range signOpts {
+		if cof, ok := op.(CertificateOptions); ok {
+			found = true
+			csr := parseCertificateRequest(t, "testdata/certs/ecdsa.csr")
+			crt, err := x509util.NewCertificate(csr, cof.Options(SignOptions{})...)
+			require.NoError(t, err)
+			assert.Equal(t, want, crt.GetCertificate().DNSNames)
+		}
+	}
+	assert.True(t, found)
+}
+
+func assertStatusCode(t *testing.T, err error, statusCode int) {
+	t.Helper()
+	var sc render.StatusCodedError
+	require.True(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+	assert.Equal(t, statusCode, sc.StatusCode())
+}
+
+func TestK8sBoundSA_discovery(t *testing.T) {
+	jwk, err := generateJSONWebKey()
+	require.NoError(t, err)
+	other, err := generateJSONWebKey()
+	require.NoError(t, err)
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(openIDConfiguration{Issuer: srv.URL, JWKSetURI: srv.URL + "/openid/v1/jwks"})
+		case "/openid/v1/jwks":
+			json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{jwk.Public()}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	p := &K8sBoundSA{
+		Type:       "K8sBoundSA",
+		Name:       "my-cluster",
+		Issuer:     srv.URL,
+		Namespaces: []string{"default", "web"},
+	}
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+	aud := testAudiences.Sign[0] + "#" + p.GetIDForToken()
+	exp := time.Now().Add(time.Hour)
+
+	t.Run("ok", func(t *testing.T) {
+		signOpts, err := p.AuthorizeSign(context.Background(), newK8sBoundSAToken(t, jwk, srv.URL, aud, "web", "frontend", exp))
+		require.NoError(t, err)
+		assertK8sBoundSASANs(t, signOpts, []string{"frontend.web.svc", "frontend.web.svc.cluster.local"})
+	})
+
+	t.Run("ok revoke", func(t *testing.T) {
+		assert.NoError(t, p.AuthorizeRevoke(context.Background(), newK8sBoundSAToken(t, jwk, srv.URL,
+			testAudiences.Revoke[0]+"#"+p.GetIDForToken(), "web", "frontend", exp)))
+	})
+
+	t.Run("fail key", func(t *testing.T) {
+		_, err := p.AuthorizeSign(context.Background(), newK8sBoundSAToken(t, other, srv.URL, aud, "web", "frontend", exp))
+		assertStatusCode(t, err, http.StatusUnauthorized)
+	})
+
+	t.Run("fail issuer", func(t *testing.T) {
+		_, err := p.AuthorizeSign(context.Background(), newK8sBoundSAToken(t, jwk, "https://kubernetes.default.svc", aud, "web", "frontend", exp))
+		assertStatusCode(t, err, http.StatusUnauthorized)
+	})
+
+	t.Run("fail audience", func(t *testing.T) {
+		_, err := p.AuthorizeSign(context.Background(), newK8sBoundSAToken(t, jwk, srv.URL, "https://kubernetes.default.svc", "web", "frontend", exp))
+		assertStatusCode(t, err, http.StatusUnauthorized)
+	})
+
+	t.Run("fail expired", func(t *testing.T) {
+		_, err := p.AuthorizeSign(context.Background(), newK8sBoundSAToken(t, jwk, srv.URL, aud, "web", "frontend", time.Now().Add(-time.Hour)))
+		assertStatusCode(t, err, http.StatusUnauthorized)
+	})
+
+	t.Run("fail namespace", func(t *testing.T) {
+		_, err := p.AuthorizeSign(context.Background(), newK8sBoundSAToken(t, jwk, srv.URL, aud, "kube-system", "frontend", exp))
+		assertStatusCode(t, err, http.StatusForbidden)
+	})
+}
+
+func TestK8sBoundSA_tokenReview(t *testing.T) {
+	jwk, err := generateJSONWebKey()
+	require.NoError(t, err)
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("the-token\n"), 0600))
+
+	const issuer = "https://kubernetes.default.svc.cluster.local"
+	p := &K8sBoundSA{
+		Type:          "K8sBoundSA",
+		Name:          "my-cluster",
+		Issuer:        issuer,
+		TokenFile:     tokenFile,
+		ClusterDomain: "example.internal",
+	}
+	aud := testAudiences.Sign[0] + "#" + p.GetIDForToken()
+	exp := time.Now().Add(time.Hour)
+	frontend := newK8sBoundSAToken(t, jwk, issuer, aud, "web", "frontend", exp)
+	backend := newK8sBoundSAToken(t, jwk, issuer, aud, "web", "backend", exp)
+	invalid := newK8sBoundSAToken(t, jwk, issuer, aud, "web", "invalid", exp)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/apis/authentication.k8s.io/v1/tokenreviews" || r.Header.Get("Authorization") != "Bearer the-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var review tokenReview
+		if err := json.NewDecoder(r.Body).Decode(&review); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		assert.Equal(t, "TokenReview", review.Kind)
+		assert.Contains(t, review.Spec.Audiences, aud)
+		switch review.Spec.Token {
+		case frontend:
+			review.Status.Authenticated = true
+			review.Status.User.Username = "system:serviceaccount:web:frontend"
+		case backend:
+			// The username does not match the token.
+			review.Status.Authenticated = true
+			review.Status.User.Username = "system:serviceaccount:web:frontend"
+		default:
+			review.Status.Error = "invalid bearer token"
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(review)
+	}))
+	defer srv.Close()
+
+	p.APIServer = srv.URL
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+
+	t.Run("ok", func(t *testing.T) {
+		signOpts, err := p.AuthorizeSign(context.Background(), frontend)
+		require.NoError(t, err)
+		assertK8sBoundSASANs(t, signOpts, []string{"frontend.web.svc", "frontend.web.svc.example.internal"})
+	})
+
+	t.Run("fail username", func(t *testing.T) {
+		_, err := p.AuthorizeSign(context.Background(), backend)
+		assertStatusCode(t, err, http.StatusUnauthorized)
+	})
+
+	t.Run("fail not authenticated", func(t *testing.T) {
+		_, err := p.AuthorizeSign(context.Background(), invalid)
+		assertStatusCode(t, err, http.StatusUnauthorized)
+	})
+
+	t.Run("fail credentials", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(tokenFile, []byte("other-token"), 0600))
+		_, err := p.AuthorizeSign(context.Background(), frontend)
+		assertStatusCode(t, err, http.StatusUnauthorized)
+	})
+}
+
+func TestK8sBoundSA_Init(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+
+	tests := []struct {
+		name    string
+		p       *K8sBoundSA
+		wantErr bool
+	}{
+		{"ok apiServer", &K8sBoundSA{Type: "K8sBoundSA", Name: "k8s", Issuer: "https://kubernetes.default.svc", APIServer: "https://kubernetes.default.svc"}, false},
+		{"fail type", &K8sBoundSA{Name: "k8s", Issuer: "https://kubernetes.default.svc", APIServer: "https://kubernetes.default.svc"}, true},
+		{"fail name", &K8sBoundSA{Type: "K8sBoundSA", Issuer: "https://kubernetes.default.svc", APIServer: "https://kubernetes.default.svc"}, true},
+		{"fail issuer", &K8sBoundSA{Type: "K8sBoundSA", Name: "k8s", APIServer: "https://kubernetes.default.svc"}, true},
+		{"fail apiServer", &K8sBoundSA{Type: "K8sBoundSA", Name: "k8s", Issuer: "https://kubernetes.default.svc", APIServer: "kubernetes.default.svc"}, true},
+		{"fail apiServerRoots", &K8sBoundSA{Type: "K8sBoundSA", Name: "k8s", Issuer: "https://kubernetes.default.svc", APIServer: "https://kubernetes.default.svc", APIServerRoots: []byte("foo")}, true},
+		{"fail discovery issuer", &K8sBoundSA{Type: "K8sBoundSA", Name: "k8s", Issuer: srv.URL}, true},
+		{"fail discovery", &K8sBoundSA{Type: "K8sBoundSA", Name: "k8s", Issuer: srv.URL + "/error"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences})
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "k8sbsa/k8s", tt.p.GetID())
+			assert.Equal(t, TypeK8sBoundSA, tt.p.GetType())
+		})
+	}
+}
@@ -92,6 +92,11 @@ func (p *K8sSA) GetEncryptedKey() (string, string, bool) {
 	return "", "", false
 }
 
+// GetOptions returns the configured provisioner options.
+func (p *K8sSA) GetOptions() *Options {
+	return p.Options
+}
+
 // Init initializes and validates the fields of a K8sSA type.
 func (p *K8sSA) Init(config Config) (err error) {
 	switch {
@@ -140,6 +145,7 @@ func (p *K8sSA) Init(config Config) (err error) {
 		p.kauthn = k8s.AuthenticationV1()
 	*/
 
+	p.Options = mergeOptions(p.Options, config.DefaultOptions, p.GetType())
 	p.ctl, err = NewController(p, p.Claims, config, p.Options)
 	return
 }
@@ -254,7 +260,7 @@ func (p *K8sSA) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) erro
 }
 
 // AuthorizeSSHSign validates an request for an SSH certificate.
-func (p *K8sSA) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, error) {
+func (p *K8sSA) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption, error) {
 	if !p.ctl.Claimer.IsSSHCAEnabled() {
 		return nil, errs.Unauthorized("k8ssa.AuthorizeSSHSign; sshCA is disabled for k8sSA provisioner '%s'", p.GetName())
 	}
@@ -269,6 +275,7 @@ func (p *K8sSA) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption,
 	if v, err := unsafeParseSigned(token); err == nil {
 		data.SetToken(v)
 	}
+	audit := newSSHAuditMetadata(ctx, p, claims.ServiceAccountName, data)
 
 	templateOptions, err := CustomSSHTemplateOptions(p.Options, data, sshutil.CertificateRequestTemplate)
 	if err != nil {
@@ -276,8 +283,14 @@ func (p *K8sSA) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption,
 	}
 	signOptions := []SignOption{templateOptions}
 
+	// Restrict the addresses from which the user certificates can be used.
+	if m := newSSHSourceAddressModifier(ctx, p.Options.GetSSHOptions()); m != nil {
+		signOptions = append(signOptions, m)
+	}
+
 	return append(signOptions,
 		p,
+		audit,
 		// Require type, key-id and principals in the SignSSHOptions.
 		&sshCertOptionsRequireValidator{CertType: true, KeyID: true, Principals: true},
 		// Set the validity bounds if not set.
@@ -370,7 +370,7 @@ func TestK8sSA_AuthorizeSSHSign(t *testing.T) {
 			} else {
 				if assert.Nil(t, tc.err) {
 					if assert.NotNil(t, opts) {
-						assert.Len(t, 9, opts)
+						assert.Len(t, 10, opts)
 						for _, o := range opts {
 							switch v := o.(type) {
 							case Interface:
@@ -388,6 +388,8 @@ func TestK8sSA_AuthorizeSSHSign(t *testing.T) {
 								assert.Equals(t, nil, v.hostPolicyEngine)
 							case *WebhookController:
 								assert.Len(t, 0, v.webhooks)
+							case *SSHAuditMetadata:
+								assert.Equals(t, tc.p.GetName(), v.Provisioner)
 							default:
 								assert.FatalError(t, fmt.Errorf("unexpected sign option of type %T", v))
 							}
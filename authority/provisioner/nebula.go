@@ -64,6 +64,7 @@ func (p *Nebula) Init(config Config) (err error) {
 	}
 
 	config.Audiences = config.Audiences.WithFragment(p.GetIDForToken())
+	p.Options = mergeOptions(p.Options, config.DefaultOptions, p.GetType())
 	p.ctl, err = NewController(p, p.Claims, config, p.Options)
 	return
 }
@@ -115,6 +116,11 @@ func (p *Nebula) GetEncryptedKey() (kid, key string, ok bool) {
 	return "", "", false
 }
 
+// GetOptions returns the configured provisioner options.
+func (p *Nebula) GetOptions() *Options {
+	return p.Options
+}
+
 // AuthorizeSign returns the list of SignOption for a Sign request.
 func (p *Nebula) AuthorizeSign(_ context.Context, token string) ([]SignOption, error) {
 	crt, claims, err := p.authorizeToken(token, p.ctl.Audiences.Sign)
@@ -171,7 +177,7 @@ func (p *Nebula) AuthorizeSign(_ context.Context, token string) ([]SignOption, e
 
 // AuthorizeSSHSign returns the list of SignOption for a SignSSH request.
 // Currently the Nebula provisioner only grants host SSH certificates.
-func (p *Nebula) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, error) {
+func (p *Nebula) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption, error) {
 	if !p.ctl.Claimer.IsSSHCAEnabled() {
 		return nil, errs.Unauthorized("ssh is disabled for nebula provisioner '%s'", p.Name)
 	}
@@ -241,6 +247,7 @@ func (p *Nebula) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption
 	if v, err := unsafeParseSigned(token); err == nil {
 		data.SetToken(v)
 	}
+	audit := newSSHAuditMetadata(ctx, p, claims.Subject, data)
 
 	// The Nebula certificate will be available using the template variable Crt.
 	// For example {{ .AuthorizationCrt.Details.Groups }} can be used to get all the groups.
@@ -253,6 +260,7 @@ func (p *Nebula) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption
 
 	return append(signOptions,
 		p,
+		audit,
 		templateOptions,
 		// Checks the validity bounds, and set the validity if has not been set.
 		&sshLimitDuration{p.ctl.Claimer, crt.Details.NotAfter},
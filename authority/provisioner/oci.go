@@ -0,0 +1,540 @@
+package provisioner
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/pemutil"
+	"go.step.sm/crypto/sshutil"
+	"go.step.sm/crypto/x509util"
+	"go.step.sm/linkedca"
+
+	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/certificates/webhook"
+)
+
+// ociIdentityURL is the base url of the instance identity in the OCI instance
+// metadata service.
+const ociIdentityURL = "http://169.254.169.254/opc/v2/identity"
+
+// Prefixes of the subject attributes of an OCI instance identity certificate.
+const (
+	ociCertTypePrefix    = "opc-certtype:"
+	ociInstancePrefix    = "opc-instance:"
+	ociCompartmentPrefix = "opc-compartment:"
+	ociTenantPrefix      = "opc-tenant:"
+	ociIdentityPrefix    = "opc-identity:"
+)
+
+// OCITemplateDataKey is the key used in the certificate templates to access
+// the identity of an OCI instance, e.g. {{ .OCI.CompartmentID }}.
+const OCITemplateDataKey = "OCI"
+
+// OCITemplateData is the identity of an OCI instance available in the X.509
+// and SSH certificate templates.
+type OCITemplateData struct {
+	// InstanceID is the OCID of the instance.
+	InstanceID string `json:"instanceID"`
+	// CompartmentID is the OCID of the compartment of the instance.
+	CompartmentID string `json:"compartmentID"`
+	// TenancyID is the OCID of the tenancy of the instance.
+	TenancyID string `json:"tenancyID"`
+}
+
+// ociPayload extends jwt.Claims with the SANs requested by the instance.
+type ociPayload struct {
+	jose.Claims
+	SANs     []string `json:"sans,omitempty"`
+	identity OCITemplateData
+	chains   [][]*x509.Certificate
+}
+
+type ociConfig struct {
+	identityURL string
+}
+
+func newOCIConfig() *ociConfig {
+	return &ociConfig{
+		identityURL: ociIdentityURL,
+	}
+}
+
+// OCI is the provisioner that supports the instance principals of Oracle Cloud
+// Infrastructure. The tokens are signed with the key of the instance identity
+// certificate, and the certificate and its intermediate are sent in the x5c
+// header. The certificate must chain to one of the configured Roots, and the
+// OCIDs of the instance, compartment and tenancy are read from its subject.
+// Resource principals are not supported.
+//
+// If DisableCustomSANs is true, only the instance OCID will be accepted as the
+// common name, and no SANs will be accepted. By default it will accept any SAN
+// in the CSR.
+//
+// If DisableTrustOnFirstUse is true, multiple sign request for this provisioner
+// with the same instance will be accepted. By default only the first request
+// will be accepted.
+//
+// Tenancies and Compartments restrict the OCIDs of the tenancies and
+// compartments of the instances allowed.
+//
+// OCI instance principals docs are available at
+// https://docs.oracle.com/en-us/iaas/Content/Identity/Tasks/callingservicesfrominstances.htm
+type OCI struct {
+	*base
+	ID                     string   `json:"-"`
+	Type                   string   `json:"type"`
+	Name                   string   `json:"name"`
+	Roots                  []byte   `json:"roots"`
+	Tenancies              []string `json:"tenancies,omitempty"`
+	Compartments           []string `json:"compartments,omitempty"`
+	DisableCustomSANs      bool     `json:"disableCustomSANs"`
+	DisableTrustOnFirstUse bool     `json:"disableTrustOnFirstUse"`
+	Claims                 *Claims  `json:"claims,omitempty"`
+	Options                *Options `json:"options,omitempty"`
+	config                 *ociConfig
+	rootPool               *x509.CertPool
+	ctl                    *Controller
+}
+
+// GetID returns the provisioner unique identifier.
+func (p *OCI) GetID() string {
+	if p.ID != "" {
+		return p.ID
+	}
+	return p.GetIDForToken()
+}
+
+// GetIDForToken returns an identifier that will be used to load the provisioner
+// from a token.
+func (p *OCI) GetIDForToken() string {
+	return "oci/" + p.Name
+}
+
+// GetTokenID returns the identifier of the token. The default value for OCI
+// is the SHA256 of "provisioner_id.instance_id", but if DisableTrustOnFirstUse
+// is set to true, then it will be the SHA256 of the token.
+func (p *OCI) GetTokenID(token string) (string, error) {
+	claims, err := p.authorizeToken(token)
+	if err != nil {
+		return "", err
+	}
+
+	// If TOFU is disabled create an ID for the token, so it cannot be reused.
+	if p.DisableTrustOnFirstUse {
+		sum := sha256.Sum256([]byte(token))
+		return strings.ToLower(hex.EncodeToString(sum[:])), nil
+	}
+
+	// Use provisioner + instance-id as the identifier.
+	return p.GetTOFUTokenID(claims.identity.InstanceID), nil
+}
+
+// GetTOFUInstanceID returns the OCID of the instance of the token.
+func (p *OCI) GetTOFUInstanceID(token string) (string, error) {
+	if p.DisableTrustOnFirstUse {
+		return "", nil
+	}
+	claims, err := p.authorizeToken(token)
+	if err != nil {
+		return "", err
+	}
+	return claims.identity.InstanceID, nil
+}
+
+// GetTOFUTokenID returns the SHA256 of "provisioner_id.instance_id".
+func (p *OCI) GetTOFUTokenID(instanceID string) string {
+	return tofuTokenID(fmt.Sprintf("%s.%s", p.GetIDForToken(), instanceID))
+}
+
+// GetName returns the name of the provisioner.
+func (p *OCI) GetName() string {
+	return p.Name
+}
+
+// GetType returns the type of provisioner.
+func (p *OCI) GetType() Type {
+	return TypeOCI
+}
+
+// GetEncryptedKey is not available in an OCI provisioner.
+func (p *OCI) GetEncryptedKey() (kid, key string, ok bool) {
+	return "", "", false
+}
+
+// GetOptions returns the configured provisioner options.
+func (p *OCI) GetOptions() *Options {
+	return p.Options
+}
+
+// GetIdentityToken retrieves the instance identity certificate from the
+// instance metadata service and returns a token signed with its key.
+func (p *OCI) GetIdentityToken(subject, caURL string) (string, error) {
+	// Initialize config if required
+	p.assertConfig()
+
+	audience, err := generateSignAudience(caURL, p.GetIDForToken())
+	if err != nil {
+		return "", err
+	}
+
+	var certs []*x509.Certificate
+	for _, name := range []string{"cert.pem", "intermediate.pem"} {
+		b, err := p.readIdentityMetadata(name)
+		if err != nil {
+			return "", err
+		}
+		crt, err := pemutil.ParseCertificate(b)
+		if err != nil {
+			return "", errors.Wrapf(err, "error parsing %s", name)
+		}
+		certs = append(certs, crt)
+	}
+	b, err := p.readIdentityMetadata("key.pem")
+	if err != nil {
+		return "", err
+	}
+	key, err := pemutil.ParseKey(b)
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing key.pem")
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return "", errors.New("error parsing key.pem: key is not a crypto.Signer")
+	}
+
+	identity, err := parseOCIInstanceIdentity(certs[0])
+	if err != nil {
+		return "", err
+	}
+	if subject == "" {
+		subject = identity.InstanceID
+	}
+
+	x5c := make([]string, len(certs))
+	for i, crt := range certs {
+		x5c[i] = base64.StdEncoding.EncodeToString(crt.Raw)
+	}
+	so := new(jose.SignerOptions).WithType("JWT").WithHeader("x5c", x5c)
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: signer}, so)
+	if err != nil {
+		return "", errors.Wrap(err, "error creating signer")
+	}
+
+	now := time.Now()
+	tok, err := jose.Signed(sig).Claims(ociPayload{
+		Claims: jose.Claims{
+			Issuer:    p.Name,
+			Subject:   subject,
+			Audience:  []string{audience},
+			Expiry:    jose.NewNumericDate(now.Add(5 * time.Minute)),
+			NotBefore: jose.NewNumericDate(now),
+			IssuedAt:  jose.NewNumericDate(now),
+		},
+	}).CompactSerialize()
+	if err != nil {
+		return "", errors.Wrap(err, "error serializing token")
+	}
+	return tok, nil
+}
+
+// readIdentityMetadata returns a file of the instance identity in the instance
+// metadata service.
+func (p *OCI) readIdentityMetadata(name string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, p.config.identityURL+"/"+name, http.NoBody)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating identity request")
+	}
+	req.Header.Set("Authorization", "Bearer Oracle")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error doing identity request, are you in an OCI instance?")
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading identity request response")
+	}
+	if resp.StatusCode >= 400 {
+		return nil, errors.Errorf("error on identity request: status=%d, response=%s", resp.StatusCode, b)
+	}
+	return b, nil
+}
+
+// Init validates and initializes the OCI provisioner.
+func (p *OCI) Init(config Config) (err error) {
+	switch {
+	case p.Type == "":
+		return errors.New("provisioner type cannot be empty")
+	case p.Name == "":
+		return errors.New("provisioner name cannot be empty")
+	case len(p.Roots) == 0:
+		return errors.New("provisioner root(s) cannot be empty")
+	}
+
+	certs, err := pemutil.ParseCertificateBundle(p.Roots)
+	if err != nil {
+		return errors.Wrap(err, "error parsing roots")
+	}
+	p.rootPool = x509.NewCertPool()
+	for _, crt := range certs {
+		p.rootPool.AddCert(crt)
+	}
+
+	// Initialize config
+	p.assertConfig()
+
+	config.Audiences = config.Audiences.WithFragment(p.GetIDForToken())
+	p.Options = mergeOptions(p.Options, config.DefaultOptions, p.GetType())
+	p.ctl, err = NewController(p, p.Claims, config, p.Options)
+	return
+}
+
+// assertConfig initializes the config if it has not been initialized.
+func (p *OCI) assertConfig() {
+	if p.config == nil {
+		p.config = newOCIConfig()
+	}
+}
+
+// parseOCIInstanceIdentity returns the OCIDs in the subject of an instance
+// identity certificate.
+func parseOCIInstanceIdentity(crt *x509.Certificate) (OCITemplateData, error) {
+	var certType string
+	var identity OCITemplateData
+	for _, name := range crt.Subject.Names {
+		v, ok := name.Value.(string)
+		if !ok {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(v, ociCertTypePrefix):
+			certType = strings.TrimPrefix(v, ociCertTypePrefix)
+		case strings.HasPrefix(v, ociInstancePrefix):
+			identity.InstanceID = strings.TrimPrefix(v, ociInstancePrefix)
+		case strings.HasPrefix(v, ociCompartmentPrefix):
+			identity.CompartmentID = strings.TrimPrefix(v, ociCompartmentPrefix)
+		case strings.HasPrefix(v, ociTenantPrefix):
+			identity.TenancyID = strings.TrimPrefix(v, ociTenantPrefix)
+		case strings.HasPrefix(v, ociIdentityPrefix) && identity.TenancyID == "":
+			identity.TenancyID = strings.TrimPrefix(v, ociIdentityPrefix)
+		}
+	}
+
+	switch {
+	case certType != "instance":
+		return identity, errors.Errorf("certificate type %q is not an instance principal", certType)
+	case identity.InstanceID == "":
+		return identity, errors.New("certificate does not contain the instance id")
+	case identity.CompartmentID == "":
+		return identity, errors.New("certificate does not contain the compartment id")
+	case identity.TenancyID == "":
+		return identity, errors.New("certificate does not contain the tenancy id")
+	}
+	return identity, nil
+}
+
+// authorizeToken verifies the instance identity certificate in the token, and
+// validates the token using its key.
+func (p *OCI) authorizeToken(token string) (*ociPayload, error) {
+	jwt, err := jose.ParseSigned(token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "oci.authorizeToken; error parsing oci token")
+	}
+	if len(jwt.Headers) == 0 {
+		return nil, errs.Unauthorized("oci.authorizeToken; error parsing oci token - header is missing")
+	}
+
+	verifiedChains, err := jwt.Headers[0].Certificates(x509.VerifyOptions{
+		Roots:       p.rootPool,
+		CurrentTime: time.Now().Truncate(time.Second),
+		KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err,
+			"oci.authorizeToken; error verifying oci instance certificate chain in token")
+	}
+	leaf := verifiedChains[0][0]
+	identity, err := parseOCIInstanceIdentity(leaf)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "oci.authorizeToken; invalid oci instance certificate")
+	}
+
+	// Using the key of the instance certificate to validate the claims
+	// asserts that the token has been signed by the instance.
+	var claims ociPayload
+	if err = jwt.Claims(leaf.PublicKey, &claims); err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "oci.authorizeToken; error parsing oci claims")
+	}
+
+	// According to "rfc7519 JSON Web Token" acceptable skew should be no
+	// more than a few minutes.
+	if err = claims.ValidateWithLeeway(jose.Expected{
+		Issuer: p.Name,
+		Time:   time.Now().UTC(),
+	}, time.Minute); err != nil {
+		return nil, errs.Wrapf(http.StatusUnauthorized, err, "oci.authorizeToken; invalid oci claims")
+	}
+	if claims.Expiry == nil {
+		return nil, errs.Unauthorized("oci.authorizeToken; oci token must contain an exp claim")
+	}
+
+	// validate audiences with the defaults
+	if !matchesAudience(claims.Audience, p.ctl.Audiences.Sign) {
+		return nil, errs.Unauthorized("oci.authorizeToken; invalid oci token - invalid audience claim (aud)")
+	}
+
+	// validate tenancies and compartments
+	if len(p.Tenancies) > 0 && !slices.Contains(p.Tenancies, identity.TenancyID) {
+		return nil, errs.Unauthorized("oci.authorizeToken; invalid oci token - invalid tenancy id")
+	}
+	if len(p.Compartments) > 0 && !slices.Contains(p.Compartments, identity.CompartmentID) {
+		return nil, errs.Unauthorized("oci.authorizeToken; invalid oci token - invalid compartment id")
+	}
+
+	claims.identity = identity
+	claims.chains = verifiedChains
+	return &claims, nil
+}
+
+// AuthorizeSign validates the given token and returns the sign options that
+// will be used on certificate creation.
+func (p *OCI) AuthorizeSign(ctx context.Context, token string) ([]SignOption, error) {
+	claims, err := p.authorizeToken(token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "oci.AuthorizeSign")
+	}
+
+	identity := claims.identity
+
+	// Template options
+	data := x509util.NewTemplateData()
+	data.SetCommonName(identity.InstanceID)
+	if v, err := unsafeParseSigned(token); err == nil {
+		data.SetToken(v)
+	}
+	data.SetAuthorizationCertificate(claims.chains[0][0])
+	data.SetAuthorizationCertificateChain(claims.chains[0])
+	data.Set(OCITemplateDataKey, identity)
+
+	// Enforce known CN and no SANs if configured. By default we'll accept the
+	// CN and SANs in the CSR. There's no way to trust them other than TOFU.
+	var so []SignOption
+	if p.DisableCustomSANs {
+		so = append(so,
+			commonNameValidator(identity.InstanceID),
+			dnsNamesValidator(nil),
+			ipAddressesValidator(nil),
+			emailAddressesValidator(nil),
+			newURIsValidator(ctx, nil),
+		)
+		data.SetSANs([]string{})
+	}
+
+	templateOptions, err := CustomTemplateOptions(p.Options, data, x509util.DefaultIIDLeafTemplate)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "oci.AuthorizeSign")
+	}
+
+	return append(so,
+		p,
+		templateOptions,
+		// modifiers / withOptions
+		newProvisionerExtensionOption(TypeOCI, p.Name, identity.TenancyID, "InstanceID", identity.InstanceID, "CompartmentID", identity.CompartmentID).WithControllerOptions(p.ctl),
+		profileDefaultDuration(p.ctl.Claimer.DefaultTLSCertDuration()),
+		// validators
+		defaultPublicKeyValidator{},
+		newValidityValidator(p.ctl.Claimer.MinTLSCertDuration(), p.ctl.Claimer.MaxTLSCertDuration()),
+		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
+		p.ctl.newWebhookController(
+			data,
+			linkedca.Webhook_X509,
+			webhook.WithAuthorizationPrincipal(identity.InstanceID),
+		),
+	), nil
+}
+
+// AuthorizeRenew returns an error if the renewal is disabled.
+func (p *OCI) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) error {
+	return p.ctl.AuthorizeRenew(ctx, cert)
+}
+
+// AuthorizeSSHSign returns the list of SignOption for a SignSSH request. Only
+// host certificates are supported.
+func (p *OCI) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption, error) {
+	if !p.ctl.Claimer.IsSSHCAEnabled() {
+		return nil, errs.Unauthorized("oci.AuthorizeSSHSign; sshCA is disabled for oci provisioner '%s'", p.GetName())
+	}
+	claims, err := p.authorizeToken(token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "oci.AuthorizeSSHSign")
+	}
+
+	identity := claims.identity
+	signOptions := []SignOption{}
+
+	// Enforce host certificate.
+	defaults := SignSSHOptions{
+		CertType: SSHHostCert,
+	}
+
+	// Only enforce known principals if disable custom sans is true.
+	principals := []string{identity.InstanceID}
+	if p.DisableCustomSANs {
+		defaults.Principals = principals
+	} else {
+		// Check that at least one principal is sent in the request.
+		signOptions = append(signOptions, &sshCertOptionsRequireValidator{
+			Principals: true,
+		})
+	}
+
+	// Certificate templates.
+	data := sshutil.CreateTemplateData(sshutil.HostCert, identity.InstanceID, principals)
+	if v, err := unsafeParseSigned(token); err == nil {
+		data.SetToken(v)
+	}
+	data.Set(OCITemplateDataKey, identity)
+	audit := newSSHAuditMetadata(ctx, p, identity.InstanceID, data)
+
+	templateOptions, err := CustomSSHTemplateOptions(p.Options, data, sshutil.DefaultIIDTemplate)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "oci.AuthorizeSSHSign")
+	}
+	signOptions = append(signOptions, templateOptions)
+
+	return append(signOptions,
+		p,
+		audit,
+		// Validate user SignSSHOptions.
+		sshCertOptionsValidator(defaults),
+		// Set the validity bounds if not set.
+		&sshDefaultDuration{p.ctl.Claimer},
+		// Validate public key
+		&sshDefaultPublicKeyValidator{},
+		// Validate the validity period.
+		&sshCertValidityValidator{p.ctl.Claimer},
+		// Require all the fields in the SSH certificate
+		&sshCertDefaultValidator{},
+		// Ensure that all principal names are allowed
+		newSSHNamePolicyValidator(p.ctl.getPolicy().getSSHHost(), nil),
+		// Call webhooks
+		p.ctl.newWebhookController(
+			data,
+			linkedca.Webhook_SSH,
+			webhook.WithAuthorizationPrincipal(identity.InstanceID),
+		),
+	), nil
+}
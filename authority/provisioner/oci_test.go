@@ -0,0 +1,258 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/minica"
+)
+
+const (
+	testOCIInstanceID    = "ocid1.instance.oc1.iad.abc"
+	testOCICompartmentID = "ocid1.compartment.oc1..def"
+	testOCITenancyID     = "ocid1.tenancy.oc1..ghi"
+)
+
+func generateOCIInstanceCertificate(t *testing.T, ca *minica.CA, ou ...string) (*x509.Certificate, *rsa.PrivateKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	crt, err := ca.Sign(&x509.Certificate{
+		Subject: pkix.Name{
+			CommonName:         testOCIInstanceID,
+			OrganizationalUnit: ou,
+		},
+		PublicKey:   key.Public(),
+		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	require.NoError(t, err)
+	return crt, key
+}
+
+func generateOCIToken(t *testing.T, p *OCI, aud string, certs []*x509.Certificate, key *rsa.PrivateKey) string {
+	t.Helper()
+	x5c := make([]string, len(certs))
+	for i, crt := range certs {
+		x5c[i] = base64.StdEncoding.EncodeToString(crt.Raw)
+	}
+	sig, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.RS256, Key: key},
+		new(jose.SignerOptions).WithType("JWT").WithHeader("x5c", x5c),
+	)
+	require.NoError(t, err)
+
+	now := time.Now()
+	tok, err := jose.Signed(sig).Claims(jose.Claims{
+		Issuer:    p.Name,
+		Subject:   testOCIInstanceID,
+		Audience:  []string{aud},
+		Expiry:    jose.NewNumericDate(now.Add(5 * time.Minute)),
+		NotBefore: jose.NewNumericDate(now),
+		IssuedAt:  jose.NewNumericDate(now),
+	}).CompactSerialize()
+	require.NoError(t, err)
+	return tok
+}
+
+func generateOCI(t *testing.T) (*OCI, *minica.CA) {
+	t.Helper()
+	ca, err := minica.New()
+	require.NoError(t, err)
+	p := &OCI{
+		Type:  "OCI",
+		Name:  "oci",
+		Roots: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Root.Raw}),
+	}
+	require.NoError(t, p.Init(Config{
+		Claims:    globalProvisionerClaims,
+		Audiences: testAudiences,
+	}))
+	return p, ca
+}
+
+func TestOCI_Init(t *testing.T) {
+	config := Config{
+		Claims:    globalProvisionerClaims,
+		Audiences: testAudiences,
+	}
+	p, _ := generateOCI(t)
+	assert.Equal(t, "oci/oci", p.GetID())
+	assert.Equal(t, TypeOCI, p.GetType())
+
+	assert.EqualError(t, (&OCI{Name: "oci"}).Init(config), "provisioner type cannot be empty")
+	assert.EqualError(t, (&OCI{Type: "OCI"}).Init(config), "provisioner name cannot be empty")
+	assert.EqualError(t, (&OCI{Type: "OCI", Name: "oci"}).Init(config), "provisioner root(s) cannot be empty")
+	assert.Error(t, (&OCI{Type: "OCI", Name: "oci", Roots: []byte("foo")}).Init(config))
+}
+
+func TestOCI_authorizeToken(t *testing.T) {
+	p, ca := generateOCI(t)
+	otherCA, err := minica.New()
+	require.NoError(t, err)
+
+	ou := []string{
+		"opc-certtype:instance",
+		"opc-instance:" + testOCIInstanceID,
+		"opc-compartment:" + testOCICompartmentID,
+		"opc-tenant:" + testOCITenancyID,
+	}
+	crt, key := generateOCIInstanceCertificate(t, ca, ou...)
+	certs := []*x509.Certificate{crt, ca.Intermediate}
+	aud := p.ctl.Audiences.Sign[0]
+
+	legacyCrt, legacyKey := generateOCIInstanceCertificate(t, ca, ou[0], ou[1], ou[2], "opc-identity:"+testOCITenancyID)
+	otherCrt, otherKey := generateOCIInstanceCertificate(t, otherCA, ou...)
+	resourceCrt, resourceKey := generateOCIInstanceCertificate(t, ca, "opc-certtype:resource", ou[1], ou[2], ou[3])
+	noCompartmentCrt, noCompartmentKey := generateOCIInstanceCertificate(t, ca, ou[0], ou[1], ou[3])
+
+	tests := []struct {
+		name         string
+		token        string
+		tenancies    []string
+		compartments []string
+		wantErr      bool
+	}{
+		{"ok", generateOCIToken(t, p, aud, certs, key), nil, nil, false},
+		{"ok allowed", generateOCIToken(t, p, aud, certs, key), []string{testOCITenancyID}, []string{testOCICompartmentID}, false},
+		{"ok legacy identity", generateOCIToken(t, p, aud, []*x509.Certificate{legacyCrt, ca.Intermediate}, legacyKey), nil, nil, false},
+		{"fail root", generateOCIToken(t, p, aud, []*x509.Certificate{otherCrt, otherCA.Intermediate}, otherKey), nil, nil, true},
+		{"fail key", generateOCIToken(t, p, aud, certs, otherKey), nil, nil, true},
+		{"fail audience", generateOCIToken(t, p, "https://ca.example.com/1.0/sign", certs, key), nil, nil, true},
+		{"fail resource principal", generateOCIToken(t, p, aud, []*x509.Certificate{resourceCrt, ca.Intermediate}, resourceKey), nil, nil, true},
+		{"fail no compartment", generateOCIToken(t, p, aud, []*x509.Certificate{noCompartmentCrt, ca.Intermediate}, noCompartmentKey), nil, nil, true},
+		{"fail tenancy", generateOCIToken(t, p, aud, certs, key), []string{"ocid1.tenancy.oc1..other"}, nil, true},
+		{"fail compartment", generateOCIToken(t, p, aud, certs, key), nil, []string{"ocid1.compartment.oc1..other"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p.Tenancies = tt.tenancies
+			p.Compartments = tt.compartments
+
+			claims, err := p.authorizeToken(tt.token)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, OCITemplateData{
+				InstanceID:    testOCIInstanceID,
+				CompartmentID: testOCICompartmentID,
+				TenancyID:     testOCITenancyID,
+			}, claims.identity)
+
+			id, err := p.GetTokenID(tt.token)
+			require.NoError(t, err)
+			assert.Equal(t, p.GetTOFUTokenID(testOCIInstanceID), id)
+
+			instanceID, err := p.GetTOFUInstanceID(tt.token)
+			require.NoError(t, err)
+			assert.Equal(t, testOCIInstanceID, instanceID)
+		})
+	}
+}
+
+func TestOCI_AuthorizeSign(t *testing.T) {
+	p, ca := generateOCI(t)
+	crt, key := generateOCIInstanceCertificate(t, ca,
+		"opc-certtype:instance",
+		"opc-instance:"+testOCIInstanceID,
+		"opc-compartment:"+testOCICompartmentID,
+		"opc-tenant:"+testOCITenancyID,
+	)
+	token := generateOCIToken(t, p, p.ctl.Audiences.Sign[0], []*x509.Certificate{crt, ca.Intermediate}, key)
+
+	opts, err := p.AuthorizeSign(context.Background(), token)
+	require.NoError(t, err)
+	assert.NotContains(t, opts, commonNameValidator(testOCIInstanceID))
+
+	p.DisableCustomSANs = true
+	opts, err = p.AuthorizeSign(context.Background(), token)
+	require.NoError(t, err)
+	assert.Contains(t, opts, commonNameValidator(testOCIInstanceID))
+
+	p.DisableTrustOnFirstUse = true
+	id, err := p.GetTokenID(token)
+	require.NoError(t, err)
+	assert.NotEqual(t, p.GetTOFUTokenID(testOCIInstanceID), id)
+	instanceID, err := p.GetTOFUInstanceID(token)
+	require.NoError(t, err)
+	assert.Empty(t, instanceID)
+}
+
+func TestOCI_AuthorizeSSHSign(t *testing.T) {
+	p, ca := generateOCI(t)
+	crt, key := generateOCIInstanceCertificate(t, ca,
+		"opc-certtype:instance",
+		"opc-instance:"+testOCIInstanceID,
+		"opc-compartment:"+testOCICompartmentID,
+		"opc-tenant:"+testOCITenancyID,
+	)
+	certs := []*x509.Certificate{crt, ca.Intermediate}
+
+	_, err := p.AuthorizeSSHSign(context.Background(), generateOCIToken(t, p, "https://ca.example.com/1.0/sign", certs, key))
+	assert.Error(t, err)
+
+	opts, err := p.AuthorizeSSHSign(context.Background(), generateOCIToken(t, p, p.ctl.Audiences.Sign[0], certs, key))
+	require.NoError(t, err)
+	assert.Contains(t, opts, sshCertOptionsValidator(SignSSHOptions{CertType: SSHHostCert}))
+
+	p.DisableCustomSANs = true
+	opts, err = p.AuthorizeSSHSign(context.Background(), generateOCIToken(t, p, p.ctl.Audiences.Sign[0], certs, key))
+	require.NoError(t, err)
+	assert.Contains(t, opts, sshCertOptionsValidator(SignSSHOptions{
+		CertType:   SSHHostCert,
+		Principals: []string{testOCIInstanceID},
+	}))
+}
+
+func TestOCI_GetIdentityToken(t *testing.T) {
+	p, ca := generateOCI(t)
+	crt, key := generateOCIInstanceCertificate(t, ca,
+		"opc-certtype:instance",
+		"opc-instance:"+testOCIInstanceID,
+		"opc-compartment:"+testOCICompartmentID,
+		"opc-tenant:"+testOCITenancyID,
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer Oracle" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/cert.pem":
+			w.Write(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: crt.Raw}))
+		case "/intermediate.pem":
+			w.Write(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Intermediate.Raw}))
+		case "/key.pem":
+			w.Write(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	p.config.identityURL = srv.URL
+
+	token, err := p.GetIdentityToken("", "https://ca.smallstep.com")
+	require.NoError(t, err)
+	claims, err := p.authorizeToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, testOCIInstanceID, claims.Subject)
+
+	p.config.identityURL = srv.URL + "/missing"
+	_, err = p.GetIdentityToken("", "https://ca.smallstep.com")
+	assert.Error(t, err)
+}
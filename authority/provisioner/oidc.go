@@ -4,10 +4,12 @@ import (
 	"context"
 	"crypto/x509"
 	"encoding/json"
+	"io"
 	"net"
 	"net/http"
 	"net/url"
 	"path"
+	"slices"
 	"strings"
 	"time"
 
@@ -50,6 +52,20 @@ type openIDPayload struct {
 	Hd              string   `json:"hd"`
 	Nonce           string   `json:"nonce"`
 	Groups          []string `json:"groups"`
+	// AuthenticationMethods are the authentication methods used by the user,
+	// e.g. pwd, otp or mfa.
+	AuthenticationMethods []string `json:"amr"`
+	// introspected contains the claims returned by the introspection endpoint
+	// if the token was an opaque access token.
+	introspected map[string]interface{}
+}
+
+// introspectionResponse is the response of an OAuth 2.0 Token Introspection
+// endpoint, as defined in RFC 7662.
+type introspectionResponse struct {
+	openIDPayload
+	Active   bool   `json:"active"`
+	ClientID string `json:"client_id"`
 }
 
 func (o *openIDPayload) IsAdmin(admins []string) bool {
@@ -93,11 +109,137 @@ type OIDC struct {
 	ListenAddress         string   `json:"listenAddress,omitempty"`
 	Claims                *Claims  `json:"claims,omitempty"`
 	Options               *Options `json:"options,omitempty"`
+	// ClaimMappings adds X.509 SANs and SSH principals to the certificates of
+	// the users with the given values in the ID token claims.
+	ClaimMappings []*OIDCClaimMapping `json:"claimMappings,omitempty"`
+	// DeviceAuthorization enables the tokens obtained using the OAuth 2.0
+	// Device Authorization Grant (RFC 8628), so headless servers can request
+	// certificates authorized by a user in a different device.
+	DeviceAuthorization *OIDCDeviceAuthorization `json:"deviceAuthorization,omitempty"`
+	// IntrospectionEndpoint enables the use of opaque access tokens. These
+	// tokens are validated using the OAuth 2.0 Token Introspection endpoint
+	// (RFC 7662) of the identity provider, authenticated with the clientID and
+	// clientSecret. Opaque tokens do not identify their provisioner, requests
+	// using them must set the name of the provisioner in the
+	// X-Step-Provisioner header.
+	IntrospectionEndpoint string `json:"introspectionEndpoint,omitempty"`
 	configuration         openIDConfiguration
 	keyStore              *keyStore
+	introspectionClient   *http.Client
 	ctl                   *Controller
 }
 
+// OIDCClaimMapping maps a value of an ID token claim to the X.509 SANs and SSH
+// principals added to the certificates of the users with that value. The claim
+// can be a string or a list of strings, e.g. the groups or roles claims.
+type OIDCClaimMapping struct {
+	Claim      string   `json:"claim"`
+	Value      string   `json:"value"`
+	SANs       []string `json:"sans,omitempty"`
+	Principals []string `json:"principals,omitempty"`
+}
+
+// Validate validates the claim mapping.
+func (m *OIDCClaimMapping) Validate() error {
+	switch {
+	case m == nil:
+		return errors.New("claimMappings cannot contain an empty mapping")
+	case m.Claim == "":
+		return errors.New("claimMappings claim cannot be empty")
+	case m.Value == "":
+		return errors.Errorf("claimMappings value for claim %q cannot be empty", m.Claim)
+	case len(m.SANs) == 0 && len(m.Principals) == 0:
+		return errors.Errorf("claimMappings for %s=%s must contain sans or principals", m.Claim, m.Value)
+	default:
+		return nil
+	}
+}
+
+// OIDCDeviceAuthorization configures the validation of the tokens obtained
+// using the OAuth 2.0 Device Authorization Grant.
+//
+// ClientID is the client used in the device flow, if it's not set the clientID
+// of the provisioner is used, and all the tokens issued to it will be validated
+// as device flow tokens. AuthenticationMethods, if set, requires the amr claim
+// of the tokens to contain at least one of the given methods.
+type OIDCDeviceAuthorization struct {
+	ClientID              string   `json:"clientID,omitempty"`
+	AuthenticationMethods []string `json:"authenticationMethods,omitempty"`
+}
+
+// Validate validates the device authorization options.
+func (d *OIDCDeviceAuthorization) Validate() error {
+	for _, m := range d.AuthenticationMethods {
+		if m == "" {
+			return errors.New("deviceAuthorization authenticationMethods cannot contain an empty value")
+		}
+	}
+	return nil
+}
+
+// getClientID returns the client id used in the device flow.
+func (d *OIDCDeviceAuthorization) getClientID(defaultClientID string) string {
+	if d.ClientID != "" {
+		return d.ClientID
+	}
+	return defaultClientID
+}
+
+// validatePayload validates the claims specific to the device flow tokens.
+func (d *OIDCDeviceAuthorization) validatePayload(p openIDPayload) error {
+	// The authorized party is required if the token has multiple audiences.
+	if len(p.Audience) > 1 && p.AuthorizedParty == "" {
+		return errs.Unauthorized("validatePayload: failed to validate oidc token payload: azp not found")
+	}
+	if len(d.AuthenticationMethods) == 0 {
+		return nil
+	}
+	for _, m := range p.AuthenticationMethods {
+		if slices.Contains(d.AuthenticationMethods, m) {
+			return nil
+		}
+	}
+	return errs.Unauthorized("validatePayload: failed to validate oidc token payload: invalid amr")
+}
+
+// matches returns true if the value of the claim in the given token claims is
+// the mapping value, or contains it if it's a list.
+func (m *OIDCClaimMapping) matches(claims map[string]interface{}) bool {
+	switch v := claims[m.Claim].(type) {
+	case string:
+		return v == m.Value
+	case []interface{}:
+		for _, vv := range v {
+			if s, ok := vv.(string); ok && s == m.Value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// mapClaims returns the SANs and SSH principals of the claim mappings matching
+// the given token claims.
+func (o *OIDC) mapClaims(claims map[string]interface{}) (sans, principals []string) {
+	for _, m := range o.ClaimMappings {
+		if m.matches(claims) {
+			sans = appendUnique(sans, m.SANs...)
+			principals = appendUnique(principals, m.Principals...)
+		}
+	}
+	return
+}
+
+// appendUnique appends to s the values not already present.
+func appendUnique(s []string, values ...string) []string {
+	for _, v := range values {
+		if !slices.Contains(s, v) {
+			s = append(s, v)
+		}
+	}
+	return s
+}
+
 func sanitizeEmail(email string) string {
 	if i := strings.LastIndex(email, "@"); i >= 0 {
 		email = email[:i] + strings.ToLower(email[i:])
@@ -120,12 +262,27 @@ func (o *OIDC) GetIDForToken() string {
 	return o.ClientID
 }
 
+// additionalClientIDs returns the client id of the device authorization
+// grant if it's different than the clientID.
+func (o *OIDC) additionalClientIDs() []string {
+	if o.DeviceAuthorization != nil {
+		if clientID := o.DeviceAuthorization.getClientID(o.ClientID); clientID != o.ClientID {
+			return []string{clientID}
+		}
+	}
+	return nil
+}
+
 // GetTokenID returns the provisioner unique identifier, the OIDC provisioner the
 // uses the clientID for this.
 func (o *OIDC) GetTokenID(ott string) (string, error) {
 	// Validate payload
 	token, err := jose.ParseSigned(ott)
 	if err != nil {
+		// Opaque tokens do not have a nonce, the hash of the token will be used.
+		if o.IntrospectionEndpoint != "" {
+			return "", nil
+		}
 		return "", errors.Wrap(err, "error parsing token")
 	}
 
@@ -154,6 +311,11 @@ func (o *OIDC) GetEncryptedKey() (kid, key string, ok bool) {
 	return "", "", false
 }
 
+// GetOptions returns the configured provisioner options.
+func (o *OIDC) GetOptions() *Options {
+	return o.Options
+}
+
 // Init validates and initializes the OIDC provider.
 func (o *OIDC) Init(config Config) (err error) {
 	switch {
@@ -167,6 +329,30 @@ func (o *OIDC) Init(config Config) (err error) {
 		return errors.New("configurationEndpoint cannot be empty")
 	}
 
+	for _, m := range o.ClaimMappings {
+		if err := m.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if o.DeviceAuthorization != nil {
+		if err := o.DeviceAuthorization.Validate(); err != nil {
+			return err
+		}
+	}
+
+	// Validate introspectionEndpoint if given
+	if o.IntrospectionEndpoint != "" {
+		u, err := url.Parse(o.IntrospectionEndpoint)
+		if err != nil {
+			return errors.Wrap(err, "error parsing introspectionEndpoint")
+		}
+		if u.Scheme != "https" && u.Scheme != "http" {
+			return errors.Errorf("introspectionEndpoint %q is not a valid url", o.IntrospectionEndpoint)
+		}
+		o.introspectionClient = newIntrospectionClient(config.WebhookClient)
+	}
+
 	// Validate listenAddress if given
 	if o.ListenAddress != "" {
 		if _, _, err := net.SplitHostPort(o.ListenAddress); err != nil {
@@ -198,27 +384,45 @@ func (o *OIDC) Init(config Config) (err error) {
 		return err
 	}
 
+	o.Options = mergeOptions(o.Options, config.DefaultOptions, o.GetType())
 	o.ctl, err = NewController(o, o.Claims, config, o.Options)
 	return
 }
 
 // ValidatePayload validates the given token payload.
 func (o *OIDC) ValidatePayload(p openIDPayload) error {
+	// Tokens obtained using the device authorization grant can be issued to a
+	// different client.
+	clientID := o.ClientID
+	isDeviceAuthorization := false
+	if o.DeviceAuthorization != nil {
+		if id := o.DeviceAuthorization.getClientID(o.ClientID); p.Audience.Contains(id) {
+			clientID, isDeviceAuthorization = id, true
+		}
+	}
+
 	// According to "rfc7519 JSON Web Token" acceptable skew should be no more
 	// than a few minutes.
 	if err := p.ValidateWithLeeway(jose.Expected{
 		Issuer:   o.configuration.Issuer,
-		Audience: jose.Audience{o.ClientID},
+		Audience: jose.Audience{clientID},
 		Time:     time.Now().UTC(),
 	}, time.Minute); err != nil {
 		return errs.Wrap(http.StatusUnauthorized, err, "validatePayload: failed to validate oidc token payload")
 	}
 
 	// Validate azp if present
-	if p.AuthorizedParty != "" && p.AuthorizedParty != o.ClientID {
+	if p.AuthorizedParty != "" && p.AuthorizedParty != clientID {
 		return errs.Unauthorized("validatePayload: failed to validate oidc token payload: invalid azp")
 	}
 
+	// Validate azp and amr in device flow tokens
+	if isDeviceAuthorization {
+		if err := o.DeviceAuthorization.validatePayload(p); err != nil {
+			return err
+		}
+	}
+
 	// Validate domains (case-insensitive)
 	if p.Email != "" && len(o.Domains) > 0 && !p.IsAdmin(o.Admins) {
 		email := sanitizeEmail(p.Email)
@@ -258,6 +462,9 @@ func (o *OIDC) ValidatePayload(p openIDPayload) error {
 func (o *OIDC) authorizeToken(token string) (*openIDPayload, error) {
 	jwt, err := jose.ParseSigned(token)
 	if err != nil {
+		if o.IntrospectionEndpoint != "" {
+			return o.authorizeOpaqueToken(token)
+		}
 		return nil, errs.Wrap(http.StatusUnauthorized, err,
 			"oidc.AuthorizeToken; error parsing oidc token")
 	}
@@ -289,6 +496,94 @@ func (o *OIDC) authorizeToken(token string) (*openIDPayload, error) {
 	return &claims, nil
 }
 
+// authorizeOpaqueToken validates an opaque access token using the introspection
+// endpoint and applies the same payload validations used in ID tokens.
+func (o *OIDC) authorizeOpaqueToken(token string) (*openIDPayload, error) {
+	claims, err := o.introspectToken(token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err,
+			"oidc.AuthorizeToken; cannot validate oidc access token")
+	}
+
+	if err := o.ValidatePayload(*claims); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "oidc.AuthorizeToken")
+	}
+
+	return claims, nil
+}
+
+// introspectToken sends the token to the introspection endpoint and returns
+// the claims of the token if the identity provider reports it as active and it
+// was issued for the clientID of the provisioner.
+func (o *OIDC) introspectToken(token string) (*openIDPayload, error) {
+	if o.IntrospectionEndpoint == "" {
+		return nil, errors.New("token introspection is not enabled")
+	}
+
+	form := url.Values{
+		"token":           []string{token},
+		"token_type_hint": []string{"access_token"},
+	}
+	req, err := http.NewRequest(http.MethodPost, o.IntrospectionEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error creating request to %s", o.IntrospectionEndpoint)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	// RFC 6749, section 2.3.1; the client credentials are form-urlencoded.
+	req.SetBasicAuth(url.QueryEscape(o.ClientID), url.QueryEscape(o.ClientSecret))
+
+	client := o.introspectionClient
+	if client == nil {
+		client = newIntrospectionClient(nil)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to connect to %s", o.IntrospectionEndpoint)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("error introspecting token: %s returned status code %d", o.IntrospectionEndpoint, resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxIntrospectionResponseSize))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", o.IntrospectionEndpoint)
+	}
+
+	var r introspectionResponse
+	if err := json.Unmarshal(body, &r); err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", o.IntrospectionEndpoint)
+	}
+	if !r.Active {
+		return nil, errors.New("token is not active")
+	}
+	if r.ClientID != o.ClientID && !slices.Contains(r.Audience, o.ClientID) {
+		return nil, errors.New("token was not issued for the provisioner clientID")
+	}
+	if err := json.Unmarshal(body, &r.introspected); err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", o.IntrospectionEndpoint)
+	}
+
+	// The issuer and audience are optional in an introspection response, but
+	// the client has been validated above.
+	if r.Issuer == "" {
+		r.Issuer = o.configuration.Issuer
+	}
+	r.Audience = jose.Audience{o.ClientID}
+
+	return &r.openIDPayload, nil
+}
+
+// tokenClaims returns the claims of the token available to the templates and
+// claim mappings. These are the introspected claims if the token is opaque.
+func tokenClaims(token string, claims *openIDPayload) (map[string]interface{}, error) {
+	if claims.introspected != nil {
+		return claims.introspected, nil
+	}
+	return unsafeParseSigned(token)
+}
+
 // AuthorizeRevoke returns an error if the provisioner does not have rights to
 // revoke the certificate with serial number in the `sub` property.
 // Only tokens generated by an admin have the right to revoke a certificate.
@@ -330,8 +625,15 @@ func (o *OIDC) AuthorizeSign(_ context.Context, token string) ([]SignOption, err
 		sans = append(sans, iss.String())
 	}
 
+	// Add the SANs mapped from the token claims.
+	v, tokenErr := tokenClaims(token, claims)
+	if tokenErr == nil {
+		mappedSANs, _ := o.mapClaims(v)
+		sans = appendUnique(sans, mappedSANs...)
+	}
+
 	data := x509util.CreateTemplateData(claims.Subject, sans)
-	if v, err := unsafeParseSigned(token); err == nil {
+	if tokenErr == nil {
 		data.SetToken(v)
 	}
 
@@ -384,12 +686,18 @@ func (o *OIDC) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption
 		return nil, errs.Unauthorized("oidc.AuthorizeSSHSign: failed to validate oidc token payload: subject not found")
 	}
 
+	// Principals mapped from the token claims.
+	var mappedPrincipals []string
+	if v, err := tokenClaims(token, claims); err == nil {
+		_, mappedPrincipals = o.mapClaims(v)
+	}
+
 	var data sshutil.TemplateData
 	if claims.Email == "" {
 		// If email is empty, use the Subject claim instead to create minimal
 		// data for the template to use.
-		data = sshutil.CreateTemplateData(sshutil.UserCert, claims.Subject, nil)
-		if v, err := unsafeParseSigned(token); err == nil {
+		data = sshutil.CreateTemplateData(sshutil.UserCert, claims.Subject, mappedPrincipals)
+		if v, err := tokenClaims(token, claims); err == nil {
 			data.SetToken(v)
 		}
 	} else {
@@ -402,8 +710,8 @@ func (o *OIDC) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption
 		}
 
 		// Certificate templates.
-		data = sshutil.CreateTemplateData(sshutil.UserCert, claims.Email, iden.Usernames)
-		if v, err := unsafeParseSigned(token); err == nil {
+		data = sshutil.CreateTemplateData(sshutil.UserCert, claims.Email, appendUnique(iden.Usernames, mappedPrincipals...))
+		if v, err := tokenClaims(token, claims); err == nil {
 			data.SetToken(v)
 		}
 		// Add custom extensions added in the identity function.
@@ -424,6 +732,21 @@ func (o *OIDC) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption
 		defaultTemplate = sshutil.DefaultAdminTemplate
 	}
 
+	identity := claims.Email
+	if identity == "" {
+		identity = claims.Subject
+	}
+	audit := newSSHAuditMetadata(ctx, o, identity, data)
+
+	// The principals of non-admin users are the ones mapped to their identity
+	// if user principal rules are configured.
+	var principalsValidator *sshUserPrincipalsValidator
+	if !isAdmin {
+		if principalsValidator = newSSHUserPrincipalsValidator(o.Options.GetSSHOptions(), identity); principalsValidator != nil {
+			data.SetPrincipals(principalsValidator.principals)
+		}
+	}
+
 	templateOptions, err := CustomSSHTemplateOptions(o.Options, data, defaultTemplate)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "jwk.AuthorizeSign")
@@ -443,10 +766,19 @@ func (o *OIDC) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption
 		signOptions = append(signOptions, sshCertOptionsValidator(SignSSHOptions{
 			CertType: SSHUserCert,
 		}))
+		if principalsValidator != nil {
+			signOptions = append(signOptions, principalsValidator)
+		}
+	}
+
+	// Restrict the addresses from which the user certificates can be used.
+	if m := newSSHSourceAddressModifier(ctx, o.Options.GetSSHOptions()); m != nil {
+		signOptions = append(signOptions, m)
 	}
 
 	return append(signOptions,
 		o,
+		audit,
 		// Set the validity bounds if not set.
 		&sshDefaultDuration{o.ctl.Claimer},
 		// Validate public key
@@ -477,6 +809,27 @@ func (o *OIDC) AuthorizeSSHRevoke(_ context.Context, token string) error {
 	return errs.Unauthorized("oidc.AuthorizeSSHRevoke; cannot revoke with non-admin oidc token")
 }
 
+// maxIntrospectionResponseSize is the maximum size of the response of an
+// introspection endpoint.
+const maxIntrospectionResponseSize = 1 << 20
+
+// introspectionTimeout is the maximum time to wait for the response of an
+// introspection endpoint.
+const introspectionTimeout = 10 * time.Second
+
+// newIntrospectionClient returns a copy of the outbound client of the
+// authority with a timeout of at most introspectionTimeout.
+func newIntrospectionClient(c *http.Client) *http.Client {
+	if c == nil {
+		return &http.Client{Timeout: introspectionTimeout}
+	}
+	client := *c
+	if client.Timeout == 0 || client.Timeout > introspectionTimeout {
+		client.Timeout = introspectionTimeout
+	}
+	return &client
+}
+
 func getAndDecode(uri string, v interface{}) error {
 	resp, err := http.Get(uri) //nolint:gosec // openid-configuration uri
 	if err != nil {
@@ -6,15 +6,18 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/require"
 	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/x509util"
 
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/api/render"
@@ -746,3 +749,425 @@ func Test_openIDPayload_IsAdmin(t *testing.T) {
 		})
 	}
 }
+
+func TestOIDC_claimMappings(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+
+	var keys jose.JSONWebKeySet
+	assert.FatalError(t, getAndDecode(srv.URL+"/private", &keys))
+
+	p, err := generateOIDC()
+	assert.FatalError(t, err)
+	p.ConfigurationEndpoint = srv.URL + "/.well-known/openid-configuration"
+	p.ClaimMappings = []*OIDCClaimMapping{
+		{Claim: "groups", Value: "web", SANs: []string{"web.example.com"}, Principals: []string{"web"}},
+		{Claim: "roles", Value: "dba", SANs: []string{"db.example.com"}, Principals: []string{"postgres", "web"}},
+		{Claim: "department", Value: "ops", Principals: []string{"ops"}},
+		{Claim: "groups", Value: "other", SANs: []string{"other.example.com"}},
+	}
+	assert.FatalError(t, p.Init(Config{Claims: globalProvisionerClaims}))
+
+	so := new(jose.SignerOptions)
+	so.WithType("JWT")
+	so.WithHeader("kid", keys.Keys[0].KeyID)
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: keys.Keys[0].Key}, so)
+	assert.FatalError(t, err)
+	now := time.Now()
+	token, err := jose.Signed(sig).Claims(map[string]interface{}{
+		"sub":        "subject",
+		"iss":        "the-issuer",
+		"aud":        p.ClientID,
+		"iat":        now.Unix(),
+		"nbf":        now.Unix(),
+		"exp":        now.Add(5 * time.Minute).Unix(),
+		"email":      "name@smallstep.com",
+		"groups":     []string{"users", "web"},
+		"roles":      []string{"dba"},
+		"department": "ops",
+	}).CompactSerialize()
+	assert.FatalError(t, err)
+
+	t.Run("x509", func(t *testing.T) {
+		signOpts, err := p.AuthorizeSign(context.Background(), token)
+		assert.FatalError(t, err)
+		for _, op := range signOpts {
+			if cof, ok := op.(CertificateOptions); ok {
+				csr := parseCertificateRequest(t, "testdata/certs/ecdsa.csr")
+				crt, err := x509util.NewCertificate(csr, cof.Options(SignOptions{})...)
+				assert.FatalError(t, err)
+				cert := crt.GetCertificate()
+				assert.Equals(t, []string{"web.example.com", "db.example.com"}, cert.DNSNames)
+				assert.Equals(t, []string{"name@smallstep.com"}, cert.EmailAddresses)
+			}
+		}
+	})
+
+	t.Run("ssh", func(t *testing.T) {
+		signer, err := generateJSONWebKey()
+		assert.FatalError(t, err)
+		key, err := generateJSONWebKey()
+		assert.FatalError(t, err)
+
+		signOpts, err := p.AuthorizeSSHSign(context.Background(), token)
+		assert.FatalError(t, err)
+		cert, err := signSSHCertificate(key.Public().Key, SignSSHOptions{}, signOpts, signer.Key.(crypto.Signer))
+		assert.FatalError(t, err)
+		assert.Equals(t, []string{"name", "name@smallstep.com", "web", "postgres", "ops"}, cert.ValidPrincipals)
+	})
+}
+
+func TestOIDC_AuthorizeSSHSign_userPrincipals(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+
+	var keys jose.JSONWebKeySet
+	assert.FatalError(t, getAndDecode(srv.URL+"/private", &keys))
+	signer, err := generateJSONWebKey()
+	assert.FatalError(t, err)
+	key, err := generateJSONWebKey()
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name           string
+		rules          []*SSHUserPrincipalRule
+		wantPrincipals []string
+		wantSignErr    bool
+	}{
+		{"ok", []*SSHUserPrincipalRule{
+			{Identity: `(?P<user>.+)@smallstep\.com`, Principals: []string{"${user}", "ops"}},
+			{Identity: `root@.*`, Principals: []string{"root"}},
+		}, []string{"name", "ops"}, false},
+		{"ok many rules", []*SSHUserPrincipalRule{
+			{Identity: `(.+)@smallstep\.com`, Principals: []string{"$1"}},
+			{Identity: `name@.*`, Principals: []string{"name", "web"}},
+		}, []string{"name", "web"}, false},
+		{"fail no match", []*SSHUserPrincipalRule{
+			{Identity: `(.+)@example\.com`, Principals: []string{"$1"}},
+		}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := generateOIDC()
+			assert.FatalError(t, err)
+			p.ConfigurationEndpoint = srv.URL + "/.well-known/openid-configuration"
+			p.Options = &Options{SSH: &SSHOptions{UserPrincipals: tt.rules}}
+			assert.FatalError(t, p.Init(Config{Claims: globalProvisionerClaims}))
+
+			token, err := generateSimpleToken("the-issuer", p.ClientID, &keys.Keys[0])
+			assert.FatalError(t, err)
+			signOpts, err := p.AuthorizeSSHSign(context.Background(), token)
+			assert.FatalError(t, err)
+			cert, err := signSSHCertificate(key.Public().Key, SignSSHOptions{}, signOpts, signer.Key.(crypto.Signer))
+			if tt.wantSignErr {
+				assert.Error(t, err)
+				assert.Nil(t, cert)
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, tt.wantPrincipals, cert.ValidPrincipals)
+		})
+	}
+}
+
+func TestOIDC_Init_claimMappings(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+
+	tests := []struct {
+		name     string
+		mappings []*OIDCClaimMapping
+		wantErr  bool
+	}{
+		{"ok", []*OIDCClaimMapping{{Claim: "groups", Value: "web", SANs: []string{"web.example.com"}}}, false},
+		{"fail nil", []*OIDCClaimMapping{nil}, true},
+		{"fail claim", []*OIDCClaimMapping{{Value: "web", SANs: []string{"web.example.com"}}}, true},
+		{"fail value", []*OIDCClaimMapping{{Claim: "groups", SANs: []string{"web.example.com"}}}, true},
+		{"fail names", []*OIDCClaimMapping{{Claim: "groups", Value: "web"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := generateOIDC()
+			assert.FatalError(t, err)
+			p.ConfigurationEndpoint = srv.URL + "/.well-known/openid-configuration"
+			p.ClaimMappings = tt.mappings
+			if err := p.Init(Config{Claims: globalProvisionerClaims}); (err != nil) != tt.wantErr {
+				t.Errorf("OIDC.Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOIDC_introspection(t *testing.T) {
+	p, err := generateOIDC()
+	assert.FatalError(t, err)
+	p.ClientSecret = "the-secret"
+	p.Groups = []string{"workloads"}
+
+	now := time.Now()
+	responses := map[string]map[string]interface{}{
+		"active": {
+			"active": true, "client_id": p.ClientID, "sub": "workload",
+			"iat": now.Unix(), "exp": now.Add(5 * time.Minute).Unix(),
+			"groups": []string{"workloads"}, "department": "ops",
+		},
+		"audience": {
+			"active": true, "client_id": "other", "aud": []string{"api", p.ClientID}, "sub": "workload",
+			"exp": now.Add(5 * time.Minute).Unix(), "groups": []string{"workloads"},
+		},
+		"inactive": {"active": false},
+		"other-client": {
+			"active": true, "client_id": "other", "sub": "workload",
+			"exp": now.Add(5 * time.Minute).Unix(), "groups": []string{"workloads"},
+		},
+		"expired": {
+			"active": true, "client_id": p.ClientID, "sub": "workload",
+			"exp": now.Add(-5 * time.Minute).Unix(), "groups": []string{"workloads"},
+		},
+		"other-group": {
+			"active": true, "client_id": p.ClientID, "sub": "workload",
+			"exp": now.Add(5 * time.Minute).Unix(), "groups": []string{"users"},
+		},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != p.ClientID || pass != "the-secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		resp, ok := responses[r.PostFormValue("token")]
+		if !ok {
+			resp = map[string]interface{}{"active": false}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer srv.Close()
+
+	t.Run("disabled", func(t *testing.T) {
+		_, err := p.authorizeToken("active")
+		assert.Error(t, err)
+		_, err = p.GetTokenID("active")
+		assert.Error(t, err)
+	})
+
+	p.IntrospectionEndpoint = srv.URL
+
+	tests := []struct {
+		token   string
+		wantErr bool
+	}{
+		{"active", false},
+		{"audience", false},
+		{"inactive", true},
+		{"other-client", true},
+		{"expired", true},
+		{"other-group", true},
+		{"unknown", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.token, func(t *testing.T) {
+			claims, err := p.authorizeToken(tt.token)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, "workload", claims.Subject)
+			assert.Equals(t, p.configuration.Issuer, claims.Issuer)
+		})
+	}
+
+	t.Run("tokenID", func(t *testing.T) {
+		id, err := p.GetTokenID("active")
+		assert.FatalError(t, err)
+		assert.Equals(t, "", id)
+	})
+
+	t.Run("sign", func(t *testing.T) {
+		p.ClaimMappings = []*OIDCClaimMapping{
+			{Claim: "department", Value: "ops", SANs: []string{"ops.example.com"}},
+		}
+		defer func() { p.ClaimMappings = nil }()
+		signOpts, err := p.AuthorizeSign(context.Background(), "active")
+		assert.FatalError(t, err)
+		for _, op := range signOpts {
+			if cof, ok := op.(CertificateOptions); ok {
+				csr := parseCertificateRequest(t, "testdata/certs/ecdsa.csr")
+				crt, err := x509util.NewCertificate(csr, cof.Options(SignOptions{})...)
+				assert.FatalError(t, err)
+				assert.Equals(t, []string{"ops.example.com"}, crt.GetCertificate().DNSNames)
+			}
+		}
+	})
+
+	t.Run("collection", func(t *testing.T) {
+		c := NewCollection(testAudiences)
+		assert.FatalError(t, c.Store(p))
+		got, ok := c.LoadByOpaqueToken(p.Name)
+		assert.True(t, ok)
+		assert.Equals(t, p, got)
+		_, ok = c.LoadByOpaqueToken("unknown")
+		assert.False(t, ok)
+
+		// Provisioners without token introspection do not accept opaque
+		// tokens.
+		other, err := generateOIDC()
+		assert.FatalError(t, err)
+		assert.FatalError(t, c.Store(other))
+		_, ok = c.LoadByOpaqueToken(other.Name)
+		assert.False(t, ok)
+	})
+
+	t.Run("fail credentials", func(t *testing.T) {
+		p.ClientSecret = "bad-secret"
+		defer func() { p.ClientSecret = "the-secret" }()
+		_, err := p.authorizeToken("active")
+		assert.Error(t, err)
+	})
+}
+
+func TestOIDC_Init_introspectionEndpoint(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+
+	tests := []struct {
+		name     string
+		endpoint string
+		wantErr  bool
+	}{
+		{"ok", "https://example.com/oauth2/introspect", false},
+		{"ok empty", "", false},
+		{"fail scheme", "ftp://example.com/oauth2/introspect", true},
+		{"fail parse", "https://example.com/%", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := generateOIDC()
+			assert.FatalError(t, err)
+			p.ConfigurationEndpoint = srv.URL + "/.well-known/openid-configuration"
+			p.IntrospectionEndpoint = tt.endpoint
+			if err := p.Init(Config{Claims: globalProvisionerClaims}); (err != nil) != tt.wantErr {
+				t.Errorf("OIDC.Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_newIntrospectionClient(t *testing.T) {
+	transport := &http.Transport{}
+	tests := []struct {
+		name   string
+		client *http.Client
+		want   time.Duration
+	}{
+		{"ok nil", nil, introspectionTimeout},
+		{"ok no timeout", &http.Client{Transport: transport}, introspectionTimeout},
+		{"ok long timeout", &http.Client{Transport: transport, Timeout: time.Minute}, introspectionTimeout},
+		{"ok short timeout", &http.Client{Transport: transport, Timeout: time.Second}, time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := newIntrospectionClient(tt.client)
+			assert.Equals(t, tt.want, got.Timeout)
+			if tt.client != nil {
+				assert.Equals(t, tt.client.Transport, got.Transport)
+				assert.True(t, got != tt.client)
+			}
+		})
+	}
+}
+
+func TestOIDC_Init_deviceAuthorization(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+
+	tests := []struct {
+		name    string
+		device  *OIDCDeviceAuthorization
+		wantErr bool
+	}{
+		{"ok", &OIDCDeviceAuthorization{ClientID: "device", AuthenticationMethods: []string{"mfa"}}, false},
+		{"ok empty", &OIDCDeviceAuthorization{}, false},
+		{"ok nil", nil, false},
+		{"fail authenticationMethods", &OIDCDeviceAuthorization{AuthenticationMethods: []string{"mfa", ""}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := generateOIDC()
+			assert.FatalError(t, err)
+			p.ConfigurationEndpoint = srv.URL + "/.well-known/openid-configuration"
+			p.DeviceAuthorization = tt.device
+			if err := p.Init(Config{Claims: globalProvisionerClaims}); (err != nil) != tt.wantErr {
+				t.Errorf("OIDC.Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOIDC_deviceAuthorization(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+
+	var keys jose.JSONWebKeySet
+	assert.FatalError(t, getAndDecode(srv.URL+"/private", &keys))
+
+	p, err := generateOIDC()
+	assert.FatalError(t, err)
+	p.ConfigurationEndpoint = srv.URL + "/.well-known/openid-configuration"
+	p.DeviceAuthorization = &OIDCDeviceAuthorization{
+		ClientID:              "device-client",
+		AuthenticationMethods: []string{"mfa", "otp"},
+	}
+	assert.FatalError(t, p.Init(Config{Claims: globalProvisionerClaims}))
+	assert.Equals(t, []string{"device-client"}, additionalTokenIDs(p))
+
+	so := new(jose.SignerOptions)
+	so.WithType("JWT")
+	so.WithHeader("kid", keys.Keys[0].KeyID)
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: keys.Keys[0].Key}, so)
+	assert.FatalError(t, err)
+	newToken := func(claims map[string]interface{}) string {
+		now := time.Now()
+		c := map[string]interface{}{
+			"sub":   "subject",
+			"iss":   "the-issuer",
+			"iat":   now.Unix(),
+			"nbf":   now.Unix(),
+			"exp":   now.Add(5 * time.Minute).Unix(),
+			"email": "name@smallstep.com",
+		}
+		for k, v := range claims {
+			c[k] = v
+		}
+		token, err := jose.Signed(sig).Claims(c).CompactSerialize()
+		assert.FatalError(t, err)
+		return token
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr string
+	}{
+		{"ok", newToken(map[string]interface{}{"aud": "device-client", "amr": []string{"pwd", "mfa"}}), ""},
+		{"ok azp", newToken(map[string]interface{}{"aud": []string{"device-client", "api"}, "azp": "device-client", "amr": []string{"otp"}}), ""},
+		{"ok client", newToken(map[string]interface{}{"aud": p.ClientID}), ""},
+		{"fail amr", newToken(map[string]interface{}{"aud": "device-client", "amr": []string{"pwd"}}), "invalid amr"},
+		{"fail no amr", newToken(map[string]interface{}{"aud": "device-client"}), "invalid amr"},
+		{"fail no azp", newToken(map[string]interface{}{"aud": []string{"device-client", "api"}, "amr": []string{"mfa"}}), "azp not found"},
+		{"fail azp", newToken(map[string]interface{}{"aud": "device-client", "azp": p.ClientID, "amr": []string{"mfa"}}), "invalid azp"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := p.authorizeToken(tt.token)
+			if tt.wantErr != "" {
+				if assert.Error(t, err) {
+					assert.True(t, strings.HasSuffix(err.Error(), tt.wantErr), err.Error())
+				}
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, "subject", claims.Subject)
+		})
+	}
+}
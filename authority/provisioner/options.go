@@ -1,8 +1,16 @@
 package provisioner
 
 import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
 	"encoding/json"
+	"net/url"
+	"slices"
+	"strconv"
 	"strings"
+	"text/template"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -33,6 +41,51 @@ type Options struct {
 
 	// Webhooks is a list of webhooks that can augment template data
 	Webhooks []*Webhook `json:"webhooks,omitempty"`
+
+	// RateLimit limits the number of signing requests of the provisioner.
+	RateLimit *RateLimitOptions `json:"rateLimit,omitempty"`
+
+	// CertificateQuota limits the number of valid X.509 certificates issued
+	// by the provisioner for the same name.
+	CertificateQuota *CertificateQuotaOptions `json:"certificateQuota,omitempty"`
+
+	// Approval queues the X.509 signing requests of the provisioner until an
+	// administrator approves or denies them.
+	Approval *ApprovalOptions `json:"approval,omitempty"`
+
+	// Conditions restrict the source addresses, the time windows and the user
+	// agents of the signing requests.
+	Conditions *Conditions `json:"conditions,omitempty"`
+
+	// State is the lifecycle state of the provisioner. A deprecated
+	// provisioner can renew, rekey and revoke certificates, but it cannot
+	// sign new ones.
+	State State `json:"state,omitempty"`
+
+	// Policy contains the X.509 and SSH name policies of the provisioner,
+	// with the same format as the authority policy. It allows to define them
+	// in ca.json, without the admin API.
+	Policy *policy.Options `json:"policy,omitempty"`
+}
+
+// State is the lifecycle state of a provisioner.
+type State string
+
+const (
+	// StateActive is the default state of a provisioner.
+	StateActive State = "active"
+	// StateDeprecated is the state of a provisioner being phased out.
+	StateDeprecated State = "deprecated"
+)
+
+// Validate returns an error if the state is not supported.
+func (s State) Validate() error {
+	switch s {
+	case "", StateActive, StateDeprecated:
+		return nil
+	default:
+		return errors.Errorf("provisioner state %q is not supported", s)
+	}
 }
 
 // GetX509Options returns the X.509 options.
@@ -59,6 +112,277 @@ func (o *Options) GetWebhooks() []*Webhook {
 	return o.Webhooks
 }
 
+// GetRateLimit returns the rate limit options.
+func (o *Options) GetRateLimit() *RateLimitOptions {
+	if o == nil {
+		return nil
+	}
+	return o.RateLimit
+}
+
+// GetConditions returns the conditions of the signing requests.
+func (o *Options) GetConditions() *Conditions {
+	if o == nil {
+		return nil
+	}
+	return o.Conditions
+}
+
+// IsDeprecated returns true if the provisioner state is deprecated.
+func (o *Options) IsDeprecated() bool {
+	return o != nil && o.State == StateDeprecated
+}
+
+// GetCertificateQuota returns the certificate quota options.
+func (o *Options) GetCertificateQuota() *CertificateQuotaOptions {
+	if o == nil {
+		return nil
+	}
+	return o.CertificateQuota
+}
+
+// GetApproval returns the approval options.
+func (o *Options) GetApproval() *ApprovalOptions {
+	if o == nil {
+		return nil
+	}
+	return o.Approval
+}
+
+// GetPolicy returns the name policies of the provisioner.
+func (o *Options) GetPolicy() *policy.Options {
+	if o == nil {
+		return nil
+	}
+	return o.Policy
+}
+
+// hasNamePolicy returns true if the X.509 or SSH options contain a name policy,
+// something only set by the admin API or the provisioner defaults.
+func (o *Options) hasNamePolicy() bool {
+	if x := o.GetX509Options(); x != nil && (x.AllowedNames != nil || x.DeniedNames != nil) {
+		return true
+	}
+	if s := o.GetSSHOptions(); s != nil && (s.User != nil || s.Host != nil) {
+		return true
+	}
+	return false
+}
+
+// mergeOptions returns the options with the unset fields taken from the given
+// defaults. The options are returned as is if there are no defaults. The
+// defaults only supported by some provisioners are ignored in provisioners of
+// other types. Boolean options cannot be disabled if they are enabled in the
+// defaults.
+func mergeOptions(o, defaults *Options, typ Type) *Options {
+	if defaults == nil {
+		return o
+	}
+	var m Options
+	if o != nil {
+		m = *o
+	}
+	m.X509 = mergeX509Options(m.X509, defaults.X509)
+	m.SSH = mergeSSHOptions(m.SSH, defaults.SSH, typ)
+	if m.Webhooks == nil {
+		m.Webhooks = defaults.Webhooks
+	}
+	if m.RateLimit == nil {
+		m.RateLimit = defaults.RateLimit
+	}
+	if m.CertificateQuota == nil {
+		m.CertificateQuota = defaults.CertificateQuota
+	}
+	if m.Approval == nil {
+		m.Approval = defaults.Approval
+	}
+	if m.Conditions == nil {
+		m.Conditions = defaults.Conditions
+	}
+	// The policy of the defaults is not used by provisioners with a policy
+	// managed by the admin API.
+	if m.Policy == nil && !o.hasNamePolicy() {
+		m.Policy = defaults.Policy
+	}
+	return &m
+}
+
+func mergeX509Options(o, defaults *X509Options) *X509Options {
+	if defaults == nil {
+		return o
+	}
+	var m X509Options
+	if o != nil {
+		m = *o
+	}
+	if !m.HasTemplate() {
+		m.Template, m.TemplateFile = defaults.Template, defaults.TemplateFile
+	}
+	if m.TemplateData == nil {
+		m.TemplateData = defaults.TemplateData
+	}
+	if !m.EnableTemplateDNSLookups {
+		m.EnableTemplateDNSLookups = defaults.EnableTemplateDNSLookups
+	}
+	if m.AllowedNames == nil && m.DeniedNames == nil {
+		m.AllowedNames = defaults.AllowedNames
+		m.DeniedNames = defaults.DeniedNames
+		m.AllowWildcardNames = defaults.AllowWildcardNames
+	}
+	if m.CommonNameMode == "" {
+		m.CommonNameMode = defaults.CommonNameMode
+	}
+	if m.OtherNames == nil {
+		m.OtherNames = defaults.OtherNames
+	}
+	if m.NotAfterAlignment == "" {
+		m.NotAfterAlignment = defaults.NotAfterAlignment
+	}
+	if m.IssuerAltNames == nil {
+		m.IssuerAltNames = defaults.IssuerAltNames
+	}
+	if m.CAA == nil {
+		m.CAA = defaults.CAA
+	}
+	if !m.AllowPrecertificates {
+		m.AllowPrecertificates = defaults.AllowPrecertificates
+	}
+	return &m
+}
+
+func mergeSSHOptions(o, defaults *SSHOptions, typ Type) *SSHOptions {
+	if defaults == nil {
+		return o
+	}
+	var m SSHOptions
+	if o != nil {
+		m = *o
+	}
+	if !m.HasTemplate() {
+		m.Template, m.TemplateFile = defaults.Template, defaults.TemplateFile
+	}
+	if m.TemplateData == nil {
+		m.TemplateData = defaults.TemplateData
+	}
+	if !m.EnableTemplateDNSLookups {
+		m.EnableTemplateDNSLookups = defaults.EnableTemplateDNSLookups
+	}
+	if m.KeyID == "" {
+		m.KeyID = defaults.KeyID
+	}
+	if m.CriticalOptions == nil {
+		m.CriticalOptions = defaults.CriticalOptions
+	}
+	if m.Extensions == nil {
+		m.Extensions = defaults.Extensions
+	}
+	if m.PrincipalOptions == nil {
+		m.PrincipalOptions = defaults.PrincipalOptions
+	}
+	if m.UserPrincipals == nil && supportsSSHUserPrincipals(typ) {
+		m.UserPrincipals = defaults.UserPrincipals
+	}
+	if m.SourceAddress == nil && supportsSSHSourceAddress(typ) {
+		m.SourceAddress = defaults.SourceAddress
+	}
+	if m.User == nil && m.Host == nil {
+		m.User = defaults.User
+		m.Host = defaults.Host
+	}
+	return &m
+}
+
+// RateLimitOptions contains the options to limit the number of X.509 and SSH
+// certificates signed by a provisioner.
+type RateLimitOptions struct {
+	// RequestsPerMinute is the number of signing requests allowed per minute.
+	RequestsPerMinute int `json:"requestsPerMinute"`
+
+	// Burst is the maximum number of signing requests allowed at once. It
+	// defaults to RequestsPerMinute.
+	Burst int `json:"burst,omitempty"`
+}
+
+// Validate returns an error if the rate limit options are not valid.
+func (o *RateLimitOptions) Validate() error {
+	switch {
+	case o == nil:
+		return nil
+	case o.RequestsPerMinute <= 0:
+		return errors.New("rateLimit requestsPerMinute must be greater than 0")
+	case o.Burst < 0:
+		return errors.New("rateLimit burst cannot be negative")
+	default:
+		return nil
+	}
+}
+
+// GetBurst returns the maximum number of signing requests allowed at once.
+func (o *RateLimitOptions) GetBurst() int {
+	if o.Burst > 0 {
+		return o.Burst
+	}
+	return o.RequestsPerMinute
+}
+
+// CertificateQuotaOptions contains the options to limit the number of valid
+// X.509 certificates signed by a provisioner for the same subject, protecting
+// the CA against runaway automation. Only the certificates signed while the
+// quota is configured are counted.
+type CertificateQuotaOptions struct {
+	// MaxPerSubject is the maximum number of certificates that are not expired
+	// nor revoked and contain the same common name or subject alternative
+	// name.
+	MaxPerSubject int `json:"maxPerSubject"`
+}
+
+// Validate returns an error if the certificate quota options are not valid.
+func (o *CertificateQuotaOptions) Validate() error {
+	if o != nil && o.MaxPerSubject <= 0 {
+		return errors.New("certificateQuota maxPerSubject must be greater than 0")
+	}
+	return nil
+}
+
+// defaultApprovalExpiration is the time a signing request waits for approval if
+// the expiration is not configured.
+const defaultApprovalExpiration = 24 * time.Hour
+
+// ApprovalOptions contains the options to require the approval of an
+// administrator before an X.509 certificate is signed. The signing requests
+// are queued in the database and the certificates can be retrieved once they
+// are approved. ACME and SCEP provisioners do not support approvals, their
+// clients cannot wait for them.
+type ApprovalOptions struct {
+	// Required enables the approval of the signing requests.
+	Required bool `json:"required"`
+
+	// Expiration is the time a signing request waits for a decision, after it
+	// the request cannot be approved. It defaults to 24h.
+	Expiration *Duration `json:"expiration,omitempty"`
+}
+
+// Validate returns an error if the approval options are not valid.
+func (o *ApprovalOptions) Validate() error {
+	if o != nil && o.Expiration != nil && o.Expiration.Duration <= 0 {
+		return errors.New("approval expiration must be greater than 0")
+	}
+	return nil
+}
+
+// IsRequired returns true if the signing requests must be approved.
+func (o *ApprovalOptions) IsRequired() bool {
+	return o != nil && o.Required
+}
+
+// GetExpiration returns the time a signing request waits for approval.
+func (o *ApprovalOptions) GetExpiration() time.Duration {
+	if o == nil || o.Expiration == nil || o.Expiration.Duration <= 0 {
+		return defaultApprovalExpiration
+	}
+	return o.Expiration.Duration
+}
+
 // X509Options contains specific options for X.509 certificates.
 type X509Options struct {
 	// Template contains a X.509 certificate template. It can be a JSON template
@@ -72,6 +396,10 @@ type X509Options struct {
 	// templates.
 	TemplateData json.RawMessage `json:"templateData,omitempty"`
 
+	// EnableTemplateDNSLookups enables the lookupHost and lookupAddr functions
+	// in the certificate template. Defaults to false.
+	EnableTemplateDNSLookups bool `json:"enableTemplateDNSLookups,omitempty"`
+
 	// AllowedNames contains the SANs the provisioner is authorized to sign
 	AllowedNames *policy.X509NameOptions `json:"-"`
 
@@ -81,8 +409,323 @@ type X509Options struct {
 	// AllowWildcardNames indicates if literal wildcard names
 	// like *.example.com are allowed. Defaults to false.
 	AllowWildcardNames bool `json:"-"`
+
+	// CommonNameMode defines the behavior when the common name in the
+	// certificate request is not in the set of SANs authorized by the token.
+	// Defaults to "reject".
+	CommonNameMode CommonNameMode `json:"commonNameMode,omitempty"`
+
+	// OtherNames is a list of otherName SANs to add to the certificate. The
+	// values are templates rendered with the certificate template data.
+	OtherNames []OtherName `json:"otherNames,omitempty"`
+
+	// NotAfterAlignment aligns the expiration of the certificates to the
+	// previous UTC calendar boundary, "daily" or "weekly", so all the
+	// certificates issued in the same period expire at the same time. The
+	// expiration is not aligned if the aligned one would be in the past or
+	// shorter than the minimum duration of the provisioner.
+	NotAfterAlignment ValidityAlignment `json:"notAfterAlignment,omitempty"`
+
+	// IssuerAltNames is a list of names to add to the issuer alternative name
+	// extension of the certificate.
+	IssuerAltNames []IssuerAltName `json:"issuerAltNames,omitempty"`
+
+	// CAA configures the checking of the CAA records of the DNS names in the
+	// certificate before signing it.
+	CAA *CAAOptions `json:"caa,omitempty"`
+
+	// AllowPrecertificates allows the sign requests of the provisioner to ask
+	// for RFC 6962 pre-certificates, and the finalization of those
+	// pre-certificates with the signed certificate timestamps of a CT log.
+	// Defaults to false.
+	AllowPrecertificates bool `json:"allowPrecertificates,omitempty"`
 }
 
+// OtherName defines an otherName SAN with a configurable type-id and a value
+// that can be rendered from the token claims or the template data, for example
+// the Microsoft UPN, "1.3.6.1.4.1.311.20.2.3", with the value
+// "{{ .Token.upn }}".
+type OtherName struct {
+	// OID is the type-id of the otherName.
+	OID string `json:"oid"`
+
+	// Type is the ASN.1 string type used to encode the value. Supported
+	// values are "utf8", "ia5", "printable" and "numeric". Defaults to "utf8".
+	Type string `json:"type,omitempty"`
+
+	// Value is a template used to render the value of the otherName.
+	Value string `json:"value"`
+}
+
+// Validate validates the otherName OID, type and value template.
+func (o OtherName) Validate() error {
+	if _, err := parseObjectIdentifier(o.OID); err != nil {
+		return errors.Wrapf(err, "invalid otherName oid %q", o.OID)
+	}
+	switch o.Type {
+	case "", "utf8", "ia5", "printable", "numeric":
+	default:
+		return errors.Errorf("invalid otherName type %q: supported types are utf8, ia5, printable and numeric", o.Type)
+	}
+	if strings.TrimSpace(o.Value) == "" {
+		return errors.Errorf("otherName %s value cannot be empty", o.OID)
+	}
+	if _, err := template.New(o.OID).Funcs(x509util.GetFuncMap()).Parse(o.Value); err != nil {
+		return errors.Wrapf(err, "invalid otherName %s value template", o.OID)
+	}
+	return nil
+}
+
+// render returns the otherName as a x509util.SubjectAlternativeName with the
+// value rendered using the given data.
+func (o OtherName) render(data x509util.TemplateData) (x509util.SubjectAlternativeName, error) {
+	tmpl, err := template.New(o.OID).Funcs(x509util.GetFuncMap()).Option("missingkey=error").Parse(o.Value)
+	if err != nil {
+		return x509util.SubjectAlternativeName{}, errors.Wrapf(err, "invalid otherName %s value template", o.OID)
+	}
+	buf := new(bytes.Buffer)
+	if err := tmpl.Execute(buf, data); err != nil {
+		return x509util.SubjectAlternativeName{}, errors.Wrapf(err, "error rendering otherName %s value", o.OID)
+	}
+	value := buf.String()
+	if value == "" || value == "<no value>" {
+		return x509util.SubjectAlternativeName{}, errors.Errorf("otherName %s value cannot be empty", o.OID)
+	}
+	typ := o.Type
+	if typ == "" {
+		typ = "utf8"
+	}
+	return x509util.SubjectAlternativeName{
+		Type:  o.OID,
+		Value: typ + ":" + value,
+	}, nil
+}
+
+// validateOtherNames validates the configured otherName SANs.
+func (o *X509Options) validateOtherNames() error {
+	if o == nil {
+		return nil
+	}
+	for _, on := range o.OtherNames {
+		if err := on.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseObjectIdentifier parses an object identifier in dot notation.
+func parseObjectIdentifier(s string) (asn1.ObjectIdentifier, error) {
+	parts := strings.Split(s, ".")
+	if len(parts) < 2 {
+		return nil, errors.New("object identifier must have at least two components")
+	}
+	oid := make(asn1.ObjectIdentifier, len(parts))
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return nil, errors.Errorf("object identifier component %q is not valid", p)
+		}
+		oid[i] = n
+	}
+	if oid[0] > 2 || (oid[0] < 2 && oid[1] >= 40) {
+		return nil, errors.New("object identifier root components are not valid")
+	}
+	return oid, nil
+}
+
+// templateFields are the top level fields of a rendered certificate template.
+type templateFields map[string]json.RawMessage
+
+// get unmarshals the given field into dst, dst is not modified if the field is
+// not set or null.
+func (f templateFields) get(key string, dst any) error {
+	if b, ok := f[key]; ok && string(b) != "null" {
+		if err := json.Unmarshal(b, dst); err != nil {
+			return errors.Wrapf(err, "error unmarshaling certificate %s", key)
+		}
+	}
+	return nil
+}
+
+// set marshals v and sets it as the given field.
+func (f templateFields) set(key string, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrapf(err, "error marshaling certificate %s", key)
+	}
+	f[key] = b
+	return nil
+}
+
+// patchCertificateTemplate modifies the rendered X.509 or SSH certificate
+// template in the given buffer, and returns a new buffer with the fields
+// modified by the patch function.
+func patchCertificateTemplate(buf *bytes.Buffer, patch func(templateFields) error) (*bytes.Buffer, error) {
+	var fields templateFields
+	if err := json.Unmarshal(buf.Bytes(), &fields); err != nil {
+		return nil, errors.Wrap(err, "error unmarshaling certificate")
+	}
+	if err := patch(fields); err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling certificate")
+	}
+	return bytes.NewBuffer(b), nil
+}
+
+// otherNamesOption returns a x509util.Option that adds the given otherName SANs
+// to the rendered certificate template.
+func otherNamesOption(otherNames []OtherName, data x509util.TemplateData) x509util.Option {
+	return func(_ *x509.CertificateRequest, o *x509util.Options) error {
+		if o.CertBuffer == nil {
+			return nil
+		}
+		var err error
+		o.CertBuffer, err = patchCertificateTemplate(o.CertBuffer, func(f templateFields) error {
+			var sans []x509util.SubjectAlternativeName
+			if err := f.get("sans", &sans); err != nil {
+				return err
+			}
+			for _, on := range otherNames {
+				san, err := on.render(data)
+				if err != nil {
+					return &x509util.TemplateError{Message: err.Error()}
+				}
+				sans = append(sans, san)
+			}
+			return f.set("sans", sans)
+		})
+		return err
+	}
+}
+
+var oidExtensionIssuerAltName = asn1.ObjectIdentifier{2, 5, 29, 18}
+
+// IssuerAltName defines an entry of the issuer alternative name extension.
+type IssuerAltName struct {
+	// Type is the type of the name. Supported values are "dns", "email" and
+	// "uri".
+	Type string `json:"type"`
+
+	// Value is the name.
+	Value string `json:"value"`
+}
+
+// Validate validates the type and value of the issuer alternative name.
+func (n IssuerAltName) Validate() error {
+	if n.Value == "" {
+		return errors.Errorf("issuerAltName %s value cannot be empty", n.Type)
+	}
+	for _, c := range n.Value {
+		if c <= ' ' || c > '~' {
+			return errors.Errorf("issuerAltName %s %q contains invalid characters", n.Type, n.Value)
+		}
+	}
+	switch n.Type {
+	case "dns":
+		for _, label := range strings.Split(strings.TrimSuffix(n.Value, "."), ".") {
+			if label == "" || len(label) > 63 || strings.ContainsAny(label, "@/:") {
+				return errors.Errorf("issuerAltName dns %q is not valid", n.Value)
+			}
+		}
+	case "email":
+		if i := strings.LastIndex(n.Value, "@"); i <= 0 || i == len(n.Value)-1 {
+			return errors.Errorf("issuerAltName email %q is not valid", n.Value)
+		}
+	case "uri":
+		u, err := url.Parse(n.Value)
+		if err != nil || u.Scheme == "" || (u.Host == "" && u.Opaque == "") {
+			return errors.Errorf("issuerAltName uri %q is not valid", n.Value)
+		}
+	default:
+		return errors.Errorf("invalid issuerAltName type %q: supported types are dns, email and uri", n.Type)
+	}
+	return nil
+}
+
+// validateIssuerAltNames validates the configured issuer alternative names.
+func (o *X509Options) validateIssuerAltNames() error {
+	if o == nil {
+		return nil
+	}
+	for _, n := range o.IssuerAltNames {
+		if err := n.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// marshalIssuerAltNames returns the DER encoding of the GeneralNames sequence
+// with the given issuer alternative names.
+func marshalIssuerAltNames(names []IssuerAltName) ([]byte, error) {
+	rawValues := make([]asn1.RawValue, len(names))
+	for i, n := range names {
+		var tag int
+		switch n.Type {
+		case "email":
+			tag = 1 // rfc822Name
+		case "dns":
+			tag = 2 // dNSName
+		case "uri":
+			tag = 6 // uniformResourceIdentifier
+		default:
+			return nil, errors.Errorf("invalid issuerAltName type %q", n.Type)
+		}
+		rawValues[i] = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: tag, Bytes: []byte(n.Value)}
+	}
+	return asn1.Marshal(rawValues)
+}
+
+// issuerAltNamesOption returns a x509util.Option that adds the issuer
+// alternative name extension to the rendered certificate template. An
+// issuerAltName extension in the template is replaced.
+func issuerAltNamesOption(names []IssuerAltName) x509util.Option {
+	return func(_ *x509.CertificateRequest, o *x509util.Options) error {
+		if o.CertBuffer == nil {
+			return nil
+		}
+		value, err := marshalIssuerAltNames(names)
+		if err != nil {
+			return errors.Wrap(err, "error marshaling issuerAltName extension")
+		}
+		o.CertBuffer, err = patchCertificateTemplate(o.CertBuffer, func(f templateFields) error {
+			var extensions []x509util.Extension
+			if err := f.get("extensions", &extensions); err != nil {
+				return err
+			}
+			extensions = slices.DeleteFunc(extensions, func(e x509util.Extension) bool {
+				return asn1.ObjectIdentifier(e.ID).Equal(oidExtensionIssuerAltName)
+			})
+			extensions = append(extensions, x509util.Extension{
+				ID:    x509util.ObjectIdentifier(oidExtensionIssuerAltName),
+				Value: value,
+			})
+			return f.set("extensions", extensions)
+		})
+		return err
+	}
+}
+
+// CommonNameMode defines how provisioners handle certificate request common
+// names that are not in the set of authorized SANs.
+type CommonNameMode string
+
+const (
+	// CommonNameReject rejects certificate requests with an unauthorized
+	// common name.
+	CommonNameReject CommonNameMode = "reject"
+	// CommonNamePromote rejects certificate requests with an unauthorized
+	// common name, and adds an authorized common name to the certificate SANs
+	// if it's not already present.
+	CommonNamePromote CommonNameMode = "promote"
+	// CommonNameDrop removes an unauthorized common name from the certificate.
+	CommonNameDrop CommonNameMode = "drop"
+)
+
 // HasTemplate returns true if a template is defined in the provisioner options.
 func (o *X509Options) HasTemplate() bool {
 	return o != nil && (o.Template != "" || o.TemplateFile != "")
@@ -106,6 +749,92 @@ func (o *X509Options) GetDeniedNameOptions() *policy.X509NameOptions {
 	return o.DeniedNames
 }
 
+// GetCommonNameMode returns the configured CommonNameMode. It defaults to
+// CommonNameReject.
+func (o *X509Options) GetCommonNameMode() CommonNameMode {
+	if o == nil {
+		return CommonNameReject
+	}
+	switch o.CommonNameMode {
+	case CommonNamePromote, CommonNameDrop:
+		return o.CommonNameMode
+	default:
+		return CommonNameReject
+	}
+}
+
+// ValidityAlignment defines the UTC calendar boundary used to align the
+// expiration of the certificates.
+type ValidityAlignment string
+
+const (
+	// ValidityAlignmentDaily aligns the expiration to midnight UTC.
+	ValidityAlignmentDaily ValidityAlignment = "daily"
+	// ValidityAlignmentWeekly aligns the expiration to Monday at midnight UTC.
+	ValidityAlignmentWeekly ValidityAlignment = "weekly"
+)
+
+// Validate returns an error if the alignment is not supported.
+func (a ValidityAlignment) Validate() error {
+	switch a {
+	case "", ValidityAlignmentDaily, ValidityAlignmentWeekly:
+		return nil
+	default:
+		return errors.Errorf("unsupported notAfterAlignment %q", a)
+	}
+}
+
+// Align returns the latest calendar boundary at or before t. Aligning to a
+// previous boundary guarantees that the validity period never exceeds the
+// requested one.
+func (a ValidityAlignment) Align(t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch a {
+	case ValidityAlignmentDaily:
+		return day
+	case ValidityAlignmentWeekly:
+		// time.Sunday is 0, go back to the previous Monday.
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	default:
+		return t
+	}
+}
+
+// AlignNotAfter returns the aligned expiration of a certificate valid from
+// notBefore to notAfter. The expiration is not aligned, and notAfter is
+// returned, if the aligned expiration is not after now, or if the aligned
+// validity period would be shorter than minDuration. Short certificates are
+// issued with the requested expiration rather than being rejected.
+func (a ValidityAlignment) AlignNotAfter(notBefore, notAfter, now time.Time, minDuration time.Duration) time.Time {
+	aligned := a.Align(notAfter)
+	if !aligned.After(now) || aligned.Sub(notBefore) < minDuration {
+		return notAfter
+	}
+	return aligned
+}
+
+// GetNotAfterAlignment returns the calendar boundary used to align the
+// expiration of the certificates.
+func (o *X509Options) GetNotAfterAlignment() ValidityAlignment {
+	if o == nil {
+		return ""
+	}
+	return o.NotAfterAlignment
+}
+
+// ArePrecertificatesAllowed returns true if the provisioner can issue RFC 6962
+// pre-certificates.
+func (o *X509Options) ArePrecertificatesAllowed() bool {
+	if o == nil {
+		return false
+	}
+	return o.AllowPrecertificates
+}
+
 func (o *X509Options) AreWildcardNamesAllowed() bool {
 	if o == nil {
 		return true
@@ -140,11 +869,11 @@ func CustomTemplateOptions(o *Options, data x509util.TemplateData, defaultTempla
 		}
 	}
 
-	return certificateOptionsFunc(func(so SignOptions) []x509util.Option {
+	templateOptions := func(so SignOptions) []x509util.Option {
 		// We're not provided user data without custom templates.
 		if !opts.HasTemplate() {
 			return []x509util.Option{
-				x509util.WithTemplate(defaultTemplate, data),
+				x509TemplateOption(defaultTemplate, data, false),
 			}
 		}
 
@@ -161,7 +890,7 @@ func CustomTemplateOptions(o *Options, data x509util.TemplateData, defaultTempla
 		// Load a template from a file if Template is not defined.
 		if opts.Template == "" && opts.TemplateFile != "" {
 			return []x509util.Option{
-				x509util.WithTemplateFile(step.Abs(opts.TemplateFile), data),
+				x509TemplateFileOption(step.Abs(opts.TemplateFile), data, opts.EnableTemplateDNSLookups),
 			}
 		}
 
@@ -170,13 +899,26 @@ func CustomTemplateOptions(o *Options, data x509util.TemplateData, defaultTempla
 		template := strings.TrimSpace(opts.Template)
 		if strings.HasPrefix(template, "{") {
 			return []x509util.Option{
-				x509util.WithTemplate(template, data),
+				x509TemplateOption(template, data, opts.EnableTemplateDNSLookups),
 			}
 		}
 		// 2. As a base64 encoded JSON.
 		return []x509util.Option{
-			x509util.WithTemplateBase64(template, data),
+			x509TemplateBase64Option(template, data, opts.EnableTemplateDNSLookups),
+		}
+	}
+
+	return certificateOptionsFunc(func(so SignOptions) []x509util.Option {
+		options := templateOptions(so)
+		// Add otherName SANs, if any, to the rendered template.
+		if opts != nil && len(opts.OtherNames) > 0 {
+			options = append(options, otherNamesOption(opts.OtherNames, data))
+		}
+		// Add the issuerAltName extension, if configured.
+		if opts != nil && len(opts.IssuerAltNames) > 0 {
+			options = append(options, issuerAltNamesOption(opts.IssuerAltNames))
 		}
+		return options
 	}), nil
 }
 
@@ -3,12 +3,19 @@ package provisioner
 import (
 	"bytes"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/json"
+	"errors"
 	"reflect"
 	"testing"
+	"time"
 
+	"github.com/stretchr/testify/assert"
 	"go.step.sm/crypto/pemutil"
 	"go.step.sm/crypto/x509util"
+
+	"github.com/smallstep/certificates/authority/policy"
 )
 
 func parseCertificateRequest(t *testing.T, filename string) *x509.CertificateRequest {
@@ -98,6 +105,98 @@ func TestOptions_GetWebhooks(t *testing.T) {
 	}
 }
 
+func TestRateLimitOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		options *RateLimitOptions
+		wantErr bool
+	}{
+		{"nil", nil, false},
+		{"ok", &RateLimitOptions{RequestsPerMinute: 60}, false},
+		{"ok burst", &RateLimitOptions{RequestsPerMinute: 60, Burst: 10}, false},
+		{"fail requestsPerMinute", &RateLimitOptions{}, true},
+		{"fail negative requestsPerMinute", &RateLimitOptions{RequestsPerMinute: -1}, true},
+		{"fail burst", &RateLimitOptions{RequestsPerMinute: 60, Burst: -1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.options.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("RateLimitOptions.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestApprovalOptions(t *testing.T) {
+	tests := []struct {
+		name           string
+		options        *ApprovalOptions
+		wantErr        bool
+		wantRequired   bool
+		wantExpiration time.Duration
+	}{
+		{"nil", nil, false, false, 24 * time.Hour},
+		{"ok", &ApprovalOptions{Required: true}, false, true, 24 * time.Hour},
+		{"ok expiration", &ApprovalOptions{Required: true, Expiration: &Duration{Duration: time.Hour}}, false, true, time.Hour},
+		{"fail expiration", &ApprovalOptions{Required: true, Expiration: &Duration{Duration: -time.Hour}}, true, true, 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.options.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("ApprovalOptions.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := tt.options.IsRequired(); got != tt.wantRequired {
+				t.Errorf("ApprovalOptions.IsRequired() = %v, want %v", got, tt.wantRequired)
+			}
+			if got := tt.options.GetExpiration(); got != tt.wantExpiration {
+				t.Errorf("ApprovalOptions.GetExpiration() = %v, want %v", got, tt.wantExpiration)
+			}
+		})
+	}
+}
+
+func TestRateLimitOptions_GetBurst(t *testing.T) {
+	if got := (&RateLimitOptions{RequestsPerMinute: 60}).GetBurst(); got != 60 {
+		t.Errorf("RateLimitOptions.GetBurst() = %d, want 60", got)
+	}
+	if got := (&RateLimitOptions{RequestsPerMinute: 60, Burst: 5}).GetBurst(); got != 5 {
+		t.Errorf("RateLimitOptions.GetBurst() = %d, want 5", got)
+	}
+}
+
+func TestState_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		state   State
+		wantErr bool
+	}{
+		{"empty", "", false},
+		{"active", StateActive, false},
+		{"deprecated", StateDeprecated, false},
+		{"fail", "disabled", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.state.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("State.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOptions_IsDeprecated(t *testing.T) {
+	var o *Options
+	if o.IsDeprecated() {
+		t.Error("Options.IsDeprecated() = true, want false")
+	}
+	if (&Options{State: StateActive}).IsDeprecated() {
+		t.Error("Options.IsDeprecated() = true, want false")
+	}
+	if !(&Options{State: StateDeprecated}).IsDeprecated() {
+		t.Error("Options.IsDeprecated() = false, want true")
+	}
+}
+
 func TestProvisionerX509Options_HasTemplate(t *testing.T) {
 	type fields struct {
 		Template     string
@@ -353,3 +452,453 @@ func TestX509Options_IsWildcardLiteralAllowed(t *testing.T) {
 		})
 	}
 }
+
+func TestX509Options_GetCommonNameMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		options *X509Options
+		want    CommonNameMode
+	}{
+		{"nil-options", nil, CommonNameReject},
+		{"empty", &X509Options{}, CommonNameReject},
+		{"reject", &X509Options{CommonNameMode: CommonNameReject}, CommonNameReject},
+		{"promote", &X509Options{CommonNameMode: CommonNamePromote}, CommonNamePromote},
+		{"drop", &X509Options{CommonNameMode: CommonNameDrop}, CommonNameDrop},
+		{"unknown", &X509Options{CommonNameMode: "foo"}, CommonNameReject},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.options.GetCommonNameMode(); got != tt.want {
+				t.Errorf("X509Options.GetCommonNameMode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOtherName_Validate(t *testing.T) {
+	tests := []struct {
+		name      string
+		otherName OtherName
+		wantErr   bool
+	}{
+		{"ok", OtherName{OID: "1.3.6.1.4.1.311.20.2.3", Value: "{{ .Token.upn }}"}, false},
+		{"ok type", OtherName{OID: "1.2.3.4", Type: "ia5", Value: "foo"}, false},
+		{"fail empty oid", OtherName{OID: "", Value: "foo"}, true},
+		{"fail short oid", OtherName{OID: "1", Value: "foo"}, true},
+		{"fail bad oid", OtherName{OID: "1.3.foo.4", Value: "foo"}, true},
+		{"fail negative oid", OtherName{OID: "1.3.-6.1", Value: "foo"}, true},
+		{"fail bad oid root", OtherName{OID: "3.1.2", Value: "foo"}, true},
+		{"fail bad oid second", OtherName{OID: "1.40.2", Value: "foo"}, true},
+		{"fail type", OtherName{OID: "1.2.3.4", Type: "int", Value: "foo"}, true},
+		{"fail empty value", OtherName{OID: "1.2.3.4", Value: " "}, true},
+		{"fail value template", OtherName{OID: "1.2.3.4", Value: "{{ .Token.upn "}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.otherName.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("OtherName.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIssuerAltName_Validate(t *testing.T) {
+	tests := []struct {
+		name          string
+		issuerAltName IssuerAltName
+		wantErr       bool
+	}{
+		{"ok dns", IssuerAltName{Type: "dns", Value: "ca.example.com"}, false},
+		{"ok email", IssuerAltName{Type: "email", Value: "ca@example.com"}, false},
+		{"ok uri", IssuerAltName{Type: "uri", Value: "https://ca.example.com/issuer"}, false},
+		{"ok urn", IssuerAltName{Type: "uri", Value: "urn:uuid:f81d4fae-7dec-11d0-a765-00a0c91e6bf6"}, false},
+		{"fail type", IssuerAltName{Type: "ip", Value: "127.0.0.1"}, true},
+		{"fail empty value", IssuerAltName{Type: "dns", Value: ""}, true},
+		{"fail spaces", IssuerAltName{Type: "dns", Value: "ca example.com"}, true},
+		{"fail non ascii", IssuerAltName{Type: "email", Value: "ca@exámple.com"}, true},
+		{"fail dns label", IssuerAltName{Type: "dns", Value: "ca..example.com"}, true},
+		{"fail dns email", IssuerAltName{Type: "dns", Value: "ca@example.com"}, true},
+		{"fail email", IssuerAltName{Type: "email", Value: "ca.example.com"}, true},
+		{"fail email no domain", IssuerAltName{Type: "email", Value: "ca@"}, true},
+		{"fail uri no scheme", IssuerAltName{Type: "uri", Value: "ca.example.com/issuer"}, true},
+		{"fail uri no host", IssuerAltName{Type: "uri", Value: "https:///issuer"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.issuerAltName.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("IssuerAltName.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCustomTemplateOptions_issuerAltNames(t *testing.T) {
+	csr := parseCertificateRequest(t, "testdata/certs/ecdsa.csr")
+	data := x509util.CreateTemplateData("jane", []string{"jane.example.com"})
+	issuerAltNames := []IssuerAltName{
+		{Type: "uri", Value: "https://ca.example.com"},
+		{Type: "email", Value: "ca@example.com"},
+		{Type: "dns", Value: "ca.example.com"},
+	}
+	want := []asn1.RawValue{
+		{Class: asn1.ClassContextSpecific, Tag: 6, Bytes: []byte("https://ca.example.com")},
+		{Class: asn1.ClassContextSpecific, Tag: 1, Bytes: []byte("ca@example.com")},
+		{Class: asn1.ClassContextSpecific, Tag: 2, Bytes: []byte("ca.example.com")},
+	}
+
+	tests := []struct {
+		name     string
+		template string
+	}{
+		{"ok", ""},
+		{"ok replace extension", `{"subject": {{ toJson .Subject }}, "extensions": [{"id": "2.5.29.18", "value": "MAA="}, {"id": "1.2.3.4", "value": "BQA="}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &Options{X509: &X509Options{Template: tt.template, IssuerAltNames: issuerAltNames}}
+			cof, err := CustomTemplateOptions(o, data, x509util.DefaultLeafTemplate)
+			if err != nil {
+				t.Fatalf("CustomTemplateOptions() error = %v", err)
+			}
+			crt, err := x509util.NewCertificate(csr, cof.Options(SignOptions{})...)
+			if err != nil {
+				t.Fatalf("x509util.NewCertificate() error = %v", err)
+			}
+
+			var exts []pkix.Extension
+			for _, e := range crt.GetCertificate().ExtraExtensions {
+				if e.Id.Equal(oidExtensionIssuerAltName) {
+					exts = append(exts, e)
+				}
+			}
+			if len(exts) != 1 {
+				t.Fatalf("certificate contains %d issuerAltName extensions, want 1", len(exts))
+			}
+			if exts[0].Critical {
+				t.Error("issuerAltName extension is critical")
+			}
+
+			var names []asn1.RawValue
+			if rest, err := asn1.Unmarshal(exts[0].Value, &names); err != nil || len(rest) > 0 {
+				t.Fatalf("asn1.Unmarshal() error = %v, rest = %x", err, rest)
+			}
+			if len(names) != len(want) {
+				t.Fatalf("issuerAltName contains %d names, want %d", len(names), len(want))
+			}
+			for i, name := range names {
+				if name.Class != want[i].Class || name.Tag != want[i].Tag || string(name.Bytes) != string(want[i].Bytes) {
+					t.Errorf("issuerAltName[%d] = {class: %d, tag: %d, value: %s}, want {class: %d, tag: %d, value: %s}",
+						i, name.Class, name.Tag, name.Bytes, want[i].Class, want[i].Tag, want[i].Bytes)
+				}
+			}
+		})
+	}
+}
+
+func TestCustomTemplateOptions_otherNames(t *testing.T) {
+	csr := parseCertificateRequest(t, "testdata/certs/ecdsa.csr")
+	oidUPN := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 20, 2, 3}
+	oidSAN := asn1.ObjectIdentifier{2, 5, 29, 17}
+
+	newData := func() x509util.TemplateData {
+		data := x509util.CreateTemplateData("jane", []string{"jane.example.com"})
+		data.SetToken(map[string]any{"upn": "jane@example.com"})
+		return data
+	}
+
+	tests := []struct {
+		name       string
+		otherNames []OtherName
+		template   string
+		wantValue  string
+		wantTag    int
+		wantErr    bool
+	}{
+		{"ok upn", []OtherName{{OID: "1.3.6.1.4.1.311.20.2.3", Value: "{{ .Token.upn }}"}}, "", "jane@example.com", asn1.TagUTF8String, false},
+		{"ok ia5", []OtherName{{OID: "1.3.6.1.4.1.311.20.2.3", Type: "ia5", Value: "{{ .Token.upn }}"}}, "", "jane@example.com", asn1.TagIA5String, false},
+		{"ok custom template", []OtherName{{OID: "1.3.6.1.4.1.311.20.2.3", Value: "{{ .Subject.CommonName }}@example.com"}}, `{"subject": {{ toJson .Subject }}}`, "jane@example.com", asn1.TagUTF8String, false},
+		{"fail missing claim", []OtherName{{OID: "1.3.6.1.4.1.311.20.2.3", Value: "{{ .Token.missing }}"}}, "", "", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &Options{X509: &X509Options{Template: tt.template, OtherNames: tt.otherNames}}
+			cof, err := CustomTemplateOptions(o, newData(), x509util.DefaultLeafTemplate)
+			if err != nil {
+				t.Fatalf("CustomTemplateOptions() error = %v", err)
+			}
+			crt, err := x509util.NewCertificate(csr, cof.Options(SignOptions{})...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("x509util.NewCertificate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				var te *x509util.TemplateError
+				if !errors.As(err, &te) {
+					t.Errorf("x509util.NewCertificate() error = %T, want *x509util.TemplateError", err)
+				}
+				return
+			}
+
+			var ext *pkix.Extension
+			for _, e := range crt.GetCertificate().ExtraExtensions {
+				if e.Id.Equal(oidSAN) {
+					ext = &e
+					break
+				}
+			}
+			if ext == nil {
+				t.Fatal("certificate does not contain a SAN extension")
+			}
+
+			var names []asn1.RawValue
+			if _, err := asn1.Unmarshal(ext.Value, &names); err != nil {
+				t.Fatal(err)
+			}
+			var found bool
+			for _, name := range names {
+				if name.Class != asn1.ClassContextSpecific || name.Tag != 0 {
+					continue
+				}
+				var on struct {
+					TypeID asn1.ObjectIdentifier
+					Value  asn1.RawValue `asn1:"tag:0"`
+				}
+				if _, err := asn1.UnmarshalWithParams(name.FullBytes, &on, "tag:0"); err != nil {
+					t.Fatal(err)
+				}
+				if !on.TypeID.Equal(oidUPN) {
+					t.Errorf("otherName type-id = %v, want %v", on.TypeID, oidUPN)
+				}
+				var value asn1.RawValue
+				if _, err := asn1.Unmarshal(on.Value.Bytes, &value); err != nil {
+					t.Fatal(err)
+				}
+				if value.Tag != tt.wantTag {
+					t.Errorf("otherName value tag = %d, want %d", value.Tag, tt.wantTag)
+				}
+				if got := string(value.Bytes); got != tt.wantValue {
+					t.Errorf("otherName value = %s, want %s", got, tt.wantValue)
+				}
+				found = true
+			}
+			if !found {
+				t.Error("SAN extension does not contain an otherName")
+			}
+		})
+	}
+}
+
+func TestValidityAlignment_Align(t *testing.T) {
+	est := time.FixedZone("EST", -5*60*60)
+	tests := []struct {
+		name      string
+		alignment ValidityAlignment
+		t         time.Time
+		want      time.Time
+	}{
+		{"none", "", time.Date(2024, 3, 13, 15, 4, 5, 0, time.UTC), time.Date(2024, 3, 13, 15, 4, 5, 0, time.UTC)},
+		{"zero", ValidityAlignmentDaily, time.Time{}, time.Time{}},
+		{"daily", ValidityAlignmentDaily, time.Date(2024, 3, 13, 15, 4, 5, 0, time.UTC), time.Date(2024, 3, 13, 0, 0, 0, 0, time.UTC)},
+		{"daily midnight", ValidityAlignmentDaily, time.Date(2024, 3, 13, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 13, 0, 0, 0, 0, time.UTC)},
+		{"daily other zone", ValidityAlignmentDaily, time.Date(2024, 3, 13, 22, 0, 0, 0, est), time.Date(2024, 3, 14, 0, 0, 0, 0, time.UTC)},
+		{"weekly wednesday", ValidityAlignmentWeekly, time.Date(2024, 3, 13, 15, 4, 5, 0, time.UTC), time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC)},
+		{"weekly monday", ValidityAlignmentWeekly, time.Date(2024, 3, 11, 15, 4, 5, 0, time.UTC), time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC)},
+		{"weekly sunday", ValidityAlignmentWeekly, time.Date(2024, 3, 17, 23, 59, 59, 0, time.UTC), time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.alignment.Align(tt.t); !got.Equal(tt.want) {
+				t.Errorf("ValidityAlignment.Align() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidityAlignment_AlignNotAfter(t *testing.T) {
+	now := time.Date(2024, 3, 13, 23, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		alignment   ValidityAlignment
+		notBefore   time.Time
+		notAfter    time.Time
+		minDuration time.Duration
+		want        time.Time
+	}{
+		{"ok", ValidityAlignmentDaily, now, now.Add(48 * time.Hour), 5 * time.Minute, time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)},
+		{"ok none", "", now, now.Add(48 * time.Hour), 5 * time.Minute, now.Add(48 * time.Hour)},
+		{"ok before now", ValidityAlignmentDaily, now, now.Add(20 * time.Minute), 5 * time.Minute, now.Add(20 * time.Minute)},
+		{"ok at now", ValidityAlignmentDaily, now.Add(-time.Hour), time.Date(2024, 3, 14, 0, 30, 0, 0, time.UTC), 0, time.Date(2024, 3, 14, 0, 0, 0, 0, time.UTC)},
+		{"ok below minimum", ValidityAlignmentWeekly, now, now.Add(24 * time.Hour), time.Hour, now.Add(24 * time.Hour)},
+		{"ok minimum", ValidityAlignmentDaily, now, now.Add(26 * time.Hour), 30 * time.Minute, time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.alignment.AlignNotAfter(tt.notBefore, tt.notAfter, now, tt.minDuration); !got.Equal(tt.want) {
+				t.Errorf("ValidityAlignment.AlignNotAfter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidityAlignment_Validate(t *testing.T) {
+	for _, a := range []ValidityAlignment{"", ValidityAlignmentDaily, ValidityAlignmentWeekly} {
+		if err := a.Validate(); err != nil {
+			t.Errorf("ValidityAlignment.Validate() error = %v", err)
+		}
+	}
+	if err := ValidityAlignment("monthly").Validate(); err == nil {
+		t.Error("ValidityAlignment.Validate() error = nil, want error")
+	}
+}
+
+func Test_mergeOptions(t *testing.T) {
+	rateLimit := &RateLimitOptions{RequestsPerMinute: 10}
+	webhooks := []*Webhook{{Name: "foo"}}
+	defaults := &Options{
+		X509: &X509Options{
+			Template:       "{{ toJson .Insecure.CR }}",
+			CommonNameMode: CommonNameDrop,
+			DeniedNames:    &policy.X509NameOptions{DNSDomains: []string{"*.internal"}},
+		},
+		SSH: &SSHOptions{
+			KeyID: "{{ .Token.sub }}",
+		},
+		Webhooks:  webhooks,
+		RateLimit: rateLimit,
+	}
+	tests := []struct {
+		name     string
+		o        *Options
+		defaults *Options
+		want     *Options
+	}{
+		{"nil defaults", &Options{X509: &X509Options{Template: "foo"}}, nil, &Options{X509: &X509Options{Template: "foo"}}},
+		{"nil options", nil, defaults, defaults},
+		{"empty options", &Options{}, defaults, defaults},
+		{"override", &Options{
+			X509: &X509Options{
+				TemplateFile: "leaf.tpl",
+				AllowedNames: &policy.X509NameOptions{DNSDomains: []string{"*.example.com"}},
+			},
+			SSH:       &SSHOptions{TemplateData: []byte(`{"foo":"bar"}`)},
+			RateLimit: &RateLimitOptions{RequestsPerMinute: 1},
+		}, defaults, &Options{
+			X509: &X509Options{
+				TemplateFile:   "leaf.tpl",
+				CommonNameMode: CommonNameDrop,
+				AllowedNames:   &policy.X509NameOptions{DNSDomains: []string{"*.example.com"}},
+			},
+			SSH: &SSHOptions{
+				TemplateData: []byte(`{"foo":"bar"}`),
+				KeyID:        "{{ .Token.sub }}",
+			},
+			Webhooks:  webhooks,
+			RateLimit: &RateLimitOptions{RequestsPerMinute: 1},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergeOptions(tt.o, tt.defaults, TypeJWK); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergeOptions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_mergeX509Options(t *testing.T) {
+	tests := []struct {
+		name     string
+		o        *X509Options
+		defaults *X509Options
+		want     *X509Options
+	}{
+		{"nil defaults", &X509Options{Template: "foo"}, nil, &X509Options{Template: "foo"}},
+		{"template", nil, &X509Options{Template: "foo"}, &X509Options{Template: "foo"}},
+		{"template file", nil, &X509Options{TemplateFile: "leaf.tpl"}, &X509Options{TemplateFile: "leaf.tpl"}},
+		{"template override", &X509Options{TemplateFile: "leaf.tpl"}, &X509Options{Template: "foo"}, &X509Options{TemplateFile: "leaf.tpl"}},
+		{"template data", nil, &X509Options{TemplateData: []byte(`{"foo":"bar"}`)}, &X509Options{TemplateData: []byte(`{"foo":"bar"}`)}},
+		{"enable template dns lookups", &X509Options{}, &X509Options{EnableTemplateDNSLookups: true}, &X509Options{EnableTemplateDNSLookups: true}},
+		{"allowed names", nil, &X509Options{
+			AllowedNames: &policy.X509NameOptions{DNSDomains: []string{"*.example.com"}}, AllowWildcardNames: true,
+		}, &X509Options{
+			AllowedNames: &policy.X509NameOptions{DNSDomains: []string{"*.example.com"}}, AllowWildcardNames: true,
+		}},
+		{"denied names override", &X509Options{
+			DeniedNames: &policy.X509NameOptions{DNSDomains: []string{"*.internal"}},
+		}, &X509Options{
+			AllowedNames: &policy.X509NameOptions{DNSDomains: []string{"*.example.com"}},
+		}, &X509Options{
+			DeniedNames: &policy.X509NameOptions{DNSDomains: []string{"*.internal"}},
+		}},
+		{"common name mode", nil, &X509Options{CommonNameMode: CommonNameDrop}, &X509Options{CommonNameMode: CommonNameDrop}},
+		{"other names", nil, &X509Options{OtherNames: []OtherName{{OID: "1.2.3.4", Value: "foo"}}}, &X509Options{OtherNames: []OtherName{{OID: "1.2.3.4", Value: "foo"}}}},
+		{"not after alignment", nil, &X509Options{NotAfterAlignment: ValidityAlignmentDaily}, &X509Options{NotAfterAlignment: ValidityAlignmentDaily}},
+		{"issuer alt names", nil, &X509Options{IssuerAltNames: []IssuerAltName{{Type: "dns", Value: "ca.example.com"}}}, &X509Options{IssuerAltNames: []IssuerAltName{{Type: "dns", Value: "ca.example.com"}}}},
+		{"caa", nil, &X509Options{CAA: &CAAOptions{}}, &X509Options{CAA: &CAAOptions{}}},
+		{"allow precertificates", nil, &X509Options{AllowPrecertificates: true}, &X509Options{AllowPrecertificates: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, mergeX509Options(tt.o, tt.defaults))
+		})
+	}
+}
+
+func Test_mergeSSHOptions(t *testing.T) {
+	userPrincipals := []*SSHUserPrincipalRule{{Identity: "*@example.com", Principals: []string{"{{ .LocalPart }}"}}}
+	sourceAddress := &SSHSourceAddress{CIDRs: []string{"10.0.0.0/8"}}
+	tests := []struct {
+		name     string
+		o        *SSHOptions
+		defaults *SSHOptions
+		typ      Type
+		want     *SSHOptions
+	}{
+		{"nil defaults", &SSHOptions{Template: "foo"}, nil, TypeJWK, &SSHOptions{Template: "foo"}},
+		{"template", nil, &SSHOptions{Template: "foo"}, TypeJWK, &SSHOptions{Template: "foo"}},
+		{"template file", nil, &SSHOptions{TemplateFile: "ssh.tpl"}, TypeJWK, &SSHOptions{TemplateFile: "ssh.tpl"}},
+		{"template data", nil, &SSHOptions{TemplateData: []byte(`{"foo":"bar"}`)}, TypeJWK, &SSHOptions{TemplateData: []byte(`{"foo":"bar"}`)}},
+		{"enable template dns lookups", &SSHOptions{}, &SSHOptions{EnableTemplateDNSLookups: true}, TypeJWK, &SSHOptions{EnableTemplateDNSLookups: true}},
+		{"key id", nil, &SSHOptions{KeyID: "{{ .Token.sub }}"}, TypeJWK, &SSHOptions{KeyID: "{{ .Token.sub }}"}},
+		{"critical options", nil, &SSHOptions{CriticalOptions: map[string]string{"force-command": "/bin/true"}}, TypeJWK, &SSHOptions{CriticalOptions: map[string]string{"force-command": "/bin/true"}}},
+		{"critical options override", &SSHOptions{CriticalOptions: map[string]string{}}, &SSHOptions{CriticalOptions: map[string]string{"force-command": "/bin/true"}}, TypeJWK, &SSHOptions{CriticalOptions: map[string]string{}}},
+		{"extensions", nil, &SSHOptions{Extensions: map[string]string{"permit-pty": ""}}, TypeJWK, &SSHOptions{Extensions: map[string]string{"permit-pty": ""}}},
+		{"principal options", nil, &SSHOptions{PrincipalOptions: map[string]*SSHPrincipalOptions{"root": {Extensions: map[string]string{"permit-pty": ""}}}}, TypeJWK, &SSHOptions{PrincipalOptions: map[string]*SSHPrincipalOptions{"root": {Extensions: map[string]string{"permit-pty": ""}}}}},
+		{"user principals", nil, &SSHOptions{UserPrincipals: userPrincipals}, TypeOIDC, &SSHOptions{UserPrincipals: userPrincipals}},
+		{"user principals not supported", nil, &SSHOptions{UserPrincipals: userPrincipals}, TypeACME, &SSHOptions{}},
+		{"source address", nil, &SSHOptions{SourceAddress: sourceAddress}, TypeX5C, &SSHOptions{SourceAddress: sourceAddress}},
+		{"source address not supported", nil, &SSHOptions{SourceAddress: sourceAddress}, TypeAWS, &SSHOptions{}},
+		{"user and host", nil, &SSHOptions{User: &policy.SSHUserCertificateOptions{}}, TypeJWK, &SSHOptions{User: &policy.SSHUserCertificateOptions{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, mergeSSHOptions(tt.o, tt.defaults, tt.typ))
+		})
+	}
+}
+
+func Test_patchCertificateTemplate(t *testing.T) {
+	buf := bytes.NewBufferString(`{"subject":{"commonName":"foo"},"sans":null}`)
+	got, err := patchCertificateTemplate(buf, func(f templateFields) error {
+		var sans []string
+		if err := f.get("sans", &sans); err != nil {
+			return err
+		}
+		var subject map[string]string
+		if err := f.get("subject", &subject); err != nil {
+			return err
+		}
+		return f.set("sans", append(sans, subject["commonName"]))
+	})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"subject":{"commonName":"foo"},"sans":["foo"]}`, got.String())
+
+	_, err = patchCertificateTemplate(bytes.NewBufferString(`{`), func(templateFields) error { return nil })
+	assert.Error(t, err)
+	_, err = patchCertificateTemplate(buf, func(f templateFields) error {
+		var sans []string
+		return f.get("subject", &sans)
+	})
+	assert.EqualError(t, err, "error unmarshaling certificate subject: json: cannot unmarshal object into Go value of type []string")
+	_, err = patchCertificateTemplate(buf, func(templateFields) error { return errors.New("force") })
+	assert.EqualError(t, err, "force")
+}
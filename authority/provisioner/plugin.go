@@ -0,0 +1,374 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/pemutil"
+	"go.step.sm/crypto/sshutil"
+	"go.step.sm/crypto/x509util"
+	"go.step.sm/linkedca"
+
+	"github.com/smallstep/certificates/authority/provisioner/plugin"
+	"github.com/smallstep/certificates/errs"
+)
+
+// pluginDefaultTimeout is the default timeout of the requests to a plugin.
+const pluginDefaultTimeout = 10 * time.Second
+
+// pluginClient is the interface used to call a plugin, implemented by
+// *plugin.Client.
+type pluginClient interface {
+	AuthorizeSign(context.Context, *plugin.AuthorizeSignRequest) (*plugin.AuthorizeSignResponse, error)
+	AuthorizeRenew(context.Context, *plugin.AuthorizeRenewRequest) (*plugin.AuthorizeRenewResponse, error)
+	AuthorizeRevoke(context.Context, *plugin.AuthorizeRevokeRequest) (*plugin.AuthorizeRevokeResponse, error)
+	AuthorizeSSHSign(context.Context, *plugin.AuthorizeSSHSignRequest) (*plugin.AuthorizeSSHSignResponse, error)
+}
+
+// Plugin is a provisioner that delegates the authorization of the requests to
+// an external process implementing the gRPC service defined in the plugin
+// package. It allows to implement proprietary authentication schemes without
+// modifying the CA.
+//
+// The tokens must be JWTs with the sign (or revoke, ssh sign) audience of the
+// CA with the provisioner id as a fragment, e.g.
+// https://ca.example.com/1.0/sign#plugin/my-plugin, so the CA can load the
+// provisioner. The plugin is responsible for the validation of the tokens.
+type Plugin struct {
+	*base
+	ID   string `json:"-"`
+	Type string `json:"type"`
+	Name string `json:"name"`
+	// Address is the gRPC target of the plugin, e.g. plugin.example.com:9443
+	// or unix:///run/step/plugin.sock.
+	Address string `json:"address"`
+	// Roots is a PEM bundle used to verify the plugin certificate. The system
+	// roots are used by default.
+	Roots []byte `json:"roots,omitempty"`
+	// Insecure disables TLS in the connection with the plugin. Connections
+	// using unix sockets never use TLS.
+	Insecure bool `json:"insecure,omitempty"`
+	// Timeout is the maximum time to wait for a plugin response, 10s by
+	// default.
+	Timeout *Duration `json:"timeout,omitempty"`
+	Claims  *Claims   `json:"claims,omitempty"`
+	Options *Options  `json:"options,omitempty"`
+	client  pluginClient
+	ctl     *Controller
+}
+
+// GetID returns the provisioner unique identifier.
+func (p *Plugin) GetID() string {
+	if p.ID != "" {
+		return p.ID
+	}
+	return p.GetIDForToken()
+}
+
+// GetIDForToken returns an identifier that will be used to load the provisioner
+// from a token.
+func (p *Plugin) GetIDForToken() string {
+	return "plugin/" + p.Name
+}
+
+// GetTokenID returns the identifier of the token.
+func (p *Plugin) GetTokenID(ott string) (string, error) {
+	token, err := jose.ParseSigned(ott)
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing token")
+	}
+	var claims jose.Claims
+	if err = token.UnsafeClaimsWithoutVerification(&claims); err != nil {
+		return "", errors.Wrap(err, "error verifying claims")
+	}
+	return claims.ID, nil
+}
+
+// GetName returns the name of the provisioner.
+func (p *Plugin) GetName() string {
+	return p.Name
+}
+
+// GetType returns the type of provisioner.
+func (p *Plugin) GetType() Type {
+	return TypePlugin
+}
+
+// GetEncryptedKey returns false, because the plugin provisioner does not
+// have access to the private key.
+func (p *Plugin) GetEncryptedKey() (string, string, bool) {
+	return "", "", false
+}
+
+// GetOptions returns the configured provisioner options.
+func (p *Plugin) GetOptions() *Options {
+	return p.Options
+}
+
+// Init initializes and validates the fields of a Plugin type.
+func (p *Plugin) Init(config Config) (err error) {
+	switch {
+	case p.Type == "":
+		return errors.New("provisioner type cannot be empty")
+	case p.Name == "":
+		return errors.New("provisioner name cannot be empty")
+	case p.Address == "":
+		return errors.New("provisioner address cannot be empty")
+	case p.Timeout != nil && p.Timeout.Duration < 0:
+		return errors.New("provisioner timeout cannot be negative")
+	}
+
+	conn, err := p.getConnection()
+	if err != nil {
+		return err
+	}
+	p.client = plugin.NewClient(conn)
+
+	config.Audiences = config.Audiences.WithFragment(p.GetIDForToken())
+	p.Options = mergeOptions(p.Options, config.DefaultOptions, p.GetType())
+	p.ctl, err = NewController(p, p.Claims, config, p.Options)
+	return
+}
+
+// pluginConnections stores the connections to the plugins indexed by the
+// address and the transport options. The connections are shared by all the
+// provisioners using the same plugin, and they are reused when the
+// provisioners are loaded again, instead of creating a new one every time.
+var pluginConnections = struct {
+	sync.Mutex
+	m map[string]*grpc.ClientConn
+}{m: make(map[string]*grpc.ClientConn)}
+
+// getConnection returns the connection to the plugin, creating it if
+// necessary. The connection is established on the first request.
+func (p *Plugin) getConnection() (*grpc.ClientConn, error) {
+	insecureTransport := p.Insecure || strings.HasPrefix(p.Address, "unix:")
+	sum := sha256.Sum256(p.Roots)
+	key := fmt.Sprintf("%s|%t|%x", p.Address, insecureTransport, sum)
+
+	pluginConnections.Lock()
+	defer pluginConnections.Unlock()
+	if conn, ok := pluginConnections.m[key]; ok {
+		return conn, nil
+	}
+
+	var creds credentials.TransportCredentials
+	if insecureTransport {
+		creds = insecure.NewCredentials()
+	} else {
+		tlsConfig := &tls.Config{
+			MinVersion: tls.VersionTLS12,
+		}
+		if len(p.Roots) > 0 {
+			certs, err := pemutil.ParseCertificateBundle(p.Roots)
+			if err != nil {
+				return nil, errors.Wrap(err, "error parsing roots")
+			}
+			tlsConfig.RootCAs = x509.NewCertPool()
+			for _, crt := range certs {
+				tlsConfig.RootCAs.AddCert(crt)
+			}
+		}
+		creds = credentials.NewTLS(tlsConfig)
+	}
+
+	conn, err := grpc.NewClient(p.Address, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error creating plugin client for %q", p.Address)
+	}
+	pluginConnections.m[key] = conn
+	return conn, nil
+}
+
+// ClosePluginConnections closes the connections to the plugins. It must only
+// be called when the CA is shut down, after stopping all the authorities using
+// them, the plugin provisioners cannot be used after it.
+func ClosePluginConnections() error {
+	pluginConnections.Lock()
+	defer pluginConnections.Unlock()
+	var err error
+	for key, conn := range pluginConnections.m {
+		if e := conn.Close(); e != nil && err == nil {
+			err = fmt.Errorf("error closing plugin connection to %s: %w", conn.Target(), e)
+		}
+		delete(pluginConnections.m, key)
+	}
+	return err
+}
+
+// context returns a context with the timeout of the plugin requests.
+func (p *Plugin) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := pluginDefaultTimeout
+	if p.Timeout != nil && p.Timeout.Duration > 0 {
+		timeout = p.Timeout.Duration
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// AuthorizeSign validates the token with the plugin and returns the sign
+// options with the subject and SANs returned by the plugin.
+func (p *Plugin) AuthorizeSign(ctx context.Context, token string) ([]SignOption, error) {
+	pctx, cancel := p.context(ctx)
+	defer cancel()
+	resp, err := p.client.AuthorizeSign(pctx, &plugin.AuthorizeSignRequest{
+		Provisioner: p.Name,
+		Token:       token,
+		Audiences:   p.ctl.Audiences.Sign,
+	})
+	if err != nil {
+		return nil, pluginError(err, "plugin.AuthorizeSign")
+	}
+
+	data := x509util.CreateTemplateData(resp.Subject, resp.SANs)
+	if v, err := unsafeParseSigned(token); err == nil {
+		data.SetToken(v)
+	}
+	for k, v := range resp.TemplateData {
+		data.Set(k, v)
+	}
+
+	templateOptions, err := TemplateOptions(p.Options, data)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "plugin.AuthorizeSign")
+	}
+
+	return []SignOption{
+		p,
+		templateOptions,
+		// modifiers / withOptions
+		newProvisionerExtensionOption(TypePlugin, p.Name, "").WithControllerOptions(p.ctl),
+		profileDefaultDuration(p.ctl.Claimer.DefaultTLSCertDuration()),
+		// validators
+		commonNameValidator(resp.Subject),
+		newDefaultSANsValidator(ctx, resp.SANs),
+		defaultPublicKeyValidator{},
+		newValidityValidator(p.ctl.Claimer.MinTLSCertDuration(), p.ctl.Claimer.MaxTLSCertDuration()),
+		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
+		p.ctl.newWebhookController(data, linkedca.Webhook_X509),
+	}, nil
+}
+
+// AuthorizeRenew returns an error if the renewal is disabled or if the
+// plugin denies it.
+func (p *Plugin) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) error {
+	if err := p.ctl.AuthorizeRenew(ctx, cert); err != nil {
+		return err
+	}
+	pctx, cancel := p.context(ctx)
+	defer cancel()
+	if _, err := p.client.AuthorizeRenew(pctx, &plugin.AuthorizeRenewRequest{
+		Provisioner: p.Name,
+		Certificate: cert.Raw,
+	}); err != nil {
+		return pluginError(err, "plugin.AuthorizeRenew")
+	}
+	return nil
+}
+
+// AuthorizeRevoke validates the revoke token with the plugin.
+func (p *Plugin) AuthorizeRevoke(ctx context.Context, token string) error {
+	pctx, cancel := p.context(ctx)
+	defer cancel()
+	if _, err := p.client.AuthorizeRevoke(pctx, &plugin.AuthorizeRevokeRequest{
+		Provisioner: p.Name,
+		Token:       token,
+		Audiences:   p.ctl.Audiences.Revoke,
+	}); err != nil {
+		return pluginError(err, "plugin.AuthorizeRevoke")
+	}
+	return nil
+}
+
+// AuthorizeSSHSign validates the token with the plugin and returns the SSH
+// sign options with the type, key id and principals returned by the plugin.
+func (p *Plugin) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption, error) {
+	if !p.ctl.Claimer.IsSSHCAEnabled() {
+		return nil, errs.Unauthorized("plugin.AuthorizeSSHSign; sshCA is disabled for plugin provisioner '%s'", p.GetName())
+	}
+	pctx, cancel := p.context(ctx)
+	defer cancel()
+	resp, err := p.client.AuthorizeSSHSign(pctx, &plugin.AuthorizeSSHSignRequest{
+		Provisioner: p.Name,
+		Token:       token,
+		Audiences:   p.ctl.Audiences.SSHSign,
+	})
+	if err != nil {
+		return nil, pluginError(err, "plugin.AuthorizeSSHSign")
+	}
+
+	certType, err := sshutil.CertTypeFromString(resp.CertType)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "plugin.AuthorizeSSHSign")
+	}
+
+	// Certificate templates.
+	data := sshutil.CreateTemplateData(certType, resp.KeyID, resp.Principals)
+	if v, err := unsafeParseSigned(token); err == nil {
+		data.SetToken(v)
+	}
+	for k, v := range resp.TemplateData {
+		data.Set(k, v)
+	}
+	audit := newSSHAuditMetadata(ctx, p, resp.KeyID, data)
+
+	templateOptions, err := TemplateSSHOptions(p.Options, data)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "plugin.AuthorizeSSHSign")
+	}
+
+	signOptions := []SignOption{templateOptions}
+
+	// Restrict the addresses from which the user certificates can be used.
+	if m := newSSHSourceAddressModifier(ctx, p.Options.GetSSHOptions()); m != nil {
+		signOptions = append(signOptions, m)
+	}
+
+	return append(signOptions,
+		p,
+		audit,
+		// validates user's SignSSHOptions with the ones returned by the plugin
+		sshCertOptionsValidator(SignSSHOptions{
+			CertType:   resp.CertType,
+			KeyID:      resp.KeyID,
+			Principals: resp.Principals,
+		}),
+		// Set the validity bounds if not set.
+		&sshDefaultDuration{p.ctl.Claimer},
+		// Validate public key
+		&sshDefaultPublicKeyValidator{},
+		// Validate the validity period.
+		&sshCertValidityValidator{p.ctl.Claimer},
+		// Require and validate all the default fields in the SSH certificate.
+		&sshCertDefaultValidator{},
+		// Ensure that all principal names are allowed
+		newSSHNamePolicyValidator(p.ctl.getPolicy().getSSHHost(), p.ctl.getPolicy().getSSHUser()),
+		// Call webhooks
+		p.ctl.newWebhookController(data, linkedca.Webhook_SSH),
+	), nil
+}
+
+// pluginError converts the error returned by a plugin to a forbidden error if
+// the plugin returned the codes.PermissionDenied code, or to an unauthorized
+// error otherwise.
+func pluginError(err error, prefix string) error {
+	st := status.Convert(err)
+	if st.Code() == codes.PermissionDenied {
+		return errs.Forbidden("%s; %s", prefix, st.Message())
+	}
+	return errs.Unauthorized("%s; plugin denied the request: %s", prefix, st.Message())
+}
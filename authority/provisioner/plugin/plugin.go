@@ -0,0 +1,244 @@
+// Package plugin defines the gRPC service implemented by the external plugins
+// used by the Plugin provisioner. A plugin authenticates the tokens of a
+// proprietary scheme and returns the attributes of the certificates that the
+// CA is allowed to sign.
+//
+// The messages are encoded using JSON, plugins only need to register an
+// implementation of the Server interface in a grpc.Server:
+//
+//	s := grpc.NewServer()
+//	plugin.RegisterServer(s, myPlugin)
+//	s.Serve(lis)
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/status"
+)
+
+// ServiceName is the full name of the gRPC service.
+const ServiceName = "step.provisioner.v1.Plugin"
+
+// codecName is the content-subtype used in the requests to the plugins.
+const codecName = "json"
+
+func init() {
+	encoding.RegisterCodec(codec{})
+}
+
+// AuthorizeSignRequest is the request to authorize the signature of an X.509
+// certificate.
+type AuthorizeSignRequest struct {
+	// Provisioner is the name of the provisioner.
+	Provisioner string `json:"provisioner"`
+	// Token is the token sent by the client.
+	Token string `json:"token"`
+	// Audiences are the audiences the token must be issued for.
+	Audiences []string `json:"audiences"`
+}
+
+// AuthorizeSignResponse contains the attributes of the X.509 certificate
+// that the CA is allowed to sign.
+type AuthorizeSignResponse struct {
+	// Subject is the common name of the certificate.
+	Subject string `json:"subject"`
+	// SANs are the subject alternative names of the certificate. The SANs in
+	// the certificate request must match them.
+	SANs []string `json:"sans"`
+	// TemplateData is extra data available in the certificate templates.
+	TemplateData map[string]interface{} `json:"templateData,omitempty"`
+}
+
+// AuthorizeRenewRequest is the request to authorize the renewal of an X.509
+// certificate.
+type AuthorizeRenewRequest struct {
+	// Provisioner is the name of the provisioner.
+	Provisioner string `json:"provisioner"`
+	// Certificate is the DER encoded certificate to renew.
+	Certificate []byte `json:"certificate"`
+}
+
+// AuthorizeRenewResponse is the response of a renew authorization.
+type AuthorizeRenewResponse struct{}
+
+// AuthorizeRevokeRequest is the request to authorize the revocation of a
+// certificate.
+type AuthorizeRevokeRequest struct {
+	// Provisioner is the name of the provisioner.
+	Provisioner string `json:"provisioner"`
+	// Token is the token sent by the client.
+	Token string `json:"token"`
+	// Audiences are the audiences the token must be issued for.
+	Audiences []string `json:"audiences"`
+}
+
+// AuthorizeRevokeResponse is the response of a revoke authorization.
+type AuthorizeRevokeResponse struct{}
+
+// AuthorizeSSHSignRequest is the request to authorize the signature of an SSH
+// certificate.
+type AuthorizeSSHSignRequest struct {
+	// Provisioner is the name of the provisioner.
+	Provisioner string `json:"provisioner"`
+	// Token is the token sent by the client.
+	Token string `json:"token"`
+	// Audiences are the audiences the token must be issued for.
+	Audiences []string `json:"audiences"`
+}
+
+// AuthorizeSSHSignResponse contains the attributes of the SSH certificate that
+// the CA is allowed to sign.
+type AuthorizeSSHSignResponse struct {
+	// CertType is the type of certificate, "user" or "host".
+	CertType string `json:"certType"`
+	// KeyID is the key id of the certificate.
+	KeyID string `json:"keyID"`
+	// Principals are the principals of the certificate.
+	Principals []string `json:"principals"`
+	// TemplateData is extra data available in the certificate templates.
+	TemplateData map[string]interface{} `json:"templateData,omitempty"`
+}
+
+// Server is the interface implemented by the plugins. A plugin denies a
+// request returning an error, errors with the codes.PermissionDenied code are
+// returned to the client as forbidden errors, others as unauthorized ones.
+type Server interface {
+	AuthorizeSign(context.Context, *AuthorizeSignRequest) (*AuthorizeSignResponse, error)
+	AuthorizeRenew(context.Context, *AuthorizeRenewRequest) (*AuthorizeRenewResponse, error)
+	AuthorizeRevoke(context.Context, *AuthorizeRevokeRequest) (*AuthorizeRevokeResponse, error)
+	AuthorizeSSHSign(context.Context, *AuthorizeSSHSignRequest) (*AuthorizeSSHSignResponse, error)
+}
+
+// UnimplementedServer can be embedded in a plugin to deny the methods it does
+// not implement.
+type UnimplementedServer struct{}
+
+// AuthorizeSign returns an unimplemented error.
+func (UnimplementedServer) AuthorizeSign(context.Context, *AuthorizeSignRequest) (*AuthorizeSignResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method AuthorizeSign not implemented")
+}
+
+// AuthorizeRenew returns an unimplemented error.
+func (UnimplementedServer) AuthorizeRenew(context.Context, *AuthorizeRenewRequest) (*AuthorizeRenewResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method AuthorizeRenew not implemented")
+}
+
+// AuthorizeRevoke returns an unimplemented error.
+func (UnimplementedServer) AuthorizeRevoke(context.Context, *AuthorizeRevokeRequest) (*AuthorizeRevokeResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method AuthorizeRevoke not implemented")
+}
+
+// AuthorizeSSHSign returns an unimplemented error.
+func (UnimplementedServer) AuthorizeSSHSign(context.Context, *AuthorizeSSHSignRequest) (*AuthorizeSSHSignResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method AuthorizeSSHSign not implemented")
+}
+
+// RegisterServer registers the plugin implementation in the given gRPC
+// server.
+func RegisterServer(s grpc.ServiceRegistrar, srv Server) {
+	s.RegisterService(&serviceDesc, srv)
+}
+
+// Client is the client used by the CA to call a plugin.
+type Client struct {
+	cc grpc.ClientConnInterface
+}
+
+// NewClient creates a new plugin client using the given connection.
+func NewClient(cc grpc.ClientConnInterface) *Client {
+	return &Client{cc: cc}
+}
+
+// AuthorizeSign calls the AuthorizeSign method of the plugin.
+func (c *Client) AuthorizeSign(ctx context.Context, in *AuthorizeSignRequest) (*AuthorizeSignResponse, error) {
+	out := new(AuthorizeSignResponse)
+	if err := c.invoke(ctx, "AuthorizeSign", in, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AuthorizeRenew calls the AuthorizeRenew method of the plugin.
+func (c *Client) AuthorizeRenew(ctx context.Context, in *AuthorizeRenewRequest) (*AuthorizeRenewResponse, error) {
+	out := new(AuthorizeRenewResponse)
+	if err := c.invoke(ctx, "AuthorizeRenew", in, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AuthorizeRevoke calls the AuthorizeRevoke method of the plugin.
+func (c *Client) AuthorizeRevoke(ctx context.Context, in *AuthorizeRevokeRequest) (*AuthorizeRevokeResponse, error) {
+	out := new(AuthorizeRevokeResponse)
+	if err := c.invoke(ctx, "AuthorizeRevoke", in, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AuthorizeSSHSign calls the AuthorizeSSHSign method of the plugin.
+func (c *Client) AuthorizeSSHSign(ctx context.Context, in *AuthorizeSSHSignRequest) (*AuthorizeSSHSignResponse, error) {
+	out := new(AuthorizeSSHSignResponse)
+	if err := c.invoke(ctx, "AuthorizeSSHSign", in, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *Client) invoke(ctx context.Context, method string, in, out interface{}) error {
+	return c.cc.Invoke(ctx, "/"+ServiceName+"/"+method, in, out, grpc.CallContentSubtype(codecName))
+}
+
+// codec is a gRPC codec that encodes the messages using JSON.
+type codec struct{}
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (codec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (codec) Name() string {
+	return codecName
+}
+
+func newHandler[Req any, Res any](method string, fn func(Server, context.Context, *Req) (*Res, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: method,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			in := new(Req)
+			if err := dec(in); err != nil {
+				return nil, err
+			}
+			if interceptor == nil {
+				return fn(srv.(Server), ctx, in)
+			}
+			info := &grpc.UnaryServerInfo{
+				Server:     srv,
+				FullMethod: "/" + ServiceName + "/" + method,
+			}
+			return interceptor(ctx, in, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+				return fn(srv.(Server), ctx, req.(*Req))
+			})
+		},
+	}
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*Server)(nil),
+	Methods: []grpc.MethodDesc{
+		newHandler("AuthorizeSign", Server.AuthorizeSign),
+		newHandler("AuthorizeRenew", Server.AuthorizeRenew),
+		newHandler("AuthorizeRevoke", Server.AuthorizeRevoke),
+		newHandler("AuthorizeSSHSign", Server.AuthorizeSSHSign),
+	},
+	Streams: []grpc.StreamDesc{},
+}
@@ -0,0 +1,185 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/x509util"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/status"
+
+	"github.com/smallstep/certificates/authority/provisioner/plugin"
+)
+
+type testPluginServer struct {
+	plugin.UnimplementedServer
+	t *testing.T
+}
+
+func (s *testPluginServer) AuthorizeSign(_ context.Context, req *plugin.AuthorizeSignRequest) (*plugin.AuthorizeSignResponse, error) {
+	assert.Equal(s.t, "my-plugin", req.Provisioner)
+	assert.Equal(s.t, []string{testAudiences.Sign[0] + "#plugin/my-plugin"}, req.Audiences[:1])
+	switch req.Token {
+	case "":
+		return nil, status.Error(codes.Unauthenticated, "token is required")
+	case "forbidden":
+		return nil, status.Error(codes.PermissionDenied, "device is not allowed")
+	default:
+		return &plugin.AuthorizeSignResponse{
+			Subject:      "device",
+			SANs:         []string{"device.example.com"},
+			TemplateData: map[string]interface{}{"DeviceID": "1234"},
+		}, nil
+	}
+}
+
+func (s *testPluginServer) AuthorizeRevoke(_ context.Context, req *plugin.AuthorizeRevokeRequest) (*plugin.AuthorizeRevokeResponse, error) {
+	if req.Token != "revoke" {
+		return nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+	return &plugin.AuthorizeRevokeResponse{}, nil
+}
+
+func (s *testPluginServer) AuthorizeSSHSign(_ context.Context, req *plugin.AuthorizeSSHSignRequest) (*plugin.AuthorizeSSHSignResponse, error) {
+	return &plugin.AuthorizeSSHSignResponse{
+		CertType:   "host",
+		KeyID:      "device",
+		Principals: []string{"device.example.com"},
+	}, nil
+}
+
+func newTestPluginServer(t *testing.T) string {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "plugin.sock")
+	lis, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	srv := grpc.NewServer()
+	plugin.RegisterServer(srv, &testPluginServer{t: t})
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	return "unix://" + socket
+}
+
+func TestPlugin_Init(t *testing.T) {
+	tests := []struct {
+		name    string
+		p       *Plugin
+		wantErr bool
+	}{
+		{"ok", &Plugin{Type: "Plugin", Name: "plugin", Address: "plugin.example.com:9443"}, false},
+		{"ok unix", &Plugin{Type: "Plugin", Name: "plugin", Address: "unix:///run/plugin.sock"}, false},
+		{"fail type", &Plugin{Name: "plugin", Address: "plugin.example.com:9443"}, true},
+		{"fail name", &Plugin{Type: "Plugin", Address: "plugin.example.com:9443"}, true},
+		{"fail address", &Plugin{Type: "Plugin", Name: "plugin"}, true},
+		{"fail roots", &Plugin{Type: "Plugin", Name: "plugin", Address: "plugin.example.com:9443", Roots: []byte("foo")}, true},
+		{"fail timeout", &Plugin{Type: "Plugin", Name: "plugin", Address: "plugin.example.com:9443", Timeout: &Duration{Duration: -time.Second}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences})
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "plugin/plugin", tt.p.GetID())
+			assert.Equal(t, TypePlugin, tt.p.GetType())
+		})
+	}
+}
+
+func TestClosePluginConnections(t *testing.T) {
+	address := newTestPluginServer(t)
+	newPlugin := func(name string) *Plugin {
+		p := &Plugin{Type: "Plugin", Name: name, Address: address}
+		require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+		return p
+	}
+
+	// The provisioners share the connection to the plugin.
+	conn1, err := newPlugin("plugin-1").getConnection()
+	require.NoError(t, err)
+	conn2, err := newPlugin("plugin-2").getConnection()
+	require.NoError(t, err)
+	assert.Same(t, conn1, conn2)
+
+	require.NoError(t, ClosePluginConnections())
+	assert.Equal(t, connectivity.Shutdown, conn1.GetState())
+	conn3, err := newPlugin("plugin-1").getConnection()
+	require.NoError(t, err)
+	assert.NotSame(t, conn1, conn3)
+	require.NoError(t, ClosePluginConnections())
+}
+
+func TestPlugin_Authorize(t *testing.T) {
+	p := &Plugin{
+		Type:    "Plugin",
+		Name:    "my-plugin",
+		Address: newTestPluginServer(t),
+		Options: &Options{
+			X509: &X509Options{Template: `{"subject": {"commonName": {{ toJson .Subject.CommonName }}, "serialNumber": {{ toJson .DeviceID }}}, "sans": {{ toJson .SANs }}}`},
+		},
+	}
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+	ctx := context.Background()
+
+	t.Run("ok sign", func(t *testing.T) {
+		signOpts, err := p.AuthorizeSign(ctx, "token")
+		require.NoError(t, err)
+		csr := parseCertificateRequest(t, "testdata/certs/ecdsa.csr")
+		for _, op := range signOpts {
+			if cof, ok := op.(CertificateOptions); ok {
+				crt, err := x509util.NewCertificate(csr, cof.Options(SignOptions{})...)
+				require.NoError(t, err)
+				assert.Equal(t, "device", crt.GetCertificate().Subject.CommonName)
+				assert.Equal(t, "1234", crt.GetCertificate().Subject.SerialNumber)
+				assert.Equal(t, []string{"device.example.com"}, crt.GetCertificate().DNSNames)
+			}
+		}
+	})
+
+	t.Run("fail sign", func(t *testing.T) {
+		_, err := p.AuthorizeSign(ctx, "")
+		assertStatusCode(t, err, http.StatusUnauthorized)
+		_, err = p.AuthorizeSign(ctx, "forbidden")
+		assertStatusCode(t, err, http.StatusForbidden)
+	})
+
+	t.Run("revoke", func(t *testing.T) {
+		assert.NoError(t, p.AuthorizeRevoke(ctx, "revoke"))
+		assertStatusCode(t, p.AuthorizeRevoke(ctx, "other"), http.StatusUnauthorized)
+	})
+
+	t.Run("fail renew unimplemented", func(t *testing.T) {
+		now := time.Now()
+		err := p.AuthorizeRenew(ctx, &x509.Certificate{NotBefore: now, NotAfter: now.Add(time.Hour)})
+		assertStatusCode(t, err, http.StatusUnauthorized)
+	})
+
+	t.Run("ok ssh sign", func(t *testing.T) {
+		signOpts, err := p.AuthorizeSSHSign(ctx, "token")
+		require.NoError(t, err)
+		for _, op := range signOpts {
+			if v, ok := op.(sshCertOptionsValidator); ok {
+				assert.NoError(t, v.Valid(SignSSHOptions{CertType: "host", KeyID: "device", Principals: []string{"device.example.com"}}))
+				assert.Error(t, v.Valid(SignSSHOptions{CertType: "user", KeyID: "device"}))
+			}
+		}
+	})
+
+	t.Run("fail unavailable", func(t *testing.T) {
+		o := &Plugin{Type: "Plugin", Name: "my-plugin", Address: "unix://" + filepath.Join(t.TempDir(), "missing.sock"), Timeout: &Duration{Duration: time.Second}}
+		require.NoError(t, o.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+		_, err := o.AuthorizeSign(ctx, "token")
+		assertStatusCode(t, err, http.StatusUnauthorized)
+	})
+}
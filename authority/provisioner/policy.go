@@ -1,6 +1,10 @@
 package provisioner
 
-import "github.com/smallstep/certificates/authority/policy"
+import (
+	"github.com/pkg/errors"
+
+	"github.com/smallstep/certificates/authority/policy"
+)
 
 type policyEngine struct {
 	x509Policy    policy.X509Policy
@@ -8,6 +12,73 @@ type policyEngine struct {
 	sshUserPolicy policy.UserPolicy
 }
 
+// applyPolicyOptions returns a copy of the options with the name policies
+// defined in the policy options set in the X.509 and SSH options, so they are
+// evaluated like the policies managed with the admin API. The given options
+// are not modified, they are shared with the configuration and, through the
+// provisioner defaults, with other provisioners.
+//
+// The policy options take precedence over the names inherited from the
+// provisioner defaults, but they cannot be combined with a policy managed by
+// the admin API.
+func applyPolicyOptions(options, defaults *Options) (*Options, error) {
+	pol := options.GetPolicy()
+	if pol == nil {
+		return options, nil
+	}
+
+	// The policy might be inherited from the provisioner defaults.
+	inheritedPolicy := pol == defaults.GetPolicy()
+	source := "options.policy"
+	if inheritedPolicy {
+		source = "provisionerDefaults.options.policy"
+	}
+	namesError := func(typ string, inheritedNames bool) error {
+		if inheritedNames {
+			return errors.Errorf("%s cannot be used with the %s policy in provisionerDefaults.policy", source, typ)
+		}
+		return errors.Errorf("%s cannot be used with the %s policy managed by the admin api", source, typ)
+	}
+
+	o := *options
+	if x := pol.GetX509Options(); x != nil {
+		var x509Options X509Options
+		if o.X509 != nil {
+			x509Options = *o.X509
+		}
+		if x509Options.AllowedNames != nil || x509Options.DeniedNames != nil {
+			d := defaults.GetX509Options()
+			inheritedNames := d != nil && x509Options.AllowedNames == d.AllowedNames && x509Options.DeniedNames == d.DeniedNames
+			if inheritedPolicy || !inheritedNames {
+				return nil, namesError("x509", inheritedNames)
+			}
+		}
+		x509Options.AllowedNames = x.AllowedNames
+		x509Options.DeniedNames = x.DeniedNames
+		x509Options.AllowWildcardNames = x.AllowWildcardNames
+		o.X509 = &x509Options
+	}
+
+	if s := pol.GetSSHOptions(); s != nil {
+		var sshOptions SSHOptions
+		if o.SSH != nil {
+			sshOptions = *o.SSH
+		}
+		if sshOptions.User != nil || sshOptions.Host != nil {
+			d := defaults.GetSSHOptions()
+			inheritedNames := d != nil && sshOptions.User == d.User && sshOptions.Host == d.Host
+			if inheritedPolicy || !inheritedNames {
+				return nil, namesError("ssh", inheritedNames)
+			}
+		}
+		sshOptions.User = s.User
+		sshOptions.Host = s.Host
+		o.SSH = &sshOptions
+	}
+
+	return &o, nil
+}
+
 func newPolicyEngine(options *Options) (*policyEngine, error) {
 	if options == nil {
 		//nolint:nilnil // legacy
@@ -169,6 +169,26 @@ const (
 	TypeSCEP Type = 10
 	// TypeNebula is used to indicate the Nebula provisioners
 	TypeNebula Type = 11
+	// TypeSPIFFE is used to indicate the SPIFFE provisioners
+	TypeSPIFFE Type = 12
+	// TypeK8sBoundSA is used to indicate the Kubernetes bound service account
+	// provisioners.
+	TypeK8sBoundSA Type = 13
+	// TypeTPMAttestation is used to indicate the TPM attestation provisioners.
+	TypeTPMAttestation Type = 14
+	// TypePlugin is used to indicate the provisioners backed by an external
+	// gRPC plugin.
+	TypePlugin Type = 15
+	// TypeOCI is used to indicate the OCI provisioners.
+	TypeOCI Type = 16
+	// TypeAlibaba is used to indicate the Alibaba Cloud provisioners.
+	TypeAlibaba Type = 17
+	// TypeTencent is used to indicate the Tencent Cloud provisioners.
+	TypeTencent Type = 18
+	// TypeGitHubActions is used to indicate the GitHub Actions provisioners.
+	TypeGitHubActions Type = 19
+	// TypeWorkloadIdentity is used to indicate the workload identity federation provisioners.
+	TypeWorkloadIdentity Type = 20
 )
 
 // String returns the string representation of the type.
@@ -196,6 +216,24 @@ func (t Type) String() string {
 		return "SCEP"
 	case TypeNebula:
 		return "Nebula"
+	case TypeSPIFFE:
+		return "SPIFFE"
+	case TypeK8sBoundSA:
+		return "K8sBoundSA"
+	case TypeTPMAttestation:
+		return "TPMAttestation"
+	case TypePlugin:
+		return "Plugin"
+	case TypeOCI:
+		return "OCI"
+	case TypeAlibaba:
+		return "Alibaba"
+	case TypeTencent:
+		return "Tencent"
+	case TypeGitHubActions:
+		return "GitHubActions"
+	case TypeWorkloadIdentity:
+		return "WorkloadIdentity"
 	default:
 		return ""
 	}
@@ -219,6 +257,9 @@ type SCEPKeyManager interface {
 type Config struct {
 	// Claims are the default claims.
 	Claims Claims
+	// DefaultOptions are the options used by the provisioners when they do
+	// not define their own.
+	DefaultOptions *Options
 	// Audiences are the audiences used in the default provisioner, (JWK).
 	Audiences Audiences
 	// SSHKeys are the root SSH public keys
@@ -236,6 +277,12 @@ type Config struct {
 	WebhookClient *http.Client
 	// SCEPKeyManager, if defined, is the interface used by SCEP provisioners.
 	SCEPKeyManager SCEPKeyManager
+	// UseSCEPChallengeFunc is a function that validates and invalidates the
+	// one-time challenges used by SCEP provisioners.
+	UseSCEPChallengeFunc UseSCEPChallengeFunc
+	// WebhookPinStore, if defined, persists the certificates of the webhook
+	// servers pinned on first use.
+	WebhookPinStore WebhookPinStore
 }
 
 type provisioner struct {
@@ -283,6 +330,24 @@ func (l *List) UnmarshalJSON(data []byte) error {
 			p = &SCEP{}
 		case "nebula":
 			p = &Nebula{}
+		case "spiffe":
+			p = &SPIFFE{}
+		case "k8sboundsa":
+			p = &K8sBoundSA{}
+		case "tpmattestation":
+			p = &TPMAttestation{}
+		case "plugin":
+			p = &Plugin{}
+		case "oci":
+			p = &OCI{}
+		case "alibaba":
+			p = &Alibaba{}
+		case "tencent":
+			p = &Tencent{}
+		case "githubactions":
+			p = &GitHubActions{}
+		case "workloadidentity":
+			p = &WorkloadIdentity{}
 		default:
 			// Skip unsupported provisioners. A client using this method may be
 			// compiled with a version of smallstep/certificates that does not
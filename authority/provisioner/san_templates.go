@@ -0,0 +1,62 @@
+package provisioner
+
+import (
+	"bytes"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"go.step.sm/crypto/x509util"
+)
+
+// parseSANTemplates parses the SAN templates of a cloud provisioner, and
+// returns an error if one of them cannot be parsed. The templates are only
+// used if disableCustomSANs is set.
+//
+// The templates are named after their source, so the errors of
+// renderSANTemplates can show the template that failed.
+func parseSANTemplates(sanTemplates []string, disableCustomSANs bool) ([]*template.Template, error) {
+	if len(sanTemplates) == 0 {
+		return nil, nil
+	}
+	if !disableCustomSANs {
+		return nil, errors.New("provisioner sanTemplates require disableCustomSANs")
+	}
+	tmpls := make([]*template.Template, 0, len(sanTemplates))
+	for _, s := range sanTemplates {
+		if strings.TrimSpace(s) == "" {
+			return nil, errors.New("provisioner sanTemplates cannot contain empty templates")
+		}
+		tmpl, err := template.New(s).Funcs(x509util.GetFuncMap()).Option("missingkey=error").Parse(s)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid sanTemplate %q", s)
+		}
+		tmpls = append(tmpls, tmpl)
+	}
+	return tmpls, nil
+}
+
+// renderSANTemplates renders the parsed SAN templates of a cloud provisioner
+// with the given instance metadata. Each template renders one SAN, templates
+// rendering to an empty string are skipped, so they can be conditional.
+func renderSANTemplates(tmpls []*template.Template, data map[string]interface{}) ([]string, error) {
+	sans := make([]string, 0, len(tmpls))
+	for _, tmpl := range tmpls {
+		buf := new(bytes.Buffer)
+		if err := tmpl.Execute(buf, data); err != nil {
+			return nil, errors.Wrapf(err, "error rendering sanTemplate %q", tmpl.Name())
+		}
+		san := strings.TrimSpace(buf.String())
+		switch {
+		case san == "":
+			continue
+		case san == "<no value>" || strings.ContainsAny(san, " \t\r\n"):
+			return nil, errors.Errorf("error rendering sanTemplate %q: invalid value %q", tmpl.Name(), san)
+		}
+		sans = append(sans, san)
+	}
+	if len(sans) == 0 {
+		return nil, errors.New("error rendering sanTemplates: no SANs rendered")
+	}
+	return sans, nil
+}
@@ -0,0 +1,75 @@
+package provisioner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseSANTemplates(t *testing.T) {
+	tests := []struct {
+		name              string
+		sanTemplates      []string
+		disableCustomSANs bool
+		wantErr           string
+	}{
+		{"ok empty", nil, false, ""},
+		{"ok", []string{"{{ .AWS.InstanceID }}.example.com", "{{ .AWS.PrivateIP }}"}, true, ""},
+		{"ok functions", []string{`{{ .GCP.InstanceName | lower }}.example.com`}, true, ""},
+		{"fail custom sans", []string{"{{ .AWS.InstanceID }}.example.com"}, false, "provisioner sanTemplates require disableCustomSANs"},
+		{"fail empty template", []string{" "}, true, "provisioner sanTemplates cannot contain empty templates"},
+		{"fail parse", []string{"{{ .AWS.InstanceID }"}, true, `invalid sanTemplate "{{ .AWS.InstanceID }"`},
+		{"fail env", []string{`{{ env "HOME" }}`}, true, `invalid sanTemplate "{{ env \"HOME\" }}"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSANTemplates(tt.sanTemplates, tt.disableCustomSANs)
+			if tt.wantErr != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), tt.wantErr)
+				}
+				return
+			}
+			assert.NoError(t, err)
+			assert.Len(t, got, len(tt.sanTemplates))
+		})
+	}
+}
+
+func Test_renderSANTemplates(t *testing.T) {
+	data := (&AWS{}).sanTemplateData(awsInstanceIdentityDocument{
+		InstanceID: "i-0123456789",
+		PrivateIP:  "10.0.0.1",
+		Region:     "us-west-1",
+	})
+	tests := []struct {
+		name         string
+		sanTemplates []string
+		want         []string
+		wantErr      string
+	}{
+		{"ok", []string{"{{ .AWS.InstanceID }}.{{ .AWS.Region }}.example.com", " {{ .AWS.PrivateIP }} "}, []string{"i-0123456789.us-west-1.example.com", "10.0.0.1"}, ""},
+		{"ok private dns", []string{"{{ .PrivateDNS }}", "{{ .AWS.InstanceID }}.example.com"}, []string{"ip-10-0-0-1.us-west-1.compute.internal", "i-0123456789.example.com"}, ""},
+		{"ok conditional", []string{`{{ if eq .AWS.Region "us-east-1" }}east.example.com{{ end }}`, "{{ .AWS.PrivateIP }}"}, []string{"10.0.0.1"}, ""},
+		{"fail missing key", []string{"{{ .GCP.InstanceName }}"}, nil, `error rendering sanTemplate "{{ .GCP.InstanceName }}"`},
+		{"fail missing field", []string{"{{ .AWS.Foo }}"}, nil, `error rendering sanTemplate "{{ .AWS.Foo }}"`},
+		{"fail spaces", []string{"{{ .AWS.InstanceID }} {{ .AWS.PrivateIP }}"}, nil, `invalid value "i-0123456789 10.0.0.1"`},
+		{"fail no sans", []string{`{{ if eq .AWS.Region "us-east-1" }}east.example.com{{ end }}`}, nil, "no SANs rendered"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpls, err := parseSANTemplates(tt.sanTemplates, true)
+			require.NoError(t, err)
+			got, err := renderSANTemplates(tmpls, data)
+			if tt.wantErr != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), tt.wantErr)
+				}
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
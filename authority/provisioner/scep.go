@@ -3,20 +3,27 @@ package provisioner
 import (
 	"context"
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
 	"crypto/subtle"
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
 	"net/http"
+	"os"
+	"slices"
 	"time"
 
 	"github.com/pkg/errors"
 
 	"go.step.sm/crypto/kms"
 	kmsapi "go.step.sm/crypto/kms/apiv1"
+	"go.step.sm/crypto/x509util"
 	"go.step.sm/linkedca"
 
+	"github.com/smallstep/certificates/authority/policy"
+	"github.com/smallstep/certificates/errs"
 	"github.com/smallstep/certificates/webhook"
 )
 
@@ -39,15 +46,54 @@ type SCEP struct {
 	// GetCACerts response
 	ExcludeIntermediate bool `json:"excludeIntermediate,omitempty"`
 
+	// ExcludeRA makes the provisioner skip the RA certificate, the decrypter
+	// certificate, in the GetCACerts response. SCEP clients will need to get
+	// the RA certificate by other means.
+	ExcludeRA bool `json:"excludeRA,omitempty"`
+
+	// ChainOrder defines the order of the certificates in the GetCACerts
+	// response. Defaults to "leafFirst", with the RA certificate, if
+	// available, followed by the intermediate and root certificates. Use
+	// "caFirst" to return the certificates in the reverse order.
+	ChainOrder SCEPChainOrder `json:"chainOrder,omitempty"`
+
+	// DynamicChallenge enables the use of one-time challenge passwords created
+	// through the admin API. Each challenge expires after DynamicChallengeTTL,
+	// 1 hour by default, and can only be used once.
+	DynamicChallenge    bool      `json:"dynamicChallenge,omitempty"`
+	DynamicChallengeTTL *Duration `json:"dynamicChallengeTTL,omitempty"`
+
+	// AllowRenewal enables the SCEP RenewalReq flow authenticated by the
+	// certificate that signs the request. The certificate must be issued by the
+	// CA, must not be revoked or expired, and must be valid for at least
+	// RenewalMinRemainingLifetime. A challenge is not required in this flow.
+	AllowRenewal                bool      `json:"allowRenewal,omitempty"`
+	RenewalMinRemainingLifetime *Duration `json:"renewalMinRemainingLifetime,omitempty"`
+
 	// MinimumPublicKeyLength is the minimum length for public keys in CSRs
 	MinimumPublicKeyLength int `json:"minimumPublicKeyLength,omitempty"`
 
+	// CSRPolicy validates the subject, the subject alternative names and the
+	// key type of the certificate requests before they are signed.
+	CSRPolicy *SCEPCSRPolicy `json:"csrPolicy,omitempty"`
+
+	// MaxMessageSize is the maximum size in bytes of the body of a SCEP POST
+	// request. It defaults to 2 MiB.
+	MaxMessageSize int64 `json:"maxMessageSize,omitempty"`
+
 	// TODO(hs): also support a separate signer configuration?
 	DecrypterCertificate []byte `json:"decrypterCertificate,omitempty"`
 	DecrypterKeyPEM      []byte `json:"decrypterKeyPEM,omitempty"`
 	DecrypterKeyURI      string `json:"decrypterKey,omitempty"`
 	DecrypterKeyPassword string `json:"decrypterKeyPassword,omitempty"`
 
+	// DecrypterCertificateFile and DecrypterKeyFile are the paths to the PEM
+	// encoded RSA decrypter certificate and key. They can be used instead of
+	// DecrypterCertificate and DecrypterKeyPEM, so that a dedicated decrypter
+	// is used instead of the intermediate CA key.
+	DecrypterCertificateFile string `json:"decrypterCertificateFile,omitempty"`
+	DecrypterKeyFile         string `json:"decrypterKeyFile,omitempty"`
+
 	// Numerical identifier for the ContentEncryptionAlgorithm as defined in github.com/mozilla-services/pkcs7
 	// at https://github.com/mozilla-services/pkcs7/blob/33d05740a3526e382af6395d3513e73d4e66d1cb/encrypt.go#L63
 	// Defaults to 0, being DES-CBC
@@ -55,9 +101,11 @@ type SCEP struct {
 	Options                       *Options `json:"options,omitempty"`
 	Claims                        *Claims  `json:"claims,omitempty"`
 	ctl                           *Controller
+	csrPolicyEngine               policy.X509Policy
 	encryptionAlgorithm           int
 	challengeValidationController *challengeValidationController
 	notificationController        *notificationController
+	useSCEPChallengeFunc          UseSCEPChallengeFunc
 	keyManager                    SCEPKeyManager
 	decrypter                     crypto.Decrypter
 	decrypterCertificate          *x509.Certificate
@@ -65,6 +113,68 @@ type SCEP struct {
 	signerCertificate             *x509.Certificate
 }
 
+// DefaultSCEPDynamicChallengeTTL is the default time a SCEP one-time challenge
+// is valid.
+const DefaultSCEPDynamicChallengeTTL = time.Hour
+
+// DefaultSCEPMaxMessageSize is the default maximum size in bytes of the body
+// of a SCEP POST request.
+const DefaultSCEPMaxMessageSize = 2 << 20
+
+// UseSCEPChallengeFunc is a function that validates and invalidates a
+// one-time challenge created for the given SCEP provisioner.
+type UseSCEPChallengeFunc func(ctx context.Context, p *SCEP, challenge string) error
+
+// SCEPChainOrder defines the order of the certificates in a SCEP GetCACert
+// response.
+type SCEPChainOrder string
+
+const (
+	// SCEPChainOrderLeafFirst returns the RA or intermediate certificate first,
+	// and the root certificate last.
+	SCEPChainOrderLeafFirst SCEPChainOrder = "leafFirst"
+	// SCEPChainOrderCAFirst returns the root or the top-most intermediate
+	// certificate first, and the RA or issuing intermediate certificate last.
+	SCEPChainOrderCAFirst SCEPChainOrder = "caFirst"
+)
+
+// SCEPCSRPolicy contains the allowed and denied names and the allowed key
+// types of the certificate requests signed by a SCEP provisioner. The names
+// are validated using the X.509 policy engine, and, as in the X.509 policies,
+// the subject common name must be allowed too.
+type SCEPCSRPolicy struct {
+	policy.X509PolicyOptions
+
+	// KeyTypes is the list of allowed key types, "EC", "RSA" or "OKP". All
+	// key types are allowed if empty.
+	KeyTypes []string `json:"keyTypes,omitempty"`
+}
+
+// Validate returns an error if the key types are not supported.
+func (p *SCEPCSRPolicy) Validate() error {
+	if p == nil {
+		return nil
+	}
+	for _, kty := range p.KeyTypes {
+		switch kty {
+		case "EC", "RSA", "OKP":
+		default:
+			return fmt.Errorf("scep csrPolicy key type %q is not supported", kty)
+		}
+	}
+	return nil
+}
+
+// Validate returns an error if the chain order is not a valid one.
+func (o SCEPChainOrder) Validate() error {
+	switch o {
+	case "", SCEPChainOrderLeafFirst, SCEPChainOrderCAFirst:
+		return nil
+	default:
+		return fmt.Errorf("scep chain order %q is not supported", o)
+	}
+}
+
 // GetID returns the provisioner unique identifier.
 func (s *SCEP) GetID() string {
 	if s.ID != "" {
@@ -255,6 +365,32 @@ func (s *SCEP) Init(config Config) (err error) {
 		return errors.New("only encryption algorithm identifiers from 0 to 4 are valid")
 	}
 
+	// Validate the GetCACerts response options
+	if err := s.ChainOrder.Validate(); err != nil {
+		return err
+	}
+	if s.ExcludeRA && s.ExcludeIntermediate {
+		return errors.New("excludeRA and excludeIntermediate cannot be used together")
+	}
+
+	if s.MaxMessageSize < 0 {
+		return errors.New("maxMessageSize cannot be negative")
+	}
+
+	// Validate the renewal options
+	if s.RenewalMinRemainingLifetime != nil && s.RenewalMinRemainingLifetime.Value() < 0 {
+		return errors.New("renewalMinRemainingLifetime cannot be negative")
+	}
+
+	// Validate the dynamic challenge options
+	if s.DynamicChallengeTTL != nil && s.DynamicChallengeTTL.Value() <= 0 {
+		return errors.New("dynamicChallengeTTL must be greater than 0")
+	}
+	if s.DynamicChallenge && config.UseSCEPChallengeFunc == nil {
+		return errors.New("dynamic challenges are not supported by the authority")
+	}
+	s.useSCEPChallengeFunc = config.UseSCEPChallengeFunc
+
 	// Prepare the SCEP challenge validator
 	s.challengeValidationController = newChallengeValidationController(
 		config.WebhookClient,
@@ -267,10 +403,29 @@ func (s *SCEP) Init(config Config) (err error) {
 		s.GetOptions().GetWebhooks(),
 	)
 
+	// read the decrypter key and certificate files if configured
+	decrypterKeyPEM, decrypterCertificate := s.DecrypterKeyPEM, s.DecrypterCertificate
+	if s.DecrypterKeyFile != "" {
+		if len(s.DecrypterKeyPEM) > 0 || s.DecrypterKeyURI != "" {
+			return errors.New("decrypterKeyFile cannot be combined with decrypterKeyPEM or decrypterKey")
+		}
+		if decrypterKeyPEM, err = os.ReadFile(s.DecrypterKeyFile); err != nil {
+			return fmt.Errorf("failed reading decrypter key: %w", err)
+		}
+	}
+	if s.DecrypterCertificateFile != "" {
+		if len(s.DecrypterCertificate) > 0 {
+			return errors.New("decrypterCertificateFile cannot be combined with decrypterCertificate")
+		}
+		if decrypterCertificate, err = os.ReadFile(s.DecrypterCertificateFile); err != nil {
+			return fmt.Errorf("failed reading decrypter certificate: %w", err)
+		}
+	}
+
 	// parse the decrypter key PEM contents if available
-	if len(s.DecrypterKeyPEM) > 0 {
+	if len(decrypterKeyPEM) > 0 {
 		// try reading the PEM for validation
-		block, rest := pem.Decode(s.DecrypterKeyPEM)
+		block, rest := pem.Decode(decrypterKeyPEM)
 		if len(rest) > 0 {
 			return errors.New("failed parsing decrypter key: trailing data")
 		}
@@ -292,14 +447,14 @@ func (s *SCEP) Init(config Config) (err error) {
 		s.keyManager = scepKeyManager
 
 		if s.decrypter, err = s.keyManager.CreateDecrypter(&kmsapi.CreateDecrypterRequest{
-			DecryptionKeyPEM: s.DecrypterKeyPEM,
+			DecryptionKeyPEM: decrypterKeyPEM,
 			Password:         []byte(s.DecrypterKeyPassword),
 			PasswordPrompter: kmsapi.NonInteractivePasswordPrompter,
 		}); err != nil {
 			return fmt.Errorf("failed creating decrypter: %w", err)
 		}
 		if s.signer, err = s.keyManager.CreateSigner(&kmsapi.CreateSignerRequest{
-			SigningKeyPEM:    s.DecrypterKeyPEM, // TODO(hs): support distinct signer key in the future?
+			SigningKeyPEM:    decrypterKeyPEM, // TODO(hs): support distinct signer key in the future?
 			Password:         []byte(s.DecrypterKeyPassword),
 			PasswordPrompter: kmsapi.NonInteractivePasswordPrompter,
 		}); err != nil {
@@ -353,8 +508,8 @@ func (s *SCEP) Init(config Config) (err error) {
 	}
 
 	// parse the decrypter certificate contents if available
-	if len(s.DecrypterCertificate) > 0 {
-		block, rest := pem.Decode(s.DecrypterCertificate)
+	if len(decrypterCertificate) > 0 {
+		block, rest := pem.Decode(decrypterCertificate)
 		if len(rest) > 0 {
 			return errors.New("failed parsing decrypter certificate: trailing data")
 		}
@@ -387,6 +542,16 @@ func (s *SCEP) Init(config Config) (err error) {
 
 	// TODO: add other, SCEP specific, options?
 
+	if err := s.CSRPolicy.Validate(); err != nil {
+		return err
+	}
+	if s.CSRPolicy != nil {
+		if s.csrPolicyEngine, err = policy.NewX509PolicyEngine(s.CSRPolicy); err != nil {
+			return fmt.Errorf("failed creating scep csrPolicy: %w", err)
+		}
+	}
+
+	s.Options = mergeOptions(s.Options, config.DefaultOptions, s.GetType())
 	s.ctl, err = NewController(s, s.Claims, config, s.Options)
 	return
 }
@@ -394,21 +559,142 @@ func (s *SCEP) Init(config Config) (err error) {
 // AuthorizeSign does not do any verification, because all verification is handled
 // in the SCEP protocol. This method returns a list of modifiers / constraints
 // on the resulting certificate.
-func (s *SCEP) AuthorizeSign(context.Context, string) ([]SignOption, error) {
+func (s *SCEP) AuthorizeSign(ctx context.Context, _ string) ([]SignOption, error) {
+	// Certificate templates
+	data := x509util.NewTemplateData()
+	if req, ok := SCEPRequestFromContext(ctx); ok && req.CSR != nil {
+		data = createSCEPTemplateData(req.CSR)
+		data.Set(SCEPTemplateDataKey, SCEPTemplateData{
+			TransactionID:   req.TransactionID,
+			ChallengeMethod: string(s.selectValidationMethod()),
+		})
+	}
+
+	templateOptions, err := TemplateOptions(s.Options, data)
+	if err != nil {
+		return nil, fmt.Errorf("error creating template options from SCEP provisioner: %w", err)
+	}
+
 	return []SignOption{
 		s,
+		templateOptions,
 		// modifiers / withOptions
 		newProvisionerExtensionOption(TypeSCEP, s.Name, "").WithControllerOptions(s.ctl),
 		newForceCNOption(s.ForceCN),
 		profileDefaultDuration(s.ctl.Claimer.DefaultTLSCertDuration()),
 		// validators
 		newPublicKeyMinimumLengthValidator(s.MinimumPublicKeyLength),
+		newSCEPCSRPolicyValidator(s.CSRPolicy, s.csrPolicyEngine),
 		newValidityValidator(s.ctl.Claimer.MinTLSCertDuration(), s.ctl.Claimer.MaxTLSCertDuration()),
 		newX509NamePolicyValidator(s.ctl.getPolicy().getX509()),
-		s.ctl.newWebhookController(nil, linkedca.Webhook_X509),
+		s.ctl.newWebhookController(data, linkedca.Webhook_X509),
 	}, nil
 }
 
+// scepCSRPolicyValidator validates the names and the key type of a SCEP
+// certificate request.
+type scepCSRPolicyValidator struct {
+	keyTypes     []string
+	policyEngine policy.X509Policy
+}
+
+func newSCEPCSRPolicyValidator(p *SCEPCSRPolicy, engine policy.X509Policy) *scepCSRPolicyValidator {
+	v := &scepCSRPolicyValidator{policyEngine: engine}
+	if p != nil {
+		v.keyTypes = p.KeyTypes
+	}
+	return v
+}
+
+// Valid validates that the certificate request key type and names are allowed.
+func (v *scepCSRPolicyValidator) Valid(req *x509.CertificateRequest) error {
+	if len(v.keyTypes) > 0 {
+		var kty string
+		switch req.PublicKey.(type) {
+		case *ecdsa.PublicKey:
+			kty = "EC"
+		case *rsa.PublicKey:
+			kty = "RSA"
+		case ed25519.PublicKey:
+			kty = "OKP"
+		}
+		if !slices.Contains(v.keyTypes, kty) {
+			return errs.Forbidden("certificate request key of type '%T' is not allowed", req.PublicKey)
+		}
+	}
+	if v.policyEngine != nil {
+		return v.policyEngine.IsX509CertificateRequestAllowed(req)
+	}
+	return nil
+}
+
+// SCEPTemplateDataKey is the key used in the certificate templates to access
+// the SCEP enrollment data, e.g. {{ .SCEP.TransactionID }}.
+const SCEPTemplateDataKey = "SCEP"
+
+// SCEPTemplateData is the SCEP enrollment data available in the certificate
+// templates and webhooks.
+type SCEPTemplateData struct {
+	// TransactionID is the transaction id of the SCEP request.
+	TransactionID string `json:"transactionID"`
+	// ChallengeMethod is the method used to validate the challenge password:
+	// none, static, webhook or dynamic.
+	ChallengeMethod string `json:"challengeMethod"`
+}
+
+// SCEPRequest contains the information of a SCEP enrollment used to create
+// the template data in AuthorizeSign.
+type SCEPRequest struct {
+	CSR           *x509.CertificateRequest
+	TransactionID string
+}
+
+type scepRequestKey struct{}
+
+// NewContextWithSCEPRequest creates a new context from ctx and attaches the
+// SCEP request to it.
+func NewContextWithSCEPRequest(ctx context.Context, req *SCEPRequest) context.Context {
+	return context.WithValue(ctx, scepRequestKey{}, req)
+}
+
+// SCEPRequestFromContext returns the SCEP request saved in ctx.
+func SCEPRequestFromContext(ctx context.Context) (*SCEPRequest, bool) {
+	req, ok := ctx.Value(scepRequestKey{}).(*SCEPRequest)
+	return req, ok && req != nil
+}
+
+// createSCEPTemplateData returns the template data with the subject and the
+// SANs in the CSR. The common name is used as the only SAN if the CSR does
+// not have any.
+func createSCEPTemplateData(csr *x509.CertificateRequest) x509util.TemplateData {
+	sans := []string{}
+	sans = append(sans, csr.DNSNames...)
+	sans = append(sans, csr.EmailAddresses...)
+	for _, v := range csr.IPAddresses {
+		sans = append(sans, v.String())
+	}
+	for _, v := range csr.URIs {
+		sans = append(sans, v.String())
+	}
+	if len(sans) == 0 {
+		sans = append(sans, csr.Subject.CommonName)
+	}
+	data := x509util.CreateTemplateData(csr.Subject.CommonName, sans)
+	data.SetCertificateRequest(csr)
+	data.SetSubject(x509util.Subject{
+		Country:            csr.Subject.Country,
+		Organization:       csr.Subject.Organization,
+		OrganizationalUnit: csr.Subject.OrganizationalUnit,
+		Locality:           csr.Subject.Locality,
+		Province:           csr.Subject.Province,
+		StreetAddress:      csr.Subject.StreetAddress,
+		PostalCode:         csr.Subject.PostalCode,
+		SerialNumber:       csr.Subject.SerialNumber,
+		CommonName:         csr.Subject.CommonName,
+	})
+	return data
+}
+
 // GetCapabilities returns the CA capabilities
 func (s *SCEP) GetCapabilities() []string {
 	return s.Capabilities
@@ -431,6 +717,68 @@ func (s *SCEP) ShouldIncludeIntermediateInChain() bool {
 	return !s.ExcludeIntermediate
 }
 
+// ShouldIncludeRAInChain indicates if the CA should include the
+// RA certificate, the provisioner specific decrypter certificate,
+// in the GetCACerts response. This is true by default.
+func (s *SCEP) ShouldIncludeRAInChain() bool {
+	return !s.ExcludeRA
+}
+
+// GetChainOrder returns the order of the certificates in the
+// GetCACerts response. It defaults to SCEPChainOrderLeafFirst.
+func (s *SCEP) GetChainOrder() SCEPChainOrder {
+	if s.ChainOrder == "" {
+		return SCEPChainOrderLeafFirst
+	}
+	return s.ChainOrder
+}
+
+// ShouldAllowRenewal indicates if the provisioner accepts SCEP
+// RenewalReq messages authenticated by an existing certificate.
+func (s *SCEP) ShouldAllowRenewal() bool {
+	return s.AllowRenewal
+}
+
+// AuthorizeRenewal returns nil if the given certificate, already
+// verified to be issued by the CA, can be used to authenticate a
+// RenewalReq. The certificate must have been issued by this provisioner,
+// and it must be still valid for at least the configured minimum remaining
+// lifetime.
+func (s *SCEP) AuthorizeRenewal(ctx context.Context, cert *x509.Certificate) error {
+	if !s.AllowRenewal {
+		return errors.Errorf("renewal is not enabled for provisioner %q", s.Name)
+	}
+	if ext, ok := GetProvisionerExtension(cert); !ok || ext.Type != TypeSCEP || ext.Name != s.Name {
+		return errors.Errorf("certificate was not issued by provisioner %q", s.Name)
+	}
+	now := time.Now()
+	if now.After(cert.NotAfter) {
+		return errors.Errorf("certificate expired on %s", cert.NotAfter.Format(time.RFC3339))
+	}
+	if d := s.RenewalMinRemainingLifetime.Value(); d > 0 && cert.NotAfter.Sub(now) < d {
+		return errors.Errorf("certificate remaining lifetime is less than %s", d)
+	}
+	return s.ctl.AuthorizeRenew(ctx, cert)
+}
+
+// GetMaxMessageSize returns the maximum size in bytes of the body of a
+// SCEP POST request. It defaults to 2 MiB.
+func (s *SCEP) GetMaxMessageSize() int64 {
+	if s.MaxMessageSize > 0 {
+		return s.MaxMessageSize
+	}
+	return DefaultSCEPMaxMessageSize
+}
+
+// GetDynamicChallengeTTL returns the time a one-time challenge created
+// for the provisioner is valid. It defaults to 1 hour.
+func (s *SCEP) GetDynamicChallengeTTL() time.Duration {
+	if d := s.DynamicChallengeTTL.Value(); d > 0 {
+		return d
+	}
+	return DefaultSCEPDynamicChallengeTTL
+}
+
 // GetContentEncryptionAlgorithm returns the numeric identifier
 // for the pkcs7 package encryption algorithm to use.
 func (s *SCEP) GetContentEncryptionAlgorithm() int {
@@ -447,6 +795,11 @@ func (s *SCEP) ValidateChallenge(ctx context.Context, csr *x509.CertificateReque
 	switch s.selectValidationMethod() {
 	case validationMethodWebhook:
 		return s.challengeValidationController.Validate(ctx, csr, s.Name, challenge, transactionID)
+	case validationMethodDynamic:
+		if err := s.useSCEPChallengeFunc(ctx, s, challenge); err != nil {
+			return fmt.Errorf("invalid challenge password provided: %w", err)
+		}
+		return nil
 	default:
 		if subtle.ConstantTimeCompare([]byte(s.ChallengePassword), []byte(challenge)) == 0 {
 			return errors.New("invalid challenge password provided")
@@ -475,16 +828,22 @@ const (
 	validationMethodNone    validationMethod = "none"
 	validationMethodStatic  validationMethod = "static"
 	validationMethodWebhook validationMethod = "webhook"
+	validationMethodDynamic validationMethod = "dynamic"
 )
 
 // selectValidationMethod returns the method to validate SCEP
 // challenges. If a webhook is configured with kind `SCEPCHALLENGE`,
-// the webhook method will be used. If a challenge password is set,
-// the static method is used. It will default to the `none` method.
+// the webhook method will be used. If dynamic challenges are enabled,
+// the one-time challenges created through the admin API are used. If
+// a challenge password is set, the static method is used. It will
+// default to the `none` method.
 func (s *SCEP) selectValidationMethod() validationMethod {
 	if len(s.challengeValidationController.webhooks) > 0 {
 		return validationMethodWebhook
 	}
+	if s.DynamicChallenge {
+		return validationMethodDynamic
+	}
 	if s.ChallengePassword != "" {
 		return validationMethodStatic
 	}
@@ -3,6 +3,8 @@ package provisioner
 import (
 	"context"
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
@@ -15,13 +17,17 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/smallstep/certificates/authority/policy"
+	"github.com/smallstep/certificates/errs"
 	"github.com/smallstep/certificates/webhook"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.step.sm/crypto/kms/softkms"
 	"go.step.sm/crypto/minica"
 	"go.step.sm/crypto/pemutil"
+	"go.step.sm/crypto/x509util"
 	"go.step.sm/linkedca"
 )
 
@@ -219,6 +225,12 @@ func Test_selectValidationMethod(t *testing.T) {
 			},
 			ChallengePassword: "pass",
 		}, "static"},
+		{"dynamic", &SCEP{
+			Name:              "SCEP",
+			Type:              "SCEP",
+			ChallengePassword: "pass",
+			DynamicChallenge:  true,
+		}, "dynamic"},
 		{"none", &SCEP{
 			Name: "SCEP",
 			Type: "SCEP",
@@ -237,7 +249,9 @@ func Test_selectValidationMethod(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := tt.p.Init(Config{Claims: globalProvisionerClaims})
+			err := tt.p.Init(Config{Claims: globalProvisionerClaims, UseSCEPChallengeFunc: func(context.Context, *SCEP, string) error {
+				return nil
+			}})
 			require.NoError(t, err)
 			got := tt.p.selectValidationMethod()
 			assert.Equal(t, tt.want, got)
@@ -245,6 +259,47 @@ func Test_selectValidationMethod(t *testing.T) {
 	}
 }
 
+func Test_challengeValidationController_Validate_csrAttributes(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:        pkix.Name{CommonName: "device-1234", Organization: []string{"Smallstep"}},
+		DNSNames:       []string{"device-1234.example.com"},
+		EmailAddresses: []string{"device@example.com"},
+	}, key)
+	require.NoError(t, err)
+	csr, err := x509.ParseCertificateRequest(der)
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req webhook.RequestBody
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "mdm", req.ProvisionerName)
+		assert.Equal(t, "device-challenge", req.SCEPChallenge)
+		assert.Equal(t, "transaction-1", req.SCEPTransactionID)
+		if assert.NotNil(t, req.X509CertificateRequest) {
+			assert.Equal(t, der, req.X509CertificateRequest.Raw)
+			assert.Equal(t, "device-1234", req.X509CertificateRequest.Subject.CommonName)
+			assert.EqualValues(t, []string{"Smallstep"}, req.X509CertificateRequest.Subject.Organization)
+			assert.EqualValues(t, []string{"device-1234.example.com"}, req.X509CertificateRequest.DNSNames)
+			assert.EqualValues(t, []string{"device@example.com"}, req.X509CertificateRequest.EmailAddresses)
+			assert.Equal(t, "RSA", req.X509CertificateRequest.PublicKeyAlgorithm)
+		}
+		w.Write([]byte(`{"allow":true}`))
+	}))
+	defer srv.Close()
+
+	c := newChallengeValidationController(http.DefaultClient, []*Webhook{{
+		ID:       "webhook-id-1",
+		Name:     "mdm-webhook",
+		Secret:   "MTIzNAo=",
+		Kind:     linkedca.Webhook_SCEPCHALLENGE.String(),
+		CertType: linkedca.Webhook_X509.String(),
+		URL:      srv.URL,
+	}})
+	assert.NoError(t, c.Validate(context.Background(), csr, "mdm", "device-challenge", "transaction-1"))
+}
+
 func TestSCEP_ValidateChallenge(t *testing.T) {
 	dummyCSR := &x509.CertificateRequest{
 		Raw: []byte{1},
@@ -423,6 +478,8 @@ func TestSCEP_Init(t *testing.T) {
 
 	require.NoError(t, os.WriteFile(path, keyPEM, 0600))
 	require.NoError(t, os.WriteFile(pathNoPassword, keyPEMNoPassword, 0600))
+	certPath := filepath.Join(tmp, "rsa.crt")
+	require.NoError(t, os.WriteFile(certPath, certPEM, 0600))
 
 	type args struct {
 		config Config
@@ -493,6 +550,38 @@ func TestSCEP_Init(t *testing.T) {
 			DecrypterKeyPassword:          "",
 			EncryptionAlgorithmIdentifier: 0,
 		}, args{Config{Claims: globalProvisionerClaims}}, false},
+		{"ok with files", &SCEP{
+			Type:                     "SCEP",
+			Name:                     "scep",
+			ChallengePassword:        "password123",
+			DecrypterCertificateFile: certPath,
+			DecrypterKeyFile:         path,
+			DecrypterKeyPassword:     "password",
+		}, args{Config{Claims: globalProvisionerClaims}}, false},
+		{"ok with key file", &SCEP{
+			Type:                 "SCEP",
+			Name:                 "scep",
+			ChallengePassword:    "password123",
+			DecrypterCertificate: certPEM,
+			DecrypterKeyFile:     pathNoPassword,
+		}, args{Config{Claims: globalProvisionerClaims}}, false},
+		{"ok dynamic challenge", &SCEP{
+			Type:             "SCEP",
+			Name:             "scep",
+			DynamicChallenge: true,
+		}, args{Config{Claims: globalProvisionerClaims, UseSCEPChallengeFunc: func(context.Context, *SCEP, string) error {
+			return nil
+		}}}, false},
+		{"ok chain order", &SCEP{
+			Type:                 "SCEP",
+			Name:                 "scep",
+			ChallengePassword:    "password123",
+			DecrypterCertificate: certPEM,
+			DecrypterKeyPEM:      keyPEM,
+			DecrypterKeyPassword: "password",
+			ExcludeRA:            true,
+			ChainOrder:           SCEPChainOrderCAFirst,
+		}, args{Config{Claims: globalProvisionerClaims}}, false},
 		{"fail type", &SCEP{
 			Type:                          "",
 			Name:                          "scep",
@@ -543,6 +632,82 @@ func TestSCEP_Init(t *testing.T) {
 			DecrypterKeyPassword:          "password",
 			EncryptionAlgorithmIdentifier: -1,
 		}, args{Config{Claims: globalProvisionerClaims}}, true},
+		{"fail chain order", &SCEP{
+			Type:                 "SCEP",
+			Name:                 "scep",
+			ChallengePassword:    "password123",
+			DecrypterCertificate: certPEM,
+			DecrypterKeyPEM:      keyPEM,
+			DecrypterKeyPassword: "password",
+			ChainOrder:           "foo",
+		}, args{Config{Claims: globalProvisionerClaims}}, true},
+		{"fail excludeRA and excludeIntermediate", &SCEP{
+			Type:                 "SCEP",
+			Name:                 "scep",
+			ChallengePassword:    "password123",
+			DecrypterCertificate: certPEM,
+			DecrypterKeyPEM:      keyPEM,
+			DecrypterKeyPassword: "password",
+			ExcludeRA:            true,
+			ExcludeIntermediate:  true,
+		}, args{Config{Claims: globalProvisionerClaims}}, true},
+		{"fail dynamic challenge", &SCEP{
+			Type:             "SCEP",
+			Name:             "scep",
+			DynamicChallenge: true,
+		}, args{Config{Claims: globalProvisionerClaims}}, true},
+		{"fail dynamic challenge ttl", &SCEP{
+			Type:                "SCEP",
+			Name:                "scep",
+			DynamicChallenge:    true,
+			DynamicChallengeTTL: &Duration{Duration: -time.Minute},
+		}, args{Config{Claims: globalProvisionerClaims, UseSCEPChallengeFunc: func(context.Context, *SCEP, string) error {
+			return nil
+		}}}, true},
+		{"fail renewal min remaining lifetime", &SCEP{
+			Type:                        "SCEP",
+			Name:                        "scep",
+			AllowRenewal:                true,
+			RenewalMinRemainingLifetime: &Duration{Duration: -time.Minute},
+		}, args{Config{Claims: globalProvisionerClaims}}, true},
+		{"fail maxMessageSize", &SCEP{
+			Type:           "SCEP",
+			Name:           "scep",
+			MaxMessageSize: -1,
+		}, args{Config{Claims: globalProvisionerClaims}}, true},
+		{"fail key file with key", &SCEP{
+			Type:                     "SCEP",
+			Name:                     "scep",
+			ChallengePassword:        "password123",
+			DecrypterCertificateFile: certPath,
+			DecrypterKeyFile:         path,
+			DecrypterKeyURI:          "softkms:path=" + path,
+			DecrypterKeyPassword:     "password",
+		}, args{Config{Claims: globalProvisionerClaims}}, true},
+		{"fail certificate file with certificate", &SCEP{
+			Type:                     "SCEP",
+			Name:                     "scep",
+			ChallengePassword:        "password123",
+			DecrypterCertificate:     certPEM,
+			DecrypterCertificateFile: certPath,
+			DecrypterKeyFile:         path,
+			DecrypterKeyPassword:     "password",
+		}, args{Config{Claims: globalProvisionerClaims}}, true},
+		{"fail missing key file", &SCEP{
+			Type:                     "SCEP",
+			Name:                     "scep",
+			ChallengePassword:        "password123",
+			DecrypterCertificateFile: certPath,
+			DecrypterKeyFile:         filepath.Join(tmp, "missing.key"),
+		}, args{Config{Claims: globalProvisionerClaims}}, true},
+		{"fail missing certificate file", &SCEP{
+			Type:                     "SCEP",
+			Name:                     "scep",
+			ChallengePassword:        "password123",
+			DecrypterCertificateFile: filepath.Join(tmp, "missing.crt"),
+			DecrypterKeyFile:         path,
+			DecrypterKeyPassword:     "password",
+		}, args{Config{Claims: globalProvisionerClaims}}, true},
 		{"fail key decode", &SCEP{
 			Type:                          "SCEP",
 			Name:                          "scep",
@@ -641,3 +806,163 @@ func TestSCEP_Init(t *testing.T) {
 		})
 	}
 }
+
+func TestSCEP_AuthorizeSign(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "device", Organization: []string{"Smallstep"}},
+		DNSNames: []string{"device.example.com"},
+	}, key)
+	require.NoError(t, err)
+	csr, err := x509.ParseCertificateRequest(der)
+	require.NoError(t, err)
+
+	p := &SCEP{
+		Type:              "SCEP",
+		Name:              "scep",
+		ChallengePassword: "password123",
+		Options: &Options{
+			X509: &X509Options{
+				Template: `{
+	"subject": {
+		"commonName": {{ toJson .Subject.CommonName }},
+		"organization": {{ toJson .Subject.Organization }},
+		"organizationalUnit": [{{ toJson .SCEP.TransactionID }}, {{ toJson .SCEP.ChallengeMethod }}]
+	},
+	"sans": {{ toJson .SANs }}
+}`,
+			},
+		},
+	}
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims}))
+
+	newCertificate := func(t *testing.T, signOps []SignOption) *x509.Certificate {
+		t.Helper()
+		for _, op := range signOps {
+			if cof, ok := op.(CertificateOptions); ok {
+				crt, err := x509util.NewCertificate(csr, cof.Options(SignOptions{})...)
+				require.NoError(t, err)
+				return crt.GetCertificate()
+			}
+		}
+		t.Fatal("certificate options not found")
+		return nil
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		ctx := NewContextWithSCEPRequest(context.Background(), &SCEPRequest{
+			CSR:           csr,
+			TransactionID: "the-transaction-id",
+		})
+		signOps, err := p.AuthorizeSign(ctx, "")
+		require.NoError(t, err)
+
+		cert := newCertificate(t, signOps)
+		assert.Equal(t, "device", cert.Subject.CommonName)
+		assert.Equal(t, []string{"Smallstep"}, cert.Subject.Organization)
+		assert.Equal(t, []string{"the-transaction-id", "static"}, cert.Subject.OrganizationalUnit)
+		assert.Equal(t, []string{"device.example.com"}, cert.DNSNames)
+
+		for _, op := range signOps {
+			if wc, ok := op.(*WebhookController); ok {
+				assert.Equal(t, SCEPTemplateData{
+					TransactionID:   "the-transaction-id",
+					ChallengeMethod: "static",
+				}, wc.TemplateData.(x509util.TemplateData)[SCEPTemplateDataKey])
+			}
+		}
+	})
+
+	t.Run("ok without request", func(t *testing.T) {
+		signOps, err := p.AuthorizeSign(context.Background(), "")
+		require.NoError(t, err)
+		assert.NotEmpty(t, signOps)
+	})
+
+	t.Run("fail template", func(t *testing.T) {
+		bad := &SCEP{
+			Type: "SCEP",
+			Name: "bad",
+			Options: &Options{
+				X509: &X509Options{TemplateData: []byte(`{"foo":`)},
+			},
+		}
+		require.NoError(t, bad.Init(Config{Claims: globalProvisionerClaims}))
+		_, err := bad.AuthorizeSign(context.Background(), "")
+		assert.Error(t, err)
+	})
+}
+
+func TestSCEP_AuthorizeSign_csrPolicy(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	newCSR := func(t *testing.T, key crypto.Signer, cn string, dnsNames ...string) *x509.CertificateRequest {
+		t.Helper()
+		der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+			Subject:  pkix.Name{CommonName: cn},
+			DNSNames: dnsNames,
+		}, key)
+		require.NoError(t, err)
+		csr, err := x509.ParseCertificateRequest(der)
+		require.NoError(t, err)
+		return csr
+	}
+
+	p := &SCEP{
+		Type:              "SCEP",
+		Name:              "scep",
+		ChallengePassword: "password123",
+		CSRPolicy: &SCEPCSRPolicy{
+			X509PolicyOptions: policy.X509PolicyOptions{
+				AllowedNames: &policy.X509NameOptions{DNSDomains: []string{"*.example.com"}},
+				DeniedNames:  &policy.X509NameOptions{DNSDomains: []string{"admin.example.com"}},
+			},
+			KeyTypes: []string{"RSA"},
+		},
+	}
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims}))
+
+	validate := func(t *testing.T, csr *x509.CertificateRequest) error {
+		t.Helper()
+		signOps, err := p.AuthorizeSign(context.Background(), "")
+		require.NoError(t, err)
+		for _, op := range signOps {
+			if v, ok := op.(*scepCSRPolicyValidator); ok {
+				return v.Valid(csr)
+			}
+		}
+		t.Fatal("csr policy validator not found")
+		return nil
+	}
+
+	assertForbidden := func(t *testing.T, err error) {
+		t.Helper()
+		var ee *errs.Error
+		require.ErrorAs(t, err, &ee)
+		assert.Equal(t, http.StatusForbidden, ee.StatusCode())
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		assert.NoError(t, validate(t, newCSR(t, rsaKey, "device.example.com", "device.example.com")))
+	})
+	t.Run("fail key type", func(t *testing.T) {
+		assertStatusCode(t, validate(t, newCSR(t, ecKey, "device.example.com", "device.example.com")), http.StatusForbidden)
+	})
+	t.Run("fail subject", func(t *testing.T) {
+		assertForbidden(t, validate(t, newCSR(t, rsaKey, "device", "device.example.com")))
+	})
+	t.Run("fail sans", func(t *testing.T) {
+		assertForbidden(t, validate(t, newCSR(t, rsaKey, "device.example.com", "device.example.com", "device.example.org")))
+		assertForbidden(t, validate(t, newCSR(t, rsaKey, "admin.example.com", "admin.example.com")))
+	})
+	t.Run("ok without policy", func(t *testing.T) {
+		assert.NoError(t, newSCEPCSRPolicyValidator(nil, nil).Valid(newCSR(t, ecKey, "device")))
+	})
+	t.Run("fail init", func(t *testing.T) {
+		bad := &SCEP{Type: "SCEP", Name: "bad", CSRPolicy: &SCEPCSRPolicy{KeyTypes: []string{"DSA"}}}
+		assert.Error(t, bad.Init(Config{Claims: globalProvisionerClaims}))
+	})
+}
@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"net/url"
 	"reflect"
+	"slices"
 	"time"
 
 	"go.step.sm/crypto/keyutil"
@@ -30,6 +31,10 @@ type SignOptions struct {
 	NotBefore    TimeDuration    `json:"notBefore"`
 	TemplateData json.RawMessage `json:"templateData"`
 	Backdate     time.Duration   `json:"-"`
+
+	// Precertificate indicates that the certificate to sign is an RFC 6962
+	// pre-certificate, and it will include the critical poison extension.
+	Precertificate bool `json:"precertificate,omitempty"`
 }
 
 // SignOption is the interface used to collect all extra options used in the
@@ -164,6 +169,71 @@ func (v commonNameSliceValidator) Valid(req *x509.CertificateRequest) error {
 	return errs.Forbidden("certificate request does not contain the valid common name - got %s, want %s", req.Subject.CommonName, v)
 }
 
+// commonNamePromoteModifier adds the common name of a certificate to its SANs
+// if it's not already present. An unauthorized common name is rejected.
+type commonNamePromoteModifier []string
+
+func (v commonNamePromoteModifier) Modify(cert *x509.Certificate, _ SignOptions) error {
+	cn := cert.Subject.CommonName
+	if cn == "" {
+		return nil
+	}
+	if !slices.Contains(v, cn) {
+		return errs.Forbidden("certificate common name %s is not in the authorized names %v", cn, []string(v))
+	}
+
+	dnsNames, ips, emails, uris := x509util.SplitSANs([]string{cn})
+	switch {
+	case len(dnsNames) == 1:
+		if !slices.Contains(cert.DNSNames, cn) {
+			cert.DNSNames = append(cert.DNSNames, dnsNames...)
+		}
+	case len(ips) == 1:
+		for _, ip := range cert.IPAddresses {
+			if ip.Equal(ips[0]) {
+				return nil
+			}
+		}
+		cert.IPAddresses = append(cert.IPAddresses, ips...)
+	case len(emails) == 1:
+		if !slices.Contains(cert.EmailAddresses, cn) {
+			cert.EmailAddresses = append(cert.EmailAddresses, emails...)
+		}
+	case len(uris) == 1:
+		for _, u := range cert.URIs {
+			if u.String() == uris[0].String() {
+				return nil
+			}
+		}
+		cert.URIs = append(cert.URIs, uris...)
+	}
+	return nil
+}
+
+// commonNameDropModifier removes the common name of a certificate if it's not
+// in the list of authorized names.
+type commonNameDropModifier []string
+
+func (v commonNameDropModifier) Modify(cert *x509.Certificate, _ SignOptions) error {
+	if cn := cert.Subject.CommonName; cn != "" && !slices.Contains(v, cn) {
+		cert.Subject.CommonName = ""
+	}
+	return nil
+}
+
+// newCommonNameOptions returns the sign options that enforce the given
+// CommonNameMode with the list of authorized names.
+func newCommonNameOptions(mode CommonNameMode, names []string) []SignOption {
+	switch mode {
+	case CommonNamePromote:
+		return []SignOption{commonNameSliceValidator(names), commonNamePromoteModifier(names)}
+	case CommonNameDrop:
+		return []SignOption{commonNameDropModifier(names)}
+	default:
+		return []SignOption{commonNameSliceValidator(names)}
+	}
+}
+
 // dnsNamesValidator validates the DNS names SAN of a certificate request.
 type dnsNamesValidator []string
 
@@ -373,6 +443,11 @@ func newValidityValidator(min, max time.Duration) *validityValidator {
 	return &validityValidator{min: min, max: max}
 }
 
+// MinDuration returns the minimum duration of the certificates.
+func (v *validityValidator) MinDuration() time.Duration {
+	return v.min
+}
+
 // Valid validates the certificate validity settings (notBefore/notAfter) and
 // total duration.
 func (v *validityValidator) Valid(cert *x509.Certificate, o SignOptions) error {
@@ -492,3 +567,46 @@ func (o *provisionerExtensionOption) Modify(cert *x509.Certificate, _ SignOption
 	cert.ExtraExtensions = append(cert.ExtraExtensions, ext)
 	return nil
 }
+
+// SignOptionsSummary contains the information authorized by a list of sign
+// options, without signing any certificate.
+type SignOptionsSummary struct {
+	Subject         string
+	SANs            []string
+	MinDuration     time.Duration
+	MaxDuration     time.Duration
+	DefaultDuration time.Duration
+	NotBefore       time.Time
+	NotAfter        time.Time
+}
+
+// SummarizeSignOptions returns a summary of the subject, SANs and validity
+// constraints defined by the given sign options.
+func SummarizeSignOptions(opts []SignOption) *SignOptionsSummary {
+	s := new(SignOptionsSummary)
+	for _, op := range opts {
+		switch v := op.(type) {
+		case profileDefaultDuration:
+			s.DefaultDuration = time.Duration(v)
+		case profileLimitDuration:
+			s.DefaultDuration = v.def
+			s.NotBefore, s.NotAfter = v.notBefore, v.notAfter
+		case *validityValidator:
+			s.MinDuration, s.MaxDuration = v.min, v.max
+		case *WebhookController:
+			data, ok := v.TemplateData.(x509util.TemplateData)
+			if !ok {
+				continue
+			}
+			if sub, ok := data[x509util.SubjectKey].(x509util.Subject); ok {
+				s.Subject = sub.CommonName
+			}
+			if sans, ok := data[x509util.SANsKey].([]x509util.SubjectAlternativeName); ok {
+				for _, san := range sans {
+					s.SANs = append(s.SANs, san.Value)
+				}
+			}
+		}
+	}
+	return s
+}
@@ -130,6 +130,81 @@ func Test_commonNameSliceValidator_Valid(t *testing.T) {
 	}
 }
 
+func Test_newCommonNameOptions(t *testing.T) {
+	names := []string{"foo.bar.zar", "127.0.0.1", "foo@bar.zar"}
+	apply := func(opts []SignOption, req *x509.CertificateRequest, cert *x509.Certificate) error {
+		for _, o := range opts {
+			switch v := o.(type) {
+			case CertificateRequestValidator:
+				if err := v.Valid(req); err != nil {
+					return err
+				}
+			case CertificateModifier:
+				if err := v.Modify(cert, SignOptions{}); err != nil {
+					return err
+				}
+			default:
+				return fmt.Errorf("unexpected sign option of type %T", v)
+			}
+		}
+		return nil
+	}
+
+	tests := []struct {
+		name    string
+		mode    CommonNameMode
+		cn      string
+		want    *x509.Certificate
+		wantErr bool
+	}{
+		{"reject unauthorized", CommonNameReject, "example.com", nil, true},
+		{"promote unauthorized", CommonNamePromote, "example.com", nil, true},
+		{"drop unauthorized", CommonNameDrop, "example.com", &x509.Certificate{
+			DNSNames: []string{"foo.bar.zar"},
+		}, false},
+		{"unknown unauthorized", "foo", "example.com", nil, true},
+		{"reject authorized", CommonNameReject, "foo.bar.zar", &x509.Certificate{
+			Subject:  pkix.Name{CommonName: "foo.bar.zar"},
+			DNSNames: []string{"foo.bar.zar"},
+		}, false},
+		{"promote authorized dns", CommonNamePromote, "foo.bar.zar", &x509.Certificate{
+			Subject:  pkix.Name{CommonName: "foo.bar.zar"},
+			DNSNames: []string{"foo.bar.zar"},
+		}, false},
+		{"promote authorized ip", CommonNamePromote, "127.0.0.1", &x509.Certificate{
+			Subject:     pkix.Name{CommonName: "127.0.0.1"},
+			DNSNames:    []string{"foo.bar.zar"},
+			IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		}, false},
+		{"promote authorized email", CommonNamePromote, "foo@bar.zar", &x509.Certificate{
+			Subject:        pkix.Name{CommonName: "foo@bar.zar"},
+			DNSNames:       []string{"foo.bar.zar"},
+			EmailAddresses: []string{"foo@bar.zar"},
+		}, false},
+		{"drop authorized", CommonNameDrop, "127.0.0.1", &x509.Certificate{
+			Subject:  pkix.Name{CommonName: "127.0.0.1"},
+			DNSNames: []string{"foo.bar.zar"},
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := newCommonNameOptions(tt.mode, names)
+			req := &x509.CertificateRequest{Subject: pkix.Name{CommonName: tt.cn}}
+			cert := &x509.Certificate{
+				Subject:  pkix.Name{CommonName: tt.cn},
+				DNSNames: []string{"foo.bar.zar"},
+			}
+			if err := apply(opts, req, cert); (err != nil) != tt.wantErr {
+				t.Errorf("newCommonNameOptions() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.want != nil {
+				assert.Equals(t, tt.want, cert)
+			}
+		})
+	}
+}
+
 func Test_emailAddressesValidator_Valid(t *testing.T) {
 	type args struct {
 		req *x509.CertificateRequest
@@ -53,6 +53,9 @@ type SignSSHOptions struct {
 	ValidBefore  TimeDuration    `json:"validBefore,omitempty"`
 	TemplateData json.RawMessage `json:"templateData,omitempty"`
 	Backdate     time.Duration   `json:"-"`
+	// Host is the information of the SSH host inventory added by the authority
+	// to the templates of host certificates.
+	Host *SSHHostTemplateData `json:"-"`
 }
 
 // Validate validates the given SignSSHOptions.
@@ -0,0 +1,378 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/pemutil"
+	"go.step.sm/crypto/x509util"
+	"go.step.sm/linkedca"
+
+	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/certificates/webhook"
+)
+
+// spiffePayload extends jwt.Claims with step attributes.
+type spiffePayload struct {
+	jose.Claims
+	SANs     []string `json:"sans,omitempty"`
+	spiffeID *url.URL
+	leaf     *x509.Certificate
+}
+
+// SPIFFE is a provisioner that authenticates workloads using SPIFFE Verifiable
+// Identity Documents (SVIDs), like the ones obtained from the Workload API of a
+// SPIRE agent. Two kind of tokens are accepted:
+//
+//   - A token signed with the key of an X.509-SVID, with the SVID chain in the
+//     x5c header. The SVID is verified using the trust domain bundle in Roots.
+//     The issuer of the token must be the provisioner name.
+//   - A JWT-SVID with the sign audience of the provisioner. The JWT-SVID is
+//     verified using the JWT authorities of the trust domain, available in
+//     JWKSetURI.
+//
+// The certificates contain the SPIFFE ID of the workload and, optionally, the
+// SANs configured for it in IDs. Tokens cannot be reused.
+type SPIFFE struct {
+	*base
+	ID          string             `json:"-"`
+	Type        string             `json:"type"`
+	Name        string             `json:"name"`
+	TrustDomain string             `json:"trustDomain"`
+	Roots       []byte             `json:"roots,omitempty"`
+	JWKSetURI   string             `json:"jwkSetURI,omitempty"`
+	IDs         []*SPIFFEIDMapping `json:"ids,omitempty"`
+	Claims      *Claims            `json:"claims,omitempty"`
+	Options     *Options           `json:"options,omitempty"`
+	ctl         *Controller
+	rootPool    *x509.CertPool
+	keyStore    *keyStore
+}
+
+// SPIFFEIDMapping maps a SPIFFE ID to the SANs, besides the SPIFFE ID itself,
+// allowed in the certificates of a workload. The ID can end with "/*" to match
+// all the SPIFFE IDs with that prefix.
+type SPIFFEIDMapping struct {
+	ID   string   `json:"id"`
+	SANs []string `json:"sans"`
+}
+
+// matches returns true if the mapping ID matches the given SPIFFE ID.
+func (m *SPIFFEIDMapping) matches(id string) bool {
+	if prefix, ok := strings.CutSuffix(m.ID, "/*"); ok {
+		return strings.HasPrefix(id, prefix+"/")
+	}
+	return m.ID == id
+}
+
+// GetID returns the provisioner unique identifier.
+func (p *SPIFFE) GetID() string {
+	if p.ID != "" {
+		return p.ID
+	}
+	return p.GetIDForToken()
+}
+
+// GetIDForToken returns an identifier that will be used to load the provisioner
+// from a token.
+func (p *SPIFFE) GetIDForToken() string {
+	return "spiffe/" + p.Name
+}
+
+// GetTokenID returns the identifier of the token. JWT-SVIDs do not usually
+// have a jti claim, an empty id makes the authority use the hash of the token.
+func (p *SPIFFE) GetTokenID(ott string) (string, error) {
+	// Validate payload
+	token, err := jose.ParseSigned(ott)
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing token")
+	}
+
+	// Get claims w/out verification. We need to look up the provisioner
+	// key in order to verify the claims and we need the issuer from the claims
+	// before we can look up the provisioner.
+	var claims jose.Claims
+	if err = token.UnsafeClaimsWithoutVerification(&claims); err != nil {
+		return "", errors.Wrap(err, "error verifying claims")
+	}
+	return claims.ID, nil
+}
+
+// GetName returns the name of the provisioner.
+func (p *SPIFFE) GetName() string {
+	return p.Name
+}
+
+// GetType returns the type of provisioner.
+func (p *SPIFFE) GetType() Type {
+	return TypeSPIFFE
+}
+
+// GetEncryptedKey returns the base provisioner encrypted key if it's defined.
+func (p *SPIFFE) GetEncryptedKey() (string, string, bool) {
+	return "", "", false
+}
+
+// GetOptions returns the configured provisioner options.
+func (p *SPIFFE) GetOptions() *Options {
+	return p.Options
+}
+
+// Init initializes and validates the fields of a SPIFFE type.
+func (p *SPIFFE) Init(config Config) (err error) {
+	switch {
+	case p.Type == "":
+		return errors.New("provisioner type cannot be empty")
+	case p.Name == "":
+		return errors.New("provisioner name cannot be empty")
+	case p.TrustDomain == "":
+		return errors.New("provisioner trustDomain cannot be empty")
+	case len(p.Roots) == 0 && p.JWKSetURI == "":
+		return errors.New("provisioner roots or jwkSetURI must be set")
+	}
+
+	if _, err := parseSPIFFEID("spiffe://"+p.TrustDomain, ""); err != nil {
+		return errors.Errorf("provisioner trustDomain %q is not valid", p.TrustDomain)
+	}
+	for _, m := range p.IDs {
+		if m == nil {
+			return errors.New("provisioner ids cannot contain an empty mapping")
+		}
+		if _, err := parseSPIFFEID(strings.TrimSuffix(m.ID, "/*"), p.TrustDomain); err != nil {
+			return errors.Wrapf(err, "provisioner ids contains an invalid id %q", m.ID)
+		}
+	}
+
+	if len(p.Roots) > 0 {
+		certs, err := pemutil.ParseCertificateBundle(p.Roots)
+		if err != nil {
+			return errors.Wrap(err, "error parsing roots")
+		}
+		p.rootPool = x509.NewCertPool()
+		for _, crt := range certs {
+			p.rootPool.AddCert(crt)
+		}
+	}
+
+	if p.JWKSetURI != "" {
+		if p.keyStore, err = newKeyStore(p.JWKSetURI); err != nil {
+			return err
+		}
+	}
+
+	config.Audiences = config.Audiences.WithFragment(p.GetIDForToken())
+	p.Options = mergeOptions(p.Options, config.DefaultOptions, p.GetType())
+	p.ctl, err = NewController(p, p.Claims, config, p.Options)
+	return
+}
+
+// authorizeToken validates a token signed with an X.509-SVID or a JWT-SVID,
+// and returns the claims with the SPIFFE ID of the workload.
+func (p *SPIFFE) authorizeToken(token string, audiences []string) (*spiffePayload, error) {
+	jwt, err := jose.ParseSigned(token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "spiffe.authorizeToken; error parsing spiffe token")
+	}
+
+	var claims spiffePayload
+	expected := jose.Expected{
+		Time: time.Now().UTC(),
+	}
+
+	if hasX5CHeader(token) {
+		if p.rootPool == nil {
+			return nil, errs.Unauthorized("spiffe.authorizeToken; provisioner does not accept x509-svid tokens")
+		}
+		verifiedChains, err := jwt.Headers[0].Certificates(x509.VerifyOptions{
+			Roots:     p.rootPool,
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		})
+		if err != nil {
+			return nil, errs.Wrap(http.StatusUnauthorized, err,
+				"spiffe.authorizeToken; error verifying x509-svid")
+		}
+		leaf := verifiedChains[0][0]
+		if leaf.IsCA || leaf.KeyUsage&x509.KeyUsageDigitalSignature == 0 {
+			return nil, errs.Unauthorized("spiffe.authorizeToken; x509-svid cannot be used for digital signature")
+		}
+		if len(leaf.URIs) != 1 {
+			return nil, errs.Unauthorized("spiffe.authorizeToken; x509-svid must contain exactly one uri")
+		}
+		if claims.spiffeID, err = parseSPIFFEID(leaf.URIs[0].String(), p.TrustDomain); err != nil {
+			return nil, errs.Wrap(http.StatusUnauthorized, err, "spiffe.authorizeToken; x509-svid is not valid")
+		}
+		if err := jwt.Claims(leaf.PublicKey, &claims); err != nil {
+			return nil, errs.Wrap(http.StatusUnauthorized, err, "spiffe.authorizeToken; error parsing spiffe claims")
+		}
+		if claims.Subject != claims.spiffeID.String() {
+			return nil, errs.Unauthorized("spiffe.authorizeToken; spiffe token subject does not match the x509-svid")
+		}
+		expected.Issuer = p.Name
+		claims.leaf = leaf
+	} else {
+		if p.keyStore == nil {
+			return nil, errs.Unauthorized("spiffe.authorizeToken; provisioner does not accept jwt-svid tokens")
+		}
+		found := false
+		for _, key := range p.keyStore.Get(jwt.Headers[0].KeyID) {
+			if err := jwt.Claims(key, &claims); err == nil {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, errs.Unauthorized("spiffe.authorizeToken; cannot validate jwt-svid")
+		}
+		if claims.Expiry == nil {
+			return nil, errs.Unauthorized("spiffe.authorizeToken; jwt-svid must contain an exp claim")
+		}
+		if claims.spiffeID, err = parseSPIFFEID(claims.Subject, p.TrustDomain); err != nil {
+			return nil, errs.Wrap(http.StatusUnauthorized, err, "spiffe.authorizeToken; jwt-svid is not valid")
+		}
+		// JWT-SVIDs are not a request for specific SANs.
+		claims.SANs = nil
+	}
+
+	// According to "rfc7519 JSON Web Token" acceptable skew should be no
+	// more than a few minutes.
+	if err = claims.ValidateWithLeeway(expected, time.Minute); err != nil {
+		return nil, errs.Wrapf(http.StatusUnauthorized, err, "spiffe.authorizeToken; invalid spiffe claims")
+	}
+
+	// validate audiences with the defaults
+	if !matchesAudience(claims.Audience, audiences) {
+		return nil, errs.Unauthorized("spiffe.authorizeToken; spiffe token has invalid audience "+
+			"claim (aud); expected %s, but got %s", audiences, claims.Audience)
+	}
+
+	return &claims, nil
+}
+
+// allowedSANs returns the SANs that can be used in the certificates of the
+// given SPIFFE ID, the SPIFFE ID and the SANs of the mappings matching it.
+func (p *SPIFFE) allowedSANs(id string) []string {
+	sans := []string{id}
+	for _, m := range p.IDs {
+		if m.matches(id) {
+			sans = appendUnique(sans, m.SANs...)
+		}
+	}
+	return sans
+}
+
+// AuthorizeSign validates the given token.
+func (p *SPIFFE) AuthorizeSign(ctx context.Context, token string) ([]SignOption, error) {
+	claims, err := p.authorizeToken(token, p.ctl.Audiences.Sign)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "spiffe.AuthorizeSign")
+	}
+
+	id := claims.spiffeID.String()
+	allowed := p.allowedSANs(id)
+	sans := claims.SANs
+	if len(sans) == 0 {
+		sans = allowed
+	}
+	for _, san := range sans {
+		if !slices.Contains(allowed, san) {
+			return nil, errs.Forbidden("spiffe.AuthorizeSign; san %q is not allowed for %s", san, id)
+		}
+	}
+
+	// Certificate templates
+	data := x509util.CreateTemplateData(id, sans)
+	if v, err := unsafeParseSigned(token); err == nil {
+		data.SetToken(v)
+	}
+
+	var webhookOptions []webhook.RequestBodyOption
+	limitDuration := profileLimitDuration{def: p.ctl.Claimer.DefaultTLSCertDuration()}
+	if claims.leaf != nil {
+		// The X.509-SVID will be available using the template variable
+		// AuthorizationCrt.
+		data.SetAuthorizationCertificate(claims.leaf)
+		webhookOptions = append(webhookOptions, webhook.WithX5CCertificate(claims.leaf))
+		limitDuration.notBefore = claims.leaf.NotBefore
+		limitDuration.notAfter = claims.leaf.NotAfter
+	}
+	webhookOptions = append(webhookOptions, webhook.WithAuthorizationPrincipal(id))
+
+	templateOptions, err := TemplateOptions(p.Options, data)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "spiffe.AuthorizeSign")
+	}
+
+	return []SignOption{
+		p,
+		templateOptions,
+		// modifiers / withOptions
+		newProvisionerExtensionOption(TypeSPIFFE, p.Name, "").WithControllerOptions(p.ctl),
+		limitDuration,
+		// validators
+		newDefaultSANsValidator(ctx, sans),
+		defaultPublicKeyValidator{},
+		newValidityValidator(p.ctl.Claimer.MinTLSCertDuration(), p.ctl.Claimer.MaxTLSCertDuration()),
+		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
+		p.ctl.newWebhookController(data, linkedca.Webhook_X509, webhookOptions...),
+	}, nil
+}
+
+// AuthorizeRenew returns an error if the renewal is disabled.
+func (p *SPIFFE) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) error {
+	return p.ctl.AuthorizeRenew(ctx, cert)
+}
+
+// AuthorizeRevoke returns an error if the token is not valid.
+func (p *SPIFFE) AuthorizeRevoke(_ context.Context, token string) error {
+	_, err := p.authorizeToken(token, p.ctl.Audiences.Revoke)
+	return errs.Wrap(http.StatusInternalServerError, err, "spiffe.AuthorizeRevoke")
+}
+
+// parseSPIFFEID parses and validates a SPIFFE ID. If trustDomain is not empty,
+// the SPIFFE ID must belong to it.
+func parseSPIFFEID(s, trustDomain string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing spiffe id %q", s)
+	}
+	switch {
+	case u.Scheme != "spiffe":
+		return nil, errors.Errorf("spiffe id %q must use the spiffe scheme", s)
+	case u.Host == "" || u.Port() != "":
+		return nil, errors.Errorf("spiffe id %q does not contain a valid trust domain", s)
+	case u.User != nil || u.RawQuery != "" || u.Fragment != "":
+		return nil, errors.Errorf("spiffe id %q cannot contain a user info, query or fragment", s)
+	case trustDomain != "" && !strings.EqualFold(u.Host, trustDomain):
+		return nil, errors.Errorf("spiffe id %q does not belong to the trust domain %q", s, trustDomain)
+	}
+	return u, nil
+}
+
+// hasX5CHeader returns true if the protected header of a compact serialized
+// token contains the x5c header.
+func hasX5CHeader(token string) bool {
+	i := strings.IndexByte(token, '.')
+	if i < 0 {
+		return false
+	}
+	b, err := base64.RawURLEncoding.DecodeString(token[:i])
+	if err != nil {
+		return false
+	}
+	var header map[string]json.RawMessage
+	if err := json.Unmarshal(b, &header); err != nil {
+		return false
+	}
+	_, ok := header["x5c"]
+	return ok
+}
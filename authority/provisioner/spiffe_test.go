@@ -0,0 +1,243 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/minica"
+	"go.step.sm/crypto/x509util"
+
+	"github.com/smallstep/certificates/api/render"
+)
+
+func newSPIFFESVID(t *testing.T, ca *minica.CA, id string) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	u, err := url.Parse(id)
+	require.NoError(t, err)
+	crt, err := ca.Sign(&x509.Certificate{
+		PublicKey:   key.Public(),
+		URIs:        []*url.URL{u},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+	})
+	require.NoError(t, err)
+	return crt, key
+}
+
+func newSPIFFEToken(t *testing.T, key interface{}, kid string, claims map[string]interface{}, certs ...*x509.Certificate) string {
+	t.Helper()
+	so := new(jose.SignerOptions)
+	so.WithType("JWT")
+	if kid != "" {
+		so.WithHeader("kid", kid)
+	}
+	if len(certs) > 0 {
+		require.NoError(t, withX5CHdr(certs)(so))
+	}
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: key}, so)
+	require.NoError(t, err)
+	tok, err := jose.Signed(sig).Claims(claims).CompactSerialize()
+	require.NoError(t, err)
+	return tok
+}
+
+func newSPIFFE(t *testing.T, ca *minica.CA, jwksURI string) *SPIFFE {
+	t.Helper()
+	p := &SPIFFE{
+		Type:        "SPIFFE",
+		Name:        "spiffe",
+		TrustDomain: "example.org",
+		Roots:       pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Root.Raw}),
+		JWKSetURI:   jwksURI,
+		IDs: []*SPIFFEIDMapping{
+			{ID: "spiffe://example.org/ns/web/sa/frontend", SANs: []string{"frontend.example.org"}},
+			{ID: "spiffe://example.org/ns/web/*", SANs: []string{"web.example.org"}},
+		},
+	}
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+	return p
+}
+
+func TestSPIFFE_Init(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	roots := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Root.Raw})
+	srv := generateJWKServer(2)
+	defer srv.Close()
+
+	tests := []struct {
+		name    string
+		p       *SPIFFE
+		wantErr bool
+	}{
+		{"ok roots", &SPIFFE{Type: "SPIFFE", Name: "spiffe", TrustDomain: "example.org", Roots: roots}, false},
+		{"ok jwkSetURI", &SPIFFE{Type: "SPIFFE", Name: "spiffe", TrustDomain: "example.org", JWKSetURI: srv.URL + "/jwks_uri"}, false},
+		{"ok ids", &SPIFFE{Type: "SPIFFE", Name: "spiffe", TrustDomain: "example.org", Roots: roots, IDs: []*SPIFFEIDMapping{
+			{ID: "spiffe://example.org/foo", SANs: []string{"foo.example.org"}},
+			{ID: "spiffe://example.org/bar/*", SANs: []string{"bar.example.org"}},
+		}}, false},
+		{"fail type", &SPIFFE{Name: "spiffe", TrustDomain: "example.org", Roots: roots}, true},
+		{"fail name", &SPIFFE{Type: "SPIFFE", TrustDomain: "example.org", Roots: roots}, true},
+		{"fail trustDomain", &SPIFFE{Type: "SPIFFE", Name: "spiffe", Roots: roots}, true},
+		{"fail bad trustDomain", &SPIFFE{Type: "SPIFFE", Name: "spiffe", TrustDomain: "example.org:443", Roots: roots}, true},
+		{"fail no keys", &SPIFFE{Type: "SPIFFE", Name: "spiffe", TrustDomain: "example.org"}, true},
+		{"fail roots", &SPIFFE{Type: "SPIFFE", Name: "spiffe", TrustDomain: "example.org", Roots: []byte("foo")}, true},
+		{"fail jwkSetURI", &SPIFFE{Type: "SPIFFE", Name: "spiffe", TrustDomain: "example.org", JWKSetURI: srv.URL + "/error"}, true},
+		{"fail nil id", &SPIFFE{Type: "SPIFFE", Name: "spiffe", TrustDomain: "example.org", Roots: roots, IDs: []*SPIFFEIDMapping{nil}}, true},
+		{"fail id trustDomain", &SPIFFE{Type: "SPIFFE", Name: "spiffe", TrustDomain: "example.org", Roots: roots, IDs: []*SPIFFEIDMapping{
+			{ID: "spiffe://example.com/foo", SANs: []string{"foo.example.org"}},
+		}}, true},
+		{"fail id scheme", &SPIFFE{Type: "SPIFFE", Name: "spiffe", TrustDomain: "example.org", Roots: roots, IDs: []*SPIFFEIDMapping{
+			{ID: "https://example.org/foo", SANs: []string{"foo.example.org"}},
+		}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences})
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "spiffe/spiffe", tt.p.GetID())
+			assert.Equal(t, TypeSPIFFE, tt.p.GetType())
+		})
+	}
+}
+
+func TestSPIFFE_AuthorizeSign(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	otherCA, err := minica.New()
+	require.NoError(t, err)
+
+	srv := generateJWKServer(2)
+	defer srv.Close()
+	var keys jose.JSONWebKeySet
+	require.NoError(t, getAndDecode(srv.URL+"/private", &keys))
+
+	p := newSPIFFE(t, ca, srv.URL+"/jwks_uri")
+	aud := testAudiences.Sign[0] + "#" + p.GetIDForToken()
+	now := time.Now()
+	newClaims := func(iss, sub string, sans ...string) map[string]interface{} {
+		claims := map[string]interface{}{
+			"sub": sub, "aud": aud,
+			"iat": now.Unix(), "nbf": now.Unix(), "exp": now.Add(5 * time.Minute).Unix(),
+		}
+		if iss != "" {
+			claims["iss"] = iss
+		}
+		if len(sans) > 0 {
+			claims["sans"] = sans
+		}
+		return claims
+	}
+
+	frontendID := "spiffe://example.org/ns/web/sa/frontend"
+	frontend, frontendKey := newSPIFFESVID(t, ca, frontendID)
+	backendID := "spiffe://example.org/ns/db/sa/backend"
+	backend, backendKey := newSPIFFESVID(t, ca, backendID)
+	other, otherKey := newSPIFFESVID(t, ca, "spiffe://example.com/ns/web/sa/frontend")
+	untrusted, untrustedKey := newSPIFFESVID(t, otherCA, frontendID)
+
+	tests := []struct {
+		name       string
+		token      string
+		wantSANs   []string
+		statusCode int
+	}{
+		{"ok x509-svid", newSPIFFEToken(t, frontendKey, "", newClaims("spiffe", frontendID), frontend, ca.Intermediate),
+			[]string{frontendID, "frontend.example.org", "web.example.org"}, 0},
+		{"ok x509-svid sans", newSPIFFEToken(t, frontendKey, "", newClaims("spiffe", frontendID, "web.example.org"), frontend, ca.Intermediate),
+			[]string{"web.example.org"}, 0},
+		{"ok x509-svid not mapped", newSPIFFEToken(t, backendKey, "", newClaims("spiffe", backendID), backend, ca.Intermediate),
+			[]string{backendID}, 0},
+		{"ok jwt-svid", newSPIFFEToken(t, keys.Keys[0].Key, keys.Keys[0].KeyID, newClaims("", "spiffe://example.org/ns/web/sa/api", "other.example.org")),
+			[]string{"spiffe://example.org/ns/web/sa/api", "web.example.org"}, 0},
+		{"fail x509-svid sans", newSPIFFEToken(t, backendKey, "", newClaims("spiffe", backendID, "web.example.org"), backend, ca.Intermediate),
+			nil, http.StatusForbidden},
+		{"fail x509-svid issuer", newSPIFFEToken(t, frontendKey, "", newClaims("foo", frontendID), frontend, ca.Intermediate),
+			nil, http.StatusUnauthorized},
+		{"fail x509-svid subject", newSPIFFEToken(t, frontendKey, "", newClaims("spiffe", backendID), frontend, ca.Intermediate),
+			nil, http.StatusUnauthorized},
+		{"fail x509-svid trust domain", newSPIFFEToken(t, otherKey, "", newClaims("spiffe", other.URIs[0].String()), other, ca.Intermediate),
+			nil, http.StatusUnauthorized},
+		{"fail x509-svid untrusted", newSPIFFEToken(t, untrustedKey, "", newClaims("spiffe", frontendID), untrusted, otherCA.Intermediate),
+			nil, http.StatusUnauthorized},
+		{"fail x509-svid key", newSPIFFEToken(t, backendKey, "", newClaims("spiffe", frontendID), frontend, ca.Intermediate),
+			nil, http.StatusUnauthorized},
+		{"fail jwt-svid key", newSPIFFEToken(t, frontendKey, keys.Keys[0].KeyID, newClaims("", frontendID)),
+			nil, http.StatusUnauthorized},
+		{"fail jwt-svid trust domain", newSPIFFEToken(t, keys.Keys[0].Key, keys.Keys[0].KeyID, newClaims("", "spiffe://example.com/foo")),
+			nil, http.StatusUnauthorized},
+		{"fail jwt-svid audience", newSPIFFEToken(t, keys.Keys[0].Key, keys.Keys[0].KeyID, map[string]interface{}{
+			"sub": frontendID, "aud": "foo", "exp": now.Add(5 * time.Minute).Unix(),
+		}), nil, http.StatusUnauthorized},
+		{"fail jwt-svid exp", newSPIFFEToken(t, keys.Keys[0].Key, keys.Keys[0].KeyID, map[string]interface{}{
+			"sub": frontendID, "aud": aud,
+		}), nil, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signOpts, err := p.AuthorizeSign(context.Background(), tt.token)
+			if tt.statusCode != 0 {
+				var sc render.StatusCodedError
+				require.True(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+				assert.Equal(t, tt.statusCode, sc.StatusCode())
+				return
+			}
+			require.NoError(t, err)
+
+			var found bool
+			for _, op := range signOpts {
+				if cof, ok := op.(CertificateOptions); ok {
+					found = true
+					csr := parseCertificateRequest(t, "testdata/certs/ecdsa.csr")
+					crt, err := x509util.NewCertificate(csr, cof.Options(SignOptions{})...)
+					require.NoError(t, err)
+					cert := crt.GetCertificate()
+					var sans []string
+					sans = append(sans, cert.DNSNames...)
+					for _, u := range cert.URIs {
+						sans = append(sans, u.String())
+					}
+					assert.ElementsMatch(t, tt.wantSANs, sans)
+				}
+			}
+			assert.True(t, found)
+		})
+	}
+}
+
+func TestSPIFFE_AuthorizeRevoke(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	p := newSPIFFE(t, ca, "")
+
+	id := "spiffe://example.org/ns/web/sa/frontend"
+	crt, key := newSPIFFESVID(t, ca, id)
+	now := time.Now()
+	newToken := func(aud string) string {
+		return newSPIFFEToken(t, key, "", map[string]interface{}{
+			"iss": "spiffe", "sub": id, "aud": aud,
+			"iat": now.Unix(), "nbf": now.Unix(), "exp": now.Add(5 * time.Minute).Unix(),
+		}, crt, ca.Intermediate)
+	}
+
+	assert.NoError(t, p.AuthorizeRevoke(context.Background(), newToken(testAudiences.Revoke[0]+"#"+p.GetIDForToken())))
+	assert.Error(t, p.AuthorizeRevoke(context.Background(), newToken(testAudiences.Sign[0]+"#"+p.GetIDForToken())))
+}
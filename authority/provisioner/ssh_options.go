@@ -1,14 +1,23 @@
 package provisioner
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"net"
+	"regexp"
+	"slices"
 	"strings"
+	"text/template"
 
 	"github.com/pkg/errors"
 	"go.step.sm/cli-utils/step"
 	"go.step.sm/crypto/sshutil"
+	"golang.org/x/crypto/ssh"
 
 	"github.com/smallstep/certificates/authority/policy"
+	"github.com/smallstep/certificates/middleware/clientinfo"
+	"github.com/smallstep/certificates/middleware/requestid"
 )
 
 // SSHCertificateOptions is an interface that returns a list of options passed when
@@ -37,6 +46,44 @@ type SSHOptions struct {
 	// templates.
 	TemplateData json.RawMessage `json:"templateData,omitempty"`
 
+	// EnableTemplateDNSLookups enables the lookupHost and lookupAddr functions
+	// in the certificate template. Defaults to false.
+	EnableTemplateDNSLookups bool `json:"enableTemplateDNSLookups,omitempty"`
+
+	// KeyID is a template used to render the key id of the SSH certificates,
+	// e.g. "{{ .Token.email }}-{{ now | unixEpoch }}". The template is executed
+	// with the same data as the certificate template, and it overrides the key
+	// id set by the certificate template.
+	KeyID string `json:"keyID,omitempty"`
+
+	// CriticalOptions are templates of critical options added to the SSH
+	// certificates, e.g. {"force-command": "/usr/local/bin/backup"}. The values
+	// are executed with the same data as the certificate template, and they
+	// override the critical options set by the certificate template.
+	CriticalOptions map[string]string `json:"criticalOptions,omitempty"`
+
+	// Extensions are templates of extensions added to the SSH certificates,
+	// e.g. {"permit-pty": ""}. The values are executed with the same data as
+	// the certificate template, and they override the extensions set by the
+	// certificate template.
+	Extensions map[string]string `json:"extensions,omitempty"`
+
+	// PrincipalOptions contains the critical options and extensions added to
+	// the SSH certificates with the given principal. They are applied after
+	// the provisioner critical options and extensions.
+	PrincipalOptions map[string]*SSHPrincipalOptions `json:"principalOptions,omitempty"`
+
+	// UserPrincipals restricts the principals of the SSH user certificates to
+	// the ones allowed for the identity in the token, e.g. the email of an
+	// OIDC token. If it is set, identities not matching any rule cannot get
+	// SSH user certificates. It can only be used in JWK and OIDC provisioners.
+	UserPrincipals []*SSHUserPrincipalRule `json:"userPrincipals,omitempty"`
+
+	// SourceAddress sets the source-address critical option of the SSH user
+	// certificates, restricting the addresses from which they can be used. It
+	// can only be used in JWK, OIDC, GCP, K8sSA, X5C and plugin provisioners.
+	SourceAddress *SSHSourceAddress `json:"sourceAddress,omitempty"`
+
 	// User contains SSH user certificate options.
 	User *policy.SSHUserCertificateOptions `json:"-"`
 
@@ -44,6 +91,48 @@ type SSHOptions struct {
 	Host *policy.SSHHostCertificateOptions `json:"-"`
 }
 
+// SSHPrincipalOptions are the critical options and extensions added to the SSH
+// certificates with a given principal.
+type SSHPrincipalOptions struct {
+	CriticalOptions map[string]string `json:"criticalOptions,omitempty"`
+	Extensions      map[string]string `json:"extensions,omitempty"`
+}
+
+// SSHUserPrincipalRule defines the SSH user principals allowed for the
+// identities matching a regular expression. The principals can reference the
+// submatches of the expression, e.g. {"identity": "(.+)@example\\.com",
+// "principals": ["$1"]} allows jane@example.com to use the principal jane.
+type SSHUserPrincipalRule struct {
+	Identity   string   `json:"identity"`
+	Principals []string `json:"principals"`
+	re         *regexp.Regexp
+}
+
+// Validate validates the user principal rule.
+func (r *SSHUserPrincipalRule) Validate() error {
+	switch {
+	case r == nil:
+		return errors.New("ssh userPrincipals cannot contain an empty rule")
+	case r.Identity == "":
+		return errors.New("ssh userPrincipals identity cannot be empty")
+	case len(r.Principals) == 0:
+		return errors.Errorf("ssh userPrincipals principals for %q cannot be empty", r.Identity)
+	}
+	if _, err := r.compile(); err != nil {
+		return errors.Wrapf(err, "error parsing ssh userPrincipals identity %q", r.Identity)
+	}
+	return nil
+}
+
+// compile returns the regular expression of the rule, it always matches the
+// full identity.
+func (r *SSHUserPrincipalRule) compile() (*regexp.Regexp, error) {
+	if r.re != nil {
+		return r.re, nil
+	}
+	return regexp.Compile("^(?:" + r.Identity + ")$")
+}
+
 // GetAllowedUserNameOptions returns the SSHNameOptions that are
 // allowed when SSH User certificates are requested.
 func (o *SSHOptions) GetAllowedUserNameOptions() *policy.SSHNameOptions {
@@ -92,11 +181,361 @@ func (o *SSHOptions) GetDeniedHostNameOptions() *policy.SSHNameOptions {
 	return o.Host.DeniedNames
 }
 
+// GetSourceAddress returns the source address options of the SSH user
+// certificates.
+func (o *SSHOptions) GetSourceAddress() *SSHSourceAddress {
+	if o == nil {
+		return nil
+	}
+	return o.SourceAddress
+}
+
 // HasTemplate returns true if a template is defined in the provisioner options.
 func (o *SSHOptions) HasTemplate() bool {
 	return o != nil && (o.Template != "" || o.TemplateFile != "")
 }
 
+// validateKeyID returns an error if the key id template cannot be parsed.
+func (o *SSHOptions) validateKeyID() error {
+	if o == nil || o.KeyID == "" {
+		return nil
+	}
+	if _, err := parseSSHKeyIDTemplate(o.KeyID); err != nil {
+		return errors.Wrap(err, "error parsing ssh keyID template")
+	}
+	return nil
+}
+
+func parseSSHKeyIDTemplate(text string) (*template.Template, error) {
+	return parseSSHValueTemplate("keyID", text)
+}
+
+func parseSSHValueTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(sshutil.GetFuncMap()).Option("missingkey=error").Parse(text)
+}
+
+// validateUserPrincipals returns an error if the user principal rules are not
+// valid or if the provisioner type does not enforce them, and compiles the
+// regular expressions of the rules.
+func (o *SSHOptions) validateUserPrincipals(typ Type) error {
+	if o == nil || len(o.UserPrincipals) == 0 {
+		return nil
+	}
+	if !supportsSSHUserPrincipals(typ) {
+		return errors.Errorf("ssh userPrincipals are not supported by %s provisioners", typ)
+	}
+	for _, r := range o.UserPrincipals {
+		if err := r.Validate(); err != nil {
+			return err
+		}
+		r.re, _ = r.compile()
+	}
+	return nil
+}
+
+// supportsSSHUserPrincipals returns true if the provisioners of the given type
+// can use the userPrincipals options.
+func supportsSSHUserPrincipals(typ Type) bool {
+	return typ == TypeJWK || typ == TypeOIDC
+}
+
+// allowedUserPrincipals returns the principals allowed for the given identity
+// and true if user principal rules are configured.
+func (o *SSHOptions) allowedUserPrincipals(identity string) ([]string, bool) {
+	if o == nil || len(o.UserPrincipals) == 0 {
+		return nil, false
+	}
+	var principals []string
+	for _, r := range o.UserPrincipals {
+		re, err := r.compile()
+		if err != nil {
+			continue
+		}
+		m := re.FindStringSubmatchIndex(identity)
+		if m == nil {
+			continue
+		}
+		for _, p := range r.Principals {
+			if v := string(re.ExpandString(nil, p, identity, m)); v != "" {
+				principals = appendUnique(principals, v)
+			}
+		}
+	}
+	return principals, true
+}
+
+// sshUserPrincipalsValidator validates that the principals of an SSH user
+// certificate are allowed for the identity in the token.
+type sshUserPrincipalsValidator struct {
+	identity   string
+	principals []string
+}
+
+// newSSHUserPrincipalsValidator returns the validator of the user principal
+// rules in the given options, or nil if they are not configured.
+func newSSHUserPrincipalsValidator(o *SSHOptions, identity string) *sshUserPrincipalsValidator {
+	principals, ok := o.allowedUserPrincipals(identity)
+	if !ok {
+		return nil
+	}
+	return &sshUserPrincipalsValidator{
+		identity:   identity,
+		principals: principals,
+	}
+}
+
+// Valid implements SSHCertValidator and returns an error if a principal of an
+// SSH user certificate is not allowed.
+func (v *sshUserPrincipalsValidator) Valid(cert *ssh.Certificate, _ SignSSHOptions) error {
+	if cert.CertType != ssh.UserCert {
+		return nil
+	}
+	if len(v.principals) == 0 {
+		return errors.Errorf("ssh user certificates are not allowed for %q", v.identity)
+	}
+	for _, p := range cert.ValidPrincipals {
+		if !slices.Contains(v.principals, p) {
+			return errors.Errorf("ssh certificate principal %q is not allowed for %q", p, v.identity)
+		}
+	}
+	return nil
+}
+
+// SSHSourceAddress defines the addresses set in the source-address critical
+// option of the SSH user certificates. If ClientIP is set, the IP address of
+// the client requesting the certificate, as observed by the CA, is added to the
+// list of CIDRs.
+type SSHSourceAddress struct {
+	ClientIP bool     `json:"clientIP,omitempty"`
+	CIDRs    []string `json:"cidrs,omitempty"`
+}
+
+// validateSourceAddress returns an error if the source address options are not
+// valid or if the provisioner type does not set them.
+func (o *SSHOptions) validateSourceAddress(typ Type) error {
+	sa := o.GetSourceAddress()
+	if sa == nil {
+		return nil
+	}
+	if !supportsSSHSourceAddress(typ) {
+		return errors.Errorf("ssh sourceAddress is not supported by %s provisioners", typ)
+	}
+	return sa.Validate()
+}
+
+// supportsSSHSourceAddress returns true if the provisioners of the given type
+// can use the sourceAddress options.
+func supportsSSHSourceAddress(typ Type) bool {
+	switch typ {
+	case TypeJWK, TypeOIDC, TypeGCP, TypeK8sSA, TypeX5C, TypePlugin:
+		return true
+	default:
+		return false
+	}
+}
+
+// Validate returns an error if the source address options are not valid.
+func (o *SSHSourceAddress) Validate() error {
+	if o == nil {
+		return nil
+	}
+	if !o.ClientIP && len(o.CIDRs) == 0 {
+		return errors.New("ssh sourceAddress requires clientIP or cidrs")
+	}
+	for _, cidr := range o.CIDRs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil && net.ParseIP(cidr) == nil {
+			return errors.Errorf("ssh sourceAddress cidr %q is not valid", cidr)
+		}
+	}
+	return nil
+}
+
+// sshSourceAddressModifier sets the source-address critical option of an SSH
+// user certificate. The critical option set by the template is replaced.
+type sshSourceAddressModifier struct {
+	addresses []string
+	err       error
+}
+
+// newSSHSourceAddressModifier returns the modifier of the source address
+// options in the given SSH options, or nil if they are not configured.
+func newSSHSourceAddressModifier(ctx context.Context, o *SSHOptions) *sshSourceAddressModifier {
+	sa := o.GetSourceAddress()
+	if sa == nil {
+		return nil
+	}
+	m := &sshSourceAddressModifier{
+		addresses: slices.Clone(sa.CIDRs),
+	}
+	if sa.ClientIP {
+		if info, ok := clientinfo.FromContext(ctx); ok && info.IP != nil {
+			m.addresses = appendUnique(m.addresses, info.IP.String())
+		} else {
+			m.err = errors.New("ssh sourceAddress requires the client ip address, but it is not available")
+		}
+	}
+	return m
+}
+
+// Modify implements SSHCertModifier and sets the source-address critical
+// option of an SSH user certificate.
+func (m *sshSourceAddressModifier) Modify(cert *ssh.Certificate, _ SignSSHOptions) error {
+	if cert.CertType != ssh.UserCert {
+		return nil
+	}
+	if m.err != nil {
+		return m.err
+	}
+	if cert.CriticalOptions == nil {
+		cert.CriticalOptions = make(map[string]string)
+	}
+	cert.CriticalOptions["source-address"] = strings.Join(m.addresses, ",")
+	return nil
+}
+
+// hasCertificateOptions returns true if critical options or extensions are
+// defined in the provisioner options.
+func (o *SSHOptions) hasCertificateOptions() bool {
+	return o != nil && (len(o.CriticalOptions) > 0 || len(o.Extensions) > 0 || len(o.PrincipalOptions) > 0)
+}
+
+// validateCertificateOptions returns an error if the critical options or
+// extensions are not valid.
+func (o *SSHOptions) validateCertificateOptions() error {
+	if o == nil {
+		return nil
+	}
+	validate := func(kind string, m map[string]string) error {
+		for name, text := range m {
+			if name == "" {
+				return errors.Errorf("ssh %s cannot contain an empty name", kind)
+			}
+			if _, err := parseSSHValueTemplate(name, text); err != nil {
+				return errors.Wrapf(err, "error parsing ssh %s %q template", kind, name)
+			}
+		}
+		return nil
+	}
+	if err := validate("criticalOptions", o.CriticalOptions); err != nil {
+		return err
+	}
+	if err := validate("extensions", o.Extensions); err != nil {
+		return err
+	}
+	for principal, po := range o.PrincipalOptions {
+		if principal == "" {
+			return errors.New("ssh principalOptions cannot contain an empty principal")
+		}
+		if po == nil {
+			continue
+		}
+		if err := validate("criticalOptions", po.CriticalOptions); err != nil {
+			return errors.Wrapf(err, "error validating ssh principalOptions %q", principal)
+		}
+		if err := validate("extensions", po.Extensions); err != nil {
+			return errors.Wrapf(err, "error validating ssh principalOptions %q", principal)
+		}
+	}
+	return nil
+}
+
+// sshCertificateOptionsOption returns an sshutil.Option that renders the
+// critical options and extensions of the provisioner and adds them to the
+// certificate created by the template. The options of a principal are only
+// added if the certificate contains that principal.
+func sshCertificateOptionsOption(opts *SSHOptions, data sshutil.TemplateData) sshutil.Option {
+	return func(_ sshutil.CertificateRequest, o *sshutil.Options) error {
+		if o.CertBuffer == nil {
+			return nil
+		}
+		var err error
+		o.CertBuffer, err = patchCertificateTemplate(o.CertBuffer, func(f templateFields) error {
+			return renderSSHCertificateOptions(f, opts, data)
+		})
+		return err
+	}
+}
+
+// renderSSHCertificateOptions renders the critical options and extensions of
+// the provisioner and the principals in the given certificate template fields.
+func renderSSHCertificateOptions(f templateFields, opts *SSHOptions, data sshutil.TemplateData) error {
+	var principals []string
+	criticalOptions := make(map[string]string)
+	extensions := make(map[string]string)
+	for key, dst := range map[string]any{
+		"principals":      &principals,
+		"criticalOptions": &criticalOptions,
+		"extensions":      &extensions,
+	} {
+		if err := f.get(key, dst); err != nil {
+			return err
+		}
+	}
+
+	render := func(dst, src map[string]string) error {
+		for name, text := range src {
+			tmpl, err := parseSSHValueTemplate(name, text)
+			if err != nil {
+				return &sshutil.TemplateError{Message: err.Error()}
+			}
+			buf := new(bytes.Buffer)
+			if err := tmpl.Execute(buf, data); err != nil {
+				return &sshutil.TemplateError{Message: err.Error()}
+			}
+			dst[name] = strings.TrimSpace(buf.String())
+		}
+		return nil
+	}
+	if err := render(criticalOptions, opts.CriticalOptions); err != nil {
+		return err
+	}
+	if err := render(extensions, opts.Extensions); err != nil {
+		return err
+	}
+	for _, p := range principals {
+		if po := opts.PrincipalOptions[p]; po != nil {
+			if err := render(criticalOptions, po.CriticalOptions); err != nil {
+				return err
+			}
+			if err := render(extensions, po.Extensions); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := f.set("criticalOptions", criticalOptions); err != nil {
+		return err
+	}
+	return f.set("extensions", extensions)
+}
+
+// sshKeyIDOption returns an sshutil.Option that renders the given key id
+// template and sets it in the certificate created by the template.
+func sshKeyIDOption(text string, data sshutil.TemplateData) sshutil.Option {
+	return func(_ sshutil.CertificateRequest, o *sshutil.Options) error {
+		if o.CertBuffer == nil {
+			return nil
+		}
+		tmpl, err := parseSSHKeyIDTemplate(text)
+		if err != nil {
+			return &sshutil.TemplateError{Message: err.Error()}
+		}
+		buf := new(bytes.Buffer)
+		if err := tmpl.Execute(buf, data); err != nil {
+			return &sshutil.TemplateError{Message: err.Error()}
+		}
+		keyID := strings.TrimSpace(buf.String())
+		if keyID == "" {
+			return &sshutil.TemplateError{Message: "ssh keyID template rendered an empty value"}
+		}
+
+		o.CertBuffer, err = patchCertificateTemplate(o.CertBuffer, func(f templateFields) error {
+			return f.set("keyId", keyID)
+		})
+		return err
+	}
+}
+
 // TemplateSSHOptions generates a SSHCertificateOptions with the template and
 // data defined in the ProvisionerOptions, the provisioner generated data, and
 // the user data provided in the request. If no template has been provided,
@@ -124,11 +563,18 @@ func CustomSSHTemplateOptions(o *Options, data sshutil.TemplateData, defaultTemp
 		}
 	}
 
-	return sshCertificateOptionsFunc(func(so SignSSHOptions) []sshutil.Option {
+	templateOptions := func(so SignSSHOptions) []sshutil.Option {
+		// Add the information of the host inventory.
+		if so.Host != nil {
+			data.Set(SSHHostTemplateDataKey, so.Host)
+		} else {
+			delete(data, SSHHostTemplateDataKey)
+		}
+
 		// We're not provided user data without custom templates.
 		if !opts.HasTemplate() {
 			return []sshutil.Option{
-				sshutil.WithTemplate(defaultTemplate, data),
+				sshTemplateOption(defaultTemplate, data, false),
 			}
 		}
 
@@ -145,7 +591,7 @@ func CustomSSHTemplateOptions(o *Options, data sshutil.TemplateData, defaultTemp
 		// Load a template from a file if Template is not defined.
 		if opts.Template == "" && opts.TemplateFile != "" {
 			return []sshutil.Option{
-				sshutil.WithTemplateFile(step.Abs(opts.TemplateFile), data),
+				sshTemplateFileOption(step.Abs(opts.TemplateFile), data, opts.EnableTemplateDNSLookups),
 			}
 		}
 
@@ -154,12 +600,78 @@ func CustomSSHTemplateOptions(o *Options, data sshutil.TemplateData, defaultTemp
 		template := strings.TrimSpace(opts.Template)
 		if strings.HasPrefix(template, "{") {
 			return []sshutil.Option{
-				sshutil.WithTemplate(template, data),
+				sshTemplateOption(template, data, opts.EnableTemplateDNSLookups),
 			}
 		}
 		// 2. As a base64 encoded JSON.
 		return []sshutil.Option{
-			sshutil.WithTemplateBase64(template, data),
+			sshTemplateBase64Option(template, data, opts.EnableTemplateDNSLookups),
+		}
+	}
+
+	return sshCertificateOptionsFunc(func(so SignSSHOptions) []sshutil.Option {
+		options := templateOptions(so)
+		if opts != nil && opts.KeyID != "" {
+			options = append(options, sshKeyIDOption(opts.KeyID, data))
+		}
+		if opts.hasCertificateOptions() {
+			options = append(options, sshCertificateOptionsOption(opts, data))
 		}
+		return options
 	}), nil
 }
+
+// SSHHostTemplateDataKey is the key used in the SSH certificate templates to
+// access the information of the host in the SSH host inventory, e.g.
+// {{ .Host.Groups }}. It is only available in host certificates of registered
+// hosts.
+const SSHHostTemplateDataKey = "Host"
+
+// SSHHostTemplateData is the information of a host in the SSH host inventory.
+// The groups can be used in the templates of registered hosts to add principals
+// to the certificate:
+//
+//	"principals": {{ toJson (concat .Principals .Host.Groups) }}
+type SSHHostTemplateData struct {
+	Hostname string            `json:"hostname"`
+	Tags     map[string]string `json:"tags,omitempty"`
+	Groups   []string          `json:"groups,omitempty"`
+}
+
+// SSHAuditTemplateDataKey is the key used in the SSH certificate templates to
+// access the audit metadata of the request, e.g. {{ .Audit.RequestID }}.
+//
+// The metadata can be embedded in a custom extension so session recording
+// systems can correlate connections with the issuance of the certificate:
+//
+//	"extensions": {
+//		"audit@smallstep.com": {{ toJson .Audit | toJson }}
+//	}
+const SSHAuditTemplateDataKey = "Audit"
+
+// SSHAuditMetadata is the audit metadata of an SSH certificate request. It is
+// available in the SSH certificate templates and it is added to the logs of
+// the request.
+type SSHAuditMetadata struct {
+	// RequestID is the id of the request that issued the certificate.
+	RequestID string `json:"requestID,omitempty"`
+	// Provisioner is the name of the provisioner that authorized the request.
+	Provisioner string `json:"provisioner"`
+	// Identity is the authenticated identity, e.g. the subject or email of a
+	// token, or the instance name of a cloud provisioner.
+	Identity string `json:"identity,omitempty"`
+}
+
+// newSSHAuditMetadata creates the audit metadata of the request and adds it
+// to the template data.
+func newSSHAuditMetadata(ctx context.Context, p Interface, identity string, data sshutil.TemplateData) *SSHAuditMetadata {
+	m := &SSHAuditMetadata{
+		Provisioner: p.GetName(),
+		Identity:    identity,
+	}
+	if requestID, ok := requestid.FromContext(ctx); ok {
+		m.RequestID = requestID
+	}
+	data.Set(SSHAuditTemplateDataKey, m)
+	return m
+}
@@ -104,3 +104,136 @@ func TestCustomSSHTemplateOptions(t *testing.T) {
 		})
 	}
 }
+
+func TestSSHUserPrincipalRule_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    *SSHUserPrincipalRule
+		wantErr bool
+	}{
+		{"ok", &SSHUserPrincipalRule{Identity: `(.+)@example\.com`, Principals: []string{"$1"}}, false},
+		{"fail nil", nil, true},
+		{"fail identity", &SSHUserPrincipalRule{Principals: []string{"$1"}}, true},
+		{"fail principals", &SSHUserPrincipalRule{Identity: `(.+)@example\.com`}, true},
+		{"fail regexp", &SSHUserPrincipalRule{Identity: `(.+@example\.com`, Principals: []string{"$1"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.rule.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("SSHUserPrincipalRule.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSSHOptions_allowedUserPrincipals(t *testing.T) {
+	o := &SSHOptions{
+		UserPrincipals: []*SSHUserPrincipalRule{
+			{Identity: `(?P<user>[a-z]+)\.(?P<last>[a-z]+)@example\.com`, Principals: []string{"${user}", "${user}_${last}"}},
+			{Identity: `.+@example\.com`, Principals: []string{"users"}},
+			{Identity: `example\.com`, Principals: []string{"never"}},
+		},
+	}
+	tests := []struct {
+		name     string
+		options  *SSHOptions
+		identity string
+		want     []string
+		wantOK   bool
+	}{
+		{"ok", o, "jane.doe@example.com", []string{"jane", "jane_doe", "users"}, true},
+		{"ok partial", o, "jane@example.com", []string{"users"}, true},
+		{"ok no match", o, "jane@example.org", nil, true},
+		{"ok anchored", o, "jane.doe@example.com.evil.org", nil, true},
+		{"nil", nil, "jane@example.com", nil, false},
+		{"empty", &SSHOptions{}, "jane@example.com", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.options.allowedUserPrincipals(tt.identity)
+			if !reflect.DeepEqual(got, tt.want) || ok != tt.wantOK {
+				t.Errorf("SSHOptions.allowedUserPrincipals() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestSSHOptions_validateUserPrincipals(t *testing.T) {
+	rules := []*SSHUserPrincipalRule{{Identity: `(.+)@example\.com`, Principals: []string{"$1"}}}
+	tests := []struct {
+		name    string
+		options *SSHOptions
+		typ     Type
+		wantErr bool
+	}{
+		{"ok jwk", &SSHOptions{UserPrincipals: rules}, TypeJWK, false},
+		{"ok oidc", &SSHOptions{UserPrincipals: rules}, TypeOIDC, false},
+		{"ok nil", nil, TypeX5C, false},
+		{"ok empty", &SSHOptions{}, TypeX5C, false},
+		{"fail x5c", &SSHOptions{UserPrincipals: rules}, TypeX5C, true},
+		{"fail sshpop", &SSHOptions{UserPrincipals: rules}, TypeSSHPOP, true},
+		{"fail rule", &SSHOptions{UserPrincipals: []*SSHUserPrincipalRule{{Identity: `(.+`, Principals: []string{"$1"}}}}, TypeJWK, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.options.validateUserPrincipals(tt.typ)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("SSHOptions.validateUserPrincipals() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && tt.options != nil {
+				for _, r := range tt.options.UserPrincipals {
+					if r.re == nil {
+						t.Errorf("SSHOptions.validateUserPrincipals() did not compile %q", r.Identity)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestSSHOptions_validateSourceAddress(t *testing.T) {
+	sa := &SSHSourceAddress{ClientIP: true}
+	tests := []struct {
+		name    string
+		options *SSHOptions
+		typ     Type
+		wantErr bool
+	}{
+		{"ok jwk", &SSHOptions{SourceAddress: sa}, TypeJWK, false},
+		{"ok plugin", &SSHOptions{SourceAddress: sa}, TypePlugin, false},
+		{"ok nil", nil, TypeAWS, false},
+		{"ok empty", &SSHOptions{}, TypeAWS, false},
+		{"fail aws", &SSHOptions{SourceAddress: sa}, TypeAWS, true},
+		{"fail nebula", &SSHOptions{SourceAddress: sa}, TypeNebula, true},
+		{"fail invalid", &SSHOptions{SourceAddress: &SSHSourceAddress{}}, TypeJWK, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.options.validateSourceAddress(tt.typ); (err != nil) != tt.wantErr {
+				t.Errorf("SSHOptions.validateSourceAddress() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSSHSourceAddress_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		sa      *SSHSourceAddress
+		wantErr bool
+	}{
+		{"ok nil", nil, false},
+		{"ok clientIP", &SSHSourceAddress{ClientIP: true}, false},
+		{"ok cidrs", &SSHSourceAddress{CIDRs: []string{"10.0.0.0/8", "192.168.1.1", "2001:db8::/32"}}, false},
+		{"fail empty", &SSHSourceAddress{}, true},
+		{"fail cidr", &SSHSourceAddress{CIDRs: []string{"10.0.0.0/33"}}, true},
+		{"fail address", &SSHSourceAddress{ClientIP: true, CIDRs: []string{"example.com"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.sa.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("SSHSourceAddress.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
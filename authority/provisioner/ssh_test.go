@@ -71,6 +71,8 @@ func signSSHCertificate(key crypto.PublicKey, opts SignSSHOptions, signOpts []Si
 			}
 		// call webhooks
 		case *WebhookController:
+		// audit metadata
+		case *SSHAuditMetadata:
 		default:
 			return nil, fmt.Errorf("signSSH: invalid extra option type %T", o)
 		}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/base64"
 	"net/http"
+	"slices"
 	"strconv"
 	"time"
 
@@ -11,6 +12,7 @@ import (
 	"golang.org/x/crypto/ssh"
 
 	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/sshutil"
 
 	"github.com/smallstep/certificates/errs"
 )
@@ -27,14 +29,43 @@ type sshPOPPayload struct {
 // signature requests.
 type SSHPOP struct {
 	*base
-	ID         string  `json:"-"`
-	Type       string  `json:"type"`
-	Name       string  `json:"name"`
-	Claims     *Claims `json:"claims,omitempty"`
+	ID     string  `json:"-"`
+	Type   string  `json:"type"`
+	Name   string  `json:"name"`
+	Claims *Claims `json:"claims,omitempty"`
+	// Delegation allows hosts with a valid SSH host certificate to request SSH
+	// user certificates for a restricted set of principals.
+	Delegation *SSHPOPDelegation `json:"delegation,omitempty"`
 	ctl        *Controller
 	sshPubKeys *SSHKeys
 }
 
+// SSHPOPDelegation contains the restrictions of the SSH user certificates
+// requested by a host, e.g. a bastion that requests certificates on behalf of
+// its users. The duration of the certificates is controlled by the SSH user
+// claims of the provisioner, and it should be short.
+type SSHPOPDelegation struct {
+	// Principals is the list of principals allowed in the user certificates.
+	Principals []string `json:"principals"`
+	// Hosts, if set, is the list of host principals allowed to request user
+	// certificates. All the hosts are allowed by default.
+	Hosts []string `json:"hosts,omitempty"`
+}
+
+// isHostAllowed returns true if one of the principals of the host certificate
+// is allowed to delegate.
+func (d *SSHPOPDelegation) isHostAllowed(principals []string) bool {
+	if len(d.Hosts) == 0 {
+		return true
+	}
+	for _, p := range principals {
+		if slices.Contains(d.Hosts, p) {
+			return true
+		}
+	}
+	return false
+}
+
 // GetID returns the provisioner unique identifier. The name and credential id
 // should uniquely identify any SSH-POP provisioner.
 func (p *SSHPOP) GetID() string {
@@ -94,6 +125,10 @@ func (p *SSHPOP) Init(config Config) (err error) {
 		return errors.New("provisioner public SSH validation keys cannot be empty")
 	}
 
+	if p.Delegation != nil && len(p.Delegation.Principals) == 0 {
+		return errors.New("provisioner delegation principals cannot be empty")
+	}
+
 	p.sshPubKeys = config.SSHKeys
 
 	config.Audiences = config.Audiences.WithFragment(p.GetIDForToken())
@@ -185,6 +220,93 @@ func (p *SSHPOP) authorizeToken(token string, audiences []string, checkValidity
 	return &claims, nil
 }
 
+// AuthorizeSSHSign validates a delegation token signed by the key of an SSH
+// host certificate, and returns the options to sign an SSH user certificate
+// with the principals in the token. The principals must be allowed by the
+// delegation configuration of the provisioner.
+func (p *SSHPOP) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption, error) {
+	// Without delegation the method is not implemented.
+	if p.Delegation == nil {
+		return p.base.AuthorizeSSHSign(ctx, token)
+	}
+	if !p.ctl.Claimer.IsSSHCAEnabled() {
+		return nil, errs.Unauthorized("sshpop.AuthorizeSSHSign; sshCA is disabled for sshpop provisioner '%s'", p.GetName())
+	}
+	claims, err := p.authorizeToken(token, p.ctl.Audiences.SSHSign, true)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "sshpop.AuthorizeSSHSign")
+	}
+	if claims.sshCert.CertType != ssh.HostCert {
+		return nil, errs.BadRequest("sshpop certificate must be a host ssh certificate")
+	}
+	if !p.Delegation.isHostAllowed(claims.sshCert.ValidPrincipals) {
+		return nil, errs.Forbidden("sshpop.AuthorizeSSHSign; host %v is not allowed to request user certificates", claims.sshCert.ValidPrincipals)
+	}
+	if claims.Step == nil || claims.Step.SSH == nil {
+		return nil, errs.Unauthorized("sshpop.AuthorizeSSHSign; sshpop token must be an SSH provisioning token")
+	}
+
+	opts := claims.Step.SSH
+	if opts.CertType != "" && opts.CertType != SSHUserCert {
+		return nil, errs.Forbidden("sshpop.AuthorizeSSHSign; sshpop delegation only allows user certificates")
+	}
+	if len(opts.Principals) == 0 {
+		return nil, errs.Forbidden("sshpop.AuthorizeSSHSign; sshpop token principals cannot be empty")
+	}
+	for _, principal := range opts.Principals {
+		if !slices.Contains(p.Delegation.Principals, principal) {
+			return nil, errs.Forbidden("sshpop.AuthorizeSSHSign; principal '%s' is not allowed", principal)
+		}
+	}
+	keyID := claims.Subject
+	if opts.KeyID != "" {
+		keyID = opts.KeyID
+	}
+
+	// Certificate templates.
+	data := sshutil.CreateTemplateData(sshutil.UserCert, keyID, opts.Principals)
+	if v, err := unsafeParseSigned(token); err == nil {
+		data.SetToken(v)
+	}
+	audit := newSSHAuditMetadata(ctx, p, claims.Subject, data)
+	templateOptions, err := TemplateSSHOptions(nil, data)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "sshpop.AuthorizeSSHSign")
+	}
+
+	signOptions := []SignOption{
+		templateOptions,
+		audit,
+		// validates user's SignSSHOptions with the ones in the token
+		sshCertOptionsValidator(SignSSHOptions{
+			CertType:   SSHUserCert,
+			KeyID:      keyID,
+			Principals: opts.Principals,
+		}),
+	}
+
+	// Add modifiers from custom claims
+	t := now()
+	if !opts.ValidAfter.IsZero() {
+		signOptions = append(signOptions, sshCertValidAfterModifier(opts.ValidAfter.RelativeTime(t).Unix()))
+	}
+	if !opts.ValidBefore.IsZero() {
+		signOptions = append(signOptions, sshCertValidBeforeModifier(opts.ValidBefore.RelativeTime(t).Unix()))
+	}
+
+	return append(signOptions,
+		p,
+		// Set the validity bounds if not set.
+		&sshDefaultDuration{p.ctl.Claimer},
+		// Validate public key
+		&sshDefaultPublicKeyValidator{},
+		// Validate the validity period.
+		&sshCertValidityValidator{p.ctl.Claimer},
+		// Require and validate all the default fields in the SSH certificate.
+		&sshCertDefaultValidator{},
+	), nil
+}
+
 // AuthorizeSSHRevoke validates the authorization token and extracts/validates
 // the SSH certificate from the ssh-pop header.
 func (p *SSHPOP) AuthorizeSSHRevoke(_ context.Context, token string) error {
@@ -586,3 +586,98 @@ func TestSSHPOP_ExtractSSHPOPCert(t *testing.T) {
 		})
 	}
 }
+
+func generateSSHPOPDelegationToken(p Interface, cert *ssh.Certificate, jwk *jose.JSONWebKey, sshOpts *SignSSHOptions) (string, error) {
+	so := new(jose.SignerOptions)
+	so.WithType("JWT")
+	so.WithHeader("sshpop", base64.StdEncoding.EncodeToString(cert.Marshal()))
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: jwk.Key}, so)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	return jose.Signed(sig).Claims(sshPOPPayload{
+		Claims: jose.Claims{
+			ID:        "the-jti",
+			Subject:   "alice@example.com",
+			Issuer:    p.GetName(),
+			IssuedAt:  jose.NewNumericDate(now),
+			NotBefore: jose.NewNumericDate(now),
+			Expiry:    jose.NewNumericDate(now.Add(5 * time.Minute)),
+			Audience:  []string{testAudiences.SSHSign[0]},
+		},
+		Step: &stepPayload{SSH: sshOpts},
+	}).CompactSerialize()
+}
+
+func TestSSHPOP_AuthorizeSSHSign(t *testing.T) {
+	key, err := pemutil.Read("./testdata/secrets/ssh_user_ca_key")
+	assert.FatalError(t, err)
+	userSigner, ok := key.(crypto.Signer)
+	assert.Fatal(t, ok, "could not cast ssh user signing key to crypto signer")
+	sshUserSigner, err := ssh.NewSignerFromSigner(userSigner)
+	assert.FatalError(t, err)
+
+	hostKey, err := pemutil.Read("./testdata/secrets/ssh_host_ca_key")
+	assert.FatalError(t, err)
+	hostSigner, ok := hostKey.(crypto.Signer)
+	assert.Fatal(t, ok, "could not cast ssh host signing key to crypto signer")
+	sshHostSigner, err := ssh.NewSignerFromSigner(hostSigner)
+	assert.FatalError(t, err)
+
+	newSSHPOP := func(t *testing.T, d *SSHPOPDelegation) *SSHPOP {
+		p, err := generateSSHPOP()
+		assert.FatalError(t, err)
+		p.Delegation = d
+		return p
+	}
+	delegation := &SSHPOPDelegation{Principals: []string{"alice", "bob"}, Hosts: []string{"bastion.example.com"}}
+	hostCert, hostJWK, err := createSSHCert(&ssh.Certificate{Serial: 1234, CertType: ssh.HostCert, ValidPrincipals: []string{"bastion.example.com"}}, sshHostSigner)
+	assert.FatalError(t, err)
+	otherCert, otherJWK, err := createSSHCert(&ssh.Certificate{Serial: 1235, CertType: ssh.HostCert, ValidPrincipals: []string{"web.example.com"}}, sshHostSigner)
+	assert.FatalError(t, err)
+	userCert, userJWK, err := createSSHCert(&ssh.Certificate{Serial: 1236, CertType: ssh.UserCert, ValidPrincipals: []string{"alice"}}, sshUserSigner)
+	assert.FatalError(t, err)
+
+	type test struct {
+		p       *SSHPOP
+		cert    *ssh.Certificate
+		jwk     *jose.JSONWebKey
+		sshOpts *SignSSHOptions
+		code    int
+	}
+	tests := map[string]test{
+		"ok":                  {newSSHPOP(t, delegation), hostCert, hostJWK, &SignSSHOptions{Principals: []string{"alice"}}, 0},
+		"ok all hosts":        {newSSHPOP(t, &SSHPOPDelegation{Principals: []string{"alice"}}), otherCert, otherJWK, &SignSSHOptions{CertType: "user", Principals: []string{"alice"}}, 0},
+		"fail no delegation":  {newSSHPOP(t, nil), hostCert, hostJWK, &SignSSHOptions{Principals: []string{"alice"}}, http.StatusUnauthorized},
+		"fail user cert":      {newSSHPOP(t, delegation), userCert, userJWK, &SignSSHOptions{Principals: []string{"alice"}}, http.StatusBadRequest},
+		"fail host":           {newSSHPOP(t, delegation), otherCert, otherJWK, &SignSSHOptions{Principals: []string{"alice"}}, http.StatusForbidden},
+		"fail no options":     {newSSHPOP(t, delegation), hostCert, hostJWK, nil, http.StatusUnauthorized},
+		"fail host cert type": {newSSHPOP(t, delegation), hostCert, hostJWK, &SignSSHOptions{CertType: "host", Principals: []string{"alice"}}, http.StatusForbidden},
+		"fail no principals":  {newSSHPOP(t, delegation), hostCert, hostJWK, &SignSSHOptions{}, http.StatusForbidden},
+		"fail principal":      {newSSHPOP(t, delegation), hostCert, hostJWK, &SignSSHOptions{Principals: []string{"alice", "root"}}, http.StatusForbidden},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			tok, err := generateSSHPOPDelegationToken(tc.p, tc.cert, tc.jwk, tc.sshOpts)
+			assert.FatalError(t, err)
+			opts, err := tc.p.AuthorizeSSHSign(context.Background(), tok)
+			if tc.code != 0 {
+				var sc render.StatusCodedError
+				if assert.True(t, errors.As(err, &sc), "error does not implement StatusCodedError interface") {
+					assert.Equals(t, tc.code, sc.StatusCode())
+				}
+				return
+			}
+			assert.FatalError(t, err)
+			var found bool
+			for _, o := range opts {
+				if v, ok := o.(sshCertOptionsValidator); ok {
+					found = true
+					assert.Equals(t, SignSSHOptions{CertType: "user", KeyID: "alice@example.com", Principals: tc.sshOpts.Principals}, SignSSHOptions(v))
+				}
+			}
+			assert.True(t, found)
+		})
+	}
+}
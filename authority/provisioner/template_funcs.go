@@ -0,0 +1,344 @@
+package provisioner
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.step.sm/crypto/sshutil"
+	"go.step.sm/crypto/x509util"
+)
+
+// templateDNSLookupTimeout is the maximum time a DNS lookup in a template can
+// take.
+const templateDNSLookupTimeout = 5 * time.Second
+
+// templateResolver is the resolver used in the DNS lookup functions of the
+// templates.
+var templateResolver = net.DefaultResolver
+
+// extendFuncMap adds the functions of the provisioner templates to the given
+// function map:
+//
+//   - cidrContains: returns true if a CIDR contains an IP, e.g.
+//     {{ cidrContains "10.0.0.0/8" .Insecure.CR.IPAddresses.0 }}.
+//   - lookupHost, lookupAddr: resolve a host name or an IP address. They're
+//     only available if enableDNSLookups is true.
+//   - sha384sum, sha512sum: return the hex encoded hash of a string.
+//   - hmacSHA256, hmacSHA512: return the hex encoded HMAC of a string with the
+//     given key, e.g. {{ hmacSHA256 "key" .Subject.CommonName }}.
+//   - hexEnc, hexDec, b64urlEnc, b64urlDec: hex and base64url encoding.
+//   - regexCapture, regexCaptureNamed: return the groups of the first match of
+//     a regular expression as a list or as a map using the group names.
+//   - jsonPath: returns the value on a path like "webhooks.name.groups[0]".
+//
+// The fail function is replaced so the message is set in failMessage.
+func extendFuncMap(m template.FuncMap, failMessage *string, enableDNSLookups bool) template.FuncMap {
+	m["fail"] = func(msg string) (string, error) {
+		*failMessage = msg
+		return "", errors.New(msg)
+	}
+	m["cidrContains"] = cidrContains
+	m["lookupHost"] = func(host string) ([]string, error) {
+		if !enableDNSLookups {
+			return nil, errors.New("lookupHost is not enabled in the provisioner")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), templateDNSLookupTimeout)
+		defer cancel()
+		return templateResolver.LookupHost(ctx, host)
+	}
+	m["lookupAddr"] = func(addr string) ([]string, error) {
+		if !enableDNSLookups {
+			return nil, errors.New("lookupAddr is not enabled in the provisioner")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), templateDNSLookupTimeout)
+		defer cancel()
+		names, err := templateResolver.LookupAddr(ctx, addr)
+		for i := range names {
+			names[i] = strings.TrimSuffix(names[i], ".")
+		}
+		return names, err
+	}
+	m["sha384sum"] = func(s string) string {
+		sum := sha512.Sum384([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+	m["sha512sum"] = func(s string) string {
+		sum := sha512.Sum512([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+	m["hmacSHA256"] = func(key, s string) string {
+		return hmacSum(sha256.New, key, s)
+	}
+	m["hmacSHA512"] = func(key, s string) string {
+		return hmacSum(sha512.New, key, s)
+	}
+	m["hexEnc"] = func(s string) string {
+		return hex.EncodeToString([]byte(s))
+	}
+	m["hexDec"] = func(s string) (string, error) {
+		b, err := hex.DecodeString(s)
+		return string(b), err
+	}
+	m["b64urlEnc"] = func(s string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(s))
+	}
+	m["b64urlDec"] = func(s string) (string, error) {
+		b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+		return string(b), err
+	}
+	m["regexCapture"] = regexCapture
+	m["regexCaptureNamed"] = regexCaptureNamed
+	m["jsonPath"] = jsonPath
+	return m
+}
+
+// x509FuncMap returns the functions available in the X.509 templates.
+func x509FuncMap(failMessage *string, enableDNSLookups bool) template.FuncMap {
+	return extendFuncMap(x509util.GetFuncMap(), failMessage, enableDNSLookups)
+}
+
+// sshFuncMap returns the functions available in the SSH templates.
+func sshFuncMap(failMessage *string, enableDNSLookups bool) template.FuncMap {
+	return extendFuncMap(sshutil.GetFuncMap(), failMessage, enableDNSLookups)
+}
+
+func cidrContains(cidr string, ip interface{}) (bool, error) {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return false, errors.Wrapf(err, "cidrContains: invalid cidr %q", cidr)
+	}
+	var addr net.IP
+	switch v := ip.(type) {
+	case net.IP:
+		addr = v
+	case string:
+		addr = net.ParseIP(v)
+	default:
+		addr = net.ParseIP(fmt.Sprint(v))
+	}
+	if addr == nil {
+		return false, errors.Errorf("cidrContains: invalid ip %v", ip)
+	}
+	return ipNet.Contains(addr), nil
+}
+
+func hmacSum(h func() hash.Hash, key, s string) string {
+	mac := hmac.New(h, []byte(key))
+	mac.Write([]byte(s))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func regexCapture(regex, s string) ([]string, error) {
+	re, err := regexp.Compile(regex)
+	if err != nil {
+		return nil, err
+	}
+	return re.FindStringSubmatch(s), nil
+}
+
+func regexCaptureNamed(regex, s string) (map[string]string, error) {
+	re, err := regexp.Compile(regex)
+	if err != nil {
+		return nil, err
+	}
+	groups := make(map[string]string)
+	match := re.FindStringSubmatch(s)
+	if match == nil {
+		return groups, nil
+	}
+	for i, name := range re.SubexpNames() {
+		if i > 0 && name != "" {
+			groups[name] = match[i]
+		}
+	}
+	return groups, nil
+}
+
+// jsonPath returns the value on the given path of a JSON like value, e.g. the
+// webhook data. The path is a list of keys separated by dots, with optional
+// array indexes, e.g. "$.webhooks.people.groups[0]" or "groups.0".
+func jsonPath(path string, data interface{}) (interface{}, error) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	path = strings.NewReplacer("[", ".", "]", "").Replace(path)
+	if path == "" {
+		return data, nil
+	}
+
+	v := data
+	for _, key := range strings.Split(path, ".") {
+		switch vv := v.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if v, ok = vv[key]; !ok {
+				return nil, errors.Errorf("jsonPath: key %q not found in %q", key, path)
+			}
+		case x509util.TemplateData:
+			var ok bool
+			if v, ok = vv[key]; !ok {
+				return nil, errors.Errorf("jsonPath: key %q not found in %q", key, path)
+			}
+		case sshutil.TemplateData:
+			var ok bool
+			if v, ok = vv[key]; !ok {
+				return nil, errors.Errorf("jsonPath: key %q not found in %q", key, path)
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(vv) {
+				return nil, errors.Errorf("jsonPath: invalid index %q in %q", key, path)
+			}
+			v = vv[i]
+		default:
+			return nil, errors.Errorf("jsonPath: cannot find %q in %q", key, path)
+		}
+	}
+	return v, nil
+}
+
+// ValidateX509Template returns an error if an X.509 certificate template
+// cannot be parsed with the functions available in the provisioner templates.
+func ValidateX509Template(text []byte) error {
+	return validateTemplate(text, x509FuncMap(new(string), false))
+}
+
+// ValidateSSHTemplate returns an error if an SSH certificate template cannot be
+// parsed with the functions available in the provisioner templates.
+func ValidateSSHTemplate(text []byte) error {
+	return validateTemplate(text, sshFuncMap(new(string), false))
+}
+
+func validateTemplate(text []byte, funcMap template.FuncMap) error {
+	if len(text) == 0 {
+		return nil
+	}
+	if _, err := template.New("template").Funcs(funcMap).Parse(string(text)); err != nil {
+		return fmt.Errorf("error parsing template: %w", err)
+	}
+	return nil
+}
+
+// X509TemplateOption returns an x509util.Option that executes an X.509
+// template with the same functions available in the provisioner templates. The
+// DNS lookup functions are disabled.
+func X509TemplateOption(text string, data x509util.TemplateData) x509util.Option {
+	return x509TemplateOption(text, data, false)
+}
+
+// SSHTemplateOption returns an sshutil.Option that executes an SSH template
+// with the same functions available in the provisioner templates. The DNS
+// lookup functions are disabled.
+func SSHTemplateOption(text string, data sshutil.TemplateData) sshutil.Option {
+	return sshTemplateOption(text, data, false)
+}
+
+// x509TemplateOption returns a x509util.Option that executes the given template
+// with the given data, like x509util.WithTemplate, but using the functions
+// returned by x509FuncMap.
+func x509TemplateOption(text string, data x509util.TemplateData, enableDNSLookups bool) x509util.Option {
+	return func(cr *x509.CertificateRequest, o *x509util.Options) error {
+		terr := new(x509util.TemplateError)
+		tmpl, err := template.New("template").Funcs(x509FuncMap(&terr.Message, enableDNSLookups)).Parse(text)
+		if err != nil {
+			return errors.Wrapf(err, "error parsing template")
+		}
+
+		buf := new(bytes.Buffer)
+		data.SetCertificateRequest(cr)
+		if err := tmpl.Execute(buf, data); err != nil {
+			if terr.Message != "" {
+				return terr
+			}
+			return errors.Wrapf(err, "error executing template")
+		}
+		o.CertBuffer = buf
+		return nil
+	}
+}
+
+// x509TemplateFileOption is like x509util.WithTemplateFile but using the
+// functions returned by x509FuncMap.
+func x509TemplateFileOption(path string, data x509util.TemplateData, enableDNSLookups bool) x509util.Option {
+	return func(cr *x509.CertificateRequest, o *x509util.Options) error {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return errors.Wrapf(err, "error reading %s", path)
+		}
+		return x509TemplateOption(string(b), data, enableDNSLookups)(cr, o)
+	}
+}
+
+// x509TemplateBase64Option is like x509util.WithTemplateBase64 but using the
+// functions returned by x509FuncMap.
+func x509TemplateBase64Option(s string, data x509util.TemplateData, enableDNSLookups bool) x509util.Option {
+	return func(cr *x509.CertificateRequest, o *x509util.Options) error {
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return errors.Wrap(err, "error decoding template")
+		}
+		return x509TemplateOption(string(b), data, enableDNSLookups)(cr, o)
+	}
+}
+
+// sshTemplateOption returns a sshutil.Option that executes the given template
+// with the given data, like sshutil.WithTemplate, but using the functions
+// returned by sshFuncMap.
+func sshTemplateOption(text string, data sshutil.TemplateData, enableDNSLookups bool) sshutil.Option {
+	return func(cr sshutil.CertificateRequest, o *sshutil.Options) error {
+		terr := new(sshutil.TemplateError)
+		tmpl, err := template.New("template").Funcs(sshFuncMap(&terr.Message, enableDNSLookups)).Parse(text)
+		if err != nil {
+			return errors.Wrapf(err, "error parsing template")
+		}
+
+		buf := new(bytes.Buffer)
+		data.SetCertificateRequest(cr)
+		if err := tmpl.Execute(buf, data); err != nil {
+			if terr.Message != "" {
+				return terr
+			}
+			return errors.Wrapf(err, "error executing template")
+		}
+		o.CertBuffer = buf
+		return nil
+	}
+}
+
+// sshTemplateFileOption is like sshutil.WithTemplateFile but using the
+// functions returned by sshFuncMap.
+func sshTemplateFileOption(path string, data sshutil.TemplateData, enableDNSLookups bool) sshutil.Option {
+	return func(cr sshutil.CertificateRequest, o *sshutil.Options) error {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return errors.Wrapf(err, "error reading %s", path)
+		}
+		return sshTemplateOption(string(b), data, enableDNSLookups)(cr, o)
+	}
+}
+
+// sshTemplateBase64Option is like sshutil.WithTemplateBase64 but using the
+// functions returned by sshFuncMap.
+func sshTemplateBase64Option(s string, data sshutil.TemplateData, enableDNSLookups bool) sshutil.Option {
+	return func(cr sshutil.CertificateRequest, o *sshutil.Options) error {
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return errors.Wrap(err, "error decoding template")
+		}
+		return sshTemplateOption(string(b), data, enableDNSLookups)(cr, o)
+	}
+}
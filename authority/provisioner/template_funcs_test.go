@@ -0,0 +1,101 @@
+package provisioner
+
+import (
+	"bytes"
+	"crypto/x509"
+	"net"
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/x509util"
+)
+
+func Test_extendFuncMap(t *testing.T) {
+	data := map[string]interface{}{
+		"IP":   net.ParseIP("10.1.2.3"),
+		"Name": "web-prod-12.us-east-1.example.com",
+		"Webhooks": map[string]interface{}{
+			"people": map[string]interface{}{
+				"groups": []interface{}{"admins", "developers"},
+			},
+		},
+	}
+	tests := []struct {
+		name     string
+		text     string
+		want     string
+		wantErr  bool
+		lookups  bool
+		wantFail string
+	}{
+		{"cidrContains", `{{ cidrContains "10.0.0.0/8" .IP }} {{ cidrContains "192.168.0.0/16" "10.1.2.3" }}`, "true false", false, false, ""},
+		{"cidrContains invalid", `{{ cidrContains "10.0.0.0" .IP }}`, "", true, false, ""},
+		{"sha512sum", `{{ "foo" | sha384sum | trunc 8 }} {{ "foo" | sha512sum | trunc 8 }}`, "98c11ffd f7fbba6e", false, false, ""},
+		{"hmacSHA256", `{{ "foo" | hmacSHA256 "key" }}`, "6ea1d9f5e93a8f3ade026261ffe5d72a1c90804ed94404a69892a163b8a35497", false, false, ""},
+		{"hex", `{{ "foo" | hexEnc }} {{ "666f6f" | hexDec }}`, "666f6f foo", false, false, ""},
+		{"b64url", `{{ "foo?" | b64urlEnc }} {{ "Zm9vPw==" | b64urlDec }}`, "Zm9vPw foo?", false, false, ""},
+		{"regexCapture", `{{ index (regexCapture "^([a-z]+)-prod-(\\d+)" .Name) 2 }}`, "12", false, false, ""},
+		{"regexCaptureNamed", `{{ (regexCaptureNamed "^(?P<role>[a-z]+)-[a-z]+-\\d+\\.(?P<region>[a-z0-9-]+)\\." .Name).region }}`, "us-east-1", false, false, ""},
+		{"jsonPath", `{{ jsonPath "$.Webhooks.people.groups[1]" . }} {{ jsonPath "Webhooks.people.groups.0" . }}`, "developers admins", false, false, ""},
+		{"jsonPath missing", `{{ jsonPath "Webhooks.email" . }}`, "", true, false, ""},
+		{"lookupHost disabled", `{{ lookupHost "localhost" }}`, "", true, false, ""},
+		{"fail", `{{ fail "not allowed" }}`, "", true, false, "not allowed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var failMessage string
+			tmpl, err := template.New(tt.name).Funcs(x509FuncMap(&failMessage, tt.lookups)).Parse(tt.text)
+			require.NoError(t, err)
+			buf := new(bytes.Buffer)
+			err = tmpl.Execute(buf, data)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Equal(t, tt.wantFail, failMessage)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, buf.String())
+		})
+	}
+}
+
+func TestValidateX509Template(t *testing.T) {
+	assert.NoError(t, ValidateX509Template(nil))
+	assert.NoError(t, ValidateX509Template([]byte(`{"subject": {{ toJson (jsonPath "Webhooks.people.name" .) }}}`)))
+	assert.NoError(t, ValidateSSHTemplate([]byte(`{"keyId": {{ toJson (.Token.email | hmacSHA256 "key") }}}`)))
+	assert.Error(t, ValidateX509Template([]byte(`{"subject": {{ toJson (foo .Token) }}}`)))
+	assert.Error(t, ValidateSSHTemplate([]byte(`{"keyId": {{ toJson .Token.email }`)))
+}
+
+func Test_x509TemplateOption(t *testing.T) {
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	csr, err := x509util.CreateCertificateRequest("foo", []string{"foo.internal", "10.1.2.3"}, signer)
+	require.NoError(t, err)
+
+	data := x509util.CreateTemplateData("foo", []string{"foo.internal", "10.1.2.3"})
+	text := `{
+	"subject": {"commonName": {{ toJson .Subject.CommonName }}, "organizationalUnit": {{ toJson (.Subject.CommonName | sha512sum | trunc 8) }}},
+	"sans": {{ toJson .SANs }}
+	{{- if not (cidrContains "10.0.0.0/8" (index .Insecure.CR.IPAddresses 0)) }}{{ fail "ip not allowed" }}{{ end }}
+}`
+	cert, err := x509util.NewCertificate(csr, x509TemplateOption(text, data, false))
+	require.NoError(t, err)
+	c := cert.GetCertificate()
+	assert.Equal(t, "foo", c.Subject.CommonName)
+	assert.Equal(t, []string{"f7fbba6e"}, c.Subject.OrganizationalUnit)
+	assert.Equal(t, []string{"foo.internal"}, c.DNSNames)
+
+	csr.IPAddresses = []net.IP{net.ParseIP("192.168.1.1")}
+	_, err = x509util.NewCertificate(csr, x509TemplateOption(text, data, false))
+	var terr *x509util.TemplateError
+	if assert.ErrorAs(t, err, &terr) {
+		assert.Equal(t, "ip not allowed", terr.Message)
+	}
+
+	_, err = x509util.NewCertificate(&x509.CertificateRequest{}, x509TemplateBase64Option("not-base64", data, false))
+	assert.Error(t, err)
+}
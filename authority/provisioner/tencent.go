@@ -0,0 +1,497 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/sshutil"
+	"go.step.sm/crypto/x509util"
+	"go.step.sm/linkedca"
+
+	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/certificates/webhook"
+)
+
+// tencentIssuer is the string used as issuer in the generated tokens.
+const tencentIssuer = "cvm.tencentcloudapi.com"
+
+// tencentIdentityURL is the url used to retrieve the instance identity
+// document.
+const tencentIdentityURL = "http://metadata.tencentyun.com/latest/dynamic/instance-identity/document"
+
+// tencentSignatureURL is the url used to retrieve the PKCS #7 signature of the
+// instance identity document.
+const tencentSignatureURL = "http://metadata.tencentyun.com/latest/dynamic/instance-identity/pkcs7"
+
+type tencentConfig struct {
+	identityURL  string
+	signatureURL string
+	certificates []*x509.Certificate
+}
+
+func newTencentConfig() *tencentConfig {
+	return &tencentConfig{
+		identityURL:  tencentIdentityURL,
+		signatureURL: tencentSignatureURL,
+	}
+}
+
+type tencentPayload struct {
+	jose.Claims
+	Tencent  tencentIdentityPayload `json:"tencent"`
+	document tencentInstanceIdentityDocument
+}
+
+type tencentIdentityPayload struct {
+	Document []byte `json:"document,omitempty"`
+	PKCS7    []byte `json:"pkcs7"`
+}
+
+type tencentInstanceIdentityDocument struct {
+	AccountID    string    `json:"accountId"`
+	AppID        string    `json:"appId"`
+	InstanceID   string    `json:"instanceId"`
+	InstanceType string    `json:"instanceType"`
+	ImageID      string    `json:"imageId"`
+	Region       string    `json:"region"`
+	Zone         string    `json:"zone"`
+	PrivateIP    string    `json:"privateIp"`
+	PendingTime  time.Time `json:"pendingTime"`
+}
+
+// Tencent is the provisioner that supports identity tokens created from the
+// Tencent Cloud CVM instance identity documents. The documents are signed by
+// Tencent Cloud with PKCS #7, and the signature is verified with the
+// certificates in IIDRoots.
+//
+// If DisableCustomSANs is true, only the private IP will be added as a SAN. By
+// default it will accept any SAN in the CSR.
+//
+// If DisableTrustOnFirstUse is true, multiple sign request for this provisioner
+// with the same instance will be accepted. By default only the first request
+// will be accepted.
+//
+// If InstanceAge is set, only the instances with a pendingTime within the given
+// period will be accepted. The token is bound to the signature of the identity
+// document, so InstanceAge limits the time in which a leaked document can be
+// used to get certificates.
+//
+// Accounts restricts the accounts of the instances allowed.
+type Tencent struct {
+	*base
+	ID                     string   `json:"-"`
+	Type                   string   `json:"type"`
+	Name                   string   `json:"name"`
+	Accounts               []string `json:"accounts"`
+	DisableCustomSANs      bool     `json:"disableCustomSANs"`
+	DisableTrustOnFirstUse bool     `json:"disableTrustOnFirstUse"`
+	InstanceAge            Duration `json:"instanceAge,omitempty"`
+	IIDRoots               string   `json:"iidRoots"`
+	Claims                 *Claims  `json:"claims,omitempty"`
+	Options                *Options `json:"options,omitempty"`
+	config                 *tencentConfig
+	ctl                    *Controller
+}
+
+// GetID returns the provisioner unique identifier.
+func (p *Tencent) GetID() string {
+	if p.ID != "" {
+		return p.ID
+	}
+	return p.GetIDForToken()
+}
+
+// GetIDForToken returns an identifier that will be used to load the provisioner
+// from a token.
+func (p *Tencent) GetIDForToken() string {
+	return "tencent/" + p.Name
+}
+
+// GetTokenID returns the identifier of the token.
+func (p *Tencent) GetTokenID(token string) (string, error) {
+	payload, err := p.authorizeToken(token)
+	if err != nil {
+		return "", err
+	}
+
+	// If TOFU is disabled create an ID for the token, so it cannot be reused.
+	if p.DisableTrustOnFirstUse {
+		sum := sha256.Sum256([]byte(token))
+		return strings.ToLower(hex.EncodeToString(sum[:])), nil
+	}
+
+	// Use provisioner + instance-id as the identifier.
+	return p.GetTOFUTokenID(payload.document.InstanceID), nil
+}
+
+// GetTOFUInstanceID returns the instance id in the identity document of the
+// token.
+func (p *Tencent) GetTOFUInstanceID(token string) (string, error) {
+	if p.DisableTrustOnFirstUse {
+		return "", nil
+	}
+	payload, err := p.authorizeToken(token)
+	if err != nil {
+		return "", err
+	}
+	return payload.document.InstanceID, nil
+}
+
+// GetTOFUTokenID returns the SHA256 of "provisioner_id.instance_id".
+func (p *Tencent) GetTOFUTokenID(instanceID string) string {
+	return tofuTokenID(fmt.Sprintf("%s.%s", p.GetIDForToken(), instanceID))
+}
+
+// GetName returns the name of the provisioner.
+func (p *Tencent) GetName() string {
+	return p.Name
+}
+
+// GetType returns the type of provisioner.
+func (p *Tencent) GetType() Type {
+	return TypeTencent
+}
+
+// GetEncryptedKey is not available in a Tencent provisioner.
+func (p *Tencent) GetEncryptedKey() (kid, key string, ok bool) {
+	return "", "", false
+}
+
+// GetOptions returns the configured provisioner options.
+func (p *Tencent) GetOptions() *Options {
+	return p.Options
+}
+
+// GetIdentityToken retrieves the identity document and its signature and
+// generates a token with them.
+func (p *Tencent) GetIdentityToken(subject, caURL string) (string, error) {
+	// Initialize the config if this method is used from the cli.
+	p.assertConfig()
+
+	doc, err := p.readURL(p.config.identityURL)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving identity document:\n  Are you in a Tencent Cloud CVM instance?\n  Is the metadata service enabled?")
+	}
+	var idoc tencentInstanceIdentityDocument
+	if err := json.Unmarshal(doc, &idoc); err != nil {
+		return "", errors.Wrap(err, "error unmarshaling identity document")
+	}
+	sig, err := p.readURL(p.config.signatureURL)
+	if err != nil {
+		return "", errors.Wrap(err, "error retrieving identity document signature:\n  Are you in a Tencent Cloud CVM instance?\n  Is the metadata service enabled?")
+	}
+	signature, err := decodeIIDPKCS7(sig)
+	if err != nil {
+		return "", errors.Wrap(err, "error decoding identity document signature")
+	}
+	if subject == "" {
+		subject = idoc.InstanceID
+	}
+
+	audience, err := generateSignAudience(caURL, p.GetIDForToken())
+	if err != nil {
+		return "", err
+	}
+
+	// Create a JWT from the identity document
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.HS256, Key: signature},
+		new(jose.SignerOptions).WithType("JWT"),
+	)
+	if err != nil {
+		return "", errors.Wrap(err, "error creating signer")
+	}
+
+	now := time.Now()
+	payload := tencentPayload{
+		Claims: jose.Claims{
+			Issuer:    tencentIssuer,
+			Subject:   subject,
+			Audience:  []string{audience},
+			Expiry:    jose.NewNumericDate(now.Add(5 * time.Minute)),
+			NotBefore: jose.NewNumericDate(now),
+			IssuedAt:  jose.NewNumericDate(now),
+		},
+		Tencent: tencentIdentityPayload{
+			Document: doc,
+			PKCS7:    signature,
+		},
+	}
+
+	tok, err := jose.Signed(signer).Claims(payload).CompactSerialize()
+	if err != nil {
+		return "", errors.Wrap(err, "error serializing token")
+	}
+	return tok, nil
+}
+
+// Init validates and initializes the Tencent provisioner.
+func (p *Tencent) Init(config Config) (err error) {
+	switch {
+	case p.Type == "":
+		return errors.New("provisioner type cannot be empty")
+	case p.Name == "":
+		return errors.New("provisioner name cannot be empty")
+	case p.IIDRoots == "":
+		return errors.New("provisioner iidRoots cannot be empty")
+	case p.InstanceAge.Value() < 0:
+		return errors.New("provisioner instanceAge cannot be negative")
+	}
+
+	// Add default config
+	p.assertConfig()
+	if p.config.certificates, err = loadIIDCertificates(p.IIDRoots); err != nil {
+		return err
+	}
+
+	config.Audiences = config.Audiences.WithFragment(p.GetIDForToken())
+	p.Options = mergeOptions(p.Options, config.DefaultOptions, p.GetType())
+	p.ctl, err = NewController(p, p.Claims, config, p.Options)
+	return
+}
+
+// assertConfig initializes the config if it has not been initialized.
+func (p *Tencent) assertConfig() {
+	if p.config == nil {
+		p.config = newTencentConfig()
+	}
+}
+
+// readURL does a GET request to the given url and returns the body.
+func (p *Tencent) readURL(u string) ([]byte, error) {
+	resp, err := http.Get(u) //nolint:gosec // the url is the metadata service
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("request for metadata returned non-successful status code %d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// authorizeToken performs common jwt authorization actions and returns the
+// claims for case specific downstream parsing.
+func (p *Tencent) authorizeToken(token string) (*tencentPayload, error) {
+	jwt, err := jose.ParseSigned(token)
+	if err != nil {
+		return nil, errs.Wrapf(http.StatusUnauthorized, err, "tencent.authorizeToken; error parsing tencent token")
+	}
+	if len(jwt.Headers) == 0 {
+		return nil, errs.InternalServer("tencent.authorizeToken; error parsing token, header is missing")
+	}
+
+	var unsafeClaims tencentPayload
+	if err := jwt.UnsafeClaimsWithoutVerification(&unsafeClaims); err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "tencent.authorizeToken; error unmarshaling claims")
+	}
+
+	var payload tencentPayload
+	if err := jwt.Claims(unsafeClaims.Tencent.PKCS7, &payload); err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "tencent.authorizeToken; error verifying claims")
+	}
+
+	// Validate identity document signature
+	document, err := verifyIIDPKCS7(payload.Tencent.PKCS7, payload.Tencent.Document, p.config.certificates)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "tencent.authorizeToken; invalid tencent token signature")
+	}
+
+	var doc tencentInstanceIdentityDocument
+	if err := json.Unmarshal(document, &doc); err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "tencent.authorizeToken; error unmarshaling tencent identity document")
+	}
+
+	switch {
+	case doc.AccountID == "":
+		return nil, errs.Unauthorized("tencent.authorizeToken; tencent identity document accountId cannot be empty")
+	case doc.InstanceID == "":
+		return nil, errs.Unauthorized("tencent.authorizeToken; tencent identity document instanceId cannot be empty")
+	case doc.PrivateIP == "":
+		return nil, errs.Unauthorized("tencent.authorizeToken; tencent identity document privateIp cannot be empty")
+	case doc.Region == "":
+		return nil, errs.Unauthorized("tencent.authorizeToken; tencent identity document region cannot be empty")
+	}
+
+	// According to "rfc7519 JSON Web Token" acceptable skew should be no
+	// more than a few minutes.
+	now := time.Now().UTC()
+	if err = payload.ValidateWithLeeway(jose.Expected{
+		Issuer: tencentIssuer,
+		Time:   now,
+	}, time.Minute); err != nil {
+		return nil, errs.Wrapf(http.StatusUnauthorized, err, "tencent.authorizeToken; invalid tencent token")
+	}
+
+	// validate instance age, the pendingTime is part of the signed document
+	if d := p.InstanceAge.Value(); d > 0 {
+		if doc.PendingTime.IsZero() || now.Sub(doc.PendingTime) > d {
+			return nil, errs.Unauthorized("tencent.authorizeToken; tencent identity document pendingTime is too old")
+		}
+	}
+
+	// validate audiences with the defaults
+	if !matchesAudience(payload.Audience, p.ctl.Audiences.Sign) {
+		return nil, errs.Unauthorized("tencent.authorizeToken; invalid token - invalid audience claim (aud)")
+	}
+
+	// Validate subject, it has to be known if disableCustomSANs is enabled
+	if p.DisableCustomSANs {
+		if payload.Subject != doc.InstanceID && payload.Subject != doc.PrivateIP {
+			return nil, errs.Unauthorized("tencent.authorizeToken; invalid token - invalid subject claim (sub)")
+		}
+	}
+
+	// validate accounts
+	if len(p.Accounts) > 0 && !slices.Contains(p.Accounts, doc.AccountID) {
+		return nil, errs.Unauthorized("tencent.authorizeToken; invalid tencent identity document - accountId is not valid")
+	}
+
+	payload.document = doc
+	return &payload, nil
+}
+
+// AuthorizeSign validates the given token and returns the sign options that
+// will be used on certificate creation.
+func (p *Tencent) AuthorizeSign(ctx context.Context, token string) ([]SignOption, error) {
+	payload, err := p.authorizeToken(token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "tencent.AuthorizeSign")
+	}
+
+	doc := payload.document
+
+	// Template options
+	data := x509util.NewTemplateData()
+	data.SetCommonName(payload.Claims.Subject)
+	if v, err := unsafeParseSigned(token); err == nil {
+		data.SetToken(v)
+	}
+
+	// Enforce known CN and default IP if configured.
+	// By default we'll accept the CN and SANs in the CSR.
+	// There's no way to trust them other than TOFU.
+	var so []SignOption
+	if p.DisableCustomSANs {
+		so = append(so,
+			dnsNamesValidator(nil),
+			ipAddressesValidator([]net.IP{
+				net.ParseIP(doc.PrivateIP),
+			}),
+			emailAddressesValidator(nil),
+			newURIsValidator(ctx, nil),
+		)
+
+		// Template options
+		data.SetSANs([]string{doc.PrivateIP})
+	}
+
+	templateOptions, err := CustomTemplateOptions(p.Options, data, x509util.DefaultIIDLeafTemplate)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "tencent.AuthorizeSign")
+	}
+
+	return append(so,
+		p,
+		templateOptions,
+		// modifiers / withOptions
+		newProvisionerExtensionOption(TypeTencent, p.Name, doc.AccountID, "InstanceID", doc.InstanceID).WithControllerOptions(p.ctl),
+		profileDefaultDuration(p.ctl.Claimer.DefaultTLSCertDuration()),
+		// validators
+		defaultPublicKeyValidator{},
+		commonNameValidator(payload.Claims.Subject),
+		newValidityValidator(p.ctl.Claimer.MinTLSCertDuration(), p.ctl.Claimer.MaxTLSCertDuration()),
+		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
+		p.ctl.newWebhookController(
+			data,
+			linkedca.Webhook_X509,
+			webhook.WithAuthorizationPrincipal(doc.InstanceID),
+		),
+	), nil
+}
+
+// AuthorizeRenew returns an error if the renewal is disabled.
+func (p *Tencent) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) error {
+	return p.ctl.AuthorizeRenew(ctx, cert)
+}
+
+// AuthorizeSSHSign returns the list of SignOption for a SignSSH request.
+func (p *Tencent) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption, error) {
+	if !p.ctl.Claimer.IsSSHCAEnabled() {
+		return nil, errs.Unauthorized("tencent.AuthorizeSSHSign; ssh ca is disabled for tencent provisioner '%s'", p.GetName())
+	}
+	claims, err := p.authorizeToken(token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "tencent.AuthorizeSSHSign")
+	}
+
+	doc := claims.document
+	signOptions := []SignOption{}
+
+	// Enforce host certificate.
+	defaults := SignSSHOptions{
+		CertType: SSHHostCert,
+	}
+
+	// Validated principals.
+	principals := []string{doc.PrivateIP}
+
+	// Only enforce known principals if disable custom sans is true.
+	if p.DisableCustomSANs {
+		defaults.Principals = principals
+	} else {
+		// Check that at least one principal is sent in the request.
+		signOptions = append(signOptions, &sshCertOptionsRequireValidator{
+			Principals: true,
+		})
+	}
+
+	// Certificate templates.
+	data := sshutil.CreateTemplateData(sshutil.HostCert, doc.InstanceID, principals)
+	if v, err := unsafeParseSigned(token); err == nil {
+		data.SetToken(v)
+	}
+	audit := newSSHAuditMetadata(ctx, p, doc.InstanceID, data)
+
+	templateOptions, err := CustomSSHTemplateOptions(p.Options, data, sshutil.DefaultIIDTemplate)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "tencent.AuthorizeSSHSign")
+	}
+	signOptions = append(signOptions, templateOptions)
+
+	return append(signOptions,
+		p,
+		audit,
+		// Validate user SignSSHOptions.
+		sshCertOptionsValidator(defaults),
+		// Set the validity bounds if not set.
+		&sshDefaultDuration{p.ctl.Claimer},
+		// Validate public key
+		&sshDefaultPublicKeyValidator{},
+		// Validate the validity period.
+		&sshCertValidityValidator{p.ctl.Claimer},
+		// Require all the fields in the SSH certificate
+		&sshCertDefaultValidator{},
+		// Ensure that all principal names are allowed
+		newSSHNamePolicyValidator(p.ctl.getPolicy().getSSHHost(), nil),
+		// Call webhooks
+		p.ctl.newWebhookController(
+			data,
+			linkedca.Webhook_SSH,
+			webhook.WithAuthorizationPrincipal(doc.InstanceID),
+		),
+	), nil
+}
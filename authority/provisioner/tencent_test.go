@@ -0,0 +1,186 @@
+package provisioner
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+)
+
+const testTencentDocument = `{"accountId":"100000000001","appId":"1250000000","instanceId":"ins-abc123","instanceType":"S5.MEDIUM2","imageId":"img-xyz","region":"ap-guangzhou","zone":"ap-guangzhou-3","privateIp":"10.0.0.10"}`
+
+func generateTencent(t *testing.T) (*Tencent, *x509.Certificate, crypto.Signer) {
+	t.Helper()
+	crt, key, path := generateIIDSigner(t)
+	p := &Tencent{
+		Type:     "Tencent",
+		Name:     "tencent",
+		IIDRoots: path,
+	}
+	require.NoError(t, p.Init(Config{
+		Claims:    globalProvisionerClaims,
+		Audiences: testAudiences,
+	}))
+	return p, crt, key
+}
+
+func generateTencentToken(t *testing.T, sub, aud string, crt *x509.Certificate, key crypto.Signer) string {
+	t.Helper()
+	return generateTencentDocumentToken(t, sub, aud, testTencentDocument, crt, key)
+}
+
+func generateTencentDocumentToken(t *testing.T, sub, aud, doc string, crt *x509.Certificate, key crypto.Signer) string {
+	t.Helper()
+	signature := signIIDDocument(t, crt, key, []byte(doc), false)
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.HS256, Key: signature},
+		new(jose.SignerOptions).WithType("JWT"),
+	)
+	require.NoError(t, err)
+	now := time.Now()
+	tok, err := jose.Signed(signer).Claims(tencentPayload{
+		Claims: jose.Claims{
+			Issuer:    tencentIssuer,
+			Subject:   sub,
+			Audience:  []string{aud},
+			Expiry:    jose.NewNumericDate(now.Add(5 * time.Minute)),
+			NotBefore: jose.NewNumericDate(now),
+			IssuedAt:  jose.NewNumericDate(now),
+		},
+		Tencent: tencentIdentityPayload{
+			PKCS7: signature,
+		},
+	}).CompactSerialize()
+	require.NoError(t, err)
+	return tok
+}
+
+func TestTencent_Init(t *testing.T) {
+	config := Config{
+		Claims:    globalProvisionerClaims,
+		Audiences: testAudiences,
+	}
+	p, _, _ := generateTencent(t)
+	assert.Equal(t, "tencent/tencent", p.GetID())
+	assert.Equal(t, TypeTencent, p.GetType())
+
+	assert.EqualError(t, (&Tencent{Name: "tencent"}).Init(config), "provisioner type cannot be empty")
+	assert.EqualError(t, (&Tencent{Type: "Tencent"}).Init(config), "provisioner name cannot be empty")
+	assert.EqualError(t, (&Tencent{Type: "Tencent", Name: "tencent"}).Init(config), "provisioner iidRoots cannot be empty")
+	assert.Error(t, (&Tencent{Type: "Tencent", Name: "tencent", IIDRoots: "testdata/missing.pem"}).Init(config))
+	assert.EqualError(t, (&Tencent{Type: "Tencent", Name: "tencent", IIDRoots: p.IIDRoots, InstanceAge: Duration{Duration: -time.Minute}}).Init(config), "provisioner instanceAge cannot be negative")
+}
+
+func TestTencent_authorizeToken(t *testing.T) {
+	p, crt, key := generateTencent(t)
+	otherCrt, otherKey, _ := generateIIDSigner(t)
+	aud := p.ctl.Audiences.Sign[0]
+	newDocument := func(pendingTime time.Time) string {
+		return fmt.Sprintf(`{"accountId":"100000000001","instanceId":"ins-abc123","region":"ap-guangzhou","privateIp":"10.0.0.10","pendingTime":%q}`, pendingTime.Format(time.RFC3339))
+	}
+	recent := generateTencentDocumentToken(t, "ins-abc123", aud, newDocument(time.Now().Add(-time.Minute)), crt, key)
+	old := generateTencentDocumentToken(t, "ins-abc123", aud, newDocument(time.Now().Add(-2*time.Hour)), crt, key)
+
+	tests := []struct {
+		name              string
+		token             string
+		accounts          []string
+		disableCustomSANs bool
+		instanceAge       time.Duration
+		wantErr           bool
+	}{
+		{"ok", generateTencentToken(t, "foo.example.com", aud, crt, key), nil, false, 0, false},
+		{"ok instance age", recent, nil, false, time.Hour, false},
+		{"ok accounts", generateTencentToken(t, "ins-abc123", aud, crt, key), []string{"100000000001"}, true, 0, false},
+		{"ok ip", generateTencentToken(t, "10.0.0.10", aud, crt, key), nil, true, 0, false},
+		{"fail signer", generateTencentToken(t, "ins-abc123", aud, otherCrt, otherKey), nil, false, 0, true},
+		{"fail audience", generateTencentToken(t, "ins-abc123", "https://ca.example.com/1.0/sign", crt, key), nil, false, 0, true},
+		{"fail subject", generateTencentToken(t, "foo.example.com", aud, crt, key), nil, true, 0, true},
+		{"fail accounts", generateTencentToken(t, "ins-abc123", aud, crt, key), []string{"100000000002"}, false, 0, true},
+		{"fail instance age", old, nil, false, time.Hour, true},
+		{"fail instance age no pendingTime", generateTencentToken(t, "ins-abc123", aud, crt, key), nil, false, time.Hour, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p.Accounts = tt.accounts
+			p.DisableCustomSANs = tt.disableCustomSANs
+			p.InstanceAge = Duration{Duration: tt.instanceAge}
+
+			payload, err := p.authorizeToken(tt.token)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "ins-abc123", payload.document.InstanceID)
+			assert.Equal(t, "100000000001", payload.document.AccountID)
+
+			id, err := p.GetTokenID(tt.token)
+			require.NoError(t, err)
+			assert.Equal(t, p.GetTOFUTokenID("ins-abc123"), id)
+		})
+	}
+}
+
+func TestTencent_AuthorizeSign(t *testing.T) {
+	p, crt, key := generateTencent(t)
+	token := generateTencentToken(t, "ins-abc123", p.ctl.Audiences.Sign[0], crt, key)
+
+	opts, err := p.AuthorizeSign(context.Background(), token)
+	require.NoError(t, err)
+	assert.Contains(t, opts, commonNameValidator("ins-abc123"))
+	assert.NotContains(t, opts, ipAddressesValidator([]net.IP{net.ParseIP("10.0.0.10")}))
+
+	p.DisableCustomSANs = true
+	opts, err = p.AuthorizeSign(context.Background(), token)
+	require.NoError(t, err)
+	assert.Contains(t, opts, ipAddressesValidator([]net.IP{net.ParseIP("10.0.0.10")}))
+
+	opts, err = p.AuthorizeSSHSign(context.Background(), token)
+	require.NoError(t, err)
+	assert.Contains(t, opts, sshCertOptionsValidator(SignSSHOptions{
+		CertType:   SSHHostCert,
+		Principals: []string{"10.0.0.10"},
+	}))
+}
+
+func TestTencent_GetIdentityToken(t *testing.T) {
+	p, crt, key := generateTencent(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/document":
+			fmt.Fprint(w, testTencentDocument)
+		case "/pkcs7":
+			w.Write(pem.EncodeToMemory(&pem.Block{
+				Type:  "PKCS7",
+				Bytes: signIIDDocument(t, crt, key, []byte(testTencentDocument), false),
+			}))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	p.config.identityURL = srv.URL + "/document"
+	p.config.signatureURL = srv.URL + "/pkcs7"
+
+	token, err := p.GetIdentityToken("", "https://ca.smallstep.com")
+	require.NoError(t, err)
+	payload, err := p.authorizeToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, "ins-abc123", payload.Subject)
+
+	p.config.signatureURL = srv.URL + "/missing"
+	_, err = p.GetIdentityToken("", "https://ca.smallstep.com")
+	assert.Error(t, err)
+}
@@ -0,0 +1,108 @@
+package provisioner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.step.sm/crypto/jose"
+)
+
+// TrustOnFirstUse is implemented by the cloud provisioners that, by default,
+// only accept the first token of an instance. The authority uses it to keep a
+// registry of the instances that have already been issued a certificate, so
+// they can be listed and reset.
+type TrustOnFirstUse interface {
+	// GetTOFUInstanceID returns the instance id of a validated token, or an
+	// empty string if trust on first use does not apply to the token.
+	GetTOFUInstanceID(token string) (string, error)
+	// GetTOFUTokenID returns the token id used to record the first use of the
+	// given instance.
+	GetTOFUTokenID(instanceID string) string
+}
+
+// tofuTokenID returns the SHA256 of the given value as used in the token id of
+// the first use of an instance.
+func tofuTokenID(unique string) string {
+	sum := sha256.Sum256([]byte(unique))
+	return strings.ToLower(hex.EncodeToString(sum[:]))
+}
+
+// GetTOFUInstanceID returns the instance id in the identity document of the
+// token. Tokens with an IAM identity are not bound to an instance.
+func (p *AWS) GetTOFUInstanceID(token string) (string, error) {
+	if p.DisableTrustOnFirstUse {
+		return "", nil
+	}
+	jwt, err := jose.ParseSigned(token)
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing token")
+	}
+	var payload awsPayload
+	if err := jwt.UnsafeClaimsWithoutVerification(&payload); err != nil {
+		return "", errors.Wrap(err, "error parsing claims")
+	}
+	if payload.Amazon.IAMRequest != nil {
+		return "", nil
+	}
+	var doc awsInstanceIdentityDocument
+	if err := json.Unmarshal(payload.Amazon.Document, &doc); err != nil {
+		return "", errors.Wrap(err, "error unmarshaling identity document")
+	}
+	return doc.InstanceID, nil
+}
+
+// GetTOFUTokenID returns the SHA256 of "provisioner_id.instance_id".
+func (p *AWS) GetTOFUTokenID(instanceID string) string {
+	return tofuTokenID(fmt.Sprintf("%s.%s", p.GetIDForToken(), instanceID))
+}
+
+// GetTOFUInstanceID returns the compute engine instance id of the token. GKE
+// tokens are not bound to an instance.
+func (p *GCP) GetTOFUInstanceID(token string) (string, error) {
+	if p.DisableTrustOnFirstUse {
+		return "", nil
+	}
+	jwt, err := jose.ParseSigned(token)
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing token")
+	}
+	var claims gcpPayload
+	if err := jwt.UnsafeClaimsWithoutVerification(&claims); err != nil {
+		return "", errors.Wrap(err, "error parsing claims")
+	}
+	if isGKEIssuer(claims.Issuer) {
+		return "", nil
+	}
+	return claims.Google.ComputeEngine.InstanceID, nil
+}
+
+// GetTOFUTokenID returns the SHA256 of "provisioner_id.instance_id".
+func (p *GCP) GetTOFUTokenID(instanceID string) string {
+	return tofuTokenID(fmt.Sprintf("%s.%s", p.GetIDForToken(), instanceID))
+}
+
+// GetTOFUInstanceID returns the xms_mirid claim of the token, the resource id
+// of the managed identity.
+func (p *Azure) GetTOFUInstanceID(token string) (string, error) {
+	if p.DisableTrustOnFirstUse {
+		return "", nil
+	}
+	jwt, err := jose.ParseSigned(token)
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing token")
+	}
+	var claims azurePayload
+	if err := jwt.UnsafeClaimsWithoutVerification(&claims); err != nil {
+		return "", errors.Wrap(err, "error parsing claims")
+	}
+	return claims.XMSMirID, nil
+}
+
+// GetTOFUTokenID returns the SHA256 of the xms_mirid.
+func (p *Azure) GetTOFUTokenID(instanceID string) string {
+	return tofuTokenID(instanceID)
+}
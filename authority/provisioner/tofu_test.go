@@ -0,0 +1,69 @@
+package provisioner
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrustOnFirstUse(t *testing.T) {
+	now := time.Now()
+
+	aws, err := generateAWS()
+	require.NoError(t, err)
+	block, _ := pem.Decode([]byte(awsTestKey))
+	require.NotNil(t, block)
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	require.NoError(t, err)
+	awsToken, err := generateAWSToken(aws, "instance-id", awsIssuer, aws.GetID(), aws.Accounts[0], "i-1234",
+		"127.0.0.1", "us-west-1", now, key)
+	require.NoError(t, err)
+
+	gcp, err := generateGCP()
+	require.NoError(t, err)
+	gcpToken, err := generateGCPToken(gcp.ServiceAccounts[0], "https://accounts.google.com", gcp.GetID(),
+		"5678", "instance-name", "project-id", "zone", now, &gcp.keyStore.keySet.Keys[0])
+	require.NoError(t, err)
+
+	azure, err := generateAzure()
+	require.NoError(t, err)
+	azureToken, err := generateAzureToken("subject", azure.oidcConfig.Issuer, azureDefaultAudience,
+		azure.TenantID, "subscriptionID", "resourceGroup", "myVM", "vm", now, &azure.keyStore.keySet.Keys[0])
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		prov           TrustOnFirstUse
+		token          string
+		disable        func()
+		wantInstanceID string
+	}{
+		{"aws", aws, awsToken, func() { aws.DisableTrustOnFirstUse = true }, "i-1234"},
+		{"gcp", gcp, gcpToken, func() { gcp.DisableTrustOnFirstUse = true }, "5678"},
+		{"azure", azure, azureToken, func() { azure.DisableTrustOnFirstUse = true },
+			"/subscriptions/subscriptionID/resourceGroups/resourceGroup/providers/Microsoft.Compute/virtualMachines/myVM"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instanceID, err := tt.prov.GetTOFUInstanceID(tt.token)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantInstanceID, instanceID)
+
+			tokenID, err := tt.prov.(Interface).GetTokenID(tt.token)
+			require.NoError(t, err)
+			assert.Equal(t, tokenID, tt.prov.GetTOFUTokenID(instanceID))
+
+			_, err = tt.prov.GetTOFUInstanceID("foo")
+			assert.Error(t, err)
+
+			tt.disable()
+			instanceID, err = tt.prov.GetTOFUInstanceID(tt.token)
+			require.NoError(t, err)
+			assert.Empty(t, instanceID)
+		})
+	}
+}
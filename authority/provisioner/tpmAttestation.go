@@ -0,0 +1,425 @@
+package provisioner
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/asn1"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/go-tpm/legacy/tpm2"
+	"github.com/pkg/errors"
+	"github.com/smallstep/go-attestation/attest"
+
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/pemutil"
+	"go.step.sm/crypto/x509util"
+	"go.step.sm/linkedca"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+// COSE algorithm identifiers used in the TPM attestation statements, see
+// https://www.w3.org/TR/webauthn-2/#sctn-alg-identifier.
+const (
+	tpmAlgES256 int64 = -7
+	tpmAlgRS256 int64 = -257
+	tpmAlgRS1   int64 = -65535
+)
+
+var (
+	oidTPMSubjectAlternativeName = asn1.ObjectIdentifier{2, 5, 29, 17}
+	oidTCGKpAIKCertificate       = asn1.ObjectIdentifier{2, 23, 133, 8, 3}
+)
+
+// tpmAttestationStatement is the TPM 2.0 attestation statement in a TPM token.
+// It uses the same fields as the "tpm" format of the ACME device-attest-01
+// challenge.
+type tpmAttestationStatement struct {
+	Version   string   `json:"ver"`
+	Algorithm int64    `json:"alg"`
+	X5C       [][]byte `json:"x5c"`
+	PubArea   []byte   `json:"pubArea"`
+	CertInfo  []byte   `json:"certInfo"`
+	Signature []byte   `json:"sig"`
+}
+
+// tpmPayload extends jwt.Claims with the TPM attestation.
+type tpmPayload struct {
+	jose.Claims
+	SANs        []string                 `json:"sans,omitempty"`
+	Attestation *tpmAttestationStatement `json:"tpm"`
+	attested    *tpmAttestationData
+}
+
+// tpmAttestationData contains the verified data of a TPM attestation.
+type tpmAttestationData struct {
+	Certificate          *x509.Certificate
+	VerifiedChains       [][]*x509.Certificate
+	PermanentIdentifiers []string
+	PublicKey            crypto.PublicKey
+}
+
+// TPMAttestation represents a provisioner that issues certificates to keys
+// attested by a TPM 2.0, without using the ACME device-attest-01 challenge.
+//
+// The token is a JWT signed by the attested key, with the provisioner name as
+// the issuer and the sign audience of the CA, with the provisioner id as a
+// fragment, e.g. https://ca.example.com/1.0/sign#tpm/my-tpm. The "tpm" claim
+// contains the attestation statement: the AK certificate chain, that must
+// chain to one of the configured TPM manufacturer roots, and the
+// certification of the key by the AK. The issued certificate is bound to the
+// attested key.
+type TPMAttestation struct {
+	*base
+	ID   string `json:"-"`
+	Type string `json:"type"`
+	Name string `json:"name"`
+	// Roots is a PEM bundle with the TPM manufacturer roots, or the roots of
+	// the CA issuing the AK certificates.
+	Roots []byte `json:"roots"`
+	// PermanentIdentifiers, if set, are the only TPMs allowed to get
+	// certificates. They are matched with the permanent identifiers in the AK
+	// certificate.
+	PermanentIdentifiers []string `json:"permanentIdentifiers,omitempty"`
+	Claims               *Claims  `json:"claims,omitempty"`
+	Options              *Options `json:"options,omitempty"`
+	rootPool             *x509.CertPool
+	ctl                  *Controller
+}
+
+// GetID returns the provisioner unique identifier.
+func (p *TPMAttestation) GetID() string {
+	if p.ID != "" {
+		return p.ID
+	}
+	return p.GetIDForToken()
+}
+
+// GetIDForToken returns an identifier that will be used to load the provisioner
+// from a token.
+func (p *TPMAttestation) GetIDForToken() string {
+	return "tpm/" + p.Name
+}
+
+// GetTokenID returns the identifier of the token.
+func (p *TPMAttestation) GetTokenID(ott string) (string, error) {
+	// Validate payload
+	token, err := jose.ParseSigned(ott)
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing token")
+	}
+
+	// Get claims w/out verification. We need to verify the attestation in
+	// order to get the key that signs the token.
+	var claims jose.Claims
+	if err = token.UnsafeClaimsWithoutVerification(&claims); err != nil {
+		return "", errors.Wrap(err, "error verifying claims")
+	}
+	return claims.ID, nil
+}
+
+// GetName returns the name of the provisioner.
+func (p *TPMAttestation) GetName() string {
+	return p.Name
+}
+
+// GetType returns the type of provisioner.
+func (p *TPMAttestation) GetType() Type {
+	return TypeTPMAttestation
+}
+
+// GetEncryptedKey returns false, because the TPM provisioner does not have
+// access to the private key.
+func (p *TPMAttestation) GetEncryptedKey() (string, string, bool) {
+	return "", "", false
+}
+
+// GetOptions returns the configured provisioner options.
+func (p *TPMAttestation) GetOptions() *Options {
+	return p.Options
+}
+
+// Init initializes and validates the fields of a TPMAttestation type.
+func (p *TPMAttestation) Init(config Config) (err error) {
+	switch {
+	case p.Type == "":
+		return errors.New("provisioner type cannot be empty")
+	case p.Name == "":
+		return errors.New("provisioner name cannot be empty")
+	case len(p.Roots) == 0:
+		return errors.New("provisioner root(s) cannot be empty")
+	}
+
+	certs, err := pemutil.ParseCertificateBundle(p.Roots)
+	if err != nil {
+		return errors.Wrap(err, "error parsing roots")
+	}
+	p.rootPool = x509.NewCertPool()
+	for _, crt := range certs {
+		p.rootPool.AddCert(crt)
+	}
+
+	config.Audiences = config.Audiences.WithFragment(p.GetIDForToken())
+	p.Options = mergeOptions(p.Options, config.DefaultOptions, p.GetType())
+	p.ctl, err = NewController(p, p.Claims, config, p.Options)
+	return
+}
+
+// authorizeToken verifies the TPM attestation in the token, and validates the
+// token using the attested key.
+func (p *TPMAttestation) authorizeToken(token string, audiences []string) (*tpmPayload, error) {
+	jwt, err := jose.ParseSigned(token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "tpm.authorizeToken; error parsing tpm token")
+	}
+
+	var unsafeClaims tpmPayload
+	if err := jwt.UnsafeClaimsWithoutVerification(&unsafeClaims); err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "tpm.authorizeToken; error parsing tpm token claims")
+	}
+	if unsafeClaims.Attestation == nil {
+		return nil, errs.Unauthorized("tpm.authorizeToken; tpm token must contain a tpm claim")
+	}
+	data, err := p.verifyAttestation(unsafeClaims.Attestation)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "tpm.authorizeToken; error verifying tpm attestation")
+	}
+
+	// Using the attested key to validate the claims asserts that the token
+	// has been signed by the attested key.
+	var claims tpmPayload
+	if err = jwt.Claims(data.PublicKey, &claims); err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "tpm.authorizeToken; error parsing tpm claims")
+	}
+
+	// According to "rfc7519 JSON Web Token" acceptable skew should be no
+	// more than a few minutes.
+	if err = claims.ValidateWithLeeway(jose.Expected{
+		Issuer: p.Name,
+		Time:   time.Now().UTC(),
+	}, time.Minute); err != nil {
+		return nil, errs.Wrapf(http.StatusUnauthorized, err, "tpm.authorizeToken; invalid tpm claims")
+	}
+	if claims.Expiry == nil {
+		return nil, errs.Unauthorized("tpm.authorizeToken; tpm token must contain an exp claim")
+	}
+
+	// validate audiences with the defaults
+	if !matchesAudience(claims.Audience, audiences) {
+		return nil, errs.Unauthorized("tpm.authorizeToken; tpm token has invalid audience "+
+			"claim (aud); expected %s, but got %s", audiences, claims.Audience)
+	}
+
+	if claims.Subject == "" {
+		return nil, errs.Unauthorized("tpm.authorizeToken; tpm token subject cannot be empty")
+	}
+
+	if len(p.PermanentIdentifiers) > 0 && !slices.ContainsFunc(data.PermanentIdentifiers, func(s string) bool {
+		return slices.Contains(p.PermanentIdentifiers, s)
+	}) {
+		return nil, errs.Forbidden("tpm.authorizeToken; tpm permanent identifier is not allowed")
+	}
+
+	claims.attested = data
+	return &claims, nil
+}
+
+// verifyAttestation verifies the AK certificate chain and the certification
+// of the attested key, and returns the attested data.
+func (p *TPMAttestation) verifyAttestation(att *tpmAttestationStatement) (*tpmAttestationData, error) {
+	if att.Version != "2.0" {
+		return nil, errors.Errorf("version %q is not supported", att.Version)
+	}
+	if len(att.X5C) == 0 {
+		return nil, errors.New("x5c is empty")
+	}
+
+	akCert, err := x509.ParseCertificate(att.X5C[0])
+	if err != nil {
+		return nil, errors.Wrap(err, "x5c is malformed")
+	}
+	intermediates := x509.NewCertPool()
+	for _, b := range att.X5C[1:] {
+		crt, err := x509.ParseCertificate(b)
+		if err != nil {
+			return nil, errors.Wrap(err, "x5c is malformed")
+		}
+		intermediates.AddCert(crt)
+	}
+
+	// The Subject Alternative Name of an AK certificate is critical, but it
+	// only contains names not supported by the standard library.
+	if len(akCert.UnhandledCriticalExtensions) > 0 {
+		unhandledCriticalExtensions := akCert.UnhandledCriticalExtensions[:0]
+		for _, oid := range akCert.UnhandledCriticalExtensions {
+			if !oid.Equal(oidTPMSubjectAlternativeName) {
+				unhandledCriticalExtensions = append(unhandledCriticalExtensions, oid)
+			}
+		}
+		akCert.UnhandledCriticalExtensions = unhandledCriticalExtensions
+	}
+
+	verifiedChains, err := akCert.Verify(x509.VerifyOptions{
+		Roots:         p.rootPool,
+		Intermediates: intermediates,
+		CurrentTime:   time.Now().Truncate(time.Second),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "x5c is not valid")
+	}
+	if err := validateTPMAKCertificate(akCert); err != nil {
+		return nil, err
+	}
+
+	sans, err := x509util.ParseSubjectAlternativeNames(akCert)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing AK certificate subject alternative names")
+	}
+	permanentIdentifiers := make([]string, len(sans.PermanentIdentifiers))
+	for i, pi := range sans.PermanentIdentifiers {
+		permanentIdentifiers[i] = pi.Identifier
+	}
+
+	var hash crypto.Hash
+	switch att.Algorithm {
+	case tpmAlgRS256, tpmAlgES256:
+		hash = crypto.SHA256
+	case tpmAlgRS1:
+		hash = crypto.SHA1
+	default:
+		return nil, errors.Errorf("alg %d is not supported", att.Algorithm)
+	}
+
+	// Verify the certification of the key using the public key of the AK.
+	params := &attest.CertificationParameters{
+		Public:            att.PubArea,
+		CreateAttestation: att.CertInfo,
+		CreateSignature:   att.Signature,
+	}
+	if err := params.Verify(attest.VerifyOpts{
+		Public: akCert.PublicKey,
+		Hash:   hash,
+	}); err != nil {
+		return nil, errors.Wrap(err, "invalid certification parameters")
+	}
+
+	pub, err := tpm2.DecodePublic(att.PubArea)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding pubArea")
+	}
+	publicKey, err := pub.Key()
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting attested public key")
+	}
+
+	return &tpmAttestationData{
+		Certificate:          akCert,
+		VerifiedChains:       verifiedChains,
+		PermanentIdentifiers: permanentIdentifiers,
+		PublicKey:            publicKey,
+	}, nil
+}
+
+// validateTPMAKCertificate validates the required properties of an AK
+// certificate, see https://www.w3.org/TR/webauthn-2/#sctn-tpm-cert-requirements.
+func validateTPMAKCertificate(c *x509.Certificate) error {
+	switch {
+	case c.Version != 3:
+		return errors.Errorf("AK certificate has invalid version %d; only version 3 is allowed", c.Version)
+	case c.Subject.String() != "":
+		return errors.Errorf("AK certificate subject must be empty; got %q", c.Subject)
+	case c.IsCA:
+		return errors.New("AK certificate must not be a CA")
+	case !slices.ContainsFunc(c.UnknownExtKeyUsage, oidTCGKpAIKCertificate.Equal):
+		return errors.New("AK certificate is missing Extended Key Usage value tcg-kp-AIKCertificate (2.23.133.8.3)")
+	default:
+		return nil
+	}
+}
+
+// AuthorizeRevoke returns an error if the provisioner does not have rights to
+// revoke the certificate with serial number in the `sub` property.
+func (p *TPMAttestation) AuthorizeRevoke(_ context.Context, token string) error {
+	_, err := p.authorizeToken(token, p.ctl.Audiences.Revoke)
+	return errs.Wrap(http.StatusInternalServerError, err, "tpm.AuthorizeRevoke")
+}
+
+// AuthorizeSign validates the given token.
+func (p *TPMAttestation) AuthorizeSign(ctx context.Context, token string) ([]SignOption, error) {
+	claims, err := p.authorizeToken(token, p.ctl.Audiences.Sign)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "tpm.AuthorizeSign")
+	}
+
+	if len(claims.SANs) == 0 {
+		claims.SANs = []string{claims.Subject}
+	}
+
+	// Certificate templates
+	data := x509util.CreateTemplateData(claims.Subject, claims.SANs)
+	if v, err := unsafeParseSigned(token); err == nil {
+		data.SetToken(v)
+	}
+
+	// The AK certificate will be available using the template variable
+	// AuthorizationCrt.
+	akCert := claims.attested.Certificate
+	data.SetAuthorizationCertificate(akCert)
+	data.SetAuthorizationCertificateChain(claims.attested.VerifiedChains[0])
+
+	templateOptions, err := TemplateOptions(p.Options, data)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "tpm.AuthorizeSign")
+	}
+
+	var permanentIdentifier string
+	if len(claims.attested.PermanentIdentifiers) > 0 {
+		permanentIdentifier = claims.attested.PermanentIdentifiers[0]
+	}
+
+	signOptions := []SignOption{
+		p,
+		templateOptions,
+		AttestationData{PermanentIdentifier: permanentIdentifier},
+		// modifiers / withOptions
+		newProvisionerExtensionOption(TypeTPMAttestation, p.Name, "").WithControllerOptions(p.ctl),
+		profileDefaultDuration(p.ctl.Claimer.DefaultTLSCertDuration()),
+		// validators
+		attestedPublicKeyValidator{claims.attested.PublicKey},
+		newDefaultSANsValidator(ctx, claims.SANs),
+		defaultPublicKeyValidator{},
+		newValidityValidator(p.ctl.Claimer.MinTLSCertDuration(), p.ctl.Claimer.MaxTLSCertDuration()),
+		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
+		p.ctl.newWebhookController(data, linkedca.Webhook_X509),
+	}
+
+	// Common name validators or modifiers
+	return append(signOptions, newCommonNameOptions(
+		p.Options.GetX509Options().GetCommonNameMode(),
+		[]string{claims.Subject},
+	)...), nil
+}
+
+// AuthorizeRenew returns an error if the renewal is disabled.
+func (p *TPMAttestation) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) error {
+	return p.ctl.AuthorizeRenew(ctx, cert)
+}
+
+// attestedPublicKeyValidator validates that the key in the certificate request
+// is the attested key.
+type attestedPublicKeyValidator struct {
+	key crypto.PublicKey
+}
+
+// Valid checks that the certificate request public key is the attested key.
+func (v attestedPublicKeyValidator) Valid(req *x509.CertificateRequest) error {
+	if !keyutil.Equal(v.key, req.PublicKey) {
+		return errs.Forbidden("certificate request public key does not match the attested key")
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+)
+
+func TestTPMAttestation_Init(t *testing.T) {
+	roots, err := os.ReadFile("./testdata/certs/root_ca.crt")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		p       *TPMAttestation
+		wantErr bool
+	}{
+		{"ok", &TPMAttestation{Type: "TPMAttestation", Name: "tpm", Roots: roots}, false},
+		{"fail type", &TPMAttestation{Name: "tpm", Roots: roots}, true},
+		{"fail name", &TPMAttestation{Type: "TPMAttestation", Roots: roots}, true},
+		{"fail roots empty", &TPMAttestation{Type: "TPMAttestation", Name: "tpm"}, true},
+		{"fail roots", &TPMAttestation{Type: "TPMAttestation", Name: "tpm", Roots: []byte("foo")}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences})
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "tpm/tpm", tt.p.GetID())
+			assert.Equal(t, TypeTPMAttestation, tt.p.GetType())
+		})
+	}
+}
+
+func TestTPMAttestation_authorizeToken(t *testing.T) {
+	roots, err := os.ReadFile("./testdata/certs/root_ca.crt")
+	require.NoError(t, err)
+	p := &TPMAttestation{Type: "TPMAttestation", Name: "tpm", Roots: roots}
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+
+	jwk, err := generateJSONWebKey()
+	require.NoError(t, err)
+	newToken := func(att *tpmAttestationStatement) string {
+		sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: jwk.Key}, new(jose.SignerOptions).WithType("JWT"))
+		require.NoError(t, err)
+		now := time.Now()
+		tok, err := jose.Signed(sig).Claims(tpmPayload{
+			Claims: jose.Claims{
+				Issuer:   "tpm",
+				Subject:  "server.example.com",
+				Audience: []string{testAudiences.Sign[0] + "#" + p.GetIDForToken()},
+				Expiry:   jose.NewNumericDate(now.Add(time.Minute)),
+			},
+			Attestation: att,
+		}).CompactSerialize()
+		require.NoError(t, err)
+		return tok
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"fail token", "foo"},
+		{"fail missing attestation", newToken(nil)},
+		{"fail version", newToken(&tpmAttestationStatement{Version: "1.2"})},
+		{"fail x5c empty", newToken(&tpmAttestationStatement{Version: "2.0"})},
+		{"fail x5c", newToken(&tpmAttestationStatement{Version: "2.0", X5C: [][]byte{[]byte("foo")}})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := p.AuthorizeSign(context.Background(), tt.token)
+			assertStatusCode(t, err, http.StatusUnauthorized)
+		})
+	}
+}
+
+func Test_validateTPMAKCertificate(t *testing.T) {
+	tests := []struct {
+		name    string
+		crt     *x509.Certificate
+		wantErr bool
+	}{
+		{"ok", &x509.Certificate{Version: 3, UnknownExtKeyUsage: []asn1.ObjectIdentifier{oidTCGKpAIKCertificate}}, false},
+		{"fail version", &x509.Certificate{Version: 1, UnknownExtKeyUsage: []asn1.ObjectIdentifier{oidTCGKpAIKCertificate}}, true},
+		{"fail subject", &x509.Certificate{Version: 3, Subject: pkix.Name{CommonName: "ak"}, UnknownExtKeyUsage: []asn1.ObjectIdentifier{oidTCGKpAIKCertificate}}, true},
+		{"fail ca", &x509.Certificate{Version: 3, IsCA: true, UnknownExtKeyUsage: []asn1.ObjectIdentifier{oidTCGKpAIKCertificate}}, true},
+		{"fail extKeyUsage", &x509.Certificate{Version: 3}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateTPMAKCertificate(tt.crt)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+//go:build tpmsimulator
+// +build tpmsimulator
+
+package provisioner
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/smallstep/go-attestation/attest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/minica"
+	"go.step.sm/crypto/tpm"
+	"go.step.sm/crypto/tpm/simulator"
+	tpmstorage "go.step.sm/crypto/tpm/storage"
+	"go.step.sm/crypto/x509util"
+)
+
+func newSimulatedTPM(t *testing.T) *tpm.TPM {
+	t.Helper()
+	sim, err := simulator.New()
+	require.NoError(t, err)
+	require.NoError(t, sim.Open())
+	t.Cleanup(func() {
+		assert.NoError(t, sim.Close())
+	})
+	stpm, err := tpm.New(tpm.WithSimulator(sim), tpm.WithStore(tpmstorage.NewDirstore(t.TempDir())))
+	require.NoError(t, err)
+	return stpm
+}
+
+// mustAttestTPMKey creates a key attested by a simulated TPM, and returns the
+// attestation statement, the signer of the attested key and the root of the
+// AK certificate.
+func mustAttestTPMKey(t *testing.T, permanentIdentifier string) (*tpmAttestationStatement, crypto.Signer, *x509.Certificate) {
+	t.Helper()
+	ctx := context.Background()
+	aca, err := minica.New(
+		minica.WithName("TPM Testing"),
+		minica.WithGetSignerFunc(func() (crypto.Signer, error) {
+			return keyutil.GenerateSigner("RSA", "", 2048)
+		}),
+	)
+	require.NoError(t, err)
+
+	stpm := newSimulatedTPM(t)
+	ak, err := stpm.CreateAK(ctx, "ak")
+	require.NoError(t, err)
+	ap, err := ak.AttestationParameters(ctx)
+	require.NoError(t, err)
+	akp, err := attest.ParseAKPublic(attest.TPMVersion20, ap.Public)
+	require.NoError(t, err)
+
+	// The AK certificate has an empty subject, so the subject alternative
+	// name extension is critical.
+	rawValue, err := x509util.SubjectAlternativeName{
+		Type: x509util.PermanentIdentifierType, Value: permanentIdentifier,
+	}.RawValue()
+	require.NoError(t, err)
+	sanValue, err := asn1.Marshal([]asn1.RawValue{rawValue})
+	require.NoError(t, err)
+	akCert, err := aca.Sign(&x509.Certificate{
+		PublicKey:          akp.Public,
+		UnknownExtKeyUsage: []asn1.ObjectIdentifier{oidTCGKpAIKCertificate},
+		ExtraExtensions: []pkix.Extension{
+			{Id: oidTPMSubjectAlternativeName, Critical: true, Value: sanValue},
+		},
+	})
+	require.NoError(t, err)
+
+	key, err := stpm.AttestKey(ctx, "ak", "key", tpm.AttestKeyConfig{Algorithm: "RSA", Size: 2048})
+	require.NoError(t, err)
+	signer, err := key.Signer(ctx)
+	require.NoError(t, err)
+	params, err := key.CertificationParameters(ctx)
+	require.NoError(t, err)
+
+	return &tpmAttestationStatement{
+		Version:   "2.0",
+		Algorithm: tpmAlgRS256,
+		X5C:       [][]byte{akCert.Raw, aca.Intermediate.Raw},
+		PubArea:   params.Public,
+		CertInfo:  params.CreateAttestation,
+		Signature: params.CreateSignature,
+	}, signer, aca.Root
+}
+
+func newTPMAttestationToken(t *testing.T, signer crypto.Signer, att *tpmAttestationStatement, iss, aud, sub string) string {
+	t.Helper()
+	so := new(jose.SignerOptions)
+	so.WithType("JWT")
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: jose.NewOpaqueSigner(signer)}, so)
+	require.NoError(t, err)
+	now := time.Now()
+	tok, err := jose.Signed(sig).Claims(tpmPayload{
+		Claims: jose.Claims{
+			ID:        "the-jti",
+			Issuer:    iss,
+			Subject:   sub,
+			Audience:  []string{aud},
+			IssuedAt:  jose.NewNumericDate(now),
+			NotBefore: jose.NewNumericDate(now),
+			Expiry:    jose.NewNumericDate(now.Add(5 * time.Minute)),
+		},
+		Attestation: att,
+	}).CompactSerialize()
+	require.NoError(t, err)
+	return tok
+}
+
+func TestTPMAttestation_AuthorizeSign(t *testing.T) {
+	att, signer, root := mustAttestTPMKey(t, "device-1")
+	other, err := keyutil.GenerateSigner("RSA", "", 2048)
+	require.NoError(t, err)
+
+	p := &TPMAttestation{
+		Type:  "TPMAttestation",
+		Name:  "my-tpm",
+		Roots: encodeTPMTestCertificate(root),
+	}
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+	aud := testAudiences.Sign[0] + "#" + p.GetIDForToken()
+
+	t.Run("ok", func(t *testing.T) {
+		signOpts, err := p.AuthorizeSign(context.Background(), newTPMAttestationToken(t, signer, att, "my-tpm", aud, "server.example.com"))
+		require.NoError(t, err)
+		assert.Contains(t, signOpts, AttestationData{PermanentIdentifier: "device-1"})
+
+		var validator attestedPublicKeyValidator
+		for _, op := range signOpts {
+			if v, ok := op.(attestedPublicKeyValidator); ok {
+				validator = v
+			}
+		}
+		csr, err := x509util.CreateCertificateRequest("server.example.com", []string{"server.example.com"}, signer)
+		require.NoError(t, err)
+		assert.NoError(t, validator.Valid(csr))
+		csr, err = x509util.CreateCertificateRequest("server.example.com", []string{"server.example.com"}, other)
+		require.NoError(t, err)
+		assertStatusCode(t, validator.Valid(csr), http.StatusForbidden)
+	})
+
+	t.Run("ok revoke", func(t *testing.T) {
+		assert.NoError(t, p.AuthorizeRevoke(context.Background(), newTPMAttestationToken(t, signer, att, "my-tpm",
+			testAudiences.Revoke[0]+"#"+p.GetIDForToken(), "server.example.com")))
+	})
+
+	t.Run("fail signer", func(t *testing.T) {
+		_, err := p.AuthorizeSign(context.Background(), newTPMAttestationToken(t, other, att, "my-tpm", aud, "server.example.com"))
+		assertStatusCode(t, err, http.StatusUnauthorized)
+	})
+
+	t.Run("fail issuer", func(t *testing.T) {
+		_, err := p.AuthorizeSign(context.Background(), newTPMAttestationToken(t, signer, att, "other", aud, "server.example.com"))
+		assertStatusCode(t, err, http.StatusUnauthorized)
+	})
+
+	t.Run("fail roots", func(t *testing.T) {
+		ca, err := minica.New()
+		require.NoError(t, err)
+		o := &TPMAttestation{Type: "TPMAttestation", Name: "my-tpm", Roots: encodeTPMTestCertificate(ca.Root)}
+		require.NoError(t, o.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+		_, err = o.AuthorizeSign(context.Background(), newTPMAttestationToken(t, signer, att, "my-tpm", aud, "server.example.com"))
+		assertStatusCode(t, err, http.StatusUnauthorized)
+	})
+
+	t.Run("fail certification", func(t *testing.T) {
+		sig := make([]byte, len(att.Signature))
+		_, err := rand.Read(sig)
+		require.NoError(t, err)
+		_, err = p.AuthorizeSign(context.Background(), newTPMAttestationToken(t, signer, &tpmAttestationStatement{
+			Version: att.Version, Algorithm: att.Algorithm, X5C: att.X5C,
+			PubArea: att.PubArea, CertInfo: att.CertInfo, Signature: sig,
+		}, "my-tpm", aud, "server.example.com"))
+		assertStatusCode(t, err, http.StatusUnauthorized)
+	})
+
+	t.Run("fail permanentIdentifiers", func(t *testing.T) {
+		o := &TPMAttestation{Type: "TPMAttestation", Name: "my-tpm", Roots: p.Roots, PermanentIdentifiers: []string{"device-2"}}
+		require.NoError(t, o.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+		_, err := o.AuthorizeSign(context.Background(), newTPMAttestationToken(t, signer, att, "my-tpm", aud, "server.example.com"))
+		assertStatusCode(t, err, http.StatusForbidden)
+	})
+}
+
+func encodeTPMTestCertificate(crt *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: crt.Raw})
+}
@@ -1014,6 +1014,12 @@ func generateAzureToken(sub, iss, aud, tenantID, subscriptionID, resourceGroup,
 		xmsMirID = fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Compute/virtualMachines/%s", subscriptionID, resourceGroup, resourceName)
 	} else if resourceType == "uai" {
 		xmsMirID = fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.ManagedIdentity/userAssignedIdentities/%s", subscriptionID, resourceGroup, resourceName)
+	} else if resourceType == "vmss" {
+		xmsMirID = fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Compute/virtualMachineScaleSets/%s", subscriptionID, resourceGroup, resourceName)
+	} else if resourceType == "vmss-instance" {
+		xmsMirID = fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Compute/virtualMachineScaleSets/%s/virtualMachines/0", subscriptionID, resourceGroup, resourceName)
+	} else if resourceType == "arc" {
+		xmsMirID = fmt.Sprintf("/subscriptions/%s/resourcegroups/%s/providers/Microsoft.HybridCompute/machines/%s", subscriptionID, resourceGroup, resourceName)
 	}
 
 	claims := azurePayload{
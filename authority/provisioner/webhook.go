@@ -5,12 +5,17 @@ import (
 	"context"
 	"crypto/hmac"
 	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"slices"
+	"sync"
 	"text/template"
 	"time"
 
@@ -18,11 +23,363 @@ import (
 	"github.com/smallstep/certificates/middleware/requestid"
 	"github.com/smallstep/certificates/templates"
 	"github.com/smallstep/certificates/webhook"
+	"go.step.sm/crypto/kms"
+	kmsapi "go.step.sm/crypto/kms/apiv1"
+	"go.step.sm/crypto/pemutil"
 	"go.step.sm/linkedca"
+	"golang.org/x/crypto/ssh"
 )
 
 var ErrWebhookDenied = errors.New("webhook server did not allow request")
 
+// ErrWebhookCertificateChanged is returned when the certificate presented by a
+// webhook server does not match the one pinned on first use.
+var ErrWebhookCertificateChanged = errors.New("webhook server certificate does not match the pinned certificate")
+
+// WebhookTOFU is the trust-on-first-use mode used to verify the certificate of
+// a webhook server.
+type WebhookTOFU string
+
+const (
+	// WebhookTOFUStrict pins the certificate of the webhook server on first use
+	// and fails the webhook if the certificate changes.
+	WebhookTOFUStrict WebhookTOFU = "strict"
+	// WebhookTOFUWarn pins the certificate of the webhook server on first use
+	// and, if the certificate changes, logs a warning and pins the new one. The
+	// new certificate is not verified, so it can be a self-signed one.
+	WebhookTOFUWarn WebhookTOFU = "warn"
+)
+
+// Validate returns an error if the trust-on-first-use mode is not supported.
+func (m WebhookTOFU) Validate() error {
+	switch m {
+	case "", WebhookTOFUStrict, WebhookTOFUWarn:
+		return nil
+	default:
+		return fmt.Errorf("unsupported webhook tofu mode %q", m)
+	}
+}
+
+// ErrWebhookCircuitOpen is returned when a webhook is not called because its
+// circuit breaker is open.
+var ErrWebhookCircuitOpen = errors.New("webhook circuit breaker is open")
+
+// WebhookFallback is the behavior of a webhook with a circuit breaker when the
+// webhook server is not available.
+type WebhookFallback string
+
+const (
+	// WebhookFailClosed fails the request if the webhook server is not
+	// available. It's the default behavior.
+	WebhookFailClosed WebhookFallback = "fail-closed"
+	// WebhookFailOpen allows the request if the webhook server is not
+	// available, without any data from an enriching webhook.
+	WebhookFailOpen WebhookFallback = "fail-open"
+)
+
+const (
+	defaultWebhookFailureThreshold = 5
+	defaultWebhookOpenTimeout      = 30 * time.Second
+	webhookCacheMaxEntries         = 1000
+)
+
+// WebhookCache configures the caching of the webhook responses. Responses are
+// cached by the content of the request, so the same request to the same URL
+// within the TTL does not call the webhook server again.
+type WebhookCache struct {
+	TTL *Duration `json:"ttl"`
+}
+
+// Validate returns an error if the cache options are not valid.
+func (c *WebhookCache) Validate() error {
+	if c != nil && c.TTL.Value() <= 0 {
+		return errors.New("webhook cache ttl must be greater than 0")
+	}
+	return nil
+}
+
+// WebhookCircuitBreaker configures the circuit breaker of a webhook. After
+// FailureThreshold consecutive failures the webhook server is not called for
+// OpenTimeout, and the Fallback behavior is used instead. The Fallback is also
+// used when a request fails.
+type WebhookCircuitBreaker struct {
+	FailureThreshold int             `json:"failureThreshold,omitempty"`
+	OpenTimeout      *Duration       `json:"openTimeout,omitempty"`
+	Fallback         WebhookFallback `json:"fallback,omitempty"`
+}
+
+// Validate returns an error if the circuit breaker options are not valid.
+func (c *WebhookCircuitBreaker) Validate() error {
+	if c == nil {
+		return nil
+	}
+	switch {
+	case c.FailureThreshold < 0:
+		return errors.New("webhook circuitBreaker failureThreshold cannot be negative")
+	case c.OpenTimeout != nil && c.OpenTimeout.Value() < 0:
+		return errors.New("webhook circuitBreaker openTimeout cannot be negative")
+	}
+	switch c.Fallback {
+	case "", WebhookFailClosed, WebhookFailOpen:
+		return nil
+	default:
+		return fmt.Errorf("unsupported webhook circuitBreaker fallback %q", c.Fallback)
+	}
+}
+
+func (c *WebhookCircuitBreaker) failureThreshold() int {
+	if c.FailureThreshold > 0 {
+		return c.FailureThreshold
+	}
+	return defaultWebhookFailureThreshold
+}
+
+func (c *WebhookCircuitBreaker) openTimeout() time.Duration {
+	if d := c.OpenTimeout.Value(); d > 0 {
+		return d
+	}
+	return defaultWebhookOpenTimeout
+}
+
+// WebhookClientCertificate configures the client certificate used to
+// authenticate to the webhook server with mutual TLS, instead of the default
+// client certificate of the CA. The key can be stored in a KMS.
+type WebhookClientCertificate struct {
+	// Certificate is the path to a PEM file with the certificate chain, or a
+	// KMS URI if the KMS supports storing certificates.
+	Certificate string `json:"certificate"`
+	// Key is the KMS URI or the path to the private key.
+	Key string `json:"key"`
+	// Password is the password used to decrypt the private key, if any.
+	Password string `json:"password,omitempty"`
+}
+
+// Validate returns an error if the client certificate options are not valid.
+func (c *WebhookClientCertificate) Validate() error {
+	switch {
+	case c == nil:
+		return nil
+	case c.Certificate == "":
+		return errors.New("webhook clientCertificate certificate cannot be empty")
+	case c.Key == "":
+		return errors.New("webhook clientCertificate key cannot be empty")
+	default:
+		return nil
+	}
+}
+
+// load creates the tls.Certificate with the configured certificate chain and
+// private key.
+func (c *WebhookClientCertificate) load() (*tls.Certificate, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	opts := kms.Options{Type: kmsapi.SoftKMS}
+	if kmsType, err := kmsapi.TypeOf(c.Key); err == nil && kmsType != kmsapi.DefaultKMS {
+		opts = kms.Options{Type: kmsType, URI: c.Key}
+	}
+	km, done, err := getWebhookKeyManager(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed initializing kms: %w", err)
+	}
+	defer done()
+
+	var password []byte
+	if c.Password != "" {
+		password = []byte(c.Password)
+	}
+	signer, err := km.CreateSigner(&kmsapi.CreateSignerRequest{
+		SigningKey:       c.Key,
+		Password:         password,
+		PasswordPrompter: kmsapi.NonInteractivePasswordPrompter,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed creating webhook client signer: %w", err)
+	}
+
+	var chain []*x509.Certificate
+	if kmsType, err := kmsapi.TypeOf(c.Certificate); err == nil && kmsType != kmsapi.DefaultKMS {
+		switch m := km.(type) {
+		case kmsapi.CertificateChainManager:
+			chain, err = m.LoadCertificateChain(&kmsapi.LoadCertificateChainRequest{Name: c.Certificate})
+		case kmsapi.CertificateManager:
+			var cert *x509.Certificate
+			cert, err = m.LoadCertificate(&kmsapi.LoadCertificateRequest{Name: c.Certificate})
+			chain = []*x509.Certificate{cert}
+		default:
+			err = fmt.Errorf("%q does not support loading certificates", opts.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed loading webhook client certificate: %w", err)
+		}
+	} else if chain, err = pemutil.ReadCertificateBundle(c.Certificate); err != nil {
+		return nil, fmt.Errorf("failed reading webhook client certificate: %w", err)
+	}
+
+	cert := &tls.Certificate{
+		PrivateKey: signer,
+		Leaf:       chain[0],
+	}
+	for _, crt := range chain {
+		cert.Certificate = append(cert.Certificate, crt.Raw)
+	}
+	return cert, nil
+}
+
+// webhookKeyManagers stores the key managers of the webhook client
+// certificates indexed by the key URI. The signers created by a KMS might need
+// the KMS to be open, so they are created once and shared by all the
+// controllers, instead of creating a new one every time the provisioners are
+// loaded.
+var webhookKeyManagers = struct {
+	sync.Mutex
+	m map[string]kmsapi.KeyManager
+}{m: make(map[string]kmsapi.KeyManager)}
+
+// getWebhookKeyManager returns the key manager for the given options, and a
+// function that must be called once the signer has been created. The keys of
+// a softkms are loaded in memory, so the softkms is closed right away.
+func getWebhookKeyManager(opts kms.Options) (kmsapi.KeyManager, func(), error) {
+	if opts.Type == kmsapi.SoftKMS {
+		km, err := kms.New(context.Background(), opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		return km, func() { km.Close() }, nil
+	}
+
+	webhookKeyManagers.Lock()
+	defer webhookKeyManagers.Unlock()
+	if km, ok := webhookKeyManagers.m[opts.URI]; ok {
+		return km, func() {}, nil
+	}
+	km, err := kms.New(context.Background(), opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	webhookKeyManagers.m[opts.URI] = km
+	return km, func() {}, nil
+}
+
+// CloseWebhookKeyManagers closes the key managers used by the webhook client
+// certificates. It must only be called when the CA is shut down, after
+// stopping all the authorities using them, the signers of the webhooks cannot
+// be used after it.
+func CloseWebhookKeyManagers() error {
+	webhookKeyManagers.Lock()
+	defer webhookKeyManagers.Unlock()
+	var err error
+	for uri, km := range webhookKeyManagers.m {
+		if e := km.Close(); e != nil && err == nil {
+			err = fmt.Errorf("error closing %s: %w", uri, e)
+		}
+		delete(webhookKeyManagers.m, uri)
+	}
+	return err
+}
+
+// webhookCircuits stores the state of the circuit breakers, and webhookCaches
+// the cached responses, indexed by webhook id and name.
+var (
+	webhookCircuits sync.Map
+	webhookCaches   sync.Map
+)
+
+// webhookCircuit is the state of the circuit breaker of a webhook.
+type webhookCircuit struct {
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+}
+
+// allow returns true if the webhook server can be called. Once the open
+// timeout has passed, one request is allowed to check if the server is back.
+func (c *webhookCircuit) allow(now time.Time, threshold int, openTimeout time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.failures < threshold {
+		return true
+	}
+	if now.Sub(c.openedAt) >= openTimeout {
+		c.openedAt = now
+		return true
+	}
+	return false
+}
+
+func (c *webhookCircuit) success() {
+	c.mu.Lock()
+	c.failures = 0
+	c.mu.Unlock()
+}
+
+func (c *webhookCircuit) failure(now time.Time, threshold int) {
+	c.mu.Lock()
+	c.failures++
+	if c.failures >= threshold {
+		c.openedAt = now
+	}
+	c.mu.Unlock()
+}
+
+type webhookCacheEntry struct {
+	resp      *webhook.ResponseBody
+	expiresAt time.Time
+}
+
+// webhookCache is a cache of webhook responses indexed by the hash of the URL
+// and request.
+type webhookCache struct {
+	mu      sync.Mutex
+	entries map[string]webhookCacheEntry
+}
+
+func (c *webhookCache) get(key string, now time.Time) (*webhook.ResponseBody, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok || !now.Before(e.expiresAt) {
+		return nil, false
+	}
+	return e.resp, true
+}
+
+func (c *webhookCache) set(key string, resp *webhook.ResponseBody, expiresAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]webhookCacheEntry)
+	}
+	// Remove the expired entries before adding a new one, and drop the cache
+	// if it's full.
+	if len(c.entries) >= webhookCacheMaxEntries {
+		now := time.Now()
+		for k, e := range c.entries {
+			if !now.Before(e.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= webhookCacheMaxEntries {
+			c.entries = make(map[string]webhookCacheEntry)
+		}
+	}
+	c.entries[key] = webhookCacheEntry{resp: resp, expiresAt: expiresAt}
+}
+
+// webhookPins stores the SHA-256 fingerprints of the webhook server
+// certificates seen on first use, indexed by webhook id and host. It caches
+// the pins of the WebhookPinStore, if configured.
+var webhookPins sync.Map
+
+// WebhookPinStore is the interface used to persist the fingerprints of the
+// webhook server certificates pinned on first use, so they survive restarts.
+// GetWebhookPin returns an empty string if the key is not pinned.
+type WebhookPinStore interface {
+	GetWebhookPin(key string) (string, error)
+	StoreWebhookPin(key, fingerprint string) error
+}
+
 type WebhookSetter interface {
 	SetWebhook(string, any)
 }
@@ -33,6 +390,12 @@ type WebhookController struct {
 	certType     linkedca.Webhook_CertType
 	options      []webhook.RequestBodyOption
 	TemplateData WebhookSetter
+	sshChanges   []sshCertificateChanges
+}
+
+type sshCertificateChanges struct {
+	webhook string
+	changes *webhook.SSHCertificateChanges
 }
 
 // Enrich fetches data from remote servers and adds returned data to the
@@ -68,6 +431,43 @@ func (wc *WebhookController) Enrich(ctx context.Context, req *webhook.RequestBod
 			return ErrWebhookDenied
 		}
 		wc.TemplateData.SetWebhook(wh.Name, resp.Data)
+		if resp.SSH != nil && req.SSHCertificateRequest != nil {
+			wc.sshChanges = append(wc.sshChanges, sshCertificateChanges{
+				webhook: wh.Name,
+				changes: resp.SSH,
+			})
+		}
+	}
+	return nil
+}
+
+// ModifySSHCertificate applies the principals and extensions returned by the
+// enriching webhooks to the SSH certificate. The changes are applied in the
+// order of the webhooks, before the provisioner modifiers and validators, so
+// the result is still subject to the provisioner constraints and policies.
+func (wc *WebhookController) ModifySSHCertificate(cert *ssh.Certificate) error {
+	if wc == nil {
+		return nil
+	}
+	for _, c := range wc.sshChanges {
+		// The principals are copied so the certificate does not share its
+		// slice with the webhook response.
+		if c.changes.Principals != nil {
+			cert.ValidPrincipals = slices.Clone(c.changes.Principals)
+		}
+		cert.ValidPrincipals = append(slices.Clone(cert.ValidPrincipals), c.changes.AddPrincipals...)
+		if len(c.changes.Extensions) == 0 {
+			continue
+		}
+		if cert.CertType != ssh.UserCert {
+			return fmt.Errorf("webhook %q cannot set extensions on host certificates", c.webhook)
+		}
+		if cert.Extensions == nil {
+			cert.Extensions = make(map[string]string, len(c.changes.Extensions))
+		}
+		for k, v := range c.changes.Extensions {
+			cert.Extensions[k] = v
+		}
 	}
 	return nil
 }
@@ -117,16 +517,222 @@ func (wc *WebhookController) isCertTypeOK(wh *Webhook) bool {
 	return wc.certType.String() == wh.CertType
 }
 
+// webhookNotifyAttempts is the number of times a notification is sent before
+// writing it to the dead-letter log, and webhookNotifyBackoff the initial
+// delay between attempts, doubled after each one. webhookNotifyWorkers is the
+// number of notifications sent at the same time, and webhookNotifyQueueSize
+// the number of notifications waiting to be sent.
+var (
+	webhookNotifyAttempts  = 5
+	webhookNotifyBackoff   = time.Second
+	webhookNotifyWorkers   = 8
+	webhookNotifyQueueSize = 1024
+)
+
+// errWebhookNotifierStopped and errWebhookNotifyQueueFull are the errors
+// written to the dead-letter log for the notifications that are not sent.
+var (
+	errWebhookNotifierStopped = errors.New("webhook notifier is stopped")
+	errWebhookNotifyQueueFull = errors.New("webhook notification queue is full")
+)
+
+type webhookNotification struct {
+	ctx     context.Context
+	webhook *Webhook
+	req     *webhook.RequestBody
+}
+
+// WebhookNotifier sends the events of the notifying webhooks, like the
+// certificate issued one, in the background, so the issuance is not blocked.
+// The notifications are added to a bounded queue and sent by a fixed number of
+// workers. Failed requests are retried with exponential backoff, and the
+// notifications that cannot be delivered or queued are written to the
+// dead-letter log.
+type WebhookNotifier struct {
+	client  *http.Client
+	queue   chan *webhookNotification
+	stop    chan struct{}
+	wg      sync.WaitGroup
+	mu      sync.RWMutex
+	stopped bool
+}
+
+// NewWebhookNotifier creates a new notifier and starts its workers. The
+// notifier must be stopped with Stop.
+func NewWebhookNotifier(client *http.Client) *WebhookNotifier {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	n := &WebhookNotifier{
+		client: client,
+		queue:  make(chan *webhookNotification, webhookNotifyQueueSize),
+		stop:   make(chan struct{}),
+	}
+	for i := 0; i < webhookNotifyWorkers; i++ {
+		n.wg.Add(1)
+		go n.run()
+	}
+	return n
+}
+
+func (n *WebhookNotifier) run() {
+	defer n.wg.Done()
+	for wn := range n.queue {
+		wn.webhook.notify(wn.ctx, n.client, wn.req, n.stop)
+	}
+}
+
+// Notify queues the event in req for the notifying webhooks for X.509
+// certificates. A nil notifier writes the notifications to the dead-letter
+// log.
+func (n *WebhookNotifier) Notify(ctx context.Context, webhooks []*Webhook, req *webhook.RequestBody) {
+	// The notifications must outlive the request, but keep its id.
+	notifyCtx := context.Background()
+	if requestID, ok := requestid.FromContext(ctx); ok {
+		notifyCtx = requestid.NewContext(notifyCtx, requestID)
+	}
+
+	if n != nil {
+		n.mu.RLock()
+		defer n.mu.RUnlock()
+	}
+	for _, wh := range webhooks {
+		if wh.Kind != linkedca.Webhook_NOTIFYING.String() || !isCertTypeOK(wh) {
+			continue
+		}
+		// DoWithContext modifies the body, so each webhook uses its own copy.
+		body := *req
+		if n == nil || n.stopped {
+			wh.writeDeadLetter(&body, errWebhookNotifierStopped)
+			continue
+		}
+		select {
+		case n.queue <- &webhookNotification{ctx: notifyCtx, webhook: wh, req: &body}:
+		default:
+			wh.writeDeadLetter(&body, errWebhookNotifyQueueFull)
+		}
+	}
+}
+
+// Stop stops the notifier and waits until the queued notifications are
+// processed. Each queued notification is sent once more without retries, and
+// written to the dead-letter log if it fails.
+func (n *WebhookNotifier) Stop() {
+	n.mu.Lock()
+	if n.stopped {
+		n.mu.Unlock()
+		return
+	}
+	n.stopped = true
+	close(n.stop)
+	close(n.queue)
+	n.mu.Unlock()
+	n.wg.Wait()
+}
+
+func (w *Webhook) notify(ctx context.Context, client *http.Client, req *webhook.RequestBody, stop <-chan struct{}) {
+	// The fail-open fallback of the circuit breaker would report the
+	// notification as sent, so notifications always fail closed, and the ones
+	// skipped by an open circuit are written to the dead-letter log.
+	wh := *w
+	if w.CircuitBreaker != nil {
+		cb := *w.CircuitBreaker
+		cb.Fallback = WebhookFailClosed
+		wh.CircuitBreaker = &cb
+	}
+
+	var err error
+	backoff := webhookNotifyBackoff
+retry:
+	for attempt := 1; attempt <= webhookNotifyAttempts; attempt++ {
+		whCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+		_, err = wh.DoWithContext(whCtx, client, req, nil)
+		cancel()
+		if err == nil {
+			return
+		}
+		if errors.Is(err, ErrWebhookCircuitOpen) || attempt == webhookNotifyAttempts {
+			break
+		}
+		select {
+		case <-stop:
+			break retry
+		case <-time.After(backoff):
+			backoff *= 2
+		}
+	}
+	w.writeDeadLetter(req, err)
+}
+
+// webhookDeadLetter is the entry written to the dead-letter log when a
+// notification cannot be delivered.
+type webhookDeadLetter struct {
+	Time    time.Time            `json:"time"`
+	Webhook string               `json:"webhook"`
+	URL     string               `json:"url"`
+	Error   string               `json:"error"`
+	Request *webhook.RequestBody `json:"request"`
+}
+
+// writeDeadLetter writes an undelivered notification to the DeadLetterLog
+// file of the webhook, or to the standard logger if it's not set.
+func (w *Webhook) writeDeadLetter(req *webhook.RequestBody, reqErr error) {
+	b, err := json.Marshal(webhookDeadLetter{
+		Time:    time.Now().UTC(),
+		Webhook: w.Name,
+		URL:     w.URL,
+		Error:   reqErr.Error(),
+		Request: req,
+	})
+	if err != nil {
+		log.Printf("webhook %q: error marshaling undelivered notification: %v", w.Name, err)
+		return
+	}
+
+	if w.DeadLetterLog != "" {
+		webhookDeadLetterMutex.Lock()
+		defer webhookDeadLetterMutex.Unlock()
+		f, err := os.OpenFile(w.DeadLetterLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err == nil {
+			_, err = f.Write(append(b, '\n'))
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}
+		if err == nil {
+			return
+		}
+		log.Printf("webhook %q: error writing dead-letter log: %v", w.Name, err)
+	}
+
+	log.Printf("webhook %q: undelivered notification: %s", w.Name, b)
+}
+
+var webhookDeadLetterMutex sync.Mutex
+
 type Webhook struct {
-	ID                   string `json:"id"`
-	Name                 string `json:"name"`
-	URL                  string `json:"url"`
-	Kind                 string `json:"kind"`
-	DisableTLSClientAuth bool   `json:"disableTLSClientAuth,omitempty"`
-	CertType             string `json:"certType"`
-	Secret               string `json:"-"`
-	BearerToken          string `json:"-"`
-	BasicAuth            struct {
+	ID                   string      `json:"id"`
+	Name                 string      `json:"name"`
+	URL                  string      `json:"url"`
+	Kind                 string      `json:"kind"`
+	DisableTLSClientAuth bool        `json:"disableTLSClientAuth,omitempty"`
+	TOFU                 WebhookTOFU `json:"tofu,omitempty"`
+	CertType             string      `json:"certType"`
+	// Cache configures the caching of the responses of the webhook.
+	Cache *WebhookCache `json:"cache,omitempty"`
+	// CircuitBreaker configures the behavior when the webhook server fails.
+	CircuitBreaker *WebhookCircuitBreaker `json:"circuitBreaker,omitempty"`
+	// ClientCertificate configures the certificate used to authenticate to
+	// the webhook server.
+	ClientCertificate *WebhookClientCertificate `json:"clientCertificate,omitempty"`
+	clientCertificate *tls.Certificate
+	pinStore          WebhookPinStore
+	// DeadLetterLog is the path of the file where notifications that cannot
+	// be delivered are appended. If empty, they are logged.
+	DeadLetterLog string `json:"deadLetterLog,omitempty"`
+	Secret        string `json:"-"`
+	BearerToken   string `json:"-"`
+	BasicAuth     struct {
 		Username string
 		Password string
 	} `json:"-"`
@@ -143,6 +749,69 @@ func (w *Webhook) DoWithContext(ctx context.Context, client *http.Client, reqBod
 	}
 	url := buf.String()
 
+	// Return the cached response if the same request has been sent before.
+	var cache *webhookCache
+	var cacheKey string
+	if w.Cache != nil {
+		reqBody.Timestamp = time.Time{}
+		reqBytes, err := json.Marshal(reqBody)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(append([]byte(url+"\n"), reqBytes...))
+		cacheKey = hex.EncodeToString(sum[:])
+		v, _ := webhookCaches.LoadOrStore(w.stateKey(), &webhookCache{})
+		cache = v.(*webhookCache)
+		if resp, ok := cache.get(cacheKey, time.Now()); ok {
+			return resp, nil
+		}
+	}
+
+	if w.CircuitBreaker == nil {
+		resp, err := w.do(ctx, client, url, reqBody)
+		if err == nil && cache != nil {
+			cache.set(cacheKey, resp, time.Now().Add(w.Cache.TTL.Value()))
+		}
+		return resp, err
+	}
+
+	threshold := w.CircuitBreaker.failureThreshold()
+	v, _ := webhookCircuits.LoadOrStore(w.stateKey(), &webhookCircuit{})
+	circuit := v.(*webhookCircuit)
+	if !circuit.allow(time.Now(), threshold, w.CircuitBreaker.openTimeout()) {
+		return w.fallback(ErrWebhookCircuitOpen)
+	}
+
+	resp, err := w.do(ctx, client, url, reqBody)
+	if err != nil {
+		circuit.failure(time.Now(), threshold)
+		return w.fallback(err)
+	}
+	circuit.success()
+	if cache != nil {
+		cache.set(cacheKey, resp, time.Now().Add(w.Cache.TTL.Value()))
+	}
+	return resp, nil
+}
+
+// stateKey returns the key used to store the state of the circuit breaker and
+// the cache of a webhook.
+func (w *Webhook) stateKey() string {
+	return w.ID + "|" + w.Name
+}
+
+// fallback returns the response used when the webhook server is not
+// available. Errors verifying the pinned certificate of the server always fail
+// the request.
+func (w *Webhook) fallback(err error) (*webhook.ResponseBody, error) {
+	if w.CircuitBreaker.Fallback == WebhookFailOpen && !errors.Is(err, ErrWebhookCertificateChanged) {
+		log.Printf("WARNING: webhook %q is not available, allowing the request: %v", w.Name, err)
+		return &webhook.ResponseBody{Allow: true}, nil
+	}
+	return nil, err
+}
+
+func (w *Webhook) do(ctx context.Context, client *http.Client, url string, reqBody *webhook.RequestBody) (*webhook.ResponseBody, error) {
 	/*
 		Sending the token to the webhook server is a security risk. A K8sSA
 		token can be reused multiple times. The webhook can misuse it to get
@@ -191,15 +860,32 @@ retry:
 		req.SetBasicAuth(w.BasicAuth.Username, w.BasicAuth.Password)
 	}
 
-	if w.DisableTLSClientAuth {
+	if w.DisableTLSClientAuth || w.TOFU != "" || w.clientCertificate != nil {
 		transport, ok := client.Transport.(*http.Transport)
 		if !ok {
-			return nil, errors.New("client transport is not a *http.Transport")
+			if client.Transport != nil {
+				return nil, errors.New("client transport is not a *http.Transport")
+			}
+			transport = http.DefaultTransport.(*http.Transport)
 		}
 		transport = transport.Clone()
 		tlsConfig := transport.TLSClientConfig.Clone()
-		tlsConfig.GetClientCertificate = nil
-		tlsConfig.Certificates = nil
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		if w.DisableTLSClientAuth {
+			tlsConfig.GetClientCertificate = nil
+			tlsConfig.Certificates = nil
+		} else if w.clientCertificate != nil {
+			tlsConfig.GetClientCertificate = nil
+			tlsConfig.Certificates = []tls.Certificate{*w.clientCertificate}
+		}
+		if w.TOFU != "" {
+			// The server certificate is verified against the pinned one
+			// instead of the trusted roots.
+			tlsConfig.InsecureSkipVerify = true //nolint:gosec // verified by VerifyConnection
+			tlsConfig.VerifyConnection = w.verifyPinnedCertificate(req.URL.Host)
+		}
 		transport.TLSClientConfig = tlsConfig
 		client = &http.Client{
 			Transport: transport,
@@ -207,7 +893,7 @@ retry:
 	}
 	resp, err := client.Do(req)
 	if err != nil {
-		if errors.Is(err, context.DeadlineExceeded) {
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrWebhookCertificateChanged) {
 			return nil, err
 		} else if retries > 0 {
 			retries--
@@ -237,3 +923,65 @@ retry:
 
 	return respBody, nil
 }
+
+// verifyPinnedCertificate returns a function that verifies the certificate
+// presented by the webhook server using trust-on-first-use. The fingerprint of
+// the first certificate seen for the webhook and host is pinned, and
+// subsequent connections must present the same certificate. In warn mode a
+// different certificate is logged and pinned.
+func (w *Webhook) verifyPinnedCertificate(host string) func(tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return errors.New("webhook server did not present a certificate")
+		}
+		sum := sha256.Sum256(cs.PeerCertificates[0].Raw)
+		fingerprint := hex.EncodeToString(sum[:])
+
+		key := w.ID + "|" + host
+		pinned, err := w.loadPin(key)
+		if err != nil {
+			return err
+		}
+		if pinned == "" {
+			return w.storePin(key, fingerprint)
+		}
+		if pinned == fingerprint {
+			return nil
+		}
+		if w.TOFU != WebhookTOFUWarn {
+			return fmt.Errorf("%w: webhook %q for %s presented %s", ErrWebhookCertificateChanged, w.Name, host, fingerprint)
+		}
+		log.Printf("WARNING: webhook %q server certificate for %s has changed: pinned %s, got %s", w.Name, host, pinned, fingerprint)
+		return w.storePin(key, fingerprint)
+	}
+}
+
+// loadPin returns the fingerprint pinned with the given key, or an empty
+// string if there is none.
+func (w *Webhook) loadPin(key string) (string, error) {
+	if v, ok := webhookPins.Load(key); ok {
+		return v.(string), nil
+	}
+	if w.pinStore == nil {
+		return "", nil
+	}
+	fingerprint, err := w.pinStore.GetWebhookPin(key)
+	if err != nil {
+		return "", errors.Wrap(err, "error loading webhook certificate pin")
+	}
+	if fingerprint != "" {
+		webhookPins.Store(key, fingerprint)
+	}
+	return fingerprint, nil
+}
+
+// storePin pins the fingerprint with the given key.
+func (w *Webhook) storePin(key, fingerprint string) error {
+	if w.pinStore != nil {
+		if err := w.pinStore.StoreWebhookPin(key, fingerprint); err != nil {
+			return errors.Wrap(err, "error storing webhook certificate pin")
+		}
+	}
+	webhookPins.Store(key, fingerprint)
+	return nil
+}
@@ -1,28 +1,43 @@
 package provisioner
 
 import (
+	"bytes"
 	"context"
+	"crypto"
 	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"go.step.sm/crypto/keyutil"
+	kmsapi "go.step.sm/crypto/kms/apiv1"
 	"go.step.sm/crypto/pemutil"
+	"go.step.sm/crypto/sshutil"
 	"go.step.sm/crypto/x509util"
 	"go.step.sm/linkedca"
+	"golang.org/x/crypto/ssh"
 
 	"github.com/smallstep/certificates/middleware/requestid"
 	"github.com/smallstep/certificates/webhook"
@@ -272,6 +287,89 @@ func TestWebhookController_Enrich(t *testing.T) {
 	}
 }
 
+func TestWebhookController_ModifySSHCertificate(t *testing.T) {
+	responses := map[string]*webhook.ResponseBody{
+		"/people":  {Allow: true, SSH: &webhook.SSHCertificateChanges{Principals: []string{"jane"}, Extensions: map[string]string{"permit-pty": "", "login@example.com": "jane"}}},
+		"/groups":  {Allow: true, SSH: &webhook.SSHCertificateChanges{AddPrincipals: []string{"admins"}}},
+		"/devices": {Allow: true, Data: map[string]any{"serial": "123"}},
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewEncoder(w).Encode(responses[r.URL.Path]))
+	}))
+	defer ts.Close()
+
+	newController := func() *WebhookController {
+		return &WebhookController{
+			client: http.DefaultClient,
+			webhooks: []*Webhook{
+				{Name: "people", URL: ts.URL + "/people", Kind: "ENRICHING"},
+				{Name: "groups", URL: ts.URL + "/groups", Kind: "ENRICHING"},
+				{Name: "devices", URL: ts.URL + "/devices", Kind: "ENRICHING"},
+			},
+			TemplateData: sshutil.TemplateData{},
+			certType:     linkedca.Webhook_SSH,
+		}
+	}
+	newRequest := func(t *testing.T) *webhook.RequestBody {
+		req, err := webhook.NewRequestBody(webhook.WithSSHCertificateRequest(sshutil.CertificateRequest{
+			Type: "user", KeyID: "jane@example.com", Principals: []string{"jane@example.com"},
+		}))
+		require.NoError(t, err)
+		return req
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		ctl := newController()
+		require.NoError(t, ctl.Enrich(context.Background(), newRequest(t)))
+		cert := &ssh.Certificate{
+			CertType:        ssh.UserCert,
+			ValidPrincipals: []string{"jane@example.com"},
+			Permissions:     ssh.Permissions{Extensions: map[string]string{"permit-pty": "", "permit-agent-forwarding": ""}},
+		}
+		require.NoError(t, ctl.ModifySSHCertificate(cert))
+		assert.Equal(t, []string{"jane", "admins"}, cert.ValidPrincipals)
+		assert.Equal(t, map[string]string{
+			"permit-pty":              "",
+			"permit-agent-forwarding": "",
+			"login@example.com":       "jane",
+		}, cert.Extensions)
+	})
+
+	t.Run("ok copy principals", func(t *testing.T) {
+		ctl := newController()
+		require.NoError(t, ctl.Enrich(context.Background(), newRequest(t)))
+		// The response has capacity for the added principals.
+		principals := append(make([]string, 0, 2), "jane")
+		ctl.sshChanges[0].changes.Principals = principals
+		cert := &ssh.Certificate{CertType: ssh.UserCert}
+		require.NoError(t, ctl.ModifySSHCertificate(cert))
+		assert.Equal(t, []string{"jane", "admins"}, cert.ValidPrincipals)
+		cert.ValidPrincipals[0] = "john"
+		assert.Equal(t, []string{"jane"}, principals)
+		assert.Equal(t, []string{"jane", ""}, principals[:2])
+	})
+
+	t.Run("ok x509", func(t *testing.T) {
+		ctl := newController()
+		require.NoError(t, ctl.Enrich(context.Background(), &webhook.RequestBody{}))
+		cert := &ssh.Certificate{CertType: ssh.UserCert, ValidPrincipals: []string{"jane@example.com"}}
+		require.NoError(t, ctl.ModifySSHCertificate(cert))
+		assert.Equal(t, []string{"jane@example.com"}, cert.ValidPrincipals)
+	})
+
+	t.Run("ok nil", func(t *testing.T) {
+		var ctl *WebhookController
+		assert.NoError(t, ctl.ModifySSHCertificate(&ssh.Certificate{}))
+	})
+
+	t.Run("fail host extensions", func(t *testing.T) {
+		ctl := newController()
+		require.NoError(t, ctl.Enrich(context.Background(), newRequest(t)))
+		err := ctl.ModifySSHCertificate(&ssh.Certificate{CertType: ssh.HostCert})
+		assert.EqualError(t, err, `webhook "people" cannot set extensions on host certificates`)
+	})
+}
+
 func TestWebhookController_Authorize(t *testing.T) {
 	cert, err := pemutil.ReadCertificate("testdata/certs/x5c-leaf.crt", pemutil.WithFirstBlock())
 	require.NoError(t, err)
@@ -622,3 +720,544 @@ func TestWebhook_Do(t *testing.T) {
 		require.Error(t, err)
 	})
 }
+
+func TestWebhook_Do_tofu(t *testing.T) {
+	csr := parseCertificateRequest(t, "testdata/certs/ecdsa.csr")
+
+	newServer := func() *httptest.Server {
+		return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"allow": true}`))
+		}))
+	}
+	do := func(t *testing.T, wh *Webhook, ts *httptest.Server, client *http.Client) error {
+		t.Helper()
+		reqBody, err := webhook.NewRequestBody(webhook.WithX509CertificateRequest(csr))
+		require.NoError(t, err)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		defer cancel()
+		wh.URL = ts.URL
+		_, err = wh.DoWithContext(ctx, client, reqBody, nil)
+		return err
+	}
+
+	tests := []struct {
+		name      string
+		tofu      WebhookTOFU
+		trusted   bool
+		expectErr error
+		expectLog bool
+	}{
+		{"strict", WebhookTOFUStrict, false, ErrWebhookCertificateChanged, false},
+		{"strict trusted", WebhookTOFUStrict, true, ErrWebhookCertificateChanged, false},
+		{"warn trusted", WebhookTOFUWarn, true, nil, true},
+		{"warn self-signed", WebhookTOFUWarn, false, nil, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			log.SetOutput(&buf)
+			t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+			wh := &Webhook{
+				ID:   "tofu-" + tc.name,
+				Name: "tofu",
+				TOFU: tc.tofu,
+			}
+
+			// First use pins the self-signed certificate.
+			ts := newServer()
+			require.NoError(t, do(t, wh, ts, http.DefaultClient))
+			require.NoError(t, do(t, wh, ts, http.DefaultClient))
+			addr := ts.Listener.Addr().String()
+			ts.Close()
+
+			// A server with a new certificate on the same address.
+			cert := mustSelfSignedCertificate(t)
+			ts = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"allow": true}`))
+			}))
+			ln, err := net.Listen("tcp", addr)
+			require.NoError(t, err)
+			ts.Listener = ln
+			ts.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+			ts.StartTLS()
+			defer ts.Close()
+
+			client := http.DefaultClient
+			if tc.trusted {
+				leaf, err := x509.ParseCertificate(cert.Certificate[0])
+				require.NoError(t, err)
+				roots := x509.NewCertPool()
+				roots.AddCert(leaf)
+				transport := http.DefaultTransport.(*http.Transport).Clone()
+				transport.TLSClientConfig = &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}
+				client = &http.Client{Transport: transport}
+			}
+
+			err = do(t, wh, ts, client)
+			if tc.expectErr != nil {
+				assert.ErrorIs(t, err, tc.expectErr)
+			} else {
+				assert.NoError(t, err)
+				// The new certificate is pinned.
+				require.NoError(t, do(t, wh, ts, http.DefaultClient))
+			}
+			assert.Equal(t, tc.expectLog, strings.Contains(buf.String(), "server certificate for "+addr+" has changed"))
+		})
+	}
+
+	t.Run("ok pin store", func(t *testing.T) {
+		store := &testWebhookPinStore{pins: map[string]string{}}
+		ts := newServer()
+		defer ts.Close()
+
+		wh := &Webhook{ID: "tofu-store", Name: "tofu", TOFU: WebhookTOFUStrict, pinStore: store}
+		require.NoError(t, do(t, wh, ts, http.DefaultClient))
+		key := "tofu-store|" + ts.Listener.Addr().String()
+		sum := sha256.Sum256(ts.Certificate().Raw)
+		assert.Equal(t, map[string]string{key: hex.EncodeToString(sum[:])}, store.pins)
+
+		// A pin loaded from the store is enforced.
+		store.pins = map[string]string{"tofu-stored|" + ts.Listener.Addr().String(): "bad-fingerprint"}
+		wh = &Webhook{ID: "tofu-stored", Name: "tofu", TOFU: WebhookTOFUStrict, pinStore: store}
+		assert.ErrorIs(t, do(t, wh, ts, http.DefaultClient), ErrWebhookCertificateChanged)
+	})
+
+	t.Run("fail pin store", func(t *testing.T) {
+		ts := newServer()
+		defer ts.Close()
+		wh := &Webhook{ID: "tofu-store-error", Name: "tofu", TOFU: WebhookTOFUStrict, pinStore: &testWebhookPinStore{err: errors.New("force")}}
+		assert.Error(t, do(t, wh, ts, http.DefaultClient))
+	})
+
+	t.Run("fail invalid mode", func(t *testing.T) {
+		assert.Error(t, WebhookTOFU("foo").Validate())
+	})
+}
+
+func TestWebhook_Do_cache(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		fmt.Fprintf(w, `{"allow": true, "data": {"call": %d}}`, n)
+	}))
+	defer ts.Close()
+
+	do := func(t *testing.T, wh *Webhook, cn string) *webhook.ResponseBody {
+		t.Helper()
+		reqBody, err := webhook.NewRequestBody(webhook.WithX509CertificateRequest(&x509.CertificateRequest{
+			Subject: pkix.Name{CommonName: cn},
+		}))
+		require.NoError(t, err)
+		resp, err := wh.DoWithContext(context.Background(), http.DefaultClient, reqBody, nil)
+		require.NoError(t, err)
+		return resp
+	}
+
+	ttl := &Duration{Duration: 50 * time.Millisecond}
+	wh := &Webhook{ID: "cache", Name: "cache", URL: ts.URL, Cache: &WebhookCache{TTL: ttl}}
+	assert.Equal(t, map[string]any{"call": float64(1)}, do(t, wh, "foo").Data)
+	assert.Equal(t, map[string]any{"call": float64(1)}, do(t, wh, "foo").Data)
+	assert.Equal(t, map[string]any{"call": float64(2)}, do(t, wh, "bar").Data)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, map[string]any{"call": float64(3)}, do(t, wh, "foo").Data)
+
+	// Without cache
+	wh = &Webhook{ID: "no-cache", Name: "no-cache", URL: ts.URL}
+	do(t, wh, "foo")
+	do(t, wh, "foo")
+	assert.Equal(t, int32(5), atomic.LoadInt32(&calls))
+
+	assert.NoError(t, (*WebhookCache)(nil).Validate())
+	assert.NoError(t, (&WebhookCache{TTL: ttl}).Validate())
+	assert.Error(t, (&WebhookCache{}).Validate())
+}
+
+func TestWebhook_Do_circuitBreaker(t *testing.T) {
+	var calls, failing int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"allow": true, "data": {"role": "admin"}}`))
+	}))
+	defer ts.Close()
+
+	do := func(t *testing.T, wh *Webhook) (*webhook.ResponseBody, error) {
+		t.Helper()
+		reqBody, err := webhook.NewRequestBody(webhook.WithX509CertificateRequest(&x509.CertificateRequest{}))
+		require.NoError(t, err)
+		return wh.DoWithContext(context.Background(), http.DefaultClient, reqBody, nil)
+	}
+
+	t.Run("fail-closed", func(t *testing.T) {
+		atomic.StoreInt32(&calls, 0)
+		atomic.StoreInt32(&failing, 1)
+		wh := &Webhook{ID: "circuit-closed", Name: "circuit", URL: ts.URL, CircuitBreaker: &WebhookCircuitBreaker{
+			FailureThreshold: 2,
+			OpenTimeout:      &Duration{Duration: 50 * time.Millisecond},
+		}}
+		for i := 0; i < 2; i++ {
+			_, err := do(t, wh)
+			assert.EqualError(t, err, "Webhook server responded with 400")
+		}
+		_, err := do(t, wh)
+		assert.ErrorIs(t, err, ErrWebhookCircuitOpen)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+		// After the timeout, a request is allowed and closes the circuit.
+		atomic.StoreInt32(&failing, 0)
+		time.Sleep(60 * time.Millisecond)
+		resp, err := do(t, wh)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]any{"role": "admin"}, resp.Data)
+		_, err = do(t, wh)
+		assert.NoError(t, err)
+		assert.Equal(t, int32(4), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("fail-open", func(t *testing.T) {
+		var buf bytes.Buffer
+		log.SetOutput(&buf)
+		t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+		atomic.StoreInt32(&calls, 0)
+		atomic.StoreInt32(&failing, 1)
+		wh := &Webhook{ID: "circuit-open", Name: "circuit", URL: ts.URL, CircuitBreaker: &WebhookCircuitBreaker{
+			FailureThreshold: 1,
+			OpenTimeout:      &Duration{Duration: time.Hour},
+			Fallback:         WebhookFailOpen,
+		}}
+		for i := 0; i < 3; i++ {
+			resp, err := do(t, wh)
+			require.NoError(t, err)
+			assert.Equal(t, &webhook.ResponseBody{Allow: true}, resp)
+		}
+		assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+		assert.Contains(t, buf.String(), `webhook "circuit" is not available, allowing the request: webhook circuit breaker is open`)
+	})
+
+	t.Run("validate", func(t *testing.T) {
+		assert.NoError(t, (*WebhookCircuitBreaker)(nil).Validate())
+		assert.NoError(t, (&WebhookCircuitBreaker{}).Validate())
+		assert.NoError(t, (&WebhookCircuitBreaker{Fallback: WebhookFailClosed}).Validate())
+		assert.Error(t, (&WebhookCircuitBreaker{FailureThreshold: -1}).Validate())
+		assert.Error(t, (&WebhookCircuitBreaker{OpenTimeout: &Duration{Duration: -time.Second}}).Validate())
+		assert.Error(t, (&WebhookCircuitBreaker{Fallback: "foo"}).Validate())
+	})
+}
+
+func TestWebhook_Do_clientCertificate(t *testing.T) {
+	csr := parseCertificateRequest(t, "testdata/certs/ecdsa.csr")
+	fooCert, err := pemutil.ReadCertificate("testdata/certs/foo.crt")
+	require.NoError(t, err)
+
+	var peerCert *x509.Certificate
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peerCert = r.TLS.PeerCertificates[0]
+		w.Write([]byte(`{"allow": true}`))
+	}))
+	defer ts.Close()
+	ts.TLS.ClientAuth = tls.RequireAnyClientCert
+
+	cc := &WebhookClientCertificate{
+		Certificate: "testdata/certs/foo.crt",
+		Key:         "testdata/secrets/foo.key",
+	}
+	require.NoError(t, cc.Validate())
+	cert, err := cc.load()
+	require.NoError(t, err)
+	assert.Equal(t, fooCert, cert.Leaf)
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{
+		InsecureSkipVerify: true,
+		Certificates:       []tls.Certificate{mustSelfSignedCertificate(t)},
+	}
+	client := &http.Client{Transport: transport}
+
+	wh := &Webhook{URL: ts.URL, ClientCertificate: cc, clientCertificate: cert}
+	reqBody, err := webhook.NewRequestBody(webhook.WithX509CertificateRequest(csr))
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	_, err = wh.DoWithContext(ctx, client, reqBody, nil)
+	require.NoError(t, err)
+	assert.Equal(t, fooCert, peerCert)
+
+	t.Run("fail", func(t *testing.T) {
+		assert.NoError(t, (*WebhookClientCertificate)(nil).Validate())
+		assert.Error(t, (&WebhookClientCertificate{Key: "testdata/secrets/foo.key"}).Validate())
+		assert.Error(t, (&WebhookClientCertificate{Certificate: "testdata/certs/foo.crt"}).Validate())
+
+		_, err := (&WebhookClientCertificate{Certificate: "testdata/certs/foo.crt", Key: "testdata/secrets/missing.key"}).load()
+		assert.Error(t, err)
+		_, err = (&WebhookClientCertificate{Certificate: "testdata/certs/missing.crt", Key: "testdata/secrets/foo.key"}).load()
+		assert.Error(t, err)
+		_, err = (&WebhookClientCertificate{Certificate: "softkms:name=foo.crt", Key: "testdata/secrets/foo.key"}).load()
+		assert.Error(t, err)
+
+		_, err = NewController(&JWK{}, nil, Config{Claims: globalProvisionerClaims}, &Options{Webhooks: []*Webhook{
+			{Name: "foo", DisableTLSClientAuth: true, ClientCertificate: cc},
+		}})
+		assert.Error(t, err)
+	})
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	backoff := webhookNotifyBackoff
+	webhookNotifyBackoff = time.Millisecond
+	t.Cleanup(func() { webhookNotifyBackoff = backoff })
+
+	leaf, err := pemutil.ReadCertificate("testdata/certs/foo.crt")
+	require.NoError(t, err)
+	req, err := webhook.NewRequestBody(webhook.WithCertificateIssued([]*x509.Certificate{leaf}, "JWK", "request-id"))
+	require.NoError(t, err)
+
+	var calls, failures int32
+	received := make(chan *webhook.RequestBody, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if r.URL.Path == "/fail" || (r.URL.Path == "/retry" && atomic.AddInt32(&failures, 1) < 3) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body := new(webhook.RequestBody)
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(body))
+		assert.Equal(t, "request-id", r.Header.Get("X-Request-Id"))
+		received <- body
+		w.Write([]byte(`{}`))
+	}))
+	defer ts.Close()
+
+	ctx := requestid.NewContext(context.Background(), "request-id")
+	deadLetterLog := filepath.Join(t.TempDir(), "dead-letter.log")
+
+	n := NewWebhookNotifier(nil)
+	t.Cleanup(n.Stop)
+
+	t.Run("ok", func(t *testing.T) {
+		atomic.StoreInt32(&calls, 0)
+		n.Notify(ctx, []*Webhook{
+			{Name: "notify", URL: ts.URL + "/ok", Kind: linkedca.Webhook_NOTIFYING.String()},
+			{Name: "retry", URL: ts.URL + "/retry", Kind: linkedca.Webhook_NOTIFYING.String(), CertType: linkedca.Webhook_X509.String()},
+			{Name: "enrich", URL: ts.URL + "/ok", Kind: linkedca.Webhook_ENRICHING.String()},
+			{Name: "ssh", URL: ts.URL + "/ok", Kind: linkedca.Webhook_NOTIFYING.String(), CertType: linkedca.Webhook_SSH.String()},
+		}, req)
+		for i := 0; i < 2; i++ {
+			select {
+			case body := <-received:
+				assert.Equal(t, webhook.EventCertificateIssued, body.Event)
+				assert.Equal(t, req.CertificateIssued, body.CertificateIssued)
+			case <-time.After(5 * time.Second):
+				t.Fatal("timeout waiting for notification")
+			}
+		}
+		assert.Equal(t, int32(4), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("dead-letter", func(t *testing.T) {
+		atomic.StoreInt32(&calls, 0)
+		n.Notify(ctx, []*Webhook{
+			{Name: "fail", URL: ts.URL + "/fail", Kind: linkedca.Webhook_NOTIFYING.String(), DeadLetterLog: deadLetterLog},
+		}, req)
+		var b []byte
+		require.Eventually(t, func() bool {
+			b, _ = os.ReadFile(deadLetterLog)
+			return bytes.HasSuffix(b, []byte("\n"))
+		}, 5*time.Second, 10*time.Millisecond)
+		assert.Equal(t, int32(webhookNotifyAttempts), atomic.LoadInt32(&calls))
+
+		var entry webhookDeadLetter
+		require.NoError(t, json.Unmarshal(b, &entry))
+		assert.Equal(t, "fail", entry.Webhook)
+		assert.Equal(t, ts.URL+"/fail", entry.URL)
+		assert.Equal(t, "Webhook server responded with 400", entry.Error)
+		assert.Equal(t, req.CertificateIssued, entry.Request.CertificateIssued)
+	})
+
+	readDeadLetters := func(t *testing.T, name string, want int) []webhookDeadLetter {
+		t.Helper()
+		var entries []webhookDeadLetter
+		require.Eventually(t, func() bool {
+			b, _ := os.ReadFile(name)
+			entries = entries[:0]
+			for _, line := range bytes.Split(bytes.TrimSpace(b), []byte("\n")) {
+				var entry webhookDeadLetter
+				if json.Unmarshal(line, &entry) == nil {
+					entries = append(entries, entry)
+				}
+			}
+			return len(entries) == want
+		}, 5*time.Second, 10*time.Millisecond)
+		return entries
+	}
+
+	t.Run("dead-letter circuit open", func(t *testing.T) {
+		atomic.StoreInt32(&calls, 0)
+		deadLetterLog := filepath.Join(t.TempDir(), "dead-letter.log")
+		// The circuit opens after the first failure, and the fail-open
+		// fallback does not mark the notifications as sent.
+		wh := &Webhook{
+			ID: fmt.Sprintf("circuit-open-%d", time.Now().UnixNano()), Name: "fail", URL: ts.URL + "/fail", Kind: linkedca.Webhook_NOTIFYING.String(), DeadLetterLog: deadLetterLog,
+			CircuitBreaker: &WebhookCircuitBreaker{FailureThreshold: 1, OpenTimeout: &Duration{Duration: time.Hour}, Fallback: WebhookFailOpen},
+		}
+		n.Notify(ctx, []*Webhook{wh}, req)
+		readDeadLetters(t, deadLetterLog, 1)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+		n.Notify(ctx, []*Webhook{wh}, req)
+		entries := readDeadLetters(t, deadLetterLog, 2)
+		assert.Equal(t, ErrWebhookCircuitOpen.Error(), entries[1].Error)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("dead-letter queue full", func(t *testing.T) {
+		size, workers := webhookNotifyQueueSize, webhookNotifyWorkers
+		webhookNotifyQueueSize, webhookNotifyWorkers = 1, 0
+		t.Cleanup(func() { webhookNotifyQueueSize, webhookNotifyWorkers = size, workers })
+
+		deadLetterLog := filepath.Join(t.TempDir(), "dead-letter.log")
+		wh := &Webhook{Name: "ok", URL: ts.URL + "/ok", Kind: linkedca.Webhook_NOTIFYING.String(), DeadLetterLog: deadLetterLog}
+		n := NewWebhookNotifier(nil)
+		n.Notify(ctx, []*Webhook{wh, wh}, req)
+		entries := readDeadLetters(t, deadLetterLog, 1)
+		assert.Equal(t, errWebhookNotifyQueueFull.Error(), entries[0].Error)
+		assert.Len(t, n.queue, 1)
+	})
+
+	t.Run("stop", func(t *testing.T) {
+		atomic.StoreInt32(&calls, 0)
+		deadLetterLog := filepath.Join(t.TempDir(), "dead-letter.log")
+		n := NewWebhookNotifier(nil)
+		n.Notify(ctx, []*Webhook{
+			{Name: "notify", URL: ts.URL + "/ok", Kind: linkedca.Webhook_NOTIFYING.String()},
+			{Name: "fail", URL: ts.URL + "/fail", Kind: linkedca.Webhook_NOTIFYING.String(), DeadLetterLog: deadLetterLog},
+		}, req)
+		// Stop waits for the queued notifications.
+		n.Stop()
+		select {
+		case <-received:
+		default:
+			t.Fatal("notification was not sent before stopping")
+		}
+		readDeadLetters(t, deadLetterLog, 1)
+
+		n.Notify(ctx, []*Webhook{
+			{Name: "notify", URL: ts.URL + "/ok", Kind: linkedca.Webhook_NOTIFYING.String(), DeadLetterLog: deadLetterLog},
+		}, req)
+		entries := readDeadLetters(t, deadLetterLog, 2)
+		assert.Equal(t, errWebhookNotifierStopped.Error(), entries[1].Error)
+
+		(*WebhookNotifier)(nil).Notify(ctx, []*Webhook{
+			{Name: "notify", URL: ts.URL + "/ok", Kind: linkedca.Webhook_NOTIFYING.String(), DeadLetterLog: deadLetterLog},
+		}, req)
+		readDeadLetters(t, deadLetterLog, 3)
+		n.Stop()
+	})
+}
+
+func mustSelfSignedCertificate(t *testing.T) tls.Certificate {
+	t.Helper()
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, signer.Public(), signer)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: signer}
+}
+
+type testWebhookPinStore struct {
+	pins map[string]string
+	err  error
+}
+
+func (s *testWebhookPinStore) GetWebhookPin(key string) (string, error) {
+	return s.pins[key], s.err
+}
+
+func (s *testWebhookPinStore) StoreWebhookPin(key, fingerprint string) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.pins[key] = fingerprint
+	return nil
+}
+
+type testWebhookKeyManager struct {
+	closed atomic.Bool
+}
+
+func (k *testWebhookKeyManager) GetPublicKey(*kmsapi.GetPublicKeyRequest) (crypto.PublicKey, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (k *testWebhookKeyManager) CreateKey(*kmsapi.CreateKeyRequest) (*kmsapi.CreateKeyResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (k *testWebhookKeyManager) CreateSigner(*kmsapi.CreateSignerRequest) (crypto.Signer, error) {
+	if k.closed.Load() {
+		return nil, errors.New("kms is closed")
+	}
+	key, err := pemutil.Read("testdata/secrets/foo.key")
+	if err != nil {
+		return nil, err
+	}
+	return key.(crypto.Signer), nil
+}
+
+func (k *testWebhookKeyManager) Close() error {
+	k.closed.Store(true)
+	return nil
+}
+
+func TestWebhookClientCertificate_load_keyManager(t *testing.T) {
+	var created []*testWebhookKeyManager
+	kmsapi.Register("webhooktestkms", func(ctx context.Context, opts kmsapi.Options) (kmsapi.KeyManager, error) {
+		km := &testWebhookKeyManager{}
+		created = append(created, km)
+		return km, nil
+	})
+
+	cc := &WebhookClientCertificate{
+		Certificate: "testdata/certs/foo.crt",
+		Key:         "webhooktestkms:name=foo",
+	}
+	// The key manager is created once and shared by all the controllers.
+	for i := 0; i < 3; i++ {
+		cert, err := cc.load()
+		require.NoError(t, err)
+		assert.NotNil(t, cert.PrivateKey)
+	}
+	require.Len(t, created, 1)
+	assert.False(t, created[0].closed.Load())
+
+	other := &WebhookClientCertificate{
+		Certificate: "testdata/certs/foo.crt",
+		Key:         "webhooktestkms:name=bar",
+	}
+	_, err := other.load()
+	require.NoError(t, err)
+	require.Len(t, created, 2)
+
+	require.NoError(t, CloseWebhookKeyManagers())
+	assert.True(t, created[0].closed.Load())
+	assert.True(t, created[1].closed.Load())
+
+	// A new key manager is created after closing them.
+	_, err = cc.load()
+	require.NoError(t, err)
+	require.Len(t, created, 3)
+	require.NoError(t, CloseWebhookKeyManagers())
+}
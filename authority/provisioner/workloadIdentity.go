@@ -0,0 +1,382 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/x509util"
+	"go.step.sm/linkedca"
+
+	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/certificates/webhook"
+)
+
+// workloadIdentityPlaceholderRegExp is the regular expression used to replace
+// the claims in the SANs of a WorkloadIdentity provisioner, e.g. {project_path}.
+var workloadIdentityPlaceholderRegExp = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// WorkloadIdentityClaimMatcher requires a claim of the tokens to match one of
+// the patterns. The claim can be a string or a list of strings, in the latter
+// any of the values must match. A "*" in a pattern matches any sequence of
+// characters.
+type WorkloadIdentityClaimMatcher struct {
+	Claim    string   `json:"claim"`
+	Patterns []string `json:"patterns"`
+}
+
+// WorkloadIdentity represents a provisioner for workload identity federation.
+// It validates the OIDC tokens of any issuer with an OIDC discovery endpoint,
+// like the ID tokens of GitLab CI jobs or Buildkite agents.
+//
+// The tokens must have as audience the sign audience of the CA with the
+// provisioner id as a fragment, e.g.
+// https://ca.example.com/1.0/sign#wif/my-provisioner.
+//
+// Subjects are the patterns allowed in the sub claim, and ClaimMatchers can be
+// used to require other claims, e.g. the namespace_path of GitLab tokens. A "*"
+// in a pattern matches any sequence of characters.
+//
+// SANs are the SANs of the certificates, the claims can be used with the format
+// {claim}, e.g. https://gitlab.com/{project_path}. The common name is the value
+// of the CommonNameClaim, sub by default.
+type WorkloadIdentity struct {
+	*base
+	ID              string                         `json:"-"`
+	Type            string                         `json:"type"`
+	Name            string                         `json:"name"`
+	Issuer          string                         `json:"issuer"`
+	Subjects        []string                       `json:"subjects"`
+	ClaimMatchers   []WorkloadIdentityClaimMatcher `json:"claimMatchers,omitempty"`
+	SANs            []string                       `json:"sans,omitempty"`
+	CommonNameClaim string                         `json:"commonNameClaim,omitempty"`
+	Claims          *Claims                        `json:"claims,omitempty"`
+	Options         *Options                       `json:"options,omitempty"`
+	sanTemplates    []workloadIdentitySAN
+	keyStore        *keyStore
+	ctl             *Controller
+}
+
+// workloadIdentitySAN is a parsed SAN of a WorkloadIdentity provisioner.
+// pathStart is the index of the path in URI templates, the claims in the path
+// are the only ones that can contain slashes.
+type workloadIdentitySAN struct {
+	template  string
+	sanType   string
+	pathStart int
+}
+
+// workloadIdentitySANType returns the type of the SAN in a certificate, "ip",
+// "email", "uri" or "dns".
+func workloadIdentitySANType(san string) string {
+	_, ips, emails, uris := x509util.SplitSANs([]string{san})
+	switch {
+	case len(ips) > 0:
+		return "ip"
+	case len(emails) > 0:
+		return "email"
+	case len(uris) > 0:
+		return "uri"
+	default:
+		return "dns"
+	}
+}
+
+// newWorkloadIdentitySAN parses a SAN template, the type of the SAN is the type
+// of the template with the placeholders replaced.
+func newWorkloadIdentitySAN(template string) workloadIdentitySAN {
+	san := workloadIdentitySAN{
+		template:  template,
+		sanType:   workloadIdentitySANType(workloadIdentityPlaceholderRegExp.ReplaceAllString(template, "placeholder")),
+		pathStart: len(template),
+	}
+	if san.sanType == "uri" {
+		if i := strings.Index(template, "://"); i >= 0 {
+			if j := strings.Index(template[i+3:], "/"); j >= 0 {
+				san.pathStart = i + 3 + j
+			}
+		}
+	}
+	return san
+}
+
+// workloadIdentityPayload represents the claims of a workload identity token.
+type workloadIdentityPayload struct {
+	jose.Claims
+	raw map[string]interface{}
+}
+
+// GetID returns the provisioner unique identifier.
+func (p *WorkloadIdentity) GetID() string {
+	if p.ID != "" {
+		return p.ID
+	}
+	return p.GetIDForToken()
+}
+
+// GetIDForToken returns an identifier that will be used to load the provisioner
+// from a token.
+func (p *WorkloadIdentity) GetIDForToken() string {
+	return "wif/" + p.Name
+}
+
+// GetTokenID returns the identifier of the token, the jti claim or the SHA256
+// of the token if the claim is not present.
+func (p *WorkloadIdentity) GetTokenID(ott string) (string, error) {
+	token, err := jose.ParseSigned(ott)
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing token")
+	}
+	var claims jose.Claims
+	if err = token.UnsafeClaimsWithoutVerification(&claims); err != nil {
+		return "", errors.Wrap(err, "error verifying claims")
+	}
+	if claims.ID != "" {
+		return claims.ID, nil
+	}
+	sum := sha256.Sum256([]byte(ott))
+	return strings.ToLower(hex.EncodeToString(sum[:])), nil
+}
+
+// GetName returns the name of the provisioner.
+func (p *WorkloadIdentity) GetName() string {
+	return p.Name
+}
+
+// GetType returns the type of provisioner.
+func (p *WorkloadIdentity) GetType() Type {
+	return TypeWorkloadIdentity
+}
+
+// GetEncryptedKey is not available in a WorkloadIdentity provisioner.
+func (p *WorkloadIdentity) GetEncryptedKey() (kid, key string, ok bool) {
+	return "", "", false
+}
+
+// GetOptions returns the configured provisioner options.
+func (p *WorkloadIdentity) GetOptions() *Options {
+	return p.Options
+}
+
+func (p *WorkloadIdentity) getCommonNameClaim() string {
+	if p.CommonNameClaim != "" {
+		return p.CommonNameClaim
+	}
+	return "sub"
+}
+
+// Init initializes and validates the fields of a WorkloadIdentity type.
+func (p *WorkloadIdentity) Init(config Config) (err error) {
+	switch {
+	case p.Type == "":
+		return errors.New("provisioner type cannot be empty")
+	case p.Name == "":
+		return errors.New("provisioner name cannot be empty")
+	case p.Issuer == "":
+		return errors.New("provisioner issuer cannot be empty")
+	case len(p.Subjects) == 0:
+		return errors.New("provisioner subjects cannot be empty")
+	}
+	for _, m := range p.ClaimMatchers {
+		if m.Claim == "" || len(m.Patterns) == 0 {
+			return errors.New("provisioner claimMatchers must contain a claim and patterns")
+		}
+	}
+	p.sanTemplates = make([]workloadIdentitySAN, len(p.SANs))
+	for i, san := range p.SANs {
+		p.sanTemplates[i] = newWorkloadIdentitySAN(san)
+	}
+
+	// Get the keys from the OIDC discovery of the issuer.
+	var conf openIDConfiguration
+	u := strings.TrimSuffix(p.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := getAndDecode(u, &conf); err != nil {
+		return err
+	}
+	if err := conf.Validate(); err != nil {
+		return errors.Wrapf(err, "error parsing %s", u)
+	}
+	if conf.Issuer != p.Issuer {
+		return errors.Errorf("error parsing %s: issuer %q does not match the provisioner issuer", u, conf.Issuer)
+	}
+	if p.keyStore, err = newKeyStore(conf.JWKSetURI); err != nil {
+		return err
+	}
+
+	config.Audiences = config.Audiences.WithFragment(p.GetIDForToken())
+	p.Options = mergeOptions(p.Options, config.DefaultOptions, p.GetType())
+	p.ctl, err = NewController(p, p.Claims, config, p.Options)
+	return
+}
+
+// workloadIdentityClaimValues returns the values of a string or list of
+// strings claim.
+func workloadIdentityClaimValues(raw map[string]interface{}, claim string) []string {
+	switch v := raw[claim].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, vv := range v {
+			if s, ok := vv.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	case bool, float64:
+		return []string{fmt.Sprint(v)}
+	default:
+		return nil
+	}
+}
+
+// authorizeToken validates a workload identity token and returns its claims.
+func (p *WorkloadIdentity) authorizeToken(token string) (*workloadIdentityPayload, error) {
+	jwt, err := jose.ParseSigned(token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err,
+			"wif.authorizeToken; error parsing workload identity token")
+	}
+	if len(jwt.Headers) == 0 {
+		return nil, errs.Unauthorized("wif.authorizeToken; error parsing workload identity token - header is missing")
+	}
+
+	var found bool
+	var claims workloadIdentityPayload
+	for _, key := range p.keyStore.Get(jwt.Headers[0].KeyID) {
+		if err := jwt.Claims(key, &claims.Claims, &claims.raw); err == nil {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, errs.Unauthorized("wif.authorizeToken; error validating workload identity token and extracting claims")
+	}
+
+	// According to "rfc7519 JSON Web Token" acceptable skew should be no
+	// more than a few minutes.
+	if err = claims.ValidateWithLeeway(jose.Expected{
+		Issuer: p.Issuer,
+		Time:   time.Now().UTC(),
+	}, time.Minute); err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "wif.authorizeToken; invalid workload identity token claims")
+	}
+	if claims.Expiry == nil {
+		return nil, errs.Unauthorized("wif.authorizeToken; workload identity token must contain an exp claim")
+	}
+	if !matchesAudience(claims.Audience, p.ctl.Audiences.Sign) {
+		return nil, errs.Unauthorized("wif.authorizeToken; workload identity token has invalid audience "+
+			"claim (aud); expected %s, but got %s", p.ctl.Audiences.Sign, claims.Audience)
+	}
+
+	if claims.Subject == "" || !matchesAnyPattern(p.Subjects, claims.Subject) {
+		return nil, errs.Forbidden("wif.authorizeToken; subject %q is not allowed", claims.Subject)
+	}
+	for _, m := range p.ClaimMatchers {
+		var ok bool
+		for _, v := range workloadIdentityClaimValues(claims.raw, m.Claim) {
+			if matchesAnyPattern(m.Patterns, v) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return nil, errs.Forbidden("wif.authorizeToken; claim %q is not allowed", m.Claim)
+		}
+	}
+
+	return &claims, nil
+}
+
+// sans returns the SANs of the certificate with the claims of the token. The
+// claims cannot contain the characters that would change the meaning of a SAN,
+// "@" and ":", or "/" outside the path of a URI, and the SANs must have the
+// type of their template.
+func (p *WorkloadIdentity) sans(claims *workloadIdentityPayload) ([]string, error) {
+	sans := make([]string, 0, len(p.sanTemplates))
+	for _, san := range p.sanTemplates {
+		var sb strings.Builder
+		var last int
+		for _, m := range workloadIdentityPlaceholderRegExp.FindAllStringSubmatchIndex(san.template, -1) {
+			claim := san.template[m[2]:m[3]]
+			values := workloadIdentityClaimValues(claims.raw, claim)
+			if len(values) != 1 || values[0] == "" {
+				return nil, errors.Errorf("claim %q is missing or it is not a single value", claim)
+			}
+			v := values[0]
+			if strings.ContainsAny(v, "@:") || (m[0] < san.pathStart && strings.Contains(v, "/")) {
+				return nil, errors.Errorf("claim %q contains characters not allowed in a SAN", claim)
+			}
+			sb.WriteString(san.template[last:m[0]])
+			sb.WriteString(v)
+			last = m[1]
+		}
+		sb.WriteString(san.template[last:])
+
+		s := sb.String()
+		if typ := workloadIdentitySANType(s); typ != san.sanType {
+			return nil, errors.Errorf("SAN %q is not of type %s", s, san.sanType)
+		}
+		sans = append(sans, s)
+	}
+	return sans, nil
+}
+
+// AuthorizeSign validates the given token.
+func (p *WorkloadIdentity) AuthorizeSign(ctx context.Context, token string) ([]SignOption, error) {
+	claims, err := p.authorizeToken(token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "wif.AuthorizeSign")
+	}
+
+	sans, err := p.sans(claims)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "wif.AuthorizeSign; invalid workload identity token")
+	}
+	var commonName string
+	if values := workloadIdentityClaimValues(claims.raw, p.getCommonNameClaim()); len(values) == 1 {
+		commonName = values[0]
+	}
+
+	data := x509util.CreateTemplateData(commonName, sans)
+	if v, err := unsafeParseSigned(token); err == nil {
+		data.SetToken(v)
+	}
+
+	templateOptions, err := TemplateOptions(p.Options, data)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "wif.AuthorizeSign")
+	}
+
+	return []SignOption{
+		p,
+		templateOptions,
+		// modifiers / withOptions
+		newProvisionerExtensionOption(TypeWorkloadIdentity, p.Name, claims.Subject).WithControllerOptions(p.ctl),
+		profileDefaultDuration(p.ctl.Claimer.DefaultTLSCertDuration()),
+		// validators
+		newDefaultSANsValidator(ctx, sans),
+		defaultPublicKeyValidator{},
+		newValidityValidator(p.ctl.Claimer.MinTLSCertDuration(), p.ctl.Claimer.MaxTLSCertDuration()),
+		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
+		p.ctl.newWebhookController(
+			data,
+			linkedca.Webhook_X509,
+			webhook.WithAuthorizationPrincipal(claims.Subject),
+		),
+	}, nil
+}
+
+// AuthorizeRenew returns an error if the renewal is disabled.
+func (p *WorkloadIdentity) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) error {
+	return p.ctl.AuthorizeRenew(ctx, cert)
+}
@@ -0,0 +1,223 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+)
+
+func newWorkloadIdentityToken(t *testing.T, jwk *jose.JSONWebKey, iss, aud string, modify func(c map[string]interface{})) string {
+	t.Helper()
+	sig, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.ES256, Key: jwk.Key},
+		new(jose.SignerOptions).WithType("JWT").WithHeader("kid", jwk.KeyID),
+	)
+	require.NoError(t, err)
+
+	now := time.Now()
+	claims := map[string]interface{}{
+		"jti":            "the-jti",
+		"sub":            "project_path:my-group/my-project:ref_type:branch:ref:main",
+		"iss":            iss,
+		"aud":            aud,
+		"iat":            now.Unix(),
+		"nbf":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"namespace_path": "my-group",
+		"project_path":   "my-group/my-project",
+		"ref":            "main",
+		"ref_protected":  "true",
+		"groups":         []string{"developers", "maintainers"},
+	}
+	if modify != nil {
+		modify(claims)
+	}
+	tok, err := jose.Signed(sig).Claims(claims).CompactSerialize()
+	require.NoError(t, err)
+	return tok
+}
+
+func TestWorkloadIdentity_Init(t *testing.T) {
+	config := Config{Claims: globalProvisionerClaims, Audiences: testAudiences}
+	assert.EqualError(t, (&WorkloadIdentity{Name: "gitlab"}).Init(config), "provisioner type cannot be empty")
+	assert.EqualError(t, (&WorkloadIdentity{Type: "WorkloadIdentity"}).Init(config), "provisioner name cannot be empty")
+	assert.EqualError(t, (&WorkloadIdentity{Type: "WorkloadIdentity", Name: "gitlab"}).Init(config), "provisioner issuer cannot be empty")
+	assert.EqualError(t, (&WorkloadIdentity{Type: "WorkloadIdentity", Name: "gitlab", Issuer: "https://gitlab.com"}).Init(config), "provisioner subjects cannot be empty")
+	assert.EqualError(t, (&WorkloadIdentity{Type: "WorkloadIdentity", Name: "gitlab", Issuer: "https://gitlab.com", Subjects: []string{"*"},
+		ClaimMatchers: []WorkloadIdentityClaimMatcher{{Claim: "ref"}}}).Init(config), "provisioner claimMatchers must contain a claim and patterns")
+}
+
+func TestWorkloadIdentity_AuthorizeSign(t *testing.T) {
+	jwk, err := generateJSONWebKey()
+	require.NoError(t, err)
+	other, err := generateJSONWebKey()
+	require.NoError(t, err)
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(openIDConfiguration{Issuer: srv.URL, JWKSetURI: srv.URL + "/oauth/discovery/keys"})
+		case "/oauth/discovery/keys":
+			json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{jwk.Public()}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	p := &WorkloadIdentity{
+		Type:     "WorkloadIdentity",
+		Name:     "gitlab",
+		Issuer:   srv.URL,
+		Subjects: []string{"project_path:my-group/*"},
+		ClaimMatchers: []WorkloadIdentityClaimMatcher{
+			{Claim: "ref_protected", Patterns: []string{"true"}},
+		},
+		SANs:            []string{"https://gitlab.example.com/{project_path}", "{namespace_path}.ci.example.com"},
+		CommonNameClaim: "project_path",
+	}
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+	assert.Equal(t, "wif/gitlab", p.GetID())
+	assert.Equal(t, TypeWorkloadIdentity, p.GetType())
+	aud := testAudiences.Sign[0] + "#" + p.GetIDForToken()
+
+	t.Run("ok", func(t *testing.T) {
+		token := newWorkloadIdentityToken(t, jwk, srv.URL, aud, nil)
+		opts, err := p.AuthorizeSign(context.Background(), token)
+		require.NoError(t, err)
+		v := findGKEDefaultSANsValidator(t, opts)
+		u, err := url.Parse("https://gitlab.example.com/my-group/my-project")
+		require.NoError(t, err)
+		assert.NoError(t, v.Valid(&x509.CertificateRequest{
+			Subject:  pkix.Name{CommonName: "my-group/my-project"},
+			DNSNames: []string{"my-group.ci.example.com"},
+			URIs:     []*url.URL{u},
+		}))
+		assert.Error(t, v.Valid(&x509.CertificateRequest{
+			Subject:  pkix.Name{CommonName: "my-group/my-project"},
+			DNSNames: []string{"example.com"},
+		}))
+
+		id, err := p.GetTokenID(token)
+		require.NoError(t, err)
+		assert.Equal(t, "the-jti", id)
+	})
+
+	t.Run("ok token id without jti", func(t *testing.T) {
+		token := newWorkloadIdentityToken(t, jwk, srv.URL, aud, func(c map[string]interface{}) {
+			delete(c, "jti")
+		})
+		id, err := p.GetTokenID(token)
+		require.NoError(t, err)
+		assert.Len(t, id, 64)
+	})
+
+	t.Run("ok list claim", func(t *testing.T) {
+		p.ClaimMatchers = append(p.ClaimMatchers, WorkloadIdentityClaimMatcher{Claim: "groups", Patterns: []string{"maintainers"}})
+		defer func() { p.ClaimMatchers = p.ClaimMatchers[:1] }()
+		_, err := p.AuthorizeSign(context.Background(), newWorkloadIdentityToken(t, jwk, srv.URL, aud, nil))
+		assert.NoError(t, err)
+		_, err = p.AuthorizeSign(context.Background(), newWorkloadIdentityToken(t, jwk, srv.URL, aud, func(c map[string]interface{}) {
+			c["groups"] = []string{"developers"}
+		}))
+		assertStatusCode(t, err, http.StatusForbidden)
+	})
+
+	t.Run("fail key", func(t *testing.T) {
+		_, err := p.AuthorizeSign(context.Background(), newWorkloadIdentityToken(t, other, srv.URL, aud, nil))
+		assertStatusCode(t, err, http.StatusUnauthorized)
+	})
+
+	t.Run("fail issuer", func(t *testing.T) {
+		_, err := p.AuthorizeSign(context.Background(), newWorkloadIdentityToken(t, jwk, "https://gitlab.com", aud, nil))
+		assertStatusCode(t, err, http.StatusUnauthorized)
+	})
+
+	t.Run("fail audience", func(t *testing.T) {
+		_, err := p.AuthorizeSign(context.Background(), newWorkloadIdentityToken(t, jwk, srv.URL, "https://gitlab.com", nil))
+		assertStatusCode(t, err, http.StatusUnauthorized)
+	})
+
+	t.Run("fail exp", func(t *testing.T) {
+		_, err := p.AuthorizeSign(context.Background(), newWorkloadIdentityToken(t, jwk, srv.URL, aud, func(c map[string]interface{}) {
+			delete(c, "exp")
+		}))
+		assertStatusCode(t, err, http.StatusUnauthorized)
+	})
+
+	t.Run("fail subject", func(t *testing.T) {
+		_, err := p.AuthorizeSign(context.Background(), newWorkloadIdentityToken(t, jwk, srv.URL, aud, func(c map[string]interface{}) {
+			c["sub"] = "project_path:other-group/my-project:ref_type:branch:ref:main"
+		}))
+		assertStatusCode(t, err, http.StatusForbidden)
+	})
+
+	t.Run("fail claim", func(t *testing.T) {
+		_, err := p.AuthorizeSign(context.Background(), newWorkloadIdentityToken(t, jwk, srv.URL, aud, func(c map[string]interface{}) {
+			c["ref_protected"] = "false"
+		}))
+		assertStatusCode(t, err, http.StatusForbidden)
+		_, err = p.AuthorizeSign(context.Background(), newWorkloadIdentityToken(t, jwk, srv.URL, aud, func(c map[string]interface{}) {
+			delete(c, "ref_protected")
+		}))
+		assertStatusCode(t, err, http.StatusForbidden)
+	})
+
+	t.Run("fail missing san claim", func(t *testing.T) {
+		_, err := p.AuthorizeSign(context.Background(), newWorkloadIdentityToken(t, jwk, srv.URL, aud, func(c map[string]interface{}) {
+			delete(c, "namespace_path")
+		}))
+		assertStatusCode(t, err, http.StatusUnauthorized)
+	})
+
+	t.Run("fail invalid san claim", func(t *testing.T) {
+		for _, v := range []string{"example.com/my-group", "admin@example.com", "example.com:443"} {
+			_, err := p.AuthorizeSign(context.Background(), newWorkloadIdentityToken(t, jwk, srv.URL, aud, func(c map[string]interface{}) {
+				c["namespace_path"] = v
+			}))
+			assertStatusCode(t, err, http.StatusUnauthorized)
+		}
+		_, err := p.AuthorizeSign(context.Background(), newWorkloadIdentityToken(t, jwk, srv.URL, aud, func(c map[string]interface{}) {
+			c["project_path"] = "my-group/my-project@example.com"
+		}))
+		assertStatusCode(t, err, http.StatusUnauthorized)
+	})
+}
+
+func TestWorkloadIdentity_sans(t *testing.T) {
+	p := &WorkloadIdentity{
+		SANs: []string{"spiffe://example.com/{project_path}", "{namespace_path}"},
+	}
+	p.sanTemplates = []workloadIdentitySAN{
+		newWorkloadIdentitySAN(p.SANs[0]),
+		newWorkloadIdentitySAN(p.SANs[1]),
+	}
+	assert.Equal(t, "uri", p.sanTemplates[0].sanType)
+	assert.Equal(t, len("spiffe://example.com"), p.sanTemplates[0].pathStart)
+	assert.Equal(t, "dns", p.sanTemplates[1].sanType)
+
+	sans, err := p.sans(&workloadIdentityPayload{raw: map[string]interface{}{
+		"project_path":   "my-group/my-project",
+		"namespace_path": "my-group.example.com",
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"spiffe://example.com/my-group/my-project", "my-group.example.com"}, sans)
+
+	// The DNS template cannot be used to create an IP address.
+	_, err = p.sans(&workloadIdentityPayload{raw: map[string]interface{}{
+		"project_path":   "my-group/my-project",
+		"namespace_path": "10.0.0.1",
+	}})
+	assert.EqualError(t, err, `SAN "10.0.0.1" is not of type dns`)
+}
@@ -5,11 +5,15 @@ import (
 	"crypto/x509"
 	"encoding/pem"
 	"net/http"
+	"regexp"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
 
 	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/pemutil"
 	"go.step.sm/crypto/sshutil"
 	"go.step.sm/crypto/x509util"
 	"go.step.sm/linkedca"
@@ -30,14 +34,114 @@ type x5cPayload struct {
 // signature requests.
 type X5C struct {
 	*base
-	ID       string   `json:"-"`
-	Type     string   `json:"type"`
-	Name     string   `json:"name"`
-	Roots    []byte   `json:"roots"`
-	Claims   *Claims  `json:"claims,omitempty"`
-	Options  *Options `json:"options,omitempty"`
-	ctl      *Controller
-	rootPool *x509.CertPool
+	ID      string   `json:"-"`
+	Type    string   `json:"type"`
+	Name    string   `json:"name"`
+	Roots   []byte   `json:"roots"`
+	Claims  *Claims  `json:"claims,omitempty"`
+	Options *Options `json:"options,omitempty"`
+	// Constraints restricts the certificates that can sign tokens, instead of
+	// accepting any certificate chaining up to the roots.
+	Constraints *X5CConstraints `json:"constraints,omitempty"`
+	ctl         *Controller
+	rootPool    *x509.CertPool
+}
+
+// X5CConstraints are the constraints of the certificates used to sign the
+// tokens of a X5C provisioner.
+type X5CConstraints struct {
+	// MaxChainDepth is the maximum number of certificates in the chain,
+	// including the leaf and the root. A value of 2 only accepts leaf
+	// certificates signed directly by a root. The default, 0, does not limit
+	// the depth.
+	MaxChainDepth int `json:"maxChainDepth,omitempty"`
+	// ExtKeyUsage is the list of extended key usages that the leaf certificate
+	// must contain.
+	ExtKeyUsage x509util.ExtKeyUsage `json:"extKeyUsage,omitempty"`
+	// SANs is a list of patterns, with optional * wildcards, and the leaf
+	// certificate must contain a SAN matching one of them.
+	SANs []string `json:"sans,omitempty"`
+	// Intermediates is a PEM bundle with the intermediates allowed to issue
+	// the leaf certificates.
+	Intermediates []byte `json:"intermediates,omitempty"`
+	sanPatterns   []*regexp.Regexp
+	intermediates []*x509.Certificate
+}
+
+// init validates and initializes the constraints.
+func (c *X5CConstraints) init() error {
+	if c.MaxChainDepth < 0 {
+		return errors.New("constraints maxChainDepth cannot be negative")
+	}
+	if c.MaxChainDepth == 1 {
+		return errors.New("constraints maxChainDepth must be at least 2")
+	}
+
+	c.sanPatterns = nil
+	for _, san := range c.SANs {
+		if san == "" {
+			return errors.New("constraints sans cannot contain an empty pattern")
+		}
+		re, err := regexp.Compile("^" + strings.ReplaceAll(regexp.QuoteMeta(san), `\*`, ".*") + "$")
+		if err != nil {
+			return errors.Wrapf(err, "error parsing constraints san %q", san)
+		}
+		c.sanPatterns = append(c.sanPatterns, re)
+	}
+
+	c.intermediates = nil
+	if len(c.Intermediates) > 0 {
+		certs, err := pemutil.ParseCertificateBundle(c.Intermediates)
+		if err != nil {
+			return errors.Wrap(err, "error parsing constraints intermediates")
+		}
+		c.intermediates = certs
+	}
+
+	return nil
+}
+
+// validateChain returns an error if the given verified chain does not satisfy
+// the chain depth and issuing intermediate constraints.
+func (c *X5CConstraints) validateChain(chain []*x509.Certificate) error {
+	if c.MaxChainDepth > 0 && len(chain) > c.MaxChainDepth {
+		return errors.Errorf("certificate chain depth %d exceeds the maximum of %d", len(chain), c.MaxChainDepth)
+	}
+	if c.intermediates != nil {
+		if len(chain) < 2 || !slices.ContainsFunc(c.intermediates, chain[1].Equal) {
+			return errors.New("certificate is not issued by an allowed intermediate")
+		}
+	}
+	return nil
+}
+
+// validateLeaf returns an error if the leaf certificate does not satisfy the
+// extended key usage and SAN constraints.
+func (c *X5CConstraints) validateLeaf(leaf *x509.Certificate) error {
+	for _, eku := range c.ExtKeyUsage {
+		if !slices.Contains(leaf.ExtKeyUsage, eku) {
+			return errors.New("certificate does not have the required extended key usages")
+		}
+	}
+	if len(c.sanPatterns) > 0 {
+		var sans []string
+		sans = append(sans, leaf.DNSNames...)
+		sans = append(sans, leaf.EmailAddresses...)
+		for _, ip := range leaf.IPAddresses {
+			sans = append(sans, ip.String())
+		}
+		for _, u := range leaf.URIs {
+			sans = append(sans, u.String())
+		}
+		if !slices.ContainsFunc(sans, func(san string) bool {
+			return slices.ContainsFunc(c.sanPatterns, func(re *regexp.Regexp) bool {
+				return re.MatchString(san)
+			})
+		}) {
+			return errors.New("certificate does not have an allowed subject alternative name")
+		}
+	}
+	return nil
 }
 
 // GetID returns the provisioner unique identifier. The name and credential id
@@ -88,6 +192,11 @@ func (p *X5C) GetEncryptedKey() (string, string, bool) {
 	return "", "", false
 }
 
+// GetOptions returns the configured provisioner options.
+func (p *X5C) GetOptions() *Options {
+	return p.Options
+}
+
 // Init initializes and validates the fields of a X5C type.
 func (p *X5C) Init(config Config) (err error) {
 	switch {
@@ -124,7 +233,14 @@ func (p *X5C) Init(config Config) (err error) {
 		return errors.Errorf("no x509 certificates found in roots attribute for provisioner '%s'", p.GetName())
 	}
 
+	if p.Constraints != nil {
+		if err := p.Constraints.init(); err != nil {
+			return err
+		}
+	}
+
 	config.Audiences = config.Audiences.WithFragment(p.GetIDForToken())
+	p.Options = mergeOptions(p.Options, config.DefaultOptions, p.GetType())
 	p.ctl, err = NewController(p, p.Claims, config, p.Options)
 	return
 }
@@ -146,6 +262,23 @@ func (p *X5C) authorizeToken(token string, audiences []string) (*x5cPayload, err
 		return nil, errs.Wrap(http.StatusUnauthorized, err,
 			"x5c.authorizeToken; error verifying x5c certificate chain in token")
 	}
+	if c := p.Constraints; c != nil {
+		var chains [][]*x509.Certificate
+		for _, chain := range verifiedChains {
+			if err = c.validateChain(chain); err == nil {
+				chains = append(chains, chain)
+			}
+		}
+		if len(chains) == 0 {
+			return nil, errs.Wrap(http.StatusUnauthorized, err,
+				"x5c.authorizeToken; x5c certificate chain does not satisfy the provisioner constraints")
+		}
+		if err := c.validateLeaf(chains[0][0]); err != nil {
+			return nil, errs.Wrap(http.StatusUnauthorized, err,
+				"x5c.authorizeToken; x5c certificate does not satisfy the provisioner constraints")
+		}
+		verifiedChains = chains
+	}
 	leaf := verifiedChains[0][0]
 
 	if leaf.KeyUsage&x509.KeyUsageDigitalSignature == 0 {
@@ -233,7 +366,7 @@ func (p *X5C) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 		}
 	}
 
-	return []SignOption{
+	signOptions := []SignOption{
 		self,
 		templateOptions,
 		// modifiers / withOptions
@@ -243,7 +376,6 @@ func (p *X5C) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 			x5cLeaf.NotBefore, x5cLeaf.NotAfter,
 		},
 		// validators
-		commonNameValidator(claims.Subject),
 		newDefaultSANsValidator(ctx, claims.SANs),
 		defaultPublicKeyValidator{},
 		newValidityValidator(p.ctl.Claimer.MinTLSCertDuration(), p.ctl.Claimer.MaxTLSCertDuration()),
@@ -254,7 +386,13 @@ func (p *X5C) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 			webhook.WithX5CCertificate(x5cLeaf),
 			webhook.WithAuthorizationPrincipal(x5cLeaf.Subject.CommonName),
 		),
-	}, nil
+	}
+
+	// Common name validators or modifiers
+	return append(signOptions, newCommonNameOptions(
+		p.Options.GetX509Options().GetCommonNameMode(),
+		[]string{claims.Subject},
+	)...), nil
 }
 
 // AuthorizeRenew returns an error if the renewal is disabled.
@@ -263,7 +401,7 @@ func (p *X5C) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) error
 }
 
 // AuthorizeSSHSign returns the list of SignOption for a SignSSH request.
-func (p *X5C) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, error) {
+func (p *X5C) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption, error) {
 	if !p.ctl.Claimer.IsSSHCAEnabled() {
 		return nil, errs.Unauthorized("x5c.AuthorizeSSHSign; sshCA is disabled for x5c provisioner '%s'", p.GetName())
 	}
@@ -308,6 +446,7 @@ func (p *X5C) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, e
 	if v, err := unsafeParseSigned(token); err == nil {
 		data.SetToken(v)
 	}
+	audit := newSSHAuditMetadata(ctx, p, claims.Subject, data)
 
 	// The X509 certificate will be available using the template variable
 	// AuthorizationCrt. For example {{ .AuthorizationCrt.DNSNames }} can be
@@ -321,6 +460,11 @@ func (p *X5C) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, e
 	}
 	signOptions = append(signOptions, templateOptions)
 
+	// Restrict the addresses from which the user certificates can be used.
+	if m := newSSHSourceAddressModifier(ctx, p.Options.GetSSHOptions()); m != nil {
+		signOptions = append(signOptions, m)
+	}
+
 	// Add modifiers from custom claims
 	t := now()
 	if !opts.ValidAfter.IsZero() {
@@ -332,6 +476,7 @@ func (p *X5C) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, e
 
 	return append(signOptions,
 		p,
+		audit,
 		// Checks the validity bounds, and set the validity if has not been set.
 		&sshLimitDuration{p.ctl.Claimer, x5cLeaf.NotAfter},
 		// Validate public key.
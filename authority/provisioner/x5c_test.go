@@ -3,15 +3,18 @@ package provisioner
 import (
 	"context"
 	"crypto/x509"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"net/http"
+	"os"
 	"testing"
 	"time"
 
 	"go.step.sm/crypto/jose"
 	"go.step.sm/crypto/pemutil"
 	"go.step.sm/crypto/randutil"
+	"go.step.sm/crypto/x509util"
 	"go.step.sm/linkedca"
 
 	"github.com/smallstep/assert"
@@ -406,6 +409,86 @@ lgsqsR63is+0YQ==
 	}
 }
 
+func TestX5C_authorizeToken_constraints(t *testing.T) {
+	x5cCerts, err := pemutil.ReadCertificateBundle("./testdata/certs/x5c-leaf.crt")
+	assert.FatalError(t, err)
+	x5cJWK, err := jose.ReadKey("./testdata/secrets/x5c-leaf.key")
+	assert.FatalError(t, err)
+	intermediate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: x5cCerts[1].Raw})
+
+	tests := []struct {
+		name        string
+		constraints *X5CConstraints
+		wantErr     bool
+	}{
+		{"ok empty", &X5CConstraints{}, false},
+		{"ok depth", &X5CConstraints{MaxChainDepth: 3}, false},
+		{"ok extKeyUsage", &X5CConstraints{ExtKeyUsage: x509util.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}}, false},
+		{"ok sans", &X5CConstraints{SANs: []string{"*.example.com", "leaf-*"}}, false},
+		{"ok intermediates", &X5CConstraints{Intermediates: intermediate}, false},
+		{"ok all", &X5CConstraints{
+			MaxChainDepth: 3,
+			ExtKeyUsage:   x509util.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+			SANs:          []string{"leaf-test"},
+			Intermediates: intermediate,
+		}, false},
+		{"fail depth", &X5CConstraints{MaxChainDepth: 2}, true},
+		{"fail extKeyUsage", &X5CConstraints{ExtKeyUsage: x509util.ExtKeyUsage{x509.ExtKeyUsageCodeSigning}}, true},
+		{"fail sans", &X5CConstraints{SANs: []string{"*.example.com", "leaf"}}, true},
+		{"fail intermediates", &X5CConstraints{Intermediates: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: x5cCerts[0].Raw})}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := generateX5C(nil)
+			assert.FatalError(t, err)
+			p.Constraints = tt.constraints
+			assert.FatalError(t, p.Constraints.init())
+
+			tok, err := generateToken("foo", p.GetName(), testAudiences.Sign[0], "",
+				[]string{"test.smallstep.com"}, time.Now(), x5cJWK,
+				withX5CHdr(x5cCerts))
+			assert.FatalError(t, err)
+
+			_, err = p.authorizeToken(tok, testAudiences.Sign)
+			if tt.wantErr {
+				var sc render.StatusCodedError
+				if assert.True(t, errors.As(err, &sc), "error does not implement StatusCodedError interface") {
+					assert.Equals(t, http.StatusUnauthorized, sc.StatusCode())
+				}
+			} else {
+				assert.FatalError(t, err)
+			}
+		})
+	}
+}
+
+func TestX5C_Init_constraints(t *testing.T) {
+	roots, err := os.ReadFile("./testdata/certs/root_ca.crt")
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name        string
+		constraints *X5CConstraints
+		wantErr     bool
+	}{
+		{"ok", &X5CConstraints{MaxChainDepth: 2, SANs: []string{"*.example.com"}, Intermediates: roots}, false},
+		{"fail negative depth", &X5CConstraints{MaxChainDepth: -1}, true},
+		{"fail depth", &X5CConstraints{MaxChainDepth: 1}, true},
+		{"fail empty san", &X5CConstraints{SANs: []string{""}}, true},
+		{"fail intermediates", &X5CConstraints{Intermediates: []byte("foo")}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := generateX5C(nil)
+			assert.FatalError(t, err)
+			p.Constraints = tt.constraints
+			if err := p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}); (err != nil) != tt.wantErr {
+				t.Errorf("X5C.Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestX5C_AuthorizeSign(t *testing.T) {
 	certs, err := pemutil.ReadCertificateBundle("./testdata/certs/x5c-leaf.crt")
 	assert.FatalError(t, err)
@@ -487,8 +570,8 @@ func TestX5C_AuthorizeSign(t *testing.T) {
 								claims, err := tc.p.authorizeToken(tc.token, tc.p.ctl.Audiences.Sign)
 								assert.FatalError(t, err)
 								assert.Equals(t, v.notAfter, claims.chains[0][0].NotAfter)
-							case commonNameValidator:
-								assert.Equals(t, string(v), "foo")
+							case commonNameSliceValidator:
+								assert.Equals(t, []string(v), []string{"foo"})
 							case defaultPublicKeyValidator:
 							case *defaultSANsValidator:
 								assert.Equals(t, v.sans, tc.sans)
@@ -808,15 +891,17 @@ func TestX5C_AuthorizeSSHSign(t *testing.T) {
 								assert.Len(t, 0, v.webhooks)
 								assert.Equals(t, linkedca.Webhook_SSH, v.certType)
 								assert.Len(t, 2, v.options)
+							case *SSHAuditMetadata:
+								assert.Equals(t, &SSHAuditMetadata{Provisioner: tc.p.GetName(), Identity: tc.claims.Subject}, v)
 							default:
 								assert.FatalError(t, fmt.Errorf("unexpected sign option of type %T", v))
 							}
 							tot++
 						}
 						if tc.claims.Step.SSH.CertType != "" {
-							assert.Equals(t, tot, 12)
+							assert.Equals(t, tot, 13)
 						} else {
-							assert.Equals(t, tot, 10)
+							assert.Equals(t, tot, 11)
 						}
 					}
 				}
@@ -183,6 +183,14 @@ func (a *Authority) generateProvisionerConfig(ctx context.Context) (provisioner.
 	if err != nil {
 		return provisioner.Config{}, err
 	}
+	// Merge the provisioner defaults, they take precedence over the authority
+	// claims.
+	defaults := a.config.AuthorityConfig.ProvisionerDefaults
+	if claims := defaults.GetClaims(); claims != nil {
+		if claimer, err = provisioner.NewClaimer(claims, claimer.Claims()); err != nil {
+			return provisioner.Config{}, err
+		}
+	}
 	// TODO: should we also be combining the ssh federated roots here?
 	// If we rotate ssh roots keys, sshpop provisioner will lose ability to
 	// validate old SSH certificates, unless they are added as federated certs.
@@ -190,9 +198,14 @@ func (a *Authority) generateProvisionerConfig(ctx context.Context) (provisioner.
 	if err != nil {
 		return provisioner.Config{}, err
 	}
+	var pinStore provisioner.WebhookPinStore
+	if ps, ok := a.db.(db.WebhookPinDB); ok {
+		pinStore = ps
+	}
 	return provisioner.Config{
-		Claims:    claimer.Claims(),
-		Audiences: a.config.GetAudiences(),
+		Claims:         claimer.Claims(),
+		DefaultOptions: defaults.GetOptions(),
+		Audiences:      a.config.GetAudiences(),
 		SSHKeys: &provisioner.SSHKeys{
 			UserKeys: sshKeys.UserKeys,
 			HostKeys: sshKeys.HostKeys,
@@ -202,6 +215,8 @@ func (a *Authority) generateProvisionerConfig(ctx context.Context) (provisioner.
 		AuthorizeSSHRenewFunc: a.authorizeSSHRenewFunc,
 		WebhookClient:         a.webhookClient,
 		SCEPKeyManager:        a.scepKeyManager,
+		UseSCEPChallengeFunc:  a.useSCEPChallenge,
+		WebhookPinStore:       pinStore,
 	}, nil
 }
 
@@ -501,6 +516,7 @@ func optionsToCertificates(p *linkedca.Provisioner) *provisioner.Options {
 		if x := pol.GetX509(); x != nil {
 			if allow := x.GetAllow(); allow != nil {
 				ops.X509.AllowedNames = &policy.X509NameOptions{
+					CommonNames:    allow.CommonNames,
 					DNSDomains:     allow.Dns,
 					IPRanges:       allow.Ips,
 					EmailAddresses: allow.Emails,
@@ -509,6 +525,7 @@ func optionsToCertificates(p *linkedca.Provisioner) *provisioner.Options {
 			}
 			if deny := x.GetDeny(); deny != nil {
 				ops.X509.DeniedNames = &policy.X509NameOptions{
+					CommonNames:    deny.CommonNames,
 					DNSDomains:     deny.Dns,
 					IPRanges:       deny.Ips,
 					EmailAddresses: deny.Emails,
@@ -1019,6 +1036,21 @@ func ProvisionerToCertificates(p *linkedca.Provisioner) (provisioner.Interface,
 // ProvisionerToLinkedca converts a provisioner.Interface to a
 // linkedca.Provisioner type.
 func ProvisionerToLinkedca(p provisioner.Interface) (*linkedca.Provisioner, error) {
+	lp, err := provisionerToLinkedca(p)
+	if err != nil {
+		return nil, err
+	}
+	// Policies defined in the provisioner options are stored as the
+	// provisioner policy.
+	if o, ok := p.(interface {
+		GetOptions() *provisioner.Options
+	}); ok {
+		lp.Policy = policy.CertificatesToLinked(o.GetOptions().GetPolicy())
+	}
+	return lp, nil
+}
+
+func provisionerToLinkedca(p provisioner.Interface) (*linkedca.Provisioner, error) {
 	switch p := p.(type) {
 	case *provisioner.JWK:
 		x509Template, sshTemplate, webhooks, err := provisionerOptionsToLinkedca(p.Options)
@@ -18,6 +18,7 @@ import (
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/api/render"
 	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/policy"
 	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/db"
 )
@@ -390,3 +391,37 @@ func Test_isRAProvisioner(t *testing.T) {
 		})
 	}
 }
+
+func TestProvisionerToLinkedca_policy(t *testing.T) {
+	p := &provisioner.JWK{
+		Type: "JWK",
+		Name: "my-jwk",
+		Options: &provisioner.Options{
+			Policy: &policy.Options{
+				X509: &policy.X509PolicyOptions{
+					AllowedNames: &policy.X509NameOptions{DNSDomains: []string{"*.example.com"}},
+				},
+				SSH: &policy.SSHPolicyOptions{
+					User: &policy.SSHUserCertificateOptions{
+						DeniedNames: &policy.SSHNameOptions{Principals: []string{"root"}},
+					},
+				},
+			},
+		},
+	}
+	lp, err := ProvisionerToLinkedca(p)
+	assert.FatalError(t, err)
+	assert.Equals(t, []string{"*.example.com"}, lp.GetPolicy().GetX509().GetAllow().GetDns())
+	assert.Equals(t, []string{"root"}, lp.GetPolicy().GetSsh().GetUser().GetDeny().GetPrincipals())
+
+	// The policy is used as an admin managed policy.
+	ops := optionsToCertificates(lp)
+	assert.Equals(t, []string{"*.example.com"}, ops.X509.AllowedNames.DNSDomains)
+	assert.Equals(t, []string{"root"}, ops.SSH.User.DeniedNames.Principals)
+
+	// Without policy.
+	p.Options = nil
+	lp, err = ProvisionerToLinkedca(p)
+	assert.FatalError(t, err)
+	assert.Nil(t, lp.Policy)
+}
@@ -0,0 +1,73 @@
+package authority
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"log"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/errs"
+)
+
+// reserveCertificateQuota adds the certificate to the certificate quota of the
+// provisioner before signing it, and returns a 429 error if the provisioner
+// has already issued the number of valid certificates configured in its
+// certificateQuota options for any of the names in the certificate.
+//
+// The quota is tracked by serial number, so the serial number of the
+// certificate is set if the template does not define one. The returned
+// function must be called with the issued certificate, or with nil if the
+// certificate is not issued, to update or release the reservation.
+func (a *Authority) reserveCertificateQuota(p provisioner.Interface, leaf *x509.Certificate) (func(*x509.Certificate), error) {
+	done := func(*x509.Certificate) {}
+	if p == nil {
+		return done, nil
+	}
+	po, ok := p.(interface{ GetOptions() *provisioner.Options })
+	if !ok {
+		return done, nil
+	}
+	o := po.GetOptions().GetCertificateQuota()
+	if o == nil || o.MaxPerSubject <= 0 {
+		return done, nil
+	}
+
+	counter, ok := a.db.(db.CertificateCounter)
+	if !ok {
+		return nil, errs.InternalServer("database does not support certificate quotas")
+	}
+	if leaf.SerialNumber == nil {
+		serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+		if err != nil {
+			return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.reserveCertificateQuota")
+		}
+		leaf.SerialNumber = serial
+	}
+
+	name, ok, err := counter.AddCertificateToQuota(p.GetID(), leaf, o.MaxPerSubject, time.Now())
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.reserveCertificateQuota")
+	}
+	if !ok {
+		return nil, errs.New(http.StatusTooManyRequests, "provisioner %q has exceeded its certificate quota for %q", p.GetName(), name)
+	}
+
+	return func(issued *x509.Certificate) {
+		if issued != nil && issued.SerialNumber.Cmp(leaf.SerialNumber) == 0 {
+			return
+		}
+		if err := counter.RemoveCertificateFromQuota(p.GetID(), leaf); err != nil {
+			log.Printf("error releasing the certificate quota of serial number %s: %v", leaf.SerialNumber, err)
+		}
+		// The CA service might not use the serial number of the template.
+		if issued != nil {
+			if _, _, err := counter.AddCertificateToQuota(p.GetID(), issued, 0, time.Now()); err != nil {
+				log.Printf("error adding the certificate with serial number %s to the certificate quota: %v", issued.SerialNumber, err)
+			}
+		}
+	}, nil
+}
@@ -0,0 +1,147 @@
+package authority
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+)
+
+func TestAuthority_reserveCertificateQuota(t *testing.T) {
+	authDB, err := db.New(&db.Config{Type: "badgerv2", DataSource: t.TempDir()})
+	require.NoError(t, err)
+	t.Cleanup(func() { authDB.Shutdown() })
+	d := authDB.(*db.DB)
+
+	var serial int64
+	newLeaf := func(notAfter time.Time, dnsNames ...string) *x509.Certificate {
+		serial++
+		return &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: dnsNames[0]},
+			DNSNames:     dnsNames,
+			NotBefore:    time.Now().Add(-2 * time.Hour),
+			NotAfter:     notAfter,
+		}
+	}
+	assertTooManyRequests := func(t *testing.T, err error) {
+		t.Helper()
+		var sc render.StatusCodedError
+		require.ErrorAs(t, err, &sc)
+		assert.Equal(t, http.StatusTooManyRequests, sc.StatusCode())
+	}
+
+	p := &provisioner.JWK{ID: "jwk-1", Name: "jwk-1", Options: &provisioner.Options{
+		CertificateQuota: &provisioner.CertificateQuotaOptions{MaxPerSubject: 2},
+	}}
+	other := &provisioner.JWK{ID: "jwk-2", Name: "jwk-2", Options: p.Options}
+	exp := time.Now().Add(time.Hour)
+
+	a := testAuthority(t, WithDatabase(authDB))
+	reserve := func(t *testing.T, p provisioner.Interface, leaf *x509.Certificate) error {
+		t.Helper()
+		done, err := a.reserveCertificateQuota(p, leaf)
+		if err == nil {
+			done(leaf)
+		}
+		return err
+	}
+
+	// a.example.com has 2 valid certificates, b.example.com has one valid and
+	// one expired.
+	require.NoError(t, reserve(t, p, newLeaf(exp, "a.example.com")))
+	require.NoError(t, reserve(t, p, newLeaf(exp, "b.example.com", "a.example.com")))
+	require.NoError(t, reserve(t, p, newLeaf(time.Now().Add(-time.Minute), "b.example.com")))
+	require.NoError(t, reserve(t, other, newLeaf(exp, "b.example.com")))
+
+	t.Run("ok", func(t *testing.T) {
+		leaf := newLeaf(exp, "b.example.com")
+		require.NoError(t, reserve(t, p, leaf))
+		require.NoError(t, d.Revoke(&db.RevokedCertificateInfo{Serial: leaf.SerialNumber.String()}))
+		assert.NoError(t, reserve(t, p, newLeaf(exp, "b.example.com")))
+		assert.NoError(t, reserve(t, p, newLeaf(exp, "c.example.com")))
+	})
+
+	t.Run("ok serial number", func(t *testing.T) {
+		leaf := newLeaf(exp, "d.example.com")
+		leaf.SerialNumber = nil
+		done, err := a.reserveCertificateQuota(p, leaf)
+		require.NoError(t, err)
+		assert.NotNil(t, leaf.SerialNumber)
+
+		// The reservation is moved to the serial of the issued certificate.
+		issued := newLeaf(exp, "d.example.com")
+		done(issued)
+		require.NoError(t, reserve(t, p, newLeaf(exp, "d.example.com")))
+		require.NoError(t, d.Revoke(&db.RevokedCertificateInfo{Serial: issued.SerialNumber.String()}))
+		assert.NoError(t, reserve(t, p, newLeaf(exp, "d.example.com")))
+	})
+
+	t.Run("ok released", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			done, err := a.reserveCertificateQuota(p, newLeaf(exp, "e.example.com"))
+			require.NoError(t, err)
+			done(nil)
+		}
+	})
+
+	t.Run("ok no options", func(t *testing.T) {
+		_, err := a.reserveCertificateQuota(nil, nil)
+		assert.NoError(t, err)
+		_, err = a.reserveCertificateQuota(&provisioner.JWK{ID: "jwk-3", Name: "jwk-3"}, newLeaf(exp, "a.example.com"))
+		assert.NoError(t, err)
+		_, err = a.reserveCertificateQuota(&provisioner.SSHPOP{Name: "sshpop"}, nil)
+		assert.NoError(t, err)
+	})
+
+	t.Run("fail quota", func(t *testing.T) {
+		assertTooManyRequests(t, reserve(t, p, newLeaf(exp, "a.example.com")))
+		assertTooManyRequests(t, reserve(t, p, newLeaf(exp, "f.example.com", "a.example.com")))
+		// The names of a rejected certificate are not counted.
+		require.NoError(t, reserve(t, p, newLeaf(exp, "f.example.com")))
+		require.NoError(t, reserve(t, p, newLeaf(exp, "f.example.com")))
+	})
+
+	t.Run("fail concurrent", func(t *testing.T) {
+		var (
+			wg      sync.WaitGroup
+			mu      sync.Mutex
+			success int
+		)
+		for i := 0; i < 10; i++ {
+			leaf := newLeaf(exp, "g.example.com")
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := a.reserveCertificateQuota(p, leaf); err == nil {
+					mu.Lock()
+					success++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		assert.NotZero(t, success)
+		assert.LessOrEqual(t, success, 2)
+	})
+
+	t.Run("fail database", func(t *testing.T) {
+		a := testAuthority(t, WithDatabase(&db.MockAuthDB{Err: errors.New("force")}))
+		_, err := a.reserveCertificateQuota(p, newLeaf(exp, "a.example.com"))
+		assert.Error(t, err)
+		a = testAuthority(t, WithDatabase(&db.SimpleDB{}))
+		_, err = a.reserveCertificateQuota(p, newLeaf(exp, "a.example.com"))
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,69 @@
+package authority
+
+import (
+	"net/http"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/errs"
+)
+
+// provisionerRateLimiter is the rate limiter of a provisioner, with the
+// options used to create it.
+type provisionerRateLimiter struct {
+	options provisioner.RateLimitOptions
+	limiter *rate.Limiter
+}
+
+// checkRateLimit returns a 429 error if the provisioner has exceeded the
+// number of signing requests configured in its rateLimit options. The limit is
+// checked before authorizing the sign, renew and rekey requests, so the
+// rejected requests do not run the provisioner authorization or its webhooks.
+// The limiters are created on demand, and they are created again if the
+// options of the provisioner change.
+func (a *Authority) checkRateLimit(p provisioner.Interface) error {
+	if p == nil {
+		return nil
+	}
+	po, ok := p.(interface{ GetOptions() *provisioner.Options })
+	if !ok {
+		return nil
+	}
+	o := po.GetOptions().GetRateLimit()
+	if o == nil || o.RequestsPerMinute <= 0 {
+		return nil
+	}
+
+	a.rateLimitersMutex.Lock()
+	rl, ok := a.rateLimiters[p.GetID()]
+	if !ok || rl.options != *o {
+		if a.rateLimiters == nil {
+			a.rateLimiters = make(map[string]*provisionerRateLimiter)
+		}
+		rl = &provisionerRateLimiter{
+			options: *o,
+			limiter: rate.NewLimiter(rate.Every(time.Minute/time.Duration(o.RequestsPerMinute)), o.GetBurst()),
+		}
+		a.rateLimiters[p.GetID()] = rl
+	}
+	a.rateLimitersMutex.Unlock()
+
+	if !rl.limiter.Allow() {
+		return errs.New(http.StatusTooManyRequests, "provisioner %q has exceeded its rate limit", p.GetName())
+	}
+	return nil
+}
+
+// isTokenAuthorized returns false for the provisioners that authorize the sign
+// requests in their own packages, like ACME and SCEP, their rate limit is
+// checked when the certificate is signed.
+func isTokenAuthorized(p provisioner.Interface) bool {
+	switch p.(type) {
+	case *provisioner.ACME, *provisioner.SCEP:
+		return false
+	default:
+		return true
+	}
+}
@@ -0,0 +1,155 @@
+package authority
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/pemutil"
+
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func TestAuthority_checkRateLimit(t *testing.T) {
+	a := testAuthority(t)
+	assertTooManyRequests := func(t *testing.T, err error) {
+		t.Helper()
+		var sc render.StatusCodedError
+		require.ErrorAs(t, err, &sc)
+		assert.Equal(t, http.StatusTooManyRequests, sc.StatusCode())
+	}
+
+	t.Run("ok no options", func(t *testing.T) {
+		p := &provisioner.JWK{ID: "jwk-1", Name: "jwk-1"}
+		for i := 0; i < 100; i++ {
+			require.NoError(t, a.checkRateLimit(p))
+		}
+		require.NoError(t, a.checkRateLimit(nil))
+		require.NoError(t, a.checkRateLimit(&provisioner.SSHPOP{Name: "sshpop"}))
+	})
+
+	t.Run("ok burst", func(t *testing.T) {
+		p := &provisioner.JWK{ID: "jwk-2", Name: "jwk-2", Options: &provisioner.Options{
+			RateLimit: &provisioner.RateLimitOptions{RequestsPerMinute: 1, Burst: 2},
+		}}
+		require.NoError(t, a.checkRateLimit(p))
+		require.NoError(t, a.checkRateLimit(p))
+		assertTooManyRequests(t, a.checkRateLimit(p))
+
+		// other provisioners are not affected
+		other := &provisioner.JWK{ID: "jwk-3", Name: "jwk-3", Options: p.Options}
+		require.NoError(t, a.checkRateLimit(other))
+	})
+
+	t.Run("ok options changed", func(t *testing.T) {
+		p := &provisioner.JWK{ID: "jwk-4", Name: "jwk-4", Options: &provisioner.Options{
+			RateLimit: &provisioner.RateLimitOptions{RequestsPerMinute: 1},
+		}}
+		require.NoError(t, a.checkRateLimit(p))
+		assertTooManyRequests(t, a.checkRateLimit(p))
+
+		p.Options.RateLimit = &provisioner.RateLimitOptions{RequestsPerMinute: 1, Burst: 3}
+		require.NoError(t, a.checkRateLimit(p))
+		require.NoError(t, a.checkRateLimit(p))
+		require.NoError(t, a.checkRateLimit(p))
+		assertTooManyRequests(t, a.checkRateLimit(p))
+	})
+}
+
+func TestAuthority_rateLimitBeforeAuthorization(t *testing.T) {
+	assertStatusCode := func(t *testing.T, code int, err error) {
+		t.Helper()
+		var sc render.StatusCodedError
+		require.ErrorAs(t, err, &sc)
+		assert.Equal(t, code, sc.StatusCode())
+	}
+	rateLimit := &provisioner.RateLimitOptions{RequestsPerMinute: 1}
+
+	t.Run("sign", func(t *testing.T) {
+		a := testAuthority(t)
+		p, err := a.LoadProvisionerByName("step-cli")
+		require.NoError(t, err)
+		p.(*provisioner.JWK).Options = &provisioner.Options{RateLimit: rateLimit}
+
+		jwk, err := jose.ReadKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+		require.NoError(t, err)
+		sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: jwk.Key},
+			(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", jwk.KeyID))
+		require.NoError(t, err)
+		newToken := func(id string) string {
+			// The token is not valid, it does not have a subject.
+			raw, err := jose.Signed(sig).Claims(jose.Claims{
+				Issuer:    "step-cli",
+				NotBefore: jose.NewNumericDate(time.Now()),
+				Expiry:    jose.NewNumericDate(time.Now().Add(time.Minute)),
+				Audience:  []string{"https://example.com/sign"},
+				ID:        id,
+			}).CompactSerialize()
+			require.NoError(t, err)
+			return raw
+		}
+
+		// Requests that fail the authorization are also limited.
+		_, err = a.authorizeSign(context.Background(), newToken("1"))
+		assertStatusCode(t, http.StatusUnauthorized, err)
+		_, err = a.authorizeSign(context.Background(), newToken("2"))
+		assertStatusCode(t, http.StatusTooManyRequests, err)
+	})
+
+	t.Run("validate token", func(t *testing.T) {
+		a := testAuthority(t)
+		p, err := a.LoadProvisionerByName("step-cli")
+		require.NoError(t, err)
+		p.(*provisioner.JWK).Options = &provisioner.Options{RateLimit: rateLimit}
+
+		jwk, err := jose.ReadKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+		require.NoError(t, err)
+		newToken := func() string {
+			raw, err := generateToken("test.smallstep.com", "step-cli", testAudiences.Sign[0],
+				[]string{"test.smallstep.com"}, time.Now(), jwk)
+			require.NoError(t, err)
+			return raw
+		}
+		token := newToken()
+
+		// Validations do not use the budget of the sign requests.
+		for i := 0; i < 3; i++ {
+			_, err = a.ValidateToken(context.Background(), token)
+			require.NoError(t, err)
+		}
+		ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod)
+		_, err = a.Authorize(ctx, token)
+		require.NoError(t, err)
+		_, err = a.ValidateToken(context.Background(), token)
+		require.NoError(t, err)
+		_, err = a.authorizeSign(context.Background(), newToken())
+		assertStatusCode(t, http.StatusTooManyRequests, err)
+	})
+
+	t.Run("renew", func(t *testing.T) {
+		a := testAuthority(t)
+		crt, err := pemutil.ReadCertificate("testdata/certs/foo.crt")
+		require.NoError(t, err)
+		crt.NotAfter = time.Now().Add(time.Hour)
+		p, err := a.LoadProvisionerByCertificate(crt)
+		require.NoError(t, err)
+		p.(*provisioner.JWK).Options = &provisioner.Options{RateLimit: rateLimit}
+
+		_, err = a.authorizeRenew(context.Background(), crt)
+		require.NoError(t, err)
+		_, err = a.authorizeRenew(context.Background(), crt)
+		assertStatusCode(t, http.StatusTooManyRequests, err)
+	})
+}
+
+func Test_isTokenAuthorized(t *testing.T) {
+	assert.True(t, isTokenAuthorized(&provisioner.JWK{}))
+	assert.True(t, isTokenAuthorized(&provisioner.SSHPOP{}))
+	assert.False(t, isTokenAuthorized(&provisioner.ACME{}))
+	assert.False(t, isTokenAuthorized(&provisioner.SCEP{}))
+}
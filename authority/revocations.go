@@ -0,0 +1,84 @@
+package authority
+
+import (
+	"context"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/errs"
+)
+
+// ImportRevokedCertificates adds to the database a list of certificates
+// revoked by another certificate authority, for example, when the certificates
+// of an existing CA are migrated to step-ca. All the entries are written in
+// one transaction, and the returned list contains the result of each entry:
+// nil if it has been imported, db.ErrAlreadyExists if the certificate was
+// already revoked, or the validation error of the entry.
+//
+// The serial numbers are normalized to their decimal representation. The CRL
+// is not generated again, callers should call GenerateCertificateRevocationList
+// after importing all the entries.
+func (a *Authority) ImportRevokedCertificates(_ context.Context, rcis []*db.RevokedCertificateInfo) ([]error, error) {
+	if _, ok := a.adminDB.(*linkedCaClient); ok {
+		return nil, errs.New(http.StatusNotImplemented, "importing revoked certificates is not supported with a linked authority")
+	}
+	importer, ok := a.db.(db.RevocationImporter)
+	if !ok {
+		return nil, errs.New(http.StatusNotImplemented, "database does not support importing revoked certificates")
+	}
+
+	now := time.Now()
+	results := make([]error, len(rcis))
+	valid := make([]*db.RevokedCertificateInfo, 0, len(rcis))
+	index := make([]int, 0, len(rcis))
+	for i, rci := range rcis {
+		if err := validateRevokedCertificateInfo(rci, now); err != nil {
+			results[i] = err
+			continue
+		}
+		valid = append(valid, rci)
+		index = append(index, i)
+	}
+	if len(valid) == 0 {
+		return results, nil
+	}
+
+	imported, err := importer.ImportRevokedCertificates(valid)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.ImportRevokedCertificates")
+	}
+	for i, err := range imported {
+		results[index[i]] = err
+	}
+	return results, nil
+}
+
+// validateRevokedCertificateInfo validates the serial number, reason code and
+// revocation time of an imported revoked certificate. The serial number is
+// normalized to its decimal representation.
+func validateRevokedCertificateInfo(rci *db.RevokedCertificateInfo, now time.Time) error {
+	if rci == nil {
+		return errors.New("revoked certificate cannot be empty")
+	}
+	sn, ok := new(big.Int).SetString(rci.Serial, 10)
+	if !ok || sn.Sign() <= 0 {
+		return errors.Errorf("serial number %q is not valid", rci.Serial)
+	}
+	// The reason code 7 is not used in RFC 5280.
+	if rci.ReasonCode < ocsp.Unspecified || rci.ReasonCode > ocsp.AACompromise || rci.ReasonCode == 7 {
+		return errors.Errorf("reason code %d is not valid", rci.ReasonCode)
+	}
+	switch {
+	case rci.RevokedAt.IsZero():
+		return errors.New("revocation time cannot be empty")
+	case rci.RevokedAt.After(now):
+		return errors.Errorf("revocation time %s is in the future", rci.RevokedAt.Format(time.RFC3339))
+	}
+	rci.Serial = sn.String()
+	return nil
+}
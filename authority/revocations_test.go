@@ -0,0 +1,108 @@
+package authority
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/db"
+)
+
+func TestAuthority_ImportRevokedCertificates(t *testing.T) {
+	authDB, err := db.New(&db.Config{Type: "badgerv2", DataSource: t.TempDir()})
+	require.NoError(t, err)
+	t.Cleanup(func() { authDB.Shutdown() })
+
+	a := testAuthority(t, WithDatabase(authDB))
+	a.config.CRL = &config.CRLConfig{Enabled: true}
+
+	const total = 3000
+	revokedAt := time.Now().Add(-time.Hour).Truncate(time.Second).UTC()
+	reasonCodes := []int{ocsp.Unspecified, ocsp.KeyCompromise, ocsp.Superseded, ocsp.CessationOfOperation}
+
+	start := time.Now()
+	for i := 0; i < total; i += 500 {
+		rcis := make([]*db.RevokedCertificateInfo, 500)
+		for j := range rcis {
+			n := i + j + 1
+			rcis[j] = &db.RevokedCertificateInfo{
+				Serial:     fmt.Sprintf("%d", n),
+				ReasonCode: reasonCodes[n%len(reasonCodes)],
+				RevokedAt:  revokedAt.Add(-time.Duration(n) * time.Second),
+			}
+		}
+		results, err := a.ImportRevokedCertificates(context.Background(), rcis)
+		require.NoError(t, err)
+		require.Len(t, results, len(rcis))
+		for _, err := range results {
+			require.NoError(t, err)
+		}
+	}
+	assert.Less(t, time.Since(start), 10*time.Second)
+
+	// Entries already revoked and invalid entries are reported
+	results, err := a.ImportRevokedCertificates(context.Background(), []*db.RevokedCertificateInfo{
+		{Serial: "1", ReasonCode: ocsp.KeyCompromise, RevokedAt: revokedAt},
+		{Serial: "0003001", ReasonCode: ocsp.AffiliationChanged, RevokedAt: revokedAt},
+		{Serial: "0x1234", ReasonCode: ocsp.KeyCompromise, RevokedAt: revokedAt},
+		{Serial: "-10", ReasonCode: ocsp.KeyCompromise, RevokedAt: revokedAt},
+		{Serial: "3002", ReasonCode: 7, RevokedAt: revokedAt},
+		{Serial: "3003", ReasonCode: ocsp.AACompromise + 1, RevokedAt: revokedAt},
+		{Serial: "3004", ReasonCode: ocsp.KeyCompromise},
+		{Serial: "3005", ReasonCode: ocsp.KeyCompromise, RevokedAt: time.Now().Add(time.Hour)},
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 8)
+	assert.ErrorIs(t, results[0], db.ErrAlreadyExists)
+	assert.NoError(t, results[1])
+	assert.EqualError(t, results[2], `serial number "0x1234" is not valid`)
+	assert.EqualError(t, results[3], `serial number "-10" is not valid`)
+	assert.EqualError(t, results[4], "reason code 7 is not valid")
+	assert.EqualError(t, results[5], "reason code 11 is not valid")
+	assert.EqualError(t, results[6], "revocation time cannot be empty")
+	assert.ErrorContains(t, results[7], "is in the future")
+
+	isRevoked, err := authDB.IsRevoked("3001")
+	require.NoError(t, err)
+	assert.True(t, isRevoked)
+
+	// The imported entries appear in the CRL
+	require.NoError(t, a.GenerateCertificateRevocationList())
+	crlInfo, err := a.GetCertificateRevocationList()
+	require.NoError(t, err)
+	crl, err := x509.ParseRevocationList(crlInfo.Data)
+	require.NoError(t, err)
+	require.Len(t, crl.RevokedCertificateEntries, total+1)
+
+	for _, e := range crl.RevokedCertificateEntries {
+		n := int(e.SerialNumber.Int64())
+		if n == total+1 {
+			assert.Equal(t, ocsp.AffiliationChanged, e.ReasonCode)
+			assert.Equal(t, revokedAt, e.RevocationTime)
+			continue
+		}
+		require.True(t, n > 0 && n <= total, "unexpected serial number %d", n)
+		assert.Equal(t, reasonCodes[n%len(reasonCodes)], e.ReasonCode, "serial number %d", n)
+		assert.Equal(t, revokedAt.Add(-time.Duration(n)*time.Second), e.RevocationTime, "serial number %d", n)
+	}
+}
+
+func TestAuthority_ImportRevokedCertificates_notSupported(t *testing.T) {
+	a := testAuthority(t)
+	a.db = &struct{ db.AuthDB }{&db.MockAuthDB{}}
+	_, err := a.ImportRevokedCertificates(context.Background(), []*db.RevokedCertificateInfo{
+		{Serial: "1", RevokedAt: time.Now()},
+	})
+	var sc render.StatusCodedError
+	require.ErrorAs(t, err, &sc)
+	assert.Equal(t, http.StatusNotImplemented, sc.StatusCode())
+}
@@ -3,6 +3,8 @@ package authority
 import (
 	"crypto/x509"
 
+	"github.com/pkg/errors"
+
 	"github.com/smallstep/certificates/errs"
 )
 
@@ -42,6 +44,66 @@ func (a *Authority) GetRoots() ([]*x509.Certificate, error) {
 	return a.rootX509Certs, nil
 }
 
+// GetAlternateChains returns the alternate chains of intermediates of the given
+// certificate. A chain can be used if its first certificate is the issuer of
+// the certificate, e.g. the same intermediate cross-signed by another root.
+func (a *Authority) GetAlternateChains(crt *x509.Certificate) [][]*x509.Certificate {
+	var chains [][]*x509.Certificate
+	for _, chain := range a.alternateX509Chains {
+		if crt.CheckSignatureFrom(chain[0]) == nil {
+			chains = append(chains, chain)
+		}
+	}
+	return chains
+}
+
+// GetCertificateChains returns the chains that can be served for the given
+// certificate chain, the chain signed by the authority followed by the ones
+// using the alternate chains of intermediates. All the chains start with the
+// leaf certificate.
+//
+// If a preferred chain is given, or configured in the authority, the first
+// chain with the topmost certificate issued by a CA with that common name is
+// returned first. The order of the other chains is kept.
+func (a *Authority) GetCertificateChains(certChain []*x509.Certificate, preferredChain string) [][]*x509.Certificate {
+	if len(certChain) == 0 {
+		return [][]*x509.Certificate{certChain}
+	}
+
+	leaf := certChain[0]
+	chains := [][]*x509.Certificate{certChain}
+	for _, chain := range a.GetAlternateChains(leaf) {
+		chains = append(chains, append([]*x509.Certificate{leaf}, chain...))
+	}
+
+	if preferredChain == "" {
+		preferredChain = a.config.PreferredChain
+	}
+	if preferredChain == "" || len(chains) == 1 {
+		return chains
+	}
+	for i, chain := range chains {
+		if chain[len(chain)-1].Issuer.CommonName == preferredChain {
+			return append([][]*x509.Certificate{chain}, append(chains[:i:i], chains[i+1:]...)...)
+		}
+	}
+	return chains
+}
+
+// validateAlternateChain checks that the given chain is not empty and that
+// each certificate is signed by the next one.
+func validateAlternateChain(chain []*x509.Certificate) error {
+	if len(chain) == 0 {
+		return errors.New("chain cannot be empty")
+	}
+	for i := 0; i < len(chain)-1; i++ {
+		if err := chain[i].CheckSignatureFrom(chain[i+1]); err != nil {
+			return errors.Wrapf(err, "certificate %q is not signed by %q", chain[i].Subject, chain[i+1].Subject)
+		}
+	}
+	return nil
+}
+
 // GetFederation returns all the root certificates in the federation.
 // This method implements the Authority interface.
 func (a *Authority) GetFederation() (federation []*x509.Certificate, err error) {
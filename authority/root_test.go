@@ -1,12 +1,16 @@
 package authority
 
 import (
+	"crypto/rand"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"errors"
+	"math/big"
 	"net/http"
 	"reflect"
 	"testing"
 
+	"go.step.sm/crypto/minica"
 	"go.step.sm/crypto/pemutil"
 
 	"github.com/smallstep/assert"
@@ -152,3 +156,145 @@ func TestAuthority_GetFederation(t *testing.T) {
 		})
 	}
 }
+
+func mustCrossSign(t *testing.T, crt *x509.Certificate, ca *minica.CA) *x509.Certificate {
+	t.Helper()
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               crt.Subject,
+		SubjectKeyId:          crt.SubjectKeyId,
+		NotBefore:             crt.NotBefore,
+		NotAfter:              crt.NotAfter,
+		KeyUsage:              crt.KeyUsage,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.Root, crt.PublicKey, ca.RootSigner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cross, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cross
+}
+
+func TestAuthority_GetAlternateChains(t *testing.T) {
+	ca0, err := minica.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca1, err := minica.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := ca0.Sign(&x509.Certificate{
+		Subject:   pkix.Name{CommonName: "test.smallstep.com"},
+		DNSNames:  []string{"test.smallstep.com"},
+		PublicKey: ca0.Signer.Public(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cross := mustCrossSign(t, ca0.Intermediate, ca1)
+
+	tests := []struct {
+		name   string
+		chains [][]*x509.Certificate
+		crt    *x509.Certificate
+		want   [][]*x509.Certificate
+	}{
+		{"ok", [][]*x509.Certificate{{cross}}, leaf, [][]*x509.Certificate{{cross}}},
+		{"ok filtered", [][]*x509.Certificate{{ca1.Intermediate}, {cross}}, leaf, [][]*x509.Certificate{{cross}}},
+		{"ok none", [][]*x509.Certificate{{ca1.Intermediate}}, leaf, nil},
+		{"ok no chains", nil, leaf, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testAuthority(t, WithX509AlternateChains(tt.chains...))
+			if got := a.GetAlternateChains(tt.crt); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Authority.GetAlternateChains() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthority_GetCertificateChains(t *testing.T) {
+	ca0, err := minica.New(minica.WithName("Old"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca1, err := minica.New(minica.WithName("New"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := ca0.Sign(&x509.Certificate{
+		Subject:   pkix.Name{CommonName: "test.smallstep.com"},
+		DNSNames:  []string{"test.smallstep.com"},
+		PublicKey: ca0.Signer.Public(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cross := mustCrossSign(t, ca0.Intermediate, ca1)
+	chain := []*x509.Certificate{leaf, ca0.Intermediate}
+	crossChain := []*x509.Certificate{leaf, cross, ca1.Root}
+
+	tests := []struct {
+		name            string
+		chains          [][]*x509.Certificate
+		configPreferred string
+		preferred       string
+		certChain       []*x509.Certificate
+		want            [][]*x509.Certificate
+	}{
+		{"ok", [][]*x509.Certificate{{cross, ca1.Root}}, "", "", chain, [][]*x509.Certificate{chain, crossChain}},
+		{"ok no alternate chains", nil, "", "New Root CA", chain, [][]*x509.Certificate{chain}},
+		{"ok preferred", [][]*x509.Certificate{{cross, ca1.Root}}, "", "New Root CA", chain, [][]*x509.Certificate{crossChain, chain}},
+		{"ok preferred default", [][]*x509.Certificate{{cross, ca1.Root}}, "", "Old Root CA", chain, [][]*x509.Certificate{chain, crossChain}},
+		{"ok preferred in config", [][]*x509.Certificate{{cross, ca1.Root}}, "New Root CA", "", chain, [][]*x509.Certificate{crossChain, chain}},
+		{"ok preferred overrides config", [][]*x509.Certificate{{cross, ca1.Root}}, "New Root CA", "Old Root CA", chain, [][]*x509.Certificate{chain, crossChain}},
+		{"ok preferred not found", [][]*x509.Certificate{{cross, ca1.Root}}, "", "Other Root CA", chain, [][]*x509.Certificate{chain, crossChain}},
+		{"ok empty", [][]*x509.Certificate{{cross, ca1.Root}}, "", "", nil, [][]*x509.Certificate{nil}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testAuthority(t, WithX509AlternateChains(tt.chains...))
+			a.config.PreferredChain = tt.configPreferred
+			if got := a.GetCertificateChains(tt.certChain, tt.preferred); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Authority.GetCertificateChains() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_validateAlternateChain(t *testing.T) {
+	ca0, err := minica.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca1, err := minica.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cross := mustCrossSign(t, ca0.Intermediate, ca1)
+
+	tests := []struct {
+		name    string
+		chain   []*x509.Certificate
+		wantErr bool
+	}{
+		{"ok", []*x509.Certificate{cross}, false},
+		{"ok with root", []*x509.Certificate{cross, ca1.Root}, false},
+		{"fail empty", nil, true},
+		{"fail not signed", []*x509.Certificate{cross, ca0.Root}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateAlternateChain(tt.chain); (err != nil) != tt.wantErr {
+				t.Errorf("validateAlternateChain() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,562 @@
+package authority
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	kmsapi "go.step.sm/crypto/kms/apiv1"
+	"go.step.sm/crypto/pemutil"
+
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/cas"
+	casapi "github.com/smallstep/certificates/cas/apiv1"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/certificates/scep"
+)
+
+// intermediateRotation is a new intermediate key waiting for its certificate.
+type intermediateRotation struct {
+	keyName    string
+	signer     crypto.Signer
+	privateKey crypto.PrivateKey
+	csr        *x509.CertificateRequest
+	createdAt  time.Time
+}
+
+// previousIntermediate is an intermediate replaced by a rotation. The files
+// are the ones in the configuration, and the signer is used to sign the CRL
+// of the certificates issued by it.
+type previousIntermediate struct {
+	certFile string
+	keyName  string
+	chain    []*x509.Certificate
+	signer   crypto.Signer
+}
+
+// IntermediateRotation contains the information of an intermediate rotation in
+// progress. The certificate request must be signed by the root, and the
+// certificate activated using ActivateIntermediateRotation.
+type IntermediateRotation struct {
+	KeyName            string
+	CertificateRequest *x509.CertificateRequest
+	CreatedAt          time.Time
+}
+
+func (r *intermediateRotation) info() *IntermediateRotation {
+	return &IntermediateRotation{
+		KeyName:            r.keyName,
+		CertificateRequest: r.csr,
+		CreatedAt:          r.createdAt,
+	}
+}
+
+// GetIntermediateCertificates returns the intermediates used to sign new
+// certificates, and the intermediates replaced by a rotation that have not
+// expired yet. Certificates signed by the previous intermediates are still
+// valid.
+func (a *Authority) GetIntermediateCertificates() (current, previous []*x509.Certificate) {
+	a.x509CAMutex.RLock()
+	defer a.x509CAMutex.RUnlock()
+	now := time.Now()
+	for _, pi := range a.previousIntermediates {
+		for _, crt := range pi.chain {
+			if now.Before(crt.NotAfter) {
+				previous = append(previous, crt)
+			}
+		}
+	}
+	return a.intermediateX509Certs, previous
+}
+
+// getPreviousIntermediates returns the previous intermediates that have not
+// expired yet.
+func (a *Authority) getPreviousIntermediates() []*previousIntermediate {
+	a.x509CAMutex.RLock()
+	defer a.x509CAMutex.RUnlock()
+	now := time.Now()
+	previous := make([]*previousIntermediate, 0, len(a.previousIntermediates))
+	for _, pi := range a.previousIntermediates {
+		if now.Before(pi.chain[0].NotAfter) {
+			previous = append(previous, pi)
+		}
+	}
+	return previous
+}
+
+// loadPreviousIntermediates loads the intermediates replaced by an online
+// rotation. The expired ones are skipped.
+func (a *Authority) loadPreviousIntermediates() error {
+	now := time.Now()
+	for _, c := range a.config.PreviousIntermediates {
+		chain, err := pemutil.ReadCertificateBundle(c.Cert)
+		if err != nil {
+			return err
+		}
+		if !now.Before(chain[0].NotAfter) {
+			continue
+		}
+		signer, err := a.keyManager.CreateSigner(&kmsapi.CreateSignerRequest{
+			SigningKey: c.Key,
+			Password:   a.password,
+		})
+		if err != nil {
+			return errors.Wrapf(err, "error loading previous intermediate key %s", c.Key)
+		}
+		a.previousIntermediates = append(a.previousIntermediates, &previousIntermediate{
+			certFile: c.Cert,
+			keyName:  c.Key,
+			chain:    chain,
+			signer:   signer,
+		})
+	}
+	return nil
+}
+
+// GetIssuerCertificateRevocationList returns the CRL of the certificates
+// issued by a previous intermediate, signed with the key of that
+// intermediate. The key id is the hexadecimal subject key id of the
+// intermediate.
+func (a *Authority) GetIssuerCertificateRevocationList(keyID string) (*CertificateRevocationListInfo, error) {
+	if !a.config.CRL.IsEnabled() {
+		return nil, errs.Wrap(http.StatusNotFound, errors.Errorf("Certificate Revocation Lists are not enabled"), "authority.GetIssuerCertificateRevocationList")
+	}
+	a.crlMutex.Lock()
+	defer a.crlMutex.Unlock()
+	crlInfo, ok := a.previousCRLs[strings.ToLower(keyID)]
+	if !ok {
+		return nil, errs.New(http.StatusNotFound, "no CRL available for issuer %s", keyID)
+	}
+	return crlInfo, nil
+}
+
+// generatePreviousCRLs signs the given revocation list with the keys of the
+// previous intermediates, so the certificates issued by them can still be
+// checked. It must be called with the crlMutex locked.
+func (a *Authority) generatePreviousCRLs(revocationList *x509.RevocationList) {
+	crls := make(map[string]*CertificateRevocationListInfo)
+	for _, pi := range a.getPreviousIntermediates() {
+		der, err := x509.CreateRevocationList(rand.Reader, revocationList, pi.chain[0], pi.signer)
+		if err != nil {
+			log.Printf("error creating CRL for previous intermediate %s: %v", pi.certFile, err)
+			continue
+		}
+		crls[hex.EncodeToString(pi.chain[0].SubjectKeyId)] = &CertificateRevocationListInfo{
+			Number:    revocationList.Number.Int64(),
+			ExpiresAt: revocationList.NextUpdate,
+			Duration:  revocationList.NextUpdate.Sub(revocationList.ThisUpdate),
+			Data:      der,
+		}
+	}
+	a.previousCRLs = crls
+}
+
+// CreateIntermediateRotation starts the rotation of the intermediate. It
+// creates a new key with the given name in the configured KMS, and returns a
+// certificate request with the subject of the current intermediate.
+//
+// With softkms, the key is only written to disk once the new intermediate is
+// activated.
+func (a *Authority) CreateIntermediateRotation(_ context.Context, keyName string) (*IntermediateRotation, error) {
+	if err := a.checkIntermediateRotation(); err != nil {
+		return nil, err
+	}
+	if keyName == "" {
+		return nil, admin.NewError(admin.ErrorBadRequestType, "key name cannot be empty")
+	}
+
+	a.rotationMutex.Lock()
+	defer a.rotationMutex.Unlock()
+	if a.intermediateRotation != nil {
+		return nil, admin.NewError(admin.ErrorConflictType, "an intermediate rotation is already in progress")
+	}
+
+	current := a.getIntermediates()[0]
+	alg, bits, err := signatureAlgorithmFor(current.PublicKey)
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error creating intermediate key")
+	}
+	resp, err := a.keyManager.CreateKey(&kmsapi.CreateKeyRequest{
+		Name:               keyName,
+		SignatureAlgorithm: alg,
+		Bits:               bits,
+	})
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error creating intermediate key")
+	}
+	signer := resp.CreateSignerRequest.Signer
+	if signer == nil {
+		if signer, err = a.keyManager.CreateSigner(&resp.CreateSignerRequest); err != nil {
+			return nil, admin.WrapErrorISE(err, "error creating intermediate signer")
+		}
+	}
+
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: current.Subject,
+	}, signer)
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error creating intermediate certificate request")
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error parsing intermediate certificate request")
+	}
+
+	a.intermediateRotation = &intermediateRotation{
+		keyName:    resp.Name,
+		signer:     signer,
+		privateKey: resp.PrivateKey,
+		csr:        csr,
+		createdAt:  time.Now(),
+	}
+	return a.intermediateRotation.info(), nil
+}
+
+// GetIntermediateRotation returns the intermediate rotation in progress.
+func (a *Authority) GetIntermediateRotation(context.Context) (*IntermediateRotation, error) {
+	a.rotationMutex.Lock()
+	defer a.rotationMutex.Unlock()
+	if a.intermediateRotation == nil {
+		return nil, admin.NewError(admin.ErrorNotFoundType, "there is no intermediate rotation in progress")
+	}
+	return a.intermediateRotation.info(), nil
+}
+
+// CancelIntermediateRotation cancels the intermediate rotation in progress.
+// Keys created in a KMS other than softkms are not deleted.
+func (a *Authority) CancelIntermediateRotation(context.Context) error {
+	a.rotationMutex.Lock()
+	defer a.rotationMutex.Unlock()
+	if a.intermediateRotation == nil {
+		return admin.NewError(admin.ErrorNotFoundType, "there is no intermediate rotation in progress")
+	}
+	a.intermediateRotation = nil
+	return nil
+}
+
+// ActivateIntermediateRotation replaces the intermediate used to sign
+// certificates with the one in the given chain. The first certificate in the
+// chain must be the new intermediate, signed using the certificate request of
+// the rotation in progress. If the chain is empty, the certificate is signed
+// using the root key in the intermediateRotation configuration.
+//
+// The new chain and key are written next to the current ones, and the
+// configuration file is updated to use them. The previous intermediates are
+// kept in the configuration until they expire, and their keys sign the CRL of
+// the certificates issued by them. The SCEP authority is updated to use the
+// new intermediate.
+func (a *Authority) ActivateIntermediateRotation(ctx context.Context, chain []*x509.Certificate) ([]*x509.Certificate, error) {
+	if err := a.checkIntermediateRotation(); err != nil {
+		return nil, err
+	}
+
+	a.rotationMutex.Lock()
+	defer a.rotationMutex.Unlock()
+	rotation := a.intermediateRotation
+	if rotation == nil {
+		return nil, admin.NewError(admin.ErrorNotFoundType, "there is no intermediate rotation in progress")
+	}
+
+	current, _ := a.GetIntermediateCertificates()
+	if len(chain) == 0 {
+		rc := a.config.AuthorityConfig.IntermediateRotation
+		if rc == nil || rc.RootKey == "" {
+			return nil, admin.NewError(admin.ErrorBadRequestType, "certificate cannot be empty: the authority is not configured with a root key")
+		}
+		crt, err := a.signIntermediate(rotation.csr, current[0])
+		if err != nil {
+			return nil, err
+		}
+		chain = []*x509.Certificate{crt}
+	}
+	if err := a.validateIntermediateChain(chain, rotation.signer.Public()); err != nil {
+		return nil, err
+	}
+
+	// The key of the current intermediate is kept to sign the CRL of the
+	// certificates issued by it.
+	currentSigner, err := a.keyManager.CreateSigner(&kmsapi.CreateSignerRequest{
+		SigningKey: a.config.IntermediateKey,
+		Password:   a.password,
+	})
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading current intermediate key")
+	}
+
+	// Write the new chain and key, and update the configuration.
+	certFile, err := writeIntermediateChain(filepath.Dir(a.config.IntermediateCert), chain)
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error writing intermediate certificate")
+	}
+	if rotation.privateKey != nil {
+		opts := []pemutil.Options{pemutil.ToFile(rotation.keyName, 0600)}
+		if len(a.password) > 0 {
+			opts = append(opts, pemutil.WithPassword(a.password))
+		}
+		if _, err := pemutil.Serialize(rotation.privateKey, opts...); err != nil {
+			return nil, admin.WrapErrorISE(err, "error writing intermediate key")
+		}
+	}
+
+	// The previous intermediates are written in the configuration, so they
+	// are available after a restart.
+	previous := append([]*previousIntermediate{{
+		certFile: a.config.IntermediateCert,
+		keyName:  a.config.IntermediateKey,
+		chain:    current,
+		signer:   currentSigner,
+	}}, a.getPreviousIntermediates()...)
+	previousConfig := make([]*config.PreviousIntermediate, len(previous))
+	for i, pi := range previous {
+		previousConfig[i] = &config.PreviousIntermediate{Cert: pi.certFile, Key: pi.keyName}
+	}
+
+	oldCert, oldKey, oldPrevious := a.config.IntermediateCert, a.config.IntermediateKey, a.config.PreviousIntermediates
+	a.config.IntermediateCert, a.config.IntermediateKey, a.config.PreviousIntermediates = certFile, rotation.keyName, previousConfig
+	if a.config.WasLoadedFromFile() {
+		if err := a.config.Commit(); err != nil {
+			a.config.IntermediateCert, a.config.IntermediateKey, a.config.PreviousIntermediates = oldCert, oldKey, oldPrevious
+			return nil, admin.WrapErrorISE(err, "error updating configuration")
+		}
+	} else {
+		log.Printf("configuration was not loaded from a file, intermediate certificate %s and key %s must be configured manually", certFile, rotation.keyName)
+	}
+
+	var options casapi.Options
+	if a.config.AuthorityConfig.Options != nil {
+		options = *a.config.AuthorityConfig.Options
+	}
+	options.CertificateChain = chain
+	options.Signer = rotation.signer
+	options.KeyManager = a.keyManager
+	svc, err := cas.New(ctx, options)
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error initializing certificate authority service")
+	}
+
+	// The SCEP authority signs and decrypts with the new intermediate too.
+	scepAuthority, scepOptions, err := a.newRotatedSCEPAuthority(chain, rotation.keyName)
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error initializing scep authority")
+	}
+
+	a.x509CAMutex.Lock()
+	a.x509CAService = svc
+	a.intermediateX509Certs = chain
+	a.previousIntermediates = previous
+	a.constraintsEngine = newConstraintsEngine(chain, a.rootX509Certs)
+	a.x509CAMutex.Unlock()
+
+	if scepAuthority != nil {
+		a.scepMutex.Lock()
+		a.scepAuthority, a.scepOptions = scepAuthority, scepOptions
+		if nextCADB, ok := a.db.(db.SCEPNextCADB); ok {
+			if err := nextCADB.StoreSCEPNextCACertificates(nil); err != nil {
+				log.Printf("error removing the next scep ca certificates: %v", err)
+			}
+		}
+		a.scepMutex.Unlock()
+	}
+
+	a.intermediateRotation = nil
+	return chain, nil
+}
+
+// newRotatedSCEPAuthority returns a SCEP authority with the options of the
+// current one, using the given intermediate and key. It returns nil if SCEP is
+// not enabled. The certificates staged for the rollover are not kept, they
+// are the current ones now.
+func (a *Authority) newRotatedSCEPAuthority(chain []*x509.Certificate, keyName string) (*scep.Authority, *scep.Options, error) {
+	a.scepMutex.RLock()
+	current := a.scepOptions
+	enabled := a.scepAuthority != nil
+	a.scepMutex.RUnlock()
+	if !enabled || current == nil {
+		return nil, nil, nil
+	}
+
+	options := *current
+	options.Intermediates = chain
+	options.SignerCert = chain[0]
+	options.Decrypter, options.DecrypterCert = nil, nil
+	options.NextCACertificates = nil
+	if err := a.setSCEPSigner(&options, keyName); err != nil {
+		return nil, nil, err
+	}
+	scepAuthority, err := scep.New(a, options)
+	if err != nil {
+		return nil, nil, err
+	}
+	return scepAuthority, &options, nil
+}
+
+// checkIntermediateRotation returns an error if the intermediate cannot be
+// rotated by the authority.
+func (a *Authority) checkIntermediateRotation() error {
+	if casapi.TypeOf(a.getX509CAService()) != casapi.SoftCAS || len(a.getIntermediates()) == 0 {
+		return admin.NewError(admin.ErrorNotImplementedType, "intermediate rotation is only supported by the default certificate authority service")
+	}
+	return nil
+}
+
+// signIntermediate signs the given certificate request with the root key in
+// the intermediateRotation configuration. The new certificate keeps the key
+// usages and constraints of the current intermediate.
+func (a *Authority) signIntermediate(csr *x509.CertificateRequest, current *x509.Certificate) (*x509.Certificate, error) {
+	rc := a.config.AuthorityConfig.IntermediateRotation
+	signer, err := a.keyManager.CreateSigner(&kmsapi.CreateSignerRequest{
+		SigningKey: rc.RootKey,
+		Password:   []byte(rc.RootKeyPassword),
+	})
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error creating root signer")
+	}
+
+	var root *x509.Certificate
+	for _, crt := range a.rootX509Certs {
+		if publicKeyEqual(crt.PublicKey, signer.Public()) {
+			root = crt
+			break
+		}
+	}
+	if root == nil {
+		return nil, admin.NewErrorISE("root key does not match any of the root certificates")
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error generating serial number")
+	}
+	now := time.Now()
+	notAfter := now.Add(rc.GetValidity())
+	if notAfter.After(root.NotAfter) {
+		notAfter = root.NotAfter
+	}
+	template := &x509.Certificate{
+		SerialNumber:            serial,
+		Subject:                 csr.Subject,
+		NotBefore:               now.Add(-time.Minute),
+		NotAfter:                notAfter,
+		KeyUsage:                current.KeyUsage,
+		ExtKeyUsage:             current.ExtKeyUsage,
+		BasicConstraintsValid:   true,
+		IsCA:                    true,
+		MaxPathLen:              current.MaxPathLen,
+		MaxPathLenZero:          current.MaxPathLenZero,
+		PermittedDNSDomains:     current.PermittedDNSDomains,
+		ExcludedDNSDomains:      current.ExcludedDNSDomains,
+		PermittedIPRanges:       current.PermittedIPRanges,
+		ExcludedIPRanges:        current.ExcludedIPRanges,
+		PermittedEmailAddresses: current.PermittedEmailAddresses,
+		ExcludedEmailAddresses:  current.ExcludedEmailAddresses,
+		PermittedURIDomains:     current.PermittedURIDomains,
+		ExcludedURIDomains:      current.ExcludedURIDomains,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, root, csr.PublicKey, signer)
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error signing intermediate certificate")
+	}
+	crt, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error parsing intermediate certificate")
+	}
+	return crt, nil
+}
+
+// validateIntermediateChain checks that the first certificate in the chain is
+// a CA with the given public key, and that the chain is signed by one of the
+// roots of the authority.
+func (a *Authority) validateIntermediateChain(chain []*x509.Certificate, pub crypto.PublicKey) error {
+	crt := chain[0]
+	if !crt.IsCA {
+		return admin.NewError(admin.ErrorBadRequestType, "certificate is not a certificate authority")
+	}
+	if !publicKeyEqual(crt.PublicKey, pub) {
+		return admin.NewError(admin.ErrorBadRequestType, "certificate does not match the key of the intermediate rotation")
+	}
+
+	roots := x509.NewCertPool()
+	for _, root := range a.rootX509Certs {
+		roots.AddCert(root)
+	}
+	intermediates := x509.NewCertPool()
+	for _, c := range chain[1:] {
+		intermediates.AddCert(c)
+	}
+	if _, err := crt.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return admin.WrapError(admin.ErrorBadRequestType, err, "error verifying intermediate certificate")
+	}
+	return nil
+}
+
+// writeIntermediateChain writes the given chain in the given directory. The
+// name of the file contains the serial number of the intermediate.
+func writeIntermediateChain(dir string, chain []*x509.Certificate) (string, error) {
+	var b []byte
+	for _, crt := range chain {
+		b = append(b, pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: crt.Raw,
+		})...)
+	}
+	filename := filepath.Join(dir, fmt.Sprintf("intermediate_ca_%x.crt", chain[0].SerialNumber))
+	if err := os.WriteFile(filename, b, 0600); err != nil {
+		return "", errors.Wrapf(err, "error writing %s", filename)
+	}
+	return filename, nil
+}
+
+// signatureAlgorithmFor returns the algorithm and size of the keys of the same
+// type as the given public key.
+func signatureAlgorithmFor(pub crypto.PublicKey) (kmsapi.SignatureAlgorithm, int, error) {
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return kmsapi.ECDSAWithSHA256, 0, nil
+		case elliptic.P384():
+			return kmsapi.ECDSAWithSHA384, 0, nil
+		case elliptic.P521():
+			return kmsapi.ECDSAWithSHA512, 0, nil
+		default:
+			return 0, 0, errors.Errorf("unsupported elliptic curve %s", k.Curve.Params().Name)
+		}
+	case *rsa.PublicKey:
+		return kmsapi.SHA256WithRSA, k.N.BitLen(), nil
+	case ed25519.PublicKey:
+		return kmsapi.PureEd25519, 0, nil
+	default:
+		return 0, 0, errors.Errorf("unsupported public key type %T", pub)
+	}
+}
+
+// publicKeyEqual returns true if both public keys are equal.
+func publicKeyEqual(a, b crypto.PublicKey) bool {
+	if k, ok := a.(interface{ Equal(crypto.PublicKey) bool }); ok {
+		return k.Equal(b)
+	}
+	return false
+}
@@ -0,0 +1,268 @@
+package authority
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/minica"
+	"go.step.sm/crypto/pemutil"
+
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/scep"
+)
+
+func testRotationAuthority(t *testing.T, rc *config.RotationConfig) (*Authority, *minica.CA) {
+	t.Helper()
+	ca, err := minica.New()
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	rootFile := filepath.Join(dir, "root_ca.crt")
+	intermediateFile := filepath.Join(dir, "intermediate_ca.crt")
+	keyFile := filepath.Join(dir, "intermediate_ca_key")
+	_, err = pemutil.Serialize(ca.Root, pemutil.ToFile(rootFile, 0600))
+	require.NoError(t, err)
+	_, err = pemutil.Serialize(ca.Intermediate, pemutil.ToFile(intermediateFile, 0600))
+	require.NoError(t, err)
+	_, err = pemutil.Serialize(ca.Signer, pemutil.WithPassword([]byte("pass")), pemutil.ToFile(keyFile, 0600))
+	require.NoError(t, err)
+	if rc != nil && rc.RootKey != "" {
+		rc.RootKey = filepath.Join(dir, rc.RootKey)
+		_, err = pemutil.Serialize(ca.RootSigner, pemutil.ToFile(rc.RootKey, 0600))
+		require.NoError(t, err)
+	}
+
+	a, err := New(&config.Config{
+		Address:          "127.0.0.1:443",
+		Root:             []string{rootFile},
+		IntermediateCert: intermediateFile,
+		IntermediateKey:  keyFile,
+		DNSNames:         []string{"ca.smallstep.com"},
+		Password:         "pass",
+		AuthorityConfig: &config.AuthConfig{
+			IntermediateRotation: rc,
+		},
+	}, WithQuietInit())
+	require.NoError(t, err)
+	return a, ca
+}
+
+func assertStatusCode(t *testing.T, want int, err error) {
+	t.Helper()
+	var sc render.StatusCodedError
+	require.ErrorAs(t, err, &sc)
+	assert.Equal(t, want, sc.StatusCode())
+}
+
+func TestAuthority_IntermediateRotation(t *testing.T) {
+	ctx := context.Background()
+	a, ca := testRotationAuthority(t, &config.RotationConfig{RootKey: "root_ca_key"})
+	keyName := filepath.Join(t.TempDir(), "new_intermediate_ca_key")
+
+	_, err := a.GetIntermediateRotation(ctx)
+	assertStatusCode(t, http.StatusNotFound, err)
+	_, err = a.ActivateIntermediateRotation(ctx, nil)
+	assertStatusCode(t, http.StatusNotFound, err)
+	_, err = a.CreateIntermediateRotation(ctx, "")
+	assertStatusCode(t, http.StatusBadRequest, err)
+
+	rotation, err := a.CreateIntermediateRotation(ctx, keyName)
+	require.NoError(t, err)
+	assert.Equal(t, keyName, rotation.KeyName)
+	assert.Equal(t, ca.Intermediate.Subject.String(), rotation.CertificateRequest.Subject.String())
+	assert.NoError(t, rotation.CertificateRequest.CheckSignature())
+
+	got, err := a.GetIntermediateRotation(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, rotation, got)
+	_, err = a.CreateIntermediateRotation(ctx, keyName)
+	assertStatusCode(t, http.StatusConflict, err)
+
+	// The key is not written until the new intermediate is activated.
+	assert.NoFileExists(t, keyName)
+
+	chain, err := a.ActivateIntermediateRotation(ctx, nil)
+	require.NoError(t, err)
+	require.Len(t, chain, 1)
+	assert.Equal(t, rotation.CertificateRequest.PublicKey, chain[0].PublicKey)
+	assert.NoError(t, chain[0].CheckSignatureFrom(ca.Root))
+	assert.Equal(t, ca.Intermediate.MaxPathLen, chain[0].MaxPathLen)
+
+	current, previous := a.GetIntermediateCertificates()
+	assert.Equal(t, chain, current)
+	assert.Equal(t, []*x509.Certificate{ca.Intermediate}, previous)
+	assert.Equal(t, keyName, a.config.IntermediateKey)
+	assert.FileExists(t, keyName)
+	crts, err := pemutil.ReadCertificateBundle(a.config.IntermediateCert)
+	require.NoError(t, err)
+	assert.Equal(t, chain, crts)
+	_, err = pemutil.Read(keyName, pemutil.WithPassword([]byte("pass")))
+	assert.NoError(t, err)
+
+	// New certificates are signed by the new intermediate.
+	tlsCrt, err := a.GetTLSCertificate()
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(tlsCrt.Certificate[0])
+	require.NoError(t, err)
+	assert.NoError(t, leaf.CheckSignatureFrom(chain[0]))
+	intermediate, err := x509.ParseCertificate(tlsCrt.Certificate[1])
+	require.NoError(t, err)
+	assert.Equal(t, chain[0], intermediate)
+
+	_, err = a.GetIntermediateRotation(ctx)
+	assertStatusCode(t, http.StatusNotFound, err)
+}
+
+func TestAuthority_ActivateIntermediateRotation_previous(t *testing.T) {
+	ctx := context.Background()
+	a, ca := testRotationAuthority(t, &config.RotationConfig{RootKey: "root_ca_key"})
+	oldCert, oldKey := a.config.IntermediateCert, a.config.IntermediateKey
+
+	// Enable the SCEP authority with the current intermediate.
+	a.scepOptions = &scep.Options{
+		Roots:         a.rootX509Certs,
+		Intermediates: a.intermediateX509Certs,
+		SignerCert:    a.intermediateX509Certs[0],
+	}
+	require.NoError(t, a.setSCEPSigner(a.scepOptions, a.config.IntermediateKey))
+	oldSCEP, err := scep.New(a, *a.scepOptions)
+	require.NoError(t, err)
+	a.scepAuthority = oldSCEP
+
+	_, err = a.CreateIntermediateRotation(ctx, filepath.Join(t.TempDir(), "new_intermediate_ca_key"))
+	require.NoError(t, err)
+	chain, err := a.ActivateIntermediateRotation(ctx, nil)
+	require.NoError(t, err)
+
+	// The SCEP authority uses the new intermediate.
+	assert.NotSame(t, oldSCEP, a.GetSCEP())
+	assert.Equal(t, chain, a.scepOptions.Intermediates)
+	assert.Equal(t, chain[0], a.scepOptions.SignerCert)
+	assert.True(t, publicKeyEqual(chain[0].PublicKey, a.scepOptions.Signer.Public()))
+
+	// The previous intermediate is in the configuration.
+	assert.Equal(t, []*config.PreviousIntermediate{{Cert: oldCert, Key: oldKey}}, a.config.PreviousIntermediates)
+
+	// The CRL of the previous intermediate is signed by its key.
+	a.generatePreviousCRLs(&x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now(),
+		NextUpdate: time.Now().Add(time.Hour),
+	})
+	crlInfo, ok := a.previousCRLs[hex.EncodeToString(ca.Intermediate.SubjectKeyId)]
+	require.True(t, ok)
+	crl, err := x509.ParseRevocationList(crlInfo.Data)
+	require.NoError(t, err)
+	assert.NoError(t, crl.CheckSignatureFrom(ca.Intermediate))
+	assert.Len(t, a.previousCRLs, 1)
+
+	// The previous intermediates are loaded on initialization.
+	b, err := New(a.config, WithQuietInit())
+	require.NoError(t, err)
+	current, previous := b.GetIntermediateCertificates()
+	assert.Equal(t, chain, current)
+	assert.Equal(t, []*x509.Certificate{ca.Intermediate}, previous)
+	require.Len(t, b.previousIntermediates, 1)
+	assert.True(t, publicKeyEqual(ca.Intermediate.PublicKey, b.previousIntermediates[0].signer.Public()))
+}
+
+func TestAuthority_ActivateIntermediateRotation(t *testing.T) {
+	ctx := context.Background()
+	sign := func(t *testing.T, ca *minica.CA, template *x509.Certificate) *x509.Certificate {
+		t.Helper()
+		der, err := x509.CreateCertificate(rand.Reader, template, ca.Root, template.PublicKey, ca.RootSigner)
+		require.NoError(t, err)
+		crt, err := x509.ParseCertificate(der)
+		require.NoError(t, err)
+		return crt
+	}
+	newTemplate := func(rotation *IntermediateRotation, isCA bool) *x509.Certificate {
+		return &x509.Certificate{
+			SerialNumber:          big.NewInt(1234),
+			Subject:               rotation.CertificateRequest.Subject,
+			PublicKey:             rotation.CertificateRequest.PublicKey,
+			NotBefore:             time.Now(),
+			NotAfter:              time.Now().Add(time.Hour),
+			KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+			BasicConstraintsValid: true,
+			IsCA:                  isCA,
+		}
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		a, ca := testRotationAuthority(t, nil)
+		rotation, err := a.CreateIntermediateRotation(ctx, filepath.Join(t.TempDir(), "new_key"))
+		require.NoError(t, err)
+		crt := sign(t, ca, newTemplate(rotation, true))
+		chain, err := a.ActivateIntermediateRotation(ctx, []*x509.Certificate{crt})
+		require.NoError(t, err)
+		assert.Equal(t, []*x509.Certificate{crt}, chain)
+		assert.Equal(t, filepath.Join(filepath.Dir(a.config.Root[0]), "intermediate_ca_4d2.crt"), a.config.IntermediateCert)
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		a, ca := testRotationAuthority(t, nil)
+		rotation, err := a.CreateIntermediateRotation(ctx, filepath.Join(t.TempDir(), "new_key"))
+		require.NoError(t, err)
+
+		// The authority does not have a root key.
+		_, err = a.ActivateIntermediateRotation(ctx, nil)
+		assertStatusCode(t, http.StatusBadRequest, err)
+		// The certificate is not a CA.
+		_, err = a.ActivateIntermediateRotation(ctx, []*x509.Certificate{sign(t, ca, newTemplate(rotation, false))})
+		assertStatusCode(t, http.StatusBadRequest, err)
+		// The certificate does not use the new key.
+		_, err = a.ActivateIntermediateRotation(ctx, []*x509.Certificate{ca.Intermediate})
+		assertStatusCode(t, http.StatusBadRequest, err)
+		// The certificate is not signed by the root.
+		other, err := minica.New()
+		require.NoError(t, err)
+		_, err = a.ActivateIntermediateRotation(ctx, []*x509.Certificate{sign(t, other, newTemplate(rotation, true))})
+		assertStatusCode(t, http.StatusBadRequest, err)
+
+		// The rotation is still in progress and the intermediate is not
+		// replaced.
+		_, err = a.GetIntermediateRotation(ctx)
+		assert.NoError(t, err)
+		current, previous := a.GetIntermediateCertificates()
+		assert.Equal(t, []*x509.Certificate{ca.Intermediate}, current)
+		assert.Empty(t, previous)
+	})
+}
+
+func TestAuthority_CancelIntermediateRotation(t *testing.T) {
+	ctx := context.Background()
+	a, _ := testRotationAuthority(t, nil)
+	keyName := filepath.Join(t.TempDir(), "new_key")
+
+	assertStatusCode(t, http.StatusNotFound, a.CancelIntermediateRotation(ctx))
+	_, err := a.CreateIntermediateRotation(ctx, keyName)
+	require.NoError(t, err)
+	require.NoError(t, a.CancelIntermediateRotation(ctx))
+	_, err = a.GetIntermediateRotation(ctx)
+	assertStatusCode(t, http.StatusNotFound, err)
+	_, err = os.Stat(keyName)
+	assert.True(t, os.IsNotExist(err))
+
+	// A new rotation can be started.
+	_, err = a.CreateIntermediateRotation(ctx, keyName)
+	assert.NoError(t, err)
+}
+
+func TestAuthority_CreateIntermediateRotation_notImplemented(t *testing.T) {
+	a := testAuthority(t)
+	a.x509CAService = nil
+	_, err := a.CreateIntermediateRotation(context.Background(), "key")
+	assertStatusCode(t, http.StatusNotImplemented, err)
+}
@@ -0,0 +1,151 @@
+package authority
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"slices"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.step.sm/crypto/randutil"
+
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+)
+
+// scepChallengeLength is the number of hexadecimal characters of a SCEP
+// one-time challenge.
+const scepChallengeLength = 32
+
+// CreateSCEPChallenge creates a new one-time challenge for the SCEP provisioner
+// with the given name. The challenge expires after the given ttl, or after the
+// provisioner's dynamicChallengeTTL if the ttl is 0, and it can only be used in
+// one enrollment. Only the hash of the challenge is stored in the database.
+func (a *Authority) CreateSCEPChallenge(_ context.Context, provisionerName string, ttl time.Duration) (string, time.Time, error) {
+	challengeDB, ok := a.db.(db.SCEPChallengeDB)
+	if !ok {
+		return "", time.Time{}, admin.NewError(admin.ErrorNotImplementedType, "database does not support scep dynamic challenges")
+	}
+
+	p, err := a.LoadProvisionerByName(provisionerName)
+	if err != nil {
+		return "", time.Time{}, admin.WrapError(admin.ErrorNotFoundType, err, "error loading provisioner %s", provisionerName)
+	}
+	prov, ok := p.(*provisioner.SCEP)
+	if !ok {
+		return "", time.Time{}, admin.NewError(admin.ErrorBadRequestType, "provisioner %s is not a SCEP provisioner", provisionerName)
+	}
+	if !prov.DynamicChallenge {
+		return "", time.Time{}, admin.NewError(admin.ErrorBadRequestType, "provisioner %s does not have dynamic challenges enabled", provisionerName)
+	}
+
+	maxTTL := prov.GetDynamicChallengeTTL()
+	switch {
+	case ttl == 0:
+		ttl = maxTTL
+	case ttl < 0:
+		return "", time.Time{}, admin.NewError(admin.ErrorBadRequestType, "ttl must be greater than 0")
+	case ttl > maxTTL:
+		return "", time.Time{}, admin.NewError(admin.ErrorBadRequestType, "ttl cannot be greater than %s", maxTTL)
+	}
+
+	challenge, err := randutil.Hex(scepChallengeLength)
+	if err != nil {
+		return "", time.Time{}, admin.WrapErrorISE(err, "error creating scep challenge")
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	sci := &db.SCEPChallengeInfo{
+		ID:            scepChallengeID(challenge),
+		ProvisionerID: prov.GetID(),
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(ttl),
+	}
+	if err := challengeDB.StoreSCEPChallenge(sci); err != nil {
+		return "", time.Time{}, admin.WrapErrorISE(err, "error creating scep challenge")
+	}
+
+	return challenge, sci.ExpiresAt, nil
+}
+
+// useSCEPChallenge validates and invalidates a one-time challenge created for
+// the given SCEP provisioner. It is used as the provisioner's
+// UseSCEPChallengeFunc.
+func (a *Authority) useSCEPChallenge(_ context.Context, p *provisioner.SCEP, challenge string) error {
+	challengeDB, ok := a.db.(db.SCEPChallengeDB)
+	if !ok {
+		return errors.New("database does not support scep dynamic challenges")
+	}
+	if challenge == "" {
+		return errors.New("scep challenge cannot be empty")
+	}
+	return challengeDB.UseSCEPChallenge(scepChallengeID(challenge), p.GetID(), time.Now())
+}
+
+// scepChallengeID returns the id used to store a SCEP one-time challenge, the
+// hex encoded SHA-256 of the challenge.
+func scepChallengeID(challenge string) string {
+	sum := sha256.Sum256([]byte(challenge))
+	return hex.EncodeToString(sum[:])
+}
+
+// SetSCEPNextCACertificates stages the certificates returned by the SCEP
+// GetNextCACert operation, so that SCEP clients can fetch the next issuing CA
+// certificate before a CA rollover. The first certificate must be the next
+// issuing CA certificate. An empty list removes the staged certificates.
+//
+// The certificates are stored in the database if it supports it, and loaded
+// again when the authority starts. With other databases the certificates are
+// only kept in memory, and they are lost on restart.
+func (a *Authority) SetSCEPNextCACertificates(certs []*x509.Certificate) error {
+	a.scepMutex.Lock()
+	defer a.scepMutex.Unlock()
+
+	if a.scepAuthority == nil {
+		return admin.NewError(admin.ErrorNotImplementedType, "scep is not enabled")
+	}
+	previous := a.scepAuthority.GetNextCACertificates()
+	if err := a.scepAuthority.SetNextCACertificates(certs); err != nil {
+		return admin.WrapError(admin.ErrorBadRequestType, err, "error staging next scep ca certificates")
+	}
+	if nextCADB, ok := a.db.(db.SCEPNextCADB); ok {
+		if err := nextCADB.StoreSCEPNextCACertificates(certs); err != nil {
+			_ = a.scepAuthority.SetNextCACertificates(previous)
+			return admin.WrapErrorISE(err, "error storing next scep ca certificates")
+		}
+	}
+
+	// keep the staged certificates if the scep authority is created again
+	if a.scepOptions != nil {
+		a.scepOptions.NextCACertificates = slices.Clone(certs)
+	}
+	return nil
+}
+
+// loadSCEPNextCACertificates returns the certificates staged for the SCEP
+// GetNextCACert operation stored in the database, or nil if the database does
+// not support it.
+func (a *Authority) loadSCEPNextCACertificates() ([]*x509.Certificate, error) {
+	nextCADB, ok := a.db.(db.SCEPNextCADB)
+	if !ok {
+		return nil, nil
+	}
+	certs, err := nextCADB.GetSCEPNextCACertificates()
+	if err != nil {
+		return nil, errors.Wrap(err, "error loading next scep ca certificates")
+	}
+	return certs, nil
+}
+
+// GetSCEPNextCACertificates returns the certificates staged for the SCEP
+// GetNextCACert operation.
+func (a *Authority) GetSCEPNextCACertificates() ([]*x509.Certificate, error) {
+	scepAuthority := a.GetSCEP()
+	if scepAuthority == nil {
+		return nil, admin.NewError(admin.ErrorNotImplementedType, "scep is not enabled")
+	}
+	return scepAuthority.GetNextCACertificates(), nil
+}
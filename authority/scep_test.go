@@ -0,0 +1,209 @@
+package authority
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/minica"
+
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/scep"
+)
+
+func TestAuthority_SCEPChallenge(t *testing.T) {
+	authDB, err := db.New(&db.Config{Type: "badgerv2", DataSource: t.TempDir()})
+	require.NoError(t, err)
+	t.Cleanup(func() { authDB.Shutdown() })
+
+	a := testAuthority(t, WithDatabase(authDB))
+	newSCEP := func(t *testing.T, name string, dynamic bool) *provisioner.SCEP {
+		t.Helper()
+		p := &provisioner.SCEP{
+			Type:                "SCEP",
+			Name:                name,
+			DynamicChallenge:    dynamic,
+			DynamicChallengeTTL: &provisioner.Duration{Duration: 10 * time.Minute},
+		}
+		config, err := a.generateProvisionerConfig(context.Background())
+		require.NoError(t, err)
+		require.NoError(t, p.Init(config))
+		require.NoError(t, a.provisioners.Store(p))
+		return p
+	}
+	p1 := newSCEP(t, "scep1", true)
+	p2 := newSCEP(t, "scep2", true)
+	newSCEP(t, "static", false)
+
+	ctx := context.Background()
+	assertStatusCode := func(t *testing.T, err error, statusCode int) {
+		t.Helper()
+		var sc render.StatusCodedError
+		require.ErrorAs(t, err, &sc)
+		assert.Equal(t, statusCode, sc.StatusCode())
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		challenge, expiresAt, err := a.CreateSCEPChallenge(ctx, "scep1", 0)
+		require.NoError(t, err)
+		assert.Len(t, challenge, 32)
+		assert.WithinDuration(t, time.Now().Add(10*time.Minute), expiresAt, 2*time.Second)
+
+		// challenges can only be used by the provisioner they were created for
+		assert.Error(t, p2.ValidateChallenge(ctx, nil, challenge, "tx"))
+		assert.NoError(t, p1.ValidateChallenge(ctx, nil, challenge, "tx"))
+		assert.EqualError(t, p1.ValidateChallenge(ctx, nil, challenge, "tx"),
+			"invalid challenge password provided: scep challenge has already been used")
+	})
+
+	t.Run("ok multiple", func(t *testing.T) {
+		c1, _, err := a.CreateSCEPChallenge(ctx, "scep1", time.Minute)
+		require.NoError(t, err)
+		c2, _, err := a.CreateSCEPChallenge(ctx, "scep1", time.Minute)
+		require.NoError(t, err)
+		assert.NotEqual(t, c1, c2)
+		assert.NoError(t, p1.ValidateChallenge(ctx, nil, c2, "tx"))
+		assert.NoError(t, p1.ValidateChallenge(ctx, nil, c1, "tx"))
+	})
+
+	t.Run("fail expired", func(t *testing.T) {
+		challenge := "0123456789abcdef0123456789abcdef"
+		now := time.Now().UTC()
+		require.NoError(t, authDB.(db.SCEPChallengeDB).StoreSCEPChallenge(&db.SCEPChallengeInfo{
+			ID:            scepChallengeID(challenge),
+			ProvisionerID: p1.GetID(),
+			CreatedAt:     now.Add(-time.Hour),
+			ExpiresAt:     now.Add(-time.Minute),
+		}))
+		assert.EqualError(t, p1.ValidateChallenge(ctx, nil, challenge, "tx"),
+			"invalid challenge password provided: scep challenge has expired")
+	})
+
+	t.Run("fail unknown", func(t *testing.T) {
+		assert.EqualError(t, p1.ValidateChallenge(ctx, nil, "foo", "tx"),
+			"invalid challenge password provided: scep challenge not found")
+		assert.EqualError(t, p1.ValidateChallenge(ctx, nil, "", "tx"),
+			"invalid challenge password provided: scep challenge cannot be empty")
+	})
+
+	t.Run("fail create", func(t *testing.T) {
+		_, _, err := a.CreateSCEPChallenge(ctx, "missing", 0)
+		assertStatusCode(t, err, http.StatusNotFound)
+		_, _, err = a.CreateSCEPChallenge(ctx, "step-cli", 0)
+		assertStatusCode(t, err, http.StatusBadRequest)
+		_, _, err = a.CreateSCEPChallenge(ctx, "static", 0)
+		assertStatusCode(t, err, http.StatusBadRequest)
+		_, _, err = a.CreateSCEPChallenge(ctx, "scep1", -time.Minute)
+		assertStatusCode(t, err, http.StatusBadRequest)
+		_, _, err = a.CreateSCEPChallenge(ctx, "scep1", time.Hour)
+		assertStatusCode(t, err, http.StatusBadRequest)
+	})
+}
+
+func TestAuthority_CreateSCEPChallenge_notSupported(t *testing.T) {
+	a := testAuthority(t)
+	a.db = &struct{ db.AuthDB }{&db.MockAuthDB{}}
+	_, _, err := a.CreateSCEPChallenge(context.Background(), "scep", 0)
+	var sc render.StatusCodedError
+	require.ErrorAs(t, err, &sc)
+	assert.Equal(t, http.StatusNotImplemented, sc.StatusCode())
+}
+
+func TestAuthority_SetSCEPNextCACertificates_notEnabled(t *testing.T) {
+	a := testAuthority(t)
+	var sc render.StatusCodedError
+	require.ErrorAs(t, a.SetSCEPNextCACertificates(nil), &sc)
+	assert.Equal(t, http.StatusNotImplemented, sc.StatusCode())
+	_, err := a.GetSCEPNextCACertificates()
+	require.ErrorAs(t, err, &sc)
+	assert.Equal(t, http.StatusNotImplemented, sc.StatusCode())
+}
+
+type failSCEPNextCADB struct {
+	db.AuthDB
+}
+
+func (failSCEPNextCADB) StoreSCEPNextCACertificates([]*x509.Certificate) error {
+	return errors.New("force")
+}
+
+func (failSCEPNextCADB) GetSCEPNextCACertificates() ([]*x509.Certificate, error) {
+	return nil, errors.New("force")
+}
+
+func TestAuthority_SetSCEPNextCACertificates(t *testing.T) {
+	authDB, err := db.New(&db.Config{Type: "badgerv2", DataSource: t.TempDir()})
+	require.NoError(t, err)
+	t.Cleanup(func() { authDB.Shutdown() })
+
+	next, err := minica.New()
+	require.NoError(t, err)
+
+	newAuthority := func(t *testing.T, authDB db.AuthDB) *Authority {
+		t.Helper()
+		a := testAuthority(t, WithDatabase(authDB))
+		a.scepOptions = &scep.Options{
+			Intermediates: a.intermediateX509Certs,
+			SignerCert:    a.intermediateX509Certs[0],
+		}
+		a.scepAuthority, err = scep.New(a, *a.scepOptions)
+		require.NoError(t, err)
+		return a
+	}
+	assertStatusCode := func(t *testing.T, err error, statusCode int) {
+		t.Helper()
+		var sc render.StatusCodedError
+		require.ErrorAs(t, err, &sc)
+		assert.Equal(t, statusCode, sc.StatusCode())
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		a := newAuthority(t, authDB)
+		certs := []*x509.Certificate{next.Intermediate, next.Root}
+		require.NoError(t, a.SetSCEPNextCACertificates(certs))
+		got, err := a.GetSCEPNextCACertificates()
+		require.NoError(t, err)
+		assert.Equal(t, certs, got)
+		assert.Equal(t, certs, a.scepOptions.NextCACertificates)
+
+		// The certificates are loaded again by a new authority.
+		got, err = newAuthority(t, authDB).loadSCEPNextCACertificates()
+		require.NoError(t, err)
+		assert.Equal(t, certs, got)
+
+		require.NoError(t, a.SetSCEPNextCACertificates(nil))
+		got, err = a.loadSCEPNextCACertificates()
+		require.NoError(t, err)
+		assert.Empty(t, got)
+	})
+
+	t.Run("ok memory only", func(t *testing.T) {
+		a := newAuthority(t, &db.MockAuthDB{})
+		require.NoError(t, a.SetSCEPNextCACertificates([]*x509.Certificate{next.Intermediate}))
+		got, err := a.loadSCEPNextCACertificates()
+		require.NoError(t, err)
+		assert.Nil(t, got)
+	})
+
+	t.Run("fail not ca", func(t *testing.T) {
+		a := newAuthority(t, authDB)
+		assertStatusCode(t, a.SetSCEPNextCACertificates([]*x509.Certificate{{}}), http.StatusBadRequest)
+	})
+
+	t.Run("fail database", func(t *testing.T) {
+		a := newAuthority(t, failSCEPNextCADB{&db.MockAuthDB{}})
+		assertStatusCode(t, a.SetSCEPNextCACertificates([]*x509.Certificate{next.Intermediate}), http.StatusInternalServerError)
+		got, err := a.GetSCEPNextCACertificates()
+		require.NoError(t, err)
+		assert.Empty(t, got)
+		_, err = a.loadSCEPNextCACertificates()
+		assert.Error(t, err)
+	})
+}
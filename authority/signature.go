@@ -0,0 +1,116 @@
+package authority
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"slices"
+
+	"go.step.sm/crypto/x509util"
+
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/errs"
+)
+
+// getX509Signer returns the X.509 signer options, or nil if they are not
+// configured.
+func (a *Authority) getX509Signer() *config.X509SignerConfig {
+	if a.config == nil || a.config.AuthorityConfig == nil {
+		return nil
+	}
+	return a.config.AuthorityConfig.X509Signer
+}
+
+// validateX509Signer returns an error if the configured signature algorithm
+// cannot be used with the key of the intermediate.
+func (a *Authority) validateX509Signer() error {
+	signer := a.getX509Signer()
+	if signer == nil || signer.SignatureAlgorithm == 0 {
+		return nil
+	}
+	intermediates := a.getIntermediates()
+	if len(intermediates) == 0 {
+		return nil
+	}
+	alg := x509.SignatureAlgorithm(signer.SignatureAlgorithm)
+	if !isCompatibleSignatureAlgorithm(alg, intermediates[0].PublicKey) {
+		return fmt.Errorf("authority.x509Signer.signatureAlgorithm %s cannot be used with an intermediate key of type %s", alg, keyType(intermediates[0].PublicKey))
+	}
+	return nil
+}
+
+// checkX509KeyType returns a forbidden error if the type of the given public
+// key is not in the allowed key types.
+func (a *Authority) checkX509KeyType(pub crypto.PublicKey) error {
+	signer := a.getX509Signer()
+	if signer == nil || len(signer.AllowedKeyTypes) == 0 {
+		return nil
+	}
+	if kty := keyType(pub); !slices.Contains(signer.AllowedKeyTypes, kty) {
+		return errs.Forbidden("certificate key of type '%s' is not allowed", kty)
+	}
+	return nil
+}
+
+// setX509SignatureAlgorithm sets the configured signature algorithm in the
+// certificate if the template does not set one, and returns a forbidden
+// error if the algorithm is not allowed or if it cannot be used with the key
+// of the intermediate.
+func (a *Authority) setX509SignatureAlgorithm(leaf *x509.Certificate) error {
+	signer := a.getX509Signer()
+	if signer == nil {
+		return nil
+	}
+	if leaf.SignatureAlgorithm == x509.UnknownSignatureAlgorithm {
+		leaf.SignatureAlgorithm = x509.SignatureAlgorithm(signer.SignatureAlgorithm)
+	}
+	if leaf.SignatureAlgorithm == x509.UnknownSignatureAlgorithm {
+		return nil
+	}
+	if len(signer.AllowedSignatureAlgorithms) > 0 && !slices.Contains(signer.AllowedSignatureAlgorithms, x509util.SignatureAlgorithm(leaf.SignatureAlgorithm)) {
+		return errs.Forbidden("certificate signature algorithm %s is not allowed", leaf.SignatureAlgorithm)
+	}
+	if intermediates := a.getIntermediates(); len(intermediates) > 0 {
+		if !isCompatibleSignatureAlgorithm(leaf.SignatureAlgorithm, intermediates[0].PublicKey) {
+			return errs.Forbidden("certificate signature algorithm %s cannot be used with an intermediate key of type %s", leaf.SignatureAlgorithm, keyType(intermediates[0].PublicKey))
+		}
+	}
+	return nil
+}
+
+// isCompatibleSignatureAlgorithm returns true if a key of the type of the
+// given public key can create signatures with the given algorithm.
+func isCompatibleSignatureAlgorithm(alg x509.SignatureAlgorithm, pub crypto.PublicKey) bool {
+	switch alg {
+	case x509.SHA256WithRSA, x509.SHA384WithRSA, x509.SHA512WithRSA,
+		x509.SHA256WithRSAPSS, x509.SHA384WithRSAPSS, x509.SHA512WithRSAPSS:
+		_, ok := pub.(*rsa.PublicKey)
+		return ok
+	case x509.ECDSAWithSHA256, x509.ECDSAWithSHA384, x509.ECDSAWithSHA512:
+		_, ok := pub.(*ecdsa.PublicKey)
+		return ok
+	case x509.PureEd25519:
+		_, ok := pub.(ed25519.PublicKey)
+		return ok
+	default:
+		return false
+	}
+}
+
+// keyType returns the JWK key type of the given public key, "EC", "RSA" or
+// "OKP".
+func keyType(pub crypto.PublicKey) string {
+	switch pub.(type) {
+	case *ecdsa.PublicKey:
+		return "EC"
+	case *rsa.PublicKey:
+		return "RSA"
+	case ed25519.PublicKey:
+		return "OKP"
+	default:
+		return fmt.Sprintf("%T", pub)
+	}
+}
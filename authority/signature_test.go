@@ -0,0 +1,142 @@
+package authority
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/minica"
+	"go.step.sm/crypto/x509util"
+
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func newX509SignerAuthority(t *testing.T, ca *minica.CA, signer *config.X509SignerConfig) (*Authority, error) {
+	t.Helper()
+	return NewEmbedded(
+		WithConfig(&config.Config{AuthorityConfig: &config.AuthConfig{X509Signer: signer}}),
+		WithX509RootBundle(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Root.Raw})),
+		WithX509Signer(ca.Intermediate, ca.Signer),
+	)
+}
+
+func TestAuthority_SignWithContext_x509Signer(t *testing.T) {
+	rsaCA, err := minica.New(minica.WithGetSignerFunc(func() (crypto.Signer, error) {
+		return rsa.GenerateKey(rand.Reader, 2048)
+	}))
+	require.NoError(t, err)
+	ed25519CA, err := minica.New(minica.WithGetSignerFunc(func() (crypto.Signer, error) {
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		return priv, err
+	}))
+	require.NoError(t, err)
+
+	ecSigner, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	_, ed25519Signer, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	withValidity := provisioner.CertificateModifierFunc(func(crt *x509.Certificate, opts provisioner.SignOptions) error {
+		crt.NotBefore = time.Now()
+		crt.NotAfter = time.Now().Add(time.Hour)
+		return nil
+	})
+	withSignatureAlgorithm := func(alg x509.SignatureAlgorithm) provisioner.CertificateModifierFunc {
+		return func(crt *x509.Certificate, opts provisioner.SignOptions) error {
+			crt.SignatureAlgorithm = alg
+			return nil
+		}
+	}
+	sign := func(t *testing.T, a *Authority, signer crypto.Signer, extraOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+		t.Helper()
+		csr, err := x509util.CreateCertificateRequest("test.smallstep.com", []string{"test.smallstep.com"}, signer)
+		require.NoError(t, err)
+		return a.SignWithContext(context.Background(), csr, provisioner.SignOptions{}, append([]provisioner.SignOption{withValidity}, extraOpts...)...)
+	}
+
+	t.Run("ok rsa-pss", func(t *testing.T) {
+		a, err := newX509SignerAuthority(t, rsaCA, &config.X509SignerConfig{
+			SignatureAlgorithm: x509util.SignatureAlgorithm(x509.SHA256WithRSAPSS),
+		})
+		require.NoError(t, err)
+		chain, err := sign(t, a, ecSigner)
+		require.NoError(t, err)
+		assert.Equal(t, x509.SHA256WithRSAPSS, chain[0].SignatureAlgorithm)
+		assert.NoError(t, chain[0].CheckSignatureFrom(rsaCA.Intermediate))
+
+		// The template can use a different algorithm.
+		chain, err = sign(t, a, ecSigner, withSignatureAlgorithm(x509.SHA512WithRSAPSS))
+		require.NoError(t, err)
+		assert.Equal(t, x509.SHA512WithRSAPSS, chain[0].SignatureAlgorithm)
+
+		// The certificate of the CA uses the configured algorithm too.
+		tlsCrt, err := a.GetTLSCertificate()
+		require.NoError(t, err)
+		assert.Equal(t, x509.SHA256WithRSAPSS, tlsCrt.Leaf.SignatureAlgorithm)
+	})
+
+	t.Run("ok ed25519", func(t *testing.T) {
+		a, err := newX509SignerAuthority(t, ed25519CA, &config.X509SignerConfig{
+			AllowedSignatureAlgorithms: []x509util.SignatureAlgorithm{x509util.SignatureAlgorithm(x509.PureEd25519)},
+			AllowedKeyTypes:            []string{"OKP"},
+		})
+		require.NoError(t, err)
+		chain, err := sign(t, a, ed25519Signer)
+		require.NoError(t, err)
+		assert.Equal(t, x509.Ed25519, chain[0].PublicKeyAlgorithm)
+		assert.Equal(t, x509.PureEd25519, chain[0].SignatureAlgorithm)
+		assert.NoError(t, chain[0].CheckSignatureFrom(ed25519CA.Intermediate))
+	})
+
+	t.Run("ok ed25519 key", func(t *testing.T) {
+		a, err := newX509SignerAuthority(t, rsaCA, nil)
+		require.NoError(t, err)
+		chain, err := sign(t, a, ed25519Signer)
+		require.NoError(t, err)
+		assert.Equal(t, x509.Ed25519, chain[0].PublicKeyAlgorithm)
+		assert.Equal(t, x509.SHA256WithRSA, chain[0].SignatureAlgorithm)
+	})
+
+	t.Run("fail key type", func(t *testing.T) {
+		a, err := newX509SignerAuthority(t, rsaCA, &config.X509SignerConfig{
+			AllowedKeyTypes: []string{"EC", "RSA"},
+		})
+		require.NoError(t, err)
+		_, err = sign(t, a, ed25519Signer)
+		assertForbidden(t, err)
+	})
+
+	t.Run("fail signature algorithm not allowed", func(t *testing.T) {
+		a, err := newX509SignerAuthority(t, rsaCA, &config.X509SignerConfig{
+			SignatureAlgorithm:         x509util.SignatureAlgorithm(x509.SHA256WithRSAPSS),
+			AllowedSignatureAlgorithms: []x509util.SignatureAlgorithm{x509util.SignatureAlgorithm(x509.SHA256WithRSAPSS)},
+		})
+		require.NoError(t, err)
+		_, err = sign(t, a, ecSigner, withSignatureAlgorithm(x509.SHA256WithRSA))
+		assertForbidden(t, err)
+	})
+
+	t.Run("fail signature algorithm not compatible", func(t *testing.T) {
+		a, err := newX509SignerAuthority(t, rsaCA, &config.X509SignerConfig{})
+		require.NoError(t, err)
+		_, err = sign(t, a, ecSigner, withSignatureAlgorithm(x509.PureEd25519))
+		assertForbidden(t, err)
+	})
+
+	t.Run("fail config not compatible", func(t *testing.T) {
+		_, err := newX509SignerAuthority(t, ed25519CA, &config.X509SignerConfig{
+			SignatureAlgorithm: x509util.SignatureAlgorithm(x509.SHA256WithRSAPSS),
+		})
+		assert.EqualError(t, err, "authority.x509Signer.signatureAlgorithm SHA256-RSAPSS cannot be used with an intermediate key of type OKP")
+	})
+}
@@ -1,6 +1,7 @@
 package authority
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
 	"crypto/x509"
@@ -167,6 +168,20 @@ func (a *Authority) signSSH(ctx context.Context, key ssh.PublicKey, opts provisi
 	// Set backdate with the configured value
 	opts.Backdate = a.config.AuthorityConfig.Backdate.Duration
 
+	// Set the host inventory information available in the templates. The
+	// host is identified by the identity verified by the provisioner.
+	var audit *provisioner.SSHAuditMetadata
+	for _, op := range signOpts {
+		if m, ok := op.(*provisioner.SSHAuditMetadata); ok {
+			audit = m
+		}
+	}
+	host, err := a.getSSHHostTemplateData(opts, audit)
+	if err != nil {
+		return nil, nil, errs.Wrap(http.StatusInternalServerError, err, "authority.SignSSH: error getting ssh inventory host")
+	}
+	opts.Host = host
+
 	var prov provisioner.Interface
 	var webhookCtl webhookController
 	for _, op := range signOpts {
@@ -197,11 +212,23 @@ func (a *Authority) signSSH(ctx context.Context, key ssh.PublicKey, opts provisi
 		case webhookController:
 			webhookCtl = o
 
+		// audit metadata is only used in the templates and logs
+		case *provisioner.SSHAuditMetadata:
+
 		default:
 			return nil, prov, errs.InternalServer("authority.SignSSH: invalid extra option type %T", o)
 		}
 	}
 
+	// Reject the request if the provisioner is deprecated or if the request
+	// does not satisfy its conditions
+	if err := checkProvisionerState(prov); err != nil {
+		return nil, prov, err
+	}
+	if err := checkProvisionerConditions(ctx, prov); err != nil {
+		return nil, prov, err
+	}
+
 	// Simulated certificate request with request options.
 	cr := sshutil.CertificateRequest{
 		Type:       opts.CertType,
@@ -242,6 +269,13 @@ func (a *Authority) signSSH(ctx context.Context, key ssh.PublicKey, opts provisi
 	// Get actual *ssh.Certificate and continue with provisioner modifiers.
 	certTpl := certificate.GetCertificate()
 
+	// Apply the principals and extensions returned by the enriching webhooks.
+	if m, ok := webhookCtl.(sshCertificateWebhookModifier); ok {
+		if err := m.ModifySSHCertificate(certTpl); err != nil {
+			return nil, prov, errs.ForbiddenErr(err, "%s", err)
+		}
+	}
+
 	// Use SignSSHOptions to modify the certificate validity. It will be later
 	// checked or set if not defined.
 	if err := opts.ModifyValidity(certTpl); err != nil {
@@ -283,6 +317,11 @@ func (a *Authority) signSSH(ctx context.Context, key ssh.PublicKey, opts provisi
 		)
 	}
 
+	// Reject the request if the certificate exceeds the authority limits
+	if err := a.checkSSHLimits(certTpl); err != nil {
+		return nil, prov, err
+	}
+
 	// Send certificate to webhooks for authorization
 	if err := a.callAuthorizingWebhooksSSH(ctx, prov, webhookCtl, certificate, certTpl); err != nil {
 		return nil, prov, errs.ApplyOptions(
@@ -334,7 +373,7 @@ func (a *Authority) renewSSH(ctx context.Context, oldCert *ssh.Certificate) (*ss
 	// Attempt to extract the provisioner from the token.
 	var prov provisioner.Interface
 	if token, ok := provisioner.TokenFromContext(ctx); ok {
-		prov, _, _ = a.getProvisionerFromToken(token)
+		prov, _, _ = a.getProvisionerFromToken(ctx, token)
 	}
 
 	backdate := a.config.AuthorityConfig.Backdate.Duration
@@ -356,6 +395,11 @@ func (a *Authority) renewSSH(ctx context.Context, oldCert *ssh.Certificate) (*ss
 		ValidBefore:     uint64(vb.Unix()),
 	}
 
+	// Reject the renewal if the certificate exceeds the authority limits
+	if err := a.checkSSHLimits(certTpl); err != nil {
+		return nil, prov, err
+	}
+
 	// Get signer from authority keys
 	var signer ssh.Signer
 	switch certTpl.CertType {
@@ -387,6 +431,8 @@ func (a *Authority) renewSSH(ctx context.Context, oldCert *ssh.Certificate) (*ss
 }
 
 // RekeySSH creates a signed SSH certificate using the old SSH certificate as a template.
+// The new public key must be different from the key of the old certificate
+// unless the ssh.allowSameKeyRekey option is enabled.
 func (a *Authority) RekeySSH(ctx context.Context, oldCert *ssh.Certificate, pub ssh.PublicKey, signOpts ...provisioner.SignOption) (*ssh.Certificate, error) {
 	cert, prov, err := a.rekeySSH(ctx, oldCert, pub, signOpts...)
 	a.meter.SSHRekeyed(prov, err)
@@ -413,6 +459,15 @@ func (a *Authority) rekeySSH(ctx context.Context, oldCert *ssh.Certificate, pub
 		return nil, prov, errs.BadRequest("cannot rekey a certificate without validity period")
 	}
 
+	// Rekeying is used to rotate the key, do not sign the same key again unless
+	// it is explicitly allowed.
+	if pub == nil {
+		return nil, prov, errs.BadRequest("cannot rekey a certificate without a public key")
+	}
+	if !a.config.SSH.IsSameKeyRekeyAllowed() && oldCert.Key != nil && bytes.Equal(oldCert.Key.Marshal(), pub.Marshal()) {
+		return nil, prov, errs.BadRequest("cannot rekey a certificate with the same public key")
+	}
+
 	if err := a.authorizeSSHCertificate(ctx, oldCert); err != nil {
 		return nil, prov, err
 	}
@@ -436,6 +491,11 @@ func (a *Authority) rekeySSH(ctx context.Context, oldCert *ssh.Certificate, pub
 		ValidBefore:     uint64(vb.Unix()),
 	}
 
+	// Reject the rekey if the certificate exceeds the authority limits
+	if err := a.checkSSHLimits(cert); err != nil {
+		return nil, prov, err
+	}
+
 	// Get signer from authority keys
 	var signer ssh.Signer
 	switch cert.CertType {
@@ -568,7 +628,7 @@ func (a *Authority) SignSSHAddUser(ctx context.Context, key ssh.PublicKey, subje
 	// Attempt to extract the provisioner from the token.
 	var prov provisioner.Interface
 	if token, ok := provisioner.TokenFromContext(ctx); ok {
-		prov, _, _ = a.getProvisionerFromToken(token)
+		prov, _, _ = a.getProvisionerFromToken(ctx, token)
 	}
 
 	signer := a.sshCAUserCertSignKey
@@ -642,16 +702,21 @@ func (a *Authority) GetSSHHosts(ctx context.Context, cert *x509.Certificate) ([]
 		hosts, err := a.sshGetHostsFunc(ctx, cert)
 		return hosts, errs.Wrap(http.StatusInternalServerError, err, "getSSHHosts")
 	}
-	hostnames, err := a.db.GetSSHHostPrincipals()
+	hosts, err := a.getSSHInventoryHosts()
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "getSSHHosts")
 	}
-
-	hosts := make([]config.Host, len(hostnames))
-	for i, hn := range hostnames {
-		hosts[i] = config.Host{Hostname: hn}
+	if len(hosts) == 0 {
+		hostnames, err := a.db.GetSSHHostPrincipals()
+		if err != nil {
+			return nil, errs.Wrap(http.StatusInternalServerError, err, "getSSHHosts")
+		}
+		hosts = make([]config.Host, len(hostnames))
+		for i, hn := range hostnames {
+			hosts[i] = config.Host{Hostname: hn}
+		}
 	}
-	return hosts, nil
+	return a.filterSSHHosts(cert, hosts)
 }
 
 func (a *Authority) getAddUserPrincipal() (cmd string) {
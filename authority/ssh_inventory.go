@@ -0,0 +1,234 @@
+package authority
+
+import (
+	"context"
+	"crypto/x509"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/nosql"
+
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/errs"
+)
+
+// sshHostInventory returns the database used to store the SSH host inventory.
+func (a *Authority) sshHostInventory() (db.SSHHostInventoryDB, error) {
+	inventory, ok := a.db.(db.SSHHostInventoryDB)
+	if !ok {
+		return nil, admin.NewError(admin.ErrorNotImplementedType, "database does not support the ssh host inventory")
+	}
+	return inventory, nil
+}
+
+// StoreSSHInventoryHost adds a host to the SSH host inventory, or replaces the
+// tags and groups of an existing one.
+func (a *Authority) StoreSSHInventoryHost(_ context.Context, host *db.SSHInventoryHost) (*db.SSHInventoryHost, error) {
+	inventory, err := a.sshHostInventory()
+	if err != nil {
+		return nil, err
+	}
+	if err := validateSSHInventoryHost(host); err != nil {
+		return nil, admin.WrapError(admin.ErrorBadRequestType, err, "error validating ssh inventory host")
+	}
+
+	now := time.Now().UTC()
+	host.CreatedAt, host.UpdatedAt = now, now
+	if old, err := inventory.GetSSHInventoryHost(host.Hostname); err == nil {
+		host.CreatedAt = old.CreatedAt
+	} else if !nosql.IsErrNotFound(err) {
+		return nil, admin.WrapErrorISE(err, "error storing ssh inventory host")
+	}
+
+	if err := inventory.StoreSSHInventoryHost(host); err != nil {
+		return nil, admin.WrapErrorISE(err, "error storing ssh inventory host")
+	}
+	return host, nil
+}
+
+// GetSSHInventoryHosts returns all the hosts in the SSH host inventory sorted
+// by hostname.
+func (a *Authority) GetSSHInventoryHosts(_ context.Context) ([]*db.SSHInventoryHost, error) {
+	inventory, err := a.sshHostInventory()
+	if err != nil {
+		return nil, err
+	}
+	hosts, err := inventory.GetSSHInventoryHosts()
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error retrieving ssh inventory hosts")
+	}
+	sort.Slice(hosts, func(i, j int) bool {
+		return hosts[i].Hostname < hosts[j].Hostname
+	})
+	return hosts, nil
+}
+
+// RemoveSSHInventoryHost removes a host from the SSH host inventory.
+func (a *Authority) RemoveSSHInventoryHost(_ context.Context, hostname string) error {
+	inventory, err := a.sshHostInventory()
+	if err != nil {
+		return err
+	}
+	if _, err := inventory.GetSSHInventoryHost(hostname); err != nil {
+		if nosql.IsErrNotFound(err) {
+			return admin.NewError(admin.ErrorNotFoundType, "ssh inventory host %s not found", hostname)
+		}
+		return admin.WrapErrorISE(err, "error deleting ssh inventory host %s", hostname)
+	}
+	if err := inventory.DeleteSSHInventoryHost(hostname); err != nil {
+		return admin.WrapErrorISE(err, "error deleting ssh inventory host %s", hostname)
+	}
+	return nil
+}
+
+// validateSSHInventoryHost validates the hostname, tags and groups of a host.
+// The hostname and groups are normalized to lowercase.
+func validateSSHInventoryHost(host *db.SSHInventoryHost) error {
+	if host == nil {
+		return errors.New("ssh inventory host cannot be empty")
+	}
+	host.Hostname = strings.ToLower(strings.TrimSpace(host.Hostname))
+	if host.Hostname == "" || strings.ContainsAny(host.Hostname, " \t/") {
+		return errors.Errorf("ssh inventory hostname %q is not valid", host.Hostname)
+	}
+	for name := range host.Tags {
+		if name == "" {
+			return errors.New("ssh inventory host tags cannot contain an empty name")
+		}
+	}
+	groups := make([]string, 0, len(host.Groups))
+	for _, g := range host.Groups {
+		g = strings.ToLower(strings.TrimSpace(g))
+		if g == "" {
+			return errors.New("ssh inventory host groups cannot contain an empty value")
+		}
+		if !slices.Contains(groups, g) {
+			groups = append(groups, g)
+		}
+	}
+	host.Groups = groups
+	return nil
+}
+
+// getSSHInventoryHosts returns the hosts in the SSH host inventory as a list of
+// config.Host. It returns an empty list if the inventory is not available.
+func (a *Authority) getSSHInventoryHosts() ([]config.Host, error) {
+	inventory, ok := a.db.(db.SSHHostInventoryDB)
+	if !ok {
+		return nil, nil
+	}
+	entries, err := inventory.GetSSHInventoryHosts()
+	if err != nil {
+		if errors.Is(err, db.ErrNotImplemented) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	hosts := make([]config.Host, len(entries))
+	for i, e := range entries {
+		hosts[i] = config.Host{
+			HostID:   e.Hostname,
+			Hostname: e.Hostname,
+			Groups:   e.Groups,
+		}
+		for name, value := range e.Tags {
+			hosts[i].HostTags = append(hosts[i].HostTags, config.HostTag{
+				Name:  name,
+				Value: value,
+			})
+		}
+		sort.Slice(hosts[i].HostTags, func(a, b int) bool {
+			return hosts[i].HostTags[a].Name < hosts[i].HostTags[b].Name
+		})
+	}
+	sort.Slice(hosts, func(i, j int) bool {
+		return hosts[i].Hostname < hosts[j].Hostname
+	})
+	return hosts, nil
+}
+
+// filterSSHHosts returns the hosts in the groups that the ssh.hostAccess rules
+// grant to the client certificate. All the hosts are returned if there are no
+// rules.
+func (a *Authority) filterSSHHosts(cert *x509.Certificate, hosts []config.Host) ([]config.Host, error) {
+	if a.config.SSH == nil || len(a.config.SSH.HostAccess) == 0 {
+		return hosts, nil
+	}
+	if cert == nil {
+		return nil, errs.Unauthorized("getSSHHosts: a client certificate is required to list the ssh hosts")
+	}
+
+	identities := sshHostAccessIdentities(cert)
+	allowed := make(map[string]bool)
+	for _, rule := range a.config.SSH.HostAccess {
+		if rule.Allows(identities...) {
+			allowed[strings.ToLower(rule.Group)] = true
+		}
+	}
+
+	filtered := make([]config.Host, 0, len(hosts))
+	for _, h := range hosts {
+		for _, g := range h.Groups {
+			if allowed[strings.ToLower(g)] {
+				filtered = append(filtered, h)
+				break
+			}
+		}
+	}
+	return filtered, nil
+}
+
+// sshHostAccessIdentities returns the identities of the client certificate
+// matched by the ssh.hostAccess rules. These are the email addresses of the
+// certificate, and the common name only if it is also one of the SANs, the
+// common name alone is not validated by all the provisioners.
+func sshHostAccessIdentities(cert *x509.Certificate) []string {
+	identities := slices.Clone(cert.EmailAddresses)
+	if cn := cert.Subject.CommonName; cn != "" && !slices.Contains(identities, cn) {
+		if slices.Contains(cert.DNSNames, cn) {
+			identities = append(identities, cn)
+		} else {
+			for _, u := range cert.URIs {
+				if u.String() == cn {
+					identities = append(identities, cn)
+					break
+				}
+			}
+		}
+	}
+	return identities
+}
+
+// getSSHHostTemplateData returns the information of the SSH host inventory for
+// a host certificate request. The host is searched using the identity verified
+// by the provisioner, the token subject or the instance identity, and nil is
+// returned if it's not registered. The key id and principals of the request
+// are never used, they are chosen by the client.
+func (a *Authority) getSSHHostTemplateData(opts provisioner.SignSSHOptions, audit *provisioner.SSHAuditMetadata) (*provisioner.SSHHostTemplateData, error) {
+	inventory, ok := a.db.(db.SSHHostInventoryDB)
+	if !ok || opts.CertType != provisioner.SSHHostCert || audit == nil || audit.Identity == "" {
+		return nil, nil
+	}
+	host, err := inventory.GetSSHInventoryHost(strings.ToLower(audit.Identity))
+	switch {
+	case nosql.IsErrNotFound(err), errors.Is(err, db.ErrNotImplemented):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	case host == nil:
+		return nil, nil
+	default:
+		return &provisioner.SSHHostTemplateData{
+			Hostname: host.Hostname,
+			Tags:     host.Tags,
+			Groups:   host.Groups,
+		}, nil
+	}
+}
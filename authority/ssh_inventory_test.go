@@ -0,0 +1,251 @@
+package authority
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/smallstep/nosql/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/sshutil"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+)
+
+func TestAuthority_StoreSSHInventoryHost(t *testing.T) {
+	createdAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		db       db.AuthDB
+		host     *db.SSHInventoryHost
+		want     *db.SSHInventoryHost
+		wantType admin.ProblemType
+		wantErr  bool
+	}{
+		{"ok new", &db.MockAuthDB{
+			MGetSSHInventoryHost: func(hostname string) (*db.SSHInventoryHost, error) {
+				return nil, database.ErrNotFound
+			},
+		}, &db.SSHInventoryHost{Hostname: " Web01.Internal ", Groups: []string{"Web", "web"}}, &db.SSHInventoryHost{
+			Hostname: "web01.internal", Groups: []string{"web"},
+		}, 0, false},
+		{"ok existing", &db.MockAuthDB{
+			MGetSSHInventoryHost: func(hostname string) (*db.SSHInventoryHost, error) {
+				return &db.SSHInventoryHost{Hostname: hostname, CreatedAt: createdAt}, nil
+			},
+		}, &db.SSHInventoryHost{Hostname: "web01.internal", Tags: map[string]string{"env": "prod"}}, &db.SSHInventoryHost{
+			Hostname: "web01.internal", Tags: map[string]string{"env": "prod"}, Groups: []string{}, CreatedAt: createdAt,
+		}, 0, false},
+		{"fail hostname", &db.MockAuthDB{}, &db.SSHInventoryHost{Hostname: "web 01"}, nil, admin.ErrorBadRequestType, true},
+		{"fail tags", &db.MockAuthDB{}, &db.SSHInventoryHost{Hostname: "web01", Tags: map[string]string{"": "prod"}}, nil, admin.ErrorBadRequestType, true},
+		{"fail groups", &db.MockAuthDB{}, &db.SSHInventoryHost{Hostname: "web01", Groups: []string{" "}}, nil, admin.ErrorBadRequestType, true},
+		{"fail get", &db.MockAuthDB{
+			MGetSSHInventoryHost: func(hostname string) (*db.SSHInventoryHost, error) {
+				return nil, errors.New("force")
+			},
+		}, &db.SSHInventoryHost{Hostname: "web01"}, nil, admin.ErrorServerInternalType, true},
+		{"fail store", &db.MockAuthDB{
+			MGetSSHInventoryHost: func(hostname string) (*db.SSHInventoryHost, error) {
+				return nil, database.ErrNotFound
+			},
+			MStoreSSHInventoryHost: func(host *db.SSHInventoryHost) error {
+				return errors.New("force")
+			},
+		}, &db.SSHInventoryHost{Hostname: "web01"}, nil, admin.ErrorServerInternalType, true},
+		{"fail not implemented", &db.SimpleDB{}, &db.SSHInventoryHost{Hostname: "web01"}, nil, admin.ErrorNotImplementedType, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testAuthority(t, WithDatabase(tt.db))
+			got, err := a.StoreSSHInventoryHost(context.Background(), tt.host)
+			if tt.wantErr {
+				var ae *admin.Error
+				if assert.ErrorAs(t, err, &ae) {
+					assert.Equal(t, tt.wantType.String(), ae.Type)
+				}
+				return
+			}
+			require.NoError(t, err)
+			assert.False(t, got.UpdatedAt.IsZero())
+			if tt.want.CreatedAt.IsZero() {
+				assert.Equal(t, got.UpdatedAt, got.CreatedAt)
+				tt.want.CreatedAt = got.CreatedAt
+			}
+			tt.want.UpdatedAt = got.UpdatedAt
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestAuthority_RemoveSSHInventoryHost(t *testing.T) {
+	var deleted string
+	a := testAuthority(t, WithDatabase(&db.MockAuthDB{
+		MGetSSHInventoryHost: func(hostname string) (*db.SSHInventoryHost, error) {
+			if hostname == "web01.internal" {
+				return &db.SSHInventoryHost{Hostname: hostname}, nil
+			}
+			return nil, database.ErrNotFound
+		},
+		MDeleteSSHInventoryHost: func(hostname string) error {
+			deleted = hostname
+			return nil
+		},
+	}))
+
+	require.NoError(t, a.RemoveSSHInventoryHost(context.Background(), "web01.internal"))
+	assert.Equal(t, "web01.internal", deleted)
+
+	var ae *admin.Error
+	err := a.RemoveSSHInventoryHost(context.Background(), "db01.internal")
+	if assert.ErrorAs(t, err, &ae) {
+		assert.Equal(t, admin.ErrorNotFoundType.String(), ae.Type)
+	}
+}
+
+func TestAuthority_GetSSHHosts_inventory(t *testing.T) {
+	a := testAuthority(t, WithDatabase(&db.MockAuthDB{
+		MGetSSHInventoryHosts: func() ([]*db.SSHInventoryHost, error) {
+			return []*db.SSHInventoryHost{
+				{Hostname: "web01.internal", Tags: map[string]string{"region": "eu", "env": "prod"}, Groups: []string{"web"}},
+				{Hostname: "db01.internal", Groups: []string{"db"}},
+				{Hostname: "bastion.internal"},
+			}, nil
+		},
+		MGetSSHHostPrincipals: func() ([]string, error) {
+			return nil, errors.New("unexpected call")
+		},
+	}))
+
+	hosts, err := a.GetSSHHosts(context.Background(), &x509.Certificate{})
+	require.NoError(t, err)
+	assert.Equal(t, []config.Host{
+		{HostID: "bastion.internal", Hostname: "bastion.internal"},
+		{HostID: "db01.internal", Hostname: "db01.internal", Groups: []string{"db"}},
+		{HostID: "web01.internal", Hostname: "web01.internal", Groups: []string{"web"}, HostTags: []config.HostTag{
+			{Name: "env", Value: "prod"},
+			{Name: "region", Value: "eu"},
+		}},
+	}, hosts)
+
+	a.config.SSH = &config.SSHConfig{
+		HostAccess: []*config.SSHHostAccess{
+			{Group: "web", Users: []string{"@example.com"}},
+			{Group: "db", Users: []string{"dba@example.com"}},
+		},
+	}
+
+	_, err = a.GetSSHHosts(context.Background(), nil)
+	assert.Error(t, err)
+
+	hosts, err = a.GetSSHHosts(context.Background(), &x509.Certificate{
+		EmailAddresses: []string{"jane@example.com"},
+	})
+	require.NoError(t, err)
+	if assert.Len(t, hosts, 1) {
+		assert.Equal(t, "web01.internal", hosts[0].Hostname)
+	}
+
+	hosts, err = a.GetSSHHosts(context.Background(), &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "dba@example.com"},
+		EmailAddresses: []string{"dba@example.com"},
+	})
+	require.NoError(t, err)
+	assert.Len(t, hosts, 2)
+
+	// The common name is only used if it is also a SAN.
+	hosts, err = a.GetSSHHosts(context.Background(), &x509.Certificate{
+		Subject: pkix.Name{CommonName: "dba@example.com"},
+	})
+	require.NoError(t, err)
+	assert.Empty(t, hosts)
+
+	hosts, err = a.GetSSHHosts(context.Background(), &x509.Certificate{
+		EmailAddresses: []string{"jane@example.org"},
+	})
+	require.NoError(t, err)
+	assert.Empty(t, hosts)
+}
+
+func TestAuthority_SignSSH_hostInventory(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	pub, err := ssh.NewPublicKey(key.Public())
+	require.NoError(t, err)
+	signKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(signKey)
+	require.NoError(t, err)
+
+	hostTemplate, err := provisioner.TemplateSSHOptions(&provisioner.Options{
+		SSH: &provisioner.SSHOptions{Template: `{
+			"type": "{{ .Type }}",
+			"keyId": "{{ .KeyID }}",
+			"principals": {{ if .Host }}{{ toJson (concat .Principals .Host.Groups) }}{{ else }}{{ toJson .Principals }}{{ end }}
+		}`},
+	}, sshutil.CreateTemplateData(sshutil.HostCert, "web01.internal", []string{"web01.internal"}))
+	require.NoError(t, err)
+
+	inventory := &db.MockAuthDB{
+		MGetSSHInventoryHost: func(hostname string) (*db.SSHInventoryHost, error) {
+			if hostname != "web01.internal" {
+				return nil, database.ErrNotFound
+			}
+			return &db.SSHInventoryHost{Hostname: hostname, Groups: []string{"web"}}, nil
+		},
+	}
+
+	tests := []struct {
+		name    string
+		db      db.AuthDB
+		audit   *provisioner.SSHAuditMetadata
+		want    []string
+		wantErr bool
+	}{
+		{"ok", inventory, &provisioner.SSHAuditMetadata{Identity: "web01.internal"}, []string{"web01.internal", "web"}, false},
+		{"ok not found", &db.MockAuthDB{
+			MGetSSHInventoryHost: func(hostname string) (*db.SSHInventoryHost, error) {
+				return nil, database.ErrNotFound
+			},
+		}, &provisioner.SSHAuditMetadata{Identity: "web01.internal"}, []string{"web01.internal"}, false},
+		{"ok request names are not used", inventory, &provisioner.SSHAuditMetadata{Identity: "i-1234567890"}, []string{"web01.internal"}, false},
+		{"ok without identity", inventory, nil, []string{"web01.internal"}, false},
+		{"fail", &db.MockAuthDB{
+			MGetSSHInventoryHost: func(hostname string) (*db.SSHInventoryHost, error) {
+				return nil, errors.New("force")
+			},
+		}, &provisioner.SSHAuditMetadata{Identity: "web01.internal"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testAuthority(t, WithDatabase(tt.db))
+			a.sshCAHostCertSignKey = signer
+
+			signOpts := []provisioner.SignOption{hostTemplate}
+			if tt.audit != nil {
+				signOpts = append(signOpts, tt.audit)
+			}
+			got, err := a.SignSSH(context.Background(), pub, provisioner.SignSSHOptions{
+				CertType:   "host",
+				KeyID:      "web01.internal",
+				Principals: []string{"web01.internal"},
+			}, signOpts...)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got.ValidPrincipals)
+		})
+	}
+}
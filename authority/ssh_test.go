@@ -20,6 +20,7 @@ import (
 
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/config"
 	"github.com/smallstep/certificates/authority/policy"
 	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/db"
@@ -135,6 +136,31 @@ func TestAuthority_initUserOnly(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestAuthority_initSigningKeys(t *testing.T) {
+	// The previous key is still trusted but the new one signs the
+	// certificates.
+	auth := testAuthority(t, func(a *Authority) error {
+		a.config.SSH.SigningKeys = []*config.SSHSigningKey{
+			{Type: "host", Key: "testdata/secrets/ssh_user_ca_key", Active: true},
+			{Type: "user", Key: "testdata/secrets/ssh_host_ca_key"},
+		}
+		return nil
+	})
+
+	keys, err := auth.GetSSHRoots(context.Background())
+	assert.NoError(t, err)
+	if assert.Len(t, 2, keys.HostKeys) && assert.Len(t, 2, keys.UserKeys) {
+		assert.Equals(t, auth.sshCAHostCertSignKey.PublicKey(), keys.HostKeys[0])
+		assert.Equals(t, auth.sshCAUserCertSignKey.PublicKey(), keys.UserKeys[0])
+		assert.Equals(t, keys.UserKeys[0], keys.HostKeys[0])
+		assert.Equals(t, keys.HostKeys[1], keys.UserKeys[1])
+	}
+
+	// Template variables use the active keys.
+	assert.Equals(t, auth.sshCAHostCertSignKey.PublicKey(), auth.templates.Data["Step"].(templates.Step).SSH.HostKey)
+	assert.Len(t, 1, auth.templates.Data["Step"].(templates.Step).SSH.HostFederatedKeys)
+}
+
 func TestAuthority_SignSSH(t *testing.T) {
 	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	assert.FatalError(t, err)
@@ -267,6 +293,7 @@ func TestAuthority_SignSSH(t *testing.T) {
 		{"ok-opts-modifier", fields{signer, signer, nil}, args{pub, provisioner.SignSSHOptions{}, []provisioner.SignOption{userTemplate, userOptions, sshTestOptionsModifier("")}}, want{CertType: ssh.UserCert}, false},
 		{"ok-custom-template", fields{signer, signer, nil}, args{pub, provisioner.SignSSHOptions{}, []provisioner.SignOption{userCustomTemplate, userOptions}}, want{CertType: ssh.UserCert, Principals: []string{"user", "admin"}}, false},
 		{"ok-enrich-template", fields{signer, signer, nil}, args{pub, provisioner.SignSSHOptions{}, []provisioner.SignOption{enrichTemplate, userOptions, &mockWebhookController{templateData: enrichTemplateData, respData: map[string]any{"people": map[string]any{"role": []string{"user", "eng"}}}}}}, want{CertType: ssh.UserCert, Principals: []string{"user", "eng"}}, false},
+		{"ok-enrich-principals", fields{signer, signer, nil}, args{pub, provisioner.SignSSHOptions{}, []provisioner.SignOption{userTemplate, userOptions, &mockWebhookController{sshPrincipals: []string{"jane", "admin"}}}}, want{CertType: ssh.UserCert, Principals: []string{"jane", "admin"}}, false},
 		{"ok-user-policy", fields{signer, signer, userPolicy}, args{pub, provisioner.SignSSHOptions{CertType: "user", Principals: []string{"user"}}, []provisioner.SignOption{userTemplateWithUser}}, want{CertType: ssh.UserCert, Principals: []string{"user"}}, false},
 		{"ok-host-policy", fields{signer, signer, hostPolicy}, args{pub, provisioner.SignSSHOptions{CertType: "host", Principals: []string{"foo.test.com", "bar.test.com"}}, []provisioner.SignOption{hostTemplateWithHosts}}, want{CertType: ssh.HostCert, Principals: []string{"foo.test.com", "bar.test.com"}}, false},
 		{"fail-opts-type", fields{signer, signer, nil}, args{pub, provisioner.SignSSHOptions{CertType: "foo"}, []provisioner.SignOption{userTemplate}}, want{}, true},
@@ -288,6 +315,7 @@ func TestAuthority_SignSSH(t *testing.T) {
 		{"fail-host-policy-with-user-cert", fields{signer, signer, hostPolicy}, args{pub, provisioner.SignSSHOptions{CertType: "user", Principals: []string{"user"}}, []provisioner.SignOption{userTemplateWithUser}}, want{}, true},
 		{"fail-host-policy-with-bad-host", fields{signer, signer, hostPolicy}, args{pub, provisioner.SignSSHOptions{CertType: "host", Principals: []string{"example.com"}}, []provisioner.SignOption{badHostTemplate}}, want{}, true},
 		{"fail-enriching-webhooks", fields{signer, signer, nil}, args{pub, provisioner.SignSSHOptions{}, []provisioner.SignOption{userTemplate, userOptions, &mockWebhookController{enrichErr: provisioner.ErrWebhookDenied}}}, want{}, true},
+		{"fail-modify-webhooks", fields{signer, signer, nil}, args{pub, provisioner.SignSSHOptions{}, []provisioner.SignOption{userTemplate, userOptions, &mockWebhookController{modifySSHErr: errors.New("an error")}}}, want{}, true},
 		{"fail-authorizing-webhooks", fields{signer, signer, nil}, args{pub, provisioner.SignSSHOptions{}, []provisioner.SignOption{userTemplate, userOptions, &mockWebhookController{authorizeErr: provisioner.ErrWebhookDenied}}}, want{}, true},
 	}
 	for _, tt := range tests {
@@ -996,6 +1024,40 @@ func TestAuthority_RekeySSH(t *testing.T) {
 				code:       http.StatusBadRequest,
 			}
 		},
+		"fail/no-key": func(t *testing.T) *test {
+			return &test{
+				userSigner: signer,
+				hostSigner: signer,
+				cert:       &ssh.Certificate{ValidAfter: uint64(now.Unix()), ValidBefore: uint64(now.Add(10 * time.Minute).Unix()), CertType: ssh.HostCert},
+				signOpts:   []provisioner.SignOption{},
+				err:        errors.New("cannot rekey a certificate without a public key"),
+				code:       http.StatusBadRequest,
+			}
+		},
+		"fail/same-key": func(t *testing.T) *test {
+			return &test{
+				userSigner: signer,
+				hostSigner: signer,
+				cert:       &ssh.Certificate{Key: pub, ValidAfter: uint64(now.Unix()), ValidBefore: uint64(now.Add(10 * time.Minute).Unix()), CertType: ssh.HostCert},
+				key:        pub,
+				signOpts:   []provisioner.SignOption{},
+				err:        errors.New("cannot rekey a certificate with the same public key"),
+				code:       http.StatusBadRequest,
+			}
+		},
+		"ok/same-key-allowed": func(t *testing.T) *test {
+			auth := testAuthority(t, WithDatabase(a.db))
+			auth.config.SSH = &config.SSHConfig{AllowSameKeyRekey: true}
+			return &test{
+				auth:     auth,
+				cert:     &ssh.Certificate{Key: pub, ValidAfter: uint64(now.Unix()), ValidBefore: uint64(now.Add(10 * time.Minute).Unix()), CertType: ssh.UserCert},
+				key:      pub,
+				signOpts: []provisioner.SignOption{},
+				cmpResult: func(old, n *ssh.Certificate) {
+					assert.Equals(t, n.Key.Marshal(), old.Key.Marshal())
+				},
+			}
+		},
 		"fail/old-cert-no-user-key": func(t *testing.T) *test {
 			return &test{
 				userSigner: nil,
@@ -11,6 +11,7 @@ import (
 	"encoding/json"
 	"encoding/pem"
 	"fmt"
+	"log"
 	"math/big"
 	"net"
 	"net/http"
@@ -18,6 +19,7 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
+	"golang.org/x/crypto/ocsp"
 	"golang.org/x/crypto/ssh"
 
 	"go.step.sm/crypto/jose"
@@ -26,6 +28,7 @@ import (
 	"go.step.sm/crypto/x509util"
 
 	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/lint"
 	"github.com/smallstep/certificates/authority/provisioner"
 	casapi "github.com/smallstep/certificates/cas/apiv1"
 	"github.com/smallstep/certificates/db"
@@ -56,6 +59,7 @@ var (
 	oidAuthorityKeyIdentifier            = asn1.ObjectIdentifier{2, 5, 29, 35}
 	oidSubjectKeyIdentifier              = asn1.ObjectIdentifier{2, 5, 29, 14}
 	oidExtensionIssuingDistributionPoint = asn1.ObjectIdentifier{2, 5, 29, 28}
+	oidExtensionReasonCode               = asn1.ObjectIdentifier{2, 5, 29, 21}
 )
 
 func withDefaultASN1DN(def *config.ASN1DN) provisioner.CertificateModifierFunc {
@@ -180,6 +184,34 @@ func (a *Authority) signX509(ctx context.Context, csr *x509.CertificateRequest,
 		}
 	}
 
+	// Reject public keys in the denylist
+	if err := a.keyDenylist.Validate(csr.PublicKey); err != nil {
+		return nil, prov, errs.ApplyOptions(err, opts...)
+	}
+
+	// Reject public keys of a type not allowed by the authority
+	if err := a.checkX509KeyType(csr.PublicKey); err != nil {
+		return nil, prov, errs.ApplyOptions(err, opts...)
+	}
+
+	// Reject the request if the provisioner is deprecated or if the request
+	// does not satisfy its conditions. The checks are also done here for the
+	// flows that do not use a token, like ACME or SCEP.
+	if err := checkProvisionerState(prov); err != nil {
+		return nil, prov, errs.ApplyOptions(err, opts...)
+	}
+	if err := checkProvisionerConditions(ctx, prov); err != nil {
+		return nil, prov, errs.ApplyOptions(err, opts...)
+	}
+
+	// Reject the request if the provisioner has exceeded its rate limit. The
+	// token flows are limited before the token is authorized.
+	if !isTokenAuthorized(prov) {
+		if err := a.checkRateLimit(prov); err != nil {
+			return nil, prov, errs.ApplyOptions(err, opts...)
+		}
+	}
+
 	if err := a.callEnrichingWebhooksX509(ctx, prov, webhookCtl, attData, csr); err != nil {
 		return nil, prov, errs.ApplyOptions(
 			errs.ForbiddenErr(err, err.Error()),
@@ -230,6 +262,22 @@ func (a *Authority) signX509(ctx context.Context, csr *x509.CertificateRequest,
 		}
 	}
 
+	// Align the expiration to the calendar boundary configured in the
+	// provisioner before validating the final validity period. The expiration
+	// is kept if the aligned one would be in the past or shorter than the
+	// minimum duration of the provisioner.
+	if p, ok := prov.(interface{ GetOptions() *provisioner.Options }); ok {
+		if alignment := p.GetOptions().GetX509Options().GetNotAfterAlignment(); alignment != "" {
+			var minDuration time.Duration
+			for _, v := range certValidators {
+				if m, ok := v.(interface{ MinDuration() time.Duration }); ok && m.MinDuration() > minDuration {
+					minDuration = m.MinDuration()
+				}
+			}
+			leaf.NotAfter = alignment.AlignNotAfter(leaf.NotBefore, leaf.NotAfter, time.Now(), minDuration)
+		}
+	}
+
 	// Certificate validation.
 	for _, v := range certValidators {
 		if err := v.Valid(leaf, signOpts); err != nil {
@@ -260,6 +308,26 @@ func (a *Authority) signX509(ctx context.Context, csr *x509.CertificateRequest,
 		}
 	}
 
+	// Add the poison extension to pre-certificates, if the provisioner allows
+	// them
+	if signOpts.Precertificate && !precertificatesAllowed(prov) {
+		return nil, prov, errs.ApplyOptions(
+			errs.Forbidden("provisioner does not allow pre-certificates"),
+			opts...,
+		)
+	}
+	if err = withPrecertificatePoison(signOpts.Precertificate).Enforce(leaf); err != nil {
+		return nil, prov, errs.ApplyOptions(
+			errs.ForbiddenErr(err, "error creating certificate"),
+			opts...,
+		)
+	}
+
+	// Set the default signature algorithm and reject the ones not allowed
+	if err := a.setX509SignatureAlgorithm(leaf); err != nil {
+		return nil, prov, errs.ApplyOptions(err, opts...)
+	}
+
 	// Check if authority is allowed to sign the certificate
 	if err = a.isAllowedToSignX509Certificate(leaf); err != nil {
 		var ee *errs.Error
@@ -273,6 +341,19 @@ func (a *Authority) signX509(ctx context.Context, csr *x509.CertificateRequest,
 		)
 	}
 
+	// Reject the request if the certificate exceeds the authority limits
+	if err := a.checkX509Limits(leaf, leaf.NotAfter.Sub(leaf.NotBefore.Add(signOpts.Backdate))); err != nil {
+		return nil, prov, errs.ApplyOptions(err, opts...)
+	}
+	if err := a.checkX509ChainLimits(); err != nil {
+		return nil, prov, errs.ApplyOptions(err, opts...)
+	}
+
+	// Lint the certificate before signing it
+	if err := a.lintX509Certificate(leaf); err != nil {
+		return nil, prov, errs.ApplyOptions(err, opts...)
+	}
+
 	// Send certificate to webhooks for authorization
 	if err := a.callAuthorizingWebhooksX509(ctx, prov, webhookCtl, crt, leaf, attData); err != nil {
 		return nil, prov, errs.ApplyOptions(
@@ -281,10 +362,32 @@ func (a *Authority) signX509(ctx context.Context, csr *x509.CertificateRequest,
 		)
 	}
 
-	// Sign certificate
+	// Check the CAA records of the DNS names just before signing
+	if p, ok := prov.(interface{ GetOptions() *provisioner.Options }); ok {
+		if err := p.GetOptions().GetX509Options().GetCAA().Check(ctx, leaf); err != nil {
+			return nil, prov, errs.ApplyOptions(
+				errs.ForbiddenErr(err, "error creating certificate"),
+				opts...,
+			)
+		}
+	}
+
 	lifetime := leaf.NotAfter.Sub(leaf.NotBefore.Add(signOpts.Backdate))
 
-	resp, err := a.x509CAService.CreateCertificate(&casapi.CreateCertificateRequest{
+	// Queue the request if the provisioner requires the approval of an
+	// administrator, the certificate is signed once it's approved.
+	if o, ok := getApprovalOptions(prov); ok {
+		return nil, prov, a.queuePendingIssuance(ctx, prov, o, csr, leaf, lifetime, signOpts.Backdate)
+	}
+
+	// Reject the request if the provisioner has reached its certificate quota
+	quotaDone, err := a.reserveCertificateQuota(prov, leaf)
+	if err != nil {
+		return nil, prov, errs.ApplyOptions(err, opts...)
+	}
+
+	// Sign certificate
+	resp, err := a.getX509CAService().CreateCertificate(&casapi.CreateCertificateRequest{
 		Template:    leaf,
 		CSR:         csr,
 		Lifetime:    lifetime,
@@ -292,9 +395,11 @@ func (a *Authority) signX509(ctx context.Context, csr *x509.CertificateRequest,
 		Provisioner: pInfo,
 	})
 	if err != nil {
+		quotaDone(nil)
 		return nil, prov, errs.Wrap(http.StatusInternalServerError, err, "authority.Sign; error creating certificate", opts...)
 	}
 
+	quotaDone(resp.Certificate)
 	chain := append([]*x509.Certificate{resp.Certificate}, resp.CertificateChain...)
 
 	// Wrap provisioner with extra information, if not nil
@@ -307,13 +412,54 @@ func (a *Authority) signX509(ctx context.Context, csr *x509.CertificateRequest,
 		return nil, prov, errs.Wrap(http.StatusInternalServerError, err, "authority.Sign; error storing certificate in db", opts...)
 	}
 
+	a.notifyCertificateIssued(ctx, prov, csr, chain)
+
 	return chain, prov, nil
 }
 
+// lintX509Certificate runs the built-in lints enabled in the configuration and
+// the custom ones on the certificate that is going to be signed. The template
+// is encoded with an ephemeral key, so a certificate failing the lints is
+// never signed by the CA. If the lints are configured as warn-only, the
+// findings are logged and no error is returned.
+func (a *Authority) lintX509Certificate(leaf *x509.Certificate) error {
+	var cfg *config.LintConfig
+	if a.config != nil && a.config.AuthorityConfig != nil {
+		cfg = a.config.AuthorityConfig.Lint
+	}
+
+	var linters []lint.Linter
+	if cfg != nil {
+		linters = lint.Builtin(cfg.Options())
+	}
+	linters = append(linters, a.x509Linters...)
+	if len(linters) == 0 {
+		return nil
+	}
+
+	der, err := marshalPendingTemplate(leaf)
+	if err != nil {
+		return errs.Wrap(http.StatusInternalServerError, err, "authority.lintX509Certificate")
+	}
+	crt, err := x509.ParseCertificate(der)
+	if err != nil {
+		return errs.Wrap(http.StatusInternalServerError, err, "authority.lintX509Certificate")
+	}
+
+	if err := lint.Lint(crt, linters...); err != nil {
+		if cfg != nil && cfg.WarnOnly {
+			log.Printf("WARNING: certificate for %q: %v", leaf.Subject.CommonName, err)
+			return nil
+		}
+		return errs.ForbiddenErr(err, "%s", err)
+	}
+	return nil
+}
+
 // isAllowedToSignX509Certificate checks if the Authority is allowed
 // to sign the X.509 certificate.
 func (a *Authority) isAllowedToSignX509Certificate(cert *x509.Certificate) error {
-	if err := a.constraintsEngine.ValidateCertificate(cert); err != nil {
+	if err := a.getConstraintsEngine().ValidateCertificate(cert); err != nil {
 		return err
 	}
 	return a.policyEngine.IsX509CertificateAllowed(cert)
@@ -418,6 +564,23 @@ func (a *Authority) renewContext(ctx context.Context, oldCert *x509.Certificate,
 		newCert.PublicKey = oldCert.PublicKey
 	}
 
+	// Reject public keys in the denylist, the old key might have been added to
+	// the list after the certificate was issued.
+	if err := a.keyDenylist.Validate(newCert.PublicKey); err != nil {
+		return nil, prov, errs.StatusCodeError(http.StatusForbidden, err, opts...)
+	}
+
+	// Reject public keys of a type not allowed by the authority, the allowed
+	// key types might have changed after the certificate was issued.
+	if err := a.checkX509KeyType(newCert.PublicKey); err != nil {
+		return nil, prov, errs.StatusCodeError(http.StatusForbidden, err, opts...)
+	}
+
+	// Sign the new certificate with the configured signature algorithm.
+	if err := a.setX509SignatureAlgorithm(newCert); err != nil {
+		return nil, prov, errs.StatusCodeError(http.StatusForbidden, err, opts...)
+	}
+
 	// Copy all extensions except:
 	//
 	//  1. Authority Key Identifier - This one might be different if we rotate
@@ -438,12 +601,21 @@ func (a *Authority) renewContext(ctx context.Context, oldCert *x509.Certificate,
 		newCert.ExtraExtensions = append(newCert.ExtraExtensions, ext)
 	}
 
+	// Reject the renewal if the certificate exceeds the authority limits, the
+	// subject and validity of the new certificate are the old ones.
+	if err := a.checkX509Limits(oldCert, lifetime); err != nil {
+		return nil, prov, errs.StatusCodeError(http.StatusForbidden, err, opts...)
+	}
+	if err := a.checkX509ChainLimits(); err != nil {
+		return nil, prov, errs.StatusCodeError(http.StatusForbidden, err, opts...)
+	}
+
 	// Check if the certificate is allowed to be renewed, name constraints might
 	// change over time.
 	//
 	// TODO(hslatman,maraino): consider adding policies too and consider if
 	// RenewSSH should check policies.
-	if err = a.constraintsEngine.ValidateCertificate(newCert); err != nil {
+	if err = a.getConstraintsEngine().ValidateCertificate(newCert); err != nil {
 		var ee *errs.Error
 		switch {
 		case errors.As(err, &ee):
@@ -460,7 +632,7 @@ func (a *Authority) renewContext(ctx context.Context, oldCert *x509.Certificate,
 	// mode, this can be used to renew a certificate.
 	token, _ := TokenFromContext(ctx)
 
-	resp, err := a.x509CAService.RenewCertificate(&casapi.RenewCertificateRequest{
+	resp, err := a.getX509CAService().RenewCertificate(&casapi.RenewCertificateRequest{
 		Template: newCert,
 		Lifetime: lifetime,
 		Backdate: backdate,
@@ -476,6 +648,8 @@ func (a *Authority) renewContext(ctx context.Context, oldCert *x509.Certificate,
 		return nil, prov, errs.StatusCodeError(http.StatusInternalServerError, err, opts...)
 	}
 
+	a.notifyCertificateIssued(ctx, prov, nil, chain)
+
 	return chain, prov, nil
 }
 
@@ -645,6 +819,14 @@ func (a *Authority) Revoke(ctx context.Context, revokeOpts *RevokeOptions) error
 		if err := a.revokeSSH(nil, rci); err != nil {
 			return failRevoke(err)
 		}
+
+		// Generate a new KRL so hosts will always get an up-to-date KRL
+		// whenever they request it.
+		if a.config.SSH.GetKRL().IsEnabled() {
+			if err := a.GenerateSSHKeyRevocationList(); err != nil {
+				return errs.Wrap(http.StatusInternalServerError, err, "authority.Revoke", opts...)
+			}
+		}
 	} else {
 		// Revoke an X.509 certificate using CAS. If the certificate is not
 		// provided we will try to read it from the db. If the read fails we
@@ -659,7 +841,7 @@ func (a *Authority) Revoke(ctx context.Context, revokeOpts *RevokeOptions) error
 
 		// CAS operation, note that SoftCAS (default) is a noop.
 		// The revoke happens when this is stored in the db.
-		_, err := a.x509CAService.RevokeCertificate(&casapi.RevokeCertificateRequest{
+		_, err := a.getX509CAService().RevokeCertificate(&casapi.RevokeCertificateRequest{
 			Certificate:  revokedCert,
 			SerialNumber: rci.Serial,
 			Reason:       rci.Reason,
@@ -696,11 +878,20 @@ func (a *Authority) revoke(crt *x509.Certificate, rci *db.RevokedCertificateInfo
 	return a.db.Revoke(rci)
 }
 
+// revokeSSH revokes an SSH certificate. With a linked CA the revocation is
+// also stored in the database if the KRL is enabled, as the KRL is generated
+// with the revocations in the database.
 func (a *Authority) revokeSSH(crt *ssh.Certificate, rci *db.RevokedCertificateInfo) error {
 	if lca, ok := a.adminDB.(interface {
 		RevokeSSH(*ssh.Certificate, *db.RevokedCertificateInfo) error
 	}); ok {
-		return lca.RevokeSSH(crt, rci)
+		if err := lca.RevokeSSH(crt, rci); err != nil {
+			return err
+		}
+		if a.config.SSH.GetKRL().IsEnabled() {
+			return a.db.RevokeSSH(rci)
+		}
+		return nil
 	}
 	return a.db.RevokeSSH(rci)
 }
@@ -751,7 +942,7 @@ func (a *Authority) GenerateCertificateRevocationList() error {
 	}
 
 	// some CAS may not implement the CRLGenerator interface, so check before we proceed
-	caCRLGenerator, ok := a.x509CAService.(casapi.CertificateAuthorityCRLGenerator)
+	caCRLGenerator, ok := a.getX509CAService().(casapi.CertificateAuthorityCRLGenerator)
 	if !ok {
 		return errors.Errorf("CA does not support CRL Generation")
 	}
@@ -795,7 +986,7 @@ func (a *Authority) GenerateCertificateRevocationList() error {
 		revokedCertificates = append(revokedCertificates, pkix.RevokedCertificate{
 			SerialNumber:   &sn,
 			RevocationTime: revokedCert.RevokedAt,
-			Extensions:     nil,
+			Extensions:     crlEntryExtensions(revokedCert.ReasonCode),
 		})
 	}
 
@@ -838,6 +1029,10 @@ func (a *Authority) GenerateCertificateRevocationList() error {
 		return errors.Wrap(err, "could not create CRL")
 	}
 
+	// The certificates issued by the previous intermediates are checked with
+	// a CRL signed by their issuer.
+	a.generatePreviousCRLs(&revocationList)
+
 	// Create a new db.CertificateRevocationListInfo, which stores the new Number we just generated, the
 	// expiry time, duration, and the DER-encoded CRL
 	newCRLInfo := db.CertificateRevocationListInfo{
@@ -909,7 +1104,12 @@ func (a *Authority) GetTLSCertificate() (*tls.Certificate, error) {
 	certTpl.URIs = cr.URIs
 
 	// Fail if name constraints do not allow the server names.
-	if err := a.constraintsEngine.ValidateCertificate(certTpl); err != nil {
+	if err := a.getConstraintsEngine().ValidateCertificate(certTpl); err != nil {
+		return fatal(err)
+	}
+
+	// Use the configured signature algorithm.
+	if err := a.setX509SignatureAlgorithm(certTpl); err != nil {
 		return fatal(err)
 	}
 
@@ -918,11 +1118,11 @@ func (a *Authority) GetTLSCertificate() (*tls.Certificate, error) {
 	//  ii) if the CA is a StepCAS RA, leave the lifetime empty and
 	//      let the provisioner of the CA decide the lifetime of the RA cert.
 	var lifetime time.Duration
-	if casapi.TypeOf(a.x509CAService) != casapi.StepCAS {
+	if casapi.TypeOf(a.getX509CAService()) != casapi.StepCAS {
 		lifetime = 24 * time.Hour
 	}
 
-	resp, err := a.x509CAService.CreateCertificate(&casapi.CreateCertificateRequest{
+	resp, err := a.getX509CAService().CreateCertificate(&casapi.CreateCertificateRequest{
 		Template:       certTpl,
 		CSR:            cr,
 		Lifetime:       lifetime,
@@ -973,6 +1173,22 @@ type distributionPointName struct {
 	RelativeName pkix.RDNSequence `asn1:"optional,tag:1"`
 }
 
+// crlEntryExtensions returns the extensions of a CRL entry with the given
+// reason code. As RFC 5280 recommends, the reason code extension is not added
+// if the reason is unspecified.
+func crlEntryExtensions(reasonCode int) []pkix.Extension {
+	if reasonCode <= ocsp.Unspecified {
+		return nil
+	}
+	b, err := asn1.Marshal(asn1.Enumerated(reasonCode))
+	if err != nil {
+		return nil
+	}
+	return []pkix.Extension{
+		{Id: oidExtensionReasonCode, Value: b},
+	}
+}
+
 func marshalDistributionPoint(fullName string, isCA bool) ([]byte, error) {
 	return asn1.Marshal(distributionPoint{
 		DistributionPoint: distributionPointName{
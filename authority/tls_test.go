@@ -13,6 +13,7 @@ import (
 	"encoding/pem"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"reflect"
 	"testing"
@@ -27,6 +28,7 @@ import (
 	sassert "github.com/smallstep/assert"
 	"github.com/smallstep/certificates/api/render"
 	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/lint"
 	"github.com/smallstep/certificates/authority/policy"
 	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/cas/softcas"
@@ -1952,3 +1954,221 @@ func TestAuthority_CRL(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthority_SignWithContext_lint(t *testing.T) {
+	_, priv, err := keyutil.GenerateDefaultKeyPair()
+	require.NoError(t, err)
+
+	compliant := `{
+		"subject": {{ toJson .Subject }},
+		"dnsNames": {{ toJson .Insecure.CR.DNSNames }},
+		"keyUsage": ["digitalSignature"],
+		"extKeyUsage": ["serverAuth","clientAuth"]
+	}`
+	nonCompliant := `{
+		"subject": {{ toJson .Subject }},
+		"keyUsage": ["digitalSignature"]
+	}`
+
+	key, err := jose.ReadKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		template string
+		lint     *config.LintConfig
+		options  []Option
+		wantErr  string
+	}{
+		{"ok compliant", compliant, &config.LintConfig{}, nil, ""},
+		{"ok non-compliant without lint", nonCompliant, nil, nil, ""},
+		{"ok non-compliant warn only", nonCompliant, &config.LintConfig{WarnOnly: true}, nil, ""},
+		{"ok non-compliant skipped", nonCompliant, &config.LintConfig{Skip: []string{lint.CommonNameOnly, lint.ExtKeyUsage}}, nil, ""},
+		{"fail non-compliant", nonCompliant, &config.LintConfig{}, nil,
+			`certificate failed lint checks: cn_only: common name "smallstep test" is not included in the subject alternative names; ext_key_usage: certificate does not contain extended key usages`},
+		{"fail max validity", compliant, &config.LintConfig{MaxValidity: &provisioner.Duration{Duration: time.Hour}}, nil,
+			"certificate failed lint checks: validity: validity period 24h1m0s is greater than 1h0m0s"},
+		{"fail custom linter", compliant, nil, []Option{WithX509Linters(lint.New("no_smallstep", func(crt *x509.Certificate) error {
+			return errors.New("smallstep is not allowed")
+		}))}, "certificate failed lint checks: no_smallstep: smallstep is not allowed"},
+		{"fail custom linter format", compliant, nil, []Option{WithX509Linters(lint.New("no_percent", func(crt *x509.Certificate) error {
+			return errors.New("100% of smallstep is not allowed")
+		}))}, "certificate failed lint checks: no_percent: 100% of smallstep is not allowed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testAuthority(t, tt.options...)
+			a.config.AuthorityConfig.Lint = tt.lint
+			p, ok := a.provisioners.Load("step-cli:4UELJx8e0aS9m0CH3fZ0EB7D5aUPICb759zALHFejvc")
+			require.True(t, ok)
+			p.(*provisioner.JWK).Options = &provisioner.Options{
+				X509: &provisioner.X509Options{Template: tt.template},
+			}
+
+			token, err := generateToken("smallstep test", "step-cli", testAudiences.Sign[0], []string{"test.smallstep.com"}, time.Now(), key)
+			require.NoError(t, err)
+			ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod)
+			extraOpts, err := a.Authorize(ctx, token)
+			require.NoError(t, err)
+
+			var stored bool
+			a.db = &db.MockAuthDB{
+				MStoreCertificate: func(crt *x509.Certificate) error {
+					stored = true
+					return nil
+				},
+			}
+
+			chain, err := a.SignWithContext(ctx, getCSR(t, priv), provisioner.SignOptions{}, extraOpts...)
+			if tt.wantErr != "" {
+				var ee *errs.Error
+				require.ErrorAs(t, err, &ee)
+				assert.Equal(t, http.StatusForbidden, ee.StatusCode())
+				assert.Contains(t, ee.Message(), tt.wantErr)
+				assert.Nil(t, chain)
+				assert.False(t, stored, "certificate failing lints has been stored")
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, chain, 2)
+			assert.True(t, stored)
+		})
+	}
+}
+
+func TestAuthority_SignWithContext_notAfterAlignment(t *testing.T) {
+	_, priv, err := keyutil.GenerateDefaultKeyPair()
+	require.NoError(t, err)
+	key, err := jose.ReadKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	require.NoError(t, err)
+
+	newAuthority := func(t *testing.T, alignment provisioner.ValidityAlignment, duration time.Duration, minDuration ...time.Duration) *Authority {
+		a := testAuthority(t)
+		p, ok := a.provisioners.Load("step-cli:4UELJx8e0aS9m0CH3fZ0EB7D5aUPICb759zALHFejvc")
+		require.True(t, ok)
+		jwk := p.(*provisioner.JWK)
+		jwk.Claims = &provisioner.Claims{
+			DefaultTLSDur: &provisioner.Duration{Duration: duration},
+			MaxTLSDur:     &provisioner.Duration{Duration: duration},
+		}
+		if len(minDuration) > 0 {
+			jwk.Claims.MinTLSDur = &provisioner.Duration{Duration: minDuration[0]}
+		}
+		jwk.Options = &provisioner.Options{
+			X509: &provisioner.X509Options{NotAfterAlignment: alignment},
+		}
+		require.NoError(t, jwk.Init(provisioner.Config{
+			Claims:    config.GlobalProvisionerClaims,
+			Audiences: a.config.GetAudiences(),
+		}))
+		return a
+	}
+	sign := func(t *testing.T, a *Authority, notBefore time.Time) *x509.Certificate {
+		t.Helper()
+		token, err := generateToken("smallstep test", "step-cli", testAudiences.Sign[0], []string{"test.smallstep.com"}, time.Now(), key)
+		require.NoError(t, err)
+		ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod)
+		extraOpts, err := a.Authorize(ctx, token)
+		require.NoError(t, err)
+		chain, err := a.SignWithContext(ctx, getCSR(t, priv), provisioner.SignOptions{
+			NotBefore: provisioner.NewTimeDuration(notBefore),
+		}, extraOpts...)
+		require.NoError(t, err)
+		return chain[0]
+	}
+
+	// Certificates issued at different times of the same day.
+	day := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 1)
+	early, late := day.Add(1*time.Hour), day.Add(22*time.Hour+30*time.Minute)
+	expected := day.AddDate(0, 0, 2)
+
+	t.Run("daily", func(t *testing.T) {
+		a := newAuthority(t, provisioner.ValidityAlignmentDaily, 48*time.Hour)
+		crt1 := sign(t, a, early)
+		crt2 := sign(t, a, late)
+		assert.Equal(t, early, crt1.NotBefore)
+		assert.Equal(t, late, crt2.NotBefore)
+		assert.Equal(t, expected, crt1.NotAfter.UTC())
+		assert.Equal(t, expected, crt2.NotAfter.UTC())
+		assert.LessOrEqual(t, crt2.NotAfter.Sub(crt2.NotBefore), 48*time.Hour)
+	})
+
+	t.Run("weekly", func(t *testing.T) {
+		a := newAuthority(t, provisioner.ValidityAlignmentWeekly, 14*24*time.Hour)
+		crt1 := sign(t, a, early)
+		crt2 := sign(t, a, late)
+		assert.Equal(t, crt1.NotAfter, crt2.NotAfter)
+		assert.Equal(t, time.Monday, crt1.NotAfter.UTC().Weekday())
+		assert.Equal(t, provisioner.ValidityAlignmentWeekly.Align(day.AddDate(0, 0, 14)), crt1.NotAfter.UTC())
+	})
+
+	t.Run("daily below minimum", func(t *testing.T) {
+		// The aligned expirations would be before early and 1h30m after late.
+		a := newAuthority(t, provisioner.ValidityAlignmentDaily, 5*time.Hour, 4*time.Hour)
+		crt1 := sign(t, a, early)
+		crt2 := sign(t, a, late)
+		assert.Equal(t, early.Add(5*time.Hour), crt1.NotAfter.UTC())
+		assert.Equal(t, late.Add(5*time.Hour), crt2.NotAfter.UTC())
+	})
+
+	t.Run("none", func(t *testing.T) {
+		a := newAuthority(t, "", 48*time.Hour)
+		crt1 := sign(t, a, early)
+		crt2 := sign(t, a, late)
+		assert.Equal(t, early.Add(48*time.Hour), crt1.NotAfter.UTC())
+		assert.Equal(t, late.Add(48*time.Hour), crt2.NotAfter.UTC())
+	})
+}
+
+func TestAuthority_SignWithContext_caa(t *testing.T) {
+	_, priv, err := keyutil.GenerateDefaultKeyPair()
+	require.NoError(t, err)
+	key, err := jose.ReadKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	require.NoError(t, err)
+
+	// The resolver is not available, so the CAA records cannot be looked up.
+	ln, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	resolver := ln.LocalAddr().String()
+	ln.Close()
+
+	sign := func(t *testing.T, mode provisioner.CAAFailureMode) error {
+		t.Helper()
+		a := testAuthority(t)
+		p, ok := a.provisioners.Load("step-cli:4UELJx8e0aS9m0CH3fZ0EB7D5aUPICb759zALHFejvc")
+		require.True(t, ok)
+		jwk := p.(*provisioner.JWK)
+		jwk.Options = &provisioner.Options{
+			X509: &provisioner.X509Options{CAA: &provisioner.CAAOptions{
+				IssuerDomainNames: []string{"ca.smallstep.com"},
+				FailureMode:       mode,
+				Resolvers:         []string{resolver},
+				Timeout:           &provisioner.Duration{Duration: time.Second},
+			}},
+		}
+		require.NoError(t, jwk.Init(provisioner.Config{
+			Claims:    config.GlobalProvisionerClaims,
+			Audiences: a.config.GetAudiences(),
+		}))
+
+		token, err := generateToken("smallstep test", "step-cli", testAudiences.Sign[0], []string{"test.smallstep.com"}, time.Now(), key)
+		require.NoError(t, err)
+		ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod)
+		extraOpts, err := a.Authorize(ctx, token)
+		require.NoError(t, err)
+		_, err = a.SignWithContext(ctx, getCSR(t, priv), provisioner.SignOptions{}, extraOpts...)
+		return err
+	}
+
+	t.Run("hard-fail", func(t *testing.T) {
+		err := sign(t, provisioner.CAAHardFail)
+		var sc render.StatusCodedError
+		require.ErrorAs(t, err, &sc)
+		assert.Equal(t, http.StatusForbidden, sc.StatusCode())
+		assert.ErrorContains(t, err, "error looking up caa records")
+	})
+
+	t.Run("soft-fail", func(t *testing.T) {
+		assert.NoError(t, sign(t, provisioner.CAASoftFail))
+	})
+}
@@ -0,0 +1,101 @@
+package authority
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+)
+
+// storeTOFUInstance adds the instance of a token to the registry of trust on
+// first use instances if the token has been used as the first use of the
+// instance. It does nothing if the provisioner or the database do not support
+// it.
+func (a *Authority) storeTOFUInstance(token, tokenID string, prov provisioner.Interface) error {
+	tofu, ok := prov.(provisioner.TrustOnFirstUse)
+	if !ok {
+		return nil
+	}
+	registry, ok := a.db.(db.TOFUInstanceDB)
+	if !ok {
+		return nil
+	}
+	instanceID, err := tofu.GetTOFUInstanceID(token)
+	if err != nil || instanceID == "" || tofu.GetTOFUTokenID(instanceID) != tokenID {
+		return err
+	}
+	if err := registry.StoreTOFUInstance(&db.TOFUInstance{
+		ProvisionerID: prov.GetID(),
+		InstanceID:    instanceID,
+		TokenID:       tokenID,
+		CreatedAt:     time.Now().UTC(),
+	}); err != nil {
+		// Release the token, otherwise the instance would be locked out
+		// without a record in the registry.
+		if _, rerr := registry.DeleteTOFUInstance(tokenID); rerr != nil {
+			log.Printf("error releasing the first use of instance %s: %v", instanceID, rerr)
+		}
+		return err
+	}
+	return nil
+}
+
+// loadTOFUProvisioner returns the provisioner with the given name and the
+// registry of trust on first use instances.
+func (a *Authority) loadTOFUProvisioner(provisionerName string) (provisioner.Interface, provisioner.TrustOnFirstUse, db.TOFUInstanceDB, error) {
+	registry, ok := a.db.(db.TOFUInstanceDB)
+	if !ok {
+		return nil, nil, nil, admin.NewError(admin.ErrorNotImplementedType, "database does not support the trust on first use registry")
+	}
+	p, err := a.LoadProvisionerByName(provisionerName)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	tofu, ok := p.(provisioner.TrustOnFirstUse)
+	if !ok {
+		return nil, nil, nil, admin.NewError(admin.ErrorBadRequestType, "provisioner %s does not support trust on first use", provisionerName)
+	}
+	return p, tofu, registry, nil
+}
+
+// GetTOFUInstances returns the instances that have been issued a certificate
+// by the cloud provisioner with the given name, sorted by creation time.
+func (a *Authority) GetTOFUInstances(_ context.Context, provisionerName string) ([]*db.TOFUInstance, error) {
+	p, _, registry, err := a.loadTOFUProvisioner(provisionerName)
+	if err != nil {
+		return nil, err
+	}
+	instances, err := registry.GetTOFUInstances(p.GetID())
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error retrieving tofu instances for provisioner %s", provisionerName)
+	}
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].CreatedAt.Before(instances[j].CreatedAt)
+	})
+	return instances, nil
+}
+
+// ResetTOFUInstance removes the record of the first use of an instance in the
+// cloud provisioner with the given name, so the instance can get a new
+// certificate. Instances used before the registry existed can also be reset.
+func (a *Authority) ResetTOFUInstance(_ context.Context, provisionerName, instanceID string) error {
+	if instanceID == "" {
+		return admin.NewError(admin.ErrorBadRequestType, "instance id cannot be empty")
+	}
+	_, tofu, registry, err := a.loadTOFUProvisioner(provisionerName)
+	if err != nil {
+		return err
+	}
+	ok, err := registry.DeleteTOFUInstance(tofu.GetTOFUTokenID(instanceID))
+	if err != nil {
+		return admin.WrapErrorISE(err, "error resetting instance %s for provisioner %s", instanceID, provisionerName)
+	}
+	if !ok {
+		return admin.NewError(admin.ErrorNotFoundType, "instance %s has not been used in provisioner %s", instanceID, provisionerName)
+	}
+	return nil
+}
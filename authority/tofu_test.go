@@ -0,0 +1,117 @@
+package authority
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+)
+
+func TestAuthority_TOFUInstances(t *testing.T) {
+	authDB, err := db.New(&db.Config{Type: "badgerv2", DataSource: t.TempDir()})
+	require.NoError(t, err)
+	t.Cleanup(func() { authDB.Shutdown() })
+
+	a := testAuthority(t, WithDatabase(authDB))
+	p := &provisioner.Azure{Type: "Azure", Name: "azure", TenantID: "the-tenant"}
+	require.NoError(t, a.provisioners.Store(p))
+
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	require.NoError(t, err)
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: jwk.Key}, nil)
+	require.NoError(t, err)
+	mirID := "/subscriptions/subscriptionID/resourceGroups/resourceGroup/providers/Microsoft.Compute/virtualMachines/myVM"
+	token, err := jose.Signed(signer).Claims(map[string]any{"xms_mirid": mirID}).CompactSerialize()
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	assertStatusCode := func(t *testing.T, err error, statusCode int) {
+		t.Helper()
+		var sc render.StatusCodedError
+		require.ErrorAs(t, err, &sc)
+		assert.Equal(t, statusCode, sc.StatusCode())
+	}
+
+	// The first use of an instance is added to the registry.
+	require.NoError(t, a.UseToken(token, p))
+	assertStatusCode(t, a.UseToken(token, p), http.StatusUnauthorized)
+	instances, err := a.GetTOFUInstances(ctx, "azure")
+	require.NoError(t, err)
+	require.Len(t, instances, 1)
+	assert.Equal(t, p.GetID(), instances[0].ProvisionerID)
+	assert.Equal(t, mirID, instances[0].InstanceID)
+	assert.Equal(t, p.GetTOFUTokenID(mirID), instances[0].TokenID)
+	assert.False(t, instances[0].CreatedAt.IsZero())
+
+	// A reset instance can get a new certificate.
+	require.NoError(t, a.ResetTOFUInstance(ctx, "azure", mirID))
+	instances, err = a.GetTOFUInstances(ctx, "azure")
+	require.NoError(t, err)
+	assert.Empty(t, instances)
+	require.NoError(t, a.UseToken(token, p))
+
+	// Tokens are not added to the registry if trust on first use is disabled.
+	p.DisableTrustOnFirstUse = true
+	require.NoError(t, a.ResetTOFUInstance(ctx, "azure", mirID))
+	require.NoError(t, a.UseToken(token, p))
+	instances, err = a.GetTOFUInstances(ctx, "azure")
+	require.NoError(t, err)
+	assert.Empty(t, instances)
+
+	_, err = a.GetTOFUInstances(ctx, "missing")
+	assertStatusCode(t, err, http.StatusNotFound)
+	_, err = a.GetTOFUInstances(ctx, "step-cli")
+	assertStatusCode(t, err, http.StatusBadRequest)
+	assertStatusCode(t, a.ResetTOFUInstance(ctx, "azure", ""), http.StatusBadRequest)
+	assertStatusCode(t, a.ResetTOFUInstance(ctx, "step-cli", "i-1234"), http.StatusBadRequest)
+	assertStatusCode(t, a.ResetTOFUInstance(ctx, "azure", "/subscriptions/subscriptionID/unknown"), http.StatusNotFound)
+}
+
+func TestAuthority_storeTOFUInstance_rollback(t *testing.T) {
+	p := &provisioner.Azure{Type: "Azure", Name: "azure", TenantID: "the-tenant"}
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	require.NoError(t, err)
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: jwk.Key}, nil)
+	require.NoError(t, err)
+	mirID := "/subscriptions/subscriptionID/resourceGroups/resourceGroup/providers/Microsoft.Compute/virtualMachines/myVM"
+	token, err := jose.Signed(signer).Claims(map[string]any{"xms_mirid": mirID}).CompactSerialize()
+	require.NoError(t, err)
+
+	var released string
+	a := testAuthority(t, WithDatabase(&db.MockAuthDB{
+		MUseToken: func(id, tok string) (bool, error) {
+			return true, nil
+		},
+		MStoreTOFUInstance: func(ti *db.TOFUInstance) error {
+			return errors.New("force")
+		},
+		MDeleteTOFUInstance: func(tokenID string) (bool, error) {
+			released = tokenID
+			return true, nil
+		},
+	}))
+
+	// The used token is released if the instance cannot be stored.
+	err = a.UseToken(token, p)
+	var sc render.StatusCodedError
+	require.ErrorAs(t, err, &sc)
+	assert.Equal(t, http.StatusInternalServerError, sc.StatusCode())
+	assert.Equal(t, p.GetTOFUTokenID(mirID), released)
+}
+
+func TestAuthority_TOFUInstances_notSupported(t *testing.T) {
+	a := testAuthority(t)
+	a.db = &struct{ db.AuthDB }{&db.MockAuthDB{}}
+	_, err := a.GetTOFUInstances(context.Background(), "azure")
+	var sc render.StatusCodedError
+	require.ErrorAs(t, err, &sc)
+	assert.Equal(t, http.StatusNotImplemented, sc.StatusCode())
+}
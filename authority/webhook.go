@@ -2,7 +2,14 @@ package authority
 
 import (
 	"context"
+	"crypto/x509"
+	"log"
 
+	"go.step.sm/crypto/x509util"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/middleware/requestid"
 	"github.com/smallstep/certificates/webhook"
 )
 
@@ -10,3 +17,68 @@ type webhookController interface {
 	Enrich(context.Context, *webhook.RequestBody) error
 	Authorize(context.Context, *webhook.RequestBody) error
 }
+
+// sshCertificateWebhookModifier is implemented by webhook controllers that can
+// modify an SSH certificate with the changes returned by enriching webhooks.
+type sshCertificateWebhookModifier interface {
+	ModifySSHCertificate(*ssh.Certificate) error
+}
+
+// notifyCertificateIssued sends the certificate issued event to the notifying
+// webhooks of the provisioner. The csr is nil on renewals. SCEP provisioners
+// are skipped because they send their own notifications.
+func (a *Authority) notifyCertificateIssued(ctx context.Context, prov provisioner.Interface, csr *x509.CertificateRequest, chain []*x509.Certificate) {
+	if wp, ok := prov.(*wrappedProvisioner); ok {
+		prov = wp.Interface
+	}
+	p, ok := prov.(interface{ GetOptions() *provisioner.Options })
+	if !ok || prov.GetType() == provisioner.TypeSCEP {
+		return
+	}
+	webhooks := p.GetOptions().GetWebhooks()
+	if len(webhooks) == 0 || len(chain) == 0 {
+		return
+	}
+
+	leaf := chain[0]
+	cert, err := x509util.NewCertificateFromX509(leaf)
+	if err != nil {
+		log.Printf("error creating certificate issued notification: %v", err)
+		return
+	}
+	requestID, _ := requestid.FromContext(ctx)
+	opts := []webhook.RequestBodyOption{
+		webhook.WithX509Certificate(cert, leaf),
+		webhook.WithCertificateIssued(chain, prov.GetType().String(), requestID),
+	}
+	if csr != nil {
+		opts = append(opts, webhook.WithX509CertificateRequest(csr))
+	}
+	req, err := webhook.NewRequestBody(opts...)
+	if err != nil {
+		log.Printf("error creating certificate issued notification: %v", err)
+		return
+	}
+	req.X509Certificate.Raw = leaf.Raw
+	req.ProvisionerName = prov.GetName()
+
+	a.getWebhookNotifier().Notify(ctx, webhooks, req)
+}
+
+// getWebhookNotifier returns the notifier of the notifying webhooks. It
+// returns nil after the authority is shut down.
+func (a *Authority) getWebhookNotifier() *provisioner.WebhookNotifier {
+	a.webhookNotifierOnce.Do(func() {
+		a.webhookNotifier = provisioner.NewWebhookNotifier(a.webhookClient)
+	})
+	return a.webhookNotifier
+}
+
+// stopWebhookNotifier stops the notifier of the notifying webhooks, waiting
+// for the queued notifications, and prevents the creation of a new one.
+func (a *Authority) stopWebhookNotifier() {
+	a.webhookNotifierOnce.Do(func() {})
+	if a.webhookNotifier != nil {
+		a.webhookNotifier.Stop()
+	}
+}
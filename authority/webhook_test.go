@@ -2,16 +2,30 @@ package authority
 
 import (
 	"context"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/pemutil"
+	"go.step.sm/linkedca"
+	"golang.org/x/crypto/ssh"
 
 	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/webhook"
 )
 
 type mockWebhookController struct {
-	enrichErr    error
-	authorizeErr error
-	templateData provisioner.WebhookSetter
-	respData     map[string]any
+	enrichErr     error
+	authorizeErr  error
+	modifySSHErr  error
+	sshPrincipals []string
+	templateData  provisioner.WebhookSetter
+	respData      map[string]any
 }
 
 var _ webhookController = &mockWebhookController{}
@@ -27,3 +41,64 @@ func (wc *mockWebhookController) Enrich(context.Context, *webhook.RequestBody) e
 func (wc *mockWebhookController) Authorize(context.Context, *webhook.RequestBody) error {
 	return wc.authorizeErr
 }
+
+func (wc *mockWebhookController) ModifySSHCertificate(cert *ssh.Certificate) error {
+	if wc.sshPrincipals != nil {
+		cert.ValidPrincipals = wc.sshPrincipals
+	}
+	return wc.modifySSHErr
+}
+
+func TestAuthority_notifyCertificateIssued(t *testing.T) {
+	chain, err := pemutil.ReadCertificateBundle("testdata/certs/intermediate_ca.crt")
+	require.NoError(t, err)
+	csr, err := pemutil.ReadCertificateRequest("testdata/certs/foo.csr")
+	require.NoError(t, err)
+
+	received := make(chan *webhook.RequestBody, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := new(webhook.RequestBody)
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(body))
+		received <- body
+		w.Write([]byte(`{}`))
+	}))
+	defer ts.Close()
+
+	newProvisioner := func(typ string) provisioner.Interface {
+		options := &provisioner.Options{Webhooks: []*provisioner.Webhook{
+			{Name: "inventory", URL: ts.URL, Kind: linkedca.Webhook_NOTIFYING.String()},
+		}}
+		if typ == "SCEP" {
+			return &provisioner.SCEP{Type: typ, Name: "scep", Options: options}
+		}
+		return &provisioner.JWK{Type: typ, Name: "jwk", Options: options}
+	}
+
+	a := &Authority{}
+	t.Cleanup(a.stopWebhookNotifier)
+	a.notifyCertificateIssued(context.Background(), wrapProvisioner(newProvisioner("JWK"), nil), csr, chain)
+	select {
+	case body := <-received:
+		assert.Equal(t, webhook.EventCertificateIssued, body.Event)
+		assert.Equal(t, "jwk", body.ProvisionerName)
+		assert.Equal(t, "JWK", body.CertificateIssued.ProvisionerType)
+		assert.Equal(t, chain[0].SerialNumber.String(), body.CertificateIssued.SerialNumber)
+		assert.Equal(t, chain[0].Raw, body.X509Certificate.Raw)
+		assert.Equal(t, csr.Raw, body.X509CertificateRequest.Raw)
+		got, err := pemutil.ParseCertificateBundle([]byte(body.CertificateIssued.PEM))
+		require.NoError(t, err)
+		assert.Equal(t, chain, got)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for notification")
+	}
+
+	// SCEP provisioners and missing provisioners do not send notifications.
+	a.notifyCertificateIssued(context.Background(), newProvisioner("SCEP"), csr, chain)
+	a.notifyCertificateIssued(context.Background(), nil, csr, chain)
+	a.notifyCertificateIssued(context.Background(), newProvisioner("JWK"), nil, []*x509.Certificate{})
+	select {
+	case <-received:
+		t.Fatal("unexpected notification")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -714,6 +714,106 @@ retry:
 	return nil
 }
 
+// UpdateExternalAccountKey performs the PUT /admin/acme/eab/{prov}/{key_id} request to the CA.
+func (c *AdminClient) UpdateExternalAccountKey(provisionerName, keyID string, eakRequest *adminAPI.UpdateExternalAccountKeyRequest) (*linkedca.EABKey, error) {
+	var retried bool
+	body, err := json.Marshal(eakRequest)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "error marshaling request")
+	}
+	u := c.endpoint.ResolveReference(&url.URL{Path: path.Join(adminURLPrefix, "acme/eab", provisionerName, keyID)})
+	tok, err := c.generateAdminToken(u)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error generating admin token")
+	}
+	req, err := http.NewRequest("PUT", u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrapf(err, "create PUT %s request failed", u)
+	}
+	req.Header.Add("Authorization", tok)
+retry:
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, clientError(err)
+	}
+	if resp.StatusCode >= 400 {
+		if !retried && c.retryOnError(resp) {
+			retried = true
+			goto retry
+		}
+		return nil, readAdminError(resp.Body)
+	}
+	var eabKey = new(linkedca.EABKey)
+	if err := readProtoJSON(resp.Body, eabKey); err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", u)
+	}
+	return eabKey, nil
+}
+
+// RevokeExternalAccountKey performs the POST /admin/acme/eab/{prov}/{key_id}/revoke request to the CA.
+func (c *AdminClient) RevokeExternalAccountKey(provisionerName, keyID string) (*adminAPI.ExternalAccountKeyStatsResponse, error) {
+	var retried bool
+	u := c.endpoint.ResolveReference(&url.URL{Path: path.Join(adminURLPrefix, "acme/eab", provisionerName, keyID, "revoke")})
+	tok, err := c.generateAdminToken(u)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error generating admin token")
+	}
+	req, err := http.NewRequest("POST", u.String(), http.NoBody)
+	if err != nil {
+		return nil, errors.Wrapf(err, "create POST %s request failed", u)
+	}
+	req.Header.Add("Authorization", tok)
+retry:
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, clientError(err)
+	}
+	if resp.StatusCode >= 400 {
+		if !retried && c.retryOnError(resp) {
+			retried = true
+			goto retry
+		}
+		return nil, readAdminError(resp.Body)
+	}
+	var body = new(adminAPI.ExternalAccountKeyStatsResponse)
+	if err := readJSON(resp.Body, body); err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", u)
+	}
+	return body, nil
+}
+
+// GetExternalAccountKeyStats performs the GET /admin/acme/eab/{prov}/{key_id}/stats request to the CA.
+func (c *AdminClient) GetExternalAccountKeyStats(provisionerName, keyID string) (*adminAPI.ExternalAccountKeyStatsResponse, error) {
+	var retried bool
+	u := c.endpoint.ResolveReference(&url.URL{Path: path.Join(adminURLPrefix, "acme/eab", provisionerName, keyID, "stats")})
+	tok, err := c.generateAdminToken(u)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error generating admin token")
+	}
+	req, err := http.NewRequest("GET", u.String(), http.NoBody)
+	if err != nil {
+		return nil, errors.Wrapf(err, "create GET %s request failed", u)
+	}
+	req.Header.Add("Authorization", tok)
+retry:
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, clientError(err)
+	}
+	if resp.StatusCode >= 400 {
+		if !retried && c.retryOnError(resp) {
+			retried = true
+			goto retry
+		}
+		return nil, readAdminError(resp.Body)
+	}
+	var body = new(adminAPI.ExternalAccountKeyStatsResponse)
+	if err := readJSON(resp.Body, body); err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", u)
+	}
+	return body, nil
+}
+
 func (c *AdminClient) GetAuthorityPolicy() (*linkedca.Policy, error) {
 	var retried bool
 	u := c.endpoint.ResolveReference(&url.URL{Path: path.Join(adminURLPrefix, "policy")})
@@ -1196,6 +1296,62 @@ retry:
 	return webhook, nil
 }
 
+// RotateProvisionerWebhookAuth replaces the bearer token or basic auth
+// credentials of a provisioner webhook. If the auth in wh is not set, new
+// random credentials are generated and returned.
+func (c *AdminClient) RotateProvisionerWebhookAuth(provisionerName, webhookName string, wh *linkedca.Webhook) (*linkedca.Webhook, error) {
+	return c.rotateProvisionerWebhookAuth(provisionerName, webhookName, wh, false)
+}
+
+// StageProvisionerWebhookAuth returns new bearer token or basic auth
+// credentials of a provisioner webhook without using them. The returned
+// credentials can be added to the webhook server, and then used with
+// RotateProvisionerWebhookAuth.
+func (c *AdminClient) StageProvisionerWebhookAuth(provisionerName, webhookName string, wh *linkedca.Webhook) (*linkedca.Webhook, error) {
+	return c.rotateProvisionerWebhookAuth(provisionerName, webhookName, wh, true)
+}
+
+func (c *AdminClient) rotateProvisionerWebhookAuth(provisionerName, webhookName string, wh *linkedca.Webhook, stage bool) (*linkedca.Webhook, error) {
+	var retried bool
+	if wh == nil {
+		wh = new(linkedca.Webhook)
+	}
+	body, err := protojson.Marshal(wh)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling request: %w", err)
+	}
+	u := c.endpoint.ResolveReference(&url.URL{Path: path.Join(adminURLPrefix, "provisioners", provisionerName, "webhooks", webhookName, "rotate")})
+	if stage {
+		u.RawQuery = url.Values{"stage": []string{"true"}}.Encode()
+	}
+	tok, err := c.generateAdminToken(u)
+	if err != nil {
+		return nil, fmt.Errorf("error generating admin token: %w", err)
+	}
+retry:
+	req, err := http.NewRequest(http.MethodPost, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("creating POST %s request failed: %w", u, err)
+	}
+	req.Header.Add("Authorization", tok)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, clientError(err)
+	}
+	if resp.StatusCode >= 400 {
+		if !retried && c.retryOnError(resp) {
+			retried = true
+			goto retry
+		}
+		return nil, readAdminError(resp.Body)
+	}
+	var webhook = new(linkedca.Webhook)
+	if err := readProtoJSON(resp.Body, webhook); err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", u, err)
+	}
+	return webhook, nil
+}
+
 func (c *AdminClient) DeleteProvisionerWebhook(provisionerName, webhookName string) error {
 	var retried bool
 	u := c.endpoint.ResolveReference(&url.URL{Path: path.Join(adminURLPrefix, "provisioners", provisionerName, "webhooks", webhookName)})
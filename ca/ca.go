@@ -26,10 +26,12 @@ import (
 	"github.com/smallstep/certificates/authority/admin"
 	adminAPI "github.com/smallstep/certificates/authority/admin/api"
 	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/cas/apiv1"
 	"github.com/smallstep/certificates/db"
 	"github.com/smallstep/certificates/internal/metrix"
 	"github.com/smallstep/certificates/logging"
+	"github.com/smallstep/certificates/middleware/clientinfo"
 	"github.com/smallstep/certificates/middleware/requestid"
 	"github.com/smallstep/certificates/monitoring"
 	"github.com/smallstep/certificates/scep"
@@ -51,6 +53,8 @@ type options struct {
 	database        db.AuthDB
 	x509CAService   apiv1.CertificateAuthorityService
 	tlsConfig       *tls.Config
+	tenantDatabases map[string]db.AuthDB
+	reloader        *CA
 }
 
 func (o *options) apply(opts []Option) {
@@ -116,6 +120,21 @@ func WithDatabase(d db.AuthDB) Option {
 	}
 }
 
+// withTenantDatabases sets the databases of the tenants, used on reloads.
+func withTenantDatabases(m map[string]db.AuthDB) Option {
+	return func(o *options) {
+		o.tenantDatabases = m
+	}
+}
+
+// withReloader sets the CA that reloads the configuration requested using the
+// admin API, the one running the servers.
+func withReloader(ca *CA) Option {
+	return func(o *options) {
+		o.reloader = ca
+	}
+}
+
 // WithTLSConfig sets the TLS configuration to be used by the HTTP(s) server
 // spun by step-ca.
 func WithTLSConfig(t *tls.Config) Option {
@@ -149,6 +168,9 @@ type CA struct {
 	opts        *options
 	renewer     *TLSRenewer
 	compactStop chan struct{}
+	acmeJanitor *acme.Janitor
+	tenants     *tenantRouter
+	reloadMutex sync.Mutex
 }
 
 // New creates and initializes the CA with the given configuration and options.
@@ -197,12 +219,28 @@ func (ca *CA) Init(cfg *config.Config) (*CA, error) {
 	webhookTransport := http.DefaultTransport.(*http.Transport).Clone()
 	opts = append(opts, authority.WithWebhookClient(&http.Client{Transport: webhookTransport}))
 
+	// The configuration is always reloaded by the CA running the servers.
+	reloader := ca
+	if ca.opts.reloader != nil {
+		reloader = ca.opts.reloader
+	}
+	opts = append(opts, authority.WithReloadFunc(reloader.reloadConfig))
+
 	auth, err := authority.New(cfg, opts...)
 	if err != nil {
 		return nil, err
 	}
 	ca.auth = auth
 
+	// Initialize the additional authorities served by the CA
+	var tenants *tenantRouter
+	if len(cfg.Tenants) > 0 {
+		if tenants, err = ca.newTenantRouter(cfg, auth); err != nil {
+			return nil, err
+		}
+		ca.tenants = tenants
+	}
+
 	var tlsConfig *tls.Config
 	var clientTLSConfig *tls.Config
 	if ca.opts.tlsConfig != nil {
@@ -217,6 +255,12 @@ func (ca *CA) Init(cfg *config.Config) (*CA, error) {
 		if err != nil {
 			return nil, err
 		}
+		// Serve the tenants selected by the SNI with their own certificate
+		// and client CAs.
+		if tenants != nil {
+			tenants.addClientCAs(tlsConfig.ClientCAs)
+			tlsConfig.GetConfigForClient = tenants.GetConfigForClient(tlsConfig)
+		}
 	}
 
 	webhookTransport.TLSClientConfig = clientTLSConfig
@@ -243,15 +287,10 @@ func (ca *CA) Init(cfg *config.Config) (*CA, error) {
 	insecureMux.Get("/1.0/crl", api.CRL)
 
 	// Add ACME api endpoints in /acme and /1.0/acme
-	dns := cfg.DNSNames[0]
-	u, err := url.Parse("https://" + cfg.Address)
+	dns, err := linkerDNS(cfg)
 	if err != nil {
 		return nil, err
 	}
-	port := u.Port()
-	if port != "" && port != "443" {
-		dns = fmt.Sprintf("%s:%s", dns, port)
-	}
 
 	// ACME Router is only available if we have a database.
 	var acmeDB acme.DB
@@ -262,6 +301,9 @@ func (ca *CA) Init(cfg *config.Config) (*CA, error) {
 			return nil, errors.Wrap(err, "error configuring ACME DB interface")
 		}
 		acmeLinker = acme.NewLinker(dns, "acme")
+		ca.acmeJanitor = acme.NewJanitor(acmeDB, func() []acme.Provisioner {
+			return acmeProvisioners(auth)
+		})
 		mux.Route("/acme", func(r chi.Router) {
 			acmeAPI.Route(r)
 		})
@@ -315,6 +357,11 @@ func (ca *CA) Init(cfg *config.Config) (*CA, error) {
 		})
 	}
 
+	// Route the requests of the tenants
+	if tenants != nil {
+		handler = tenants.Middleware(handler)
+	}
+
 	// helpful routine for logging all routes
 	//dumpRoutes(mux)
 	//dumpRoutes(insecureMux)
@@ -341,6 +388,10 @@ func (ca *CA) Init(cfg *config.Config) (*CA, error) {
 		insecureHandler = logger.Middleware(insecureHandler)
 	}
 
+	// add the client address and user agent, used in the provisioner conditions
+	handler = clientinfo.Middleware(handler)
+	insecureHandler = clientinfo.Middleware(insecureHandler)
+
 	// always use request ID middleware; traceHeader is provided for backwards compatibility (for now)
 	handler = requestid.New(legacyTraceHeader).Middleware(handler)
 	insecureHandler = requestid.New(legacyTraceHeader).Middleware(insecureHandler)
@@ -393,9 +444,30 @@ func (ca *CA) shouldServeInsecureServer() bool {
 	}
 }
 
+// linkerDNS returns the host used in the ACME links, the port is only added
+// if it's not the default one.
+func linkerDNS(cfg *config.Config) (string, error) {
+	dns := cfg.DNSNames[0]
+	u, err := url.Parse("https://" + cfg.Address)
+	if err != nil {
+		return "", err
+	}
+	port := u.Port()
+	if port != "" && port != "443" {
+		dns = fmt.Sprintf("%s:%s", dns, port)
+	}
+	return dns, nil
+}
+
 // buildContext builds the server base context.
 func buildContext(a *authority.Authority, scepAuthority *scep.Authority, acmeDB acme.DB, acmeLinker acme.Linker) context.Context {
-	ctx := authority.NewContext(context.Background(), a)
+	return newAuthorityContext(context.Background(), a, scepAuthority, acmeDB, acmeLinker)
+}
+
+// newAuthorityContext returns a new context with the authority and the
+// databases used by the handlers.
+func newAuthorityContext(ctx context.Context, a *authority.Authority, scepAuthority *scep.Authority, acmeDB acme.DB, acmeLinker acme.Linker) context.Context {
+	ctx = authority.NewContext(ctx, a)
 	if authDB := a.GetDatabase(); authDB != nil {
 		ctx = db.NewContext(ctx, authDB)
 	}
@@ -437,6 +509,14 @@ func (ca *CA) Run() error {
 		for _, crt := range authorityInfo.RootX509Certs {
 			log.Printf("X.509 Root Fingerprint: %s", x509util.Fingerprint(crt))
 		}
+		if ca.tenants != nil {
+			for _, t := range ca.tenants.tenants {
+				if t.prefix != "" {
+					log.Printf("Tenant %s is available at %s/%s", t.name, baseURL, t.prefix)
+				}
+				log.Printf("Tenant %s hostnames: %s", t.name, strings.Join(t.dnsNames, ", "))
+			}
+		}
 		if authorityInfo.SSHCAHostPublicKey != nil {
 			log.Printf("SSH Host CA Key: %s\n", bytes.TrimSpace(authorityInfo.SSHCAHostPublicKey))
 		}
@@ -451,6 +531,18 @@ func (ca *CA) Run() error {
 		ca.runCompactJob()
 	}()
 
+	if ca.acmeJanitor != nil {
+		wg.Add(1)
+		go func(j *acme.Janitor) {
+			defer wg.Done()
+			j.Run()
+		}(ca.acmeJanitor)
+	}
+
+	if ca.tenants != nil {
+		ca.tenants.run()
+	}
+
 	if ca.insecureSrv != nil {
 		wg.Add(1)
 		go func() {
@@ -498,6 +590,9 @@ func (ca *CA) Run() error {
 // Stop stops the CA calling to the server Shutdown method.
 func (ca *CA) Stop() error {
 	close(ca.compactStop)
+	if ca.acmeJanitor != nil {
+		ca.acmeJanitor.Stop()
+	}
 	if ca.renewer != nil {
 		ca.renewer.Stop()
 	}
@@ -505,6 +600,23 @@ func (ca *CA) Stop() error {
 	if err := ca.auth.Shutdown(); err != nil {
 		log.Printf("error stopping ca.Authority: %+v\n", err)
 	}
+	if ca.tenants != nil {
+		ca.tenants.stop()
+		for _, t := range ca.tenants.tenants {
+			if err := t.auth.Shutdown(); err != nil {
+				log.Printf("error stopping tenant %s: %+v\n", t.name, err)
+			}
+		}
+	}
+	// The plugin connections and the webhook key managers are shared by the
+	// main authority and the tenants, so they are closed once all of them have
+	// been stopped.
+	if err := provisioner.ClosePluginConnections(); err != nil {
+		log.Printf("error closing the plugin connections: %v", err)
+	}
+	if err := provisioner.CloseWebhookKeyManagers(); err != nil {
+		log.Printf("error closing the webhook key managers: %v", err)
+	}
 	var insecureShutdownErr error
 	if ca.insecureSrv != nil {
 		insecureShutdownErr = ca.insecureSrv.Shutdown()
@@ -521,23 +633,95 @@ func (ca *CA) Stop() error {
 // Reload reloads the configuration of the CA and calls to the server Reload
 // method.
 func (ca *CA) Reload() error {
-	cfg, err := config.LoadConfiguration(ca.opts.configFile)
+	ca.reloadMutex.Lock()
+	defer ca.reloadMutex.Unlock()
+
+	cfg, changes, err := ca.loadReloadConfig()
+	if err != nil {
+		return err
+	}
+	for _, c := range changes {
+		log.Printf("Reloading configuration: %s", c)
+	}
+
+	newCA, err := ca.newReloadCA(cfg)
 	if err != nil {
-		return errors.Wrap(err, "error reloading ca configuration")
+		return err
+	}
+	return ca.reload(newCA)
+}
+
+// reloadConfig implements the authority.ReloadFunc used by the admin API. It
+// validates the configuration file and returns the changes. The CA is
+// reloaded after returning, as the reload waits for the active connections,
+// including the one requesting the reload.
+func (ca *CA) reloadConfig(_ context.Context, dryRun bool) ([]config.Change, error) {
+	if ca.opts.configFile == "" {
+		return nil, admin.NewError(admin.ErrorNotImplementedType, "configuration reload requires a configuration file")
+	}
+
+	ca.reloadMutex.Lock()
+	cfg, changes, err := ca.loadReloadConfig()
+	if err != nil {
+		ca.reloadMutex.Unlock()
+		return nil, admin.WrapError(admin.ErrorBadRequestType, err, "error validating configuration")
+	}
+
+	// The new CA is also initialized in a dry run, so the validation catches
+	// the same errors as the reload.
+	newCA, err := ca.newReloadCA(cfg)
+	if err != nil {
+		ca.reloadMutex.Unlock()
+		return nil, admin.WrapError(admin.ErrorBadRequestType, err, "error initializing configuration")
+	}
+	if dryRun {
+		newCA.discard(ca)
+		ca.reloadMutex.Unlock()
+		return changes, nil
 	}
+	go func() {
+		defer ca.reloadMutex.Unlock()
+		for _, c := range changes {
+			log.Printf("Reloading configuration: %s", c)
+		}
+		if err := ca.reload(newCA); err != nil {
+			log.Printf("error reloading server: %+v", err)
+		}
+	}()
+	return changes, nil
+}
 
-	logContinue := func(reason string) {
-		log.Println(reason)
-		log.Println("Continuing to run with the original configuration.")
-		log.Println("You can force a restart by sending a SIGTERM signal and then restarting the step-ca.")
+// loadReloadConfig loads the configuration file and checks that it can be
+// used to reload the CA. It returns the new configuration and the changes
+// from the running one.
+func (ca *CA) loadReloadConfig() (*config.Config, []config.Change, error) {
+	cfg, err := config.LoadConfiguration(ca.opts.configFile)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error reloading ca configuration")
 	}
 
 	// Do not allow reload if the database configuration has changed.
 	if !reflect.DeepEqual(ca.config.DB, cfg.DB) {
-		logContinue("Reload failed because the database configuration has changed.")
-		return errors.New("error reloading ca: database configuration cannot change")
+		logReloadContinue("Reload failed because the database configuration has changed.")
+		return nil, nil, errors.New("error reloading ca: database configuration cannot change")
 	}
 
+	changes, err := config.Diff(ca.config, cfg)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error reloading ca configuration")
+	}
+	return cfg, changes, nil
+}
+
+// logReloadContinue logs the reason of a failed reload.
+func logReloadContinue(reason string) {
+	log.Println(reason)
+	log.Println("Continuing to run with the original configuration.")
+	log.Println("You can force a restart by sending a SIGTERM signal and then restarting the step-ca.")
+}
+
+// newReloadCA initializes the CA that replaces the running one.
+func (ca *CA) newReloadCA(cfg *config.Config) (*CA, error) {
 	newCA, err := New(cfg,
 		WithPassword(ca.opts.password),
 		WithSSHHostPassword(ca.opts.sshHostPassword),
@@ -547,28 +731,36 @@ func (ca *CA) Reload() error {
 		WithQuiet(ca.opts.quiet),
 		WithConfigFile(ca.opts.configFile),
 		WithDatabase(ca.auth.GetDatabase()),
+		withTenantDatabases(ca.tenantDatabases()),
+		withReloader(ca),
 	)
 	if err != nil {
-		logContinue("Reload failed because the CA with new configuration could not be initialized.")
-		return errors.Wrap(err, "error reloading ca")
+		logReloadContinue("Reload failed because the CA with new configuration could not be initialized.")
+		return nil, errors.Wrap(err, "error reloading ca")
 	}
+	return newCA, nil
+}
 
+// reload replaces the servers and the internal state of the CA with the ones
+// of the given CA.
+func (ca *CA) reload(newCA *CA) error {
+	var err error
 	if ca.insecureSrv != nil {
 		if err = ca.insecureSrv.Reload(newCA.insecureSrv); err != nil {
-			logContinue("Reload failed because insecure server could not be replaced.")
+			logReloadContinue("Reload failed because insecure server could not be replaced.")
 			return errors.Wrap(err, "error reloading insecure server")
 		}
 	}
 
 	if ca.metricsSrv != nil {
 		if err = ca.metricsSrv.Reload(newCA.metricsSrv); err != nil {
-			logContinue("Reload failed because metrics server could not be replaced.")
+			logReloadContinue("Reload failed because metrics server could not be replaced.")
 			return errors.Wrap(err, "error reloading metrics server")
 		}
 	}
 
 	if err = ca.srv.Reload(newCA.srv); err != nil {
-		logContinue("Reload failed because server could not be replaced.")
+		logReloadContinue("Reload failed because server could not be replaced.")
 		return errors.Wrap(err, "error reloading server")
 	}
 
@@ -585,9 +777,65 @@ func (ca *CA) Reload() error {
 	ca.config = newCA.config
 	ca.opts = newCA.opts
 	ca.renewer = newCA.renewer
+
+	// Replace the ACME janitor with the one using the new provisioners.
+	if ca.acmeJanitor != nil {
+		ca.acmeJanitor.Stop()
+	}
+	ca.acmeJanitor = newCA.acmeJanitor
+	if ca.acmeJanitor != nil {
+		go ca.acmeJanitor.Run()
+	}
+
+	// Replace the tenants, their databases are reused by the new ones, and
+	// closed if the tenant has been removed.
+	if ca.tenants != nil {
+		ca.tenants.stop()
+		for _, t := range ca.tenants.tenants {
+			if newCA.tenants.has(t.name) {
+				t.auth.CloseForReload()
+			} else {
+				t.close()
+			}
+		}
+	}
+	ca.tenants = newCA.tenants
+	if ca.tenants != nil {
+		ca.tenants.run()
+	}
 	return nil
 }
 
+// discard releases the internal resources of a CA initialized for a reload
+// that does not replace the running CA. The databases are shared with the
+// running CA, so only the ones of new tenants are closed. The state shared by
+// all the authorities of the process, like the plugin connections, is kept
+// open.
+func (ca *CA) discard(running *CA) {
+	if ca.renewer != nil {
+		ca.renewer.Stop()
+	}
+	ca.auth.CloseForReload()
+	if ca.tenants != nil {
+		ca.tenants.stop()
+		for _, t := range ca.tenants.tenants {
+			if running.tenants.has(t.name) {
+				t.auth.CloseForReload()
+			} else {
+				t.close()
+			}
+		}
+	}
+}
+
+// tenantDatabases returns the databases of the current tenants.
+func (ca *CA) tenantDatabases() map[string]db.AuthDB {
+	if ca.tenants == nil {
+		return nil
+	}
+	return ca.tenants.databases()
+}
+
 // get TLSConfig returns separate TLSConfigs for server and client with the
 // same self-renewing certificate.
 func (ca *CA) getTLSConfig(auth *authority.Authority) (*tls.Config, *tls.Config, error) {
@@ -723,6 +971,29 @@ func (ca *CA) runCompactJob() {
 	}
 }
 
+// acmeProvisioners returns the ACME provisioners of the authority.
+func acmeProvisioners(auth *authority.Authority) []acme.Provisioner {
+	var (
+		provs  []acme.Provisioner
+		cursor string
+	)
+	for {
+		list, next, err := auth.GetProvisioners(cursor, provisioner.DefaultProvisionersMax)
+		if err != nil {
+			return provs
+		}
+		for _, p := range list {
+			if p, ok := p.(*provisioner.ACME); ok {
+				provs = append(provs, p)
+			}
+		}
+		if next == "" {
+			return provs
+		}
+		cursor = next
+	}
+}
+
 // runCompact executes the compact job until it returns an error.
 func runCompact(c nosql.Compactor) {
 	for err := error(nil); err == nil; {
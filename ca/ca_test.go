@@ -13,9 +13,11 @@ import (
 	"encoding/json"
 	"encoding/pem"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -23,14 +25,19 @@ import (
 	"github.com/pkg/errors"
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/api/render"
 	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/authority/config"
 	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/authority/provisioner/plugin"
 	"github.com/smallstep/certificates/errs"
 	"go.step.sm/crypto/jose"
 	"go.step.sm/crypto/keyutil"
+	kmsapi "go.step.sm/crypto/kms/apiv1"
 	"go.step.sm/crypto/pemutil"
 	"go.step.sm/crypto/randutil"
 	"go.step.sm/crypto/x509util"
+	"google.golang.org/grpc"
 )
 
 type ClosingBuffer struct {
@@ -698,3 +705,187 @@ func TestCARenew(t *testing.T) {
 		})
 	}
 }
+
+func TestCAReloadConfig(t *testing.T) {
+	b, err := os.ReadFile("testdata/ca.json")
+	assert.FatalError(t, err)
+	configFile := filepath.Join(t.TempDir(), "ca.json")
+	assert.FatalError(t, os.WriteFile(configFile, b, 0600))
+
+	cfg, err := config.LoadConfiguration(configFile)
+	assert.FatalError(t, err)
+	ca, err := New(cfg, WithConfigFile(configFile))
+	assert.FatalError(t, err)
+	ctx := context.Background()
+
+	// No changes
+	changes, err := ca.auth.ReloadConfig(ctx, true)
+	assert.FatalError(t, err)
+	assert.Len(t, 0, changes)
+
+	// Changes are only reported in a dry run
+	var m map[string]any
+	assert.FatalError(t, json.Unmarshal(b, &m))
+	m["address"] = "127.0.0.1:8443"
+	m["dnsNames"] = []string{"127.0.0.1", "ca.smallstep.com"}
+	modified, err := json.Marshal(m)
+	assert.FatalError(t, err)
+	assert.FatalError(t, os.WriteFile(configFile, modified, 0600))
+	changes, err = ca.auth.ReloadConfig(ctx, true)
+	assert.FatalError(t, err)
+	assert.Equals(t, []config.Change{
+		{Path: "address", Type: config.ChangeModified},
+		{Path: "dnsNames", Type: config.ChangeModified},
+	}, changes)
+	assert.Equals(t, "127.0.0.1:0", ca.config.Address)
+
+	// Invalid configuration
+	assert.FatalError(t, os.WriteFile(configFile, []byte("{"), 0600))
+	_, err = ca.auth.ReloadConfig(ctx, true)
+	var sc render.StatusCodedError
+	if assert.True(t, errors.As(err, &sc)) {
+		assert.Equals(t, http.StatusBadRequest, sc.StatusCode())
+	}
+
+	// Configuration that cannot initialize the CA
+	m["key"] = filepath.Join(t.TempDir(), "missing_key")
+	modified, err = json.Marshal(m)
+	assert.FatalError(t, err)
+	assert.FatalError(t, os.WriteFile(configFile, modified, 0600))
+	_, err = ca.auth.ReloadConfig(ctx, true)
+	if assert.True(t, errors.As(err, &sc)) {
+		assert.Equals(t, http.StatusBadRequest, sc.StatusCode())
+	}
+	m["key"] = cfg.IntermediateKey
+
+	// Database configuration changes are not allowed
+	m["db"] = map[string]any{"type": "badgerv2", "dataSource": t.TempDir()}
+	modified, err = json.Marshal(m)
+	assert.FatalError(t, err)
+	assert.FatalError(t, os.WriteFile(configFile, modified, 0600))
+	_, err = ca.auth.ReloadConfig(ctx, true)
+	if assert.True(t, errors.As(err, &sc)) {
+		assert.Equals(t, http.StatusBadRequest, sc.StatusCode())
+	}
+
+	// Without configuration file
+	ca, err = New(cfg)
+	assert.FatalError(t, err)
+	_, err = ca.auth.ReloadConfig(ctx, true)
+	if assert.True(t, errors.As(err, &sc)) {
+		assert.Equals(t, http.StatusNotImplemented, sc.StatusCode())
+	}
+}
+
+type testPluginServer struct {
+	plugin.UnimplementedServer
+}
+
+func (*testPluginServer) AuthorizeSign(context.Context, *plugin.AuthorizeSignRequest) (*plugin.AuthorizeSignResponse, error) {
+	return &plugin.AuthorizeSignResponse{Subject: "device", SANs: []string{"device.example.com"}}, nil
+}
+
+type testKeyManager struct {
+	closed bool
+}
+
+func (*testKeyManager) GetPublicKey(*kmsapi.GetPublicKeyRequest) (crypto.PublicKey, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (*testKeyManager) CreateKey(*kmsapi.CreateKeyRequest) (*kmsapi.CreateKeyResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (*testKeyManager) CreateSigner(*kmsapi.CreateSignerRequest) (crypto.Signer, error) {
+	return keyutil.GenerateDefaultSigner()
+}
+
+func (k *testKeyManager) Close() error {
+	k.closed = true
+	return nil
+}
+
+func TestCAReloadConfig_dryRunSharedState(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "plugin.sock")
+	lis, err := net.Listen("unix", socket)
+	assert.FatalError(t, err)
+	srv := grpc.NewServer()
+	plugin.RegisterServer(srv, &testPluginServer{})
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	var keyManagers []*testKeyManager
+	kmsapi.Register("catestkms", func(ctx context.Context, opts kmsapi.Options) (kmsapi.KeyManager, error) {
+		km := &testKeyManager{}
+		keyManagers = append(keyManagers, km)
+		return km, nil
+	})
+	t.Cleanup(func() {
+		provisioner.ClosePluginConnections()
+		provisioner.CloseWebhookKeyManagers()
+	})
+
+	// The running CA has a plugin provisioner with a webhook using a client
+	// certificate in a KMS.
+	b, err := os.ReadFile("testdata/ca.json")
+	assert.FatalError(t, err)
+	var m map[string]any
+	assert.FatalError(t, json.Unmarshal(b, &m))
+	authConfig := m["authority"].(map[string]any)
+	authConfig["provisioners"] = append(authConfig["provisioners"].([]any), map[string]any{
+		"type":    "Plugin",
+		"name":    "plugin",
+		"address": "unix://" + socket,
+		"options": map[string]any{
+			"webhooks": []any{map[string]any{
+				"name": "enrich",
+				"url":  "https://webhook.example.com",
+				"kind": "ENRICHING",
+				"clientCertificate": map[string]any{
+					"certificate": "testdata/secrets/intermediate_ca.crt",
+					"key":         "catestkms:name=webhook",
+				},
+			}},
+		},
+	})
+	b, err = json.Marshal(m)
+	assert.FatalError(t, err)
+	configFile := filepath.Join(t.TempDir(), "ca.json")
+	assert.FatalError(t, os.WriteFile(configFile, b, 0600))
+
+	cfg, err := config.LoadConfiguration(configFile)
+	assert.FatalError(t, err)
+	ca, err := New(cfg, WithConfigFile(configFile))
+	assert.FatalError(t, err)
+	t.Cleanup(func() { ca.auth.Shutdown() })
+
+	authorizePlugin := func(t *testing.T) {
+		t.Helper()
+		p, err := ca.auth.LoadProvisionerByName("plugin")
+		assert.FatalError(t, err)
+		_, err = p.AuthorizeSign(context.Background(), "token")
+		assert.FatalError(t, err)
+	}
+	authorizePlugin(t)
+	assert.Len(t, 1, keyManagers)
+
+	// A dry run with a new tenant initializes and discards the tenant.
+	m["tenants"] = []any{map[string]any{
+		"name":   "new",
+		"prefix": "new",
+		"config": writeTenantConfig(t, "new", "tenant.example.com"),
+	}}
+	b, err = json.Marshal(m)
+	assert.FatalError(t, err)
+	assert.FatalError(t, os.WriteFile(configFile, b, 0600))
+	changes, err := ca.auth.ReloadConfig(context.Background(), true)
+	assert.FatalError(t, err)
+	assert.Equals(t, []config.Change{{Path: "tenants", Type: config.ChangeAdded}}, changes)
+	assert.Nil(t, ca.tenants)
+
+	// The running CA can still use the plugin connection and the KMS.
+	authorizePlugin(t)
+	assert.Len(t, 1, keyManagers)
+	assert.False(t, keyManagers[0].closed)
+}
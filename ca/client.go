@@ -22,6 +22,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/certificates/api"
@@ -748,6 +749,13 @@ retry:
 		}
 		return nil, readError(resp)
 	}
+	if resp.StatusCode == http.StatusAccepted {
+		var pending api.PendingIssuanceResponse
+		if err := readJSON(resp.Body, &pending); err != nil {
+			return nil, errs.Wrapf(http.StatusInternalServerError, err, "client.Sign; error reading %s", u)
+		}
+		return nil, &PendingApprovalError{ID: pending.ID, ExpiresAt: pending.ExpiresAt}
+	}
 	var sign api.SignResponse
 	if err := readJSON(resp.Body, &sign); err != nil {
 		return nil, errs.Wrapf(http.StatusInternalServerError, err, "client.Sign; error reading %s", u)
@@ -758,6 +766,109 @@ retry:
 	return &sign, nil
 }
 
+// FinalizePrecertificate performs the request to get the final certificate of
+// an RFC 6962 pre-certificate and returns the api.SignResponse struct.
+func (c *Client) FinalizePrecertificate(ctx context.Context, req *api.FinalizePrecertificateRequest) (*api.SignResponse, error) {
+	var retried bool
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "client.FinalizePrecertificate; error marshaling request")
+	}
+	u := c.endpoint.ResolveReference(&url.URL{Path: "/precertificates/finalize"})
+retry:
+	resp, err := c.client.PostWithContext(ctx, u.String(), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, clientError(err)
+	}
+	if resp.StatusCode >= 400 {
+		if !retried && c.retryOnError(resp) { //nolint:contextcheck // deeply nested context; retry using the same context
+			retried = true
+			goto retry
+		}
+		return nil, readError(resp)
+	}
+	var sign api.SignResponse
+	if err := readJSON(resp.Body, &sign); err != nil {
+		return nil, errs.Wrapf(http.StatusInternalServerError, err, "client.FinalizePrecertificate; error reading %s", u)
+	}
+	sign.TLS = resp.TLS
+	return &sign, nil
+}
+
+// PendingApprovalError is the error returned by Sign when the certificate
+// request requires the approval of an administrator. The status of the request
+// can be checked using PendingIssuance with the given ID.
+type PendingApprovalError struct {
+	ID        string
+	ExpiresAt time.Time
+}
+
+// Error implements the error interface.
+func (e *PendingApprovalError) Error() string {
+	return fmt.Sprintf("certificate request %s is pending approval", e.ID)
+}
+
+// PendingIssuance performs the request to get the status of a certificate
+// request waiting for approval with an empty context. The response contains
+// the certificate once the request is approved.
+func (c *Client) PendingIssuance(id string) (*api.PendingIssuanceResponse, error) {
+	return c.PendingIssuanceWithContext(context.Background(), id)
+}
+
+// PendingIssuanceWithContext performs the request to get the status of a
+// certificate request waiting for approval with the provided context. The
+// response contains the certificate once the request is approved.
+func (c *Client) PendingIssuanceWithContext(ctx context.Context, id string) (*api.PendingIssuanceResponse, error) {
+	var retried bool
+	u := c.endpoint.ResolveReference(&url.URL{Path: "/pending-issuances/" + id})
+retry:
+	resp, err := c.client.GetWithContext(ctx, u.String())
+	if err != nil {
+		return nil, clientError(err)
+	}
+	if resp.StatusCode >= 400 {
+		if !retried && c.retryOnError(resp) { //nolint:contextcheck // deeply nested context; retry using the same context
+			retried = true
+			goto retry
+		}
+		return nil, readError(resp)
+	}
+	var pending api.PendingIssuanceResponse
+	if err := readJSON(resp.Body, &pending); err != nil {
+		return nil, errs.Wrapf(http.StatusInternalServerError, err, "client.PendingIssuance; error reading %s", u)
+	}
+	return &pending, nil
+}
+
+// ValidateToken performs the validate-token request to the CA with the
+// provided context and returns the api.ValidateTokenResponse struct. The token
+// is not consumed.
+func (c *Client) ValidateToken(ctx context.Context, req *api.ValidateTokenRequest) (*api.ValidateTokenResponse, error) {
+	var retried bool
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "client.ValidateToken; error marshaling request")
+	}
+	u := c.endpoint.ResolveReference(&url.URL{Path: "/validate-token"})
+retry:
+	resp, err := c.client.PostWithContext(ctx, u.String(), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, clientError(err)
+	}
+	if resp.StatusCode >= 400 {
+		if !retried && c.retryOnError(resp) { //nolint:contextcheck // deeply nested context; retry using the same context
+			retried = true
+			goto retry
+		}
+		return nil, readError(resp)
+	}
+	var validation api.ValidateTokenResponse
+	if err := readJSON(resp.Body, &validation); err != nil {
+		return nil, errs.Wrapf(http.StatusInternalServerError, err, "client.ValidateToken; error reading %s", u)
+	}
+	return &validation, nil
+}
+
 // Renew performs the renew request to the CA with an empty context and
 // returns the api.SignResponse struct.
 func (c *Client) Renew(tr http.RoundTripper) (*api.SignResponse, error) {
@@ -1047,6 +1158,36 @@ retry:
 	return &federation, nil
 }
 
+// Intermediates performs the get intermediates request to the CA and returns
+// the api.IntermediatesResponse struct.
+func (c *Client) Intermediates() (*api.IntermediatesResponse, error) {
+	return c.IntermediatesWithContext(context.Background())
+}
+
+// IntermediatesWithContext performs the get intermediates request to the CA
+// with the provided context and returns the api.IntermediatesResponse struct.
+func (c *Client) IntermediatesWithContext(ctx context.Context) (*api.IntermediatesResponse, error) {
+	var retried bool
+	u := c.endpoint.ResolveReference(&url.URL{Path: "/intermediates"})
+retry:
+	resp, err := c.client.GetWithContext(ctx, u.String())
+	if err != nil {
+		return nil, clientError(err)
+	}
+	if resp.StatusCode >= 400 {
+		if !retried && c.retryOnError(resp) { //nolint:contextcheck // deeply nested context; retry using the same context
+			retried = true
+			goto retry
+		}
+		return nil, readError(resp)
+	}
+	var intermediates api.IntermediatesResponse
+	if err := readJSON(resp.Body, &intermediates); err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", u)
+	}
+	return &intermediates, nil
+}
+
 // SSHSign performs the POST /ssh/sign request to the CA with an empty context
 // and returns the api.SSHSignResponse struct.
 func (c *Client) SSHSign(req *api.SSHSignRequest) (*api.SSHSignResponse, error) {
@@ -2,6 +2,7 @@ package ca
 
 import (
 	"bytes"
+	"context"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
@@ -357,6 +358,64 @@ func TestClient_Sign(t *testing.T) {
 	}
 }
 
+func TestClient_FinalizePrecertificate(t *testing.T) {
+	ok := &api.SignResponse{
+		ServerPEM: api.Certificate{Certificate: parseCertificate(t, certPEM)},
+		CaPEM:     api.Certificate{Certificate: parseCertificate(t, rootPEM)},
+		CertChainPEM: []api.Certificate{
+			{Certificate: parseCertificate(t, certPEM)},
+			{Certificate: parseCertificate(t, rootPEM)},
+		},
+	}
+	request := &api.FinalizePrecertificateRequest{
+		PrecertificatePEM: api.Certificate{Certificate: parseCertificate(t, certPEM)},
+		SCTs:              [][]byte{[]byte("sct")},
+		OTT:               "the-ott",
+	}
+
+	tests := []struct {
+		name         string
+		response     interface{}
+		responseCode int
+		wantErr      bool
+		expectedErr  error
+	}{
+		{"ok", ok, 201, false, nil},
+		{"unauthorized", errs.Unauthorized("force"), 401, true, errors.New(errs.UnauthorizedDefaultMsg)},
+		{"forbidden", errs.Forbidden("force"), 403, true, errors.New(errs.ForbiddenPrefix + "force.")},
+	}
+
+	srv := httptest.NewServer(nil)
+	defer srv.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewClient(srv.URL, WithTransport(http.DefaultTransport))
+			require.NoError(t, err)
+
+			srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				assert.Equal(t, "/precertificates/finalize", req.URL.Path)
+				body := new(api.FinalizePrecertificateRequest)
+				require.NoError(t, read.JSON(req.Body, body))
+				assert.True(t, equalJSON(t, body, request))
+				render.JSONStatus(w, tt.response, tt.responseCode)
+			})
+
+			got, err := c.FinalizePrecertificate(context.Background(), request)
+			if tt.wantErr {
+				if assert.Error(t, err) {
+					assert.EqualError(t, err, tt.expectedErr.Error())
+				}
+				assert.Nil(t, got)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.response, got)
+		})
+	}
+}
+
 func TestClient_Revoke(t *testing.T) {
 	ok := &api.RevokeResponse{Status: "ok"}
 	request := &api.RevokeRequest{
@@ -641,6 +700,39 @@ func TestClient_Provisioners(t *testing.T) {
 	}
 }
 
+func TestClient_Sign_pendingApproval(t *testing.T) {
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.RequestURI {
+		case "/sign":
+			render.JSONStatus(w, &api.PendingIssuanceResponse{ID: "pi-1", Status: "pending", ExpiresAt: expiresAt}, http.StatusAccepted)
+		case "/pending-issuances/pi-1":
+			render.JSON(w, &api.PendingIssuanceResponse{ID: "pi-1", Status: "denied", Reason: "not allowed", ExpiresAt: expiresAt})
+		default:
+			render.Error(w, errs.NotFound("force"))
+		}
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(srv.URL, WithTransport(http.DefaultTransport))
+	require.NoError(t, err)
+
+	got, err := c.Sign(&api.SignRequest{})
+	assert.Nil(t, got)
+	var pe *PendingApprovalError
+	require.ErrorAs(t, err, &pe)
+	assert.Equal(t, &PendingApprovalError{ID: "pi-1", ExpiresAt: expiresAt}, pe)
+
+	pending, err := c.PendingIssuance(pe.ID)
+	require.NoError(t, err)
+	assert.Equal(t, &api.PendingIssuanceResponse{ID: "pi-1", Status: "denied", Reason: "not allowed", ExpiresAt: expiresAt}, pending)
+
+	_, err = c.PendingIssuance("missing")
+	var sc render.StatusCodedError
+	require.ErrorAs(t, err, &sc)
+	assert.Equal(t, http.StatusNotFound, sc.StatusCode())
+}
+
 func TestClient_ProvisionerKey(t *testing.T) {
 	ok := &api.ProvisionerKeyResponse{
 		Key: "an encrypted key",
@@ -792,6 +884,58 @@ func TestClient_Federation(t *testing.T) {
 	}
 }
 
+func TestClient_Intermediates(t *testing.T) {
+	ok := &api.IntermediatesResponse{
+		Certificates: []api.Certificate{
+			{Certificate: parseCertificate(t, rootPEM)},
+		},
+		Previous: []api.Certificate{
+			{Certificate: parseCertificate(t, rootPEM)},
+		},
+	}
+
+	tests := []struct {
+		name         string
+		response     interface{}
+		responseCode int
+		wantErr      bool
+		err          error
+	}{
+		{"ok", ok, 200, false, nil},
+		{"unauthorized", errs.Unauthorized("force"), 401, true, errors.New(errs.UnauthorizedDefaultMsg)},
+	}
+
+	srv := httptest.NewServer(nil)
+	defer srv.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewClient(srv.URL, WithTransport(http.DefaultTransport))
+			require.NoError(t, err)
+
+			srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				render.JSONStatus(w, tt.response, tt.responseCode)
+			})
+
+			got, err := c.Intermediates()
+			if tt.wantErr {
+				if assert.Error(t, err) {
+					var sc render.StatusCodedError
+					if assert.ErrorAs(t, err, &sc) {
+						assert.Equal(t, tt.responseCode, sc.StatusCode())
+					}
+					assert.True(t, strings.HasPrefix(err.Error(), tt.err.Error()))
+				}
+				assert.Nil(t, got)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.response, got)
+		})
+	}
+}
+
 func TestClient_SSHRoots(t *testing.T) {
 	key, err := ssh.NewPublicKey(mustKey(t).Public())
 	require.NoError(t, err)
@@ -0,0 +1,416 @@
+package ca
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"log"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/acme"
+	acmeAPI "github.com/smallstep/certificates/acme/api"
+	acmeNoSQL "github.com/smallstep/certificates/acme/db/nosql"
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/authority"
+	adminAPI "github.com/smallstep/certificates/authority/admin/api"
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/db"
+	scepAPI "github.com/smallstep/certificates/scep/api"
+)
+
+// tenant is an additional authority served by the CA. Each tenant has its own
+// authority, TLS certificate and HTTP handlers.
+type tenant struct {
+	name         string
+	prefix       string
+	dnsNames     []string
+	auth         *authority.Authority
+	renewer      *TLSRenewer
+	acmeJanitor  *acme.Janitor
+	certificates []*x509.Certificate
+	handler      http.Handler
+}
+
+// newTenant initializes the tenant defined in the given configuration. Tenants
+// without a database use the database of the main authority with their tables
+// namespaced by the tenant name.
+func (ca *CA) newTenant(tc *config.TenantConfig, parent *config.Config, authDB db.AuthDB) (*tenant, error) {
+	cfg, err := tc.Load(parent)
+	if err != nil {
+		return nil, err
+	}
+
+	webhookTransport := http.DefaultTransport.(*http.Transport).Clone()
+	opts := []authority.Option{
+		authority.WithWebhookClient(&http.Client{Transport: webhookTransport}),
+	}
+	if ca.opts.quiet {
+		opts = append(opts, authority.WithQuietInit())
+	}
+	switch {
+	case cfg.DB != nil:
+		// Reuse the database on reloads, it cannot be opened twice.
+		if tenantDB, ok := ca.opts.tenantDatabases[tc.Name]; ok {
+			opts = append(opts, authority.WithDatabase(tenantDB))
+		}
+	default:
+		if ndb, ok := authDB.(*db.DB); ok {
+			tenantDB, err := db.NewNamespace(ndb, tc.Name)
+			if err != nil {
+				return nil, errors.Wrapf(err, "error configuring database for tenant %s", tc.Name)
+			}
+			opts = append(opts, authority.WithDatabase(tenantDB))
+		}
+	}
+
+	auth, err := authority.New(cfg, opts...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error initializing tenant %s", tc.Name)
+	}
+
+	tlsCrt, err := auth.GetTLSCertificate()
+	if err != nil {
+		return nil, errors.Wrapf(err, "error creating TLS certificate for tenant %s", tc.Name)
+	}
+	renewer, err := NewTLSRenewer(tlsCrt, auth.GetTLSCertificate)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &tenant{
+		name:         tc.Name,
+		prefix:       tc.Prefix,
+		dnsNames:     cfg.DNSNames,
+		auth:         auth,
+		renewer:      renewer,
+		certificates: auth.GetRootCertificates(),
+	}
+	for _, b := range tlsCrt.Certificate[1:] {
+		crt, err := x509.ParseCertificate(b)
+		if err != nil {
+			return nil, err
+		}
+		t.certificates = append(t.certificates, crt)
+	}
+
+	// Webhook servers are called using the TLS certificate of the tenant.
+	rootCAs, err := x509.SystemCertPool()
+	if err != nil {
+		return nil, err
+	}
+	for _, crt := range t.certificates {
+		rootCAs.AddCert(crt)
+	}
+	clientTLSConfig := cfg.TLS.TLSConfig()
+	clientTLSConfig.GetClientCertificate = renewer.GetClientCertificate
+	clientTLSConfig.RootCAs = rootCAs
+	webhookTransport.TLSClientConfig = clientTLSConfig
+
+	if t.handler, err = t.newHandler(cfg); err != nil {
+		return nil, err
+	}
+
+	renewer.Run()
+	return t, nil
+}
+
+// newHandler returns the HTTP handler of the tenant. It serves the same APIs
+// as the main authority, except the SCEP endpoints in the insecure server.
+func (t *tenant) newHandler(cfg *config.Config) (http.Handler, error) {
+	mux := chi.NewRouter()
+	mux.Use(middleware.GetHead)
+
+	api.Route(mux)
+	mux.Route("/1.0", func(r chi.Router) {
+		api.Route(r)
+	})
+
+	var acmeDB acme.DB
+	var acmeLinker acme.Linker
+	// ACME is only available if the tenant has a database.
+	if ndb, ok := t.auth.GetDatabase().(*db.DB); ok {
+		dns, err := linkerDNS(cfg)
+		if err != nil {
+			return nil, err
+		}
+		acmeDB, err = acmeNoSQL.New(ndb)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error configuring ACME DB interface for tenant %s", t.name)
+		}
+		acmeLinker = acme.NewLinker(dns, path.Join(t.prefix, "acme"))
+		auth := t.auth
+		t.acmeJanitor = acme.NewJanitor(acmeDB, func() []acme.Provisioner {
+			return acmeProvisioners(auth)
+		})
+		mux.Route("/acme", func(r chi.Router) {
+			acmeAPI.Route(r)
+		})
+		mux.Route("/2.0/acme", func(r chi.Router) {
+			acmeAPI.Route(r)
+		})
+	}
+
+	if cfg.AuthorityConfig.EnableAdmin && t.auth.GetAdminDatabase() != nil {
+		mux.Route("/admin", func(r chi.Router) {
+			adminAPI.Route(
+				r,
+				adminAPI.WithACMEResponder(adminAPI.NewACMEAdminResponder()),
+				adminAPI.WithPolicyResponder(adminAPI.NewPolicyAdminResponder()),
+				adminAPI.WithWebhookResponder(adminAPI.NewWebhookAdminResponder()),
+			)
+		})
+	}
+
+	scepAuthority := t.auth.GetSCEP()
+	if scepAuthority != nil {
+		mux.Route("/scep", func(r chi.Router) {
+			scepAPI.Route(r)
+		})
+	}
+
+	// The base context of the server contains the main authority, the values
+	// are replaced with the ones of the tenant.
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := newAuthorityContext(r.Context(), t.auth, scepAuthority, acmeDB, acmeLinker)
+		mux.ServeHTTP(w, r.WithContext(ctx))
+	}), nil
+}
+
+// stop stops the background jobs of the tenant.
+func (t *tenant) stop() {
+	if t.acmeJanitor != nil {
+		t.acmeJanitor.Stop()
+	}
+	if t.renewer != nil {
+		t.renewer.Stop()
+	}
+}
+
+// close releases the resources owned by a tenant that is not served anymore,
+// its key manager and its database. The namespaced databases do not close the
+// database of the main authority. Unlike Authority.Shutdown, the state shared
+// by all the authorities of the process is kept open.
+func (t *tenant) close() {
+	t.auth.CloseForReload()
+	if err := t.auth.GetDatabase().Shutdown(); err != nil {
+		log.Printf("error stopping tenant %s: %+v\n", t.name, err)
+	}
+}
+
+// tenantRouter selects the tenant that serves a request. A tenant is selected
+// by the URL prefix, or by the SNI or host of the request. Requests that do
+// not match any tenant are served by the main authority, so the prefixes take
+// precedence over the routes of the main authority.
+type tenantRouter struct {
+	tenants  []*tenant
+	prefixes map[string]http.Handler
+	hosts    map[string]*tenant
+	// certificates are the roots and intermediates of the main authority.
+	certificates []*x509.Certificate
+}
+
+// newTenantRouter initializes the tenants in the given configuration. The DNS
+// names of the tenants that are not used by the main authority must be
+// unique, and tenants without a prefix must have at least one of them.
+func (ca *CA) newTenantRouter(cfg *config.Config, auth *authority.Authority) (*tenantRouter, error) {
+	roots := auth.GetRootCertificates()
+	current, previous := auth.GetIntermediateCertificates()
+	certs := make([]*x509.Certificate, 0, len(roots)+len(current)+len(previous))
+	certs = append(certs, roots...)
+	certs = append(certs, current...)
+	certs = append(certs, previous...)
+
+	tr := &tenantRouter{
+		prefixes:     make(map[string]http.Handler),
+		hosts:        make(map[string]*tenant),
+		certificates: certs,
+	}
+	authDB := auth.GetDatabase()
+
+	shared := make(map[string]bool, len(cfg.DNSNames))
+	for _, name := range cfg.DNSNames {
+		shared[strings.ToLower(name)] = true
+	}
+
+	for _, tc := range cfg.Tenants {
+		t, err := ca.newTenant(tc, cfg, authDB)
+		if err != nil {
+			tr.stop()
+			return nil, err
+		}
+		tr.tenants = append(tr.tenants, t)
+
+		if t.prefix != "" {
+			tr.prefixes[t.prefix] = http.StripPrefix("/"+t.prefix, withPeerCertificatesOf(t.certificates, t.handler))
+		}
+		var reachable bool
+		for _, name := range t.dnsNames {
+			name = strings.ToLower(name)
+			if shared[name] {
+				continue
+			}
+			if other, ok := tr.hosts[name]; ok && other != t {
+				tr.stop()
+				return nil, errors.Errorf("dns name %s is used by tenants %s and %s", name, other.name, t.name)
+			}
+			tr.hosts[name] = t
+			reachable = true
+		}
+		if !reachable && t.prefix == "" {
+			tr.stop()
+			return nil, errors.Errorf("tenant %s requires a prefix or a dns name not used by the authority", t.name)
+		}
+	}
+
+	return tr, nil
+}
+
+// has returns true if the router contains a tenant with the given name.
+func (tr *tenantRouter) has(name string) bool {
+	if tr == nil {
+		return false
+	}
+	for _, t := range tr.tenants {
+		if t.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupHost returns the tenant serving the given host name.
+func (tr *tenantRouter) lookupHost(host string) (*tenant, bool) {
+	t, ok := tr.hosts[strings.ToLower(host)]
+	return t, ok
+}
+
+// Middleware returns a handler that routes the requests to the tenants, and
+// the rest of the requests to the next handler.
+func (tr *tenantRouter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The prefix is the first segment of the path.
+		if p := strings.TrimPrefix(r.URL.Path, "/"); p != "" {
+			prefix, _, _ := strings.Cut(p, "/")
+			if h, ok := tr.prefixes[prefix]; ok {
+				h.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		host := r.Host
+		if r.TLS != nil && r.TLS.ServerName != "" {
+			host = r.TLS.ServerName
+		} else if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if t, ok := tr.lookupHost(strings.Trim(host, "[]")); ok {
+			withPeerCertificatesOf(t.certificates, t.handler).ServeHTTP(w, r)
+			return
+		}
+
+		withPeerCertificatesOf(tr.certificates, next).ServeHTTP(w, r)
+	})
+}
+
+// withPeerCertificatesOf returns a handler that removes the client
+// certificate of the requests if it was not issued by one of the given roots
+// or intermediates. The clients of the tenants served using a prefix share
+// the TLS configuration of the main authority, so the client certificate is
+// verified with the roots and intermediates of all of them, but a certificate
+// can only be used with the authority that issued it.
+func withPeerCertificatesOf(certs []*x509.Certificate, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 || isVerifiedBy(r.TLS.VerifiedChains, certs) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		state := *r.TLS
+		state.PeerCertificates = nil
+		state.VerifiedChains = nil
+		r2 := r.WithContext(r.Context())
+		r2.TLS = &state
+		next.ServeHTTP(w, r2)
+	})
+}
+
+// isVerifiedBy returns true if one of the verified chains contains one of the
+// given certificates as an issuer.
+func isVerifiedBy(chains [][]*x509.Certificate, certs []*x509.Certificate) bool {
+	for _, chain := range chains {
+		for _, crt := range chain[1:] {
+			for _, c := range certs {
+				if crt.Equal(c) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// GetConfigForClient returns a tls.Config GetConfigForClient function that
+// returns the configuration of the tenant selected by the SNI. The
+// configuration of a tenant only trusts its own roots and intermediates to
+// authenticate the clients. Other connections use the given configuration.
+func (tr *tenantRouter) GetConfigForClient(base *tls.Config) func(*tls.ClientHelloInfo) (*tls.Config, error) {
+	configs := make(map[*tenant]*tls.Config, len(tr.tenants))
+	for _, t := range tr.tenants {
+		cfg := base.Clone()
+		cfg.GetCertificate = t.renewer.GetCertificateForCA
+		cfg.ClientCAs = x509.NewCertPool()
+		for _, crt := range t.certificates {
+			cfg.ClientCAs.AddCert(crt)
+		}
+		configs[t] = cfg
+	}
+	return func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		if t, ok := tr.lookupHost(hello.ServerName); ok {
+			return configs[t], nil
+		}
+		return nil, nil
+	}
+}
+
+// addClientCAs adds the roots and intermediates of the tenants served using a
+// prefix to the given pool, allowing their clients to use mTLS with the TLS
+// configuration of the main authority.
+func (tr *tenantRouter) addClientCAs(pool *x509.CertPool) {
+	for _, t := range tr.tenants {
+		if t.prefix == "" {
+			continue
+		}
+		for _, crt := range t.certificates {
+			pool.AddCert(crt)
+		}
+	}
+}
+
+// databases returns the databases of the tenants by tenant name.
+func (tr *tenantRouter) databases() map[string]db.AuthDB {
+	m := make(map[string]db.AuthDB, len(tr.tenants))
+	for _, t := range tr.tenants {
+		m[t.name] = t.auth.GetDatabase()
+	}
+	return m
+}
+
+// run starts the background jobs of the tenants.
+func (tr *tenantRouter) run() {
+	for _, t := range tr.tenants {
+		if t.acmeJanitor != nil {
+			go t.acmeJanitor.Run()
+		}
+	}
+}
+
+// stop stops the background jobs of the tenants.
+func (tr *tenantRouter) stop() {
+	for _, t := range tr.tenants {
+		t.stop()
+	}
+}
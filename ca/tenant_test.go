@@ -0,0 +1,201 @@
+package ca
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/minica"
+	"go.step.sm/crypto/pemutil"
+
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/db"
+)
+
+// writeTenantConfig writes a tenant configuration using the rotated root and
+// intermediate in the test data.
+func writeTenantConfig(t *testing.T, name string, dnsNames ...string) string {
+	t.Helper()
+	b, err := os.ReadFile("testdata/federated-ca.json")
+	require.NoError(t, err)
+	var m map[string]any
+	require.NoError(t, json.Unmarshal(b, &m))
+	m["dnsNames"] = dnsNames
+	b, err = json.Marshal(m)
+	require.NoError(t, err)
+	fn := filepath.Join(t.TempDir(), name+".json")
+	require.NoError(t, os.WriteFile(fn, b, 0600))
+	return fn
+}
+
+func TestCA_tenants(t *testing.T) {
+	rootCrt, err := pemutil.ReadCertificate("testdata/secrets/root_ca.crt")
+	require.NoError(t, err)
+	tenantRootCrt, err := pemutil.ReadCertificate("testdata/rotated/root_ca.crt")
+	require.NoError(t, err)
+
+	cfg, err := authority.LoadConfiguration("testdata/ca.json")
+	require.NoError(t, err)
+	cfg.DB = &db.Config{Type: "badgerv2", DataSource: t.TempDir()}
+	cfg.Tenants = []*config.TenantConfig{
+		{Name: "prefixed", Prefix: "tenant", Config: writeTenantConfig(t, "prefixed", "127.0.0.1")},
+		{Name: "sni", Config: writeTenantConfig(t, "sni", "tenant.example.com")},
+	}
+	ca, err := New(cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		ca.tenants.stop()
+		ca.auth.Shutdown()
+	})
+	require.Len(t, ca.tenants.tenants, 2)
+
+	// Tenants use the database of the main authority.
+	for _, tt := range ca.tenants.tenants {
+		_, ok := tt.auth.GetDatabase().(*db.DB)
+		assert.True(t, ok)
+		assert.NotNil(t, tt.acmeJanitor)
+	}
+
+	srv := startTestServer(buildContext(ca.auth, nil, nil, nil), ca.srv.TLSConfig, ca.srv.Handler)
+	defer srv.Close()
+
+	getRoots := func(t *testing.T, serverName, path string, root *x509.Certificate) *api.RootsResponse {
+		t.Helper()
+		pool := x509.NewCertPool()
+		pool.AddCert(root)
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			ServerName: serverName,
+			RootCAs:    pool,
+			MinVersion: tls.VersionTLS12,
+		}}}
+		resp, err := client.Get(srv.URL + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+		var roots api.RootsResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&roots))
+		return &roots
+	}
+
+	// The main authority
+	roots := getRoots(t, "127.0.0.1", "/roots", rootCrt)
+	require.Len(t, roots.Certificates, 1)
+	assert.Equal(t, rootCrt, roots.Certificates[0].Certificate)
+
+	// Tenant selected by the prefix, using the TLS certificate of the main
+	// authority.
+	roots = getRoots(t, "127.0.0.1", "/tenant/roots", rootCrt)
+	require.Len(t, roots.Certificates, 1)
+	assert.Equal(t, tenantRootCrt, roots.Certificates[0].Certificate)
+	roots = getRoots(t, "127.0.0.1", "/tenant/1.0/roots", rootCrt)
+	require.Len(t, roots.Certificates, 1)
+	assert.Equal(t, tenantRootCrt, roots.Certificates[0].Certificate)
+
+	// Tenant selected by the SNI, using its own TLS certificate.
+	roots = getRoots(t, "tenant.example.com", "/roots", tenantRootCrt)
+	require.Len(t, roots.Certificates, 1)
+	assert.Equal(t, tenantRootCrt, roots.Certificates[0].Certificate)
+
+	// The tenant selected by the SNI only trusts its own client certificates.
+	var sni *tenant
+	for _, tt := range ca.tenants.tenants {
+		if tt.name == "sni" {
+			sni = tt
+		}
+	}
+	require.NotNil(t, sni)
+	tenantPool := x509.NewCertPool()
+	for _, crt := range sni.certificates {
+		tenantPool.AddCert(crt)
+	}
+	tlsConfig, err := ca.srv.TLSConfig.GetConfigForClient(&tls.ClientHelloInfo{ServerName: "tenant.example.com"})
+	require.NoError(t, err)
+	require.NotNil(t, tlsConfig)
+	assert.True(t, tenantPool.Equal(tlsConfig.ClientCAs))
+	assert.False(t, tenantPool.Equal(ca.srv.TLSConfig.ClientCAs))
+	tlsConfig, err = ca.srv.TLSConfig.GetConfigForClient(&tls.ClientHelloInfo{ServerName: "127.0.0.1"})
+	require.NoError(t, err)
+	assert.Nil(t, tlsConfig)
+}
+
+func Test_withPeerCertificatesOf(t *testing.T) {
+	mustCA := func(t *testing.T) (*minica.CA, []*x509.Certificate) {
+		t.Helper()
+		ca, err := minica.New()
+		require.NoError(t, err)
+		signer, err := keyutil.GenerateDefaultSigner()
+		require.NoError(t, err)
+		leaf, err := ca.Sign(&x509.Certificate{
+			Subject:   pkix.Name{CommonName: "leaf"},
+			PublicKey: signer.Public(),
+		})
+		require.NoError(t, err)
+		return ca, []*x509.Certificate{leaf, ca.Intermediate, ca.Root}
+	}
+	ca, chain := mustCA(t)
+	_, otherChain := mustCA(t)
+
+	var got []*x509.Certificate
+	h := withPeerCertificatesOf([]*x509.Certificate{ca.Root, ca.Intermediate}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = nil
+		if r.TLS != nil {
+			got = r.TLS.PeerCertificates
+		}
+	}))
+	serve := func(state *tls.ConnectionState) []*x509.Certificate {
+		r := httptest.NewRequest("GET", "/renew", http.NoBody)
+		r.TLS = state
+		h.ServeHTTP(httptest.NewRecorder(), r)
+		return got
+	}
+
+	assert.Equal(t, chain[:1], serve(&tls.ConnectionState{PeerCertificates: chain[:1], VerifiedChains: [][]*x509.Certificate{chain}}))
+	assert.Equal(t, chain[:1], serve(&tls.ConnectionState{PeerCertificates: chain[:1], VerifiedChains: [][]*x509.Certificate{chain[:2]}}))
+	assert.Empty(t, serve(&tls.ConnectionState{PeerCertificates: otherChain[:1], VerifiedChains: [][]*x509.Certificate{otherChain}}))
+	assert.Empty(t, serve(&tls.ConnectionState{}))
+	assert.Nil(t, serve(nil))
+}
+
+func TestCA_tenants_fail(t *testing.T) {
+	tests := []struct {
+		name    string
+		tenants func(t *testing.T) []*config.TenantConfig
+	}{
+		{"fail unreachable", func(t *testing.T) []*config.TenantConfig {
+			return []*config.TenantConfig{
+				{Name: "foo", Config: writeTenantConfig(t, "foo", "127.0.0.1")},
+			}
+		}},
+		{"fail dns names", func(t *testing.T) []*config.TenantConfig {
+			return []*config.TenantConfig{
+				{Name: "foo", Config: writeTenantConfig(t, "foo", "tenant.example.com")},
+				{Name: "bar", Prefix: "bar", Config: writeTenantConfig(t, "bar", "TENANT.example.com")},
+			}
+		}},
+		{"fail config", func(t *testing.T) []*config.TenantConfig {
+			return []*config.TenantConfig{
+				{Name: "foo", Config: filepath.Join(t.TempDir(), "missing.json")},
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := authority.LoadConfiguration("testdata/ca.json")
+			require.NoError(t, err)
+			cfg.Tenants = tt.tenants(t)
+			_, err = New(cfg)
+			assert.Error(t, err)
+		})
+	}
+}
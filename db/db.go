@@ -26,6 +26,13 @@ var (
 	sshHostsTable          = []byte("ssh_hosts")
 	sshUsersTable          = []byte("ssh_users")
 	sshHostPrincipalsTable = []byte("ssh_host_principals")
+	scepChallengesTable    = []byte("scep_challenges")
+	sshHostInventoryTable  = []byte("ssh_host_inventory")
+	tofuInstancesTable     = []byte("tofu_instances")
+	pendingIssuancesTable  = []byte("pending_issuances")
+	certsQuotaTable        = []byte("x509_certs_quota")
+	scepNextCATable        = []byte("scep_next_ca")
+	webhookPinsTable       = []byte("webhook_pins")
 )
 
 // TODO: at the moment we store a single CRL in the database, in a dedicated table.
@@ -102,6 +109,80 @@ type CertificateRevocationListDB interface {
 	StoreCRL(*CertificateRevocationListInfo) error
 }
 
+// SSHRevocationListDB is an interface to indicate whether the DB supports the
+// generation of OpenSSH key revocation lists.
+type SSHRevocationListDB interface {
+	GetRevokedSSHCertificates() (*[]RevokedCertificateInfo, error)
+}
+
+// RevocationImporter is an extension of AuthDB that allows to add multiple
+// revoked certificates in one transaction.
+type RevocationImporter interface {
+	ImportRevokedCertificates(rcis []*RevokedCertificateInfo) ([]error, error)
+}
+
+// CertificateCounter is an extension of AuthDB that keeps, for each
+// provisioner and name, a counter of the valid certificates issued by the
+// provisioner for the name.
+type CertificateCounter interface {
+	AddCertificateToQuota(provisionerID string, crt *x509.Certificate, max int, now time.Time) (string, bool, error)
+	RemoveCertificateFromQuota(provisionerID string, crt *x509.Certificate) error
+}
+
+// SCEPChallengeDB is an extension of AuthDB that allows to store and use SCEP
+// one-time challenges.
+type SCEPChallengeDB interface {
+	StoreSCEPChallenge(sci *SCEPChallengeInfo) error
+	UseSCEPChallenge(id, provisionerID string, now time.Time) error
+}
+
+// SSHHostInventoryDB is an extension of AuthDB that allows to store an
+// inventory of SSH hosts with their tags and groups.
+type SSHHostInventoryDB interface {
+	StoreSSHInventoryHost(host *SSHInventoryHost) error
+	GetSSHInventoryHost(hostname string) (*SSHInventoryHost, error)
+	GetSSHInventoryHosts() ([]*SSHInventoryHost, error)
+	DeleteSSHInventoryHost(hostname string) error
+}
+
+// TOFUInstanceDB is an extension of AuthDB that allows to keep a registry of
+// the instances that have been issued a certificate by a cloud provisioner
+// using trust on first use.
+type TOFUInstanceDB interface {
+	StoreTOFUInstance(ti *TOFUInstance) error
+	GetTOFUInstances(provisionerID string) ([]*TOFUInstance, error)
+	DeleteTOFUInstance(tokenID string) (bool, error)
+}
+
+// PendingIssuanceDB is an extension of AuthDB that allows to store the signing
+// requests waiting for the approval of an administrator.
+type PendingIssuanceDB interface {
+	StorePendingIssuance(pi *PendingIssuance) error
+	GetPendingIssuance(id string) (*PendingIssuance, error)
+	GetPendingIssuances() ([]*PendingIssuance, error)
+	UpdatePendingIssuance(pi *PendingIssuance, status PendingIssuanceStatus) error
+}
+
+// SCEPNextCADB is an extension of AuthDB that allows to persist the
+// certificates staged for the SCEP GetNextCACert operation.
+type SCEPNextCADB interface {
+	StoreSCEPNextCACertificates(certs []*x509.Certificate) error
+	GetSCEPNextCACertificates() ([]*x509.Certificate, error)
+}
+
+// UsedTokenDB is an extension of AuthDB that allows to check if a token has
+// been used without storing it.
+type UsedTokenDB interface {
+	IsTokenUsed(id string) (bool, error)
+}
+
+// WebhookPinDB is an extension of AuthDB that allows to persist the
+// fingerprints of the webhook server certificates pinned on first use.
+type WebhookPinDB interface {
+	GetWebhookPin(key string) (string, error)
+	StoreWebhookPin(key, fingerprint string) error
+}
+
 // DB is a wrapper over the nosql.DB interface.
 type DB struct {
 	nosql.DB
@@ -125,19 +206,29 @@ func New(c *Config) (AuthDB, error) {
 		return nil, errors.Wrapf(err, "Error opening database of Type %s", c.Type)
 	}
 
+	if err := createTables(db); err != nil {
+		return nil, err
+	}
+
+	return &DB{db, true}, nil
+}
+
+// createTables creates the tables used by the AuthDB.
+func createTables(db nosql.DB) error {
 	tables := [][]byte{
 		revokedCertsTable, certsTable, usedOTTTable,
 		sshCertsTable, sshHostsTable, sshHostPrincipalsTable, sshUsersTable,
-		revokedSSHCertsTable, certsDataTable, crlTable,
+		revokedSSHCertsTable, certsDataTable, crlTable, scepChallengesTable,
+		sshHostInventoryTable, tofuInstancesTable, pendingIssuancesTable,
+		certsQuotaTable, scepNextCATable, webhookPinsTable,
 	}
 	for _, b := range tables {
 		if err := db.CreateTable(b); err != nil {
-			return nil, errors.Wrapf(err, "error creating table %s",
+			return errors.Wrapf(err, "error creating table %s",
 				string(b))
 		}
 	}
-
-	return &DB{db, true}, nil
+	return nil
 }
 
 // RevokedCertificateInfo contains information regarding the certificate
@@ -245,6 +336,444 @@ func (db *DB) RevokeSSH(rci *RevokedCertificateInfo) error {
 	}
 }
 
+// ImportRevokedCertificates adds the given certificates to the revocation
+// table in one transaction. It returns a list with the result of each entry,
+// nil if the certificate has been added, or ErrAlreadyExists if it was already
+// in the table.
+func (db *DB) ImportRevokedCertificates(rcis []*RevokedCertificateInfo) ([]error, error) {
+	tx := new(database.Tx)
+	for _, rci := range rcis {
+		rcib, err := json.Marshal(rci)
+		if err != nil {
+			return nil, errors.Wrap(err, "error marshaling revoked certificate info")
+		}
+		tx.Cas(revokedCertsTable, []byte(rci.Serial), rcib)
+	}
+	if err := db.Update(tx); err != nil {
+		return nil, errors.Wrap(err, "database Update error")
+	}
+
+	results := make([]error, len(rcis))
+	for i, op := range tx.Operations {
+		if !op.Swapped {
+			results[i] = ErrAlreadyExists
+		}
+	}
+	return results, nil
+}
+
+// SCEPChallengeInfo contains the information of a SCEP one-time challenge. The
+// challenge itself is not stored, the ID is the hex encoded SHA-256 of the
+// challenge.
+type SCEPChallengeInfo struct {
+	ID            string    `json:"id"`
+	ProvisionerID string    `json:"provisionerID"`
+	CreatedAt     time.Time `json:"createdAt"`
+	ExpiresAt     time.Time `json:"expiresAt"`
+	UsedAt        time.Time `json:"usedAt"`
+}
+
+// StoreSCEPChallenge adds a new SCEP one-time challenge to the challenges
+// table.
+func (db *DB) StoreSCEPChallenge(sci *SCEPChallengeInfo) error {
+	scib, err := json.Marshal(sci)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling scep challenge info")
+	}
+
+	_, swapped, err := db.CmpAndSwap(scepChallengesTable, []byte(sci.ID), nil, scib)
+	switch {
+	case err != nil:
+		return errors.Wrap(err, "error AuthDB CmpAndSwap")
+	case !swapped:
+		return ErrAlreadyExists
+	default:
+		return nil
+	}
+}
+
+// UseSCEPChallenge marks as used the SCEP one-time challenge with the given
+// id. It returns an error if the challenge does not exist, does not belong to
+// the given provisioner, has expired, or has already been used.
+func (db *DB) UseSCEPChallenge(id, provisionerID string, now time.Time) error {
+	b, err := db.Get(scepChallengesTable, []byte(id))
+	if err != nil {
+		if nosql.IsErrNotFound(err) {
+			return errors.New("scep challenge not found")
+		}
+		return errors.Wrap(err, "database Get error")
+	}
+
+	var sci SCEPChallengeInfo
+	if err := json.Unmarshal(b, &sci); err != nil {
+		return errors.Wrap(err, "error unmarshaling scep challenge info")
+	}
+	switch {
+	case sci.ProvisionerID != provisionerID:
+		return errors.New("scep challenge not found")
+	case !sci.UsedAt.IsZero():
+		return errors.New("scep challenge has already been used")
+	case now.After(sci.ExpiresAt):
+		return errors.New("scep challenge has expired")
+	}
+
+	sci.UsedAt = now.UTC()
+	scib, err := json.Marshal(sci)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling scep challenge info")
+	}
+	_, swapped, err := db.CmpAndSwap(scepChallengesTable, []byte(id), b, scib)
+	switch {
+	case err != nil:
+		return errors.Wrap(err, "error AuthDB CmpAndSwap")
+	case !swapped:
+		return errors.New("scep challenge has already been used")
+	default:
+		return nil
+	}
+}
+
+// SSHInventoryHost is a host registered in the SSH host inventory.
+type SSHInventoryHost struct {
+	Hostname  string            `json:"hostname"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	Groups    []string          `json:"groups,omitempty"`
+	CreatedAt time.Time         `json:"createdAt"`
+	UpdatedAt time.Time         `json:"updatedAt"`
+}
+
+// StoreSSHInventoryHost adds or replaces a host in the SSH host inventory. The
+// hostname is case-insensitive.
+func (db *DB) StoreSSHInventoryHost(host *SSHInventoryHost) error {
+	b, err := json.Marshal(host)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling ssh inventory host")
+	}
+	if err := db.Set(sshHostInventoryTable, []byte(strings.ToLower(host.Hostname)), b); err != nil {
+		return errors.Wrap(err, "database Set error")
+	}
+	return nil
+}
+
+// GetSSHInventoryHost returns the host with the given hostname in the SSH host
+// inventory.
+func (db *DB) GetSSHInventoryHost(hostname string) (*SSHInventoryHost, error) {
+	b, err := db.Get(sshHostInventoryTable, []byte(strings.ToLower(hostname)))
+	if err != nil {
+		if nosql.IsErrNotFound(err) {
+			return nil, errors.Wrapf(err, "ssh inventory host %s not found", hostname)
+		}
+		return nil, errors.Wrap(err, "database Get error")
+	}
+	var host SSHInventoryHost
+	if err := json.Unmarshal(b, &host); err != nil {
+		return nil, errors.Wrap(err, "error unmarshaling ssh inventory host")
+	}
+	return &host, nil
+}
+
+// GetSSHInventoryHosts returns all the hosts in the SSH host inventory.
+func (db *DB) GetSSHInventoryHosts() ([]*SSHInventoryHost, error) {
+	entries, err := db.List(sshHostInventoryTable)
+	if err != nil {
+		return nil, err
+	}
+	hosts := make([]*SSHInventoryHost, 0, len(entries))
+	for _, e := range entries {
+		var host SSHInventoryHost
+		if err := json.Unmarshal(e.Value, &host); err != nil {
+			return nil, errors.Wrap(err, "error unmarshaling ssh inventory host")
+		}
+		hosts = append(hosts, &host)
+	}
+	return hosts, nil
+}
+
+// DeleteSSHInventoryHost removes a host from the SSH host inventory.
+func (db *DB) DeleteSSHInventoryHost(hostname string) error {
+	if err := db.Del(sshHostInventoryTable, []byte(strings.ToLower(hostname))); err != nil {
+		return errors.Wrap(err, "database Del error")
+	}
+	return nil
+}
+
+// TOFUInstance is the record of the first use of an instance in a cloud
+// provisioner. TokenID is the id of the used token.
+type TOFUInstance struct {
+	ProvisionerID string    `json:"provisionerID"`
+	InstanceID    string    `json:"instanceID"`
+	TokenID       string    `json:"tokenID"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// StoreTOFUInstance adds the first use of an instance to the registry.
+func (db *DB) StoreTOFUInstance(ti *TOFUInstance) error {
+	b, err := json.Marshal(ti)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling tofu instance")
+	}
+	if err := db.Set(tofuInstancesTable, []byte(ti.TokenID), b); err != nil {
+		return errors.Wrap(err, "database Set error")
+	}
+	return nil
+}
+
+// GetTOFUInstances returns the instances in the registry of the given
+// provisioner.
+func (db *DB) GetTOFUInstances(provisionerID string) ([]*TOFUInstance, error) {
+	entries, err := db.List(tofuInstancesTable)
+	if err != nil {
+		return nil, err
+	}
+	var instances []*TOFUInstance
+	for _, e := range entries {
+		var ti TOFUInstance
+		if err := json.Unmarshal(e.Value, &ti); err != nil {
+			return nil, errors.Wrap(err, "error unmarshaling tofu instance")
+		}
+		if ti.ProvisionerID == provisionerID {
+			instances = append(instances, &ti)
+		}
+	}
+	return instances, nil
+}
+
+// DeleteTOFUInstance removes an instance from the registry and the used token
+// of its first use, so the instance can get a new certificate. The token is
+// removed even if the instance is not in the registry. It returns false if
+// neither the instance nor the token exist.
+func (db *DB) DeleteTOFUInstance(tokenID string) (bool, error) {
+	var found bool
+	for _, bucket := range [][]byte{usedOTTTable, tofuInstancesTable} {
+		switch _, err := db.Get(bucket, []byte(tokenID)); {
+		case err == nil:
+			found = true
+		case !database.IsErrNotFound(err):
+			return false, errors.Wrap(err, "database Get error")
+		}
+	}
+	if !found {
+		return false, nil
+	}
+
+	tx := new(database.Tx)
+	tx.Del(usedOTTTable, []byte(tokenID))
+	tx.Del(tofuInstancesTable, []byte(tokenID))
+	if err := db.Update(tx); err != nil {
+		return false, errors.Wrap(err, "database Update error")
+	}
+	return true, nil
+}
+
+// ErrPendingIssuanceConflict is returned when a pending issuance is updated
+// and it does not have the expected status.
+var ErrPendingIssuanceConflict = errors.New("pending issuance has been modified")
+
+// PendingIssuanceStatus is the status of a signing request waiting for
+// approval.
+type PendingIssuanceStatus string
+
+const (
+	// PendingIssuanceStatusPending is the status of a request waiting for a
+	// decision.
+	PendingIssuanceStatusPending PendingIssuanceStatus = "pending"
+	// PendingIssuanceStatusApproved is the status of an approved request that
+	// is being signed.
+	PendingIssuanceStatusApproved PendingIssuanceStatus = "approved"
+	// PendingIssuanceStatusIssued is the status of an approved request with
+	// the certificate already signed.
+	PendingIssuanceStatusIssued PendingIssuanceStatus = "issued"
+	// PendingIssuanceStatusDenied is the status of a denied request.
+	PendingIssuanceStatusDenied PendingIssuanceStatus = "denied"
+	// PendingIssuanceStatusExpired is the status of a pending request that
+	// has not been approved before its expiration. It is not stored.
+	PendingIssuanceStatusExpired PendingIssuanceStatus = "expired"
+)
+
+// PendingIssuance is an X.509 signing request waiting for approval. Template
+// contains the unsigned certificate as it will be sent to the CAS, and
+// Certificates the issued chain once the request is approved. NotAfter, if
+// set, is the fixed expiration of a certificate that must expire with another
+// one, like the identity certificate of an SSH certificate.
+type PendingIssuance struct {
+	ID                 string                  `json:"id"`
+	Status             PendingIssuanceStatus   `json:"status"`
+	ProvisionerID      string                  `json:"provisionerID"`
+	ProvisionerName    string                  `json:"provisionerName"`
+	CommonName         string                  `json:"commonName,omitempty"`
+	SANs               []string                `json:"sans,omitempty"`
+	CSR                []byte                  `json:"csr"`
+	Template           []byte                  `json:"template"`
+	SignatureAlgorithm x509.SignatureAlgorithm `json:"signatureAlgorithm,omitempty"`
+	Lifetime           time.Duration           `json:"lifetime"`
+	Backdate           time.Duration           `json:"backdate"`
+	NotAfter           time.Time               `json:"notAfter,omitempty"`
+	Certificates       [][]byte                `json:"certificates,omitempty"`
+	DecidedBy          string                  `json:"decidedBy,omitempty"`
+	Reason             string                  `json:"reason,omitempty"`
+	CreatedAt          time.Time               `json:"createdAt"`
+	ExpiresAt          time.Time               `json:"expiresAt"`
+	DecidedAt          time.Time               `json:"decidedAt"`
+}
+
+// StorePendingIssuance adds a new signing request to the pending issuances
+// table.
+func (db *DB) StorePendingIssuance(pi *PendingIssuance) error {
+	b, err := json.Marshal(pi)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling pending issuance")
+	}
+	_, swapped, err := db.CmpAndSwap(pendingIssuancesTable, []byte(pi.ID), nil, b)
+	switch {
+	case err != nil:
+		return errors.Wrap(err, "error AuthDB CmpAndSwap")
+	case !swapped:
+		return ErrAlreadyExists
+	default:
+		return nil
+	}
+}
+
+// GetPendingIssuance returns the signing request with the given id.
+func (db *DB) GetPendingIssuance(id string) (*PendingIssuance, error) {
+	b, err := db.Get(pendingIssuancesTable, []byte(id))
+	if err != nil {
+		if nosql.IsErrNotFound(err) {
+			return nil, errors.Wrapf(err, "pending issuance %s not found", id)
+		}
+		return nil, errors.Wrap(err, "database Get error")
+	}
+	var pi PendingIssuance
+	if err := json.Unmarshal(b, &pi); err != nil {
+		return nil, errors.Wrap(err, "error unmarshaling pending issuance")
+	}
+	return &pi, nil
+}
+
+// GetPendingIssuances returns all the signing requests in the pending
+// issuances table.
+func (db *DB) GetPendingIssuances() ([]*PendingIssuance, error) {
+	entries, err := db.List(pendingIssuancesTable)
+	if err != nil {
+		return nil, err
+	}
+	pis := make([]*PendingIssuance, 0, len(entries))
+	for _, e := range entries {
+		var pi PendingIssuance
+		if err := json.Unmarshal(e.Value, &pi); err != nil {
+			return nil, errors.Wrap(err, "error unmarshaling pending issuance")
+		}
+		pis = append(pis, &pi)
+	}
+	return pis, nil
+}
+
+// UpdatePendingIssuance replaces a signing request if its stored status is the
+// given one. It returns ErrPendingIssuanceConflict if the status is different
+// or if the request is modified concurrently.
+func (db *DB) UpdatePendingIssuance(pi *PendingIssuance, status PendingIssuanceStatus) error {
+	old, err := db.Get(pendingIssuancesTable, []byte(pi.ID))
+	if err != nil {
+		if nosql.IsErrNotFound(err) {
+			return errors.Wrapf(err, "pending issuance %s not found", pi.ID)
+		}
+		return errors.Wrap(err, "database Get error")
+	}
+	var current PendingIssuance
+	if err := json.Unmarshal(old, &current); err != nil {
+		return errors.Wrap(err, "error unmarshaling pending issuance")
+	}
+	if current.Status != status {
+		return ErrPendingIssuanceConflict
+	}
+
+	b, err := json.Marshal(pi)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling pending issuance")
+	}
+	_, swapped, err := db.CmpAndSwap(pendingIssuancesTable, []byte(pi.ID), old, b)
+	switch {
+	case err != nil:
+		return errors.Wrap(err, "error AuthDB CmpAndSwap")
+	case !swapped:
+		return ErrPendingIssuanceConflict
+	default:
+		return nil
+	}
+}
+
+// scepNextCAKey is the key of the certificates staged for the SCEP
+// GetNextCACert operation.
+var scepNextCAKey = []byte("certificates")
+
+// StoreSCEPNextCACertificates replaces the certificates staged for the SCEP
+// GetNextCACert operation. An empty list removes them.
+func (db *DB) StoreSCEPNextCACertificates(certs []*x509.Certificate) error {
+	if len(certs) == 0 {
+		if err := db.Del(scepNextCATable, scepNextCAKey); err != nil && !nosql.IsErrNotFound(err) {
+			return errors.Wrap(err, "database Del error")
+		}
+		return nil
+	}
+	ders := make([][]byte, len(certs))
+	for i, crt := range certs {
+		ders[i] = crt.Raw
+	}
+	b, err := json.Marshal(ders)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling scep next ca certificates")
+	}
+	if err := db.Set(scepNextCATable, scepNextCAKey, b); err != nil {
+		return errors.Wrap(err, "database Set error")
+	}
+	return nil
+}
+
+// GetSCEPNextCACertificates returns the certificates staged for the SCEP
+// GetNextCACert operation, or nil if there are none.
+func (db *DB) GetSCEPNextCACertificates() ([]*x509.Certificate, error) {
+	b, err := db.Get(scepNextCATable, scepNextCAKey)
+	if err != nil {
+		if nosql.IsErrNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "database Get error")
+	}
+	var ders [][]byte
+	if err := json.Unmarshal(b, &ders); err != nil {
+		return nil, errors.Wrap(err, "error unmarshaling scep next ca certificates")
+	}
+	certs := make([]*x509.Certificate, len(ders))
+	for i, der := range ders {
+		if certs[i], err = x509.ParseCertificate(der); err != nil {
+			return nil, errors.Wrap(err, "error parsing scep next ca certificate")
+		}
+	}
+	return certs, nil
+}
+
+// GetWebhookPin returns the fingerprint of the webhook server certificate
+// pinned with the given key, or an empty string if there is none.
+func (db *DB) GetWebhookPin(key string) (string, error) {
+	b, err := db.Get(webhookPinsTable, []byte(key))
+	if err != nil {
+		if nosql.IsErrNotFound(err) {
+			return "", nil
+		}
+		return "", errors.Wrap(err, "database Get error")
+	}
+	return string(b), nil
+}
+
+// StoreWebhookPin pins the fingerprint of a webhook server certificate with
+// the given key.
+func (db *DB) StoreWebhookPin(key, fingerprint string) error {
+	if err := db.Set(webhookPinsTable, []byte(key), []byte(fingerprint)); err != nil {
+		return errors.Wrap(err, "database Set error")
+	}
+	return nil
+}
+
 // GetRevokedCertificates gets a list of all revoked certificates.
 func (db *DB) GetRevokedCertificates() (*[]RevokedCertificateInfo, error) {
 	entries, err := db.List(revokedCertsTable)
@@ -262,6 +791,23 @@ func (db *DB) GetRevokedCertificates() (*[]RevokedCertificateInfo, error) {
 	return &revokedCerts, nil
 }
 
+// GetRevokedSSHCertificates gets a list of all revoked SSH certificates.
+func (db *DB) GetRevokedSSHCertificates() (*[]RevokedCertificateInfo, error) {
+	entries, err := db.List(revokedSSHCertsTable)
+	if err != nil {
+		return nil, err
+	}
+	var revokedCerts []RevokedCertificateInfo
+	for _, e := range entries {
+		var data RevokedCertificateInfo
+		if err := json.Unmarshal(e.Value, &data); err != nil {
+			return nil, err
+		}
+		revokedCerts = append(revokedCerts, data)
+	}
+	return &revokedCerts, nil
+}
+
 // StoreCRL stores a CRL in the DB
 func (db *DB) StoreCRL(crlInfo *CertificateRevocationListInfo) error {
 	crlInfoBytes, err := json.Marshal(crlInfo)
@@ -316,6 +862,153 @@ func (db *DB) GetCertificateData(serialNumber string) (*CertificateData, error)
 	return &data, nil
 }
 
+// maxCertificateQuotaRetries is the number of times that the counter of a
+// name is read again if it changes while it is updated.
+const maxCertificateQuotaRetries = 10
+
+// certificateQuotaEntry is a certificate counted in the quota of a name.
+type certificateQuotaEntry struct {
+	Serial   string    `json:"serial"`
+	NotAfter time.Time `json:"notAfter"`
+}
+
+// certificateQuotaKey returns the key of the counter of a name.
+func certificateQuotaKey(provisionerID, name string) []byte {
+	return []byte(provisionerID + "\x00" + name)
+}
+
+// AddCertificateToQuota adds the certificate to the counters of the given
+// provisioner for each name in the common name and subject alternative names
+// of the certificate. The counters only keep the certificates that are not
+// expired nor revoked at the given time. If max is greater than 0 and a name
+// already has max certificates, the certificate is not added to any counter
+// and the name is returned with false.
+//
+// The counters are updated using CmpAndSwap, so concurrent requests cannot
+// exceed the quota.
+func (db *DB) AddCertificateToQuota(provisionerID string, crt *x509.Certificate, max int, now time.Time) (string, bool, error) {
+	entry := certificateQuotaEntry{
+		Serial:   crt.SerialNumber.String(),
+		NotAfter: crt.NotAfter,
+	}
+	var added []string
+	for name := range certificateNames(crt) {
+		ok, err := db.updateCertificateQuota(provisionerID, name, func(entries []certificateQuotaEntry) ([]certificateQuotaEntry, bool, error) {
+			valid := make([]certificateQuotaEntry, 0, len(entries)+1)
+			for _, e := range entries {
+				if e.Serial == entry.Serial || now.After(e.NotAfter) {
+					continue
+				}
+				isRevoked, err := db.IsRevoked(e.Serial)
+				if err != nil {
+					return nil, false, err
+				}
+				if !isRevoked {
+					valid = append(valid, e)
+				}
+			}
+			if max > 0 && len(valid) >= max {
+				return nil, false, nil
+			}
+			return append(valid, entry), true, nil
+		})
+		if err != nil || !ok {
+			for _, n := range added {
+				// Ignore the error, the entry expires with the certificate.
+				db.removeCertificateFromQuota(provisionerID, n, entry.Serial)
+			}
+			return name, false, err
+		}
+		added = append(added, name)
+	}
+	return "", true, nil
+}
+
+// RemoveCertificateFromQuota removes the certificate from the counters of the
+// given provisioner. It is used if the certificate is not issued after being
+// added to the counters.
+func (db *DB) RemoveCertificateFromQuota(provisionerID string, crt *x509.Certificate) error {
+	serial := crt.SerialNumber.String()
+	for name := range certificateNames(crt) {
+		if err := db.removeCertificateFromQuota(provisionerID, name, serial); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *DB) removeCertificateFromQuota(provisionerID, name, serial string) error {
+	_, err := db.updateCertificateQuota(provisionerID, name, func(entries []certificateQuotaEntry) ([]certificateQuotaEntry, bool, error) {
+		valid := make([]certificateQuotaEntry, 0, len(entries))
+		for _, e := range entries {
+			if e.Serial != serial {
+				valid = append(valid, e)
+			}
+		}
+		return valid, len(valid) != len(entries), nil
+	})
+	return err
+}
+
+// updateCertificateQuota replaces the counter of a name with the entries
+// returned by fn. The counter is not updated if fn returns false.
+func (db *DB) updateCertificateQuota(provisionerID, name string, fn func([]certificateQuotaEntry) ([]certificateQuotaEntry, bool, error)) (bool, error) {
+	key := certificateQuotaKey(provisionerID, name)
+	for i := 0; i < maxCertificateQuotaRetries; i++ {
+		var entries []certificateQuotaEntry
+		old, err := db.Get(certsQuotaTable, key)
+		switch {
+		case nosql.IsErrNotFound(err):
+			old = nil
+		case err != nil:
+			return false, errors.Wrap(err, "database Get error")
+		default:
+			if err := json.Unmarshal(old, &entries); err != nil {
+				return false, errors.Wrap(err, "error unmarshaling json")
+			}
+		}
+
+		entries, ok, err := fn(entries)
+		if err != nil || !ok {
+			return false, err
+		}
+		b, err := json.Marshal(entries)
+		if err != nil {
+			return false, errors.Wrap(err, "error marshaling json")
+		}
+		_, swapped, err := db.CmpAndSwap(certsQuotaTable, key, old, b)
+		if err != nil {
+			return false, errors.Wrap(err, "error AuthDB CmpAndSwap")
+		}
+		if swapped {
+			return true, nil
+		}
+	}
+	return false, errors.Errorf("error updating the certificate quota of %q: too many concurrent updates", name)
+}
+
+// certificateNames returns the set of names in the common name and subject
+// alternative names of a certificate.
+func certificateNames(crt *x509.Certificate) map[string]struct{} {
+	names := make(map[string]struct{})
+	if crt.Subject.CommonName != "" {
+		names[crt.Subject.CommonName] = struct{}{}
+	}
+	for _, s := range crt.DNSNames {
+		names[s] = struct{}{}
+	}
+	for _, s := range crt.EmailAddresses {
+		names[s] = struct{}{}
+	}
+	for _, ip := range crt.IPAddresses {
+		names[ip.String()] = struct{}{}
+	}
+	for _, u := range crt.URIs {
+		names[u.String()] = struct{}{}
+	}
+	return names
+}
+
 // StoreCertificate stores a certificate PEM.
 func (db *DB) StoreCertificate(crt *x509.Certificate) error {
 	if err := db.Set(certsTable, []byte(crt.SerialNumber.String()), crt.Raw); err != nil {
@@ -409,6 +1102,18 @@ func (db *DB) UseToken(id, tok string) (bool, error) {
 	return swapped, nil
 }
 
+// IsTokenUsed returns true if a token with the given id has already been
+// used. The token is not stored.
+func (db *DB) IsTokenUsed(id string) (bool, error) {
+	if _, err := db.Get(usedOTTTable, []byte(id)); err != nil {
+		if database.IsErrNotFound(err) {
+			return false, nil
+		}
+		return false, errors.Wrapf(err, "error loading used token %s/%s", string(usedOTTTable), id)
+	}
+	return true, nil
+}
+
 // IsSSHHost returns if a principal is present in the ssh hosts table.
 func (db *DB) IsSSHHost(principal string) (bool, error) {
 	if _, err := db.Get(sshHostsTable, []byte(strings.ToLower(principal))); err != nil {
@@ -485,23 +1190,37 @@ func (db *DB) Shutdown() error {
 
 // MockAuthDB mocks the AuthDB interface. //
 type MockAuthDB struct {
-	Err                     error
-	Ret1                    interface{}
-	MIsRevoked              func(string) (bool, error)
-	MIsSSHRevoked           func(string) (bool, error)
-	MRevoke                 func(rci *RevokedCertificateInfo) error
-	MRevokeSSH              func(rci *RevokedCertificateInfo) error
-	MGetCertificate         func(serialNumber string) (*x509.Certificate, error)
-	MGetCertificateData     func(serialNumber string) (*CertificateData, error)
-	MStoreCertificate       func(crt *x509.Certificate) error
-	MUseToken               func(id, tok string) (bool, error)
-	MIsSSHHost              func(principal string) (bool, error)
-	MStoreSSHCertificate    func(crt *ssh.Certificate) error
-	MGetSSHHostPrincipals   func() ([]string, error)
-	MShutdown               func() error
-	MGetRevokedCertificates func() (*[]RevokedCertificateInfo, error)
-	MGetCRL                 func() (*CertificateRevocationListInfo, error)
-	MStoreCRL               func(*CertificateRevocationListInfo) error
+	Err                        error
+	Ret1                       interface{}
+	MIsRevoked                 func(string) (bool, error)
+	MIsSSHRevoked              func(string) (bool, error)
+	MRevoke                    func(rci *RevokedCertificateInfo) error
+	MRevokeSSH                 func(rci *RevokedCertificateInfo) error
+	MGetCertificate            func(serialNumber string) (*x509.Certificate, error)
+	MGetCertificateData        func(serialNumber string) (*CertificateData, error)
+	MStoreCertificate          func(crt *x509.Certificate) error
+	MUseToken                  func(id, tok string) (bool, error)
+	MIsSSHHost                 func(principal string) (bool, error)
+	MStoreSSHCertificate       func(crt *ssh.Certificate) error
+	MGetSSHHostPrincipals      func() ([]string, error)
+	MShutdown                  func() error
+	MGetRevokedCertificates    func() (*[]RevokedCertificateInfo, error)
+	MGetRevokedSSHCertificates func() (*[]RevokedCertificateInfo, error)
+	MGetCRL                    func() (*CertificateRevocationListInfo, error)
+	MStoreCRL                  func(*CertificateRevocationListInfo) error
+
+	MImportRevokedCertificates  func(rcis []*RevokedCertificateInfo) ([]error, error)
+	MStoreSCEPChallenge         func(sci *SCEPChallengeInfo) error
+	MUseSCEPChallenge           func(id, provisionerID string, now time.Time) error
+	MAddCertificateToQuota      func(provisionerID string, crt *x509.Certificate, max int, now time.Time) (string, bool, error)
+	MRemoveCertificateFromQuota func(provisionerID string, crt *x509.Certificate) error
+	MStoreSSHInventoryHost      func(host *SSHInventoryHost) error
+	MGetSSHInventoryHost        func(hostname string) (*SSHInventoryHost, error)
+	MGetSSHInventoryHosts       func() ([]*SSHInventoryHost, error)
+	MDeleteSSHInventoryHost     func(hostname string) error
+	MStoreTOFUInstance          func(ti *TOFUInstance) error
+	MGetTOFUInstances           func(provisionerID string) ([]*TOFUInstance, error)
+	MDeleteTOFUInstance         func(tokenID string) (bool, error)
 }
 
 func (m *MockAuthDB) GetRevokedCertificates() (*[]RevokedCertificateInfo, error) {
@@ -511,6 +1230,13 @@ func (m *MockAuthDB) GetRevokedCertificates() (*[]RevokedCertificateInfo, error)
 	return m.Ret1.(*[]RevokedCertificateInfo), m.Err
 }
 
+func (m *MockAuthDB) GetRevokedSSHCertificates() (*[]RevokedCertificateInfo, error) {
+	if m.MGetRevokedSSHCertificates != nil {
+		return m.MGetRevokedSSHCertificates()
+	}
+	return m.Ret1.(*[]RevokedCertificateInfo), m.Err
+}
+
 func (m *MockAuthDB) GetCRL() (*CertificateRevocationListInfo, error) {
 	if m.MGetCRL != nil {
 		return m.MGetCRL()
@@ -525,6 +1251,108 @@ func (m *MockAuthDB) StoreCRL(info *CertificateRevocationListInfo) error {
 	return m.Err
 }
 
+// ImportRevokedCertificates mock.
+func (m *MockAuthDB) ImportRevokedCertificates(rcis []*RevokedCertificateInfo) ([]error, error) {
+	if m.MImportRevokedCertificates != nil {
+		return m.MImportRevokedCertificates(rcis)
+	}
+	if m.Ret1 == nil {
+		return nil, m.Err
+	}
+	return m.Ret1.([]error), m.Err
+}
+
+// StoreSCEPChallenge mock.
+func (m *MockAuthDB) StoreSCEPChallenge(sci *SCEPChallengeInfo) error {
+	if m.MStoreSCEPChallenge != nil {
+		return m.MStoreSCEPChallenge(sci)
+	}
+	return m.Err
+}
+
+// UseSCEPChallenge mock.
+func (m *MockAuthDB) UseSCEPChallenge(id, provisionerID string, now time.Time) error {
+	if m.MUseSCEPChallenge != nil {
+		return m.MUseSCEPChallenge(id, provisionerID, now)
+	}
+	return m.Err
+}
+
+// AddCertificateToQuota mock.
+func (m *MockAuthDB) AddCertificateToQuota(provisionerID string, crt *x509.Certificate, max int, now time.Time) (string, bool, error) {
+	if m.MAddCertificateToQuota != nil {
+		return m.MAddCertificateToQuota(provisionerID, crt, max, now)
+	}
+	return "", m.Err == nil, m.Err
+}
+
+// RemoveCertificateFromQuota mock.
+func (m *MockAuthDB) RemoveCertificateFromQuota(provisionerID string, crt *x509.Certificate) error {
+	if m.MRemoveCertificateFromQuota != nil {
+		return m.MRemoveCertificateFromQuota(provisionerID, crt)
+	}
+	return m.Err
+}
+
+// StoreSSHInventoryHost mock.
+func (m *MockAuthDB) StoreSSHInventoryHost(host *SSHInventoryHost) error {
+	if m.MStoreSSHInventoryHost != nil {
+		return m.MStoreSSHInventoryHost(host)
+	}
+	return m.Err
+}
+
+// GetSSHInventoryHost mock.
+func (m *MockAuthDB) GetSSHInventoryHost(hostname string) (*SSHInventoryHost, error) {
+	if m.MGetSSHInventoryHost != nil {
+		return m.MGetSSHInventoryHost(hostname)
+	}
+	host, _ := m.Ret1.(*SSHInventoryHost)
+	return host, m.Err
+}
+
+// GetSSHInventoryHosts mock.
+func (m *MockAuthDB) GetSSHInventoryHosts() ([]*SSHInventoryHost, error) {
+	if m.MGetSSHInventoryHosts != nil {
+		return m.MGetSSHInventoryHosts()
+	}
+	hosts, _ := m.Ret1.([]*SSHInventoryHost)
+	return hosts, m.Err
+}
+
+// DeleteSSHInventoryHost mock.
+func (m *MockAuthDB) DeleteSSHInventoryHost(hostname string) error {
+	if m.MDeleteSSHInventoryHost != nil {
+		return m.MDeleteSSHInventoryHost(hostname)
+	}
+	return m.Err
+}
+
+// StoreTOFUInstance mock.
+func (m *MockAuthDB) StoreTOFUInstance(ti *TOFUInstance) error {
+	if m.MStoreTOFUInstance != nil {
+		return m.MStoreTOFUInstance(ti)
+	}
+	return m.Err
+}
+
+// GetTOFUInstances mock.
+func (m *MockAuthDB) GetTOFUInstances(provisionerID string) ([]*TOFUInstance, error) {
+	if m.MGetTOFUInstances != nil {
+		return m.MGetTOFUInstances(provisionerID)
+	}
+	instances, _ := m.Ret1.([]*TOFUInstance)
+	return instances, m.Err
+}
+
+// DeleteTOFUInstance mock.
+func (m *MockAuthDB) DeleteTOFUInstance(tokenID string) (bool, error) {
+	if m.MDeleteTOFUInstance != nil {
+		return m.MDeleteTOFUInstance(tokenID)
+	}
+	return m.Err == nil, m.Err
+}
+
 // IsRevoked mock.
 func (m *MockAuthDB) IsRevoked(sn string) (bool, error) {
 	if m.MIsRevoked != nil {
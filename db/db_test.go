@@ -12,6 +12,7 @@ import (
 	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/nosql"
 	"github.com/smallstep/nosql/database"
+	"go.step.sm/crypto/minica"
 )
 
 func TestIsRevoked(t *testing.T) {
@@ -100,6 +101,60 @@ func TestRevoke(t *testing.T) {
 	}
 }
 
+func TestDB_ImportRevokedCertificates(t *testing.T) {
+	rcis := []*RevokedCertificateInfo{
+		{Serial: "1", ReasonCode: 1},
+		{Serial: "2", ReasonCode: 4},
+	}
+	tests := []struct {
+		name    string
+		db      nosql.DB
+		want    []error
+		wantErr bool
+	}{
+		{"ok", &MockNoSQLDB{
+			MUpdate: func(tx *database.Tx) error {
+				if len(tx.Operations) != 2 {
+					t.Fatal("unexpected number of operations")
+				}
+				for i, op := range tx.Operations {
+					assert.Equals(t, database.CmpAndSwap, op.Cmd)
+					assert.Equals(t, []byte("revoked_x509_certs"), op.Bucket)
+					assert.Equals(t, []byte(rcis[i].Serial), op.Key)
+					assert.Nil(t, op.CmpValue)
+					op.Swapped = true
+				}
+				assert.Equals(t, `{"Serial":"2","ProvisionerID":"","ReasonCode":4,"Reason":"","RevokedAt":"0001-01-01T00:00:00Z","ExpiresAt":"0001-01-01T00:00:00Z","TokenID":"","MTLS":false,"ACME":false}`, string(tx.Operations[1].Value))
+				return nil
+			},
+		}, []error{nil, nil}, false},
+		{"ok already exists", &MockNoSQLDB{
+			MUpdate: func(tx *database.Tx) error {
+				tx.Operations[1].Swapped = true
+				return nil
+			},
+		}, []error{ErrAlreadyExists, nil}, false},
+		{"fail update", &MockNoSQLDB{
+			MUpdate: func(tx *database.Tx) error {
+				return errors.New("test error")
+			},
+		}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &DB{DB: tt.db, isUp: true}
+			got, err := d.ImportRevokedCertificates(rcis)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DB.ImportRevokedCertificates() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DB.ImportRevokedCertificates() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestUseToken(t *testing.T) {
 	type result struct {
 		err error
@@ -165,6 +220,43 @@ func TestUseToken(t *testing.T) {
 	}
 }
 
+func TestDB_IsTokenUsed(t *testing.T) {
+	tests := map[string]struct {
+		db      *DB
+		want    bool
+		wantErr bool
+	}{
+		"ok/used": {db: &DB{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				assert.Equals(t, usedOTTTable, bucket)
+				assert.Equals(t, []byte("id"), key)
+				return []byte("token"), nil
+			},
+		}, true}, want: true},
+		"ok/not-used": {db: &DB{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return nil, database.ErrNotFound
+			},
+		}, true}, want: false},
+		"fail/get-error": {db: &DB{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return nil, errors.New("force")
+			},
+		}, true}, wantErr: true},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := tc.db.IsTokenUsed("id")
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, tc.want, got)
+		})
+	}
+}
+
 // wrappedProvisioner implements raProvisioner and attProvisioner.
 type wrappedProvisioner struct {
 	provisioner.Interface
@@ -435,3 +527,243 @@ func TestDB_StoreRenewedCertificate(t *testing.T) {
 		})
 	}
 }
+
+func TestDB_SSHInventoryHosts(t *testing.T) {
+	store := map[string][]byte{}
+	d := &DB{DB: &MockNoSQLDB{
+		MSet: func(bucket, key, value []byte) error {
+			assert.Equals(t, sshHostInventoryTable, bucket)
+			store[string(key)] = value
+			return nil
+		},
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			assert.Equals(t, sshHostInventoryTable, bucket)
+			if b, ok := store[string(key)]; ok {
+				return b, nil
+			}
+			return nil, database.ErrNotFound
+		},
+		MList: func(bucket []byte) ([]*database.Entry, error) {
+			assert.Equals(t, sshHostInventoryTable, bucket)
+			var entries []*database.Entry
+			for k, v := range store {
+				entries = append(entries, &database.Entry{Bucket: bucket, Key: []byte(k), Value: v})
+			}
+			return entries, nil
+		},
+		MDel: func(bucket, key []byte) error {
+			assert.Equals(t, sshHostInventoryTable, bucket)
+			delete(store, string(key))
+			return nil
+		},
+	}, isUp: true}
+
+	host := &SSHInventoryHost{
+		Hostname: "Web01.Example.com",
+		Tags:     map[string]string{"env": "prod"},
+		Groups:   []string{"web"},
+	}
+	assert.FatalError(t, d.StoreSSHInventoryHost(host))
+
+	got, err := d.GetSSHInventoryHost("web01.example.com")
+	assert.FatalError(t, err)
+	assert.Equals(t, host, got)
+
+	hosts, err := d.GetSSHInventoryHosts()
+	assert.FatalError(t, err)
+	assert.Equals(t, []*SSHInventoryHost{host}, hosts)
+
+	assert.FatalError(t, d.DeleteSSHInventoryHost("WEB01.example.com"))
+	_, err = d.GetSSHInventoryHost("web01.example.com")
+	assert.True(t, nosql.IsErrNotFound(err))
+}
+
+func TestDB_TOFUInstances(t *testing.T) {
+	store := map[string][]byte{}
+	var deleted [][]byte
+	d := &DB{DB: &MockNoSQLDB{
+		MSet: func(bucket, key, value []byte) error {
+			assert.Equals(t, tofuInstancesTable, bucket)
+			store[string(key)] = value
+			return nil
+		},
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			if v, ok := store[string(key)]; ok && bytes.Equal(bucket, tofuInstancesTable) {
+				return v, nil
+			}
+			return nil, database.ErrNotFound
+		},
+		MList: func(bucket []byte) ([]*database.Entry, error) {
+			assert.Equals(t, tofuInstancesTable, bucket)
+			var entries []*database.Entry
+			for k, v := range store {
+				entries = append(entries, &database.Entry{Bucket: bucket, Key: []byte(k), Value: v})
+			}
+			return entries, nil
+		},
+		MUpdate: func(tx *database.Tx) error {
+			for _, op := range tx.Operations {
+				assert.Equals(t, database.Delete, op.Cmd)
+				deleted = append(deleted, op.Bucket)
+				if bytes.Equal(op.Bucket, tofuInstancesTable) {
+					delete(store, string(op.Key))
+				}
+			}
+			return nil
+		},
+	}, isUp: true}
+
+	ti1 := &TOFUInstance{ProvisionerID: "aws/foo", InstanceID: "i-1234", TokenID: "token-1"}
+	ti2 := &TOFUInstance{ProvisionerID: "gcp/bar", InstanceID: "5678", TokenID: "token-2"}
+	assert.FatalError(t, d.StoreTOFUInstance(ti1))
+	assert.FatalError(t, d.StoreTOFUInstance(ti2))
+
+	instances, err := d.GetTOFUInstances("aws/foo")
+	assert.FatalError(t, err)
+	assert.Equals(t, []*TOFUInstance{ti1}, instances)
+
+	ok, err := d.DeleteTOFUInstance("token-1")
+	assert.FatalError(t, err)
+	assert.True(t, ok)
+	assert.Equals(t, [][]byte{usedOTTTable, tofuInstancesTable}, deleted)
+	instances, err = d.GetTOFUInstances("aws/foo")
+	assert.FatalError(t, err)
+	assert.Len(t, 0, instances)
+
+	// Nothing is deleted if the instance does not exist.
+	ok, err = d.DeleteTOFUInstance("token-1")
+	assert.FatalError(t, err)
+	assert.False(t, ok)
+	assert.Len(t, 2, deleted)
+}
+
+func TestDB_PendingIssuances(t *testing.T) {
+	store := map[string][]byte{}
+	d := &DB{DB: &MockNoSQLDB{
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			assert.Equals(t, pendingIssuancesTable, bucket)
+			if v, ok := store[string(key)]; ok {
+				return v, nil
+			}
+			return nil, database.ErrNotFound
+		},
+		MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+			assert.Equals(t, pendingIssuancesTable, bucket)
+			if !bytes.Equal(store[string(key)], old) {
+				return store[string(key)], false, nil
+			}
+			store[string(key)] = newval
+			return newval, true, nil
+		},
+		MList: func(bucket []byte) ([]*database.Entry, error) {
+			assert.Equals(t, pendingIssuancesTable, bucket)
+			var entries []*database.Entry
+			for k, v := range store {
+				entries = append(entries, &database.Entry{Bucket: bucket, Key: []byte(k), Value: v})
+			}
+			return entries, nil
+		},
+	}, isUp: true}
+
+	pi := &PendingIssuance{ID: "the-id", Status: PendingIssuanceStatusPending, ProvisionerID: "jwk/foo", CommonName: "foo.example.com"}
+	assert.FatalError(t, d.StorePendingIssuance(pi))
+	assert.Equals(t, ErrAlreadyExists, d.StorePendingIssuance(pi))
+
+	got, err := d.GetPendingIssuance("the-id")
+	assert.FatalError(t, err)
+	assert.Equals(t, pi, got)
+	_, err = d.GetPendingIssuance("missing")
+	assert.True(t, nosql.IsErrNotFound(err))
+
+	approved := *pi
+	approved.Status = PendingIssuanceStatusApproved
+	assert.FatalError(t, d.UpdatePendingIssuance(&approved, PendingIssuanceStatusPending))
+	assert.Equals(t, ErrPendingIssuanceConflict, d.UpdatePendingIssuance(&approved, PendingIssuanceStatusPending))
+
+	pis, err := d.GetPendingIssuances()
+	assert.FatalError(t, err)
+	assert.Equals(t, []*PendingIssuance{&approved}, pis)
+}
+
+func TestDB_SCEPNextCACertificates(t *testing.T) {
+	ca, err := minica.New()
+	assert.FatalError(t, err)
+
+	store := map[string][]byte{}
+	d := &DB{DB: &MockNoSQLDB{
+		MSet: func(bucket, key, value []byte) error {
+			assert.Equals(t, scepNextCATable, bucket)
+			store[string(key)] = value
+			return nil
+		},
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			assert.Equals(t, scepNextCATable, bucket)
+			if b, ok := store[string(key)]; ok {
+				return b, nil
+			}
+			return nil, database.ErrNotFound
+		},
+		MDel: func(bucket, key []byte) error {
+			assert.Equals(t, scepNextCATable, bucket)
+			if _, ok := store[string(key)]; !ok {
+				return database.ErrNotFound
+			}
+			delete(store, string(key))
+			return nil
+		},
+	}, isUp: true}
+
+	certs, err := d.GetSCEPNextCACertificates()
+	assert.FatalError(t, err)
+	assert.Len(t, 0, certs)
+
+	assert.FatalError(t, d.StoreSCEPNextCACertificates([]*x509.Certificate{ca.Intermediate, ca.Root}))
+	certs, err = d.GetSCEPNextCACertificates()
+	assert.FatalError(t, err)
+	assert.Equals(t, []*x509.Certificate{ca.Intermediate, ca.Root}, certs)
+
+	assert.FatalError(t, d.StoreSCEPNextCACertificates(nil))
+	certs, err = d.GetSCEPNextCACertificates()
+	assert.FatalError(t, err)
+	assert.Len(t, 0, certs)
+	assert.FatalError(t, d.StoreSCEPNextCACertificates(nil))
+}
+
+func TestDB_WebhookPin(t *testing.T) {
+	store := map[string][]byte{}
+	d := &DB{DB: &MockNoSQLDB{
+		MSet: func(bucket, key, value []byte) error {
+			assert.Equals(t, webhookPinsTable, bucket)
+			store[string(key)] = value
+			return nil
+		},
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			assert.Equals(t, webhookPinsTable, bucket)
+			if b, ok := store[string(key)]; ok {
+				return b, nil
+			}
+			return nil, database.ErrNotFound
+		},
+	}, isUp: true}
+
+	fingerprint, err := d.GetWebhookPin("wh|example.com:443")
+	assert.FatalError(t, err)
+	assert.Equals(t, "", fingerprint)
+
+	assert.FatalError(t, d.StoreWebhookPin("wh|example.com:443", "abcd"))
+	fingerprint, err = d.GetWebhookPin("wh|example.com:443")
+	assert.FatalError(t, err)
+	assert.Equals(t, "abcd", fingerprint)
+
+	d = &DB{DB: &MockNoSQLDB{
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			return nil, errors.New("force")
+		},
+		MSet: func(bucket, key, value []byte) error {
+			return errors.New("force")
+		},
+	}, isUp: true}
+	_, err = d.GetWebhookPin("wh|example.com:443")
+	assert.Error(t, err)
+	assert.Error(t, d.StoreWebhookPin("wh|example.com:443", "abcd"))
+}
@@ -0,0 +1,119 @@
+package db
+
+import (
+	"bytes"
+	"regexp"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/nosql"
+	"github.com/smallstep/nosql/database"
+)
+
+var namespaceRegexp = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+
+// NewNamespace returns a new AuthDB that stores its data in the given database
+// with all the tables prefixed by the namespace and a dash. It allows multiple
+// authorities to share the same database. Namespaces and table names cannot
+// contain a dash, so the tables of a namespace never match the tables of the
+// main authority or of other namespaces.
+//
+// Closing the returned database does not close the underlying one.
+func NewNamespace(db nosql.DB, namespace string) (AuthDB, error) {
+	if !namespaceRegexp.MatchString(namespace) {
+		return nil, errors.Errorf("invalid database namespace %q", namespace)
+	}
+
+	ndb := &namespaceDB{
+		db:     db,
+		prefix: []byte(namespace + "-"),
+	}
+	if err := createTables(ndb); err != nil {
+		return nil, err
+	}
+
+	return &DB{ndb, true}, nil
+}
+
+// namespaceDB is a nosql.DB that prefixes the name of the tables.
+type namespaceDB struct {
+	db     nosql.DB
+	prefix []byte
+}
+
+func (n *namespaceDB) bucket(bucket []byte) []byte {
+	b := make([]byte, 0, len(n.prefix)+len(bucket))
+	return append(append(b, n.prefix...), bucket...)
+}
+
+// Open returns an error, the underlying database must be already open.
+func (n *namespaceDB) Open(string, ...database.Option) error {
+	return errors.New("namespaced database cannot be opened")
+}
+
+// Close does nothing, the underlying database is closed by its owner.
+func (n *namespaceDB) Close() error {
+	return nil
+}
+
+// Get returns the value stored in the given table/bucket and key.
+func (n *namespaceDB) Get(bucket, key []byte) ([]byte, error) {
+	return n.db.Get(n.bucket(bucket), key)
+}
+
+// Set sets the given value in the given table/bucket and key.
+func (n *namespaceDB) Set(bucket, key, value []byte) error {
+	return n.db.Set(n.bucket(bucket), key, value)
+}
+
+// CmpAndSwap swaps the value at the given bucket and key if the current value
+// is equivalent to the oldValue input.
+func (n *namespaceDB) CmpAndSwap(bucket, key, oldValue, newValue []byte) ([]byte, bool, error) {
+	return n.db.CmpAndSwap(n.bucket(bucket), key, oldValue, newValue)
+}
+
+// Del deletes the data in the given table/bucket and key.
+func (n *namespaceDB) Del(bucket, key []byte) error {
+	return n.db.Del(n.bucket(bucket), key)
+}
+
+// List returns a list of all the entries in a given table/bucket. The bucket
+// in the entries does not contain the namespace.
+func (n *namespaceDB) List(bucket []byte) ([]*database.Entry, error) {
+	entries, err := n.db.List(n.bucket(bucket))
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		e.Bucket = bytes.TrimPrefix(e.Bucket, n.prefix)
+	}
+	return entries, nil
+}
+
+// Update performs a transaction with multiple read-write commands. The results
+// are copied to the operations of the given transaction.
+func (n *namespaceDB) Update(tx *database.Tx) error {
+	ntx := &database.Tx{
+		Operations: make([]*database.TxEntry, len(tx.Operations)),
+	}
+	for i, op := range tx.Operations {
+		nop := *op
+		nop.Bucket = n.bucket(op.Bucket)
+		ntx.Operations[i] = &nop
+	}
+	err := n.db.Update(ntx)
+	for i, op := range tx.Operations {
+		op.Result = ntx.Operations[i].Result
+		op.Swapped = ntx.Operations[i].Swapped
+	}
+	return err
+}
+
+// CreateTable creates a table or a bucket in the database.
+func (n *namespaceDB) CreateTable(bucket []byte) error {
+	return n.db.CreateTable(n.bucket(bucket))
+}
+
+// DeleteTable deletes a table or a bucket in the database.
+func (n *namespaceDB) DeleteTable(bucket []byte) error {
+	return n.db.DeleteTable(n.bucket(bucket))
+}
@@ -0,0 +1,84 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/nosql"
+	"github.com/smallstep/nosql/database"
+)
+
+func TestNewNamespace(t *testing.T) {
+	db, err := nosql.New("badgerv2", t.TempDir())
+	assert.FatalError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	foo, err := NewNamespace(db, "foo")
+	assert.FatalError(t, err)
+	bar, err := NewNamespace(db, "bar")
+	assert.FatalError(t, err)
+	_, err = NewNamespace(db, "foo/bar")
+	assert.Error(t, err)
+
+	// Tokens are only visible in their namespace.
+	ok, err := foo.UseToken("token-id", "token")
+	assert.FatalError(t, err)
+	assert.True(t, ok)
+	ok, err = foo.UseToken("token-id", "token")
+	assert.FatalError(t, err)
+	assert.False(t, ok)
+	ok, err = bar.UseToken("token-id", "token")
+	assert.FatalError(t, err)
+	assert.True(t, ok)
+	_, err = db.Get(usedOTTTable, []byte("token-id"))
+	assert.True(t, nosql.IsErrNotFound(err))
+	b, err := db.Get([]byte("foo-used_ott"), []byte("token-id"))
+	assert.FatalError(t, err)
+	assert.Equals(t, []byte("token"), b)
+
+	// Entries and transactions use the table names without the namespace.
+	ndb := foo.(*DB).DB
+	entries, err := ndb.List(usedOTTTable)
+	assert.FatalError(t, err)
+	assert.Len(t, 1, entries)
+	assert.Equals(t, usedOTTTable, entries[0].Bucket)
+	assert.Equals(t, []byte("token-id"), entries[0].Key)
+
+	tx := new(database.Tx)
+	tx.Set(certsTable, []byte("1234"), []byte("certificate"))
+	tx.Get(usedOTTTable, []byte("token-id"))
+	assert.FatalError(t, ndb.Update(tx))
+	assert.Equals(t, certsTable, tx.Operations[0].Bucket)
+	assert.Equals(t, []byte("token"), tx.Operations[1].Result)
+	b, err = db.Get([]byte("foo-x509_certs"), []byte("1234"))
+	assert.FatalError(t, err)
+	assert.Equals(t, []byte("certificate"), b)
+
+	// Closing a namespace does not close the database.
+	assert.FatalError(t, foo.Shutdown())
+	ok, err = bar.UseToken("other-token-id", "token")
+	assert.FatalError(t, err)
+	assert.True(t, ok)
+	assert.Error(t, ndb.Open("foo"))
+}
+
+func TestNewNamespace_tableNames(t *testing.T) {
+	db, err := nosql.New("badgerv2", t.TempDir())
+	assert.FatalError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	// A namespace named as the first part of a table does not use the tables
+	// of the main authority.
+	revoked, err := NewNamespace(db, "revoked")
+	assert.FatalError(t, err)
+	ndb := revoked.(*DB).DB
+	assert.FatalError(t, ndb.Set([]byte("x509_certs"), []byte("1234"), []byte("certificate")))
+	_, err = db.Get(revokedCertsTable, []byte("1234"))
+	assert.True(t, nosql.IsErrNotFound(err))
+	b, err := db.Get([]byte("revoked-x509_certs"), []byte("1234"))
+	assert.FatalError(t, err)
+	assert.Equals(t, []byte("certificate"), b)
+
+	_, err = NewNamespace(db, "foo-bar")
+	assert.Error(t, err)
+}
@@ -89,6 +89,13 @@ func (s *SimpleDB) UseToken(id, tok string) (bool, error) {
 	return true, nil
 }
 
+// IsTokenUsed returns true if a token with the given id has already been
+// used.
+func (s *SimpleDB) IsTokenUsed(id string) (bool, error) {
+	_, ok := s.usedTokens.Load(id)
+	return ok, nil
+}
+
 // IsSSHHost returns a "NotImplemented" error.
 func (s *SimpleDB) IsSSHHost(string) (bool, error) {
 	return false, ErrNotImplemented
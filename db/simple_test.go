@@ -29,6 +29,14 @@ func TestSimpleDB(t *testing.T) {
 	assert.False(t, ok)
 	assert.Nil(t, err)
 
+	// IsTokenUsed
+	ok, err = db.IsTokenUsed("foo")
+	assert.True(t, ok)
+	assert.Nil(t, err)
+	ok, err = db.IsTokenUsed("bar")
+	assert.False(t, ok)
+	assert.Nil(t, err)
+
 	// Shutdown -- verify noop
 	assert.FatalError(t, db.Shutdown())
 	ok, err = db.UseToken("foo", "cat")
@@ -0,0 +1,58 @@
+// Package clientinfo provides the information of the client of an HTTP
+// request to the handlers down the chain.
+package clientinfo
+
+import (
+	"context"
+	"net"
+	"net/http"
+)
+
+// ClientInfo contains the information of the client that sent a request.
+type ClientInfo struct {
+	// IP is the address of the client, it is taken from the connection, the
+	// X-Forwarded-For header is not used.
+	IP net.IP
+	// UserAgent is the value of the User-Agent header.
+	UserAgent string
+	// Provisioner is the value of the X-Step-Provisioner header, the name of
+	// the provisioner selected by the client for tokens that do not identify
+	// their provisioner.
+	Provisioner string
+}
+
+// ProvisionerHeader is the header used by clients to select the provisioner
+// of an opaque token.
+const ProvisionerHeader = "X-Step-Provisioner"
+
+// Middleware wraps an [http.Handler] adding the information of the client to
+// the request context.
+func Middleware(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, req *http.Request) {
+		host, _, err := net.SplitHostPort(req.RemoteAddr)
+		if err != nil {
+			host = req.RemoteAddr
+		}
+		ctx := NewContext(req.Context(), &ClientInfo{
+			IP:          net.ParseIP(host),
+			UserAgent:   req.UserAgent(),
+			Provisioner: req.Header.Get(ProvisionerHeader),
+		})
+		next.ServeHTTP(w, req.WithContext(ctx))
+	}
+	return http.HandlerFunc(fn)
+}
+
+type contextKey struct{}
+
+// NewContext returns a new context with the given client info added to the
+// context.
+func NewContext(ctx context.Context, info *ClientInfo) context.Context {
+	return context.WithValue(ctx, contextKey{}, info)
+}
+
+// FromContext returns the client info from the context if it exists.
+func FromContext(ctx context.Context) (*ClientInfo, bool) {
+	v, ok := ctx.Value(contextKey{}).(*ClientInfo)
+	return v, ok && v != nil
+}
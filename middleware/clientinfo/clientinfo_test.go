@@ -0,0 +1,59 @@
+package clientinfo
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Middleware(t *testing.T) {
+	tests := []struct {
+		name        string
+		remoteAddr  string
+		userAgent   string
+		provisioner string
+		want        *ClientInfo
+	}{
+		{"ok", "10.1.2.3:43210", "step-cli/0.26.0", "", &ClientInfo{IP: net.ParseIP("10.1.2.3"), UserAgent: "step-cli/0.26.0"}},
+		{"ok ipv6", "[2001:db8::1]:443", "", "", &ClientInfo{IP: net.ParseIP("2001:db8::1")}},
+		{"ok no port", "10.1.2.3", "curl/8.0", "", &ClientInfo{IP: net.ParseIP("10.1.2.3"), UserAgent: "curl/8.0"}},
+		{"ok invalid address", "foo", "curl/8.0", "", &ClientInfo{UserAgent: "curl/8.0"}},
+		{"ok provisioner", "10.1.2.3:43210", "step-cli/0.26.0", "oidc", &ClientInfo{IP: net.ParseIP("10.1.2.3"), UserAgent: "step-cli/0.26.0", Provisioner: "oidc"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := http.NewRequest(http.MethodGet, "https://example.com", http.NoBody)
+			require.NoError(t, err)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.userAgent != "" {
+				r.Header.Set("User-Agent", tt.userAgent)
+			}
+			if tt.provisioner != "" {
+				r.Header.Set(ProvisionerHeader, tt.provisioner)
+			}
+			var got *ClientInfo
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var ok bool
+				got, ok = FromContext(r.Context())
+				assert.True(t, ok)
+			})
+			Middleware(next).ServeHTTP(httptest.NewRecorder(), r)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	_, ok := FromContext(context.Background())
+	assert.False(t, ok)
+	_, ok = FromContext(NewContext(context.Background(), nil))
+	assert.False(t, ok)
+	info, ok := FromContext(NewContext(context.Background(), &ClientInfo{UserAgent: "step-cli"}))
+	assert.True(t, ok)
+	assert.Equal(t, "step-cli", info.UserAgent)
+}
@@ -6,6 +6,7 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"regexp"
 
 	"go.step.sm/crypto/x509util"
 	"golang.org/x/crypto/ssh"
@@ -40,8 +41,27 @@ const (
 	EmailNameType     NameType = "email"
 	URINameType       NameType = "uri"
 	PrincipalNameType NameType = "principal"
+
+	// name types of the attributes of the subject distinguished name
+	OrganizationNameType       NameType = "organization"
+	OrganizationalUnitNameType NameType = "organizationalUnit"
+	CountryNameType            NameType = "country"
+	LocalityNameType           NameType = "locality"
+	ProvinceNameType           NameType = "province"
+	SerialNumberNameType       NameType = "serialNumber"
 )
 
+// subjectAttributeNameTypes are the name types of the subject attributes that
+// can be constrained, in the order they are validated.
+var subjectAttributeNameTypes = []NameType{
+	OrganizationNameType,
+	OrganizationalUnitNameType,
+	CountryNameType,
+	LocalityNameType,
+	ProvinceNameType,
+	SerialNumberNameType,
+}
+
 type NamePolicyError struct {
 	Reason   NamePolicyReason
 	NameType NameType
@@ -110,6 +130,16 @@ type NamePolicyEngine struct {
 	permittedPrincipals     []string
 	excludedPrincipals      []string
 
+	// permitted and excluded values of the subject attributes, indexed by
+	// the name type of the attribute. They're not included in the counts
+	// below, so they don't change how the names are validated.
+	permittedSubjectAttributes map[NameType][]string
+	excludedSubjectAttributes  map[NameType][]string
+
+	// regexConstraints contains the compiled regular expression constraints,
+	// indexed by the constraint, e.g. "regex:[a-z]+\.internal".
+	regexConstraints map[string]*regexp.Regexp
+
 	// some internal counts for housekeeping
 	numberOfCommonNameConstraints     int
 	numberOfDNSDomainConstraints      int
@@ -145,6 +175,13 @@ func New(opts ...NamePolicyOption) (*NamePolicyEngine, error) {
 	e.excludedURIDomains = removeDuplicates(e.excludedURIDomains)
 	e.excludedPrincipals = removeDuplicates(e.excludedPrincipals)
 
+	for nameType, values := range e.permittedSubjectAttributes {
+		e.permittedSubjectAttributes[nameType] = removeDuplicates(values)
+	}
+	for nameType, values := range e.excludedSubjectAttributes {
+		e.excludedSubjectAttributes[nameType] = removeDuplicates(values)
+	}
+
 	e.numberOfCommonNameConstraints = len(e.permittedCommonNames) + len(e.excludedCommonNames)
 	e.numberOfDNSDomainConstraints = len(e.permittedDNSDomains) + len(e.excludedDNSDomains)
 	e.numberOfIPRangeConstraints = len(e.permittedIPRanges) + len(e.excludedIPRanges)
@@ -218,12 +255,17 @@ func removeDuplicateIPNets(items []*net.IPNet) (ret []*net.IPNet) {
 	return
 }
 
-// IsX509CertificateAllowed verifies that all SANs in a Certificate are allowed.
+// IsX509CertificateAllowed verifies that all SANs and subject attributes in a
+// Certificate are allowed.
 func (e *NamePolicyEngine) IsX509CertificateAllowed(cert *x509.Certificate) error {
 	if err := e.validateNames(cert.DNSNames, cert.IPAddresses, cert.EmailAddresses, cert.URIs, []string{}); err != nil {
 		return err
 	}
 
+	if err := e.validateSubject(cert.Subject); err != nil {
+		return err
+	}
+
 	if e.verifySubjectCommonName {
 		return e.validateCommonName(cert.Subject.CommonName)
 	}
@@ -237,6 +279,10 @@ func (e *NamePolicyEngine) IsX509CertificateRequestAllowed(csr *x509.Certificate
 		return err
 	}
 
+	if err := e.validateSubject(csr.Subject); err != nil {
+		return err
+	}
+
 	if e.verifySubjectCommonName {
 		return e.validateCommonName(csr.Subject.CommonName)
 	}
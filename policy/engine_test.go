@@ -2487,6 +2487,243 @@ func TestNamePolicyEngine_X509_AllAllowed(t *testing.T) {
 			},
 			want: true,
 		},
+		// SUBJECT ATTRIBUTE TESTS
+		{
+			name: "fail/subject-organization-permitted",
+			options: []NamePolicyOption{
+				WithPermittedSubjectAttributes(OrganizationNameType, "Smallstep Labs"),
+			},
+			cert: &x509.Certificate{
+				Subject: pkix.Name{
+					Organization: []string{"Smallstep Labs", "Evil Corp"},
+				},
+			},
+			want: false,
+			wantErr: &NamePolicyError{
+				Reason:   NotAllowed,
+				NameType: OrganizationNameType,
+				Name:     "Evil Corp",
+			},
+		},
+		{
+			name: "fail/subject-organizational-unit-excluded-wildcard",
+			options: []NamePolicyOption{
+				WithPermittedDNSDomains("*.local"),
+				WithExcludedSubjectAttributes(OrganizationalUnitNameType, "*"),
+			},
+			cert: &x509.Certificate{
+				Subject: pkix.Name{
+					OrganizationalUnit: []string{"Engineering"},
+				},
+				DNSNames: []string{"host.local"},
+			},
+			want: false,
+			wantErr: &NamePolicyError{
+				Reason:   NotAllowed,
+				NameType: OrganizationalUnitNameType,
+				Name:     "Engineering",
+			},
+		},
+		{
+			name: "fail/subject-serial-number-permitted-regex",
+			options: []NamePolicyOption{
+				WithPermittedSubjectAttributes(SerialNumberNameType, `regex:\d{8}`),
+			},
+			cert: &x509.Certificate{
+				Subject: pkix.Name{
+					SerialNumber: "ABC12345",
+				},
+			},
+			want: false,
+			wantErr: &NamePolicyError{
+				Reason:   NotAllowed,
+				NameType: SerialNumberNameType,
+				Name:     "ABC12345",
+			},
+		},
+		{
+			name: "ok/subject-attributes",
+			options: []NamePolicyOption{
+				WithPermittedSubjectAttributes(OrganizationNameType, "Smallstep Labs"),
+				WithPermittedSubjectAttributes(CountryNameType, "US", "CA"),
+				WithPermittedSubjectAttributes(LocalityNameType, "San Francisco"),
+				WithPermittedSubjectAttributes(ProvinceNameType, "California"),
+				WithPermittedSubjectAttributes(SerialNumberNameType, `regex:\d{8}`),
+				WithExcludedSubjectAttributes(OrganizationalUnitNameType, "*"),
+			},
+			cert: &x509.Certificate{
+				Subject: pkix.Name{
+					Organization: []string{"smallstep labs"},
+					Country:      []string{"US"},
+					Locality:     []string{"San Francisco"},
+					Province:     []string{"California"},
+					SerialNumber: "12345678",
+				},
+				DNSNames: []string{"www.example.com"},
+			},
+			want: true,
+		},
+		{
+			name: "ok/subject-attributes-not-set",
+			options: []NamePolicyOption{
+				WithPermittedSubjectAttributes(OrganizationNameType, "Smallstep Labs"),
+			},
+			cert: &x509.Certificate{
+				Subject: pkix.Name{
+					CommonName: "www.example.com",
+				},
+				DNSNames: []string{"www.example.com"},
+			},
+			want: true,
+		},
+		// REGULAR EXPRESSION TESTS
+		{
+			name: "fail/dns-permitted-regex",
+			options: []NamePolicyOption{
+				WithPermittedDNSDomains(`regex:[a-z]{3}-prod-\d+\.internal`),
+			},
+			cert: &x509.Certificate{
+				DNSNames: []string{"web-prod-1.internal.example.com"},
+			},
+			want: false,
+			wantErr: &NamePolicyError{
+				Reason:   NotAllowed,
+				NameType: DNSNameType,
+				Name:     "web-prod-1.internal.example.com",
+			},
+		},
+		{
+			name: "fail/dns-permitted-regex-wildcard-literal",
+			options: []NamePolicyOption{
+				WithPermittedDNSDomains(`regex:.*\.internal`),
+			},
+			cert: &x509.Certificate{
+				DNSNames: []string{"*.internal"},
+			},
+			want: false,
+			wantErr: &NamePolicyError{
+				Reason:   NotAllowed,
+				NameType: DNSNameType,
+				Name:     "*.internal",
+			},
+		},
+		{
+			name: "fail/dns-excluded-regex",
+			options: []NamePolicyOption{
+				WithPermittedDNSDomains("*.internal"),
+				WithExcludedDNSDomains(`regex:.+-dev-\d+\.internal`),
+			},
+			cert: &x509.Certificate{
+				DNSNames: []string{"web-prod-1.internal", "web-dev-1.internal"},
+			},
+			want: false,
+			wantErr: &NamePolicyError{
+				Reason:   NotAllowed,
+				NameType: DNSNameType,
+				Name:     "web-dev-1.internal",
+			},
+		},
+		{
+			name: "fail/email-permitted-regex",
+			options: []NamePolicyOption{
+				WithPermittedEmailAddresses(`regex:[a-z]+\.[a-z]+@example\.com`),
+			},
+			cert: &x509.Certificate{
+				EmailAddresses: []string{"jane@example.com"},
+			},
+			want: false,
+			wantErr: &NamePolicyError{
+				Reason:   NotAllowed,
+				NameType: EmailNameType,
+				Name:     "jane@example.com",
+			},
+		},
+		{
+			name: "fail/uri-permitted-regex",
+			options: []NamePolicyOption{
+				WithPermittedURIDomains(`regex:spiffe://example\.com/ns/[a-z-]+/sa/[a-z-]+`),
+			},
+			cert: &x509.Certificate{
+				URIs: []*url.URL{
+					{
+						Scheme: "spiffe",
+						Host:   "example.com",
+						Path:   "/ns/default/sa/web/extra",
+					},
+				},
+			},
+			want: false,
+			wantErr: &NamePolicyError{
+				Reason:   NotAllowed,
+				NameType: URINameType,
+				Name:     "spiffe://example.com/ns/default/sa/web/extra",
+			},
+		},
+		{
+			name: "fail/cn-permitted-regex",
+			options: []NamePolicyOption{
+				WithSubjectCommonNameVerification(),
+				WithPermittedCommonNames(`regex:runner-\d+`),
+				WithPermittedDNSDomains("*.local"),
+			},
+			cert: &x509.Certificate{
+				Subject: pkix.Name{
+					CommonName: "builder-1",
+				},
+			},
+			want: false,
+			wantErr: &NamePolicyError{
+				Reason:   NotAllowed,
+				NameType: CNNameType,
+				Name:     "builder-1",
+			},
+		},
+		{
+			name: "ok/dns-permitted-regex",
+			options: []NamePolicyOption{
+				WithPermittedDNSDomains(`regex:[a-z]{3}-prod-\d+\.internal`),
+			},
+			cert: &x509.Certificate{
+				DNSNames: []string{"web-prod-1.internal", "api-prod-12.internal"},
+			},
+			want: true,
+		},
+		{
+			name: "ok/dns-permitted-regex-wildcard-literal",
+			options: []NamePolicyOption{
+				WithPermittedDNSDomains(`regex:\*\.internal`),
+				WithAllowLiteralWildcardNames(),
+			},
+			cert: &x509.Certificate{
+				DNSNames: []string{"*.internal"},
+			},
+			want: true,
+		},
+		{
+			name: "ok/combined-regex",
+			options: []NamePolicyOption{
+				WithSubjectCommonNameVerification(),
+				WithPermittedCommonNames(`regex:[a-z]+-\d+`),
+				WithPermittedDNSDomains("*.local", `regex:[a-z]{3}-prod-\d+\.internal`),
+				WithPermittedEmailAddresses(`regex:[a-z]+\.[a-z]+@example\.com`),
+				WithPermittedURIDomains(`regex:spiffe://example\.com/ns/[a-z-]+/sa/[a-z-]+`),
+			},
+			cert: &x509.Certificate{
+				Subject: pkix.Name{
+					CommonName: "runner-42",
+				},
+				DNSNames:       []string{"host.local", "web-prod-1.internal"},
+				EmailAddresses: []string{"jane.doe@example.com"},
+				URIs: []*url.URL{
+					{
+						Scheme: "spiffe",
+						Host:   "example.com",
+						Path:   "/ns/default/sa/web",
+					},
+				},
+			},
+			want: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -3023,6 +3260,39 @@ func TestNamePolicyEngine_SSH_ArePrincipalsAllowed(t *testing.T) {
 			},
 			want: true,
 		},
+		{
+			name: "fail/user-with-permitted-regex-principal",
+			options: []NamePolicyOption{
+				WithPermittedPrincipals(`regex:svc-[a-z]+`),
+			},
+			cert: &ssh.Certificate{
+				CertType: ssh.UserCert,
+				ValidPrincipals: []string{
+					"svc-deploy",
+					"root",
+				},
+			},
+			want: false,
+			wantErr: &NamePolicyError{
+				Reason:   NotAllowed,
+				NameType: PrincipalNameType,
+				Name:     "root",
+			},
+		},
+		{
+			name: "ok/host-with-permitted-regex-dns-domain",
+			options: []NamePolicyOption{
+				WithPermittedDNSDomains(`regex:node-\d+\.cluster\.local`),
+			},
+			cert: &ssh.Certificate{
+				CertType: ssh.HostCert,
+				ValidPrincipals: []string{
+					"node-1.cluster.local",
+					"node-23.cluster.local",
+				},
+			},
+			want: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -3,6 +3,7 @@ package policy
 import (
 	"fmt"
 	"net"
+	"regexp"
 	"strings"
 
 	"golang.org/x/net/idna"
@@ -10,6 +11,13 @@ import (
 
 type NamePolicyOption func(e *NamePolicyEngine) error
 
+// RegexConstraintPrefix is the prefix of the constraints using a regular
+// expression instead of a literal or wildcard match, e.g.
+// "regex:[a-z]{3}-prod-\d+\.internal". The expression must match the full
+// name. Regular expressions are supported in common name, DNS, email, URI and
+// principal constraints.
+const RegexConstraintPrefix = "regex:"
+
 // TODO: wrap (more) errors; and prove a set of known (exported) errors
 
 func WithSubjectCommonNameVerification() NamePolicyOption {
@@ -30,7 +38,7 @@ func WithPermittedCommonNames(commonNames ...string) NamePolicyOption {
 	return func(g *NamePolicyEngine) error {
 		normalizedCommonNames := make([]string, len(commonNames))
 		for i, commonName := range commonNames {
-			normalizedCommonName, err := normalizeAndValidateCommonName(commonName)
+			normalizedCommonName, err := g.normalizeConstraint(commonName, normalizeAndValidateCommonName)
 			if err != nil {
 				return fmt.Errorf("cannot parse permitted common name constraint %q: %w", commonName, err)
 			}
@@ -45,7 +53,7 @@ func WithExcludedCommonNames(commonNames ...string) NamePolicyOption {
 	return func(g *NamePolicyEngine) error {
 		normalizedCommonNames := make([]string, len(commonNames))
 		for i, commonName := range commonNames {
-			normalizedCommonName, err := normalizeAndValidateCommonName(commonName)
+			normalizedCommonName, err := g.normalizeConstraint(commonName, normalizeAndValidateCommonName)
 			if err != nil {
 				return fmt.Errorf("cannot parse excluded common name constraint %q: %w", commonName, err)
 			}
@@ -60,7 +68,7 @@ func WithPermittedDNSDomains(domains ...string) NamePolicyOption {
 	return func(e *NamePolicyEngine) error {
 		normalizedDomains := make([]string, len(domains))
 		for i, domain := range domains {
-			normalizedDomain, err := normalizeAndValidateDNSDomainConstraint(domain)
+			normalizedDomain, err := e.normalizeConstraint(domain, normalizeAndValidateDNSDomainConstraint)
 			if err != nil {
 				return fmt.Errorf("cannot parse permitted domain constraint %q: %w", domain, err)
 			}
@@ -75,7 +83,7 @@ func WithExcludedDNSDomains(domains ...string) NamePolicyOption {
 	return func(e *NamePolicyEngine) error {
 		normalizedDomains := make([]string, len(domains))
 		for i, domain := range domains {
-			normalizedDomain, err := normalizeAndValidateDNSDomainConstraint(domain)
+			normalizedDomain, err := e.normalizeConstraint(domain, normalizeAndValidateDNSDomainConstraint)
 			if err != nil {
 				return fmt.Errorf("cannot parse excluded domain constraint %q: %w", domain, err)
 			}
@@ -170,7 +178,7 @@ func WithPermittedEmailAddresses(emailAddresses ...string) NamePolicyOption {
 	return func(e *NamePolicyEngine) error {
 		normalizedEmailAddresses := make([]string, len(emailAddresses))
 		for i, email := range emailAddresses {
-			normalizedEmailAddress, err := normalizeAndValidateEmailConstraint(email)
+			normalizedEmailAddress, err := e.normalizeConstraint(email, normalizeAndValidateEmailConstraint)
 			if err != nil {
 				return fmt.Errorf("cannot parse permitted email constraint %q: %w", email, err)
 			}
@@ -185,7 +193,7 @@ func WithExcludedEmailAddresses(emailAddresses ...string) NamePolicyOption {
 	return func(e *NamePolicyEngine) error {
 		normalizedEmailAddresses := make([]string, len(emailAddresses))
 		for i, email := range emailAddresses {
-			normalizedEmailAddress, err := normalizeAndValidateEmailConstraint(email)
+			normalizedEmailAddress, err := e.normalizeConstraint(email, normalizeAndValidateEmailConstraint)
 			if err != nil {
 				return fmt.Errorf("cannot parse excluded email constraint %q: %w", email, err)
 			}
@@ -200,7 +208,7 @@ func WithPermittedURIDomains(uriDomains ...string) NamePolicyOption {
 	return func(e *NamePolicyEngine) error {
 		normalizedURIDomains := make([]string, len(uriDomains))
 		for i, domain := range uriDomains {
-			normalizedURIDomain, err := normalizeAndValidateURIDomainConstraint(domain)
+			normalizedURIDomain, err := e.normalizeConstraint(domain, normalizeAndValidateURIDomainConstraint)
 			if err != nil {
 				return fmt.Errorf("cannot parse permitted URI domain constraint %q: %w", domain, err)
 			}
@@ -215,7 +223,7 @@ func WithExcludedURIDomains(domains ...string) NamePolicyOption {
 	return func(e *NamePolicyEngine) error {
 		normalizedURIDomains := make([]string, len(domains))
 		for i, domain := range domains {
-			normalizedURIDomain, err := normalizeAndValidateURIDomainConstraint(domain)
+			normalizedURIDomain, err := e.normalizeConstraint(domain, normalizeAndValidateURIDomainConstraint)
 			if err != nil {
 				return fmt.Errorf("cannot parse excluded URI domain constraint %q: %w", domain, err)
 			}
@@ -228,6 +236,11 @@ func WithExcludedURIDomains(domains ...string) NamePolicyOption {
 
 func WithPermittedPrincipals(principals ...string) NamePolicyOption {
 	return func(g *NamePolicyEngine) error {
+		for _, principal := range principals {
+			if _, err := g.normalizeConstraint(principal, normalizeAndValidatePrincipal); err != nil {
+				return fmt.Errorf("cannot parse permitted principal constraint %q: %w", principal, err)
+			}
+		}
 		g.permittedPrincipals = principals
 		return nil
 	}
@@ -235,11 +248,111 @@ func WithPermittedPrincipals(principals ...string) NamePolicyOption {
 
 func WithExcludedPrincipals(principals ...string) NamePolicyOption {
 	return func(g *NamePolicyEngine) error {
+		for _, principal := range principals {
+			if _, err := g.normalizeConstraint(principal, normalizeAndValidatePrincipal); err != nil {
+				return fmt.Errorf("cannot parse excluded principal constraint %q: %w", principal, err)
+			}
+		}
 		g.excludedPrincipals = principals
 		return nil
 	}
 }
 
+// WithPermittedSubjectAttributes sets the permitted values of an attribute of
+// the subject distinguished name, e.g. the OrganizationNameType. If set, all
+// the values of the attribute in a certificate must match one of them. Subjects
+// without the attribute are not affected.
+func WithPermittedSubjectAttributes(nameType NameType, values ...string) NamePolicyOption {
+	return func(e *NamePolicyEngine) error {
+		normalizedValues, err := e.normalizeSubjectAttributeConstraints(nameType, values)
+		if err != nil {
+			return fmt.Errorf("cannot parse permitted %s constraint: %w", nameType, err)
+		}
+		if e.permittedSubjectAttributes == nil {
+			e.permittedSubjectAttributes = make(map[NameType][]string)
+		}
+		e.permittedSubjectAttributes[nameType] = normalizedValues
+		return nil
+	}
+}
+
+// WithExcludedSubjectAttributes sets the excluded values of an attribute of
+// the subject distinguished name, e.g. the OrganizationNameType. The value "*"
+// excludes any value of the attribute.
+func WithExcludedSubjectAttributes(nameType NameType, values ...string) NamePolicyOption {
+	return func(e *NamePolicyEngine) error {
+		normalizedValues, err := e.normalizeSubjectAttributeConstraints(nameType, values)
+		if err != nil {
+			return fmt.Errorf("cannot parse excluded %s constraint: %w", nameType, err)
+		}
+		if e.excludedSubjectAttributes == nil {
+			e.excludedSubjectAttributes = make(map[NameType][]string)
+		}
+		e.excludedSubjectAttributes[nameType] = normalizedValues
+		return nil
+	}
+}
+
+func (e *NamePolicyEngine) normalizeSubjectAttributeConstraints(nameType NameType, values []string) ([]string, error) {
+	if !isSubjectAttributeNameType(nameType) {
+		return nil, fmt.Errorf("%q is not a supported subject attribute", nameType)
+	}
+	normalizedValues := make([]string, len(values))
+	for i, value := range values {
+		normalizedValue, err := e.normalizeConstraint(value, normalizeAndValidateSubjectAttribute)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", value, err)
+		}
+		normalizedValues[i] = normalizedValue
+	}
+	return normalizedValues, nil
+}
+
+func isSubjectAttributeNameType(nameType NameType) bool {
+	for _, t := range subjectAttributeNameTypes {
+		if t == nameType {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeConstraint normalizes and validates a constraint using the given
+// function. Regular expression constraints are kept as they are, and the
+// compiled expression is stored in the engine.
+func (e *NamePolicyEngine) normalizeConstraint(constraint string, normalize func(string) (string, error)) (string, error) {
+	expr, ok := strings.CutPrefix(constraint, RegexConstraintPrefix)
+	if !ok {
+		return normalize(constraint)
+	}
+	if strings.TrimSpace(expr) == "" {
+		return "", fmt.Errorf("regular expression constraint %q cannot be empty", constraint)
+	}
+	re, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		return "", fmt.Errorf("invalid regular expression constraint %q: %w", constraint, err)
+	}
+	if e.regexConstraints == nil {
+		e.regexConstraints = make(map[string]*regexp.Regexp)
+	}
+	e.regexConstraints[constraint] = re
+	return constraint, nil
+}
+
+func normalizeAndValidateSubjectAttribute(constraint string) (string, error) {
+	normalizedConstraint := strings.TrimSpace(constraint)
+	if normalizedConstraint == "" {
+		return "", fmt.Errorf("subject attribute constraint %q cannot be empty", constraint)
+	}
+	return normalizedConstraint, nil
+}
+
+// normalizeAndValidatePrincipal returns the principal constraint as it is, the
+// principals are matched literally.
+func normalizeAndValidatePrincipal(constraint string) (string, error) {
+	return constraint, nil
+}
+
 func networkFor(ip net.IP) *net.IPNet {
 	var mask net.IPMask
 	if !isIPv4(ip) {
@@ -272,6 +272,51 @@ func TestNew(t *testing.T) {
 				wantErr: true,
 			}
 		},
+		"fail/with-permitted-dns-domains-regex": func(t *testing.T) test {
+			return test{
+				options: []NamePolicyOption{
+					WithPermittedDNSDomains("regex:[a-z"),
+				},
+				want:    nil,
+				wantErr: true,
+			}
+		},
+		"fail/with-excluded-email-addresses-regex-empty": func(t *testing.T) test {
+			return test{
+				options: []NamePolicyOption{
+					WithExcludedEmailAddresses("regex:"),
+				},
+				want:    nil,
+				wantErr: true,
+			}
+		},
+		"fail/with-permitted-principals-regex": func(t *testing.T) test {
+			return test{
+				options: []NamePolicyOption{
+					WithPermittedPrincipals("regex:(svc"),
+				},
+				want:    nil,
+				wantErr: true,
+			}
+		},
+		"fail/with-permitted-subject-attributes-name-type": func(t *testing.T) test {
+			return test{
+				options: []NamePolicyOption{
+					WithPermittedSubjectAttributes(DNSNameType, "example.com"),
+				},
+				want:    nil,
+				wantErr: true,
+			}
+		},
+		"fail/with-excluded-subject-attributes-empty": func(t *testing.T) test {
+			return test{
+				options: []NamePolicyOption{
+					WithExcludedSubjectAttributes(OrganizationNameType, " "),
+				},
+				want:    nil,
+				wantErr: true,
+			}
+		},
 		"fail/with-permitted-cidrs": func(t *testing.T) test {
 			return test{
 				options: []NamePolicyOption{
@@ -8,6 +8,7 @@ package policy
 
 import (
 	"bytes"
+	"crypto/x509/pkix"
 	"errors"
 	"fmt"
 	"net"
@@ -75,6 +76,10 @@ func (e *NamePolicyEngine) validateNames(dnsNames []string, ips []net.IP, emailA
 		}
 		if err := checkNameConstraints(DNSNameType, dns, parsedDNS,
 			func(parsedName, constraint interface{}) (bool, error) {
+				if match, ok := e.matchRegexConstraint(parsedName.(string), constraint.(string)); ok {
+					// literal wildcards are only allowed if configured
+					return match && (e.allowLiteralWildcardNames || !strings.HasPrefix(parsedName.(string), "*.")), nil
+				}
 				return e.matchDomainConstraint(parsedName.(string), constraint.(string))
 			}, e.permittedDNSDomains, e.excludedDNSDomains); err != nil {
 			return err
@@ -131,6 +136,9 @@ func (e *NamePolicyEngine) validateNames(dnsNames []string, ips []net.IP, emailA
 		mailbox.domain = domainASCII
 		if err := checkNameConstraints(EmailNameType, email, mailbox,
 			func(parsedName, constraint interface{}) (bool, error) {
+				if match, ok := e.matchRegexConstraint(email, constraint.(string)); ok {
+					return match, nil
+				}
 				return e.matchEmailConstraint(parsedName.(rfc2821Mailbox), constraint.(string))
 			}, e.permittedEmailAddresses, e.excludedEmailAddresses); err != nil {
 			return err
@@ -152,6 +160,9 @@ func (e *NamePolicyEngine) validateNames(dnsNames []string, ips []net.IP, emailA
 		// it's transformed into ASCII. Prevent that here?
 		if err := checkNameConstraints(URINameType, uri.String(), uri,
 			func(parsedName, constraint interface{}) (bool, error) {
+				if match, ok := e.matchRegexConstraint(parsedName.(*url.URL).String(), constraint.(string)); ok {
+					return match, nil
+				}
 				return e.matchURIConstraint(parsedName.(*url.URL), constraint.(string))
 			}, e.permittedURIDomains, e.excludedURIDomains); err != nil {
 			return err
@@ -170,6 +181,9 @@ func (e *NamePolicyEngine) validateNames(dnsNames []string, ips []net.IP, emailA
 		// TODO: some validation? I.e. allowed characters?
 		if err := checkNameConstraints(PrincipalNameType, principal, principal,
 			func(parsedName, constraint interface{}) (bool, error) {
+				if match, ok := e.matchRegexConstraint(parsedName.(string), constraint.(string)); ok {
+					return match, nil
+				}
 				return matchPrincipalConstraint(parsedName.(string), constraint.(string))
 			}, e.permittedPrincipals, e.excludedPrincipals); err != nil {
 			return err
@@ -198,6 +212,9 @@ func (e *NamePolicyEngine) validateCommonName(commonName string) error {
 		// explicitly allowed and nil is returned immediately.
 		if err := checkNameConstraints(CNNameType, commonName, commonName,
 			func(parsedName, constraint interface{}) (bool, error) {
+				if match, ok := e.matchRegexConstraint(parsedName.(string), constraint.(string)); ok {
+					return match, nil
+				}
 				return matchCommonNameConstraint(parsedName.(string), constraint.(string))
 			}, e.permittedCommonNames, e.excludedCommonNames); err == nil {
 			return nil
@@ -220,6 +237,56 @@ func (e *NamePolicyEngine) validateCommonName(commonName string) error {
 	return err
 }
 
+// validateSubject verifies that the attributes of the subject distinguished
+// name are allowed.
+func (e *NamePolicyEngine) validateSubject(subject pkix.Name) error {
+	// nothing to compare against; return early
+	if len(e.permittedSubjectAttributes) == 0 && len(e.excludedSubjectAttributes) == 0 {
+		return nil
+	}
+
+	for _, nameType := range subjectAttributeNameTypes {
+		permitted, excluded := e.permittedSubjectAttributes[nameType], e.excludedSubjectAttributes[nameType]
+		if len(permitted) == 0 && len(excluded) == 0 {
+			continue
+		}
+		for _, value := range subjectAttributeValues(subject, nameType) {
+			if err := checkNameConstraints(nameType, value, value,
+				func(parsedName, constraint interface{}) (bool, error) {
+					if match, ok := e.matchRegexConstraint(parsedName.(string), constraint.(string)); ok {
+						return match, nil
+					}
+					return matchSubjectAttributeConstraint(parsedName.(string), constraint.(string))
+				}, permitted, excluded); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// subjectAttributeValues returns the values of an attribute of the subject.
+func subjectAttributeValues(subject pkix.Name, nameType NameType) []string {
+	switch nameType {
+	case OrganizationNameType:
+		return subject.Organization
+	case OrganizationalUnitNameType:
+		return subject.OrganizationalUnit
+	case CountryNameType:
+		return subject.Country
+	case LocalityNameType:
+		return subject.Locality
+	case ProvinceNameType:
+		return subject.Province
+	case SerialNumberNameType:
+		if subject.SerialNumber != "" {
+			return []string{subject.SerialNumber}
+		}
+	}
+	return nil
+}
+
 // checkNameConstraints checks that a name, of type nameType is permitted.
 // The argument parsedName contains the parsed form of name, suitable for passing
 // to the match function.
@@ -626,6 +693,17 @@ func (e *NamePolicyEngine) matchURIConstraint(uri *url.URL, constraint string) (
 	return e.matchDomainConstraint(host, constraint)
 }
 
+// matchRegexConstraint matches a name against a regular expression constraint.
+// The second value returned is false if the constraint is not a regular
+// expression.
+func (e *NamePolicyEngine) matchRegexConstraint(name, constraint string) (match, ok bool) {
+	re, ok := e.regexConstraints[constraint]
+	if !ok {
+		return false, false
+	}
+	return re.MatchString(name), true
+}
+
 // matchPrincipalConstraint performs a string literal equality check against a constraint.
 func matchPrincipalConstraint(principal, constraint string) (bool, error) {
 	// allow any plain principal when wildcard constraint is used
@@ -635,6 +713,15 @@ func matchPrincipalConstraint(principal, constraint string) (bool, error) {
 	return strings.EqualFold(principal, constraint), nil
 }
 
+// matchSubjectAttributeConstraint performs a string literal equality check
+// against a constraint. The wildcard constraint matches any value.
+func matchSubjectAttributeConstraint(value, constraint string) (bool, error) {
+	if constraint == "*" {
+		return true, nil
+	}
+	return strings.EqualFold(value, constraint), nil
+}
+
 // matchCommonNameConstraint performs a string literal equality check against constraint.
 func matchCommonNameConstraint(commonName, constraint string) (bool, error) {
 	// wildcard constraint is (currently) not supported for common names
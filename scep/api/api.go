@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"net/url"
 	"strings"
@@ -24,15 +25,14 @@ import (
 )
 
 const (
-	opnGetCACert    = "GetCACert"
-	opnGetCACaps    = "GetCACaps"
-	opnPKIOperation = "PKIOperation"
+	opnGetCACert     = "GetCACert"
+	opnGetNextCACert = "GetNextCACert"
+	opnGetCACaps     = "GetCACaps"
+	opnPKIOperation  = "PKIOperation"
 
 	// TODO: add other (more optional) operations and handling
 )
 
-const maxPayloadSize = 2 << 20
-
 // request is a SCEP server request.
 type request struct {
 	Operation string
@@ -107,6 +107,8 @@ func Get(w http.ResponseWriter, r *http.Request) {
 	switch req.Operation {
 	case opnGetCACert:
 		res, err = GetCACert(ctx)
+	case opnGetNextCACert:
+		res, err = GetNextCACert(ctx)
 	case opnGetCACaps:
 		res, err = GetCACaps(ctx)
 	case opnPKIOperation:
@@ -164,7 +166,7 @@ func decodeRequest(r *http.Request) (request, error) {
 	switch method {
 	case http.MethodGet:
 		switch operation {
-		case opnGetCACert, opnGetCACaps:
+		case opnGetCACert, opnGetNextCACert, opnGetCACaps:
 			return request{
 				Operation: operation,
 				Message:   []byte{},
@@ -183,19 +185,58 @@ func decodeRequest(r *http.Request) (request, error) {
 			return request{}, fmt.Errorf("unsupported operation: %s", operation)
 		}
 	case http.MethodPost:
-		body, err := io.ReadAll(io.LimitReader(r.Body, maxPayloadSize))
+		body, err := io.ReadAll(r.Body)
 		if err != nil {
 			return request{}, fmt.Errorf("failed reading request body: %w", err)
 		}
+		message, err := decodeBody(r.Header.Get("Content-Type"), body)
+		if err != nil {
+			return request{}, fmt.Errorf("failed decoding message: %w", err)
+		}
 		return request{
 			Operation: operation,
-			Message:   body,
+			Message:   message,
 		}, nil
 	default:
 		return request{}, fmt.Errorf("unsupported method: %s", method)
 	}
 }
 
+// errUnsupportedContentType is returned when the body of a POST request is
+// sent with an unsupported content type.
+var errUnsupportedContentType = errors.New("unsupported content type")
+
+// decodeBody returns the message sent in the body of a POST request. RFC 8894
+// defines the body as the binary PKCS#7 message, sent with the
+// application/x-pki-message content type, but some clients send it base64
+// encoded as text/plain or application/x-www-form-urlencoded.
+func decodeBody(contentType string, body []byte) ([]byte, error) {
+	if len(body) == 0 {
+		return nil, errors.New("message must not be empty")
+	}
+	if contentType == "" {
+		return body, nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("invalid content type %q: %w", contentType, err)
+	}
+
+	switch mediaType {
+	case "application/x-pki-message", "application/octet-stream", "application/pkcs7-mime":
+		return body, nil
+	case "text/plain", "application/x-www-form-urlencoded":
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(body)))
+		if err != nil {
+			return nil, fmt.Errorf("failed base64 decoding message: %w", err)
+		}
+		return decoded, nil
+	default:
+		return nil, fmt.Errorf("%w %q", errUnsupportedContentType, mediaType)
+	}
+}
+
 func decodeMessage(message string, r *http.Request) ([]byte, error) {
 	if message == "" {
 		return nil, errors.New("message must not be empty")
@@ -292,6 +333,10 @@ func lookupProvisioner(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
+		// limit the size of the SCEP messages sent in the body; the chunked
+		// requests are also limited while reading them.
+		r.Body = http.MaxBytesReader(w, r.Body, prov.GetMaxMessageSize())
+
 		ctx = scep.NewProvisionerContext(ctx, scep.Provisioner(prov))
 		next(w, r.WithContext(ctx))
 	}
@@ -330,6 +375,21 @@ func GetCACert(ctx context.Context) (Response, error) {
 	return res, nil
 }
 
+// GetNextCACert returns the CA certificate staged for a CA rollover in a
+// SCEP response.
+func GetNextCACert(ctx context.Context) (Response, error) {
+	auth := scep.MustFromContext(ctx)
+	data, err := auth.GetNextCACert(ctx)
+	if err != nil {
+		return Response{}, err
+	}
+
+	return Response{
+		Operation: opnGetNextCACert,
+		Data:      data,
+	}, nil
+}
+
 // GetCACaps returns the CA capabilities in a SCEP response
 func GetCACaps(ctx context.Context) (Response, error) {
 	auth := scep.MustFromContext(ctx)
@@ -384,7 +444,16 @@ func PKIOperation(ctx context.Context, req request) (Response, error) {
 	// even if using the renewal flow as described in the README.md. MicroMDM SCEP client also only does PKCSreq by default, unless
 	// a certificate exists; then it will use RenewalReq. Adding the challenge check here may be a small breaking change for clients.
 	// We'll have to see how it works out.
-	if msg.MessageType == smallscep.PKCSReq || msg.MessageType == smallscep.RenewalReq {
+	//
+	// If renewals are enabled in the provisioner, a RenewalReq is authenticated by the certificate that signs the request, which
+	// must be issued by the CA, and the challenge is not used.
+	switch {
+	case msg.MessageType == smallscep.RenewalReq && auth.IsRenewalAllowed(ctx):
+		if err := auth.ValidateRenewal(ctx, csr, msg); err != nil {
+			scepErr := errors.New("failed validating renewal request")
+			return createFailureResponse(ctx, csr, msg, smallscep.BadRequest, scepErr.Error(), fmt.Errorf("%w: %w", scepErr, err))
+		}
+	case msg.MessageType == smallscep.PKCSReq || msg.MessageType == smallscep.RenewalReq:
 		if err := auth.ValidateChallenge(ctx, csr, challengePassword, transactionID); err != nil {
 			if errors.Is(err, provisioner.ErrSCEPChallengeInvalid) {
 				return createFailureResponse(ctx, csr, msg, smallscep.BadRequest, err.Error(), err)
@@ -394,14 +463,6 @@ func PKIOperation(ctx context.Context, req request) (Response, error) {
 		}
 	}
 
-	// TODO: authorize renewal: we can authorize renewals with the challenge password (if reusable secrets are used).
-	// Renewals OPTIONALLY include the challenge if the existing cert is used as authentication, but client SHOULD omit the challenge.
-	// This means that for renewal requests we should check the certificate provided to be signed before by the CA. We could
-	// enforce use of the challenge if we want too. That way we could be more flexible in terms of authentication scheme (i.e. reusing
-	// tokens from other provisioners, calling a webhook, storing multiple secrets, allowing them to be multi-use, etc).
-	// Authentication by the (self-signed) certificate with an optional challenge is required; supporting renewals incl. verification
-	// of the client cert is not.
-
 	certRep, err := auth.SignCSR(ctx, csr, msg)
 	if err != nil {
 		if notifyErr := auth.NotifyFailure(ctx, csr, transactionID, 0, err.Error()); notifyErr != nil {
@@ -446,7 +507,16 @@ func writeResponse(w http.ResponseWriter, res Response) {
 func fail(w http.ResponseWriter, err error) {
 	log.Error(w, err)
 
-	http.Error(w, err.Error(), http.StatusInternalServerError)
+	status := http.StatusInternalServerError
+	var mbe *http.MaxBytesError
+	switch {
+	case errors.As(err, &mbe):
+		status = http.StatusRequestEntityTooLarge
+	case errors.Is(err, errUnsupportedContentType):
+		status = http.StatusUnsupportedMediaType
+	}
+
+	http.Error(w, err.Error(), status)
 }
 
 func createFailureResponse(ctx context.Context, csr *x509.CertificateRequest, msg *scep.PKIMessage, info smallscep.FailInfo, infoText string, failError error) (Response, error) {
@@ -471,6 +541,8 @@ func contentHeader(r Response) string {
 			return "application/x-x509-ca-ra-cert"
 		}
 		return "application/x-x509-ca-cert"
+	case opnGetNextCACert:
+		return "application/x-x509-next-ca-cert"
 	case opnPKIOperation:
 		return "application/x-pki-message"
 	}
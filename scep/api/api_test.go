@@ -3,9 +3,16 @@ package api
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/base64"
+	"encoding/pem"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -13,11 +20,25 @@ import (
 	"testing"
 	"testing/iotest"
 
+	"github.com/smallstep/pkcs7"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/minica"
+	"go.step.sm/crypto/pemutil"
+
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/scep"
 )
 
 func Test_decodeRequest(t *testing.T) {
+	newPostRequest := func(contentType string, body io.Reader) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "http://scep:8080/?operation=PKIOperation", body)
+		r.Header.Set("Content-Type", contentType)
+		return r
+	}
+	chunked := newPostRequest("application/x-pki-message", iotest.OneByteReader(strings.NewReader("1234")))
+	chunked.ContentLength = -1
 	randomB64 := "wx/1mQ49TpdLRfvVjQhXNSe8RB3hjZEarqYp5XVIxpSbvOhQSs8hP2TgucID1IputbA8JC6CbsUpcVae3+8hRNqs5pTsSHP2aNxsw8AHGSX9dZVymSclkUV8irk+ztfEfs7aLA=="
 	expectedRandom, err := base64.StdEncoding.DecodeString(randomB64)
 	require.NoError(t, err)
@@ -100,6 +121,17 @@ func Test_decodeRequest(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "ok/get-GetNextCACert",
+			args: args{
+				r: httptest.NewRequest(http.MethodGet, "http://scep:8080/?operation=GetNextCACert", http.NoBody),
+			},
+			want: request{
+				Operation: "GetNextCACert",
+				Message:   []byte{},
+			},
+			wantErr: false,
+		},
 		{
 			name: "ok/get-GetCACaps",
 			args: args{
@@ -166,6 +198,63 @@ func Test_decodeRequest(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "ok/post-PKIOperation-pki-message",
+			args: args{
+				r: newPostRequest("application/x-pki-message", bytes.NewBufferString("1234")),
+			},
+			want: request{
+				Operation: "PKIOperation",
+				Message:   []byte("1234"),
+			},
+			wantErr: false,
+		},
+		{
+			name: "ok/post-PKIOperation-chunked",
+			args: args{
+				r: chunked,
+			},
+			want: request{
+				Operation: "PKIOperation",
+				Message:   []byte("1234"),
+			},
+			wantErr: false,
+		},
+		{
+			name: "ok/post-PKIOperation-base64",
+			args: args{
+				r: newPostRequest("text/plain; charset=utf-8", bytes.NewBufferString("MTIzNA==\n")),
+			},
+			want: request{
+				Operation: "PKIOperation",
+				Message:   []byte("1234"),
+			},
+			wantErr: false,
+		},
+		{
+			name: "fail/post-PKIOperation-base64",
+			args: args{
+				r: newPostRequest("text/plain", bytes.NewBufferString("not-base64")),
+			},
+			want:    request{},
+			wantErr: true,
+		},
+		{
+			name: "fail/post-PKIOperation-content-type",
+			args: args{
+				r: newPostRequest("application/json", bytes.NewBufferString("1234")),
+			},
+			want:    request{},
+			wantErr: true,
+		},
+		{
+			name: "fail/post-PKIOperation-empty",
+			args: args{
+				r: newPostRequest("application/x-pki-message", http.NoBody),
+			},
+			want:    request{},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -181,3 +270,146 @@ func Test_decodeRequest(t *testing.T) {
 		})
 	}
 }
+
+func TestGetCACert(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ra, err := ca.Sign(&x509.Certificate{
+		Subject:   pkix.Name{CommonName: "SCEP decrypter"},
+		PublicKey: key.Public(),
+	})
+	require.NoError(t, err)
+	block, err := pemutil.Serialize(key, pemutil.WithPassword([]byte("password")))
+	require.NoError(t, err)
+
+	auth, err := scep.New(nil, scep.Options{
+		Roots:         []*x509.Certificate{ca.Root},
+		Intermediates: []*x509.Certificate{ca.Intermediate},
+		SignerCert:    ca.Intermediate,
+	})
+	require.NoError(t, err)
+
+	newProvisioner := func(t *testing.T, fn func(p *provisioner.SCEP)) *provisioner.SCEP {
+		t.Helper()
+		p := &provisioner.SCEP{
+			Type:                 "SCEP",
+			Name:                 "scep",
+			ChallengePassword:    "password123",
+			DecrypterCertificate: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ra.Raw}),
+			DecrypterKeyPEM:      pem.EncodeToMemory(block),
+			DecrypterKeyPassword: "password",
+		}
+		fn(p)
+		require.NoError(t, p.Init(provisioner.Config{Claims: config.GlobalProvisionerClaims}))
+		return p
+	}
+
+	tests := []struct {
+		name string
+		fn   func(p *provisioner.SCEP)
+		want []*x509.Certificate
+	}{
+		{"ok default", func(p *provisioner.SCEP) {}, []*x509.Certificate{ra, ca.Intermediate}},
+		{"ok leafFirst", func(p *provisioner.SCEP) {
+			p.IncludeRoot = true
+			p.ChainOrder = provisioner.SCEPChainOrderLeafFirst
+		}, []*x509.Certificate{ra, ca.Intermediate, ca.Root}},
+		{"ok caFirst", func(p *provisioner.SCEP) {
+			p.IncludeRoot = true
+			p.ChainOrder = provisioner.SCEPChainOrderCAFirst
+		}, []*x509.Certificate{ca.Root, ca.Intermediate, ra}},
+		{"ok excludeRA", func(p *provisioner.SCEP) {
+			p.IncludeRoot = true
+			p.ExcludeRA = true
+		}, []*x509.Certificate{ca.Intermediate, ca.Root}},
+		{"ok excludeRA caFirst", func(p *provisioner.SCEP) {
+			p.IncludeRoot = true
+			p.ExcludeRA = true
+			p.ChainOrder = provisioner.SCEPChainOrderCAFirst
+		}, []*x509.Certificate{ca.Root, ca.Intermediate}},
+		{"ok excludeIntermediate caFirst", func(p *provisioner.SCEP) {
+			p.IncludeRoot = true
+			p.ExcludeIntermediate = true
+			p.ChainOrder = provisioner.SCEPChainOrderCAFirst
+		}, []*x509.Certificate{ca.Root, ra}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := scep.NewContext(context.Background(), auth)
+			ctx = scep.NewProvisionerContext(ctx, newProvisioner(t, tt.fn))
+
+			res, err := GetCACert(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, len(tt.want), res.CACertNum)
+
+			p7, err := pkcs7.Parse(res.Data)
+			require.NoError(t, err)
+			require.Len(t, p7.Certificates, len(tt.want))
+			for i, cert := range tt.want {
+				assert.Equal(t, cert.Raw, p7.Certificates[i].Raw, "certificate %d", i)
+			}
+		})
+	}
+}
+
+func TestGetNextCACert(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	next, err := minica.New()
+	require.NoError(t, err)
+
+	auth, err := scep.New(nil, scep.Options{
+		Roots:         []*x509.Certificate{ca.Root},
+		Intermediates: []*x509.Certificate{ca.Intermediate},
+		SignerCert:    ca.Intermediate,
+		Signer:        ca.Signer,
+	})
+	require.NoError(t, err)
+
+	p := &provisioner.SCEP{Type: "SCEP", Name: "scep", ChallengePassword: "password123"}
+	require.NoError(t, p.Init(provisioner.Config{Claims: config.GlobalProvisionerClaims}))
+	ctx := scep.NewContext(context.Background(), auth)
+	ctx = scep.NewProvisionerContext(ctx, p)
+
+	_, err = GetNextCACert(ctx)
+	assert.Error(t, err)
+
+	require.NoError(t, auth.SetNextCACertificates([]*x509.Certificate{next.Intermediate}))
+	res, err := GetNextCACert(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "application/x-x509-next-ca-cert", contentHeader(res))
+
+	p7, err := pkcs7.Parse(res.Data)
+	require.NoError(t, err)
+	require.NoError(t, p7.Verify())
+	inner, err := pkcs7.Parse(p7.Content)
+	require.NoError(t, err)
+	require.Len(t, inner.Certificates, 1)
+	assert.Equal(t, next.Intermediate.Raw, inner.Certificates[0].Raw)
+}
+
+func TestPost_errors(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		statusCode  int
+	}{
+		{"fail too large", "application/x-pki-message", strings.Repeat("a", 2048), http.StatusRequestEntityTooLarge},
+		{"fail content type", "application/json", "{}", http.StatusUnsupportedMediaType},
+		{"fail message", "application/x-pki-message", "1234", http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "http://scep:8080/?operation=PKIOperation", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+			r.Body = http.MaxBytesReader(w, r.Body, 1024)
+			Post(w, r)
+			assert.Equal(t, tt.statusCode, w.Result().StatusCode)
+		})
+	}
+}
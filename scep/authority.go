@@ -6,14 +6,14 @@ import (
 	"crypto/x509"
 	"errors"
 	"fmt"
+	"net/url"
+	"slices"
 	"sync"
 
 	"github.com/smallstep/pkcs7"
 	smallscep "github.com/smallstep/scep"
 	smallscepx509util "github.com/smallstep/scep/x509util"
 
-	"go.step.sm/crypto/x509util"
-
 	"github.com/smallstep/certificates/authority/provisioner"
 )
 
@@ -27,9 +27,11 @@ type Authority struct {
 	defaultDecrypter     crypto.Decrypter
 	decrypterCertificate *x509.Certificate
 	scepProvisionerNames []string
+	nextCACertificates   []*x509.Certificate
 
 	provisionersMutex        sync.RWMutex
 	encryptionAlgorithmMutex sync.Mutex
+	nextCAMutex              sync.RWMutex
 }
 
 type authorityKey struct{}
@@ -62,6 +64,7 @@ func MustFromContext(ctx context.Context) *Authority {
 type SignAuthority interface {
 	SignWithContext(ctx context.Context, cr *x509.CertificateRequest, opts provisioner.SignOptions, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error)
 	LoadProvisionerByName(string) (provisioner.Interface, error)
+	IsRevoked(sn string) (bool, error)
 }
 
 // New returns a new Authority that implements the SCEP interface.
@@ -79,6 +82,7 @@ func New(signAuth SignAuthority, opts Options) (*Authority, error) {
 		defaultDecrypter:     opts.Decrypter,
 		decrypterCertificate: opts.SignerCert, // the intermediate signer cert is also the decrypter cert (if RSA)
 		scepProvisionerNames: opts.SCEPProvisionerNames,
+		nextCACertificates:   opts.NextCACertificates,
 	}, nil
 }
 
@@ -162,8 +166,8 @@ func (a *Authority) GetCACertificates(ctx context.Context) (certs []*x509.Certif
 	p := provisionerFromContext(ctx)
 
 	// if a provisioner specific RSA decrypter is available, it is returned as
-	// the first certificate.
-	if decrypterCertificate, _ := p.GetDecrypter(); decrypterCertificate != nil {
+	// the first certificate, unless it's excluded through configuration.
+	if decrypterCertificate, _ := p.GetDecrypter(); decrypterCertificate != nil && p.ShouldIncludeRAInChain() {
 		certs = append(certs, decrypterCertificate)
 	}
 
@@ -183,9 +187,68 @@ func (a *Authority) GetCACertificates(ctx context.Context) (certs []*x509.Certif
 		certs = append(certs, a.roots...)
 	}
 
+	// some clients expect the CA certificate first, so the order of the
+	// certificates can be reversed through configuration.
+	if p.GetChainOrder() == provisioner.SCEPChainOrderCAFirst {
+		slices.Reverse(certs)
+	}
+
 	return certs, nil
 }
 
+// SetNextCACertificates stages the certificates that will be returned in the
+// GetNextCACert operation, so that clients can fetch the upcoming CA
+// certificate before a CA rollover. The first certificate must be the next
+// issuing CA certificate. Passing an empty list removes the staged
+// certificates.
+func (a *Authority) SetNextCACertificates(certs []*x509.Certificate) error {
+	if len(certs) > 0 && !certs[0].IsCA {
+		return errors.New("next CA certificate is not a CA certificate")
+	}
+	a.nextCAMutex.Lock()
+	a.nextCACertificates = slices.Clone(certs)
+	a.nextCAMutex.Unlock()
+	return nil
+}
+
+// GetNextCACertificates returns the certificates staged for a CA rollover.
+func (a *Authority) GetNextCACertificates() []*x509.Certificate {
+	a.nextCAMutex.RLock()
+	defer a.nextCAMutex.RUnlock()
+	return slices.Clone(a.nextCACertificates)
+}
+
+// GetNextCACert returns the response of the GetNextCACert operation, a
+// degenerate certificates-only PKCS#7 with the staged certificates, signed by
+// the current CA or RA signer, as defined in
+// https://tools.ietf.org/html/rfc8894#section-4.7.
+func (a *Authority) GetNextCACert(ctx context.Context) ([]byte, error) {
+	certs := a.GetNextCACertificates()
+	if len(certs) == 0 {
+		return nil, errors.New("next CA certificate is not available")
+	}
+
+	deg, err := smallscep.DegenerateCertificates(certs)
+	if err != nil {
+		return nil, fmt.Errorf("failed generating degenerate certificates: %w", err)
+	}
+
+	signedData, err := pkcs7.NewSignedData(deg)
+	if err != nil {
+		return nil, err
+	}
+
+	signerCert, signer, err := a.selectSigner(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed selecting signer: %w", err)
+	}
+	if err := signedData.AddSigner(signerCert, signer, pkcs7.SignerInfoConfig{}); err != nil {
+		return nil, err
+	}
+
+	return signedData.Finish()
+}
+
 // DecryptPKIEnvelope decrypts an enveloped message
 func (a *Authority) DecryptPKIEnvelope(ctx context.Context, msg *PKIMessage) error {
 	p7c, err := pkcs7.Parse(msg.P7.Content)
@@ -257,55 +320,19 @@ func (a *Authority) SignCSR(ctx context.Context, csr *x509.CertificateRequest, m
 		csr = msg.CSRReqMessage.CSR
 	}
 
-	// Template data
-	sans := []string{}
-	sans = append(sans, csr.DNSNames...)
-	sans = append(sans, csr.EmailAddresses...)
-	for _, v := range csr.IPAddresses {
-		sans = append(sans, v.String())
-	}
-	for _, v := range csr.URIs {
-		sans = append(sans, v.String())
-	}
-	if len(sans) == 0 {
-		sans = append(sans, csr.Subject.CommonName)
-	}
-	data := x509util.CreateTemplateData(csr.Subject.CommonName, sans)
-	data.SetCertificateRequest(csr)
-	data.SetSubject(x509util.Subject{
-		Country:            csr.Subject.Country,
-		Organization:       csr.Subject.Organization,
-		OrganizationalUnit: csr.Subject.OrganizationalUnit,
-		Locality:           csr.Subject.Locality,
-		Province:           csr.Subject.Province,
-		StreetAddress:      csr.Subject.StreetAddress,
-		PostalCode:         csr.Subject.PostalCode,
-		SerialNumber:       csr.Subject.SerialNumber,
-		CommonName:         csr.Subject.CommonName,
-	})
-
-	// Get authorizations from the SCEP provisioner.
+	// Get authorizations from the SCEP provisioner. The CSR and the
+	// transaction id are used to create the template data.
 	ctx = provisioner.NewContextWithMethod(ctx, provisioner.SignMethod)
+	ctx = provisioner.NewContextWithSCEPRequest(ctx, &provisioner.SCEPRequest{
+		CSR:           csr,
+		TransactionID: string(msg.TransactionID),
+	})
 	signOps, err := p.AuthorizeSign(ctx, "")
 	if err != nil {
 		return nil, fmt.Errorf("error retrieving authorization options from SCEP provisioner: %w", err)
 	}
-	// Unlike most of the provisioners, scep's AuthorizeSign method doesn't
-	// define the templates, and the template data used in WebHooks is not
-	// available.
-	for _, signOp := range signOps {
-		if wc, ok := signOp.(*provisioner.WebhookController); ok {
-			wc.TemplateData = data
-		}
-	}
 
 	opts := provisioner.SignOptions{}
-	templateOptions, err := provisioner.TemplateOptions(p.GetOptions(), data)
-	if err != nil {
-		return nil, fmt.Errorf("error creating template options from SCEP provisioner: %w", err)
-	}
-	signOps = append(signOps, templateOptions)
-
 	certChain, err := a.signAuth.SignWithContext(ctx, csr, opts, signOps...)
 	if err != nil {
 		return nil, fmt.Errorf("error generating certificate: %w", err)
@@ -494,6 +521,10 @@ func (a *Authority) GetCACaps(ctx context.Context) []string {
 
 	caps := p.GetCapabilities()
 	if len(caps) == 0 {
+		// advertise the GetNextCACert operation if a CA rollover is staged
+		if len(a.GetNextCACertificates()) > 0 {
+			return append(slices.Clone(defaultCapabilities), "GetNextCACert")
+		}
 		return defaultCapabilities
 	}
 
@@ -511,6 +542,87 @@ func (a *Authority) ValidateChallenge(ctx context.Context, csr *x509.Certificate
 	return p.ValidateChallenge(ctx, csr, challenge, transactionID)
 }
 
+// IsRenewalAllowed returns true if the provisioner accepts RenewalReq messages
+// authenticated by an existing certificate.
+func (a *Authority) IsRenewalAllowed(ctx context.Context) bool {
+	p := provisionerFromContext(ctx)
+	return p.ShouldAllowRenewal()
+}
+
+// ValidateRenewal authenticates a RenewalReq using the certificate that signed
+// the PKCS#7 envelope. The certificate must chain up to the CA, must not be
+// revoked, and must be accepted by the provisioner. The CSR must not request
+// a subject or SANs not present in the certificate.
+func (a *Authority) ValidateRenewal(ctx context.Context, csr *x509.CertificateRequest, msg *PKIMessage) error {
+	p := provisionerFromContext(ctx)
+
+	cert := msg.P7.GetOnlySigner()
+	if cert == nil {
+		return errors.New("renewal request must be signed by a single certificate")
+	}
+
+	roots := x509.NewCertPool()
+	for _, root := range a.roots {
+		roots.AddCert(root)
+	}
+	intermediates := x509.NewCertPool()
+	for _, intermediate := range a.intermediates {
+		intermediates.AddCert(intermediate)
+	}
+	if _, err := cert.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return fmt.Errorf("renewal certificate was not issued by the CA: %w", err)
+	}
+
+	if a.signAuth != nil {
+		isRevoked, err := a.signAuth.IsRevoked(cert.SerialNumber.String())
+		if err != nil {
+			return fmt.Errorf("failed checking certificate revocation: %w", err)
+		}
+		if isRevoked {
+			return errors.New("renewal certificate has been revoked")
+		}
+	}
+
+	if err := p.AuthorizeRenewal(ctx, cert); err != nil {
+		return err
+	}
+
+	return validateRenewalCSR(csr, cert)
+}
+
+// validateRenewalCSR checks that the common name and the SANs requested in a
+// renewal CSR are present in the certificate being renewed.
+func validateRenewalCSR(csr *x509.CertificateRequest, cert *x509.Certificate) error {
+	if csr.Subject.CommonName != cert.Subject.CommonName {
+		return fmt.Errorf("renewal common name %q does not match the certificate", csr.Subject.CommonName)
+	}
+	for _, name := range csr.DNSNames {
+		if !slices.Contains(cert.DNSNames, name) {
+			return fmt.Errorf("renewal dns name %q is not in the certificate", name)
+		}
+	}
+	for _, email := range csr.EmailAddresses {
+		if !slices.Contains(cert.EmailAddresses, email) {
+			return fmt.Errorf("renewal email address %q is not in the certificate", email)
+		}
+	}
+	for _, ip := range csr.IPAddresses {
+		if !slices.ContainsFunc(cert.IPAddresses, ip.Equal) {
+			return fmt.Errorf("renewal ip address %q is not in the certificate", ip)
+		}
+	}
+	for _, u := range csr.URIs {
+		if !slices.ContainsFunc(cert.URIs, func(v *url.URL) bool { return v.String() == u.String() }) {
+			return fmt.Errorf("renewal uri %q is not in the certificate", u)
+		}
+	}
+	return nil
+}
+
 func (a *Authority) NotifySuccess(ctx context.Context, csr *x509.CertificateRequest, cert *x509.Certificate, transactionID string) error {
 	p := provisionerFromContext(ctx)
 	return p.NotifySuccess(ctx, csr, cert, transactionID)
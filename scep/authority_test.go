@@ -1,9 +1,13 @@
 package scep
 
 import (
+	"context"
+	"crypto"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/smallstep/pkcs7"
 	"github.com/stretchr/testify/assert"
@@ -11,6 +15,9 @@ import (
 	"go.step.sm/crypto/keyutil"
 	"go.step.sm/crypto/minica"
 	"go.step.sm/crypto/randutil"
+
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
 )
 
 func generateContent(t *testing.T, size int) []byte {
@@ -71,3 +78,179 @@ func TestAuthority_encrypt(t *testing.T) {
 		})
 	}
 }
+
+type mockSignAuthority struct {
+	SignAuthority
+	isRevoked func(sn string) (bool, error)
+}
+
+func (m *mockSignAuthority) IsRevoked(sn string) (bool, error) {
+	return m.isRevoked(sn)
+}
+
+func TestAuthority_ValidateRenewal(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	other, err := minica.New()
+	require.NoError(t, err)
+
+	signer, err := keyutil.GenerateSigner("RSA", "", 2048)
+	require.NoError(t, err)
+	newCertWithExtension := func(t *testing.T, ca *minica.CA, notAfter time.Time, ext *provisioner.Extension) *x509.Certificate {
+		t.Helper()
+		tpl := &x509.Certificate{
+			Subject:   pkix.Name{CommonName: "device"},
+			DNSNames:  []string{"device.example.com"},
+			PublicKey: signer.Public(),
+			NotBefore: time.Now().Add(-time.Hour),
+			NotAfter:  notAfter,
+		}
+		if ext != nil {
+			e, err := ext.ToExtension()
+			require.NoError(t, err)
+			tpl.ExtraExtensions = append(tpl.ExtraExtensions, e)
+		}
+		cert, err := ca.Sign(tpl)
+		require.NoError(t, err)
+		return cert
+	}
+	newCert := func(t *testing.T, ca *minica.CA, notAfter time.Time) *x509.Certificate {
+		t.Helper()
+		return newCertWithExtension(t, ca, notAfter, &provisioner.Extension{Type: provisioner.TypeSCEP, Name: "scep"})
+	}
+	newMessage := func(t *testing.T, cert *x509.Certificate) *PKIMessage {
+		t.Helper()
+		sd, err := pkcs7.NewSignedData([]byte("content"))
+		require.NoError(t, err)
+		require.NoError(t, sd.AddSigner(cert, signer.(crypto.PrivateKey), pkcs7.SignerInfoConfig{}))
+		b, err := sd.Finish()
+		require.NoError(t, err)
+		p7, err := pkcs7.Parse(b)
+		require.NoError(t, err)
+		return &PKIMessage{P7: p7}
+	}
+	newProvisioner := func(t *testing.T, allowRenewal bool) *provisioner.SCEP {
+		t.Helper()
+		p := &provisioner.SCEP{
+			Type:                        "SCEP",
+			Name:                        "scep",
+			AllowRenewal:                allowRenewal,
+			RenewalMinRemainingLifetime: &provisioner.Duration{Duration: time.Hour},
+		}
+		require.NoError(t, p.Init(provisioner.Config{Claims: config.GlobalProvisionerClaims}))
+		return p
+	}
+
+	revokedSerial := ""
+	a := &Authority{
+		signAuth: &mockSignAuthority{isRevoked: func(sn string) (bool, error) {
+			if sn == "error" {
+				return false, errors.New("force")
+			}
+			return sn == revokedSerial, nil
+		}},
+		roots:         []*x509.Certificate{ca.Root},
+		intermediates: []*x509.Certificate{ca.Intermediate},
+	}
+
+	valid := newCert(t, ca, time.Now().Add(24*time.Hour))
+	revoked := newCert(t, ca, time.Now().Add(24*time.Hour))
+	revokedSerial = revoked.SerialNumber.String()
+	csr := &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "device"},
+		DNSNames: []string{"device.example.com"},
+	}
+
+	tests := []struct {
+		name        string
+		p           *provisioner.SCEP
+		csr         *x509.CertificateRequest
+		msg         *PKIMessage
+		expectedErr string
+	}{
+		{"ok", newProvisioner(t, true), csr, newMessage(t, valid), ""},
+		{"ok no sans", newProvisioner(t, true), &x509.CertificateRequest{
+			Subject: pkix.Name{CommonName: "device"},
+		}, newMessage(t, valid), ""},
+		{"fail disabled", newProvisioner(t, false), csr, newMessage(t, valid), `renewal is not enabled for provisioner "scep"`},
+		{"fail other ca", newProvisioner(t, true), csr, newMessage(t, newCert(t, other, time.Now().Add(24*time.Hour))), "renewal certificate was not issued by the CA"},
+		{"fail expired", newProvisioner(t, true), csr, newMessage(t, newCert(t, ca, time.Now().Add(-time.Minute))), "renewal certificate was not issued by the CA"},
+		{"fail revoked", newProvisioner(t, true), csr, newMessage(t, revoked), "renewal certificate has been revoked"},
+		{"fail no provisioner", newProvisioner(t, true), csr, newMessage(t, newCertWithExtension(t, ca, time.Now().Add(24*time.Hour), nil)), `certificate was not issued by provisioner "scep"`},
+		{"fail other provisioner", newProvisioner(t, true), csr, newMessage(t, newCertWithExtension(t, ca, time.Now().Add(24*time.Hour), &provisioner.Extension{Type: provisioner.TypeSCEP, Name: "other"})), `certificate was not issued by provisioner "scep"`},
+		{"fail other provisioner type", newProvisioner(t, true), csr, newMessage(t, newCertWithExtension(t, ca, time.Now().Add(24*time.Hour), &provisioner.Extension{Type: provisioner.TypeJWK, Name: "scep"})), `certificate was not issued by provisioner "scep"`},
+		{"fail remaining lifetime", newProvisioner(t, true), csr, newMessage(t, newCert(t, ca, time.Now().Add(30*time.Minute))), "certificate remaining lifetime is less than 1h0m0s"},
+		{"fail common name", newProvisioner(t, true), &x509.CertificateRequest{
+			Subject: pkix.Name{CommonName: "other"},
+		}, newMessage(t, valid), `renewal common name "other" does not match the certificate`},
+		{"fail dns names", newProvisioner(t, true), &x509.CertificateRequest{
+			Subject:  pkix.Name{CommonName: "device"},
+			DNSNames: []string{"device.example.com", "other.example.com"},
+		}, newMessage(t, valid), `renewal dns name "other.example.com" is not in the certificate`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := NewProvisionerContext(context.Background(), tt.p)
+			err := a.ValidateRenewal(ctx, tt.csr, tt.msg)
+			if tt.expectedErr != "" {
+				assert.ErrorContains(t, err, tt.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestAuthority_SetNextCACertificates(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	next, err := minica.New()
+	require.NoError(t, err)
+
+	auth, err := New(nil, Options{
+		Roots:         []*x509.Certificate{ca.Root},
+		Intermediates: []*x509.Certificate{ca.Intermediate},
+		SignerCert:    ca.Intermediate,
+		Signer:        ca.Signer,
+	})
+	require.NoError(t, err)
+
+	p := &provisioner.SCEP{Type: "SCEP", Name: "scep", ChallengePassword: "password123"}
+	require.NoError(t, p.Init(provisioner.Config{Claims: config.GlobalProvisionerClaims}))
+	ctx := NewProvisionerContext(context.Background(), p)
+
+	_, err = auth.GetNextCACert(ctx)
+	assert.EqualError(t, err, "next CA certificate is not available")
+	assert.NotContains(t, auth.GetCACaps(ctx), "GetNextCACert")
+
+	leaf, err := next.Sign(&x509.Certificate{
+		Subject:   pkix.Name{CommonName: "leaf"},
+		PublicKey: ca.Intermediate.PublicKey,
+	})
+	require.NoError(t, err)
+	assert.EqualError(t, auth.SetNextCACertificates([]*x509.Certificate{leaf}),
+		"next CA certificate is not a CA certificate")
+
+	require.NoError(t, auth.SetNextCACertificates([]*x509.Certificate{next.Intermediate, next.Root}))
+	assert.Equal(t, []*x509.Certificate{next.Intermediate, next.Root}, auth.GetNextCACertificates())
+	assert.Contains(t, auth.GetCACaps(ctx), "GetNextCACert")
+
+	b, err := auth.GetNextCACert(ctx)
+	require.NoError(t, err)
+	p7, err := pkcs7.Parse(b)
+	require.NoError(t, err)
+	require.NoError(t, p7.Verify())
+	signer := p7.GetOnlySigner()
+	require.NotNil(t, signer)
+	assert.Equal(t, ca.Intermediate.Raw, signer.Raw)
+
+	inner, err := pkcs7.Parse(p7.Content)
+	require.NoError(t, err)
+	require.Len(t, inner.Certificates, 2)
+	assert.Equal(t, next.Intermediate.Raw, inner.Certificates[0].Raw)
+	assert.Equal(t, next.Root.Raw, inner.Certificates[1].Raw)
+
+	require.NoError(t, auth.SetNextCACertificates(nil))
+	assert.Empty(t, auth.GetNextCACertificates())
+	assert.NotContains(t, auth.GetCACaps(ctx), "GetNextCACert")
+}
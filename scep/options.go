@@ -22,6 +22,9 @@ type Options struct {
 	Decrypter crypto.Decrypter `json:"-"`
 	// DecrypterCert points to the certificate of the CA decrypter.
 	DecrypterCert *x509.Certificate `json:"-"`
+	// NextCACertificates are the certificates returned in the GetNextCACert
+	// operation, the first one being the next issuing CA certificate.
+	NextCACertificates []*x509.Certificate `json:"-"`
 	// SCEPProvisionerNames contains the currently configured SCEP provioner names. These
 	// are used to be able to load the provisioners when the SCEP authority is being
 	// validated.
@@ -17,6 +17,10 @@ type Provisioner interface {
 	GetCapabilities() []string
 	ShouldIncludeRootInChain() bool
 	ShouldIncludeIntermediateInChain() bool
+	ShouldIncludeRAInChain() bool
+	GetChainOrder() provisioner.SCEPChainOrder
+	ShouldAllowRenewal() bool
+	AuthorizeRenewal(ctx context.Context, cert *x509.Certificate) error
 	GetDecrypter() (*x509.Certificate, crypto.Decrypter)
 	GetSigner() (*x509.Certificate, crypto.Signer)
 	GetContentEncryptionAlgorithm() int
@@ -1,7 +1,11 @@
 package webhook
 
 import (
+	"bytes"
 	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"time"
 
 	"go.step.sm/crypto/sshutil"
 	"go.step.sm/crypto/x509util"
@@ -61,6 +65,48 @@ func WithX509Certificate(cert *x509util.Certificate, leaf *x509.Certificate) Req
 	}
 }
 
+// WithCertificateIssued sets the certificate issued event with the given
+// certificate chain. The first certificate in the chain is the issued one.
+func WithCertificateIssued(chain []*x509.Certificate, provisionerType, requestID string) RequestBodyOption {
+	return func(rb *RequestBody) error {
+		if len(chain) == 0 {
+			return errors.New("certificate chain cannot be empty")
+		}
+		var buf bytes.Buffer
+		for _, crt := range chain {
+			if err := pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: crt.Raw}); err != nil {
+				return err
+			}
+		}
+		rb.Event = EventCertificateIssued
+		rb.CertificateIssued = &CertificateIssued{
+			SerialNumber:    chain[0].SerialNumber.String(),
+			ProvisionerType: provisionerType,
+			RequestID:       requestID,
+			PEM:             buf.String(),
+		}
+		return nil
+	}
+}
+
+// WithIssuancePending sets the issuance pending event for the signing request
+// with the given id.
+func WithIssuancePending(id, provisionerType, requestID string, expiresAt time.Time) RequestBodyOption {
+	return func(rb *RequestBody) error {
+		if id == "" {
+			return errors.New("pending issuance id cannot be empty")
+		}
+		rb.Event = EventIssuancePending
+		rb.IssuancePending = &IssuancePending{
+			ID:              id,
+			ProvisionerType: provisionerType,
+			RequestID:       requestID,
+			ExpiresAt:       expiresAt,
+		}
+		return nil
+	}
+}
+
 func WithAttestationData(data *AttestationData) RequestBodyOption {
 	return func(rb *RequestBody) error {
 		rb.AttestationData = data
@@ -122,3 +168,17 @@ func WithX5CCertificate(leaf *x509.Certificate) RequestBodyOption {
 		return nil
 	}
 }
+
+func WithACMEOrder(order *ACMEOrder) RequestBodyOption {
+	return func(rb *RequestBody) error {
+		rb.ACMEOrder = order
+		return nil
+	}
+}
+
+func WithACMEAccount(acc *ACMEAccount) RequestBodyOption {
+	return func(rb *RequestBody) error {
+		rb.ACMEAccount = acc
+		return nil
+	}
+}
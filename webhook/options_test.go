@@ -3,6 +3,7 @@ package webhook
 import (
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"math/big"
 	"testing"
 	"time"
 
@@ -134,6 +135,78 @@ func TestNewRequestBody(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		"ACME Order": {
+			options: []RequestBodyOption{
+				WithACMEOrder(&ACMEOrder{
+					ID:          "oID",
+					Identifiers: []ACMEIdentifier{{Type: "dns", Value: "foo.internal"}},
+				}),
+				WithACMEAccount(&ACMEAccount{
+					ID:      "accID",
+					KeyID:   "kid",
+					Contact: []string{"mailto:jane@example.com"},
+				}),
+			},
+			want: &RequestBody{
+				ACMEOrder: &ACMEOrder{
+					ID:          "oID",
+					Identifiers: []ACMEIdentifier{{Type: "dns", Value: "foo.internal"}},
+				},
+				ACMEAccount: &ACMEAccount{
+					ID:      "accID",
+					KeyID:   "kid",
+					Contact: []string{"mailto:jane@example.com"},
+				},
+			},
+			wantErr: false,
+		},
+		"Certificate Issued": {
+			options: []RequestBodyOption{
+				WithCertificateIssued([]*x509.Certificate{
+					{Raw: []byte("leaf"), SerialNumber: big.NewInt(1234)},
+					{Raw: []byte("intermediate"), SerialNumber: big.NewInt(1)},
+				}, "JWK", "request-id"),
+			},
+			want: &RequestBody{
+				Event: EventCertificateIssued,
+				CertificateIssued: &CertificateIssued{
+					SerialNumber:    "1234",
+					ProvisionerType: "JWK",
+					RequestID:       "request-id",
+					PEM:             "-----BEGIN CERTIFICATE-----\nbGVhZg==\n-----END CERTIFICATE-----\n-----BEGIN CERTIFICATE-----\naW50ZXJtZWRpYXRl\n-----END CERTIFICATE-----\n",
+				},
+			},
+			wantErr: false,
+		},
+		"fail/Certificate Issued": {
+			options: []RequestBodyOption{
+				WithCertificateIssued(nil, "JWK", "request-id"),
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		"ok/Issuance Pending": {
+			options: []RequestBodyOption{
+				WithIssuancePending("the-id", "JWK", "request-id", t2),
+			},
+			want: &RequestBody{
+				Event: EventIssuancePending,
+				IssuancePending: &IssuancePending{
+					ID:              "the-id",
+					ProvisionerType: "JWK",
+					RequestID:       "request-id",
+					ExpiresAt:       t2,
+				},
+			},
+			wantErr: false,
+		},
+		"fail/Issuance Pending": {
+			options: []RequestBodyOption{
+				WithIssuancePending("", "JWK", "request-id", t2),
+			},
+			want:    nil,
+			wantErr: true,
+		},
 		"fail/X5C Certificate": {
 			options: []RequestBodyOption{
 				WithX5CCertificate(&x509.Certificate{
@@ -11,6 +11,21 @@ import (
 type ResponseBody struct {
 	Data  any  `json:"data"`
 	Allow bool `json:"allow"`
+	// SSH contains the changes to the SSH certificate requested by enriching
+	// webhooks when signing SSH certificates.
+	SSH *SSHCertificateChanges `json:"ssh,omitempty"`
+}
+
+// SSHCertificateChanges are the changes that enriching webhooks can apply to
+// SSH certificates, without changing the certificate template.
+type SSHCertificateChanges struct {
+	// Principals, if set, replace the principals of the certificate.
+	Principals []string `json:"principals,omitempty"`
+	// AddPrincipals are added to the principals of the certificate.
+	AddPrincipals []string `json:"addPrincipals,omitempty"`
+	// Extensions are added to the extensions of a user certificate,
+	// replacing the ones with the same name.
+	Extensions map[string]string `json:"extensions,omitempty"`
 }
 
 // X509CertificateRequest is the certificate request sent to webhook servers for
@@ -57,6 +72,29 @@ type AttestationData struct {
 	PermanentIdentifier string `json:"permanentIdentifier"`
 }
 
+// ACMEAccount is the ACME account sent to webhook servers for authorizing
+// webhooks when creating or updating ACME accounts.
+type ACMEAccount struct {
+	ID      string   `json:"id,omitempty"`
+	KeyID   string   `json:"keyID"`
+	Contact []string `json:"contact,omitempty"`
+}
+
+// ACMEIdentifier is an identifier of an ACME order validated by the ACME
+// challenges.
+type ACMEIdentifier struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// ACMEOrder is the ACME order sent to webhook servers for enriching or
+// authorizing webhooks when an ACME order is finalized.
+type ACMEOrder struct {
+	ID          string           `json:"id"`
+	Identifiers []ACMEIdentifier `json:"identifiers"`
+	Profile     string           `json:"profile,omitempty"`
+}
+
 // X5CCertificate is the authorization certificate sent to webhook servers for
 // enriching or authorizing webhooks when signing X509 or SSH certificates using
 // the X5C provisioner.
@@ -68,6 +106,33 @@ type X5CCertificate struct {
 	NotAfter           time.Time `json:"notAfter"`
 }
 
+// EventCertificateIssued is the event sent to notifying webhooks after an
+// X.509 certificate is issued.
+const EventCertificateIssued = "certificate.issued"
+
+// CertificateIssued is the issued certificate sent to notifying webhooks with
+// the certificate issued event.
+type CertificateIssued struct {
+	SerialNumber    string `json:"serialNumber"`
+	ProvisionerType string `json:"provisionerType"`
+	RequestID       string `json:"requestID,omitempty"`
+	// PEM contains the PEM encoded certificate followed by its intermediates.
+	PEM string `json:"pem"`
+}
+
+// EventIssuancePending is the event sent to notifying webhooks when an X.509
+// signing request is queued waiting for the approval of an administrator.
+const EventIssuancePending = "issuance.pending"
+
+// IssuancePending is the signing request sent to notifying webhooks with the
+// issuance pending event.
+type IssuancePending struct {
+	ID              string    `json:"id"`
+	ProvisionerType string    `json:"provisionerType"`
+	RequestID       string    `json:"requestID,omitempty"`
+	ExpiresAt       time.Time `json:"expiresAt"`
+}
+
 // RequestBody is the body sent to webhook servers.
 type RequestBody struct {
 	Timestamp       time.Time `json:"timestamp"`
@@ -88,6 +153,14 @@ type RequestBody struct {
 	SCEPErrorDescription string `json:"scepErrorDescription,omitempty"`
 	// Only set for X5C provisioners
 	X5CCertificate *X5CCertificate `json:"x5cCertificate,omitempty"`
+	// Only set for ACME account webhook requests and finalized ACME orders
+	ACMEAccount *ACMEAccount `json:"acmeAccount,omitempty"`
+	// Only set for finalized ACME orders
+	ACMEOrder *ACMEOrder `json:"acmeOrder,omitempty"`
 	// Set for X5C, AWS, GCP, and Azure provisioners
 	AuthorizationPrincipal string `json:"authorizationPrincipal,omitempty"`
+	// Only set for notifying webhooks of events
+	Event             string             `json:"event,omitempty"`
+	CertificateIssued *CertificateIssued `json:"certificateIssued,omitempty"`
+	IssuancePending   *IssuancePending   `json:"issuancePending,omitempty"`
 }